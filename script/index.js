@@ -12,12 +12,16 @@ var events = require('./src/events')
 // this needs to be called on module level as otherwise the value will be undefined
 // again when being accessed from inside a function body
 var accountId = document.currentScript && document.currentScript.dataset.accountId
+var writeKey = document.currentScript && document.currentScript.dataset.writeKey
 var scriptHost = document.currentScript && document.currentScript.src
 var useApi = document.currentScript && 'useApi' in document.currentScript.dataset
 
+// The script might be served below a path prefix in case the instance is
+// proxied from the domain of the embedding site, so the vault is expected to
+// live next to the script.
 var scriptUrl = ''
 try {
-  scriptUrl = new window.URL(scriptHost).origin
+  scriptUrl = new window.URL('.', scriptHost).toString().replace(/\/$/, '')
 } catch (err) {}
 
 function main () {
@@ -25,6 +29,10 @@ function main () {
   if (accountId) {
     vaultUrl.searchParams.set('accountId', accountId)
   }
+  // accounts using write keys only accept events from pages embedding the key
+  if (writeKey) {
+    vaultUrl.searchParams.set('writeKey', writeKey)
+  }
   var app = router(vaultUrl.toString())
   app.on('PAGEVIEW', supportMiddleware, function (context, send, next) {
     var message = {
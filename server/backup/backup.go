@@ -0,0 +1,228 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package backup creates encrypted snapshots of the entire database and
+// keeps a rotating set of them in one or more object stores.
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/persistence"
+)
+
+const (
+	archiveVersion = 1
+	archiveSuffix  = ".backup"
+	keyTimeFormat  = "20060102T150405Z"
+)
+
+// Store persists backup archives. It is satisfied by *s3.Client.
+type Store interface {
+	Put(key, contentType string, body []byte) error
+	Get(key string) ([]byte, error)
+	List(prefix string) ([]string, error)
+	Delete(key string) error
+}
+
+type archive struct {
+	Version int    `json:"version"`
+	Salt    string `json:"salt"`
+	Data    string `json:"data"`
+}
+
+// Encrypt serializes and compresses the given snapshot and encrypts it
+// using a key derived from the given passphrase.
+func Encrypt(snapshot *persistence.Snapshot, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("backup: passphrase cannot be empty")
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		return nil, fmt.Errorf("backup: error encoding snapshot: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("backup: error compressing snapshot: %w", err)
+	}
+
+	salt, err := keys.NewSalt(keys.DefaultSecretLength)
+	if err != nil {
+		return nil, fmt.Errorf("backup: error creating salt: %w", err)
+	}
+	key, err := keys.DeriveKey(passphrase, salt.Marshal())
+	if err != nil {
+		return nil, fmt.Errorf("backup: error deriving key: %w", err)
+	}
+	cipher, err := keys.EncryptWith(key, buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("backup: error encrypting snapshot: %w", err)
+	}
+	return json.Marshal(archive{
+		Version: archiveVersion,
+		Salt:    salt.Marshal(),
+		Data:    cipher.Marshal(),
+	})
+}
+
+// Decrypt reverses Encrypt.
+func Decrypt(data []byte, passphrase string) (*persistence.Snapshot, error) {
+	var a archive
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("backup: error decoding archive: %w", err)
+	}
+	if a.Version != archiveVersion {
+		return nil, fmt.Errorf("backup: unsupported archive version %d", a.Version)
+	}
+	key, err := keys.DeriveKey(passphrase, a.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("backup: error deriving key: %w", err)
+	}
+	compressed, err := keys.DecryptWith(key, a.Data)
+	if err != nil {
+		return nil, fmt.Errorf("backup: error decrypting archive, check the passphrase: %w", err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("backup: error decompressing archive: %w", err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("backup: error decompressing archive: %w", err)
+	}
+	var snapshot persistence.Snapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return nil, fmt.Errorf("backup: error decoding snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// List returns the keys of all backups in the given store, oldest first.
+func List(store Store, prefix string) ([]string, error) {
+	keys, err := store.List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("backup: error listing backups: %w", err)
+	}
+	var result []string
+	for _, key := range keys {
+		if strings.HasSuffix(key, archiveSuffix) {
+			result = append(result, key)
+		}
+	}
+	// keys embed their creation time in a lexically sortable format
+	sort.Strings(result)
+	return result, nil
+}
+
+// Fetch downloads and decrypts the backup stored under the given key. In
+// case key is empty, the most recent backup is used.
+func Fetch(store Store, prefix, key, passphrase string) (*persistence.Snapshot, error) {
+	if key == "" {
+		keys, err := List(store, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("backup: no backups found using prefix %s", prefix)
+		}
+		key = keys[len(keys)-1]
+	}
+	data, err := store.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("backup: error downloading backup %s: %w", key, err)
+	}
+	return Decrypt(data, passphrase)
+}
+
+// Manager periodically creates backups and uploads them to all of the
+// given stores. Using stores in different regions guards against the outage
+// of a single provider or region.
+type Manager struct {
+	DB         persistence.Service
+	Stores     []Store
+	Prefix     string
+	Passphrase string
+	// Retention is the number of backups to keep in each store. Zero keeps
+	// all backups.
+	Retention int
+}
+
+// Backup creates a single backup and uploads it to all stores, pruning
+// backups that exceed the retention count afterwards. Failing stores do not
+// prevent the backup from being uploaded to the remaining ones.
+func (m *Manager) Backup() (string, error) {
+	snapshot, err := m.DB.Dump()
+	if err != nil {
+		return "", fmt.Errorf("backup: error creating snapshot: %w", err)
+	}
+	data, err := Encrypt(snapshot, m.Passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	key := fmt.Sprintf("%soffen-%s%s", m.Prefix, time.Now().UTC().Format(keyTimeFormat), archiveSuffix)
+	var errs []error
+	for i, store := range m.Stores {
+		if err := store.Put(key, "application/json", data); err != nil {
+			errs = append(errs, fmt.Errorf("backup: error uploading to store %d: %w", i, err))
+			continue
+		}
+		if err := m.prune(store); err != nil {
+			errs = append(errs, fmt.Errorf("backup: error pruning store %d: %w", i, err))
+		}
+	}
+	return key, errors.Join(errs...)
+}
+
+func (m *Manager) prune(store Store) error {
+	if m.Retention <= 0 {
+		return nil
+	}
+	keys, err := List(store, m.Prefix)
+	if err != nil {
+		return err
+	}
+	if len(keys) <= m.Retention {
+		return nil
+	}
+	for _, key := range keys[:len(keys)-m.Retention] {
+		if err := store.Delete(key); err != nil {
+			return fmt.Errorf("backup: error deleting backup %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Run creates a backup in the given interval until the context is canceled.
+func (m *Manager) Run(ctx context.Context, interval time.Duration, onSuccess func(string), onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			key, err := m.Backup()
+			if err != nil {
+				if onError != nil {
+					onError(err)
+				}
+				continue
+			}
+			if onSuccess != nil {
+				onSuccess(key)
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package backup
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockStore struct {
+	objects map[string][]byte
+	putErr  error
+}
+
+func (m *mockStore) Put(key, contentType string, body []byte) error {
+	if m.putErr != nil {
+		return m.putErr
+	}
+	m.objects[key] = body
+	return nil
+}
+
+func (m *mockStore) Get(key string) ([]byte, error) {
+	b, ok := m.objects[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return b, nil
+}
+
+func (m *mockStore) List(prefix string) ([]string, error) {
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockStore) Delete(key string) error {
+	delete(m.objects, key)
+	return nil
+}
+
+type mockDumpDatabase struct {
+	persistence.Service
+	snapshot *persistence.Snapshot
+}
+
+func (m *mockDumpDatabase) Dump() (*persistence.Snapshot, error) {
+	return m.snapshot, nil
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	snapshot := &persistence.Snapshot{
+		Accounts: []persistence.Account{{AccountID: "account-a", Name: "name"}},
+		Events:   []persistence.Event{{EventID: "event-a", AccountID: "account-a", Payload: "payload"}},
+	}
+	data, err := Encrypt(snapshot, "passphrase")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if strings.Contains(string(data), "payload") {
+		t.Errorf("Expected archive to be encrypted, got %s", string(data))
+	}
+
+	if _, err := Decrypt(data, "other"); err == nil {
+		t.Error("Expected error when using wrong passphrase")
+	}
+	result, err := Decrypt(data, "passphrase")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(result.Accounts, snapshot.Accounts) || !reflect.DeepEqual(result.Events, snapshot.Events) {
+		t.Errorf("Unexpected result %v", result)
+	}
+
+	if _, err := Encrypt(snapshot, ""); err == nil {
+		t.Error("Expected error when using empty passphrase")
+	}
+}
+
+func TestManager_Backup(t *testing.T) {
+	primary := &mockStore{objects: map[string][]byte{
+		"backups/offen-20220101T000000Z.backup": []byte("a"),
+		"backups/offen-20220102T000000Z.backup": []byte("b"),
+		"backups/offen-20220103T000000Z.backup": []byte("c"),
+		"backups/unrelated.txt":                 []byte("d"),
+	}}
+	replica := &mockStore{objects: map[string][]byte{}}
+	broken := &mockStore{objects: map[string][]byte{}, putErr: errors.New("did not work")}
+
+	m := &Manager{
+		DB:         &mockDumpDatabase{snapshot: &persistence.Snapshot{Accounts: []persistence.Account{{AccountID: "account-a"}}}},
+		Stores:     []Store{primary, broken, replica},
+		Prefix:     "backups/",
+		Passphrase: "passphrase",
+		Retention:  2,
+	}
+	key, err := m.Backup()
+	if err == nil {
+		t.Error("Expected error for failing store")
+	}
+	if !strings.HasPrefix(key, "backups/offen-") {
+		t.Errorf("Unexpected key %s", key)
+	}
+
+	keys, _ := List(primary, "backups/")
+	if !reflect.DeepEqual(keys, []string{"backups/offen-20220103T000000Z.backup", key}) {
+		t.Errorf("Unexpected keys after pruning %v", keys)
+	}
+	if _, ok := primary.objects["backups/unrelated.txt"]; !ok {
+		t.Error("Expected unrelated object to be retained")
+	}
+	if _, ok := replica.objects[key]; !ok {
+		t.Errorf("Expected backup to be uploaded to replica, got %v", replica.objects)
+	}
+
+	snapshot, err := Fetch(replica, "backups/", "", "passphrase")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(snapshot.Accounts) != 1 || snapshot.Accounts[0].AccountID != "account-a" {
+		t.Errorf("Unexpected snapshot %v", snapshot)
+	}
+
+	if _, err := Fetch(broken, "backups/", "", "passphrase"); err == nil {
+		t.Error("Expected error fetching from empty store")
+	}
+}
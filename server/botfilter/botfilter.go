@@ -0,0 +1,94 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package botfilter detects requests issued by crawlers and other automated
+// clients using heuristics on their User-Agent header and address. The
+// default heuristics are embedded from crawlers.txt, which is updated with
+// each release.
+package botfilter
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+//go:embed crawlers.txt
+var crawlers string
+
+// Filter matches requests against a list of heuristics.
+type Filter struct {
+	agents   []string
+	networks []*net.IPNet
+}
+
+// Parse reads a list of heuristics from r. Each line is expected to be
+// either blank, a comment starting with #, a User-Agent substring prefixed
+// with "ua:" or a network in CIDR notation prefixed with "ip:".
+func Parse(r io.Reader) (*Filter, error) {
+	f := &Filter{}
+	scanner := bufio.NewScanner(r)
+	var line int
+	for scanner.Scan() {
+		line++
+		value := strings.TrimSpace(scanner.Text())
+		if value == "" || strings.HasPrefix(value, "#") {
+			continue
+		}
+		kind, pattern, ok := strings.Cut(value, ":")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("botfilter: malformed heuristic in line %d", line)
+		}
+		switch kind {
+		case "ua":
+			f.agents = append(f.agents, strings.ToLower(pattern))
+		case "ip":
+			_, network, err := net.ParseCIDR(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("botfilter: invalid network in line %d: %w", line, err)
+			}
+			f.networks = append(f.networks, network)
+		default:
+			return nil, fmt.Errorf("botfilter: unknown heuristic %s in line %d", kind, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("botfilter: error reading heuristics: %w", err)
+	}
+	return f, nil
+}
+
+// Default returns a Filter using the embedded heuristics.
+func Default() *Filter {
+	f, err := Parse(strings.NewReader(crawlers))
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// Match returns true if a request using the given User-Agent header and
+// client address is considered to be issued by a bot. Passing a nil address
+// skips matching networks.
+func (f *Filter) Match(userAgent string, ip net.IP) bool {
+	if userAgent != "" {
+		userAgent = strings.ToLower(userAgent)
+		for _, agent := range f.agents {
+			if strings.Contains(userAgent, agent) {
+				return true
+			}
+		}
+	}
+	if ip != nil {
+		for _, network := range f.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
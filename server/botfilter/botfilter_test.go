@@ -0,0 +1,78 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package botfilter
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expectError bool
+	}{
+		{"ok", "# comment\n\nua:somebot\nip:10.0.0.0/8\n", false},
+		{"unknown kind", "path:/robots.txt", true},
+		{"missing pattern", "ua:", true},
+		{"bad network", "ip:10.0.0.0", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(test.input)); (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	f := Default()
+	tests := []struct {
+		name           string
+		userAgent      string
+		ip             net.IP
+		expectedResult bool
+	}{
+		{
+			"browser",
+			"Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0",
+			net.ParseIP("192.0.2.12"),
+			false,
+		},
+		{
+			"crawler by user agent",
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			nil,
+			true,
+		},
+		{
+			"headless browser",
+			"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36",
+			nil,
+			true,
+		},
+		{
+			"crawler by address",
+			"Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			net.ParseIP("66.249.66.1"),
+			true,
+		},
+		{
+			"empty",
+			"",
+			nil,
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := f.Match(test.userAgent, test.ip); result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
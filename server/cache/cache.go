@@ -0,0 +1,133 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package cache defines the store for short lived values that the server
+// uses for caching and rate limiting. Values are kept in memory by default,
+// but can be shared between multiple instances using Redis.
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/offen/offen/server/redis"
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// Cache stores short lived values. Implementations never return errors, as
+// callers are expected to work without any cached values.
+type Cache interface {
+	Get(key string) (string, bool)
+	Set(key, value string, expiry time.Duration)
+	Delete(key string)
+}
+
+// Remote is a Cache that keeps values outside of the current process and
+// therefore might become unavailable. Available reports whether the remote
+// store is currently being used or requests are served from the fallback.
+type Remote interface {
+	Cache
+	Available() bool
+}
+
+// NewLocal creates a Cache that keeps values in memory. Expired values are
+// removed in the given interval.
+func NewLocal(cleanupInterval time.Duration) Cache {
+	return &localCache{gocache.New(gocache.NoExpiration, cleanupInterval)}
+}
+
+type localCache struct {
+	c *gocache.Cache
+}
+
+func (l *localCache) Get(key string) (string, bool) {
+	value, ok := l.c.Get(key)
+	if !ok {
+		return "", false
+	}
+	s, ok := value.(string)
+	return s, ok
+}
+
+func (l *localCache) Set(key, value string, expiry time.Duration) {
+	l.c.Set(key, value, expiry)
+}
+
+func (l *localCache) Delete(key string) {
+	l.c.Delete(key)
+}
+
+// retryAfter is the time a remote cache is not being used after an error
+// occurred, so an outage does not add latency to every single request.
+const retryAfter = time.Second * 5
+
+// NewRedis creates a Remote cache that stores values in Redis using the given
+// prefix for all keys. In case Redis cannot be reached, values are read and
+// written using the given fallback until Redis becomes available again.
+// Errors are passed to onError, which may be nil.
+func NewRedis(client *redis.Client, prefix string, fallback Cache, onError func(error)) Remote {
+	return &redisCache{
+		client:   client,
+		prefix:   prefix,
+		fallback: fallback,
+		onError:  onError,
+	}
+}
+
+type redisCache struct {
+	client      *redis.Client
+	prefix      string
+	fallback    Cache
+	onError     func(error)
+	unavailable atomic.Int64
+}
+
+func (r *redisCache) Available() bool {
+	return time.Now().UnixNano() >= r.unavailable.Load()
+}
+
+func (r *redisCache) fail(err error) {
+	r.unavailable.Store(time.Now().Add(retryAfter).UnixNano())
+	if r.onError != nil {
+		r.onError(err)
+	}
+}
+
+func (r *redisCache) Get(key string) (string, bool) {
+	if !r.Available() {
+		return r.fallback.Get(key)
+	}
+	value, err := r.client.Get(r.prefix + key)
+	if err != nil {
+		if errors.Is(err, redis.ErrNil) {
+			return "", false
+		}
+		r.fail(fmt.Errorf("cache: error reading from redis: %w", err))
+		return r.fallback.Get(key)
+	}
+	return value, true
+}
+
+func (r *redisCache) Set(key, value string, expiry time.Duration) {
+	if r.Available() {
+		err := r.client.Set(r.prefix+key, value, expiry)
+		if err == nil {
+			return
+		}
+		r.fail(fmt.Errorf("cache: error writing to redis: %w", err))
+	}
+	r.fallback.Set(key, value, expiry)
+}
+
+func (r *redisCache) Delete(key string) {
+	// values might have been written to the fallback during an outage
+	r.fallback.Delete(key)
+	if !r.Available() {
+		return
+	}
+	if err := r.client.Del(r.prefix + key); err != nil {
+		r.fail(fmt.Errorf("cache: error deleting from redis: %w", err))
+	}
+}
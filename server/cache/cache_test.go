@@ -0,0 +1,62 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package cache
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/redis"
+)
+
+func TestLocal(t *testing.T) {
+	c := NewLocal(time.Minute)
+	if _, ok := c.Get("key"); ok {
+		t.Error("Expected empty cache")
+	}
+	c.Set("key", "value", time.Minute)
+	if v, ok := c.Get("key"); !ok || v != "value" {
+		t.Errorf("Unexpected result %v, %v", v, ok)
+	}
+	c.Delete("key")
+	if _, ok := c.Get("key"); ok {
+		t.Error("Expected key to be deleted")
+	}
+	c.Set("expiring", "value", time.Millisecond)
+	time.Sleep(time.Millisecond * 5)
+	if _, ok := c.Get("expiring"); ok {
+		t.Error("Expected key to be expired")
+	}
+}
+
+func TestRedis_Unavailable(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	client, _ := redis.New("redis://" + addr)
+	var errs []error
+	c := NewRedis(client, "offen-", NewLocal(time.Minute), func(err error) {
+		errs = append(errs, err)
+	})
+
+	if !c.Available() {
+		t.Error("Expected cache to be available before first use")
+	}
+	c.Set("key", "value", time.Minute)
+	if c.Available() {
+		t.Error("Expected cache to be unavailable after error")
+	}
+	if v, ok := c.Get("key"); !ok || v != "value" {
+		t.Errorf("Expected value to be read from fallback, got %v, %v", v, ok)
+	}
+	c.Delete("key")
+	if _, ok := c.Get("key"); ok {
+		t.Error("Expected key to be deleted from fallback")
+	}
+	if len(errs) != 1 {
+		t.Errorf("Expected a single error while backing off, got %v", errs)
+	}
+}
@@ -12,15 +12,17 @@ import (
 )
 
 const (
-	translationFunc = "__"
-	opening         = '{'
-	closing         = '}'
+	translationFunc       = "__"
+	pluralTranslationFunc = "__n"
+	opening               = '{'
+	closing               = '}'
 )
 
 type token struct {
 	token    string
 	line     int
 	filename string
+	plural   *token
 }
 
 func main() {
@@ -33,7 +35,11 @@ func main() {
 		fmt.Printf("\n")
 		for _, token := range tokens {
 			fmt.Printf("#~ line %d \"%s\"\n", token.line, token.filename)
-			fmt.Printf("gettext(%s)\n", token.token)
+			if token.plural != nil {
+				fmt.Printf("ngettext(%s, %s, n)\n", token.token, token.plural.token)
+			} else {
+				fmt.Printf("gettext(%s)\n", token.token)
+			}
 			fmt.Printf("\n")
 		}
 	}
@@ -73,6 +79,12 @@ func extractFromFile(f string) ([]*token, error) {
 			if token.token == translationFunc && len(brace) > idx+1 {
 				translationStrings = append(translationStrings, &brace[idx+1])
 			}
+			// plural forms pass the singular and the plural string
+			if token.token == pluralTranslationFunc && len(brace) > idx+2 {
+				singular := brace[idx+1]
+				singular.plural = &brace[idx+2]
+				translationStrings = append(translationStrings, &singular)
+			}
 		}
 	}
 	return translationStrings, nil
@@ -4,13 +4,42 @@
 package main
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"os"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/offen/offen/server/backup"
+	chclient "github.com/offen/offen/server/clickhouse"
 	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/dnschallenge"
+	"github.com/offen/offen/server/ingest"
+	"github.com/offen/offen/server/locales"
+	"github.com/offen/offen/server/lock"
+	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/metrics"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/persistence/clickhouse"
+	"github.com/offen/offen/server/persistence/relational"
+	"github.com/offen/offen/server/persistence/replicated"
+	"github.com/offen/offen/server/public"
+	"github.com/offen/offen/server/ratelimiter"
+	"github.com/offen/offen/server/redis"
+	"github.com/offen/offen/server/remotefs"
+	"github.com/offen/offen/server/router"
+	"github.com/offen/offen/server/s3"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
@@ -35,9 +64,9 @@ func newApp(populateMissing, quiet bool, envFileOverride string) *app {
 	}
 
 	logger.SetLevel(cfg.App.LogLevel.LogLevel())
-	if !quiet && !cfg.SMTPConfigured() {
-		logger.Warn("SMTP for transactional email is not configured right now, mail delivery will be unreliable")
-		logger.Warn("Refer to the documentation to find out how to configure SMTP")
+	if !quiet && !cfg.MailerConfigured() {
+		logger.Warn("SMTP or a mail provider for transactional email is not configured right now, mail delivery will be unreliable")
+		logger.Warn("Refer to the documentation to find out how to configure SMTP or a mail provider")
 	}
 	return &app{
 		logger: logger,
@@ -50,14 +79,53 @@ func newLogger() *logrus.Logger {
 }
 
 func newDB(c *config.Config, l *logrus.Logger) (*gorm.DB, error) {
+	return openDB(c, c.Database.ConnectionString.String(), l)
+}
+
+// newReplicaDBs opens a connection to each of the configured read replicas.
+func newReplicaDBs(c *config.Config, l *logrus.Logger) ([]*gorm.DB, error) {
+	var result []*gorm.DB
+	for i, dsn := range c.Database.ReadReplicas {
+		db, err := openDB(c, dsn.String(), l)
+		if err != nil {
+			return nil, fmt.Errorf("error opening read replica %d: %w", i, err)
+		}
+		result = append(result, db)
+	}
+	return result, nil
+}
+
+func openDB(c *config.Config, connectionString string, l *logrus.Logger) (*gorm.DB, error) {
 	var d gorm.Dialector
 	switch c.Database.Dialect.String() {
 	case "sqlite3":
-		d = sqlite.Open(c.Database.ConnectionString.String())
-	case "mysql":
-		d = mysql.Open(c.Database.ConnectionString.String())
-	case "postgres":
-		d = postgres.Open(c.Database.ConnectionString.String())
+		if c.Database.SQLCipher {
+			key, err := sqlcipherKey(c)
+			if err != nil {
+				return nil, err
+			}
+			d, err = newSQLCipherDialector(connectionString, key)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		d = sqlite.Open(connectionString)
+	case "mysql", "mariadb":
+		dsn, err := mysqlDSN(connectionString)
+		if err != nil {
+			return nil, err
+		}
+		d = mysql.New(mysql.Config{
+			DSN: dsn,
+			// MariaDB versions before 10.5 do not support renaming columns
+			// and indices using the MySQL syntax
+			DontSupportRenameColumn: c.Database.Dialect == "mariadb",
+			DontSupportRenameIndex:  c.Database.Dialect == "mariadb",
+		})
+	case "postgres", "cockroachdb":
+		// CockroachDB implements the PostgreSQL wire protocol
+		d = postgres.Open(connectionString)
 	}
 
 	logLevel := logger.Silent
@@ -65,6 +133,18 @@ func newDB(c *config.Config, l *logrus.Logger) (*gorm.DB, error) {
 		logLevel = logger.Info
 	}
 
+	// a database server started alongside the application might not be
+	// accepting connections yet. Opening a SQLite database does not depend
+	// on anything else being ready, so it is never retried.
+	retries := c.Database.ConnectionRetries
+	if c.Database.Dialect.String() == "sqlite3" {
+		retries = 0
+	}
+	policy := backoff.NewExponentialBackOff()
+	if c.Database.ConnectionRetryMaxInterval > 0 {
+		policy.MaxInterval = c.Database.ConnectionRetryMaxInterval
+	}
+
 	var gormDB *gorm.DB
 	if err := backoff.RetryNotify(
 		func() error {
@@ -75,9 +155,9 @@ func newDB(c *config.Config, l *logrus.Logger) (*gorm.DB, error) {
 			})
 			return err
 		},
-		backoff.WithMaxRetries(backoff.NewExponentialBackOff(), uint64(c.Database.ConnectionRetries)),
+		backoff.WithMaxRetries(policy, uint64(retries)),
 		func(err error, duration time.Duration) {
-			if l != nil && c.Database.ConnectionRetries != 0 {
+			if l != nil {
 				l.WithError(err).Warn("Connecting to database failed")
 				l.WithField("duration", duration).Info("Scheduling sleep before retrying")
 			}
@@ -86,12 +166,291 @@ func newDB(c *config.Config, l *logrus.Logger) (*gorm.DB, error) {
 		return nil, fmt.Errorf("error opening database: %w", err)
 	}
 
+	db, err := gormDB.DB()
+	if err != nil {
+		return nil, fmt.Errorf("error accessing underlying database: %w", err)
+	}
+	db.SetMaxOpenConns(c.Database.MaxOpenConns)
+	db.SetMaxIdleConns(c.Database.MaxIdleConns)
+	db.SetConnMaxIdleTime(c.Database.ConnMaxIdleTime)
+	switch {
+	case c.Database.ConnMaxLifetime != 0:
+		db.SetConnMaxLifetime(c.Database.ConnMaxLifetime)
+	case c.Database.Dialect == "mysql" || c.Database.Dialect == "mariadb":
+		// connections need to be closed before the server does so
+		// which happens after 8 hours by default, but is often configured
+		// much lower by hosting providers
+		db.SetConnMaxLifetime(time.Minute * 3)
+	}
 	if c.Database.Dialect == "sqlite3" {
-		db, err := gormDB.DB()
-		if err != nil {
-			return nil, fmt.Errorf("error accessing underlying database: %w", err)
-		}
 		db.SetMaxOpenConns(1)
 	}
 	return gormDB, nil
 }
+
+// mysqlDSN ensures the given connection string for MySQL or MariaDB sets all
+// options the application depends on.
+func mysqlDSN(connectionString string) (string, error) {
+	cfg, err := mysqldriver.ParseDSN(connectionString)
+	if err != nil {
+		return "", fmt.Errorf("error parsing connection string: %w", err)
+	}
+	// timestamps are scanned into time.Time values
+	cfg.ParseTime = true
+	return cfg.FormatDSN(), nil
+}
+
+// newDAL creates the data access layer for the given database connection,
+// routing reads to the given replicas and storing events in ClickHouse if
+// configured.
+func newDAL(c *config.Config, gormDB *gorm.DB, replicas ...*gorm.DB) (persistence.DataAccessLayer, error) {
+	var replicaDALs []persistence.DataAccessLayer
+	for _, replica := range replicas {
+		replicaDALs = append(replicaDALs, relational.NewRelationalDAL(replica))
+	}
+	dal := replicated.NewReplicatedDAL(relational.NewRelationalDAL(gormDB), replicaDALs...)
+	if c.Database.EventStore != "clickhouse" {
+		return dal, nil
+	}
+	client, err := chclient.New(c.Database.ClickHouseURL.String())
+	if err != nil {
+		return nil, fmt.Errorf("error creating clickhouse client: %w", err)
+	}
+	return clickhouse.NewEventsDAL(dal, client), nil
+}
+
+// newAccessLogSink returns the destination for HTTP access logs, which is
+// either stdout, syslog or a file that logs are appended to.
+func newAccessLogSink(c *config.Config) (io.Writer, error) {
+	switch sink := c.Server.AccessLogSink.String(); sink {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "syslog":
+		return newSyslogWriter("offen")
+	default:
+		f, err := os.OpenFile(sink, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			return nil, fmt.Errorf("error opening access log file %s: %w", sink, err)
+		}
+		return f, nil
+	}
+}
+
+func newDNSProvider(c *config.Config) (dnschallenge.Provider, error) {
+	switch c.DNSChallenge.Provider {
+	case "cloudflare":
+		return dnschallenge.NewCloudflare(c.DNSChallenge.CloudflareToken), nil
+	case "route53":
+		return dnschallenge.NewRoute53(
+			c.DNSChallenge.Route53HostedZoneID,
+			c.DNSChallenge.Route53AccessKeyID,
+			c.DNSChallenge.Route53SecretAccessKey,
+		), nil
+	case "rfc2136":
+		return dnschallenge.NewRFC2136(
+			c.DNSChallenge.RFC2136Nameserver,
+			c.DNSChallenge.RFC2136Zone,
+			c.DNSChallenge.RFC2136KeyName,
+			c.DNSChallenge.RFC2136Algorithm,
+			c.DNSChallenge.RFC2136Secret,
+		)
+	default:
+		return nil, fmt.Errorf("unknown dns provider %s", c.DNSChallenge.Provider)
+	}
+}
+
+// newIngestServer returns a gRPC server that accepts events submitted using
+// API tokens. Connections are secured using the configured certificate, if
+// any.
+func newIngestServer(c *config.Config, db persistence.Service, limitBackend ratelimiter.Backend, registry *metrics.Registry) (*grpc.Server, error) {
+	options := ingest.ServerOptions()
+	if c.Server.SSLCertificate != "" && c.Server.SSLKey != "" {
+		creds, err := credentials.NewServerTLSFromFile(c.Server.SSLCertificate.String(), c.Server.SSLKey.String())
+		if err != nil {
+			return nil, fmt.Errorf("error loading certificate: %w", err)
+		}
+		options = append(options, grpc.Creds(creds))
+	}
+
+	limiter := ratelimiter.New(time.Second*30, ratelimiter.NewMemoryBackend(time.Minute*2))
+	if c.Server.ReverseProxy {
+		limiter = ratelimiter.NewNoopRateLimiter()
+	} else if limitBackend != nil {
+		limiter = ratelimiter.NewShared(time.Second*30, limitBackend, c.Secret.Bytes(), !c.Cache.RateLimitFailOpen)
+	}
+
+	srv := grpc.NewServer(options...)
+	service := &ingest.Service{
+		DB:      db,
+		Limiter: limiter,
+		Limit:   ratelimiter.Limit(c.RateLimit.Events),
+		OnIngest: func(string) {
+			registry.Counter("offen_events_ingested_total", "Number of events that have been ingested.").Inc()
+		},
+	}
+	service.Register(srv)
+	return srv, nil
+}
+
+// newLocker returns the Locker used for making sure maintenance work is not
+// run by multiple instances at once.
+func newLocker(c *config.Config, db *gorm.DB) (lock.Locker, error) {
+	if c.Locks.Backend == "redis" {
+		if c.Cache.RedisURL == "" {
+			return nil, errors.New("using redis for locks requires OFFEN_CACHE_REDISURL to be set")
+		}
+		client, err := redis.New(c.Cache.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("error creating redis client: %w", err)
+		}
+		return lock.NewRedis(client, "offen-lock-", c.Locks.TTL), nil
+	}
+	return relational.NewAdvisoryLocker(db), nil
+}
+
+// newBackupStores returns the primary backup store, followed by a store for
+// each of the configured replicas. All stores share bucket and credentials.
+func newBackupStores(c *config.Config) ([]backup.Store, error) {
+	bucket := c.Backup.Bucket
+	if bucket == "" {
+		bucket = c.S3.Bucket
+	}
+	primary, err := s3.New(c.S3.Endpoint, bucket, c.S3.Region, c.S3.AccessKeyID, c.S3.SecretAccessKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating primary backup store: %w", err)
+	}
+	stores := []backup.Store{primary}
+	for _, replica := range c.Backup.Replicas {
+		client, err := s3.New(replica.Endpoint, bucket, replica.Region, c.S3.AccessKeyID, c.S3.SecretAccessKey)
+		if err != nil {
+			return nil, fmt.Errorf("error creating backup store for region %s: %w", replica.Region, err)
+		}
+		stores = append(stores, client)
+	}
+	return stores, nil
+}
+
+// newAssetsOrigin returns the remote origin static assets are fetched from.
+// Object storage origins use the credentials configured in the S3 namespace.
+func newAssetsOrigin(c *config.Config) (remotefs.Origin, error) {
+	bucket := c.Assets.Bucket
+	if bucket == "" {
+		bucket = c.S3.Bucket
+	}
+	switch c.Assets.Origin {
+	case "s3":
+		client, err := s3.New(c.S3.Endpoint, bucket, c.S3.Region, c.S3.AccessKeyID, c.S3.SecretAccessKey)
+		if err != nil {
+			return nil, fmt.Errorf("error creating object storage client: %w", err)
+		}
+		return remotefs.NewS3Origin(client, c.Assets.Prefix), nil
+	case "gcs":
+		// Google Cloud Storage accepts requests signed using HMAC keys in
+		// any region
+		client, err := s3.New(remotefs.GCSEndpoint, bucket, "auto", c.S3.AccessKeyID, c.S3.SecretAccessKey)
+		if err != nil {
+			return nil, fmt.Errorf("error creating object storage client: %w", err)
+		}
+		return remotefs.NewS3Origin(client, c.Assets.Prefix), nil
+	case "http":
+		origin, err := remotefs.NewHTTPOrigin(c.Assets.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error creating http origin: %w", err)
+		}
+		return origin, nil
+	}
+	return nil, fmt.Errorf("unsupported assets origin %s", c.Assets.Origin)
+}
+
+// newTemplates parses the HTML and email templates in the configured locale
+// and returns router configuration for rendering them in all other
+// available locales too. Email templates found in the configured templates
+// directory replace the built-in ones. Fingerprints of the assets
+// referenced by the templates are computed before parsing.
+func newTemplates(c *config.Config, fs *public.LocalizedFS) (*template.Template, *mailer.Templates, []router.Config, error) {
+	if _, err := fs.Manifest(public.FingerprintedAssets...); err != nil {
+		return nil, nil, nil, fmt.Errorf("error creating asset manifest: %w", err)
+	}
+	bundle, err := locales.NewBundle()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error reading locale files: %w", err)
+	}
+	var localized []router.Config
+	htmlTemplates, emailTemplates := map[string]*template.Template{}, map[string]*template.Template{}
+	for _, locale := range bundle.Locales() {
+		html, err := fs.HTMLTemplate(bundle.Gettext(locale), bundle.NGettext(locale))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error parsing html templates for locale %s: %w", locale, err)
+		}
+		emails, err := fs.EmailTemplate(bundle.Gettext(locale), bundle.NGettext(locale))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error parsing email templates for locale %s: %w", locale, err)
+		}
+		htmlTemplates[locale], emailTemplates[locale] = html, emails
+		localized = append(localized, router.WithLocalizedTemplates(locale, html))
+	}
+	html, ok := htmlTemplates[c.App.Locale.String()]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("no translations found for locale %s", c.App.Locale.String())
+	}
+	emails, err := mailer.NewTemplates(emailTemplates, c.App.Locale.String(), c.Mailer.TemplatesDirectory.String())
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error loading email templates: %w", err)
+	}
+	return html, emails, localized, nil
+}
+
+// configureHTTP2 sets up the protocols the given server speaks. Connections
+// using TLS negotiate HTTP/2 using ALPN. When enabled, cleartext connections
+// can use HTTP/2 with prior knowledge (h2c), which is useful for reverse
+// proxies talking HTTP/2 to their upstream. It is expected to be called after
+// the TLS config of the server has been set. HTTP/3 is not supported and
+// needs to be terminated by a reverse proxy.
+func configureHTTP2(srv *http.Server, c *config.Config) error {
+	if !c.Server.HTTP2 {
+		// a non-nil, empty map disables HTTP/2 for TLS connections
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		// clients would still negotiate HTTP/2 in case it is offered
+		if srv.TLSConfig != nil {
+			var protos []string
+			for _, proto := range srv.TLSConfig.NextProtos {
+				if proto != http2.NextProtoTLS {
+					protos = append(protos, proto)
+				}
+			}
+			srv.TLSConfig.NextProtos = protos
+		}
+		return nil
+	}
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return fmt.Errorf("error configuring http/2: %w", err)
+	}
+	if c.Server.H2C {
+		srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	}
+	return nil
+}
+
+// listenUnix creates a listener on a unix socket at the given location that
+// can be accessed using the given permissions. Sockets that have been left
+// behind by previous runs are removed before.
+func listenUnix(location string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(location); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("refusing to replace %s as it is not a socket", location)
+		}
+		if err := os.Remove(location); err != nil {
+			return nil, fmt.Errorf("error removing stale socket: %w", err)
+		}
+	}
+	listener, err := net.Listen("unix", location)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on socket: %w", err)
+	}
+	if err := os.Chmod(location, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("error setting permissions of socket: %w", err)
+	}
+	return listener, nil
+}
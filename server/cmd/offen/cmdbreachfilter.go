@@ -0,0 +1,104 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/offen/offen/server/keys"
+)
+
+var breachFilterUsage = `
+"breachfilter" creates a bloom filter of breached passwords that can be used
+for setting OFFEN_PASSWORDS_BREACHFILTER. The input is expected to be a list
+of SHA-1 password hashes in hex encoding, one per line. Anything following a
+colon is ignored, so the SHA-1 lists published by Have I Been Pwned can be
+used as is.
+
+Usage of "breachfilter":
+`
+
+func cmdBreachFilter(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), breachFilterUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		in   = cmd.String("in", "", "the list of SHA-1 hashes to read")
+		out  = cmd.String("out", "breaches.bin", "the file to write the bloom filter to")
+		rate = cmd.Float64("rate", 0.001, "the false positive rate of the bloom filter")
+	)
+	cmd.Parse(flags)
+	l := newLogger()
+
+	if *in == "" {
+		l.Fatal("The -in flag is required")
+	}
+
+	// the file is read twice so the filter can be sized upfront
+	var count uint64
+	if err := scanHashes(*in, func([]byte) error {
+		count++
+		return nil
+	}); err != nil {
+		l.WithError(err).Fatalf("Error reading %s", *in)
+	}
+	if count == 0 {
+		l.Fatalf("No hashes found in %s", *in)
+	}
+
+	filter, err := keys.NewBloomFilter(count, *rate)
+	if err != nil {
+		l.WithError(err).Fatal("Error creating bloom filter")
+	}
+	if err := scanHashes(*in, filter.Add); err != nil {
+		l.WithError(err).Fatalf("Error reading %s", *in)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		l.WithError(err).Fatalf("Error creating file %s", *out)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if _, err := filter.WriteTo(w); err != nil {
+		l.WithError(err).Fatal("Error writing bloom filter")
+	}
+	if err := w.Flush(); err != nil {
+		l.WithError(err).Fatal("Error writing bloom filter")
+	}
+	l.WithField("hashes", count).Infof("Successfully wrote bloom filter to %s", *out)
+}
+
+func scanHashes(file string, fn func([]byte) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("breachfilter: error opening file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	var line int
+	for scanner.Scan() {
+		line++
+		value := strings.TrimSpace(strings.SplitN(scanner.Text(), ":", 2)[0])
+		if value == "" {
+			continue
+		}
+		hash, err := hex.DecodeString(value)
+		if err != nil {
+			return fmt.Errorf("breachfilter: invalid hash in line %d: %w", line, err)
+		}
+		if err := fn(hash); err != nil {
+			return fmt.Errorf("breachfilter: line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,309 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/mailer"
+)
+
+var configUsage = `
+"config" inspects the runtime configuration. The following subcommands are
+available:
+
+- "validate" loads the configuration and checks whether the database, the
+  mailer, OpenID Connect providers and TLS certificates can be used. Results
+  are printed as JSON and the command exits with a non-zero status in case
+  any check has failed.
+
+Usage of "config validate":
+`
+
+// Diagnostic codes reported by "config validate".
+const (
+	codeOK                  = "OK"
+	codeConfigInvalid       = "CONFIG_INVALID"
+	codeDatabaseUnreachable = "DATABASE_UNREACHABLE"
+	codeMailerNotConfigured = "MAILER_NOT_CONFIGURED"
+	codeMailerUnreachable   = "MAILER_UNREACHABLE"
+	codeMailerAuthFailed    = "MAILER_AUTH_FAILED"
+	codeOIDCIncomplete      = "OIDC_INCOMPLETE"
+	codeOIDCDiscoveryFailed = "OIDC_DISCOVERY_FAILED"
+	codeTLSIncomplete       = "TLS_INCOMPLETE"
+	codeTLSInvalid          = "TLS_INVALID"
+	codeTLSExpired          = "TLS_EXPIRED"
+	codeTLSExpiresSoon      = "TLS_EXPIRES_SOON"
+	codeTLSConflict         = "TLS_CONFLICT"
+)
+
+const (
+	severityOK      = "ok"
+	severityWarning = "warning"
+	severityError   = "error"
+)
+
+// tlsExpiryWarning is the remaining validity of a certificate below which
+// a warning is reported.
+const tlsExpiryWarning = time.Hour * 24 * 14
+
+type diagnostic struct {
+	Check    string `json:"check"`
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Message  string `json:"message,omitempty"`
+}
+
+type validationResult struct {
+	OK          bool         `json:"ok"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+func (v *validationResult) add(d diagnostic) {
+	if d.Severity == severityError {
+		v.OK = false
+	}
+	v.Diagnostics = append(v.Diagnostics, d)
+}
+
+func (v *validationResult) print() {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+	if !v.OK {
+		os.Exit(1)
+	}
+}
+
+func cmdConfig(subcommand string, flags []string) {
+	if len(flags) == 0 || flags[0] != "validate" {
+		fmt.Fprint(flag.CommandLine.Output(), configUsage)
+		os.Exit(1)
+	}
+	cmd := flag.NewFlagSet(subcommand+" validate", flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), configUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile = cmd.String("envfile", "", "the env file to use")
+		skip    = cmd.String("skip", "", "comma separated list of checks to skip (database, mailer, oidc, tls)")
+		timeout = cmd.Duration("timeout", time.Second*10, "the timeout applied to each check")
+	)
+	cmd.Parse(flags[1:])
+
+	skipped := map[string]bool{}
+	for _, check := range strings.Split(*skip, ",") {
+		skipped[strings.TrimSpace(check)] = true
+	}
+
+	result := &validationResult{OK: true, Diagnostics: []diagnostic{}}
+	cfg, err := config.New(false, *envFile)
+	if err != nil {
+		result.add(diagnostic{Check: "config", Code: codeConfigInvalid, Severity: severityError, Message: err.Error()})
+		result.print()
+		return
+	}
+	result.add(diagnostic{Check: "config", Code: codeOK, Severity: severityOK})
+
+	checks := []struct {
+		name  string
+		check func(context.Context, *config.Config) []diagnostic
+	}{
+		{"database", validateDatabase},
+		{"mailer", validateMailer},
+		{"oidc", validateOIDC},
+		{"tls", validateTLS},
+	}
+	for _, c := range checks {
+		if skipped[c.name] {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		for _, d := range c.check(ctx, cfg) {
+			d.Check = c.name + d.Check
+			result.add(d)
+		}
+		cancel()
+	}
+	result.print()
+}
+
+func validateDatabase(ctx context.Context, cfg *config.Config) []diagnostic {
+	gormDB, err := newDB(cfg, newLogger())
+	if err != nil {
+		return []diagnostic{{Code: codeDatabaseUnreachable, Severity: severityError, Message: err.Error()}}
+	}
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		return []diagnostic{{Code: codeDatabaseUnreachable, Severity: severityError, Message: err.Error()}}
+	}
+	defer sqlDB.Close()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return []diagnostic{{Code: codeDatabaseUnreachable, Severity: severityError, Message: err.Error()}}
+	}
+	return []diagnostic{{Code: codeOK, Severity: severityOK}}
+}
+
+func validateMailer(ctx context.Context, cfg *config.Config) []diagnostic {
+	if !cfg.MailerConfigured() {
+		return []diagnostic{{
+			Code:     codeMailerNotConfigured,
+			Severity: severityWarning,
+			Message:  "SMTP or a mail provider is not configured, mail delivery will be unreliable",
+		}}
+	}
+	m := cfg.NewMailer()
+	check := func() error {
+		if checker, ok := m.(mailer.AuthChecker); ok {
+			return checker.CheckAuth()
+		}
+		if checker, ok := m.(mailer.HealthChecker); ok {
+			return checker.CheckHealth()
+		}
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- check()
+	}()
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case err = <-done:
+	}
+	switch {
+	case err == nil:
+		return []diagnostic{{Code: codeOK, Severity: severityOK}}
+	case errors.Is(err, mailer.ErrUnauthorized):
+		return []diagnostic{{Code: codeMailerAuthFailed, Severity: severityError, Message: err.Error()}}
+	default:
+		return []diagnostic{{Code: codeMailerUnreachable, Severity: severityError, Message: err.Error()}}
+	}
+}
+
+func validateOIDC(ctx context.Context, cfg *config.Config) []diagnostic {
+	issuers := map[string]string{}
+	for name, issuer := range cfg.OIDC.Providers {
+		issuers[name] = issuer
+	}
+	if cfg.OIDC.Issuer != "" {
+		if cfg.OIDC.ClientID == "" || cfg.OIDC.ClientSecret == "" {
+			return []diagnostic{{
+				Code:     codeOIDCIncomplete,
+				Severity: severityError,
+				Message:  "OFFEN_OIDC_ISSUER is set, but client id or client secret are missing",
+			}}
+		}
+		issuers["default"] = cfg.OIDC.Issuer
+	}
+
+	names := make([]string, 0, len(issuers))
+	for name := range issuers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []diagnostic
+	for _, name := range names {
+		d := diagnostic{Check: ":" + name, Code: codeOK, Severity: severityOK}
+		if err := checkDiscovery(ctx, issuers[name]); err != nil {
+			d.Code, d.Severity, d.Message = codeOIDCDiscoveryFailed, severityError, err.Error()
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+func checkDiscovery(ctx context.Context, issuer string) error {
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", nil,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating discovery request: %w", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error requesting discovery document: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("discovery document returned unexpected status code %d", res.StatusCode)
+	}
+	var document struct {
+		Issuer string `json:"issuer"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&document); err != nil {
+		return fmt.Errorf("error decoding discovery document: %w", err)
+	}
+	if strings.TrimSuffix(document.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return fmt.Errorf("discovery document is issued by %s", document.Issuer)
+	}
+	return nil
+}
+
+func validateTLS(ctx context.Context, cfg *config.Config) []diagnostic {
+	cert, key := cfg.Server.SSLCertificate.String(), cfg.Server.SSLKey.String()
+	autoTLS := len(cfg.Server.AutoTLS) != 0
+	switch {
+	case autoTLS && cfg.Server.Socket != "":
+		return []diagnostic{{
+			Code:     codeTLSConflict,
+			Severity: severityError,
+			Message:  "AutoTLS cannot be used when listening on a unix socket",
+		}}
+	case autoTLS && (cert != "" || key != ""):
+		return []diagnostic{{
+			Code:     codeTLSConflict,
+			Severity: severityError,
+			Message:  "AutoTLS cannot be used together with a certificate and key",
+		}}
+	case (cert == "") != (key == ""):
+		return []diagnostic{{
+			Code:     codeTLSIncomplete,
+			Severity: severityError,
+			Message:  "both OFFEN_SERVER_SSLCERTIFICATE and OFFEN_SERVER_SSLKEY need to be set",
+		}}
+	case cert == "":
+		return []diagnostic{{Code: codeOK, Severity: severityOK}}
+	}
+
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return []diagnostic{{Code: codeTLSInvalid, Severity: severityError, Message: err.Error()}}
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return []diagnostic{{Code: codeTLSInvalid, Severity: severityError, Message: err.Error()}}
+	}
+	remaining := time.Until(leaf.NotAfter)
+	switch {
+	case remaining <= 0:
+		return []diagnostic{{
+			Code:     codeTLSExpired,
+			Severity: severityError,
+			Message:  fmt.Sprintf("certificate has expired at %s", leaf.NotAfter.Format(time.RFC3339)),
+		}}
+	case remaining < tlsExpiryWarning:
+		return []diagnostic{{
+			Code:     codeTLSExpiresSoon,
+			Severity: severityWarning,
+			Message:  fmt.Sprintf("certificate expires at %s", leaf.NotAfter.Format(time.RFC3339)),
+		}}
+	}
+	return []diagnostic{{Code: codeOK, Severity: severityOK}}
+}
@@ -19,10 +19,8 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid"
-	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/keys"
-	"github.com/offen/offen/server/locales"
 	"github.com/offen/offen/server/persistence"
 	"github.com/offen/offen/server/persistence/relational"
 	"github.com/offen/offen/server/public"
@@ -40,6 +38,12 @@ take a minute or two.
 By default, a random free port will be picked for running the server.
 If you need to override this, pass a value to -port.
 
+While the demo is running, new events are generated continuously so the
+dashboard shows live data. Use -rate to control the number of events generated
+per minute and -pages and -referrers to control which pages are visited. Both
+take a comma separated list of values that can be weighted by appending
+"=<weight>", e.g. "/=5,/blog/=2,/about/".
+
 Usage of "demo":
 `
 
@@ -52,10 +56,22 @@ func cmdDemo(subcommand string, flags []string) {
 	var (
 		port     = demoCmd.Int("port", 0, "the port to bind to (defaults to a random free port)")
 		numUsers = demoCmd.Int("users", -1, "the number of users to simulate - this defaults to a random number between 250 and 500")
+		rate     = demoCmd.Float64("rate", 6, "the number of events per minute to generate while the demo is running - 0 disables generation")
+		pageList = demoCmd.String("pages", defaultPages, "the weighted list of pages to generate pageviews for")
+		refList  = demoCmd.String("referrers", defaultReferrers, "the weighted list of referrers to use for new sessions")
 	)
 	demoCmd.Parse(flags)
 
 	a := newApp(false, true, "")
+
+	pages, err := parseDistribution(*pageList)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Unable to parse list of pages")
+	}
+	referrers, err := parseDistribution(*refList)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Unable to parse list of referrers")
+	}
 	{
 		dbID, _ := uuid.NewV4()
 		cfg, _ := config.New(false, "")
@@ -116,129 +132,156 @@ func cmdDemo(subcommand string, flags []string) {
 
 	a.logger.Info("Offen is generating some random usage data for your demo, this might take a little while.")
 	rand.Seed(time.Now().UnixNano())
-	account, _ := db.GetAccount(accountID.String(), false, false, "")
 
 	users := *numUsers
 	if users == -1 {
 		users = randomInRange(250, 500)
 	}
 
+	pBar := progressbar.NewOptions(users, progressbar.OptionClearOnFinish())
+	demoRoot := fmt.Sprintf("http://localhost:%d", a.config.Server.Port)
+	if err := seedDemoAccount(db, accountID.String(), demoRoot, users, pages, referrers, func() { pBar.Add(1) }); err != nil {
+		a.logger.WithError(err).Fatal("Error setting up demo")
+	}
+
+	fs := public.NewLocalizedFS(a.config.App.Locale.String())
+	tpl, emails, localized, tplErr := newTemplates(a.config, fs)
+	if tplErr != nil {
+		a.logger.WithError(tplErr).Fatal("Failed parsing template files, cannot continue")
+	}
+
+	routerConfig := []router.Config{
+		router.WithDatabase(db),
+		router.WithLogger(a.logger),
+		router.WithTemplate(tpl),
+		router.WithEmailTemplates(emails),
+		router.WithConfig(a.config),
+		router.WithFS(fs),
+		router.WithIntegrity(fs.Integrity(public.ScriptAssets...)),
+		router.WithMailer(a.config.NewMailer()),
+		router.WithDemoSeeder(func() error {
+			return seedDemoAccount(db, accountID.String(), demoRoot, randomInRange(250, 500), pages, referrers, nil)
+		}),
+	}
+	handler := router.New(append(routerConfig, localized...)...)
+	if err := handler.Warmup(context.Background()); err != nil {
+		a.logger.WithError(err).Fatal("Failed warming up application, cannot continue")
+	}
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("0.0.0.0:%d", a.config.Server.Port),
+		Handler: handler,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			a.logger.WithError(err).Fatal("Error binding server to network")
+		}
+	}()
+
+	generatorCtx, cancelGenerator := context.WithCancel(context.Background())
+	defer cancelGenerator()
+	generator := &demoGenerator{
+		db:        db,
+		accountID: accountID.String(),
+		root:      demoRoot,
+		rate:      *rate,
+		pages:     pages,
+		referrers: referrers,
+	}
+	go generator.Run(generatorCtx, func(err error) {
+		a.logger.WithError(err).Warn("Error generating demo data")
+	})
+	a.logger.Infof("You can now start your Offen demo by visiting")
+	a.logger.Infof("")
+	a.logger.Infof("--> http://localhost:%d/intro/ <--", a.config.Server.Port)
+	a.logger.Infof("")
+	a.logger.Infof("in your browser. Please make sure to use the `localhost`")
+	a.logger.Infof("hostname so a secure context is available.")
+
+	quit := make(chan os.Signal)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	cancelGenerator()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		a.logger.WithError(err).Fatal("Error shutting down server")
+	}
+
+	a.logger.Info("Gracefully shut down server")
+}
+
+// seedDemoAccount generates random usage data for the given number of users
+// and stores it for the given account. onProgress is called each time
+// the data for a single user has been stored.
+func seedDemoAccount(db persistence.Service, accountID, root string, users int, pages, referrers distribution, onProgress func()) error {
+	account, err := db.GetAccount(accountID, false, false, "")
+	if err != nil {
+		return fmt.Errorf("error looking up demo account: %w", err)
+	}
+
 	wg := sync.WaitGroup{}
-	done := make(chan error)
+	errs := make(chan error, users)
 	wg.Add(users)
-	pBar := progressbar.NewOptions(users, progressbar.OptionClearOnFinish())
 
 	for i := 0; i < users; i++ {
 		go func() {
+			defer wg.Done()
 			userID, key, jwk, err := newFakeUser()
 			if err != nil {
-				done <- err
+				errs <- err
 				return
 			}
 			encryptedSecret, encryptionErr := keys.EncryptAsymmetricWith(
 				account.PublicKey, jwk,
 			)
 			if encryptionErr != nil {
-				done <- err
+				errs <- encryptionErr
 				return
 			}
 			if err := db.AssociateUserSecret(
-				accountID.String(), userID, encryptedSecret.Marshal(),
+				accountID, userID, encryptedSecret.Marshal(),
 			); err != nil {
-				done <- err
+				errs <- err
+				return
 			}
 
 			for s := 0; s < randomInRange(1, 4); s++ {
-				evts := newFakeSession(
-					fmt.Sprintf("http://localhost:%d", a.config.Server.Port),
-					randomInRange(1, 12),
-				)
+				evts := newFakeSession(root, randomInRange(1, 12), pages, referrers)
 				for _, evt := range evts {
 					b, bErr := json.Marshal(evt)
 					if bErr != nil {
-						done <- err
+						errs <- bErr
+						return
 					}
 					event, eventErr := keys.EncryptWith(key, b)
 					if eventErr != nil {
-						done <- err
+						errs <- eventErr
+						return
 					}
 					eventID, _ := persistence.EventIDAt(evt.Timestamp)
 					if err := db.Insert(
 						userID,
-						accountID.String(),
+						accountID,
+						"",
 						event.Marshal(),
 						&eventID,
 					); err != nil {
-						done <- err
+						errs <- err
+						return
 					}
 				}
 			}
-			wg.Done()
-			pBar.Add(1)
+			if onProgress != nil {
+				onProgress()
+			}
 		}()
 	}
 
-	go func() {
-		wg.Wait()
-		done <- nil
-	}()
-
-	select {
-	case err := <-done:
-		if err != nil {
-			a.logger.WithError(err).Fatal("Error setting up demo")
-		}
-	}
-
-	fs := public.NewLocalizedFS(a.config.App.Locale.String())
-	gettext, gettextErr := locales.GettextFor(a.config.App.Locale.String())
-	if gettextErr != nil {
-		a.logger.WithError(gettextErr).Fatal("Failed reading locale files, cannot continue")
-	}
-	tpl, tplErr := fs.HTMLTemplate(gettext)
-	if tplErr != nil {
-		a.logger.WithError(tplErr).Fatal("Failed parsing template files, cannot continue")
-	}
-	emails, emailsErr := fs.EmailTemplate(gettext)
-	if emailsErr != nil {
-		a.logger.WithError(emailsErr).Fatal("Failed parsing template files, cannot continue")
-	}
-
-	srv := &http.Server{
-		Addr: fmt.Sprintf("0.0.0.0:%d", a.config.Server.Port),
-		Handler: router.New(
-			router.WithDatabase(db),
-			router.WithLogger(a.logger),
-			router.WithTemplate(tpl),
-			router.WithEmails(emails),
-			router.WithConfig(a.config),
-			router.WithFS(fs),
-			router.WithMailer(a.config.NewMailer()),
-		),
-	}
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			a.logger.WithError(err).Fatal("Error binding server to network")
-		}
-	}()
-	a.logger.Infof("You can now start your Offen demo by visiting")
-	a.logger.Infof("")
-	a.logger.Infof("--> http://localhost:%d/intro/ <--", a.config.Server.Port)
-	a.logger.Infof("")
-	a.logger.Infof("in your browser. Please make sure to use the `localhost`")
-	a.logger.Infof("hostname so a secure context is available.")
-
-	quit := make(chan os.Signal)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		a.logger.WithError(err).Fatal("Error shutting down server")
-	}
-
-	a.logger.Info("Gracefully shut down server")
+	wg.Wait()
+	close(errs)
+	return <-errs
 }
 
 func mustSecret(length int) []byte {
@@ -258,21 +301,10 @@ func newFakeUser() (string, []byte, []byte, error) {
 	if err != nil {
 		return "", nil, nil, fmt.Errorf("error creating user id: %w", err)
 	}
-	k, err := keys.GenerateRandomBytes(keys.DefaultSecretLength)
+	k, b, err := keys.GenerateUserSecret()
 	if err != nil {
 		return "", nil, nil, fmt.Errorf("error creating user key: %w", err)
 	}
-	j, err := jwk.New(k)
-	if err != nil {
-		return "", nil, nil, fmt.Errorf("error wrapping key as jwk: %w", err)
-	}
-	j.Set(jwk.AlgorithmKey, "A128GCM")
-	j.Set("ext", true)
-	j.Set(jwk.KeyOpsKey, jwk.KeyOperationList{jwk.KeyOpEncrypt, jwk.KeyOpDecrypt})
-	b, err := json.Marshal(j)
-	if err != nil {
-		return "", nil, nil, fmt.Errorf("error marshaling jwk: %w", err)
-	}
 	return id.String(), k, b, nil
 }
 
@@ -281,7 +313,7 @@ func randomInRange(lower, upper int) int {
 }
 
 func randomBool(prob float64) bool {
-	return prob <= rand.Float64()
+	return rand.Float64() < prob
 }
 
 type fakeEvent struct {
@@ -295,33 +327,13 @@ type fakeEvent struct {
 	SessionID string    `json:"sessionId"`
 }
 
-var pages = []string{
-	"/",
-	"/about/",
-	"/blog/",
-	"/imprint/",
-	"/landing-page/",
-	"/landing-page/?utm_source=Example_Source",
-	"/landing-page/?utm_campaign=Example_Campaign",
-	"/intro/",
-	"/contact/",
-}
-
-func randomPage() string {
-	return pages[randomInRange(0, len(pages)-1)]
-}
+const defaultPages = "/=6,/about/=2,/blog/=3,/imprint/=1,/landing-page/=2," +
+	"/landing-page/?utm_source=Example_Source=2,/landing-page/?utm_campaign=Example_Campaign=1," +
+	"/intro/=1,/contact/=1"
 
-var referrers = []string{
-	"https://www.offen.dev",
-	"https://t.co/xyz",
-	"https://example.net/",
-}
-
-func randomReferrer() string {
-	return referrers[randomInRange(0, len(referrers)-1)]
-}
+const defaultReferrers = "https://www.offen.dev=3,https://t.co/xyz=2,https://example.net/=1"
 
-func newFakeSession(root string, length int) []*fakeEvent {
+func newFakeSession(root string, length int, pages, referrers distribution) []*fakeEvent {
 	var result []*fakeEvent
 	sessionID, _ := uuid.NewV4()
 	timestamp := time.Now().Add(-time.Duration(randomInRange(0, int(config.EventRetention))))
@@ -332,14 +344,14 @@ func newFakeSession(root string, length int) []*fakeEvent {
 	for i := 0; i < length; i++ {
 		var referrer string
 		if i == 0 && randomBool(0.25) {
-			referrer = randomReferrer()
+			referrer = referrers.pick()
 		} else if i != 0 {
 			// a subsequent view will use the previously visited URL
 			// as the referrer
 			referrer = href
 		}
 
-		href := fmt.Sprintf("%s%s", root, randomPage())
+		href := fmt.Sprintf("%s%s", root, pages.pick())
 		result = append(result, &fakeEvent{
 			Type:      "PAGEVIEW",
 			Href:      href,
@@ -9,13 +9,14 @@ import (
 
 	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/persistence"
-	"github.com/offen/offen/server/persistence/relational"
 )
 
 var expireUsage = `
-"expire" prunes all events older than 6 months (4464 hours) from the connected
-database. Only run this command when you run Offen as a horizontally scaling
-service as the default installation will handle this routine by itself.
+"expire" prunes all events older than 6 months (4464 hours), all audit log
+entries older than the configured audit retention and all queued mails older
+than the configured mail retention from the connected database. Only run this
+command when you run Offen as a horizontally scaling service as the default
+installation will handle this routine by itself.
 
 Usage of "expire":
 `
@@ -37,16 +38,56 @@ func cmdExpire(subcommand string, flags []string) {
 		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
 	}
 
+	dal, err := newDAL(a.config, gormDB)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error setting up data access layer")
+	}
 	db, err := persistence.New(
-		relational.NewRelationalDAL(gormDB),
+		dal,
 	)
 	if err != nil {
 		a.logger.WithError(err).Fatalf("Error setting up database")
 	}
 
-	affected, err := db.Expire(config.EventRetention)
+	locker, err := newLocker(a.config, gormDB)
 	if err != nil {
-		a.logger.WithError(err).Fatalf("Error pruning expired events")
+		a.logger.WithError(err).Fatal("Error creating locker")
+	}
+
+	// jobs use the same locks as the scheduler of running instances, so
+	// they are skipped in case an instance is currently running them
+	jobs := []struct {
+		name    string
+		message string
+		run     func() (int, error)
+	}{
+		{"expire-events", "Successfully expired events", func() (int, error) {
+			return db.Expire(config.EventRetention, config.RetentionDuration)
+		}},
+		{"expire-audit-log", "Successfully expired audit log entries", func() (int, error) {
+			return db.ExpireAuditLog(a.config.App.AuditRetention)
+		}},
+		{"expire-mails", "Successfully expired queued mails", func() (int, error) {
+			return db.ExpireMails(a.config.Mailer.Retention)
+		}},
+		{"purge-retired-accounts", "Successfully purged retired accounts", func() (int, error) {
+			return db.PurgeRetiredAccounts(a.config.App.RetirementGracePeriod)
+		}},
+	}
+	for _, job := range jobs {
+		release, acquired, err := locker.TryLock("job:" + job.name)
+		if err != nil {
+			a.logger.WithError(err).Fatalf("Error acquiring lock for job %s", job.name)
+		}
+		if !acquired {
+			a.logger.WithField("job", job.name).Info("Skipping job as it is currently run by another instance")
+			continue
+		}
+		affected, err := job.run()
+		release()
+		if err != nil {
+			a.logger.WithError(err).Fatalf("Error running job %s", job.name)
+		}
+		a.logger.WithField("removed", affected).Info(job.message)
 	}
-	a.logger.WithField("removed", affected).Info("Successfully expired events")
 }
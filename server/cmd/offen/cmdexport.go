@@ -0,0 +1,66 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+var exportUsage = `
+"export" writes all data stored in the connected database as line delimited
+JSON. The output can be read by "import", which allows moving data between
+different database dialects or instances.
+
+Usage of "export":
+`
+
+func cmdExport(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), exportUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile = cmd.String("envfile", "", "the env file to use")
+		out     = cmd.String("out", "", "the file to write to (defaults to stdout)")
+	)
+	cmd.Parse(flags)
+	a := newApp(false, true, *envFile)
+
+	gormDB, dbErr := newDB(a.config, a.logger)
+	if dbErr != nil {
+		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
+	}
+	dal, err := newDAL(a.config, gormDB)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating data access layer")
+	}
+	db, err := persistence.New(
+		dal,
+	)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating persistence layer")
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			a.logger.WithError(err).Fatalf("Error creating file %s", *out)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	count, err := db.DumpStream(w)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error exporting data")
+	}
+	a.logger.WithField("records", count).Info("Successfully exported data")
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+var importUsage = `
+"import" reads line delimited JSON as written by "export" and writes it into
+the connected database. Importing into a database that already contains data
+requires passing -force, which drops all existing data.
+
+Usage of "import":
+`
+
+func cmdImport(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), importUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile = cmd.String("envfile", "", "the env file to use")
+		in      = cmd.String("in", "", "the file to read from (defaults to stdin)")
+		force   = cmd.Bool("force", false, "drop all existing data before importing")
+	)
+	cmd.Parse(flags)
+	a := newApp(false, true, *envFile)
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			a.logger.WithError(err).Fatalf("Error opening file %s", *in)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	gormDB, dbErr := newDB(a.config, a.logger)
+	if dbErr != nil {
+		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
+	}
+	dal, err := newDAL(a.config, gormDB)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating data access layer")
+	}
+	db, err := persistence.New(
+		dal,
+	)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating persistence layer")
+	}
+
+	count, err := db.RestoreStream(r, *force)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error importing data")
+	}
+	a.logger.WithField("records", count).Info("Successfully imported data")
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/offen/offen/server/foreignimport"
+	"github.com/offen/offen/server/persistence"
+)
+
+var importForeignUsage = `
+"import-foreign" reads data exported from another analytics tool and stores it
+as events for the given account. Supported sources are "goaccess" (JSON
+report), "matomo" (JSON response of Actions.getPageUrls using period=day and
+flat=1) and "plausible" (the imported_pages CSV file of a CSV export).
+
+As other tools only export aggregated numbers, events are created for
+synthetic users. Each imported event is marked as migrated from the given
+source.
+
+Usage of "import-foreign":
+`
+
+func cmdImportForeign(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), importForeignUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile   = cmd.String("envfile", "", "the env file to use")
+		in        = cmd.String("in", "", "the file to read from (defaults to stdin)")
+		source    = cmd.String("source", "", "the tool the data has been exported from")
+		accountID = cmd.String("account", "", "the id of the account to import events into")
+		root      = cmd.String("root", "", "the URL pages given as paths are resolved against, e.g. https://www.example.net")
+	)
+	cmd.Parse(flags)
+	a := newApp(false, true, *envFile)
+
+	if *accountID == "" {
+		a.logger.Fatal("Flag -account is required")
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			a.logger.WithError(err).Fatalf("Error opening file %s", *in)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	rows, err := foreignimport.Parse(*source, r)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error reading export")
+	}
+
+	gormDB, dbErr := newDB(a.config, a.logger)
+	if dbErr != nil {
+		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
+	}
+	dal, err := newDAL(a.config, gormDB)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating data access layer")
+	}
+	db, err := persistence.New(
+		dal,
+	)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating persistence layer")
+	}
+
+	result, err := foreignimport.Import(db, *accountID, *root, *source, rows)
+	if err != nil {
+		a.logger.WithError(err).WithField("events", result.Events).Fatal("Error importing data")
+	}
+	a.logger.WithField("users", result.Users).WithField("events", result.Events).Info("Successfully imported data")
+}
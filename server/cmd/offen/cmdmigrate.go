@@ -4,9 +4,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"time"
 
+	"github.com/offen/offen/server/lock"
 	"github.com/offen/offen/server/persistence"
 	"github.com/offen/offen/server/persistence/relational"
 )
@@ -14,7 +17,13 @@ import (
 var migrateUsage = `
 "migrate" applies all pending database migrations to the connected database.
 Only run this command when you run Offen as a horizontally scaling service as
-the default installation will handle this routine by itself.
+the default installation will handle this routine by itself. In case another
+instance is currently applying migrations, the command waits for it to finish.
+
+For upgrading without downtime, apply migrations of the "expand" phase before
+deploying a new version and migrations of the "contract" phase after all
+instances have been upgraded. Passing -to rolls back all applied migrations
+defined after the given one. Use -dry-run to print the planned steps first.
 
 Usage of "migrate":
 `
@@ -28,6 +37,10 @@ func cmdMigrate(subcommand string, flags []string) {
 	}
 	var (
 		envFile = cmd.String("envfile", "", "the env file to use")
+		to      = cmd.String("to", "", "the id of the migration to migrate to, rolling back later migrations")
+		phase   = cmd.String("phase", "", "only apply migrations of the given phase (expand or contract)")
+		dryRun  = cmd.Bool("dry-run", false, "print the planned steps without applying them")
+		status  = cmd.Bool("status", false, "print the status of all migrations")
 	)
 	cmd.Parse(flags)
 	a := newApp(false, true, *envFile)
@@ -37,15 +50,77 @@ func cmdMigrate(subcommand string, flags []string) {
 		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
 	}
 
+	dal, err := newDAL(a.config, gormDB)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating data access layer")
+	}
 	db, err := persistence.New(
-		relational.NewRelationalDAL(gormDB),
+		dal,
 	)
 	if err != nil {
 		a.logger.WithError(err).Fatal("Error creating persistence layer")
 	}
 
-	if err := db.Migrate(); err != nil {
+	locker, err := newLocker(a.config, gormDB)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating locker")
+	}
+
+	if *status {
+		statuses, err := relational.MigrationStatuses(gormDB)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Error reading migration status")
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied {
+				applied = "applied"
+			}
+			fmt.Printf("%s\t%s\t%s\n", s.ID, s.Phase, applied)
+		}
+		return
+	}
+
+	if *to == "" && *phase == "" && !*dryRun {
+		if err := migrateLocked(context.Background(), db, locker); err != nil {
+			a.logger.WithError(err).Fatal("Error applying database migrations")
+		}
+		a.logger.Info("Successfully ran database migrations")
+		return
+	}
+
+	release, err := lock.Acquire(context.Background(), locker, "migrations", time.Second)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error acquiring lock for applying migrations")
+	}
+	defer release()
+
+	steps, err := relational.RunMigrations(gormDB, relational.MigrationOptions{
+		To:     *to,
+		Phase:  relational.MigrationPhase(*phase),
+		DryRun: *dryRun,
+	})
+	for _, step := range steps {
+		fmt.Println(step)
+	}
+	if err != nil {
 		a.logger.WithError(err).Fatal("Error applying database migrations")
 	}
-	a.logger.Info("Successfully ran database migrations")
+	if *dryRun {
+		a.logger.WithField("steps", len(steps)).Info("Dry run finished, no migrations have been applied")
+		return
+	}
+	a.logger.WithField("steps", len(steps)).Info("Successfully ran database migrations")
+}
+
+// migrateLocked applies all pending migrations while holding the migrations
+// lock, so instances starting at the same time wait for each other instead
+// of applying the same migrations concurrently.
+func migrateLocked(ctx context.Context, db persistence.Service, locker lock.Locker) error {
+	release, err := lock.Acquire(ctx, locker, "migrations", time.Second)
+	if err != nil {
+		return fmt.Errorf("error acquiring lock for applying migrations: %w", err)
+	}
+	defer release()
+	return db.Migrate()
 }
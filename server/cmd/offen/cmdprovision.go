@@ -0,0 +1,117 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+	"golang.org/x/crypto/ssh/terminal"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var provisionUsage = `
+"provision" makes the accounts of an instance match the given YAML document.
+Accounts are identified by their id, so the same document can be applied
+repeatedly. Each change is printed, passing -dry-run prints the changes
+without applying them. A document looks like:
+
+accounts:
+  - id: 9b63c4d8-65c0-438c-9d30-cc4b01173393
+    name: My Website
+    retention_period: 30days
+    allowed_origins:
+      - https://www.example.com
+    members:
+      - email: me@example.com
+        role: admin
+
+Adding or removing members of existing accounts requires the credentials of
+one of their admins to be passed using -email. The password will be prompted
+for.
+
+Usage of "provision":
+`
+
+func cmdProvision(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), provisionUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile = cmd.String("envfile", "", "the env file to use")
+		file    = cmd.String("f", "", "the document describing the accounts")
+		dryRun  = cmd.Bool("dry-run", false, "print changes without applying them")
+		email   = cmd.String("email", "", "the email address of an account admin")
+	)
+	cmd.Parse(flags)
+	a := newApp(false, true, *envFile)
+
+	if *file == "" {
+		a.logger.Fatal("Flag -f is required")
+	}
+	read, err := os.ReadFile(*file)
+	if err != nil {
+		a.logger.WithError(err).Fatalf("Unable to read given file %s", *file)
+	}
+	var conf persistence.ProvisionConfig
+	if err := yaml.Unmarshal(read, &conf); err != nil {
+		a.logger.WithError(err).Fatalf("Error parsing content of given file %s", *file)
+	}
+	for _, account := range conf.Accounts {
+		if account.RetentionPeriod != nil && *account.RetentionPeriod != "" {
+			if _, err := config.RetentionDuration(*account.RetentionPeriod); err != nil {
+				a.logger.WithError(err).Fatalf("Invalid retention period for account %s", account.AccountID)
+			}
+		}
+		if account.BotPolicy != nil && *account.BotPolicy != "" {
+			var policy config.BotPolicy
+			if err := policy.Decode(*account.BotPolicy); err != nil {
+				a.logger.WithError(err).Fatalf("Invalid bot policy for account %s", account.AccountID)
+			}
+		}
+	}
+
+	credentials := persistence.ProvisionCredentials{EmailAddress: *email}
+	if *email != "" {
+		a.logger.Info("You can now enter your password (input is not displayed):")
+		input, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			a.logger.WithError(err).Fatal("Error reading password")
+		}
+		credentials.Password = string(input)
+	}
+
+	gormDB, dbErr := newDB(a.config, a.logger)
+	if dbErr != nil {
+		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
+	}
+	dal, err := newDAL(a.config, gormDB)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating data access layer")
+	}
+	db, err := persistence.New(
+		dal,
+	)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating persistence layer")
+	}
+
+	result, err := db.Provision(conf, credentials, *dryRun)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error provisioning accounts")
+	}
+	for _, change := range result.Changes {
+		fmt.Fprintf(os.Stdout, "%s %s %s %q -> %q\n", change.Action, change.AccountID, change.Target, change.From, change.To)
+	}
+	if *dryRun {
+		a.logger.Infof("Dry run found %d changes, nothing has been applied", len(result.Changes))
+		return
+	}
+	a.logger.Infof("Successfully applied %d changes", len(result.Changes))
+}
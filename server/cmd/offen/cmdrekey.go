@@ -0,0 +1,78 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/offen/offen/server/keys"
+)
+
+var rekeyUsage = `
+"rekey" re-encrypts a SQLite database that is encrypted using SQLCipher with
+the key contained in the given key file. In case the key file does not exist
+yet, a new random key will be generated and written to the given location.
+Stop all running instances before running this command and update
+OFFEN_DATABASE_SQLCIPHERKEYFILE to point to the new key file afterwards.
+
+Usage of "rekey":
+`
+
+func cmdRekey(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), rekeyUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile = cmd.String("envfile", "", "the env file to use")
+		keyFile = cmd.String("keyfile", "", "the location of the key file holding the new key")
+	)
+	cmd.Parse(flags)
+	a := newApp(false, true, *envFile)
+
+	if *keyFile == "" {
+		a.logger.Fatal("Flag -keyfile is required")
+	}
+	if a.config.Database.Dialect.String() != "sqlite3" || !a.config.Database.SQLCipher {
+		a.logger.Fatal("Rekeying is only supported for SQLite databases using SQLCipher")
+	}
+
+	if _, err := os.Stat(*keyFile); errors.Is(err, os.ErrNotExist) {
+		value, err := keys.GenerateRandomValue(keys.DefaultEncryptionKeySize)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Error generating new key")
+		}
+		if err := os.WriteFile(*keyFile, []byte(value), 0600); err != nil {
+			a.logger.WithError(err).Fatal("Error writing new key file")
+		}
+		a.logger.Infof("Wrote newly generated key to %s", *keyFile)
+	}
+	newKey, err := readSQLCipherKeyFile(*keyFile)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error reading new key")
+	}
+
+	gormDB, dbErr := newDB(a.config, a.logger)
+	if dbErr != nil {
+		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
+	}
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error accessing database connection")
+	}
+	// rekeying happens on a single connection, other connections would
+	// still use the previous key
+	sqlDB.SetMaxOpenConns(1)
+	defer sqlDB.Close()
+
+	if _, err := sqlDB.Exec(sqlcipherPragma("rekey", newKey)); err != nil {
+		a.logger.WithError(err).Fatal("Error rekeying database")
+	}
+	a.logger.Info("Successfully rekeyed database")
+	a.logger.Infof("Make sure to set OFFEN_DATABASE_SQLCIPHERKEYFILE to %s before restarting Offen", *keyFile)
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/offen/offen/server/backup"
+	"github.com/offen/offen/server/persistence"
+)
+
+var restoreUsage = `
+"restore" downloads an encrypted backup from the configured object storage and
+restores it into the connected database. By default, the most recent backup
+is restored from the primary store. Restoring into a database that already
+contains data requires passing -force, which drops all existing data.
+
+Usage of "restore":
+`
+
+func cmdRestore(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), restoreUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile = cmd.String("envfile", "", "the env file to use")
+		key     = cmd.String("key", "", "the key of the backup to restore (defaults to the most recent backup)")
+		region  = cmd.String("region", "", "restore from the replica in the given region instead of the primary store")
+		force   = cmd.Bool("force", false, "drop all existing data before restoring")
+	)
+	cmd.Parse(flags)
+	a := newApp(false, true, *envFile)
+
+	if a.config.Backup.Passphrase == "" {
+		a.logger.Fatal("OFFEN_BACKUP_PASSPHRASE is required for restoring backups")
+	}
+
+	stores, err := newBackupStores(a.config)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error configuring backup stores")
+	}
+	store := stores[0]
+	if *region != "" {
+		store = nil
+		for i, replica := range a.config.Backup.Replicas {
+			if replica.Region == *region {
+				store = stores[i+1]
+				break
+			}
+		}
+		if store == nil {
+			a.logger.Fatalf("No backup replica configured for region %s", *region)
+		}
+	}
+
+	snapshot, err := backup.Fetch(store, a.config.Backup.Prefix, *key, a.config.Backup.Passphrase)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error fetching backup")
+	}
+
+	gormDB, dbErr := newDB(a.config, a.logger)
+	if dbErr != nil {
+		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
+	}
+	dal, err := newDAL(a.config, gormDB)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating data access layer")
+	}
+	db, err := persistence.New(
+		dal,
+	)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error creating persistence layer")
+	}
+
+	if err := db.Restore(snapshot, *force); err != nil {
+		a.logger.WithError(err).Fatal("Error restoring backup")
+	}
+	a.logger.WithField("accounts", len(snapshot.Accounts)).WithField("events", len(snapshot.Events)).Info("Successfully restored backup")
+}
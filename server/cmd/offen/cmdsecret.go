@@ -7,6 +7,7 @@ import (
 	"flag"
 	"fmt"
 
+	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/keys"
 )
 
@@ -16,10 +17,26 @@ cookies or similar. The default length of 16 is a good default value for
 generating a value to use as OFFEN_SECRET. Pass '-quiet' to print a single secret
 to stdout (this can be used when creating config files for example).
 
+Run "secret rotate" for replacing the secret of an existing installation.
+
 Usage of "secret":
 `
 
+var secretRotateUsage = `
+"secret rotate" replaces OFFEN_SECRET in the env file in use with a newly
+generated value. The previous value is prepended to OFFEN_PREVIOUSSECRETS so
+that sessions, tokens and second factors created using it stay valid. Restart
+all running instances afterwards for the new secret to take effect.
+
+Usage of "secret rotate":
+`
+
 func cmdSecret(subcommand string, flags []string) {
+	if len(flags) != 0 && flags[0] == "rotate" {
+		cmdSecretRotate(subcommand+" rotate", flags[1:])
+		return
+	}
+
 	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
 	cmd.Usage = func() {
 		fmt.Fprint(flag.CommandLine.Output(), secretUsage)
@@ -45,3 +62,32 @@ func cmdSecret(subcommand string, flags []string) {
 		}
 	}
 }
+
+func cmdSecretRotate(subcommand string, flags []string) {
+	cmd := flag.NewFlagSet(subcommand, flag.ExitOnError)
+	cmd.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), secretRotateUsage)
+		cmd.PrintDefaults()
+	}
+	var (
+		envFile = cmd.String("envfile", "", "the env file to use")
+		keep    = cmd.Int("keep", 1, "the number of previous secrets to keep for verifying existing values")
+	)
+	cmd.Parse(flags)
+
+	l := newLogger()
+	cfg, err := config.New(false, *envFile)
+	if err != nil {
+		l.WithError(err).Fatal("Unable to read configuration")
+	}
+	if cfg.Database.SQLCipher && cfg.Database.SQLCipherKeyFile.String() == "" {
+		l.Fatal(
+			"The database encryption key is derived from OFFEN_SECRET. " +
+				"Use `offen rekey -keyfile` and set OFFEN_DATABASE_SQLCIPHERKEYFILE before rotating the secret.",
+		)
+	}
+	if err := config.RotateSecret(*envFile, *keep); err != nil {
+		l.WithError(err).Fatal("Error rotating secret")
+	}
+	l.Info("Successfully rotated secret, restart Offen for the change to take effect")
+}
@@ -5,22 +5,48 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/offen/offen/server/backup"
+	"github.com/offen/offen/server/cache"
 	"github.com/offen/offen/server/config"
-	"github.com/offen/offen/server/locales"
+	"github.com/offen/offen/server/dnschallenge"
+	"github.com/offen/offen/server/eventsink"
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/lifecycle"
+	"github.com/offen/offen/server/livefeed"
+	"github.com/offen/offen/server/lock"
+	"github.com/offen/offen/server/logingest"
+	"github.com/offen/offen/server/mailqueue"
+	"github.com/offen/offen/server/metrics"
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/persistence/buffered"
+	"github.com/offen/offen/server/persistence/instrumented"
 	"github.com/offen/offen/server/persistence/relational"
 	"github.com/offen/offen/server/public"
+	"github.com/offen/offen/server/ratelimiter"
+	"github.com/offen/offen/server/redis"
+	"github.com/offen/offen/server/remotefs"
 	"github.com/offen/offen/server/router"
+	"github.com/offen/offen/server/s3"
+	"github.com/offen/offen/server/scheduler"
+	"github.com/offen/offen/server/stylestore"
+	"github.com/offen/offen/server/systemd"
+	"github.com/offen/offen/server/webhook"
 	"golang.org/x/crypto/acme/autocert"
-	"mpldr.codes/oidc"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
 )
 
 var serveUsage = `
@@ -53,49 +79,226 @@ func cmdServe(subcommand string, flags []string) {
 	envFile := cmd.String("envfile", "", "the env file to use")
 	cmd.Parse(flags)
 	a := newApp(false, false, *envFile)
+	lc := lifecycle.New()
 
 	gormDB, err := newDB(a.config, a.logger)
 	if err != nil {
 		a.logger.WithError(err).Fatal("Unable to establish database connection")
 	}
 
+	replicaDBs, err := newReplicaDBs(a.config, a.logger)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Unable to establish read replica connection")
+	}
+
+	var registry *metrics.Registry
+	if a.config.Metrics.Enabled {
+		registry = metrics.New()
+		for _, db := range append([]*gorm.DB{gormDB}, replicaDBs...) {
+			if err := relational.ObserveQueries(db, registry); err != nil {
+				a.logger.WithError(err).Fatal("Unable to instrument database connection")
+			}
+		}
+	}
+
+	liveFeed := livefeed.New()
+	persistenceConfigs := []persistence.Config{
+		persistence.WithInsertListener(liveFeed.Publish),
+		persistence.WithSecret(a.config.Secret.Bytes()),
+	}
+	if a.config.EventSink.URL != "" {
+		publisher, err := eventsink.NewPublisher(a.config.EventSink.URL)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Failed initializing event sink, cannot continue")
+		}
+		sink := eventsink.New(
+			publisher,
+			a.config.EventSink.Topic,
+			eventsink.WithQueueSize(a.config.EventSink.QueueSize),
+			eventsink.WithMetrics(registry),
+		)
+		go sink.Run(lc.Context(), func(err error) {
+			a.logger.WithError(err).Error("Error forwarding events to event sink")
+		})
+		persistenceConfigs = append(persistenceConfigs, persistence.WithInsertListener(sink.Publish))
+		a.logger.Info("Forwarding ingested events to event sink")
+	}
+	if len(a.config.PreviousSecrets) != 0 {
+		var previousSecrets [][]byte
+		for _, secret := range a.config.PreviousSecrets {
+			previousSecrets = append(previousSecrets, secret.Bytes())
+		}
+		persistenceConfigs = append(persistenceConfigs, persistence.WithPreviousSecrets(previousSecrets...))
+	}
+	if a.config.App.SessionStore == "memory" {
+		persistenceConfigs = append(persistenceConfigs, persistence.WithSessionStore(persistence.NewMemorySessionStore()))
+	}
+	if a.config.App.QuotaEventsPerMonth > 0 || a.config.App.QuotaStoredEvents > 0 {
+		persistenceConfigs = append(persistenceConfigs, persistence.WithQuotas(persistence.Quotas{
+			EventsPerMonth: a.config.App.QuotaEventsPerMonth,
+			StoredEvents:   a.config.App.QuotaStoredEvents,
+		}))
+	}
+	persistenceConfigs = append(persistenceConfigs, persistence.WithInvitationExpiry(a.config.App.InvitationExpiry))
+	persistenceConfigs = append(persistenceConfigs, persistence.WithLockout(persistence.Lockout{
+		Threshold:   a.config.Lockout.Threshold,
+		Duration:    a.config.Lockout.Duration,
+		MaxDuration: a.config.Lockout.MaxDuration,
+	}))
+
+	dal, err := newDAL(a.config, gormDB, replicaDBs...)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Unable to create data access layer")
+	}
+	dal = instrumented.NewInstrumentedDAL(
+		dal,
+		instrumented.WithMetrics(registry),
+		instrumented.WithSlowQueryLog(a.logger, a.config.Database.SlowQueryThreshold),
+	)
+
+	// events are batched before inserting them in case a buffer directory
+	// is configured, unless they are required to be acknowledged only after
+	// they have been inserted
+	if a.config.AsyncEventAcknowledgement() && a.config.Database.EventBufferDirectory == "" {
+		a.logger.Fatal("Acknowledging events asynchronously requires OFFEN_DATABASE_EVENTBUFFERDIRECTORY to be set")
+	}
+	var eventBuffer *buffered.DAL
+	if a.config.Database.EventBufferDirectory != "" {
+		bufferConfigs := []buffered.Config{
+			buffered.WithMaxEvents(a.config.Database.EventBufferSize),
+			buffered.WithInterval(a.config.Database.EventBufferInterval),
+			buffered.WithMetrics(registry),
+		}
+		if !a.config.AsyncEventAcknowledgement() {
+			bufferConfigs = append(bufferConfigs, buffered.WithStrictAcknowledgement())
+		}
+		eventBuffer, err = buffered.NewBufferedDAL(
+			dal,
+			a.config.Database.EventBufferDirectory.String(),
+			bufferConfigs...,
+		)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Unable to create event buffer")
+		}
+		go eventBuffer.Run(lc.Context(), func(err error) {
+			a.logger.WithError(err).Error("Error flushing buffered events")
+		})
+		dal = eventBuffer
+	}
 	db, err := persistence.New(
-		relational.NewRelationalDAL(gormDB),
+		dal,
+		persistenceConfigs...,
 	)
 	if err != nil {
 		a.logger.WithError(err).Fatal("Unable to create persistence layer")
 	}
 
+	// locks make sure destructive maintenance work is never run by multiple
+	// instances at the same time
+	locker, err := newLocker(a.config, gormDB)
+	if err != nil {
+		a.logger.WithError(err).Fatal("Unable to create locker")
+	}
+
 	if a.config.App.SingleNode {
-		if err := db.Migrate(); err != nil {
+		if err := migrateLocked(lc.Context(), db, locker); err != nil {
 			a.logger.WithError(err).Fatal("Error applying database migrations")
 		} else {
 			a.logger.Info("Successfully applied database migrations")
 		}
 	}
 
+	if a.config.LogIngest.Path != "" {
+		if a.config.LogIngest.AccountID == "" {
+			a.logger.Fatal("Ingesting access logs requires OFFEN_LOGINGEST_ACCOUNTID to be set")
+		}
+		parse, err := logingest.NewParser(a.config.LogIngest.Format.String())
+		if err != nil {
+			a.logger.WithError(err).Fatal("Failed configuring access log ingestion, cannot continue")
+		}
+		ingester := logingest.New(
+			db,
+			a.config.LogIngest.AccountID,
+			parse,
+			logingest.WithRoot(a.config.LogIngest.Root),
+		)
+		go ingester.Run(lc.Context(), a.config.LogIngest.Path.String(), func(err error) {
+			a.logger.WithError(err).Warn("Error ingesting access log")
+		})
+		a.logger.Infof("Ingesting access log at %s", a.config.LogIngest.Path)
+	}
+
 	fs := public.NewLocalizedFS(a.config.App.Locale.String())
-	gettext, gettextErr := locales.GettextFor(a.config.App.Locale.String())
-	if gettextErr != nil {
-		a.logger.WithError(gettextErr).Fatal("Failed reading locale files, cannot continue")
+	if a.config.Assets.Origin != "embedded" {
+		origin, err := newAssetsOrigin(a.config)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Failed initializing origin for static assets, cannot continue")
+		}
+		a.logger.Infof("Serving static assets from %s origin", a.config.Assets.Origin)
+		fs = public.NewRemoteLocalizedFS(
+			a.config.App.Locale.String(),
+			remotefs.New(origin, a.config.Assets.CacheDirectory.String(), a.config.Assets.CacheTTL),
+		)
 	}
-	tpl, tplErr := fs.HTMLTemplate(gettext)
+	tpl, emails, localized, tplErr := newTemplates(a.config, fs)
 	if tplErr != nil {
 		a.logger.WithError(tplErr).Fatal("Failed parsing template files, cannot continue")
 	}
-	emails, emailErr := fs.EmailTemplate(gettext)
-	if emailErr != nil {
-		a.logger.WithError(emailErr).Fatal("Failed parsing template files, cannot continue")
+
+	// some values can be changed at runtime by sending SIGHUP or by
+	// updating the env file in use
+	live := config.NewLive(a.config)
+
+	// mails are sent by a background worker so that slow transports do not
+	// block request handlers
+	mails := &mailqueue.Queue{
+		DB:          db,
+		Transport:   a.config.NewMailer(),
+		MaxAttempts: a.config.Mailer.MaxAttempts,
+	}
+
+	// all background work is run by the scheduler, guarded by locks that
+	// are shared by all instances
+	jobs := &scheduler.Scheduler{
+		Locker: locker,
+		Jitter: a.config.Jobs.Jitter,
+		OnResult: func(name string, affected int, err error) {
+			logger := a.logger.WithField("job", name)
+			if err != nil {
+				logger.WithError(err).Error("Error running background job")
+				return
+			}
+			if affected != 0 {
+				logger.WithField("affected", affected).Info("Cron successfully ran background job")
+			}
+		},
 	}
 
 	routerConfig := []router.Config{
 		router.WithDatabase(db),
+		router.WithScheduler(jobs),
 		router.WithLogger(a.logger),
 		router.WithTemplate(tpl),
-		router.WithEmails(emails),
+		router.WithEmailTemplates(emails),
 		router.WithConfig(a.config),
+		router.WithLiveConfig(live),
 		router.WithFS(fs),
-		router.WithMailer(a.config.NewMailer()),
+		router.WithIntegrity(fs.Integrity(public.ScriptAssets...)),
+		router.WithMailer(mails),
+		router.WithLiveFeed(liveFeed),
+	}
+
+	if !a.config.Server.ReverseProxy {
+		sink, err := newAccessLogSink(a.config)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Unable to open access log sink")
+		}
+		routerConfig = append(routerConfig, router.WithAccessLogOutput(sink))
+	}
+
+	if registry != nil {
+		a.logger.Info("Exposing metrics at /metricsz")
+		routerConfig = append(routerConfig, router.WithMetrics(registry))
 	}
 
 	if a.config.OIDC.Issuer != "" &&
@@ -104,32 +307,194 @@ func cmdServe(subcommand string, flags []string) {
 		a.logger.Info("Using OIDC authentication")
 		// TODO: generate a proper callback URL
 		// callbackUrl := a.config.App.DeployTarget
-		oidcCfg, err := oidc.Configure(a.config.OIDC.Issuer, "")
+		routerConfig = append(routerConfig, router.WithOIDCIssuer("default", a.config.OIDC.Issuer))
+	}
+
+	if a.config.App.StylesStore == "s3" {
+		client, err := s3.New(
+			a.config.S3.Endpoint,
+			a.config.S3.Bucket,
+			a.config.S3.Region,
+			a.config.S3.AccessKeyID,
+			a.config.S3.SecretAccessKey,
+		)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Failed initializing object storage for account styles, cannot continue")
+		}
+		a.logger.Info("Storing account styles in object storage")
+		routerConfig = append(routerConfig, router.WithStyleStore(stylestore.NewS3Store(client, db, a.config.S3.Prefix, a.config.S3.PublicURL)))
+	}
+
+	var limitBackend ratelimiter.Backend
+	if a.config.Cache.RedisURL != "" {
+		client, err := redis.New(a.config.Cache.RedisURL)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Failed initializing shared cache, cannot continue")
+		}
+		a.logger.Info("Using Redis as shared cache")
+		routerConfig = append(routerConfig, router.WithCache(
+			cache.NewRedis(client, "offen-", cache.NewLocal(time.Minute), func(err error) {
+				a.logger.WithError(err).Warn("Shared cache is unavailable, falling back to local cache")
+			}),
+		))
+		limitBackend = ratelimiter.NewRedisBackend(client, "offen-", ratelimiter.NewMemoryBackend(time.Minute), func(err error) {
+			a.logger.WithError(err).Warn("Shared rate limits are unavailable, falling back to local rate limits")
+		})
+		routerConfig = append(routerConfig, router.WithRateLimitBackend(limitBackend))
+	}
+
+	if a.config.SAML.IDPMetadataURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		sp, err := newSAMLServiceProvider(ctx, a.config)
+		cancel()
+		if err != nil {
+			a.logger.WithError(err).Fatal("Failed configuring SAML authentication, cannot continue")
+		}
+		a.logger.Info("Using SAML authentication")
+		routerConfig = append(routerConfig, router.WithSAML(sp))
+	}
+
+	if a.config.WebAuthn.RPID != "" {
+		w, err := webauthn.New(&webauthn.Config{
+			RPID:          a.config.WebAuthn.RPID,
+			RPDisplayName: a.config.WebAuthn.RPDisplayName,
+			RPOrigins:     a.config.WebAuthn.RPOrigins,
+		})
 		if err != nil {
-			a.logger.WithError(err).Fatal("Failed initializing OIDC with provided configuration, cannot continue")
+			a.logger.WithError(err).Fatal("Failed configuring passkey login, cannot continue")
 		}
-		routerConfig = append(routerConfig, router.WithOIDC(oidcCfg))
+		routerConfig = append(routerConfig, router.WithWebAuthn(w))
+	}
+
+	if a.config.Passwords.MinScore < 0 || a.config.Passwords.MinScore > 4 {
+		a.logger.Fatalf("OFFEN_PASSWORDS_MINSCORE must be between 0 and 4, got %d", a.config.Passwords.MinScore)
+	}
+	if a.config.Passwords.BreachFilter != "" {
+		breaches, err := keys.LoadBloomFilter(a.config.Passwords.BreachFilter.String())
+		if err != nil {
+			a.logger.WithError(err).Fatal("Failed loading filter of breached passwords, cannot continue")
+		}
+		a.logger.Info("Checking new passwords against filter of breached passwords")
+		routerConfig = append(routerConfig, router.WithBreachedPasswords(breaches))
+	}
+
+	if len(a.config.OIDC.GroupMapping) != 0 && a.config.OIDC.Sponsor == "" {
+		a.logger.Warn("OIDC group mapping is configured without a sponsor, provisioning new users will fail")
+	}
+
+	for name, issuer := range a.config.OIDC.Providers {
+		a.logger.WithField("provider", name).Info("Using OIDC authentication")
+		routerConfig = append(routerConfig, router.WithOIDCIssuer(name, issuer))
+	}
+
+	routerConfig = append(routerConfig, localized...)
+
+	handler := router.New(routerConfig...)
+	{
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		if err := handler.Warmup(ctx); err != nil {
+			a.logger.WithError(err).Fatal("Failed warming up application, cannot continue")
+		}
+		cancel()
 	}
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf("0.0.0.0:%d", a.config.Server.Port),
-		Handler: router.New(routerConfig...),
+		Handler: handler,
+	}
+	// live event streams would otherwise keep the server from shutting down
+	srv.RegisterOnShutdown(liveFeed.Close)
+
+	useDNSChallenge := len(a.config.Server.AutoTLS) != 0 && a.config.DNSChallenge.Provider != ""
+	if useDNSChallenge {
+		provider, err := newDNSProvider(a.config)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Failed configuring DNS provider, cannot continue")
+		}
+		certManager := &dnschallenge.Manager{
+			Provider:         provider,
+			Domains:          a.config.Server.AutoTLS,
+			Email:            a.config.Server.LetsEncryptEmail,
+			Cache:            autocert.DirCache(a.config.Server.CertificateCache),
+			PropagationDelay: a.config.DNSChallenge.PropagationDelay,
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+		if err := certManager.Obtain(ctx); err != nil {
+			a.logger.WithError(err).Fatal("Failed obtaining certificate using DNS-01 challenge, cannot continue")
+		}
+		cancel()
+		go certManager.Renew(lc.Context(), time.Hour*12, func(err error) {
+			a.logger.WithError(err).Error("Error renewing certificate")
+		})
+		srv.Addr = ":https"
+		srv.TLSConfig = &tls.Config{GetCertificate: certManager.GetCertificate}
 	}
+
+	var autocertManager *autocert.Manager
+	if len(a.config.Server.AutoTLS) != 0 && !useDNSChallenge {
+		autocertManager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(a.config.Server.AutoTLS...),
+			Cache:      autocert.DirCache(a.config.Server.CertificateCache),
+			Email:      a.config.Server.LetsEncryptEmail,
+		}
+		srv.Addr = ":https"
+		srv.TLSConfig = autocertManager.TLSConfig()
+	}
+
+	if err := configureHTTP2(srv, a.config); err != nil {
+		a.logger.WithError(err).Fatal("Failed configuring HTTP/2, cannot continue")
+	}
+
+	var socket net.Listener
+	activated, err := systemd.Listeners()
+	if err != nil {
+		a.logger.WithError(err).Fatal("Error using sockets passed by systemd")
+	}
+	if len(activated) != 0 {
+		// sockets passed by systemd take precedence over any configured address
+		if len(a.config.Server.AutoTLS) != 0 {
+			a.logger.Fatal("AutoTLS cannot be used with socket activation, cannot continue")
+		}
+		socket = activated[0]
+		for _, l := range activated[1:] {
+			l.Close()
+		}
+	} else if a.config.Server.Socket != "" {
+		if len(a.config.Server.AutoTLS) != 0 {
+			a.logger.Fatal("AutoTLS cannot be used when listening on a unix socket, cannot continue")
+		}
+		socket, err = listenUnix(a.config.Server.Socket.String(), a.config.Server.SocketMode.FileMode())
+		if err != nil {
+			a.logger.WithError(err).Fatal("Error binding server to unix socket")
+		}
+	}
+
 	go func() {
-		if a.config.Server.SSLCertificate != "" && a.config.Server.SSLKey != "" {
+		if socket != nil {
+			var err error
+			if a.config.Server.SSLCertificate != "" && a.config.Server.SSLKey != "" {
+				err = srv.ServeTLS(socket, a.config.Server.SSLCertificate.String(), a.config.Server.SSLKey.String())
+			} else {
+				err = srv.Serve(socket)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				a.logger.WithError(err).Fatal("Error serving requests on socket")
+			}
+		} else if a.config.Server.SSLCertificate != "" && a.config.Server.SSLKey != "" {
 			err := srv.ListenAndServeTLS(a.config.Server.SSLCertificate.String(), a.config.Server.SSLKey.String())
 			if err != nil && err != http.ErrServerClosed {
 				a.logger.WithError(err).Fatal("Error binding server to network")
 			}
-		} else if len(a.config.Server.AutoTLS) != 0 {
-			m := autocert.Manager{
-				Prompt:     autocert.AcceptTOS,
-				HostPolicy: autocert.HostWhitelist(a.config.Server.AutoTLS...),
-				Cache:      autocert.DirCache(a.config.Server.CertificateCache),
-				Email:      a.config.Server.LetsEncryptEmail,
+		} else if useDNSChallenge {
+			// certificates are served from the TLS config
+			if err := srv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				a.logger.WithError(err).Fatal("Error binding server to network")
 			}
-			go http.ListenAndServe(":http", m.HTTPHandler(nil))
-			if err := http.Serve(m.Listener(), srv.Handler); err != nil && err != http.ErrServerClosed {
+		} else if autocertManager != nil {
+			go http.ListenAndServe(":http", autocertManager.HTTPHandler(nil))
+			// certificates are served from the TLS config
+			if err := srv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
 				a.logger.WithError(err).Fatal("Error binding server to network")
 			}
 		} else {
@@ -138,39 +503,308 @@ func cmdServe(subcommand string, flags []string) {
 			}
 		}
 	}()
-	if len(a.config.Server.AutoTLS) != 0 {
+	if len(activated) != 0 {
+		a.logger.Infof("Server now listening on socket %s passed by systemd", socket.Addr())
+	} else if socket != nil {
+		a.logger.Infof("Server now listening on unix socket %s", a.config.Server.Socket)
+	} else if useDNSChallenge {
+		a.logger.Info("Server now listening on port 443 using AutoTLS with DNS-01 challenges")
+	} else if len(a.config.Server.AutoTLS) != 0 {
 		a.logger.Info("Server now listening on port 80 and 443 using AutoTLS")
 	} else {
 		a.logger.Infof("Server now listening on port %d", a.config.Server.Port)
 	}
 
-	if a.config.App.SingleNode {
-		hourlyJob := time.Tick(time.Hour)
-		runOnInit := make(chan bool)
+	var grpcServer *grpc.Server
+	if a.config.Server.GRPCPort != 0 {
+		var err error
+		grpcServer, err = newIngestServer(a.config, db, limitBackend, registry)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Failed configuring gRPC ingestion server, cannot continue")
+		}
+		listener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", a.config.Server.GRPCPort))
+		if err != nil {
+			a.logger.WithError(err).Fatal("Error binding gRPC server to network")
+		}
 		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				a.logger.WithError(err).Fatal("Error serving gRPC requests")
+			}
+		}()
+		a.logger.Infof("gRPC ingestion server now listening on port %d", a.config.Server.GRPCPort)
+	}
+
+	// hooks run in order: requests are drained first so that mails they
+	// queue are flushed before the database connection is closed
+	lc.OnShutdown("http server", srv.Shutdown)
+	if grpcServer != nil {
+		lc.OnShutdown("grpc server", func(ctx context.Context) error {
+			stopped := make(chan struct{})
+			go func() {
+				grpcServer.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-ctx.Done():
+				grpcServer.Stop()
+				return ctx.Err()
+			case <-stopped:
+				return nil
+			}
+		})
+	}
+	lc.OnShutdown("mail queue", func(context.Context) error {
+		delivered, err := mails.Deliver()
+		if delivered > 0 {
+			a.logger.WithField("delivered", delivered).Info("Flushed queued mails")
+		}
+		return err
+	})
+	if eventBuffer != nil {
+		lc.OnShutdown("event buffer", func(context.Context) error {
+			return eventBuffer.Close()
+		})
+	}
+	lc.OnShutdown("database", func(context.Context) error {
+		var errs []error
+		for _, db := range append([]*gorm.DB{gormDB}, replicaDBs...) {
+			sqlDB, err := db.DB()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			// Close waits for queries that have already started to finish
+			errs = append(errs, sqlDB.Close())
+		}
+		return errors.Join(errs...)
+	})
+
+	addJob := func(job scheduler.Job) {
+		if job.Schedule == nil {
+			return
+		}
+		if err := jobs.Add(job); err != nil {
+			a.logger.WithError(err).Fatal("Failed scheduling background job, cannot continue")
+		}
+	}
+
+	// Maintenance jobs must not be run by multiple instances at once. This
+	// is guaranteed either by running a single node only or by using locks
+	// that are shared between instances.
+	if a.config.App.SingleNode || lock.Shared(locker) {
+		maintenance := a.config.Jobs.Maintenance.Schedule()
+		addJob(scheduler.Job{
+			Name:      "expire-events",
+			Schedule:  maintenance,
+			RunOnInit: true,
+			Run: func() (int, error) {
+				return db.Expire(live.Load().App.Retention.Duration(), config.RetentionDuration)
+			},
+		})
+		addJob(scheduler.Job{
+			Name:      "expire-audit-log",
+			Schedule:  maintenance,
+			RunOnInit: true,
+			Run: func() (int, error) {
+				return db.ExpireAuditLog(a.config.App.AuditRetention)
+			},
+		})
+		addJob(scheduler.Job{
+			Name:      "expire-mails",
+			Schedule:  maintenance,
+			RunOnInit: true,
+			Run: func() (int, error) {
+				return db.ExpireMails(a.config.Mailer.Retention)
+			},
+		})
+		addJob(scheduler.Job{
+			Name:      "purge-retired-accounts",
+			Schedule:  maintenance,
+			RunOnInit: true,
+			Run: func() (int, error) {
+				return db.PurgeRetiredAccounts(a.config.App.RetirementGracePeriod)
+			},
+		})
+		if threshold := a.config.App.AnomalyThreshold; threshold > 0 {
+			addJob(scheduler.Job{
+				Name:      "detect-anomalies",
+				Schedule:  maintenance,
+				RunOnInit: true,
+				Run: func() (int, error) {
+					return db.DetectAnomalies(threshold, live.Load().App.Retention.Duration())
+				},
+			})
+		}
+		if a.config.Aggregates.Enabled {
+			addJob(scheduler.Job{
+				Name:      "count-aggregates",
+				Schedule:  maintenance,
+				RunOnInit: true,
+				Run: func() (int, error) {
+					cfg := live.Load()
+					return db.CountAggregates(cfg.Aggregates.Epsilon, cfg.Aggregates.Retention)
+				},
+			})
+		}
+		if a.config.Pings.Enabled {
+			addJob(scheduler.Job{
+				Name:     "expire-pings",
+				Schedule: maintenance,
+				Run: func() (int, error) {
+					return db.ExpirePings(live.Load().Pings.Retention)
+				},
+			})
+		}
+	}
+
+	addJob(scheduler.Job{
+		Name:     "deliver-mails",
+		Schedule: a.config.Jobs.Mails.Schedule(),
+		Run:      mails.Deliver,
+	})
+
+	webhooks := &webhook.Dispatcher{
+		DB:          db,
+		Sender:      webhook.NewHTTPSender(a.config.Webhooks.Timeout),
+		MaxAttempts: a.config.Webhooks.MaxAttempts,
+	}
+	addJob(scheduler.Job{
+		Name:     "deliver-webhooks",
+		Schedule: a.config.Jobs.Webhooks.Schedule(),
+		Run:      webhooks.Deliver,
+	})
+
+	backupSchedule := a.config.Jobs.Backup.Schedule()
+	if backupSchedule == nil && a.config.Backup.Interval != 0 {
+		backupSchedule, _ = scheduler.Parse(fmt.Sprintf("@every %v", a.config.Backup.Interval))
+	}
+	if backupSchedule != nil {
+		if a.config.Backup.Passphrase == "" {
+			a.logger.Fatal("OFFEN_BACKUP_PASSPHRASE is required when backups are enabled")
+		}
+		stores, err := newBackupStores(a.config)
+		if err != nil {
+			a.logger.WithError(err).Fatal("Failed configuring backup stores, cannot continue")
+		}
+		backups := &backup.Manager{
+			DB:         db,
+			Stores:     stores,
+			Prefix:     a.config.Backup.Prefix,
+			Passphrase: a.config.Backup.Passphrase,
+			Retention:  a.config.Backup.Retention,
+		}
+		a.logger.WithField("stores", len(stores)).Infof("Creating backups on schedule %s", backupSchedule)
+		addJob(scheduler.Job{
+			Name:     "backup",
+			Schedule: backupSchedule,
+			Run: func() (int, error) {
+				key, err := backups.Backup()
+				if err != nil {
+					return 0, err
+				}
+				a.logger.WithField("key", key).Info("Cron successfully created backup")
+				return 1, nil
+			},
+		})
+	}
+
+	go jobs.Run(lc.Context())
+
+	var reloadMu sync.Mutex
+	reload := func() {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+		next, err := config.Reload(*envFile)
+		if err != nil {
+			a.logger.WithError(err).Error("Error reloading configuration, keeping current values")
+			return
+		}
+		updated := live.Update(next)
+		a.logger.SetLevel(updated.App.LogLevel.LogLevel())
+		mails.SetTransport(updated.NewMailer())
+		if err := emails.Reload(); err != nil {
+			a.logger.WithError(err).Error("Error reloading email templates, keeping current templates")
+		}
+		a.logger.Info("Successfully reloaded configuration")
+	}
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-lc.Context().Done():
+				return
+			case <-hup:
+				reload()
+			}
+		}
+	}()
+	go func() {
+		if err := config.WatchEnvFile(lc.Context(), *envFile, time.Second*10, reload); err != nil {
+			a.logger.WithError(err).Error("Error watching env file for changes")
+		}
+	}()
+	go emails.Watch(lc.Context(), time.Second*10, func(err error) {
+		if err != nil {
+			a.logger.WithError(err).Error("Error reloading email templates, keeping current templates")
+			return
+		}
+		a.logger.Info("Successfully reloaded email templates")
+	})
+	// secrets referenced in secret stores are fetched again on each reload,
+	// so rotated credentials are picked up without restarting
+	if interval := live.Load().SecretSources.RefreshInterval; interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
 			for {
 				select {
-				case <-hourlyJob:
-				case <-runOnInit:
+				case <-lc.Context().Done():
+					return
+				case <-ticker.C:
+					reload()
 				}
-				affected, err := db.Expire(config.EventRetention)
-				if err != nil {
-					a.logger.WithError(err).Errorf("Error pruning expired events")
+			}
+		}()
+	}
+
+	if _, err := systemd.Notify(systemd.StateReady); err != nil {
+		a.logger.WithError(err).Warn("Error notifying systemd about readiness")
+	}
+	if interval, err := systemd.WatchdogInterval(); err != nil {
+		a.logger.WithError(err).Warn("Error reading systemd watchdog interval, watchdog pings are disabled")
+	} else if interval != 0 {
+		go func() {
+			// pings are only sent while the database is reachable so
+			// systemd restarts the service in case the connection is lost
+			ticker := time.NewTicker(interval / 2)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-lc.Context().Done():
 					return
+				case <-ticker.C:
+					if err := db.CheckHealth(); err != nil {
+						a.logger.WithError(err).Warn("Database is unhealthy, skipping systemd watchdog ping")
+						continue
+					}
+					if _, err := systemd.Notify(systemd.StateWatchdog); err != nil {
+						a.logger.WithError(err).Warn("Error sending systemd watchdog ping")
+					}
 				}
-				a.logger.WithField("removed", affected).Info("Cron successfully pruned expired events")
 			}
 		}()
-		runOnInit <- true
 	}
 
-	quit := make(chan os.Signal)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	a.logger.WithField("signal", lc.Wait(syscall.SIGINT, syscall.SIGTERM)).Info("Shutting down server")
+	if _, err := systemd.Notify(systemd.StateStopping); err != nil {
+		a.logger.WithError(err).Warn("Error notifying systemd about shutdown")
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.Server.ShutdownTimeout)
 	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
+	if err := lc.Shutdown(ctx); err != nil {
 		a.logger.WithError(err).Fatal("Error shutting down server")
 	}
 
@@ -14,7 +14,6 @@ import (
 	uuid "github.com/gofrs/uuid"
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/offen/offen/server/persistence"
-	"github.com/offen/offen/server/persistence/relational"
 	"golang.org/x/crypto/ssh/terminal"
 	yaml "gopkg.in/yaml.v2"
 )
@@ -139,7 +138,12 @@ func cmdSetup(subcommand string, flags []string) {
 		a.logger.WithError(dbErr).Fatal("Error establishing database connection")
 	}
 
-	db, dbErr := persistence.New(relational.NewRelationalDAL(gormDB))
+	dal, dalErr := newDAL(a.config, gormDB)
+	if dalErr != nil {
+		a.logger.WithError(dalErr).Fatal("Error creating data access layer")
+	}
+
+	db, dbErr := persistence.New(dal)
 	if dbErr != nil {
 		a.logger.WithError(dbErr).Fatal("Error creating persistence layer")
 	}
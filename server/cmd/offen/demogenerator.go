@@ -0,0 +1,226 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/persistence"
+)
+
+// distribution is a list of values that are picked at random according
+// to their weight.
+type distribution []weightedValue
+
+type weightedValue struct {
+	value  string
+	weight int
+}
+
+func (d distribution) pick() string {
+	var total int
+	for _, item := range d {
+		total += item.weight
+	}
+	if total <= 0 {
+		return ""
+	}
+	n := rand.Intn(total)
+	for _, item := range d {
+		if n < item.weight {
+			return item.value
+		}
+		n -= item.weight
+	}
+	return d[len(d)-1].value
+}
+
+// parseDistribution parses a comma separated list of values, each
+// optionally followed by `=<weight>`, e.g. `/=5,/blog/=2,/about/`. Values
+// without a weight default to a weight of 1.
+func parseDistribution(s string) (distribution, error) {
+	var result distribution
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		value, weight := item, 1
+		if i := strings.LastIndex(item, "="); i != -1 {
+			if w, err := strconv.Atoi(item[i+1:]); err == nil {
+				if w < 0 {
+					return nil, fmt.Errorf("invalid negative weight for %s", item[:i])
+				}
+				value, weight = item[:i], w
+			}
+		}
+		result = append(result, weightedValue{value: value, weight: weight})
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no values given in %q", s)
+	}
+	return result, nil
+}
+
+// demoSessionTimeout is the duration of inactivity after which a simulated
+// session is considered finished
+const demoSessionTimeout = time.Minute * 15
+
+// demoReturningUsers is the maximum number of users that are kept around for
+// simulating returning visitors
+const demoReturningUsers = 100
+
+type demoUser struct {
+	userID string
+	key    []byte
+}
+
+type demoSession struct {
+	user     *demoUser
+	id       string
+	href     string
+	isMobile bool
+	geo      string
+	lastSeen time.Time
+}
+
+// demoGenerator continuously generates pageviews for the demo account so
+// that its dashboard shows live data.
+type demoGenerator struct {
+	db        persistence.Service
+	accountID string
+	root      string
+	rate      float64
+	pages     distribution
+	referrers distribution
+
+	publicKey interface{}
+	users     []*demoUser
+	sessions  []*demoSession
+}
+
+// Run generates rate events per minute until the given context is
+// cancelled. Errors are passed to onError and do not stop the generator.
+func (g *demoGenerator) Run(ctx context.Context, onError func(error)) {
+	if g.rate <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Minute) / g.rate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := g.next(now); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// next inserts a single pageview, either continuing an ongoing session
+// or starting a new one for a new or returning user.
+func (g *demoGenerator) next(now time.Time) error {
+	var active []*demoSession
+	for _, session := range g.sessions {
+		if now.Sub(session.lastSeen) < demoSessionTimeout {
+			active = append(active, session)
+		}
+	}
+	g.sessions = active
+
+	var session *demoSession
+	var referrer string
+	if len(g.sessions) != 0 && randomBool(0.4) {
+		session = g.sessions[rand.Intn(len(g.sessions))]
+		// a subsequent view will use the previously visited URL
+		// as the referrer
+		referrer = session.href
+	} else {
+		user, err := g.user()
+		if err != nil {
+			return fmt.Errorf("error creating demo user: %w", err)
+		}
+		sessionID, _ := uuid.NewV4()
+		session = &demoSession{
+			user:     user,
+			id:       sessionID.String(),
+			isMobile: randomBool(0.33),
+			geo:      randomCountryCode(),
+		}
+		g.sessions = append(g.sessions, session)
+		if randomBool(0.25) {
+			referrer = g.referrers.pick()
+		}
+	}
+
+	session.href = fmt.Sprintf("%s%s", g.root, g.pages.pick())
+	session.lastSeen = now
+	b, err := json.Marshal(&fakeEvent{
+		Type:      "PAGEVIEW",
+		Href:      session.href,
+		Geo:       session.geo,
+		Referrer:  referrer,
+		Pageload:  randomInRange(400, 1200),
+		IsMobile:  session.isMobile,
+		Timestamp: now,
+		SessionID: session.id,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling demo event: %w", err)
+	}
+	event, err := keys.EncryptWith(session.user.key, b)
+	if err != nil {
+		return fmt.Errorf("error encrypting demo event: %w", err)
+	}
+	if err := g.db.Insert(session.user.userID, g.accountID, "", event.Marshal(), nil); err != nil {
+		return fmt.Errorf("error inserting demo event: %w", err)
+	}
+	return nil
+}
+
+// user returns a user for a new session. Known users are reused now and
+// then so the data also contains returning visitors.
+func (g *demoGenerator) user() (*demoUser, error) {
+	if len(g.users) != 0 && randomBool(0.7) {
+		return g.users[rand.Intn(len(g.users))], nil
+	}
+
+	if g.publicKey == nil {
+		account, err := g.db.GetAccount(g.accountID, false, false, "")
+		if err != nil {
+			return nil, fmt.Errorf("error looking up demo account: %w", err)
+		}
+		g.publicKey = account.PublicKey
+	}
+
+	userID, key, jwk, err := newFakeUser()
+	if err != nil {
+		return nil, err
+	}
+	encryptedSecret, err := keys.EncryptAsymmetricWith(g.publicKey, jwk)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting user secret: %w", err)
+	}
+	if err := g.db.AssociateUserSecret(g.accountID, userID, encryptedSecret.Marshal()); err != nil {
+		return nil, fmt.Errorf("error associating user secret: %w", err)
+	}
+
+	user := &demoUser{userID: userID, key: key}
+	if len(g.users) < demoReturningUsers {
+		g.users = append(g.users, user)
+	} else {
+		g.users[rand.Intn(len(g.users))] = user
+	}
+	return user, nil
+}
@@ -14,11 +14,19 @@ var mainUsage = `
 
 - "serve" runs the application (this will also run when not providing a subcommand)
 - "setup" can be used to setup a new instance
+- "provision" creates and updates accounts from a declarative document
 - "secret" can be used to generate runtime secrets
 - "demo" starts an ephemeral instance for testing
 - "expire" prunes expired events from the database
 - "migrate" applies pending database migrations
+- "restore" restores the database from an encrypted backup
+- "export" writes all data in the database as line delimited JSON
+- "import" reads data written by "export" into the database
+- "import-foreign" imports data exported from other analytics tools
+- "breachfilter" creates a bloom filter of breached passwords
+- "rekey" re-encrypts a SQLCipher encrypted database using a new key
 - "debug" prints the currently applied configuration values
+- "config" validates the configuration and the services it refers to
 
 Refer to the -help content of each subcommand for information about how to use
 them. Further documentation is available at
@@ -48,12 +56,28 @@ func main() {
 		cmdServe("serve", flags)
 	case "setup":
 		cmdSetup("setup", flags)
+	case "provision":
+		cmdProvision("provision", flags)
 	case "migrate":
 		cmdMigrate("migrate", flags)
 	case "expire":
 		cmdExpire("expire", flags)
+	case "restore":
+		cmdRestore("restore", flags)
+	case "export":
+		cmdExport("export", flags)
+	case "import":
+		cmdImport("import", flags)
+	case "import-foreign":
+		cmdImportForeign("import-foreign", flags)
+	case "breachfilter":
+		cmdBreachFilter("breachfilter", flags)
+	case "rekey":
+		cmdRekey("rekey", flags)
 	case "debug":
 		cmdDebug("debug", flags)
+	case "config":
+		cmdConfig("config", flags)
 	case "secret":
 		cmdSecret("secret", flags)
 	case "version":
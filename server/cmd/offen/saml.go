@@ -0,0 +1,58 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/offen/offen/server/config"
+)
+
+// newSAMLServiceProvider creates a service provider using the given
+// configuration, fetching the metadata of the identity provider.
+func newSAMLServiceProvider(ctx context.Context, c *config.Config) (*saml.ServiceProvider, error) {
+	keyPair, err := tls.LoadX509KeyPair(c.SAML.Certificate.String(), c.SAML.Key.String())
+	if err != nil {
+		return nil, fmt.Errorf("error loading certificate: %w", err)
+	}
+	certificate, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate: %w", err)
+	}
+	key, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is expected to be a RSA private key")
+	}
+
+	rootURL, err := url.Parse(strings.TrimSuffix(c.SAML.RootURL, "/"))
+	if err != nil || rootURL.Scheme == "" || rootURL.Host == "" {
+		return nil, fmt.Errorf("invalid root url %s", c.SAML.RootURL)
+	}
+	idpMetadataURL, err := url.Parse(c.SAML.IDPMetadataURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity provider metadata url: %w", err)
+	}
+	idpMetadata, err := samlsp.FetchMetadata(ctx, http.DefaultClient, *idpMetadataURL)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching identity provider metadata: %w", err)
+	}
+
+	return &saml.ServiceProvider{
+		Key:         key,
+		Certificate: certificate,
+		MetadataURL: *rootURL.JoinPath("/api/login/saml/metadata"),
+		AcsURL:      *rootURL.JoinPath("/api/login/saml/acs"),
+		IDPMetadata: idpMetadata,
+	}, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/offen/offen/server/config"
+)
+
+// sqlcipherKeyLabel is used for deriving the database key from the
+// application secret, so that the key differs from all other values derived
+// from the secret.
+const sqlcipherKeyLabel = "offen-sqlcipher-database-key"
+
+// sqlcipherKey returns the raw key used for encrypting the SQLite database.
+// In case a key file is configured, the key is the SHA-256 hash of its
+// content. Otherwise, it is derived from the application secret.
+func sqlcipherKey(c *config.Config) ([]byte, error) {
+	if keyFile := c.Database.SQLCipherKeyFile.String(); keyFile != "" {
+		return readSQLCipherKeyFile(keyFile)
+	}
+	if len(c.Secret.Bytes()) == 0 {
+		return nil, errors.New("sqlcipher: neither a key file nor a secret is configured")
+	}
+	mac := hmac.New(sha256.New, c.Secret.Bytes())
+	mac.Write([]byte(sqlcipherKeyLabel))
+	return mac.Sum(nil), nil
+}
+
+func readSQLCipherKeyFile(location string) ([]byte, error) {
+	content, err := os.ReadFile(location)
+	if err != nil {
+		return nil, fmt.Errorf("sqlcipher: error reading key file: %w", err)
+	}
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 {
+		return nil, fmt.Errorf("sqlcipher: key file %s is empty", location)
+	}
+	key := sha256.Sum256(content)
+	return key[:], nil
+}
+
+// sqlcipherPragma returns the statement that applies the given raw key
+// using the given pragma, i.e. `key` or `rekey`. Raw keys skip the key
+// derivation SQLCipher would apply to passphrases.
+func sqlcipherPragma(pragma string, key []byte) string {
+	return fmt.Sprintf(`PRAGMA %s = "x'%s'"`, pragma, hex.EncodeToString(key))
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build cgo
+// +build cgo
+
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var sqlcipherDrivers int64
+
+// newSQLCipherDialector returns a dialector that keys each connection it
+// opens. The binary needs to be linked against SQLCipher instead of SQLite
+// for this to work, which is checked when connecting so that a database is
+// never written unencrypted by accident.
+func newSQLCipherDialector(dsn string, key []byte) (gorm.Dialector, error) {
+	// drivers cannot be registered twice, so each key gets its own driver
+	driverName := fmt.Sprintf("sqlite3_sqlcipher_%d", atomic.AddInt64(&sqlcipherDrivers, 1))
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if _, err := conn.Exec(sqlcipherPragma("key", key), nil); err != nil {
+				return fmt.Errorf("sqlcipher: error applying key: %w", err)
+			}
+			version, err := queryString(conn, "PRAGMA cipher_version")
+			if err != nil {
+				return fmt.Errorf("sqlcipher: error checking cipher version: %w", err)
+			}
+			if version == "" {
+				return errors.New("sqlcipher: binary has not been linked against SQLCipher, refusing to continue")
+			}
+			// reading from the database fails in case the key is wrong
+			if _, err := queryString(conn, "SELECT count(*) FROM sqlite_master"); err != nil {
+				return fmt.Errorf("sqlcipher: error reading database, the key is likely wrong: %w", err)
+			}
+			return nil
+		},
+	})
+	return &sqlite.Dialector{DriverName: driverName, DSN: dsn}, nil
+}
+
+// queryString returns the first column of the first row returned by the
+// given query as a string or an empty string in case no rows are returned.
+func queryString(conn *sqlite3.SQLiteConn, query string) (string, error) {
+	rows, err := conn.Query(query, nil)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, len(rows.Columns()))
+	if err := rows.Next(dest); err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", nil
+		}
+		return "", err
+	}
+	if len(dest) == 0 || dest[0] == nil {
+		return "", nil
+	}
+	switch value := dest[0].(type) {
+	case []byte:
+		return string(value), nil
+	default:
+		return fmt.Sprintf("%v", value), nil
+	}
+}
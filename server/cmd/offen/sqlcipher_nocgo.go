@@ -0,0 +1,20 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !cgo
+// +build !cgo
+
+package main
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// newSQLCipherDialector fails as keying connections requires access to the
+// underlying SQLite connection, which is only available when building with
+// cgo enabled.
+func newSQLCipherDialector(dsn string, key []byte) (gorm.Dialector, error) {
+	return nil, errors.New("sqlcipher: binary has been built without cgo, encrypting the database is not supported")
+}
@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "fmt"
+
+// AccessLogFormat identifies how HTTP access logs are rendered.
+type AccessLogFormat string
+
+// Decode validates and assigns v.
+func (a *AccessLogFormat) Decode(v string) error {
+	switch v {
+	case "combined", "json":
+		*a = AccessLogFormat(v)
+	default:
+		return fmt.Errorf("unknown or unsupported access log format %s", v)
+	}
+	return nil
+}
+
+func (a *AccessLogFormat) String() string {
+	return string(*a)
+}
@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestAccessLogFormat(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var a AccessLogFormat
+		if err := a.Decode("json"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if a.String() != "json" {
+			t.Errorf("Unexpected value %v", a.String())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var a AccessLogFormat
+		if err := a.Decode("common"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "fmt"
+
+// AssetsOrigin identifies where static assets are served from.
+type AssetsOrigin string
+
+// Decode validates and assigns v.
+func (a *AssetsOrigin) Decode(v string) error {
+	switch v {
+	case "embedded", "s3", "gcs", "http":
+		*a = AssetsOrigin(v)
+	default:
+		return fmt.Errorf("unknown or unsupported assets origin %s", v)
+	}
+	return nil
+}
+
+func (a *AssetsOrigin) String() string {
+	return string(*a)
+}
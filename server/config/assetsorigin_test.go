@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestAssetsOrigin(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var a AssetsOrigin
+		if err := a.Decode("gcs"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if a.String() != "gcs" {
+			t.Errorf("Unexpected value %v", a.String())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var a AssetsOrigin
+		if err := a.Decode("floppy"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
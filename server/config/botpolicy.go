@@ -0,0 +1,35 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "fmt"
+
+// BotPolicy defines how events sent by known crawlers are handled.
+type BotPolicy string
+
+// The following bot policies are supported.
+const (
+	// BotPolicyAllow handles events of crawlers like any other event.
+	BotPolicyAllow BotPolicy = "allow"
+	// BotPolicyFlag stores events of crawlers but counts them separately,
+	// which allows checking the effect of rejecting them.
+	BotPolicyFlag BotPolicy = "flag"
+	// BotPolicyReject drops events of crawlers without storing them.
+	BotPolicyReject BotPolicy = "reject"
+)
+
+// Decode validates and assigns v.
+func (b *BotPolicy) Decode(v string) error {
+	switch BotPolicy(v) {
+	case BotPolicyAllow, BotPolicyFlag, BotPolicyReject:
+		*b = BotPolicy(v)
+	default:
+		return fmt.Errorf("unknown bot policy %s", v)
+	}
+	return nil
+}
+
+func (b *BotPolicy) String() string {
+	return string(*b)
+}
@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestBotPolicy(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var b BotPolicy
+		if err := b.Decode("flag"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if b.String() != "flag" {
+			t.Errorf("Unexpected value %v", b.String())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var b BotPolicy
+		if err := b.Decode("ignore"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
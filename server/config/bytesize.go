@@ -0,0 +1,48 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a size in bytes.
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"KB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"B", 1},
+}
+
+// Decode parses a size given in bytes, optionally using one of the units
+// KB, MB or GB, e.g. 64KB, and assigns the result.
+func (b *ByteSize) Decode(v string) error {
+	value := strings.ToUpper(strings.TrimSpace(v))
+	factor := int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			factor = unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("config: invalid size %s", v)
+	}
+	*b = ByteSize(n * factor)
+	return nil
+}
+
+// Int64 returns the size in bytes.
+func (b ByteSize) Int64() int64 {
+	return int64(b)
+}
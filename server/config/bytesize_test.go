@@ -0,0 +1,36 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestByteSize(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		tests := map[string]int64{
+			"512":    512,
+			"512B":   512,
+			"64KB":   64 * 1024,
+			"1mb":    1024 * 1024,
+			" 2 GB ": 2 * 1024 * 1024 * 1024,
+			"0":      0,
+		}
+		for value, expected := range tests {
+			var b ByteSize
+			if err := b.Decode(value); err != nil {
+				t.Errorf("Unexpected error %v for %s", err, value)
+			}
+			if b.Int64() != expected {
+				t.Errorf("Expected %d for %s, got %d", expected, value, b.Int64())
+			}
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		for _, value := range []string{"", "KB", "-1KB", "1TB", "lots"} {
+			var b ByteSize
+			if err := b.Decode(value); err == nil {
+				t.Errorf("Unexpected nil error for %s", value)
+			}
+		}
+	})
+}
@@ -16,7 +16,10 @@ import (
 	"github.com/offen/offen/server/keys"
 	"github.com/offen/offen/server/mailer"
 	"github.com/offen/offen/server/mailer/localmailer"
+	"github.com/offen/offen/server/mailer/mailgunmailer"
+	"github.com/offen/offen/server/mailer/sendgridmailer"
 	"github.com/offen/offen/server/mailer/sendmailmailer"
+	"github.com/offen/offen/server/mailer/sesmailer"
 	"github.com/offen/offen/server/mailer/smtpmailer"
 )
 
@@ -40,19 +43,77 @@ func (c *Config) SMTPConfigured() bool {
 	return c.SMTP.Host != ""
 }
 
+// MailerConfigured returns true if transactional email is sent using either
+// SMTP or one of the supported HTTP APIs.
+func (c *Config) MailerConfigured() bool {
+	switch c.Mailer.Provider {
+	case "ses", "mailgun", "sendgrid":
+		return true
+	case "sendmail":
+		return false
+	default:
+		return c.SMTPConfigured()
+	}
+}
+
+// AsyncEventAcknowledgement returns true in case events are acknowledged
+// once they have been enqueued instead of once they have been inserted into
+// the database. Unless configured explicitly, this is the case when events
+// are buffered.
+func (c *Config) AsyncEventAcknowledgement() bool {
+	switch c.Database.EventAcknowledgement {
+	case EventAcknowledgementStrict:
+		return false
+	case EventAcknowledgementAsync:
+		return true
+	default:
+		return c.Database.EventBufferDirectory != ""
+	}
+}
+
 // NewMailer returns a new mailer that is suitable for the given config.
 // In development, mail content will be printed to stdout. In production,
-// SMTP is preferred and falls back to sendmail if no SMTP credentials are given.
+// the configured provider is used. If no provider is given, SMTP is preferred
+// and falls back to sendmail if no SMTP credentials are given.
 func (c *Config) NewMailer() mailer.Mailer {
 	if c.App.Development {
 		return localmailer.New()
 	}
+	switch c.Mailer.Provider {
+	case "ses":
+		return sesmailer.New(c.Mailer.Region, c.Mailer.AccessKeyID, c.Mailer.SecretAccessKey, c.Mailer.Retries)
+	case "mailgun":
+		return mailgunmailer.New(c.Mailer.Domain, c.Mailer.APIKey, c.Mailer.Region, c.Mailer.Retries)
+	case "sendgrid":
+		return sendgridmailer.New(c.Mailer.APIKey, c.Mailer.Retries)
+	case "sendmail":
+		return sendmailmailer.New()
+	}
 	if c.SMTPConfigured() {
 		return smtpmailer.New(c.SMTP.Host, c.SMTP.User, c.SMTP.Password, c.SMTP.Port)
 	}
 	return sendmailmailer.New()
 }
 
+// lookupEnvFile returns the env file that is used for sourcing configuration.
+// Depending on the system, a certain cascade of locations is checked. An
+// empty string is returned in case no file exists.
+func lookupEnvFile(override string) (string, error) {
+	if override != "" {
+		if _, err := os.Stat(override); err != nil {
+			return "", fmt.Errorf("config: error looking up config file override: %w", err)
+		}
+		return override, nil
+	}
+	match, err := walkConfigurationCascade()
+	if err != nil {
+		return "", fmt.Errorf("config: error checking if config file exists: %w", err)
+	}
+	// there might not exist a config file at all in which case all values
+	// are sourced from environment variables
+	return match, nil
+}
+
 func walkConfigurationCascade() (string, error) {
 	wd, err := os.Getwd()
 	if err != nil {
@@ -74,19 +135,26 @@ func walkConfigurationCascade() (string, error) {
 			path.Join("/etc/offen", envFileName),
 		}
 	}
-	for _, file := range cascade {
-		_, err := os.Stat(file)
-		if os.IsNotExist(err) {
-			continue
-		} else if err != nil {
-			return "", fmt.Errorf("config: error checking if config file exists in location %s: %w", file, err)
+	for _, envFile := range cascade {
+		// a YAML file is only used in case there is no env file in the
+		// same location
+		for _, file := range []string{envFile, path.Join(path.Dir(envFile), yamlFileName)} {
+			_, err := os.Stat(file)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return "", fmt.Errorf("config: error checking if config file exists in location %s: %w", file, err)
+			}
+			return file, nil
 		}
-		return file, nil
 	}
 	return "", nil
 }
 
 func persistSettings(update map[string]string, envFile string) error {
+	if isYAMLFile(envFile) {
+		return fmt.Errorf("config: unable to persist settings to YAML file %s, set the values manually", envFile)
+	}
 	if envFile == "" {
 		wd, err := os.Getwd()
 		if err != nil {
@@ -114,33 +182,20 @@ type autopopulatedValue struct {
 // New returns a new runtime configuration
 func New(populateMissing bool, override string) (*Config, error) {
 	var c Config
-	var envFile string
-	// Depending on the system, a certain cascade of configuration options will
-	// be sourced. In case a variable is already set in the environment, it will
-	// not be overridden by any file content.
-	if override != "" {
-		if _, err := os.Stat(override); err != nil {
-			return nil, fmt.Errorf("config: error looking up config file override: %w", err)
-		}
-		envFile = override
-	} else {
-		match, err := walkConfigurationCascade()
-		if err != nil {
-			return nil, fmt.Errorf("config: error checking if config file exists: %w", err)
-		}
-		// there might not exist a config file at all in which case all values
-		// are sourced from environment variables
-		if match != "" {
-			envFile = match
-		}
+	envFile, err := lookupEnvFile(override)
+	if err != nil {
+		return nil, err
 	}
-
 	if envFile != "" {
-		godotenv.Load(envFile)
+		if err := loadEnvFile(envFile); err != nil {
+			return &c, err
+		}
+	}
+	if err := resolveSecretReferences(); err != nil {
+		return &c, err
 	}
 
-	err := envconfig.Process("offen", &c)
-	if err != nil {
+	if err := envconfig.Process("offen", &c); err != nil {
 		return &c, fmt.Errorf("config: error processing configuration: %w", err)
 	}
 
@@ -0,0 +1,42 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/offen/offen/server/scheduler"
+)
+
+// CronSchedule is a cron expression defining when a background job is run.
+// An empty value disables the job.
+type CronSchedule string
+
+// Decode validates and assigns v.
+func (c *CronSchedule) Decode(v string) error {
+	if v != "" {
+		if _, err := scheduler.Parse(v); err != nil {
+			return fmt.Errorf("invalid cron schedule: %w", err)
+		}
+	}
+	*c = CronSchedule(v)
+	return nil
+}
+
+func (c *CronSchedule) String() string {
+	return string(*c)
+}
+
+// Schedule returns the parsed schedule. It returns nil in case the value
+// is empty.
+func (c *CronSchedule) Schedule() scheduler.Schedule {
+	if *c == "" {
+		return nil
+	}
+	s, err := scheduler.Parse(string(*c))
+	if err != nil {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,33 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestCronSchedule(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var c CronSchedule
+		if err := c.Decode("0 3 * * *"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if c.String() != "0 3 * * *" || c.Schedule() == nil {
+			t.Errorf("Unexpected value %v", c.String())
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		var c CronSchedule
+		if err := c.Decode(""); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if c.Schedule() != nil {
+			t.Error("Expected nil schedule")
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var c CronSchedule
+		if err := c.Decode("every now and then"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
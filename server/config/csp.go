@@ -0,0 +1,113 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CSPDirective modifies a single directive of a Content-Security-Policy.
+type CSPDirective struct {
+	Name    string
+	Sources []string
+	// Extend adds Sources to the existing directive instead of replacing it.
+	Extend bool
+}
+
+// CSPDirectives is a list of modifications to a Content-Security-Policy.
+type CSPDirectives []CSPDirective
+
+var knownCSPDirectives = map[string]bool{
+	"base-uri":                  true,
+	"block-all-mixed-content":   true,
+	"child-src":                 true,
+	"connect-src":               true,
+	"default-src":               true,
+	"font-src":                  true,
+	"form-action":               true,
+	"frame-ancestors":           true,
+	"frame-src":                 true,
+	"img-src":                   true,
+	"manifest-src":              true,
+	"media-src":                 true,
+	"object-src":                true,
+	"report-to":                 true,
+	"report-uri":                true,
+	"sandbox":                   true,
+	"script-src":                true,
+	"script-src-attr":           true,
+	"script-src-elem":           true,
+	"style-src":                 true,
+	"style-src-attr":            true,
+	"style-src-elem":            true,
+	"upgrade-insecure-requests": true,
+	"worker-src":                true,
+}
+
+var knownCSPKeywords = map[string]bool{
+	"'self'":             true,
+	"'none'":             true,
+	"'unsafe-inline'":    true,
+	"'unsafe-eval'":      true,
+	"'unsafe-hashes'":    true,
+	"'strict-dynamic'":   true,
+	"'report-sample'":    true,
+	"'wasm-unsafe-eval'": true,
+}
+
+// Decode parses a semicolon separated list of directives and assigns the
+// result. Each directive replaces the directive of the same name, unless
+// its name is prefixed with `+`, in which case its sources are added.
+// Nonces cannot be configured, as they need to be different for each
+// response.
+func (d *CSPDirectives) Decode(v string) error {
+	var result CSPDirectives
+	for _, item := range strings.Split(v, ";") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		directive := CSPDirective{Name: strings.ToLower(fields[0]), Sources: fields[1:]}
+		if strings.HasPrefix(directive.Name, "+") {
+			directive.Name = strings.TrimPrefix(directive.Name, "+")
+			directive.Extend = true
+		}
+		if !knownCSPDirectives[directive.Name] {
+			return fmt.Errorf("config: unknown content security policy directive %s", directive.Name)
+		}
+		for _, source := range directive.Sources {
+			if err := validateCSPSource(source); err != nil {
+				return fmt.Errorf("config: invalid source in directive %s: %w", directive.Name, err)
+			}
+		}
+		result = append(result, directive)
+	}
+	*d = result
+	return nil
+}
+
+func validateCSPSource(source string) error {
+	if strings.ContainsAny(source, ",\"") {
+		return fmt.Errorf("source %s contains an illegal character", source)
+	}
+	if !strings.HasPrefix(source, "'") {
+		if strings.HasSuffix(source, "'") {
+			return fmt.Errorf("source %s is not quoted correctly", source)
+		}
+		return nil
+	}
+	lower := strings.ToLower(source)
+	switch {
+	case knownCSPKeywords[lower]:
+		return nil
+	case strings.HasPrefix(lower, "'nonce-"):
+		return fmt.Errorf("nonce %s cannot be configured, enable nonce generation instead", source)
+	case strings.HasPrefix(lower, "'sha256-"), strings.HasPrefix(lower, "'sha384-"), strings.HasPrefix(lower, "'sha512-"):
+		if len(source) > len("'sha256-'") && strings.HasSuffix(source, "'") {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown keyword %s", source)
+}
@@ -0,0 +1,40 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCSPDirectives(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var d CSPDirectives
+		if err := d.Decode("img-src 'self' data: https://cdn.offen.dev; +script-src 'sha256-abc='; upgrade-insecure-requests;"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		expected := CSPDirectives{
+			{Name: "img-src", Sources: []string{"'self'", "data:", "https://cdn.offen.dev"}},
+			{Name: "script-src", Sources: []string{"'sha256-abc='"}, Extend: true},
+			{Name: "upgrade-insecure-requests", Sources: []string{}},
+		}
+		if !reflect.DeepEqual(d, expected) {
+			t.Errorf("Unexpected value %v", d)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		for _, value := range []string{
+			"image-src 'self'",
+			"script-src 'nonce-abc'",
+			"script-src 'unsafe'",
+			"script-src self'",
+			"img-src a.offen.dev,b.offen.dev",
+		} {
+			var d CSPDirectives
+			if err := d.Decode(value); err == nil {
+				t.Errorf("Unexpected nil error for %s", value)
+			}
+		}
+	})
+}
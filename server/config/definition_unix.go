@@ -6,39 +6,206 @@
 
 package config
 
+import "time"
+
 // Config contains all runtime configuration needed for running offen as
 // and also defines the desired defaults. Package envconfig is used to
 // source values from the application environment at runtime.
 type Config struct {
 	Server struct {
-		Port             int  `default:"3000"`
-		ReverseProxy     bool `default:"false"`
+		Port             int `default:"3000"`
+		Socket           EnvString
+		SocketMode       FileMode `default:"0660"`
+		ReverseProxy     bool     `default:"false"`
 		SSLCertificate   EnvString
 		SSLKey           EnvString
 		AutoTLS          []string
 		LetsEncryptEmail string
 		CertificateCache EnvString `default:"/var/www/.cache"`
+		TrustedProxies   Networks
+		LogClientIP      bool          `default:"false"`
+		StrictWarmup     bool          `default:"true"`
+		DeepHealthCheck  bool          `default:"false"`
+		ShutdownTimeout  time.Duration `default:"30s"`
+		HTTP2            bool          `default:"true"`
+		H2C              bool          `default:"false"`
+		GRPCPort         int
+		AccessLogFormat  AccessLogFormat `default:"combined"`
+		AccessLogSink    EnvString       `default:"stdout"`
+		AccessLogRedact  []string        `default:"referer,user_agent"`
+		MaxBodySize      ByteSize        `default:"64KB"`
+		MaxBatchBodySize ByteSize        `default:"1MB"`
+		MaxImportSize    ByteSize        `default:"512MB"`
+		PathPrefixes     []string
+	}
+	CSP struct {
+		Default    CSPDirectives
+		Vault      CSPDirectives
+		Index      CSPDirectives
+		Auditorium CSPDirectives
+		Nonce      bool `default:"false"`
 	}
 	Database struct {
-		Dialect           Dialect   `default:"sqlite3"`
-		ConnectionString  EnvString `default:"/var/opt/offen/offen.db"`
-		ConnectionRetries int       `default:"0"`
+		Dialect                    Dialect       `default:"sqlite3"`
+		ConnectionString           EnvString     `default:"/var/opt/offen/offen.db"`
+		ConnectionRetries          int           `default:"10"`
+		ConnectionRetryMaxInterval time.Duration `default:"10s"`
+		EventStore                 EventStore    `default:"database"`
+		ClickHouseURL              EnvString
+		MaxOpenConns               int
+		MaxIdleConns               int `default:"2"`
+		ConnMaxLifetime            time.Duration
+		ConnMaxIdleTime            time.Duration
+		ReadReplicas               []EnvString
+		EventBufferDirectory       EnvString
+		EventBufferSize            int           `default:"500"`
+		EventBufferInterval        time.Duration `default:"1s"`
+		EventAcknowledgement       EventAcknowledgement
+		SlowQueryThreshold         time.Duration `default:"1s"`
+		CircuitBreakerThreshold    int           `default:"5"`
+		CircuitBreakerCooldown     time.Duration `default:"10s"`
+		SQLCipher                  bool          `default:"false"`
+		SQLCipherKeyFile           EnvString
 	}
 	App struct {
-		Development  bool     `default:"false"`
-		LogLevel     LogLevel `default:"info"`
-		SingleNode   bool     `default:"true"`
-		Locale       Locale   `default:"en"`
-		RootAccount  string
-		DemoAccount  string `ignored:"true"`
-		DeployTarget DeployTarget
-		Retention    Retention `default:"6months"`
-	}
-	Secret Bytes
-	OIDC   struct {
+		Development           bool     `default:"false"`
+		LogLevel              LogLevel `default:"info"`
+		SingleNode            bool     `default:"true"`
+		Locale                Locale   `default:"en"`
+		RootAccount           string
+		DemoAccount           string `ignored:"true"`
+		DeployTarget          DeployTarget
+		Retention             Retention     `default:"6months"`
+		AuditRetention        time.Duration `default:"4464h"`
+		RetirementGracePeriod time.Duration `default:"720h"`
+		InvitationExpiry      time.Duration `default:"168h"`
+		StylesStore           StylesStore   `default:"database"`
+		ShareLinkMaxLifetime  time.Duration `default:"24h"`
+		SessionStore          SessionStore  `default:"database"`
+		QuotaEventsPerMonth   int64
+		QuotaStoredEvents     int64
+		AdminToken            EnvString
+		AnomalyThreshold      float64       `default:"3"`
+		BotPolicy             BotPolicy     `default:"reject"`
+		EnforceDomains        bool          `default:"false"`
+		IdempotencyWindow     time.Duration `default:"24h"`
+		ReplayWindow          time.Duration `default:"168h"`
+		ConsentPolicyVersion  string        `default:"1"`
+		ConsentLifetime       time.Duration `default:"876000h"`
+		UserCookieLifetime    time.Duration
+		PrivacySignals        PrivacySignalPolicy `default:"ignore"`
+		Features              map[string]bool
+	}
+	Secret          Bytes
+	PreviousSecrets []Bytes
+	OIDC            struct {
 		Issuer       string
 		ClientID     string
 		ClientSecret string
+		Providers    map[string]string
+		GroupsClaim  string `default:"groups"`
+		GroupMapping GroupMapping
+		Sponsor      string
+	}
+	SAML struct {
+		IDPMetadataURL  string
+		RootURL         string
+		Certificate     EnvString
+		Key             EnvString
+		EmailAttribute  string `default:"email"`
+		GroupsAttribute string `default:"groups"`
+	}
+	WebAuthn struct {
+		RPID          string
+		RPOrigins     []string
+		RPDisplayName string `default:"Offen Fair Web Analytics"`
+	}
+	Passwords struct {
+		MinLength    int `default:"8"`
+		MinScore     int
+		BreachFilter EnvString
+	}
+	Honeypot struct {
+		Enabled bool `default:"false"`
+		Paths   []string
+		Delay   time.Duration `default:"20s"`
+	}
+	Lockout struct {
+		Threshold   int           `default:"5"`
+		Duration    time.Duration `default:"1m"`
+		MaxDuration time.Duration `default:"24h"`
+	}
+	S3 struct {
+		Endpoint        string
+		Bucket          string
+		Prefix          string
+		Region          string `default:"us-east-1"`
+		AccessKeyID     string
+		SecretAccessKey string
+		PublicURL       string
+	}
+	Assets struct {
+		Origin         AssetsOrigin `default:"embedded"`
+		URL            string
+		Bucket         string
+		Prefix         string
+		CacheDirectory EnvString
+		CacheTTL       time.Duration `default:"5m"`
+	}
+	Backup struct {
+		Interval   time.Duration
+		Passphrase string
+		Bucket     string
+		Prefix     string `default:"backups/"`
+		Retention  int    `default:"7"`
+		Replicas   Replicas
+	}
+	Jobs struct {
+		Maintenance CronSchedule `default:"@hourly"`
+		Mails       CronSchedule `default:"@every 30s"`
+		Webhooks    CronSchedule `default:"@every 30s"`
+		Backup      CronSchedule
+		Jitter      time.Duration
+	}
+	Locks struct {
+		Backend LockBackend   `default:"database"`
+		TTL     time.Duration `default:"30s"`
+	}
+	DNSChallenge struct {
+		Provider               DNSProvider
+		PropagationDelay       time.Duration `default:"30s"`
+		CloudflareToken        string
+		Route53HostedZoneID    string
+		Route53AccessKeyID     string
+		Route53SecretAccessKey string
+		RFC2136Nameserver      string
+		RFC2136Zone            string
+		RFC2136KeyName         string
+		RFC2136Algorithm       string `default:"hmac-sha256"`
+		RFC2136Secret          string
+	}
+	Cache struct {
+		RedisURL          string
+		RateLimitFailOpen bool `default:"true"`
+	}
+	RateLimit struct {
+		Login          RateLimit `default:"10/1m"`
+		ForgotPassword RateLimit `default:"5/15m"`
+		Events         RateLimit `default:"120/1m"`
+		Exchange       RateLimit `default:"5/1h"`
+	}
+	Metrics struct {
+		Enabled bool `default:"false"`
+		Token   string
+	}
+	Aggregates struct {
+		Enabled   bool          `default:"false"`
+		Epsilon   float64       `default:"1"`
+		Retention time.Duration `default:"8760h"`
+	}
+	Pings struct {
+		Enabled   bool          `default:"false"`
+		Retention time.Duration `default:"8760h"`
 	}
 	SMTP struct {
 		User     string
@@ -47,4 +214,34 @@ type Config struct {
 		Port     int    `default:"587"`
 		Sender   string `default:"no-reply@offen.dev"`
 	}
+	Mailer struct {
+		Provider           MailerProvider
+		Retries            int           `default:"3"`
+		MaxAttempts        int           `default:"8"`
+		Retention          time.Duration `default:"168h"`
+		APIKey             string
+		Domain             string
+		Region             string
+		AccessKeyID        string
+		SecretAccessKey    string
+		TemplatesDirectory EnvString
+	}
+	Webhooks struct {
+		MaxAttempts int           `default:"8"`
+		Timeout     time.Duration `default:"10s"`
+	}
+	EventSink struct {
+		URL       string
+		Topic     string `default:"offen.events"`
+		QueueSize int    `default:"1024"`
+	}
+	LogIngest struct {
+		Path      EnvString
+		Format    LogFormat `default:"combined"`
+		AccountID string
+		Root      string
+	}
+	SecretSources struct {
+		RefreshInterval time.Duration
+	}
 }
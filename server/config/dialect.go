@@ -11,7 +11,7 @@ type Dialect string
 // Decode validates and assigns v.
 func (d *Dialect) Decode(v string) error {
 	switch v {
-	case "postgres", "sqlite3", "mysql":
+	case "postgres", "sqlite3", "mysql", "mariadb", "cockroachdb":
 		*d = Dialect(v)
 	default:
 		return fmt.Errorf("unknown or unsupported SQL dialect %s", v)
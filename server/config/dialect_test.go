@@ -7,12 +7,14 @@ import "testing"
 
 func TestDialect(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
-		var d Dialect
-		if err := d.Decode("sqlite3"); err != nil {
-			t.Errorf("Unexpected error %v", err)
-		}
-		if d.String() != "sqlite3" {
-			t.Errorf("Unexpected value %v", d.String())
+		for _, value := range []string{"sqlite3", "postgres", "mysql", "mariadb", "cockroachdb"} {
+			var d Dialect
+			if err := d.Decode(value); err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			if d.String() != value {
+				t.Errorf("Unexpected value %v", d.String())
+			}
 		}
 	})
 	t.Run("error", func(t *testing.T) {
@@ -0,0 +1,25 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "fmt"
+
+// DNSProvider identifies the DNS provider used for solving DNS-01 challenges
+// when requesting certificates.
+type DNSProvider string
+
+// Decode validates and assigns v.
+func (d *DNSProvider) Decode(v string) error {
+	switch v {
+	case "", "route53", "cloudflare", "rfc2136":
+		*d = DNSProvider(v)
+	default:
+		return fmt.Errorf("unknown or unsupported dns provider %s", v)
+	}
+	return nil
+}
+
+func (d *DNSProvider) String() string {
+	return string(*d)
+}
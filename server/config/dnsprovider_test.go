@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestDNSProvider(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var d DNSProvider
+		if err := d.Decode("cloudflare"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if d.String() != "cloudflare" {
+			t.Errorf("Unexpected value %v", d.String())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var d DNSProvider
+		if err := d.Decode("carrier-pigeon"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
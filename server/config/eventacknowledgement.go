@@ -0,0 +1,31 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "fmt"
+
+// EventAcknowledgement defines when storing an event is acknowledged to
+// the client sending it.
+type EventAcknowledgement string
+
+// Supported acknowledgement modes.
+const (
+	EventAcknowledgementStrict EventAcknowledgement = "strict"
+	EventAcknowledgementAsync  EventAcknowledgement = "async"
+)
+
+// Decode validates and assigns v.
+func (a *EventAcknowledgement) Decode(v string) error {
+	switch EventAcknowledgement(v) {
+	case "", EventAcknowledgementStrict, EventAcknowledgementAsync:
+		*a = EventAcknowledgement(v)
+	default:
+		return fmt.Errorf("unknown event acknowledgement mode %s", v)
+	}
+	return nil
+}
+
+func (a *EventAcknowledgement) String() string {
+	return string(*a)
+}
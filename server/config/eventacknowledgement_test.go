@@ -0,0 +1,48 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestEventAcknowledgement(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var a EventAcknowledgement
+		if err := a.Decode("async"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if a != EventAcknowledgementAsync {
+			t.Errorf("Unexpected value %v", a.String())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var a EventAcknowledgement
+		if err := a.Decode("eventually"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
+
+func TestConfig_AsyncEventAcknowledgement(t *testing.T) {
+	tests := []struct {
+		name            string
+		acknowledgement EventAcknowledgement
+		bufferDirectory EnvString
+		expected        bool
+	}{
+		{"default", "", "", false},
+		{"default with buffer", "", "/tmp/buffer", true},
+		{"strict with buffer", EventAcknowledgementStrict, "/tmp/buffer", false},
+		{"async", EventAcknowledgementAsync, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Config{}
+			c.Database.EventAcknowledgement = test.acknowledgement
+			c.Database.EventBufferDirectory = test.bufferDirectory
+			if result := c.AsyncEventAcknowledgement(); result != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "fmt"
+
+// EventStore identifies where events are stored.
+type EventStore string
+
+// Decode validates and assigns v.
+func (s *EventStore) Decode(v string) error {
+	switch v {
+	case "database", "clickhouse":
+		*s = EventStore(v)
+	default:
+		return fmt.Errorf("unknown or unsupported event store %s", v)
+	}
+	return nil
+}
+
+func (s *EventStore) String() string {
+	return string(*s)
+}
@@ -0,0 +1,31 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// FileMode is a set of permission bits given in octal notation, e.g. 0660.
+type FileMode os.FileMode
+
+// Decode parses the octal value v and assigns it.
+func (f *FileMode) Decode(v string) error {
+	value, err := strconv.ParseUint(v, 8, 32)
+	if err != nil {
+		return fmt.Errorf("error parsing file mode %s: %w", v, err)
+	}
+	if value > uint64(os.ModePerm) {
+		return fmt.Errorf("file mode %s contains more than permission bits", v)
+	}
+	*f = FileMode(value)
+	return nil
+}
+
+// FileMode returns f as an os.FileMode.
+func (f *FileMode) FileMode() os.FileMode {
+	return os.FileMode(*f)
+}
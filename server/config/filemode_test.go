@@ -0,0 +1,30 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestFileMode(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var f FileMode
+		if err := f.Decode("0660"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if f.FileMode() != 0660 {
+			t.Errorf("Unexpected value %v", f.FileMode())
+		}
+	})
+	t.Run("not octal", func(t *testing.T) {
+		var f FileMode
+		if err := f.Decode("0999"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+	t.Run("too large", func(t *testing.T) {
+		var f FileMode
+		if err := f.Decode("7777"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
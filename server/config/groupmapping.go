@@ -0,0 +1,66 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GroupGrant gives members of an identity provider group access to an
+// account, optionally granting admin privileges.
+type GroupGrant struct {
+	Group     string
+	AccountID string
+	Admin     bool
+}
+
+// GroupMapping is a list of group grants.
+type GroupMapping []GroupGrant
+
+// Decode parses a comma separated list of group=accountID[:role] items and
+// assigns the result. Supported roles are `admin` and `member`, which is
+// also used when no role is given.
+func (g *GroupMapping) Decode(v string) error {
+	var result GroupMapping
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		group, target, ok := strings.Cut(item, "=")
+		if !ok || group == "" {
+			return fmt.Errorf("config: invalid group mapping %s, expected group=accountID[:role]", item)
+		}
+		accountID, role, _ := strings.Cut(target, ":")
+		if accountID == "" {
+			return fmt.Errorf("config: missing account id in group mapping %s", item)
+		}
+		grant := GroupGrant{Group: group, AccountID: accountID}
+		switch role {
+		case "", "member":
+		case "admin":
+			grant.Admin = true
+		default:
+			return fmt.Errorf("config: unknown role %s in group mapping %s", role, item)
+		}
+		result = append(result, grant)
+	}
+	*g = result
+	return nil
+}
+
+// Grants returns all grants that apply to a member of the given groups.
+func (g GroupMapping) Grants(groups []string) []GroupGrant {
+	var result []GroupGrant
+	for _, grant := range g {
+		for _, group := range groups {
+			if grant.Group == group {
+				result = append(result, grant)
+				break
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,38 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupMapping(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var g GroupMapping
+		if err := g.Decode("analytics-admins=account-a:admin, analytics-admins=account-b, analytics=account-a:member"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		expected := GroupMapping{
+			{Group: "analytics-admins", AccountID: "account-a", Admin: true},
+			{Group: "analytics-admins", AccountID: "account-b"},
+			{Group: "analytics", AccountID: "account-a"},
+		}
+		if !reflect.DeepEqual(g, expected) {
+			t.Errorf("Unexpected value %v", g)
+		}
+		grants := g.Grants([]string{"analytics", "staff"})
+		if !reflect.DeepEqual(grants, []GroupGrant{{Group: "analytics", AccountID: "account-a"}}) {
+			t.Errorf("Unexpected grants %v", grants)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		for _, value := range []string{"analytics", "=account-a", "analytics=", "analytics=account-a:owner"} {
+			var g GroupMapping
+			if err := g.Decode(value); err == nil {
+				t.Errorf("Unexpected nil error for %s", value)
+			}
+		}
+	})
+}
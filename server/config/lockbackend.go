@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "fmt"
+
+// LockBackend identifies where locks shared between instances are stored.
+type LockBackend string
+
+// Decode validates and assigns v.
+func (l *LockBackend) Decode(v string) error {
+	switch v {
+	case "database", "redis":
+		*l = LockBackend(v)
+	default:
+		return fmt.Errorf("unknown or unsupported lock backend %s", v)
+	}
+	return nil
+}
+
+func (l *LockBackend) String() string {
+	return string(*l)
+}
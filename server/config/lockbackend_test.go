@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestLockBackend(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var l LockBackend
+		if err := l.Decode("redis"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if l.String() != "redis" {
+			t.Errorf("Unexpected value %v", l.String())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var l LockBackend
+		if err := l.Decode("zookeeper"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
@@ -0,0 +1,31 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "fmt"
+
+// LogFormat is the format of an access log that is ingested.
+type LogFormat string
+
+// Supported access log formats.
+const (
+	LogFormatCombined LogFormat = "combined"
+	LogFormatCommon   LogFormat = "common"
+	LogFormatCaddy    LogFormat = "caddy"
+)
+
+// Decode validates and assigns v.
+func (f *LogFormat) Decode(v string) error {
+	switch LogFormat(v) {
+	case LogFormatCombined, LogFormatCommon, LogFormatCaddy:
+		*f = LogFormat(v)
+	default:
+		return fmt.Errorf("unknown log format %s", v)
+	}
+	return nil
+}
+
+func (f *LogFormat) String() string {
+	return string(*f)
+}
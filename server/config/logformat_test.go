@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestLogFormat(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var f LogFormat
+		if err := f.Decode("caddy"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if f != LogFormatCaddy {
+			t.Errorf("Unexpected value %v", f.String())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var f LogFormat
+		if err := f.Decode("w3c"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
@@ -0,0 +1,26 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "fmt"
+
+// MailerProvider identifies the transport used for sending transactional
+// email. An empty value selects SMTP or sendmail depending on whether SMTP
+// has been configured.
+type MailerProvider string
+
+// Decode validates and assigns v.
+func (m *MailerProvider) Decode(v string) error {
+	switch v {
+	case "", "smtp", "sendmail", "ses", "mailgun", "sendgrid":
+		*m = MailerProvider(v)
+	default:
+		return fmt.Errorf("unknown or unsupported mailer provider %s", v)
+	}
+	return nil
+}
+
+func (m *MailerProvider) String() string {
+	return string(*m)
+}
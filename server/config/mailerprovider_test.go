@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestMailerProvider(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var m MailerProvider
+		if err := m.Decode("sendgrid"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if m.String() != "sendgrid" {
+			t.Errorf("Unexpected value %v", m.String())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var m MailerProvider
+		if err := m.Decode("carrier-pigeon"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
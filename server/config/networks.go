@@ -0,0 +1,54 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Networks is a list of IP networks.
+type Networks []*net.IPNet
+
+// Decode parses a comma separated list of CIDR notations or single IP
+// addresses and assigns the result.
+func (n *Networks) Decode(v string) error {
+	var result Networks
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return fmt.Errorf("config: invalid ip address %s", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return fmt.Errorf("config: invalid network %s: %w", item, err)
+		}
+		result = append(result, network)
+	}
+	*n = result
+	return nil
+}
+
+// Contains checks whether the given ip is part of any of the networks.
+func (n Networks) Contains(ip net.IP) bool {
+	for _, network := range n {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
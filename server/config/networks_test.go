@@ -0,0 +1,37 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNetworks(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var n Networks
+		if err := n.Decode("10.0.0.0/8, 192.168.1.1,fd00::/8"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(n) != 3 {
+			t.Errorf("Unexpected length %d", len(n))
+		}
+		for _, ip := range []string{"10.1.2.3", "192.168.1.1", "fd00::1"} {
+			if !n.Contains(net.ParseIP(ip)) {
+				t.Errorf("Expected %s to be contained", ip)
+			}
+		}
+		for _, ip := range []string{"11.1.2.3", "192.168.1.2", "2001:db8::1"} {
+			if n.Contains(net.ParseIP(ip)) {
+				t.Errorf("Expected %s not to be contained", ip)
+			}
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var n Networks
+		if err := n.Decode("10.0.0.0/8,localhost"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
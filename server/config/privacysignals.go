@@ -0,0 +1,36 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "fmt"
+
+// PrivacySignalPolicy defines how events are handled when the client sends a
+// Do-Not-Track or Global Privacy Control signal.
+type PrivacySignalPolicy string
+
+// The following privacy signal policies are supported.
+const (
+	// PrivacySignalIgnore handles events like any other event.
+	PrivacySignalIgnore PrivacySignalPolicy = "ignore"
+	// PrivacySignalAnonymous stores events without linking them to the
+	// user that sent them.
+	PrivacySignalAnonymous PrivacySignalPolicy = "anonymous"
+	// PrivacySignalDrop drops events without storing them.
+	PrivacySignalDrop PrivacySignalPolicy = "drop"
+)
+
+// Decode validates and assigns v.
+func (p *PrivacySignalPolicy) Decode(v string) error {
+	switch PrivacySignalPolicy(v) {
+	case PrivacySignalIgnore, PrivacySignalAnonymous, PrivacySignalDrop:
+		*p = PrivacySignalPolicy(v)
+	default:
+		return fmt.Errorf("unknown privacy signal policy %s", v)
+	}
+	return nil
+}
+
+func (p *PrivacySignalPolicy) String() string {
+	return string(*p)
+}
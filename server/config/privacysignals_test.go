@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestPrivacySignalPolicy(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var p PrivacySignalPolicy
+		if err := p.Decode("anonymous"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if p.String() != "anonymous" {
+			t.Errorf("Unexpected value %v", p.String())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var p PrivacySignalPolicy
+		if err := p.Decode("honor"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
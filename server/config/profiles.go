@@ -0,0 +1,102 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// includeKey lists further env files that are read before the file
+	// containing it, so its own values take precedence.
+	includeKey = "OFFEN_INCLUDE"
+	// profileKey selects an env file containing per-environment overrides
+	// that is read after the env file in use.
+	profileKey = "OFFEN_PROFILE"
+)
+
+// profileEnvFile returns the location of the env file for the given profile,
+// e.g. offen.production.env for offen.env.
+func profileEnvFile(envFile, profile string) string {
+	ext := filepath.Ext(envFile)
+	return strings.TrimSuffix(envFile, ext) + "." + profile + ext
+}
+
+// readEnvFileLayers reads the given env file, the files it includes and the
+// env file of the selected profile. Values are merged in the following order,
+// later values overriding earlier ones:
+//
+// 1. files included by the env file
+// 2. the env file
+// 3. files included by the profile's env file
+// 4. the profile's env file
+//
+// The profile is read from the environment, falling back to the value given
+// in the env file. The locations of all files that have been read are
+// returned as well.
+func readEnvFileLayers(envFile string) (map[string]string, []string, error) {
+	values := map[string]string{}
+	var files []string
+	if err := readEnvFileWithIncludes(envFile, values, &files, map[string]bool{}); err != nil {
+		return nil, nil, err
+	}
+
+	profile, ok := os.LookupEnv(profileKey)
+	if !ok || fileValues[profileKey] == profile {
+		profile = values[profileKey]
+	}
+	if profile == "" {
+		return values, files, nil
+	}
+	if strings.ContainsAny(profile, `/\`) {
+		return nil, nil, fmt.Errorf("config: invalid profile %q", profile)
+	}
+	profileFile := profileEnvFile(envFile, profile)
+	if _, err := os.Stat(profileFile); err != nil {
+		return nil, nil, fmt.Errorf("config: error looking up env file for profile %s: %w", profile, err)
+	}
+	if err := readEnvFileWithIncludes(profileFile, values, &files, map[string]bool{}); err != nil {
+		return nil, nil, err
+	}
+	return values, files, nil
+}
+
+func readEnvFileWithIncludes(envFile string, into map[string]string, files *[]string, visited map[string]bool) error {
+	location, err := filepath.Abs(envFile)
+	if err != nil {
+		return fmt.Errorf("config: error resolving location of env file %s: %w", envFile, err)
+	}
+	if visited[location] {
+		return fmt.Errorf("config: env file %s includes itself", envFile)
+	}
+	visited[location] = true
+	defer delete(visited, location)
+
+	values, err := readConfigFile(envFile)
+	if err != nil {
+		return fmt.Errorf("config: error reading config file %s: %w", envFile, err)
+	}
+	for _, include := range strings.Split(values[includeKey], ",") {
+		include = strings.TrimSpace(include)
+		if include == "" {
+			continue
+		}
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(envFile), include)
+		}
+		if err := readEnvFileWithIncludes(include, into, files, visited); err != nil {
+			return err
+		}
+	}
+	delete(values, includeKey)
+
+	for key, value := range values {
+		into[key] = value
+	}
+	*files = append(*files, envFile)
+	return nil
+}
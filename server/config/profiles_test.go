@@ -0,0 +1,90 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeEnvFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	return dir
+}
+
+func TestReadEnvFileLayers(t *testing.T) {
+	t.Run("includes and profile", func(t *testing.T) {
+		dir := writeEnvFiles(t, map[string]string{
+			"offen.env":            "OFFEN_INCLUDE=shared.env\nOFFEN_SERVER_PORT=4000\nOFFEN_PROFILE=production\n",
+			"shared.env":           "OFFEN_SERVER_PORT=3000\nOFFEN_SMTP_HOST=smtp.offen.dev\nOFFEN_SMTP_USER=shared\n",
+			"offen.production.env": "OFFEN_INCLUDE=production-smtp.env\nOFFEN_SERVER_PORT=80\n",
+			"production-smtp.env":  "OFFEN_SMTP_USER=production\n",
+		})
+		values, files, err := readEnvFileLayers(filepath.Join(dir, "offen.env"))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		expected := map[string]string{
+			"OFFEN_SERVER_PORT": "80",
+			"OFFEN_SMTP_HOST":   "smtp.offen.dev",
+			"OFFEN_SMTP_USER":   "production",
+			"OFFEN_PROFILE":     "production",
+		}
+		if !reflect.DeepEqual(expected, values) {
+			t.Errorf("Expected %v, got %v", expected, values)
+		}
+		if len(files) != 4 {
+			t.Errorf("Expected four files to be read, got %v", files)
+		}
+	})
+	t.Run("profile from environment", func(t *testing.T) {
+		dir := writeEnvFiles(t, map[string]string{
+			"offen.env":         "OFFEN_SERVER_PORT=4000\n",
+			"offen.staging.env": "OFFEN_SERVER_PORT=5000\n",
+		})
+		t.Setenv("OFFEN_PROFILE", "staging")
+		values, _, err := readEnvFileLayers(filepath.Join(dir, "offen.env"))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if values["OFFEN_SERVER_PORT"] != "5000" {
+			t.Errorf("Unexpected values %v", values)
+		}
+	})
+	t.Run("missing profile", func(t *testing.T) {
+		dir := writeEnvFiles(t, map[string]string{
+			"offen.env": "OFFEN_PROFILE=production\n",
+		})
+		if _, _, err := readEnvFileLayers(filepath.Join(dir, "offen.env")); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("include cycle", func(t *testing.T) {
+		dir := writeEnvFiles(t, map[string]string{
+			"offen.env": "OFFEN_INCLUDE=a.env\n",
+			"a.env":     "OFFEN_INCLUDE=offen.env\n",
+		})
+		if _, _, err := readEnvFileLayers(filepath.Join(dir, "offen.env")); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("shared include", func(t *testing.T) {
+		dir := writeEnvFiles(t, map[string]string{
+			"offen.env":  "OFFEN_INCLUDE=a.env,b.env\n",
+			"a.env":      "OFFEN_INCLUDE=common.env\n",
+			"b.env":      "OFFEN_INCLUDE=common.env\n",
+			"common.env": "OFFEN_SERVER_PORT=4000\n",
+		})
+		if _, _, err := readEnvFileLayers(filepath.Join(dir, "offen.env")); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit allows the given number of requests within a sliding window.
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Decode parses a value of the form requests/window, e.g. 10/1m, and assigns
+// the result.
+func (r *RateLimit) Decode(v string) error {
+	requests, window, ok := strings.Cut(v, "/")
+	if !ok {
+		return fmt.Errorf("config: invalid rate limit %s, expected requests/window", v)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || n < 1 {
+		return fmt.Errorf("config: invalid number of requests in rate limit %s", v)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil || d <= 0 {
+		return fmt.Errorf("config: invalid window in rate limit %s", v)
+	}
+	*r = RateLimit{Requests: n, Window: d}
+	return nil
+}
+
+func (r *RateLimit) String() string {
+	return fmt.Sprintf("%d/%s", r.Requests, r.Window)
+}
@@ -0,0 +1,32 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var r RateLimit
+		if err := r.Decode("10/1m"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if r.Requests != 10 || r.Window != time.Minute {
+			t.Errorf("Unexpected value %v", r)
+		}
+		if r.String() != "10/1m0s" {
+			t.Errorf("Unexpected string value %s", r.String())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		for _, value := range []string{"10", "0/1m", "ten/1m", "10/minute", "10/-1m"} {
+			var r RateLimit
+			if err := r.Decode(value); err == nil {
+				t.Errorf("Unexpected nil error for %s", value)
+			}
+		}
+	})
+}
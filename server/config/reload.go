@@ -0,0 +1,169 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+var (
+	fileValuesMu sync.Mutex
+	// fileValues contains all values that have been set in the environment
+	// by reading an env file, as opposed to having been set by the caller.
+	fileValues = map[string]string{}
+)
+
+// loadEnvFile sets the values of the given env file, its includes and the
+// selected profile in the environment. In case a variable is already set in
+// the environment, it will not be overridden by any file content, unless it
+// has been read from an env file before.
+func loadEnvFile(envFile string) error {
+	fileValuesMu.Lock()
+	defer fileValuesMu.Unlock()
+
+	values, _, err := readEnvFileLayers(envFile)
+	if err != nil {
+		return err
+	}
+	for key, previous := range fileValues {
+		// values that have been changed by the caller in the meantime are
+		// not considered to be sourced from the file anymore
+		if current, ok := os.LookupEnv(key); !ok || current != previous {
+			delete(fileValues, key)
+			continue
+		}
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+			delete(fileValues, key)
+		}
+	}
+	for key, value := range values {
+		if _, fromFile := fileValues[key]; !fromFile {
+			if _, ok := os.LookupEnv(key); ok {
+				continue
+			}
+		}
+		os.Setenv(key, value)
+		fileValues[key] = value
+	}
+	return nil
+}
+
+// Reload sources the runtime configuration again, picking up changes to
+// the env file that is in use. In contrast to New, it does not populate or
+// generate any values, so it is expected to be used for updating a
+// configuration that has been created by New only.
+func Reload(override string) (*Config, error) {
+	var c Config
+	envFile, err := lookupEnvFile(override)
+	if err != nil {
+		return nil, err
+	}
+	if envFile != "" {
+		if err := loadEnvFile(envFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := resolveSecretReferences(); err != nil {
+		return nil, err
+	}
+	if err := envconfig.Process("offen", &c); err != nil {
+		return nil, fmt.Errorf("config: error processing configuration: %w", err)
+	}
+	return &c, nil
+}
+
+// Live holds the current runtime configuration and allows updating the
+// values that can be changed without restarting the process.
+type Live struct {
+	current atomic.Pointer[Config]
+}
+
+// NewLive wraps the given configuration.
+func NewLive(c *Config) *Live {
+	l := &Live{}
+	l.current.Store(c)
+	return l
+}
+
+// Load returns the current configuration. Callers must not modify the
+// returned value.
+func (l *Live) Load() *Config {
+	return l.current.Load()
+}
+
+// Update replaces the reloadable values of the current configuration with
+// the ones in next and returns the result. These are the log level, the
+// retention period, feature flags, rate limits and all mailer settings except
+// for the templates directory. All other values are kept as is. This
+// includes the demo account, which is never sourced from the environment but
+// set by the demo command, so reloading it would only ever reset it.
+func (l *Live) Update(next *Config) *Config {
+	current := l.current.Load()
+	updated := *current
+	updated.App.LogLevel = next.App.LogLevel
+	updated.App.Retention = next.App.Retention
+	updated.App.Features = next.App.Features
+	updated.RateLimit = next.RateLimit
+	updated.SMTP = next.SMTP
+	updated.Mailer = next.Mailer
+	// templates are read from the directory configured on startup
+	updated.Mailer.TemplatesDirectory = current.Mailer.TemplatesDirectory
+	l.current.Store(&updated)
+	return &updated
+}
+
+// WatchEnvFile calls onChange each time the modification time of the env
+// file in use, one of its includes or the env file of the selected profile
+// changes. The file is checked in the given interval until ctx
+// is cancelled.
+func WatchEnvFile(ctx context.Context, override string, interval time.Duration, onChange func()) error {
+	envFile, err := lookupEnvFile(override)
+	if err != nil {
+		return err
+	}
+	if envFile == "" {
+		return nil
+	}
+	modTime := func() string {
+		fileValuesMu.Lock()
+		_, files, err := readEnvFileLayers(envFile)
+		fileValuesMu.Unlock()
+		if err != nil {
+			files = []string{envFile}
+		}
+		var result []string
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			result = append(result, fmt.Sprintf("%s@%d", file, info.ModTime().UnixNano()))
+		}
+		return strings.Join(result, ",")
+	}
+
+	last := modTime()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if next := modTime(); next != last {
+				last = next
+				onChange()
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "offen.env")
+	if err := os.WriteFile(envFile, []byte("OFFEN_APP_LOGLEVEL=warn\nOFFEN_SMTP_HOST=smtp.offen.dev\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	t.Setenv("OFFEN_SMTP_USER", "develop")
+	// other tests restore an unset deploy target as an empty value
+	t.Setenv("OFFEN_APP_DEPLOYTARGET", "")
+	os.Unsetenv("OFFEN_APP_DEPLOYTARGET")
+	defer os.Unsetenv("OFFEN_APP_LOGLEVEL")
+	defer os.Unsetenv("OFFEN_SMTP_HOST")
+
+	c, err := New(false, envFile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.App.LogLevel.LogLevel().String() != "warning" || c.SMTP.Host != "smtp.offen.dev" {
+		t.Errorf("Unexpected config %v", c)
+	}
+
+	if err := os.WriteFile(envFile, []byte("OFFEN_APP_LOGLEVEL=debug\nOFFEN_SMTP_USER=other\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	next, err := Reload(envFile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if next.App.LogLevel.LogLevel().String() != "debug" {
+		t.Errorf("Expected log level to be updated, got %v", next.App.LogLevel.LogLevel())
+	}
+	if next.SMTP.Host != "" {
+		t.Errorf("Expected value removed from file to be unset, got %v", next.SMTP.Host)
+	}
+	if next.SMTP.User != "develop" {
+		t.Errorf("Expected value from environment to take precedence, got %v", next.SMTP.User)
+	}
+}
+
+func TestLive_Update(t *testing.T) {
+	initial := &Config{}
+	initial.Server.Port = 3000
+	initial.SMTP.Host = "smtp.offen.dev"
+	initial.App.DemoAccount = "demo-account"
+	live := NewLive(initial)
+
+	next := &Config{}
+	next.Server.Port = 4000
+	next.SMTP.Host = "mail.offen.dev"
+	next.RateLimit.Login = RateLimit{Requests: 1}
+
+	updated := live.Update(next)
+	if live.Load() != updated {
+		t.Error("Expected updated config to be stored")
+	}
+	if updated.Server.Port != 3000 {
+		t.Errorf("Expected port not to be reloaded, got %v", updated.Server.Port)
+	}
+	if updated.App.DemoAccount != "demo-account" {
+		t.Errorf("Expected demo account to be kept, got %v", updated.App.DemoAccount)
+	}
+	if updated.SMTP.Host != "mail.offen.dev" || updated.RateLimit.Login.Requests != 1 {
+		t.Errorf("Unexpected config %v", updated)
+	}
+	if initial.SMTP.Host != "smtp.offen.dev" {
+		t.Error("Expected initial config not to be modified")
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Replica is an additional S3 compatible endpoint backups are copied to.
+type Replica struct {
+	Region   string
+	Endpoint string
+}
+
+// Replicas is a list of backup replicas.
+type Replicas []Replica
+
+// Decode parses a comma separated list of region=endpoint pairs and assigns
+// the result.
+func (r *Replicas) Decode(v string) error {
+	var result Replicas
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		region, endpoint, ok := strings.Cut(item, "=")
+		if !ok || region == "" {
+			return fmt.Errorf("config: invalid replica %s, expected region=endpoint", item)
+		}
+		if u, err := url.Parse(endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("config: invalid endpoint %s for replica in region %s", endpoint, region)
+		}
+		result = append(result, Replica{Region: region, Endpoint: endpoint})
+	}
+	*r = result
+	return nil
+}
@@ -0,0 +1,33 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReplicas(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var r Replicas
+		if err := r.Decode("eu-central-1=https://s3.eu-central-1.amazonaws.com, us-west-2=https://s3.us-west-2.amazonaws.com"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		expected := Replicas{
+			{Region: "eu-central-1", Endpoint: "https://s3.eu-central-1.amazonaws.com"},
+			{Region: "us-west-2", Endpoint: "https://s3.us-west-2.amazonaws.com"},
+		}
+		if !reflect.DeepEqual(r, expected) {
+			t.Errorf("Unexpected value %v", r)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		for _, value := range []string{"https://s3.amazonaws.com", "eu-central-1=s3.amazonaws.com", "=https://s3.amazonaws.com"} {
+			var r Replicas
+			if err := r.Decode(value); err == nil {
+				t.Errorf("Unexpected nil error for %s", value)
+			}
+		}
+	})
+}
@@ -51,3 +51,18 @@ func (r *Retention) Decode(v string) error {
 func (r *Retention) String() string {
 	return r.configured
 }
+
+// Duration returns the configured retention period.
+func (r *Retention) Duration() time.Duration {
+	return r.retention
+}
+
+// RetentionDuration returns the duration of the given named retention
+// period, e.g. 30days.
+func RetentionDuration(v string) (time.Duration, error) {
+	var r Retention
+	if err := r.Decode(v); err != nil {
+		return 0, err
+	}
+	return r.retention, nil
+}
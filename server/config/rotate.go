@@ -0,0 +1,63 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/offen/offen/server/keys"
+)
+
+// RotateSecret generates a new value for OFFEN_SECRET and persists it in the
+// env file that is in use. The previous value is prepended to
+// OFFEN_PREVIOUSSECRETS so that values signed using it can still be verified.
+// Only the given number of previous secrets is kept.
+func RotateSecret(override string, keep int) error {
+	envFile, err := lookupEnvFile(override)
+	if err != nil {
+		return err
+	}
+	if envFile == "" {
+		return errors.New("config: unable to find env file to persist rotated secret")
+	}
+	values, err := godotenv.Read(envFile)
+	if err != nil {
+		return fmt.Errorf("config: error reading env file: %w", err)
+	}
+	current, ok := values["OFFEN_SECRET"]
+	if !ok || current == "" {
+		return fmt.Errorf("config: no OFFEN_SECRET set in env file %s", envFile)
+	}
+
+	previous := []string{current}
+	for _, value := range strings.Split(values["OFFEN_PREVIOUSSECRETS"], ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			previous = append(previous, value)
+		}
+	}
+	if keep < 0 {
+		keep = 0
+	}
+	if len(previous) > keep {
+		previous = previous[:keep]
+	}
+
+	next, err := keys.GenerateRandomValue(keys.DefaultSecretLength)
+	if err != nil {
+		return fmt.Errorf("config: error creating secret: %w", err)
+	}
+	values["OFFEN_SECRET"] = next
+	if len(previous) == 0 {
+		delete(values, "OFFEN_PREVIOUSSECRETS")
+	} else {
+		values["OFFEN_PREVIOUSSECRETS"] = strings.Join(previous, ",")
+	}
+	if err := godotenv.Write(values, envFile); err != nil {
+		return fmt.Errorf("config: error writing env file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joho/godotenv"
+)
+
+func TestRotateSecret(t *testing.T) {
+	tests := []struct {
+		name             string
+		content          string
+		keep             int
+		expectError      bool
+		expectedPrevious string
+	}{
+		{
+			"no secret",
+			"OFFEN_APP_LOGLEVEL=warn\n",
+			1,
+			true,
+			"",
+		},
+		{
+			"first rotation",
+			"OFFEN_SECRET=a2V5MQ==\n",
+			1,
+			false,
+			"a2V5MQ==",
+		},
+		{
+			"prepend previous",
+			"OFFEN_SECRET=a2V5Mg==\nOFFEN_PREVIOUSSECRETS=a2V5MQ==\n",
+			3,
+			false,
+			"a2V5Mg==,a2V5MQ==",
+		},
+		{
+			"drop old secrets",
+			"OFFEN_SECRET=a2V5Mw==\nOFFEN_PREVIOUSSECRETS=a2V5Mg==,a2V5MQ==\n",
+			2,
+			false,
+			"a2V5Mw==,a2V5Mg==",
+		},
+		{
+			"keep none",
+			"OFFEN_SECRET=a2V5Mw==\nOFFEN_PREVIOUSSECRETS=a2V5Mg==\n",
+			0,
+			false,
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			envFile := filepath.Join(t.TempDir(), "offen.env")
+			if err := os.WriteFile(envFile, []byte(test.content), 0644); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			before, _ := godotenv.Read(envFile)
+
+			err := RotateSecret(envFile, test.keep)
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if test.expectError {
+				return
+			}
+
+			after, err := godotenv.Read(envFile)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if after["OFFEN_SECRET"] == "" || after["OFFEN_SECRET"] == before["OFFEN_SECRET"] {
+				t.Errorf("Expected secret to be rotated, got %v", after["OFFEN_SECRET"])
+			}
+			if after["OFFEN_PREVIOUSSECRETS"] != test.expectedPrevious {
+				t.Errorf("Expected previous secrets %v, got %v", test.expectedPrevious, after["OFFEN_PREVIOUSSECRETS"])
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/offen/offen/server/secretsource"
+)
+
+type secretReference struct {
+	reference string
+	resolved  string
+}
+
+var (
+	secretReferencesMu sync.Mutex
+	// secretReferences contains all variables whose value has been resolved
+	// from a secret store, so they can be resolved again on reload.
+	secretReferences = map[string]secretReference{}
+	secretResolver   = secretsource.New(nil)
+)
+
+// resolveSecretReferences replaces the value of each variable that references
+// a secret in HashiCorp Vault or AWS Secrets Manager with the secret itself.
+// Variables that have been resolved before are resolved again using their
+// original reference, so secrets are fetched again each time the
+// configuration is reloaded.
+func resolveSecretReferences() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	secretReferencesMu.Lock()
+	defer secretReferencesMu.Unlock()
+	for _, pair := range os.Environ() {
+		key, value, _ := strings.Cut(pair, "=")
+		if !strings.HasPrefix(key, "OFFEN_") {
+			continue
+		}
+		reference := value
+		if previous, ok := secretReferences[key]; ok && previous.resolved == value {
+			reference = previous.reference
+		}
+		if !secretsource.IsReference(reference) {
+			delete(secretReferences, key)
+			continue
+		}
+		resolved, err := secretResolver.Resolve(ctx, reference)
+		if err != nil {
+			return fmt.Errorf("config: error resolving secret referenced by %s: %w", key, err)
+		}
+		os.Setenv(key, resolved)
+		secretReferences[key] = secretReference{reference: reference, resolved: resolved}
+
+		// the env file still is the source of the resolved value, so changes
+		// to the reference in the file are picked up on reload
+		fileValuesMu.Lock()
+		if previous, ok := fileValues[key]; ok && previous == reference {
+			fileValues[key] = resolved
+		}
+		fileValuesMu.Unlock()
+	}
+	return nil
+}
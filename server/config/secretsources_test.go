@@ -0,0 +1,76 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type mockSecretResolver struct {
+	version int
+	err     error
+}
+
+func (m *mockSecretResolver) Resolve(ctx context.Context, reference string) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	return fmt.Sprintf("%s@%d", reference, m.version), nil
+}
+
+func TestReload_SecretReferences(t *testing.T) {
+	resolver := &mockSecretResolver{version: 1}
+	original := secretResolver
+	secretResolver = resolver
+	defer func() { secretResolver = original }()
+
+	envFile := filepath.Join(t.TempDir(), "offen.env")
+	if err := os.WriteFile(envFile, []byte("OFFEN_SMTP_PASSWORD=vault://secret/offen?key=smtp\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	t.Setenv("OFFEN_SMTP_USER", "awssm://offen?key=user")
+	t.Setenv("OFFEN_APP_DEPLOYTARGET", "")
+	os.Unsetenv("OFFEN_APP_DEPLOYTARGET")
+	defer os.Unsetenv("OFFEN_SMTP_PASSWORD")
+
+	c, err := New(false, envFile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.SMTP.Password != "vault://secret/offen?key=smtp@1" || c.SMTP.User != "awssm://offen?key=user@1" {
+		t.Errorf("Unexpected config %v", c.SMTP)
+	}
+
+	// secrets are fetched again on reload
+	resolver.version = 2
+	next, err := Reload(envFile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if next.SMTP.Password != "vault://secret/offen?key=smtp@2" || next.SMTP.User != "awssm://offen?key=user@2" {
+		t.Errorf("Unexpected config %v", next.SMTP)
+	}
+
+	// changes to the env file apply to references
+	if err := os.WriteFile(envFile, []byte("OFFEN_SMTP_PASSWORD=vault://secret/other?key=smtp\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	next, err = Reload(envFile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if next.SMTP.Password != "vault://secret/other?key=smtp@2" {
+		t.Errorf("Unexpected password %v", next.SMTP.Password)
+	}
+
+	resolver.err = errors.New("did not work")
+	if _, err := Reload(envFile); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "fmt"
+
+// SessionStore identifies where login sessions of account users are stored.
+type SessionStore string
+
+// Decode validates and assigns v.
+func (s *SessionStore) Decode(v string) error {
+	switch v {
+	case "database", "memory":
+		*s = SessionStore(v)
+	default:
+		return fmt.Errorf("unknown or unsupported session store %s", v)
+	}
+	return nil
+}
+
+func (s *SessionStore) String() string {
+	return string(*s)
+}
@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "fmt"
+
+// StylesStore identifies where custom account styles are stored.
+type StylesStore string
+
+// Decode validates and assigns v.
+func (s *StylesStore) Decode(v string) error {
+	switch v {
+	case "database", "s3":
+		*s = StylesStore(v)
+	default:
+		return fmt.Errorf("unknown or unsupported styles store %s", v)
+	}
+	return nil
+}
+
+func (s *StylesStore) String() string {
+	return string(*s)
+}
@@ -0,0 +1,24 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import "testing"
+
+func TestStylesStore(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var s StylesStore
+		if err := s.Decode("s3"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if s.String() != "s3" {
+			t.Errorf("Unexpected value %v", s.String())
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		var s StylesStore
+		if err := s.Decode("floppy"); err == nil {
+			t.Error("Unexpected nil error")
+		}
+	})
+}
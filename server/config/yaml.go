@@ -0,0 +1,126 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
+)
+
+// yamlFileName is looked up next to each location of envFileName in case
+// no env file exists.
+const yamlFileName = "offen.yml"
+
+func isYAMLFile(file string) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yml", ".yaml":
+		return true
+	}
+	return false
+}
+
+// readConfigFile returns the values defined in the given file, keyed by the
+// environment variable they are overriding.
+func readConfigFile(file string) (map[string]string, error) {
+	if !isYAMLFile(file) {
+		return godotenv.Read(file)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parseYAMLConfig(b)
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// parseYAMLConfig flattens the given YAML document into environment
+// variables, so that
+//
+//	server:
+//	  port: 4000
+//	  auto_tls: [offen.example.com]
+//
+// results in OFFEN_SERVER_PORT=4000 and OFFEN_SERVER_AUTOTLS=offen.example.com.
+// Underscores and dashes in keys are ignored. Lists are joined by commas and
+// maps are encoded as key:value pairs. References like ${HOME} are replaced
+// with the value of the given environment variable.
+func parseYAMLConfig(b []byte) (map[string]string, error) {
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(b, &document); err != nil {
+		return nil, fmt.Errorf("config: error parsing yaml: %w", err)
+	}
+	result := map[string]string{}
+	for key, value := range document {
+		section, ok := value.(map[interface{}]interface{})
+		if !ok {
+			encoded, err := encodeYAMLValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("config: error encoding value of %s: %w", key, err)
+			}
+			result[yamlEnvKey(key)] = encoded
+			continue
+		}
+		for field, value := range section {
+			encoded, err := encodeYAMLValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("config: error encoding value of %s.%v: %w", key, field, err)
+			}
+			result[yamlEnvKey(key, fmt.Sprint(field))] = encoded
+		}
+	}
+	return result, nil
+}
+
+func yamlEnvKey(segments ...string) string {
+	normalized := []string{"OFFEN"}
+	for _, segment := range segments {
+		segment = strings.NewReplacer("_", "", "-", "").Replace(segment)
+		normalized = append(normalized, strings.ToUpper(segment))
+	}
+	return strings.Join(normalized, "_")
+}
+
+func encodeYAMLValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			encoded, err := encodeYAMLValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, encoded)
+		}
+		return strings.Join(items, ","), nil
+	case map[interface{}]interface{}:
+		var pairs []string
+		for key, item := range v {
+			encoded, err := encodeYAMLValue(item)
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, fmt.Sprintf("%v:%s", key, encoded))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ","), nil
+	case string:
+		return envReference.ReplaceAllStringFunc(v, func(match string) string {
+			return os.Getenv(envReference.FindStringSubmatch(match)[1])
+		}), nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", v)
+	}
+}
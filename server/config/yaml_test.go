@@ -0,0 +1,117 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseYAMLConfig(t *testing.T) {
+	t.Setenv("OFFEN_TEST_SMTP_PASSWORD", "pass")
+	tests := []struct {
+		name           string
+		document       string
+		expectedResult map[string]string
+		expectError    bool
+	}{
+		{
+			"nested sections",
+			`
+secret: abc
+include: [shared.yml, other.yml]
+server:
+  port: 4000
+  auto_tls:
+    - offen.example.com
+    - www.offen.example.com
+  max-body-size: 1MB
+smtp:
+  password: ${OFFEN_TEST_SMTP_PASSWORD}-$plain
+oidc:
+  providers:
+    google: https://accounts.google.com
+    okta: https://offen.okta.com
+`,
+			map[string]string{
+				"OFFEN_SECRET":             "abc",
+				"OFFEN_INCLUDE":            "shared.yml,other.yml",
+				"OFFEN_SERVER_PORT":        "4000",
+				"OFFEN_SERVER_AUTOTLS":     "offen.example.com,www.offen.example.com",
+				"OFFEN_SERVER_MAXBODYSIZE": "1MB",
+				"OFFEN_SMTP_PASSWORD":      "pass-$plain",
+				"OFFEN_OIDC_PROVIDERS":     "google:https://accounts.google.com,okta:https://offen.okta.com",
+			},
+			false,
+		},
+		{
+			"empty document",
+			"",
+			map[string]string{},
+			false,
+		},
+		{
+			"bad document",
+			"server: [",
+			nil,
+			true,
+		},
+		{
+			"date-like value",
+			"server:\n  port: 2020-01-01\n",
+			map[string]string{"OFFEN_SERVER_PORT": "2020-01-01"},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := parseYAMLConfig([]byte(test.document))
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestNew_YAML(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "offen.yml")
+	if err := os.WriteFile(configFile, []byte(`
+app:
+  log_level: warn
+  invitation_expiry: 12h
+server:
+  port: 4000
+  max_body_size: 128KB
+`), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	t.Setenv("OFFEN_SERVER_PORT", "5000")
+	// other tests restore an unset deploy target as an empty value
+	t.Setenv("OFFEN_APP_DEPLOYTARGET", "")
+	os.Unsetenv("OFFEN_APP_DEPLOYTARGET")
+	defer os.Unsetenv("OFFEN_APP_LOGLEVEL")
+	defer os.Unsetenv("OFFEN_APP_INVITATIONEXPIRY")
+	defer os.Unsetenv("OFFEN_SERVER_MAXBODYSIZE")
+
+	c, err := New(false, configFile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.App.LogLevel.LogLevel().String() != "warning" || c.App.InvitationExpiry != time.Hour*12 {
+		t.Errorf("Unexpected app config %v", c.App)
+	}
+	if c.Server.Port != 5000 {
+		t.Errorf("Expected environment to take precedence, got %v", c.Server.Port)
+	}
+	if c.Server.MaxBodySize.Int64() != 128*1024 {
+		t.Errorf("Unexpected body size %v", c.Server.MaxBodySize)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package dnschallenge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NewCloudflare creates a Provider that manages records using the Cloudflare
+// API. The given token needs to be allowed to edit DNS records of the zone.
+func NewCloudflare(token string) Provider {
+	return &cloudflare{
+		token:   token,
+		baseURL: "https://api.cloudflare.com/client/v4",
+		client:  &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+type cloudflare struct {
+	token   string
+	baseURL string
+	client  *http.Client
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+func (c *cloudflare) do(ctx context.Context, method, path string, payload, result interface{}) error {
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return fmt.Errorf("dnschallenge: error encoding payload: %w", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, &body)
+	if err != nil {
+		return fmt.Errorf("dnschallenge: error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("dnschallenge: error calling cloudflare api: %w", err)
+	}
+	defer res.Body.Close()
+
+	var response cloudflareResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return fmt.Errorf("dnschallenge: error decoding cloudflare response: %w", err)
+	}
+	if !response.Success {
+		var messages []string
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("dnschallenge: cloudflare api returned errors: %s", strings.Join(messages, ", "))
+	}
+	if result != nil {
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			return fmt.Errorf("dnschallenge: error decoding cloudflare result: %w", err)
+		}
+	}
+	return nil
+}
+
+// zoneID looks up the zone the given name belongs to by trying all of its
+// parent domains.
+func (c *cloudflare) zoneID(ctx context.Context, name string) (string, error) {
+	labels := strings.Split(name, ".")
+	for i := 0; i < len(labels)-1; i++ {
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		candidate := strings.Join(labels[i:], ".")
+		if err := c.do(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(candidate), nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones) != 0 {
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("dnschallenge: no cloudflare zone found for %s", name)
+}
+
+func (c *cloudflare) Present(ctx context.Context, fqdn, value string) error {
+	name := strings.TrimSuffix(fqdn, ".")
+	zoneID, err := c.zoneID(ctx, name)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/zones/%s/dns_records", zoneID), cloudflareRecord{
+		Type:    "TXT",
+		Name:    name,
+		Content: value,
+		TTL:     120,
+	}, nil)
+}
+
+func (c *cloudflare) CleanUp(ctx context.Context, fqdn, value string) error {
+	name := strings.TrimSuffix(fqdn, ".")
+	zoneID, err := c.zoneID(ctx, name)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"type": {"TXT"}, "name": {name}, "content": {value}}
+	var records []cloudflareRecord
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/zones/%s/dns_records?%s", zoneID, query.Encode()), nil, &records); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := c.do(ctx, http.MethodDelete, fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, record.ID), nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package dnschallenge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCloudflare(t *testing.T) {
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.Write([]byte(`{"success":false,"errors":[{"message":"unauthorized"}]}`))
+			return
+		}
+		calls = append(calls, fmt.Sprintf("%s %s", r.Method, r.URL.RequestURI()))
+		switch {
+		case r.URL.Path == "/zones" && r.URL.Query().Get("name") == "example.com":
+			w.Write([]byte(`{"success":true,"result":[{"id":"zone-a"}]}`))
+		case r.URL.Path == "/zones":
+			w.Write([]byte(`{"success":true,"result":[]}`))
+		case r.Method == http.MethodPost:
+			var record cloudflareRecord
+			json.NewDecoder(r.Body).Decode(&record)
+			if record.Name != "_acme-challenge.example.com" || record.Content != "value" {
+				t.Errorf("Unexpected record %v", record)
+			}
+			w.Write([]byte(`{"success":true,"result":{"id":"record-a"}}`))
+		case r.Method == http.MethodGet:
+			w.Write([]byte(`{"success":true,"result":[{"id":"record-a"}]}`))
+		default:
+			w.Write([]byte(`{"success":true,"result":null}`))
+		}
+	}))
+	defer server.Close()
+
+	p := NewCloudflare("token").(*cloudflare)
+	p.baseURL = server.URL
+
+	if err := p.Present(context.Background(), "_acme-challenge.example.com.", "value"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := p.CleanUp(context.Background(), "_acme-challenge.example.com.", "value"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if calls[len(calls)-1] != "DELETE /zones/zone-a/dns_records/record-a" {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+
+	p.token = "other"
+	if err := p.Present(context.Background(), "_acme-challenge.example.com.", "value"); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package dnschallenge obtains certificates from Let's Encrypt using the
+// DNS-01 challenge. In contrast to the HTTP-01 challenge, this does not
+// require port 80 to be reachable and supports wildcard domains.
+package dnschallenge
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Provider creates and removes the TXT records used for solving DNS-01
+// challenges.
+type Provider interface {
+	Present(ctx context.Context, fqdn, value string) error
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+const (
+	accountKeyName = "dns01+account+key"
+	renewBefore    = time.Hour * 24 * 30
+)
+
+// Manager obtains and renews a single certificate that is valid for all of
+// the given domains.
+type Manager struct {
+	Provider Provider
+	Domains  []string
+	Email    string
+	Cache    autocert.Cache
+	// PropagationDelay is the time waited after creating TXT records before
+	// asking the ACME server to validate them.
+	PropagationDelay time.Duration
+	// DirectoryURL defaults to the production endpoint of Let's Encrypt.
+	DirectoryURL string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// GetCertificate can be used as the GetCertificate callback of a tls.Config.
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return nil, errors.New("dnschallenge: no certificate available")
+	}
+	return m.cert, nil
+}
+
+func (m *Manager) certKey() string {
+	domains := append([]string(nil), m.Domains...)
+	sort.Strings(domains)
+	return "dns01+" + strings.ReplaceAll(strings.Join(domains, "+"), "*", "_")
+}
+
+func (m *Manager) needsRenewal() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cert == nil || time.Until(m.cert.Leaf.NotAfter) < renewBefore
+}
+
+// Obtain ensures a valid certificate is available, reading it from the
+// cache or requesting a new one in case there is none or it is about to
+// expire.
+func (m *Manager) Obtain(ctx context.Context) error {
+	if m.cert == nil {
+		if data, err := m.Cache.Get(ctx, m.certKey()); err == nil {
+			cert, err := parseCertificate(data)
+			if err != nil {
+				return fmt.Errorf("dnschallenge: error parsing cached certificate: %w", err)
+			}
+			m.mu.Lock()
+			m.cert = cert
+			m.mu.Unlock()
+		} else if !errors.Is(err, autocert.ErrCacheMiss) {
+			return fmt.Errorf("dnschallenge: error reading certificate from cache: %w", err)
+		}
+	}
+	if !m.needsRenewal() {
+		return nil
+	}
+
+	cert, data, err := m.issue(ctx)
+	if err != nil {
+		return err
+	}
+	if err := m.Cache.Put(ctx, m.certKey(), data); err != nil {
+		return fmt.Errorf("dnschallenge: error caching certificate: %w", err)
+	}
+	m.mu.Lock()
+	m.cert = cert
+	m.mu.Unlock()
+	return nil
+}
+
+// Renew periodically checks whether the certificate needs to be renewed
+// until the given context is canceled. Errors are passed to onError.
+func (m *Manager) Renew(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Obtain(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (m *Manager) client(ctx context.Context) (*acme.Client, error) {
+	key, err := m.accountKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{Key: key, DirectoryURL: m.DirectoryURL}
+	if client.DirectoryURL == "" {
+		client.DirectoryURL = acme.LetsEncryptURL
+	}
+	account := &acme.Account{}
+	if m.Email != "" {
+		account.Contact = []string{"mailto:" + m.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("dnschallenge: error registering account: %w", err)
+	}
+	return client, nil
+}
+
+func (m *Manager) accountKey(ctx context.Context) (crypto.Signer, error) {
+	data, err := m.Cache.Get(ctx, accountKeyName)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("dnschallenge: invalid account key in cache")
+		}
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("dnschallenge: error parsing account key: %w", err)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, autocert.ErrCacheMiss) {
+		return nil, fmt.Errorf("dnschallenge: error reading account key from cache: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("dnschallenge: error generating account key: %w", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("dnschallenge: error encoding account key: %w", err)
+	}
+	if err := m.Cache.Put(ctx, accountKeyName, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, fmt.Errorf("dnschallenge: error caching account key: %w", err)
+	}
+	return key, nil
+}
+
+func (m *Manager) issue(ctx context.Context) (*tls.Certificate, []byte, error) {
+	client, err := m.client(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(m.Domains...))
+	if err != nil {
+		return nil, nil, fmt.Errorf("dnschallenge: error creating order: %w", err)
+	}
+	// authorizations are solved one after the other as a wildcard domain and
+	// its base domain use the same record name
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, authzURL); err != nil {
+			return nil, nil, err
+		}
+	}
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, nil, fmt.Errorf("dnschallenge: error waiting for order: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dnschallenge: error generating certificate key: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: m.Domains}, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dnschallenge: error creating certificate request: %w", err)
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dnschallenge: error finalizing order: %w", err)
+	}
+
+	data, err := encodeCertificate(key, chain)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := parseCertificate(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dnschallenge: error parsing issued certificate: %w", err)
+	}
+	return cert, data, nil
+}
+
+func (m *Manager) authorize(ctx context.Context, client *acme.Client, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("dnschallenge: error fetching authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("dnschallenge: no dns-01 challenge offered for %s", authz.Identifier.Value)
+	}
+
+	value, err := client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return fmt.Errorf("dnschallenge: error computing challenge record: %w", err)
+	}
+	fqdn := "_acme-challenge." + strings.TrimPrefix(authz.Identifier.Value, "*.") + "."
+	if err := m.Provider.Present(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("dnschallenge: error creating challenge record for %s: %w", authz.Identifier.Value, err)
+	}
+	defer m.Provider.CleanUp(ctx, fqdn, value)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(m.PropagationDelay):
+	}
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("dnschallenge: error accepting challenge: %w", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("dnschallenge: error validating %s: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// encodeCertificate uses the same format as autocert, i.e. the private key
+// followed by the certificate chain.
+func encodeCertificate(key *ecdsa.PrivateKey, chain [][]byte) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("dnschallenge: error encoding certificate key: %w", err)
+	}
+	var buf bytes.Buffer
+	pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	for _, c := range chain {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c})
+	}
+	return buf.Bytes(), nil
+}
+
+func parseCertificate(data []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package dnschallenge
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+type mockCache map[string][]byte
+
+func (m mockCache) Get(ctx context.Context, key string) ([]byte, error) {
+	if data, ok := m[key]; ok {
+		return data, nil
+	}
+	return nil, autocert.ErrCacheMiss
+}
+
+func (m mockCache) Put(ctx context.Context, key string, data []byte) error {
+	m[key] = data
+	return nil
+}
+
+func (m mockCache) Delete(ctx context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func selfSignedCertificate(t *testing.T, notAfter time.Time) []byte {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com", "*.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	data, err := encodeCertificate(key, [][]byte{der})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return data
+}
+
+func TestManager_Obtain(t *testing.T) {
+	cache := mockCache{}
+	m := &Manager{Domains: []string{"example.com", "*.example.com"}, Cache: cache}
+	if _, err := m.GetCertificate(nil); err == nil {
+		t.Error("Expected error before obtaining certificate")
+	}
+
+	if m.certKey() != "dns01+_.example.com+example.com" {
+		t.Errorf("Unexpected cache key %s", m.certKey())
+	}
+	cache[m.certKey()] = selfSignedCertificate(t, time.Now().Add(time.Hour*24*60))
+
+	if err := m.Obtain(context.Background()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cert, err := m.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if cert.Leaf.Subject.CommonName != "example.com" {
+		t.Errorf("Unexpected certificate %v", cert.Leaf.Subject)
+	}
+}
+
+func TestManager_needsRenewal(t *testing.T) {
+	m := &Manager{}
+	if !m.needsRenewal() {
+		t.Error("Expected missing certificate to need renewal")
+	}
+	cert, _ := parseCertificate(selfSignedCertificate(t, time.Now().Add(time.Hour*24*7)))
+	m.cert = cert
+	if !m.needsRenewal() {
+		t.Error("Expected certificate close to expiry to need renewal")
+	}
+	cert, _ = parseCertificate(selfSignedCertificate(t, time.Now().Add(time.Hour*24*60)))
+	m.cert = cert
+	if m.needsRenewal() {
+		t.Error("Expected valid certificate not to need renewal")
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package dnschallenge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	dnsTypeSOA  = 6
+	dnsTypeTXT  = 16
+	dnsTypeTSIG = 250
+
+	dnsClassIN   = 1
+	dnsClassNone = 254
+	dnsClassAny  = 255
+
+	dnsOpcodeUpdate = 5
+	tsigFudge       = 300
+)
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha1.":   sha1.New,
+	"hmac-sha256.": sha256.New,
+	"hmac-sha512.": sha512.New,
+}
+
+// NewRFC2136 creates a Provider that manages records using dynamic DNS
+// updates as defined in RFC 2136, authenticated using TSIG. The secret is
+// expected to be base64 encoded.
+func NewRFC2136(nameserver, zone, keyName, algorithm, secret string) (Provider, error) {
+	if _, _, err := net.SplitHostPort(nameserver); err != nil {
+		nameserver = net.JoinHostPort(nameserver, "53")
+	}
+	algorithm = fqdn(strings.ToLower(algorithm))
+	if _, ok := tsigAlgorithms[algorithm]; !ok {
+		return nil, fmt.Errorf("dnschallenge: unsupported tsig algorithm %s", algorithm)
+	}
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("dnschallenge: error decoding tsig secret: %w", err)
+	}
+	return &rfc2136{
+		nameserver: nameserver,
+		zone:       fqdn(zone),
+		keyName:    fqdn(strings.ToLower(keyName)),
+		algorithm:  algorithm,
+		secret:     key,
+		now:        time.Now,
+	}, nil
+}
+
+type rfc2136 struct {
+	nameserver string
+	zone       string
+	keyName    string
+	algorithm  string
+	secret     []byte
+	now        func() time.Time
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func (r *rfc2136) Present(ctx context.Context, name, value string) error {
+	return r.update(ctx, name, value, dnsClassIN, 60)
+}
+
+func (r *rfc2136) CleanUp(ctx context.Context, name, value string) error {
+	// a record of class NONE deletes the matching record from the zone
+	return r.update(ctx, name, value, dnsClassNone, 0)
+}
+
+func (r *rfc2136) update(ctx context.Context, name, value string, class uint16, ttl uint32) error {
+	msg, err := r.message(fqdn(name), value, class, ttl)
+	if err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", r.nameserver)
+	if err != nil {
+		return fmt.Errorf("dnschallenge: error connecting to nameserver: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Second * 30))
+	}
+
+	// messages sent over TCP are prefixed with their length
+	if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(msg))), msg...)); err != nil {
+		return fmt.Errorf("dnschallenge: error sending update: %w", err)
+	}
+	var length uint16
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+		return fmt.Errorf("dnschallenge: error reading response: %w", err)
+	}
+	response := make([]byte, length)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return fmt.Errorf("dnschallenge: error reading response: %w", err)
+	}
+	if len(response) < 12 {
+		return errors.New("dnschallenge: received truncated response")
+	}
+	if rcode := response[3] & 0x0f; rcode != 0 {
+		return fmt.Errorf("dnschallenge: nameserver rejected update with rcode %d", rcode)
+	}
+	return nil
+}
+
+// message builds a signed DNS UPDATE message containing a single TXT record
+// for the given name.
+func (r *rfc2136) message(name, value string, class uint16, ttl uint32) ([]byte, error) {
+	if len(value) > 255 {
+		return nil, errors.New("dnschallenge: txt record value too long")
+	}
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, fmt.Errorf("dnschallenge: error generating message id: %w", err)
+	}
+
+	msg := append([]byte(nil), id[:]...)
+	msg = binary.BigEndian.AppendUint16(msg, dnsOpcodeUpdate<<11)
+	// one zone, no prerequisites, one update, no additional records yet
+	msg = binary.BigEndian.AppendUint16(msg, 1)
+	msg = binary.BigEndian.AppendUint16(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, 1)
+	msg = binary.BigEndian.AppendUint16(msg, 0)
+
+	msg = appendName(msg, r.zone)
+	msg = binary.BigEndian.AppendUint16(msg, dnsTypeSOA)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+
+	msg = appendName(msg, name)
+	msg = binary.BigEndian.AppendUint16(msg, dnsTypeTXT)
+	msg = binary.BigEndian.AppendUint16(msg, class)
+	msg = binary.BigEndian.AppendUint32(msg, ttl)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(value)+1))
+	msg = append(msg, byte(len(value)))
+	msg = append(msg, value...)
+
+	return r.sign(msg, id[:]), nil
+}
+
+// sign appends a TSIG record as defined in RFC 8945 to the given message.
+func (r *rfc2136) sign(msg, id []byte) []byte {
+	timeSigned := uint64(r.now().Unix())
+
+	variables := appendName(nil, r.keyName)
+	variables = binary.BigEndian.AppendUint16(variables, dnsClassAny)
+	variables = binary.BigEndian.AppendUint32(variables, 0)
+	variables = appendName(variables, r.algorithm)
+	variables = appendUint48(variables, timeSigned)
+	variables = binary.BigEndian.AppendUint16(variables, tsigFudge)
+	// no error and no other data
+	variables = binary.BigEndian.AppendUint16(variables, 0)
+	variables = binary.BigEndian.AppendUint16(variables, 0)
+
+	mac := hmac.New(tsigAlgorithms[r.algorithm], r.secret)
+	mac.Write(msg)
+	mac.Write(variables)
+	sum := mac.Sum(nil)
+
+	rdata := appendName(nil, r.algorithm)
+	rdata = appendUint48(rdata, timeSigned)
+	rdata = binary.BigEndian.AppendUint16(rdata, tsigFudge)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(sum)))
+	rdata = append(rdata, sum...)
+	rdata = append(rdata, id...)
+	rdata = binary.BigEndian.AppendUint16(rdata, 0)
+	rdata = binary.BigEndian.AppendUint16(rdata, 0)
+
+	signed := append([]byte(nil), msg...)
+	signed = appendName(signed, r.keyName)
+	signed = binary.BigEndian.AppendUint16(signed, dnsTypeTSIG)
+	signed = binary.BigEndian.AppendUint16(signed, dnsClassAny)
+	signed = binary.BigEndian.AppendUint32(signed, 0)
+	signed = binary.BigEndian.AppendUint16(signed, uint16(len(rdata)))
+	signed = append(signed, rdata...)
+	// the TSIG record is the only additional record
+	binary.BigEndian.PutUint16(signed[10:], 1)
+	return signed
+}
+
+func appendName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func appendUint48(b []byte, v uint64) []byte {
+	return append(b, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
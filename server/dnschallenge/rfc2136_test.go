@@ -0,0 +1,105 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package dnschallenge
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewRFC2136(t *testing.T) {
+	if _, err := NewRFC2136("ns.example.com", "example.com", "key", "hmac-md5", "c2VjcmV0"); err == nil {
+		t.Error("Expected error for unsupported algorithm")
+	}
+	if _, err := NewRFC2136("ns.example.com", "example.com", "key", "hmac-sha256", "%%%"); err == nil {
+		t.Error("Expected error for invalid secret")
+	}
+	p, err := NewRFC2136("ns.example.com", "example.com", "Key", "HMAC-SHA256", "c2VjcmV0")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	r := p.(*rfc2136)
+	if r.nameserver != "ns.example.com:53" || r.zone != "example.com." || r.keyName != "key." || r.algorithm != "hmac-sha256." {
+		t.Errorf("Unexpected provider %v", r)
+	}
+}
+
+func TestRFC2136_message(t *testing.T) {
+	p, _ := NewRFC2136("127.0.0.1", "example.com", "key", "hmac-sha256", "c2VjcmV0")
+	r := p.(*rfc2136)
+	r.now = func() time.Time { return time.Unix(1600000000, 0) }
+
+	msg, err := r.message("_acme-challenge.example.com.", "value", dnsClassIN, 60)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if opcode := binary.BigEndian.Uint16(msg[2:]) >> 11; opcode != dnsOpcodeUpdate {
+		t.Errorf("Unexpected opcode %d", opcode)
+	}
+	if counts := msg[4:12]; !bytes.Equal(counts, []byte{0, 1, 0, 0, 0, 1, 0, 1}) {
+		t.Errorf("Unexpected section counts %v", counts)
+	}
+	if !bytes.Contains(msg, append([]byte{5}, "value"...)) {
+		t.Error("Expected message to contain txt record")
+	}
+
+	// the MAC is the last value before the original id, error and other len
+	mac := msg[len(msg)-6-sha256.Size : len(msg)-6]
+	unsigned := append([]byte(nil), msg[:bytes.Index(msg, append(appendName(nil, "key."), 0, dnsTypeTSIG))]...)
+	binary.BigEndian.PutUint16(unsigned[10:], 0)
+	variables := appendName(nil, "key.")
+	variables = append(variables, 0, dnsClassAny, 0, 0, 0, 0)
+	variables = appendName(variables, "hmac-sha256.")
+	variables = appendUint48(variables, 1600000000)
+	variables = append(variables, 1, 44, 0, 0, 0, 0)
+	expected := hmac.New(sha256.New, []byte("secret"))
+	expected.Write(unsigned)
+	expected.Write(variables)
+	if !hmac.Equal(mac, expected.Sum(nil)) {
+		t.Error("Unexpected message signature")
+	}
+}
+
+func TestRFC2136_update(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer l.Close()
+	rcodes := make(chan byte, 2)
+	rcodes <- 0
+	rcodes <- 5
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var length uint16
+			binary.Read(conn, binary.BigEndian, &length)
+			msg := make([]byte, length)
+			io.ReadFull(conn, msg)
+			response := append([]byte(nil), msg[:12]...)
+			response[2] |= 0x80
+			response[3] = <-rcodes
+			conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(response))), response...))
+			conn.Close()
+		}
+	}()
+
+	p, _ := NewRFC2136(l.Addr().String(), "example.com", "key", "hmac-sha256", "c2VjcmV0")
+	if err := p.Present(context.Background(), "_acme-challenge.example.com.", "value"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := p.CleanUp(context.Background(), "_acme-challenge.example.com.", "value"); err == nil {
+		t.Error("Expected refused update to return an error")
+	}
+}
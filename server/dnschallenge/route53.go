@@ -0,0 +1,93 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package dnschallenge
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/offen/offen/server/sigv4"
+)
+
+// NewRoute53 creates a Provider that manages records in the given hosted zone
+// using the AWS Route53 API.
+func NewRoute53(hostedZoneID, accessKeyID, secretAccessKey string) Provider {
+	return &route53{
+		hostedZoneID: hostedZoneID,
+		baseURL:      "https://route53.amazonaws.com",
+		// Route53 is a global service that is always signed for us-east-1
+		signer: sigv4.New(sigv4.Credentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+		}, "us-east-1", "route53"),
+		client: &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+type route53 struct {
+	hostedZoneID string
+	baseURL      string
+	signer       *sigv4.Signer
+	client       *http.Client
+}
+
+type route53ChangeRequest struct {
+	XMLName xml.Name        `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+	Changes []route53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+type route53Change struct {
+	Action string `xml:"Action"`
+	Name   string `xml:"ResourceRecordSet>Name"`
+	Type   string `xml:"ResourceRecordSet>Type"`
+	TTL    int    `xml:"ResourceRecordSet>TTL"`
+	Value  string `xml:"ResourceRecordSet>ResourceRecords>ResourceRecord>Value"`
+}
+
+func (r *route53) change(ctx context.Context, action, fqdn, value string) error {
+	body, err := xml.Marshal(route53ChangeRequest{
+		Changes: []route53Change{
+			{Action: action, Name: fqdn, Type: "TXT", TTL: 60, Value: fmt.Sprintf("%q", value)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("dnschallenge: error encoding change request: %w", err)
+	}
+	body = append([]byte(xml.Header), body...)
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost,
+		fmt.Sprintf("%s/2013-04-01/hostedzone/%s/rrset", r.baseURL, r.hostedZoneID),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return fmt.Errorf("dnschallenge: error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	r.signer.Sign(req, body)
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("dnschallenge: error calling route53 api: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("dnschallenge: route53 api returned status %d: %s", res.StatusCode, string(b))
+	}
+	return nil
+}
+
+func (r *route53) Present(ctx context.Context, fqdn, value string) error {
+	return r.change(ctx, "UPSERT", fqdn, value)
+}
+
+func (r *route53) CleanUp(ctx context.Context, fqdn, value string) error {
+	return r.change(ctx, "DELETE", fqdn, value)
+}
@@ -0,0 +1,56 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package dnschallenge
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRoute53(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2013-04-01/hostedzone/zone-a/rrset" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer server.Close()
+
+	p := NewRoute53("zone-a", "key", "secret").(*route53)
+	p.baseURL = server.URL
+	if err := p.Present(context.Background(), "_acme-challenge.example.com.", "value"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := p.CleanUp(context.Background(), "_acme-challenge.example.com.", "value"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	expected := `<ChangeResourceRecordSetsRequest xmlns="https://route53.amazonaws.com/doc/2013-04-01/">` +
+		`<ChangeBatch><Changes><Change><Action>UPSERT</Action><ResourceRecordSet>` +
+		`<Name>_acme-challenge.example.com.</Name><Type>TXT</Type><TTL>60</TTL>` +
+		`<ResourceRecords><ResourceRecord><Value>&#34;value&#34;</Value></ResourceRecord></ResourceRecords>` +
+		`</ResourceRecordSet></Change></Changes></ChangeBatch></ChangeResourceRecordSetsRequest>`
+	if len(bodies) != 2 || !strings.HasSuffix(bodies[0], expected) {
+		t.Errorf("Unexpected request bodies %v", bodies)
+	}
+	if !strings.Contains(bodies[1], "<Action>DELETE</Action>") {
+		t.Errorf("Expected record to be deleted, got %s", bodies[1])
+	}
+
+	p.hostedZoneID = "zone-b"
+	if err := p.Present(context.Background(), "_acme-challenge.example.com.", "value"); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package domainverify checks whether the owner of a domain has published a
+// challenge token, either as a DNS TXT record or as a meta tag on the
+// domain's index page.
+package domainverify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/safehttp"
+)
+
+// The following methods can be used for verifying a domain.
+const (
+	MethodDNS  = "dns"
+	MethodMeta = "meta"
+)
+
+// ErrChallengeFailed is wrapped by errors that are returned in case the
+// challenge could be looked up, but the expected token was not found.
+var ErrChallengeFailed = errors.New("domainverify: challenge failed")
+
+// Verifier checks whether the given token has been published for a domain
+// using the given method.
+type Verifier interface {
+	Verify(method, domain, token string) error
+}
+
+// RecordName returns the name of the TXT record that is expected to contain
+// the challenge for the given domain.
+func RecordName(domain string) string {
+	return "_offen-verification." + domain
+}
+
+// RecordValue returns the value of the TXT record or the content of the meta
+// tag that is expected for the given token.
+func RecordValue(token string) string {
+	return "offen-verification=" + token
+}
+
+// MetaTag returns the tag that is expected in the head of the domain's
+// index page for the given token.
+func MetaTag(token string) string {
+	return fmt.Sprintf(`<meta name="offen-verification" content="%s">`, RecordValue(token))
+}
+
+// NetVerifier looks up challenges using the network.
+type NetVerifier struct {
+	LookupTXT func(ctx context.Context, name string) ([]string, error)
+	Client    *http.Client
+	Timeout   time.Duration
+}
+
+// New creates a verifier that gives up on lookups after the given timeout.
+func New(timeout time.Duration) *NetVerifier {
+	return &NetVerifier{
+		LookupTXT: net.DefaultResolver.LookupTXT,
+		Client:    safehttp.NewClient(timeout),
+		Timeout:   timeout,
+	}
+}
+
+// Verify implements Verifier.
+func (v *NetVerifier) Verify(method, domain, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), v.Timeout)
+	defer cancel()
+	switch method {
+	case MethodDNS:
+		return v.verifyDNS(ctx, domain, token)
+	case MethodMeta:
+		return v.verifyMeta(ctx, domain, token)
+	default:
+		return fmt.Errorf("domainverify: unknown method %s", method)
+	}
+}
+
+func (v *NetVerifier) verifyDNS(ctx context.Context, domain, token string) error {
+	records, err := v.LookupTXT(ctx, RecordName(domain))
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return fmt.Errorf("%w: no TXT record found at %s", ErrChallengeFailed, RecordName(domain))
+		}
+		return fmt.Errorf("domainverify: error looking up TXT record: %w", err)
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == RecordValue(token) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: TXT record at %s does not contain the expected value", ErrChallengeFailed, RecordName(domain))
+}
+
+var metaTagRe = regexp.MustCompile(`(?i)<meta\s[^>]*>`)
+var metaAttrRe = regexp.MustCompile(`(?i)(name|content)\s*=\s*("[^"]*"|'[^']*')`)
+
+// maxPageSize limits the part of the index page that is searched for the
+// meta tag, which is expected to be in the document's head.
+const maxPageSize = 1 << 20
+
+func (v *NetVerifier) verifyMeta(ctx context.Context, domain, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+domain+"/", nil)
+	if err != nil {
+		return fmt.Errorf("domainverify: error creating request: %w", err)
+	}
+	res, err := v.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("domainverify: error requesting index page: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: index page responded with status %d", ErrChallengeFailed, res.StatusCode)
+	}
+	page, err := io.ReadAll(io.LimitReader(res.Body, maxPageSize))
+	if err != nil {
+		return fmt.Errorf("domainverify: error reading index page: %w", err)
+	}
+	for _, tag := range metaTagRe.FindAllString(string(page), -1) {
+		var name, content string
+		for _, attr := range metaAttrRe.FindAllStringSubmatch(tag, -1) {
+			value := strings.Trim(attr[2], `"'`)
+			switch strings.ToLower(attr[1]) {
+			case "name":
+				name = value
+			case "content":
+				content = value
+			}
+		}
+		if strings.EqualFold(name, "offen-verification") && content == RecordValue(token) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: index page does not contain the expected meta tag", ErrChallengeFailed)
+}
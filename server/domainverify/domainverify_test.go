@@ -0,0 +1,128 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package domainverify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetVerifier_DNS(t *testing.T) {
+	tests := []struct {
+		name          string
+		lookup        func(ctx context.Context, name string) ([]string, error)
+		expectError   bool
+		expectFailure bool
+	}{
+		{
+			"ok",
+			func(ctx context.Context, name string) ([]string, error) {
+				if name != "_offen-verification.www.offen.dev" {
+					return nil, errors.New("unexpected name")
+				}
+				return []string{"other=value", "offen-verification=token"}, nil
+			},
+			false,
+			false,
+		},
+		{
+			"bad value",
+			func(ctx context.Context, name string) ([]string, error) {
+				return []string{"offen-verification=other"}, nil
+			},
+			true,
+			true,
+		},
+		{
+			"no record",
+			func(ctx context.Context, name string) ([]string, error) {
+				return nil, &net.DNSError{IsNotFound: true}
+			},
+			true,
+			true,
+		},
+		{
+			"lookup error",
+			func(ctx context.Context, name string) ([]string, error) {
+				return nil, errors.New("did not work")
+			},
+			true,
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := &NetVerifier{LookupTXT: test.lookup, Timeout: time.Second}
+			err := v.Verify(MethodDNS, "www.offen.dev", "token")
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if errors.Is(err, ErrChallengeFailed) != test.expectFailure {
+				t.Errorf("Unexpected failure value %v", err)
+			}
+		})
+	}
+}
+
+func TestNetVerifier_Meta(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		expectError   bool
+		expectFailure bool
+	}{
+		{
+			"ok",
+			http.StatusOK,
+			`<html><head><meta charset="utf-8"><META content='offen-verification=token' name="offen-verification"></head></html>`,
+			false,
+			false,
+		},
+		{
+			"bad token",
+			http.StatusOK,
+			`<html><head><meta name="offen-verification" content="offen-verification=other"></head></html>`,
+			true,
+			true,
+		},
+		{
+			"bad status",
+			http.StatusNotFound,
+			MetaTag("token"),
+			true,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+			v := &NetVerifier{Client: server.Client(), Timeout: time.Second}
+			err := v.Verify(MethodMeta, strings.TrimPrefix(server.URL, "https://"), "token")
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if errors.Is(err, ErrChallengeFailed) != test.expectFailure {
+				t.Errorf("Unexpected failure value %v", err)
+			}
+		})
+	}
+}
+
+func TestNetVerifier_UnknownMethod(t *testing.T) {
+	v := New(time.Second)
+	if err := v.Verify("carrier-pigeon", "www.offen.dev", "token"); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
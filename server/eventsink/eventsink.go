@@ -0,0 +1,240 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package eventsink forwards ingested events to a message broker so they can
+// be archived or processed by downstream systems. Events are forwarded as
+// they are stored, i.e. their payloads are still encrypted.
+//
+// Forwarding happens in the background and never blocks ingestion. In case
+// the broker cannot keep up or is unavailable, events are dropped after a
+// number of attempts and the failure is reported.
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/offen/offen/server/kafka"
+	"github.com/offen/offen/server/metrics"
+	"github.com/offen/offen/server/nats"
+	"github.com/offen/offen/server/persistence"
+)
+
+// Message is a single serialized event.
+type Message struct {
+	// Key is the id of the account the event belongs to.
+	Key     string
+	Payload []byte
+}
+
+// Publisher sends messages to a topic of a message broker.
+type Publisher interface {
+	Publish(topic string, messages []Message) error
+	Close() error
+}
+
+// NewPublisher creates a publisher for the broker with the given URL. Both
+// kafka:// and nats:// URLs are supported.
+func NewPublisher(brokerURL string) (Publisher, error) {
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return nil, fmt.Errorf("eventsink: error parsing url: %w", err)
+	}
+	switch u.Scheme {
+	case "kafka":
+		client, err := kafka.New(brokerURL)
+		if err != nil {
+			return nil, fmt.Errorf("eventsink: error creating kafka client: %w", err)
+		}
+		return &kafkaPublisher{client: client}, nil
+	case "nats":
+		client, err := nats.New(brokerURL)
+		if err != nil {
+			return nil, fmt.Errorf("eventsink: error creating nats client: %w", err)
+		}
+		return &natsPublisher{client: client}, nil
+	default:
+		return nil, fmt.Errorf("eventsink: unsupported scheme %s", u.Scheme)
+	}
+}
+
+// kafkaPublisher uses the account id as the key of each message, so all
+// events of an account end up in the same partition.
+type kafkaPublisher struct {
+	client *kafka.Client
+}
+
+func (k *kafkaPublisher) Publish(topic string, messages []Message) error {
+	kafkaMessages := make([]kafka.Message, len(messages))
+	for i, msg := range messages {
+		kafkaMessages[i] = kafka.Message{Key: []byte(msg.Key), Value: msg.Payload}
+	}
+	return k.client.Produce(topic, kafkaMessages...)
+}
+
+func (k *kafkaPublisher) Close() error {
+	return k.client.Close()
+}
+
+// natsPublisher appends the account id to the subject of each message, so
+// subscribers can choose to receive the events of a single account only.
+type natsPublisher struct {
+	client *nats.Client
+}
+
+func (n *natsPublisher) Publish(topic string, messages []Message) error {
+	for _, msg := range messages {
+		if err := n.client.Publish(topic+"."+msg.Key, msg.Payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *natsPublisher) Close() error {
+	return n.client.Close()
+}
+
+// Sink queues events and forwards them using a publisher.
+type Sink struct {
+	publisher   Publisher
+	topic       string
+	queue       chan persistence.EventResult
+	batchSize   int
+	maxAttempts int
+	backoff     time.Duration
+	forwarded   *metrics.Counter
+	dropped     *metrics.Counter
+}
+
+// Config adds a configuration value to the sink.
+type Config func(*Sink)
+
+// WithQueueSize sets the number of events that are queued before new events
+// are dropped.
+func WithQueueSize(n int) Config {
+	return func(s *Sink) {
+		if n > 0 {
+			s.queue = make(chan persistence.EventResult, n)
+		}
+	}
+}
+
+// WithMetrics sets the registry used for counting forwarded and dropped
+// events.
+func WithMetrics(m *metrics.Registry) Config {
+	return func(s *Sink) {
+		s.forwarded = m.Counter(
+			"offen_eventsink_forwarded_events_total",
+			"Number of events that have been forwarded to the message broker.",
+		)
+		s.dropped = m.Counter(
+			"offen_eventsink_dropped_events_total",
+			"Number of events that have been dropped instead of being forwarded to the message broker.",
+			"reason",
+		)
+	}
+}
+
+// New creates a Sink that forwards events to the given topic.
+func New(publisher Publisher, topic string, configs ...Config) *Sink {
+	s := &Sink{
+		publisher:   publisher,
+		topic:       topic,
+		queue:       make(chan persistence.EventResult, 1024),
+		batchSize:   100,
+		maxAttempts: 5,
+		backoff:     time.Second,
+	}
+	for _, cfg := range configs {
+		cfg(s)
+	}
+	return s
+}
+
+// Publish queues the given event for forwarding. It never blocks, so it
+// can be used as an insert listener.
+func (s *Sink) Publish(evt persistence.EventResult) {
+	select {
+	case s.queue <- evt:
+	default:
+		s.dropped.Inc("queue_full")
+	}
+}
+
+// Run forwards queued events until the context is cancelled. Events that are
+// still queued at this point are forwarded before returning.
+func (s *Sink) Run(ctx context.Context, onError func(error)) {
+	defer s.publisher.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				batch := s.collect(nil)
+				if len(batch) == 0 {
+					return
+				}
+				if err := s.forward(context.Background(), batch, 1); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		case evt := <-s.queue:
+			if err := s.forward(ctx, s.collect([]persistence.EventResult{evt}), s.maxAttempts); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// collect appends all events that are currently queued to the given batch
+// until the batch is full.
+func (s *Sink) collect(batch []persistence.EventResult) []persistence.EventResult {
+	for len(batch) < s.batchSize {
+		select {
+		case evt := <-s.queue:
+			batch = append(batch, evt)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (s *Sink) forward(ctx context.Context, batch []persistence.EventResult, attempts int) error {
+	messages := make([]Message, len(batch))
+	for i, evt := range batch {
+		payload, err := json.Marshal(evt)
+		if err != nil {
+			s.dropped.Add(float64(len(batch)), "error")
+			return fmt.Errorf("eventsink: error serializing event: %w", err)
+		}
+		messages[i] = Message{Key: evt.AccountID, Payload: payload}
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = s.publisher.Publish(s.topic, messages); err == nil {
+			s.forwarded.Add(float64(len(messages)))
+			return nil
+		}
+		if attempt >= attempts || !sleep(ctx, s.backoff*time.Duration(attempt)) {
+			break
+		}
+	}
+	s.dropped.Add(float64(len(messages)), "error")
+	return fmt.Errorf("eventsink: error forwarding %d events, dropping them: %w", len(messages), err)
+}
+
+// sleep waits for the given duration and returns false in case the context
+// has been cancelled before.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
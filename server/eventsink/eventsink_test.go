@@ -0,0 +1,135 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package eventsink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/metrics"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockPublisher struct {
+	mu        sync.Mutex
+	failures  int
+	published []Message
+	topics    []string
+	closed    bool
+}
+
+func (m *mockPublisher) Publish(topic string, messages []Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("did not work")
+	}
+	m.topics = append(m.topics, topic)
+	m.published = append(m.published, messages...)
+	return nil
+}
+
+func (m *mockPublisher) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+func TestSink(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		p := &mockPublisher{failures: 1}
+		s := New(p, "offen.events")
+		s.backoff = time.Millisecond
+
+		s.Publish(persistence.EventResult{AccountID: "account-a", EventID: "event-a", Payload: "encrypted-a"})
+		s.Publish(persistence.EventResult{AccountID: "account-b", EventID: "event-b", Payload: "encrypted-b"})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			s.Run(ctx, func(err error) {
+				t.Errorf("Unexpected error %v", err)
+			})
+			close(done)
+		}()
+		time.Sleep(time.Millisecond * 50)
+		cancel()
+		<-done
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if len(p.published) != 2 || !p.closed {
+			t.Fatalf("Unexpected publisher state %v", p)
+		}
+		if p.published[0].Key != "account-a" || !strings.Contains(string(p.published[0].Payload), `"payload":"encrypted-a"`) {
+			t.Errorf("Unexpected message %v", p.published[0])
+		}
+		if p.topics[0] != "offen.events" {
+			t.Errorf("Unexpected topic %v", p.topics[0])
+		}
+	})
+	t.Run("dropped", func(t *testing.T) {
+		registry := metrics.New()
+		p := &mockPublisher{failures: 10}
+		s := New(p, "offen.events", WithQueueSize(1), WithMetrics(registry))
+		s.backoff = time.Millisecond
+		s.maxAttempts = 2
+
+		s.Publish(persistence.EventResult{AccountID: "account-a", EventID: "event-a"})
+		s.Publish(persistence.EventResult{AccountID: "account-a", EventID: "event-b"})
+
+		var errs []error
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			s.Run(ctx, func(err error) {
+				errs = append(errs, err)
+			})
+			close(done)
+		}()
+		time.Sleep(time.Millisecond * 50)
+		cancel()
+		<-done
+
+		if len(errs) != 1 {
+			t.Errorf("Unexpected errors %v", errs)
+		}
+		if p.failures != 8 {
+			t.Errorf("Expected 2 attempts, got %d", 10-p.failures)
+		}
+		var b bytes.Buffer
+		registry.WriteTo(&b)
+		for _, expected := range []string{
+			`offen_eventsink_dropped_events_total{reason="queue_full"} 1`,
+			`offen_eventsink_dropped_events_total{reason="error"} 1`,
+		} {
+			if !strings.Contains(b.String(), expected) {
+				t.Errorf("Expected metrics to contain %s, got %s", expected, b.String())
+			}
+		}
+	})
+}
+
+func TestNewPublisher(t *testing.T) {
+	if p, err := NewPublisher("kafka://localhost:9092"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	} else if _, ok := p.(*kafkaPublisher); !ok {
+		t.Errorf("Unexpected publisher %T", p)
+	}
+	if p, err := NewPublisher("nats://localhost"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	} else if _, ok := p.(*natsPublisher); !ok {
+		t.Errorf("Unexpected publisher %T", p)
+	}
+	if _, err := NewPublisher("amqp://localhost"); err == nil {
+		t.Error("Expected error for unsupported scheme")
+	}
+}
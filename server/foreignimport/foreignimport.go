@@ -0,0 +1,210 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package foreignimport converts data exported from other analytics tools
+// into Offen events, so history is not lost when switching to Offen.
+//
+// Other tools only export aggregated numbers, so the importer creates a
+// synthetic user for each visitor of a day and distributes the pageviews of
+// each page across these users. As events are usually encrypted by the
+// client, the importer creates the secrets of these users itself and
+// encrypts them using the public key of the account, the same way a client
+// would. Each imported event carries a `migratedFrom` field naming the tool
+// it has been imported from.
+package foreignimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/persistence"
+)
+
+// Database is the subset of persistence.Service needed for importing.
+type Database interface {
+	GetAccount(accountID string, styles, events bool, eventsSince string) (persistence.AccountResult, error)
+	AssociateUserSecret(accountID, userID, encryptedUserSecret string) error
+	InsertBatch(userID string, events []persistence.BatchEvent) ([]error, error)
+}
+
+// Result summarizes an import.
+type Result struct {
+	Users  int `json:"users"`
+	Events int `json:"events"`
+}
+
+// event is the payload of an imported pageview. It mirrors the events
+// created by the script, leaving out all values that are unknown.
+type event struct {
+	Type         string    `json:"type"`
+	Href         string    `json:"href"`
+	Referrer     string    `json:"referrer"`
+	Timestamp    time.Time `json:"timestamp"`
+	SessionID    string    `json:"sessionId"`
+	MigratedFrom string    `json:"migratedFrom"`
+}
+
+type user struct {
+	userID    string
+	key       []byte
+	jwk       []byte
+	sessionID string
+	events    []persistence.BatchEvent
+}
+
+// Import creates events for the given rows in the given account. Pages that
+// are given as paths are resolved against root.
+//
+// The visitors of a single day are shared across all pages visited that
+// day, so the number of visitors per day is the maximum number of visitors
+// of a single page. Users are not shared across days, so imported data does
+// not contain any returning visitors.
+//
+// Pages are resolved before writing any data, so an ErrInvalidExport is
+// returned without importing anything.
+func Import(db Database, accountID, root, source string, rows []Row) (Result, error) {
+	var result Result
+	resolved := make([]Row, len(rows))
+	for i, row := range rows {
+		target, err := href(root, row.Page)
+		if err != nil {
+			return result, err
+		}
+		row.Page = target
+		resolved[i] = row
+	}
+
+	account, err := db.GetAccount(accountID, false, false, "")
+	if err != nil {
+		return result, fmt.Errorf("foreignimport: error looking up account: %w", err)
+	}
+
+	byDay := map[time.Time][]Row{}
+	var days []time.Time
+	for _, row := range resolved {
+		day := time.Date(row.Date.Year(), row.Date.Month(), row.Date.Day(), 0, 0, 0, 0, time.UTC)
+		if _, ok := byDay[day]; !ok {
+			days = append(days, day)
+		}
+		byDay[day] = append(byDay[day], row)
+	}
+
+	for _, day := range days {
+		users, err := eventsForDay(accountID, day, byDay[day], source)
+		if err != nil {
+			return result, err
+		}
+		for _, u := range users {
+			if err := createUser(db, account, u); err != nil {
+				return result, err
+			}
+			result.Users++
+			errs, err := db.InsertBatch(u.userID, u.events)
+			if err != nil {
+				return result, fmt.Errorf("foreignimport: error inserting events: %w", err)
+			}
+			for _, err := range errs {
+				if err != nil {
+					return result, fmt.Errorf("foreignimport: error inserting event: %w", err)
+				}
+				result.Events++
+			}
+		}
+	}
+	return result, nil
+}
+
+// eventsForDay creates the users visiting on the given day and assigns
+// their pageviews. Pageviews are spread evenly across the day in the order
+// they have been given.
+func eventsForDay(accountID string, day time.Time, rows []Row, source string) ([]*user, error) {
+	var users []*user
+	var total int
+	for _, row := range rows {
+		if row.Pageviews > 0 {
+			total += row.Pageviews
+		}
+	}
+	if total == 0 {
+		return nil, nil
+	}
+	interval := time.Hour * 24 / time.Duration(total)
+
+	var n int
+	for _, row := range rows {
+		if row.Pageviews <= 0 {
+			continue
+		}
+		visitors := row.Visitors
+		if visitors < 1 {
+			visitors = 1
+		}
+		if visitors > row.Pageviews {
+			visitors = row.Pageviews
+		}
+		for len(users) < visitors {
+			u, err := newUser()
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, u)
+		}
+		for i := 0; i < row.Pageviews; i++ {
+			u := users[i%visitors]
+			timestamp := day.Add(interval * time.Duration(n))
+			n++
+			b, err := json.Marshal(event{
+				Type:         "PAGEVIEW",
+				Href:         row.Page,
+				Timestamp:    timestamp,
+				SessionID:    u.sessionID,
+				MigratedFrom: source,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("foreignimport: error marshaling event: %w", err)
+			}
+			encrypted, err := keys.EncryptWith(u.key, b)
+			if err != nil {
+				return nil, fmt.Errorf("foreignimport: error encrypting event: %w", err)
+			}
+			u.events = append(u.events, persistence.BatchEvent{
+				AccountID:  accountID,
+				Payload:    encrypted.Marshal(),
+				RecordedAt: timestamp,
+			})
+		}
+	}
+	return users, nil
+}
+
+func newUser() (*user, error) {
+	userID, err := uuid.NewV4()
+	if err != nil {
+		return nil, fmt.Errorf("foreignimport: error creating user id: %w", err)
+	}
+	sessionID, err := uuid.NewV4()
+	if err != nil {
+		return nil, fmt.Errorf("foreignimport: error creating session id: %w", err)
+	}
+	key, jwk, err := keys.GenerateUserSecret()
+	if err != nil {
+		return nil, fmt.Errorf("foreignimport: error creating user key: %w", err)
+	}
+	return &user{userID: userID.String(), key: key, jwk: jwk, sessionID: sessionID.String()}, nil
+}
+
+// createUser stores the secret of the given user, encrypted using the public
+// key of the account.
+func createUser(db Database, account persistence.AccountResult, u *user) error {
+	encryptedSecret, err := keys.EncryptAsymmetricWith(account.PublicKey, u.jwk)
+	if err != nil {
+		return fmt.Errorf("foreignimport: error encrypting user secret: %w", err)
+	}
+	if err := db.AssociateUserSecret(account.AccountID, u.userID, encryptedSecret.Marshal()); err != nil {
+		return fmt.Errorf("foreignimport: error associating user secret: %w", err)
+	}
+	return nil
+}
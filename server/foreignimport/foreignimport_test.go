@@ -0,0 +1,112 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package foreignimport
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockDatabase struct {
+	Database
+	publicKey jwk.Key
+	secrets   map[string]string
+	inserted  map[string][]persistence.BatchEvent
+}
+
+func (m *mockDatabase) GetAccount(accountID string, styles, events bool, eventsSince string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{AccountID: accountID, PublicKey: m.publicKey}, nil
+}
+
+func (m *mockDatabase) AssociateUserSecret(accountID, userID, encryptedUserSecret string) error {
+	m.secrets[userID] = encryptedUserSecret
+	return nil
+}
+
+func (m *mockDatabase) InsertBatch(userID string, events []persistence.BatchEvent) ([]error, error) {
+	m.inserted[userID] = append(m.inserted[userID], events...)
+	return make([]error, len(events)), nil
+}
+
+func TestImport(t *testing.T) {
+	publicKey, _, err := keys.GenerateRSAKeypair(2048)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	set, _ := jwk.ParseString(string(publicKey))
+	key, _ := set.Get(0)
+	db := &mockDatabase{
+		publicKey: key,
+		secrets:   map[string]string{},
+		inserted:  map[string][]persistence.BatchEvent{},
+	}
+
+	day := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	result, err := Import(db, "account-a", "https://www.example.net", SourcePlausible, []Row{
+		{Date: day, Page: "/", Visitors: 2, Pageviews: 3},
+		{Date: day, Page: "/about", Visitors: 1, Pageviews: 1},
+		{Date: day.Add(time.Hour * 24), Page: "/", Visitors: 5, Pageviews: 1},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if result.Users != 3 || result.Events != 5 {
+		t.Errorf("Unexpected result %v", result)
+	}
+	if len(db.secrets) != 3 || len(db.inserted) != 3 {
+		t.Errorf("Unexpected database state %v", db)
+	}
+	for _, events := range db.inserted {
+		for _, evt := range events {
+			if evt.AccountID != "account-a" || evt.RecordedAt.Before(day) || evt.RecordedAt.After(day.Add(time.Hour*48)) {
+				t.Errorf("Unexpected event %v", evt)
+			}
+		}
+	}
+
+	_, err = Import(db, "account-a", "", SourcePlausible, []Row{
+		{Date: day, Page: "https://www.example.net/", Visitors: 1, Pageviews: 1},
+		{Date: day, Page: "/about", Visitors: 1, Pageviews: 1},
+	})
+	var invalidErr ErrInvalidExport
+	if !errors.As(err, &invalidErr) {
+		t.Errorf("Expected invalid export error, got %v", err)
+	}
+	if len(db.secrets) != 3 {
+		t.Errorf("Expected no data to be written for invalid export, got %d secrets", len(db.secrets))
+	}
+}
+
+func TestEventsForDay(t *testing.T) {
+	day := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	users, err := eventsForDay("account-a", day, []Row{
+		{Date: day, Page: "https://www.example.net/", Visitors: 2, Pageviews: 3},
+		{Date: day, Page: "https://www.example.net/about", Visitors: 0, Pageviews: 1},
+	}, SourceMatomo)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(users) != 2 || len(users[0].events) != 3 || len(users[1].events) != 1 {
+		t.Fatalf("Unexpected users %v", users)
+	}
+
+	b, err := keys.DecryptWith(users[0].key, users[0].events[2].Payload)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	var evt map[string]interface{}
+	json.Unmarshal(b, &evt)
+	if evt["type"] != "PAGEVIEW" || evt["href"] != "https://www.example.net/about" || evt["migratedFrom"] != "matomo" {
+		t.Errorf("Unexpected event %v", evt)
+	}
+	if evt["timestamp"] != "2022-04-01T18:00:00Z" || !users[0].events[2].RecordedAt.Equal(day.Add(time.Hour*18)) {
+		t.Errorf("Unexpected timestamp %v", evt["timestamp"])
+	}
+}
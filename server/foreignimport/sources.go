@@ -0,0 +1,290 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package foreignimport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The tools exports can be read from.
+const (
+	SourceGoAccess  = "goaccess"
+	SourceMatomo    = "matomo"
+	SourcePlausible = "plausible"
+)
+
+// ErrInvalidExport is returned by Import when an export references pages
+// that cannot be resolved.
+type ErrInvalidExport string
+
+func (e ErrInvalidExport) Error() string {
+	return string(e)
+}
+
+// Row is the number of pageviews and visitors of a single page on a single
+// day.
+type Row struct {
+	Date time.Time
+	// Page is either an absolute URL or a path.
+	Page      string
+	Visitors  int
+	Pageviews int
+}
+
+// Parse reads the export of the given source. The following formats are
+// supported:
+//
+// - goaccess: the JSON report written using `goaccess -o report.json`
+// - matomo: the JSON response of `Actions.getPageUrls` using `period=day`
+// and `flat=1` for a range of dates
+// - plausible: the `imported_pages` CSV file contained in a CSV export
+func Parse(source string, r io.Reader) ([]Row, error) {
+	var rows []Row
+	var err error
+	switch source {
+	case SourceGoAccess:
+		rows, err = parseGoAccess(r)
+	case SourceMatomo:
+		rows, err = parseMatomo(r)
+	case SourcePlausible:
+		rows, err = parsePlausible(r)
+	default:
+		return nil, fmt.Errorf("foreignimport: unsupported source %q", source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("foreignimport: error parsing %s export: %w", source, err)
+	}
+	var result []Row
+	for _, row := range rows {
+		if row.Pageviews > 0 && row.Page != "" {
+			result = append(result, row)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Date.Before(result[j].Date)
+	})
+	return result, nil
+}
+
+func parsePlausible(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, required := range []string{"date", "page", "pageviews"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing column %s", required)
+		}
+	}
+	value := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading record: %w", err)
+		}
+		date, err := time.Parse("2006-01-02", value(record, "date"))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing date: %w", err)
+		}
+		pageviews, err := strconv.Atoi(value(record, "pageviews"))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing pageviews: %w", err)
+		}
+		var visitors int
+		if v := value(record, "visitors"); v != "" {
+			if visitors, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("error parsing visitors: %w", err)
+			}
+		}
+		page := value(record, "page")
+		if hostname := value(record, "hostname"); hostname != "" && strings.HasPrefix(page, "/") {
+			page = "https://" + hostname + page
+		}
+		rows = append(rows, Row{Date: date, Page: page, Visitors: visitors, Pageviews: pageviews})
+	}
+	return rows, nil
+}
+
+// flexInt is a number that might be encoded as a JSON number or string.
+type flexInt int
+
+func (f *flexInt) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*f = 0
+		return nil
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("error parsing number %s: %w", s, err)
+	}
+	*f = flexInt(n)
+	return nil
+}
+
+type matomoRow struct {
+	Label          string      `json:"label"`
+	URL            string      `json:"url"`
+	Hits           flexInt     `json:"nb_hits"`
+	Visits         flexInt     `json:"nb_visits"`
+	UniqueVisitors flexInt     `json:"nb_uniq_visitors"`
+	SubTable       interface{} `json:"idsubdatatable"`
+}
+
+func parseMatomo(r io.Reader) ([]Row, error) {
+	var byDate map[string][]matomoRow
+	if err := json.NewDecoder(r).Decode(&byDate); err != nil {
+		return nil, fmt.Errorf("error decoding report, make sure to request a range of days: %w", err)
+	}
+	var rows []Row
+	for day, items := range byDate {
+		date, err := time.Parse("2006-01-02", day)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing date: %w", err)
+		}
+		for _, item := range items {
+			// rows referencing a subtable aggregate all pages in a folder
+			// and would be counted twice
+			if item.SubTable != nil {
+				return nil, errors.New("report contains aggregated folders, make sure to pass flat=1")
+			}
+			page := item.URL
+			if page == "" {
+				page = "/" + strings.TrimPrefix(item.Label, "/")
+			}
+			visitors := int(item.UniqueVisitors)
+			if visitors == 0 {
+				visitors = int(item.Visits)
+			}
+			rows = append(rows, Row{Date: date, Page: page, Visitors: visitors, Pageviews: int(item.Hits)})
+		}
+	}
+	return rows, nil
+}
+
+type goAccessItem struct {
+	Data string `json:"data"`
+	Hits struct {
+		Count int `json:"count"`
+	} `json:"hits"`
+	Visitors struct {
+		Count int `json:"count"`
+	} `json:"visitors"`
+}
+
+type goAccessReport struct {
+	Visitors struct {
+		Data []goAccessItem `json:"data"`
+	} `json:"visitors"`
+	Requests struct {
+		Data []goAccessItem `json:"data"`
+	} `json:"requests"`
+}
+
+// parseGoAccess distributes the totals of each requested page across the
+// days of the report, weighted by the hits and visitors of each day, as
+// GoAccess does not report requests per day. The totals of each page are
+// kept, but the number of views of a page on a certain day is estimated.
+func parseGoAccess(r io.Reader) ([]Row, error) {
+	var report goAccessReport
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, fmt.Errorf("error decoding report: %w", err)
+	}
+	if len(report.Visitors.Data) == 0 || len(report.Requests.Data) == 0 {
+		return nil, errors.New("report does not contain visitors and requests")
+	}
+	dates := make([]time.Time, len(report.Visitors.Data))
+	hitsPerDay := make([]int, len(report.Visitors.Data))
+	visitorsPerDay := make([]int, len(report.Visitors.Data))
+	for i, day := range report.Visitors.Data {
+		date, err := time.Parse("20060102", day.Data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing date: %w", err)
+		}
+		dates[i] = date
+		hitsPerDay[i] = day.Hits.Count
+		visitorsPerDay[i] = day.Visitors.Count
+	}
+
+	var rows []Row
+	for _, request := range report.Requests.Data {
+		pageviews := apportion(request.Hits.Count, hitsPerDay)
+		visitors := apportion(request.Visitors.Count, visitorsPerDay)
+		for i, date := range dates {
+			rows = append(rows, Row{Date: date, Page: request.Data, Visitors: visitors[i], Pageviews: pageviews[i]})
+		}
+	}
+	return rows, nil
+}
+
+// apportion splits total into parts proportional to the given weights using
+// the largest remainder method, so the parts always add up to total.
+func apportion(total int, weights []int) []int {
+	result := make([]int, len(weights))
+	var sum int
+	for _, w := range weights {
+		sum += w
+	}
+	if sum == 0 || total <= 0 {
+		return result
+	}
+	remainders := make([]int, len(weights))
+	assigned := 0
+	for i, w := range weights {
+		result[i] = total * w / sum
+		remainders[i] = total * w % sum
+		assigned += result[i]
+	}
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := 0; assigned < total; i++ {
+		result[order[i]]++
+		assigned++
+	}
+	return result
+}
+
+// href resolves the page of a row against the given root URL.
+func href(root, page string) (string, error) {
+	if u, err := url.Parse(page); err == nil && u.IsAbs() {
+		return page, nil
+	}
+	if root == "" {
+		return "", ErrInvalidExport(fmt.Sprintf("foreignimport: cannot resolve relative page %s without a root url", page))
+	}
+	base, err := url.Parse(root)
+	if err != nil || !base.IsAbs() {
+		return "", ErrInvalidExport(fmt.Sprintf("foreignimport: invalid root url %s", root))
+	}
+	return strings.TrimSuffix(root, "/") + "/" + strings.TrimPrefix(page, "/"), nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package foreignimport
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	day1 := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2022, 4, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		source         string
+		input          string
+		expectedResult []Row
+		expectError    bool
+	}{
+		{
+			"plausible",
+			SourcePlausible,
+			"date,hostname,page,visits,visitors,pageviews,exits,time_on_page\n" +
+				"2022-04-02,www.example.net,/about,3,2,4,1,30\n" +
+				"2022-04-01,www.example.net,/,10,8,12,5,120\n" +
+				"2022-04-01,www.example.net,/empty,0,0,0,0,0\n",
+			[]Row{
+				{Date: day1, Page: "https://www.example.net/", Visitors: 8, Pageviews: 12},
+				{Date: day2, Page: "https://www.example.net/about", Visitors: 2, Pageviews: 4},
+			},
+			false,
+		},
+		{
+			"plausible without dates",
+			SourcePlausible,
+			"name,visitors,pageviews\n/,1,2\n",
+			nil,
+			true,
+		},
+		{
+			"matomo",
+			SourceMatomo,
+			`{"2022-04-01":[{"label":"/blog/post","nb_visits":3,"nb_hits":"5","url":"https://www.example.net/blog/post"},{"label":"about","nb_visits":1,"nb_uniq_visitors":1,"nb_hits":1}],"2022-04-02":[]}`,
+			[]Row{
+				{Date: day1, Page: "https://www.example.net/blog/post", Visitors: 3, Pageviews: 5},
+				{Date: day1, Page: "/about", Visitors: 1, Pageviews: 1},
+			},
+			false,
+		},
+		{
+			"matomo with folders",
+			SourceMatomo,
+			`{"2022-04-01":[{"label":"blog","nb_visits":3,"nb_hits":5,"idsubdatatable":2}]}`,
+			nil,
+			true,
+		},
+		{
+			"goaccess",
+			SourceGoAccess,
+			`{"visitors":{"data":[{"hits":{"count":30},"visitors":{"count":4},"data":"20220401"},{"hits":{"count":10},"visitors":{"count":2},"data":"20220402"}]},` +
+				`"requests":{"data":[{"hits":{"count":8},"visitors":{"count":3},"data":"/"},{"hits":{"count":1},"visitors":{"count":1},"data":"/about"}]}}`,
+			[]Row{
+				{Date: day1, Page: "/", Visitors: 2, Pageviews: 6},
+				{Date: day1, Page: "/about", Visitors: 1, Pageviews: 1},
+				{Date: day2, Page: "/", Visitors: 1, Pageviews: 2},
+			},
+			false,
+		},
+		{
+			"unknown source",
+			"other",
+			"",
+			nil,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := Parse(test.source, strings.NewReader(test.input))
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if !reflect.DeepEqual(result, test.expectedResult) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestApportion(t *testing.T) {
+	tests := []struct {
+		total    int
+		weights  []int
+		expected []int
+	}{
+		{10, []int{1, 1}, []int{5, 5}},
+		{10, []int{1, 1, 1}, []int{4, 3, 3}},
+		{1, []int{1, 3}, []int{0, 1}},
+		{5, []int{0, 0}, []int{0, 0}},
+	}
+	for _, test := range tests {
+		if result := apportion(test.total, test.weights); !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Expected %v for %d and %v, got %v", test.expected, test.total, test.weights, result)
+		}
+	}
+}
+
+func TestHref(t *testing.T) {
+	if result, err := href("https://www.example.net/", "/about"); err != nil || result != "https://www.example.net/about" {
+		t.Errorf("Unexpected result %v, %v", result, err)
+	}
+	if result, err := href("", "https://www.example.net/blog"); err != nil || result != "https://www.example.net/blog" {
+		t.Errorf("Unexpected result %v, %v", result, err)
+	}
+	if _, err := href("", "/about"); err == nil {
+		t.Error("Expected error when resolving path without root")
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ingest
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages defined in ingest.proto are small enough to be encoded by
+// hand, which saves generating code and registering descriptors for them.
+// Unknown fields are skipped when decoding so that clients built against
+// a newer version of the definition keep working.
+
+// IngestRequest is a single event submitted for an account.
+type IngestRequest struct {
+	AccountID string
+	Payload   string
+	UserID    string
+}
+
+func (r *IngestRequest) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, r.AccountID)
+	b = appendString(b, 2, r.Payload)
+	b = appendString(b, 3, r.UserID)
+	return b
+}
+
+func (r *IngestRequest) unmarshal(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeString(b, &r.AccountID)
+		case num == 2 && typ == protowire.BytesType:
+			return consumeString(b, &r.Payload)
+		case num == 3 && typ == protowire.BytesType:
+			return consumeString(b, &r.UserID)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// IngestResponse acknowledges an ingested event.
+type IngestResponse struct {
+	Ack bool
+}
+
+func (r *IngestResponse) marshal() []byte {
+	var b []byte
+	if r.Ack {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(r.Ack))
+	}
+	return b
+}
+
+func (r *IngestResponse) unmarshal(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num == 1 && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			r.Ack = protowire.DecodeBool(v)
+			return n, nil
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	// proto3 does not encode fields that have their default value
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func consumeString(b []byte, target *string) (int, error) {
+	v, n := protowire.ConsumeString(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*target = v
+	return n, nil
+}
+
+func skipField(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+	n := protowire.ConsumeFieldValue(num, typ, b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	return n, nil
+}
+
+// consumeFields calls field for each field contained in b. field is
+// expected to return the number of bytes it has consumed.
+func consumeFields(b []byte, field func(protowire.Number, protowire.Type, []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("ingest: error decoding tag: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+		n, err := field(num, typ, b)
+		if err != nil {
+			return fmt.Errorf("ingest: error decoding field %d: %w", num, err)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+type message interface {
+	marshal() []byte
+	unmarshal([]byte) error
+}
+
+// codec encodes the messages of this package using the protobuf wire
+// format. It is forced on the server, so that regular protobuf clients
+// can talk to it without any further configuration.
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("ingest: cannot marshal value of type %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("ingest: cannot unmarshal into value of type %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func (codec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,164 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package ingest implements a gRPC service for submitting events from
+// backend services and native applications. In contrast to the HTTP API,
+// it does not rely on cookies or the browser based consent flow, but
+// authenticates callers using API tokens that have been granted the
+// write-events scope.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Service handles calls to the Ingestion service defined in ingest.proto.
+type Service struct {
+	DB      persistence.Service
+	Limiter ratelimiter.Throttler
+	Limit   ratelimiter.Limit
+	// OnIngest is called after an event has been persisted. It can be used
+	// for collecting metrics.
+	OnIngest func(accountID string)
+}
+
+// Register adds the service to the given server. The server is expected to
+// be created using the options returned by ServerOptions.
+func (s *Service) Register(srv *grpc.Server) {
+	srv.RegisterService(&serviceDesc, s)
+}
+
+// ServerOptions returns the options needed for creating a server that is
+// able to handle the messages used by this service.
+func ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{grpc.ForceServerCodec(codec{})}
+}
+
+// Ingest persists a single event, mirroring POST /api/events.
+func (s *Service) Ingest(ctx context.Context, req *IngestRequest) (*IngestResponse, error) {
+	if req.AccountID == "" || req.Payload == "" {
+		return nil, status.Error(codes.InvalidArgument, "ingest: account id and payload are required")
+	}
+
+	token, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token.AccountID != req.AccountID {
+		return nil, status.Errorf(codes.PermissionDenied, "ingest: api token %s cannot write events for account %s", token.TokenID, req.AccountID)
+	}
+
+	if s.Limiter != nil {
+		if l := <-s.Limiter.Throttle(s.Limit, fmt.Sprintf("ingest-%s", token.TokenID)); l.Error != nil {
+			return nil, status.Errorf(codes.ResourceExhausted, "ingest: error rate limiting request: %v", l.Error)
+		}
+	}
+
+	if err := s.DB.Insert(req.UserID, req.AccountID, "", req.Payload, nil); err != nil {
+		var unknownAccountErr persistence.ErrUnknownAccount
+		if errors.As(err, &unknownAccountErr) {
+			return nil, status.Errorf(codes.NotFound, "ingest: error inserting event: %v", unknownAccountErr)
+		}
+		var unknownSecretErr persistence.ErrUnknownSecret
+		if errors.As(err, &unknownSecretErr) {
+			return nil, status.Errorf(codes.InvalidArgument, "ingest: error inserting event: %v", unknownSecretErr)
+		}
+		var disabledErr persistence.ErrAccountDisabled
+		if errors.As(err, &disabledErr) {
+			return nil, status.Errorf(codes.PermissionDenied, "ingest: error inserting event: %v", disabledErr)
+		}
+		var quotaErr persistence.ErrQuotaExceeded
+		if errors.As(err, &quotaErr) {
+			return nil, status.Errorf(codes.ResourceExhausted, "ingest: error inserting event: %v", quotaErr)
+		}
+		return nil, status.Errorf(codes.Internal, "ingest: error persisting event: %v", err)
+	}
+
+	if s.OnIngest != nil {
+		s.OnIngest(req.AccountID)
+	}
+	return &IngestResponse{Ack: true}, nil
+}
+
+// authenticate looks up the API token passed in the authorization metadata
+// of the given context.
+func (s *Service) authenticate(ctx context.Context) (persistence.APITokenResult, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var value string
+	for _, header := range md.Get("authorization") {
+		if strings.HasPrefix(header, "Bearer ") {
+			value = strings.TrimPrefix(header, "Bearer ")
+			break
+		}
+	}
+	if value == "" {
+		return persistence.APITokenResult{}, status.Error(codes.Unauthenticated, "ingest: no api token given")
+	}
+
+	token, err := s.DB.LookupAPIToken(value)
+	if err != nil {
+		return persistence.APITokenResult{}, status.Errorf(codes.Unauthenticated, "ingest: error looking up api token: %v", err)
+	}
+	if !token.HasScope(persistence.APITokenScopeWriteEvents) {
+		return persistence.APITokenResult{}, status.Errorf(
+			codes.PermissionDenied, "ingest: api token %s has not been granted scope %s", token.TokenID, persistence.APITokenScopeWriteEvents,
+		)
+	}
+
+	// tokens act on behalf of their creator, so they are invalidated
+	// when the creator loses access to the account
+	creator, err := s.DB.LookupAccountUser(token.AccountUserID)
+	if err != nil || !creator.CanAccessAccount(token.AccountID) {
+		return persistence.APITokenResult{}, status.Errorf(
+			codes.Unauthenticated, "ingest: creator of api token %s cannot access account %s anymore", token.TokenID, token.AccountID,
+		)
+	}
+	return token, nil
+}
+
+type ingestionServer interface {
+	Ingest(context.Context, *IngestRequest) (*IngestResponse, error)
+}
+
+func ingestHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IngestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ingestionServer).Ingest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/offen.ingest.v1.Ingestion/Ingest",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ingestionServer).Ingest(ctx, req.(*IngestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// serviceDesc is the equivalent of what protoc-gen-go-grpc would create
+// for the Ingestion service.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "offen.ingest.v1.Ingestion",
+	HandlerType: (*ingestionServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Ingest",
+			Handler:    ingestHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "ingest.proto",
+}
@@ -0,0 +1,221 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ingest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/offen/offen/server/persistence"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type mockIngestDatabase struct {
+	persistence.Service
+	token       persistence.APITokenResult
+	lookupErr   error
+	accountUser persistence.LoginResult
+	insertErr   error
+	inserted    []string
+}
+
+func (m *mockIngestDatabase) LookupAPIToken(token string) (persistence.APITokenResult, error) {
+	if token != "offen_abc" {
+		return persistence.APITokenResult{}, persistence.ErrUnknownAPIToken("unknown")
+	}
+	return m.token, m.lookupErr
+}
+
+func (m *mockIngestDatabase) LookupAccountUser(accountUserID string) (persistence.LoginResult, error) {
+	return m.accountUser, nil
+}
+
+func (m *mockIngestDatabase) Insert(userID, accountID, eventType, payload string, eventID *string) error {
+	m.inserted = append(m.inserted, userID, accountID, payload)
+	return m.insertErr
+}
+
+func TestService_Ingest(t *testing.T) {
+	validToken := persistence.APITokenResult{
+		TokenID:       "token-a",
+		AccountID:     "account-a",
+		AccountUserID: "user-a",
+		Scopes:        []string{persistence.APITokenScopeWriteEvents},
+	}
+	validUser := persistence.LoginResult{
+		AccountUserID: "user-a",
+		Accounts:      []persistence.LoginAccountResult{{AccountID: "account-a"}},
+	}
+	tests := []struct {
+		name             string
+		db               *mockIngestDatabase
+		authorization    string
+		req              *IngestRequest
+		expectedCode     codes.Code
+		expectedInserted []string
+	}{
+		{
+			"missing payload",
+			&mockIngestDatabase{token: validToken, accountUser: validUser},
+			"Bearer offen_abc",
+			&IngestRequest{AccountID: "account-a"},
+			codes.InvalidArgument,
+			nil,
+		},
+		{
+			"no token",
+			&mockIngestDatabase{token: validToken, accountUser: validUser},
+			"",
+			&IngestRequest{AccountID: "account-a", Payload: "payload"},
+			codes.Unauthenticated,
+			nil,
+		},
+		{
+			"unknown token",
+			&mockIngestDatabase{token: validToken, accountUser: validUser},
+			"Bearer offen_xyz",
+			&IngestRequest{AccountID: "account-a", Payload: "payload"},
+			codes.Unauthenticated,
+			nil,
+		},
+		{
+			"missing scope",
+			&mockIngestDatabase{
+				token: persistence.APITokenResult{
+					TokenID:       "token-a",
+					AccountID:     "account-a",
+					AccountUserID: "user-a",
+					Scopes:        []string{persistence.APITokenScopeReadStats},
+				},
+				accountUser: validUser,
+			},
+			"Bearer offen_abc",
+			&IngestRequest{AccountID: "account-a", Payload: "payload"},
+			codes.PermissionDenied,
+			nil,
+		},
+		{
+			"creator lost access",
+			&mockIngestDatabase{token: validToken, accountUser: persistence.LoginResult{AccountUserID: "user-a"}},
+			"Bearer offen_abc",
+			&IngestRequest{AccountID: "account-a", Payload: "payload"},
+			codes.Unauthenticated,
+			nil,
+		},
+		{
+			"account mismatch",
+			&mockIngestDatabase{token: validToken, accountUser: validUser},
+			"Bearer offen_abc",
+			&IngestRequest{AccountID: "account-b", Payload: "payload"},
+			codes.PermissionDenied,
+			nil,
+		},
+		{
+			"unknown secret",
+			&mockIngestDatabase{token: validToken, accountUser: validUser, insertErr: persistence.ErrUnknownSecret("unknown")},
+			"Bearer offen_abc",
+			&IngestRequest{AccountID: "account-a", Payload: "payload", UserID: "user-z"},
+			codes.InvalidArgument,
+			[]string{"user-z", "account-a", "payload"},
+		},
+		{
+			"database error",
+			&mockIngestDatabase{token: validToken, accountUser: validUser, insertErr: errors.New("did not work")},
+			"Bearer offen_abc",
+			&IngestRequest{AccountID: "account-a", Payload: "payload"},
+			codes.Internal,
+			[]string{"", "account-a", "payload"},
+		},
+		{
+			"ok",
+			&mockIngestDatabase{token: validToken, accountUser: validUser},
+			"Bearer offen_abc",
+			&IngestRequest{AccountID: "account-a", Payload: "payload", UserID: "user-z"},
+			codes.OK,
+			[]string{"user-z", "account-a", "payload"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ingested []string
+			s := &Service{
+				DB: test.db,
+				OnIngest: func(accountID string) {
+					ingested = append(ingested, accountID)
+				},
+			}
+			ctx := context.Background()
+			if test.authorization != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", test.authorization))
+			}
+			res, err := s.Ingest(ctx, test.req)
+			if code := status.Code(err); code != test.expectedCode {
+				t.Errorf("Unexpected status code %v", code)
+			}
+			if !reflect.DeepEqual(test.expectedInserted, test.db.inserted) {
+				t.Errorf("Unexpected inserted values %v", test.db.inserted)
+			}
+			if test.expectedCode == codes.OK {
+				if !res.Ack || len(ingested) != 1 {
+					t.Errorf("Unexpected result %v and ingested accounts %v", res, ingested)
+				}
+			} else if len(ingested) != 0 {
+				t.Errorf("Unexpected ingested accounts %v", ingested)
+			}
+		})
+	}
+}
+
+func TestCodec(t *testing.T) {
+	t.Run("request", func(t *testing.T) {
+		in := &IngestRequest{AccountID: "account-a", Payload: "payload", UserID: "user-a"}
+		b, err := codec{}.Marshal(in)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		out := &IngestRequest{}
+		if err := (codec{}).Unmarshal(b, out); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("Unexpected result %v", out)
+		}
+	})
+	t.Run("response", func(t *testing.T) {
+		b, err := codec{}.Marshal(&IngestResponse{Ack: true})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		out := &IngestResponse{}
+		if err := (codec{}).Unmarshal(b, out); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !out.Ack {
+			t.Errorf("Unexpected result %v", out)
+		}
+	})
+	t.Run("unknown fields", func(t *testing.T) {
+		// field 1 of type string, followed by an unknown varint field 9
+		b := []byte{0x0a, 0x01, 'a', 0x48, 0x01}
+		out := &IngestRequest{}
+		if err := (codec{}).Unmarshal(b, out); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if out.AccountID != "a" {
+			t.Errorf("Unexpected result %v", out)
+		}
+	})
+	t.Run("bad input", func(t *testing.T) {
+		if err := (codec{}).Unmarshal([]byte{0x0a, 0x05, 'a'}, &IngestRequest{}); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if _, err := (codec{}).Marshal("zomfg"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
@@ -0,0 +1,317 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package kafka is a minimal client for producing messages to a Kafka
+// cluster. It speaks the binary Kafka protocol over plain TCP connections and
+// does not support consuming messages, TLS or SASL authentication.
+package kafka
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error is an error code returned by a Kafka broker.
+type Error int16
+
+func (e Error) Error() string {
+	return fmt.Sprintf("kafka: broker responded with error code %d", int16(e))
+}
+
+type partition struct {
+	id     int32
+	leader int32
+}
+
+// Client produces messages to topics of a Kafka cluster. Partition leaders
+// are looked up using the configured bootstrap brokers. Connections are
+// kept open and reestablished after failures.
+type Client struct {
+	brokers  []string
+	clientID string
+	timeout  time.Duration
+	now      func() time.Time
+
+	mu            sync.Mutex
+	correlationID int32
+	nodes         map[int32]string
+	topics        map[string][]partition
+	conns         map[string]*conn
+	counter       uint32
+}
+
+// New creates a Client for the given URL of the form
+// kafka://host[:port][,host[:port]...]
+func New(kafkaURL string) (*Client, error) {
+	hosts, ok := strings.CutPrefix(kafkaURL, "kafka://")
+	if !ok {
+		return nil, fmt.Errorf("kafka: unsupported url %s", kafkaURL)
+	}
+	hosts = strings.TrimSuffix(hosts, "/")
+	c := &Client{
+		clientID: "offen",
+		timeout:  time.Second * 10,
+		now:      time.Now,
+		nodes:    map[int32]string{},
+		topics:   map[string][]partition{},
+		conns:    map[string]*conn{},
+	}
+	for _, host := range strings.Split(hosts, ",") {
+		if host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "9092")
+		}
+		c.brokers = append(c.brokers, host)
+	}
+	if len(c.brokers) == 0 {
+		return nil, errors.New("kafka: no brokers given")
+	}
+	return c, nil
+}
+
+// Produce sends the given messages to the given topic and returns after all
+// in-sync replicas have acknowledged them. Messages with the same key are
+// always sent to the same partition, messages without a key are
+// distributed evenly.
+//
+// In case an error is returned, some of the messages might have been
+// written nonetheless.
+func (c *Client) Produce(topic string, messages ...Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	partitions, err := c.partitions(topic)
+	if err != nil {
+		return err
+	}
+	byLeader := map[int32]map[int32][]Message{}
+	for _, msg := range messages {
+		p := partitions[c.partitionFor(msg.Key, len(partitions))]
+		if p.leader < 0 {
+			delete(c.topics, topic)
+			return fmt.Errorf("kafka: partition %d of topic %s has no leader", p.id, topic)
+		}
+		if byLeader[p.leader] == nil {
+			byLeader[p.leader] = map[int32][]Message{}
+		}
+		byLeader[p.leader][p.id] = append(byLeader[p.leader][p.id], msg)
+	}
+
+	for leader, byPartition := range byLeader {
+		if err := c.produce(leader, topic, byPartition); err != nil {
+			// leadership might have moved to another broker, so metadata is
+			// looked up again on the next call
+			delete(c.topics, topic)
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes all open connections.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, cn := range c.conns {
+		cn.Close()
+		delete(c.conns, addr)
+	}
+	return nil
+}
+
+func (c *Client) partitionFor(key []byte, n int) int {
+	if key == nil {
+		c.counter++
+		return int(c.counter % uint32(n))
+	}
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(n))
+}
+
+func (c *Client) produce(leader int32, topic string, byPartition map[int32][]Message) error {
+	addr, ok := c.nodes[leader]
+	if !ok {
+		return fmt.Errorf("kafka: unknown broker %d", leader)
+	}
+	timestamp := c.now().UnixMilli()
+
+	var req encoder
+	req.nullString()                           // transactional id
+	req.int16(-1)                              // acks from all in-sync replicas
+	req.int32(int32(c.timeout.Milliseconds())) // timeout
+	req.int32(1)
+	req.string(topic)
+	req.int32(int32(len(byPartition)))
+	for id, messages := range byPartition {
+		req.int32(id)
+		req.bytes(encodeRecordBatch(messages, timestamp))
+	}
+
+	res, err := c.roundTrip(addr, apiKeyProduce, apiVersionProduce, req.b)
+	if err != nil {
+		return err
+	}
+	d := &decoder{b: res}
+	for i, n := 0, d.arrayLength(); i < n; i++ {
+		d.string()
+		for j, m := 0, d.arrayLength(); j < m; j++ {
+			id := d.int32()
+			code := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if d.err == nil && code != 0 {
+				return fmt.Errorf("kafka: error producing to partition %d of topic %s: %w", id, topic, Error(code))
+			}
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf("kafka: error decoding produce response: %w", d.err)
+	}
+	return nil
+}
+
+// partitions returns the partitions of the given topic, looking them up
+// in case they are not known yet.
+func (c *Client) partitions(topic string) ([]partition, error) {
+	if partitions, ok := c.topics[topic]; ok {
+		return partitions, nil
+	}
+	var req encoder
+	req.int32(1)
+	req.string(topic)
+
+	var lastErr error
+	for _, addr := range c.brokers {
+		res, err := c.roundTrip(addr, apiKeyMetadata, apiVersionMetadata, req.b)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		partitions, err := c.decodeMetadata(topic, res)
+		if err != nil {
+			return nil, err
+		}
+		c.topics[topic] = partitions
+		return partitions, nil
+	}
+	return nil, fmt.Errorf("kafka: error looking up metadata for topic %s: %w", topic, lastErr)
+}
+
+func (c *Client) decodeMetadata(topic string, res []byte) ([]partition, error) {
+	d := &decoder{b: res}
+	for i, n := 0, d.arrayLength(); i < n; i++ {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		c.nodes[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller id
+
+	var partitions []partition
+	var topicErr int16
+	for i, n := 0, d.arrayLength(); i < n; i++ {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is internal
+		for j, m := 0, d.arrayLength(); j < m; j++ {
+			d.int16() // partition error code
+			p := partition{id: d.int32(), leader: d.int32()}
+			d.int32Array() // replicas
+			d.int32Array() // in-sync replicas
+			if name == topic {
+				partitions = append(partitions, p)
+			}
+		}
+		if name == topic {
+			topicErr = code
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("kafka: error decoding metadata response: %w", d.err)
+	}
+	if topicErr != 0 {
+		return nil, fmt.Errorf("kafka: error looking up metadata for topic %s: %w", topic, Error(topicErr))
+	}
+	if len(partitions) == 0 {
+		return nil, fmt.Errorf("kafka: topic %s has no partitions", topic)
+	}
+	// partitions are sorted by id so keys are always mapped to the same
+	// partition, no matter the order returned by the broker
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].id < partitions[j].id
+	})
+	return partitions, nil
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// roundTrip sends a request to the broker at the given address and returns
+// the body of the response.
+func (c *Client) roundTrip(addr string, apiKey, apiVersion int16, body []byte) ([]byte, error) {
+	cn, ok := c.conns[addr]
+	if !ok {
+		netConn, err := net.DialTimeout("tcp", addr, c.timeout)
+		if err != nil {
+			return nil, fmt.Errorf("kafka: error connecting to %s: %w", addr, err)
+		}
+		cn = &conn{Conn: netConn, r: bufio.NewReader(netConn)}
+		c.conns[addr] = cn
+	}
+	res, err := c.exchange(cn, apiKey, apiVersion, body)
+	if err != nil {
+		// the connection is in an unknown state, so it is discarded
+		cn.Close()
+		delete(c.conns, addr)
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *Client) exchange(cn *conn, apiKey, apiVersion int16, body []byte) ([]byte, error) {
+	c.correlationID++
+	correlationID := c.correlationID
+
+	var req encoder
+	req.int32(0) // size, set below
+	req.int16(apiKey)
+	req.int16(apiVersion)
+	req.int32(correlationID)
+	req.string(c.clientID)
+	req.b = append(req.b, body...)
+	binary.BigEndian.PutUint32(req.b, uint32(len(req.b)-4))
+
+	cn.SetDeadline(time.Now().Add(c.timeout * 2))
+	if _, err := cn.Write(req.b); err != nil {
+		return nil, fmt.Errorf("kafka: error writing request: %w", err)
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(cn.r, size[:]); err != nil {
+		return nil, fmt.Errorf("kafka: error reading response: %w", err)
+	}
+	res := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(cn.r, res); err != nil {
+		return nil, fmt.Errorf("kafka: error reading response: %w", err)
+	}
+	d := &decoder{b: res}
+	if id := d.int32(); d.err != nil || id != correlationID {
+		return nil, fmt.Errorf("kafka: unexpected correlation id %d in response", id)
+	}
+	return d.b, nil
+}
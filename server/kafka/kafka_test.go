@@ -0,0 +1,259 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package kafka
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBroker implements the Metadata and Produce requests of a single
+// Kafka broker for testing purposes.
+type fakeBroker struct {
+	listener   net.Listener
+	partitions int32
+	mu         sync.Mutex
+	produced   map[int32][]Message
+}
+
+func newFakeBroker(t *testing.T, partitions int32) *fakeBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	b := &fakeBroker{listener: l, partitions: partitions, produced: map[int32][]Message{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(r, req); err != nil {
+			return
+		}
+		d := &decoder{b: req}
+		apiKey := d.int16()
+		d.int16()
+		correlationID := d.int32()
+		d.string()
+
+		var res encoder
+		res.int32(0)
+		res.int32(correlationID)
+		switch apiKey {
+		case apiKeyMetadata:
+			d.arrayLength()
+			topic := d.string()
+			host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+			portNumber, _ := strconv.Atoi(port)
+			res.int32(1)
+			res.int32(7)
+			res.string(host)
+			res.int32(int32(portNumber))
+			res.nullString()
+			res.int32(7)
+			res.int32(1)
+			if topic == "missing" {
+				res.int16(3)
+				res.string(topic)
+				res.int8(0)
+				res.int32(0)
+				break
+			}
+			res.int16(0)
+			res.string(topic)
+			res.int8(0)
+			res.int32(b.partitions)
+			// partitions are returned in reverse order on purpose
+			for i := b.partitions - 1; i >= 0; i-- {
+				res.int16(0)
+				res.int32(i)
+				res.int32(7)
+				res.int32(1)
+				res.int32(7)
+				res.int32(1)
+				res.int32(7)
+			}
+		case apiKeyProduce:
+			d.string()
+			d.int16()
+			d.int32()
+			d.arrayLength()
+			topic := d.string()
+			res.int32(1)
+			res.string(topic)
+			n := d.arrayLength()
+			res.int32(int32(n))
+			for i := 0; i < n; i++ {
+				id := d.int32()
+				messages, err := decodeRecordBatch(d.bytes())
+				res.int32(id)
+				if err != nil {
+					res.int16(2)
+				} else {
+					res.int16(0)
+				}
+				res.int64(0)
+				res.int64(-1)
+				b.mu.Lock()
+				b.produced[id] = append(b.produced[id], messages...)
+				b.mu.Unlock()
+			}
+			res.int32(0)
+		}
+		binary.BigEndian.PutUint32(res.b, uint32(len(res.b)-4))
+		conn.Write(res.b)
+	}
+}
+
+func TestNew(t *testing.T) {
+	c, err := New("kafka://kafka-a,kafka-b:9093")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(c.brokers) != 2 || c.brokers[0] != "kafka-a:9092" || c.brokers[1] != "kafka-b:9093" {
+		t.Errorf("Unexpected brokers %v", c.brokers)
+	}
+	if _, err := New("nats://localhost"); err == nil {
+		t.Error("Expected error for unsupported scheme")
+	}
+	if _, err := New("kafka://"); err == nil {
+		t.Error("Expected error when no brokers are given")
+	}
+}
+
+func TestClient_Produce(t *testing.T) {
+	b := newFakeBroker(t, 3)
+	defer b.listener.Close()
+
+	c, err := New("kafka://" + b.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer c.Close()
+	c.now = func() time.Time { return time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC) }
+
+	if err := c.Produce(
+		"offen-events",
+		Message{Key: []byte("account-a"), Value: []byte("one")},
+		Message{Key: []byte("account-b"), Value: []byte("two")},
+		Message{Key: []byte("account-a"), Value: []byte("three")},
+	); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	b.mu.Lock()
+	total := 0
+	for _, messages := range b.produced {
+		total += len(messages)
+	}
+	partitionA := c.topics["offen-events"][c.partitionFor([]byte("account-a"), 3)].id
+	messagesA := b.produced[partitionA]
+	b.mu.Unlock()
+
+	if total != 3 {
+		t.Errorf("Expected 3 messages to be produced, got %d", total)
+	}
+	var valuesA []string
+	for _, msg := range messagesA {
+		if string(msg.Key) == "account-a" {
+			valuesA = append(valuesA, string(msg.Value))
+		}
+	}
+	if len(valuesA) != 2 || valuesA[0] != "one" || valuesA[1] != "three" {
+		t.Errorf("Expected messages of the same key to be produced to the same partition in order, got %v", valuesA)
+	}
+
+	err = c.Produce("missing", Message{Value: []byte("x")})
+	var kafkaErr Error
+	if !errors.As(err, &kafkaErr) || kafkaErr != 3 {
+		t.Errorf("Expected unknown topic error, got %v", err)
+	}
+}
+
+func TestRecordBatch(t *testing.T) {
+	messages := []Message{
+		{Key: []byte("key"), Value: []byte("value")},
+		{Value: []byte("no key")},
+	}
+	batch := encodeRecordBatch(messages, 1648814400000)
+	result, err := decodeRecordBatch(batch)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(result) != 2 || string(result[0].Key) != "key" || result[1].Key != nil || string(result[1].Value) != "no key" {
+		t.Errorf("Unexpected result %v", result)
+	}
+
+	batch[len(batch)-1] ^= 0xff
+	if _, err := decodeRecordBatch(batch); err == nil {
+		t.Error("Expected error for invalid checksum")
+	}
+}
+
+// decodeRecordBatch is the inverse of encodeRecordBatch.
+func decodeRecordBatch(b []byte) ([]Message, error) {
+	d := &decoder{b: b}
+	d.int64()
+	length := d.int32()
+	d.int32()
+	if magic := d.int8(); d.err == nil && magic != 2 {
+		return nil, errors.New("kafka: unsupported message format")
+	}
+	crc := uint32(d.int32())
+	if d.err != nil {
+		return nil, d.err
+	}
+	if int(length) != len(b)-12 {
+		return nil, errors.New("kafka: invalid batch length")
+	}
+	if crc32.Checksum(d.b, castagnoli) != crc {
+		return nil, errors.New("kafka: invalid checksum")
+	}
+	d.int16()
+	d.int32()
+	d.int64()
+	d.int64()
+	d.int64()
+	d.int16()
+	d.int32()
+	n := d.arrayLength()
+	var messages []Message
+	for i := 0; i < n; i++ {
+		d.varint()
+		d.int8()
+		d.varint()
+		d.varint()
+		msg := Message{Key: d.varbytes(), Value: d.varbytes()}
+		for h := d.varint(); h > 0; h-- {
+			d.varbytes()
+			d.varbytes()
+		}
+		messages = append(messages, msg)
+	}
+	return messages, d.err
+}
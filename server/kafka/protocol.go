@@ -0,0 +1,224 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// The API keys and versions of the requests sent by the client.
+const (
+	apiKeyProduce  int16 = 0
+	apiKeyMetadata int16 = 3
+
+	apiVersionProduce  int16 = 3
+	apiVersionMetadata int16 = 1
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// encoder appends values to a byte slice using the encoding of the Kafka
+// protocol.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8) {
+	e.b = append(e.b, byte(v))
+}
+
+func (e *encoder) int16(v int16) {
+	e.b = binary.BigEndian.AppendUint16(e.b, uint16(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.b = binary.BigEndian.AppendUint32(e.b, uint32(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.b = binary.BigEndian.AppendUint64(e.b, uint64(v))
+}
+
+func (e *encoder) varint(v int64) {
+	e.b = binary.AppendVarint(e.b, v)
+}
+
+func (e *encoder) string(v string) {
+	e.int16(int16(len(v)))
+	e.b = append(e.b, v...)
+}
+
+func (e *encoder) nullString() {
+	e.int16(-1)
+}
+
+func (e *encoder) bytes(v []byte) {
+	e.int32(int32(len(v)))
+	e.b = append(e.b, v...)
+}
+
+// varbytes encodes a byte slice prefixed by its length as used in records.
+// nil is encoded as null.
+func (e *encoder) varbytes(v []byte) {
+	if v == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(v)))
+	e.b = append(e.b, v...)
+}
+
+var errShortBuffer = errors.New("kafka: unexpected end of response")
+
+// decoder reads values from a response. After the first error, all
+// subsequent reads return zero values and the error is kept.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errShortBuffer
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int8() int8 {
+	if v := d.next(1); v != nil {
+		return int8(v[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if v := d.next(2); v != nil {
+		return int16(binary.BigEndian.Uint16(v))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if v := d.next(4); v != nil {
+		return int32(binary.BigEndian.Uint32(v))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if v := d.next(8); v != nil {
+		return int64(binary.BigEndian.Uint64(v))
+	}
+	return 0
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errShortBuffer
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.next(int(n))
+}
+
+func (d *decoder) varbytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	return d.next(int(n))
+}
+
+// arrayLength reads the length of an array, guarding against lengths that
+// cannot possibly be satisfied by the remaining bytes.
+func (d *decoder) arrayLength() int {
+	n := int(d.int32())
+	if n > len(d.b) {
+		d.err = errShortBuffer
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) int32Array() []int32 {
+	n := d.arrayLength()
+	var result []int32
+	for i := 0; i < n; i++ {
+		result = append(result, d.int32())
+	}
+	return result
+}
+
+// Message is a single message that is produced.
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+// encodeRecordBatch encodes the given messages as a record batch using the
+// message format version 2.
+func encodeRecordBatch(messages []Message, timestamp int64) []byte {
+	var records encoder
+	for i, msg := range messages {
+		var record encoder
+		record.int8(0)             // attributes
+		record.varint(0)           // timestamp delta
+		record.varint(int64(i))    // offset delta
+		record.varbytes(msg.Key)   // key
+		record.varbytes(msg.Value) // value
+		record.varint(0)           // headers
+		records.varint(int64(len(record.b)))
+		records.b = append(records.b, record.b...)
+	}
+
+	// the checksum covers everything from the attributes to the end of the
+	// batch
+	var body encoder
+	body.int16(0) // attributes
+	body.int32(int32(len(messages) - 1))
+	body.int64(timestamp)
+	body.int64(timestamp)
+	body.int64(-1) // producer id
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(int32(len(messages)))
+	body.b = append(body.b, records.b...)
+
+	var batch encoder
+	batch.int64(0) // base offset
+	batch.int32(int32(4 + 1 + 4 + len(body.b)))
+	batch.int32(-1) // partition leader epoch
+	batch.int8(2)   // magic
+	batch.int32(int32(crc32.Checksum(body.b, castagnoli)))
+	batch.b = append(batch.b, body.b...)
+	return batch.b
+}
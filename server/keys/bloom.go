@@ -0,0 +1,137 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// bloomFilterMagic prefixes all serialized bloom filters.
+var bloomFilterMagic = []byte("OFFENBF1")
+
+// BloomFilter is a probabilistic set of SHA-1 hashes, which is used for
+// checking passwords against a list of breached passwords without having to
+// store the entire list. Membership is checked by the SHA-1 hash of a
+// password, which matches the format breached password lists are
+// distributed in.
+type BloomFilter struct {
+	bits   []byte
+	size   uint64
+	hashes uint32
+}
+
+// NewBloomFilter creates an empty bloom filter that is sized for holding the
+// given number of items with the given false positive rate.
+func NewBloomFilter(items uint64, falsePositiveRate float64) (*BloomFilter, error) {
+	if items == 0 || falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, errors.New("keys: bloom filter requires a positive number of items and a false positive rate between 0 and 1")
+	}
+	size := uint64(math.Ceil(-float64(items) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint32(math.Max(1, math.Round(float64(size)/float64(items)*math.Ln2)))
+	return &BloomFilter{
+		bits:   make([]byte, (size+7)/8),
+		size:   size,
+		hashes: hashes,
+	}, nil
+}
+
+// ReadBloomFilter reads a bloom filter that has been written using WriteTo.
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	header := make([]byte, len(bloomFilterMagic)+12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("keys: error reading bloom filter header: %w", err)
+	}
+	if !bytes.Equal(header[:len(bloomFilterMagic)], bloomFilterMagic) {
+		return nil, errors.New("keys: given data is not a bloom filter")
+	}
+	b := &BloomFilter{
+		hashes: binary.BigEndian.Uint32(header[len(bloomFilterMagic):]),
+		size:   binary.BigEndian.Uint64(header[len(bloomFilterMagic)+4:]),
+	}
+	if b.hashes == 0 || b.size == 0 {
+		return nil, errors.New("keys: bloom filter header is invalid")
+	}
+	b.bits = make([]byte, (b.size+7)/8)
+	if _, err := io.ReadFull(r, b.bits); err != nil {
+		return nil, fmt.Errorf("keys: error reading bloom filter: %w", err)
+	}
+	return b, nil
+}
+
+// LoadBloomFilter reads the bloom filter stored in the given file.
+func LoadBloomFilter(file string) (*BloomFilter, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("keys: error opening bloom filter: %w", err)
+	}
+	defer f.Close()
+	return ReadBloomFilter(bufio.NewReader(f))
+}
+
+// WriteTo serializes the bloom filter into the given writer.
+func (b *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, 12)
+	binary.BigEndian.PutUint32(header, b.hashes)
+	binary.BigEndian.PutUint64(header[4:], b.size)
+	var written int64
+	for _, chunk := range [][]byte{bloomFilterMagic, header, b.bits} {
+		n, err := w.Write(chunk)
+		written += int64(n)
+		if err != nil {
+			return written, fmt.Errorf("keys: error writing bloom filter: %w", err)
+		}
+	}
+	return written, nil
+}
+
+func (b *BloomFilter) positions(hash []byte) []uint64 {
+	h1 := binary.BigEndian.Uint64(hash[0:8])
+	// the second hash is odd so all positions are reached
+	h2 := binary.BigEndian.Uint64(hash[8:16]) | 1
+	result := make([]uint64, b.hashes)
+	for i := range result {
+		result[i] = (h1 + uint64(i)*h2) % b.size
+	}
+	return result
+}
+
+// Add adds the given SHA-1 hash to the filter.
+func (b *BloomFilter) Add(hash []byte) error {
+	if len(hash) != sha1.Size {
+		return fmt.Errorf("keys: expected hash of %d bytes, got %d", sha1.Size, len(hash))
+	}
+	for _, p := range b.positions(hash) {
+		b.bits[p/8] |= 1 << (p % 8)
+	}
+	return nil
+}
+
+// Contains checks whether the given SHA-1 hash might have been added to
+// the filter.
+func (b *BloomFilter) Contains(hash []byte) bool {
+	if len(hash) != sha1.Size {
+		return false
+	}
+	for _, p := range b.positions(hash) {
+		if b.bits[p/8]&(1<<(p%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsPassword checks whether the given password might have been added
+// to the filter.
+func (b *BloomFilter) ContainsPassword(pw string) bool {
+	sum := sha1.Sum([]byte(pw))
+	return b.Contains(sum[:])
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	b, err := NewBloomFilter(1000, 0.01)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		sum := sha1.Sum([]byte(fmt.Sprintf("password-%d", i)))
+		if err := b.Add(sum[:]); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if err := b.Add([]byte("short")); err == nil {
+		t.Error("Expected error when adding bad hash")
+	}
+
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	restored, err := ReadBloomFilter(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if !restored.ContainsPassword(fmt.Sprintf("password-%d", i)) {
+			t.Errorf("Expected password-%d to be contained", i)
+		}
+	}
+	var falsePositives int
+	for i := 0; i < 1000; i++ {
+		if restored.ContainsPassword(fmt.Sprintf("other-%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 30 {
+		t.Errorf("Unexpected number of false positives %d", falsePositives)
+	}
+
+	if _, err := ReadBloomFilter(bytes.NewBufferString("OFFENBF0xxxxxxxxxxxx")); err == nil {
+		t.Error("Expected error reading bad data")
+	}
+	if _, err := NewBloomFilter(0, 0.01); err == nil {
+		t.Error("Expected error creating empty filter")
+	}
+}
@@ -3,7 +3,12 @@
 
 package keys
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
 
 // different errors will be returned for different validation failures
 var (
@@ -11,14 +16,78 @@ var (
 	ErrPasswordTooLong  = errors.New("keys: given password is longer than 64 characters")
 )
 
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 64
+)
+
 // ValidatePassword checks whether the given password meets all requirements
 // of the currently applicable password policy
 func ValidatePassword(pw string) error {
-	if len(pw) < 8 {
+	if len(pw) < minPasswordLength {
 		return ErrPasswordTooShort
 	}
-	if len(pw) > 64 {
+	if len(pw) > maxPasswordLength {
 		return ErrPasswordTooLong
 	}
 	return nil
 }
+
+// Violations of a PasswordPolicy are reported using these identifiers.
+const (
+	PasswordViolationTooShort = "too-short"
+	PasswordViolationTooLong  = "too-long"
+	PasswordViolationTooWeak  = "too-weak"
+	PasswordViolationBreached = "breached"
+)
+
+// PasswordPolicyError is returned when a password does not meet the
+// requirements of a PasswordPolicy.
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (p *PasswordPolicyError) Error() string {
+	return fmt.Sprintf("keys: password violates policy: %s", strings.Join(p.Violations, ", "))
+}
+
+// PasswordPolicy defines additional requirements for passwords chosen by
+// account users. The requirements of ValidatePassword always apply.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters. Values lower than 8 are
+	// ignored.
+	MinLength int
+	// MinScore is the minimum score as returned by PasswordScore.
+	MinScore int
+	// Breaches is an optional filter of passwords known to have been exposed
+	// in data breaches.
+	Breaches *BloomFilter
+}
+
+// Validate checks the given password against the policy. In case it does not
+// meet all requirements, a *PasswordPolicyError listing all violations is
+// returned.
+func (p *PasswordPolicy) Validate(pw string) error {
+	minLength := minPasswordLength
+	if p != nil && p.MinLength > minLength {
+		minLength = p.MinLength
+	}
+
+	var violations []string
+	if len(pw) < minPasswordLength || utf8.RuneCountInString(pw) < minLength {
+		violations = append(violations, PasswordViolationTooShort)
+	}
+	if len(pw) > maxPasswordLength {
+		violations = append(violations, PasswordViolationTooLong)
+	}
+	if p != nil && p.MinScore > 0 && PasswordScore(pw) < p.MinScore {
+		violations = append(violations, PasswordViolationTooWeak)
+	}
+	if p != nil && p.Breaches != nil && p.Breaches.ContainsPassword(pw) {
+		violations = append(violations, PasswordViolationBreached)
+	}
+	if len(violations) != 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
@@ -3,7 +3,12 @@
 
 package keys
 
-import "testing"
+import (
+	"crypto/sha1"
+	"errors"
+	"reflect"
+	"testing"
+)
 
 func TestValidatePassword(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
@@ -22,3 +27,67 @@ func TestValidatePassword(t *testing.T) {
 		}
 	})
 }
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	breaches, _ := NewBloomFilter(10, 0.001)
+	sum := sha1.Sum([]byte("correct horse battery staple"))
+	breaches.Add(sum[:])
+
+	tests := []struct {
+		name               string
+		policy             *PasswordPolicy
+		password           string
+		expectedViolations []string
+	}{
+		{"nil policy", nil, "development", nil},
+		{"nil policy short", nil, "dev", []string{PasswordViolationTooShort}},
+		{"min length", &PasswordPolicy{MinLength: 12}, "development", []string{PasswordViolationTooShort}},
+		{"min length below default", &PasswordPolicy{MinLength: 4}, "devel", []string{PasswordViolationTooShort}},
+		{"weak", &PasswordPolicy{MinScore: 3}, "password123", []string{PasswordViolationTooWeak}},
+		{"strong", &PasswordPolicy{MinScore: 3}, "Vq7#pLm2!xZr", nil},
+		{"breached", &PasswordPolicy{Breaches: breaches}, "correct horse battery staple", []string{PasswordViolationBreached}},
+		{"not breached", &PasswordPolicy{Breaches: breaches}, "correct horse battery", nil},
+		{"multiple", &PasswordPolicy{MinLength: 10, MinScore: 2}, "aaaaaaaa", []string{PasswordViolationTooShort, PasswordViolationTooWeak}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.policy.Validate(test.password)
+			if test.expectedViolations == nil {
+				if err != nil {
+					t.Errorf("Unexpected error %v", err)
+				}
+				return
+			}
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(policyErr.Violations, test.expectedViolations) {
+				t.Errorf("Unexpected violations %v", policyErr.Violations)
+			}
+		})
+	}
+}
+
+func TestPasswordScore(t *testing.T) {
+	tests := []struct {
+		password      string
+		expectedScore int
+	}{
+		{"password", 0},
+		{"P@ssw0rd", 0},
+		{"aaaaaaaaaaaa", 1},
+		{"qwertyuiop", 1},
+		{"abcdefghijkl", 1},
+		{"sunshine2022", 2},
+		{"Tr0ub4dor&3", 4},
+		{"Vq7#pLm2!xZr", 4},
+	}
+	for _, test := range tests {
+		t.Run(test.password, func(t *testing.T) {
+			if score := PasswordScore(test.password); score != test.expectedScore {
+				t.Errorf("Expected score %d, got %d", test.expectedScore, score)
+			}
+		})
+	}
+}
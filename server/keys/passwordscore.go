@@ -0,0 +1,168 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords contains frequently used passwords and password
+// fragments. A password containing one of them is considered to be
+// guessed using a dictionary instead of brute force.
+var commonPasswords = []string{
+	"password", "passwort", "123456", "qwerty", "abc123", "letmein",
+	"welcome", "monkey", "dragon", "football", "baseball", "master",
+	"shadow", "sunshine", "princess", "iloveyou", "trustno1", "superman",
+	"batman", "starwars", "whatever", "freedom", "secret", "admin",
+	"login", "access", "hello", "charlie", "michael", "jordan",
+	"summer", "winter", "spring", "autumn", "flower", "cookie",
+	"cheese", "soccer", "hockey", "killer", "pepper", "ginger",
+	"computer", "internet", "matrix", "hunter", "ranger", "buster",
+	"tigger", "purple", "orange", "yellow", "silver", "golden",
+	"lovely", "family", "friend", "angel", "love", "offen",
+	"analytics", "change", "default", "test", "demo", "guest",
+	"user", "root", "pass", "temp", "qazwsx", "zxcvbn", "asdfgh",
+}
+
+// keyboardRows are used for detecting passwords that follow adjacent keys.
+var keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./",
+	"qwertzuiopü", "asdfghjklöä", "yxcvbnm", "azertyuiop", "qsdfghjklm", "wxcvbn",
+}
+
+var leetSubstitutions = strings.NewReplacer(
+	"4", "a", "@", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t", "+", "t",
+)
+
+// PasswordScore estimates the strength of the given password on a scale
+// from 0 (too guessable) to 4 (very unguessable), using the same thresholds
+// as the zxcvbn library. The estimate is derived from the number of guesses
+// an attacker would need, taking into account common passwords, repeated
+// characters, sequences and adjacent keys.
+func PasswordScore(pw string) int {
+	guesses := passwordGuesses(pw)
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// passwordGuesses returns the log10 of the number of guesses needed for
+// guessing the given password.
+func passwordGuesses(pw string) float64 {
+	runes := []rune(pw)
+	if len(runes) == 0 {
+		return 0
+	}
+
+	// characters matching a dictionary entry are guessed all at once
+	covered := make([]bool, len(runes))
+	var guesses float64
+	lower := strings.ToLower(pw)
+	for _, candidate := range []string{lower, leetSubstitutions.Replace(lower)} {
+		normalized := []rune(candidate)
+		if len(normalized) != len(runes) {
+			continue
+		}
+		for _, word := range commonPasswords {
+			w := []rune(word)
+			for start := 0; start+len(w) <= len(normalized); start++ {
+				if covered[start] || string(normalized[start:start+len(w)]) != word {
+					continue
+				}
+				for i := range w {
+					covered[start+i] = true
+				}
+				guesses += math.Log10(float64(len(commonPasswords)))
+			}
+		}
+	}
+
+	perCharacter := math.Log10(float64(characterSpace(runes)))
+	var run int
+	for i, r := range runes {
+		if covered[i] {
+			continue
+		}
+		if i > 0 && predictable(runes[i-1], r) {
+			run++
+			continue
+		}
+		if run > 0 {
+			// a pattern is guessed by its kind and length only
+			guesses += math.Log10(float64(4 * run))
+			run = 0
+		}
+		guesses += perCharacter
+	}
+	if run > 0 {
+		guesses += math.Log10(float64(4 * run))
+	}
+	return guesses
+}
+
+// characterSpace returns the number of characters an attacker would need
+// to try for each position of the given password.
+func characterSpace(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	var space int
+	if lower {
+		space += 26
+	}
+	if upper {
+		space += 26
+	}
+	if digit {
+		space += 10
+	}
+	if symbol {
+		space += 33
+	}
+	if other {
+		space += 100
+	}
+	return space
+}
+
+// predictable checks whether the character next follows from the character
+// prev, i.e. it repeats it, continues a sequence or is the adjacent key.
+func predictable(prev, next rune) bool {
+	prev, next = unicode.ToLower(prev), unicode.ToLower(next)
+	if next == prev || next == prev+1 || next == prev-1 {
+		return true
+	}
+	for _, row := range keyboardRows {
+		keys := []rune(row)
+		for i := 0; i < len(keys)-1; i++ {
+			if (keys[i] == prev && keys[i+1] == next) || (keys[i] == next && keys[i+1] == prev) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// The following values are used for time based one time passwords as
+// defined in RFC 6238. They match the defaults that authenticator apps use.
+const (
+	TOTPSecretLength = 20
+	TOTPDigits       = 6
+	TOTPPeriod       = 30 * time.Second
+	// TOTPSkew is the number of periods before or after the current one
+	// that are accepted to account for clock drift.
+	TOTPSkew = 1
+)
+
+// TOTPEncoding is the encoding used for sharing TOTP secrets with
+// authenticator apps.
+var TOTPEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random TOTP secret.
+func GenerateTOTPSecret() ([]byte, error) {
+	secret, err := GenerateRandomBytes(TOTPSecretLength)
+	if err != nil {
+		return nil, fmt.Errorf("keys: error generating totp secret: %w", err)
+	}
+	return secret, nil
+}
+
+// TOTP returns the one time password for the given secret at the given time.
+func TOTP(secret []byte, t time.Time) string {
+	return hotp(secret, uint64(t.Unix()/int64(TOTPPeriod/time.Second)))
+}
+
+// ValidateTOTP checks whether the given code is a valid one time password
+// for the given secret at the given time.
+func ValidateTOTP(secret []byte, code string, t time.Time) bool {
+	_, ok := MatchTOTP(secret, code, t)
+	return ok
+}
+
+// MatchTOTP checks whether the given code is a valid one time password for
+// the given secret at the given time and returns the time step the code
+// belongs to. Callers can store the step for rejecting codes that have
+// already been used.
+func MatchTOTP(secret []byte, code string, t time.Time) (int64, bool) {
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+	counter := t.Unix() / int64(TOTPPeriod/time.Second)
+	var step int64
+	valid := false
+	for i := int64(-TOTPSkew); i <= TOTPSkew; i++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(secret, uint64(counter+i))), []byte(code)) == 1 {
+			step = counter + i
+			valid = true
+		}
+	}
+	return step, valid
+}
+
+func hotp(secret []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod)
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// test vectors from RFC 6238, truncated to 6 digits
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, test := range tests {
+		if code := TOTP(secret, time.Unix(test.unix, 0)); code != test.expected {
+			t.Errorf("Expected %s at %d, got %s", test.expected, test.unix, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111109, 0)
+	if !ValidateTOTP(secret, "081804", now) {
+		t.Error("Expected current code to be valid")
+	}
+	if !ValidateTOTP(secret, "081804", now.Add(TOTPPeriod)) {
+		t.Error("Expected code of previous period to be valid")
+	}
+	if ValidateTOTP(secret, "081804", now.Add(3*TOTPPeriod)) {
+		t.Error("Expected outdated code to be invalid")
+	}
+	if ValidateTOTP(secret, "81804", now) {
+		t.Error("Expected short code to be invalid")
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111109, 0)
+	if step, ok := MatchTOTP(secret, "081804", now); !ok || step != 37037036 {
+		t.Errorf("Unexpected result %d, %v", step, ok)
+	}
+	if step, ok := MatchTOTP(secret, "081804", now.Add(TOTPPeriod)); !ok || step != 37037036 {
+		t.Errorf("Unexpected result for previous period %d, %v", step, ok)
+	}
+	if _, ok := MatchTOTP(secret, "081804", now.Add(3*TOTPPeriod)); ok {
+		t.Error("Expected outdated code not to match")
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// GenerateUserSecret creates a random key for encrypting the events of a
+// single user, the same way the vault does when a user opts in. It returns
+// the raw key and the key serialized as a JSON Web Key, which is expected to
+// be encrypted using the public key of an account before being stored.
+func GenerateUserSecret() ([]byte, []byte, error) {
+	k, err := GenerateRandomBytes(DefaultSecretLength)
+	if err != nil {
+		return nil, nil, fmt.Errorf("keys: error creating user secret: %w", err)
+	}
+	j, err := jwk.New(k)
+	if err != nil {
+		return nil, nil, fmt.Errorf("keys: error wrapping user secret as jwk: %w", err)
+	}
+	j.Set(jwk.AlgorithmKey, "A128GCM")
+	j.Set("ext", true)
+	j.Set(jwk.KeyOpsKey, jwk.KeyOperationList{jwk.KeyOpEncrypt, jwk.KeyOpDecrypt})
+	b, err := json.Marshal(j)
+	if err != nil {
+		return nil, nil, fmt.Errorf("keys: error marshaling user secret: %w", err)
+	}
+	return k, b, nil
+}
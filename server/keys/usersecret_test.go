@@ -0,0 +1,26 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package keys
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGenerateUserSecret(t *testing.T) {
+	key, jwk, err := GenerateUserSecret()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(key) != DefaultSecretLength {
+		t.Errorf("Unexpected key length %d", len(key))
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(jwk, &result); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if result["kty"] != "oct" || result["alg"] != "A128GCM" || result["ext"] != true {
+		t.Errorf("Unexpected jwk %v", result)
+	}
+}
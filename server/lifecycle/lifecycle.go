@@ -0,0 +1,83 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package lifecycle coordinates shutting down the application, so that
+// in-flight requests and queued work are completed before the process exits.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+type hook struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// Manager runs registered shutdown hooks in the order they have been added.
+// All hooks share a single deadline, defined by the context passed to
+// Shutdown.
+type Manager struct {
+	mu     sync.Mutex
+	hooks  []hook
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates a new Manager.
+func New() *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{ctx: ctx, cancel: cancel}
+}
+
+// Context returns a context that is cancelled as soon as shutdown begins.
+// Background workers are expected to use it so they stop picking up new work.
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// OnShutdown registers a hook that is run on shutdown.
+func (m *Manager) OnShutdown(name string, fn func(context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook{name: name, fn: fn})
+}
+
+// Wait blocks until one of the given signals is received.
+func (m *Manager) Wait(signals ...os.Signal) os.Signal {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, signals...)
+	defer signal.Stop(quit)
+	return <-quit
+}
+
+// Shutdown cancels the context returned by Context and runs all registered
+// hooks. A failing hook does not keep subsequent hooks from running. In
+// case ctx is done before all hooks have returned, the remaining hooks are
+// skipped.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.cancel()
+
+	m.mu.Lock()
+	hooks := append([]hook{}, m.hooks...)
+	m.mu.Unlock()
+
+	var errs []error
+	for i, h := range hooks {
+		if err := ctx.Err(); err != nil {
+			for _, skipped := range hooks[i:] {
+				errs = append(errs, fmt.Errorf("lifecycle: skipped %s: %w", skipped.name, err))
+			}
+			break
+		}
+		if err := h.fn(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("lifecycle: error running %s: %w", h.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestManager_Shutdown(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		m := New()
+		var calls []string
+		m.OnShutdown("a", func(ctx context.Context) error {
+			if m.Context().Err() == nil {
+				t.Error("Expected context to be cancelled before running hooks")
+			}
+			calls = append(calls, "a")
+			return nil
+		})
+		m.OnShutdown("b", func(ctx context.Context) error {
+			calls = append(calls, "b")
+			return nil
+		})
+		if err := m.Shutdown(context.Background()); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(calls, []string{"a", "b"}) {
+			t.Errorf("Unexpected calls %v", calls)
+		}
+	})
+	t.Run("failing hook", func(t *testing.T) {
+		m := New()
+		var calls []string
+		m.OnShutdown("a", func(ctx context.Context) error {
+			calls = append(calls, "a")
+			return errors.New("did not work")
+		})
+		m.OnShutdown("b", func(ctx context.Context) error {
+			calls = append(calls, "b")
+			return nil
+		})
+		err := m.Shutdown(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "error running a") {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(calls, []string{"a", "b"}) {
+			t.Errorf("Unexpected calls %v", calls)
+		}
+	})
+	t.Run("deadline exceeded", func(t *testing.T) {
+		m := New()
+		ctx, cancel := context.WithCancel(context.Background())
+		var calls []string
+		m.OnShutdown("a", func(context.Context) error {
+			calls = append(calls, "a")
+			cancel()
+			return nil
+		})
+		m.OnShutdown("b", func(context.Context) error {
+			calls = append(calls, "b")
+			return nil
+		})
+		err := m.Shutdown(ctx)
+		if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "skipped b") {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(calls, []string{"a"}) {
+			t.Errorf("Unexpected calls %v", calls)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package livefeed distributes newly ingested events to subscribers that
+// are interested in the events of a certain account. Events are only
+// distributed in-process, so subscribers connected to one instance will not
+// receive events ingested by another one.
+package livefeed
+
+import (
+	"sync"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+// bufferSize is the number of events that are buffered for each subscriber.
+// Slow subscribers miss events instead of blocking ingestion.
+const bufferSize = 32
+
+// Broker fans out published events to all subscribers of the event's account.
+type Broker struct {
+	mu          sync.Mutex
+	closed      bool
+	subscribers map[string]map[chan persistence.EventResult]struct{}
+}
+
+// New creates a new Broker.
+func New() *Broker {
+	return &Broker{
+		subscribers: map[string]map[chan persistence.EventResult]struct{}{},
+	}
+}
+
+// Publish passes the given event to all subscribers of its account. It never
+// blocks.
+func (b *Broker) Publish(evt persistence.EventResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers[evt.AccountID] {
+		select {
+		case ch <- evt:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving all events published for the given
+// account. Callers must call the returned function once they are not
+// interested in events anymore. The channel is closed when unsubscribing or
+// when the broker is closed.
+func (b *Broker) Subscribe(accountID string) (<-chan persistence.EventResult, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan persistence.EventResult, bufferSize)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subscribers[accountID] == nil {
+		b.subscribers[accountID] = map[chan persistence.EventResult]struct{}{}
+	}
+	b.subscribers[accountID][ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.subscribers[accountID][ch]; !ok {
+				return
+			}
+			delete(b.subscribers[accountID], ch)
+			if len(b.subscribers[accountID]) == 0 {
+				delete(b.subscribers, accountID)
+			}
+			close(ch)
+		})
+	}
+}
+
+// Close closes the channels of all subscribers so that long running requests
+// can finish. Subscribing after Close returns a closed channel.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for accountID, subscribers := range b.subscribers {
+		for ch := range subscribers {
+			close(ch)
+		}
+		delete(b.subscribers, accountID)
+	}
+}
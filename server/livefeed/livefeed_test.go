@@ -0,0 +1,63 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package livefeed
+
+import (
+	"testing"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestBroker(t *testing.T) {
+	b := New()
+	eventsA, unsubscribeA := b.Subscribe("account-a")
+	eventsB, unsubscribeB := b.Subscribe("account-b")
+	defer unsubscribeB()
+
+	b.Publish(persistence.EventResult{AccountID: "account-a", EventID: "event-a"})
+	b.Publish(persistence.EventResult{AccountID: "account-c", EventID: "event-c"})
+
+	if evt := <-eventsA; evt.EventID != "event-a" {
+		t.Errorf("Unexpected event %v", evt)
+	}
+	select {
+	case evt := <-eventsB:
+		t.Errorf("Unexpected event for other account %v", evt)
+	default:
+	}
+
+	unsubscribeA()
+	unsubscribeA()
+	if _, ok := <-eventsA; ok {
+		t.Error("Expected channel to be closed after unsubscribing")
+	}
+	b.Publish(persistence.EventResult{AccountID: "account-a", EventID: "event-b"})
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	b := New()
+	events, unsubscribe := b.Subscribe("account-a")
+	defer unsubscribe()
+	for i := 0; i < bufferSize*2; i++ {
+		b.Publish(persistence.EventResult{AccountID: "account-a"})
+	}
+	if len(events) != bufferSize {
+		t.Errorf("Expected %d buffered events, got %d", bufferSize, len(events))
+	}
+}
+
+func TestBroker_Close(t *testing.T) {
+	b := New()
+	events, unsubscribe := b.Subscribe("account-a")
+	b.Close()
+	if _, ok := <-events; ok {
+		t.Error("Expected channel to be closed")
+	}
+	unsubscribe()
+
+	events, _ = b.Subscribe("account-a")
+	if _, ok := <-events; ok {
+		t.Error("Expected channel to be closed when subscribing after close")
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package locales
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/offen/offen/server/public"
+)
+
+// Bundle contains the translations of all locales that are available in the
+// public file system.
+type Bundle struct {
+	catalogs map[string]*gotext.Po
+}
+
+// NewBundle reads the translations of all available locales.
+func NewBundle() (*Bundle, error) {
+	b := &Bundle{catalogs: map[string]*gotext.Po{}}
+	files, err := fs.Glob(public.FS, "static/locales/*.po")
+	if err != nil {
+		return nil, fmt.Errorf("locales: error looking up locale files: %w", err)
+	}
+	for _, file := range files {
+		content, err := fs.ReadFile(public.FS, file)
+		if err != nil {
+			return nil, fmt.Errorf("locales: error reading file %s: %w", file, err)
+		}
+		po := gotext.NewPo()
+		po.Parse(content)
+		b.catalogs[strings.TrimSuffix(path.Base(file), ".po")] = po
+	}
+	return b, nil
+}
+
+// Locales returns all locales translations are available for, including the
+// default locale.
+func (b *Bundle) Locales() []string {
+	result := []string{defaultLocale}
+	for locale := range b.catalogs {
+		if locale != defaultLocale {
+			result = append(result, locale)
+		}
+	}
+	sort.Strings(result[1:])
+	return result
+}
+
+// Gettext returns the gettext function for the given locale. Unknown locales
+// use the default locale, which returns strings as is.
+func (b *Bundle) Gettext(locale string) func(string, ...interface{}) template.HTML {
+	if po, ok := b.catalogs[locale]; ok && locale != defaultLocale {
+		return wrapFmt(po.Get)
+	}
+	return wrapFmt(fmt.Sprintf)
+}
+
+// NGettext returns a function for translating strings depending on a count
+// for the given locale. The plural forms defined by the locale's translations
+// are respected.
+func (b *Bundle) NGettext(locale string) func(string, string, int, ...interface{}) template.HTML {
+	if po, ok := b.catalogs[locale]; ok && locale != defaultLocale {
+		return func(singular, plural string, n int, args ...interface{}) template.HTML {
+			return template.HTML(po.GetN(singular, plural, n, args...))
+		}
+	}
+	return func(singular, plural string, n int, args ...interface{}) template.HTML {
+		if n == 1 {
+			return template.HTML(fmt.Sprintf(singular, args...))
+		}
+		return template.HTML(fmt.Sprintf(plural, args...))
+	}
+}
+
+// Negotiate returns the first of the given candidates that is contained in
+// available. Candidates can either be locales or values of an
+// Accept-Language header, whose languages are considered in order of their
+// quality. In case no candidate matches, fallback is returned.
+func Negotiate(available []string, fallback string, candidates ...string) string {
+	supported := map[string]bool{}
+	for _, locale := range available {
+		supported[locale] = true
+	}
+	for _, candidate := range candidates {
+		for _, language := range parseAcceptLanguage(candidate) {
+			if supported[language] {
+				return language
+			}
+		}
+	}
+	return fallback
+}
+
+// parseAcceptLanguage returns the primary language subtags of the given
+// Accept-Language header, ordered by their quality. Languages with a quality
+// of zero and wildcards are skipped.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		language string
+		quality  float64
+	}
+	var languages []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+				quality = q
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		languages = append(languages, weighted{strings.SplitN(tag, "-", 2)[0], quality})
+	}
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+	result := make([]string, len(languages))
+	for i, l := range languages {
+		result[i] = l.language
+	}
+	return result
+}
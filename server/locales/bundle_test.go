@@ -0,0 +1,78 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package locales
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/leonelquinteros/gotext"
+)
+
+func TestNegotiate(t *testing.T) {
+	available := []string{"en", "de", "fr"}
+	tests := []struct {
+		name       string
+		candidates []string
+		expected   string
+	}{
+		{"no candidates", nil, "en"},
+		{"locale", []string{"de"}, "de"},
+		{"account setting first", []string{"fr", "de-DE,de;q=0.9"}, "fr"},
+		{"empty account setting", []string{"", "de-DE,de;q=0.9"}, "de"},
+		{"quality", []string{"es;q=1.0, fr;q=0.5, de;q=0.8"}, "de"},
+		{"unsupported", []string{"es-ES, pt;q=0.5"}, "en"},
+		{"refused", []string{"de;q=0, fr;q=0.1"}, "fr"},
+		{"wildcard", []string{"*"}, "en"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := Negotiate(available, "en", test.candidates...); result != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	result := parseAcceptLanguage("fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5")
+	expected := []string{"fr", "fr", "en", "de"}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	po := gotext.NewPo()
+	po.Parse([]byte(`
+msgid ""
+msgstr ""
+"Plural-Forms: nplurals=2; plural=(n != 1);\n"
+
+msgid "Hi!"
+msgstr "Hallo!"
+
+msgid "%d account"
+msgid_plural "%d accounts"
+msgstr[0] "%d Account"
+msgstr[1] "%d Accounts"
+`))
+	b := &Bundle{catalogs: map[string]*gotext.Po{"de": po}}
+
+	if locales := b.Locales(); !reflect.DeepEqual(locales, []string{"en", "de"}) {
+		t.Errorf("Unexpected locales %v", locales)
+	}
+	if result := b.Gettext("de")("Hi!"); result != "Hallo!" {
+		t.Errorf("Unexpected translation %v", result)
+	}
+	if result := b.Gettext("es")("Hi!"); result != "Hi!" {
+		t.Errorf("Unexpected translation %v", result)
+	}
+	if result := b.NGettext("de")("%d account", "%d accounts", 3, 3); result != "3 Accounts" {
+		t.Errorf("Unexpected translation %v", result)
+	}
+	if result := b.NGettext("en")("%d account", "%d accounts", 1, 1); result != "1 account" {
+		t.Errorf("Unexpected translation %v", result)
+	}
+}
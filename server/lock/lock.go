@@ -0,0 +1,75 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package lock provides named locks that make sure destructive maintenance
+// work like purging expired data or applying migrations is not executed by
+// multiple instances of a deployment at the same time.
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Locker acquires named locks. TryLock does not block. In case the lock is
+// held elsewhere, acquired is false. Calling release gives up the lock.
+type Locker interface {
+	TryLock(name string) (release func(), acquired bool, err error)
+}
+
+// Shared returns whether locks acquired from the given Locker are shared
+// with other processes. Lockers signal this by implementing
+// `Shared() bool`.
+func Shared(l Locker) bool {
+	if s, ok := l.(interface{ Shared() bool }); ok {
+		return s.Shared()
+	}
+	return false
+}
+
+// Acquire blocks until the lock with the given name has been acquired or
+// the context is canceled. Acquisition is retried in the given interval.
+func Acquire(ctx context.Context, l Locker, name string, interval time.Duration) (func(), error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		release, acquired, err := l.TryLock(name)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			return release, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// NewLocal creates a Locker whose locks are only held within the current
+// process.
+func NewLocal() Locker {
+	return &localLocker{locks: map[string]*sync.Mutex{}}
+}
+
+type localLocker struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (l *localLocker) TryLock(name string) (func(), bool, error) {
+	l.mu.Lock()
+	m, ok := l.locks[name]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[name] = m
+	}
+	l.mu.Unlock()
+	if !m.TryLock() {
+		return nil, false, nil
+	}
+	return m.Unlock, true, nil
+}
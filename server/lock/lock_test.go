@@ -0,0 +1,71 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLocal(t *testing.T) {
+	l := NewLocal()
+	if Shared(l) {
+		t.Error("Expected local locks not to be shared")
+	}
+	release, acquired, err := l.TryLock("migrations")
+	if err != nil || !acquired {
+		t.Fatalf("Unexpected result %v %v", acquired, err)
+	}
+	if _, acquired, _ := l.TryLock("migrations"); acquired {
+		t.Error("Expected lock to be held")
+	}
+	if _, acquired, _ := l.TryLock("job:expire-events"); !acquired {
+		t.Error("Expected other lock to be acquired")
+	}
+	release()
+	if _, acquired, _ := l.TryLock("migrations"); !acquired {
+		t.Error("Expected lock to be acquired after release")
+	}
+}
+
+type mockLocker struct {
+	attempts int
+	freeAt   int
+	err      error
+}
+
+func (m *mockLocker) TryLock(name string) (func(), bool, error) {
+	m.attempts++
+	if m.err != nil {
+		return nil, false, m.err
+	}
+	return func() {}, m.attempts >= m.freeAt, nil
+}
+
+func TestAcquire(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		m := &mockLocker{freeAt: 3}
+		release, err := Acquire(context.Background(), m, "migrations", time.Millisecond)
+		if err != nil || release == nil {
+			t.Errorf("Unexpected result %v", err)
+		}
+		if m.attempts != 3 {
+			t.Errorf("Unexpected number of attempts %d", m.attempts)
+		}
+	})
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+		if _, err := Acquire(ctx, &mockLocker{freeAt: 1000}, "migrations", time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		if _, err := Acquire(context.Background(), &mockLocker{err: errors.New("did not work")}, "migrations", time.Millisecond); err == nil {
+			t.Error("Expected error")
+		}
+	})
+}
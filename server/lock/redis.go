@@ -0,0 +1,88 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package lock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/offen/offen/server/redis"
+)
+
+// releaseScript deletes the lock only if it is still held by the caller,
+// so a lock that has expired and been acquired by another instance is not
+// released by accident.
+const releaseScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+// refreshScript extends the expiry of the lock if it is still held by
+// the caller.
+const refreshScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`
+
+// NewRedis creates a Locker that stores locks in Redis using the given
+// prefix for all keys. Locks expire after the given TTL unless they are
+// refreshed, which happens automatically while they are held. This makes
+// sure a crashed instance does not hold on to a lock forever.
+func NewRedis(client *redis.Client, prefix string, ttl time.Duration) Locker {
+	return &redisLocker{client: client, prefix: prefix, ttl: ttl}
+}
+
+type redisLocker struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+func (r *redisLocker) Shared() bool {
+	return true
+}
+
+func (r *redisLocker) TryLock(name string) (func(), bool, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, false, fmt.Errorf("lock: error creating token: %w", err)
+	}
+	key, token := r.prefix+name, hex.EncodeToString(b)
+	ttl := strconv.FormatInt(r.ttl.Milliseconds(), 10)
+
+	reply, err := r.client.Do("SET", key, token, "NX", "PX", ttl)
+	if err != nil {
+		return nil, false, fmt.Errorf("lock: error acquiring lock in redis: %w", err)
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(r.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// errors are retried on the next tick, the lock will expire
+				// in case Redis stays unavailable
+				r.client.Do("EVAL", refreshScript, "1", key, token, ttl)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		r.client.Do("EVAL", releaseScript, "1", key, token)
+	}, true, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package lock
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/redis"
+)
+
+// fakeRedis implements the commands used for locking.
+type fakeRedis struct {
+	listener net.Listener
+	mu       sync.Mutex
+	values   map[string]string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	s := &fakeRedis{listener: l, values: map[string]string{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	var args []string
+	for i := 0; i < count; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		length, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		b := make([]byte, length+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args = append(args, string(b[:length]))
+	}
+	return args, nil
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		switch args[0] {
+		case "SET":
+			if _, ok := s.values[args[1]]; ok {
+				fmt.Fprint(conn, "$-1\r\n")
+			} else {
+				s.values[args[1]] = args[2]
+				fmt.Fprint(conn, "+OK\r\n")
+			}
+		case "EVAL":
+			if s.values[args[3]] != args[4] {
+				fmt.Fprint(conn, ":0\r\n")
+			} else {
+				if args[1] == releaseScript {
+					delete(s.values, args[3])
+				}
+				fmt.Fprint(conn, ":1\r\n")
+			}
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command %s\r\n", args[0])
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestRedis(t *testing.T) {
+	s := newFakeRedis(t)
+	defer s.listener.Close()
+
+	client, _ := redis.New("redis://" + s.listener.Addr().String())
+	l := NewRedis(client, "offen-lock-", time.Minute)
+	if !Shared(l) {
+		t.Error("Expected redis locks to be shared")
+	}
+
+	release, acquired, err := l.TryLock("migrations")
+	if err != nil || !acquired {
+		t.Fatalf("Unexpected result %v %v", acquired, err)
+	}
+	if _, acquired, err := l.TryLock("migrations"); acquired || err != nil {
+		t.Errorf("Expected lock to be held, got %v %v", acquired, err)
+	}
+
+	// another instance has taken over the expired lock
+	s.mu.Lock()
+	s.values["offen-lock-migrations"] = "other"
+	s.mu.Unlock()
+	release()
+	s.mu.Lock()
+	if s.values["offen-lock-migrations"] != "other" {
+		t.Error("Expected lock held by other instance not to be released")
+	}
+	delete(s.values, "offen-lock-migrations")
+	s.mu.Unlock()
+
+	release, acquired, _ = l.TryLock("migrations")
+	if !acquired {
+		t.Fatal("Expected lock to be acquired")
+	}
+	release()
+	s.mu.Lock()
+	if _, ok := s.values["offen-lock-migrations"]; ok {
+		t.Error("Expected lock to be released")
+	}
+	s.mu.Unlock()
+}
+
+func TestRedis_Unavailable(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	client, _ := redis.New("redis://" + addr)
+	if _, acquired, err := NewRedis(client, "offen-lock-", time.Minute).TryLock("migrations"); acquired || err == nil {
+		t.Errorf("Expected error, got %v %v", acquired, err)
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package logingest tails the access log of a web server and converts the
+// pageviews it contains into events of an account. This allows counting
+// visitors that block the script, at the cost of less detailed data.
+//
+// Access logs contain personal data, so entries are anonymized before
+// anything is stored. Visitors are told apart by a hash of their IP address
+// and User-Agent header that is salted using a random value which is kept in
+// memory only and replaced each day, so visitors cannot be recognized across
+// days or after restarting. Neither IP addresses nor User-Agent headers are
+// persisted. Query parameters other than campaign parameters are removed
+// from pages, referrers are reduced the same way the script does.
+//
+// Each visitor is represented by a synthetic user whose secret is created
+// by the ingester and encrypted using the public key of the account, so the
+// resulting events can be decrypted by account users like any other event.
+package logingest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/offen/offen/server/botfilter"
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/persistence"
+)
+
+// Database is the subset of persistence.Service needed for ingesting.
+type Database interface {
+	GetAccount(accountID string, styles, events bool, eventsSince string) (persistence.AccountResult, error)
+	AssociateUserSecret(accountID, userID, encryptedUserSecret string) error
+	InsertBatch(userID string, events []persistence.BatchEvent) ([]error, error)
+}
+
+// ErrSkipped is returned by Handle for lines that do not describe a
+// pageview.
+type ErrSkipped string
+
+func (e ErrSkipped) Error() string {
+	return string(e)
+}
+
+// event is the payload of an ingested pageview. It mirrors the events
+// created by the script, leaving out all values that are unknown.
+type event struct {
+	Type          string    `json:"type"`
+	Href          string    `json:"href"`
+	Referrer      string    `json:"referrer"`
+	IsMobile      bool      `json:"isMobile"`
+	Timestamp     time.Time `json:"timestamp"`
+	SessionID     string    `json:"sessionId"`
+	CollectedFrom string    `json:"collectedFrom"`
+}
+
+type visitor struct {
+	userID    string
+	key       []byte
+	sessionID string
+	lastSeen  time.Time
+}
+
+// Ingester converts access log entries into events.
+type Ingester struct {
+	db             Database
+	accountID      string
+	parse          Parser
+	root           string
+	filter         *botfilter.Filter
+	sessionTimeout time.Duration
+	interval       time.Duration
+
+	account  *persistence.AccountResult
+	day      time.Time
+	salt     []byte
+	visitors map[string]*visitor
+}
+
+// Config adds a configuration value to the ingester.
+type Config func(*Ingester)
+
+// WithRoot sets the URL that requested paths are resolved against. It is
+// required for formats that do not log the requested host.
+func WithRoot(root string) Config {
+	return func(i *Ingester) {
+		i.root = strings.TrimSuffix(root, "/")
+	}
+}
+
+// WithFilter sets the filter used for skipping requests issued by bots.
+func WithFilter(f *botfilter.Filter) Config {
+	return func(i *Ingester) {
+		i.filter = f
+	}
+}
+
+// WithInterval sets the interval in which the log file is checked for new
+// lines.
+func WithInterval(d time.Duration) Config {
+	return func(i *Ingester) {
+		i.interval = d
+	}
+}
+
+// New creates an Ingester that stores events in the given account.
+func New(db Database, accountID string, parse Parser, configs ...Config) *Ingester {
+	i := &Ingester{
+		db:             db,
+		accountID:      accountID,
+		parse:          parse,
+		filter:         botfilter.Default(),
+		sessionTimeout: time.Minute * 30,
+		interval:       time.Second,
+		visitors:       map[string]*visitor{},
+	}
+	for _, cfg := range configs {
+		cfg(i)
+	}
+	return i
+}
+
+// Run tails the log file at the given path until the context is cancelled.
+// Only lines appended after calling Run are ingested. Errors are passed to
+// onError and do not stop ingestion.
+func (i *Ingester) Run(ctx context.Context, path string, onError func(error)) {
+	tail(ctx, path, i.interval, func(line string) {
+		var skipped ErrSkipped
+		if err := i.Handle(line); err != nil && !errors.As(err, &skipped) && onError != nil {
+			onError(err)
+		}
+	}, onError)
+}
+
+// Handle ingests a single line of the access log. Lines that do not
+// describe a successful pageview of a human visitor return ErrSkipped.
+func (i *Ingester) Handle(line string) error {
+	entry, err := i.parse(line)
+	if err != nil {
+		return err
+	}
+	if entry.Method != "GET" || entry.Status < 200 || entry.Status > 299 {
+		return ErrSkipped("logingest: not a successful GET request")
+	}
+	if i.filter != nil && i.filter.Match(entry.UserAgent, net.ParseIP(entry.RemoteAddr)) {
+		return ErrSkipped("logingest: request issued by a bot")
+	}
+	href, err := i.href(entry)
+	if err != nil {
+		return err
+	}
+
+	v, err := i.visitor(entry)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(event{
+		Type:          "PAGEVIEW",
+		Href:          href,
+		Referrer:      referrer(entry.Referrer, href),
+		IsMobile:      strings.Contains(entry.UserAgent, "Mobi"),
+		Timestamp:     entry.Time.UTC(),
+		SessionID:     v.sessionID,
+		CollectedFrom: "accesslog",
+	})
+	if err != nil {
+		return fmt.Errorf("logingest: error marshaling event: %w", err)
+	}
+	encrypted, err := keys.EncryptWith(v.key, b)
+	if err != nil {
+		return fmt.Errorf("logingest: error encrypting event: %w", err)
+	}
+	errs, err := i.db.InsertBatch(v.userID, []persistence.BatchEvent{{
+		AccountID:  i.accountID,
+		Payload:    encrypted.Marshal(),
+		RecordedAt: entry.Time,
+	}})
+	if err != nil {
+		return fmt.Errorf("logingest: error inserting event: %w", err)
+	}
+	if errs[0] != nil {
+		return fmt.Errorf("logingest: error inserting event: %w", errs[0])
+	}
+	return nil
+}
+
+// pageExtensions are the file extensions of requests that are considered
+// pageviews, next to requests without any extension.
+var pageExtensions = map[string]bool{
+	".html": true,
+	".htm":  true,
+	".php":  true,
+}
+
+// href returns the URL of the requested page, removing all query parameters
+// except the ones used for tracking campaigns.
+func (i *Ingester) href(entry Entry) (string, error) {
+	u, err := url.ParseRequestURI(entry.URI)
+	if err != nil {
+		return "", ErrSkipped(fmt.Sprintf("logingest: invalid request uri %s", entry.URI))
+	}
+	if ext := strings.ToLower(path.Ext(u.Path)); ext != "" && !pageExtensions[ext] {
+		return "", ErrSkipped("logingest: request for a static asset")
+	}
+
+	root := i.root
+	if root == "" {
+		if entry.Host == "" {
+			return "", errors.New("logingest: cannot resolve requested page without a root url")
+		}
+		root = "https://" + entry.Host
+	}
+	query := url.Values{}
+	for key, values := range u.Query() {
+		if strings.HasPrefix(key, "utm_") {
+			query[key] = values
+		}
+	}
+	href := root + u.Path
+	if len(query) != 0 {
+		href += "?" + query.Encode()
+	}
+	return href, nil
+}
+
+// referrer strips the query parameters from the given referrer the same way
+// the script does. Referrers from the same host as the page are removed.
+func referrer(value, href string) string {
+	r, err := url.Parse(value)
+	if err != nil || !r.IsAbs() {
+		return ""
+	}
+	if h, err := url.Parse(href); err == nil && strings.EqualFold(h.Host, r.Host) {
+		return ""
+	}
+	r.RawQuery = ""
+	r.Fragment = ""
+	r.User = nil
+	return r.String()
+}
+
+// visitor returns the synthetic user for the visitor issuing the given
+// request. Visitors are created on their first request of the day and
+// start a new session after being inactive for the session timeout.
+func (i *Ingester) visitor(entry Entry) (*visitor, error) {
+	day := entry.Time.UTC().Truncate(time.Hour * 24)
+	if i.salt == nil || day.After(i.day) {
+		salt, err := keys.GenerateRandomBytes(keys.DefaultSecretLength)
+		if err != nil {
+			return nil, fmt.Errorf("logingest: error creating salt: %w", err)
+		}
+		i.salt, i.day = salt, day
+		i.visitors = map[string]*visitor{}
+	}
+
+	mac := hmac.New(sha256.New, i.salt)
+	mac.Write([]byte(entry.RemoteAddr))
+	mac.Write([]byte{0})
+	mac.Write([]byte(entry.UserAgent))
+	hash := hex.EncodeToString(mac.Sum(nil))
+
+	v, ok := i.visitors[hash]
+	if !ok {
+		var err error
+		if v, err = i.createVisitor(); err != nil {
+			return nil, err
+		}
+		i.visitors[hash] = v
+	} else if entry.Time.Sub(v.lastSeen) > i.sessionTimeout {
+		sessionID, err := uuid.NewV4()
+		if err != nil {
+			return nil, fmt.Errorf("logingest: error creating session id: %w", err)
+		}
+		v.sessionID = sessionID.String()
+	}
+	if entry.Time.After(v.lastSeen) {
+		v.lastSeen = entry.Time
+	}
+	return v, nil
+}
+
+// createVisitor creates a synthetic user and stores its secret, encrypted
+// using the public key of the account.
+func (i *Ingester) createVisitor() (*visitor, error) {
+	if i.account == nil {
+		account, err := i.db.GetAccount(i.accountID, false, false, "")
+		if err != nil {
+			return nil, fmt.Errorf("logingest: error looking up account: %w", err)
+		}
+		i.account = &account
+	}
+	userID, err := uuid.NewV4()
+	if err != nil {
+		return nil, fmt.Errorf("logingest: error creating user id: %w", err)
+	}
+	sessionID, err := uuid.NewV4()
+	if err != nil {
+		return nil, fmt.Errorf("logingest: error creating session id: %w", err)
+	}
+	key, jwk, err := keys.GenerateUserSecret()
+	if err != nil {
+		return nil, fmt.Errorf("logingest: error creating user key: %w", err)
+	}
+	encryptedSecret, err := keys.EncryptAsymmetricWith(i.account.PublicKey, jwk)
+	if err != nil {
+		return nil, fmt.Errorf("logingest: error encrypting user secret: %w", err)
+	}
+	if err := i.db.AssociateUserSecret(i.accountID, userID.String(), encryptedSecret.Marshal()); err != nil {
+		return nil, fmt.Errorf("logingest: error associating user secret: %w", err)
+	}
+	return &visitor{userID: userID.String(), key: key, sessionID: sessionID.String()}, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package logingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockDatabase struct {
+	Database
+	publicKey jwk.Key
+	secrets   map[string]string
+	inserted  map[string][]persistence.BatchEvent
+}
+
+func (m *mockDatabase) GetAccount(accountID string, styles, events bool, eventsSince string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{AccountID: accountID, PublicKey: m.publicKey}, nil
+}
+
+func (m *mockDatabase) AssociateUserSecret(accountID, userID, encryptedUserSecret string) error {
+	m.secrets[userID] = encryptedUserSecret
+	return nil
+}
+
+func (m *mockDatabase) InsertBatch(userID string, events []persistence.BatchEvent) ([]error, error) {
+	m.inserted[userID] = append(m.inserted[userID], events...)
+	return make([]error, len(events)), nil
+}
+
+func TestIngester_Handle(t *testing.T) {
+	publicKey, _, err := keys.GenerateRSAKeypair(2048)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	set, _ := jwk.ParseString(string(publicKey))
+	key, _ := set.Get(0)
+	db := &mockDatabase{
+		publicKey: key,
+		secrets:   map[string]string{},
+		inserted:  map[string][]persistence.BatchEvent{},
+	}
+	parse, _ := NewParser(FormatCombined)
+	ingester := New(db, "account-a", parse, WithRoot("https://www.example.net/"))
+
+	line := func(ip, t, uri string, status int, referrer, ua string) string {
+		return fmt.Sprintf(`%s - - [%s +0000] "GET %s HTTP/1.1" %d 100 "%s" "%s"`, ip, t, uri, status, referrer, ua)
+	}
+	const browser = "Mozilla/5.0 (iPhone; CPU iPhone OS 15_0 like Mac OS X) Mobile/15E148"
+	lines := []struct {
+		line          string
+		expectSkipped bool
+	}{
+		{line("203.0.113.7", "10/Oct/2022:10:00:00", "/?utm_source=news&token=secret", 200, "https://search.example.com/results?q=offen", browser), false},
+		{line("203.0.113.7", "10/Oct/2022:10:00:01", "/style.css", 200, "https://www.example.net/", browser), true},
+		{line("203.0.113.7", "10/Oct/2022:10:05:00", "/about.html", 200, "https://www.example.net/", browser), false},
+		{line("203.0.113.7", "10/Oct/2022:11:00:00", "/about.html", 200, "-", browser), false},
+		{line("203.0.113.7", "10/Oct/2022:11:00:00", "/missing", 404, "-", browser), true},
+		{line("203.0.113.7", "10/Oct/2022:11:00:00", "/", 200, "-", "Googlebot/2.1 (+http://www.google.com/bot.html)"), true},
+		{line("198.51.100.1", "10/Oct/2022:11:00:00", "/", 200, "-", browser), false},
+		{line("203.0.113.7", "11/Oct/2022:09:00:00", "/", 200, "-", browser), false},
+	}
+	// visitors are forgotten at the end of each day, so their keys are
+	// collected while ingesting
+	var visitorKeys [][]byte
+	for _, l := range lines {
+		err := ingester.Handle(l.line)
+		for _, v := range ingester.visitors {
+			visitorKeys = append(visitorKeys, v.key)
+		}
+		var skipped ErrSkipped
+		if l.expectSkipped != errors.As(err, &skipped) {
+			t.Errorf("Unexpected result %v for line %s", err, l.line)
+		}
+		if !l.expectSkipped && err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+
+	if len(db.secrets) != 3 || len(db.inserted) != 3 {
+		t.Fatalf("Expected 3 visitors, got %d secrets and %d users", len(db.secrets), len(db.inserted))
+	}
+	var returning []persistence.BatchEvent
+	for _, events := range db.inserted {
+		if len(events) == 3 {
+			returning = events
+		}
+	}
+	if returning == nil {
+		t.Fatalf("Expected a visitor with 3 events, got %v", db.inserted)
+	}
+
+	var payloads []map[string]interface{}
+	for _, evt := range returning {
+		if evt.AccountID != "account-a" {
+			t.Errorf("Unexpected account id %v", evt.AccountID)
+		}
+		var b []byte
+		for _, key := range visitorKeys {
+			if b, err = keys.DecryptWith(key, evt.Payload); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		var payload map[string]interface{}
+		json.Unmarshal(b, &payload)
+		payloads = append(payloads, payload)
+	}
+	if payloads[0]["href"] != "https://www.example.net/?utm_source=news" ||
+		payloads[0]["referrer"] != "https://search.example.com/results" ||
+		payloads[0]["isMobile"] != true ||
+		payloads[0]["timestamp"] != "2022-10-10T10:00:00Z" ||
+		payloads[0]["collectedFrom"] != "accesslog" {
+		t.Errorf("Unexpected first event %v", payloads[0])
+	}
+	if payloads[1]["href"] != "https://www.example.net/about.html" || payloads[1]["referrer"] != "" {
+		t.Errorf("Unexpected second event %v", payloads[1])
+	}
+	if payloads[0]["sessionId"] != payloads[1]["sessionId"] || payloads[1]["sessionId"] == payloads[2]["sessionId"] {
+		t.Errorf("Unexpected sessions %v", payloads)
+	}
+	if !returning[2].RecordedAt.Equal(time.Date(2022, 10, 10, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected recorded at %v", returning[2].RecordedAt)
+	}
+}
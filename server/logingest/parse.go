@@ -0,0 +1,192 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package logingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The access log formats that can be parsed.
+const (
+	FormatCombined = "combined"
+	FormatCommon   = "common"
+	FormatCaddy    = "caddy"
+)
+
+// Entry is a single request read from an access log.
+type Entry struct {
+	Time       time.Time
+	RemoteAddr string
+	Method     string
+	// Host is only known for formats that log it, i.e. caddy.
+	Host      string
+	URI       string
+	Status    int
+	Referrer  string
+	UserAgent string
+}
+
+// Parser parses a single line of an access log.
+type Parser func(line string) (Entry, error)
+
+// NewParser returns the parser for the given format:
+//
+// - combined: the default format of nginx and Apache's "combined" format
+// - common: the Common Log Format
+// - caddy: the JSON access logs written by Caddy
+func NewParser(format string) (Parser, error) {
+	switch format {
+	case FormatCombined:
+		return parseCombined, nil
+	case FormatCommon:
+		return parseCommon, nil
+	case FormatCaddy:
+		return parseCaddy, nil
+	default:
+		return nil, fmt.Errorf("logingest: unsupported log format %q", format)
+	}
+}
+
+var (
+	commonLine   = regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) (\S+)(?: [^"]*)?" (\d{3}) \S+`)
+	combinedLine = regexp.MustCompile(commonLine.String() + ` "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)"`)
+)
+
+const commonTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+func parseCommon(line string) (Entry, error) {
+	match := commonLine.FindStringSubmatch(line)
+	if match == nil {
+		return Entry{}, errors.New("logingest: line does not match common log format")
+	}
+	return commonEntry(match)
+}
+
+func parseCombined(line string) (Entry, error) {
+	match := combinedLine.FindStringSubmatch(line)
+	if match == nil {
+		return Entry{}, errors.New("logingest: line does not match combined log format")
+	}
+	entry, err := commonEntry(match)
+	if err != nil {
+		return entry, err
+	}
+	entry.Referrer = unquote(match[6])
+	entry.UserAgent = unquote(match[7])
+	return entry, nil
+}
+
+func commonEntry(match []string) (Entry, error) {
+	t, err := time.Parse(commonTimeLayout, match[2])
+	if err != nil {
+		return Entry{}, fmt.Errorf("logingest: error parsing time: %w", err)
+	}
+	status, err := strconv.Atoi(match[5])
+	if err != nil {
+		return Entry{}, fmt.Errorf("logingest: error parsing status: %w", err)
+	}
+	return Entry{
+		Time:       t,
+		RemoteAddr: match[1],
+		Method:     match[3],
+		URI:        match[4],
+		Status:     status,
+	}, nil
+}
+
+// unquote reverts the escaping of quoted fields, where a dash denotes an
+// empty value.
+func unquote(s string) string {
+	if s == "-" {
+		return ""
+	}
+	s = strings.ReplaceAll(s, `\x22`, `"`)
+	return strings.ReplaceAll(s, `\"`, `"`)
+}
+
+type caddyLine struct {
+	Timestamp json.RawMessage `json:"ts"`
+	Request   struct {
+		RemoteIP   string              `json:"remote_ip"`
+		RemoteAddr string              `json:"remote_addr"`
+		ClientIP   string              `json:"client_ip"`
+		Method     string              `json:"method"`
+		Host       string              `json:"host"`
+		URI        string              `json:"uri"`
+		Headers    map[string][]string `json:"headers"`
+	} `json:"request"`
+	Status int `json:"status"`
+}
+
+func parseCaddy(line string) (Entry, error) {
+	var l caddyLine
+	if err := json.Unmarshal([]byte(line), &l); err != nil {
+		return Entry{}, fmt.Errorf("logingest: error decoding caddy log line: %w", err)
+	}
+	if l.Request.Method == "" || l.Request.URI == "" {
+		return Entry{}, errors.New("logingest: caddy log line does not describe a request")
+	}
+	t, err := caddyTime(l.Timestamp)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	// client_ip respects trusted proxies, remote_addr is used by versions
+	// of caddy before 2.5
+	remoteAddr := l.Request.ClientIP
+	if remoteAddr == "" {
+		remoteAddr = l.Request.RemoteIP
+	}
+	if remoteAddr == "" {
+		remoteAddr = l.Request.RemoteAddr
+		if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+			remoteAddr = host
+		}
+	}
+	header := func(key string) string {
+		for name, values := range l.Request.Headers {
+			if strings.EqualFold(name, key) && len(values) != 0 {
+				return values[0]
+			}
+		}
+		return ""
+	}
+	return Entry{
+		Time:       t,
+		RemoteAddr: remoteAddr,
+		Method:     l.Request.Method,
+		Host:       l.Request.Host,
+		URI:        l.Request.URI,
+		Status:     l.Status,
+		Referrer:   header("Referer"),
+		UserAgent:  header("User-Agent"),
+	}, nil
+}
+
+// caddyTime parses the timestamp of a log line, which is either given as
+// fractional seconds since the epoch or as a RFC3339 string.
+func caddyTime(raw json.RawMessage) (time.Time, error) {
+	var seconds float64
+	if err := json.Unmarshal(raw, &seconds); err == nil {
+		whole, frac := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(frac*1e9)).UTC(), nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return time.Time{}, fmt.Errorf("logingest: error parsing time %s: %w", raw, err)
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("logingest: error parsing time: %w", err)
+	}
+	return t, nil
+}
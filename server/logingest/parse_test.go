@@ -0,0 +1,137 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package logingest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewParser(t *testing.T) {
+	tests := []struct {
+		name          string
+		format        string
+		line          string
+		expectError   bool
+		expectedEntry Entry
+	}{
+		{
+			"combined",
+			FormatCombined,
+			`203.0.113.7 - - [10/Oct/2022:13:55:36 +0200] "GET /about?utm_source=x HTTP/1.1" 200 2326 "https://www.example.com/start?q=1" "Mozilla/5.0 (X11; Linux x86_64) \"quoted\""`,
+			false,
+			Entry{
+				Time:       time.Date(2022, 10, 10, 11, 55, 36, 0, time.UTC),
+				RemoteAddr: "203.0.113.7",
+				Method:     "GET",
+				URI:        "/about?utm_source=x",
+				Status:     200,
+				Referrer:   "https://www.example.com/start?q=1",
+				UserAgent:  `Mozilla/5.0 (X11; Linux x86_64) "quoted"`,
+			},
+		},
+		{
+			"combined without referrer",
+			FormatCombined,
+			`203.0.113.7 - frank [10/Oct/2022:13:55:36 +0000] "POST /form HTTP/2.0" 302 0 "-" "curl/7.82.0"`,
+			false,
+			Entry{
+				Time:       time.Date(2022, 10, 10, 13, 55, 36, 0, time.UTC),
+				RemoteAddr: "203.0.113.7",
+				Method:     "POST",
+				URI:        "/form",
+				Status:     302,
+				UserAgent:  "curl/7.82.0",
+			},
+		},
+		{
+			"combined given common",
+			FormatCombined,
+			`203.0.113.7 - - [10/Oct/2022:13:55:36 +0000] "GET / HTTP/1.1" 200 12`,
+			true,
+			Entry{},
+		},
+		{
+			"common",
+			FormatCommon,
+			`2001:db8::1 - - [10/Oct/2022:13:55:36 +0000] "GET / HTTP/1.1" 404 -`,
+			false,
+			Entry{
+				Time:       time.Date(2022, 10, 10, 13, 55, 36, 0, time.UTC),
+				RemoteAddr: "2001:db8::1",
+				Method:     "GET",
+				URI:        "/",
+				Status:     404,
+			},
+		},
+		{
+			"common bad request",
+			FormatCommon,
+			`203.0.113.7 - - [10/Oct/2022:13:55:36 +0000] "-" 400 0`,
+			true,
+			Entry{},
+		},
+		{
+			"caddy",
+			FormatCaddy,
+			`{"level":"info","ts":1665410136.5,"logger":"http.log.access","msg":"handled request","request":{"remote_ip":"10.0.0.1","remote_port":"41342","client_ip":"203.0.113.7","proto":"HTTP/2.0","method":"GET","host":"www.example.net","uri":"/","headers":{"User-Agent":["Mozilla/5.0"],"Referer":["https://search.example.com/"]}},"status":200}`,
+			false,
+			Entry{
+				Time:       time.Date(2022, 10, 10, 13, 55, 36, 500000000, time.UTC),
+				RemoteAddr: "203.0.113.7",
+				Method:     "GET",
+				Host:       "www.example.net",
+				URI:        "/",
+				Status:     200,
+				Referrer:   "https://search.example.com/",
+				UserAgent:  "Mozilla/5.0",
+			},
+		},
+		{
+			"caddy legacy",
+			FormatCaddy,
+			`{"ts":"2022-10-10T13:55:36Z","request":{"remote_addr":"203.0.113.7:41342","method":"GET","host":"www.example.net","uri":"/"},"status":200}`,
+			false,
+			Entry{
+				Time:       time.Date(2022, 10, 10, 13, 55, 36, 0, time.UTC),
+				RemoteAddr: "203.0.113.7",
+				Method:     "GET",
+				Host:       "www.example.net",
+				URI:        "/",
+				Status:     200,
+			},
+		},
+		{
+			"caddy other logger",
+			FormatCaddy,
+			`{"level":"info","ts":1665410136.5,"logger":"tls","msg":"certificate obtained"}`,
+			true,
+			Entry{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parse, err := NewParser(test.format)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			entry, err := parse(test.line)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !entry.Time.Equal(test.expectedEntry.Time) {
+				t.Errorf("Expected time %v, got %v", test.expectedEntry.Time, entry.Time)
+			}
+			entry.Time, test.expectedEntry.Time = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(test.expectedEntry, entry) {
+				t.Errorf("Expected %v, got %v", test.expectedEntry, entry)
+			}
+		})
+	}
+
+	if _, err := NewParser("w3c"); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package logingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// tailer follows a file the way `tail -F` does. Reading starts at the end of
+// the file, so lines that have been written before are skipped. In case the
+// file is rotated, the new file is read from its beginning.
+type tailer struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+}
+
+func (t *tailer) open(fromStart bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("logingest: error opening %s: %w", t.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("logingest: error reading file info of %s: %w", t.path, err)
+	}
+	var offset int64
+	if !fromStart {
+		if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return fmt.Errorf("logingest: error seeking to end of %s: %w", t.path, err)
+		}
+	}
+	t.file, t.info, t.offset, t.partial = f, info, offset, nil
+	return nil
+}
+
+// poll calls fn for each complete line that has been appended since the last
+// call and checks whether the file has been rotated or truncated.
+func (t *tailer) poll(fn func(line string)) error {
+	if t.file == nil {
+		// the file did not exist when tailing started, so all of its
+		// contents are new
+		if err := t.open(true); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+	}
+	if err := t.read(fn); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("logingest: error reading file info of %s: %w", t.path, err)
+	}
+	if !os.SameFile(info, t.info) {
+		// lines written to the rotated file before it has been renamed have
+		// been read above
+		t.file.Close()
+		t.file = nil
+		if err := t.open(true); err != nil {
+			return err
+		}
+		return t.read(fn)
+	}
+	if info.Size() < t.offset {
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("logingest: error seeking to start of truncated %s: %w", t.path, err)
+		}
+		t.offset, t.partial = 0, nil
+		return t.read(fn)
+	}
+	return nil
+}
+
+func (t *tailer) read(fn func(line string)) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := t.file.Read(buf)
+		t.offset += int64(n)
+		t.partial = append(t.partial, buf[:n]...)
+		for {
+			i := bytes.IndexByte(t.partial, '\n')
+			if i < 0 {
+				break
+			}
+			if line := bytes.TrimRight(t.partial[:i], "\r"); len(line) != 0 {
+				fn(string(line))
+			}
+			t.partial = t.partial[i+1:]
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("logingest: error reading %s: %w", t.path, err)
+		}
+	}
+}
+
+func (t *tailer) close() {
+	if t.file != nil {
+		t.file.Close()
+	}
+}
+
+// tail calls fn for each line appended to the file at the given path until
+// the context is cancelled, checking for new lines in the given interval.
+// Errors are passed to onError and do not stop tailing.
+func tail(ctx context.Context, path string, interval time.Duration, fn func(line string), onError func(error)) {
+	t := &tailer{path: path}
+	defer t.close()
+	if err := t.open(false); err != nil && onError != nil {
+		onError(err)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.poll(fn); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
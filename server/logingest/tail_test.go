@@ -0,0 +1,91 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package logingest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	appendLines := func(s string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		f.WriteString(s)
+		f.Close()
+	}
+
+	var lines []string
+	collect := func(line string) {
+		lines = append(lines, line)
+	}
+	expect := func(expected ...string) {
+		t.Helper()
+		if !reflect.DeepEqual(expected, lines) {
+			t.Errorf("Expected %v, got %v", expected, lines)
+		}
+		lines = nil
+	}
+
+	tl := &tailer{path: path}
+	defer tl.close()
+	if err := tl.open(false); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	appendLines("a\nb\r\npart")
+	if err := tl.poll(collect); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expect("a", "b")
+
+	appendLines("ial\n")
+	tl.poll(collect)
+	expect("partial")
+
+	// rotation
+	appendLines("before rotation\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	tl.poll(collect)
+	expect("before rotation")
+	appendLines("after rotation\n")
+	tl.poll(collect)
+	expect("after rotation")
+
+	// truncation
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	appendLines("c\n")
+	tl.poll(collect)
+	expect("c")
+}
+
+func TestTailer_Missing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	tl := &tailer{path: path}
+	defer tl.close()
+	if err := tl.open(false); err == nil {
+		t.Error("Expected error opening missing file")
+	}
+	var lines []string
+	if err := tl.poll(func(line string) { lines = append(lines, line) }); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	os.WriteFile(path, []byte("a\n"), 0644)
+	tl.poll(func(line string) { lines = append(lines, line) })
+	if !reflect.DeepEqual([]string{"a"}, lines) {
+		t.Errorf("Unexpected lines %v", lines)
+	}
+}
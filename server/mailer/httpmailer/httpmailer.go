@@ -0,0 +1,99 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package httpmailer sends email using the HTTP APIs of hosted email
+// services. Provider specific packages supply a Transport for building
+// requests, while this package takes care of retrying and classifying
+// failed requests.
+package httpmailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/offen/offen/server/mailer"
+)
+
+// Transport creates the HTTP request for sending a single message. It is
+// called once per attempt, so the returned request must not be reused.
+type Transport interface {
+	NewRequest(ctx context.Context, from, to, subject, body string) (*http.Request, error)
+}
+
+// New creates a new Mailer that sends requests created by the given
+// transport, retrying temporary failures up to the given number of times.
+func New(transport Transport, retries int) mailer.Mailer {
+	return &httpMailer{
+		transport: transport,
+		retries:   retries,
+		client:    &http.Client{Timeout: time.Second * 15},
+		newBackOff: func() backoff.BackOff {
+			return backoff.NewExponentialBackOff()
+		},
+	}
+}
+
+type httpMailer struct {
+	transport  Transport
+	retries    int
+	client     *http.Client
+	newBackOff func() backoff.BackOff
+}
+
+func (h *httpMailer) Send(from, to, subject, body string) error {
+	ctx := context.Background()
+	op := func() error {
+		err := h.send(ctx, from, to, subject, body)
+		if err != nil && !mailer.IsTemporary(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}
+	b := backoff.WithContext(
+		backoff.WithMaxRetries(h.newBackOff(), uint64(h.retries)), ctx,
+	)
+	if err := backoff.Retry(op, b); err != nil {
+		var permanent *backoff.PermanentError
+		if errors.As(err, &permanent) {
+			err = permanent.Err
+		}
+		return fmt.Errorf("httpmailer: error sending email: %w", err)
+	}
+	return nil
+}
+
+func (h *httpMailer) send(ctx context.Context, from, to, subject, body string) error {
+	req, err := h.transport.NewRequest(ctx, from, to, subject, body)
+	if err != nil {
+		return fmt.Errorf("httpmailer: error creating request: %w", err)
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return mailer.NewError(mailer.ErrTemporary, fmt.Errorf("httpmailer: error performing request: %w", err))
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return mailer.NewError(
+		classifyStatus(res.StatusCode),
+		fmt.Errorf("httpmailer: api returned status %d: %s", res.StatusCode, string(b)),
+	)
+}
+
+func classifyStatus(status int) error {
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return mailer.ErrUnauthorized
+	case status == http.StatusRequestTimeout, status == http.StatusTooManyRequests, status >= 500:
+		return mailer.ErrTemporary
+	default:
+		return mailer.ErrRejected
+	}
+}
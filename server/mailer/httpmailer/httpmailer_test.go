@@ -0,0 +1,102 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package httpmailer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/offen/offen/server/mailer"
+)
+
+type mockTransport struct {
+	url string
+}
+
+func (m *mockTransport) NewRequest(ctx context.Context, from, to, subject, body string) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodPost, m.url, nil)
+}
+
+func TestHTTPMailer_Send(t *testing.T) {
+	tests := []struct {
+		name             string
+		statuses         []int
+		expectedErr      error
+		expectedAttempts int
+	}{
+		{
+			"ok",
+			[]int{http.StatusAccepted},
+			nil,
+			1,
+		},
+		{
+			"temporary error is retried",
+			[]int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK},
+			nil,
+			3,
+		},
+		{
+			"retries exhausted",
+			[]int{http.StatusServiceUnavailable},
+			mailer.ErrTemporary,
+			3,
+		},
+		{
+			"unauthorized",
+			[]int{http.StatusUnauthorized},
+			mailer.ErrUnauthorized,
+			1,
+		},
+		{
+			"rejected",
+			[]int{http.StatusBadRequest, http.StatusOK},
+			mailer.ErrRejected,
+			1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := test.statuses[len(test.statuses)-1]
+				if attempts < len(test.statuses) {
+					status = test.statuses[attempts]
+				}
+				attempts++
+				w.WriteHeader(status)
+			}))
+			defer ts.Close()
+
+			m := New(&mockTransport{url: ts.URL}, 2).(*httpMailer)
+			m.newBackOff = func() backoff.BackOff {
+				return &backoff.ZeroBackOff{}
+			}
+
+			err := m.Send("from@offen.dev", "to@offen.dev", "subject", "body")
+			if test.expectedErr == nil {
+				if err != nil {
+					t.Errorf("Unexpected error %v", err)
+				}
+			} else if !errors.Is(err, test.expectedErr) {
+				t.Errorf("Expected error to be %v, got %v", test.expectedErr, err)
+			}
+			if attempts != test.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", test.expectedAttempts, attempts)
+			}
+		})
+	}
+	t.Run("network error", func(t *testing.T) {
+		ts := httptest.NewServer(http.NotFoundHandler())
+		ts.Close()
+		m := New(&mockTransport{url: ts.URL}, 0)
+		if err := m.Send("from@offen.dev", "to@offen.dev", "subject", "body"); !mailer.IsTemporary(err) {
+			t.Errorf("Expected temporary error, got %v", err)
+		}
+	})
+}
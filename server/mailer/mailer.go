@@ -3,7 +3,49 @@
 
 package mailer
 
+import (
+	"errors"
+	"fmt"
+)
+
 // Mailer is used to send transactional emails
 type Mailer interface {
 	Send(from, to, subject, body string) error
 }
+
+// HealthChecker is implemented by mailers that are able to check whether
+// their transport can be reached without sending a message.
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// AuthChecker is implemented by mailers that are able to check whether
+// their credentials are accepted without sending a message.
+type AuthChecker interface {
+	CheckAuth() error
+}
+
+// Errors returned by a Mailer wrap one of the following values so that callers
+// can tell apart failures that might go away when retrying from those that
+// will not.
+var (
+	// ErrTemporary signals the transport could not be reached or asked
+	// for the message to be sent again later.
+	ErrTemporary = errors.New("mailer: temporary failure")
+	// ErrUnauthorized signals the transport rejected the given credentials.
+	ErrUnauthorized = errors.New("mailer: unauthorized")
+	// ErrRejected signals the transport refused to accept the message, e.g.
+	// because of an invalid sender or recipient.
+	ErrRejected = errors.New("mailer: message rejected")
+)
+
+// NewError wraps err so that it matches kind when using errors.Is
+func NewError(kind, err error) error {
+	return fmt.Errorf("%w: %w", kind, err)
+}
+
+// IsTemporary returns true if err is a failure that might be resolved by
+// trying again later.
+func IsTemporary(err error) bool {
+	return errors.Is(err, ErrTemporary)
+}
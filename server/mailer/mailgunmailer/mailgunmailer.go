@@ -0,0 +1,55 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package mailgunmailer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/mailer/httpmailer"
+)
+
+// New creates a new Mailer that sends email using the Mailgun API. Passing
+// "eu" as the region uses Mailgun's EU infrastructure.
+func New(domain, apiKey, region string, retries int) mailer.Mailer {
+	baseURL := "https://api.mailgun.net"
+	if strings.EqualFold(region, "eu") {
+		baseURL = "https://api.eu.mailgun.net"
+	}
+	return httpmailer.New(&transport{
+		baseURL: baseURL,
+		domain:  domain,
+		apiKey:  apiKey,
+	}, retries)
+}
+
+type transport struct {
+	baseURL string
+	domain  string
+	apiKey  string
+}
+
+func (t *transport) NewRequest(ctx context.Context, from, to, subject, body string) (*http.Request, error) {
+	form := url.Values{}
+	form.Set("from", from)
+	form.Set("to", to)
+	form.Set("subject", subject)
+	form.Set("text", body)
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost,
+		fmt.Sprintf("%s/v3/%s/messages", t.baseURL, url.PathEscape(t.domain)),
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("mailgunmailer: error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("api", t.apiKey)
+	return req, nil
+}
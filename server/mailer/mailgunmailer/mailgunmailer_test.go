@@ -0,0 +1,36 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package mailgunmailer
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTransport_NewRequest(t *testing.T) {
+	tr := &transport{baseURL: "https://mailgun.local", domain: "mg.offen.dev", apiKey: "key"}
+	req, err := tr.NewRequest(context.Background(), "no-reply@offen.dev", "develop@offen.dev", "subject", "body")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if req.URL.String() != "https://mailgun.local/v3/mg.offen.dev/messages" {
+		t.Errorf("Unexpected URL %v", req.URL)
+	}
+	if user, pass, ok := req.BasicAuth(); !ok || user != "api" || pass != "key" {
+		t.Errorf("Unexpected basic auth %v %v", user, pass)
+	}
+	if err := req.ParseForm(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for key, value := range map[string]string{
+		"from":    "no-reply@offen.dev",
+		"to":      "develop@offen.dev",
+		"subject": "subject",
+		"text":    "body",
+	} {
+		if req.PostForm.Get(key) != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, req.PostForm.Get(key))
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package sendgridmailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+
+	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/mailer/httpmailer"
+)
+
+// New creates a new Mailer that sends email using the Sendgrid v3 API
+func New(apiKey string, retries int) mailer.Mailer {
+	return httpmailer.New(&transport{
+		baseURL: "https://api.sendgrid.com",
+		apiKey:  apiKey,
+	}, retries)
+}
+
+type transport struct {
+	baseURL string
+	apiKey  string
+}
+
+type address struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type personalization struct {
+	To []address `json:"to"`
+}
+
+type content struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendRequest struct {
+	Personalizations []personalization `json:"personalizations"`
+	From             address           `json:"from"`
+	Subject          string            `json:"subject"`
+	Content          []content         `json:"content"`
+}
+
+func parseAddress(s string) (address, error) {
+	a, err := mail.ParseAddress(s)
+	if err != nil {
+		return address{}, mailer.NewError(mailer.ErrRejected, fmt.Errorf("sendgridmailer: error parsing address %s: %w", s, err))
+	}
+	return address{Email: a.Address, Name: a.Name}, nil
+}
+
+func (t *transport) NewRequest(ctx context.Context, from, to, subject, body string) (*http.Request, error) {
+	fromAddress, err := parseAddress(from)
+	if err != nil {
+		return nil, err
+	}
+	toAddress, err := parseAddress(to)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(sendRequest{
+		Personalizations: []personalization{{To: []address{toAddress}}},
+		From:             fromAddress,
+		Subject:          subject,
+		Content:          []content{{Type: "text/plain", Value: body}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sendgridmailer: error encoding payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, fmt.Sprintf("%s/v3/mail/send", t.baseURL), bytes.NewReader(payload),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("sendgridmailer: error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", t.apiKey))
+	return req, nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package sendgridmailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/offen/offen/server/mailer"
+)
+
+func TestTransport_NewRequest(t *testing.T) {
+	tr := &transport{baseURL: "https://sendgrid.local", apiKey: "key"}
+	t.Run("ok", func(t *testing.T) {
+		req, err := tr.NewRequest(context.Background(), "Offen <no-reply@offen.dev>", "develop@offen.dev", "subject", "body")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if req.URL.String() != "https://sendgrid.local/v3/mail/send" {
+			t.Errorf("Unexpected URL %v", req.URL)
+		}
+		if auth := req.Header.Get("Authorization"); auth != "Bearer key" {
+			t.Errorf("Unexpected Authorization header %v", auth)
+		}
+		var payload sendRequest
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		expected := sendRequest{
+			Personalizations: []personalization{{To: []address{{Email: "develop@offen.dev"}}}},
+			From:             address{Email: "no-reply@offen.dev", Name: "Offen"},
+			Subject:          "subject",
+			Content:          []content{{Type: "text/plain", Value: "body"}},
+		}
+		if !reflect.DeepEqual(expected, payload) {
+			t.Errorf("Expected %v, got %v", expected, payload)
+		}
+	})
+	t.Run("bad address", func(t *testing.T) {
+		_, err := tr.NewRequest(context.Background(), "no-reply@offen.dev", "zomfg", "subject", "body")
+		if !errors.Is(err, mailer.ErrRejected) {
+			t.Errorf("Expected rejected error, got %v", err)
+		}
+	})
+}
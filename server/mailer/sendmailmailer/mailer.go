@@ -35,6 +35,12 @@ func (s *sendmailMailer) Send(from, to, subject, body string) error {
 	return nil
 }
 
+// CheckHealth checks whether a sendmail binary is available.
+func (s *sendmailMailer) CheckHealth() error {
+	_, err := lookupSendmail()
+	return err
+}
+
 func submitMail(m *gomail.Message) error {
 	// see: https://stackoverflow.com/a/35521846/797194
 	bin, err := lookupSendmail()
@@ -0,0 +1,75 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package sesmailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/mailer/httpmailer"
+	"github.com/offen/offen/server/sigv4"
+)
+
+// New creates a new Mailer that sends email using the Amazon SES v2 API in
+// the given region.
+func New(region, accessKeyID, secretAccessKey string, retries int) mailer.Mailer {
+	return httpmailer.New(&transport{
+		baseURL: fmt.Sprintf("https://email.%s.amazonaws.com", region),
+		signer: sigv4.New(sigv4.Credentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+		}, region, "ses"),
+	}, retries)
+}
+
+type transport struct {
+	baseURL string
+	signer  *sigv4.Signer
+}
+
+type data struct {
+	Data string `json:"Data"`
+}
+
+type sendEmailRequest struct {
+	FromEmailAddress string `json:"FromEmailAddress"`
+	Destination      struct {
+		ToAddresses []string `json:"ToAddresses"`
+	} `json:"Destination"`
+	Content struct {
+		Simple struct {
+			Subject data `json:"Subject"`
+			Body    struct {
+				Text data `json:"Text"`
+			} `json:"Body"`
+		} `json:"Simple"`
+	} `json:"Content"`
+}
+
+func (t *transport) NewRequest(ctx context.Context, from, to, subject, body string) (*http.Request, error) {
+	var r sendEmailRequest
+	r.FromEmailAddress = from
+	r.Destination.ToAddresses = []string{to}
+	r.Content.Simple.Subject.Data = subject
+	r.Content.Simple.Body.Text.Data = body
+
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("sesmailer: error encoding payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, fmt.Sprintf("%s/v2/email/outbound-emails", t.baseURL), bytes.NewReader(payload),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("sesmailer: error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	t.signer.Sign(req, payload)
+	return req, nil
+}
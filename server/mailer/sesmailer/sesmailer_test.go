@@ -0,0 +1,58 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package sesmailer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/sigv4"
+)
+
+func TestTransport_NewRequest(t *testing.T) {
+	tr := &transport{
+		baseURL: "https://ses.local",
+		signer:  sigv4.New(sigv4.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"}, "eu-west-1", "ses"),
+	}
+	req, err := tr.NewRequest(context.Background(), "no-reply@offen.dev", "develop@offen.dev", "subject", "body")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if req.URL.String() != "https://ses.local/v2/email/outbound-emails" {
+		t.Errorf("Unexpected URL %v", req.URL)
+	}
+	if req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected content type %v", req.Header.Get("Content-Type"))
+	}
+
+	var payload sendEmailRequest
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	var expected sendEmailRequest
+	expected.FromEmailAddress = "no-reply@offen.dev"
+	expected.Destination.ToAddresses = []string{"develop@offen.dev"}
+	expected.Content.Simple.Subject.Data = "subject"
+	expected.Content.Simple.Body.Text.Data = "body"
+	if !reflect.DeepEqual(expected, payload) {
+		t.Errorf("Expected %v, got %v", expected, payload)
+	}
+
+	date := req.Header.Get("X-Amz-Date")
+	if _, err := time.Parse("20060102T150405Z", date); err != nil {
+		t.Fatalf("Unexpected date header %v", date)
+	}
+	authorization := regexp.MustCompile(fmt.Sprintf(
+		`^AWS4-HMAC-SHA256 Credential=key/%s/eu-west-1/ses/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=[0-9a-f]{64}$`,
+		date[:8],
+	))
+	if auth := req.Header.Get("Authorization"); !authorization.MatchString(auth) {
+		t.Errorf("Unexpected authorization header %v", auth)
+	}
+}
@@ -4,6 +4,13 @@
 package smtpmailer
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"time"
+
 	"github.com/go-gomail/gomail"
 	"github.com/offen/offen/server/mailer"
 )
@@ -24,5 +31,49 @@ func (s *smtpMailer) Send(from, to, subject, body string) error {
 	m.SetHeader("To", to)
 	m.SetHeader("Subject", subject)
 	m.SetBody("text/plain", body)
-	return s.DialAndSend(m)
+	if err := s.DialAndSend(m); err != nil {
+		return mailer.NewError(classifyError(err), fmt.Errorf("smtpmailer: error sending email: %w", err))
+	}
+	return nil
+}
+
+// CheckHealth checks whether the configured SMTP server accepts connections.
+func (s *smtpMailer) CheckHealth() error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.Host, strconv.Itoa(s.Port)), 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("smtpmailer: error connecting to server: %w", err)
+	}
+	return conn.Close()
+}
+
+// CheckAuth connects to the configured SMTP server and authenticates using
+// the configured credentials.
+func (s *smtpMailer) CheckAuth() error {
+	conn, err := s.Dial()
+	if err != nil {
+		return mailer.NewError(classifyError(err), fmt.Errorf("smtpmailer: error authenticating: %w", err))
+	}
+	return conn.Close()
+}
+
+// classifyError maps SMTP reply codes onto the error kinds defined in
+// package mailer. 4xx replies are transient by definition, 535 signals
+// failed authentication.
+func classifyError(err error) error {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		switch {
+		case protoErr.Code == 535:
+			return mailer.ErrUnauthorized
+		case protoErr.Code >= 400 && protoErr.Code < 500:
+			return mailer.ErrTemporary
+		default:
+			return mailer.ErrRejected
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return mailer.ErrTemporary
+	}
+	return mailer.ErrRejected
 }
@@ -0,0 +1,216 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TemplateSamples contains the names of all email templates mapped to
+// the data used for validating them and rendering previews. Emails consist
+// of a subject and a body template, named `subject_<email>` and `body_<email>`.
+var TemplateSamples = map[string]interface{}{
+	"reset_password": map[string]string{
+		"url": "https://offen.example.com/reset-password/?token=example",
+	},
+	"login_locked": map[string]string{
+		"until": time.Date(2022, 3, 4, 12, 0, 0, 0, time.UTC).Format(time.RFC1123),
+	},
+	"new_user_invite": map[string]interface{}{
+		"url": "https://offen.example.com/join/?token=example",
+	},
+	"existing_user_invite": map[string]interface{}{
+		"accountNames": []string{"Example Account"},
+	},
+}
+
+// Templates contains the email templates for all available locales. In case
+// a directory is given, template files found in it are applied on top of the
+// built-in templates. Files placed in the directory itself apply to all
+// locales, files placed in a subdirectory named after a locale apply to this
+// locale only.
+type Templates struct {
+	base     map[string]*template.Template
+	fallback string
+	dir      string
+	current  atomic.Pointer[map[string]*template.Template]
+}
+
+// NewTemplates loads the email templates for the given built-in templates
+// and overrides in dir. Unknown locales use the templates of fallback.
+func NewTemplates(base map[string]*template.Template, fallback, dir string) (*Templates, error) {
+	if _, ok := base[fallback]; !ok {
+		return nil, fmt.Errorf("mailer: no templates given for fallback locale %s", fallback)
+	}
+	t := &Templates{base: base, fallback: fallback, dir: dir}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Lookup returns the email templates for the given locale.
+func (t *Templates) Lookup(locale string) *template.Template {
+	current := *t.current.Load()
+	if tpl, ok := current[locale]; ok {
+		return tpl
+	}
+	return current[t.fallback]
+}
+
+// Render renders the subject and the body of the given email in the given
+// locale.
+func (t *Templates) Render(locale, email string, data interface{}) (string, string, error) {
+	subject, body, err := render(t.Lookup(locale), email, data)
+	if err != nil {
+		return "", "", fmt.Errorf("mailer: %w", err)
+	}
+	return subject, body, nil
+}
+
+// Reload reads all overrides again. In case any of the resulting templates
+// is invalid, an error is returned and the current templates are kept.
+func (t *Templates) Reload() error {
+	next := map[string]*template.Template{}
+	for locale, base := range t.base {
+		tpl, err := t.load(locale, base)
+		if err != nil {
+			return err
+		}
+		next[locale] = tpl
+	}
+	t.current.Store(&next)
+	return nil
+}
+
+// Watch reloads the templates each time a file in the overrides directory
+// is changed. The directory is checked in the given interval until ctx is
+// cancelled. The result of each reload is passed to onReload.
+func (t *Templates) Watch(ctx context.Context, interval time.Duration, onReload func(error)) {
+	if t.dir == "" {
+		return
+	}
+	last := t.modTime()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if next := t.modTime(); next != last {
+				last = next
+				onReload(t.Reload())
+			}
+		}
+	}
+}
+
+func (t *Templates) modTime() string {
+	files, _ := t.files("")
+	for locale := range t.base {
+		localeFiles, _ := t.files(locale)
+		files = append(files, localeFiles...)
+	}
+	var result []string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		result = append(result, fmt.Sprintf("%s@%d", file, info.ModTime().UnixNano()))
+	}
+	sort.Strings(result)
+	return strings.Join(result, ",")
+}
+
+// files returns the override files for the given locale, or the files
+// applying to all locales in case locale is empty.
+func (t *Templates) files(locale string) ([]string, error) {
+	if t.dir == "" {
+		return nil, nil
+	}
+	files, err := filepath.Glob(filepath.Join(t.dir, locale, "*.go.html"))
+	if err != nil {
+		return nil, fmt.Errorf("mailer: error looking up template files: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (t *Templates) load(locale string, base *template.Template) (*template.Template, error) {
+	shared, err := t.files("")
+	if err != nil {
+		return nil, err
+	}
+	localized, err := t.files(locale)
+	if err != nil {
+		return nil, err
+	}
+	files := append(shared, localized...)
+
+	// templates cannot be parsed or cloned anymore after they have been
+	// executed, so base is never used as is
+	tpl, err := base.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("mailer: error cloning templates: %w", err)
+	}
+	if len(files) == 0 {
+		return tpl, nil
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("mailer: error reading template file %s: %w", file, err)
+		}
+		if tpl, err = tpl.Parse(string(b)); err != nil {
+			return nil, fmt.Errorf("mailer: error parsing template file %s: %w", file, err)
+		}
+	}
+	if err := validate(tpl); err != nil {
+		return nil, fmt.Errorf("mailer: invalid templates for locale %s: %w", locale, err)
+	}
+	return tpl, nil
+}
+
+// validate checks that the given templates do not define unknown templates
+// and that all emails can be rendered using sample data.
+func validate(tpl *template.Template) error {
+	known := map[string]bool{tpl.Name(): true}
+	for email := range TemplateSamples {
+		known["subject_"+email] = true
+		known["body_"+email] = true
+	}
+	for _, t := range tpl.Templates() {
+		if !known[t.Name()] {
+			return fmt.Errorf("unknown template %s", t.Name())
+		}
+	}
+	for email, data := range TemplateSamples {
+		if _, _, err := render(tpl, email, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func render(tpl *template.Template, email string, data interface{}) (string, string, error) {
+	subject, body := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	for name, w := range map[string]io.Writer{"subject_" + email: subject, "body_" + email: body} {
+		if err := tpl.ExecuteTemplate(w, name, data); err != nil {
+			return "", "", fmt.Errorf("error rendering template %s: %w", name, err)
+		}
+	}
+	return subject.String(), body.String(), nil
+}
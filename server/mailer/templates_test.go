@@ -0,0 +1,107 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package mailer
+
+import (
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const baseTemplates = `
+{{ define "subject_reset_password" }}Reset{{ end }}
+{{ define "body_reset_password" }}Reset at {{ .url }}{{ end }}
+{{ define "subject_login_locked" }}Locked{{ end }}
+{{ define "body_login_locked" }}Locked until {{ .until }}{{ end }}
+{{ define "subject_new_user_invite" }}Invite{{ end }}
+{{ define "body_new_user_invite" }}Join at {{ .url }}{{ end }}
+{{ define "subject_existing_user_invite" }}Added{{ end }}
+{{ define "body_existing_user_invite" }}Added to {{ range .accountNames }}{{ . }}{{ end }}{{ end }}
+`
+
+func newBase(locales ...string) map[string]*template.Template {
+	result := map[string]*template.Template{}
+	for _, locale := range locales {
+		result[locale] = template.Must(template.New("email_template").Parse(baseTemplates))
+	}
+	return result
+}
+
+func writeFile(t *testing.T, location, content string) {
+	if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := os.WriteFile(location, []byte(content), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	t.Run("no overrides", func(t *testing.T) {
+		tpl, err := NewTemplates(newBase("en"), "en", "")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		subject, body, err := tpl.Render("de", "reset_password", map[string]string{"url": "https://x"})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if subject != "Reset" || body != "Reset at https://x" {
+			t.Errorf("Unexpected result %v %v", subject, body)
+		}
+	})
+	t.Run("overrides", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "reset.go.html"), `{{ define "subject_reset_password" }}Custom reset{{ end }}`)
+		writeFile(t, filepath.Join(dir, "de", "reset.go.html"), `{{ define "body_reset_password" }}Hier: {{ .url }}{{ end }}`)
+		tpl, err := NewTemplates(newBase("en", "de"), "en", dir)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		subject, body, _ := tpl.Render("en", "reset_password", map[string]string{"url": "https://x"})
+		if subject != "Custom reset" || body != "Reset at https://x" {
+			t.Errorf("Unexpected result %v %v", subject, body)
+		}
+		subject, body, _ = tpl.Render("de", "reset_password", map[string]string{"url": "https://x"})
+		if subject != "Custom reset" || body != "Hier: https://x" {
+			t.Errorf("Unexpected result %v %v", subject, body)
+		}
+	})
+	t.Run("unknown template", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "typo.go.html"), `{{ define "subject_reset_pasword" }}Oops{{ end }}`)
+		if _, err := NewTemplates(newBase("en"), "en", dir); err == nil || !strings.Contains(err.Error(), "subject_reset_pasword") {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("reload keeps valid templates", func(t *testing.T) {
+		dir := t.TempDir()
+		tpl, err := NewTemplates(newBase("en"), "en", dir)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		writeFile(t, filepath.Join(dir, "broken.go.html"), `{{ define "subject_login_locked" }}{{ .until.Nope }}{{ end }}`)
+		if err := tpl.Reload(); err == nil {
+			t.Error("Expected error reloading invalid template")
+		}
+		if subject, _, _ := tpl.Render("en", "login_locked", TemplateSamples["login_locked"]); subject != "Locked" {
+			t.Errorf("Unexpected subject %v", subject)
+		}
+
+		writeFile(t, filepath.Join(dir, "broken.go.html"), `{{ define "subject_login_locked" }}Blocked{{ end }}`)
+		if err := tpl.Reload(); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if subject, _, _ := tpl.Render("en", "login_locked", TemplateSamples["login_locked"]); subject != "Blocked" {
+			t.Errorf("Unexpected subject %v", subject)
+		}
+	})
+	t.Run("unknown fallback", func(t *testing.T) {
+		if _, err := NewTemplates(newBase("en"), "de", ""); err == nil {
+			t.Error("Expected error")
+		}
+	})
+}
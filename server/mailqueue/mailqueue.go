@@ -0,0 +1,94 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package mailqueue delivers transactional email in the background so that
+// slow mail transports do not block request handlers.
+package mailqueue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/persistence"
+)
+
+// Queue is a mailer.Mailer that persists mails instead of sending them
+// right away. Persisted mails are delivered using Transport when calling
+// Deliver or Run.
+type Queue struct {
+	DB        persistence.Service
+	Transport mailer.Mailer
+	// MaxAttempts is the number of times delivery of a mail is attempted
+	// before it is marked as failed. Mails that are rejected by the
+	// transport are marked as failed right away.
+	MaxAttempts int
+	mu          sync.RWMutex
+}
+
+// SetTransport replaces the transport used for delivering mails, e.g.
+// after credentials have been changed. It is safe to call while mails are
+// being delivered.
+func (q *Queue) SetTransport(m mailer.Mailer) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.Transport = m
+}
+
+func (q *Queue) transport() mailer.Mailer {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.Transport
+}
+
+// Send queues the given mail for delivery.
+func (q *Queue) Send(from, to, subject, body string) error {
+	if err := q.DB.EnqueueMail(from, to, subject, body); err != nil {
+		return fmt.Errorf("mailqueue: error queueing mail: %w", err)
+	}
+	return nil
+}
+
+// CheckHealth checks the health of the underlying transport in case it
+// supports it.
+func (q *Queue) CheckHealth() error {
+	if checker, ok := q.transport().(mailer.HealthChecker); ok {
+		return checker.CheckHealth()
+	}
+	return nil
+}
+
+// Deliver sends all mails that are currently due and returns the number
+// of mails that have been delivered.
+func (q *Queue) Deliver() (int, error) {
+	delivered, err := q.DB.DeliverQueuedMails(q.transport(), q.MaxAttempts)
+	if err != nil {
+		return delivered, fmt.Errorf("mailqueue: error delivering mails: %w", err)
+	}
+	return delivered, nil
+}
+
+// Run calls Deliver in the given interval until the context is cancelled.
+func (q *Queue) Run(ctx context.Context, interval time.Duration, onDelivered func(int), onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			delivered, err := q.Deliver()
+			if err != nil {
+				if onError != nil {
+					onError(err)
+				}
+				continue
+			}
+			if delivered != 0 && onDelivered != nil {
+				onDelivered(delivered)
+			}
+		}
+	}
+}
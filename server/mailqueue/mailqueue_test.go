@@ -0,0 +1,93 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package mailqueue
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockQueueDatabase struct {
+	persistence.Service
+	enqueued    []string
+	enqueueErr  error
+	transport   mailer.Mailer
+	maxAttempts int
+	deliverErr  error
+}
+
+func (m *mockQueueDatabase) EnqueueMail(from, to, subject, body string) error {
+	m.enqueued = append(m.enqueued, to)
+	return m.enqueueErr
+}
+
+func (m *mockQueueDatabase) DeliverQueuedMails(transport mailer.Mailer, maxAttempts int) (int, error) {
+	m.transport = transport
+	m.maxAttempts = maxAttempts
+	return len(m.enqueued), m.deliverErr
+}
+
+type mockMailer struct{}
+
+func (*mockMailer) Send(from, to, subject, body string) error {
+	return nil
+}
+
+func TestQueue(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		db := &mockQueueDatabase{}
+		transport := &mockMailer{}
+		q := &Queue{DB: db, Transport: transport, MaxAttempts: 4}
+		if err := q.Send("no-reply@offen.dev", "develop@offen.dev", "subject", "body"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		delivered, err := q.Deliver()
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if delivered != 1 {
+			t.Errorf("Unexpected number of delivered mails %d", delivered)
+		}
+		if db.transport != transport || db.maxAttempts != 4 {
+			t.Errorf("Unexpected delivery parameters %v, %d", db.transport, db.maxAttempts)
+		}
+	})
+	t.Run("errors", func(t *testing.T) {
+		db := &mockQueueDatabase{
+			enqueueErr: errors.New("did not work"),
+			deliverErr: errors.New("did not work"),
+		}
+		q := &Queue{DB: db, Transport: &mockMailer{}}
+		if err := q.Send("no-reply@offen.dev", "develop@offen.dev", "subject", "body"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if _, err := q.Deliver(); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
+
+type mockCheckingMailer struct {
+	mockMailer
+	err error
+}
+
+func (m *mockCheckingMailer) CheckHealth() error {
+	return m.err
+}
+
+func TestQueue_CheckHealth(t *testing.T) {
+	if err := (&Queue{Transport: &mockMailer{}}).CheckHealth(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := (&Queue{Transport: &mockCheckingMailer{}}).CheckHealth(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := (&Queue{Transport: &mockCheckingMailer{err: errors.New("did not work")}}).CheckHealth(); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
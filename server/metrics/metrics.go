@@ -0,0 +1,263 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package metrics collects counters and histograms and exposes them in the
+// Prometheus text format. All methods are safe to call on nil values, so
+// callers do not need to check whether metrics are enabled.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets used for measuring durations in
+// seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+const (
+	kindCounter   = "counter"
+	kindHistogram = "histogram"
+)
+
+// Registry holds all metrics of an application.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// New creates an empty Registry.
+func New() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	count       uint64
+}
+
+func (r *Registry) family(name, help, kind string, buckets []float64, labels []string) *family {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		if f.kind != kind {
+			panic(fmt.Sprintf("metrics: %s is already registered as a %s", name, f.kind))
+		}
+		return f
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  map[string]*series{},
+	}
+	r.families[name] = f
+	return f
+}
+
+// lookup returns the series for the given label values. The caller is
+// expected to hold the registry's lock.
+func (f *family) lookup(labelValues []string) *series {
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == kindHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter is a value that only ever increases.
+type Counter struct {
+	registry *Registry
+	family   *family
+}
+
+// Counter returns the counter of the given name, registering it in case it
+// does not exist yet.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	if r == nil {
+		return nil
+	}
+	return &Counter{r, r.family(name, help, kindCounter, nil, labels)}
+}
+
+// Add adds v to the counter for the given label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if c == nil {
+		return
+	}
+	c.registry.mu.Lock()
+	defer c.registry.mu.Unlock()
+	c.family.lookup(labelValues).value += v
+}
+
+// Inc increments the counter for the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Histogram counts observed values in buckets.
+type Histogram struct {
+	registry *Registry
+	family   *family
+}
+
+// Histogram returns the histogram of the given name, registering it in case
+// it does not exist yet.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if r == nil {
+		return nil
+	}
+	return &Histogram{r, r.family(name, help, kindHistogram, buckets, labels)}
+}
+
+// Observe records the given value for the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+	h.registry.mu.Lock()
+	defer h.registry.mu.Unlock()
+	s := h.family.lookup(labelValues)
+	for i, upper := range h.family.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+// WriteTo writes all metrics in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	if r == nil {
+		return 0, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(cw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(cw, "# TYPE %s %s\n", f.name, f.kind)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			labels := formatLabels(f.labels, s.labelValues)
+			switch f.kind {
+			case kindCounter:
+				fmt.Fprintf(cw, "%s%s %s\n", f.name, wrapLabels(labels), formatFloat(s.value))
+			case kindHistogram:
+				for i, upper := range f.buckets {
+					fmt.Fprintf(
+						cw, "%s_bucket%s %d\n", f.name,
+						wrapLabels(appendLabel(labels, "le", formatFloat(upper))), s.counts[i],
+					)
+				}
+				fmt.Fprintf(cw, "%s_bucket%s %d\n", f.name, wrapLabels(appendLabel(labels, "le", "+Inf")), s.count)
+				fmt.Fprintf(cw, "%s_sum%s %s\n", f.name, wrapLabels(labels), formatFloat(s.value))
+				fmt.Fprintf(cw, "%s_count%s %d\n", f.name, wrapLabels(labels), s.count)
+			}
+		}
+	}
+	if cw.err != nil {
+		return cw.n, fmt.Errorf("metrics: error writing metrics: %w", cw.err)
+	}
+	if err := cw.w.Flush(); err != nil {
+		return cw.n, fmt.Errorf("metrics: error flushing metrics: %w", err)
+	}
+	return cw.n, nil
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func formatLabels(names, values []string) []string {
+	var result []string
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		result = appendLabel(result, name, value)
+	}
+	return result
+}
+
+func appendLabel(labels []string, name, value string) []string {
+	result := append([]string(nil), labels...)
+	return append(result, fmt.Sprintf("%s=\"%s\"", name, escapeLabelValue(value)))
+}
+
+func wrapLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := New()
+	requests := r.Counter("requests_total", "Number of requests.", "group", "code")
+	requests.Inc("api", "200")
+	requests.Inc("api", "200")
+	requests.Inc("static", "404")
+	r.Counter("requests_total", "Number of requests.", "group", "code").Add(0.5, "api", "200")
+	r.Counter("escaped_total", "Escaping\nhelp.", "value").Inc("a \"quoted\"\nvalue")
+
+	durations := r.Histogram("duration_seconds", "Durations.", []float64{0.1, 1})
+	durations.Observe(0.05)
+	durations.Observe(0.5)
+	durations.Observe(2)
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("Expected %d bytes to be reported, got %d", buf.Len(), n)
+	}
+
+	expected := `# HELP duration_seconds Durations.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="0.1"} 1
+duration_seconds_bucket{le="1"} 2
+duration_seconds_bucket{le="+Inf"} 3
+duration_seconds_sum 2.55
+duration_seconds_count 3
+# HELP escaped_total Escaping\nhelp.
+# TYPE escaped_total counter
+escaped_total{value="a \"quoted\"\nvalue"} 1
+# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{group="api",code="200"} 2.5
+requests_total{group="static",code="404"} 1
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output\n%s", buf.String())
+	}
+}
+
+func TestRegistry_Nil(t *testing.T) {
+	var r *Registry
+	r.Counter("requests_total", "Number of requests.").Inc()
+	r.Histogram("duration_seconds", "Durations.", DefaultBuckets).Observe(1)
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil || buf.Len() != 0 {
+		t.Errorf("Unexpected result %v, %s", err, buf.String())
+	}
+}
+
+func TestRegistry_KindMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a different kind to panic")
+		}
+	}()
+	r := New()
+	r.Counter("value", "Value.")
+	r.Histogram("value", "Value.", DefaultBuckets)
+}
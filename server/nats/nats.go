@@ -0,0 +1,210 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package nats is a minimal client for publishing messages to a NATS server
+// using its text based protocol. It does not support subscriptions or TLS.
+package nats
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error is an error returned by the NATS server.
+type Error string
+
+func (e Error) Error() string {
+	return fmt.Sprintf("nats: %s", string(e))
+}
+
+// Client publishes messages to a single NATS server. Messages are sent over
+// a single connection that is reestablished after failures.
+type Client struct {
+	addr     string
+	user     string
+	password string
+	token    string
+	timeout  time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+// New creates a Client for the given URL of the form
+// nats://[user:password@|token@]host[:port]
+func New(natsURL string) (*Client, error) {
+	u, err := url.Parse(natsURL)
+	if err != nil {
+		return nil, fmt.Errorf("nats: error parsing url: %w", err)
+	}
+	if u.Scheme != "nats" {
+		return nil, fmt.Errorf("nats: unsupported scheme %s", u.Scheme)
+	}
+	c := &Client{
+		addr:    u.Host,
+		timeout: time.Second * 5,
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			c.user = u.User.Username()
+			c.password = password
+		} else {
+			c.token = u.User.Username()
+		}
+	}
+	return c, nil
+}
+
+// Publish sends the given payload to the given subject. It returns after
+// the server has processed the message, so errors like permission
+// violations are reported to the caller.
+func (c *Client) Publish(subject string, payload []byte) error {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return fmt.Errorf("nats: invalid subject %q", subject)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return err
+		}
+	}
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	fmt.Fprintf(c.rw, "PUB %s %d\r\n", subject, len(payload))
+	c.rw.Write(payload)
+	c.rw.WriteString("\r\nPING\r\n")
+	if err := c.rw.Flush(); err != nil {
+		c.close()
+		return fmt.Errorf("nats: error writing message: %w", err)
+	}
+	if err := c.awaitPong(); err != nil {
+		// the connection is in an unknown state, so it is discarded
+		c.close()
+		return err
+	}
+	return nil
+}
+
+// Close closes the underlying connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.close()
+}
+
+func (c *Client) close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+type serverInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+type connectOptions struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+}
+
+func (c *Client) connect() error {
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return fmt.Errorf("nats: error connecting to %s: %w", c.addr, err)
+	}
+	c.conn = conn
+	c.rw = bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	if err := c.handshake(); err != nil {
+		c.close()
+		return err
+	}
+	return nil
+}
+
+func (c *Client) handshake() error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("nats: expected INFO from server, received %q", line)
+	}
+	var info serverInfo
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		return fmt.Errorf("nats: error parsing server info: %w", err)
+	}
+	if info.TLSRequired {
+		return errors.New("nats: server requires TLS, which is not supported")
+	}
+
+	options, _ := json.Marshal(connectOptions{
+		Name:    "offen",
+		Lang:    "go",
+		Version: "1.0.0",
+		User:    c.user,
+		Pass:    c.password,
+		Token:   c.token,
+	})
+	fmt.Fprintf(c.rw, "CONNECT %s\r\nPING\r\n", options)
+	if err := c.rw.Flush(); err != nil {
+		return fmt.Errorf("nats: error writing connect message: %w", err)
+	}
+	if err := c.awaitPong(); err != nil {
+		return fmt.Errorf("nats: error connecting: %w", err)
+	}
+	return nil
+}
+
+// awaitPong reads messages sent by the server until it has responded to
+// a PING that has been sent before.
+func (c *Client) awaitPong() error {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			c.rw.WriteString("PONG\r\n")
+			if err := c.rw.Flush(); err != nil {
+				return fmt.Errorf("nats: error writing pong: %w", err)
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return Error(strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		case line == "+OK", strings.HasPrefix(line, "INFO "):
+		default:
+			return fmt.Errorf("nats: unexpected message %q", line)
+		}
+	}
+}
+
+func (c *Client) readLine() (string, error) {
+	line, err := c.rw.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("nats: error reading from server: %w", err)
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
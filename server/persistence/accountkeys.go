@@ -0,0 +1,157 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/offen/offen/server/keys"
+)
+
+func parseAccountKeys(s string) ([]AccountKey, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var accountKeys []AccountKey
+	if err := json.Unmarshal([]byte(s), &accountKeys); err != nil {
+		return nil, fmt.Errorf("persistence: error parsing account keys: %w", err)
+	}
+	return accountKeys, nil
+}
+
+// keyFingerprint identifies the given public key without revealing it.
+func keyFingerprint(publicKey string) string {
+	sum := sha256.Sum256([]byte(publicKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// accountKeyFingerprints returns the fingerprints of all keys of the given
+// account, indexed by their version.
+func accountKeyFingerprints(account Account) (map[int]string, error) {
+	previousKeys, err := parseAccountKeys(account.PreviousKeys)
+	if err != nil {
+		return nil, err
+	}
+	result := map[int]string{account.KeyVersion: keyFingerprint(account.PublicKey)}
+	for _, key := range previousKeys {
+		result[key.Version] = keyFingerprint(key.PublicKey)
+	}
+	return result, nil
+}
+
+// RotateAccountKeys replaces the keypair of the given account with a newly
+// generated one. The previous keypair is kept as a versioned key so secrets
+// that have been encrypted using it can still be decrypted. The new private
+// key is encrypted using the key encryption key of the account, which is
+// unlocked using the given password, so it is accessible to all account
+// users without having to update any of their relationships.
+func (p *persistenceLayer) RotateAccountKeys(accountID, accountUserID, password string) error {
+	encryptionKey, err := p.unlockKeyEncryptionKey(accountID, accountUserID, password)
+	if err != nil {
+		return err
+	}
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account before rotating keys: %w", err)
+	}
+	if err := rotateAccountKeys(&account, encryptionKey); err != nil {
+		return err
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	if err := txn.UpdateAccount(&account); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error updating keys of account %s: %w", accountID, err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionRotateKeys, fmt.Sprintf("version %d", account.KeyVersion)); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording key rotation of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing key rotation: %w", err)
+	}
+	return nil
+}
+
+// unlockKeyEncryptionKey returns the key encryption key of the given account
+// after checking the given account user is an admin of the account and
+// has given the correct password.
+func (p *persistenceLayer) unlockKeyEncryptionKey(accountID, accountUserID, password string) ([]byte, error) {
+	accountUser, err := p.dal.FindAccountUser(FindAccountUserQueryByAccountUserIDIncludeRelationships(accountUserID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	if err := keys.CompareString(password, accountUser.HashedPassword); err != nil {
+		return nil, fmt.Errorf("persistence: error comparing passwords: %w", err)
+	}
+
+	var relationship *AccountUserRelationship
+	for idx, r := range accountUser.Relationships {
+		if r.AccountID == accountID && r.PasswordEncryptedKeyEncryptionKey != "" {
+			relationship = &accountUser.Relationships[idx]
+			break
+		}
+	}
+	if relationship == nil {
+		return nil, fmt.Errorf("persistence: account user %s is not allowed to access account %s", accountUserID, accountID)
+	}
+	if !relationship.Role.Includes(AccountUserRoleAdmin) {
+		return nil, fmt.Errorf("persistence: account user %s is not allowed to manage keys of account %s", accountUserID, accountID)
+	}
+
+	pwDerivedKey, err := keys.DeriveKey(password, accountUser.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error deriving key from password: %w", err)
+	}
+	encryptionKey, err := keys.DecryptWith(pwDerivedKey, relationship.PasswordEncryptedKeyEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error decrypting key encryption key: %w", err)
+	}
+	return encryptionKey, nil
+}
+
+// rotateAccountKeys updates the given account to use a newly generated
+// keypair, keeping the current one as a previous key.
+func rotateAccountKeys(account *Account, encryptionKey []byte) error {
+	// a key encryption key that does not match the account would leave the
+	// new private key inaccessible, so it is checked before going on
+	if _, err := keys.DecryptWith(encryptionKey, account.EncryptedPrivateKey); err != nil {
+		return fmt.Errorf("persistence: error decrypting current private key: %w", err)
+	}
+
+	previousKeys, err := parseAccountKeys(account.PreviousKeys)
+	if err != nil {
+		return err
+	}
+	previousKeys = append(previousKeys, AccountKey{
+		Version:             account.KeyVersion,
+		PublicKey:           account.PublicKey,
+		EncryptedPrivateKey: account.EncryptedPrivateKey,
+	})
+	previousKeysValue, err := json.Marshal(previousKeys)
+	if err != nil {
+		return fmt.Errorf("persistence: error serializing previous account keys: %w", err)
+	}
+
+	publicKey, privateKey, err := keys.GenerateRSAKeypair(keys.RSAKeyLength)
+	if err != nil {
+		return fmt.Errorf("persistence: error creating keypair: %w", err)
+	}
+	encryptedPrivateKey, err := keys.EncryptWith(encryptionKey, privateKey)
+	if err != nil {
+		return fmt.Errorf("persistence: error encrypting private key: %w", err)
+	}
+
+	account.PreviousKeys = string(previousKeysValue)
+	account.PublicKey = string(publicKey)
+	account.EncryptedPrivateKey = encryptedPrivateKey.Marshal()
+	account.KeyVersion++
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"testing"
+
+	"github.com/offen/offen/server/keys"
+)
+
+type mockRotateKeysDatabase struct {
+	DataAccessLayer
+	accountUser AccountUser
+	account     Account
+	auditLog    []*AuditLogEntry
+}
+
+func (m *mockRotateKeysDatabase) FindAccountUser(interface{}) (AccountUser, error) {
+	return m.accountUser, nil
+}
+
+func (m *mockRotateKeysDatabase) FindAccount(interface{}) (Account, error) {
+	return m.account, nil
+}
+
+func (m *mockRotateKeysDatabase) UpdateAccount(a *Account) error {
+	m.account = *a
+	return nil
+}
+
+func (m *mockRotateKeysDatabase) CreateAuditLogEntry(e *AuditLogEntry) error {
+	m.auditLog = append(m.auditLog, e)
+	return nil
+}
+
+func (m *mockRotateKeysDatabase) Commit() error {
+	return nil
+}
+
+func (m *mockRotateKeysDatabase) Rollback() error {
+	return nil
+}
+
+func (m *mockRotateKeysDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func TestPersistenceLayer_RotateAccountKeys(t *testing.T) {
+	account, key, err := newAccount("name", "")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	accountUser, err := newAccountUser("user@offen.dev", "pass", AccountUserAdminLevelSuperAdmin)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	relationship, _ := newAccountUserRelationship(accountUser.AccountUserID, account.AccountID, AccountUserRoleViewer)
+	if err := relationship.addPasswordEncryptedKey(key, accountUser.Salt, "pass"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	accountUser.Relationships = append(accountUser.Relationships, *relationship)
+
+	db := &mockRotateKeysDatabase{accountUser: *accountUser, account: *account}
+	p := &persistenceLayer{dal: db}
+
+	if err := p.RotateAccountKeys(account.AccountID, accountUser.AccountUserID, "pass"); err == nil {
+		t.Error("Expected error when rotating keys as viewer, got nil")
+	}
+	db.accountUser.Relationships[0].Role = AccountUserRoleAdmin
+
+	if err := p.RotateAccountKeys(account.AccountID, accountUser.AccountUserID, "other"); err == nil {
+		t.Error("Expected error when using bad password, got nil")
+	}
+	if err := p.RotateAccountKeys("account-z", accountUser.AccountUserID, "pass"); err == nil {
+		t.Error("Expected error when using unknown account, got nil")
+	}
+
+	if err := p.RotateAccountKeys(account.AccountID, accountUser.AccountUserID, "pass"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if db.account.KeyVersion != 1 {
+		t.Errorf("Unexpected key version %d", db.account.KeyVersion)
+	}
+	if db.account.PublicKey == account.PublicKey {
+		t.Error("Expected public key to be replaced")
+	}
+	if _, err := keys.DecryptWith(key, db.account.EncryptedPrivateKey); err != nil {
+		t.Errorf("Unexpected error decrypting new private key: %v", err)
+	}
+	previousKeys, err := parseAccountKeys(db.account.PreviousKeys)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(previousKeys) != 1 || previousKeys[0].Version != 0 || previousKeys[0].EncryptedPrivateKey != account.EncryptedPrivateKey {
+		t.Errorf("Unexpected previous keys %v", previousKeys)
+	}
+	if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionRotateKeys {
+		t.Errorf("Unexpected audit log %v", db.auditLog)
+	}
+}
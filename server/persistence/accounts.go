@@ -6,6 +6,8 @@ package persistence
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/offen/offen/server/keys"
@@ -14,26 +16,79 @@ import (
 func (p *persistenceLayer) GetAccount(accountID string, includeStyles, includeEvents bool, eventsSince string) (AccountResult, error) {
 	var account Account
 	var err error
-	if includeEvents {
-		account, err = p.dal.FindAccount(FindAccountQueryIncludeEvents{
-			AccountID: accountID,
-			Since:     eventsSince,
+	since, ok := parseSequenceCursor(eventsSince)
+	var legacySince string
+	if !ok {
+		legacySince = eventsSince
+	}
+	var pruned []Tombstone
+	// the result is never written back, so it can be read from a replica,
+	// reading tombstones from the same database as events so the sequence
+	// does not skip any changes
+	err = readReplica(p.dal, func(dal DataAccessLayer) error {
+		if !includeEvents {
+			account, err = dal.FindAccount(FindAccountQueryActiveByID(accountID))
+			if err != nil {
+				return fmt.Errorf("persistence: error looking up account data: %w", err)
+			}
+			return nil
+		}
+		account, err = dal.FindAccount(FindAccountQueryIncludeEvents{
+			AccountID:            accountID,
+			Since:                legacySince,
+			SinceSequenceNumbers: since,
 		})
-	} else {
-		account, err = p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
-	}
+		if err != nil {
+			return fmt.Errorf("persistence: error looking up account data: %w", err)
+		}
+		if eventsSince != "" {
+			pruned, err = dal.FindTombstones(FindTombstonesQueryByAccounts{
+				AccountIDs:           []string{accountID},
+				Since:                legacySince,
+				SinceSequenceNumbers: since,
+			})
+			if err != nil {
+				return fmt.Errorf("persistence: error finding deleted events: %w", err)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return AccountResult{}, fmt.Errorf("persistence: error looking up account data: %w", err)
+		return AccountResult{}, err
 	}
 
 	result := AccountResult{
-		AccountID: account.AccountID,
-		Name:      account.Name,
-		Created:   account.Created,
+		AccountID:       account.AccountID,
+		Name:            account.Name,
+		Created:         account.Created,
+		RetentionPeriod: account.RetentionPeriod,
+		BotPolicy:       account.BotPolicy,
+		Locale:          account.Locale,
+	}
+	if rules, err := parseRetentionRules(account.RetentionRules); err == nil {
+		result.RetentionRules = rules
+	}
+	if account.AllowedOrigins != "" {
+		result.AllowedOrigins = strings.Split(account.AllowedOrigins, ",")
+	}
+	if types, err := parseEventTypes(account.EventTypes); err == nil {
+		result.EventTypes = types
+	}
+	if policy, err := parseCookiePolicy(account.CookiePolicy); err == nil && policy != (CookiePolicy{}) {
+		result.CookiePolicy = &policy
+	}
+	if flags, err := parseFeatureFlags(account.FeatureFlags); err == nil && len(flags) != 0 {
+		result.FeatureFlags = flags
+	}
+	if writeKeys, err := parseWriteKeys(account.WriteKeys); err == nil {
+		result.WriteKeys = writeKeys.Active(time.Now())
 	}
 
 	if includeStyles {
 		result.AccountStyles = account.AccountStyles
+		if theme, err := parseTheme(account.Theme); err == nil && !theme.Empty() {
+			result.Theme = &theme
+		}
 	}
 
 	key, err := account.WrapPublicKey()
@@ -47,21 +102,45 @@ func (p *persistenceLayer) GetAccount(accountID string, includeStyles, includeEv
 	}
 
 	result.EncryptedPrivateKey = account.EncryptedPrivateKey
+	result.KeyVersion = account.KeyVersion
+	previousKeys, err := parseAccountKeys(account.PreviousKeys)
+	if err != nil {
+		return AccountResult{}, fmt.Errorf("persistence: error parsing previous account keys: %w", err)
+	}
+	for _, key := range previousKeys {
+		result.PreviousKeys = append(result.PreviousKeys, AccountKeyResult{
+			Version:             key.Version,
+			EncryptedPrivateKey: key.EncryptedPrivateKey,
+		})
+	}
+
+	if p.quotas.enabled() {
+		usage, err := p.accountUsageResult(account.AccountID)
+		if err != nil {
+			return AccountResult{}, fmt.Errorf("persistence: error looking up account usage: %w", err)
+		}
+		result.Usage = usage
+	}
 
 	eventResults := EventsByAccountID{}
 	secrets := EncryptedSecretsByID{}
-	seqs := []string{}
+	next := sequenceCursor{}
+	if sequenceNumber, ok := since[accountID]; ok {
+		next[accountID] = sequenceNumber
+	}
 
 	for _, evt := range account.Events {
 		eventResults[evt.AccountID] = append(eventResults[evt.AccountID], EventResult{
-			SecretID: evt.SecretID,
-			EventID:  evt.EventID,
-			Payload:  evt.Payload,
+			SecretID:   evt.SecretID,
+			EventID:    evt.EventID,
+			Payload:    evt.Payload,
+			KeyVersion: evt.KeyVersion,
+			EventType:  evt.EventType,
 		})
 		if evt.SecretID != nil {
 			secrets[*evt.SecretID] = evt.Secret.EncryptedSecret
 		}
-		seqs = append(seqs, evt.Sequence)
+		next.advance(evt.AccountID, evt.SequenceNumber)
 	}
 
 	if len(eventResults) != 0 {
@@ -72,27 +151,44 @@ func (p *persistenceLayer) GetAccount(accountID string, includeStyles, includeEv
 	}
 
 	if eventsSince != "" {
-		pruned, err := p.dal.FindTombstones(FindTombstonesQueryByAccounts{
-			AccountIDs: []string{accountID},
-			Since:      eventsSince,
-		})
-		if err != nil {
-			return AccountResult{}, fmt.Errorf("persistence: error finding deleted events: %w", err)
-		}
-
 		var prunedIDs []string
 		for _, tombstone := range pruned {
 			prunedIDs = append(prunedIDs, tombstone.EventID)
-			seqs = append(seqs, tombstone.Sequence)
+			next.advance(tombstone.AccountID, tombstone.SequenceNumber)
 		}
 		result.DeletedEvents = prunedIDs
 	}
 
-	result.Sequence = getLatestSeq(seqs)
+	result.Sequence = next.String()
 
 	return result, nil
 }
 
+func (p *persistenceLayer) GetAccountSummary(accountID string) (AccountSummaryResult, error) {
+	var account Account
+	var stats EventStats
+	if err := readReplica(p.dal, func(dal DataAccessLayer) error {
+		var err error
+		account, err = dal.FindAccount(FindAccountQueryActiveByID(accountID))
+		if err != nil {
+			return fmt.Errorf("persistence: error looking up account data: %w", err)
+		}
+		stats, err = dal.FindEventStats(FindEventStatsQueryByAccountID(account.AccountID))
+		if err != nil {
+			return fmt.Errorf("persistence: error looking up event stats: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return AccountSummaryResult{}, err
+	}
+	return AccountSummaryResult{
+		AccountID:     account.AccountID,
+		EventCount:    stats.Count,
+		LatestEventID: stats.LatestEventID,
+		Sequence:      stats.LatestSequence,
+	}, nil
+}
+
 func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserSecret string) error {
 	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
 	if err != nil {
@@ -129,79 +225,99 @@ func (p *persistenceLayer) AssociateUserSecret(accountID, userID, encryptedUserS
 			return fmt.Errorf("persistence: error hashing parked id: %v", parkErr)
 		}
 
-		txn, err := p.dal.Transaction()
-		if err != nil {
-			return fmt.Errorf("persistence: error creating transaction: %w", err)
-		}
-		if err := txn.CreateSecret(&Secret{
-			SecretID:        parkedHash,
-			EncryptedSecret: secret.EncryptedSecret,
+		// databases like CockroachDB might abort the transaction in case
+		// events are inserted concurrently, so it is retried
+		if err := retryOnSerializationFailure(func() error {
+			return p.parkEvents(secret, hashedUserID, parkedHash)
 		}); err != nil {
-			txn.Rollback()
-			return fmt.Errorf("persistence: error creating user for use as migration target: %w", err)
-		}
-
-		if err := txn.DeleteSecret(DeleteSecretQueryBySecretID(secret.SecretID)); err != nil {
-			txn.Rollback()
-			return fmt.Errorf("persistence: error deleting existing user: %v", err)
+			return err
 		}
+	}
 
-		// The previous user is now deleted so all orphaned events need to be
-		// copied over to the one used for parking the events.
-		var idsToDelete []string
-		orphanedEvents, err := txn.FindEvents(FindEventsQueryForSecretIDs{
-			SecretIDs: []string{hashedUserID},
-		})
-		if err != nil {
-			return fmt.Errorf("persistence: error looking up orphaned events: %w", err)
-		}
+	if err := p.dal.CreateSecret(&Secret{
+		SecretID:        hashedUserID,
+		EncryptedSecret: encryptedUserSecret,
+		KeyVersion:      account.KeyVersion,
+	}); err != nil {
+		return fmt.Errorf("persistence: error creating user: %w", err)
+	}
+	return nil
+}
 
-		sequence, seqErr := NewULID()
-		if seqErr != nil {
-			return fmt.Errorf("persistence: error creating sequence for parked events: %w", err)
-		}
-		for _, orphan := range orphanedEvents {
-			newID, err := siblingEventID(orphan.EventID)
-			if err != nil {
-				txn.Rollback()
-				return fmt.Errorf("persistence: error creating new event id: %w", err)
-			}
+// parkEvents moves all events stored for the given hashed user id to the
+// given parked hash in a single transaction.
+func (p *persistenceLayer) parkEvents(secret Secret, hashedUserID, parkedHash string) error {
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	if err := txn.CreateSecret(&Secret{
+		SecretID:        parkedHash,
+		EncryptedSecret: secret.EncryptedSecret,
+		KeyVersion:      secret.KeyVersion,
+	}); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error creating user for use as migration target: %w", err)
+	}
 
-			if err := txn.CreateEvent(&Event{
-				EventID:   newID,
-				Sequence:  sequence,
-				AccountID: orphan.AccountID,
-				SecretID:  &parkedHash,
-				Payload:   orphan.Payload,
-			}); err != nil {
-				return fmt.Errorf("persistence: error migrating an existing event: %w", err)
-			}
+	if err := txn.DeleteSecret(DeleteSecretQueryBySecretID(secret.SecretID)); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error deleting existing user: %w", err)
+	}
 
-			if err := txn.CreateTombstone(&Tombstone{
-				EventID:   orphan.EventID,
-				AccountID: orphan.AccountID,
-				SecretID:  orphan.SecretID,
-				Sequence:  sequence,
-			}); err != nil {
-				return fmt.Errorf("persistence: error creating tombstone for migrated event: %w", err)
-			}
+	// The previous user is now deleted so all orphaned events need to be
+	// copied over to the one used for parking the events.
+	var idsToDelete []string
+	orphanedEvents, err := txn.FindEvents(FindEventsQueryForSecretIDs{
+		SecretIDs: []string{hashedUserID},
+	})
+	if err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error looking up orphaned events: %w", err)
+	}
 
-			idsToDelete = append(idsToDelete, orphan.EventID)
+	sequence, err := NewULID()
+	if err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error creating sequence for parked events: %w", err)
+	}
+	for _, orphan := range orphanedEvents {
+		newID, err := siblingEventID(orphan.EventID)
+		if err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error creating new event id: %w", err)
 		}
-		if _, err := txn.DeleteEvents(DeleteEventsQueryByEventIDs(idsToDelete)); err != nil {
+
+		if err := txn.CreateEvent(&Event{
+			EventID:    newID,
+			Sequence:   sequence,
+			AccountID:  orphan.AccountID,
+			SecretID:   &parkedHash,
+			Payload:    orphan.Payload,
+			KeyVersion: orphan.KeyVersion,
+		}); err != nil {
 			txn.Rollback()
-			return fmt.Errorf("persistence: error deleting orphaned events: %w", err)
+			return fmt.Errorf("persistence: error migrating an existing event: %w", err)
 		}
-		if err := txn.Commit(); err != nil {
-			return fmt.Errorf("persistence: error committing transaction: %w", err)
+
+		if err := txn.CreateTombstone(&Tombstone{
+			EventID:   orphan.EventID,
+			AccountID: orphan.AccountID,
+			SecretID:  orphan.SecretID,
+			Sequence:  sequence,
+		}); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error creating tombstone for migrated event: %w", err)
 		}
-	}
 
-	if err := p.dal.CreateSecret(&Secret{
-		SecretID:        hashedUserID,
-		EncryptedSecret: encryptedUserSecret,
-	}); err != nil {
-		return fmt.Errorf("persistence: error creating user: %w", err)
+		idsToDelete = append(idsToDelete, orphan.EventID)
+	}
+	if _, err := txn.DeleteEvents(DeleteEventsQueryByEventIDs(idsToDelete)); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error deleting orphaned events: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing transaction: %w", err)
 	}
 	return nil
 }
@@ -234,7 +350,7 @@ func (p *persistenceLayer) CreateAccount(name, emailAddress, password string) er
 	if err != nil {
 		return fmt.Errorf("persistence: error creating account: %w", err)
 	}
-	relationship, err := newAccountUserRelationship(match.AccountUserID, account.AccountID)
+	relationship, err := newAccountUserRelationship(match.AccountUserID, account.AccountID, AccountUserRoleAdmin)
 	if err != nil {
 		return fmt.Errorf("persistence: error creating relationship: %w", err)
 	}
@@ -257,6 +373,13 @@ func (p *persistenceLayer) CreateAccount(name, emailAddress, password string) er
 		txn.Rollback()
 		return fmt.Errorf("persistence: error persisting relationship: %w", err)
 	}
+	if err := notifyWebhooks(txn, account.AccountID, WebhookEventAccountCreated, map[string]interface{}{
+		"name":      account.Name,
+		"createdBy": match.AccountUserID,
+	}); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error notifying webhooks: %w", err)
+	}
 	if err := txn.Commit(); err != nil {
 		return fmt.Errorf("persistence: error committing transaction: %w", err)
 	}
@@ -264,7 +387,7 @@ func (p *persistenceLayer) CreateAccount(name, emailAddress, password string) er
 	return nil
 }
 
-func (p *persistenceLayer) RetireAccount(accountID string) error {
+func (p *persistenceLayer) RetireAccount(accountID, accountUserID string) error {
 	account, lookupErr := p.dal.FindAccount(FindAccountQueryByID(accountID))
 	if lookupErr != nil {
 		return fmt.Errorf("persistence: error looking up account to retire: %w", lookupErr)
@@ -276,14 +399,17 @@ func (p *persistenceLayer) RetireAccount(accountID string) error {
 	if txnErr != nil {
 		return fmt.Errorf("persistence: error creating transaction: %w", txnErr)
 	}
+	// relationships are kept so the account can be restored until it is
+	// purged, retired accounts are hidden from login results instead
 	account.Retired = true
+	account.RetiredAt = time.Now()
 	if err := txn.UpdateAccount(&account); err != nil {
 		txn.Rollback()
 		return fmt.Errorf("persistence: error retiring account %s: %w", accountID, err)
 	}
-	if err := txn.DeleteAccountUserRelationships(DeleteAccountUserRelationshipsQueryByAccountID(accountID)); err != nil {
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionRetireAccount, ""); err != nil {
 		txn.Rollback()
-		return fmt.Errorf("persistence: error deleting account user relationships for retired account %s: %w", accountID, err)
+		return fmt.Errorf("persistence: error recording retirement of account %s: %w", accountID, err)
 	}
 	if err := txn.Commit(); err != nil {
 		txn.Rollback()
@@ -291,3 +417,99 @@ func (p *persistenceLayer) RetireAccount(accountID string) error {
 	}
 	return nil
 }
+
+func (p *persistenceLayer) RestoreAccount(accountID, accountUserID string) error {
+	account, err := p.dal.FindAccount(FindAccountQueryByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account to restore: %w", err)
+	}
+	if !account.Retired {
+		return ErrUnknownAccount(fmt.Sprintf("persistence: account %s is not retired", accountID))
+	}
+
+	relationships, err := p.dal.FindAccountUserRelationships(FindAccountUserRelationshipsQueryByAccountUserID(accountUserID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up relationships: %w", err)
+	}
+	var allowed bool
+	for _, relationship := range relationships {
+		if relationship.AccountID == accountID && relationship.Role.Includes(AccountUserRoleAdmin) {
+			allowed = true
+			break
+		}
+	}
+	// users that cannot restore the account are not told about its existence
+	if !allowed {
+		return ErrUnknownAccount(fmt.Sprintf("persistence: account %s cannot be restored by account user %s", accountID, accountUserID))
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	account.Retired = false
+	account.RetiredAt = time.Time{}
+	if err := txn.UpdateAccount(&account); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error restoring account %s: %w", accountID, err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionRestoreAccount, ""); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording restoration of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing account restoration: %w", err)
+	}
+	return nil
+}
+
+// PurgeRetiredAccounts permanently deletes all accounts that have been retired
+// for longer than the given grace period, including their events and
+// relationships.
+func (p *persistenceLayer) PurgeRetiredAccounts(gracePeriod time.Duration) (int, error) {
+	accounts, err := p.dal.FindAccounts(FindAccountsQueryRetired{})
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error looking up retired accounts: %w", err)
+	}
+
+	deadline := time.Now().Add(-gracePeriod)
+	var purged int
+	for _, account := range accounts {
+		if account.RetiredAt.After(deadline) {
+			continue
+		}
+		txn, err := p.dal.Transaction()
+		if err != nil {
+			return purged, fmt.Errorf("persistence: error creating transaction: %w", err)
+		}
+		if _, err := txn.DeleteEvents(DeleteEventsQueryByAccountID(account.AccountID)); err != nil {
+			txn.Rollback()
+			return purged, fmt.Errorf("persistence: error deleting events of account %s: %w", account.AccountID, err)
+		}
+		if err := txn.DeleteAccountUserRelationships(DeleteAccountUserRelationshipsQueryByAccountID(account.AccountID)); err != nil {
+			txn.Rollback()
+			return purged, fmt.Errorf("persistence: error deleting relationships of account %s: %w", account.AccountID, err)
+		}
+		if _, err := txn.DeleteWebhooks(DeleteWebhooksQueryByAccountID(account.AccountID)); err != nil {
+			txn.Rollback()
+			return purged, fmt.Errorf("persistence: error deleting webhooks of account %s: %w", account.AccountID, err)
+		}
+		if _, err := txn.DeleteWebhookDeliveries(DeleteWebhookDeliveriesQueryByAccountID(account.AccountID)); err != nil {
+			txn.Rollback()
+			return purged, fmt.Errorf("persistence: error deleting webhook deliveries of account %s: %w", account.AccountID, err)
+		}
+		if _, err := txn.DeleteAccountDomains(DeleteAccountDomainsQueryByAccountID(account.AccountID)); err != nil {
+			txn.Rollback()
+			return purged, fmt.Errorf("persistence: error deleting domains of account %s: %w", account.AccountID, err)
+		}
+		if err := txn.DeleteAccount(DeleteAccountQueryByID(account.AccountID)); err != nil {
+			txn.Rollback()
+			return purged, fmt.Errorf("persistence: error deleting account %s: %w", account.AccountID, err)
+		}
+		if err := txn.Commit(); err != nil {
+			return purged, fmt.Errorf("persistence: error committing purge of account %s: %w", account.AccountID, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
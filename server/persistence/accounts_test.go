@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/lestrrat-go/jwx/jwk"
 )
@@ -83,9 +84,9 @@ func TestPersistenceLayer_GetAccount(t *testing.T) {
 					PublicKey:           publicKey,
 					EncryptedPrivateKey: "encrypted-private-key",
 					Events: []Event{
-						{Secret: Secret{EncryptedSecret: "aaaaa"}, SecretID: strptr("hashed-user-a"), EventID: "event-a", AccountID: "account-id", Payload: "payload-a"},
-						{Secret: Secret{EncryptedSecret: "bbbbb"}, SecretID: strptr("hashed-user-b"), EventID: "event-b", AccountID: "account-id", Payload: "payload-b"},
-						{EventID: "event-c", AccountID: "account-id", Payload: "payload-c"},
+						{Secret: Secret{EncryptedSecret: "aaaaa"}, SecretID: strptr("hashed-user-a"), EventID: "event-a", AccountID: "account-id", Payload: "payload-a", SequenceNumber: 3},
+						{Secret: Secret{EncryptedSecret: "bbbbb"}, SecretID: strptr("hashed-user-b"), EventID: "event-b", AccountID: "account-id", Payload: "payload-b", SequenceNumber: 5},
+						{EventID: "event-c", AccountID: "account-id", Payload: "payload-c", SequenceNumber: 4},
 					},
 				},
 			},
@@ -95,6 +96,7 @@ func TestPersistenceLayer_GetAccount(t *testing.T) {
 				AccountID:           "account-id",
 				Name:                "name",
 				EncryptedPrivateKey: "encrypted-private-key",
+				Sequence:            sequenceCursor{"account-id": 5}.String(),
 				Events: &EventsByAccountID{
 					"account-id": []EventResult{
 						{EventID: "event-a", SecretID: strptr("hashed-user-a"), Payload: "payload-a"},
@@ -231,11 +233,14 @@ func TestPersistenceLayer_AssociateUserSecret(t *testing.T) {
 
 type mockRetireAccountDatabase struct {
 	DataAccessLayer
-	updateErr         error
-	deleteErr         error
-	txnErr            error
-	findAccountResult Account
-	findAccountErr    error
+	updateErr               error
+	deleteErr               error
+	txnErr                  error
+	findAccountResult       Account
+	findAccountErr          error
+	findAccountsResult      []Account
+	findRelationshipsResult []AccountUserRelationship
+	deleted                 []string
 }
 
 func (m *mockRetireAccountDatabase) UpdateAccount(*Account) error {
@@ -245,10 +250,43 @@ func (m *mockRetireAccountDatabase) UpdateAccount(*Account) error {
 func (m *mockRetireAccountDatabase) DeleteAccountUserRelationships(interface{}) error {
 	return m.deleteErr
 }
+
+func (m *mockRetireAccountDatabase) DeleteWebhooks(interface{}) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockRetireAccountDatabase) DeleteWebhookDeliveries(interface{}) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockRetireAccountDatabase) DeleteAccountDomains(interface{}) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockRetireAccountDatabase) FindAccountUserRelationships(interface{}) ([]AccountUserRelationship, error) {
+	return m.findRelationshipsResult, nil
+}
+
+func (m *mockRetireAccountDatabase) FindAccounts(interface{}) ([]Account, error) {
+	return m.findAccountsResult, nil
+}
+
+func (m *mockRetireAccountDatabase) DeleteEvents(interface{}) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockRetireAccountDatabase) DeleteAccount(q interface{}) error {
+	m.deleted = append(m.deleted, string(q.(DeleteAccountQueryByID)))
+	return nil
+}
 func (m *mockRetireAccountDatabase) FindAccount(interface{}) (Account, error) {
 	return m.findAccountResult, m.findAccountErr
 }
 
+func (m *mockRetireAccountDatabase) CreateAuditLogEntry(*AuditLogEntry) error {
+	return nil
+}
+
 func (m *mockRetireAccountDatabase) Commit() error {
 	return nil
 }
@@ -275,11 +313,11 @@ func TestPersistenceLayer_RetireAccount(t *testing.T) {
 			true,
 		},
 		{
-			"delete error",
+			"relationships are kept",
 			&mockRetireAccountDatabase{
-				deleteErr: errors.New("did not work"),
+				deleteErr: errors.New("must not be called"),
 			},
-			true,
+			false,
 		},
 		{
 			"transaction error",
@@ -296,11 +334,91 @@ func TestPersistenceLayer_RetireAccount(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			p := persistenceLayer{test.db}
-			err := p.RetireAccount("account-a")
+			p := persistenceLayer{dal: test.db}
+			err := p.RetireAccount("account-a", "user-a")
+			if test.expectError != (err != nil) {
+				t.Errorf("Unexpected error value: %v", err)
+			}
+		})
+	}
+}
+
+func TestPersistenceLayer_RestoreAccount(t *testing.T) {
+	tests := []struct {
+		name        string
+		db          *mockRetireAccountDatabase
+		expectError bool
+	}{
+		{
+			"not retired",
+			&mockRetireAccountDatabase{
+				findAccountResult: Account{AccountID: "account-a"},
+				findRelationshipsResult: []AccountUserRelationship{
+					{AccountID: "account-a", Role: AccountUserRoleAdmin},
+				},
+			},
+			true,
+		},
+		{
+			"not an admin",
+			&mockRetireAccountDatabase{
+				findAccountResult: Account{AccountID: "account-a", Retired: true},
+				findRelationshipsResult: []AccountUserRelationship{
+					{AccountID: "account-a", Role: AccountUserRoleEditor},
+					{AccountID: "account-b", Role: AccountUserRoleAdmin},
+				},
+			},
+			true,
+		},
+		{
+			"update error",
+			&mockRetireAccountDatabase{
+				findAccountResult: Account{AccountID: "account-a", Retired: true},
+				findRelationshipsResult: []AccountUserRelationship{
+					{AccountID: "account-a", Role: AccountUserRoleAdmin},
+				},
+				updateErr: errors.New("did not work"),
+			},
+			true,
+		},
+		{
+			"ok",
+			&mockRetireAccountDatabase{
+				findAccountResult: Account{AccountID: "account-a", Retired: true},
+				findRelationshipsResult: []AccountUserRelationship{
+					{AccountID: "account-a", Role: AccountUserRoleAdmin},
+				},
+			},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := persistenceLayer{dal: test.db}
+			err := p.RestoreAccount("account-a", "user-a")
 			if test.expectError != (err != nil) {
 				t.Errorf("Unexpected error value: %v", err)
 			}
 		})
 	}
 }
+
+func TestPersistenceLayer_PurgeRetiredAccounts(t *testing.T) {
+	db := &mockRetireAccountDatabase{
+		findAccountsResult: []Account{
+			{AccountID: "account-a", Retired: true, RetiredAt: time.Now().Add(-time.Hour * 48)},
+			{AccountID: "account-b", Retired: true, RetiredAt: time.Now().Add(-time.Hour)},
+		},
+	}
+	p := persistenceLayer{dal: db}
+	purged, err := p.PurgeRetiredAccounts(time.Hour * 24)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Unexpected number of purged accounts %d", purged)
+	}
+	if !reflect.DeepEqual(db.deleted, []string{"account-a"}) {
+		t.Errorf("Unexpected deletions %v", db.deleted)
+	}
+}
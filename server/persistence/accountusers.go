@@ -0,0 +1,166 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import "fmt"
+
+// ListAccountUsers returns all account users that are members of the given
+// account, including those that have not accepted their invitation yet.
+func (p *persistenceLayer) ListAccountUsers(accountID string) ([]AccountUserResult, error) {
+	relationships, err := p.dal.FindAccountUserRelationships(FindAccountUserRelationshipsQueryByAccountID(accountID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up account users: %w", err)
+	}
+	result := []AccountUserResult{}
+	for _, relationship := range relationships {
+		result = append(result, AccountUserResult{
+			AccountUserID: relationship.AccountUserID,
+			Role:          relationship.Role,
+			Pending:       relationship.PasswordEncryptedKeyEncryptionKey == "",
+		})
+	}
+	return result, nil
+}
+
+// memberRelationship looks up the relationship of the given account user
+// for the given account and checks whether changing it would leave the
+// account without an admin.
+func (p *persistenceLayer) memberRelationship(accountID, accountUserID string, role AccountUserRole) (*AccountUserRelationship, error) {
+	relationships, err := p.dal.FindAccountUserRelationships(FindAccountUserRelationshipsQueryByAccountID(accountID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up account users: %w", err)
+	}
+	var match *AccountUserRelationship
+	var admins int
+	for idx, r := range relationships {
+		if r.AccountUserID == accountUserID {
+			match = &relationships[idx]
+		}
+		if r.Role.Includes(AccountUserRoleAdmin) && r.PasswordEncryptedKeyEncryptionKey != "" {
+			admins++
+		}
+	}
+	if match == nil {
+		return nil, ErrUnknownAccountUser(
+			fmt.Sprintf("persistence: account user %s is not a member of account %s", accountUserID, accountID),
+		)
+	}
+	isAdmin := match.Role.Includes(AccountUserRoleAdmin) && match.PasswordEncryptedKeyEncryptionKey != ""
+	if isAdmin && !role.Includes(AccountUserRoleAdmin) && admins < 2 {
+		return nil, ErrLastAccountAdmin(
+			fmt.Sprintf("persistence: account user %s is the last admin of account %s", accountUserID, accountID),
+		)
+	}
+	return match, nil
+}
+
+// UpdateAccountUserRole grants the given role for the given account to a
+// member of the account.
+func (p *persistenceLayer) UpdateAccountUserRole(accountID, targetAccountUserID string, role AccountUserRole, accountUserID string) error {
+	if !role.Valid() {
+		return fmt.Errorf("persistence: unknown role %s", role)
+	}
+	relationship, err := p.memberRelationship(accountID, targetAccountUserID, role)
+	if err != nil {
+		return err
+	}
+	if relationship.Role == role {
+		return nil
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	if role == AccountUserRoleAdmin {
+		// this mirrors granting the admin role when sharing an account, where
+		// the admin level is never lowered
+		target, err := txn.FindAccountUser(FindAccountUserQueryByAccountUserIDIncludeRelationships(targetAccountUserID))
+		if err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error looking up account user: %w", err)
+		}
+		if target.AdminLevel != AccountUserAdminLevelSuperAdmin {
+			target.AdminLevel = AccountUserAdminLevelSuperAdmin
+			if err := txn.UpdateAccountUser(&target); err != nil {
+				txn.Rollback()
+				return fmt.Errorf("persistence: error updating admin level of account user: %w", err)
+			}
+		}
+	}
+	relationship.Role = role
+	if err := txn.UpdateAccountUserRelationship(relationship); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error updating role of account user relationship: %w", err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionChangeRole, targetAccountUserID); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording role change: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing role change: %w", err)
+	}
+	return nil
+}
+
+// RemoveAccountUser revokes access to the given account for a member of
+// the account. The removed account user might still know the key encryption
+// key of the account, so the keys of the account are rotated in the same
+// step. This makes sure secrets created after the removal are encrypted using
+// a private key the removed user has never been able to decrypt, as the
+// newly encrypted private key is only handed out to remaining members.
+// Rotating the keys requires the password of the admin that is removing
+// the user.
+func (p *persistenceLayer) RemoveAccountUser(accountID, targetAccountUserID, accountUserID, password string) error {
+	encryptionKey, err := p.unlockKeyEncryptionKey(accountID, accountUserID, password)
+	if err != nil {
+		return err
+	}
+	if _, err := p.memberRelationship(accountID, targetAccountUserID, ""); err != nil {
+		return err
+	}
+
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account before removing account user: %w", err)
+	}
+	if err := rotateAccountKeys(&account, encryptionKey); err != nil {
+		return err
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	if err := txn.DeleteAccountUserRelationships(DeleteAccountUserRelationshipsQueryByAccountUserID{
+		AccountID:     accountID,
+		AccountUserID: targetAccountUserID,
+	}); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error removing account user %s: %w", targetAccountUserID, err)
+	}
+	if _, err := txn.DeleteAPITokens(DeleteAPITokensQueryByAccountUserID{
+		AccountID:     accountID,
+		AccountUserID: targetAccountUserID,
+	}); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error revoking api tokens of account user %s: %w", targetAccountUserID, err)
+	}
+	if err := txn.UpdateAccount(&account); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error updating keys of account %s: %w", accountID, err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionRemoveAccountUser, targetAccountUserID); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording removal of account user: %w", err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionRotateKeys, fmt.Sprintf("version %d", account.KeyVersion)); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording key rotation of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing removal of account user: %w", err)
+	}
+	return nil
+}
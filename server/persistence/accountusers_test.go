@@ -0,0 +1,225 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type mockAccountUsersDatabase struct {
+	mockRotateKeysDatabase
+	relationships  []AccountUserRelationship
+	updated        *AccountUserRelationship
+	deleted        interface{}
+	deletedTokens  interface{}
+	updatedAccount bool
+}
+
+func (m *mockAccountUsersDatabase) FindAccountUserRelationships(interface{}) ([]AccountUserRelationship, error) {
+	return append([]AccountUserRelationship{}, m.relationships...), nil
+}
+
+func (m *mockAccountUsersDatabase) UpdateAccountUserRelationship(r *AccountUserRelationship) error {
+	m.updated = r
+	return nil
+}
+
+func (m *mockAccountUsersDatabase) UpdateAccountUser(a *AccountUser) error {
+	m.accountUser = *a
+	return nil
+}
+
+func (m *mockAccountUsersDatabase) DeleteAccountUserRelationships(q interface{}) error {
+	m.deleted = q
+	return nil
+}
+
+func (m *mockAccountUsersDatabase) DeleteAPITokens(q interface{}) (int64, error) {
+	m.deletedTokens = q
+	return 1, nil
+}
+
+func (m *mockAccountUsersDatabase) UpdateAccount(a *Account) error {
+	m.updatedAccount = true
+	return m.mockRotateKeysDatabase.UpdateAccount(a)
+}
+
+func (m *mockAccountUsersDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func TestPersistenceLayer_ListAccountUsers(t *testing.T) {
+	db := &mockAccountUsersDatabase{
+		relationships: []AccountUserRelationship{
+			{AccountUserID: "user-a", Role: AccountUserRoleAdmin, PasswordEncryptedKeyEncryptionKey: "key"},
+			{AccountUserID: "user-b", Role: AccountUserRoleViewer},
+		},
+	}
+	result, err := (&persistenceLayer{dal: db}).ListAccountUsers("account-a")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := []AccountUserResult{
+		{AccountUserID: "user-a", Role: AccountUserRoleAdmin},
+		{AccountUserID: "user-b", Role: AccountUserRoleViewer, Pending: true},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
+
+func TestPersistenceLayer_UpdateAccountUserRole(t *testing.T) {
+	t.Run("last admin", func(t *testing.T) {
+		db := &mockAccountUsersDatabase{
+			relationships: []AccountUserRelationship{
+				{AccountUserID: "user-a", Role: AccountUserRoleAdmin, PasswordEncryptedKeyEncryptionKey: "key"},
+				{AccountUserID: "user-b", Role: AccountUserRoleAdmin},
+			},
+		}
+		err := (&persistenceLayer{dal: db}).UpdateAccountUserRole("account-a", "user-a", AccountUserRoleViewer, "user-a")
+		var lastAdminErr ErrLastAccountAdmin
+		if !errors.As(err, &lastAdminErr) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("unknown user", func(t *testing.T) {
+		db := &mockAccountUsersDatabase{}
+		err := (&persistenceLayer{dal: db}).UpdateAccountUserRole("account-a", "user-z", AccountUserRoleViewer, "user-a")
+		var unknownErr ErrUnknownAccountUser
+		if !errors.As(err, &unknownErr) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("bad role", func(t *testing.T) {
+		db := &mockAccountUsersDatabase{}
+		if err := (&persistenceLayer{dal: db}).UpdateAccountUserRole("account-a", "user-a", "owner", "user-a"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockAccountUsersDatabase{
+			relationships: []AccountUserRelationship{
+				{AccountUserID: "user-a", Role: AccountUserRoleAdmin, PasswordEncryptedKeyEncryptionKey: "key"},
+				{AccountUserID: "user-b", Role: AccountUserRoleViewer, PasswordEncryptedKeyEncryptionKey: "key"},
+			},
+		}
+		if err := (&persistenceLayer{dal: db}).UpdateAccountUserRole("account-a", "user-b", AccountUserRoleAdmin, "user-a"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if db.updated == nil || db.updated.AccountUserID != "user-b" || db.updated.Role != AccountUserRoleAdmin {
+			t.Errorf("Unexpected update %v", db.updated)
+		}
+		if db.accountUser.AdminLevel != AccountUserAdminLevelSuperAdmin {
+			t.Errorf("Expected admin level to be raised, got %v", db.accountUser.AdminLevel)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionChangeRole {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+	t.Run("transaction", func(t *testing.T) {
+		db := &mockUpdateRoleDatabase{
+			mockAccountUsersDatabase: mockAccountUsersDatabase{
+				relationships: []AccountUserRelationship{
+					{AccountUserID: "user-a", Role: AccountUserRoleAdmin, PasswordEncryptedKeyEncryptionKey: "key"},
+					{AccountUserID: "user-b", Role: AccountUserRoleViewer, PasswordEncryptedKeyEncryptionKey: "key"},
+				},
+			},
+		}
+		if err := (&persistenceLayer{dal: db}).UpdateAccountUserRole("account-a", "user-b", AccountUserRoleAdmin, "user-a"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(db.outsideTransaction) != 0 {
+			t.Errorf("Unexpected writes outside of transaction %v", db.outsideTransaction)
+		}
+		if db.accountUser.AdminLevel != AccountUserAdminLevelSuperAdmin || db.updated == nil {
+			t.Errorf("Expected admin level and role to be updated in transaction, got %v and %v", db.accountUser.AdminLevel, db.updated)
+		}
+	})
+}
+
+// mockUpdateRoleDatabase records writes that are not performed using the
+// transaction it hands out.
+type mockUpdateRoleDatabase struct {
+	mockAccountUsersDatabase
+	outsideTransaction []string
+}
+
+func (m *mockUpdateRoleDatabase) UpdateAccountUser(a *AccountUser) error {
+	m.outsideTransaction = append(m.outsideTransaction, "UpdateAccountUser")
+	return m.mockAccountUsersDatabase.UpdateAccountUser(a)
+}
+
+func (m *mockUpdateRoleDatabase) UpdateAccountUserRelationship(r *AccountUserRelationship) error {
+	m.outsideTransaction = append(m.outsideTransaction, "UpdateAccountUserRelationship")
+	return m.mockAccountUsersDatabase.UpdateAccountUserRelationship(r)
+}
+
+func (m *mockUpdateRoleDatabase) Transaction() (Transaction, error) {
+	return &m.mockAccountUsersDatabase, nil
+}
+
+func TestPersistenceLayer_RemoveAccountUser(t *testing.T) {
+	account, key, err := newAccount("name", "")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	accountUser, err := newAccountUser("user@offen.dev", "pass", AccountUserAdminLevelSuperAdmin)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	relationship, _ := newAccountUserRelationship(accountUser.AccountUserID, account.AccountID, AccountUserRoleAdmin)
+	if err := relationship.addPasswordEncryptedKey(key, accountUser.Salt, "pass"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	accountUser.Relationships = append(accountUser.Relationships, *relationship)
+
+	newDB := func() *mockAccountUsersDatabase {
+		return &mockAccountUsersDatabase{
+			mockRotateKeysDatabase: mockRotateKeysDatabase{accountUser: *accountUser, account: *account},
+			relationships: []AccountUserRelationship{
+				*relationship,
+				{AccountUserID: "user-b", AccountID: account.AccountID, Role: AccountUserRoleViewer, PasswordEncryptedKeyEncryptionKey: "key"},
+			},
+		}
+	}
+
+	t.Run("bad password", func(t *testing.T) {
+		db := newDB()
+		if err := (&persistenceLayer{dal: db}).RemoveAccountUser(account.AccountID, "user-b", accountUser.AccountUserID, "other"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if db.deleted != nil || db.updatedAccount {
+			t.Error("Unexpected modification of database")
+		}
+	})
+	t.Run("last admin", func(t *testing.T) {
+		db := newDB()
+		err := (&persistenceLayer{dal: db}).RemoveAccountUser(account.AccountID, accountUser.AccountUserID, accountUser.AccountUserID, "pass")
+		var lastAdminErr ErrLastAccountAdmin
+		if !errors.As(err, &lastAdminErr) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := newDB()
+		if err := (&persistenceLayer{dal: db}).RemoveAccountUser(account.AccountID, "user-b", accountUser.AccountUserID, "pass"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		expected := DeleteAccountUserRelationshipsQueryByAccountUserID{AccountID: account.AccountID, AccountUserID: "user-b"}
+		if db.deleted != expected {
+			t.Errorf("Unexpected deletion %v", db.deleted)
+		}
+		if db.deletedTokens != (DeleteAPITokensQueryByAccountUserID{AccountID: account.AccountID, AccountUserID: "user-b"}) {
+			t.Errorf("Unexpected token deletion %v", db.deletedTokens)
+		}
+		if db.account.KeyVersion != 1 || db.account.PublicKey == account.PublicKey {
+			t.Errorf("Expected keys to be rotated, got version %d", db.account.KeyVersion)
+		}
+		if len(db.auditLog) != 2 || db.auditLog[0].Action != AuditActionRemoveAccountUser || db.auditLog[1].Action != AuditActionRotateKeys {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ListAllAccounts returns all accounts of the instance, including retired
+// and disabled ones, sorted by their creation date.
+func (p *persistenceLayer) ListAllAccounts() ([]AdminAccountResult, error) {
+	accounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up accounts: %w", err)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Created.Before(accounts[j].Created)
+	})
+
+	result := []AdminAccountResult{}
+	if err := readReplica(p.dal, func(dal DataAccessLayer) error {
+		result = []AdminAccountResult{}
+		for _, account := range accounts {
+			stats, err := dal.FindEventStats(FindEventStatsQueryByAccountID(account.AccountID))
+			if err != nil {
+				return fmt.Errorf("persistence: error looking up event stats for account %s: %w", account.AccountID, err)
+			}
+			result = append(result, AdminAccountResult{
+				AccountID:     account.AccountID,
+				Name:          account.Name,
+				Created:       account.Created,
+				Retired:       account.Retired,
+				Disabled:      account.Disabled,
+				EventCount:    stats.Count,
+				LatestEventID: stats.LatestEventID,
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetInstanceUsage aggregates the usage of all accounts of the instance.
+func (p *persistenceLayer) GetInstanceUsage() (InstanceUsageResult, error) {
+	accounts, err := p.ListAllAccounts()
+	if err != nil {
+		return InstanceUsageResult{}, err
+	}
+	var result InstanceUsageResult
+	for _, account := range accounts {
+		result.Accounts++
+		if account.Retired {
+			result.RetiredAccounts++
+		}
+		if account.Disabled {
+			result.DisabledAccounts++
+		}
+		result.Events += account.EventCount
+	}
+	return result, nil
+}
+
+// SetAccountDisabled disables or enables the given account. Disabled
+// accounts do not accept any events, but can still be accessed by their
+// users.
+func (p *persistenceLayer) SetAccountDisabled(accountID string, disabled bool, accountUserID string) error {
+	account, err := p.dal.FindAccount(FindAccountQueryByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account: %w", err)
+	}
+	if account.Disabled == disabled {
+		return nil
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	account.Disabled = disabled
+	if err := txn.UpdateAccount(&account); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error updating account %s: %w", accountID, err)
+	}
+	action := AuditActionEnableAccount
+	if disabled {
+		action = AuditActionDisableAccount
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, action, ""); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording change of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing account update: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type mockAdminDatabase struct {
+	mockRetireAccountDatabase
+	stats   map[string]EventStats
+	updated []Account
+}
+
+func (m *mockAdminDatabase) FindEventStats(q interface{}) (EventStats, error) {
+	return m.stats[string(q.(FindEventStatsQueryByAccountID))], nil
+}
+
+func (m *mockAdminDatabase) UpdateAccount(a *Account) error {
+	m.updated = append(m.updated, *a)
+	return m.updateErr
+}
+
+func (m *mockAdminDatabase) Transaction() (Transaction, error) {
+	return m, m.txnErr
+}
+
+func TestPersistenceLayer_GetInstanceUsage(t *testing.T) {
+	db := &mockAdminDatabase{
+		mockRetireAccountDatabase: mockRetireAccountDatabase{
+			findAccountsResult: []Account{
+				{AccountID: "account-b", Created: time.Unix(20, 0), Disabled: true},
+				{AccountID: "account-a", Created: time.Unix(10, 0), Retired: true},
+			},
+		},
+		stats: map[string]EventStats{
+			"account-a": {Count: 12, LatestEventID: "event-a"},
+			"account-b": {Count: 30},
+		},
+	}
+	p := &persistenceLayer{dal: db}
+
+	accounts, err := p.ListAllAccounts()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(accounts) != 2 || accounts[0].AccountID != "account-a" || accounts[0].EventCount != 12 {
+		t.Errorf("Unexpected accounts %v", accounts)
+	}
+
+	usage, err := p.GetInstanceUsage()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := InstanceUsageResult{Accounts: 2, RetiredAccounts: 1, DisabledAccounts: 1, Events: 42}
+	if !reflect.DeepEqual(expected, usage) {
+		t.Errorf("Expected %v, got %v", expected, usage)
+	}
+}
+
+func TestPersistenceLayer_SetAccountDisabled(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		db := &mockAdminDatabase{
+			mockRetireAccountDatabase: mockRetireAccountDatabase{
+				findAccountResult: Account{AccountID: "account-a"},
+			},
+		}
+		p := &persistenceLayer{dal: db}
+		if err := p.SetAccountDisabled("account-a", true, "user-a"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 || !db.updated[0].Disabled {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+	})
+	t.Run("unchanged", func(t *testing.T) {
+		db := &mockAdminDatabase{
+			mockRetireAccountDatabase: mockRetireAccountDatabase{
+				findAccountResult: Account{AccountID: "account-a", Disabled: true},
+			},
+		}
+		p := &persistenceLayer{dal: db}
+		if err := p.SetAccountDisabled("account-a", true, "user-a"); err != nil || len(db.updated) != 0 {
+			t.Errorf("Unexpected result %v, %v", err, db.updated)
+		}
+	})
+	t.Run("unknown account", func(t *testing.T) {
+		db := &mockAdminDatabase{
+			mockRetireAccountDatabase: mockRetireAccountDatabase{
+				findAccountErr: ErrUnknownAccount("unknown"),
+			},
+		}
+		p := &persistenceLayer{dal: db}
+		err := p.SetAccountDisabled("account-a", false, "user-a")
+		var unknownErr ErrUnknownAccount
+		if !errors.As(err, &unknownErr) {
+			t.Errorf("Expected unknown account error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// aggregateBackfillDays is the number of completed days that are considered
+// when counting aggregates, so that days are not skipped in case the job
+// did not run for a while.
+const aggregateBackfillDays = 3
+
+// laplaceNoise draws a sample from a laplace distribution centered at zero
+// using the given scale. As noised counters are published, the randomness
+// must not be predictable.
+func laplaceNoise(scale float64) (float64, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, fmt.Errorf("persistence: error reading random bytes: %w", err)
+	}
+	// u is uniformly distributed in the open interval (-0.5, 0.5)
+	u := (float64(binary.BigEndian.Uint64(b[:])>>11)+0.5)/(1<<53) - 0.5
+	sign := 1.0
+	if u < 0 {
+		sign = -1.0
+	}
+	return -scale * sign * math.Log(1-2*math.Abs(u)), nil
+}
+
+// noisedCount adds laplace noise to count so that the result is epsilon
+// differentially private with regards to a single event. Negative results
+// are clamped, which does not weaken the guarantee.
+func noisedCount(count int64, epsilon float64) (int64, error) {
+	noise, err := laplaceNoise(1 / epsilon)
+	if err != nil {
+		return 0, err
+	}
+	noised := math.Round(float64(count) + noise)
+	if noised < 0 {
+		return 0, nil
+	}
+	return int64(noised), nil
+}
+
+// CountAggregates records a noised count of events for each completed day
+// that has not been counted yet for any active account. Noise is added only
+// once per day and account, so that querying counters repeatedly does not
+// allow averaging it out. Counters for days that are older than retention
+// are removed.
+func (p *persistenceLayer) CountAggregates(epsilon float64, retention time.Duration) (int, error) {
+	if epsilon <= 0 {
+		return 0, fmt.Errorf("persistence: expected positive epsilon, received %v", epsilon)
+	}
+	now := time.Now()
+	today := startOfDay(now)
+	firstDay := today.AddDate(0, 0, -aggregateBackfillDays)
+
+	accounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error looking up accounts: %w", err)
+	}
+
+	var counted int
+	for _, account := range accounts {
+		if account.Retired || account.Disabled {
+			continue
+		}
+		from := firstDay
+		if created := startOfDay(account.Created); created.After(from) {
+			from = created
+		}
+		days := int(today.Sub(from).Hours() / 24)
+		if days < 1 {
+			continue
+		}
+
+		existing, err := p.dal.FindAggregateCounters(FindAggregateCountersQueryByAccountID{
+			AccountID: account.AccountID,
+			Since:     from,
+		})
+		if err != nil {
+			return counted, fmt.Errorf("persistence: error looking up aggregate counters: %w", err)
+		}
+		seen := map[time.Time]bool{}
+		for _, counter := range existing {
+			seen[startOfDay(counter.Day)] = true
+		}
+
+		counts, err := p.dailyEventCounts(account.AccountID, from, days)
+		if err != nil {
+			return counted, err
+		}
+		for i, count := range counts {
+			day := from.AddDate(0, 0, i)
+			if seen[day] {
+				continue
+			}
+			noised, err := noisedCount(count, epsilon)
+			if err != nil {
+				return counted, err
+			}
+			counterID, err := NewULID()
+			if err != nil {
+				return counted, fmt.Errorf("persistence: error creating counter id: %w", err)
+			}
+			if err := p.dal.CreateAggregateCounter(&AggregateCounter{
+				CounterID: counterID,
+				AccountID: account.AccountID,
+				Day:       day,
+				Count:     noised,
+				Epsilon:   epsilon,
+				Created:   now,
+			}); err != nil {
+				return counted, fmt.Errorf("persistence: error recording aggregate counter: %w", err)
+			}
+			counted++
+		}
+	}
+
+	if retention > 0 {
+		if _, err := p.dal.DeleteAggregateCounters(DeleteAggregateCountersQueryBefore(now.Add(-retention))); err != nil {
+			return counted, fmt.Errorf("persistence: error pruning aggregate counters: %w", err)
+		}
+	}
+	return counted, nil
+}
+
+func (p *persistenceLayer) ListAggregates(accountID string, since time.Time) ([]AggregateResult, error) {
+	counters, err := p.dal.FindAggregateCounters(FindAggregateCountersQueryByAccountID{
+		AccountID: accountID,
+		Since:     since,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up aggregate counters: %w", err)
+	}
+	result := []AggregateResult{}
+	for _, counter := range counters {
+		result = append(result, AggregateResult{
+			Day:     counter.Day,
+			Count:   counter.Count,
+			Epsilon: counter.Epsilon,
+		})
+	}
+	return result, nil
+}
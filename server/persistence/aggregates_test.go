@@ -0,0 +1,154 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+type mockAggregatesDatabase struct {
+	DataAccessLayer
+	accounts []Account
+	daily    int64
+	existing []AggregateCounter
+	created  []AggregateCounter
+	pruned   bool
+}
+
+func (m *mockAggregatesDatabase) FindAccounts(interface{}) ([]Account, error) {
+	return m.accounts, nil
+}
+
+func (m *mockAggregatesDatabase) FindEventStats(interface{}) (EventStats, error) {
+	return EventStats{Count: m.daily}, nil
+}
+
+func (m *mockAggregatesDatabase) FindAggregateCounters(interface{}) ([]AggregateCounter, error) {
+	return m.existing, nil
+}
+
+func (m *mockAggregatesDatabase) CreateAggregateCounter(c *AggregateCounter) error {
+	m.created = append(m.created, *c)
+	return nil
+}
+
+func (m *mockAggregatesDatabase) DeleteAggregateCounters(interface{}) (int64, error) {
+	m.pruned = true
+	return 0, nil
+}
+
+func TestPersistenceLayer_CountAggregates(t *testing.T) {
+	old := time.Now().AddDate(0, -6, 0)
+	yesterday := startOfDay(time.Now()).AddDate(0, 0, -1)
+	tests := []struct {
+		name            string
+		db              *mockAggregatesDatabase
+		expectedCounted int
+	}{
+		{
+			"backfill",
+			&mockAggregatesDatabase{
+				accounts: []Account{{AccountID: "account-a", Created: old}},
+				daily:    100,
+			},
+			aggregateBackfillDays,
+		},
+		{
+			"already counted",
+			&mockAggregatesDatabase{
+				accounts: []Account{{AccountID: "account-a", Created: old}},
+				daily:    100,
+				existing: []AggregateCounter{{CounterID: "counter-a", Day: yesterday}},
+			},
+			aggregateBackfillDays - 1,
+		},
+		{
+			"new account",
+			&mockAggregatesDatabase{
+				accounts: []Account{{AccountID: "account-a", Created: yesterday.Add(time.Hour)}},
+				daily:    100,
+			},
+			1,
+		},
+		{
+			"skipped accounts",
+			&mockAggregatesDatabase{
+				accounts: []Account{
+					{AccountID: "account-a", Created: time.Now()},
+					{AccountID: "account-b", Created: old, Retired: true},
+					{AccountID: "account-c", Created: old, Disabled: true},
+				},
+				daily: 100,
+			},
+			0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.db}
+			counted, err := p.CountAggregates(1, time.Hour*24*365)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if counted != test.expectedCounted || len(test.db.created) != counted {
+				t.Errorf("Expected %d counters, got %d", test.expectedCounted, counted)
+			}
+			for _, counter := range test.db.created {
+				if counter.Epsilon != 1 || counter.Count < 0 {
+					t.Errorf("Unexpected counter %v", counter)
+				}
+				if counter.Day.After(yesterday) {
+					t.Errorf("Unexpected counter for incomplete day %v", counter.Day)
+				}
+			}
+			if !test.db.pruned {
+				t.Error("Expected old counters to be pruned")
+			}
+		})
+	}
+	t.Run("bad epsilon", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockAggregatesDatabase{}}
+		if _, err := p.CountAggregates(0, 0); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
+
+func TestNoisedCount(t *testing.T) {
+	var sum float64
+	const samples = 10000
+	for i := 0; i < samples; i++ {
+		count, err := noisedCount(1000, 1)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		sum += float64(count)
+	}
+	// with a scale of 1 the mean of the samples is very close to the count
+	if mean := sum / samples; math.Abs(mean-1000) > 0.5 {
+		t.Errorf("Unexpected mean %v", mean)
+	}
+	count, err := noisedCount(0, 0.01)
+	if err != nil || count < 0 {
+		t.Errorf("Unexpected result %v, %v", count, err)
+	}
+}
+
+func TestPersistenceLayer_ListAggregates(t *testing.T) {
+	db := &mockAggregatesDatabase{
+		existing: []AggregateCounter{
+			{CounterID: "counter-a", AccountID: "account-a", Count: 12, Epsilon: 0.5},
+		},
+	}
+	p := &persistenceLayer{dal: db}
+	result, err := p.ListAggregates("account-a", time.Now().AddDate(0, -1, 0))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(result) != 1 || result[0].Count != 12 || result[0].Epsilon != 0.5 {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// anomalyBaselineDays is the number of days preceding a day that are used
+// for computing the number of events expected on that day.
+const anomalyBaselineDays = 28
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// dailyEventCounts returns the number of events the given account has
+// received on each of the given number of days, starting at from.
+func (p *persistenceLayer) dailyEventCounts(accountID string, from time.Time, days int) ([]int64, error) {
+	bounds := make([]string, days+1)
+	for i := range bounds {
+		eventID, err := EventIDAt(from.AddDate(0, 0, i))
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error creating event id for day boundary: %w", err)
+		}
+		bounds[i] = eventID
+	}
+	counts := make([]int64, days)
+	if err := readReplica(p.dal, func(dal DataAccessLayer) error {
+		for i := range counts {
+			stats, err := dal.FindEventStats(FindEventStatsQueryByAccountIDSince{
+				AccountID: accountID,
+				Since:     bounds[i],
+				Until:     bounds[i+1],
+			})
+			if err != nil {
+				return fmt.Errorf("persistence: error counting events: %w", err)
+			}
+			counts[i] = stats.Count
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// detectAnomaly compares count against the given baseline. It returns the
+// expected value and the deviation from it in units of standard deviations.
+// As traffic is bursty, the standard deviation is never considered lower
+// than the one of a poisson distribution with the same mean.
+func detectAnomaly(count int64, baseline []int64) (float64, float64) {
+	var sum float64
+	for _, value := range baseline {
+		sum += float64(value)
+	}
+	mean := sum / float64(len(baseline))
+	var variance float64
+	for _, value := range baseline {
+		variance += math.Pow(float64(value)-mean, 2)
+	}
+	stddev := math.Sqrt(variance / float64(len(baseline)))
+	stddev = math.Max(stddev, math.Max(math.Sqrt(mean), 1))
+	return mean, (float64(count) - mean) / stddev
+}
+
+// DetectAnomalies checks the number of events each active account has
+// received on the previous day and records an anomaly in case it deviates
+// from the preceding days by at least threshold standard deviations.
+// Anomalies for days that are older than retention are removed.
+func (p *persistenceLayer) DetectAnomalies(threshold float64, retention time.Duration) (int, error) {
+	now := time.Now()
+	day := startOfDay(now).AddDate(0, 0, -1)
+	baselineStart := day.AddDate(0, 0, -anomalyBaselineDays)
+
+	accounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error looking up accounts: %w", err)
+	}
+
+	var detected int
+	for _, account := range accounts {
+		// accounts without a full baseline would report their first days
+		// as anomalies
+		if account.Retired || account.Disabled || account.Created.After(baselineStart) {
+			continue
+		}
+		counts, err := p.dailyEventCounts(account.AccountID, baselineStart, anomalyBaselineDays+1)
+		if err != nil {
+			return detected, err
+		}
+		count := counts[anomalyBaselineDays]
+		expected, deviation := detectAnomaly(count, counts[:anomalyBaselineDays])
+		if math.Abs(deviation) < threshold {
+			continue
+		}
+
+		existing, err := p.dal.FindTrafficAnomalies(FindTrafficAnomaliesQueryByAccountIDs{
+			AccountIDs: []string{account.AccountID},
+			Since:      day,
+		})
+		if err != nil {
+			return detected, fmt.Errorf("persistence: error looking up anomalies: %w", err)
+		}
+		if len(existing) != 0 {
+			continue
+		}
+
+		anomalyID, err := NewULID()
+		if err != nil {
+			return detected, fmt.Errorf("persistence: error creating anomaly id: %w", err)
+		}
+		if err := p.dal.CreateTrafficAnomaly(&TrafficAnomaly{
+			AnomalyID: anomalyID,
+			AccountID: account.AccountID,
+			Day:       day,
+			Count:     count,
+			Expected:  expected,
+			Deviation: deviation,
+			Detected:  now,
+		}); err != nil {
+			return detected, fmt.Errorf("persistence: error recording anomaly: %w", err)
+		}
+		detected++
+	}
+
+	if retention > 0 {
+		if _, err := p.dal.DeleteTrafficAnomalies(DeleteTrafficAnomaliesQueryBefore(now.Add(-retention))); err != nil {
+			return detected, fmt.Errorf("persistence: error pruning anomalies: %w", err)
+		}
+	}
+	return detected, nil
+}
+
+func (p *persistenceLayer) ListAnomalies(accountIDs []string, since time.Time) ([]AnomalyResult, error) {
+	result := []AnomalyResult{}
+	if len(accountIDs) == 0 {
+		return result, nil
+	}
+	anomalies, err := p.dal.FindTrafficAnomalies(FindTrafficAnomaliesQueryByAccountIDs{
+		AccountIDs: accountIDs,
+		Since:      since,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up anomalies: %w", err)
+	}
+
+	names := map[string]string{}
+	for _, anomaly := range anomalies {
+		name, ok := names[anomaly.AccountID]
+		if !ok {
+			account, err := p.dal.FindAccount(FindAccountQueryByID(anomaly.AccountID))
+			if err != nil {
+				return nil, fmt.Errorf("persistence: error looking up account %s: %w", anomaly.AccountID, err)
+			}
+			name = account.Name
+			names[anomaly.AccountID] = name
+		}
+		result = append(result, AnomalyResult{
+			AnomalyID:   anomaly.AnomalyID,
+			AccountID:   anomaly.AccountID,
+			AccountName: name,
+			Day:         anomaly.Day,
+			Count:       anomaly.Count,
+			Expected:    anomaly.Expected,
+			Deviation:   anomaly.Deviation,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"testing"
+	"time"
+)
+
+type mockAnomaliesDatabase struct {
+	DataAccessLayer
+	accounts  []Account
+	daily     int64
+	yesterday int64
+	existing  []TrafficAnomaly
+	created   []TrafficAnomaly
+	pruned    bool
+}
+
+func (m *mockAnomaliesDatabase) FindAccounts(interface{}) ([]Account, error) {
+	return m.accounts, nil
+}
+
+func (m *mockAnomaliesDatabase) FindAccount(q interface{}) (Account, error) {
+	return Account{AccountID: string(q.(FindAccountQueryByID)), Name: "name"}, nil
+}
+
+func (m *mockAnomaliesDatabase) FindEventStats(q interface{}) (EventStats, error) {
+	yesterday, _ := EventIDAt(startOfDay(time.Now()).AddDate(0, 0, -1))
+	if q.(FindEventStatsQueryByAccountIDSince).Since[:10] == yesterday[:10] {
+		return EventStats{Count: m.yesterday}, nil
+	}
+	return EventStats{Count: m.daily}, nil
+}
+
+func (m *mockAnomaliesDatabase) FindTrafficAnomalies(interface{}) ([]TrafficAnomaly, error) {
+	return m.existing, nil
+}
+
+func (m *mockAnomaliesDatabase) CreateTrafficAnomaly(a *TrafficAnomaly) error {
+	m.created = append(m.created, *a)
+	return nil
+}
+
+func (m *mockAnomaliesDatabase) DeleteTrafficAnomalies(interface{}) (int64, error) {
+	m.pruned = true
+	return 0, nil
+}
+
+func TestPersistenceLayer_DetectAnomalies(t *testing.T) {
+	old := time.Now().AddDate(0, -6, 0)
+	tests := []struct {
+		name             string
+		db               *mockAnomaliesDatabase
+		expectedDetected int
+	}{
+		{
+			"usual traffic",
+			&mockAnomaliesDatabase{
+				accounts:  []Account{{AccountID: "account-a", Created: old}},
+				daily:     100,
+				yesterday: 110,
+			},
+			0,
+		},
+		{
+			"spike",
+			&mockAnomaliesDatabase{
+				accounts:  []Account{{AccountID: "account-a", Created: old}},
+				daily:     100,
+				yesterday: 400,
+			},
+			1,
+		},
+		{
+			"drop",
+			&mockAnomaliesDatabase{
+				accounts:  []Account{{AccountID: "account-a", Created: old}},
+				daily:     100,
+				yesterday: 0,
+			},
+			1,
+		},
+		{
+			"already recorded",
+			&mockAnomaliesDatabase{
+				accounts:  []Account{{AccountID: "account-a", Created: old}},
+				daily:     100,
+				yesterday: 400,
+				existing:  []TrafficAnomaly{{AnomalyID: "anomaly-a"}},
+			},
+			0,
+		},
+		{
+			"skipped accounts",
+			&mockAnomaliesDatabase{
+				accounts: []Account{
+					{AccountID: "account-a", Created: time.Now()},
+					{AccountID: "account-b", Created: old, Retired: true},
+					{AccountID: "account-c", Created: old, Disabled: true},
+				},
+				daily:     100,
+				yesterday: 400,
+			},
+			0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &persistenceLayer{dal: test.db}
+			detected, err := p.DetectAnomalies(3, time.Hour*24*90)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if detected != test.expectedDetected || len(test.db.created) != detected {
+				t.Errorf("Expected %d anomalies, got %d", test.expectedDetected, detected)
+			}
+			if !test.db.pruned {
+				t.Error("Expected old anomalies to be pruned")
+			}
+		})
+	}
+}
+
+func TestDetectAnomaly(t *testing.T) {
+	expected, deviation := detectAnomaly(0, []int64{0, 0, 0, 0})
+	if expected != 0 || deviation != 0 {
+		t.Errorf("Unexpected result %v, %v", expected, deviation)
+	}
+	expected, deviation = detectAnomaly(3, []int64{1, 1, 1, 1})
+	if expected != 1 || deviation != 2 {
+		t.Errorf("Unexpected result %v, %v", expected, deviation)
+	}
+}
+
+func TestPersistenceLayer_ListAnomalies(t *testing.T) {
+	db := &mockAnomaliesDatabase{
+		existing: []TrafficAnomaly{
+			{AnomalyID: "anomaly-a", AccountID: "account-a", Count: 12},
+		},
+	}
+	p := &persistenceLayer{dal: db}
+	result, err := p.ListAnomalies([]string{"account-a"}, time.Now().AddDate(0, -1, 0))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(result) != 1 || result[0].AccountName != "name" || result[0].Count != 12 {
+		t.Errorf("Unexpected result %v", result)
+	}
+	result, _ = p.ListAnomalies(nil, time.Now())
+	if len(result) != 0 {
+		t.Errorf("Expected empty result, got %v", result)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+)
+
+// The following scopes can be granted to API tokens.
+const (
+	APITokenScopeReadStats     = "read-stats"
+	APITokenScopeManageAccount = "manage-account"
+	APITokenScopeWriteEvents   = "write-events"
+)
+
+const apiTokenPrefix = "offen_"
+
+// ValidateAPITokenScopes checks that the given list of scopes is non-empty
+// and only contains known scopes.
+func ValidateAPITokenScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("persistence: api tokens require at least one scope")
+	}
+	for _, scope := range scopes {
+		switch scope {
+		case APITokenScopeReadStats, APITokenScopeManageAccount, APITokenScopeWriteEvents:
+		default:
+			return fmt.Errorf("persistence: unknown api token scope %s", scope)
+		}
+	}
+	return nil
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *persistenceLayer) CreateAPIToken(accountID, accountUserID, name string, scopes []string) (APITokenResult, error) {
+	if err := ValidateAPITokenScopes(scopes); err != nil {
+		return APITokenResult{}, err
+	}
+	tokenID, err := NewULID()
+	if err != nil {
+		return APITokenResult{}, fmt.Errorf("persistence: error creating api token id: %w", err)
+	}
+	// tokens are random values of sufficient length, so a plain hash is
+	// enough to protect them at rest while still allowing direct lookups
+	value, err := keys.GenerateRandomValueWith(32, base64.RawURLEncoding)
+	if err != nil {
+		return APITokenResult{}, fmt.Errorf("persistence: error creating api token: %w", err)
+	}
+	value = apiTokenPrefix + value
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return APITokenResult{}, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	token := &APIToken{
+		TokenID:       tokenID,
+		AccountID:     accountID,
+		AccountUserID: accountUserID,
+		Name:          name,
+		HashedToken:   hashAPIToken(value),
+		Scopes:        scopes,
+		Created:       time.Now(),
+	}
+	if err := txn.CreateAPIToken(token); err != nil {
+		txn.Rollback()
+		return APITokenResult{}, fmt.Errorf("persistence: error creating api token: %w", err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionCreateToken, tokenID); err != nil {
+		txn.Rollback()
+		return APITokenResult{}, fmt.Errorf("persistence: error recording api token creation: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return APITokenResult{}, fmt.Errorf("persistence: error committing api token: %w", err)
+	}
+
+	result := token.export()
+	result.Token = value
+	return result, nil
+}
+
+func (p *persistenceLayer) LookupAPIToken(token string) (APITokenResult, error) {
+	tokens, err := p.dal.FindAPITokens(FindAPITokensQueryByHashedToken(hashAPIToken(token)))
+	if err != nil {
+		return APITokenResult{}, fmt.Errorf("persistence: error looking up api token: %w", err)
+	}
+	if len(tokens) == 0 {
+		return APITokenResult{}, ErrUnknownAPIToken("persistence: no matching api token found")
+	}
+	return tokens[0].export(), nil
+}
+
+func (p *persistenceLayer) ListAPITokens(accountIDs []string) ([]APITokenResult, error) {
+	result := []APITokenResult{}
+	if len(accountIDs) == 0 {
+		return result, nil
+	}
+	tokens, err := p.dal.FindAPITokens(FindAPITokensQueryByAccountIDs(accountIDs))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error listing api tokens: %w", err)
+	}
+	for _, token := range tokens {
+		result = append(result, token.export())
+	}
+	return result, nil
+}
+
+func (p *persistenceLayer) RevokeAPIToken(accountID, tokenID, accountUserID string) error {
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+
+	affected, err := txn.DeleteAPITokens(DeleteAPITokensQueryByID{AccountID: accountID, TokenID: tokenID})
+	if err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error revoking api token: %w", err)
+	}
+	if affected == 0 {
+		txn.Rollback()
+		return ErrUnknownAPIToken(fmt.Sprintf("persistence: api token %s not found for account %s", tokenID, accountID))
+	}
+
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionRevokeToken, tokenID); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording api token revocation: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing api token revocation: %w", err)
+	}
+	return nil
+}
+
+func (a *APIToken) export() APITokenResult {
+	return APITokenResult{
+		TokenID:       a.TokenID,
+		AccountID:     a.AccountID,
+		AccountUserID: a.AccountUserID,
+		Name:          a.Name,
+		Scopes:        append([]string{}, a.Scopes...),
+		Created:       a.Created,
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type mockAPITokenDatabase struct {
+	DataAccessLayer
+	tokens       []APIToken
+	findQuery    interface{}
+	created      []*APIToken
+	createErr    error
+	deleteResult int64
+	auditLog     []*AuditLogEntry
+}
+
+func (m *mockAPITokenDatabase) CreateAPIToken(a *APIToken) error {
+	m.created = append(m.created, a)
+	return m.createErr
+}
+
+func (m *mockAPITokenDatabase) FindAPITokens(q interface{}) ([]APIToken, error) {
+	m.findQuery = q
+	return m.tokens, nil
+}
+
+func (m *mockAPITokenDatabase) DeleteAPITokens(q interface{}) (int64, error) {
+	return m.deleteResult, nil
+}
+
+func (m *mockAPITokenDatabase) CreateAuditLogEntry(e *AuditLogEntry) error {
+	m.auditLog = append(m.auditLog, e)
+	return nil
+}
+
+func (m *mockAPITokenDatabase) Commit() error {
+	return nil
+}
+
+func (m *mockAPITokenDatabase) Rollback() error {
+	return nil
+}
+
+func (m *mockAPITokenDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func TestValidateAPITokenScopes(t *testing.T) {
+	if err := ValidateAPITokenScopes([]string{APITokenScopeReadStats, APITokenScopeManageAccount, APITokenScopeWriteEvents}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := ValidateAPITokenScopes(nil); err == nil {
+		t.Error("Expected error for missing scopes")
+	}
+	if err := ValidateAPITokenScopes([]string{APITokenScopeReadStats, "root"}); err == nil {
+		t.Error("Expected error for unknown scope")
+	}
+}
+
+func TestPersistenceLayer_CreateAPIToken(t *testing.T) {
+	t.Run("bad scope", func(t *testing.T) {
+		db := &mockAPITokenDatabase{}
+		p := &persistenceLayer{dal: db}
+		if _, err := p.CreateAPIToken("account-a", "user-a", "ci", []string{"root"}); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if len(db.created) != 0 {
+			t.Errorf("Unexpected tokens created %v", db.created)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		db := &mockAPITokenDatabase{createErr: errors.New("did not work")}
+		p := &persistenceLayer{dal: db}
+		if _, err := p.CreateAPIToken("account-a", "user-a", "ci", []string{APITokenScopeReadStats}); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if len(db.auditLog) != 0 {
+			t.Errorf("Unexpected audit log entries %v", db.auditLog)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockAPITokenDatabase{}
+		p := &persistenceLayer{dal: db}
+		result, err := p.CreateAPIToken("account-a", "user-a", "ci", []string{APITokenScopeReadStats})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !strings.HasPrefix(result.Token, apiTokenPrefix) || result.TokenID == "" {
+			t.Errorf("Unexpected result %v", result)
+		}
+		if len(db.created) != 1 {
+			t.Fatalf("Unexpected tokens created %v", db.created)
+		}
+		if db.created[0].HashedToken == result.Token || db.created[0].HashedToken != hashAPIToken(result.Token) {
+			t.Errorf("Expected only a hash of the token to be stored, got %v", db.created[0].HashedToken)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionCreateToken {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+}
+
+func TestPersistenceLayer_LookupAPIToken(t *testing.T) {
+	t.Run("unknown", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockAPITokenDatabase{}}
+		var unknown ErrUnknownAPIToken
+		if _, err := p.LookupAPIToken("offen_abc"); !errors.As(err, &unknown) {
+			t.Errorf("Expected unknown token error, got %v", err)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockAPITokenDatabase{
+			tokens: []APIToken{{TokenID: "token-a", AccountID: "account-a", Scopes: []string{APITokenScopeReadStats}}},
+		}
+		p := &persistenceLayer{dal: db}
+		result, err := p.LookupAPIToken("offen_abc")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if result.TokenID != "token-a" || !result.HasScope(APITokenScopeReadStats) || result.HasScope(APITokenScopeManageAccount) {
+			t.Errorf("Unexpected result %v", result)
+		}
+		if q, ok := db.findQuery.(FindAPITokensQueryByHashedToken); !ok || string(q) != hashAPIToken("offen_abc") {
+			t.Errorf("Unexpected query %v", db.findQuery)
+		}
+	})
+}
+
+func TestPersistenceLayer_RevokeAPIToken(t *testing.T) {
+	t.Run("unknown", func(t *testing.T) {
+		db := &mockAPITokenDatabase{}
+		p := &persistenceLayer{dal: db}
+		var unknown ErrUnknownAPIToken
+		if err := p.RevokeAPIToken("account-a", "token-a", "user-a"); !errors.As(err, &unknown) {
+			t.Errorf("Expected unknown token error, got %v", err)
+		}
+		if len(db.auditLog) != 0 {
+			t.Errorf("Unexpected audit log entries %v", db.auditLog)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockAPITokenDatabase{deleteResult: 1}
+		p := &persistenceLayer{dal: db}
+		if err := p.RevokeAPIToken("account-a", "token-a", "user-a"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionRevokeToken || db.auditLog[0].Target != "token-a" {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+}
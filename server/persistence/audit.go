@@ -0,0 +1,126 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"time"
+)
+
+// The following actions are recorded in the audit log.
+const (
+	AuditActionLogin                = "login"
+	AuditActionChangePassword       = "change-password"
+	AuditActionResetPassword        = "reset-password"
+	AuditActionChangeEmail          = "change-email"
+	AuditActionChangeRole           = "change-role"
+	AuditActionShareAccount         = "share-account"
+	AuditActionResendInvite         = "resend-invitation"
+	AuditActionRevokeInvite         = "revoke-invitation"
+	AuditActionRestoreAccount       = "restore-account"
+	AuditActionRetireAccount        = "retire-account"
+	AuditActionPurge                = "purge"
+	AuditActionResetEvents          = "reset-events"
+	AuditActionCreateShare          = "create-share-link"
+	AuditActionRevokeShare          = "revoke-share-link"
+	AuditActionCreateToken          = "create-api-token"
+	AuditActionRevokeToken          = "revoke-api-token"
+	AuditActionUpdateRetention      = "update-retention"
+	AuditActionUpdateRetentionRules = "update-retention-rules"
+	AuditActionUpdateBotPolicy      = "update-bot-policy"
+	AuditActionUpdateOrigins        = "update-allowed-origins"
+	AuditActionProvisionUser        = "provision-account-user"
+	AuditActionEnableTwoFactor      = "enable-two-factor"
+	AuditActionRegisterPasskey      = "register-passkey"
+	AuditActionDisableAccount       = "disable-account"
+	AuditActionEnableAccount        = "enable-account"
+	AuditActionCreateWebhook        = "create-webhook"
+	AuditActionDeleteWebhook        = "delete-webhook"
+	AuditActionAddDomain            = "add-domain"
+	AuditActionVerifyDomain         = "verify-domain"
+	AuditActionRemoveDomain         = "remove-domain"
+	AuditActionRotateKeys           = "rotate-keys"
+	AuditActionRemoveAccountUser    = "remove-account-user"
+	AuditActionLockAccountUser      = "lock-account-user"
+	AuditActionUnlockAccountUser    = "unlock-account-user"
+	AuditActionUpdateEventTypes     = "update-event-types"
+	AuditActionRecordConsent        = "record-consent"
+	AuditActionUpdateCookiePolicy   = "update-cookie-policy"
+	AuditActionUpdateFeatureFlags   = "update-feature-flags"
+	AuditActionUpdateLocale         = "update-locale"
+	AuditActionUpdateTheme          = "update-theme"
+	AuditActionImportEvents         = "import-events"
+	AuditActionProvision            = "provision"
+	AuditActionRotateWriteKey       = "rotate-write-key"
+	AuditActionRemoveWriteKeys      = "remove-write-keys"
+	AuditActionExchangeAbuse        = "suspected-exchange-abuse"
+)
+
+const defaultAuditLogLimit = 250
+
+// writeAuditLog creates an entry for each of the given accounts using the
+// given access layer. Callers that are running a transaction are expected to
+// pass it so entries are only persisted in case the audited action succeeds.
+func writeAuditLog(dal DataAccessLayer, accountIDs []string, accountUserID, action, target string) error {
+	for _, accountID := range accountIDs {
+		entryID, err := NewULID()
+		if err != nil {
+			return fmt.Errorf("persistence: error creating audit log entry id: %w", err)
+		}
+		if err := dal.CreateAuditLogEntry(&AuditLogEntry{
+			EntryID:       entryID,
+			AccountID:     accountID,
+			AccountUserID: accountUserID,
+			Action:        action,
+			Target:        target,
+			Timestamp:     time.Now(),
+		}); err != nil {
+			return fmt.Errorf("persistence: error creating audit log entry: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *persistenceLayer) RecordAuditLog(accountUserID string, accountIDs []string, action, target string) error {
+	if err := writeAuditLog(p.dal, accountIDs, accountUserID, action, target); err != nil {
+		return fmt.Errorf("persistence: error recording %s: %w", action, err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) GetAuditLog(accountID string, limit int) ([]AuditLogResult, error) {
+	if limit <= 0 {
+		limit = defaultAuditLogLimit
+	}
+	entries, err := p.dal.FindAuditLogEntries(FindAuditLogEntriesQueryByAccountID{
+		AccountID: accountID,
+		Limit:     limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up audit log for account %s: %w", accountID, err)
+	}
+	result := []AuditLogResult{}
+	for _, entry := range entries {
+		result = append(result, AuditLogResult{
+			EntryID:       entry.EntryID,
+			AccountUserID: entry.AccountUserID,
+			Action:        entry.Action,
+			Target:        entry.Target,
+			Timestamp:     entry.Timestamp,
+		})
+	}
+	return result, nil
+}
+
+// ExpireAuditLog deletes all audit log entries that are older than the given
+// retention period.
+func (p *persistenceLayer) ExpireAuditLog(retention time.Duration) (int, error) {
+	affected, err := p.dal.DeleteAuditLogEntries(
+		DeleteAuditLogEntriesQueryOlderThan(time.Now().Add(-retention)),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error expiring audit log entries: %w", err)
+	}
+	return int(affected), nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type mockAuditLogDatabase struct {
+	DataAccessLayer
+	findResult []AuditLogEntry
+	findErr    error
+	created    []*AuditLogEntry
+	createErr  error
+	methodArgs []interface{}
+}
+
+func (m *mockAuditLogDatabase) FindAuditLogEntries(q interface{}) ([]AuditLogEntry, error) {
+	m.methodArgs = append(m.methodArgs, q)
+	return m.findResult, m.findErr
+}
+
+func (m *mockAuditLogDatabase) CreateAuditLogEntry(e *AuditLogEntry) error {
+	m.created = append(m.created, e)
+	return m.createErr
+}
+
+func TestPersistenceLayer_GetAuditLog(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockAuditLogDatabase{findErr: errors.New("did not work")}}
+		if _, err := p.GetAuditLog("account-a", 0); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		ts := time.Now()
+		db := &mockAuditLogDatabase{
+			findResult: []AuditLogEntry{
+				{EntryID: "entry-a", AccountID: "account-a", AccountUserID: "user-a", Action: AuditActionLogin, Timestamp: ts},
+			},
+		}
+		p := &persistenceLayer{dal: db}
+		result, err := p.GetAuditLog("account-a", 0)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		expected := []AuditLogResult{
+			{EntryID: "entry-a", AccountUserID: "user-a", Action: AuditActionLogin, Timestamp: ts},
+		}
+		if !reflect.DeepEqual(expected, result) {
+			t.Errorf("Expected %v, got %v", expected, result)
+		}
+		query := FindAuditLogEntriesQueryByAccountID{AccountID: "account-a", Limit: defaultAuditLogLimit}
+		if !reflect.DeepEqual(db.methodArgs, []interface{}{query}) {
+			t.Errorf("Unexpected method args %v", db.methodArgs)
+		}
+	})
+}
+
+func TestPersistenceLayer_RecordAuditLog(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockAuditLogDatabase{createErr: errors.New("did not work")}}
+		if err := p.RecordAuditLog("user-a", []string{"account-a"}, AuditActionLogin, ""); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockAuditLogDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.RecordAuditLog("user-a", []string{"account-a", "account-b"}, AuditActionLogin, ""); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.created) != 2 {
+			t.Fatalf("Expected 2 entries, got %d", len(db.created))
+		}
+		for i, accountID := range []string{"account-a", "account-b"} {
+			entry := db.created[i]
+			if entry.AccountID != accountID || entry.AccountUserID != "user-a" || entry.Action != AuditActionLogin {
+				t.Errorf("Unexpected entry %v", entry)
+			}
+			if entry.EntryID == "" || entry.Timestamp.IsZero() {
+				t.Errorf("Expected entry id and timestamp to be populated, got %v", entry)
+			}
+		}
+	})
+}
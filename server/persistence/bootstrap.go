@@ -141,7 +141,11 @@ func bootstrapAccounts(config *BootstrapConfig) ([]Account, []AccountUser, []Acc
 				return nil, nil, nil, fmt.Errorf("account with id %s not found", accountID)
 			}
 
-			r, err := newAccountUserRelationship(accountUser.AccountUserID, accountID)
+			role := AccountUserRoleEditor
+			if accountUser.AdminLevel == AccountUserAdminLevelSuperAdmin {
+				role = AccountUserRoleAdmin
+			}
+			r, err := newAccountUserRelationship(accountUser.AccountUserID, accountID, role)
 			if err != nil {
 				return nil, nil, nil, fmt.Errorf("persistence: error creating account user relationship: %w", err)
 			}
@@ -250,7 +254,7 @@ func newAccount(name, accountID string) (*Account, []byte, error) {
 	}, encryptionKey, nil
 }
 
-func newAccountUserRelationship(accountUserID, accountID string) (*AccountUserRelationship, error) {
+func newAccountUserRelationship(accountUserID, accountID string, role AccountUserRole) (*AccountUserRelationship, error) {
 	randomID, err := uuid.NewV4()
 	if err != nil {
 		return nil, fmt.Errorf("persistence: error creating random id for relationship: %w", err)
@@ -259,5 +263,6 @@ func newAccountUserRelationship(accountUserID, accountID string) (*AccountUserRe
 		RelationshipID: randomID.String(),
 		AccountUserID:  accountUserID,
 		AccountID:      accountID,
+		Role:           role,
 	}, nil
 }
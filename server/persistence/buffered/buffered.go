@@ -0,0 +1,372 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package buffered batches event inserts of a data access layer. Events
+// passed to CreateEvent are appended to a write-ahead log on disk and kept in
+// memory until they are flushed to the wrapped data access layer using a
+// single batched insert. A flush happens once a configured number of events
+// is buffered or a configured interval has passed, whichever comes first.
+//
+// In case the process crashes before a flush, the events are read from the
+// write-ahead log and inserted when a new buffer is created for the same
+// directory.
+//
+// Buffered events are not returned by reads until they are flushed. Events
+// created as part of a transaction are not buffered at all.
+package buffered
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/offen/offen/server/metrics"
+	"github.com/offen/offen/server/persistence"
+)
+
+const (
+	defaultMaxEvents = 500
+	defaultInterval  = time.Second
+	segmentPrefix    = "events-"
+	segmentSuffix    = ".wal"
+)
+
+// segment is a single write-ahead log file and the events it contains.
+type segment struct {
+	path   string
+	file   *os.File
+	events []*persistence.Event
+	// recovered segments have been written by a previous process, so some
+	// of their events might have already been inserted
+	recovered bool
+}
+
+// DAL wraps a data access layer, buffering calls to CreateEvent.
+type DAL struct {
+	persistence.DataAccessLayer
+	dir       string
+	maxEvents int
+	interval  time.Duration
+	metrics   *metrics.Registry
+	strict    bool
+
+	mu       sync.Mutex
+	current  *segment
+	sequence int64
+
+	flushMu sync.Mutex
+	pending []*segment
+	full    chan struct{}
+}
+
+// Config adds a configuration value to the buffer.
+type Config func(*DAL)
+
+// WithMaxEvents sets the number of buffered events that triggers a flush.
+func WithMaxEvents(n int) Config {
+	return func(d *DAL) {
+		if n > 0 {
+			d.maxEvents = n
+		}
+	}
+}
+
+// WithInterval sets the maximum time events are buffered before they are
+// flushed.
+func WithInterval(i time.Duration) Config {
+	return func(d *DAL) {
+		if i > 0 {
+			d.interval = i
+		}
+	}
+}
+
+// WithMetrics sets the registry used for recording flush latency.
+func WithMetrics(m *metrics.Registry) Config {
+	return func(d *DAL) {
+		d.metrics = m
+	}
+}
+
+// WithStrictAcknowledgement makes CreateEvent insert events into the wrapped
+// data access layer right away, so callers acknowledge events only once they
+// have been inserted. Events left in the write-ahead log by a previous
+// process are still flushed.
+func WithStrictAcknowledgement() Config {
+	return func(d *DAL) {
+		d.strict = true
+	}
+}
+
+// NewBufferedDAL wraps the given data access layer, storing its write-ahead
+// log in dir. Events left in dir by a previous process are queued for
+// insertion on the next flush.
+func NewBufferedDAL(dal persistence.DataAccessLayer, dir string, configs ...Config) (*DAL, error) {
+	d := &DAL{
+		DataAccessLayer: dal,
+		dir:             dir,
+		maxEvents:       defaultMaxEvents,
+		interval:        defaultInterval,
+		full:            make(chan struct{}, 1),
+	}
+	for _, cfg := range configs {
+		cfg(d)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("buffered: error creating write-ahead log directory: %w", err)
+	}
+	if err := d.recover(); err != nil {
+		return nil, err
+	}
+	if err := d.openSegment(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// CreateEvent appends the event to the write-ahead log. It returns once the
+// event has been synced to disk.
+func (d *DAL) CreateEvent(evt *persistence.Event) error {
+	if d.strict {
+		return d.DataAccessLayer.CreateEvent(evt)
+	}
+	line, err := json.Marshal(evt)
+	if err != nil {
+		return fmt.Errorf("buffered: error encoding event: %w", err)
+	}
+	line = append(line, '\n')
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := d.current.file.Write(line); err != nil {
+		return fmt.Errorf("buffered: error writing event to write-ahead log: %w", err)
+	}
+	if err := d.current.file.Sync(); err != nil {
+		return fmt.Errorf("buffered: error syncing write-ahead log: %w", err)
+	}
+	d.current.events = append(d.current.events, evt)
+	if len(d.current.events) >= d.maxEvents {
+		select {
+		case d.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// DeleteEvents flushes all buffered events before deleting, so that deleted
+// events cannot be inserted afterwards.
+func (d *DAL) DeleteEvents(q interface{}) (int64, error) {
+	if err := d.Flush(); err != nil {
+		return 0, err
+	}
+	return d.DataAccessLayer.DeleteEvents(q)
+}
+
+// ReadReplica is passed to the wrapped data access layer, as buffered events
+// are not visible to reads before being flushed anyways.
+func (d *DAL) ReadReplica(fn func(persistence.DataAccessLayer) error) error {
+	if r, ok := d.DataAccessLayer.(persistence.ReplicaReader); ok {
+		return r.ReadReplica(fn)
+	}
+	return fn(d)
+}
+
+// Run flushes buffered events periodically until ctx is done. Errors are
+// passed to onError, and failed batches are retried on the next flush.
+func (d *DAL) Run(ctx context.Context, onError func(error)) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.full:
+		}
+		if err := d.Flush(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// Flush inserts all buffered events into the wrapped data access layer.
+// Batches are inserted in the order they were buffered and the write-ahead
+// log of a batch is removed once it has been inserted.
+func (d *DAL) Flush() error {
+	d.flushMu.Lock()
+	defer d.flushMu.Unlock()
+
+	if err := d.rotate(); err != nil {
+		return err
+	}
+	for len(d.pending) > 0 {
+		seg := d.pending[0]
+		if err := d.insert(seg); err != nil {
+			return err
+		}
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("buffered: error removing write-ahead log segment: %w", err)
+		}
+		d.pending = d.pending[1:]
+	}
+	return nil
+}
+
+// Close flushes all buffered events and closes the write-ahead log. In case
+// flushing fails, events are kept on disk and are inserted on next startup.
+func (d *DAL) Close() error {
+	flushErr := d.Flush()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.current.file.Close(); err != nil {
+		return fmt.Errorf("buffered: error closing write-ahead log: %w", err)
+	}
+	if len(d.current.events) == 0 {
+		os.Remove(d.current.path)
+	}
+	return flushErr
+}
+
+func (d *DAL) insert(seg *segment) error {
+	events := seg.events
+	if seg.recovered {
+		var err error
+		if events, err = d.withoutExisting(events); err != nil {
+			return err
+		}
+	}
+	start := time.Now()
+	err := d.DataAccessLayer.CreateEvents(events)
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	d.metrics.Histogram(
+		"offen_event_buffer_flush_duration_seconds",
+		"Duration of flushing buffered events in seconds.",
+		metrics.DefaultBuckets,
+		"result",
+	).Observe(time.Since(start).Seconds(), result)
+	if err != nil {
+		return fmt.Errorf("buffered: error inserting %d buffered events: %w", len(events), err)
+	}
+	d.metrics.Counter(
+		"offen_event_buffer_flushed_events_total",
+		"Number of buffered events that have been flushed.",
+	).Add(float64(len(events)))
+	return nil
+}
+
+// withoutExisting removes events that have already been inserted, which
+// happens in case a process crashes after flushing but before removing the
+// segment.
+func (d *DAL) withoutExisting(events []*persistence.Event) ([]*persistence.Event, error) {
+	ids := make([]string, len(events))
+	for i, evt := range events {
+		ids[i] = evt.EventID
+	}
+	existing, err := d.DataAccessLayer.FindEvents(persistence.FindEventsQueryByEventIDs(ids))
+	if err != nil {
+		return nil, fmt.Errorf("buffered: error looking up recovered events: %w", err)
+	}
+	skip := map[string]bool{}
+	for _, evt := range existing {
+		skip[evt.EventID] = true
+	}
+	var result []*persistence.Event
+	for _, evt := range events {
+		if !skip[evt.EventID] {
+			result = append(result, evt)
+		}
+	}
+	return result, nil
+}
+
+// rotate closes the current segment, queues it for insertion and opens a new
+// one. Empty segments are not rotated.
+func (d *DAL) rotate() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.current.events) == 0 {
+		return nil
+	}
+	if err := d.current.file.Close(); err != nil {
+		return fmt.Errorf("buffered: error closing write-ahead log segment: %w", err)
+	}
+	d.pending = append(d.pending, d.current)
+	return d.openSegment()
+}
+
+func (d *DAL) openSegment() error {
+	d.sequence++
+	path := filepath.Join(d.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, d.sequence, segmentSuffix))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("buffered: error creating write-ahead log segment: %w", err)
+	}
+	d.current = &segment{path: path, file: f}
+	return nil
+}
+
+// recover reads all segments in the buffer's directory and queues them for
+// insertion. A trailing partial line caused by a crash while writing is
+// ignored, as the event has never been acknowledged.
+func (d *DAL) recover() error {
+	matches, err := filepath.Glob(filepath.Join(d.dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		return fmt.Errorf("buffered: error listing write-ahead log segments: %w", err)
+	}
+	sort.Strings(matches)
+	for _, path := range matches {
+		var sequence int64
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), segmentPrefix), segmentSuffix)
+		if _, err := fmt.Sscanf(name, "%d", &sequence); err != nil {
+			continue
+		}
+		if sequence > d.sequence {
+			d.sequence = sequence
+		}
+		events, err := readSegment(path)
+		if err != nil {
+			return err
+		}
+		d.pending = append(d.pending, &segment{path: path, events: events, recovered: true})
+	}
+	return nil
+}
+
+func readSegment(path string) ([]*persistence.Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("buffered: error opening write-ahead log segment: %w", err)
+	}
+	defer f.Close()
+
+	var events []*persistence.Event
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// a partially written line is dropped here
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("buffered: error reading write-ahead log segment: %w", err)
+		}
+		var evt persistence.Event
+		if err := json.Unmarshal(line, &evt); err != nil {
+			return nil, fmt.Errorf("buffered: error decoding event in %s: %w", path, err)
+		}
+		events = append(events, &evt)
+	}
+	return events, nil
+}
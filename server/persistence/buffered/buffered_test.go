@@ -0,0 +1,196 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package buffered
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockDAL struct {
+	persistence.DataAccessLayer
+	batches  [][]*persistence.Event
+	created  []*persistence.Event
+	existing []persistence.Event
+	err      error
+}
+
+func (m *mockDAL) CreateEvent(evt *persistence.Event) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.created = append(m.created, evt)
+	return nil
+}
+
+func (m *mockDAL) CreateEvents(evts []*persistence.Event) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.batches = append(m.batches, evts)
+	return nil
+}
+
+func (m *mockDAL) FindEvents(q interface{}) ([]persistence.Event, error) {
+	return m.existing, nil
+}
+
+func (m *mockDAL) DeleteEvents(q interface{}) (int64, error) {
+	return 0, nil
+}
+
+func TestDAL_Flush(t *testing.T) {
+	t.Run("batches events", func(t *testing.T) {
+		base := &mockDAL{}
+		dal, err := NewBufferedDAL(base, t.TempDir())
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		defer dal.Close()
+
+		for _, id := range []string{"a", "b", "c"} {
+			if err := dal.CreateEvent(&persistence.Event{EventID: id}); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+		if len(base.batches) != 0 {
+			t.Errorf("Expected events to be buffered, got %v", base.batches)
+		}
+		if err := dal.Flush(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(base.batches) != 1 || len(base.batches[0]) != 3 {
+			t.Errorf("Unexpected batches %v", base.batches)
+		}
+		if err := dal.Flush(); err != nil || len(base.batches) != 1 {
+			t.Errorf("Expected empty flush to be skipped, got %v", err)
+		}
+	})
+	t.Run("failing insert", func(t *testing.T) {
+		base := &mockDAL{err: errors.New("did not work")}
+		dal, err := NewBufferedDAL(base, t.TempDir())
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		defer dal.Close()
+
+		dal.CreateEvent(&persistence.Event{EventID: "a"})
+		if err := dal.Flush(); err == nil {
+			t.Error("Expected error")
+		}
+		dal.CreateEvent(&persistence.Event{EventID: "b"})
+		base.err = nil
+		if err := dal.Flush(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(base.batches) != 2 || base.batches[0][0].EventID != "a" || base.batches[1][0].EventID != "b" {
+			t.Errorf("Expected failed batch to be retried in order, got %v", base.batches)
+		}
+	})
+	t.Run("full buffer", func(t *testing.T) {
+		dal, err := NewBufferedDAL(&mockDAL{}, t.TempDir(), WithMaxEvents(2))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		defer dal.Close()
+
+		dal.CreateEvent(&persistence.Event{EventID: "a"})
+		dal.CreateEvent(&persistence.Event{EventID: "b"})
+		select {
+		case <-dal.full:
+		default:
+			t.Error("Expected full buffer to be signaled")
+		}
+	})
+}
+
+func TestDAL_strictAcknowledgement(t *testing.T) {
+	dir := t.TempDir()
+	crashed, err := NewBufferedDAL(&mockDAL{}, dir)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	crashed.CreateEvent(&persistence.Event{EventID: "a"})
+	crashed.current.file.Close()
+
+	base := &mockDAL{}
+	dal, err := NewBufferedDAL(base, dir, WithStrictAcknowledgement())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer dal.Close()
+
+	if err := dal.CreateEvent(&persistence.Event{EventID: "b"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(base.created) != 1 || base.created[0].EventID != "b" {
+		t.Errorf("Expected event to be inserted right away, got %v", base.created)
+	}
+	base.err = errors.New("did not work")
+	if err := dal.CreateEvent(&persistence.Event{EventID: "c"}); err == nil {
+		t.Error("Expected error to be returned to caller")
+	}
+	base.err = nil
+	if err := dal.Flush(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(base.batches) != 1 || len(base.batches[0]) != 1 || base.batches[0][0].EventID != "a" {
+		t.Errorf("Expected recovered events to be flushed, got %v", base.batches)
+	}
+}
+
+func TestDAL_recover(t *testing.T) {
+	dir := t.TempDir()
+	crashed, err := NewBufferedDAL(&mockDAL{}, dir)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		crashed.CreateEvent(&persistence.Event{EventID: id})
+	}
+	// simulate a crash while writing the next event
+	crashed.current.file.Write([]byte(`{"EventID":"d"`))
+	crashed.current.file.Close()
+
+	base := &mockDAL{existing: []persistence.Event{{EventID: "a"}}}
+	dal, err := NewBufferedDAL(base, dir)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer dal.Close()
+	if err := dal.Flush(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(base.batches) != 1 || len(base.batches[0]) != 2 || base.batches[0][0].EventID != "b" {
+		t.Errorf("Unexpected batches %v", base.batches)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if len(matches) != 1 {
+		t.Errorf("Expected only the current segment to be left, got %v", matches)
+	}
+}
+
+func TestDAL_Close(t *testing.T) {
+	dir := t.TempDir()
+	base := &mockDAL{}
+	dal, err := NewBufferedDAL(base, dir)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	dal.CreateEvent(&persistence.Event{EventID: "a"})
+	if err := dal.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(base.batches) != 1 {
+		t.Errorf("Expected events to be flushed on close, got %v", base.batches)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("Expected write-ahead log to be removed, got %v", entries)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package clickhouse
+
+import (
+	"fmt"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+// FindAccount reads events from ClickHouse when they are requested together
+// with an account, joining in their secrets from the wrapped data access layer.
+func (e *eventsDAL) FindAccount(q interface{}) (persistence.Account, error) {
+	query, ok := q.(persistence.FindAccountQueryIncludeEvents)
+	if !ok {
+		return e.DataAccessLayer.FindAccount(q)
+	}
+	account, err := e.DataAccessLayer.FindAccount(persistence.FindAccountQueryByID(query.AccountID))
+	if err != nil {
+		return account, err
+	}
+
+	statement := "SELECT * FROM events WHERE account_id = {accountID:String} AND event_id > {since:String}"
+	params := map[string]string{"accountID": query.AccountID, "since": query.Since}
+	if condition := sinceSequenceNumbers(query.SinceSequenceNumbers, params); condition != "" {
+		statement += " AND " + condition
+	}
+	var events []event
+	if err := e.client.Query(statement+" ORDER BY event_id ASC", params, &events); err != nil {
+		return account, fmt.Errorf("clickhouse: error looking up events for account %s: %w", query.AccountID, err)
+	}
+	account.Events = exportEvents(events)
+
+	secretIDs := []string{}
+	seen := map[string]bool{}
+	for _, evt := range account.Events {
+		if evt.SecretID != nil && !seen[*evt.SecretID] {
+			seen[*evt.SecretID] = true
+			secretIDs = append(secretIDs, *evt.SecretID)
+		}
+	}
+	if len(secretIDs) == 0 {
+		return account, nil
+	}
+	secrets, err := e.DataAccessLayer.FindSecrets(persistence.FindSecretsQueryBySecretIDs(secretIDs))
+	if err != nil {
+		return account, err
+	}
+	secretsByID := map[string]persistence.Secret{}
+	for _, secret := range secrets {
+		secretsByID[secret.SecretID] = secret
+	}
+	for i, evt := range account.Events {
+		if evt.SecretID != nil {
+			account.Events[i].Secret = secretsByID[*evt.SecretID]
+		}
+	}
+	return account, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package clickhouse implements the events portion of the data access layer
+// using ClickHouse, which handles large event volumes a lot better than
+// relational databases. All other data is left to the wrapped data access
+// layer.
+//
+// ClickHouse does not support transactions, so event writes and deletions
+// that happen as part of a transaction are applied immediately and are not
+// reverted in case the transaction is rolled back.
+package clickhouse
+
+import (
+	"fmt"
+
+	chclient "github.com/offen/offen/server/clickhouse"
+	"github.com/offen/offen/server/persistence"
+)
+
+type eventsDAL struct {
+	persistence.DataAccessLayer
+	client        *chclient.Client
+	inTransaction bool
+}
+
+// NewEventsDAL wraps the given data access layer, storing events in
+// ClickHouse using the given client.
+func NewEventsDAL(dal persistence.DataAccessLayer, client *chclient.Client) persistence.DataAccessLayer {
+	return &eventsDAL{DataAccessLayer: dal, client: client}
+}
+
+type transaction struct {
+	*eventsDAL
+	txn persistence.Transaction
+}
+
+func (t *transaction) Commit() error {
+	return t.txn.Commit()
+}
+
+func (t *transaction) Rollback() error {
+	return t.txn.Rollback()
+}
+
+func (e *eventsDAL) Transaction() (persistence.Transaction, error) {
+	txn, err := e.DataAccessLayer.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	return &transaction{
+		eventsDAL: &eventsDAL{DataAccessLayer: txn, client: e.client, inTransaction: true},
+		txn:       txn,
+	}, nil
+}
+
+func (e *eventsDAL) Ping() error {
+	if err := e.DataAccessLayer.Ping(); err != nil {
+		return err
+	}
+	if err := e.client.Ping(); err != nil {
+		return fmt.Errorf("clickhouse: error pinging events database: %w", err)
+	}
+	return nil
+}
+
+func (e *eventsDAL) ProbeEmpty() bool {
+	if !e.DataAccessLayer.ProbeEmpty() {
+		return false
+	}
+	var rows []struct {
+		Count int64 `json:"count"`
+	}
+	if err := e.client.Query("SELECT count() AS count FROM events", nil, &rows); err != nil {
+		return false
+	}
+	return len(rows) == 1 && rows[0].Count == 0
+}
+
+func (e *eventsDAL) DropAll() error {
+	if err := e.DataAccessLayer.DropAll(); err != nil {
+		return err
+	}
+	for _, table := range []string{"events", migrationsTable} {
+		if err := e.client.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", table), nil); err != nil {
+			return fmt.Errorf("clickhouse: error dropping table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func (e *eventsDAL) DumpAll() (*persistence.Snapshot, error) {
+	snapshot, err := e.DataAccessLayer.DumpAll()
+	if err != nil {
+		return nil, err
+	}
+	var rows []event
+	if err := e.client.Query("SELECT * FROM events ORDER BY event_id", nil, &rows); err != nil {
+		return nil, fmt.Errorf("clickhouse: error dumping events: %w", err)
+	}
+	snapshot.Events = exportEvents(rows)
+	return snapshot, nil
+}
+
+func (e *eventsDAL) RestoreAll(s *persistence.Snapshot) error {
+	withoutEvents := *s
+	withoutEvents.Events = nil
+	if err := e.DataAccessLayer.RestoreAll(&withoutEvents); err != nil {
+		return err
+	}
+	for _, chunk := range chunks(len(s.Events), insertBatchSize) {
+		var rows []interface{}
+		for _, evt := range s.Events[chunk[0]:chunk[1]] {
+			rows = append(rows, importEvent(&evt))
+		}
+		if err := e.client.Insert("events", rows...); err != nil {
+			return fmt.Errorf("clickhouse: error restoring events: %w", err)
+		}
+	}
+	return nil
+}
+
+// chunks splits a sequence of the given length into [start, end) ranges of
+// at most size elements.
+func chunks(length, size int) [][2]int {
+	var result [][2]int
+	for start := 0; start < length; start += size {
+		end := start + size
+		if end > length {
+			end = length
+		}
+		result = append(result, [2]int{start, end})
+	}
+	return result
+}
@@ -0,0 +1,343 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package clickhouse
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	chclient "github.com/offen/offen/server/clickhouse"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockBaseDAL struct {
+	persistence.DataAccessLayer
+	committed  bool
+	migrated   bool
+	tombstones []*persistence.Tombstone
+	sequences  map[string]int64
+}
+
+func (m *mockBaseDAL) ReserveSequenceNumbers(accountID string, n int64) (int64, error) {
+	if m.sequences == nil {
+		m.sequences = map[string]int64{}
+	}
+	first := m.sequences[accountID] + 1
+	m.sequences[accountID] += n
+	return first, nil
+}
+
+func (m *mockBaseDAL) Transaction() (persistence.Transaction, error) {
+	return m, nil
+}
+
+func (m *mockBaseDAL) Commit() error {
+	m.committed = true
+	return nil
+}
+
+func (m *mockBaseDAL) Rollback() error {
+	return nil
+}
+
+func (m *mockBaseDAL) ApplyMigrations() error {
+	m.migrated = true
+	return nil
+}
+
+func (m *mockBaseDAL) FindAccount(q interface{}) (persistence.Account, error) {
+	if _, ok := q.(persistence.FindAccountQueryByID); !ok {
+		return persistence.Account{}, persistence.ErrBadQuery
+	}
+	return persistence.Account{AccountID: string(q.(persistence.FindAccountQueryByID))}, nil
+}
+
+func (m *mockBaseDAL) FindSecrets(q interface{}) ([]persistence.Secret, error) {
+	return []persistence.Secret{{SecretID: "secret-a", EncryptedSecret: "encrypted"}}, nil
+}
+
+func (m *mockBaseDAL) CreateTombstone(t *persistence.Tombstone) error {
+	m.tombstones = append(m.tombstones, t)
+	return nil
+}
+
+// fakeServer records all statements it receives and responds to SELECT
+// statements with the response registered for the longest matching prefix.
+type fakeServer struct {
+	statements []string
+	params     []map[string]string
+	responses  map[string]string
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	statement := string(b)
+	if q := r.URL.Query().Get("query"); q != "" {
+		statement = q + " " + strings.TrimSpace(statement)
+	}
+	params := map[string]string{}
+	for key, values := range r.URL.Query() {
+		if strings.HasPrefix(key, "param_") {
+			params[strings.TrimPrefix(key, "param_")] = values[0]
+		}
+	}
+	f.statements = append(f.statements, statement)
+	f.params = append(f.params, params)
+
+	var match string
+	for prefix := range f.responses {
+		if strings.HasPrefix(statement, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	data := "[]"
+	if match != "" {
+		data = f.responses[match]
+	}
+	w.Write([]byte(`{"data":` + data + `}`))
+}
+
+func newTestDAL(t *testing.T, responses map[string]string) (*eventsDAL, *mockBaseDAL, *fakeServer, func()) {
+	server := &fakeServer{responses: responses}
+	ts := httptest.NewServer(server)
+	client, err := chclient.New(ts.URL + "/offen")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	base := &mockBaseDAL{}
+	return NewEventsDAL(base, client).(*eventsDAL), base, server, ts.Close
+}
+
+func TestEventsDAL_CreateEvent(t *testing.T) {
+	dal, _, server, closeServer := newTestDAL(t, nil)
+	defer closeServer()
+
+	secretID := "secret-a"
+	if err := dal.CreateEvent(&persistence.Event{EventID: "event-a", AccountID: "account-a", SecretID: &secretID, Payload: "payload"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	expected := `INSERT INTO events FORMAT JSONEachRow {"event_id":"event-a","sequence":"","sequence_number":1,"account_id":"account-a","secret_id":"secret-a","payload":"payload","key_version":0,"event_type":""}`
+	if len(server.statements) != 1 || server.statements[0] != expected {
+		t.Errorf("Unexpected statements %v", server.statements)
+	}
+}
+
+func TestEventsDAL_CreateEvent_reservation(t *testing.T) {
+	t.Run("standalone", func(t *testing.T) {
+		dal, base, server, closeServer := newTestDAL(t, nil)
+		defer closeServer()
+
+		if err := dal.CreateEvent(&persistence.Event{EventID: "event-a", AccountID: "account-a"}); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(server.statements) != 1 || !base.committed {
+			t.Errorf("Expected reservation to be committed after inserting, got %v and %v", server.statements, base.committed)
+		}
+	})
+	t.Run("insert error", func(t *testing.T) {
+		dal, base, _, closeServer := newTestDAL(t, nil)
+		closeServer()
+
+		if err := dal.CreateEvent(&persistence.Event{EventID: "event-a", AccountID: "account-a"}); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if !base.committed || base.sequences["account-a"] != 1 {
+			t.Errorf("Expected reservation to be kept, got %v and %v", base.committed, base.sequences)
+		}
+	})
+	t.Run("transaction", func(t *testing.T) {
+		dal, base, _, closeServer := newTestDAL(t, nil)
+		defer closeServer()
+
+		txn, err := dal.Transaction()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if err := txn.CreateEvent(&persistence.Event{EventID: "event-a", AccountID: "account-a"}); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if base.committed {
+			t.Error("Expected reservation to be held until the transaction is committed")
+		}
+		if err := txn.Commit(); err != nil || !base.committed {
+			t.Errorf("Unexpected result %v and %v", err, base.committed)
+		}
+	})
+}
+
+func TestEventsDAL_CreateEvents(t *testing.T) {
+	dal, _, server, closeServer := newTestDAL(t, nil)
+	defer closeServer()
+
+	if err := dal.CreateEvents([]*persistence.Event{
+		{EventID: "event-a", AccountID: "account-a", Payload: "payload-a"},
+		{EventID: "event-b", AccountID: "account-a", Payload: "payload-b"},
+	}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(server.statements) != 1 || strings.Count(server.statements[0], "event_id") != 2 {
+		t.Errorf("Unexpected statements %v", server.statements)
+	}
+	if !strings.Contains(server.statements[0], `"event_id":"event-b","sequence":"","sequence_number":2`) {
+		t.Errorf("Unexpected sequence numbers in %v", server.statements[0])
+	}
+}
+
+func TestEventsDAL_FindEvents(t *testing.T) {
+	dal, _, server, closeServer := newTestDAL(t, map[string]string{
+		"SELECT * FROM events": `[{"event_id":"event-a","sequence":"seq-a","account_id":"account-a","secret_id":"secret-a","payload":"payload"}]`,
+	})
+	defer closeServer()
+
+	events, err := dal.FindEvents(persistence.FindEventsQueryForSecretIDs{SecretIDs: []string{"secret-a", "secret-b"}, Since: "seq-0"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(events) != 1 || events[0].EventID != "event-a" || *events[0].SecretID != "secret-a" {
+		t.Errorf("Unexpected events %v", events)
+	}
+	expectedParams := map[string]string{"secretIDs": "['secret-a','secret-b']", "since": "seq-0"}
+	if !reflect.DeepEqual(server.params[0], expectedParams) {
+		t.Errorf("Unexpected params %v", server.params[0])
+	}
+
+	if _, err := dal.FindEvents("event-a"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+}
+
+func TestEventsDAL_ordering(t *testing.T) {
+	dal, _, server, closeServer := newTestDAL(t, nil)
+	defer closeServer()
+
+	for _, query := range []persistence.FindEventsQueryForSecretIDs{
+		{SecretIDs: []string{"secret-a"}},
+		{SecretIDs: []string{"secret-a"}, Since: "seq-0"},
+		{SecretIDs: []string{"secret-a"}, Since: "seq-0", After: "event-a", Limit: 10},
+	} {
+		if _, err := dal.FindEvents(query); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if _, err := dal.FindAccount(persistence.FindAccountQueryIncludeEvents{AccountID: "account-a"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for _, statement := range server.statements {
+		if !strings.Contains(statement, "ORDER BY event_id ASC") {
+			t.Errorf("Expected statement to be ordered by event id, got %s", statement)
+		}
+	}
+	if server.params[2]["after"] != "event-a" || server.params[2]["limit"] != "10" {
+		t.Errorf("Unexpected params %v", server.params[2])
+	}
+}
+
+func TestEventsDAL_FindAccount(t *testing.T) {
+	dal, _, server, closeServer := newTestDAL(t, map[string]string{
+		"SELECT * FROM events": `[{"event_id":"event-a","account_id":"account-a","secret_id":"secret-a","payload":"payload"},{"event_id":"event-b","account_id":"account-a","payload":"payload"}]`,
+	})
+	defer closeServer()
+
+	account, err := dal.FindAccount(persistence.FindAccountQueryIncludeEvents{AccountID: "account-a", Since: "event-0"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if account.AccountID != "account-a" || len(account.Events) != 2 {
+		t.Errorf("Unexpected account %v", account)
+	}
+	if account.Events[0].Secret.EncryptedSecret != "encrypted" || account.Events[1].Secret.SecretID != "" {
+		t.Errorf("Unexpected secrets %v", account.Events)
+	}
+	if server.params[0]["since"] != "event-0" {
+		t.Errorf("Unexpected params %v", server.params)
+	}
+}
+
+func TestEventsDAL_DeleteEvents(t *testing.T) {
+	t.Run("no match", func(t *testing.T) {
+		dal, _, server, closeServer := newTestDAL(t, map[string]string{
+			"SELECT count()": `[{"count":0}]`,
+		})
+		defer closeServer()
+
+		affected, err := dal.DeleteEvents(persistence.DeleteEventsQueryByAccountID("account-a"))
+		if err != nil || affected != 0 {
+			t.Errorf("Unexpected result %d, %v", affected, err)
+		}
+		if len(server.statements) != 1 {
+			t.Errorf("Unexpected statements %v", server.statements)
+		}
+	})
+	t.Run("match", func(t *testing.T) {
+		dal, _, server, closeServer := newTestDAL(t, map[string]string{
+			"SELECT count()": `[{"count":3}]`,
+		})
+		defer closeServer()
+
+		affected, err := dal.DeleteEvents(persistence.DeleteEventsQueryExpired{Before: "event-z"})
+		if err != nil || affected != 3 {
+			t.Errorf("Unexpected result %d, %v", affected, err)
+		}
+		if len(server.statements) != 2 || server.statements[1] != "ALTER TABLE events DELETE WHERE event_id < {deadline:String}" {
+			t.Errorf("Unexpected statements %v", server.statements)
+		}
+	})
+}
+
+func TestEventsDAL_Transaction(t *testing.T) {
+	dal, base, server, closeServer := newTestDAL(t, nil)
+	defer closeServer()
+
+	txn, err := dal.Transaction()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := txn.CreateTombstone(&persistence.Tombstone{EventID: "event-a"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := txn.CreateEvent(&persistence.Event{EventID: "event-b"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(base.tombstones) != 1 || !base.committed {
+		t.Errorf("Expected tombstone to be written to base layer, got %v", base)
+	}
+	if len(server.statements) != 1 {
+		t.Errorf("Expected event to be written to ClickHouse, got %v", server.statements)
+	}
+}
+
+func TestEventsDAL_ApplyMigrations(t *testing.T) {
+	dal, base, server, closeServer := newTestDAL(t, map[string]string{
+		"SELECT id FROM offen_migrations": `[{"id":"001_create_events"}]`,
+	})
+	defer closeServer()
+
+	if err := dal.ApplyMigrations(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !base.migrated {
+		t.Error("Expected base layer to be migrated")
+	}
+	for _, statement := range server.statements {
+		if strings.HasPrefix(statement, "CREATE TABLE IF NOT EXISTS events") {
+			t.Errorf("Unexpected reapplication of migration %s", statement)
+		}
+	}
+}
+
+func TestChunks(t *testing.T) {
+	if result := chunks(5, 2); !reflect.DeepEqual(result, [][2]int{{0, 2}, {2, 4}, {4, 5}}) {
+		t.Errorf("Unexpected result %v", result)
+	}
+	if result := chunks(0, 2); len(result) != 0 {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
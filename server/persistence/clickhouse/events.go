@@ -0,0 +1,376 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package clickhouse
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	chclient "github.com/offen/offen/server/clickhouse"
+	"github.com/offen/offen/server/persistence"
+)
+
+const (
+	queryBatchSize  = 500
+	insertBatchSize = 5000
+)
+
+type event struct {
+	EventID        string  `json:"event_id"`
+	Sequence       string  `json:"sequence"`
+	SequenceNumber int64   `json:"sequence_number"`
+	AccountID      string  `json:"account_id"`
+	SecretID       *string `json:"secret_id"`
+	Payload        string  `json:"payload"`
+	KeyVersion     int     `json:"key_version"`
+	EventType      string  `json:"event_type"`
+}
+
+func (e *event) export() persistence.Event {
+	return persistence.Event{
+		EventID:        e.EventID,
+		Sequence:       e.Sequence,
+		SequenceNumber: e.SequenceNumber,
+		AccountID:      e.AccountID,
+		SecretID:       e.SecretID,
+		Payload:        e.Payload,
+		KeyVersion:     e.KeyVersion,
+		EventType:      e.EventType,
+	}
+}
+
+func importEvent(e *persistence.Event) event {
+	return event{
+		EventID:        e.EventID,
+		Sequence:       e.Sequence,
+		SequenceNumber: e.SequenceNumber,
+		AccountID:      e.AccountID,
+		SecretID:       e.SecretID,
+		Payload:        e.Payload,
+		KeyVersion:     e.KeyVersion,
+		EventType:      e.EventType,
+	}
+}
+
+func exportEvents(evts []event) []persistence.Event {
+	result := []persistence.Event{}
+	for _, e := range evts {
+		result = append(result, e.export())
+	}
+	return result
+}
+
+// CreateEvent reserves a sequence number from the wrapped data access layer
+// before inserting the event.
+func (e *eventsDAL) CreateEvent(evt *persistence.Event) error {
+	return e.reserveSequenceNumbers(map[string]int64{evt.AccountID: 1}, func(first map[string]int64) error {
+		evt.SequenceNumber = first[evt.AccountID]
+		if err := e.client.Insert("events", importEvent(evt)); err != nil {
+			return fmt.Errorf("clickhouse: error creating event: %w", err)
+		}
+		return nil
+	})
+}
+
+func (e *eventsDAL) CreateEvents(evts []*persistence.Event) error {
+	counts := map[string]int64{}
+	for _, evt := range evts {
+		counts[evt.AccountID]++
+	}
+	return e.reserveSequenceNumbers(counts, func(next map[string]int64) error {
+		for _, evt := range evts {
+			evt.SequenceNumber = next[evt.AccountID]
+			next[evt.AccountID]++
+		}
+		for _, chunk := range chunks(len(evts), insertBatchSize) {
+			var rows []interface{}
+			for _, evt := range evts[chunk[0]:chunk[1]] {
+				rows = append(rows, importEvent(evt))
+			}
+			if err := e.client.Insert("events", rows...); err != nil {
+				return fmt.Errorf("clickhouse: error creating events: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// reserveSequenceNumbers reserves the given count of sequence numbers for
+// each account and calls insert with the first number of each account.
+// ClickHouse does not support transactions, so the reservation is held
+// until insert returns. Concurrent writers for the same account have to wait
+// for it, which makes events become visible in the order they are numbered
+// in, so clients do not skip events when advancing their cursor.
+func (e *eventsDAL) reserveSequenceNumbers(counts map[string]int64, insert func(first map[string]int64) error) error {
+	dal := e.DataAccessLayer
+	var txn persistence.Transaction
+	if !e.inTransaction {
+		var err error
+		txn, err = e.DataAccessLayer.Transaction()
+		if err != nil {
+			return fmt.Errorf("clickhouse: error creating transaction: %w", err)
+		}
+		dal = txn
+	}
+
+	// counters are locked in a stable order so concurrent batches spanning
+	// multiple accounts cannot deadlock
+	accountIDs := make([]string, 0, len(counts))
+	for accountID := range counts {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Strings(accountIDs)
+	first := map[string]int64{}
+	for _, accountID := range accountIDs {
+		n, err := dal.ReserveSequenceNumbers(accountID, counts[accountID])
+		if err != nil {
+			if txn != nil {
+				txn.Rollback()
+			}
+			return fmt.Errorf("clickhouse: error reserving sequence numbers: %w", err)
+		}
+		first[accountID] = n
+	}
+
+	insertErr := insert(first)
+	if txn != nil {
+		// the reservation is kept even if inserting failed, as parts of a
+		// batch might have been inserted already
+		if err := txn.Commit(); err != nil {
+			return fmt.Errorf("clickhouse: error committing sequence numbers: %w", err)
+		}
+	}
+	return insertErr
+}
+
+func (e *eventsDAL) FindEvents(q interface{}) ([]persistence.Event, error) {
+	var events []event
+	switch query := q.(type) {
+	case persistence.FindEventsQueryExpired:
+		condition, params := expiredEvents(query.Before, query.AccountID, query.ExcludeAccountIDs, query.EventType)
+		if err := e.client.Query("SELECT * FROM events WHERE "+condition, params, &events); err != nil {
+			return nil, fmt.Errorf("clickhouse: error looking up events by age: %w", err)
+		}
+	case persistence.FindEventsQueryForSecretIDs:
+		statement := "SELECT * FROM events WHERE secret_id IN {secretIDs:Array(String)}"
+		params := map[string]string{"secretIDs": chclient.Array(query.SecretIDs)}
+		if query.Since != "" {
+			statement += " AND sequence > {since:String}"
+			params["since"] = query.Since
+		}
+		if condition := sinceSequenceNumbers(query.SinceSequenceNumbers, params); condition != "" {
+			statement += " AND " + condition
+		}
+		if query.After != "" {
+			statement += " AND event_id > {after:String}"
+			params["after"] = query.After
+		}
+		statement += " ORDER BY event_id ASC"
+		if query.Limit > 0 {
+			statement += " LIMIT {limit:UInt32}"
+			params["limit"] = strconv.Itoa(query.Limit)
+		}
+		if err := e.client.Query(statement, params, &events); err != nil {
+			return nil, fmt.Errorf("clickhouse: error looking up events: %w", err)
+		}
+	case persistence.FindEventsQueryByAccountID:
+		statement := "SELECT * FROM events WHERE account_id = {accountID:String} AND event_id > {after:String} ORDER BY event_id ASC"
+		params := map[string]string{"accountID": query.AccountID, "after": query.After}
+		if query.Limit > 0 {
+			statement += " LIMIT {limit:UInt32}"
+			params["limit"] = strconv.Itoa(query.Limit)
+		}
+		if err := e.client.Query(statement, params, &events); err != nil {
+			return nil, fmt.Errorf("clickhouse: error looking up events by account id: %w", err)
+		}
+	case persistence.FindEventsQueryNthNewest:
+		if query.N < 1 {
+			return nil, persistence.ErrBadQuery
+		}
+		statement := "SELECT * FROM events WHERE account_id = {accountID:String}"
+		params := map[string]string{"accountID": query.AccountID, "offset": strconv.FormatInt(query.N-1, 10)}
+		if query.EventType != "" {
+			statement += " AND event_type = {eventType:String}"
+			params["eventType"] = query.EventType
+		}
+		if err := e.client.Query(statement+" ORDER BY event_id DESC LIMIT 1 OFFSET {offset:UInt64}", params, &events); err != nil {
+			return nil, fmt.Errorf("clickhouse: error looking up nth newest event: %w", err)
+		}
+	case persistence.FindEventsQueryByEventIDs:
+		for _, chunk := range chunks(len(query), queryBatchSize) {
+			var next []event
+			if err := e.client.Query(
+				"SELECT * FROM events WHERE event_id IN {eventIDs:Array(String)}",
+				map[string]string{"eventIDs": chclient.Array(query[chunk[0]:chunk[1]])},
+				&next,
+			); err != nil {
+				return nil, fmt.Errorf("clickhouse: error looking up events: %w", err)
+			}
+			events = append(events, next...)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	return exportEvents(events), nil
+}
+
+func (e *eventsDAL) FindEventStats(q interface{}) (persistence.EventStats, error) {
+	statement := "SELECT count() AS count, max(event_id) AS latest_event_id, max(sequence) AS latest_sequence, max(sequence_number) AS latest_sequence_number FROM events WHERE account_id = {accountID:String}"
+	var params map[string]string
+	switch query := q.(type) {
+	case persistence.FindEventStatsQueryByAccountID:
+		params = map[string]string{"accountID": string(query)}
+	case persistence.FindEventStatsQueryByAccountIDSince:
+		statement += " AND event_id > {since:String}"
+		params = map[string]string{"accountID": query.AccountID, "since": query.Since}
+		if query.Until != "" {
+			statement += " AND event_id < {until:String}"
+			params["until"] = query.Until
+		}
+	case persistence.FindEventStatsQueryBySecretID:
+		statement += " AND secret_id = {secretID:String}"
+		params = map[string]string{"accountID": query.AccountID, "secretID": query.SecretID}
+	default:
+		return persistence.EventStats{}, persistence.ErrBadQuery
+	}
+	var rows []struct {
+		Count                int64  `json:"count"`
+		LatestEventID        string `json:"latest_event_id"`
+		LatestSequence       string `json:"latest_sequence"`
+		LatestSequenceNumber int64  `json:"latest_sequence_number"`
+	}
+	if err := e.client.Query(statement, params, &rows); err != nil {
+		return persistence.EventStats{}, fmt.Errorf("clickhouse: error looking up event stats: %w", err)
+	}
+	if len(rows) == 0 {
+		return persistence.EventStats{}, nil
+	}
+	return persistence.EventStats{
+		Count:                rows[0].Count,
+		LatestEventID:        rows[0].LatestEventID,
+		LatestSequence:       rows[0].LatestSequence,
+		LatestSequenceNumber: rows[0].LatestSequenceNumber,
+	}, nil
+}
+
+// deleteWhere deletes all events matching the given condition. ClickHouse
+// does not report the number of affected rows, so matching events are
+// counted before deleting them.
+func (e *eventsDAL) deleteWhere(condition string, params map[string]string) (int64, error) {
+	var rows []struct {
+		Count int64 `json:"count"`
+	}
+	if err := e.client.Query("SELECT count() AS count FROM events WHERE "+condition, params, &rows); err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 || rows[0].Count == 0 {
+		return 0, nil
+	}
+	if err := e.client.Exec("ALTER TABLE events DELETE WHERE "+condition, params); err != nil {
+		return 0, err
+	}
+	return rows[0].Count, nil
+}
+
+func (e *eventsDAL) DeleteEvents(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.DeleteEventsQueryByEventIDs:
+		var affected int64
+		for _, chunk := range chunks(len(query), queryBatchSize) {
+			n, err := e.deleteWhere(
+				"event_id IN {eventIDs:Array(String)}",
+				map[string]string{"eventIDs": chclient.Array(query[chunk[0]:chunk[1]])},
+			)
+			if err != nil {
+				return 0, fmt.Errorf("clickhouse: error deleting events by event id: %w", err)
+			}
+			affected += n
+		}
+		return affected, nil
+	case persistence.DeleteEventsQueryBySecretIDs:
+		affected, err := e.deleteWhere(
+			"secret_id IN {secretIDs:Array(String)}",
+			map[string]string{"secretIDs": chclient.Array(query)},
+		)
+		if err != nil {
+			return 0, fmt.Errorf("clickhouse: error deleting events: %w", err)
+		}
+		return affected, nil
+	case persistence.DeleteEventsQueryBySecretIDsForAccounts:
+		affected, err := e.deleteWhere(
+			"secret_id IN {secretIDs:Array(String)} AND account_id IN {accountIDs:Array(String)}",
+			map[string]string{
+				"secretIDs":  chclient.Array(query.SecretIDs),
+				"accountIDs": chclient.Array(query.AccountIDs),
+			},
+		)
+		if err != nil {
+			return 0, fmt.Errorf("clickhouse: error deleting events: %w", err)
+		}
+		return affected, nil
+	case persistence.DeleteEventsQueryByAccountID:
+		affected, err := e.deleteWhere(
+			"account_id = {accountID:String}",
+			map[string]string{"accountID": string(query)},
+		)
+		if err != nil {
+			return 0, fmt.Errorf("clickhouse: error deleting events by account id: %w", err)
+		}
+		return affected, nil
+	case persistence.DeleteEventsQueryExpired:
+		affected, err := e.deleteWhere(expiredEvents(query.Before, query.AccountID, query.ExcludeAccountIDs, query.EventType))
+		if err != nil {
+			return 0, fmt.Errorf("clickhouse: error deleting events: %w", err)
+		}
+		return affected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
+
+func expiredEvents(before, accountID string, excludeAccountIDs []string, eventType string) (string, map[string]string) {
+	condition := "event_id < {deadline:String}"
+	params := map[string]string{"deadline": before}
+	if accountID != "" {
+		condition += " AND account_id = {accountID:String}"
+		params["accountID"] = accountID
+	}
+	if len(excludeAccountIDs) != 0 {
+		condition += " AND account_id NOT IN {excludeAccountIDs:Array(String)}"
+		params["excludeAccountIDs"] = chclient.Array(excludeAccountIDs)
+	}
+	if eventType != "" {
+		condition += " AND event_type = {eventType:String}"
+		params["eventType"] = eventType
+	}
+	return condition, params
+}
+
+// sinceSequenceNumbers returns a condition matching events with a sequence
+// number higher than the one given for their account, adding the required
+// parameters to params. Events of accounts that are not contained in the map
+// are not restricted.
+func sinceSequenceNumbers(since map[string]int64, params map[string]string) string {
+	if len(since) == 0 {
+		return ""
+	}
+	accountIDs := make([]string, 0, len(since))
+	for accountID := range since {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Strings(accountIDs)
+
+	conditions := []string{"account_id NOT IN {sinceAccountIDs:Array(String)}"}
+	params["sinceAccountIDs"] = chclient.Array(accountIDs)
+	for i, accountID := range accountIDs {
+		conditions = append(conditions, fmt.Sprintf(
+			"(account_id = {sinceAccountID%d:String} AND sequence_number > {sinceSequenceNumber%d:Int64})", i, i,
+		))
+		params[fmt.Sprintf("sinceAccountID%d", i)] = accountID
+		params[fmt.Sprintf("sinceSequenceNumber%d", i)] = strconv.FormatInt(since[accountID], 10)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")"
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package clickhouse
+
+import (
+	"fmt"
+)
+
+const migrationsTable = "offen_migrations"
+
+type migration struct {
+	ID        string
+	Statement string
+}
+
+var migrations = []migration{
+	{
+		ID: "001_create_events",
+		Statement: `CREATE TABLE IF NOT EXISTS events (
+			event_id String,
+			sequence String,
+			account_id String,
+			secret_id Nullable(String),
+			payload String,
+			INDEX secret_id_idx secret_id TYPE bloom_filter GRANULARITY 4
+		) ENGINE = MergeTree ORDER BY (account_id, event_id)`,
+	},
+	{
+		ID:        "002_add_key_version",
+		Statement: `ALTER TABLE events ADD COLUMN IF NOT EXISTS key_version UInt32 DEFAULT 0`,
+	},
+	{
+		ID:        "003_add_event_type",
+		Statement: `ALTER TABLE events ADD COLUMN IF NOT EXISTS event_type String DEFAULT ''`,
+	},
+	{
+		ID:        "004_add_sequence_number",
+		Statement: `ALTER TABLE events ADD COLUMN IF NOT EXISTS sequence_number Int64 DEFAULT 0`,
+	},
+}
+
+// ApplyMigrations applies all pending migrations of the wrapped data access
+// layer before applying the ones for the events table.
+func (e *eventsDAL) ApplyMigrations() error {
+	if err := e.DataAccessLayer.ApplyMigrations(); err != nil {
+		return err
+	}
+	if err := e.client.Exec(
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id String, applied DateTime DEFAULT now()) ENGINE = MergeTree ORDER BY id", migrationsTable),
+		nil,
+	); err != nil {
+		return fmt.Errorf("clickhouse: error creating migrations table: %w", err)
+	}
+
+	var applied []struct {
+		ID string `json:"id"`
+	}
+	if err := e.client.Query(fmt.Sprintf("SELECT id FROM %s", migrationsTable), nil, &applied); err != nil {
+		return fmt.Errorf("clickhouse: error looking up applied migrations: %w", err)
+	}
+	done := map[string]bool{}
+	for _, m := range applied {
+		done[m.ID] = true
+	}
+
+	for _, m := range migrations {
+		if done[m.ID] {
+			continue
+		}
+		if err := e.client.Exec(m.Statement, nil); err != nil {
+			return fmt.Errorf("clickhouse: error applying migration %s: %w", m.ID, err)
+		}
+		if err := e.client.Insert(migrationsTable, map[string]string{"id": m.ID}); err != nil {
+			return fmt.Errorf("clickhouse: error recording migration %s: %w", m.ID, err)
+		}
+	}
+	return nil
+}
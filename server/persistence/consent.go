@@ -0,0 +1,49 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ConsentedAccountIDs returns the ids of all active accounts the given user
+// has opted in to, i.e. the accounts a user secret has been stored for. Ids
+// are sorted so that scopes can be compared.
+func (p *persistenceLayer) ConsentedAccountIDs(userID string) ([]string, error) {
+	accounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up accounts: %w", err)
+	}
+
+	accountIDsBySecretID := map[string]string{}
+	var secretIDs []string
+	for _, account := range accounts {
+		if account.Retired {
+			continue
+		}
+		hashedUserID, err := account.HashUserID(userID)
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error hashing user id for account %s: %w", account.AccountID, err)
+		}
+		accountIDsBySecretID[hashedUserID] = account.AccountID
+		secretIDs = append(secretIDs, hashedUserID)
+	}
+
+	result := []string{}
+	if len(secretIDs) == 0 {
+		return result, nil
+	}
+	secrets, err := p.dal.FindSecrets(FindSecretsQueryBySecretIDs(secretIDs))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up secrets: %w", err)
+	}
+	for _, secret := range secrets {
+		if accountID, ok := accountIDsBySecretID[secret.SecretID]; ok {
+			result = append(result, accountID)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
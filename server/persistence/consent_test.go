@@ -0,0 +1,31 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPersistenceLayer_ConsentedAccountIDs(t *testing.T) {
+	accounts := []Account{
+		{AccountID: "account-b", UserSalt: "{1,} JF+rNeViJeJb0jth6ZheWg=="},
+		{AccountID: "account-a", UserSalt: "{1,} D6xdWYfRqbuWrkg4OWVgGQ=="},
+		{AccountID: "account-c", UserSalt: "{1,} CaHVhk78uhoPmf5wanA0vg=="},
+		{AccountID: "account-d", UserSalt: "{1,} b2tpZG9raQ==", Retired: true},
+	}
+	var secrets []Secret
+	for _, account := range []Account{accounts[0], accounts[1], accounts[3]} {
+		secretID, _ := account.HashUserID("user-id")
+		secrets = append(secrets, Secret{SecretID: secretID})
+	}
+	p := &persistenceLayer{dal: &mockGetUserDataDatabase{accounts: accounts, secrets: secrets}}
+	result, err := p.ConsentedAccountIDs("user-id")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(result, []string{"account-a", "account-b"}) {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
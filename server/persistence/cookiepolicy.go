@@ -0,0 +1,119 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// maxPolicyVersionLength limits the length of the privacy policy version
+// an account can define.
+const maxPolicyVersionLength = 64
+
+// CookiePolicy defines how long the cookies set for users of an account
+// live and which version of the account's privacy policy users need to
+// have consented to. Empty values fall back to the instance wide defaults.
+type CookiePolicy struct {
+	// ConsentLifetime is the duration the consent decision of a user is
+	// kept for before asking again.
+	ConsentLifetime string `json:"consentLifetime,omitempty"`
+	// UserCookieLifetime is the duration the user cookie is kept for. It
+	// never exceeds the retention period of the account.
+	UserCookieLifetime string `json:"userCookieLifetime,omitempty"`
+	// PolicyVersion is the version of the privacy policy of the account.
+	// Changing it asks users that have decided on a different version for
+	// consent again.
+	PolicyVersion string `json:"policyVersion,omitempty"`
+}
+
+// Validate checks whether the lifetimes in the policy are valid durations.
+func (c CookiePolicy) Validate() error {
+	if _, err := c.ConsentLifetimeDuration(); err != nil {
+		return err
+	}
+	if _, err := c.UserCookieLifetimeDuration(); err != nil {
+		return err
+	}
+	if len(c.PolicyVersion) > maxPolicyVersionLength {
+		return fmt.Errorf("persistence: policy version must not be longer than %d characters", maxPolicyVersionLength)
+	}
+	return nil
+}
+
+// ConsentLifetimeDuration returns the lifetime of consent decisions, or zero
+// in case the default applies.
+func (c CookiePolicy) ConsentLifetimeDuration() (time.Duration, error) {
+	return parseLifetime("consent lifetime", c.ConsentLifetime)
+}
+
+// UserCookieLifetimeDuration returns the lifetime of user cookies, or zero in
+// case the default applies.
+func (c CookiePolicy) UserCookieLifetimeDuration() (time.Duration, error) {
+	return parseLifetime("user cookie lifetime", c.UserCookieLifetime)
+}
+
+func parseLifetime(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error parsing %s: %w", name, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("persistence: %s must be positive, received %s", name, value)
+	}
+	return d, nil
+}
+
+func parseCookiePolicy(s string) (CookiePolicy, error) {
+	var policy CookiePolicy
+	if s == "" {
+		return policy, nil
+	}
+	if err := json.Unmarshal([]byte(s), &policy); err != nil {
+		return policy, fmt.Errorf("persistence: error parsing cookie policy: %w", err)
+	}
+	return policy, nil
+}
+
+// UpdateAccountCookiePolicy replaces the cookie policy of the given account.
+func (p *persistenceLayer) UpdateAccountCookiePolicy(accountID string, policy CookiePolicy, accountUserID string) error {
+	if err := policy.Validate(); err != nil {
+		return fmt.Errorf("persistence: invalid cookie policy: %w", err)
+	}
+	a, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account before updating cookie policy: %w", err)
+	}
+
+	var encoded string
+	if policy != (CookiePolicy{}) {
+		b, err := json.Marshal(policy)
+		if err != nil {
+			return fmt.Errorf("persistence: error encoding cookie policy: %w", err)
+		}
+		encoded = string(b)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	a.CookiePolicy = encoded
+	if err := txn.UpdateAccount(&a); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error updating cookie policy of account %s: %w", accountID, err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionUpdateCookiePolicy, policy.PolicyVersion); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording cookie policy update of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing cookie policy update: %w", err)
+	}
+	return nil
+}
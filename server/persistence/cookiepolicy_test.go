@@ -0,0 +1,76 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCookiePolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      CookiePolicy
+		expectError bool
+	}{
+		{"empty", CookiePolicy{}, false},
+		{"ok", CookiePolicy{ConsentLifetime: "8760h", UserCookieLifetime: "720h", PolicyVersion: "2022-05"}, false},
+		{"bad consent lifetime", CookiePolicy{ConsentLifetime: "one year"}, true},
+		{"negative user cookie lifetime", CookiePolicy{UserCookieLifetime: "-1h"}, true},
+		{"long version", CookiePolicy{PolicyVersion: string(make([]byte, maxPolicyVersionLength+1))}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.policy.Validate(); (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
+
+func TestCookiePolicy_Durations(t *testing.T) {
+	policy := CookiePolicy{UserCookieLifetime: "720h"}
+	if d, err := policy.UserCookieLifetimeDuration(); err != nil || d != 720*time.Hour {
+		t.Errorf("Unexpected result %v, %v", d, err)
+	}
+	if d, err := policy.ConsentLifetimeDuration(); err != nil || d != 0 {
+		t.Errorf("Unexpected result %v, %v", d, err)
+	}
+}
+
+func TestPersistenceLayer_UpdateAccountCookiePolicy(t *testing.T) {
+	t.Run("invalid policy", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdateAccountCookiePolicy("account-a", CookiePolicy{ConsentLifetime: "zero"}, "user-a"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if len(db.updated) != 0 {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdateAccountCookiePolicy("account-a", CookiePolicy{PolicyVersion: "2"}, "user-a"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 || db.updated[0].CookiePolicy != `{"policyVersion":"2"}` {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionUpdateCookiePolicy {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+	t.Run("reset", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdateAccountCookiePolicy("account-a", CookiePolicy{}, "user-a"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 || db.updated[0].CookiePolicy != "" {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+	})
+}
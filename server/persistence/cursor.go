@@ -0,0 +1,92 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// sequenceCursorPrefix is used for telling cursors apart from the ULID based
+// sequences that have been handed out to clients before.
+const sequenceCursorPrefix = "c1."
+
+// sequenceCursor is the position of a client in the events of one or more
+// accounts, mapping account ids to the highest sequence number the client
+// has seen. It is handed out to clients as an opaque string.
+type sequenceCursor map[string]int64
+
+// parseSequenceCursor decodes the given value. The second return value is
+// false in case the value is not a cursor, which is the case for ULID based
+// sequences. Values that cannot be decoded are treated as an empty cursor.
+func parseSequenceCursor(s string) (sequenceCursor, bool) {
+	if !strings.HasPrefix(s, sequenceCursorPrefix) {
+		return sequenceCursor{}, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, sequenceCursorPrefix))
+	if err != nil {
+		return sequenceCursor{}, true
+	}
+	c := sequenceCursor{}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return sequenceCursor{}, true
+	}
+	return c, true
+}
+
+// advance moves the cursor for the given account in case the given sequence
+// number is higher than the current position.
+func (c sequenceCursor) advance(accountID string, sequenceNumber int64) {
+	if current, ok := c[accountID]; !ok || sequenceNumber > current {
+		c[accountID] = sequenceNumber
+	}
+}
+
+// String encodes the cursor. Empty cursors are encoded as an empty string.
+func (c sequenceCursor) String() string {
+	if len(c) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(c)
+	return sequenceCursorPrefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// pageCursorPrefix is used for telling page cursors apart from the event ids
+// that have been handed out as cursors before.
+const pageCursorPrefix = "p1."
+
+// pageCursor is the position of a client paging through the results of a
+// query. Pages are ordered by event id, so sequence numbers of events on
+// subsequent pages can be lower than the ones already seen. The cursor
+// therefore carries the sequence that has been reached when the first page
+// was requested, which is handed out once the last page has been returned.
+type pageCursor struct {
+	After    string         `json:"a"`
+	Sequence sequenceCursor `json:"s,omitempty"`
+}
+
+// parsePageCursor decodes the given value. The second return value is false
+// in case the value is an event id that has been handed out as a cursor
+// before, which is returned as the After value of a cursor without sequence.
+func parsePageCursor(s string) (pageCursor, bool) {
+	if !strings.HasPrefix(s, pageCursorPrefix) {
+		return pageCursor{After: s}, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, pageCursorPrefix))
+	if err != nil {
+		return pageCursor{}, true
+	}
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return pageCursor{}, true
+	}
+	return c, true
+}
+
+// String encodes the cursor.
+func (c pageCursor) String() string {
+	b, _ := json.Marshal(c)
+	return pageCursorPrefix + base64.RawURLEncoding.EncodeToString(b)
+}
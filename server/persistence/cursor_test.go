@@ -0,0 +1,233 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSequenceCursor(t *testing.T) {
+	t.Run("roundtrip", func(t *testing.T) {
+		c := sequenceCursor{"account-a": 12}
+		c.advance("account-a", 4)
+		c.advance("account-b", 0)
+		c.advance("account-b", 3)
+		result, ok := parseSequenceCursor(c.String())
+		if !ok {
+			t.Fatal("Expected value to be parsed as cursor")
+		}
+		if !reflect.DeepEqual(result, sequenceCursor{"account-a": 12, "account-b": 3}) {
+			t.Errorf("Unexpected result %v", result)
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		if s := (sequenceCursor{}).String(); s != "" {
+			t.Errorf("Unexpected encoding %v", s)
+		}
+	})
+	t.Run("legacy", func(t *testing.T) {
+		if result, ok := parseSequenceCursor("01DYB9Z08N1M6RF3K0CQ8VW3R6"); ok || len(result) != 0 {
+			t.Errorf("Unexpected result %v, %v", result, ok)
+		}
+	})
+	t.Run("bad value", func(t *testing.T) {
+		if result, ok := parseSequenceCursor(sequenceCursorPrefix + "%%%"); !ok || len(result) != 0 {
+			t.Errorf("Unexpected result %v, %v", result, ok)
+		}
+	})
+}
+
+type mockQueryCursorDatabase struct {
+	mockQueryEventDatabase
+	findTombstonesResult []Tombstone
+}
+
+func (m *mockQueryCursorDatabase) FindTombstones(q interface{}) ([]Tombstone, error) {
+	m.methodArgs = append(m.methodArgs, q)
+	return m.findTombstonesResult, nil
+}
+
+func TestPersistenceLayer_Query_cursor(t *testing.T) {
+	db := &mockQueryCursorDatabase{
+		mockQueryEventDatabase: mockQueryEventDatabase{
+			findAccountsResult: []Account{
+				{AccountID: "account-a", UserSalt: "LEWtq55DKObqPK+XEQbnZA=="},
+				{AccountID: "account-b", UserSalt: "kxwkHp6yPBd0tQ85XlayDg=="},
+			},
+			findEventsResult: []Event{
+				{AccountID: "account-a", EventID: "event-a", SequenceNumber: 8},
+			},
+		},
+		findTombstonesResult: []Tombstone{
+			{AccountID: "account-a", EventID: "event-x", SequenceNumber: 9},
+		},
+	}
+	p := &persistenceLayer{dal: db}
+	since := sequenceCursor{"account-a": 7, "account-b": 2}
+	result, err := p.Query(Query{UserID: "user-id", Since: since.String()})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := (sequenceCursor{"account-a": 9, "account-b": 2}).String(); result.Sequence != expected {
+		t.Errorf("Expected sequence %v, got %v", expected, result.Sequence)
+	}
+	if !reflect.DeepEqual(result.DeletedEvents, []string{"event-x"}) {
+		t.Errorf("Unexpected deleted events %v", result.DeletedEvents)
+	}
+
+	eventsQuery := db.methodArgs[1].(FindEventsQueryForSecretIDs)
+	if eventsQuery.Since != "" || !reflect.DeepEqual(eventsQuery.SinceSequenceNumbers, map[string]int64(since)) {
+		t.Errorf("Unexpected events query %v", eventsQuery)
+	}
+	tombstonesQuery := db.methodArgs[2].(FindTombstonesQueryBySecrets)
+	if tombstonesQuery.Since != "" || !reflect.DeepEqual(tombstonesQuery.SinceSequenceNumbers, map[string]int64(since)) {
+		t.Errorf("Unexpected tombstones query %v", tombstonesQuery)
+	}
+}
+
+func TestPageCursor(t *testing.T) {
+	t.Run("roundtrip", func(t *testing.T) {
+		c := pageCursor{After: "event-a", Sequence: sequenceCursor{"account-a": 12}}
+		result, ok := parsePageCursor(c.String())
+		if !ok {
+			t.Fatal("Expected value to be parsed as cursor")
+		}
+		if !reflect.DeepEqual(result, c) {
+			t.Errorf("Unexpected result %v", result)
+		}
+	})
+	t.Run("legacy", func(t *testing.T) {
+		if result, ok := parsePageCursor("event-a"); ok || result.After != "event-a" || result.Sequence != nil {
+			t.Errorf("Unexpected result %v, %v", result, ok)
+		}
+	})
+}
+
+// mockPagedQueryDatabase filters and orders the events it holds the same way
+// a data access layer would.
+type mockPagedQueryDatabase struct {
+	DataAccessLayer
+	events []Event
+}
+
+func (m *mockPagedQueryDatabase) FindAccounts(q interface{}) ([]Account, error) {
+	return []Account{
+		{AccountID: "account-a", UserSalt: "{1,} D6xdWYfRqbuWrkg4OWVgGQ=="},
+		{AccountID: "account-b", UserSalt: "{1,} JF+rNeViJeJb0jth6ZheWg=="},
+	}, nil
+}
+
+func (m *mockPagedQueryDatabase) FindEvents(q interface{}) ([]Event, error) {
+	query := q.(FindEventsQueryForSecretIDs)
+	var result []Event
+	for _, evt := range m.events {
+		if since, ok := query.SinceSequenceNumbers[evt.AccountID]; ok && evt.SequenceNumber <= since {
+			continue
+		}
+		if evt.EventID <= query.After {
+			continue
+		}
+		result = append(result, evt)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].EventID < result[j].EventID
+	})
+	if query.Limit > 0 && len(result) > query.Limit {
+		result = result[:query.Limit]
+	}
+	return result, nil
+}
+
+func (m *mockPagedQueryDatabase) FindEventStats(q interface{}) (EventStats, error) {
+	query := q.(FindEventStatsQueryBySecretID)
+	var stats EventStats
+	for _, evt := range m.events {
+		if evt.AccountID != query.AccountID {
+			continue
+		}
+		stats.Count++
+		if evt.SequenceNumber > stats.LatestSequenceNumber {
+			stats.LatestSequenceNumber = evt.SequenceNumber
+		}
+	}
+	return stats, nil
+}
+
+func (m *mockPagedQueryDatabase) FindTombstones(q interface{}) ([]Tombstone, error) {
+	return nil, nil
+}
+
+func TestPersistenceLayer_Query_pages(t *testing.T) {
+	db := &mockPagedQueryDatabase{
+		events: []Event{
+			{AccountID: "account-a", EventID: "event-1", SequenceNumber: 5},
+			{AccountID: "account-a", EventID: "event-2", SequenceNumber: 2},
+			{AccountID: "account-a", EventID: "event-3", SequenceNumber: 3},
+			{AccountID: "account-b", EventID: "event-4", SequenceNumber: 1},
+		},
+	}
+	p := &persistenceLayer{dal: db}
+
+	var eventIDs []string
+	collect := func(result EventsResult) {
+		for _, accountID := range []string{"account-a", "account-b"} {
+			for _, evt := range (*result.Events)[accountID] {
+				eventIDs = append(eventIDs, evt.EventID)
+			}
+		}
+	}
+
+	first, err := p.Query(Query{UserID: "user-id", Limit: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	collect(first)
+	if first.NextCursor == "" || first.Sequence != "" {
+		t.Fatalf("Unexpected cursor %v and sequence %v", first.NextCursor, first.Sequence)
+	}
+
+	// a backdated event is inserted before the cursor while paging and
+	// a new event is inserted after it
+	db.events = append(db.events,
+		Event{AccountID: "account-a", EventID: "event-0", SequenceNumber: 6},
+		Event{AccountID: "account-a", EventID: "event-5", SequenceNumber: 7},
+	)
+
+	cursor := first.NextCursor
+	var last EventsResult
+	for cursor != "" {
+		last, err = p.Query(Query{UserID: "user-id", Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		collect(last)
+		if last.NextCursor != "" && last.Sequence != "" {
+			t.Errorf("Unexpected sequence %v before the last page", last.Sequence)
+		}
+		cursor = last.NextCursor
+	}
+	if expected := []string{"event-1", "event-2", "event-3", "event-4", "event-5"}; !reflect.DeepEqual(expected, eventIDs) {
+		t.Errorf("Expected events %v, got %v", expected, eventIDs)
+	}
+	if expected := (sequenceCursor{"account-a": 5, "account-b": 1}).String(); last.Sequence != expected {
+		t.Errorf("Expected sequence %v, got %v", expected, last.Sequence)
+	}
+
+	// the next query returns the events that have been added while paging,
+	// including the one that has been skipped
+	eventIDs = nil
+	next, err := p.Query(Query{UserID: "user-id", Since: last.Sequence})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	collect(next)
+	if expected := []string{"event-0", "event-5"}; !reflect.DeepEqual(expected, eventIDs) {
+		t.Errorf("Expected events %v, got %v", expected, eventIDs)
+	}
+	if expected := (sequenceCursor{"account-a": 7, "account-b": 1}).String(); next.Sequence != expected {
+		t.Errorf("Expected sequence %v, got %v", expected, next.Sequence)
+	}
+}
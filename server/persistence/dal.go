@@ -3,20 +3,33 @@
 
 package persistence
 
+import "time"
+
 // DataAccessLayer provides a database agnostic interface for storing data. All
 // query methods expect certain types to be passed. In case a unknown query is
 // passed, an error can be returned early.
+//
+// Creating events and tombstones assigns them the next sequence numbers of
+// their account. Sequence numbers increase monotonically per account and
+// become visible in the order they have been assigned in, so clients can
+// resume from the highest sequence number they have seen without missing
+// any changes.
 type DataAccessLayer interface {
 	CreateEvent(*Event) error
+	CreateEvents([]*Event) error
+	ReserveSequenceNumbers(accountID string, n int64) (int64, error)
 	FindEvents(interface{}) ([]Event, error)
 	DeleteEvents(interface{}) (int64, error)
+	FindEventStats(interface{}) (EventStats, error)
 	CreateSecret(*Secret) error
 	FindSecret(interface{}) (Secret, error)
+	FindSecrets(interface{}) ([]Secret, error)
 	DeleteSecret(interface{}) error
 	CreateAccount(*Account) error
 	UpdateAccount(*Account) error
 	FindAccount(interface{}) (Account, error)
 	FindAccounts(interface{}) ([]Account, error)
+	DeleteAccount(interface{}) error
 	CreateAccountUser(*AccountUser) error
 	FindAccountUser(interface{}) (AccountUser, error)
 	FindAccountUsers(interface{}) ([]AccountUser, error)
@@ -27,6 +40,52 @@ type DataAccessLayer interface {
 	DeleteAccountUserRelationships(interface{}) error
 	CreateTombstone(*Tombstone) error
 	FindTombstones(interface{}) ([]Tombstone, error)
+	CreateAuditLogEntry(*AuditLogEntry) error
+	FindAuditLogEntries(interface{}) ([]AuditLogEntry, error)
+	DeleteAuditLogEntries(interface{}) (int64, error)
+	CreateShareLink(*ShareLink) error
+	FindShareLink(interface{}) (ShareLink, error)
+	DeleteShareLinks(interface{}) (int64, error)
+	CreateTrafficAnomaly(*TrafficAnomaly) error
+	FindTrafficAnomalies(interface{}) ([]TrafficAnomaly, error)
+	DeleteTrafficAnomalies(interface{}) (int64, error)
+	CreateAggregateCounter(*AggregateCounter) error
+	FindAggregateCounters(interface{}) ([]AggregateCounter, error)
+	DeleteAggregateCounters(interface{}) (int64, error)
+	IncrementPingCounter(accountID string, day time.Time) error
+	FindPingCounters(interface{}) ([]PingCounter, error)
+	DeletePingCounters(interface{}) (int64, error)
+	CreateInvitation(*Invitation) error
+	FindInvitation(interface{}) (Invitation, error)
+	UpdateInvitation(*Invitation) error
+	DeleteInvitations(interface{}) (int64, error)
+	CreateSession(*Session) error
+	FindSessions(interface{}) ([]Session, error)
+	DeleteSessions(interface{}) (int64, error)
+	CreateAPIToken(*APIToken) error
+	FindAPITokens(interface{}) ([]APIToken, error)
+	DeleteAPITokens(interface{}) (int64, error)
+	CreateWebAuthnCredential(*WebAuthnCredential) error
+	FindWebAuthnCredentials(interface{}) ([]WebAuthnCredential, error)
+	UpdateWebAuthnCredential(*WebAuthnCredential) error
+	CreateQueuedMail(*QueuedMail) error
+	FindQueuedMails(interface{}) ([]QueuedMail, error)
+	UpdateQueuedMail(*QueuedMail) error
+	DeleteQueuedMails(interface{}) (int64, error)
+	CreateWebhook(*Webhook) error
+	FindWebhooks(interface{}) ([]Webhook, error)
+	DeleteWebhooks(interface{}) (int64, error)
+	CreateWebhookDelivery(*WebhookDelivery) error
+	FindWebhookDeliveries(interface{}) ([]WebhookDelivery, error)
+	UpdateWebhookDelivery(*WebhookDelivery) error
+	DeleteWebhookDeliveries(interface{}) (int64, error)
+	CreateAccountDomain(*AccountDomain) error
+	FindAccountDomains(interface{}) ([]AccountDomain, error)
+	UpdateAccountDomain(*AccountDomain) error
+	DeleteAccountDomains(interface{}) (int64, error)
+	DumpAll() (*Snapshot, error)
+	DumpAllWithoutEvents() (*Snapshot, error)
+	RestoreAll(*Snapshot) error
 	Transaction() (Transaction, error)
 	ApplyMigrations() error
 	DropAll() error
@@ -34,32 +93,121 @@ type DataAccessLayer interface {
 	Ping() error
 }
 
+// ReplicaReader can be implemented by data access layers that are able to
+// serve reads from read replicas. Replicas might lag behind the primary, so
+// it must only be used for reads whose results are never written back. All
+// reads fn performs are served by the same database.
+type ReplicaReader interface {
+	ReadReplica(fn func(DataAccessLayer) error) error
+}
+
+// readReplica calls fn with a data access layer that might serve reads from
+// a replica. In case the data access layer does not use replicas, fn is
+// called with the data access layer itself.
+func readReplica(dal DataAccessLayer, fn func(DataAccessLayer) error) error {
+	if r, ok := dal.(ReplicaReader); ok {
+		return r.ReadReplica(fn)
+	}
+	return fn(dal)
+}
+
 // FindEventsQueryForSecretIDs requests all events that match the list of
 // secret identifiers. In case the Since value is non-zero it will be used to request
-// only events that are newer than the given ULID.
+// only events that are newer than the given ULID. In case SinceSequenceNumbers
+// contains an account id, only events of this account with a greater sequence
+// number are returned. Events are ordered by their
+// id, the same way FindAccountQueryIncludeEvents orders them. In case After is
+// non-zero, only events with an id greater than After are returned. In case
+// Limit is non-zero, at most Limit events are returned.
 type FindEventsQueryForSecretIDs struct {
-	SecretIDs []string
-	Since     string
+	SecretIDs            []string
+	Since                string
+	SinceSequenceNumbers map[string]int64
+	After                string
+	Limit                int
 }
 
 // FindEventsQueryByEventIDs requests all events that match the given list of
 // identifiers.
 type FindEventsQueryByEventIDs []string
 
-// FindEventsQueryOlderThan looks up all events older than the given event id
-type FindEventsQueryOlderThan string
+// FindEventsQueryExpired looks up all events older than the given event id.
+// In case AccountID is set, only events of this account are considered.
+// Otherwise, events of all accounts except ExcludeAccountIDs are considered.
+// In case EventType is set, only events of this type are considered.
+type FindEventsQueryExpired struct {
+	Before            string
+	AccountID         string
+	ExcludeAccountIDs []string
+	EventType         string
+}
+
+// FindEventsQueryNthNewest requests the N-th newest event of the given
+// account. In case the account stores less than N events, no event is
+// returned. In case EventType is set, only events of this type are counted.
+type FindEventsQueryNthNewest struct {
+	AccountID string
+	N         int64
+	EventType string
+}
+
+// FindEventsQueryByAccountID requests the events of an account in ascending
+// order of their EventID. Only events newer than After are returned, and in
+// case Limit is non-zero, at most Limit events are returned.
+type FindEventsQueryByAccountID struct {
+	AccountID string
+	After     string
+	Limit     int
+}
+
+// FindEventStatsQueryByAccountID requests aggregate information about all
+// events stored for the given account.
+type FindEventStatsQueryByAccountID string
+
+// FindEventStatsQueryByAccountIDSince requests aggregate information about
+// the events stored for the given account whose event id is greater than
+// Since. In case Until is non-empty, only events whose event id is lower
+// than Until are considered.
+type FindEventStatsQueryByAccountIDSince struct {
+	AccountID string
+	Since     string
+	Until     string
+}
+
+// FindEventStatsQueryBySecretID requests aggregate information about the
+// events a single user has stored for the given account.
+type FindEventStatsQueryBySecretID struct {
+	AccountID string
+	SecretID  string
+}
 
 // DeleteEventsQueryBySecretIDs requests deletion of all events that match
 // the given identifiers.
 type DeleteEventsQueryBySecretIDs []string
 
+// DeleteEventsQueryBySecretIDsForAccounts requests deletion of all events
+// that match the given identifiers and belong to one of the given accounts.
+type DeleteEventsQueryBySecretIDsForAccounts struct {
+	SecretIDs  []string
+	AccountIDs []string
+}
+
 // DeleteEventsQueryByEventIDs requests deletion of all events contained in the
 // given set.
 type DeleteEventsQueryByEventIDs []string
 
-// DeleteEventsQueryOlderThan requests deletion of all events older than the
-// given deadline
-type DeleteEventsQueryOlderThan string
+// DeleteEventsQueryByAccountID requests deletion of all events stored for the
+// given account.
+type DeleteEventsQueryByAccountID string
+
+// DeleteEventsQueryExpired requests deletion of all events older than the
+// given event id, using the same semantics as FindEventsQueryExpired.
+type DeleteEventsQueryExpired struct {
+	Before            string
+	AccountID         string
+	ExcludeAccountIDs []string
+	EventType         string
+}
 
 // DeleteSecretQueryBySecretID requests deletion of the secret record with the given
 // secret id.
@@ -68,6 +216,9 @@ type DeleteSecretQueryBySecretID string
 // FindSecretQueryBySecretID requests the secret of the given ID
 type FindSecretQueryBySecretID string
 
+// FindSecretsQueryBySecretIDs requests all secrets matching the given ids.
+type FindSecretsQueryBySecretIDs []string
+
 // FindAccountQueryActiveByID requests a non-retired account of the given ID
 type FindAccountQueryActiveByID string
 
@@ -76,15 +227,25 @@ type FindAccountQueryByID string
 
 // FindAccountQueryIncludeEvents requests the account of the given id including
 // all of the associated events. In case the value for Since is non-zero, only
-// events newer than the given value should be considered.
+// events newer than the given value should be considered. Sequence numbers
+// in SinceSequenceNumbers are applied the same way FindEventsQueryForSecretIDs
+// applies them. Events are expected to be returned in ascending order of
+// their EventID.
 type FindAccountQueryIncludeEvents struct {
-	AccountID string
-	Since     string
+	AccountID            string
+	Since                string
+	SinceSequenceNumbers map[string]int64
 }
 
 // FindAccountsQueryAllAccounts requests all known accounts to be returned.
 type FindAccountsQueryAllAccounts struct{}
 
+// FindAccountsQueryRetired requests all accounts that have been retired.
+type FindAccountsQueryRetired struct{}
+
+// DeleteAccountQueryByID requests deletion of the account with the given id.
+type DeleteAccountQueryByID string
+
 // FindAccountUserQueryByAccountUserIDIncludeRelationships requests the account user of
 // the given id and all of its relationships.
 type FindAccountUserQueryByAccountUserIDIncludeRelationships string
@@ -93,10 +254,30 @@ type FindAccountUserQueryByAccountUserIDIncludeRelationships string
 // with the given account user ID.
 type FindAccountUserRelationshipsQueryByAccountUserID string
 
+// FindAccountUserRelationshipsQueryByAccountID requests all relationships
+// with the given account id.
+type FindAccountUserRelationshipsQueryByAccountID string
+
+// FindAccountUserRelationshipsQueryByInvitationID requests all relationships
+// that have been created by the given invitation.
+type FindAccountUserRelationshipsQueryByInvitationID string
+
+// DeleteAccountUserRelationshipsQueryPendingByInvitationID requests deletion
+// of all relationships created by the given invitation that have not been
+// accepted yet.
+type DeleteAccountUserRelationshipsQueryPendingByInvitationID string
+
 // DeleteAccountUserRelationshipsQueryByAccountID requests deletion of all relationships
 // with the given account id.
 type DeleteAccountUserRelationshipsQueryByAccountID string
 
+// DeleteAccountUserRelationshipsQueryByAccountUserID requests deletion of
+// the relationship between the given account and account user.
+type DeleteAccountUserRelationshipsQueryByAccountUserID struct {
+	AccountID     string
+	AccountUserID string
+}
+
 // FindAccountUsersQueryAllAccountUsers requests all account users.
 type FindAccountUsersQueryAllAccountUsers struct {
 	IncludeRelationships bool
@@ -107,19 +288,212 @@ type FindAccountUsersQueryAllAccountUsers struct {
 type RetireAccountQueryByID string
 
 // FindTombstonesQueryByAccounts requests all tombstones for an account id that are
-// newer than the given sequence
+// newer than the given sequence. Sequence numbers in SinceSequenceNumbers
+// are applied the same way FindEventsQueryForSecretIDs applies them.
 type FindTombstonesQueryByAccounts struct {
-	Since      string
-	AccountIDs []string
+	Since                string
+	SinceSequenceNumbers map[string]int64
+	AccountIDs           []string
 }
 
 // FindTombstonesQueryBySecrets requests all tombstones for an account id that are
-// newer than the given sequence
+// newer than the given sequence. Sequence numbers in SinceSequenceNumbers
+// are applied the same way FindEventsQueryForSecretIDs applies them.
 type FindTombstonesQueryBySecrets struct {
-	Since     string
-	SecretIDs []string
+	Since                string
+	SinceSequenceNumbers map[string]int64
+	SecretIDs            []string
+}
+
+// FindAuditLogEntriesQueryByAccountID requests the most recent audit log
+// entries for the given account, newest first. In case Limit is zero, all
+// entries are returned.
+type FindAuditLogEntriesQueryByAccountID struct {
+	AccountID string
+	Limit     int
+}
+
+// DeleteAuditLogEntriesQueryOlderThan requests deletion of all audit log
+// entries that were recorded before the given time.
+type DeleteAuditLogEntriesQueryOlderThan time.Time
+
+// FindShareLinkQueryByID requests the share link of the given id.
+type FindShareLinkQueryByID string
+
+// DeleteShareLinksQueryByID requests deletion of the share link with the
+// given id, in case it belongs to the given account.
+type DeleteShareLinksQueryByID struct {
+	AccountID string
+	LinkID    string
+}
+
+// DeleteShareLinksQueryExpiredBefore requests deletion of all share links
+// that have expired before the given time.
+type DeleteShareLinksQueryExpiredBefore time.Time
+
+// FindTrafficAnomaliesQueryByAccountIDs requests all anomalies of the given
+// accounts for days from Since on, most recent days first.
+type FindTrafficAnomaliesQueryByAccountIDs struct {
+	AccountIDs []string
+	Since      time.Time
 }
 
+// DeleteTrafficAnomaliesQueryBefore requests deletion of all anomalies for
+// days before the given time.
+type DeleteTrafficAnomaliesQueryBefore time.Time
+
+// FindAggregateCountersQueryByAccountID requests all aggregate counters of
+// the given account for days from Since on, oldest days first.
+type FindAggregateCountersQueryByAccountID struct {
+	AccountID string
+	Since     time.Time
+}
+
+// DeleteAggregateCountersQueryBefore requests deletion of all aggregate
+// counters for days before the given time.
+type DeleteAggregateCountersQueryBefore time.Time
+
+// FindPingCountersQueryByAccountID requests all ping counters of the given
+// account for days from Since on, oldest days first.
+type FindPingCountersQueryByAccountID struct {
+	AccountID string
+	Since     time.Time
+}
+
+// DeletePingCountersQueryBefore requests deletion of all ping counters for
+// days before the given time.
+type DeletePingCountersQueryBefore time.Time
+
+// FindInvitationQueryByID requests the invitation of the given id.
+type FindInvitationQueryByID string
+
+// DeleteInvitationsQueryByID requests deletion of the invitation with the
+// given id.
+type DeleteInvitationsQueryByID string
+
+// FindSessionsQueryByID requests the session of the given id.
+type FindSessionsQueryByID string
+
+// FindSessionsQueryByAccountUserID requests all sessions of the given
+// account user that have not expired yet.
+type FindSessionsQueryByAccountUserID string
+
+// DeleteSessionsQueryByID requests deletion of the session with the given id,
+// in case it belongs to the given account user.
+type DeleteSessionsQueryByID struct {
+	AccountUserID string
+	SessionID     string
+}
+
+// DeleteSessionsQueryByAccountUserID requests deletion of all sessions of the
+// given account user.
+type DeleteSessionsQueryByAccountUserID string
+
+// DeleteSessionsQueryExpiredBefore requests deletion of all sessions that
+// have expired before the given time.
+type DeleteSessionsQueryExpiredBefore time.Time
+
+// FindAPITokensQueryByHashedToken requests the API token matching the given
+// hash.
+type FindAPITokensQueryByHashedToken string
+
+// FindAPITokensQueryByAccountIDs requests all API tokens that have been
+// created for any of the given accounts.
+type FindAPITokensQueryByAccountIDs []string
+
+// DeleteAPITokensQueryByID requests deletion of the API token with the given
+// id, in case it belongs to the given account.
+type DeleteAPITokensQueryByID struct {
+	AccountID string
+	TokenID   string
+}
+
+// DeleteAPITokensQueryByAccountUserID requests deletion of all API tokens
+// the given account user has created for the given account.
+type DeleteAPITokensQueryByAccountUserID struct {
+	AccountID     string
+	AccountUserID string
+}
+
+// FindWebAuthnCredentialsQueryByAccountUserID requests all WebAuthn
+// credentials registered by the given account user.
+type FindWebAuthnCredentialsQueryByAccountUserID string
+
+// FindQueuedMailsQueryDue requests mails that have not failed and are due
+// for delivery at the given time, oldest first. In case Limit is non-zero,
+// at most Limit mails are returned.
+type FindQueuedMailsQueryDue struct {
+	Before time.Time
+	Limit  int
+}
+
+// FindQueuedMailsQueryFailed requests all mails that could not be delivered,
+// newest first.
+type FindQueuedMailsQueryFailed struct{}
+
+// FindQueuedMailsQueryByID requests the queued mail of the given id.
+type FindQueuedMailsQueryByID string
+
+// DeleteQueuedMailsQueryByID requests deletion of the queued mail with the
+// given id.
+type DeleteQueuedMailsQueryByID string
+
+// DeleteQueuedMailsQueryCreatedBefore requests deletion of all queued mails,
+// failed or not, that were created before the given time.
+type DeleteQueuedMailsQueryCreatedBefore time.Time
+
+// FindWebhooksQueryByAccountID requests all webhooks registered for the given
+// account. An empty account id requests all instance wide webhooks.
+type FindWebhooksQueryByAccountID string
+
+// FindWebhooksQueryForAccount requests all webhooks that are notified about
+// events of the given account, i.e. the webhooks of the account itself and
+// all instance wide webhooks.
+type FindWebhooksQueryForAccount string
+
+// FindWebhooksQueryByID requests the webhook of the given id.
+type FindWebhooksQueryByID string
+
+// DeleteWebhooksQueryByID requests deletion of the webhook with the given
+// id in case it has been registered for the given account.
+type DeleteWebhooksQueryByID struct {
+	AccountID string
+	WebhookID string
+}
+
+// DeleteWebhooksQueryByAccountID requests deletion of all webhooks of the
+// given account.
+type DeleteWebhooksQueryByAccountID string
+
+// FindWebhookDeliveriesQueryDue requests deliveries that have neither been
+// delivered nor failed and are due at the given time, oldest first. In case
+// Limit is non-zero, at most Limit deliveries are returned.
+type FindWebhookDeliveriesQueryDue struct {
+	Before time.Time
+	Limit  int
+}
+
+// FindWebhookDeliveriesQueryByWebhookID requests the deliveries of the given
+// webhook, newest first. In case Limit is non-zero, at most Limit deliveries
+// are returned.
+type FindWebhookDeliveriesQueryByWebhookID struct {
+	WebhookID string
+	Limit     int
+}
+
+// DeleteWebhookDeliveriesQueryByWebhookID requests deletion of all
+// deliveries of the given webhook.
+type DeleteWebhookDeliveriesQueryByWebhookID string
+
+// DeleteWebhookDeliveriesQueryByAccountID requests deletion of all
+// deliveries about events of the given account.
+type DeleteWebhookDeliveriesQueryByAccountID string
+
+// DeleteWebhookDeliveriesQueryCompletedBefore requests deletion of all
+// deliveries that have been delivered or have failed and were created
+// before the given time.
+type DeleteWebhookDeliveriesQueryCompletedBefore time.Time
+
 // Transaction is a data access layer that does not persist data until commit
 // is called. In case rollback is called before, the underlying database will
 // remain in the same state as before.
@@ -128,3 +502,18 @@ type Transaction interface {
 	Rollback() error
 	Commit() error
 }
+
+// FindAccountDomainsQueryByAccountID requests all domains claimed by the
+// given account.
+type FindAccountDomainsQueryByAccountID string
+
+// DeleteAccountDomainsQueryByID requests deletion of the domain with the
+// given id in case it belongs to the given account.
+type DeleteAccountDomainsQueryByID struct {
+	AccountID string
+	DomainID  string
+}
+
+// DeleteAccountDomainsQueryByAccountID requests deletion of all domains of
+// the given account.
+type DeleteAccountDomainsQueryByAccountID string
@@ -0,0 +1,185 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/domainverify"
+	"github.com/offen/offen/server/keys"
+)
+
+var domainLabelRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// NormalizeDomain validates the given domain name and returns it in
+// lowercase and without a trailing dot. Values containing a scheme, a port
+// or a path are rejected.
+func NormalizeDomain(value string) (string, error) {
+	domain := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), ".")
+	if len(domain) > 253 {
+		return "", fmt.Errorf("persistence: domain %s is too long", value)
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("persistence: %s is not a fully qualified domain name", value)
+	}
+	for _, label := range labels {
+		if !domainLabelRe.MatchString(label) {
+			return "", fmt.Errorf("persistence: %s is not a valid domain name", value)
+		}
+	}
+	return domain, nil
+}
+
+func (p *persistenceLayer) CreateAccountDomain(accountID, domain, accountUserID string) (AccountDomainResult, error) {
+	normalized, err := NormalizeDomain(domain)
+	if err != nil {
+		return AccountDomainResult{}, err
+	}
+	existing, err := p.dal.FindAccountDomains(FindAccountDomainsQueryByAccountID(accountID))
+	if err != nil {
+		return AccountDomainResult{}, fmt.Errorf("persistence: error looking up domains: %w", err)
+	}
+	// claiming a domain twice returns the existing challenge so that
+	// retrying a request does not invalidate published tokens
+	for _, d := range existing {
+		if d.Domain == normalized {
+			return d.export(), nil
+		}
+	}
+
+	domainID, err := NewULID()
+	if err != nil {
+		return AccountDomainResult{}, fmt.Errorf("persistence: error creating domain id: %w", err)
+	}
+	token, err := keys.GenerateRandomValueWith(24, base64.RawURLEncoding)
+	if err != nil {
+		return AccountDomainResult{}, fmt.Errorf("persistence: error creating domain token: %w", err)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return AccountDomainResult{}, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	d := &AccountDomain{
+		DomainID:  domainID,
+		AccountID: accountID,
+		Domain:    normalized,
+		Token:     token,
+		CreatedBy: accountUserID,
+		Created:   time.Now(),
+	}
+	if err := txn.CreateAccountDomain(d); err != nil {
+		txn.Rollback()
+		return AccountDomainResult{}, fmt.Errorf("persistence: error creating domain: %w", err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionAddDomain, domainID); err != nil {
+		txn.Rollback()
+		return AccountDomainResult{}, fmt.Errorf("persistence: error recording domain creation: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return AccountDomainResult{}, fmt.Errorf("persistence: error committing domain: %w", err)
+	}
+	return d.export(), nil
+}
+
+func (p *persistenceLayer) ListAccountDomains(accountID string) ([]AccountDomainResult, error) {
+	domains, err := p.dal.FindAccountDomains(FindAccountDomainsQueryByAccountID(accountID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error listing domains: %w", err)
+	}
+	result := []AccountDomainResult{}
+	for _, d := range domains {
+		result = append(result, d.export())
+	}
+	return result, nil
+}
+
+func (p *persistenceLayer) VerifyAccountDomain(accountID, domainID, method, accountUserID string, v domainverify.Verifier) (AccountDomainResult, error) {
+	domains, err := p.dal.FindAccountDomains(FindAccountDomainsQueryByAccountID(accountID))
+	if err != nil {
+		return AccountDomainResult{}, fmt.Errorf("persistence: error looking up domains: %w", err)
+	}
+	var match *AccountDomain
+	for i := range domains {
+		if domains[i].DomainID == domainID {
+			match = &domains[i]
+			break
+		}
+	}
+	if match == nil {
+		return AccountDomainResult{}, ErrUnknownAccountDomain(fmt.Sprintf("persistence: domain %s not found", domainID))
+	}
+
+	// the challenge is checked on each request so that domains can be
+	// verified again after their ownership has changed
+	if err := v.Verify(method, match.Domain, match.Token); err != nil {
+		return AccountDomainResult{}, fmt.Errorf("persistence: error verifying domain %s: %w", match.Domain, err)
+	}
+	if !match.Verified.IsZero() {
+		return match.export(), nil
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return AccountDomainResult{}, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	match.Verified = time.Now()
+	if err := txn.UpdateAccountDomain(match); err != nil {
+		txn.Rollback()
+		return AccountDomainResult{}, fmt.Errorf("persistence: error updating domain: %w", err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionVerifyDomain, domainID); err != nil {
+		txn.Rollback()
+		return AccountDomainResult{}, fmt.Errorf("persistence: error recording domain verification: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return AccountDomainResult{}, fmt.Errorf("persistence: error committing domain verification: %w", err)
+	}
+	return match.export(), nil
+}
+
+func (p *persistenceLayer) DeleteAccountDomain(accountID, domainID, accountUserID string) error {
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	affected, err := txn.DeleteAccountDomains(DeleteAccountDomainsQueryByID{AccountID: accountID, DomainID: domainID})
+	if err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error deleting domain: %w", err)
+	}
+	if affected == 0 {
+		txn.Rollback()
+		return ErrUnknownAccountDomain(fmt.Sprintf("persistence: domain %s not found", domainID))
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionRemoveDomain, domainID); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording domain deletion: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing domain deletion: %w", err)
+	}
+	return nil
+}
+
+func (d *AccountDomain) export() AccountDomainResult {
+	result := AccountDomainResult{
+		DomainID: d.DomainID,
+		Domain:   d.Domain,
+		Record:   domainverify.RecordName(d.Domain),
+		Value:    domainverify.RecordValue(d.Token),
+		MetaTag:  domainverify.MetaTag(d.Token),
+		Created:  d.Created,
+	}
+	if !d.Verified.IsZero() {
+		verified := d.Verified
+		result.Verified = &verified
+	}
+	return result
+}
@@ -0,0 +1,200 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockDomainDatabase struct {
+	DataAccessLayer
+	domains map[string]AccountDomain
+	updated int
+}
+
+func newMockDomainDatabase() *mockDomainDatabase {
+	return &mockDomainDatabase{
+		domains: map[string]AccountDomain{
+			"domain-a": {DomainID: "domain-a", AccountID: "account-a", Domain: "www.offen.dev", Token: "token-a"},
+			"domain-b": {DomainID: "domain-b", AccountID: "account-b", Domain: "offen.dev", Token: "token-b", Verified: time.Now()},
+		},
+	}
+}
+
+func (m *mockDomainDatabase) CreateAccountDomain(d *AccountDomain) error {
+	m.domains[d.DomainID] = *d
+	return nil
+}
+
+func (m *mockDomainDatabase) FindAccountDomains(q interface{}) ([]AccountDomain, error) {
+	query, ok := q.(FindAccountDomainsQueryByAccountID)
+	if !ok {
+		return nil, ErrBadQuery
+	}
+	var result []AccountDomain
+	for _, d := range m.domains {
+		if d.AccountID == string(query) {
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockDomainDatabase) UpdateAccountDomain(d *AccountDomain) error {
+	m.updated++
+	m.domains[d.DomainID] = *d
+	return nil
+}
+
+func (m *mockDomainDatabase) DeleteAccountDomains(q interface{}) (int64, error) {
+	query := q.(DeleteAccountDomainsQueryByID)
+	if d, ok := m.domains[query.DomainID]; ok && d.AccountID == query.AccountID {
+		delete(m.domains, query.DomainID)
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m *mockDomainDatabase) CreateAuditLogEntry(*AuditLogEntry) error {
+	return nil
+}
+
+func (m *mockDomainDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func (m *mockDomainDatabase) Commit() error {
+	return nil
+}
+
+func (m *mockDomainDatabase) Rollback() error {
+	return nil
+}
+
+type mockVerifier struct {
+	err    error
+	domain string
+	token  string
+}
+
+func (m *mockVerifier) Verify(method, domain, token string) error {
+	m.domain, m.token = domain, token
+	return m.err
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		expectedResult string
+		expectError    bool
+	}{
+		{"ok", "www.offen.dev", "www.offen.dev", false},
+		{"uppercase and trailing dot", " WWW.Offen.dev. ", "www.offen.dev", false},
+		{"scheme", "https://www.offen.dev", "", true},
+		{"port", "www.offen.dev:8080", "", true},
+		{"path", "www.offen.dev/about", "", true},
+		{"wildcard", "*.offen.dev", "", true},
+		{"single label", "localhost", "", true},
+		{"empty label", "www..offen.dev", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := NormalizeDomain(test.value)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestPersistenceLayer_CreateAccountDomain(t *testing.T) {
+	db := newMockDomainDatabase()
+	p := &persistenceLayer{dal: db}
+	if _, err := p.CreateAccountDomain("account-a", "https://www.offen.dev", "user-a"); err == nil {
+		t.Error("Expected error creating invalid domain")
+	}
+
+	existing, err := p.CreateAccountDomain("account-a", "WWW.offen.dev", "user-a")
+	if err != nil || existing.DomainID != "domain-a" || len(db.domains) != 2 {
+		t.Errorf("Expected existing domain to be returned, got %v, %v", existing, err)
+	}
+
+	result, err := p.CreateAccountDomain("account-a", "blog.offen.dev", "user-a")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	created := db.domains[result.DomainID]
+	if created.Domain != "blog.offen.dev" || created.Token == "" || created.AccountID != "account-a" {
+		t.Errorf("Unexpected domain %v", created)
+	}
+	if result.Record != "_offen-verification.blog.offen.dev" || result.Value != "offen-verification="+created.Token || result.Verified != nil {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
+
+func TestPersistenceLayer_VerifyAccountDomain(t *testing.T) {
+	t.Run("unknown domain", func(t *testing.T) {
+		p := &persistenceLayer{dal: newMockDomainDatabase()}
+		var unknownErr ErrUnknownAccountDomain
+		if _, err := p.VerifyAccountDomain("account-a", "domain-b", "dns", "user-a", &mockVerifier{}); !errors.As(err, &unknownErr) {
+			t.Errorf("Expected unknown domain error, got %v", err)
+		}
+	})
+	t.Run("challenge failed", func(t *testing.T) {
+		db := newMockDomainDatabase()
+		p := &persistenceLayer{dal: db}
+		if _, err := p.VerifyAccountDomain("account-a", "domain-a", "dns", "user-a", &mockVerifier{err: errors.New("did not work")}); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if !db.domains["domain-a"].Verified.IsZero() {
+			t.Error("Expected domain to stay unverified")
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := newMockDomainDatabase()
+		p := &persistenceLayer{dal: db}
+		v := &mockVerifier{}
+		result, err := p.VerifyAccountDomain("account-a", "domain-a", "dns", "user-a", v)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if v.domain != "www.offen.dev" || v.token != "token-a" {
+			t.Errorf("Unexpected challenge %v %v", v.domain, v.token)
+		}
+		if result.Verified == nil || db.domains["domain-a"].Verified.IsZero() {
+			t.Errorf("Expected domain to be verified, got %v", result)
+		}
+	})
+	t.Run("already verified", func(t *testing.T) {
+		db := newMockDomainDatabase()
+		p := &persistenceLayer{dal: db}
+		if _, err := p.VerifyAccountDomain("account-b", "domain-b", "meta", "user-a", &mockVerifier{}); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if db.updated != 0 {
+			t.Errorf("Expected no update, got %d", db.updated)
+		}
+	})
+}
+
+func TestPersistenceLayer_DeleteAccountDomain(t *testing.T) {
+	db := newMockDomainDatabase()
+	p := &persistenceLayer{dal: db}
+	var unknownErr ErrUnknownAccountDomain
+	if err := p.DeleteAccountDomain("account-a", "domain-b", "user-a"); !errors.As(err, &unknownErr) {
+		t.Errorf("Expected unknown domain error, got %v", err)
+	}
+	if err := p.DeleteAccountDomain("account-a", "domain-a", "user-a"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, ok := db.domains["domain-a"]; ok {
+		t.Error("Expected domain to be deleted")
+	}
+}
@@ -16,13 +16,22 @@ import (
 // Event is any analytics event that will be stored in the database. It is
 // uniquely tied to an Account and a Secret model.
 type Event struct {
-	EventID   string
-	Sequence  string
-	AccountID string
+	EventID  string
+	Sequence string
+	// SequenceNumber orders the events and tombstones of an account. It is
+	// assigned by the data access layer on creation.
+	SequenceNumber int64
+	AccountID      string
 	// the secret id is nullable for anonymous events
 	SecretID *string
 	Payload  string
 	Secret   Secret
+	// KeyVersion is the version of the account's keypair the secret of the
+	// event has been encrypted with.
+	KeyVersion int
+	// EventType is the name of the custom event type of the event. It is
+	// empty for untyped events and stored in plaintext.
+	EventType string
 }
 
 // A Tombstone replaces an event on its deletion
@@ -31,6 +40,9 @@ type Tombstone struct {
 	AccountID string
 	SecretID  *string
 	Sequence  string
+	// SequenceNumber shares the sequence of the account's events and is
+	// assigned by the data access layer on creation.
+	SequenceNumber int64
 }
 
 // Secret associates a hashed user id - which ties a user and account together
@@ -39,6 +51,9 @@ type Tombstone struct {
 type Secret struct {
 	SecretID        string
 	EncryptedSecret string
+	// KeyVersion is the version of the account's keypair that has been
+	// current when the secret was created.
+	KeyVersion int
 }
 
 // AccountUserAdminLevel is used to describe the privileges granted to an account
@@ -51,6 +66,41 @@ const (
 	AccountUserAdminLevelSuperAdmin AccountUserAdminLevel = 1
 )
 
+// AccountUserRole describes the privileges an account user has been granted
+// for a single account.
+type AccountUserRole string
+
+// An admin can manage and share the account, an editor can additionally
+// change the styles of the account and a viewer can only access its data.
+const (
+	AccountUserRoleAdmin  AccountUserRole = "admin"
+	AccountUserRoleEditor AccountUserRole = "editor"
+	AccountUserRoleViewer AccountUserRole = "viewer"
+)
+
+func (r AccountUserRole) rank() int {
+	switch r {
+	case AccountUserRoleAdmin:
+		return 3
+	case AccountUserRoleEditor:
+		return 2
+	case AccountUserRoleViewer:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Valid checks whether the role is known.
+func (r AccountUserRole) Valid() bool {
+	return r.rank() != 0
+}
+
+// Includes checks whether the role grants all privileges of the given role.
+func (r AccountUserRole) Includes(other AccountUserRole) bool {
+	return other.Valid() && r.rank() >= other.rank()
+}
+
 // AccountUser is a person that can log in and access data related to all
 // associated accounts.
 type AccountUser struct {
@@ -59,7 +109,34 @@ type AccountUser struct {
 	HashedPassword string
 	Salt           string
 	AdminLevel     AccountUserAdminLevel
-	Relationships  []AccountUserRelationship
+	// TOTPSecret is encrypted using a key derived from the secret of the
+	// instance. It is only used once TOTPEnabled is set.
+	TOTPSecret  string
+	TOTPEnabled bool
+	// TOTPLastStep is the time step of the last one time password that has
+	// been accepted. Codes of this or any earlier step are rejected, so each
+	// code can only be used once.
+	TOTPLastStep int64
+	// RecoveryCodes contains the hashes of all unused recovery codes.
+	RecoveryCodes []string
+	// PasskeyKey encrypts the key encryption keys of all relationships for
+	// logging in using a passkey. It is encrypted using a key derived from
+	// the secret of the instance.
+	PasskeyKey string
+	// FailedLogins counts the failed login attempts since the last successful
+	// login. Once it exceeds the configured threshold, logins are refused
+	// until LockedUntil has passed.
+	FailedLogins  int
+	LockedUntil   time.Time
+	Relationships []AccountUserRelationship
+}
+
+func (a *AccountUser) accountIDs() []string {
+	var result []string
+	for _, relationship := range a.Relationships {
+		result = append(result, relationship.AccountID)
+	}
+	return result
 }
 
 // AccountUserRelationship contains the encrypted KeyEncryptionKeys needed for
@@ -71,6 +148,11 @@ type AccountUserRelationship struct {
 	PasswordEncryptedKeyEncryptionKey string
 	EmailEncryptedKeyEncryptionKey    string
 	OneTimeEncryptedKeyEncryptionKey  string
+	PasskeyEncryptedKeyEncryptionKey  string
+	Role                              AccountUserRole
+	// InvitationID references the invitation that created a relationship
+	// which has not been accepted yet.
+	InvitationID string
 	// this cache is used to prevent deriving the same email or password based
 	// key over and over again when updating a large number of relationships
 	keyCache     map[string][]byte
@@ -160,9 +242,54 @@ type Account struct {
 	EncryptedPrivateKey string
 	UserSalt            string
 	Retired             bool
-	AccountStyles       string
-	Created             time.Time
-	Events              []Event
+	// RetiredAt is the time the account has been retired. Retired accounts
+	// can be restored until they are purged.
+	RetiredAt       time.Time
+	Disabled        bool
+	AccountStyles   string
+	RetentionPeriod string
+	// RetentionRules is the JSON encoded set of RetentionRules defined for
+	// the account.
+	RetentionRules string
+	// BotPolicy defines how events sent by crawlers are handled. An empty
+	// value means the instance wide default applies.
+	BotPolicy string
+	// AllowedOrigins is a comma separated list of origins that are allowed
+	// to send cross origin requests for the account.
+	AllowedOrigins string
+	// EventTypes is the JSON encoded set of EventTypes registered for the
+	// account.
+	EventTypes string
+	// CookiePolicy is the JSON encoded CookiePolicy of the account.
+	CookiePolicy string
+	// FeatureFlags is the JSON encoded set of FeatureFlags that override
+	// the instance wide defaults for the account.
+	FeatureFlags string
+	// Locale is the locale used for emails and pages concerning the
+	// account. An empty value means the locale is negotiated.
+	Locale string
+	// Theme is the JSON encoded Theme of the account.
+	Theme string
+	// WriteKeys is the JSON encoded set of WriteKeys that need to be passed
+	// when submitting events to the account.
+	WriteKeys string
+	// KeyVersion is the version of the account's current keypair. It is
+	// incremented each time the keys of the account are rotated.
+	KeyVersion int
+	// PreviousKeys is the JSON encoded list of AccountKeys the account has
+	// used before its keys were rotated.
+	PreviousKeys string
+	Created      time.Time
+	Events       []Event
+}
+
+// AccountKey is a keypair an account has used before its keys were rotated.
+// The private key is encrypted using the same key as the account's current
+// private key.
+type AccountKey struct {
+	Version             int    `json:"version"`
+	PublicKey           string `json:"publicKey"`
+	EncryptedPrivateKey string `json:"encryptedPrivateKey"`
 }
 
 // HashUserID uses the account's `UserSalt` to create a hashed version of a
@@ -188,3 +315,191 @@ func (a *Account) WrapPublicKey() (jwk.Key, error) {
 	}
 	return key, nil
 }
+
+// AuditLogEntry records a sensitive operation that has been performed on an
+// account. Entries only reference identifiers and must never contain secrets,
+// passwords or event payloads.
+type AuditLogEntry struct {
+	EntryID       string
+	AccountID     string
+	AccountUserID string
+	Action        string
+	Target        string
+	Timestamp     time.Time
+}
+
+// EventStats contains aggregate information about a set of events that can be
+// computed without decrypting any payload.
+type EventStats struct {
+	Count                int64
+	LatestEventID        string
+	LatestSequence       string
+	LatestSequenceNumber int64
+}
+
+// ShareLink grants read-only access to an account's data to anyone holding a
+// token referencing it until it expires or is revoked.
+type ShareLink struct {
+	LinkID        string
+	AccountID     string
+	AccountUserID string
+	Expires       time.Time
+}
+
+// Invitation tracks access to accounts that has been shared with an account
+// user. The relationships created by an invitation can only be accepted until
+// it expires or is revoked.
+type Invitation struct {
+	InvitationID  string
+	AccountUserID string
+	InvitedBy     string
+	Created       time.Time
+	Expires       time.Time
+}
+
+// TrafficAnomaly flags a day on which an account has received an unusual
+// number of events. Only aggregate counts are used for detecting anomalies,
+// the payload of events is never read.
+type TrafficAnomaly struct {
+	AnomalyID string
+	AccountID string
+	Day       time.Time
+	Count     int64
+	Expected  float64
+	Deviation float64
+	Detected  time.Time
+}
+
+// AggregateCounter is the noised number of events an account has received on
+// a single day. Counters are not linked to users and are kept independently
+// of the events they have been computed from.
+type AggregateCounter struct {
+	CounterID string
+	AccountID string
+	Day       time.Time
+	Count     int64
+	Epsilon   float64
+	Created   time.Time
+}
+
+// PingCounter is the number of cookieless pings an account has received on a
+// single day. Pings are never stored on their own, so counters are the only
+// record of them.
+type PingCounter struct {
+	AccountID string
+	Day       time.Time
+	Count     int64
+}
+
+// Session is a server side record of a login. The auth cookie only references
+// a session, so that logins can be revoked before the cookie expires.
+type Session struct {
+	SessionID     string
+	AccountUserID string
+	Created       time.Time
+	Expires       time.Time
+}
+
+// APIToken grants headless access to a single account. Only a hash of the
+// token is stored, the token itself is only known to its creator.
+type APIToken struct {
+	TokenID       string
+	AccountID     string
+	AccountUserID string
+	Name          string
+	HashedToken   string
+	Scopes        []string
+	Created       time.Time
+}
+
+// WebAuthnCredential is a passkey an account user has registered for logging
+// in. The credential itself is stored as an opaque value.
+type WebAuthnCredential struct {
+	CredentialID  string
+	AccountUserID string
+	Credential    string
+	Created       time.Time
+}
+
+// QueuedMail is a transactional email waiting to be delivered. Mails are
+// deleted as soon as they have been delivered. Mails that could not be
+// delivered are kept as failed so they can be inspected and requeued, until
+// they are expired.
+type QueuedMail struct {
+	MailID      string
+	From        string
+	To          string
+	Subject     string
+	Body        string
+	Attempts    int
+	LastError   string
+	NextAttempt time.Time
+	Failed      bool
+	Created     time.Time
+}
+
+// Webhook is an endpoint that is notified about lifecycle events of an
+// account. Webhooks without an account id are registered by super admins and
+// are notified about events of all accounts. The secret is used for signing
+// payloads, so it is stored as is.
+type Webhook struct {
+	WebhookID string
+	AccountID string
+	URL       string
+	Secret    string
+	Events    []string
+	CreatedBy string
+	Created   time.Time
+}
+
+// WebhookDelivery is a notification that is sent to a webhook. Deliveries
+// are kept after they have been attempted so they can be inspected.
+type WebhookDelivery struct {
+	DeliveryID  string
+	WebhookID   string
+	AccountID   string
+	Event       string
+	Payload     string
+	Attempts    int
+	StatusCode  int
+	LastError   string
+	NextAttempt time.Time
+	Delivered   bool
+	Failed      bool
+	Created     time.Time
+}
+
+// AccountDomain is a domain an account has claimed. Ownership of the domain
+// is proven by publishing Token, after which Verified is set.
+type AccountDomain struct {
+	DomainID  string
+	AccountID string
+	Domain    string
+	Token     string
+	CreatedBy string
+	Created   time.Time
+	Verified  time.Time
+}
+
+// Snapshot contains the entire content of a database in a form that can be
+// serialized and later be restored into an empty database. Sessions, queued
+// mails and webhook deliveries are not part of a snapshot as they are short
+// lived and restoring them would only revive logins that have already been
+// ended or deliver stale notifications.
+type Snapshot struct {
+	Accounts                 []Account
+	AccountUsers             []AccountUser
+	AccountUserRelationships []AccountUserRelationship
+	Secrets                  []Secret
+	Events                   []Event
+	Tombstones               []Tombstone
+	AuditLogEntries          []AuditLogEntry
+	ShareLinks               []ShareLink
+	Invitations              []Invitation
+	APITokens                []APIToken
+	WebAuthnCredentials      []WebAuthnCredential
+	Webhooks                 []Webhook
+	AccountDomains           []AccountDomain
+	PingCounters             []PingCounter
+	AggregateCounters        []AggregateCounter
+}
@@ -84,3 +84,24 @@ Vpq1p+9l/4NNxIc1rH4nEcDNRkG4vdSBKWiG8Pto4JL3zOONxoofJ1gpi0kB4I0/
 		}
 	})
 }
+
+func TestAccountUserRole_Includes(t *testing.T) {
+	tests := []struct {
+		role     AccountUserRole
+		other    AccountUserRole
+		expected bool
+	}{
+		{AccountUserRoleAdmin, AccountUserRoleViewer, true},
+		{AccountUserRoleAdmin, AccountUserRoleAdmin, true},
+		{AccountUserRoleEditor, AccountUserRoleViewer, true},
+		{AccountUserRoleEditor, AccountUserRoleAdmin, false},
+		{AccountUserRoleViewer, AccountUserRoleEditor, false},
+		{AccountUserRole(""), AccountUserRoleViewer, false},
+		{AccountUserRoleAdmin, AccountUserRole("owner"), false},
+	}
+	for _, test := range tests {
+		if result := test.role.Includes(test.other); result != test.expected {
+			t.Errorf("Expected %v for %s including %s, got %v", test.expected, test.role, test.other, result)
+		}
+	}
+}
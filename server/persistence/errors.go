@@ -3,7 +3,11 @@
 
 package persistence
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 // ErrUnknownAccount will be returned when an insert call tries to create an
 // event for an account ID that does not exist in the database
@@ -13,6 +17,45 @@ func (e ErrUnknownAccount) Error() string {
 	return string(e)
 }
 
+// ErrAccountDisabled is returned when an event is sent to an account that
+// has been disabled by an instance operator.
+type ErrAccountDisabled string
+
+func (e ErrAccountDisabled) Error() string {
+	return string(e)
+}
+
+// ErrAccountKeyMismatch is returned when importing events whose secrets
+// have been encrypted using a key the account does not hold.
+type ErrAccountKeyMismatch string
+
+func (e ErrAccountKeyMismatch) Error() string {
+	return string(e)
+}
+
+// ErrInvalidProvisioning is returned when a provisioning config is
+// malformed.
+type ErrInvalidProvisioning string
+
+func (e ErrInvalidProvisioning) Error() string {
+	return string(e)
+}
+
+// ErrProvisioningConflict is returned when a provisioning config cannot be
+// applied to the current state of the database.
+type ErrProvisioningConflict string
+
+func (e ErrProvisioningConflict) Error() string {
+	return string(e)
+}
+
+// ErrInvalidImport is returned when events that are imported are malformed.
+type ErrInvalidImport string
+
+func (e ErrInvalidImport) Error() string {
+	return string(e)
+}
+
 // ErrUnknownSecret will be returned when a given SecretID
 // is not found in the database
 type ErrUnknownSecret string
@@ -21,5 +64,116 @@ func (e ErrUnknownSecret) Error() string {
 	return string(e)
 }
 
+// ErrUnknownEventType is returned when an event uses a type that has not
+// been registered for its account.
+type ErrUnknownEventType string
+
+func (e ErrUnknownEventType) Error() string {
+	return string(e)
+}
+
+// ErrUnknownShareLink is returned when a share link does not exist, has
+// expired or has been revoked.
+type ErrUnknownShareLink string
+
+func (e ErrUnknownShareLink) Error() string {
+	return string(e)
+}
+
+// ErrUnknownInvitation is returned when an invitation does not exist or has
+// been revoked.
+type ErrUnknownInvitation string
+
+func (e ErrUnknownInvitation) Error() string {
+	return string(e)
+}
+
+// ErrInvitationExpired is returned when accepting an invitation that has
+// expired or has been revoked.
+type ErrInvitationExpired string
+
+func (e ErrInvitationExpired) Error() string {
+	return string(e)
+}
+
+// ErrUnknownSession is returned when a session does not exist, has expired
+// or has been revoked.
+type ErrUnknownSession string
+
+func (e ErrUnknownSession) Error() string {
+	return string(e)
+}
+
+// ErrUnknownAPIToken is returned when an API token does not exist or has
+// been revoked.
+type ErrUnknownAPIToken string
+
+func (e ErrUnknownAPIToken) Error() string {
+	return string(e)
+}
+
+// ErrUnknownMail is returned when a queued mail does not exist or has not
+// failed.
+type ErrUnknownMail string
+
+func (e ErrUnknownMail) Error() string {
+	return string(e)
+}
+
+// ErrUnknownWebhook is returned when a webhook does not exist or has been
+// registered for another account.
+type ErrUnknownWebhook string
+
+func (e ErrUnknownWebhook) Error() string {
+	return string(e)
+}
+
+// ErrUnknownAccountDomain is returned when a domain does not exist or has
+// been claimed by another account.
+type ErrUnknownAccountDomain string
+
+func (e ErrUnknownAccountDomain) Error() string {
+	return string(e)
+}
+
+// ErrUnknownAccountUser is returned when an account user does not exist or
+// is not a member of the requested account.
+type ErrUnknownAccountUser string
+
+func (e ErrUnknownAccountUser) Error() string {
+	return string(e)
+}
+
+// ErrLastAccountAdmin is returned when a change would leave an account
+// without any admin.
+type ErrLastAccountAdmin string
+
+func (e ErrLastAccountAdmin) Error() string {
+	return string(e)
+}
+
+// ErrAccountUserLocked is returned when an account user is not allowed to
+// log in as it has failed to do so too many times. Started is set when the
+// lockout has been caused by the current login attempt.
+type ErrAccountUserLocked struct {
+	Until   time.Time
+	Started bool
+}
+
+func (e ErrAccountUserLocked) Error() string {
+	return fmt.Sprintf("persistence: account user is locked until %s", e.Until.Format(time.RFC3339))
+}
+
+// ErrQuotaExceeded is returned when inserting an event would exceed one of
+// the quotas configured for an account.
+type ErrQuotaExceeded struct {
+	Quota string
+	Limit int64
+}
+
+func (e ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("persistence: account has exceeded its quota of %d %s", e.Limit, e.Quota)
+}
+
 // ErrBadQuery is returned when a DAL method cannot handle the given query
 var ErrBadQuery = errors.New("persistence: could not match query")
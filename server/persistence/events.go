@@ -4,17 +4,144 @@
 package persistence
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 )
 
-func (p *persistenceLayer) Insert(userID, accountID, payload string, idOverride *string) error {
+// WithInsertListener registers a function that is called with each event
+// after it has been inserted successfully. The function is called
+// synchronously, so it must not block. Multiple listeners can be registered
+// and are called in order.
+func WithInsertListener(l func(EventResult)) Config {
+	return func(p *persistenceLayer) {
+		if previous := p.onInsert; previous != nil {
+			p.onInsert = func(evt EventResult) {
+				previous(evt)
+				l(evt)
+			}
+			return
+		}
+		p.onInsert = l
+	}
+}
+
+func (p *persistenceLayer) Insert(userID, accountID, eventType, payload string, idOverride *string) error {
+	evt, err := p.prepareEvent(userID, accountID, eventType, payload, idOverride)
+	if err != nil {
+		return err
+	}
+	if err := p.dal.CreateEvent(evt); err != nil {
+		return fmt.Errorf("persistence: error inserting event: %w", err)
+	}
+	p.recordUsage(evt)
+	p.notifyInsert(evt)
+	return nil
+}
+
+// BatchEvent is a single event that is inserted as part of a batch.
+type BatchEvent struct {
+	AccountID string
+	// EventType is the name of a custom event type registered for the
+	// account, or empty for untyped events.
+	EventType string
+	Payload   string
+	// RecordedAt is the time the event has been recorded at by a client that
+	// has been offline. In case it is zero, the time of insertion is used.
+	RecordedAt time.Time
+}
+
+// InsertBatch validates all of the given events and inserts the valid ones
+// using a single transaction. Quotas are checked for each event on its own,
+// so a batch might exceed a quota by its size. The first return value contains the result of
+// validating each event at the respective index, the second one is non-nil
+// in case the transaction failed and no event has been inserted at all.
+//
+// Events are inserted in the order they have been recorded in, so that
+// both their identifiers and sequence numbers reflect the order in which
+// they happened, even if the client has sent them out of order.
+func (p *persistenceLayer) InsertBatch(userID string, events []BatchEvent) ([]error, error) {
+	results := make([]error, len(events))
+	now := time.Now()
+	order := make([]int, len(events))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return events[order[a]].recordedAt(now).Before(events[order[b]].recordedAt(now))
+	})
+
+	var valid []*Event
+	for _, i := range order {
+		item := events[i]
+		var idOverride *string
+		if !item.RecordedAt.IsZero() {
+			eventID, err := EventIDAt(item.RecordedAt)
+			if err != nil {
+				results[i] = fmt.Errorf("persistence: error creating event identifier: %w", err)
+				continue
+			}
+			idOverride = &eventID
+		}
+		evt, err := p.prepareEvent(userID, item.AccountID, item.EventType, item.Payload, idOverride)
+		if err != nil {
+			results[i] = err
+			continue
+		}
+		valid = append(valid, evt)
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+	// creating backdated identifiers in between resets the monotonic
+	// entropy, so sequences are not guaranteed to be ordered on creation
+	sequences := make([]string, len(valid))
+	for i, evt := range valid {
+		sequences[i] = evt.Sequence
+	}
+	sort.Strings(sequences)
+	for i, evt := range valid {
+		evt.Sequence = sequences[i]
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	for _, evt := range valid {
+		if err := txn.CreateEvent(evt); err != nil {
+			txn.Rollback()
+			return nil, fmt.Errorf("persistence: error inserting event: %w", err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, fmt.Errorf("persistence: error committing batch of events: %w", err)
+	}
+	p.recordUsage(valid...)
+	for _, evt := range valid {
+		p.notifyInsert(evt)
+	}
+	return results, nil
+}
+
+func (b BatchEvent) recordedAt(now time.Time) time.Time {
+	if b.RecordedAt.IsZero() {
+		return now
+	}
+	return b.RecordedAt
+}
+
+// prepareEvent validates an inbound event and creates the record that is
+// persisted for it.
+func (p *persistenceLayer) prepareEvent(userID, accountID, eventType, payload string, idOverride *string) (*Event, error) {
 	var eventID string
 	if idOverride == nil {
 		var err error
 		eventID, err = NewULID()
 		if err != nil {
-			return fmt.Errorf("persistence: error creating new event identifier: %w", err)
+			return nil, fmt.Errorf("persistence: error creating new event identifier: %w", err)
 		}
 	} else {
 		eventID = *idOverride
@@ -22,49 +149,91 @@ func (p *persistenceLayer) Insert(userID, accountID, payload string, idOverride
 
 	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
 	if err != nil {
-		return fmt.Errorf("persistence: error looking up matching account for given event: %w", err)
+		return nil, fmt.Errorf("persistence: error looking up matching account for given event: %w", err)
+	}
+
+	if account.Disabled {
+		return nil, ErrAccountDisabled(fmt.Sprintf("persistence: account %s is disabled", account.AccountID))
+	}
+
+	if err := checkEventType(account, eventType); err != nil {
+		return nil, err
+	}
+
+	if err := p.checkQuotas(account.AccountID); err != nil {
+		return nil, err
 	}
 
 	var hashedUserID *string
 	if userID != "" {
 		hash, err := account.HashUserID(userID)
 		if err != nil {
-			return fmt.Errorf("persistence: error hashing user id: %w", err)
+			return nil, fmt.Errorf("persistence: error hashing user id: %w", err)
 		}
 		hashedUserID = &hash
 	}
 
 	// in case the event is not anonymous, we need to check that the user
 	// already exists for the account so events can be decrypted lateron
+	var keyVersion int
 	if hashedUserID != nil {
-		if _, err := p.dal.FindSecret(FindSecretQueryBySecretID(*hashedUserID)); err != nil {
-			return fmt.Errorf("persistence: error finding secret for given event: %w", err)
+		secret, err := p.dal.FindSecret(FindSecretQueryBySecretID(*hashedUserID))
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error finding secret for given event: %w", err)
 		}
+		keyVersion = secret.KeyVersion
 	}
 
 	sequence, seqErr := NewULID()
 	if seqErr != nil {
-		return fmt.Errorf("persistence: error creating sequence number: %w", seqErr)
+		return nil, fmt.Errorf("persistence: error creating sequence number: %w", seqErr)
 	}
 
-	insertErr := p.dal.CreateEvent(&Event{
-		AccountID: accountID,
-		SecretID:  hashedUserID,
-		Payload:   payload,
-		EventID:   eventID,
-		Sequence:  sequence,
-	})
-	if insertErr != nil {
-		return fmt.Errorf("persistence: error inserting event: %w", insertErr)
+	return &Event{
+		AccountID:  accountID,
+		SecretID:   hashedUserID,
+		Payload:    payload,
+		EventID:    eventID,
+		Sequence:   sequence,
+		KeyVersion: keyVersion,
+		EventType:  eventType,
+	}, nil
+}
+
+func (p *persistenceLayer) notifyInsert(evt *Event) {
+	if p.onInsert != nil {
+		p.onInsert(EventResult{
+			AccountID:  evt.AccountID,
+			SecretID:   evt.SecretID,
+			EventID:    evt.EventID,
+			Payload:    evt.Payload,
+			KeyVersion: evt.KeyVersion,
+			EventType:  evt.EventType,
+		})
 	}
-	return nil
 }
 
 // Query defines a set of filters to limit the set of results to be returned
 // In case a field has the zero value, its filter will not be applied.
 type Query struct {
 	UserID string
-	Since  string
+	// Since is the sequence returned by a previous query. Only events that
+	// have been changed after this query are returned.
+	Since string
+	// AccountIDs limits the result to events of the given accounts.
+	AccountIDs []string
+	// Limit is the maximum number of events to be returned. In case more
+	// events exist, the result contains a cursor for the next page.
+	Limit int
+	// Cursor requests the page following the one that returned the cursor.
+	// Pages are ordered by event id, so Since needs to be passed unchanged
+	// when requesting subsequent pages. The sequence returned with the last
+	// page is the one that has been reached when requesting the first page.
+	Cursor string
+	// DeletedSince requests deleted events newer than the given sequence. It
+	// defaults to Since unless a Cursor is given, so that deleted events are
+	// only returned with the first page.
+	DeletedSince string
 }
 
 func (p *persistenceLayer) Query(query Query) (EventsResult, error) {
@@ -73,49 +242,224 @@ func (p *persistenceLayer) Query(query Query) (EventsResult, error) {
 	if err != nil {
 		return EventsResult{}, fmt.Errorf("persistence: error looking up all accounts: %v", err)
 	}
+	if len(query.AccountIDs) != 0 {
+		accounts = filterAccounts(accounts, query.AccountIDs)
+	}
 
-	results, err := p.dal.FindEvents(FindEventsQueryForSecretIDs{
-		SecretIDs: hashUserIDForAccounts(query.UserID, accounts),
-		Since:     query.Since,
-	})
-	if err != nil {
-		return EventsResult{}, fmt.Errorf("persistence: error looking up events: %w", err)
+	// sequences used to be ULIDs, which are still accepted so that
+	// clients do not need to sync from scratch after an upgrade
+	since, ok := parseSequenceCursor(query.Since)
+	var legacySince string
+	if !ok {
+		legacySince = query.Since
+	}
+
+	page, _ := parsePageCursor(query.Cursor)
+	eventsQuery := FindEventsQueryForSecretIDs{
+		SecretIDs:            hashUserIDForAccounts(query.UserID, accounts),
+		Since:                legacySince,
+		SinceSequenceNumbers: since,
+		After:                page.After,
+	}
+	if query.Limit > 0 {
+		// requesting one more event than needed tells whether another page
+		// exists
+		eventsQuery.Limit = query.Limit + 1
+	}
+
+	deletedSince := query.DeletedSince
+	if deletedSince == "" && query.Cursor == "" {
+		deletedSince = query.Since
+	}
+	var deletedQuery *FindTombstonesQueryBySecrets
+	if deletedSince != "" {
+		deletedQuery = &FindTombstonesQueryBySecrets{
+			SecretIDs: hashUserIDForAccounts(query.UserID, accounts),
+		}
+		if cursor, ok := parseSequenceCursor(deletedSince); ok {
+			deletedQuery.SinceSequenceNumbers = cursor
+		} else {
+			deletedQuery.Since = deletedSince
+		}
+	}
+
+	// events and tombstones both advance the sequence, so they need to be
+	// read from the same database in case replicas are used
+	var results []Event
+	var pruned []Tombstone
+	var reached sequenceCursor
+	if err := readReplica(p.dal, func(dal DataAccessLayer) error {
+		if query.Limit > 0 && query.Cursor == "" {
+			// in case the results span multiple pages, the sequence reached
+			// now is handed out with the last page. It is looked up before
+			// reading any events, so events that are added while paging
+			// will be returned again by the next query instead of being skipped.
+			stats, err := userEventStats(dal, query.UserID, accounts)
+			if err != nil {
+				return err
+			}
+			reached = sequenceCursor{}
+			for accountID, sequenceNumber := range since {
+				reached[accountID] = sequenceNumber
+			}
+			for accountID, s := range stats {
+				if s.Count > 0 {
+					reached.advance(accountID, s.LatestSequenceNumber)
+				}
+			}
+		}
+		var err error
+		results, err = dal.FindEvents(eventsQuery)
+		if err != nil {
+			return fmt.Errorf("persistence: error looking up events: %w", err)
+		}
+		if deletedQuery != nil {
+			pruned, err = dal.FindTombstones(*deletedQuery)
+			if err != nil {
+				return fmt.Errorf("persistence: error finding deleted events: %w", err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return EventsResult{}, err
 	}
 	out := EventsResult{}
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+		if query.Cursor != "" {
+			reached = page.Sequence
+		}
+		out.NextCursor = pageCursor{
+			After:    results[len(results)-1].EventID,
+			Sequence: reached,
+		}.String()
+	}
 	eventResults := EventsByAccountID{}
-	seqs := []string{}
+	next := sequenceCursor{}
+	for accountID, sequenceNumber := range since {
+		next[accountID] = sequenceNumber
+	}
 	for _, match := range results {
 		eventResults[match.AccountID] = append(eventResults[match.AccountID], EventResult{
 			AccountID: match.AccountID,
 			Payload:   match.Payload,
 			EventID:   match.EventID,
+			EventType: match.EventType,
 		})
-		seqs = append(seqs, match.Sequence)
+		next.advance(match.AccountID, match.SequenceNumber)
 	}
 	out.Events = &eventResults
 
-	if query.Since != "" {
-		pruned, err := p.dal.FindTombstones(FindTombstonesQueryBySecrets{
-			SecretIDs: hashUserIDForAccounts(query.UserID, accounts),
-			Since:     query.Since,
-		})
-		if err != nil {
-			return EventsResult{}, fmt.Errorf("persistence: error finding deleted events: %w", err)
-		}
-
+	if deletedQuery != nil {
 		var prunedIDs []string
 		for _, tombstone := range pruned {
 			prunedIDs = append(prunedIDs, tombstone.EventID)
-			seqs = append(seqs, tombstone.Sequence)
+			next.advance(tombstone.AccountID, tombstone.SequenceNumber)
 		}
 		out.DeletedEvents = prunedIDs
 	}
 
-	out.Sequence = getLatestSeq(seqs)
+	switch {
+	case out.NextCursor != "":
+		// pages are ordered by event id, so events on pages that have not
+		// been requested yet might have any sequence. The sequence is
+		// advanced with the last page only.
+		out.Sequence = query.Since
+	case query.Cursor == "":
+		out.Sequence = next.String()
+	case len(page.Sequence) != 0:
+		out.Sequence = page.Sequence.String()
+	default:
+		// cursors handed out before do not carry a sequence
+		out.Sequence = query.Since
+	}
 	return out, nil
 }
 
+// EventsRevision returns a value that changes whenever the result of querying
+// the user's events in the given accounts might have changed. It is derived
+// from the events that are persisted for the user in each account, so it
+// reflects changes made by any writer, including other instances and
+// background jobs.
+func (p *persistenceLayer) EventsRevision(userID string, accountIDs []string) (string, error) {
+	var revisions []string
+	if err := readReplica(p.dal, func(dal DataAccessLayer) error {
+		accounts, err := dal.FindAccounts(FindAccountsQueryAllAccounts{})
+		if err != nil {
+			return fmt.Errorf("persistence: error looking up all accounts: %w", err)
+		}
+		if len(accountIDs) != 0 {
+			accounts = filterAccounts(accounts, accountIDs)
+		}
+		stats, err := userEventStats(dal, userID, accounts)
+		if err != nil {
+			return err
+		}
+		for accountID, s := range stats {
+			// the sequence number grows on every insertion while the count also
+			// covers deletions
+			revisions = append(revisions, fmt.Sprintf(
+				"%s:%d:%d", accountID, s.LatestSequenceNumber, s.Count,
+			))
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	sort.Strings(revisions)
+	return strings.Join(revisions, "-"), nil
+}
+
+// userEventStats looks up aggregate information about the events the given
+// user has stored in each of the given accounts.
+func userEventStats(dal DataAccessLayer, userID string, accounts []Account) (map[string]EventStats, error) {
+	result := map[string]EventStats{}
+	for _, account := range accounts {
+		secretID, err := account.HashUserID(userID)
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error hashing user id: %w", err)
+		}
+		stats, err := dal.FindEventStats(FindEventStatsQueryBySecretID{
+			AccountID: account.AccountID,
+			SecretID:  secretID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error looking up event stats: %w", err)
+		}
+		result[account.AccountID] = stats
+	}
+	return result, nil
+}
+
+func filterAccounts(accounts []Account, accountIDs []string) []Account {
+	var result []Account
+	for _, account := range accounts {
+		for _, accountID := range accountIDs {
+			if account.AccountID == accountID {
+				result = append(result, account)
+				break
+			}
+		}
+	}
+	return result
+}
+
 func (p *persistenceLayer) Purge(userID string) error {
+	return p.purge(userID, nil)
+}
+
+// PurgeAccounts deletes the events the given user has stored for the given
+// accounts only, keeping events stored for any other account.
+func (p *persistenceLayer) PurgeAccounts(userID string, accountIDs []string) error {
+	if len(accountIDs) == 0 {
+		return errors.New("persistence: expected at least one account id for purging")
+	}
+	return p.purge(userID, accountIDs)
+}
+
+// purge deletes the events of the given user. In case accountIDs is nil,
+// events are deleted across all accounts.
+func (p *persistenceLayer) purge(userID string, accountIDs []string) error {
 	sequence, err := NewULID()
 	if err != nil {
 		return fmt.Errorf("persistence: error creating sequence number: %w", err)
@@ -132,6 +476,9 @@ func (p *persistenceLayer) Purge(userID string) error {
 		return fmt.Errorf("persistence: error retrieving available accounts: %w", err)
 	}
 
+	if accountIDs != nil {
+		accounts = filterAccounts(accounts, accountIDs)
+	}
 	hashedUserIDs := hashUserIDForAccounts(userID, accounts)
 
 	affectedEvents, err := txn.FindEvents(FindEventsQueryForSecretIDs{SecretIDs: hashedUserIDs})
@@ -151,17 +498,88 @@ func (p *persistenceLayer) Purge(userID string) error {
 		}
 	}
 
-	if _, err := txn.DeleteEvents(DeleteEventsQueryBySecretIDs(hashedUserIDs)); err != nil {
+	var deletion interface{} = DeleteEventsQueryBySecretIDs(hashedUserIDs)
+	if accountIDs != nil {
+		deletion = DeleteEventsQueryBySecretIDsForAccounts{
+			SecretIDs:  hashedUserIDs,
+			AccountIDs: accountIDs,
+		}
+	}
+	if _, err := txn.DeleteEvents(deletion); err != nil {
 		txn.Rollback()
 		return fmt.Errorf("persistence: error purging events: %w", err)
 	}
 
+	// the user id is not recorded so that the audit log cannot be used
+	// for linking purges to users
+	if err := writeAuditLog(txn, affectedAccountIDs(affectedEvents), "", AuditActionPurge, ""); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording purge: %w", err)
+	}
+
 	if err := txn.Commit(); err != nil {
 		return fmt.Errorf("persistence: error committing pruning of events: %w", err)
 	}
 	return nil
 }
 
+func (p *persistenceLayer) ResetAccountEvents(accountID, accountUserID string) error {
+	sequence, err := NewULID()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating sequence number: %w", err)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+
+	account, err := txn.FindAccount(FindAccountQueryIncludeEvents{AccountID: accountID})
+	if err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error looking up events to reset: %w", err)
+	}
+	for _, evt := range account.Events {
+		if err := txn.CreateTombstone(&Tombstone{
+			EventID:   evt.EventID,
+			AccountID: evt.AccountID,
+			SecretID:  evt.SecretID,
+			Sequence:  sequence,
+		}); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error creating tombstone for reset event: %w", err)
+		}
+	}
+
+	if _, err := txn.DeleteEvents(DeleteEventsQueryByAccountID(accountID)); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error resetting events: %w", err)
+	}
+
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionResetEvents, ""); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording reset: %w", err)
+	}
+
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing reset of events: %w", err)
+	}
+	return nil
+}
+
+func affectedAccountIDs(events []Event) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, evt := range events {
+		if seen[evt.AccountID] {
+			continue
+		}
+		seen[evt.AccountID] = true
+		result = append(result, evt.AccountID)
+	}
+	return result
+}
+
 func hashUserIDForAccounts(userID string, accounts []Account) []string {
 	if len(accounts) == 0 {
 		return []string{}
@@ -187,13 +605,3 @@ func hashUserIDForAccounts(userID string, accounts []Account) []string {
 	}
 	return hashedUserIDs
 }
-
-func getLatestSeq(s []string) string {
-	var latestSeq string
-	for _, seq := range s {
-		if strings.Compare(seq, latestSeq) == 1 {
-			latestSeq = seq
-		}
-	}
-	return latestSeq
-}
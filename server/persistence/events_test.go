@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type assertion func(interface{}) error
@@ -213,13 +214,20 @@ func TestPersistenceLayer_Insert(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
+			var published []EventResult
 			r := &persistenceLayer{
 				dal: test.db,
+				onInsert: func(evt EventResult) {
+					published = append(published, evt)
+				},
 			}
-			err := r.Insert(test.callArgs[0], test.callArgs[1], test.callArgs[2], nil)
+			err := r.Insert(test.callArgs[0], test.callArgs[1], "", test.callArgs[2], nil)
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
+			if test.expectError == (len(published) != 0) {
+				t.Errorf("Unexpected events passed to listener %v", published)
+			}
 			if expected, found := len(test.argsAssertions), len(test.db.methodArgs); expected != found {
 				t.Fatalf("Number of assertions did not match number of calls, got %d and expected %d", found, expected)
 			}
@@ -271,6 +279,21 @@ func (m *mockPurgeEventsDatabase) FindEvents(q interface{}) ([]Event, error) {
 	return nil, nil
 }
 
+func TestWithInsertListener(t *testing.T) {
+	var calls []string
+	p := &persistenceLayer{}
+	WithInsertListener(func(evt EventResult) {
+		calls = append(calls, "first "+evt.EventID)
+	})(p)
+	WithInsertListener(func(evt EventResult) {
+		calls = append(calls, "second "+evt.EventID)
+	})(p)
+	p.notifyInsert(&Event{EventID: "event-a"})
+	if !reflect.DeepEqual(calls, []string{"first event-a", "second event-a"}) {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+}
+
 func TestPersistenceLayer_Purge(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -374,6 +397,162 @@ func TestPersistenceLayer_Purge(t *testing.T) {
 	}
 }
 
+func TestPersistenceLayer_PurgeAccounts(t *testing.T) {
+	t.Run("no accounts", func(t *testing.T) {
+		db := &mockPurgeEventsDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.PurgeAccounts("user-id", nil); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if len(db.methodArgs) != 0 {
+			t.Errorf("Unexpected calls %v", db.methodArgs)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockPurgeEventsDatabase{
+			findAccountsResult: []Account{
+				{AccountID: "account-a", UserSalt: "JF+rNeViJeJb0jth6ZheWg=="},
+				{AccountID: "account-b", UserSalt: "D6xdWYfRqbuWrkg4OWVgGQ=="},
+			},
+		}
+		p := &persistenceLayer{dal: db}
+		if err := p.PurgeAccounts("user-id", []string{"account-b"}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(db.methodArgs) != 2 {
+			t.Fatalf("Unexpected calls %v", db.methodArgs)
+		}
+		query, ok := db.methodArgs[1].(DeleteEventsQueryBySecretIDsForAccounts)
+		if !ok {
+			t.Fatalf("Unexpected query %v", db.methodArgs[1])
+		}
+		if len(query.SecretIDs) != 1 || query.SecretIDs[0] == "user-id" {
+			t.Errorf("Unexpected secret ids %v", query.SecretIDs)
+		}
+		if !reflect.DeepEqual(query.AccountIDs, []string{"account-b"}) {
+			t.Errorf("Unexpected account ids %v", query.AccountIDs)
+		}
+	})
+}
+
+type mockResetAccountEventsDatabase struct {
+	DataAccessLayer
+	findAccountResult Account
+	findAccountErr    error
+	deleteEventsErr   error
+	tombstones        []*Tombstone
+	auditLog          []*AuditLogEntry
+	methodArgs        []interface{}
+}
+
+func (m *mockResetAccountEventsDatabase) FindAccount(q interface{}) (Account, error) {
+	m.methodArgs = append(m.methodArgs, q)
+	return m.findAccountResult, m.findAccountErr
+}
+
+func (m *mockResetAccountEventsDatabase) DeleteEvents(q interface{}) (int64, error) {
+	m.methodArgs = append(m.methodArgs, q)
+	return 0, m.deleteEventsErr
+}
+
+func (m *mockResetAccountEventsDatabase) CreateTombstone(t *Tombstone) error {
+	m.tombstones = append(m.tombstones, t)
+	return nil
+}
+
+func (m *mockResetAccountEventsDatabase) CreateAuditLogEntry(e *AuditLogEntry) error {
+	m.auditLog = append(m.auditLog, e)
+	return nil
+}
+
+func (m *mockResetAccountEventsDatabase) Commit() error {
+	return nil
+}
+
+func (m *mockResetAccountEventsDatabase) Rollback() error {
+	return nil
+}
+
+func (m *mockResetAccountEventsDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func TestPersistenceLayer_ResetAccountEvents(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockResetAccountEventsDatabase
+		expectError        bool
+		expectedArgs       []interface{}
+		expectedTombstones int
+	}{
+		{
+			"lookup error",
+			&mockResetAccountEventsDatabase{
+				findAccountErr: errors.New("did not work"),
+			},
+			true,
+			[]interface{}{
+				FindAccountQueryIncludeEvents{AccountID: "account-a"},
+			},
+			0,
+		},
+		{
+			"delete error",
+			&mockResetAccountEventsDatabase{
+				findAccountResult: Account{
+					AccountID: "account-a",
+					Events:    []Event{{EventID: "event-a", AccountID: "account-a"}},
+				},
+				deleteEventsErr: errors.New("did not work"),
+			},
+			true,
+			[]interface{}{
+				FindAccountQueryIncludeEvents{AccountID: "account-a"},
+				DeleteEventsQueryByAccountID("account-a"),
+			},
+			1,
+		},
+		{
+			"ok",
+			&mockResetAccountEventsDatabase{
+				findAccountResult: Account{
+					AccountID: "account-a",
+					Events: []Event{
+						{EventID: "event-a", AccountID: "account-a"},
+						{EventID: "event-b", AccountID: "account-a"},
+					},
+				},
+			},
+			false,
+			[]interface{}{
+				FindAccountQueryIncludeEvents{AccountID: "account-a"},
+				DeleteEventsQueryByAccountID("account-a"),
+			},
+			2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &persistenceLayer{
+				dal: test.db,
+			}
+			err := r.ResetAccountEvents("account-a", "user-a")
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !reflect.DeepEqual(test.expectedArgs, test.db.methodArgs) {
+				t.Errorf("Expected method args %v, got %v", test.expectedArgs, test.db.methodArgs)
+			}
+			if len(test.db.tombstones) != test.expectedTombstones {
+				t.Errorf("Expected %d tombstones, got %d", test.expectedTombstones, len(test.db.tombstones))
+			}
+			if !test.expectError && len(test.db.auditLog) != 1 {
+				t.Errorf("Expected reset to be recorded in audit log, got %v", test.db.auditLog)
+			}
+		})
+	}
+}
+
 type mockQueryEventDatabase struct {
 	DataAccessLayer
 	findAccountsResult []Account
@@ -461,8 +640,8 @@ func TestPersistenceLayer_Query(t *testing.T) {
 					{AccountID: "account-b", UserSalt: "kxwkHp6yPBd0tQ85XlayDg=="},
 				},
 				findEventsResult: []Event{
-					{AccountID: "account-a", EventID: "event-a", Payload: "payload-a"},
-					{AccountID: "account-b", EventID: "event-b", Payload: "payload-b"},
+					{AccountID: "account-a", EventID: "event-a", Payload: "payload-a", SequenceNumber: 12},
+					{AccountID: "account-b", EventID: "event-b", Payload: "payload-b", SequenceNumber: 7},
 				},
 			},
 			EventsResult{
@@ -474,6 +653,7 @@ func TestPersistenceLayer_Query(t *testing.T) {
 						{AccountID: "account-b", Payload: "payload-b", EventID: "event-b"},
 					},
 				},
+				Sequence: sequenceCursor{"account-a": 12, "account-b": 7}.String(),
 			},
 			false,
 			[]assertion{
@@ -529,9 +709,249 @@ func TestPersistenceLayer_Query(t *testing.T) {
 	}
 }
 
-func TestGetLatestSeq(t *testing.T) {
-	result := getLatestSeq([]string{"x", "0", "z", "a", "x", "1", "0"})
-	if result != "z" {
+type mockReplicaQueryDatabase struct {
+	mockQueryCursorDatabase
+	replica *mockQueryCursorDatabase
+}
+
+func (m *mockReplicaQueryDatabase) ReadReplica(fn func(DataAccessLayer) error) error {
+	return fn(m.replica)
+}
+
+func TestPersistenceLayer_Query_replica(t *testing.T) {
+	replica := &mockQueryCursorDatabase{
+		mockQueryEventDatabase: mockQueryEventDatabase{
+			findEventsResult: []Event{
+				{AccountID: "account-a", EventID: "event-a", SequenceNumber: 8},
+			},
+		},
+		findTombstonesResult: []Tombstone{
+			{AccountID: "account-a", EventID: "event-x", SequenceNumber: 9},
+		},
+	}
+	db := &mockReplicaQueryDatabase{
+		mockQueryCursorDatabase: mockQueryCursorDatabase{
+			mockQueryEventDatabase: mockQueryEventDatabase{
+				findAccountsResult: []Account{
+					{AccountID: "account-a", UserSalt: "LEWtq55DKObqPK+XEQbnZA=="},
+				},
+			},
+		},
+		replica: replica,
+	}
+	p := &persistenceLayer{dal: db}
+	result, err := p.Query(Query{UserID: "user-id", Since: "01DYB9Z08N1M6RF3K0CQ8VW3R6"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if result.Events == nil || len((*result.Events)["account-a"]) != 1 || !reflect.DeepEqual(result.DeletedEvents, []string{"event-x"}) {
 		t.Errorf("Unexpected result %v", result)
 	}
+	if len(db.methodArgs) != 1 {
+		t.Errorf("Expected only accounts to be read from primary, got %v", db.methodArgs)
+	}
+	if len(replica.methodArgs) != 2 {
+		t.Errorf("Expected events and tombstones to be read from replica, got %v", replica.methodArgs)
+	}
+}
+
+func TestPersistenceLayer_Query_pagination(t *testing.T) {
+	db := &mockQueryEventDatabase{
+		findAccountsResult: []Account{
+			{AccountID: "account-a", UserSalt: "LEWtq55DKObqPK+XEQbnZA=="},
+			{AccountID: "account-b", UserSalt: "kxwkHp6yPBd0tQ85XlayDg=="},
+		},
+		findEventsResult: []Event{
+			{AccountID: "account-a", EventID: "event-a", Sequence: "seq-a"},
+			{AccountID: "account-a", EventID: "event-b", Sequence: "seq-b"},
+			{AccountID: "account-a", EventID: "event-c", Sequence: "seq-c"},
+		},
+	}
+	p := &persistenceLayer{dal: db}
+	result, err := p.Query(Query{
+		UserID:     "user-id",
+		AccountIDs: []string{"account-a"},
+		Limit:      2,
+		Since:      "seq-0",
+		Cursor:     "event-0",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len((*result.Events)["account-a"]) != 2 {
+		t.Errorf("Unexpected events %v", *result.Events)
+	}
+	if cursor, _ := parsePageCursor(result.NextCursor); cursor.After != "event-b" || result.Sequence != "seq-0" {
+		t.Errorf("Unexpected cursor %s and sequence %s", result.NextCursor, result.Sequence)
+	}
+	query := db.methodArgs[1].(FindEventsQueryForSecretIDs)
+	if query.Limit != 3 || query.Since != "seq-0" || query.After != "event-0" || len(query.SecretIDs) != 1 {
+		t.Errorf("Unexpected query %v", query)
+	}
+}
+
+type mockEventsRevisionDatabase struct {
+	DataAccessLayer
+	stats map[string]EventStats
+}
+
+func (m *mockEventsRevisionDatabase) FindAccounts(q interface{}) ([]Account, error) {
+	return []Account{
+		{AccountID: "account-a", UserSalt: "{1,} D6xdWYfRqbuWrkg4OWVgGQ=="},
+		{AccountID: "account-b", UserSalt: "{1,} JF+rNeViJeJb0jth6ZheWg=="},
+	}, nil
+}
+
+func (m *mockEventsRevisionDatabase) FindEventStats(q interface{}) (EventStats, error) {
+	query, ok := q.(FindEventStatsQueryBySecretID)
+	if !ok || query.SecretID == "" {
+		return EventStats{}, fmt.Errorf("unexpected query %v", q)
+	}
+	return m.stats[query.AccountID], nil
+}
+
+func TestPersistenceLayer_EventsRevision(t *testing.T) {
+	db := &mockEventsRevisionDatabase{
+		stats: map[string]EventStats{
+			"account-a": {Count: 4, LatestSequenceNumber: 12},
+			"account-b": {Count: 1, LatestSequenceNumber: 3},
+		},
+	}
+	p := &persistenceLayer{dal: db}
+
+	all, err := p.EventsRevision("user-id", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if all != "account-a:12:4-account-b:3:1" {
+		t.Errorf("Unexpected revision %v", all)
+	}
+	revision, err := p.EventsRevision("user-id", []string{"account-a"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if revision != "account-a:12:4" {
+		t.Errorf("Unexpected revision %v", revision)
+	}
+
+	// deleting an event does not change the latest sequence number
+	db.stats["account-a"] = EventStats{Count: 3, LatestSequenceNumber: 12}
+	if changed, _ := p.EventsRevision("user-id", []string{"account-a"}); changed == revision {
+		t.Errorf("Expected revision to change after deletion, got %v", changed)
+	}
+	// events of other accounts do not affect the revision
+	db.stats["account-b"] = EventStats{Count: 2, LatestSequenceNumber: 4}
+	if unchanged, _ := p.EventsRevision("user-id", []string{"account-a"}); unchanged != "account-a:12:3" {
+		t.Errorf("Unexpected revision %v", unchanged)
+	}
+}
+
+type mockInsertBatchDatabase struct {
+	DataAccessLayer
+	created        []*Event
+	createEventErr error
+	committed      bool
+}
+
+func (m *mockInsertBatchDatabase) FindAccount(q interface{}) (Account, error) {
+	if q.(FindAccountQueryActiveByID) != "account-a" {
+		return Account{}, ErrUnknownAccount("not found")
+	}
+	return Account{AccountID: "account-a", UserSalt: "{1,} CaHVhk78uhoPmf5wanA0vg=="}, nil
+}
+
+func (m *mockInsertBatchDatabase) FindSecret(q interface{}) (Secret, error) {
+	return Secret{}, nil
+}
+
+func (m *mockInsertBatchDatabase) CreateEvent(e *Event) error {
+	if m.createEventErr != nil {
+		return m.createEventErr
+	}
+	m.created = append(m.created, e)
+	return nil
+}
+
+func (m *mockInsertBatchDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func (m *mockInsertBatchDatabase) Commit() error {
+	m.committed = true
+	return nil
+}
+
+func (m *mockInsertBatchDatabase) Rollback() error {
+	return nil
+}
+
+func TestPersistenceLayer_InsertBatch(t *testing.T) {
+	batch := []BatchEvent{
+		{AccountID: "account-a", Payload: "payload-a"},
+		{AccountID: "account-z", Payload: "payload-z"},
+		{AccountID: "account-a", Payload: "payload-b"},
+	}
+	t.Run("ok", func(t *testing.T) {
+		db := &mockInsertBatchDatabase{}
+		var notified []string
+		p := &persistenceLayer{dal: db, onInsert: func(evt EventResult) {
+			notified = append(notified, evt.Payload)
+		}}
+		results, err := p.InsertBatch("user-id", batch)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		var unknownAccount ErrUnknownAccount
+		if len(results) != 3 || results[0] != nil || !errors.As(results[1], &unknownAccount) || results[2] != nil {
+			t.Errorf("Unexpected results %v", results)
+		}
+		if len(db.created) != 2 || !db.committed {
+			t.Errorf("Unexpected database state %v", db)
+		}
+		if !reflect.DeepEqual(notified, []string{"payload-a", "payload-b"}) {
+			t.Errorf("Unexpected notifications %v", notified)
+		}
+	})
+	t.Run("recorded offline", func(t *testing.T) {
+		db := &mockInsertBatchDatabase{}
+		p := &persistenceLayer{dal: db}
+		recordedAt := time.Now().Add(-time.Hour)
+		results, err := p.InsertBatch("user-id", []BatchEvent{
+			{AccountID: "account-a", Payload: "payload-now"},
+			{AccountID: "account-a", Payload: "payload-later", RecordedAt: recordedAt.Add(time.Minute)},
+			{AccountID: "account-a", Payload: "payload-earlier", RecordedAt: recordedAt},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		for _, result := range results {
+			if result != nil {
+				t.Errorf("Unexpected result %v", result)
+			}
+		}
+		var payloads []string
+		for i, evt := range db.created {
+			payloads = append(payloads, evt.Payload)
+			if i > 0 && (evt.EventID <= db.created[i-1].EventID || evt.Sequence <= db.created[i-1].Sequence) {
+				t.Errorf("Expected event %d to be ordered after its predecessor", i)
+			}
+		}
+		if !reflect.DeepEqual(payloads, []string{"payload-earlier", "payload-later", "payload-now"}) {
+			t.Errorf("Unexpected order %v", payloads)
+		}
+		earliest, _ := EventIDAt(recordedAt)
+		if db.created[0].EventID[:10] != earliest[:10] {
+			t.Errorf("Expected event id to be backdated, got %s", db.created[0].EventID)
+		}
+	})
+	t.Run("insert error", func(t *testing.T) {
+		db := &mockInsertBatchDatabase{createEventErr: errors.New("did not work")}
+		p := &persistenceLayer{dal: db}
+		if _, err := p.InsertBatch("user-id", batch); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if db.committed {
+			t.Error("Unexpected commit")
+		}
+	})
 }
@@ -0,0 +1,145 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// maxEventTypes limits the number of event types a single account can
+// register.
+const maxEventTypes = 100
+
+var eventTypeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// EventType is a named type of custom events an account receives. Event
+// payloads are encrypted, so the expected fields are not checked by the
+// server but handed to clients which validate events before encrypting them.
+// The name of the type is stored alongside each event in plaintext.
+type EventType struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// EventTypes is the set of event types an account has registered.
+type EventTypes []EventType
+
+// Validate checks whether all types are well formed and uniquely named.
+func (t EventTypes) Validate() error {
+	if len(t) > maxEventTypes {
+		return fmt.Errorf("persistence: expected at most %d event types, received %d", maxEventTypes, len(t))
+	}
+	names := map[string]bool{}
+	for i, eventType := range t {
+		if err := ValidateEventTypeName(eventType.Name); err != nil {
+			return fmt.Errorf("persistence: event type %d: %w", i, err)
+		}
+		if names[eventType.Name] {
+			return fmt.Errorf("persistence: event type %s is defined more than once", eventType.Name)
+		}
+		names[eventType.Name] = true
+
+		fields := map[string]bool{}
+		for _, field := range eventType.Fields {
+			if !eventTypeNamePattern.MatchString(field) {
+				return fmt.Errorf("persistence: field %q of event type %s is not a valid name", field, eventType.Name)
+			}
+			if fields[field] {
+				return fmt.Errorf("persistence: field %s of event type %s is defined more than once", field, eventType.Name)
+			}
+			fields[field] = true
+		}
+	}
+	return nil
+}
+
+// ValidateEventTypeName checks whether the given value can be used as the
+// name of an event type.
+func ValidateEventTypeName(name string) error {
+	if !eventTypeNamePattern.MatchString(name) {
+		return fmt.Errorf("persistence: %q is not a valid event type name, expected up to 64 letters, digits, dots, dashes or underscores", name)
+	}
+	return nil
+}
+
+func (t EventTypes) has(name string) bool {
+	for _, eventType := range t {
+		if eventType.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parseEventTypes(s string) (EventTypes, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var types EventTypes
+	if err := json.Unmarshal([]byte(s), &types); err != nil {
+		return nil, fmt.Errorf("persistence: error parsing event types: %w", err)
+	}
+	return types, nil
+}
+
+// checkEventType returns an error in case the given account does not define
+// an event type of the given name. Untyped events are always accepted.
+func checkEventType(account Account, name string) error {
+	if name == "" {
+		return nil
+	}
+	types, err := parseEventTypes(account.EventTypes)
+	if err != nil {
+		return err
+	}
+	if !types.has(name) {
+		return ErrUnknownEventType(
+			fmt.Sprintf("persistence: account %s does not define event type %s", account.AccountID, name),
+		)
+	}
+	return nil
+}
+
+// UpdateAccountEventTypes replaces the custom event types registered for
+// the given account. Events that have been stored using types that are
+// removed are kept.
+func (p *persistenceLayer) UpdateAccountEventTypes(accountID string, types EventTypes, accountUserID string) error {
+	if err := types.Validate(); err != nil {
+		return fmt.Errorf("persistence: invalid event types: %w", err)
+	}
+	a, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account before updating event types: %w", err)
+	}
+
+	var encoded string
+	if len(types) != 0 {
+		b, err := json.Marshal(types)
+		if err != nil {
+			return fmt.Errorf("persistence: error encoding event types: %w", err)
+		}
+		encoded = string(b)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	a.EventTypes = encoded
+	if err := txn.UpdateAccount(&a); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error updating event types of account %s: %w", accountID, err)
+	}
+	// the list of types might exceed the size of an audit log target
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionUpdateEventTypes, fmt.Sprintf("%d event types", len(types))); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording event types update of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing event types update: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEventTypes_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		types       EventTypes
+		expectError bool
+	}{
+		{"ok", EventTypes{{Name: "signup", Fields: []string{"plan", "referrer"}}, {Name: "checkout.completed"}}, false},
+		{"empty", nil, false},
+		{"no name", EventTypes{{Fields: []string{"plan"}}}, true},
+		{"bad name", EventTypes{{Name: "sign up"}}, true},
+		{"duplicate name", EventTypes{{Name: "signup"}, {Name: "signup"}}, true},
+		{"bad field", EventTypes{{Name: "signup", Fields: []string{""}}}, true},
+		{"duplicate field", EventTypes{{Name: "signup", Fields: []string{"plan", "plan"}}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.types.Validate(); (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckEventType(t *testing.T) {
+	account := Account{AccountID: "account-a", EventTypes: `[{"name":"signup","fields":["plan"]}]`}
+	if err := checkEventType(account, ""); err != nil {
+		t.Errorf("Unexpected error for untyped event %v", err)
+	}
+	if err := checkEventType(account, "signup"); err != nil {
+		t.Errorf("Unexpected error for registered type %v", err)
+	}
+	var unknown ErrUnknownEventType
+	if err := checkEventType(account, "checkout"); !errors.As(err, &unknown) {
+		t.Errorf("Expected unknown event type error, got %v", err)
+	}
+	if err := checkEventType(Account{AccountID: "account-b"}, "signup"); !errors.As(err, &unknown) {
+		t.Errorf("Expected unknown event type error, got %v", err)
+	}
+}
+
+func TestPersistenceLayer_UpdateAccountEventTypes(t *testing.T) {
+	t.Run("invalid types", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdateAccountEventTypes("account-a", EventTypes{{Name: ""}}, "user-a"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if len(db.updated) != 0 {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdateAccountEventTypes("account-a", EventTypes{{Name: "signup", Fields: []string{"plan"}}}, "user-a"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 || db.updated[0].EventTypes != `[{"name":"signup","fields":["plan"]}]` {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionUpdateEventTypes {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+}
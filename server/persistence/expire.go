@@ -9,13 +9,48 @@ import (
 )
 
 // Expire deletes all events in the give database that are older than the given
-// retention threshold.
-func (p *persistenceLayer) Expire(retention time.Duration) (int, error) {
-	limit := time.Now().Add(-retention)
-	deadline, deadlineErr := EventIDAt(limit)
+// retention threshold. Accounts that define their own retention period are
+// expired using the duration returned by resolve instead. In case resolve
+// fails for an account, the given retention applies. Retention rules defined
+// by an account are applied on top of its retention period.
+func (p *persistenceLayer) Expire(retention time.Duration, resolve func(period string) (time.Duration, error)) (int, error) {
+	accounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error looking up accounts: %w", err)
+	}
+
+	var queries []FindEventsQueryExpired
+	var customAccountIDs []string
+	for _, account := range accounts {
+		// rules are validated when being saved, so in case they cannot be
+		// read, they are skipped the same way unknown retention periods are
+		rules, _ := parseRetentionRules(account.RetentionRules)
+		ruleQueries, err := rules.expiredQueries(p.dal, account.AccountID, time.Now())
+		if err != nil {
+			return 0, fmt.Errorf("persistence: error applying retention rules of account %s: %w", account.AccountID, err)
+		}
+		queries = append(queries, ruleQueries...)
+
+		if account.RetentionPeriod == "" {
+			continue
+		}
+		accountRetention, err := resolve(account.RetentionPeriod)
+		if err != nil {
+			continue
+		}
+		deadline, err := EventIDAt(time.Now().Add(-accountRetention))
+		if err != nil {
+			return 0, fmt.Errorf("persistence: error determing deadline for expiring events of account %s: %w", account.AccountID, err)
+		}
+		queries = append(queries, FindEventsQueryExpired{Before: deadline, AccountID: account.AccountID})
+		customAccountIDs = append(customAccountIDs, account.AccountID)
+	}
+
+	deadline, deadlineErr := EventIDAt(time.Now().Add(-retention))
 	if deadlineErr != nil {
 		return 0, fmt.Errorf("persistence: error determing deadline for expiring events: %w", deadlineErr)
 	}
+	queries = append(queries, FindEventsQueryExpired{Before: deadline, ExcludeAccountIDs: customAccountIDs})
 
 	sequence, seqErr := NewULID()
 	if seqErr != nil {
@@ -26,28 +61,44 @@ func (p *persistenceLayer) Expire(retention time.Duration) (int, error) {
 	if err != nil {
 		return 0, fmt.Errorf("persistence: error creating transaction: %w", err)
 	}
-	expiredEvents, err := txn.FindEvents(FindEventsQueryOlderThan(deadline))
-	if err != nil {
-		txn.Rollback()
-		return 0, fmt.Errorf("persistence: error looking up expired events: %w", err)
-	}
 
-	for _, evt := range expiredEvents {
-		if err := txn.CreateTombstone(&Tombstone{
-			AccountID: evt.AccountID,
-			EventID:   evt.EventID,
-			SecretID:  evt.SecretID,
-			Sequence:  sequence,
-		}); err != nil {
+	var eventsAffected int64
+	removedByAccount := map[string]int{}
+	for _, query := range queries {
+		expiredEvents, err := txn.FindEvents(query)
+		if err != nil {
 			txn.Rollback()
-			return 0, fmt.Errorf("persistence: error creating tombstone: %w", err)
+			return 0, fmt.Errorf("persistence: error looking up expired events: %w", err)
+		}
+
+		for _, evt := range expiredEvents {
+			removedByAccount[evt.AccountID]++
+			if err := txn.CreateTombstone(&Tombstone{
+				AccountID: evt.AccountID,
+				EventID:   evt.EventID,
+				SecretID:  evt.SecretID,
+				Sequence:  sequence,
+			}); err != nil {
+				txn.Rollback()
+				return 0, fmt.Errorf("persistence: error creating tombstone: %w", err)
+			}
 		}
+
+		affected, err := txn.DeleteEvents(DeleteEventsQueryExpired(query))
+		if err != nil {
+			txn.Rollback()
+			return 0, fmt.Errorf("persistence: error deleting expired events: %w", err)
+		}
+		eventsAffected += affected
 	}
 
-	eventsAffected, err := txn.DeleteEvents(DeleteEventsQueryOlderThan(deadline))
-	if err != nil {
-		txn.Rollback()
-		return 0, fmt.Errorf("persistence: error deleting expired events: %w", err)
+	for accountID, removed := range removedByAccount {
+		if err := notifyWebhooks(txn, accountID, WebhookEventRetentionPurged, map[string]interface{}{
+			"removed": removed,
+		}); err != nil {
+			txn.Rollback()
+			return 0, fmt.Errorf("persistence: error notifying webhooks: %w", err)
+		}
 	}
 
 	if err := txn.Commit(); err != nil {
@@ -13,9 +13,19 @@ type mockExpireDatabase struct {
 	DataAccessLayer
 	err      error
 	affected int64
+	accounts []Account
+	deleted  []DeleteEventsQueryExpired
+	newest   map[string]string
+}
+
+func (m *mockExpireDatabase) FindAccounts(q interface{}) ([]Account, error) {
+	return m.accounts, nil
 }
 
 func (m *mockExpireDatabase) DeleteEvents(q interface{}) (int64, error) {
+	if query, ok := q.(DeleteEventsQueryExpired); ok {
+		m.deleted = append(m.deleted, query)
+	}
 	return m.affected, m.err
 }
 
@@ -24,6 +34,11 @@ func (m *mockExpireDatabase) FindTombstones(q interface{}) ([]Tombstone, error)
 }
 
 func (m *mockExpireDatabase) FindEvents(q interface{}) ([]Event, error) {
+	if query, ok := q.(FindEventsQueryNthNewest); ok {
+		if eventID, ok := m.newest[query.AccountID]; ok {
+			return []Event{{EventID: eventID, AccountID: query.AccountID}}, nil
+		}
+	}
 	return nil, m.err
 }
 
@@ -39,6 +54,13 @@ func (m *mockExpireDatabase) Transaction() (Transaction, error) {
 	return m, nil
 }
 
+func resolveRetention(period string) (time.Duration, error) {
+	if period == "30days" {
+		return time.Hour * 24 * 30, nil
+	}
+	return 0, errors.New("unknown period")
+}
+
 func TestPersistenceLayer_Expire(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		r := &persistenceLayer{
@@ -47,7 +69,7 @@ func TestPersistenceLayer_Expire(t *testing.T) {
 				affected: 9876,
 			},
 		}
-		affected, err := r.Expire(time.Second)
+		affected, err := r.Expire(time.Second, resolveRetention)
 		if err != nil {
 			t.Errorf("Unexpected error %v", err)
 		}
@@ -55,13 +77,66 @@ func TestPersistenceLayer_Expire(t *testing.T) {
 			t.Errorf("Expected %d, got %d", 9876, affected)
 		}
 	})
+	t.Run("per account retention", func(t *testing.T) {
+		db := &mockExpireDatabase{
+			affected: 2,
+			accounts: []Account{
+				{AccountID: "account-a"},
+				{AccountID: "account-b", RetentionPeriod: "30days"},
+				{AccountID: "account-c", RetentionPeriod: "unknown"},
+			},
+		}
+		r := &persistenceLayer{dal: db}
+		affected, err := r.Expire(time.Second, resolveRetention)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if affected != 4 {
+			t.Errorf("Expected %d, got %d", 4, affected)
+		}
+		if len(db.deleted) != 2 {
+			t.Fatalf("Unexpected deletions %v", db.deleted)
+		}
+		if db.deleted[0].AccountID != "account-b" || db.deleted[0].Before >= db.deleted[1].Before {
+			t.Errorf("Unexpected deletion for account with custom retention %v", db.deleted[0])
+		}
+		if db.deleted[1].AccountID != "" || len(db.deleted[1].ExcludeAccountIDs) != 1 || db.deleted[1].ExcludeAccountIDs[0] != "account-b" {
+			t.Errorf("Unexpected deletion using default retention %v", db.deleted[1])
+		}
+	})
+	t.Run("retention rules", func(t *testing.T) {
+		db := &mockExpireDatabase{
+			accounts: []Account{
+				{AccountID: "account-a", RetentionRules: `[{"maxAgeDays":7},{"maxEvents":100}]`},
+				{AccountID: "account-b", RetentionRules: `[{"maxEvents":100}]`},
+				{AccountID: "account-c", RetentionRules: `not json`},
+			},
+			newest: map[string]string{"account-a": "event-a"},
+		}
+		r := &persistenceLayer{dal: db}
+		if _, err := r.Expire(time.Second, resolveRetention); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.deleted) != 3 {
+			t.Fatalf("Unexpected deletions %v", db.deleted)
+		}
+		if db.deleted[0].AccountID != "account-a" || db.deleted[0].Before == "" {
+			t.Errorf("Unexpected deletion for max age rule %v", db.deleted[0])
+		}
+		if db.deleted[1].AccountID != "account-a" || db.deleted[1].Before != "event-a" {
+			t.Errorf("Unexpected deletion for max events rule %v", db.deleted[1])
+		}
+		if db.deleted[2].AccountID != "" || len(db.deleted[2].ExcludeAccountIDs) != 0 {
+			t.Errorf("Unexpected deletion using default retention %v", db.deleted[2])
+		}
+	})
 	t.Run("error", func(t *testing.T) {
 		r := &persistenceLayer{
 			dal: &mockExpireDatabase{
 				err: errors.New("did not work"),
 			},
 		}
-		affected, err := r.Expire(time.Second)
+		affected, err := r.Expire(time.Second, resolveRetention)
 		if err == nil {
 			t.Errorf("Unexpected error value %v", err)
 		}
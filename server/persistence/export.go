@@ -0,0 +1,211 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+
+	"github.com/oklog/ulid"
+)
+
+// ExportEvents returns up to limit events of the given account that are newer
+// than the given cursor, which is expected to be the id of the last event
+// of a previous call. Passing an empty cursor starts at the oldest event.
+func (p *persistenceLayer) ExportEvents(accountID, cursor string, limit int) ([]ExportedEventResult, error) {
+	events, err := p.dal.FindEvents(FindEventsQueryByAccountID{
+		AccountID: accountID,
+		After:     cursor,
+		Limit:     limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up events for export: %w", err)
+	}
+
+	secretIDs := []string{}
+	seen := map[string]bool{}
+	for _, evt := range events {
+		if evt.SecretID != nil && !seen[*evt.SecretID] {
+			seen[*evt.SecretID] = true
+			secretIDs = append(secretIDs, *evt.SecretID)
+		}
+	}
+	secretsByID := map[string]string{}
+	if len(secretIDs) != 0 {
+		secrets, err := p.dal.FindSecrets(FindSecretsQueryBySecretIDs(secretIDs))
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error looking up secrets for export: %w", err)
+		}
+		for _, secret := range secrets {
+			secretsByID[secret.SecretID] = secret.EncryptedSecret
+		}
+	}
+
+	var fingerprints map[int]string
+	if len(secretIDs) != 0 {
+		account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error looking up account for export: %w", err)
+		}
+		fingerprints, err = accountKeyFingerprints(account)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := []ExportedEventResult{}
+	for _, evt := range events {
+		exported := ExportedEventResult{
+			EventID:   evt.EventID,
+			SecretID:  evt.SecretID,
+			Payload:   evt.Payload,
+			EventType: evt.EventType,
+		}
+		if evt.SecretID != nil {
+			exported.EncryptedSecret = secretsByID[*evt.SecretID]
+			exported.KeyVersion = evt.KeyVersion
+			exported.KeyFingerprint = fingerprints[evt.KeyVersion]
+		}
+		result = append(result, exported)
+	}
+	return result, nil
+}
+
+// ImportEvents merges events that have been exported by another instance
+// into the given account. Both instances are expected to share the account's
+// keys, which is checked for each event that references a secret, as the
+// events could not be decrypted otherwise. Event ids are kept, so events
+// that already exist are skipped and importing the same events repeatedly
+// is safe. Events that have been deleted in this instance are skipped as
+// well, so imports never restore data users have purged.
+func (p *persistenceLayer) ImportEvents(accountID, accountUserID string, events []ExportedEventResult) (ImportResult, error) {
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("persistence: error looking up account for import: %w", err)
+	}
+	fingerprints, err := accountKeyFingerprints(account)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	eventIDs := []string{}
+	secretIDs := []string{}
+	seenSecrets := map[string]bool{}
+	for _, evt := range events {
+		if _, err := ulid.Parse(evt.EventID); err != nil {
+			return ImportResult{}, ErrInvalidImport(fmt.Sprintf("persistence: invalid event id %s", evt.EventID))
+		}
+		if evt.Payload == "" {
+			return ImportResult{}, ErrInvalidImport(fmt.Sprintf("persistence: event %s has no payload", evt.EventID))
+		}
+		if err := checkEventType(account, evt.EventType); err != nil {
+			return ImportResult{}, err
+		}
+		eventIDs = append(eventIDs, evt.EventID)
+		if evt.SecretID == nil {
+			continue
+		}
+		if fingerprint, ok := fingerprints[evt.KeyVersion]; !ok || fingerprint != evt.KeyFingerprint {
+			return ImportResult{}, ErrAccountKeyMismatch(
+				fmt.Sprintf("persistence: secret of event %s has not been encrypted using a key of account %s", evt.EventID, accountID),
+			)
+		}
+		if evt.EncryptedSecret == "" {
+			return ImportResult{}, ErrInvalidImport(fmt.Sprintf("persistence: event %s has no encrypted secret", evt.EventID))
+		}
+		if !seenSecrets[*evt.SecretID] {
+			seenSecrets[*evt.SecretID] = true
+			secretIDs = append(secretIDs, *evt.SecretID)
+		}
+	}
+
+	skip := map[string]bool{}
+	if len(eventIDs) != 0 {
+		existing, err := p.dal.FindEvents(FindEventsQueryByEventIDs(eventIDs))
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("persistence: error looking up existing events: %w", err)
+		}
+		for _, evt := range existing {
+			skip[evt.EventID] = true
+		}
+	}
+	tombstones, err := p.dal.FindTombstones(FindTombstonesQueryByAccounts{AccountIDs: []string{accountID}})
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("persistence: error looking up deleted events: %w", err)
+	}
+	for _, tombstone := range tombstones {
+		skip[tombstone.EventID] = true
+	}
+
+	knownSecrets := map[string]bool{}
+	if len(secretIDs) != 0 {
+		secrets, err := p.dal.FindSecrets(FindSecretsQueryBySecretIDs(secretIDs))
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("persistence: error looking up existing secrets: %w", err)
+		}
+		for _, secret := range secrets {
+			knownSecrets[secret.SecretID] = true
+		}
+	}
+
+	var result ImportResult
+	var imported []*Event
+	var created []*Secret
+	for _, evt := range events {
+		if skip[evt.EventID] {
+			result.Skipped++
+			continue
+		}
+		// an event might be contained in the import more than once
+		skip[evt.EventID] = true
+
+		sequence, err := NewULID()
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("persistence: error creating sequence number: %w", err)
+		}
+		imported = append(imported, &Event{
+			EventID:    evt.EventID,
+			AccountID:  accountID,
+			SecretID:   evt.SecretID,
+			Payload:    evt.Payload,
+			Sequence:   sequence,
+			KeyVersion: evt.KeyVersion,
+			EventType:  evt.EventType,
+		})
+		if evt.SecretID != nil && !knownSecrets[*evt.SecretID] {
+			knownSecrets[*evt.SecretID] = true
+			created = append(created, &Secret{
+				SecretID:        *evt.SecretID,
+				EncryptedSecret: evt.EncryptedSecret,
+				KeyVersion:      evt.KeyVersion,
+			})
+		}
+	}
+	result.Imported = len(imported)
+	if len(imported) == 0 {
+		return result, nil
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	for _, secret := range created {
+		if err := txn.CreateSecret(secret); err != nil {
+			txn.Rollback()
+			return ImportResult{}, fmt.Errorf("persistence: error creating imported secret: %w", err)
+		}
+	}
+	if err := txn.CreateEvents(imported); err != nil {
+		txn.Rollback()
+		return ImportResult{}, fmt.Errorf("persistence: error creating imported events: %w", err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionImportEvents, fmt.Sprintf("%d events", result.Imported)); err != nil {
+		txn.Rollback()
+		return ImportResult{}, fmt.Errorf("persistence: error recording import: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return ImportResult{}, fmt.Errorf("persistence: error committing import: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type mockExportDatabase struct {
+	DataAccessLayer
+	events      []Event
+	findErr     error
+	eventsQuery interface{}
+	secretQuery interface{}
+}
+
+func (m *mockExportDatabase) FindEvents(q interface{}) ([]Event, error) {
+	m.eventsQuery = q
+	return m.events, m.findErr
+}
+
+func (m *mockExportDatabase) FindAccount(interface{}) (Account, error) {
+	return Account{AccountID: "account-a", PublicKey: "public-key", KeyVersion: 1}, nil
+}
+
+func (m *mockExportDatabase) FindSecrets(q interface{}) ([]Secret, error) {
+	m.secretQuery = q
+	return []Secret{{SecretID: "secret-a", EncryptedSecret: "encrypted-a"}}, nil
+}
+
+func TestPersistenceLayer_ExportEvents(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockExportDatabase{findErr: errors.New("did not work")}}
+		if _, err := p.ExportEvents("account-a", "", 10); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockExportDatabase{
+			events: []Event{
+				{EventID: "event-a", SecretID: strptr("secret-a"), Payload: "payload-a", KeyVersion: 1},
+				{EventID: "event-b", SecretID: strptr("secret-a"), Payload: "payload-b", KeyVersion: 1},
+				{EventID: "event-c", Payload: "payload-c"},
+			},
+		}
+		p := &persistenceLayer{dal: db}
+		result, err := p.ExportEvents("account-a", "event-0", 10)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		expected := []ExportedEventResult{
+			{EventID: "event-a", SecretID: strptr("secret-a"), EncryptedSecret: "encrypted-a", Payload: "payload-a", KeyVersion: 1, KeyFingerprint: keyFingerprint("public-key")},
+			{EventID: "event-b", SecretID: strptr("secret-a"), EncryptedSecret: "encrypted-a", Payload: "payload-b", KeyVersion: 1, KeyFingerprint: keyFingerprint("public-key")},
+			{EventID: "event-c", Payload: "payload-c"},
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Unexpected result %v", result)
+		}
+		if !reflect.DeepEqual(db.eventsQuery, FindEventsQueryByAccountID{AccountID: "account-a", After: "event-0", Limit: 10}) {
+			t.Errorf("Unexpected events query %v", db.eventsQuery)
+		}
+		if !reflect.DeepEqual(db.secretQuery, FindSecretsQueryBySecretIDs{"secret-a"}) {
+			t.Errorf("Unexpected secrets query %v", db.secretQuery)
+		}
+	})
+}
+
+type mockImportDatabase struct {
+	DataAccessLayer
+	existing   []Event
+	tombstones []Tombstone
+	secrets    []Secret
+	created    []*Event
+	createdSec []*Secret
+	auditLog   []AuditLogEntry
+}
+
+func (m *mockImportDatabase) FindAccount(interface{}) (Account, error) {
+	return Account{
+		AccountID:    "account-a",
+		PublicKey:    "public-key-b",
+		KeyVersion:   1,
+		PreviousKeys: `[{"version":0,"publicKey":"public-key-a"}]`,
+	}, nil
+}
+
+func (m *mockImportDatabase) FindEvents(interface{}) ([]Event, error) {
+	return m.existing, nil
+}
+
+func (m *mockImportDatabase) FindTombstones(interface{}) ([]Tombstone, error) {
+	return m.tombstones, nil
+}
+
+func (m *mockImportDatabase) FindSecrets(interface{}) ([]Secret, error) {
+	return m.secrets, nil
+}
+
+func (m *mockImportDatabase) Transaction() (Transaction, error) {
+	return &mockImportTransaction{m}, nil
+}
+
+type mockImportTransaction struct {
+	*mockImportDatabase
+}
+
+func (m *mockImportTransaction) CreateSecret(s *Secret) error {
+	m.createdSec = append(m.createdSec, s)
+	return nil
+}
+
+func (m *mockImportTransaction) CreateEvents(evts []*Event) error {
+	m.created = append(m.created, evts...)
+	return nil
+}
+
+func (m *mockImportTransaction) CreateAuditLogEntry(e *AuditLogEntry) error {
+	m.auditLog = append(m.auditLog, *e)
+	return nil
+}
+
+func (m *mockImportTransaction) Commit() error {
+	return nil
+}
+
+func (m *mockImportTransaction) Rollback() error {
+	return nil
+}
+
+func TestPersistenceLayer_ImportEvents(t *testing.T) {
+	eventA, _ := NewULID()
+	eventB, _ := NewULID()
+	eventC, _ := NewULID()
+	eventD, _ := NewULID()
+
+	t.Run("ok", func(t *testing.T) {
+		db := &mockImportDatabase{
+			existing:   []Event{{EventID: eventB}},
+			tombstones: []Tombstone{{EventID: eventC}},
+			secrets:    []Secret{{SecretID: "secret-b"}},
+		}
+		p := &persistenceLayer{dal: db}
+		result, err := p.ImportEvents("account-a", "account-user-a", []ExportedEventResult{
+			{EventID: eventA, SecretID: strptr("secret-a"), EncryptedSecret: "encrypted-a", KeyFingerprint: keyFingerprint("public-key-a"), Payload: "payload-a"},
+			{EventID: eventB, SecretID: strptr("secret-a"), EncryptedSecret: "encrypted-a", KeyFingerprint: keyFingerprint("public-key-a"), Payload: "payload-b"},
+			{EventID: eventC, Payload: "payload-c"},
+			{EventID: eventD, SecretID: strptr("secret-b"), EncryptedSecret: "encrypted-b", KeyVersion: 1, KeyFingerprint: keyFingerprint("public-key-b"), Payload: "payload-d"},
+			{EventID: eventA, SecretID: strptr("secret-a"), EncryptedSecret: "encrypted-a", KeyFingerprint: keyFingerprint("public-key-a"), Payload: "payload-a"},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(result, ImportResult{Imported: 2, Skipped: 3}) {
+			t.Errorf("Unexpected result %v", result)
+		}
+		if len(db.created) != 2 || db.created[0].EventID != eventA || db.created[1].EventID != eventD || db.created[0].Sequence == "" {
+			t.Errorf("Unexpected events %v", db.created)
+		}
+		if len(db.createdSec) != 1 || db.createdSec[0].SecretID != "secret-a" || db.createdSec[0].KeyVersion != 0 {
+			t.Errorf("Unexpected secrets %v", db.createdSec)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionImportEvents {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+	t.Run("key mismatch", func(t *testing.T) {
+		db := &mockImportDatabase{}
+		p := &persistenceLayer{dal: db}
+		_, err := p.ImportEvents("account-a", "account-user-a", []ExportedEventResult{
+			{EventID: eventA, SecretID: strptr("secret-a"), EncryptedSecret: "encrypted-a", KeyVersion: 1, KeyFingerprint: keyFingerprint("public-key-a"), Payload: "payload-a"},
+		})
+		var mismatchErr ErrAccountKeyMismatch
+		if !errors.As(err, &mismatchErr) {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.created) != 0 {
+			t.Errorf("Unexpected events %v", db.created)
+		}
+	})
+	t.Run("bad event id", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockImportDatabase{}}
+		_, err := p.ImportEvents("account-a", "account-user-a", []ExportedEventResult{
+			{EventID: "event-a", Payload: "payload-a"},
+		})
+		var invalidErr ErrInvalidImport
+		if !errors.As(err, &invalidErr) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+var featureFlagRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// FeatureFlags maps the names of features to whether they are enabled. Flags
+// that are not contained fall back to the instance wide defaults.
+type FeatureFlags map[string]bool
+
+func parseFeatureFlags(s string) (FeatureFlags, error) {
+	flags := FeatureFlags{}
+	if s == "" {
+		return flags, nil
+	}
+	if err := json.Unmarshal([]byte(s), &flags); err != nil {
+		return nil, fmt.Errorf("persistence: error parsing feature flags: %w", err)
+	}
+	return flags, nil
+}
+
+// UpdateAccountFeatureFlags merges the given update into the feature flags of
+// the given account. Flags that are set to nil are removed so the instance
+// wide default applies again. The resulting flags are returned.
+func (p *persistenceLayer) UpdateAccountFeatureFlags(accountID string, update map[string]*bool, accountUserID string) (FeatureFlags, error) {
+	for name := range update {
+		if !featureFlagRe.MatchString(name) {
+			return nil, fmt.Errorf("persistence: %q is not a valid feature flag name", name)
+		}
+	}
+	a, err := p.dal.FindAccount(FindAccountQueryByID(accountID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up account before updating feature flags: %w", err)
+	}
+	flags, err := parseFeatureFlags(a.FeatureFlags)
+	if err != nil {
+		return nil, err
+	}
+	for name, enabled := range update {
+		if enabled == nil {
+			delete(flags, name)
+			continue
+		}
+		flags[name] = *enabled
+	}
+
+	var encoded string
+	if len(flags) != 0 {
+		b, err := json.Marshal(flags)
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error encoding feature flags: %w", err)
+		}
+		encoded = string(b)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	a.FeatureFlags = encoded
+	if err := txn.UpdateAccount(&a); err != nil {
+		txn.Rollback()
+		return nil, fmt.Errorf("persistence: error updating feature flags of account %s: %w", accountID, err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionUpdateFeatureFlags, fmt.Sprintf("%d flags", len(update))); err != nil {
+		txn.Rollback()
+		return nil, fmt.Errorf("persistence: error recording feature flag update of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, fmt.Errorf("persistence: error committing feature flag update: %w", err)
+	}
+	return flags, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"reflect"
+	"testing"
+)
+
+type mockFeatureFlagsDatabase struct {
+	mockUpdateAccountRetentionDatabase
+	flags string
+}
+
+func (m *mockFeatureFlagsDatabase) FindAccount(interface{}) (Account, error) {
+	return Account{AccountID: "account-a", FeatureFlags: m.flags}, nil
+}
+
+func (m *mockFeatureFlagsDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func TestPersistenceLayer_UpdateAccountFeatureFlags(t *testing.T) {
+	enabled, disabled := true, false
+	t.Run("merge", func(t *testing.T) {
+		db := &mockFeatureFlagsDatabase{flags: `{"batch-ingestion":false,"other":true}`}
+		p := &persistenceLayer{dal: db}
+		result, err := p.UpdateAccountFeatureFlags("account-a", map[string]*bool{
+			"batch-ingestion": &enabled,
+			"other":           nil,
+			"new":             &disabled,
+		}, "")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		expected := FeatureFlags{"batch-ingestion": true, "new": false}
+		if !reflect.DeepEqual(expected, result) {
+			t.Errorf("Expected %v, got %v", expected, result)
+		}
+		if len(db.updated) != 1 || db.updated[0].FeatureFlags != `{"batch-ingestion":true,"new":false}` {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionUpdateFeatureFlags {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+	t.Run("reset", func(t *testing.T) {
+		db := &mockFeatureFlagsDatabase{flags: `{"batch-ingestion":false}`}
+		p := &persistenceLayer{dal: db}
+		if _, err := p.UpdateAccountFeatureFlags("account-a", map[string]*bool{"batch-ingestion": nil}, ""); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 || db.updated[0].FeatureFlags != "" {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+	})
+	t.Run("bad name", func(t *testing.T) {
+		db := &mockFeatureFlagsDatabase{}
+		p := &persistenceLayer{dal: db}
+		if _, err := p.UpdateAccountFeatureFlags("account-a", map[string]*bool{"Batch Ingestion": &enabled}, ""); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if len(db.updated) != 0 {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+	})
+}
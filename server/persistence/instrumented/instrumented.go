@@ -0,0 +1,209 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package instrumented records the latency of all calls to a data access
+// layer. Durations are recorded in a histogram labeled with the name of the
+// method and the type of the query that has been passed, and calls taking
+// longer than a configured threshold are logged.
+//
+// Logged queries are sanitized so that they never contain any user data.
+// Only numbers, booleans and timestamps are logged as is, strings are
+// replaced by a placeholder and collections are replaced by their length.
+package instrumented
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/metrics"
+	"github.com/offen/offen/server/persistence"
+	"github.com/sirupsen/logrus"
+)
+
+// DAL wraps a data access layer, instrumenting all of its methods.
+type DAL struct {
+	dal       persistence.DataAccessLayer
+	logger    *logrus.Logger
+	threshold time.Duration
+	durations *metrics.Histogram
+	now       func() time.Time
+}
+
+// Config adds a configuration value to the instrumentation.
+type Config func(*DAL)
+
+// WithMetrics sets the registry used for recording query latency.
+func WithMetrics(m *metrics.Registry) Config {
+	return func(d *DAL) {
+		d.durations = m.Histogram(
+			"offen_dal_query_duration_seconds",
+			"Duration of data access layer queries in seconds.",
+			metrics.DefaultBuckets,
+			"method", "query",
+		)
+	}
+}
+
+// WithSlowQueryLog logs all queries taking longer than the given threshold
+// using the given logger. Passing a threshold of zero disables logging.
+func WithSlowQueryLog(l *logrus.Logger, threshold time.Duration) Config {
+	return func(d *DAL) {
+		d.logger = l
+		d.threshold = threshold
+	}
+}
+
+// NewInstrumentedDAL wraps the given data access layer.
+func NewInstrumentedDAL(dal persistence.DataAccessLayer, configs ...Config) *DAL {
+	d := &DAL{dal: dal, now: time.Now}
+	for _, cfg := range configs {
+		cfg(d)
+	}
+	return d
+}
+
+// observe records the time that has passed since start. The query is nil
+// for methods that do not take a query argument.
+func (d *DAL) observe(method string, query interface{}, start time.Time, err error) {
+	elapsed := d.now().Sub(start)
+	queryType := ""
+	if query != nil {
+		queryType = reflect.TypeOf(query).Name()
+	}
+	d.durations.Observe(elapsed.Seconds(), method, queryType)
+
+	if d.logger == nil || d.threshold <= 0 || elapsed < d.threshold {
+		return
+	}
+	fields := logrus.Fields{
+		"method":   method,
+		"duration": elapsed.String(),
+	}
+	if query != nil {
+		fields["query"] = queryType
+		fields["params"] = sanitize(query)
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	d.logger.WithFields(fields).Warn("Slow data access layer query")
+}
+
+// sanitize formats the given query, replacing all values that might contain
+// user data.
+func sanitize(query interface{}) string {
+	var b strings.Builder
+	writeSanitized(&b, reflect.ValueOf(query))
+	return b.String()
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func writeSanitized(b *strings.Builder, v reflect.Value) {
+	if !v.IsValid() {
+		b.WriteString("nil")
+		return
+	}
+	if v.Type() == timeType && v.CanInterface() {
+		b.WriteString(v.Interface().(time.Time).UTC().Format(time.RFC3339))
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		writeSanitized(b, v.Elem())
+	case reflect.String:
+		if v.Len() == 0 {
+			b.WriteString(`""`)
+			return
+		}
+		b.WriteString("?")
+	case reflect.Slice, reflect.Array, reflect.Map:
+		fmt.Fprintf(b, "[%d items]", v.Len())
+	case reflect.Struct:
+		t := v.Type()
+		b.WriteString("{")
+		for i := 0; i < v.NumField(); i++ {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			b.WriteString(t.Field(i).Name)
+			b.WriteString(":")
+			writeSanitized(b, v.Field(i))
+		}
+		b.WriteString("}")
+	case reflect.Bool:
+		b.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		b.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		b.WriteString(strconv.FormatFloat(v.Float(), 'g', -1, 64))
+	default:
+		b.WriteString("?")
+	}
+}
+
+// Transaction returns a transaction that is instrumented as well.
+func (d *DAL) Transaction() (persistence.Transaction, error) {
+	start := d.now()
+	txn, err := d.dal.Transaction()
+	d.observe("Transaction", nil, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &transaction{
+		DAL: &DAL{
+			dal:       txn,
+			logger:    d.logger,
+			threshold: d.threshold,
+			durations: d.durations,
+			now:       d.now,
+		},
+		txn: txn,
+	}, nil
+}
+
+// ProbeEmpty is not instrumented as it is only called on startup.
+func (d *DAL) ProbeEmpty() bool {
+	return d.dal.ProbeEmpty()
+}
+
+// ReadReplica instruments reads that are served by replicas as well.
+func (d *DAL) ReadReplica(fn func(persistence.DataAccessLayer) error) error {
+	r, ok := d.dal.(persistence.ReplicaReader)
+	if !ok {
+		return fn(d)
+	}
+	return r.ReadReplica(func(dal persistence.DataAccessLayer) error {
+		replica := *d
+		replica.dal = dal
+		return fn(&replica)
+	})
+}
+
+type transaction struct {
+	*DAL
+	txn persistence.Transaction
+}
+
+func (t *transaction) Commit() error {
+	start := t.now()
+	err := t.txn.Commit()
+	t.observe("Commit", nil, start, err)
+	return err
+}
+
+func (t *transaction) Rollback() error {
+	start := t.now()
+	err := t.txn.Rollback()
+	t.observe("Rollback", nil, start, err)
+	return err
+}
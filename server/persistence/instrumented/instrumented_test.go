@@ -0,0 +1,111 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package instrumented
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/metrics"
+	"github.com/offen/offen/server/persistence"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+var _ persistence.DataAccessLayer = &DAL{}
+
+type mockDAL struct {
+	persistence.DataAccessLayer
+}
+
+func (m *mockDAL) FindEvents(q interface{}) ([]persistence.Event, error) {
+	return []persistence.Event{{EventID: "event-a"}}, nil
+}
+
+func (m *mockDAL) CreateEvent(e *persistence.Event) error {
+	return nil
+}
+
+func TestDAL_observe(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	registry := metrics.New()
+	dal := NewInstrumentedDAL(&mockDAL{}, WithMetrics(registry), WithSlowQueryLog(logger, time.Second))
+
+	// every call to now advances the clock by two seconds, so all queries
+	// are considered slow
+	clock := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	dal.now = func() time.Time {
+		clock = clock.Add(time.Second * 2)
+		return clock
+	}
+
+	result, err := dal.FindEvents(persistence.FindEventsQueryForSecretIDs{
+		SecretIDs: []string{"secret-a", "secret-b"},
+		Since:     "sequence",
+		Limit:     10,
+	})
+	if err != nil || len(result) != 1 {
+		t.Fatalf("Unexpected result %v, %v", result, err)
+	}
+	if err := dal.CreateEvent(&persistence.Event{EventID: "event-b", Payload: "payload"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	entries := hook.AllEntries()
+	if len(entries) != 2 {
+		t.Fatalf("Unexpected number of log entries %d", len(entries))
+	}
+	if entries[0].Level != logrus.WarnLevel || entries[0].Data["query"] != "FindEventsQueryForSecretIDs" {
+		t.Errorf("Unexpected log entry %v", entries[0].Data)
+	}
+	params, _ := entries[0].Data["params"].(string)
+	if strings.Contains(params, "secret-a") || strings.Contains(params, "sequence") {
+		t.Errorf("Expected params to be sanitized, got %v", params)
+	}
+	if !strings.Contains(params, "SecretIDs:[2 items]") || !strings.Contains(params, "Limit:10") {
+		t.Errorf("Unexpected params %v", params)
+	}
+	if _, ok := entries[1].Data["params"]; ok || entries[1].Data["method"] != "CreateEvent" {
+		t.Errorf("Unexpected log entry %v", entries[1].Data)
+	}
+
+	var b bytes.Buffer
+	registry.WriteTo(&b)
+	if !strings.Contains(b.String(), `offen_dal_query_duration_seconds_count{method="FindEvents",query="FindEventsQueryForSecretIDs"} 1`) {
+		t.Errorf("Unexpected metrics %s", b.String())
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    interface{}
+		expected string
+	}{
+		{
+			"string type",
+			persistence.FindAccountQueryByID("account-a"),
+			"?",
+		},
+		{
+			"struct",
+			persistence.FindEventsQueryNthNewest{AccountID: "account-a", N: 3},
+			`{AccountID:? N:3 EventType:""}`,
+		},
+		{
+			"time",
+			persistence.FindPingCountersQueryByAccountID{AccountID: "account-a", Since: time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)},
+			"{AccountID:? Since:2022-04-01T00:00:00Z}",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := sanitize(test.query); result != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,528 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package instrumented
+
+import (
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func (d *DAL) CreateEvent(evt *persistence.Event) error {
+	start := d.now()
+	err := d.dal.CreateEvent(evt)
+	d.observe("CreateEvent", nil, start, err)
+	return err
+}
+
+func (d *DAL) CreateEvents(evts []*persistence.Event) error {
+	start := d.now()
+	err := d.dal.CreateEvents(evts)
+	d.observe("CreateEvents", nil, start, err)
+	return err
+}
+
+func (d *DAL) ReserveSequenceNumbers(accountID string, n int64) (int64, error) {
+	start := d.now()
+	result, err := d.dal.ReserveSequenceNumbers(accountID, n)
+	d.observe("ReserveSequenceNumbers", nil, start, err)
+	return result, err
+}
+
+func (d *DAL) FindEvents(q interface{}) ([]persistence.Event, error) {
+	start := d.now()
+	result, err := d.dal.FindEvents(q)
+	d.observe("FindEvents", q, start, err)
+	return result, err
+}
+
+func (d *DAL) DeleteEvents(q interface{}) (int64, error) {
+	start := d.now()
+	result, err := d.dal.DeleteEvents(q)
+	d.observe("DeleteEvents", q, start, err)
+	return result, err
+}
+
+func (d *DAL) FindEventStats(q interface{}) (persistence.EventStats, error) {
+	start := d.now()
+	result, err := d.dal.FindEventStats(q)
+	d.observe("FindEventStats", q, start, err)
+	return result, err
+}
+
+func (d *DAL) CreateSecret(s *persistence.Secret) error {
+	start := d.now()
+	err := d.dal.CreateSecret(s)
+	d.observe("CreateSecret", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindSecret(q interface{}) (persistence.Secret, error) {
+	start := d.now()
+	result, err := d.dal.FindSecret(q)
+	d.observe("FindSecret", q, start, err)
+	return result, err
+}
+
+func (d *DAL) FindSecrets(q interface{}) ([]persistence.Secret, error) {
+	start := d.now()
+	result, err := d.dal.FindSecrets(q)
+	d.observe("FindSecrets", q, start, err)
+	return result, err
+}
+
+func (d *DAL) DeleteSecret(q interface{}) error {
+	start := d.now()
+	err := d.dal.DeleteSecret(q)
+	d.observe("DeleteSecret", q, start, err)
+	return err
+}
+
+func (d *DAL) CreateAccount(a *persistence.Account) error {
+	start := d.now()
+	err := d.dal.CreateAccount(a)
+	d.observe("CreateAccount", nil, start, err)
+	return err
+}
+
+func (d *DAL) UpdateAccount(a *persistence.Account) error {
+	start := d.now()
+	err := d.dal.UpdateAccount(a)
+	d.observe("UpdateAccount", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindAccount(q interface{}) (persistence.Account, error) {
+	start := d.now()
+	result, err := d.dal.FindAccount(q)
+	d.observe("FindAccount", q, start, err)
+	return result, err
+}
+
+func (d *DAL) FindAccounts(q interface{}) ([]persistence.Account, error) {
+	start := d.now()
+	result, err := d.dal.FindAccounts(q)
+	d.observe("FindAccounts", q, start, err)
+	return result, err
+}
+
+func (d *DAL) DeleteAccount(q interface{}) error {
+	start := d.now()
+	err := d.dal.DeleteAccount(q)
+	d.observe("DeleteAccount", q, start, err)
+	return err
+}
+
+func (d *DAL) CreateAccountUser(a *persistence.AccountUser) error {
+	start := d.now()
+	err := d.dal.CreateAccountUser(a)
+	d.observe("CreateAccountUser", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindAccountUser(q interface{}) (persistence.AccountUser, error) {
+	start := d.now()
+	result, err := d.dal.FindAccountUser(q)
+	d.observe("FindAccountUser", q, start, err)
+	return result, err
+}
+
+func (d *DAL) FindAccountUsers(q interface{}) ([]persistence.AccountUser, error) {
+	start := d.now()
+	result, err := d.dal.FindAccountUsers(q)
+	d.observe("FindAccountUsers", q, start, err)
+	return result, err
+}
+
+func (d *DAL) UpdateAccountUser(a *persistence.AccountUser) error {
+	start := d.now()
+	err := d.dal.UpdateAccountUser(a)
+	d.observe("UpdateAccountUser", nil, start, err)
+	return err
+}
+
+func (d *DAL) CreateAccountUserRelationship(a *persistence.AccountUserRelationship) error {
+	start := d.now()
+	err := d.dal.CreateAccountUserRelationship(a)
+	d.observe("CreateAccountUserRelationship", nil, start, err)
+	return err
+}
+
+func (d *DAL) UpdateAccountUserRelationship(a *persistence.AccountUserRelationship) error {
+	start := d.now()
+	err := d.dal.UpdateAccountUserRelationship(a)
+	d.observe("UpdateAccountUserRelationship", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindAccountUserRelationships(q interface{}) ([]persistence.AccountUserRelationship, error) {
+	start := d.now()
+	result, err := d.dal.FindAccountUserRelationships(q)
+	d.observe("FindAccountUserRelationships", q, start, err)
+	return result, err
+}
+
+func (d *DAL) DeleteAccountUserRelationships(q interface{}) error {
+	start := d.now()
+	err := d.dal.DeleteAccountUserRelationships(q)
+	d.observe("DeleteAccountUserRelationships", q, start, err)
+	return err
+}
+
+func (d *DAL) CreateTombstone(t *persistence.Tombstone) error {
+	start := d.now()
+	err := d.dal.CreateTombstone(t)
+	d.observe("CreateTombstone", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindTombstones(q interface{}) ([]persistence.Tombstone, error) {
+	start := d.now()
+	result, err := d.dal.FindTombstones(q)
+	d.observe("FindTombstones", q, start, err)
+	return result, err
+}
+
+func (d *DAL) CreateAuditLogEntry(a *persistence.AuditLogEntry) error {
+	start := d.now()
+	err := d.dal.CreateAuditLogEntry(a)
+	d.observe("CreateAuditLogEntry", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindAuditLogEntries(q interface{}) ([]persistence.AuditLogEntry, error) {
+	start := d.now()
+	result, err := d.dal.FindAuditLogEntries(q)
+	d.observe("FindAuditLogEntries", q, start, err)
+	return result, err
+}
+
+func (d *DAL) DeleteAuditLogEntries(q interface{}) (int64, error) {
+	start := d.now()
+	result, err := d.dal.DeleteAuditLogEntries(q)
+	d.observe("DeleteAuditLogEntries", q, start, err)
+	return result, err
+}
+
+func (d *DAL) CreateShareLink(s *persistence.ShareLink) error {
+	start := d.now()
+	err := d.dal.CreateShareLink(s)
+	d.observe("CreateShareLink", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindShareLink(q interface{}) (persistence.ShareLink, error) {
+	start := d.now()
+	result, err := d.dal.FindShareLink(q)
+	d.observe("FindShareLink", q, start, err)
+	return result, err
+}
+
+func (d *DAL) DeleteShareLinks(q interface{}) (int64, error) {
+	start := d.now()
+	result, err := d.dal.DeleteShareLinks(q)
+	d.observe("DeleteShareLinks", q, start, err)
+	return result, err
+}
+
+func (d *DAL) CreateTrafficAnomaly(t *persistence.TrafficAnomaly) error {
+	start := d.now()
+	err := d.dal.CreateTrafficAnomaly(t)
+	d.observe("CreateTrafficAnomaly", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindTrafficAnomalies(q interface{}) ([]persistence.TrafficAnomaly, error) {
+	start := d.now()
+	result, err := d.dal.FindTrafficAnomalies(q)
+	d.observe("FindTrafficAnomalies", q, start, err)
+	return result, err
+}
+
+func (d *DAL) DeleteTrafficAnomalies(q interface{}) (int64, error) {
+	start := d.now()
+	result, err := d.dal.DeleteTrafficAnomalies(q)
+	d.observe("DeleteTrafficAnomalies", q, start, err)
+	return result, err
+}
+
+func (d *DAL) CreateAggregateCounter(a *persistence.AggregateCounter) error {
+	start := d.now()
+	err := d.dal.CreateAggregateCounter(a)
+	d.observe("CreateAggregateCounter", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindAggregateCounters(q interface{}) ([]persistence.AggregateCounter, error) {
+	start := d.now()
+	result, err := d.dal.FindAggregateCounters(q)
+	d.observe("FindAggregateCounters", q, start, err)
+	return result, err
+}
+
+func (d *DAL) DeleteAggregateCounters(q interface{}) (int64, error) {
+	start := d.now()
+	result, err := d.dal.DeleteAggregateCounters(q)
+	d.observe("DeleteAggregateCounters", q, start, err)
+	return result, err
+}
+
+func (d *DAL) IncrementPingCounter(accountID string, day time.Time) error {
+	start := d.now()
+	err := d.dal.IncrementPingCounter(accountID, day)
+	d.observe("IncrementPingCounter", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindPingCounters(q interface{}) ([]persistence.PingCounter, error) {
+	start := d.now()
+	result, err := d.dal.FindPingCounters(q)
+	d.observe("FindPingCounters", q, start, err)
+	return result, err
+}
+
+func (d *DAL) DeletePingCounters(q interface{}) (int64, error) {
+	start := d.now()
+	result, err := d.dal.DeletePingCounters(q)
+	d.observe("DeletePingCounters", q, start, err)
+	return result, err
+}
+
+func (d *DAL) CreateInvitation(i *persistence.Invitation) error {
+	start := d.now()
+	err := d.dal.CreateInvitation(i)
+	d.observe("CreateInvitation", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindInvitation(q interface{}) (persistence.Invitation, error) {
+	start := d.now()
+	result, err := d.dal.FindInvitation(q)
+	d.observe("FindInvitation", q, start, err)
+	return result, err
+}
+
+func (d *DAL) UpdateInvitation(i *persistence.Invitation) error {
+	start := d.now()
+	err := d.dal.UpdateInvitation(i)
+	d.observe("UpdateInvitation", nil, start, err)
+	return err
+}
+
+func (d *DAL) DeleteInvitations(q interface{}) (int64, error) {
+	start := d.now()
+	result, err := d.dal.DeleteInvitations(q)
+	d.observe("DeleteInvitations", q, start, err)
+	return result, err
+}
+
+func (d *DAL) CreateSession(s *persistence.Session) error {
+	start := d.now()
+	err := d.dal.CreateSession(s)
+	d.observe("CreateSession", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindSessions(q interface{}) ([]persistence.Session, error) {
+	start := d.now()
+	result, err := d.dal.FindSessions(q)
+	d.observe("FindSessions", q, start, err)
+	return result, err
+}
+
+func (d *DAL) DeleteSessions(q interface{}) (int64, error) {
+	start := d.now()
+	result, err := d.dal.DeleteSessions(q)
+	d.observe("DeleteSessions", q, start, err)
+	return result, err
+}
+
+func (d *DAL) CreateAPIToken(a *persistence.APIToken) error {
+	start := d.now()
+	err := d.dal.CreateAPIToken(a)
+	d.observe("CreateAPIToken", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindAPITokens(q interface{}) ([]persistence.APIToken, error) {
+	start := d.now()
+	result, err := d.dal.FindAPITokens(q)
+	d.observe("FindAPITokens", q, start, err)
+	return result, err
+}
+
+func (d *DAL) DeleteAPITokens(q interface{}) (int64, error) {
+	start := d.now()
+	result, err := d.dal.DeleteAPITokens(q)
+	d.observe("DeleteAPITokens", q, start, err)
+	return result, err
+}
+
+func (d *DAL) CreateWebAuthnCredential(w *persistence.WebAuthnCredential) error {
+	start := d.now()
+	err := d.dal.CreateWebAuthnCredential(w)
+	d.observe("CreateWebAuthnCredential", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindWebAuthnCredentials(q interface{}) ([]persistence.WebAuthnCredential, error) {
+	start := d.now()
+	result, err := d.dal.FindWebAuthnCredentials(q)
+	d.observe("FindWebAuthnCredentials", q, start, err)
+	return result, err
+}
+
+func (d *DAL) UpdateWebAuthnCredential(w *persistence.WebAuthnCredential) error {
+	start := d.now()
+	err := d.dal.UpdateWebAuthnCredential(w)
+	d.observe("UpdateWebAuthnCredential", nil, start, err)
+	return err
+}
+
+func (d *DAL) CreateQueuedMail(q *persistence.QueuedMail) error {
+	start := d.now()
+	err := d.dal.CreateQueuedMail(q)
+	d.observe("CreateQueuedMail", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindQueuedMails(q interface{}) ([]persistence.QueuedMail, error) {
+	start := d.now()
+	result, err := d.dal.FindQueuedMails(q)
+	d.observe("FindQueuedMails", q, start, err)
+	return result, err
+}
+
+func (d *DAL) UpdateQueuedMail(q *persistence.QueuedMail) error {
+	start := d.now()
+	err := d.dal.UpdateQueuedMail(q)
+	d.observe("UpdateQueuedMail", nil, start, err)
+	return err
+}
+
+func (d *DAL) DeleteQueuedMails(q interface{}) (int64, error) {
+	start := d.now()
+	result, err := d.dal.DeleteQueuedMails(q)
+	d.observe("DeleteQueuedMails", q, start, err)
+	return result, err
+}
+
+func (d *DAL) CreateWebhook(w *persistence.Webhook) error {
+	start := d.now()
+	err := d.dal.CreateWebhook(w)
+	d.observe("CreateWebhook", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindWebhooks(q interface{}) ([]persistence.Webhook, error) {
+	start := d.now()
+	result, err := d.dal.FindWebhooks(q)
+	d.observe("FindWebhooks", q, start, err)
+	return result, err
+}
+
+func (d *DAL) DeleteWebhooks(q interface{}) (int64, error) {
+	start := d.now()
+	result, err := d.dal.DeleteWebhooks(q)
+	d.observe("DeleteWebhooks", q, start, err)
+	return result, err
+}
+
+func (d *DAL) CreateWebhookDelivery(w *persistence.WebhookDelivery) error {
+	start := d.now()
+	err := d.dal.CreateWebhookDelivery(w)
+	d.observe("CreateWebhookDelivery", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindWebhookDeliveries(q interface{}) ([]persistence.WebhookDelivery, error) {
+	start := d.now()
+	result, err := d.dal.FindWebhookDeliveries(q)
+	d.observe("FindWebhookDeliveries", q, start, err)
+	return result, err
+}
+
+func (d *DAL) UpdateWebhookDelivery(w *persistence.WebhookDelivery) error {
+	start := d.now()
+	err := d.dal.UpdateWebhookDelivery(w)
+	d.observe("UpdateWebhookDelivery", nil, start, err)
+	return err
+}
+
+func (d *DAL) DeleteWebhookDeliveries(q interface{}) (int64, error) {
+	start := d.now()
+	result, err := d.dal.DeleteWebhookDeliveries(q)
+	d.observe("DeleteWebhookDeliveries", q, start, err)
+	return result, err
+}
+
+func (d *DAL) CreateAccountDomain(a *persistence.AccountDomain) error {
+	start := d.now()
+	err := d.dal.CreateAccountDomain(a)
+	d.observe("CreateAccountDomain", nil, start, err)
+	return err
+}
+
+func (d *DAL) FindAccountDomains(q interface{}) ([]persistence.AccountDomain, error) {
+	start := d.now()
+	result, err := d.dal.FindAccountDomains(q)
+	d.observe("FindAccountDomains", q, start, err)
+	return result, err
+}
+
+func (d *DAL) UpdateAccountDomain(a *persistence.AccountDomain) error {
+	start := d.now()
+	err := d.dal.UpdateAccountDomain(a)
+	d.observe("UpdateAccountDomain", nil, start, err)
+	return err
+}
+
+func (d *DAL) DeleteAccountDomains(q interface{}) (int64, error) {
+	start := d.now()
+	result, err := d.dal.DeleteAccountDomains(q)
+	d.observe("DeleteAccountDomains", q, start, err)
+	return result, err
+}
+
+func (d *DAL) DumpAll() (*persistence.Snapshot, error) {
+	start := d.now()
+	result, err := d.dal.DumpAll()
+	d.observe("DumpAll", nil, start, err)
+	return result, err
+}
+
+func (d *DAL) DumpAllWithoutEvents() (*persistence.Snapshot, error) {
+	start := d.now()
+	result, err := d.dal.DumpAllWithoutEvents()
+	d.observe("DumpAllWithoutEvents", nil, start, err)
+	return result, err
+}
+
+func (d *DAL) RestoreAll(s *persistence.Snapshot) error {
+	start := d.now()
+	err := d.dal.RestoreAll(s)
+	d.observe("RestoreAll", nil, start, err)
+	return err
+}
+
+func (d *DAL) ApplyMigrations() error {
+	start := d.now()
+	err := d.dal.ApplyMigrations()
+	d.observe("ApplyMigrations", nil, start, err)
+	return err
+}
+
+func (d *DAL) DropAll() error {
+	start := d.now()
+	err := d.dal.DropAll()
+	d.observe("DropAll", nil, start, err)
+	return err
+}
+
+func (d *DAL) Ping() error {
+	start := d.now()
+	err := d.dal.Ping()
+	d.observe("Ping", nil, start, err)
+	return err
+}
@@ -0,0 +1,201 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+)
+
+// DefaultInvitationExpiry is the duration invitations can be accepted for
+// in case no other value is configured.
+const DefaultInvitationExpiry = time.Hour * 24 * 7
+
+// WithInvitationExpiry sets the duration invitations can be accepted for
+// after they have been sent.
+func WithInvitationExpiry(d time.Duration) Config {
+	return func(p *persistenceLayer) {
+		p.invitationExpiry = d
+	}
+}
+
+func (p *persistenceLayer) getInvitationExpiry() time.Duration {
+	if p.invitationExpiry <= 0 {
+		return DefaultInvitationExpiry
+	}
+	return p.invitationExpiry
+}
+
+func newInvitation(accountUserID, invitedBy string, expiry time.Duration) (*Invitation, error) {
+	invitationID, err := NewULID()
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error creating invitation id: %w", err)
+	}
+	now := time.Now()
+	return &Invitation{
+		InvitationID:  invitationID,
+		AccountUserID: accountUserID,
+		InvitedBy:     invitedBy,
+		Created:       now,
+		Expires:       now.Add(expiry),
+	}, nil
+}
+
+// pendingInvitation looks up the given invitation and all of its
+// relationships that have not been accepted yet. Invitations that have been
+// accepted entirely are considered unknown.
+func (p *persistenceLayer) pendingInvitation(invitationID string) (Invitation, []AccountUserRelationship, error) {
+	invitation, err := p.dal.FindInvitation(FindInvitationQueryByID(invitationID))
+	if err != nil {
+		return invitation, nil, fmt.Errorf("persistence: error looking up invitation: %w", err)
+	}
+	relationships, err := p.dal.FindAccountUserRelationships(FindAccountUserRelationshipsQueryByInvitationID(invitationID))
+	if err != nil {
+		return invitation, nil, fmt.Errorf("persistence: error looking up relationships for invitation: %w", err)
+	}
+	var pending []AccountUserRelationship
+	for _, relationship := range relationships {
+		if relationship.PasswordEncryptedKeyEncryptionKey == "" {
+			pending = append(pending, relationship)
+		}
+	}
+	if len(pending) == 0 {
+		return invitation, nil, ErrUnknownInvitation(fmt.Sprintf("persistence: invitation %s has already been accepted", invitationID))
+	}
+	return invitation, pending, nil
+}
+
+func (p *persistenceLayer) LookupInvitation(invitationID string) (InvitationResult, error) {
+	invitation, pending, err := p.pendingInvitation(invitationID)
+	if err != nil {
+		return InvitationResult{}, err
+	}
+	result := InvitationResult{
+		InvitationID: invitation.InvitationID,
+		Expires:      invitation.Expires,
+	}
+	for _, relationship := range pending {
+		result.AccountIDs = append(result.AccountIDs, relationship.AccountID)
+	}
+	return result, nil
+}
+
+// ResendInvitation extends the expiry of the given invitation. As email
+// addresses are only stored as hashes, callers need to pass the address of
+// the invitee which is checked against the invitation.
+func (p *persistenceLayer) ResendInvitation(invitationID, inviteeEmailAddress, accountUserID string) (InvitationResult, error) {
+	invitation, pending, err := p.pendingInvitation(invitationID)
+	if err != nil {
+		return InvitationResult{}, err
+	}
+	invitee, err := p.dal.FindAccountUser(FindAccountUserQueryByAccountUserIDIncludeRelationships(invitation.AccountUserID))
+	if err != nil {
+		return InvitationResult{}, fmt.Errorf("persistence: error looking up invitee: %w", err)
+	}
+	if err := keys.CompareString(inviteeEmailAddress, invitee.HashedEmail); err != nil {
+		return InvitationResult{}, ErrUnknownInvitation(fmt.Sprintf("persistence: invitation %s was not sent to the given email address", invitationID))
+	}
+
+	result := InvitationResult{
+		InvitationID:           invitation.InvitationID,
+		UserExistsWithPassword: invitee.HashedPassword != "",
+	}
+	for _, relationship := range pending {
+		account, err := p.dal.FindAccount(FindAccountQueryByID(relationship.AccountID))
+		if err != nil {
+			return InvitationResult{}, fmt.Errorf("persistence: error looking up account %s: %w", relationship.AccountID, err)
+		}
+		result.AccountIDs = append(result.AccountIDs, account.AccountID)
+		result.AccountNames = append(result.AccountNames, account.Name)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return InvitationResult{}, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	invitation.Expires = time.Now().Add(p.getInvitationExpiry())
+	if err := txn.UpdateInvitation(&invitation); err != nil {
+		txn.Rollback()
+		return InvitationResult{}, fmt.Errorf("persistence: error updating invitation: %w", err)
+	}
+	if err := writeAuditLog(txn, result.AccountIDs, accountUserID, AuditActionResendInvite, invitationID); err != nil {
+		txn.Rollback()
+		return InvitationResult{}, fmt.Errorf("persistence: error recording invitation resend: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return InvitationResult{}, fmt.Errorf("persistence: error committing invitation update: %w", err)
+	}
+	result.Expires = invitation.Expires
+	return result, nil
+}
+
+// RevokeInvitation removes the given invitation and all relationships it
+// created that have not been accepted yet.
+func (p *persistenceLayer) RevokeInvitation(invitationID, accountUserID string) error {
+	_, pending, err := p.pendingInvitation(invitationID)
+	if err != nil {
+		return err
+	}
+	var accountIDs []string
+	for _, relationship := range pending {
+		accountIDs = append(accountIDs, relationship.AccountID)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	if err := txn.DeleteAccountUserRelationships(DeleteAccountUserRelationshipsQueryPendingByInvitationID(invitationID)); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error deleting relationships of invitation: %w", err)
+	}
+	if _, err := txn.DeleteInvitations(DeleteInvitationsQueryByID(invitationID)); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error deleting invitation: %w", err)
+	}
+	if err := writeAuditLog(txn, accountIDs, accountUserID, AuditActionRevokeInvite, invitationID); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording invitation revocation: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing invitation revocation: %w", err)
+	}
+	return nil
+}
+
+// acceptableRelationships removes all relationships from the given list that
+// have been created by invitations which have expired or have been revoked.
+// Relationships that have been accepted before or that have been created
+// before invitations were tracked are always kept.
+func (p *persistenceLayer) acceptableRelationships(relationships []AccountUserRelationship) ([]AccountUserRelationship, error) {
+	now := time.Now()
+	valid := map[string]bool{}
+	var result []AccountUserRelationship
+	for _, relationship := range relationships {
+		if relationship.PasswordEncryptedKeyEncryptionKey != "" || relationship.InvitationID == "" {
+			result = append(result, relationship)
+			continue
+		}
+		ok, known := valid[relationship.InvitationID]
+		if !known {
+			invitation, err := p.dal.FindInvitation(FindInvitationQueryByID(relationship.InvitationID))
+			if err != nil {
+				var unknownErr ErrUnknownInvitation
+				if !errors.As(err, &unknownErr) {
+					return nil, fmt.Errorf("persistence: error looking up invitation: %w", err)
+				}
+			} else {
+				ok = invitation.Expires.After(now)
+			}
+			valid[relationship.InvitationID] = ok
+		}
+		if ok {
+			result = append(result, relationship)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockInvitationDatabase struct {
+	DataAccessLayer
+	invitations   map[string]Invitation
+	relationships []AccountUserRelationship
+	accountUser   AccountUser
+	deleted       []interface{}
+	updated       []Invitation
+}
+
+func (m *mockInvitationDatabase) FindInvitation(q interface{}) (Invitation, error) {
+	if invitation, ok := m.invitations[string(q.(FindInvitationQueryByID))]; ok {
+		return invitation, nil
+	}
+	return Invitation{}, ErrUnknownInvitation("unknown")
+}
+
+func (m *mockInvitationDatabase) UpdateInvitation(i *Invitation) error {
+	m.updated = append(m.updated, *i)
+	return nil
+}
+
+func (m *mockInvitationDatabase) DeleteInvitations(q interface{}) (int64, error) {
+	m.deleted = append(m.deleted, q)
+	return 1, nil
+}
+
+func (m *mockInvitationDatabase) FindAccountUserRelationships(q interface{}) ([]AccountUserRelationship, error) {
+	var result []AccountUserRelationship
+	for _, relationship := range m.relationships {
+		if relationship.InvitationID == string(q.(FindAccountUserRelationshipsQueryByInvitationID)) {
+			result = append(result, relationship)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockInvitationDatabase) DeleteAccountUserRelationships(q interface{}) error {
+	m.deleted = append(m.deleted, q)
+	return nil
+}
+
+func (m *mockInvitationDatabase) FindAccountUser(interface{}) (AccountUser, error) {
+	return m.accountUser, nil
+}
+
+func (m *mockInvitationDatabase) FindAccount(q interface{}) (Account, error) {
+	return Account{AccountID: string(q.(FindAccountQueryByID)), Name: "name"}, nil
+}
+
+func (m *mockInvitationDatabase) CreateAuditLogEntry(*AuditLogEntry) error {
+	return nil
+}
+
+func (m *mockInvitationDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func (m *mockInvitationDatabase) Commit() error {
+	return nil
+}
+
+func (m *mockInvitationDatabase) Rollback() error {
+	return nil
+}
+
+func newMockInvitationDatabase() *mockInvitationDatabase {
+	invitee, _ := newAccountUser("invitee@offen.dev", "", 0)
+	return &mockInvitationDatabase{
+		invitations: map[string]Invitation{
+			"invitation-a": {InvitationID: "invitation-a", Expires: time.Now().Add(time.Hour)},
+			"invitation-b": {InvitationID: "invitation-b", Expires: time.Now().Add(-time.Hour)},
+			"invitation-c": {InvitationID: "invitation-c", Expires: time.Now().Add(time.Hour)},
+		},
+		relationships: []AccountUserRelationship{
+			{AccountID: "account-a", InvitationID: "invitation-a"},
+			{AccountID: "account-b", InvitationID: "invitation-b"},
+			{AccountID: "account-c", InvitationID: "invitation-c", PasswordEncryptedKeyEncryptionKey: "key"},
+			{AccountID: "account-d", InvitationID: "invitation-z"},
+			{AccountID: "account-e"},
+		},
+		accountUser: *invitee,
+	}
+}
+
+func TestPersistenceLayer_LookupInvitation(t *testing.T) {
+	p := &persistenceLayer{dal: newMockInvitationDatabase()}
+	result, err := p.LookupInvitation("invitation-a")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(result.AccountIDs) != 1 || result.AccountIDs[0] != "account-a" {
+		t.Errorf("Unexpected result %v", result)
+	}
+
+	var unknownErr ErrUnknownInvitation
+	if _, err := p.LookupInvitation("invitation-c"); !errors.As(err, &unknownErr) {
+		t.Errorf("Expected accepted invitation to be unknown, got %v", err)
+	}
+	if _, err := p.LookupInvitation("invitation-z"); !errors.As(err, &unknownErr) {
+		t.Errorf("Expected unknown invitation error, got %v", err)
+	}
+}
+
+func TestPersistenceLayer_ResendInvitation(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		db := newMockInvitationDatabase()
+		p := &persistenceLayer{dal: db, invitationExpiry: time.Hour * 48}
+		result, err := p.ResendInvitation("invitation-b", "invitee@offen.dev", "user-a")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if result.UserExistsWithPassword || len(result.AccountNames) != 1 {
+			t.Errorf("Unexpected result %v", result)
+		}
+		if len(db.updated) != 1 || db.updated[0].Expires.Before(time.Now().Add(time.Hour*47)) {
+			t.Errorf("Expected expiry to be extended, got %v", db.updated)
+		}
+	})
+	t.Run("other invitee", func(t *testing.T) {
+		db := newMockInvitationDatabase()
+		p := &persistenceLayer{dal: db}
+		_, err := p.ResendInvitation("invitation-a", "other@offen.dev", "user-a")
+		var unknownErr ErrUnknownInvitation
+		if !errors.As(err, &unknownErr) {
+			t.Errorf("Expected unknown invitation error, got %v", err)
+		}
+		if len(db.updated) != 0 {
+			t.Errorf("Unexpected update %v", db.updated)
+		}
+	})
+}
+
+func TestPersistenceLayer_RevokeInvitation(t *testing.T) {
+	db := newMockInvitationDatabase()
+	p := &persistenceLayer{dal: db}
+	if err := p.RevokeInvitation("invitation-a", "user-a"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(db.deleted) != 2 {
+		t.Errorf("Unexpected deletions %v", db.deleted)
+	}
+}
+
+func TestPersistenceLayer_acceptableRelationships(t *testing.T) {
+	db := newMockInvitationDatabase()
+	p := &persistenceLayer{dal: db}
+	result, err := p.acceptableRelationships(db.relationships)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	var accountIDs []string
+	for _, relationship := range result {
+		accountIDs = append(accountIDs, relationship.AccountID)
+	}
+	if len(accountIDs) != 3 || accountIDs[0] != "account-a" || accountIDs[1] != "account-c" || accountIDs[2] != "account-e" {
+		t.Errorf("Unexpected relationships %v", accountIDs)
+	}
+}
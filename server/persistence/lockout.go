@@ -0,0 +1,137 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"time"
+)
+
+// Lockout defines how account users are protected against brute forcing
+// their password. Once an account user has failed to log in Threshold times
+// in a row, logins are refused for Duration. Each further failed attempt
+// after a lockout has expired doubles the duration, up to MaxDuration. A
+// Threshold of zero disables lockouts.
+type Lockout struct {
+	Threshold   int
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// DefaultLockout is used when no lockout has been configured.
+var DefaultLockout = Lockout{
+	Threshold:   5,
+	Duration:    time.Minute,
+	MaxDuration: time.Hour * 24,
+}
+
+// WithLockout sets the lockout that is applied to account users failing
+// to log in.
+func WithLockout(l Lockout) Config {
+	return func(p *persistenceLayer) {
+		p.lockout = &l
+	}
+}
+
+func (p *persistenceLayer) getLockout() Lockout {
+	if p.lockout == nil {
+		return DefaultLockout
+	}
+	return *p.lockout
+}
+
+// duration returns the duration an account user is locked out for after
+// failing to log in the given number of times in a row.
+func (l Lockout) duration(failures int) time.Duration {
+	if l.Threshold <= 0 || failures < l.Threshold {
+		return 0
+	}
+	delay := l.Duration
+	for i := l.Threshold; i < failures; i++ {
+		delay *= 2
+		if l.MaxDuration > 0 && delay >= l.MaxDuration {
+			return l.MaxDuration
+		}
+	}
+	if l.MaxDuration > 0 && delay > l.MaxDuration {
+		return l.MaxDuration
+	}
+	return delay
+}
+
+// checkLockout returns an error in case the given account user is not
+// allowed to log in at the given time.
+func checkLockout(accountUser *AccountUser, now time.Time) error {
+	if accountUser.LockedUntil.After(now) {
+		return ErrAccountUserLocked{Until: accountUser.LockedUntil}
+	}
+	return nil
+}
+
+// recordFailedLogin counts a failed login attempt of the given account user,
+// locking it in case the configured threshold has been reached.
+func (p *persistenceLayer) recordFailedLogin(accountUser *AccountUser, now time.Time) error {
+	accountUser.FailedLogins++
+	duration := p.getLockout().duration(accountUser.FailedLogins)
+	if duration > 0 {
+		accountUser.LockedUntil = now.Add(duration)
+	}
+	if err := p.dal.UpdateAccountUser(accountUser); err != nil {
+		return fmt.Errorf("persistence: error recording failed login: %w", err)
+	}
+	if duration == 0 {
+		return nil
+	}
+	if err := writeAuditLog(p.dal, accountUser.accountIDs(), accountUser.AccountUserID, AuditActionLockAccountUser, ""); err != nil {
+		return fmt.Errorf("persistence: error recording lockout: %w", err)
+	}
+	return ErrAccountUserLocked{Until: accountUser.LockedUntil, Started: true}
+}
+
+// resetFailedLogins clears all failed login attempts of the given account
+// user after it has logged in successfully.
+func (p *persistenceLayer) resetFailedLogins(accountUser *AccountUser) error {
+	if accountUser.FailedLogins == 0 && accountUser.LockedUntil.IsZero() {
+		return nil
+	}
+	accountUser.FailedLogins = 0
+	accountUser.LockedUntil = time.Time{}
+	if err := p.dal.UpdateAccountUser(accountUser); err != nil {
+		return fmt.Errorf("persistence: error resetting failed logins: %w", err)
+	}
+	return nil
+}
+
+// UnlockAccountUser lifts the lockout of a member of the given account, so
+// that it can log in again right away.
+func (p *persistenceLayer) UnlockAccountUser(accountID, targetAccountUserID, accountUserID string) error {
+	relationships, err := p.dal.FindAccountUserRelationships(FindAccountUserRelationshipsQueryByAccountID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account users: %w", err)
+	}
+	var isMember bool
+	for _, r := range relationships {
+		if r.AccountUserID == targetAccountUserID {
+			isMember = true
+			break
+		}
+	}
+	if !isMember {
+		return ErrUnknownAccountUser(
+			fmt.Sprintf("persistence: account user %s is not a member of account %s", targetAccountUserID, accountID),
+		)
+	}
+
+	target, err := p.dal.FindAccountUser(FindAccountUserQueryByAccountUserIDIncludeRelationships(targetAccountUserID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	if err := p.resetFailedLogins(&target); err != nil {
+		return err
+	}
+	if err := writeAuditLog(p.dal, []string{accountID}, accountUserID, AuditActionUnlockAccountUser, targetAccountUserID); err != nil {
+		return fmt.Errorf("persistence: error recording unlock of account user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockout_duration(t *testing.T) {
+	lockout := Lockout{Threshold: 3, Duration: time.Minute, MaxDuration: time.Hour}
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, time.Minute * 2},
+		{6, time.Minute * 8},
+		{9, time.Hour},
+		{200, time.Hour},
+	}
+	for _, test := range tests {
+		if result := lockout.duration(test.failures); result != test.expected {
+			t.Errorf("Expected %v for %d failures, got %v", test.expected, test.failures, result)
+		}
+	}
+	if result := (Lockout{}).duration(100); result != 0 {
+		t.Errorf("Expected disabled lockout, got %v", result)
+	}
+}
+
+type mockLockoutDatabase struct {
+	mockProvisionSSODatabase
+	updated []AccountUser
+}
+
+func (m *mockLockoutDatabase) UpdateAccountUser(u *AccountUser) error {
+	m.updated = append(m.updated, *u)
+	m.accountUsers[0] = *u
+	return nil
+}
+
+func (m *mockLockoutDatabase) FindAccountUser(interface{}) (AccountUser, error) {
+	return m.accountUsers[0], nil
+}
+
+func (m *mockLockoutDatabase) FindAccountUserRelationships(interface{}) ([]AccountUserRelationship, error) {
+	return []AccountUserRelationship{{AccountUserID: m.accountUsers[0].AccountUserID}}, nil
+}
+
+func TestPersistenceLayer_login_Lockout(t *testing.T) {
+	accountUser, err := newAccountUser("user@offen.dev", "secret-password", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	accountUser.Relationships = []AccountUserRelationship{{AccountUserID: accountUser.AccountUserID, AccountID: "account-a"}}
+
+	t.Run("exceeding threshold", func(t *testing.T) {
+		db := &mockLockoutDatabase{
+			mockProvisionSSODatabase: mockProvisionSSODatabase{accountUsers: []AccountUser{*accountUser}},
+		}
+		p := &persistenceLayer{dal: db, lockout: &Lockout{Threshold: 2, Duration: time.Minute}}
+
+		_, err := p.Login("user@offen.dev", "other", "")
+		var lockErr ErrAccountUserLocked
+		if err == nil || errors.As(err, &lockErr) {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		_, err = p.Login("user@offen.dev", "other", "")
+		if !errors.As(err, &lockErr) || !lockErr.Started {
+			t.Fatalf("Expected lockout to be started, got %v", err)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionLockAccountUser {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+
+		// the correct password is not accepted while being locked
+		_, err = p.Login("user@offen.dev", "secret-password", "")
+		if !errors.As(err, &lockErr) || lockErr.Started {
+			t.Errorf("Expected lockout, got %v", err)
+		}
+		if db.accountUsers[0].FailedLogins != 2 {
+			t.Errorf("Unexpected number of failed logins %d", db.accountUsers[0].FailedLogins)
+		}
+	})
+
+	t.Run("unlock", func(t *testing.T) {
+		locked := *accountUser
+		locked.FailedLogins = 7
+		locked.LockedUntil = time.Now().Add(time.Hour)
+		db := &mockLockoutDatabase{
+			mockProvisionSSODatabase: mockProvisionSSODatabase{accountUsers: []AccountUser{locked}},
+		}
+		p := &persistenceLayer{dal: db}
+
+		if err := p.UnlockAccountUser("account-a", "other-user", "admin-user"); err == nil {
+			t.Error("Expected error for non-member, got nil")
+		}
+		if err := p.UnlockAccountUser("account-a", locked.AccountUserID, "admin-user"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if db.accountUsers[0].FailedLogins != 0 || !db.accountUsers[0].LockedUntil.IsZero() {
+			t.Errorf("Expected lockout to be lifted, got %v", db.accountUsers[0])
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionUnlockAccountUser {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+}
@@ -15,40 +15,250 @@ import (
 	"github.com/offen/offen/server/keys"
 )
 
-func (p *persistenceLayer) LoginSSO(email, salt string) (LoginResult, error) {
+// SSOGrant gives an account user provisioned on their first SSO login access
+// to the given account.
+type SSOGrant struct {
+	AccountID string
+	Admin     bool
+}
+
+// SSOProvisioning describes which accounts an account user that logs in
+// using SSO for the first time is given access to. As the keys for accessing
+// an account can only be obtained from an existing account user, Sponsor
+// is expected to be the email of an account user that has logged in using SSO
+// before and has access to all accounts that are granted.
+type SSOProvisioning struct {
+	Sponsor string
+	Grants  []SSOGrant
+}
+
+func ssoPassword(email, salt string) string {
 	sha512Hash := sha512.New()
 	sha512Hash.Write([]byte(email))
 	sha512Hash.Write([]byte(salt))
-	dummyPassword := base64.URLEncoding.EncodeToString(sha512Hash.Sum(nil))
+	return base64.URLEncoding.EncodeToString(sha512Hash.Sum(nil))
+}
+
+func (p *persistenceLayer) LoginSSO(email, salt string, provisioning SSOProvisioning, previousSalts ...string) (LoginResult, error) {
+	dummyPassword := ssoPassword(email, salt)
 	_, err := p.findAccountUser(email, false, false)
 	switch {
 	case errors.Is(err, ErrAccountUserNotFound):
+		if len(provisioning.Grants) != 0 {
+			if err := p.provisionSSO(email, salt, provisioning); err != nil {
+				return LoginResult{}, fmt.Errorf("persistence: error provisioning account user: %w", err)
+			}
+		}
 		err = p.Join(email, dummyPassword)
 		if err != nil {
 			return LoginResult{}, fmt.Errorf("persistence: error joining account: %w", err)
 		}
 	case err != nil:
 		return LoginResult{}, fmt.Errorf("persistence: error looking up account user: %w", err)
+	default:
+		if err := p.migrateSSOPassword(email, salt, previousSalts); err != nil {
+			return LoginResult{}, fmt.Errorf("persistence: error migrating account user: %w", err)
+		}
 	}
 
-	return p.Login(email, dummyPassword)
+	return p.login(email, dummyPassword, "", true)
 }
 
-func (p *persistenceLayer) Login(email, password string) (LoginResult, error) {
+// migrateSSOPassword updates the password of an account user that logs in
+// using SSO in case it has been derived using a previous secret of the
+// instance, i.e. the secret has been rotated since the last login.
+func (p *persistenceLayer) migrateSSOPassword(email, salt string, previousSalts []string) error {
+	if len(previousSalts) == 0 {
+		return nil
+	}
+	accountUser, err := p.findAccountUser(email, true, false)
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	password := ssoPassword(email, salt)
+	if keys.CompareString(password, accountUser.HashedPassword) == nil {
+		return nil
+	}
+
+	for _, previousSalt := range previousSalts {
+		previousPassword := ssoPassword(email, previousSalt)
+		if keys.CompareString(previousPassword, accountUser.HashedPassword) != nil {
+			continue
+		}
+		hashedPassword, err := keys.HashString(password)
+		if err != nil {
+			return fmt.Errorf("persistence: error hashing password: %w", err)
+		}
+		accountUser.HashedPassword = hashedPassword.Marshal()
+		previousKey, err := keys.DeriveKey(previousPassword, accountUser.Salt)
+		if err != nil {
+			return fmt.Errorf("persistence: error deriving key from previous password: %w", err)
+		}
+		for idx, relationship := range accountUser.Relationships {
+			decryptedKey, err := keys.DecryptWith(previousKey, relationship.PasswordEncryptedKeyEncryptionKey)
+			if err != nil {
+				return fmt.Errorf("persistence: error decrypting key using previous password: %w", err)
+			}
+			if err := relationship.addPasswordEncryptedKey(decryptedKey, accountUser.Salt, password); err != nil {
+				return fmt.Errorf("persistence: error updating password encrypted key: %w", err)
+			}
+			accountUser.Relationships[idx] = relationship
+		}
+		if err := p.dal.UpdateAccountUser(accountUser); err != nil {
+			return fmt.Errorf("persistence: error updating account user: %w", err)
+		}
+		return nil
+	}
+	return nil
+}
+
+// provisionSSO creates a new account user for the given email, inviting it
+// to all granted accounts using the keys of the sponsor.
+func (p *persistenceLayer) provisionSSO(email, salt string, provisioning SSOProvisioning) error {
+	if provisioning.Sponsor == "" {
+		return errors.New("persistence: no sponsor given for provisioning account user")
+	}
+	sponsor, err := p.findAccountUser(provisioning.Sponsor, true, false)
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up sponsor: %w", err)
+	}
+	sponsorKey, err := keys.DeriveKey(ssoPassword(provisioning.Sponsor, salt), sponsor.Salt)
+	if err != nil {
+		return fmt.Errorf("persistence: error deriving key for sponsor: %w", err)
+	}
+
+	var adminLevel AccountUserAdminLevel
+	for _, grant := range provisioning.Grants {
+		if grant.Admin {
+			adminLevel = AccountUserAdminLevelSuperAdmin
+		}
+	}
+	accountUser, err := newAccountUser(email, "", adminLevel)
+	if err != nil {
+		return fmt.Errorf("persistence: error creating account user: %w", err)
+	}
+
+	var relationships []*AccountUserRelationship
+	granted := map[string]bool{}
+	for _, grant := range provisioning.Grants {
+		if granted[grant.AccountID] {
+			continue
+		}
+		granted[grant.AccountID] = true
+
+		var sponsorRelationship *AccountUserRelationship
+		for idx := range sponsor.Relationships {
+			if sponsor.Relationships[idx].AccountID == grant.AccountID {
+				sponsorRelationship = &sponsor.Relationships[idx]
+				break
+			}
+		}
+		if sponsorRelationship == nil {
+			return fmt.Errorf("persistence: sponsor has no access to account %s", grant.AccountID)
+		}
+
+		key, err := keys.DecryptWith(sponsorKey, sponsorRelationship.PasswordEncryptedKeyEncryptionKey)
+		if err != nil {
+			return fmt.Errorf("persistence: error decrypting key of sponsor for account %s: %w", grant.AccountID, err)
+		}
+		role := AccountUserRoleEditor
+		if grant.Admin {
+			role = AccountUserRoleAdmin
+		}
+		relationship, err := newAccountUserRelationship(accountUser.AccountUserID, grant.AccountID, role)
+		if err != nil {
+			return fmt.Errorf("persistence: error creating account user relationship: %w", err)
+		}
+		if err := relationship.addEmailEncryptedKey(key, accountUser.Salt, email); err != nil {
+			return fmt.Errorf("persistence: error adding email encrypted key: %w", err)
+		}
+		relationships = append(relationships, relationship)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	if err := txn.CreateAccountUser(accountUser); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error persisting account user: %w", err)
+	}
+	for _, relationship := range relationships {
+		if err := txn.CreateAccountUserRelationship(relationship); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error persisting account user relationship: %w", err)
+		}
+		if err := writeAuditLog(txn, []string{relationship.AccountID}, sponsor.AccountUserID, AuditActionProvisionUser, accountUser.AccountUserID); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error recording provisioning of account user: %w", err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing transaction: %w", err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) Login(email, password, secondFactor string) (LoginResult, error) {
+	return p.login(email, password, secondFactor, false)
+}
+
+// VerifyCredentials checks the credentials of an account user that has
+// already been authenticated, so no second factor is required.
+func (p *persistenceLayer) VerifyCredentials(email, password string) (LoginResult, error) {
+	return p.login(email, password, "", true)
+}
+
+// login checks the given credentials. Second factors are skipped when
+// logging in using SSO, as the identity provider is responsible for
+// authenticating users in this case.
+func (p *persistenceLayer) login(email, password, secondFactor string, skipSecondFactor bool) (LoginResult, error) {
 	accountUser, err := p.findAccountUser(email, true, true)
 	if err != nil {
 		return LoginResult{}, fmt.Errorf("persistence: error looking up account user: %w", err)
 	}
 
+	now := time.Now()
+	if err := checkLockout(accountUser, now); err != nil {
+		return LoginResult{}, err
+	}
+
 	if err := keys.CompareString(password, accountUser.HashedPassword); err != nil {
+		if lockErr := p.recordFailedLogin(accountUser, now); lockErr != nil {
+			return LoginResult{}, lockErr
+		}
 		return LoginResult{}, fmt.Errorf("persistence: error comparing passwords: %w", err)
 	}
 
+	if !skipSecondFactor {
+		if err := p.checkSecondFactor(accountUser, secondFactor); err != nil {
+			// guessing the second factor counts as a failed login, asking for
+			// it does not
+			if errors.Is(err, ErrInvalidSecondFactor) {
+				if lockErr := p.recordFailedLogin(accountUser, now); lockErr != nil {
+					return LoginResult{}, lockErr
+				}
+			}
+			return LoginResult{}, fmt.Errorf("persistence: error checking second factor: %w", err)
+		}
+	}
+
+	if err := p.resetFailedLogins(accountUser); err != nil {
+		return LoginResult{}, err
+	}
+
 	pwDerivedKey, pwDerivedKeyErr := keys.DeriveKey(password, accountUser.Salt)
 	if pwDerivedKeyErr != nil {
 		return LoginResult{}, fmt.Errorf("persistence: error deriving key from password: %w", pwDerivedKeyErr)
 	}
 
+	// invitations that have expired or have been revoked cannot be accepted
+	// anymore, so their relationships are ignored
+	accountUser.Relationships, err = p.acceptableRelationships(accountUser.Relationships)
+	if err != nil {
+		return LoginResult{}, fmt.Errorf("persistence: error checking invitations: %w", err)
+	}
+
 	// the account user logging in might have pending invitations which we can
 	// populate with proper password encrypted keys now
 	var emailDerivedKey []byte
@@ -82,21 +292,20 @@ func (p *persistenceLayer) Login(email, password string) (LoginResult, error) {
 		if decryptedKeyErr != nil {
 			return LoginResult{}, fmt.Errorf(`persistence: failed decrypting key encryption key for account "%s": %w`, relationship.AccountID, decryptedKeyErr)
 		}
-		k, kErr := jwk.New(decryptedKey)
-		if kErr != nil {
-			return LoginResult{}, kErr
+		// relationships created after a passkey has been registered are
+		// made available to passkey logins once the user logs in using
+		// their password
+		if accountUser.PasskeyKey != "" && relationship.PasskeyEncryptedKeyEncryptionKey == "" {
+			if err := p.addPasskeyEncryptedKey(accountUser, &relationship, decryptedKey); err != nil {
+				return LoginResult{}, fmt.Errorf("persistence: error adding passkey encrypted key: %w", err)
+			}
 		}
-
-		account, err := p.dal.FindAccount(FindAccountQueryByID(relationship.AccountID))
-		if err != nil {
-			return LoginResult{}, fmt.Errorf(`persistence: error looking up account with id "%s": %w`, relationship.AccountID, err)
+		result, err := p.loginAccountResult(relationship, decryptedKey)
+		if errors.Is(err, errRetiredAccount) {
+			continue
 		}
-
-		result := LoginAccountResult{
-			AccountName:      account.Name,
-			AccountID:        relationship.AccountID,
-			Created:          account.Created,
-			KeyEncryptionKey: k,
+		if err != nil {
+			return LoginResult{}, err
 		}
 		results = append(results, result)
 	}
@@ -108,6 +317,34 @@ func (p *persistenceLayer) Login(email, password string) (LoginResult, error) {
 	}, nil
 }
 
+// errRetiredAccount is returned when a login result is requested for a
+// retired account, which must not be accessible anymore.
+var errRetiredAccount = errors.New("persistence: account has been retired")
+
+func (p *persistenceLayer) loginAccountResult(relationship AccountUserRelationship, decryptedKey []byte) (LoginAccountResult, error) {
+	accountID := relationship.AccountID
+	k, err := jwk.New(decryptedKey)
+	if err != nil {
+		return LoginAccountResult{}, err
+	}
+
+	account, err := p.dal.FindAccount(FindAccountQueryByID(accountID))
+	if err != nil {
+		return LoginAccountResult{}, fmt.Errorf(`persistence: error looking up account with id "%s": %w`, accountID, err)
+	}
+	if account.Retired {
+		return LoginAccountResult{}, errRetiredAccount
+	}
+
+	return LoginAccountResult{
+		AccountName:      account.Name,
+		AccountID:        accountID,
+		Role:             relationship.Role,
+		Created:          account.Created,
+		KeyEncryptionKey: k,
+	}, nil
+}
+
 func (p *persistenceLayer) LookupAccountUser(accountUserID string) (LoginResult, error) {
 	accountUser, err := p.dal.FindAccountUser(
 		FindAccountUserQueryByAccountUserIDIncludeRelationships(accountUserID),
@@ -115,14 +352,27 @@ func (p *persistenceLayer) LookupAccountUser(accountUserID string) (LoginResult,
 	if err != nil {
 		return LoginResult{}, fmt.Errorf("persistence: error looking up account user: %w", err)
 	}
+	retiredAccounts, err := p.dal.FindAccounts(FindAccountsQueryRetired{})
+	if err != nil {
+		return LoginResult{}, fmt.Errorf("persistence: error looking up retired accounts: %w", err)
+	}
+	retired := map[string]bool{}
+	for _, account := range retiredAccounts {
+		retired[account.AccountID] = true
+	}
+
 	result := LoginResult{
 		AccountUserID: accountUser.AccountUserID,
 		AdminLevel:    accountUser.AdminLevel,
 		Accounts:      []LoginAccountResult{},
 	}
 	for _, relationship := range accountUser.Relationships {
+		if retired[relationship.AccountID] {
+			continue
+		}
 		result.Accounts = append(result.Accounts, LoginAccountResult{
 			AccountID: relationship.AccountID,
+			Role:      relationship.Role,
 		})
 	}
 	return result, nil
@@ -167,6 +417,14 @@ func (p *persistenceLayer) ChangePassword(userID, currentPassword, changedPasswo
 	if err := p.dal.UpdateAccountUser(&accountUser); err != nil {
 		return fmt.Errorf("persistence: error updating password for user: %w", err)
 	}
+	// sessions might have been established by someone knowing the previous
+	// password, so all of them are revoked
+	if err := p.sessions.DeleteByAccountUser(accountUser.AccountUserID); err != nil {
+		return fmt.Errorf("persistence: error revoking sessions: %w", err)
+	}
+	if err := writeAuditLog(p.dal, accountUser.accountIDs(), accountUser.AccountUserID, AuditActionChangePassword, ""); err != nil {
+		return fmt.Errorf("persistence: error recording password change: %w", err)
+	}
 	return nil
 }
 
@@ -196,9 +454,25 @@ func (p *persistenceLayer) ResetPassword(emailAddress, password string, oneTimeK
 		return fmt.Errorf("persistence: error hashing password: %w", hashErr)
 	}
 	accountUser.HashedPassword = passwordHash.Marshal()
-	if err := p.dal.UpdateAccountUser(accountUser); err != nil {
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	if err := txn.UpdateAccountUser(accountUser); err != nil {
+		txn.Rollback()
 		return fmt.Errorf("persistence: error updating password on account user: %w", err)
 	}
+	if err := writeAuditLog(txn, accountUser.accountIDs(), accountUser.AccountUserID, AuditActionResetPassword, ""); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording password reset: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing password reset: %w", err)
+	}
+	if err := p.sessions.DeleteByAccountUser(accountUser.AccountUserID); err != nil {
+		return fmt.Errorf("persistence: error revoking sessions: %w", err)
+	}
 	return nil
 }
 
@@ -249,6 +523,9 @@ func (p *persistenceLayer) ChangeEmail(userID, newEmailAddress, currentEmailAddr
 	if err := p.dal.UpdateAccountUser(accountUser); err != nil {
 		return fmt.Errorf("persistence: error updating hashed email on account user: %w", err)
 	}
+	if err := writeAuditLog(p.dal, accountUser.accountIDs(), accountUser.AccountUserID, AuditActionChangeEmail, ""); err != nil {
+		return fmt.Errorf("persistence: error recording email change: %w", err)
+	}
 	return nil
 }
 
@@ -0,0 +1,131 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"testing"
+
+	"github.com/offen/offen/server/keys"
+)
+
+type mockProvisionSSODatabase struct {
+	DataAccessLayer
+	accountUsers  []AccountUser
+	created       []*AccountUser
+	relationships []*AccountUserRelationship
+	auditLog      []*AuditLogEntry
+}
+
+func (m *mockProvisionSSODatabase) FindAccountUsers(interface{}) ([]AccountUser, error) {
+	return m.accountUsers, nil
+}
+
+func (m *mockProvisionSSODatabase) CreateAccountUser(u *AccountUser) error {
+	m.created = append(m.created, u)
+	return nil
+}
+
+func (m *mockProvisionSSODatabase) CreateAccountUserRelationship(r *AccountUserRelationship) error {
+	m.relationships = append(m.relationships, r)
+	return nil
+}
+
+func (m *mockProvisionSSODatabase) CreateAuditLogEntry(e *AuditLogEntry) error {
+	m.auditLog = append(m.auditLog, e)
+	return nil
+}
+
+func (m *mockProvisionSSODatabase) Commit() error {
+	return nil
+}
+
+func (m *mockProvisionSSODatabase) Rollback() error {
+	return nil
+}
+
+func (m *mockProvisionSSODatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func mockSSOSponsor(t *testing.T, email, salt string, accountIDs ...string) AccountUser {
+	sponsor, err := newAccountUser(email, ssoPassword(email, salt), AccountUserAdminLevelSuperAdmin)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for _, accountID := range accountIDs {
+		key, _ := keys.GenerateRandomBytes(keys.DefaultEncryptionKeySize)
+		relationship, _ := newAccountUserRelationship(sponsor.AccountUserID, accountID, AccountUserRoleAdmin)
+		if err := relationship.addPasswordEncryptedKey(key, sponsor.Salt, ssoPassword(email, salt)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		sponsor.Relationships = append(sponsor.Relationships, *relationship)
+	}
+	return *sponsor
+}
+
+func TestPersistenceLayer_provisionSSO(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		db := &mockProvisionSSODatabase{
+			accountUsers: []AccountUser{
+				mockSSOSponsor(t, "sponsor@offen.dev", "salt", "account-a", "account-b"),
+			},
+		}
+		p := &persistenceLayer{dal: db}
+		if err := p.provisionSSO("user@offen.dev", "salt", SSOProvisioning{
+			Sponsor: "sponsor@offen.dev",
+			Grants: []SSOGrant{
+				{AccountID: "account-a"},
+				{AccountID: "account-a", Admin: true},
+			},
+		}); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(db.created) != 1 || db.created[0].AdminLevel != AccountUserAdminLevelSuperAdmin {
+			t.Errorf("Unexpected account users %v", db.created)
+		}
+		if len(db.relationships) != 1 || db.relationships[0].AccountID != "account-a" {
+			t.Fatalf("Unexpected relationships %v", db.relationships)
+		}
+		if db.relationships[0].EmailEncryptedKeyEncryptionKey == "" || db.relationships[0].PasswordEncryptedKeyEncryptionKey != "" {
+			t.Errorf("Expected relationship to be pending invitation, got %v", db.relationships[0])
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionProvisionUser {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+	t.Run("sponsor without access", func(t *testing.T) {
+		db := &mockProvisionSSODatabase{
+			accountUsers: []AccountUser{
+				mockSSOSponsor(t, "sponsor@offen.dev", "salt", "account-b"),
+			},
+		}
+		p := &persistenceLayer{dal: db}
+		if err := p.provisionSSO("user@offen.dev", "salt", SSOProvisioning{
+			Sponsor: "sponsor@offen.dev",
+			Grants:  []SSOGrant{{AccountID: "account-a"}},
+		}); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if len(db.created) != 0 {
+			t.Errorf("Unexpected account users %v", db.created)
+		}
+	})
+	t.Run("unknown sponsor", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockProvisionSSODatabase{}}
+		if err := p.provisionSSO("user@offen.dev", "salt", SSOProvisioning{
+			Sponsor: "sponsor@offen.dev",
+			Grants:  []SSOGrant{{AccountID: "account-a"}},
+		}); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("no sponsor", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockProvisionSSODatabase{}}
+		if err := p.provisionSSO("user@offen.dev", "salt", SSOProvisioning{
+			Grants: []SSOGrant{{AccountID: "account-a"}},
+		}); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
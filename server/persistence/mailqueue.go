@@ -0,0 +1,142 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/mailer"
+)
+
+const (
+	mailDeliveryBatchSize  = 50
+	deliveryRetryBaseDelay = time.Minute
+	deliveryRetryMaxDelay  = time.Hour * 6
+)
+
+// deliveryRetryDelay returns the time to wait before retrying delivery of a
+// mail or webhook that has been attempted the given number of times. The delay doubles
+// with each attempt.
+func deliveryRetryDelay(attempts int) time.Duration {
+	delay := deliveryRetryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= deliveryRetryMaxDelay {
+			return deliveryRetryMaxDelay
+		}
+	}
+	return delay
+}
+
+func (p *persistenceLayer) EnqueueMail(from, to, subject, body string) error {
+	mailID, err := NewULID()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating mail id: %w", err)
+	}
+	now := time.Now()
+	if err := p.dal.CreateQueuedMail(&QueuedMail{
+		MailID:      mailID,
+		From:        from,
+		To:          to,
+		Subject:     subject,
+		Body:        body,
+		NextAttempt: now,
+		Created:     now,
+	}); err != nil {
+		return fmt.Errorf("persistence: error queueing mail: %w", err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) DeliverQueuedMails(m mailer.Mailer, maxAttempts int) (int, error) {
+	now := time.Now()
+	mails, err := p.dal.FindQueuedMails(FindQueuedMailsQueryDue{Before: now, Limit: mailDeliveryBatchSize})
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error looking up due mails: %w", err)
+	}
+
+	var delivered int
+	for _, mail := range mails {
+		// the next attempt is scheduled before sending so that a crash while
+		// sending causes the mail to be retried instead of being lost
+		mail.Attempts++
+		mail.NextAttempt = now.Add(deliveryRetryDelay(mail.Attempts))
+		if err := p.dal.UpdateQueuedMail(&mail); err != nil {
+			return delivered, fmt.Errorf("persistence: error scheduling next attempt for mail %s: %w", mail.MailID, err)
+		}
+
+		if sendErr := m.Send(mail.From, mail.To, mail.Subject, mail.Body); sendErr != nil {
+			mail.LastError = sendErr.Error()
+			mail.Failed = !mailer.IsTemporary(sendErr) || mail.Attempts >= maxAttempts
+			if err := p.dal.UpdateQueuedMail(&mail); err != nil {
+				return delivered, fmt.Errorf("persistence: error recording failed attempt for mail %s: %w", mail.MailID, err)
+			}
+			continue
+		}
+
+		if _, err := p.dal.DeleteQueuedMails(DeleteQueuedMailsQueryByID(mail.MailID)); err != nil {
+			return delivered, fmt.Errorf("persistence: error deleting delivered mail %s: %w", mail.MailID, err)
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+func (p *persistenceLayer) ListFailedMails() ([]QueuedMailResult, error) {
+	mails, err := p.dal.FindQueuedMails(FindQueuedMailsQueryFailed{})
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up failed mails: %w", err)
+	}
+	result := []QueuedMailResult{}
+	for _, mail := range mails {
+		result = append(result, mail.export())
+	}
+	return result, nil
+}
+
+func (p *persistenceLayer) RequeueMail(mailID string) error {
+	mails, err := p.dal.FindQueuedMails(FindQueuedMailsQueryByID(mailID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up mail: %w", err)
+	}
+	if len(mails) == 0 || !mails[0].Failed {
+		return ErrUnknownMail(fmt.Sprintf("persistence: no failed mail with id %s", mailID))
+	}
+	mail := mails[0]
+	mail.Failed = false
+	mail.Attempts = 0
+	mail.NextAttempt = time.Now()
+	if err := p.dal.UpdateQueuedMail(&mail); err != nil {
+		return fmt.Errorf("persistence: error requeueing mail: %w", err)
+	}
+	return nil
+}
+
+// ExpireMails deletes all queued mails that have been created before the
+// given retention period. Bodies of mails contain links with tokens for
+// logging in or accepting invitations, so mails that could not be delivered
+// are not kept around any longer than these links are useful.
+func (p *persistenceLayer) ExpireMails(retention time.Duration) (int, error) {
+	affected, err := p.dal.DeleteQueuedMails(
+		DeleteQueuedMailsQueryCreatedBefore(time.Now().Add(-retention)),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error expiring queued mails: %w", err)
+	}
+	return int(affected), nil
+}
+
+func (q *QueuedMail) export() QueuedMailResult {
+	return QueuedMailResult{
+		MailID:      q.MailID,
+		To:          q.To,
+		Subject:     q.Subject,
+		Attempts:    q.Attempts,
+		LastError:   q.LastError,
+		Failed:      q.Failed,
+		NextAttempt: q.NextAttempt,
+		Created:     q.Created,
+	}
+}
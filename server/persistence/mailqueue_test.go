@@ -0,0 +1,189 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/mailer"
+)
+
+type mockMailQueueDatabase struct {
+	DataAccessLayer
+	mails   map[string]QueuedMail
+	deleted []string
+}
+
+func (m *mockMailQueueDatabase) CreateQueuedMail(q *QueuedMail) error {
+	m.mails[q.MailID] = *q
+	return nil
+}
+
+func (m *mockMailQueueDatabase) FindQueuedMails(q interface{}) ([]QueuedMail, error) {
+	var result []QueuedMail
+	switch query := q.(type) {
+	case FindQueuedMailsQueryDue:
+		for _, mail := range m.mails {
+			if !mail.Failed && !mail.NextAttempt.After(query.Before) {
+				result = append(result, mail)
+			}
+		}
+	case FindQueuedMailsQueryFailed:
+		for _, mail := range m.mails {
+			if mail.Failed {
+				result = append(result, mail)
+			}
+		}
+	case FindQueuedMailsQueryByID:
+		if mail, ok := m.mails[string(query)]; ok {
+			result = append(result, mail)
+		}
+	default:
+		return nil, ErrBadQuery
+	}
+	return result, nil
+}
+
+func (m *mockMailQueueDatabase) UpdateQueuedMail(q *QueuedMail) error {
+	m.mails[q.MailID] = *q
+	return nil
+}
+
+func (m *mockMailQueueDatabase) DeleteQueuedMails(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case DeleteQueuedMailsQueryByID:
+		m.deleted = append(m.deleted, string(query))
+		delete(m.mails, string(query))
+		return 1, nil
+	case DeleteQueuedMailsQueryCreatedBefore:
+		var affected int64
+		for mailID, mail := range m.mails {
+			if mail.Created.Before(time.Time(query)) {
+				m.deleted = append(m.deleted, mailID)
+				delete(m.mails, mailID)
+				affected++
+			}
+		}
+		return affected, nil
+	default:
+		return 0, ErrBadQuery
+	}
+}
+
+type mockMailer struct {
+	errs map[string]error
+	sent []string
+}
+
+func (m *mockMailer) Send(from, to, subject, body string) error {
+	if err, ok := m.errs[to]; ok {
+		return err
+	}
+	m.sent = append(m.sent, to)
+	return nil
+}
+
+func TestPersistenceLayer_DeliverQueuedMails(t *testing.T) {
+	db := &mockMailQueueDatabase{mails: map[string]QueuedMail{}}
+	p := &persistenceLayer{dal: db}
+	for _, to := range []string{"ok@offen.dev", "temporary@offen.dev", "rejected@offen.dev", "exhausted@offen.dev"} {
+		if err := p.EnqueueMail("no-reply@offen.dev", to, "subject", "body"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	for id, mail := range db.mails {
+		if mail.To == "exhausted@offen.dev" {
+			mail.Attempts = 2
+			db.mails[id] = mail
+		}
+	}
+
+	m := &mockMailer{errs: map[string]error{
+		"temporary@offen.dev": mailer.NewError(mailer.ErrTemporary, errors.New("try again")),
+		"exhausted@offen.dev": mailer.NewError(mailer.ErrTemporary, errors.New("try again")),
+		"rejected@offen.dev":  mailer.NewError(mailer.ErrRejected, errors.New("no such user")),
+	}}
+	delivered, err := p.DeliverQueuedMails(m, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if delivered != 1 || len(m.sent) != 1 || m.sent[0] != "ok@offen.dev" {
+		t.Errorf("Unexpected delivery result %d, %v", delivered, m.sent)
+	}
+	if len(db.mails) != 3 {
+		t.Errorf("Expected delivered mail to be removed, got %v", db.mails)
+	}
+
+	for _, mail := range db.mails {
+		switch mail.To {
+		case "temporary@offen.dev":
+			if mail.Failed || mail.Attempts != 1 || mail.LastError == "" || !mail.NextAttempt.After(time.Now()) {
+				t.Errorf("Unexpected state for temporary failure %v", mail)
+			}
+		case "rejected@offen.dev", "exhausted@offen.dev":
+			if !mail.Failed || mail.LastError == "" {
+				t.Errorf("Expected mail to be failed, got %v", mail)
+			}
+		}
+	}
+
+	failed, err := p.ListFailedMails()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(failed) != 2 {
+		t.Fatalf("Unexpected failed mails %v", failed)
+	}
+
+	if err := p.RequeueMail(failed[0].MailID); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	requeued := db.mails[failed[0].MailID]
+	if requeued.Failed || requeued.Attempts != 0 || requeued.NextAttempt.After(time.Now()) {
+		t.Errorf("Unexpected state for requeued mail %v", requeued)
+	}
+
+	var unknown ErrUnknownMail
+	if err := p.RequeueMail(failed[0].MailID); !errors.As(err, &unknown) {
+		t.Errorf("Expected unknown mail error when requeueing pending mail, got %v", err)
+	}
+	if err := p.RequeueMail("zomfg"); !errors.As(err, &unknown) {
+		t.Errorf("Expected unknown mail error, got %v", err)
+	}
+}
+
+func TestPersistenceLayer_ExpireMails(t *testing.T) {
+	now := time.Now()
+	db := &mockMailQueueDatabase{mails: map[string]QueuedMail{
+		"mail-a": {MailID: "mail-a", Failed: true, Created: now.Add(-time.Hour * 48)},
+		"mail-b": {MailID: "mail-b", Created: now.Add(-time.Hour * 48)},
+		"mail-c": {MailID: "mail-c", Failed: true, Created: now},
+	}}
+	p := &persistenceLayer{dal: db}
+	affected, err := p.ExpireMails(time.Hour * 24)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if affected != 2 {
+		t.Errorf("Expected 2 mails to be expired, got %d", affected)
+	}
+	if _, ok := db.mails["mail-c"]; !ok || len(db.mails) != 1 {
+		t.Errorf("Unexpected remaining mails %v", db.mails)
+	}
+}
+
+func TestMailRetryDelay(t *testing.T) {
+	for attempts, expected := range map[int]time.Duration{
+		1:  time.Minute,
+		2:  time.Minute * 2,
+		5:  time.Minute * 16,
+		20: time.Hour * 6,
+	} {
+		if delay := deliveryRetryDelay(attempts); delay != expected {
+			t.Errorf("Expected delay of %v for %d attempts, got %v", expected, attempts, delay)
+		}
+	}
+}
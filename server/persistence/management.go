@@ -22,10 +22,91 @@ func (p *persistenceLayer) UpdateAccountStyles(accountID, accountStyles string)
 	return nil
 }
 
-func (p *persistenceLayer) ShareAccount(inviteeEmailAddress, providerEmailAddress, providerPassword, accountID string, grantAdminPrivileges bool) (ShareAccountResult, error) {
+func (p *persistenceLayer) UpdateAccountRetention(accountID, retentionPeriod, accountUserID string) error {
+	a, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account before updating retention period: %w", err)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	a.RetentionPeriod = retentionPeriod
+	if err := txn.UpdateAccount(&a); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error updating retention period of account %s: %w", accountID, err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionUpdateRetention, retentionPeriod); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording retention period update of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing retention period update: %w", err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) UpdateAccountBotPolicy(accountID, botPolicy, accountUserID string) error {
+	a, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account before updating bot policy: %w", err)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	a.BotPolicy = botPolicy
+	if err := txn.UpdateAccount(&a); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error updating bot policy of account %s: %w", accountID, err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionUpdateBotPolicy, botPolicy); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording bot policy update of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing bot policy update: %w", err)
+	}
+	return nil
+}
+
+// UpdateAccountLocale sets the locale of the given account. Passing an empty
+// value makes the locale be negotiated again.
+func (p *persistenceLayer) UpdateAccountLocale(accountID, locale, accountUserID string) error {
+	a, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account before updating locale: %w", err)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	a.Locale = locale
+	if err := txn.UpdateAccount(&a); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error updating locale of account %s: %w", accountID, err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionUpdateLocale, locale); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording locale update of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing locale update: %w", err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) ShareAccount(inviteeEmailAddress, providerEmailAddress, providerPassword, accountID string, role AccountUserRole) (ShareAccountResult, error) {
 	var result ShareAccountResult
 	var invitedAccountUser *AccountUser
 
+	if !role.Valid() {
+		return result, fmt.Errorf("persistence: unknown role %s", role)
+	}
+
 	accountUsers, err := p.dal.FindAccountUsers(FindAccountUsersQueryAllAccountUsers{true, false})
 	if err != nil {
 		return result, fmt.Errorf("persistence: error looking up account users: %w", err)
@@ -41,7 +122,7 @@ func (p *persistenceLayer) ShareAccount(inviteeEmailAddress, providerEmailAddres
 	}
 
 	var targetAdminLevel AccountUserAdminLevel
-	if grantAdminPrivileges {
+	if role == AccountUserRoleAdmin {
 		targetAdminLevel = AccountUserAdminLevelSuperAdmin
 	}
 	// Next, we need to check whether the given address is already associated
@@ -51,7 +132,9 @@ func (p *persistenceLayer) ShareAccount(inviteeEmailAddress, providerEmailAddres
 			result.UserExistsWithPassword = true
 		}
 		invitedAccountUser = match
-		if match.AdminLevel != targetAdminLevel {
+		// privileges for single accounts are restricted using roles, so the
+		// admin level is never lowered when sharing
+		if targetAdminLevel == AccountUserAdminLevelSuperAdmin && match.AdminLevel != targetAdminLevel {
 			invitedAccountUser.AdminLevel = targetAdminLevel
 			if err := p.dal.UpdateAccountUser(invitedAccountUser); err != nil {
 				return result, fmt.Errorf("persistence: error updating admin level on previously non-admin user: %w", err)
@@ -74,25 +157,41 @@ func (p *persistenceLayer) ShareAccount(inviteeEmailAddress, providerEmailAddres
 	}
 
 	var eligibleRelationships []AccountUserRelationship
+	var changedRelationships []AccountUserRelationship
 outer:
 	for _, relationship := range provider.Relationships {
+		if accountID != "" && relationship.AccountID != accountID {
+			continue
+		}
+		// only admins are allowed to share an account
+		if !relationship.Role.Includes(AccountUserRoleAdmin) {
+			if accountID != "" {
+				return result, fmt.Errorf("persistence: provider is not allowed to share account %s", accountID)
+			}
+			continue
+		}
 		for _, existingRelationship := range invitedAccountUser.Relationships {
 			if relationship.AccountID == existingRelationship.AccountID {
 				// this makes sure no existing relationship for the accountID
-				// in question is overwritten
+				// in question is overwritten, only its role is updated
+				if existingRelationship.Role != role {
+					existingRelationship.Role = role
+					changedRelationships = append(changedRelationships, existingRelationship)
+				}
 				continue outer
 			}
 		}
-		if accountID == "" || relationship.AccountID == accountID {
-			// with no filter given, the invitee inherits all relationships from
-			// the provider
-			account, accountErr := p.dal.FindAccount(FindAccountQueryByID(relationship.AccountID))
-			if accountErr != nil {
-				return result, fmt.Errorf("persistence: error looking up account info for relationship %s: %w", relationship.RelationshipID, err)
-			}
-			result.AccountNames = append(result.AccountNames, account.Name)
-			eligibleRelationships = append(eligibleRelationships, relationship)
+		// with no filter given, the invitee inherits all relationships the
+		// provider is allowed to share
+		account, accountErr := p.dal.FindAccount(FindAccountQueryByID(relationship.AccountID))
+		if accountErr != nil {
+			return result, fmt.Errorf("persistence: error looking up account info for relationship %s: %w", relationship.RelationshipID, err)
+		}
+		if account.Retired {
+			continue
 		}
+		result.AccountNames = append(result.AccountNames, account.Name)
+		eligibleRelationships = append(eligibleRelationships, relationship)
 	}
 
 	txn, err := p.dal.Transaction()
@@ -100,13 +199,40 @@ outer:
 		return result, fmt.Errorf("persistence: error creating transaction: %w", err)
 	}
 
+	var invitation *Invitation
+	if len(eligibleRelationships) != 0 {
+		invitation, err = newInvitation(invitedAccountUser.AccountUserID, provider.AccountUserID, p.getInvitationExpiry())
+		if err != nil {
+			txn.Rollback()
+			return result, err
+		}
+		if err := txn.CreateInvitation(invitation); err != nil {
+			txn.Rollback()
+			return result, fmt.Errorf("persistence: error persisting invitation: %w", err)
+		}
+		result.InvitationID = invitation.InvitationID
+	}
+
+	for _, relationship := range changedRelationships {
+		if err := txn.UpdateAccountUserRelationship(&relationship); err != nil {
+			txn.Rollback()
+			return result, fmt.Errorf("persistence: error updating role of account user relationship: %w", err)
+		}
+		if err := writeAuditLog(txn, []string{relationship.AccountID}, provider.AccountUserID, AuditActionChangeRole, invitedAccountUser.AccountUserID); err != nil {
+			txn.Rollback()
+			return result, fmt.Errorf("persistence: error recording role change: %w", err)
+		}
+		result.RoleChanged = true
+	}
+
 	// we copy over all all eligible relationships of the provider to the invitee
 	for _, providerRelationship := range eligibleRelationships {
-		inviteeRelationship, err := newAccountUserRelationship(invitedAccountUser.AccountUserID, providerRelationship.AccountID)
+		inviteeRelationship, err := newAccountUserRelationship(invitedAccountUser.AccountUserID, providerRelationship.AccountID, role)
 		if err != nil {
 			txn.Rollback()
 			return result, fmt.Errorf("persistence: error creating account user relationship: %w", err)
 		}
+		inviteeRelationship.InvitationID = invitation.InvitationID
 
 		decryptedKey, decryptErr := keys.DecryptWith(providerKey, providerRelationship.PasswordEncryptedKeyEncryptionKey)
 		if decryptErr != nil {
@@ -122,6 +248,10 @@ outer:
 		if err := txn.CreateAccountUserRelationship(inviteeRelationship); err != nil {
 			return result, fmt.Errorf("persistence: error persisting account user relationship: %w", err)
 		}
+		if err := writeAuditLog(txn, []string{providerRelationship.AccountID}, provider.AccountUserID, AuditActionShareAccount, invitedAccountUser.AccountUserID); err != nil {
+			txn.Rollback()
+			return result, fmt.Errorf("persistence: error recording account share: %w", err)
+		}
 	}
 	if err := txn.Commit(); err != nil {
 		return result, fmt.Errorf("persistence: error committing transaction: %w", err)
@@ -143,6 +273,15 @@ func (p *persistenceLayer) Join(emailAddress, password string) error {
 		return fmt.Errorf("persistence: error validating password: %w", err)
 	}
 
+	relationships, err := p.acceptableRelationships(match.Relationships)
+	if err != nil {
+		return fmt.Errorf("persistence: error checking invitations: %w", err)
+	}
+	if len(relationships) == 0 {
+		return ErrInvitationExpired(fmt.Sprintf("persistence: invitations for %s have expired or have been revoked", emailAddress))
+	}
+	match.Relationships = relationships
+
 	cipher, err := keys.HashString(password)
 	if err != nil {
 		return fmt.Errorf("persistence: hashing given password: %w", err)
@@ -166,8 +305,25 @@ func (p *persistenceLayer) Join(emailAddress, password string) error {
 		match.Relationships[index] = relationship
 	}
 
-	if err := p.dal.UpdateAccountUser(match); err != nil {
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	if err := txn.UpdateAccountUser(match); err != nil {
+		txn.Rollback()
 		return fmt.Errorf("persistence: failed to update account user: %w", err)
 	}
+	for _, relationship := range match.Relationships {
+		if err := notifyWebhooks(txn, relationship.AccountID, WebhookEventUserJoined, map[string]interface{}{
+			"accountUserId": match.AccountUserID,
+			"role":          relationship.Role,
+		}); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error notifying webhooks: %w", err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing transaction: %w", err)
+	}
 	return nil
 }
@@ -33,6 +33,18 @@ func (m *mockShareAccountDatabase) CreateAccountUserRelationship(*AccountUserRel
 	return m.createRelationshipErr
 }
 
+func (m *mockShareAccountDatabase) CreateInvitation(*Invitation) error {
+	return nil
+}
+
+func (m *mockShareAccountDatabase) UpdateAccountUser(*AccountUser) error {
+	return nil
+}
+
+func (m *mockShareAccountDatabase) UpdateAccountUserRelationship(*AccountUserRelationship) error {
+	return nil
+}
+
 func (m *mockShareAccountDatabase) Commit() error {
 	return m.commitErr
 }
@@ -49,6 +61,10 @@ func (m *mockShareAccountDatabase) FindAccount(interface{}) (Account, error) {
 	return Account{Name: "account-name", AccountID: "account-id"}, nil
 }
 
+func (m *mockShareAccountDatabase) CreateAuditLogEntry(*AuditLogEntry) error {
+	return nil
+}
+
 func TestPersistenceLayer_ShareAccount(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -144,6 +160,7 @@ func TestPersistenceLayer_ShareAccount(t *testing.T) {
 								AccountUserID:                     a.AccountUserID,
 								EmailEncryptedKeyEncryptionKey:    e.Marshal(),
 								PasswordEncryptedKeyEncryptionKey: p.Marshal(),
+								Role:                              AccountUserRoleAdmin,
 							},
 						}
 						return *a
@@ -184,6 +201,7 @@ func TestPersistenceLayer_ShareAccount(t *testing.T) {
 								AccountUserID:                     a.AccountUserID,
 								EmailEncryptedKeyEncryptionKey:    e.Marshal(),
 								PasswordEncryptedKeyEncryptionKey: p.Marshal(),
+								Role:                              AccountUserRoleAdmin,
 							},
 						}
 						return *a
@@ -200,16 +218,84 @@ func TestPersistenceLayer_ShareAccount(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"provider is not an admin",
+			&mockShareAccountDatabase{
+				findAcccountUsersResult: []AccountUser{
+					(func() AccountUser {
+						a, _ := newAccountUser("develop@offen.dev", "develop", AccountUserAdminLevelSuperAdmin)
+						a.Relationships = []AccountUserRelationship{
+							{
+								AccountID:     "account-id",
+								AccountUserID: a.AccountUserID,
+								Role:          AccountUserRoleEditor,
+							},
+						}
+						return *a
+					})(),
+				},
+			},
+			"invitee@offen.dev",
+			"develop@offen.dev",
+			"develop",
+			"account-id",
+			ShareAccountResult{},
+			true,
+		},
+		{
+			"ok - role is changed",
+			&mockShareAccountDatabase{
+				findAcccountUsersResult: []AccountUser{
+					(func() AccountUser {
+						a, _ := newAccountUser("develop@offen.dev", "develop", AccountUserAdminLevelSuperAdmin)
+						a.Relationships = []AccountUserRelationship{
+							{
+								AccountID:     "account-id",
+								AccountUserID: a.AccountUserID,
+								Role:          AccountUserRoleAdmin,
+							},
+						}
+						return *a
+					})(),
+					(func() AccountUser {
+						a, _ := newAccountUser("invitee@offen.dev", "develop", 0)
+						a.Relationships = []AccountUserRelationship{
+							{
+								AccountID:     "account-id",
+								AccountUserID: a.AccountUserID,
+								Role:          AccountUserRoleViewer,
+							},
+						}
+						return *a
+					})(),
+				},
+			},
+			"invitee@offen.dev",
+			"develop@offen.dev",
+			"develop",
+			"account-id",
+			ShareAccountResult{
+				UserExistsWithPassword: true,
+				RoleChanged:            true,
+			},
+			false,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			p := persistenceLayer{test.dal}
-			result, err := p.ShareAccount(test.invitee, test.email, test.password, test.accountID, true)
+			p := persistenceLayer{dal: test.dal}
+			result, err := p.ShareAccount(test.invitee, test.email, test.password, test.accountID, AccountUserRoleAdmin)
 
 			if test.expectErr != (err != nil) {
 				t.Errorf("Unexpected error value %v", err)
 			}
 
+			if (len(result.AccountNames) != 0) != (result.InvitationID != "") {
+				t.Errorf("Unexpected invitation id %v", result.InvitationID)
+			}
+			// invitation ids are random
+			result.InvitationID = ""
+
 			if !reflect.DeepEqual(test.expectedResult, result) {
 				t.Errorf("Expected %v, got %v", test.expectedResult, result)
 			}
@@ -247,6 +333,10 @@ func (m *mockJoinDatabase) UpdateAccountUserRelationship(*AccountUserRelationshi
 	return m.updateRelationshipErr
 }
 
+func (m *mockJoinDatabase) FindWebhooks(interface{}) ([]Webhook, error) {
+	return nil, nil
+}
+
 func (m *mockJoinDatabase) UpdateAccountUser(*AccountUser) error {
 	return m.updateAccountUserErr
 }
@@ -416,7 +506,7 @@ func TestPersistenceLayer_Join(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			p := &persistenceLayer{test.dal}
+			p := &persistenceLayer{dal: test.dal}
 			err := p.Join(test.emailArg, test.pwArg)
 			if test.expectError != (err != nil) {
 				t.Errorf("Unexpected error value: %v", err)
@@ -424,3 +514,111 @@ func TestPersistenceLayer_Join(t *testing.T) {
 		})
 	}
 }
+
+type mockUpdateAccountRetentionDatabase struct {
+	DataAccessLayer
+	findErr  error
+	updated  []Account
+	auditLog []*AuditLogEntry
+}
+
+func (m *mockUpdateAccountRetentionDatabase) FindAccount(interface{}) (Account, error) {
+	return Account{AccountID: "account-a"}, m.findErr
+}
+
+func (m *mockUpdateAccountRetentionDatabase) UpdateAccount(a *Account) error {
+	m.updated = append(m.updated, *a)
+	return nil
+}
+
+func (m *mockUpdateAccountRetentionDatabase) CreateAuditLogEntry(e *AuditLogEntry) error {
+	m.auditLog = append(m.auditLog, e)
+	return nil
+}
+
+func (m *mockUpdateAccountRetentionDatabase) Commit() error {
+	return nil
+}
+
+func (m *mockUpdateAccountRetentionDatabase) Rollback() error {
+	return nil
+}
+
+func (m *mockUpdateAccountRetentionDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func TestPersistenceLayer_UpdateAccountRetention(t *testing.T) {
+	t.Run("unknown account", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{findErr: ErrUnknownAccount("unknown")}
+		p := &persistenceLayer{dal: db}
+		var unknown ErrUnknownAccount
+		if err := p.UpdateAccountRetention("account-a", "30days", "user-a"); !errors.As(err, &unknown) {
+			t.Errorf("Expected unknown account error, got %v", err)
+		}
+		if len(db.updated) != 0 {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdateAccountRetention("account-a", "30days", "user-a"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 || db.updated[0].RetentionPeriod != "30days" {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionUpdateRetention || db.auditLog[0].Target != "30days" {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+}
+
+func TestPersistenceLayer_UpdateAccountBotPolicy(t *testing.T) {
+	t.Run("unknown account", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{findErr: ErrUnknownAccount("unknown")}
+		p := &persistenceLayer{dal: db}
+		var unknown ErrUnknownAccount
+		if err := p.UpdateAccountBotPolicy("account-a", "flag", "user-a"); !errors.As(err, &unknown) {
+			t.Errorf("Expected unknown account error, got %v", err)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdateAccountBotPolicy("account-a", "flag", "user-a"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 || db.updated[0].BotPolicy != "flag" {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionUpdateBotPolicy || db.auditLog[0].Target != "flag" {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+}
+
+func TestPersistenceLayer_UpdateAccountLocale(t *testing.T) {
+	t.Run("unknown account", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{findErr: ErrUnknownAccount("unknown")}
+		p := &persistenceLayer{dal: db}
+		var unknown ErrUnknownAccount
+		if err := p.UpdateAccountLocale("account-a", "de", "user-a"); !errors.As(err, &unknown) {
+			t.Errorf("Expected unknown account error, got %v", err)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdateAccountLocale("account-a", "de", "user-a"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 || db.updated[0].Locale != "de" {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionUpdateLocale || db.auditLog[0].Target != "de" {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// NormalizeOrigin validates the given value is an origin as sent by browsers
+// in the Origin header, i.e. a http or https URL without a path, and returns
+// it in lowercase.
+func NormalizeOrigin(value string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return "", fmt.Errorf("persistence: error parsing origin %s: %w", value, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("persistence: origin %s does not use http or https", value)
+	}
+	if u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" || (u.Path != "" && u.Path != "/") {
+		return "", fmt.Errorf("persistence: %s is not an origin", value)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// UpdateAccountAllowedOrigins replaces the origins that are allowed to send
+// cross origin requests for the given account. Passing an empty list
+// disallows all cross origin requests.
+func (p *persistenceLayer) UpdateAccountAllowedOrigins(accountID string, origins []string, accountUserID string) error {
+	var normalized []string
+	for _, origin := range origins {
+		value, err := NormalizeOrigin(origin)
+		if err != nil {
+			return err
+		}
+		normalized = append(normalized, value)
+	}
+	a, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account before updating allowed origins: %w", err)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	a.AllowedOrigins = strings.Join(normalized, ",")
+	if err := txn.UpdateAccount(&a); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error updating allowed origins of account %s: %w", accountID, err)
+	}
+	// the list of origins might exceed the size of an audit log target
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionUpdateOrigins, fmt.Sprintf("%d origins", len(normalized))); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording allowed origins update of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing allowed origins update: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeOrigin(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		expectedResult string
+		expectError    bool
+	}{
+		{"ok", "https://www.offen.dev", "https://www.offen.dev", false},
+		{"port and trailing slash", "HTTP://localhost:8080/", "http://localhost:8080", false},
+		{"path", "https://www.offen.dev/about", "", true},
+		{"query", "https://www.offen.dev?a=b", "", true},
+		{"no scheme", "www.offen.dev", "", true},
+		{"other scheme", "ftp://www.offen.dev", "", true},
+		{"wildcard", "*", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := NormalizeOrigin(test.value)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestPersistenceLayer_UpdateAccountAllowedOrigins(t *testing.T) {
+	t.Run("bad origin", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdateAccountAllowedOrigins("account-a", []string{"https://www.offen.dev/about"}, "user-a"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if len(db.updated) != 0 {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+	})
+	t.Run("unknown account", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{findErr: ErrUnknownAccount("unknown")}
+		p := &persistenceLayer{dal: db}
+		var unknown ErrUnknownAccount
+		if err := p.UpdateAccountAllowedOrigins("account-a", nil, "user-a"); !errors.As(err, &unknown) {
+			t.Errorf("Expected unknown account error, got %v", err)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdateAccountAllowedOrigins("account-a", []string{"https://WWW.offen.dev", "http://localhost:8080"}, "user-a"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 || db.updated[0].AllowedOrigins != "https://www.offen.dev,http://localhost:8080" {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionUpdateOrigins {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+}
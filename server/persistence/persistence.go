@@ -4,39 +4,132 @@
 package persistence
 
 import (
+	"io"
 	"time"
+
+	"github.com/offen/offen/server/domainverify"
+	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/webhook"
 )
 
 // Service is a backend-agnostic wrapper for interacting with a persistence
 // layer. It does not make any assumptions about how data is being modelled
 // and stored.
 type Service interface {
-	Insert(userID, accountID, payload string, eventID *string) error
+	Insert(userID, accountID, eventType, payload string, eventID *string) error
+	InsertBatch(userID string, events []BatchEvent) ([]error, error)
 	Query(Query) (EventsResult, error)
+	EventsRevision(userID string, accountIDs []string) (string, error)
 	GetAccount(accountID string, styles, events bool, eventsSince string) (AccountResult, error)
+	GetAccountSummary(accountID string) (AccountSummaryResult, error)
+	ExportEvents(accountID, cursor string, limit int) ([]ExportedEventResult, error)
+	ImportEvents(accountID, accountUserID string, events []ExportedEventResult) (ImportResult, error)
 	CreateAccount(name, creatorEmailAddress, creatorPassword string) error
-	RetireAccount(accountID string) error
+	RetireAccount(accountID, accountUserID string) error
+	RestoreAccount(accountID, accountUserID string) error
+	PurgeRetiredAccounts(gracePeriod time.Duration) (int, error)
+	ListAllAccounts() ([]AdminAccountResult, error)
+	GetInstanceUsage() (InstanceUsageResult, error)
+	SetAccountDisabled(accountID string, disabled bool, accountUserID string) error
 	AssociateUserSecret(accountID, userID, encryptedUserSecret string) error
+	GetUserData(userID string) (UserDataResult, error)
+	ConsentedAccountIDs(userID string) ([]string, error)
 	Purge(userID string) error
-	Login(email, password string) (LoginResult, error)
-	LoginSSO(email, salt string) (LoginResult, error)
+	PurgeAccounts(userID string, accountIDs []string) error
+	ResetAccountEvents(accountID, accountUserID string) error
+	Login(email, password, secondFactor string) (LoginResult, error)
+	VerifyCredentials(email, password string) (LoginResult, error)
+	LoginSSO(email, salt string, provisioning SSOProvisioning, previousSalts ...string) (LoginResult, error)
 	LookupAccountUser(userID string) (LoginResult, error)
+	SetupTOTP(accountUserID string) (TOTPSetupResult, error)
+	VerifyTOTP(accountUserID, code string) (TOTPVerifyResult, error)
+	ListWebAuthnCredentials(accountUserID string) ([]WebAuthnCredentialResult, error)
+	RegisterWebAuthnCredential(accountUserID, password, credentialID, credential string) error
+	LoginWebAuthn(accountUserID, credentialID, credential string) (LoginResult, error)
 	ChangePassword(userID, currentPassword, changedPassword string) error
 	ChangeEmail(userID, emailAddress, emailCurrent, password string) error
 	GenerateOneTimeKey(emailAddress string) ([]byte, error)
 	ResetPassword(emailAddress, password string, oneTimeKey []byte) error
-	ShareAccount(inviteeEmailAddress, providerEmailAddress, providerPassword, accountID string, grantAdminPrivileges bool) (ShareAccountResult, error)
+	ShareAccount(inviteeEmailAddress, providerEmailAddress, providerPassword, accountID string, role AccountUserRole) (ShareAccountResult, error)
 	UpdateAccountStyles(accountID, styles string) error
+	UpdateAccountRetention(accountID, retentionPeriod, accountUserID string) error
+	UpdateAccountRetentionRules(accountID string, rules RetentionRules, accountUserID string) error
+	UpdateAccountBotPolicy(accountID, botPolicy, accountUserID string) error
+	UpdateAccountLocale(accountID, locale, accountUserID string) error
+	UpdateAccountTheme(accountID string, theme Theme, accountUserID string) (Theme, error)
+	UpdateAccountAllowedOrigins(accountID string, origins []string, accountUserID string) error
+	UpdateAccountEventTypes(accountID string, types EventTypes, accountUserID string) error
+	UpdateAccountCookiePolicy(accountID string, policy CookiePolicy, accountUserID string) error
+	UpdateAccountFeatureFlags(accountID string, update map[string]*bool, accountUserID string) (FeatureFlags, error)
+	RotateAccountWriteKey(accountID string, gracePeriod time.Duration, accountUserID string) (string, error)
+	RemoveAccountWriteKeys(accountID, accountUserID string) error
+	RotateAccountKeys(accountID, accountUserID, password string) error
+	ListAccountUsers(accountID string) ([]AccountUserResult, error)
+	UpdateAccountUserRole(accountID, targetAccountUserID string, role AccountUserRole, accountUserID string) error
+	RemoveAccountUser(accountID, targetAccountUserID, accountUserID, password string) error
+	UnlockAccountUser(accountID, targetAccountUserID, accountUserID string) error
 	Join(emailAddress, password string) error
-	Expire(retention time.Duration) (int, error)
+	LookupInvitation(invitationID string) (InvitationResult, error)
+	ResendInvitation(invitationID, inviteeEmailAddress, accountUserID string) (InvitationResult, error)
+	RevokeInvitation(invitationID, accountUserID string) error
+	Expire(retention time.Duration, resolve func(period string) (time.Duration, error)) (int, error)
+	DetectAnomalies(threshold float64, retention time.Duration) (int, error)
+	ListAnomalies(accountIDs []string, since time.Time) ([]AnomalyResult, error)
+	CountAggregates(epsilon float64, retention time.Duration) (int, error)
+	ListAggregates(accountID string, since time.Time) ([]AggregateResult, error)
+	RecordPing(accountID string) error
+	ListPings(accountID string, since time.Time) ([]PingResult, error)
+	ExpirePings(retention time.Duration) (int, error)
+	CreateShareLink(accountID, accountUserID string, expires time.Time) (ShareLinkResult, error)
+	LookupShareLink(linkID string) (ShareLinkResult, error)
+	RevokeShareLink(accountID, linkID, accountUserID string) error
+	CreateSession(accountUserID string, lifetime time.Duration) (SessionResult, error)
+	LookupSession(sessionID string) (SessionResult, error)
+	ListSessions(accountUserID string) ([]SessionResult, error)
+	RevokeSession(accountUserID, sessionID string) error
+	RevokeSessions(accountUserID string) error
+	CreateAPIToken(accountID, accountUserID, name string, scopes []string) (APITokenResult, error)
+	LookupAPIToken(token string) (APITokenResult, error)
+	ListAPITokens(accountIDs []string) ([]APITokenResult, error)
+	RevokeAPIToken(accountID, tokenID, accountUserID string) error
+	RecordAuditLog(accountUserID string, accountIDs []string, action, target string) error
+	GetAuditLog(accountID string, limit int) ([]AuditLogResult, error)
+	ExpireAuditLog(retention time.Duration) (int, error)
+	EnqueueMail(from, to, subject, body string) error
+	DeliverQueuedMails(m mailer.Mailer, maxAttempts int) (int, error)
+	ListFailedMails() ([]QueuedMailResult, error)
+	RequeueMail(mailID string) error
+	ExpireMails(retention time.Duration) (int, error)
+	CreateWebhook(accountID, accountUserID, url, secret string, events []string) (WebhookResult, error)
+	ListWebhooks(accountID string) ([]WebhookResult, error)
+	DeleteWebhook(accountID, webhookID, accountUserID string) error
+	ListWebhookDeliveries(accountID, webhookID string, limit int) ([]WebhookDeliveryResult, error)
+	DeliverWebhooks(s webhook.Sender, maxAttempts int) (int, error)
+	CreateAccountDomain(accountID, domain, accountUserID string) (AccountDomainResult, error)
+	ListAccountDomains(accountID string) ([]AccountDomainResult, error)
+	VerifyAccountDomain(accountID, domainID, method, accountUserID string, v domainverify.Verifier) (AccountDomainResult, error)
+	DeleteAccountDomain(accountID, domainID, accountUserID string) error
 	Bootstrap(data BootstrapConfig) error
+	Provision(config ProvisionConfig, credentials ProvisionCredentials, dryRun bool) (ProvisionResult, error)
 	ProbeEmpty() bool
 	CheckHealth() error
 	Migrate() error
+	Dump() (*Snapshot, error)
+	Restore(snapshot *Snapshot, force bool) error
+	DumpStream(w io.Writer) (int, error)
+	RestoreStream(r io.Reader, force bool) (int, error)
 }
 
 type persistenceLayer struct {
-	dal DataAccessLayer
+	dal                DataAccessLayer
+	sessions           SessionStore
+	onInsert           func(EventResult)
+	secretKey          []byte
+	previousSecretKeys [][]byte
+	quotas             Quotas
+	usageCache         usageCache
+	invitationExpiry   time.Duration
+	lockout            *Lockout
 }
 
 // New creates a persistence service that connects to any database using
@@ -46,6 +139,9 @@ func New(dal DataAccessLayer, configs ...Config) (Service, error) {
 	for _, config := range configs {
 		config(&db)
 	}
+	if db.sessions == nil {
+		db.sessions = NewDatabaseSessionStore(dal)
+	}
 	return &db, nil
 }
 
@@ -0,0 +1,54 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"time"
+)
+
+// RecordPing counts a cookieless ping for the given account. Pings carry no
+// information about the user that sent them, so the only thing stored is the
+// number of pings received by the account on the current day.
+func (p *persistenceLayer) RecordPing(accountID string) error {
+	account, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account for ping: %w", err)
+	}
+	if account.Disabled {
+		return ErrAccountDisabled(fmt.Sprintf("persistence: account %s is disabled", account.AccountID))
+	}
+	if err := p.dal.IncrementPingCounter(account.AccountID, startOfDay(time.Now())); err != nil {
+		return fmt.Errorf("persistence: error counting ping: %w", err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) ListPings(accountID string, since time.Time) ([]PingResult, error) {
+	counters, err := p.dal.FindPingCounters(FindPingCountersQueryByAccountID{
+		AccountID: accountID,
+		Since:     since,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up ping counters: %w", err)
+	}
+	result := []PingResult{}
+	for _, counter := range counters {
+		result = append(result, PingResult{
+			Day:   counter.Day,
+			Count: counter.Count,
+		})
+	}
+	return result, nil
+}
+
+// ExpirePings deletes all ping counters for days older than the given
+// retention.
+func (p *persistenceLayer) ExpirePings(retention time.Duration) (int, error) {
+	deleted, err := p.dal.DeletePingCounters(DeletePingCountersQueryBefore(startOfDay(time.Now().Add(-retention))))
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error expiring ping counters: %w", err)
+	}
+	return int(deleted), nil
+}
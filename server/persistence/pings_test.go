@@ -0,0 +1,102 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockPingsDatabase struct {
+	DataAccessLayer
+	account     Account
+	findErr     error
+	incremented []time.Time
+	counters    []PingCounter
+	deleteQuery interface{}
+}
+
+func (m *mockPingsDatabase) FindAccount(interface{}) (Account, error) {
+	return m.account, m.findErr
+}
+
+func (m *mockPingsDatabase) IncrementPingCounter(accountID string, day time.Time) error {
+	m.incremented = append(m.incremented, day)
+	return nil
+}
+
+func (m *mockPingsDatabase) FindPingCounters(interface{}) ([]PingCounter, error) {
+	return m.counters, nil
+}
+
+func (m *mockPingsDatabase) DeletePingCounters(q interface{}) (int64, error) {
+	m.deleteQuery = q
+	return 2, nil
+}
+
+func TestPersistenceLayer_RecordPing(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		db := &mockPingsDatabase{account: Account{AccountID: "account-a"}}
+		p := &persistenceLayer{dal: db}
+		if err := p.RecordPing("account-a"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(db.incremented) != 1 || !db.incremented[0].Equal(startOfDay(time.Now())) {
+			t.Errorf("Unexpected increments %v", db.incremented)
+		}
+	})
+	t.Run("unknown account", func(t *testing.T) {
+		db := &mockPingsDatabase{findErr: ErrUnknownAccount("unknown")}
+		p := &persistenceLayer{dal: db}
+		var unknownErr ErrUnknownAccount
+		if err := p.RecordPing("account-a"); !errors.As(err, &unknownErr) {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.incremented) != 0 {
+			t.Errorf("Unexpected increments %v", db.incremented)
+		}
+	})
+	t.Run("disabled account", func(t *testing.T) {
+		db := &mockPingsDatabase{account: Account{AccountID: "account-a", Disabled: true}}
+		p := &persistenceLayer{dal: db}
+		var disabledErr ErrAccountDisabled
+		if err := p.RecordPing("account-a"); !errors.As(err, &disabledErr) {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.incremented) != 0 {
+			t.Errorf("Unexpected increments %v", db.incremented)
+		}
+	})
+}
+
+func TestPersistenceLayer_ListPings(t *testing.T) {
+	day := startOfDay(time.Now())
+	p := &persistenceLayer{dal: &mockPingsDatabase{
+		counters: []PingCounter{{AccountID: "account-a", Day: day, Count: 42}},
+	}}
+	result, err := p.ListPings("account-a", day.AddDate(0, 0, -30))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(result) != 1 || result[0].Count != 42 || !result[0].Day.Equal(day) {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
+
+func TestPersistenceLayer_ExpirePings(t *testing.T) {
+	db := &mockPingsDatabase{}
+	p := &persistenceLayer{dal: db}
+	deleted, err := p.ExpirePings(time.Hour * 24 * 7)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Unexpected number of deleted counters %d", deleted)
+	}
+	expected := DeletePingCountersQueryBefore(startOfDay(time.Now().AddDate(0, 0, -7)))
+	if db.deleteQuery != expected {
+		t.Errorf("Unexpected query %v", db.deleteQuery)
+	}
+}
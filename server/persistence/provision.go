@@ -0,0 +1,508 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	uuid "github.com/gofrs/uuid"
+	"github.com/offen/offen/server/keys"
+)
+
+// ProvisionConfig declares the desired state of a set of accounts. Accounts
+// are identified by their id, so that applying the same document more than
+// once does not create duplicates. Accounts that exist in the database but
+// are not part of the document are left untouched.
+type ProvisionConfig struct {
+	Accounts []ProvisionAccount `yaml:"accounts" json:"accounts"`
+}
+
+// ProvisionAccount is the desired state of a single account. Settings that
+// are omitted are left unchanged, and an empty value resets a setting to
+// the instance wide default. In case members are given, they replace all
+// existing members of the account.
+type ProvisionAccount struct {
+	AccountID       string             `yaml:"id" json:"id"`
+	Name            string             `yaml:"name" json:"name"`
+	RetentionPeriod *string            `yaml:"retention_period" json:"retentionPeriod"`
+	BotPolicy       *string            `yaml:"bot_policy" json:"botPolicy"`
+	AllowedOrigins  *[]string          `yaml:"allowed_origins" json:"allowedOrigins"`
+	Members         *[]ProvisionMember `yaml:"members" json:"members"`
+}
+
+// ProvisionMember grants the account user with the given email address the
+// given role for an account. Account users that do not exist yet are
+// created and can set their password by joining.
+type ProvisionMember struct {
+	Email string          `yaml:"email" json:"email"`
+	Role  AccountUserRole `yaml:"role" json:"role"`
+}
+
+// ProvisionCredentials identify the account user on whose behalf accounts
+// are provisioned. Changing the members of an existing account requires the
+// account's key, which can only be unlocked using the password of one of
+// its admins.
+type ProvisionCredentials struct {
+	EmailAddress string
+	Password     string
+}
+
+// Provision actions describe a single change applied when provisioning.
+const (
+	ProvisionActionCreateAccount = "create-account"
+	ProvisionActionUpdateAccount = "update-account"
+	ProvisionActionAddMember     = "add-member"
+	ProvisionActionUpdateRole    = "update-role"
+	ProvisionActionRemoveMember  = "remove-member"
+)
+
+func (c *ProvisionConfig) validate() error {
+	seen := map[string]bool{}
+	names := map[string]bool{}
+	for idx, account := range c.Accounts {
+		if _, err := uuid.FromString(account.AccountID); err != nil {
+			return ErrInvalidProvisioning(fmt.Sprintf("persistence: account %d does not have a valid id", idx))
+		}
+		if seen[account.AccountID] {
+			return ErrInvalidProvisioning(fmt.Sprintf("persistence: account %s is declared more than once", account.AccountID))
+		}
+		seen[account.AccountID] = true
+		if strings.TrimSpace(account.Name) == "" {
+			return ErrInvalidProvisioning(fmt.Sprintf("persistence: account %s does not have a name", account.AccountID))
+		}
+		if names[account.Name] {
+			return ErrInvalidProvisioning(fmt.Sprintf("persistence: account name %s is used more than once", account.Name))
+		}
+		names[account.Name] = true
+		if account.AllowedOrigins != nil {
+			for _, origin := range *account.AllowedOrigins {
+				if _, err := NormalizeOrigin(origin); err != nil {
+					return ErrInvalidProvisioning(fmt.Sprintf("persistence: account %s: %v", account.AccountID, err))
+				}
+			}
+		}
+		if account.Members == nil {
+			continue
+		}
+		emails := map[string]bool{}
+		for _, member := range *account.Members {
+			if member.Email == "" {
+				return ErrInvalidProvisioning(fmt.Sprintf("persistence: account %s has a member without email", account.AccountID))
+			}
+			if !member.Role.Valid() {
+				return ErrInvalidProvisioning(fmt.Sprintf("persistence: account %s: unknown role %s", account.AccountID, member.Role))
+			}
+			email := strings.ToLower(member.Email)
+			if emails[email] {
+				return ErrInvalidProvisioning(fmt.Sprintf("persistence: account %s declares member %s more than once", account.AccountID, member.Email))
+			}
+			emails[email] = true
+		}
+	}
+	return nil
+}
+
+// provisioner carries the state that is shared when provisioning multiple
+// accounts in a single transaction.
+type provisioner struct {
+	txn          Transaction
+	accountUsers []AccountUser
+	actor        *AccountUser
+	password     string
+	result       *ProvisionResult
+}
+
+func (p *provisioner) record(change ProvisionChange) {
+	p.result.Changes = append(p.result.Changes, change)
+}
+
+// Provision makes the accounts in the database match the given config. All
+// changes are applied in a single transaction. When dryRun is true, the
+// transaction is rolled back so the returned changes describe what would
+// happen without modifying any data.
+func (p *persistenceLayer) Provision(config ProvisionConfig, credentials ProvisionCredentials, dryRun bool) (ProvisionResult, error) {
+	result := ProvisionResult{DryRun: dryRun, Changes: []ProvisionChange{}}
+	if err := config.validate(); err != nil {
+		return result, err
+	}
+
+	accountUsers, err := p.dal.FindAccountUsers(FindAccountUsersQueryAllAccountUsers{IncludeRelationships: true})
+	if err != nil {
+		return result, fmt.Errorf("persistence: error looking up account users: %w", err)
+	}
+	var actor *AccountUser
+	if credentials.EmailAddress != "" {
+		actor, err = selectAccountUser(accountUsers, credentials.EmailAddress)
+		if err != nil {
+			return result, fmt.Errorf("persistence: error looking up account user %s: %w", credentials.EmailAddress, err)
+		}
+		if err := keys.CompareString(credentials.Password, actor.HashedPassword); err != nil {
+			return result, fmt.Errorf("persistence: error comparing passwords: %w", err)
+		}
+	}
+
+	accounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
+	if err != nil {
+		return result, fmt.Errorf("persistence: error looking up accounts: %w", err)
+	}
+	existing := map[string]Account{}
+	for _, account := range accounts {
+		existing[account.AccountID] = account
+	}
+	for _, declared := range config.Accounts {
+		for _, account := range accounts {
+			if account.Name == declared.Name && account.AccountID != declared.AccountID {
+				return result, ErrProvisioningConflict(fmt.Sprintf("persistence: account named %s already exists with id %s", declared.Name, account.AccountID))
+			}
+		}
+		if account, ok := existing[declared.AccountID]; ok && account.Retired {
+			return result, ErrProvisioningConflict(fmt.Sprintf("persistence: account %s has been retired", declared.AccountID))
+		}
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return result, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	pr := &provisioner{
+		txn:          txn,
+		accountUsers: accountUsers,
+		actor:        actor,
+		password:     credentials.Password,
+		result:       &result,
+	}
+	for _, declared := range config.Accounts {
+		var err error
+		if account, ok := existing[declared.AccountID]; ok {
+			err = pr.updateAccount(account, declared)
+		} else {
+			err = pr.createAccount(declared)
+		}
+		if err != nil {
+			txn.Rollback()
+			return result, err
+		}
+	}
+
+	if dryRun {
+		txn.Rollback()
+		return result, nil
+	}
+	if err := txn.Commit(); err != nil {
+		return result, fmt.Errorf("persistence: error committing provisioning: %w", err)
+	}
+	return result, nil
+}
+
+func (p *provisioner) actorID() string {
+	if p.actor == nil {
+		return ""
+	}
+	return p.actor.AccountUserID
+}
+
+func (p *provisioner) createAccount(declared ProvisionAccount) error {
+	if p.actor == nil && (declared.Members == nil || len(*declared.Members) == 0) {
+		return ErrInvalidProvisioning(fmt.Sprintf("persistence: account %s would not have any members", declared.AccountID))
+	}
+	account, key, err := newAccount(declared.Name, declared.AccountID)
+	if err != nil {
+		return fmt.Errorf("persistence: error creating account: %w", err)
+	}
+	applyProvisionSettings(account, declared)
+	if err := p.txn.CreateAccount(account); err != nil {
+		return fmt.Errorf("persistence: error persisting account %s: %w", declared.AccountID, err)
+	}
+	p.record(ProvisionChange{
+		Action:    ProvisionActionCreateAccount,
+		AccountID: account.AccountID,
+		To:        account.Name,
+	})
+
+	// the account user provisioning the account is made an admin so that
+	// members can be changed later on
+	if p.actor != nil {
+		if err := p.addMember(account.AccountID, key, p.actor, ProvisionMember{
+			Role: AccountUserRoleAdmin,
+		}, false); err != nil {
+			return err
+		}
+	}
+	if declared.Members != nil {
+		for _, member := range *declared.Members {
+			if p.actor != nil && p.isActor(member.Email) {
+				continue
+			}
+			if err := p.addMember(account.AccountID, key, nil, member, true); err != nil {
+				return err
+			}
+		}
+	}
+	if err := notifyWebhooks(p.txn, account.AccountID, WebhookEventAccountCreated, map[string]interface{}{
+		"name":      account.Name,
+		"createdBy": p.actorID(),
+	}); err != nil {
+		return fmt.Errorf("persistence: error notifying webhooks: %w", err)
+	}
+	return p.audit(account.AccountID)
+}
+
+func (p *provisioner) updateAccount(account Account, declared ProvisionAccount) error {
+	before := len(p.result.Changes)
+	updated := account
+	updated.Name = declared.Name
+	applyProvisionSettings(&updated, declared)
+	for _, field := range []struct {
+		name     string
+		from, to string
+	}{
+		{"name", account.Name, updated.Name},
+		{"retentionPeriod", account.RetentionPeriod, updated.RetentionPeriod},
+		{"botPolicy", account.BotPolicy, updated.BotPolicy},
+		{"allowedOrigins", account.AllowedOrigins, updated.AllowedOrigins},
+	} {
+		if field.from == field.to {
+			continue
+		}
+		p.record(ProvisionChange{
+			Action:    ProvisionActionUpdateAccount,
+			AccountID: account.AccountID,
+			Target:    field.name,
+			From:      field.from,
+			To:        field.to,
+		})
+	}
+	if len(p.result.Changes) != before {
+		if err := p.txn.UpdateAccount(&updated); err != nil {
+			return fmt.Errorf("persistence: error updating account %s: %w", account.AccountID, err)
+		}
+	}
+	if declared.Members != nil {
+		if err := p.syncMembers(&updated, *declared.Members); err != nil {
+			return err
+		}
+	}
+	if len(p.result.Changes) == before {
+		return nil
+	}
+	return p.audit(account.AccountID)
+}
+
+// syncMembers makes the members of an existing account match the given
+// list. Roles can be changed without further ado, but adding or removing
+// members requires the key of the account.
+func (p *provisioner) syncMembers(account *Account, members []ProvisionMember) error {
+	relationships, err := p.txn.FindAccountUserRelationships(FindAccountUserRelationshipsQueryByAccountID(account.AccountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up members of account %s: %w", account.AccountID, err)
+	}
+	current := map[string]AccountUserRelationship{}
+	for _, relationship := range relationships {
+		current[relationship.AccountUserID] = relationship
+	}
+
+	var additions []ProvisionMember
+	keep := map[string]bool{p.actorID(): true}
+	for _, member := range members {
+		match, err := selectAccountUser(p.accountUsers, member.Email)
+		if err != nil {
+			additions = append(additions, member)
+			continue
+		}
+		relationship, ok := current[match.AccountUserID]
+		if !ok {
+			additions = append(additions, member)
+			continue
+		}
+		keep[match.AccountUserID] = true
+		if relationship.Role == member.Role {
+			continue
+		}
+		p.record(ProvisionChange{
+			Action:    ProvisionActionUpdateRole,
+			AccountID: account.AccountID,
+			Target:    member.Email,
+			From:      string(relationship.Role),
+			To:        string(member.Role),
+		})
+		relationship.Role = member.Role
+		if err := p.txn.UpdateAccountUserRelationship(&relationship); err != nil {
+			return fmt.Errorf("persistence: error updating role of account user relationship: %w", err)
+		}
+	}
+
+	var removals []string
+	for accountUserID := range current {
+		if !keep[accountUserID] {
+			removals = append(removals, accountUserID)
+		}
+	}
+	sort.Strings(removals)
+	if len(additions) == 0 && len(removals) == 0 {
+		return nil
+	}
+
+	key, err := p.unlockKey(account.AccountID)
+	if err != nil {
+		return err
+	}
+	for _, member := range additions {
+		if err := p.addMember(account.AccountID, key, nil, member, true); err != nil {
+			return err
+		}
+	}
+	for _, accountUserID := range removals {
+		p.record(ProvisionChange{
+			Action:    ProvisionActionRemoveMember,
+			AccountID: account.AccountID,
+			Target:    accountUserID,
+			From:      string(current[accountUserID].Role),
+		})
+		if err := p.txn.DeleteAccountUserRelationships(DeleteAccountUserRelationshipsQueryByAccountUserID{
+			AccountID:     account.AccountID,
+			AccountUserID: accountUserID,
+		}); err != nil {
+			return fmt.Errorf("persistence: error removing account user %s: %w", accountUserID, err)
+		}
+		if _, err := p.txn.DeleteAPITokens(DeleteAPITokensQueryByAccountUserID{
+			AccountID:     account.AccountID,
+			AccountUserID: accountUserID,
+		}); err != nil {
+			return fmt.Errorf("persistence: error revoking api tokens of account user %s: %w", accountUserID, err)
+		}
+	}
+	// removed members must not be able to decrypt any data collected from
+	// now on, which is why keys are rotated just like when removing a
+	// member manually
+	if len(removals) != 0 {
+		if err := rotateAccountKeys(account, key); err != nil {
+			return err
+		}
+		if err := p.txn.UpdateAccount(account); err != nil {
+			return fmt.Errorf("persistence: error updating keys of account %s: %w", account.AccountID, err)
+		}
+	}
+	return nil
+}
+
+// unlockKey returns the key of the given account using the credentials
+// the provisioning has been requested with.
+func (p *provisioner) unlockKey(accountID string) ([]byte, error) {
+	if p.actor == nil {
+		return nil, ErrProvisioningConflict(fmt.Sprintf("persistence: changing members of account %s requires the credentials of one of its admins", accountID))
+	}
+	for _, relationship := range p.actor.Relationships {
+		if relationship.AccountID != accountID || relationship.PasswordEncryptedKeyEncryptionKey == "" {
+			continue
+		}
+		if !relationship.Role.Includes(AccountUserRoleAdmin) {
+			break
+		}
+		pwDerivedKey, err := keys.DeriveKey(p.password, p.actor.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error deriving key from password: %w", err)
+		}
+		key, err := keys.DecryptWith(pwDerivedKey, relationship.PasswordEncryptedKeyEncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error decrypting key encryption key: %w", err)
+		}
+		return key, nil
+	}
+	return nil, ErrProvisioningConflict(fmt.Sprintf("persistence: account user %s is not an admin of account %s", p.actor.AccountUserID, accountID))
+}
+
+func (p *provisioner) isActor(email string) bool {
+	if p.actor == nil {
+		return false
+	}
+	match, err := selectAccountUser([]AccountUser{*p.actor}, email)
+	return err == nil && match != nil
+}
+
+// addMember grants the given member access to the account. In case
+// accountUser is nil, it is looked up using the member's email, creating a
+// new account user if needed.
+func (p *provisioner) addMember(accountID string, key []byte, accountUser *AccountUser, member ProvisionMember, record bool) error {
+	if accountUser == nil {
+		if match, err := selectAccountUser(p.accountUsers, member.Email); err == nil {
+			accountUser = match
+		} else {
+			created, err := newAccountUser(member.Email, "", AccountUserAdminLevel(0))
+			if err != nil {
+				return fmt.Errorf("persistence: error creating account user for %s: %w", member.Email, err)
+			}
+			if err := p.txn.CreateAccountUser(created); err != nil {
+				return fmt.Errorf("persistence: error persisting account user for %s: %w", member.Email, err)
+			}
+			p.accountUsers = append(p.accountUsers, *created)
+			accountUser = created
+		}
+	}
+
+	relationship, err := newAccountUserRelationship(accountUser.AccountUserID, accountID, member.Role)
+	if err != nil {
+		return err
+	}
+	if accountUser == p.actor {
+		if err := relationship.addPasswordEncryptedKey(key, accountUser.Salt, p.password); err != nil {
+			return fmt.Errorf("persistence: error adding password encrypted key: %w", err)
+		}
+	} else {
+		// just like invitees, members set up a password encrypted key the
+		// next time they log in or when joining
+		if err := relationship.addEmailEncryptedKey(key, accountUser.Salt, member.Email); err != nil {
+			return fmt.Errorf("persistence: error adding email encrypted key: %w", err)
+		}
+	}
+	if err := p.txn.CreateAccountUserRelationship(relationship); err != nil {
+		return fmt.Errorf("persistence: error persisting account user relationship: %w", err)
+	}
+	if accountUser == p.actor {
+		p.actor.Relationships = append(p.actor.Relationships, *relationship)
+	}
+	if record {
+		p.record(ProvisionChange{
+			Action:    ProvisionActionAddMember,
+			AccountID: accountID,
+			Target:    member.Email,
+			To:        string(member.Role),
+		})
+	}
+	return nil
+}
+
+// audit records a single audit log entry for all changes that have been
+// applied to the given account.
+func (p *provisioner) audit(accountID string) error {
+	var count int
+	for _, change := range p.result.Changes {
+		if change.AccountID == accountID {
+			count++
+		}
+	}
+	if err := writeAuditLog(p.txn, []string{accountID}, p.actorID(), AuditActionProvision, fmt.Sprintf("%d changes", count)); err != nil {
+		return fmt.Errorf("persistence: error recording provisioning of account %s: %w", accountID, err)
+	}
+	return nil
+}
+
+func applyProvisionSettings(account *Account, declared ProvisionAccount) {
+	if declared.RetentionPeriod != nil {
+		account.RetentionPeriod = *declared.RetentionPeriod
+	}
+	if declared.BotPolicy != nil {
+		account.BotPolicy = *declared.BotPolicy
+	}
+	if declared.AllowedOrigins != nil {
+		var normalized []string
+		for _, origin := range *declared.AllowedOrigins {
+			// origins have been validated before
+			value, _ := NormalizeOrigin(origin)
+			normalized = append(normalized, value)
+		}
+		account.AllowedOrigins = strings.Join(normalized, ",")
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/offen/offen/server/keys"
+)
+
+type mockProvisionDatabase struct {
+	DataAccessLayer
+	accounts      []Account
+	accountUsers  []AccountUser
+	relationships []AccountUserRelationship
+	committed     bool
+	audited       int
+}
+
+func (m *mockProvisionDatabase) FindAccountUsers(interface{}) ([]AccountUser, error) {
+	return m.accountUsers, nil
+}
+
+func (m *mockProvisionDatabase) FindAccounts(interface{}) ([]Account, error) {
+	return m.accounts, nil
+}
+
+func (m *mockProvisionDatabase) FindAccountUserRelationships(q interface{}) ([]AccountUserRelationship, error) {
+	var result []AccountUserRelationship
+	for _, r := range m.relationships {
+		if r.AccountID == string(q.(FindAccountUserRelationshipsQueryByAccountID)) {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockProvisionDatabase) CreateAccount(a *Account) error {
+	m.accounts = append(m.accounts, *a)
+	return nil
+}
+
+func (m *mockProvisionDatabase) UpdateAccount(a *Account) error {
+	for idx, account := range m.accounts {
+		if account.AccountID == a.AccountID {
+			m.accounts[idx] = *a
+		}
+	}
+	return nil
+}
+
+func (m *mockProvisionDatabase) CreateAccountUser(u *AccountUser) error {
+	m.accountUsers = append(m.accountUsers, *u)
+	return nil
+}
+
+func (m *mockProvisionDatabase) CreateAccountUserRelationship(r *AccountUserRelationship) error {
+	m.relationships = append(m.relationships, *r)
+	return nil
+}
+
+func (m *mockProvisionDatabase) UpdateAccountUserRelationship(r *AccountUserRelationship) error {
+	for idx, relationship := range m.relationships {
+		if relationship.RelationshipID == r.RelationshipID {
+			m.relationships[idx] = *r
+		}
+	}
+	return nil
+}
+
+func (m *mockProvisionDatabase) FindWebhooks(interface{}) ([]Webhook, error) {
+	return nil, nil
+}
+
+func (m *mockProvisionDatabase) CreateAuditLogEntry(*AuditLogEntry) error {
+	m.audited++
+	return nil
+}
+
+func (m *mockProvisionDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func (m *mockProvisionDatabase) Commit() error {
+	m.committed = true
+	return nil
+}
+
+func (m *mockProvisionDatabase) Rollback() error {
+	return nil
+}
+
+const provisionAccountID = "9b63c4d8-65c0-438c-9d30-cc4b01173393"
+
+func newMockProvisionDatabase(t *testing.T) *mockProvisionDatabase {
+	hashedEmail, err := keys.HashString("develop@offen.dev")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	salt, err := keys.NewSalt(keys.DefaultSaltLength)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return &mockProvisionDatabase{
+		accounts: []Account{
+			{AccountID: provisionAccountID, Name: "existing"},
+		},
+		accountUsers: []AccountUser{
+			{AccountUserID: "account-user-a", HashedEmail: hashedEmail.Marshal(), Salt: salt.Marshal()},
+		},
+		relationships: []AccountUserRelationship{
+			{RelationshipID: "relationship-a", AccountID: provisionAccountID, AccountUserID: "account-user-a", Role: AccountUserRoleViewer},
+		},
+	}
+}
+
+func TestPersistenceLayer_Provision(t *testing.T) {
+	t.Run("invalid config", func(t *testing.T) {
+		p := &persistenceLayer{dal: newMockProvisionDatabase(t)}
+		_, err := p.Provision(ProvisionConfig{
+			Accounts: []ProvisionAccount{{AccountID: "not-a-uuid", Name: "name"}},
+		}, ProvisionCredentials{}, false)
+		var invalidErr ErrInvalidProvisioning
+		if !errors.As(err, &invalidErr) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("unchanged", func(t *testing.T) {
+		db := newMockProvisionDatabase(t)
+		p := &persistenceLayer{dal: db}
+		result, err := p.Provision(ProvisionConfig{
+			Accounts: []ProvisionAccount{{
+				AccountID: provisionAccountID,
+				Name:      "existing",
+				Members:   &[]ProvisionMember{{Email: "develop@offen.dev", Role: AccountUserRoleViewer}},
+			}},
+		}, ProvisionCredentials{}, false)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(result.Changes) != 0 || db.audited != 0 {
+			t.Errorf("Unexpected changes %v", result.Changes)
+		}
+	})
+	t.Run("update", func(t *testing.T) {
+		db := newMockProvisionDatabase(t)
+		p := &persistenceLayer{dal: db}
+		retention := "30days"
+		result, err := p.Provision(ProvisionConfig{
+			Accounts: []ProvisionAccount{{
+				AccountID:       provisionAccountID,
+				Name:            "renamed",
+				RetentionPeriod: &retention,
+				Members:         &[]ProvisionMember{{Email: "develop@offen.dev", Role: AccountUserRoleAdmin}},
+			}},
+		}, ProvisionCredentials{}, false)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(result.Changes) != 3 {
+			t.Errorf("Unexpected changes %v", result.Changes)
+		}
+		if db.accounts[0].Name != "renamed" || db.accounts[0].RetentionPeriod != "30days" {
+			t.Errorf("Unexpected account %v", db.accounts[0])
+		}
+		if db.relationships[0].Role != AccountUserRoleAdmin {
+			t.Errorf("Unexpected relationship %v", db.relationships[0])
+		}
+		if !db.committed || db.audited != 1 {
+			t.Errorf("Expected changes to be committed and audited")
+		}
+	})
+	t.Run("adding members without credentials", func(t *testing.T) {
+		p := &persistenceLayer{dal: newMockProvisionDatabase(t)}
+		_, err := p.Provision(ProvisionConfig{
+			Accounts: []ProvisionAccount{{
+				AccountID: provisionAccountID,
+				Name:      "existing",
+				Members: &[]ProvisionMember{
+					{Email: "develop@offen.dev", Role: AccountUserRoleViewer},
+					{Email: "other@offen.dev", Role: AccountUserRoleViewer},
+				},
+			}},
+		}, ProvisionCredentials{}, false)
+		var conflictErr ErrProvisioningConflict
+		if !errors.As(err, &conflictErr) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+	t.Run("create dry run", func(t *testing.T) {
+		db := newMockProvisionDatabase(t)
+		p := &persistenceLayer{dal: db}
+		result, err := p.Provision(ProvisionConfig{
+			Accounts: []ProvisionAccount{{
+				AccountID: "78403940-ae4f-4aff-a395-1e90f145cf62",
+				Name:      "new",
+				Members: &[]ProvisionMember{
+					{Email: "develop@offen.dev", Role: AccountUserRoleAdmin},
+					{Email: "other@offen.dev", Role: AccountUserRoleViewer},
+				},
+			}},
+		}, ProvisionCredentials{}, true)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !result.DryRun || len(result.Changes) != 3 {
+			t.Errorf("Unexpected result %v", result)
+		}
+		if result.Changes[0].Action != ProvisionActionCreateAccount || result.Changes[2].Action != ProvisionActionAddMember {
+			t.Errorf("Unexpected changes %v", result.Changes)
+		}
+		if db.committed {
+			t.Error("Expected dry run not to be committed")
+		}
+	})
+	t.Run("create without members", func(t *testing.T) {
+		p := &persistenceLayer{dal: newMockProvisionDatabase(t)}
+		_, err := p.Provision(ProvisionConfig{
+			Accounts: []ProvisionAccount{{AccountID: "78403940-ae4f-4aff-a395-1e90f145cf62", Name: "new"}},
+		}, ProvisionCredentials{}, false)
+		var invalidErr ErrInvalidProvisioning
+		if !errors.As(err, &invalidErr) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+}
@@ -0,0 +1,178 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Names of the quotas that can be exceeded.
+const (
+	QuotaEventsPerMonth = "events per month"
+	QuotaStoredEvents   = "stored events"
+)
+
+// usage is cached for this long, so that inserting events does not require
+// counting all events of an account each time
+const quotaUsageTTL = time.Minute
+
+// Quotas limit the number of events each account can receive. Zero values
+// disable the respective quota.
+type Quotas struct {
+	EventsPerMonth int64
+	StoredEvents   int64
+}
+
+func (q Quotas) enabled() bool {
+	return q.EventsPerMonth > 0 || q.StoredEvents > 0
+}
+
+// WithQuotas sets the quotas that are enforced for each account when
+// inserting events.
+func WithQuotas(q Quotas) Config {
+	return func(p *persistenceLayer) {
+		p.quotas = q
+	}
+}
+
+type accountUsage struct {
+	month     time.Time
+	fetched   time.Time
+	thisMonth int64
+	stored    int64
+}
+
+type usageCache struct {
+	mu       sync.Mutex
+	accounts map[string]*accountUsage
+	// notified contains the month in which webhooks have last been
+	// notified about an account exceeding a quota
+	notified map[string]time.Time
+}
+
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// usage returns the usage of the given account, which is looked up in case
+// it is not cached or the cached value is stale. The caller must hold the
+// lock.
+func (p *persistenceLayer) usage(accountID string, now time.Time) (*accountUsage, error) {
+	if p.usageCache.accounts == nil {
+		p.usageCache.accounts = map[string]*accountUsage{}
+	}
+	month := startOfMonth(now)
+	if cached, ok := p.usageCache.accounts[accountID]; ok && cached.month.Equal(month) && now.Sub(cached.fetched) < quotaUsageTTL {
+		return cached, nil
+	}
+
+	stored, err := p.dal.FindEventStats(FindEventStatsQueryByAccountID(accountID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up stored events: %w", err)
+	}
+	monthStart, err := EventIDAt(month)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error creating event id for start of month: %w", err)
+	}
+	thisMonth, err := p.dal.FindEventStats(FindEventStatsQueryByAccountIDSince{
+		AccountID: accountID,
+		Since:     monthStart,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up events of current month: %w", err)
+	}
+	result := &accountUsage{
+		month:     month,
+		fetched:   now,
+		thisMonth: thisMonth.Count,
+		stored:    stored.Count,
+	}
+	p.usageCache.accounts[accountID] = result
+	return result, nil
+}
+
+// checkQuotas returns ErrQuotaExceeded in case inserting another event for
+// the given account would exceed one of the configured quotas.
+func (p *persistenceLayer) checkQuotas(accountID string) error {
+	if !p.quotas.enabled() {
+		return nil
+	}
+	p.usageCache.mu.Lock()
+	usage, err := p.usage(accountID, time.Now())
+	if err != nil {
+		p.usageCache.mu.Unlock()
+		return err
+	}
+	var exceeded *ErrQuotaExceeded
+	if p.quotas.StoredEvents > 0 && usage.stored >= p.quotas.StoredEvents {
+		exceeded = &ErrQuotaExceeded{Quota: QuotaStoredEvents, Limit: p.quotas.StoredEvents}
+	} else if p.quotas.EventsPerMonth > 0 && usage.thisMonth >= p.quotas.EventsPerMonth {
+		exceeded = &ErrQuotaExceeded{Quota: QuotaEventsPerMonth, Limit: p.quotas.EventsPerMonth}
+	}
+	if exceeded == nil {
+		p.usageCache.mu.Unlock()
+		return nil
+	}
+
+	// webhooks are notified once per month and quota, which is tracked per
+	// process so a restart might cause another notification
+	if p.usageCache.notified == nil {
+		p.usageCache.notified = map[string]time.Time{}
+	}
+	key := accountID + "/" + exceeded.Quota
+	notify := !p.usageCache.notified[key].Equal(usage.month)
+	if notify {
+		p.usageCache.notified[key] = usage.month
+	}
+	p.usageCache.mu.Unlock()
+
+	if notify {
+		if err := notifyWebhooks(p.dal, accountID, WebhookEventQuotaExceeded, map[string]interface{}{
+			"quota": exceeded.Quota,
+			"limit": exceeded.Limit,
+		}); err != nil {
+			// the event is rejected anyways, so notifying is tried again
+			// when the next event is rejected
+			p.usageCache.mu.Lock()
+			delete(p.usageCache.notified, key)
+			p.usageCache.mu.Unlock()
+		}
+	}
+	return *exceeded
+}
+
+// recordUsage adds the given events to the cached usage of their accounts.
+func (p *persistenceLayer) recordUsage(events ...*Event) {
+	if !p.quotas.enabled() {
+		return
+	}
+	p.usageCache.mu.Lock()
+	defer p.usageCache.mu.Unlock()
+	for _, evt := range events {
+		if cached, ok := p.usageCache.accounts[evt.AccountID]; ok {
+			cached.thisMonth++
+			cached.stored++
+		}
+	}
+}
+
+// accountUsageResult reports the usage of the given account against the
+// configured quotas.
+func (p *persistenceLayer) accountUsageResult(accountID string) (*AccountUsageResult, error) {
+	p.usageCache.mu.Lock()
+	defer p.usageCache.mu.Unlock()
+	usage, err := p.usage(accountID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &AccountUsageResult{
+		EventsThisMonth:     usage.thisMonth,
+		EventsPerMonthLimit: p.quotas.EventsPerMonth,
+		StoredEvents:        usage.stored,
+		StoredEventsLimit:   p.quotas.StoredEvents,
+	}, nil
+}
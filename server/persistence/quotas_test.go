@@ -0,0 +1,95 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockQuotaDatabase struct {
+	DataAccessLayer
+	stored    int64
+	thisMonth int64
+	calls     int
+	notified  []string
+}
+
+func (m *mockQuotaDatabase) FindWebhooks(interface{}) ([]Webhook, error) {
+	return []Webhook{{WebhookID: "webhook-a", Events: []string{WebhookEventQuotaExceeded}}}, nil
+}
+
+func (m *mockQuotaDatabase) CreateWebhookDelivery(d *WebhookDelivery) error {
+	m.notified = append(m.notified, d.Event)
+	return nil
+}
+
+func (m *mockQuotaDatabase) FindEventStats(q interface{}) (EventStats, error) {
+	m.calls++
+	switch q.(type) {
+	case FindEventStatsQueryByAccountID:
+		return EventStats{Count: m.stored}, nil
+	case FindEventStatsQueryByAccountIDSince:
+		return EventStats{Count: m.thisMonth}, nil
+	default:
+		return EventStats{}, ErrBadQuery
+	}
+}
+
+func TestPersistenceLayer_checkQuotas(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		db := &mockQuotaDatabase{stored: 100}
+		p := &persistenceLayer{dal: db}
+		if err := p.checkQuotas("account-a"); err != nil || db.calls != 0 {
+			t.Errorf("Unexpected result %v after %d calls", err, db.calls)
+		}
+	})
+	t.Run("within quota", func(t *testing.T) {
+		db := &mockQuotaDatabase{stored: 9, thisMonth: 4}
+		p := &persistenceLayer{dal: db, quotas: Quotas{EventsPerMonth: 5, StoredEvents: 10}}
+		if err := p.checkQuotas("account-a"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		p.recordUsage(&Event{AccountID: "account-a"})
+		err := p.checkQuotas("account-a")
+		var quotaErr ErrQuotaExceeded
+		if !errors.As(err, &quotaErr) || quotaErr.Quota != QuotaStoredEvents {
+			t.Errorf("Expected stored events quota to be exceeded, got %v", err)
+		}
+		if db.calls != 2 {
+			t.Errorf("Expected usage to be cached, got %d calls", db.calls)
+		}
+		p.checkQuotas("account-a")
+		if len(db.notified) != 1 {
+			t.Errorf("Expected webhooks to be notified once, got %v", db.notified)
+		}
+	})
+	t.Run("monthly quota", func(t *testing.T) {
+		db := &mockQuotaDatabase{stored: 9, thisMonth: 5}
+		p := &persistenceLayer{dal: db, quotas: Quotas{EventsPerMonth: 5}}
+		err := p.checkQuotas("account-a")
+		var quotaErr ErrQuotaExceeded
+		if !errors.As(err, &quotaErr) || quotaErr.Quota != QuotaEventsPerMonth || quotaErr.Limit != 5 {
+			t.Errorf("Expected monthly quota to be exceeded, got %v", err)
+		}
+	})
+	t.Run("stale usage", func(t *testing.T) {
+		db := &mockQuotaDatabase{}
+		p := &persistenceLayer{dal: db, quotas: Quotas{EventsPerMonth: 5}}
+		now := time.Now()
+		p.usage("account-a", now)
+		p.usage("account-a", now.Add(quotaUsageTTL))
+		if db.calls != 4 {
+			t.Errorf("Expected stale usage to be looked up again, got %d calls", db.calls)
+		}
+	})
+}
+
+func TestStartOfMonth(t *testing.T) {
+	result := startOfMonth(time.Date(2022, 5, 17, 13, 12, 0, 0, time.UTC))
+	if !result.Equal(time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
@@ -13,8 +13,16 @@ import (
 
 func (r *relationalDAL) CreateAccount(a *persistence.Account) error {
 	local := importAccount(a)
-	if err := r.db.Create(&local).Error; err != nil {
-		return fmt.Errorf("relational: error creating account: %w", err)
+	if err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&local).Error; err != nil {
+			return fmt.Errorf("relational: error creating account: %w", err)
+		}
+		if err := tx.Create(&AccountSequence{AccountID: local.AccountID}).Error; err != nil {
+			return fmt.Errorf("relational: error creating account sequence: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
 	}
 	return nil
 }
@@ -40,7 +48,9 @@ func (r *relationalDAL) FindAccount(q interface{}) (persistence.Account, error)
 		var limit int = 500
 		var offset int
 		var events []Event
-		queryDB := r.db.Preload("Secret").Limit(limit)
+		// events are returned in ascending order of their id so that results
+		// are stable across calls and `Since` can be used for resuming
+		queryDB := sinceSequenceNumbers(r.db.Preload("Secret"), query.SinceSequenceNumbers).Order("event_id ASC").Limit(limit)
 		for {
 			var nextEvents []Event
 			var found int64
@@ -95,7 +105,28 @@ func (r *relationalDAL) FindAccounts(q interface{}) ([]persistence.Account, erro
 			result = append(result, a.export())
 		}
 		return result, nil
+	case persistence.FindAccountsQueryRetired:
+		if err := r.db.Where("retired = ?", true).Find(&accounts).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up retired accounts: %w", err)
+		}
+		result := []persistence.Account{}
+		for _, a := range accounts {
+			result = append(result, a.export())
+		}
+		return result, nil
 	default:
 		return nil, persistence.ErrBadQuery
 	}
 }
+
+func (r *relationalDAL) DeleteAccount(q interface{}) error {
+	switch query := q.(type) {
+	case persistence.DeleteAccountQueryByID:
+		if err := r.db.Where("account_id = ?", string(query)).Delete(&Account{}).Error; err != nil {
+			return fmt.Errorf("relational: error deleting account: %w", err)
+		}
+		return nil
+	default:
+		return persistence.ErrBadQuery
+	}
+}
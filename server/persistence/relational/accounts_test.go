@@ -264,6 +264,38 @@ func TestRelationalDAL_FindAccount(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"include events ordering",
+			func(db *gorm.DB) error {
+				if err := db.Save(&Account{
+					AccountID: "account-id",
+				}).Error; err != nil {
+					return fmt.Errorf("error inserting fixture: %v", err)
+				}
+				for _, eventID := range []string{"event-id-c", "event-id-a", "event-id-b"} {
+					if err := db.Save(&Event{
+						EventID:   eventID,
+						Payload:   "payload",
+						AccountID: "account-id",
+					}).Error; err != nil {
+						return fmt.Errorf("error inserting fixture: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindAccountQueryIncludeEvents{
+				AccountID: "account-id",
+			},
+			persistence.Account{
+				AccountID: "account-id",
+				Events: []persistence.Event{
+					{EventID: "event-id-a", Payload: "payload", AccountID: "account-id"},
+					{EventID: "event-id-b", Payload: "payload", AccountID: "account-id"},
+					{EventID: "event-id-c", Payload: "payload", AccountID: "account-id"},
+				},
+			},
+			false,
+		},
 		{
 			"include events unknown account",
 			func(db *gorm.DB) error {
@@ -336,6 +368,11 @@ func TestRelationalDAL_FindAccount(t *testing.T) {
 			if (err != nil) != test.expectError {
 				t.Errorf("Unexpected error value %v", err)
 			}
+
+			repeated, _ := dal.FindAccount(test.arg)
+			if !reflect.DeepEqual(result, repeated) {
+				t.Errorf("Expected repeated lookup to return %v, got %v", result, repeated)
+			}
 		})
 	}
 }
@@ -376,6 +413,27 @@ func TestRelationalDAL_FindAccounts(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"retired accounts",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"a", "b", "c"} {
+					if err := db.Save(&Account{
+						AccountID: fmt.Sprintf("account-id-%s", token),
+						Name:      fmt.Sprintf("account-name-%s", token),
+						Retired:   token != "b",
+					}).Error; err != nil {
+						return fmt.Errorf("error creating test fixture: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindAccountsQueryRetired{},
+			[]persistence.Account{
+				{AccountID: "account-id-a", Name: "account-name-a", Retired: true},
+				{AccountID: "account-id-c", Name: "account-name-c", Retired: true},
+			},
+			false,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -399,3 +457,30 @@ func TestRelationalDAL_FindAccounts(t *testing.T) {
 		})
 	}
 }
+
+func TestRelationalDAL_DeleteAccount(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	for _, id := range []string{"account-a", "account-b"} {
+		if err := db.Save(&Account{AccountID: id}).Error; err != nil {
+			t.Fatalf("Error creating test fixture: %v", err)
+		}
+	}
+
+	if err := dal.DeleteAccount("account-a"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+	if err := dal.DeleteAccount(persistence.DeleteAccountQueryByID("account-a")); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	result, err := dal.FindAccounts(persistence.FindAccountsQueryAllAccounts{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(result) != 1 || result[0].AccountID != "account-b" {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func (r *relationalDAL) CreateAggregateCounter(a *persistence.AggregateCounter) error {
+	local := importAggregateCounter(a)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating aggregate counter: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindAggregateCounters(q interface{}) ([]persistence.AggregateCounter, error) {
+	var counters []AggregateCounter
+	switch query := q.(type) {
+	case persistence.FindAggregateCountersQueryByAccountID:
+		if err := r.db.
+			Where("account_id = ? AND day >= ?", query.AccountID, query.Since).
+			Order("day ASC").
+			Find(&counters).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up aggregate counters: %w", err)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	result := []persistence.AggregateCounter{}
+	for _, counter := range counters {
+		result = append(result, counter.export())
+	}
+	return result, nil
+}
+
+func (r *relationalDAL) DeleteAggregateCounters(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.DeleteAggregateCountersQueryBefore:
+		deletion := r.db.Where("day < ?", time.Time(query)).Delete(&AggregateCounter{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting aggregate counters: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
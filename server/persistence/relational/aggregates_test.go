@@ -0,0 +1,48 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_AggregateCounters(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	day := time.Date(2022, 5, 17, 0, 0, 0, 0, time.UTC)
+	for _, counter := range []*persistence.AggregateCounter{
+		{CounterID: "counter-a", AccountID: "account-a", Day: day.AddDate(0, 0, -40)},
+		{CounterID: "counter-b", AccountID: "account-a", Day: day},
+		{CounterID: "counter-c", AccountID: "account-a", Day: day.AddDate(0, 0, -2)},
+		{CounterID: "counter-d", AccountID: "account-b", Day: day},
+	} {
+		if err := dal.CreateAggregateCounter(counter); err != nil {
+			t.Fatalf("Unexpected error creating counter: %v", err)
+		}
+	}
+
+	counters, err := dal.FindAggregateCounters(persistence.FindAggregateCountersQueryByAccountID{
+		AccountID: "account-a",
+		Since:     day.AddDate(0, 0, -30),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(counters) != 2 || counters[0].CounterID != "counter-c" || counters[1].CounterID != "counter-b" {
+		t.Errorf("Unexpected counters %v", counters)
+	}
+	if _, err := dal.FindAggregateCounters("account-a"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+
+	affected, err := dal.DeleteAggregateCounters(persistence.DeleteAggregateCountersQueryBefore(day.AddDate(0, 0, -30)))
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result deleting counters: %d, %v", affected, err)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func (r *relationalDAL) CreateTrafficAnomaly(t *persistence.TrafficAnomaly) error {
+	local := importTrafficAnomaly(t)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating traffic anomaly: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindTrafficAnomalies(q interface{}) ([]persistence.TrafficAnomaly, error) {
+	var anomalies []TrafficAnomaly
+	switch query := q.(type) {
+	case persistence.FindTrafficAnomaliesQueryByAccountIDs:
+		if err := r.db.
+			Where("account_id IN (?) AND day >= ?", query.AccountIDs, query.Since).
+			Order("day DESC").
+			Find(&anomalies).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up traffic anomalies: %w", err)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	result := []persistence.TrafficAnomaly{}
+	for _, anomaly := range anomalies {
+		result = append(result, anomaly.export())
+	}
+	return result, nil
+}
+
+func (r *relationalDAL) DeleteTrafficAnomalies(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.DeleteTrafficAnomaliesQueryBefore:
+		deletion := r.db.Where("day < ?", time.Time(query)).Delete(&TrafficAnomaly{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting traffic anomalies: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
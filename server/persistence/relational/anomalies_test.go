@@ -0,0 +1,48 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_TrafficAnomalies(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	day := time.Date(2022, 5, 17, 0, 0, 0, 0, time.UTC)
+	for _, anomaly := range []*persistence.TrafficAnomaly{
+		{AnomalyID: "anomaly-a", AccountID: "account-a", Day: day.AddDate(0, 0, -40)},
+		{AnomalyID: "anomaly-b", AccountID: "account-a", Day: day.AddDate(0, 0, -2)},
+		{AnomalyID: "anomaly-c", AccountID: "account-a", Day: day},
+		{AnomalyID: "anomaly-d", AccountID: "account-b", Day: day},
+	} {
+		if err := dal.CreateTrafficAnomaly(anomaly); err != nil {
+			t.Fatalf("Unexpected error creating anomaly: %v", err)
+		}
+	}
+
+	anomalies, err := dal.FindTrafficAnomalies(persistence.FindTrafficAnomaliesQueryByAccountIDs{
+		AccountIDs: []string{"account-a"},
+		Since:      day.AddDate(0, 0, -30),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(anomalies) != 2 || anomalies[0].AnomalyID != "anomaly-c" || anomalies[1].AnomalyID != "anomaly-b" {
+		t.Errorf("Unexpected anomalies %v", anomalies)
+	}
+	if _, err := dal.FindTrafficAnomalies("account-a"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+
+	affected, err := dal.DeleteTrafficAnomalies(persistence.DeleteTrafficAnomaliesQueryBefore(day.AddDate(0, 0, -30)))
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result deleting anomalies: %d, %v", affected, err)
+	}
+}
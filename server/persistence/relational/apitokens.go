@@ -0,0 +1,61 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func (r *relationalDAL) CreateAPIToken(a *persistence.APIToken) error {
+	local := importAPIToken(a)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating api token: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindAPITokens(q interface{}) ([]persistence.APIToken, error) {
+	var tokens []APIToken
+	switch query := q.(type) {
+	case persistence.FindAPITokensQueryByHashedToken:
+		if err := r.db.Where("hashed_token = ?", string(query)).Find(&tokens).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up api token: %w", err)
+		}
+	case persistence.FindAPITokensQueryByAccountIDs:
+		if err := r.db.
+			Where("account_id IN (?)", []string(query)).
+			Order("created DESC").
+			Find(&tokens).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up api tokens: %w", err)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	var result []persistence.APIToken
+	for _, t := range tokens {
+		result = append(result, t.export())
+	}
+	return result, nil
+}
+
+func (r *relationalDAL) DeleteAPITokens(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.DeleteAPITokensQueryByID:
+		deletion := r.db.Where("token_id = ? AND account_id = ?", query.TokenID, query.AccountID).Delete(&APIToken{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting api token: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	case persistence.DeleteAPITokensQueryByAccountUserID:
+		deletion := r.db.Where("account_id = ? AND account_user_id = ?", query.AccountID, query.AccountUserID).Delete(&APIToken{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting api tokens of account user: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_APITokens(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	now := time.Now()
+	for _, token := range []*persistence.APIToken{
+		{TokenID: "token-a", AccountID: "account-a", HashedToken: "hash-a", Scopes: []string{"read-stats"}, Created: now.Add(-time.Minute)},
+		{TokenID: "token-b", AccountID: "account-a", HashedToken: "hash-b", Scopes: []string{"read-stats", "manage-account"}, Created: now},
+		{TokenID: "token-c", AccountID: "account-b", HashedToken: "hash-c", Scopes: []string{"read-stats"}, Created: now},
+	} {
+		if err := dal.CreateAPIToken(token); err != nil {
+			t.Fatalf("Unexpected error creating api token: %v", err)
+		}
+	}
+
+	tokens, err := dal.FindAPITokens(persistence.FindAPITokensQueryByHashedToken("hash-b"))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].TokenID != "token-b" {
+		t.Fatalf("Unexpected result %v", tokens)
+	}
+	if !reflect.DeepEqual(tokens[0].Scopes, []string{"read-stats", "manage-account"}) {
+		t.Errorf("Unexpected scopes %v", tokens[0].Scopes)
+	}
+
+	tokens, err = dal.FindAPITokens(persistence.FindAPITokensQueryByAccountIDs{"account-a"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(tokens) != 2 || tokens[0].TokenID != "token-b" || tokens[1].TokenID != "token-a" {
+		t.Errorf("Unexpected result %v", tokens)
+	}
+
+	if _, err := dal.FindAPITokens("hash-a"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+
+	affected, err := dal.DeleteAPITokens(persistence.DeleteAPITokensQueryByID{AccountID: "account-b", TokenID: "token-a"})
+	if err != nil || affected != 0 {
+		t.Errorf("Expected token of other account to be left untouched, got %d, %v", affected, err)
+	}
+	affected, err = dal.DeleteAPITokens(persistence.DeleteAPITokensQueryByID{AccountID: "account-a", TokenID: "token-a"})
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result revoking token: %d, %v", affected, err)
+	}
+
+	if err := dal.CreateAPIToken(&persistence.APIToken{TokenID: "token-d", AccountID: "account-a", AccountUserID: "user-a", HashedToken: "hash-d"}); err != nil {
+		t.Fatalf("Unexpected error creating api token: %v", err)
+	}
+	affected, err = dal.DeleteAPITokens(persistence.DeleteAPITokensQueryByAccountUserID{AccountID: "account-a", AccountUserID: "user-a"})
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result revoking tokens of account user: %d, %v", affected, err)
+	}
+}
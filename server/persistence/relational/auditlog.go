@@ -0,0 +1,53 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func (r *relationalDAL) CreateAuditLogEntry(e *persistence.AuditLogEntry) error {
+	local := importAuditLogEntry(e)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating audit log entry: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindAuditLogEntries(q interface{}) ([]persistence.AuditLogEntry, error) {
+	switch query := q.(type) {
+	case persistence.FindAuditLogEntriesQueryByAccountID:
+		var entries []AuditLogEntry
+		db := r.db.Where("account_id = ?", query.AccountID).Order("entry_id DESC")
+		if query.Limit > 0 {
+			db = db.Limit(query.Limit)
+		}
+		if err := db.Find(&entries).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up audit log entries: %w", err)
+		}
+		result := []persistence.AuditLogEntry{}
+		for _, e := range entries {
+			result = append(result, e.export())
+		}
+		return result, nil
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+}
+
+func (r *relationalDAL) DeleteAuditLogEntries(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.DeleteAuditLogEntriesQueryOlderThan:
+		deletion := r.db.Where("timestamp < ?", time.Time(query)).Delete(&AuditLogEntry{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting audit log entries: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func TestRelationalDAL_FindAuditLogEntries(t *testing.T) {
+	tests := []struct {
+		name           string
+		setup          dbAccess
+		query          interface{}
+		expectedResult []persistence.AuditLogEntry
+		expectError    bool
+	}{
+		{
+			"bad query",
+			noop,
+			"query",
+			nil,
+			true,
+		},
+		{
+			"ok",
+			func(db *gorm.DB) error {
+				for _, e := range []AuditLogEntry{
+					{EntryID: "entry-a", AccountID: "account-a", Action: "login"},
+					{EntryID: "entry-b", AccountID: "account-b", Action: "login"},
+					{EntryID: "entry-c", AccountID: "account-a", Action: "purge"},
+				} {
+					if err := db.Create(&e).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			persistence.FindAuditLogEntriesQueryByAccountID{AccountID: "account-a", Limit: 10},
+			[]persistence.AuditLogEntry{
+				{EntryID: "entry-c", AccountID: "account-a", Action: "purge"},
+				{EntryID: "entry-a", AccountID: "account-a", Action: "login"},
+			},
+			false,
+		},
+		{
+			"limit",
+			func(db *gorm.DB) error {
+				for _, e := range []AuditLogEntry{
+					{EntryID: "entry-a", AccountID: "account-a", Action: "login"},
+					{EntryID: "entry-b", AccountID: "account-a", Action: "purge"},
+				} {
+					if err := db.Create(&e).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			persistence.FindAuditLogEntriesQueryByAccountID{AccountID: "account-a", Limit: 1},
+			[]persistence.AuditLogEntry{
+				{EntryID: "entry-b", AccountID: "account-a", Action: "purge"},
+			},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, closeDB := createTestDatabase()
+			defer closeDB()
+			if err := test.setup(db); err != nil {
+				t.Fatalf("Unexpected error setting up test: %v", err)
+			}
+			dal := NewRelationalDAL(db)
+			result, err := dal.FindAuditLogEntries(test.query)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			for i := range result {
+				result[i].Timestamp = time.Time{}
+			}
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestRelationalDAL_DeleteAuditLogEntries(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+
+	now := time.Now()
+	for _, e := range []AuditLogEntry{
+		{EntryID: "entry-a", AccountID: "account-a", Timestamp: now.Add(-time.Hour * 48)},
+		{EntryID: "entry-b", AccountID: "account-a", Timestamp: now},
+	} {
+		if err := db.Create(&e).Error; err != nil {
+			t.Fatalf("Unexpected error setting up test: %v", err)
+		}
+	}
+
+	dal := NewRelationalDAL(db)
+	affected, err := dal.DeleteAuditLogEntries(
+		persistence.DeleteAuditLogEntriesQueryOlderThan(now.Add(-time.Hour * 24)),
+	)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if affected != 1 {
+		t.Errorf("Expected 1 deleted entry, got %d", affected)
+	}
+
+	var remaining []AuditLogEntry
+	db.Find(&remaining)
+	if len(remaining) != 1 || remaining[0].EntryID != "entry-b" {
+		t.Errorf("Unexpected remaining entries %v", remaining)
+	}
+}
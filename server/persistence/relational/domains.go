@@ -0,0 +1,60 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func (r *relationalDAL) CreateAccountDomain(d *persistence.AccountDomain) error {
+	local := importAccountDomain(d)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating account domain: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindAccountDomains(q interface{}) ([]persistence.AccountDomain, error) {
+	var domains []AccountDomain
+	switch query := q.(type) {
+	case persistence.FindAccountDomainsQueryByAccountID:
+		if err := r.db.Where("account_id = ?", string(query)).Order("created ASC").Find(&domains).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up account domains: %w", err)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	var result []persistence.AccountDomain
+	for _, d := range domains {
+		result = append(result, d.export())
+	}
+	return result, nil
+}
+
+func (r *relationalDAL) UpdateAccountDomain(d *persistence.AccountDomain) error {
+	local := importAccountDomain(d)
+	if err := r.db.Save(&local).Error; err != nil {
+		return fmt.Errorf("relational: error updating account domain: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) DeleteAccountDomains(q interface{}) (int64, error) {
+	var deletion *gorm.DB
+	switch query := q.(type) {
+	case persistence.DeleteAccountDomainsQueryByID:
+		deletion = r.db.Where("domain_id = ? AND account_id = ?", query.DomainID, query.AccountID).Delete(&AccountDomain{})
+	case persistence.DeleteAccountDomainsQueryByAccountID:
+		deletion = r.db.Where("account_id = ?", string(query)).Delete(&AccountDomain{})
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+	if err := deletion.Error; err != nil {
+		return 0, fmt.Errorf("relational: error deleting account domains: %w", err)
+	}
+	return deletion.RowsAffected, nil
+}
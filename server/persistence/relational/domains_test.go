@@ -0,0 +1,54 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_AccountDomains(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	now := time.Now()
+	for _, domain := range []*persistence.AccountDomain{
+		{DomainID: "domain-a", AccountID: "account-a", Domain: "www.offen.dev", Token: "token-a", Created: now.Add(-time.Hour)},
+		{DomainID: "domain-b", AccountID: "account-a", Domain: "blog.offen.dev", Token: "token-b", Created: now},
+		{DomainID: "domain-c", AccountID: "account-c", Domain: "offen.dev", Token: "token-c", Created: now},
+	} {
+		if err := dal.CreateAccountDomain(domain); err != nil {
+			t.Fatalf("Unexpected error creating account domain: %v", err)
+		}
+	}
+
+	domains, err := dal.FindAccountDomains(persistence.FindAccountDomainsQueryByAccountID("account-a"))
+	if err != nil || len(domains) != 2 || domains[0].DomainID != "domain-a" || domains[1].DomainID != "domain-b" {
+		t.Fatalf("Unexpected result %v, %v", domains, err)
+	}
+	if !domains[0].Verified.IsZero() {
+		t.Errorf("Expected domain to be unverified, got %v", domains[0].Verified)
+	}
+
+	domains[0].Verified = now
+	if err := dal.UpdateAccountDomain(&domains[0]); err != nil {
+		t.Fatalf("Unexpected error updating account domain: %v", err)
+	}
+	domains, _ = dal.FindAccountDomains(persistence.FindAccountDomainsQueryByAccountID("account-a"))
+	if len(domains) == 0 || domains[0].Verified.IsZero() {
+		t.Errorf("Expected domain to be verified, got %v", domains)
+	}
+
+	affected, err := dal.DeleteAccountDomains(persistence.DeleteAccountDomainsQueryByID{AccountID: "account-a", DomainID: "domain-c"})
+	if err != nil || affected != 0 {
+		t.Errorf("Expected domain of other account to be kept, got %d, %v", affected, err)
+	}
+	affected, err = dal.DeleteAccountDomains(persistence.DeleteAccountDomainsQueryByAccountID("account-a"))
+	if err != nil || affected != 2 {
+		t.Errorf("Unexpected result deleting account domains %d, %v", affected, err)
+	}
+}
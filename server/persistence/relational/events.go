@@ -4,15 +4,75 @@
 package relational
 
 import (
+	"database/sql"
 	"fmt"
+	"sort"
 
 	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
 )
 
 func (r *relationalDAL) CreateEvent(e *persistence.Event) error {
 	local := importEvent(e)
-	if err := r.db.Create(&local).Error; err != nil {
-		return fmt.Errorf("relational: error creating event: %w", err)
+	if err := r.db.Transaction(func(tx *gorm.DB) error {
+		first, err := reserveSequenceNumbers(tx, local.AccountID, 1)
+		if err != nil {
+			return err
+		}
+		local.SequenceNumber = first
+		if err := tx.Create(&local).Error; err != nil {
+			return fmt.Errorf("relational: error creating event: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	e.SequenceNumber = local.SequenceNumber
+	return nil
+}
+
+const createEventsBatchSize = 500
+
+func (r *relationalDAL) CreateEvents(evts []*persistence.Event) error {
+	if len(evts) == 0 {
+		return nil
+	}
+	local := make([]Event, len(evts))
+	counts := map[string]int64{}
+	for i, e := range evts {
+		local[i] = importEvent(e)
+		counts[e.AccountID]++
+	}
+	// counters are always locked in the same order so that concurrent
+	// batches for overlapping accounts cannot deadlock
+	accountIDs := make([]string, 0, len(counts))
+	for accountID := range counts {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Strings(accountIDs)
+
+	if err := r.db.Transaction(func(tx *gorm.DB) error {
+		next := map[string]int64{}
+		for _, accountID := range accountIDs {
+			first, err := reserveSequenceNumbers(tx, accountID, counts[accountID])
+			if err != nil {
+				return err
+			}
+			next[accountID] = first
+		}
+		for i := range local {
+			local[i].SequenceNumber = next[local[i].AccountID]
+			next[local[i].AccountID]++
+		}
+		if err := tx.CreateInBatches(&local, createEventsBatchSize).Error; err != nil {
+			return fmt.Errorf("relational: error creating events: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for i, e := range evts {
+		e.SequenceNumber = local[i].SequenceNumber
 	}
 	return nil
 }
@@ -28,29 +88,49 @@ func exportEvents(evts []Event) []persistence.Event {
 func (r *relationalDAL) FindEvents(q interface{}) ([]persistence.Event, error) {
 	var events []Event
 	switch query := q.(type) {
-	case persistence.FindEventsQueryOlderThan:
-		if err := r.db.Find(&events, "event_id < ?", query).Error; err != nil {
+	case persistence.FindEventsQueryExpired:
+		if err := expiredEvents(r.db, query.Before, query.AccountID, query.ExcludeAccountIDs, query.EventType).Find(&events).Error; err != nil {
 			return nil, fmt.Errorf("relational: error looking up events by age: %w", err)
 		}
 		return exportEvents(events), nil
 	case persistence.FindEventsQueryForSecretIDs:
-		var eventConditions []interface{}
+		queryDB := r.db.Where("secret_id in (?)", query.SecretIDs)
 		if query.Since != "" {
-			eventConditions = []interface{}{
-				"sequence > ? AND secret_id in (?)",
-				query.Since,
-				query.SecretIDs,
-			}
-		} else {
-			eventConditions = []interface{}{
-				"secret_id in (?)", query.SecretIDs,
-			}
+			queryDB = queryDB.Where("sequence > ?", query.Since)
 		}
-
-		if err := r.db.Find(&events, eventConditions...).Error; err != nil {
+		queryDB = sinceSequenceNumbers(queryDB, query.SinceSequenceNumbers)
+		if query.After != "" {
+			queryDB = queryDB.Where("event_id > ?", query.After)
+		}
+		queryDB = queryDB.Order("event_id ASC")
+		if query.Limit > 0 {
+			queryDB = queryDB.Limit(query.Limit)
+		}
+		if err := queryDB.Find(&events).Error; err != nil {
 			return nil, fmt.Errorf("default: error looking up events: %w", err)
 		}
 		return exportEvents(events), nil
+	case persistence.FindEventsQueryByAccountID:
+		queryDB := r.db.Where("account_id = ? AND event_id > ?", query.AccountID, query.After).Order("event_id ASC")
+		if query.Limit > 0 {
+			queryDB = queryDB.Limit(query.Limit)
+		}
+		if err := queryDB.Find(&events).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up events by account id: %w", err)
+		}
+		return exportEvents(events), nil
+	case persistence.FindEventsQueryNthNewest:
+		if query.N < 1 {
+			return nil, persistence.ErrBadQuery
+		}
+		scope := r.db.Where("account_id = ?", query.AccountID)
+		if query.EventType != "" {
+			scope = scope.Where("event_type = ?", query.EventType)
+		}
+		if err := scope.Order("event_id DESC").Offset(int(query.N - 1)).Limit(1).Find(&events).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up nth newest event: %w", err)
+		}
+		return exportEvents(events), nil
 	case persistence.FindEventsQueryByEventIDs:
 		var limit int64 = 500
 		var offset int64
@@ -77,6 +157,40 @@ func (r *relationalDAL) FindEvents(q interface{}) ([]persistence.Event, error) {
 	}
 }
 
+func (r *relationalDAL) FindEventStats(q interface{}) (persistence.EventStats, error) {
+	var queryDB *gorm.DB
+	switch query := q.(type) {
+	case persistence.FindEventStatsQueryByAccountID:
+		queryDB = r.db.Model(&Event{}).Where("account_id = ?", string(query))
+	case persistence.FindEventStatsQueryByAccountIDSince:
+		queryDB = r.db.Model(&Event{}).Where("account_id = ? AND event_id > ?", query.AccountID, query.Since)
+		if query.Until != "" {
+			queryDB = queryDB.Where("event_id < ?", query.Until)
+		}
+	case persistence.FindEventStatsQueryBySecretID:
+		queryDB = r.db.Model(&Event{}).Where("account_id = ? AND secret_id = ?", query.AccountID, query.SecretID)
+	default:
+		return persistence.EventStats{}, persistence.ErrBadQuery
+	}
+	var stats struct {
+		Count                int64
+		LatestEventID        sql.NullString
+		LatestSequence       sql.NullString
+		LatestSequenceNumber sql.NullInt64
+	}
+	if err := queryDB.
+		Select("COUNT(*) AS count, MAX(event_id) AS latest_event_id, MAX(sequence) AS latest_sequence, MAX(sequence_number) AS latest_sequence_number").
+		Scan(&stats).Error; err != nil {
+		return persistence.EventStats{}, fmt.Errorf("relational: error looking up event stats: %w", err)
+	}
+	return persistence.EventStats{
+		Count:                stats.Count,
+		LatestEventID:        stats.LatestEventID.String,
+		LatestSequence:       stats.LatestSequence.String,
+		LatestSequenceNumber: stats.LatestSequenceNumber.Int64,
+	}, nil
+}
+
 func (r *relationalDAL) DeleteEvents(q interface{}) (int64, error) {
 	switch query := q.(type) {
 	case persistence.DeleteEventsQueryByEventIDs:
@@ -94,8 +208,24 @@ func (r *relationalDAL) DeleteEvents(q interface{}) (int64, error) {
 			return 0, fmt.Errorf("relational: error deleting events: %w", err)
 		}
 		return deletion.RowsAffected, nil
-	case persistence.DeleteEventsQueryOlderThan:
-		deletion := r.db.Where("event_id < ?", query).Delete(&Event{})
+	case persistence.DeleteEventsQueryBySecretIDsForAccounts:
+		deletion := r.db.Where(
+			"secret_id IN (?) AND account_id IN (?)",
+			query.SecretIDs,
+			query.AccountIDs,
+		).Delete(&Event{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting events: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	case persistence.DeleteEventsQueryByAccountID:
+		deletion := r.db.Where("account_id = ?", string(query)).Delete(&Event{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting events by account id: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	case persistence.DeleteEventsQueryExpired:
+		deletion := expiredEvents(r.db, query.Before, query.AccountID, query.ExcludeAccountIDs, query.EventType).Delete(&Event{})
 		if err := deletion.Error; err != nil {
 			return 0, fmt.Errorf("relational: error deleting events: %w", err)
 		}
@@ -104,3 +234,20 @@ func (r *relationalDAL) DeleteEvents(q interface{}) (int64, error) {
 		return 0, persistence.ErrBadQuery
 	}
 }
+
+// expiredEvents scopes the given db to events older than the given event id.
+// Excluded accounts are only applied when non-empty as an empty NOT IN
+// clause would not match any rows.
+func expiredEvents(db *gorm.DB, before, accountID string, excludeAccountIDs []string, eventType string) *gorm.DB {
+	scope := db.Where("event_id < ?", before)
+	if accountID != "" {
+		scope = scope.Where("account_id = ?", accountID)
+	}
+	if len(excludeAccountIDs) != 0 {
+		scope = scope.Where("account_id NOT IN (?)", excludeAccountIDs)
+	}
+	if eventType != "" {
+		scope = scope.Where("event_type = ?", eventType)
+	}
+	return scope
+}
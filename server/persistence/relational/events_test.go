@@ -53,6 +53,89 @@ func TestRelationalDAL_CreateEvent(t *testing.T) {
 	}
 }
 
+func TestRelationalDAL_CreateEvents(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+
+	dal := NewRelationalDAL(db)
+	if err := dal.CreateEvents([]*persistence.Event{
+		{EventID: "event-a", Payload: "payload-a"},
+		{EventID: "event-b", Payload: "payload-b"},
+	}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	var count int64
+	if err := db.Model(&Event{}).Count(&count).Error; err != nil || count != 2 {
+		t.Errorf("Unexpected count %d, %v", count, err)
+	}
+	if err := dal.CreateEvents(nil); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestRelationalDAL_CreateEvents_sequenceNumbers(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+
+	dal := NewRelationalDAL(db)
+	evts := []*persistence.Event{
+		{EventID: "event-a", SecretID: strptr("secret"), AccountID: "account-a"},
+		{EventID: "event-b", SecretID: strptr("secret"), AccountID: "account-b"},
+		{EventID: "event-c", SecretID: strptr("secret"), AccountID: "account-a"},
+	}
+	if err := dal.CreateEvents(evts); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	next := &persistence.Event{EventID: "event-d", SecretID: strptr("secret"), AccountID: "account-a"}
+	if err := dal.CreateEvent(next); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if evts[0].SequenceNumber != 1 || evts[1].SequenceNumber != 1 || evts[2].SequenceNumber != 2 || next.SequenceNumber != 3 {
+		t.Errorf("Unexpected sequence numbers %d, %d, %d, %d", evts[0].SequenceNumber, evts[1].SequenceNumber, evts[2].SequenceNumber, next.SequenceNumber)
+	}
+
+	result, err := dal.FindEvents(persistence.FindEventsQueryForSecretIDs{
+		SecretIDs:            []string{"secret"},
+		SinceSequenceNumbers: map[string]int64{"account-a": 2},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	var eventIDs []string
+	for _, e := range result {
+		eventIDs = append(eventIDs, e.EventID)
+	}
+	if !reflect.DeepEqual(eventIDs, []string{"event-b", "event-d"}) {
+		t.Errorf("Unexpected events %v", eventIDs)
+	}
+}
+
+func TestRelationalDAL_ReserveSequenceNumbers(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+
+	// events stored before sequence numbers were counted per account
+	for _, evt := range []Event{
+		{EventID: "event-a", AccountID: "account-a", SequenceNumber: 5},
+		{EventID: "event-b", AccountID: "account-b", SequenceNumber: 9},
+	} {
+		if err := db.Save(&evt).Error; err != nil {
+			t.Fatalf("Unexpected error creating fixture record: %v", err)
+		}
+	}
+
+	dal := NewRelationalDAL(db)
+	for _, expected := range []int64{6, 8} {
+		first, err := dal.ReserveSequenceNumbers("account-a", 2)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if first != expected {
+			t.Errorf("Expected %d, got %d", expected, first)
+		}
+	}
+}
+
 func TestRelationalDAL_FindEvents(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -88,6 +171,76 @@ func TestRelationalDAL_FindEvents(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"by account id",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"d", "a", "c", "b"} {
+					if err := db.Save(&Event{
+						EventID:   fmt.Sprintf("event-%s", token),
+						AccountID: "account-a",
+					}).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return db.Save(&Event{EventID: "event-e", AccountID: "account-b"}).Error
+			},
+			persistence.FindEventsQueryByAccountID{AccountID: "account-a", After: "event-a", Limit: 2},
+			[]persistence.Event{
+				{EventID: "event-b", AccountID: "account-a"},
+				{EventID: "event-c", AccountID: "account-a"},
+			},
+			false,
+		},
+		{
+			"expired",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"a", "b", "c"} {
+					for _, accountID := range []string{"account-a", "account-b", "account-c"} {
+						if err := db.Save(&Event{
+							EventID:   fmt.Sprintf("event-%s-%s", token, accountID),
+							AccountID: accountID,
+						}).Error; err != nil {
+							return fmt.Errorf("error saving fixture data: %v", err)
+						}
+					}
+				}
+				return nil
+			},
+			persistence.FindEventsQueryExpired{Before: "event-b", ExcludeAccountIDs: []string{"account-b"}},
+			[]persistence.Event{
+				{EventID: "event-a-account-a", AccountID: "account-a"},
+				{EventID: "event-a-account-c", AccountID: "account-c"},
+			},
+			false,
+		},
+		{
+			"nth newest",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"d", "a", "c", "b"} {
+					if err := db.Save(&Event{
+						EventID:   fmt.Sprintf("event-%s", token),
+						AccountID: "account-a",
+					}).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return db.Save(&Event{EventID: "event-e", AccountID: "account-b"}).Error
+			},
+			persistence.FindEventsQueryNthNewest{AccountID: "account-a", N: 3},
+			[]persistence.Event{
+				{EventID: "event-b", AccountID: "account-a"},
+			},
+			false,
+		},
+		{
+			"nth newest - not enough events",
+			func(db *gorm.DB) error {
+				return db.Save(&Event{EventID: "event-a", AccountID: "account-a"}).Error
+			},
+			persistence.FindEventsQueryNthNewest{AccountID: "account-a", N: 3},
+			[]persistence.Event{},
+			false,
+		},
 		{
 			"by secret id - all events",
 			func(db *gorm.DB) error {
@@ -133,6 +286,79 @@ func TestRelationalDAL_FindEvents(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"by secret id - using limit",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"c", "a", "b"} {
+					if err := db.Save(&Event{
+						EventID:  fmt.Sprintf("event-%s", token),
+						Sequence: fmt.Sprintf("event-%s", token),
+						SecretID: strptr("hashed-user-id-a"),
+					}).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindEventsQueryForSecretIDs{
+				SecretIDs: []string{"hashed-user-id-a"},
+				Limit:     2,
+			},
+			[]persistence.Event{
+				{EventID: "event-a", Sequence: "event-a", SecretID: strptr("hashed-user-id-a")},
+				{EventID: "event-b", Sequence: "event-b", SecretID: strptr("hashed-user-id-a")},
+			},
+			false,
+		},
+		{
+			"by secret id - ordered by event id",
+			func(db *gorm.DB) error {
+				for i, token := range []string{"c", "a", "b"} {
+					if err := db.Save(&Event{
+						EventID:  fmt.Sprintf("event-%s", token),
+						Sequence: fmt.Sprintf("seq-%d", i),
+						SecretID: strptr("hashed-user-id-a"),
+					}).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindEventsQueryForSecretIDs{
+				SecretIDs: []string{"hashed-user-id-a"},
+			},
+			[]persistence.Event{
+				{EventID: "event-a", Sequence: "seq-1", SecretID: strptr("hashed-user-id-a")},
+				{EventID: "event-b", Sequence: "seq-2", SecretID: strptr("hashed-user-id-a")},
+				{EventID: "event-c", Sequence: "seq-0", SecretID: strptr("hashed-user-id-a")},
+			},
+			false,
+		},
+		{
+			"by secret id - using after",
+			func(db *gorm.DB) error {
+				for i, token := range []string{"c", "a", "b"} {
+					if err := db.Save(&Event{
+						EventID:  fmt.Sprintf("event-%s", token),
+						Sequence: fmt.Sprintf("seq-%d", i),
+						SecretID: strptr("hashed-user-id-a"),
+					}).Error; err != nil {
+						return fmt.Errorf("error saving fixture data: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindEventsQueryForSecretIDs{
+				SecretIDs: []string{"hashed-user-id-a"},
+				Since:     "seq-0",
+				After:     "event-a",
+				Limit:     1,
+			},
+			[]persistence.Event{
+				{EventID: "event-b", Sequence: "seq-2", SecretID: strptr("hashed-user-id-a")},
+			},
+			false,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -228,6 +454,101 @@ func TestRelationalDAL_DeleteEvents(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			"by hashed ids for accounts",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"x", "y", "z"} {
+					accountID := "account-a"
+					if token == "z" {
+						accountID = "account-b"
+					}
+					if err := db.Save(&Event{
+						EventID:   fmt.Sprintf("event-%s", token),
+						AccountID: accountID,
+						SecretID:  strptr(fmt.Sprintf("hashed-user-id-%s", token)),
+					}).Error; err != nil {
+						return fmt.Errorf("error creating fixture record: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.DeleteEventsQueryBySecretIDsForAccounts{
+				SecretIDs:  []string{"hashed-user-id-y", "hashed-user-id-z"},
+				AccountIDs: []string{"account-a"},
+			},
+			1,
+			false,
+			func(db *gorm.DB) error {
+				var count int64
+				if err := db.Table("events").Count(&count).Error; err != nil {
+					return fmt.Errorf("error counting event rows: %v", err)
+				}
+				if count != 2 {
+					return fmt.Errorf("error counting event rows, got %d", count)
+				}
+				return nil
+			},
+		},
+		{
+			"by account id",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"x", "y", "z"} {
+					accountID := "account-a"
+					if token == "z" {
+						accountID = "account-b"
+					}
+					if err := db.Save(&Event{
+						EventID:   fmt.Sprintf("event-%s", token),
+						AccountID: accountID,
+					}).Error; err != nil {
+						return fmt.Errorf("error creating fixture record: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.DeleteEventsQueryByAccountID("account-a"),
+			2,
+			false,
+			func(db *gorm.DB) error {
+				var count int64
+				if err := db.Table("events").Where("account_id = ?", "account-b").Count(&count).Error; err != nil {
+					return fmt.Errorf("error counting event rows: %v", err)
+				}
+				if count != 1 {
+					return fmt.Errorf("error counting event rows, got %d", count)
+				}
+				return nil
+			},
+		},
+		{
+			"expired for account",
+			func(db *gorm.DB) error {
+				for _, token := range []string{"x", "y", "z"} {
+					for _, accountID := range []string{"account-a", "account-b"} {
+						if err := db.Save(&Event{
+							EventID:   fmt.Sprintf("event-%s-%s", token, accountID),
+							AccountID: accountID,
+						}).Error; err != nil {
+							return fmt.Errorf("error creating fixture record: %v", err)
+						}
+					}
+				}
+				return nil
+			},
+			persistence.DeleteEventsQueryExpired{Before: "event-z", AccountID: "account-a"},
+			2,
+			false,
+			func(db *gorm.DB) error {
+				var count int64
+				if err := db.Table("events").Count(&count).Error; err != nil {
+					return fmt.Errorf("error counting event rows: %v", err)
+				}
+				if count != 4 {
+					return fmt.Errorf("error counting event rows, got %d", count)
+				}
+				return nil
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -255,3 +576,121 @@ func TestRelationalDAL_DeleteEvents(t *testing.T) {
 		})
 	}
 }
+
+func TestRelationalDAL_FindEventStats(t *testing.T) {
+	tests := []struct {
+		name           string
+		setup          dbAccess
+		query          interface{}
+		expectedResult persistence.EventStats
+		expectError    bool
+	}{
+		{
+			"bad query",
+			noop,
+			"account-a",
+			persistence.EventStats{},
+			true,
+		},
+		{
+			"empty",
+			noop,
+			persistence.FindEventStatsQueryByAccountID("account-a"),
+			persistence.EventStats{},
+			false,
+		},
+		{
+			"ok",
+			func(db *gorm.DB) error {
+				for _, evt := range []Event{
+					{EventID: "event-a", Sequence: "seq-c", AccountID: "account-a"},
+					{EventID: "event-b", Sequence: "seq-a", AccountID: "account-a"},
+					{EventID: "event-c", Sequence: "seq-z", AccountID: "account-b"},
+				} {
+					if err := db.Save(&evt).Error; err != nil {
+						return fmt.Errorf("error creating fixture record: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindEventStatsQueryByAccountID("account-a"),
+			persistence.EventStats{Count: 2, LatestEventID: "event-b", LatestSequence: "seq-c"},
+			false,
+		},
+		{
+			"since",
+			func(db *gorm.DB) error {
+				for _, evt := range []Event{
+					{EventID: "event-a", Sequence: "seq-c", AccountID: "account-a"},
+					{EventID: "event-b", Sequence: "seq-a", AccountID: "account-a"},
+					{EventID: "event-c", Sequence: "seq-z", AccountID: "account-b"},
+				} {
+					if err := db.Save(&evt).Error; err != nil {
+						return fmt.Errorf("error creating fixture record: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindEventStatsQueryByAccountIDSince{AccountID: "account-a", Since: "event-a"},
+			persistence.EventStats{Count: 1, LatestEventID: "event-b", LatestSequence: "seq-a"},
+			false,
+		},
+		{
+			"until",
+			func(db *gorm.DB) error {
+				for _, evt := range []Event{
+					{EventID: "event-a", Sequence: "seq-c", AccountID: "account-a"},
+					{EventID: "event-b", Sequence: "seq-a", AccountID: "account-a"},
+					{EventID: "event-c", Sequence: "seq-b", AccountID: "account-a"},
+				} {
+					if err := db.Save(&evt).Error; err != nil {
+						return fmt.Errorf("error creating fixture record: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindEventStatsQueryByAccountIDSince{AccountID: "account-a", Since: "event-a", Until: "event-c"},
+			persistence.EventStats{Count: 1, LatestEventID: "event-b", LatestSequence: "seq-a"},
+			false,
+		},
+		{
+			"by secret id",
+			func(db *gorm.DB) error {
+				for _, evt := range []Event{
+					{EventID: "event-a", Sequence: "seq-a", SequenceNumber: 3, AccountID: "account-a", SecretID: strptr("secret-a")},
+					{EventID: "event-b", Sequence: "seq-b", SequenceNumber: 1, AccountID: "account-a", SecretID: strptr("secret-a")},
+					{EventID: "event-c", Sequence: "seq-c", SequenceNumber: 7, AccountID: "account-a", SecretID: strptr("secret-b")},
+					{EventID: "event-d", Sequence: "seq-d", SequenceNumber: 9, AccountID: "account-b", SecretID: strptr("secret-a")},
+				} {
+					if err := db.Save(&evt).Error; err != nil {
+						return fmt.Errorf("error creating fixture record: %v", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindEventStatsQueryBySecretID{AccountID: "account-a", SecretID: "secret-a"},
+			persistence.EventStats{Count: 2, LatestEventID: "event-b", LatestSequence: "seq-b", LatestSequenceNumber: 3},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, closeDB := createTestDatabase()
+			defer closeDB()
+
+			dal := NewRelationalDAL(db)
+
+			if err := test.setup(db); err != nil {
+				t.Fatalf("Unexpected error setting up test: %v", err)
+			}
+
+			result, err := dal.FindEventStats(test.query)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
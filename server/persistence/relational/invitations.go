@@ -0,0 +1,57 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func (r *relationalDAL) CreateInvitation(i *persistence.Invitation) error {
+	local := importInvitation(i)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating invitation: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindInvitation(q interface{}) (persistence.Invitation, error) {
+	var invitation Invitation
+	switch query := q.(type) {
+	case persistence.FindInvitationQueryByID:
+		if err := r.db.Where("invitation_id = ?", string(query)).First(&invitation).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return invitation.export(), persistence.ErrUnknownInvitation("relational: no matching invitation found")
+			}
+			return invitation.export(), fmt.Errorf("relational: error looking up invitation: %w", err)
+		}
+		return invitation.export(), nil
+	default:
+		return invitation.export(), persistence.ErrBadQuery
+	}
+}
+
+func (r *relationalDAL) UpdateInvitation(i *persistence.Invitation) error {
+	local := importInvitation(i)
+	if err := r.db.Save(&local).Error; err != nil {
+		return fmt.Errorf("relational: error updating invitation: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) DeleteInvitations(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.DeleteInvitationsQueryByID:
+		deletion := r.db.Where("invitation_id = ?", string(query)).Delete(&Invitation{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting invitation: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
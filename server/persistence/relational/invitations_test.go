@@ -0,0 +1,70 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_Invitations(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	now := time.Now()
+	if err := dal.CreateInvitation(&persistence.Invitation{
+		InvitationID:  "invitation-a",
+		AccountUserID: "user-a",
+		Expires:       now.Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("Unexpected error creating invitation: %v", err)
+	}
+	for _, relationship := range []*persistence.AccountUserRelationship{
+		{RelationshipID: "relationship-a", AccountUserID: "user-a", AccountID: "account-a", InvitationID: "invitation-a"},
+		{RelationshipID: "relationship-b", AccountUserID: "user-a", AccountID: "account-b", InvitationID: "invitation-a", PasswordEncryptedKeyEncryptionKey: "key"},
+		{RelationshipID: "relationship-c", AccountUserID: "user-b", AccountID: "account-a"},
+	} {
+		if err := dal.CreateAccountUserRelationship(relationship); err != nil {
+			t.Fatalf("Unexpected error creating relationship: %v", err)
+		}
+	}
+
+	invitation, err := dal.FindInvitation(persistence.FindInvitationQueryByID("invitation-a"))
+	if err != nil || invitation.AccountUserID != "user-a" {
+		t.Errorf("Unexpected result %v, %v", invitation, err)
+	}
+	var unknown persistence.ErrUnknownInvitation
+	if _, err := dal.FindInvitation(persistence.FindInvitationQueryByID("invitation-z")); !errors.As(err, &unknown) {
+		t.Errorf("Expected unknown invitation error, got %v", err)
+	}
+	if _, err := dal.FindInvitation("invitation-a"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+
+	invitation.Expires = now.Add(time.Hour * 2)
+	if err := dal.UpdateInvitation(&invitation); err != nil {
+		t.Errorf("Unexpected error updating invitation: %v", err)
+	}
+
+	relationships, err := dal.FindAccountUserRelationships(persistence.FindAccountUserRelationshipsQueryByInvitationID("invitation-a"))
+	if err != nil || len(relationships) != 2 {
+		t.Errorf("Unexpected relationships %v, %v", relationships, err)
+	}
+	if err := dal.DeleteAccountUserRelationships(persistence.DeleteAccountUserRelationshipsQueryPendingByInvitationID("invitation-a")); err != nil {
+		t.Errorf("Unexpected error deleting relationships: %v", err)
+	}
+	relationships, _ = dal.FindAccountUserRelationships(persistence.FindAccountUserRelationshipsQueryByInvitationID("invitation-a"))
+	if len(relationships) != 1 || relationships[0].RelationshipID != "relationship-b" {
+		t.Errorf("Expected accepted relationship to be kept, got %v", relationships)
+	}
+
+	affected, err := dal.DeleteInvitations(persistence.DeleteInvitationsQueryByID("invitation-a"))
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result deleting invitation: %d, %v", affected, err)
+	}
+}
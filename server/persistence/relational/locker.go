@@ -0,0 +1,89 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/offen/offen/server/lock"
+	"gorm.io/gorm"
+)
+
+// AdvisoryLocker acquires named locks using the advisory locks of the
+// underlying database, so they are shared between all instances connected
+// to the same database. Dialects without support for advisory locks
+// (i.e. SQLite) fall back to locks that are local to the current process.
+type AdvisoryLocker struct {
+	db    *gorm.DB
+	local lock.Locker
+}
+
+// NewAdvisoryLocker creates a new AdvisoryLocker for the given database.
+func NewAdvisoryLocker(db *gorm.DB) *AdvisoryLocker {
+	return &AdvisoryLocker{db: db, local: lock.NewLocal()}
+}
+
+// Shared returns whether acquired locks are shared with other processes.
+func (a *AdvisoryLocker) Shared() bool {
+	switch a.db.Config.Dialector.Name() {
+	case "postgres", "mysql":
+		return true
+	default:
+		return false
+	}
+}
+
+// TryLock tries to acquire the lock with the given name without blocking.
+func (a *AdvisoryLocker) TryLock(name string) (func(), bool, error) {
+	switch a.db.Config.Dialector.Name() {
+	case "postgres":
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		key := int64(h.Sum64())
+		return a.tryLockSession(
+			"SELECT pg_try_advisory_lock($1)", "SELECT pg_advisory_unlock($1)", key,
+		)
+	case "mysql":
+		// MySQL limits lock names to 64 characters
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		key := fmt.Sprintf("offen:%x", h.Sum64())
+		return a.tryLockSession(
+			"SELECT COALESCE(GET_LOCK(?, 0), 0) = 1", "SELECT RELEASE_LOCK(?)", key,
+		)
+	default:
+		return a.local.TryLock(name)
+	}
+}
+
+// tryLockSession acquires a session level lock, which requires the lock
+// to be released on the same connection it has been acquired on.
+func (a *AdvisoryLocker) tryLockSession(lockQuery, unlockQuery string, key interface{}) (func(), bool, error) {
+	sqlDB, err := a.db.DB()
+	if err != nil {
+		return nil, false, fmt.Errorf("relational: error accessing underlying database connection: %w", err)
+	}
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("relational: error acquiring connection: %w", err)
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, lockQuery, key).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("relational: error acquiring advisory lock: %w", err)
+	}
+	if !acquired {
+		conn.Close()
+		return nil, false, nil
+	}
+	return func() {
+		// closing the connection would release the lock as well, but the
+		// connection is returned to the pool instead
+		conn.ExecContext(ctx, unlockQuery, key)
+		conn.Close()
+	}, true, nil
+}
@@ -0,0 +1,31 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import "testing"
+
+func TestAdvisoryLocker(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+
+	locker := NewAdvisoryLocker(db)
+	if locker.Shared() {
+		t.Error("Expected SQLite locks not to be shared")
+	}
+
+	release, acquired, err := locker.TryLock("job:expire")
+	if err != nil || !acquired {
+		t.Fatalf("Unexpected result %v %v", acquired, err)
+	}
+	if _, acquired, _ := locker.TryLock("job:expire"); acquired {
+		t.Error("Expected lock to be held")
+	}
+	if _, acquired, _ := locker.TryLock("job:backup"); !acquired {
+		t.Error("Expected other lock to be acquired")
+	}
+	release()
+	if _, acquired, _ := locker.TryLock("job:expire"); !acquired {
+		t.Error("Expected lock to be acquired after release")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func (r *relationalDAL) CreateQueuedMail(q *persistence.QueuedMail) error {
+	local := importQueuedMail(q)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating queued mail: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindQueuedMails(q interface{}) ([]persistence.QueuedMail, error) {
+	var mails []QueuedMail
+	switch query := q.(type) {
+	case persistence.FindQueuedMailsQueryDue:
+		lookup := r.db.
+			Where("failed = ? AND next_attempt <= ?", false, query.Before).
+			Order("next_attempt ASC")
+		if query.Limit > 0 {
+			lookup = lookup.Limit(query.Limit)
+		}
+		if err := lookup.Find(&mails).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up due mails: %w", err)
+		}
+	case persistence.FindQueuedMailsQueryFailed:
+		if err := r.db.
+			Where("failed = ?", true).
+			Order("created DESC").
+			Find(&mails).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up failed mails: %w", err)
+		}
+	case persistence.FindQueuedMailsQueryByID:
+		if err := r.db.Where("mail_id = ?", string(query)).Find(&mails).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up mail: %w", err)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	var result []persistence.QueuedMail
+	for _, m := range mails {
+		result = append(result, m.export())
+	}
+	return result, nil
+}
+
+func (r *relationalDAL) UpdateQueuedMail(q *persistence.QueuedMail) error {
+	local := importQueuedMail(q)
+	if err := r.db.Save(&local).Error; err != nil {
+		return fmt.Errorf("relational: error updating queued mail: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) DeleteQueuedMails(q interface{}) (int64, error) {
+	var deletion *gorm.DB
+	switch query := q.(type) {
+	case persistence.DeleteQueuedMailsQueryByID:
+		deletion = r.db.Where("mail_id = ?", string(query)).Delete(&QueuedMail{})
+	case persistence.DeleteQueuedMailsQueryCreatedBefore:
+		deletion = r.db.Where("created < ?", time.Time(query)).Delete(&QueuedMail{})
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+	if err := deletion.Error; err != nil {
+		return 0, fmt.Errorf("relational: error deleting queued mails: %w", err)
+	}
+	return deletion.RowsAffected, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_QueuedMails(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	now := time.Now()
+	for _, mail := range []*persistence.QueuedMail{
+		{MailID: "mail-a", From: "no-reply@offen.dev", To: "a@offen.dev", Body: "a", NextAttempt: now.Add(-time.Minute), Created: now.Add(-time.Hour)},
+		{MailID: "mail-b", From: "no-reply@offen.dev", To: "b@offen.dev", Body: "b", NextAttempt: now.Add(-time.Hour), Created: now.Add(-time.Hour)},
+		{MailID: "mail-c", From: "no-reply@offen.dev", To: "c@offen.dev", Body: "c", NextAttempt: now.Add(time.Hour), Created: now},
+		{MailID: "mail-d", From: "no-reply@offen.dev", To: "d@offen.dev", Body: "d", NextAttempt: now.Add(-time.Hour), Failed: true, Created: now},
+	} {
+		if err := dal.CreateQueuedMail(mail); err != nil {
+			t.Fatalf("Unexpected error creating queued mail: %v", err)
+		}
+	}
+
+	mails, err := dal.FindQueuedMails(persistence.FindQueuedMailsQueryDue{Before: now})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(mails) != 2 || mails[0].MailID != "mail-b" || mails[1].MailID != "mail-a" {
+		t.Errorf("Unexpected result %v", mails)
+	}
+	if mails[0].From != "no-reply@offen.dev" || mails[0].To != "b@offen.dev" {
+		t.Errorf("Unexpected addresses %v", mails[0])
+	}
+
+	mails, err = dal.FindQueuedMails(persistence.FindQueuedMailsQueryDue{Before: now, Limit: 1})
+	if err != nil || len(mails) != 1 {
+		t.Errorf("Unexpected result with limit: %v, %v", mails, err)
+	}
+
+	mails, err = dal.FindQueuedMails(persistence.FindQueuedMailsQueryFailed{})
+	if err != nil || len(mails) != 1 || mails[0].MailID != "mail-d" {
+		t.Errorf("Unexpected result for failed mails: %v, %v", mails, err)
+	}
+
+	update := mails[0]
+	update.Failed = false
+	update.Attempts = 3
+	if err := dal.UpdateQueuedMail(&update); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	mails, err = dal.FindQueuedMails(persistence.FindQueuedMailsQueryByID("mail-d"))
+	if err != nil || len(mails) != 1 || mails[0].Failed || mails[0].Attempts != 3 {
+		t.Errorf("Unexpected result after update: %v, %v", mails, err)
+	}
+
+	if _, err := dal.FindQueuedMails("mail-a"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+
+	affected, err := dal.DeleteQueuedMails(persistence.DeleteQueuedMailsQueryByID("mail-a"))
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result deleting mail: %d, %v", affected, err)
+	}
+	affected, err = dal.DeleteQueuedMails(persistence.DeleteQueuedMailsQueryCreatedBefore(now.Add(-time.Minute)))
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result expiring mails: %d, %v", affected, err)
+	}
+	mails, err = dal.FindQueuedMails(persistence.FindQueuedMailsQueryByID("mail-b"))
+	if err != nil || len(mails) != 0 {
+		t.Errorf("Expected mail to be expired, got %v, %v", mails, err)
+	}
+	if _, err := dal.DeleteQueuedMails("mail-a"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/metrics"
+	"gorm.io/gorm"
+)
+
+const queryStartKey = "offen:query_start"
+
+// ObserveQueries registers callbacks on the given database that record the
+// duration of each statement in the given registry.
+func ObserveQueries(db *gorm.DB, registry *metrics.Registry) error {
+	durations := registry.Histogram(
+		"offen_db_query_duration_seconds",
+		"Duration of database queries in seconds.",
+		metrics.DefaultBuckets,
+		"operation", "table",
+	)
+
+	start := func(db *gorm.DB) {
+		db.InstanceSet(queryStartKey, time.Now())
+	}
+	observe := func(operation string) func(*gorm.DB) {
+		return func(db *gorm.DB) {
+			value, ok := db.InstanceGet(queryStartKey)
+			if !ok {
+				return
+			}
+			if t, ok := value.(time.Time); ok {
+				durations.Observe(time.Since(t).Seconds(), operation, db.Statement.Table)
+			}
+		}
+	}
+
+	callbacks := db.Callback()
+	type registration struct {
+		name   string
+		before func(string, func(*gorm.DB)) error
+		after  func(string, func(*gorm.DB)) error
+	}
+	registrations := []registration{
+		{"create", callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register},
+		{"query", callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register},
+		{"update", callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register},
+		{"delete", callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register},
+		{"row", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"raw", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	}
+	for _, r := range registrations {
+		if err := r.before(fmt.Sprintf("offen:before_%s", r.name), start); err != nil {
+			return fmt.Errorf("relational: error registering callback for %s: %w", r.name, err)
+		}
+		if err := r.after(fmt.Sprintf("offen:after_%s", r.name), observe(r.name)); err != nil {
+			return fmt.Errorf("relational: error registering callback for %s: %w", r.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/offen/offen/server/metrics"
+)
+
+func TestObserveQueries(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+
+	registry := metrics.New()
+	if err := ObserveQueries(db, registry); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var accounts []Account
+	if err := db.Find(&accounts).Error; err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var buf bytes.Buffer
+	registry.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `offen_db_query_duration_seconds_count{operation="query",table="accounts"} 1`) {
+		t.Errorf("Expected query to be recorded, got %s", buf.String())
+	}
+}
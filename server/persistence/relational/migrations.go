@@ -14,7 +14,20 @@ import (
 )
 
 func (r *relationalDAL) ApplyMigrations() error {
-	m := gormigrate.New(r.db, gormigrate.DefaultOptions, []*gormigrate.Migration{
+	_, err := RunMigrations(r.db, MigrationOptions{})
+	return err
+}
+
+// migrationPhases lists all migrations that are not applied in the expand
+// phase. Contract migrations remove or rewrite parts of the schema that
+// older versions of the application still depend on, so they must only be
+// applied after all instances have been upgraded.
+var migrationPhases = map[string]MigrationPhase{}
+
+// migrations returns all migrations in the order they need to be applied.
+// Migrations must never be removed or reordered once released.
+func migrations() []*gormigrate.Migration {
+	return []*gormigrate.Migration{
 		{
 			ID: "001_introduce_admin_level",
 			Migrate: func(db *gorm.DB) error {
@@ -262,7 +275,7 @@ func (r *relationalDAL) ApplyMigrations() error {
 					EncryptedSecret string
 				}
 				if db.Config.Dialector.Name() == "mysql" {
-					return db.Exec("ALTER TABLE secrets MODIFY COLUMN encrypted_secret VARCHAR").Error
+					return db.Exec("ALTER TABLE secrets MODIFY COLUMN encrypted_secret VARCHAR(255)").Error
 				}
 				return nil
 			},
@@ -350,11 +363,858 @@ func (r *relationalDAL) ApplyMigrations() error {
 				return db.Migrator().DropColumn("accounts", "account_styles")
 			},
 		},
-	})
+		{
+			ID: "008_add_audit_log",
+			Migrate: func(db *gorm.DB) error {
+				type AuditLogEntry struct {
+					EntryID       string `gorm:"primary_key;size:26;unique"`
+					AccountID     string `gorm:"size:36;index"`
+					AccountUserID string `gorm:"size:36"`
+					Action        string `gorm:"size:64"`
+					Target        string `gorm:"size:64"`
+					Timestamp     time.Time
+				}
+				return db.AutoMigrate(&AuditLogEntry{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("audit_log_entries")
+			},
+		},
+		{
+			ID: "009_add_share_links",
+			Migrate: func(db *gorm.DB) error {
+				type ShareLink struct {
+					LinkID        string `gorm:"primary_key;size:26;unique"`
+					AccountID     string `gorm:"size:36;index"`
+					AccountUserID string `gorm:"size:36"`
+					Expires       time.Time
+				}
+				return db.AutoMigrate(&ShareLink{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("share_links")
+			},
+		},
+		{
+			ID: "010_add_sessions",
+			Migrate: func(db *gorm.DB) error {
+				type Session struct {
+					SessionID     string `gorm:"primary_key;size:32;unique"`
+					AccountUserID string `gorm:"size:36;index"`
+					Created       time.Time
+					Expires       time.Time
+				}
+				return db.AutoMigrate(&Session{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("sessions")
+			},
+		},
+		{
+			ID: "011_add_api_tokens",
+			Migrate: func(db *gorm.DB) error {
+				type APIToken struct {
+					TokenID       string `gorm:"primary_key;size:26;unique"`
+					AccountID     string `gorm:"size:36;index"`
+					AccountUserID string `gorm:"size:36"`
+					Name          string
+					HashedToken   string `gorm:"size:64;uniqueIndex"`
+					Scopes        string
+					Created       time.Time
+				}
+				return db.AutoMigrate(&APIToken{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("api_tokens")
+			},
+		},
+		{
+			ID: "012_add_account_retention_period",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					AccountStyles       string `gorm:"type:text"`
+					RetentionPeriod     string
+					Created             time.Time
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "retention_period")
+			},
+		},
+		{
+			ID: "013_add_account_user_totp",
+			Migrate: func(db *gorm.DB) error {
+				type AccountUser struct {
+					AccountUserID  string `gorm:"primary_key;size:36;unique"`
+					HashedEmail    string
+					HashedPassword string
+					Salt           string
+					AdminLevel     int
+					TOTPSecret     string
+					TOTPEnabled    bool
+					RecoveryCodes  string `gorm:"type:text"`
+				}
+				return db.AutoMigrate(&AccountUser{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				for _, column := range []string{"totp_secret", "totp_enabled", "recovery_codes"} {
+					if err := db.Migrator().DropColumn("account_users", column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "014_add_webauthn_credentials",
+			Migrate: func(db *gorm.DB) error {
+				type WebAuthnCredential struct {
+					CredentialID  string `gorm:"primary_key;size:255;unique"`
+					AccountUserID string `gorm:"size:36;index"`
+					Credential    string `gorm:"type:text"`
+					Created       time.Time
+				}
+				type AccountUser struct {
+					AccountUserID  string `gorm:"primary_key;size:36;unique"`
+					HashedEmail    string
+					HashedPassword string
+					Salt           string
+					AdminLevel     int
+					TOTPSecret     string
+					TOTPEnabled    bool
+					RecoveryCodes  string `gorm:"type:text"`
+					PasskeyKey     string `gorm:"type:text"`
+				}
+				type AccountUserRelationship struct {
+					RelationshipID                    string `gorm:"primary_key;size:36;unique"`
+					AccountUserID                     string `gorm:"size:36"`
+					AccountID                         string `gorm:"size:36"`
+					PasswordEncryptedKeyEncryptionKey string `gorm:"type:text"`
+					EmailEncryptedKeyEncryptionKey    string `gorm:"type:text"`
+					OneTimeEncryptedKeyEncryptionKey  string `gorm:"type:text"`
+					PasskeyEncryptedKeyEncryptionKey  string `gorm:"type:text"`
+				}
+				return db.AutoMigrate(&WebAuthnCredential{}, &AccountUser{}, &AccountUserRelationship{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				if err := db.Migrator().DropColumn("account_user_relationships", "passkey_encrypted_key_encryption_key"); err != nil {
+					return err
+				}
+				if err := db.Migrator().DropColumn("account_users", "passkey_key"); err != nil {
+					return err
+				}
+				return db.Migrator().DropTable("web_authn_credentials")
+			},
+		},
+		{
+			ID: "015_add_relationship_roles",
+			Migrate: func(db *gorm.DB) error {
+				type AccountUserRelationship struct {
+					RelationshipID                    string `gorm:"primary_key;size:36;unique"`
+					AccountUserID                     string `gorm:"size:36"`
+					AccountID                         string `gorm:"size:36"`
+					PasswordEncryptedKeyEncryptionKey string `gorm:"type:text"`
+					EmailEncryptedKeyEncryptionKey    string `gorm:"type:text"`
+					OneTimeEncryptedKeyEncryptionKey  string `gorm:"type:text"`
+					PasskeyEncryptedKeyEncryptionKey  string `gorm:"type:text"`
+					Role                              string `gorm:"size:16"`
+				}
+				if err := db.AutoMigrate(&AccountUserRelationship{}); err != nil {
+					return err
+				}
+				// existing super admins keep full control over their accounts,
+				// while all other users keep being able to edit styles
+				admins := db.Table("account_users").Select("account_user_id").Where("admin_level = ?", 1)
+				if err := db.Table("account_user_relationships").
+					Where("account_user_id IN (?)", admins).
+					Update("role", "admin").Error; err != nil {
+					return err
+				}
+				return db.Table("account_user_relationships").
+					Where("role IS NULL OR role = ?", "").
+					Update("role", "editor").Error
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("account_user_relationships", "role")
+			},
+		},
+		{
+			ID: "016_add_account_retired_at",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					RetiredAt           *time.Time
+					AccountStyles       string `gorm:"type:text"`
+					RetentionPeriod     string
+					Created             time.Time
+				}
+				if err := db.AutoMigrate(&Account{}); err != nil {
+					return err
+				}
+				// accounts that have been retired before cannot be restored
+				// as their relationships are gone, but they are purged after
+				// the grace period has passed
+				return db.Table("accounts").
+					Where("retired = ?", true).
+					Update("retired_at", time.Now()).Error
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "retired_at")
+			},
+		},
+		{
+			ID: "017_add_queued_mails",
+			Migrate: func(db *gorm.DB) error {
+				type QueuedMail struct {
+					MailID      string `gorm:"primary_key;size:26;unique"`
+					Sender      string
+					Recipient   string
+					Subject     string
+					Body        string `gorm:"type:text"`
+					Attempts    int
+					LastError   string    `gorm:"type:text"`
+					NextAttempt time.Time `gorm:"index"`
+					Failed      bool
+					Created     time.Time
+				}
+				return db.AutoMigrate(&QueuedMail{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("queued_mails")
+			},
+		},
+		{
+			ID: "018_mysql_convert_utf8mb4",
+			Migrate: func(db *gorm.DB) error {
+				if db.Config.Dialector.Name() != "mysql" {
+					return nil
+				}
+				return convertTablesToUTF8MB4(db)
+			},
+			Rollback: func(db *gorm.DB) error {
+				// the previous character set is unknown and converting back
+				// might lose data, so tables are kept as is
+				return nil
+			},
+		},
+		{
+			ID: "019_add_account_disabled",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					RetiredAt           *time.Time
+					Disabled            bool
+					AccountStyles       string `gorm:"type:text"`
+					RetentionPeriod     string
+					Created             time.Time
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "disabled")
+			},
+		},
+		{
+			ID: "020_add_invitations",
+			Migrate: func(db *gorm.DB) error {
+				type Invitation struct {
+					InvitationID  string `gorm:"primary_key;size:26;unique"`
+					AccountUserID string `gorm:"size:36"`
+					InvitedBy     string `gorm:"size:36"`
+					Created       time.Time
+					Expires       time.Time
+				}
+				type AccountUserRelationship struct {
+					RelationshipID                    string `gorm:"primary_key;size:36;unique"`
+					AccountUserID                     string `gorm:"size:36"`
+					AccountID                         string `gorm:"size:36"`
+					PasswordEncryptedKeyEncryptionKey string `gorm:"type:text"`
+					EmailEncryptedKeyEncryptionKey    string `gorm:"type:text"`
+					OneTimeEncryptedKeyEncryptionKey  string `gorm:"type:text"`
+					PasskeyEncryptedKeyEncryptionKey  string `gorm:"type:text"`
+					Role                              string `gorm:"size:16"`
+					InvitationID                      string `gorm:"size:26;index"`
+				}
+				return db.AutoMigrate(&Invitation{}, &AccountUserRelationship{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				if err := db.Migrator().DropColumn("account_user_relationships", "invitation_id"); err != nil {
+					return err
+				}
+				return db.Migrator().DropTable("invitations")
+			},
+		},
+		{
+			ID: "021_add_traffic_anomalies",
+			Migrate: func(db *gorm.DB) error {
+				type TrafficAnomaly struct {
+					AnomalyID string `gorm:"primary_key;size:26;unique"`
+					AccountID string `gorm:"size:36;index"`
+					Day       time.Time
+					Count     int64
+					Expected  float64
+					Deviation float64
+					Detected  time.Time
+				}
+				return db.AutoMigrate(&TrafficAnomaly{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("traffic_anomalies")
+			},
+		},
+		{
+			ID: "022_add_webhooks",
+			Migrate: func(db *gorm.DB) error {
+				type Webhook struct {
+					WebhookID string `gorm:"primary_key;size:26;unique"`
+					AccountID string `gorm:"size:36;index"`
+					URL       string `gorm:"type:text"`
+					Secret    string
+					Events    string
+					CreatedBy string `gorm:"size:36"`
+					Created   time.Time
+				}
 
-	m.InitSchema(func(db *gorm.DB) error {
-		return db.AutoMigrate(knownTables...)
-	})
+				type WebhookDelivery struct {
+					DeliveryID  string `gorm:"primary_key;size:26;unique"`
+					WebhookID   string `gorm:"size:26;index"`
+					AccountID   string `gorm:"size:36;index"`
+					Event       string `gorm:"size:64"`
+					Payload     string `gorm:"type:text"`
+					Attempts    int
+					StatusCode  int
+					LastError   string    `gorm:"type:text"`
+					NextAttempt time.Time `gorm:"index"`
+					Delivered   bool
+					Failed      bool
+					Created     time.Time
+				}
+				return db.AutoMigrate(&Webhook{}, &WebhookDelivery{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("webhooks", "webhook_deliveries")
+			},
+		},
+		{
+			ID: "023_add_account_retention_rules",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					RetiredAt           *time.Time
+					Disabled            bool
+					AccountStyles       string `gorm:"type:text"`
+					RetentionPeriod     string
+					RetentionRules      string `gorm:"type:text"`
+					Created             time.Time
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "retention_rules")
+			},
+		},
+		{
+			ID: "024_add_account_bot_policy",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					RetiredAt           *time.Time
+					Disabled            bool
+					AccountStyles       string `gorm:"type:text"`
+					RetentionPeriod     string
+					RetentionRules      string `gorm:"type:text"`
+					BotPolicy           string `gorm:"size:16"`
+					Created             time.Time
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "bot_policy")
+			},
+		},
+		{
+			ID: "025_add_account_domains",
+			Migrate: func(db *gorm.DB) error {
+				type AccountDomain struct {
+					DomainID  string `gorm:"primary_key;size:26;unique"`
+					AccountID string `gorm:"size:36;index"`
+					Domain    string
+					Token     string
+					CreatedBy string `gorm:"size:36"`
+					Created   time.Time
+					Verified  *time.Time
+				}
+				return db.AutoMigrate(&AccountDomain{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("account_domains")
+			},
+		},
+		{
+			ID: "026_add_account_allowed_origins",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					RetiredAt           *time.Time
+					Disabled            bool
+					AccountStyles       string `gorm:"type:text"`
+					RetentionPeriod     string
+					RetentionRules      string `gorm:"type:text"`
+					BotPolicy           string `gorm:"size:16"`
+					AllowedOrigins      string `gorm:"type:text"`
+					Created             time.Time
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "allowed_origins")
+			},
+		},
+		{
+			ID: "027_add_key_versions",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					RetiredAt           *time.Time
+					Disabled            bool
+					AccountStyles       string `gorm:"type:text"`
+					RetentionPeriod     string
+					RetentionRules      string `gorm:"type:text"`
+					BotPolicy           string `gorm:"size:16"`
+					AllowedOrigins      string `gorm:"type:text"`
+					KeyVersion          int
+					PreviousKeys        string `gorm:"type:text"`
+					Created             time.Time
+				}
+				type Secret struct {
+					SecretID        string `gorm:"primary_key;size:64;unique"`
+					EncryptedSecret string `gorm:"type:text"`
+					KeyVersion      int
+				}
+				type Event struct {
+					EventID    string  `gorm:"primary_key;size:26;unique"`
+					Sequence   string  `gorm:"size:26"`
+					AccountID  string  `gorm:"size:36"`
+					SecretID   *string `gorm:"size:64"`
+					Payload    string  `gorm:"type:text"`
+					KeyVersion int
+				}
+				return db.AutoMigrate(&Account{}, &Secret{}, &Event{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				for _, table := range []string{"accounts", "secrets", "events"} {
+					if err := db.Migrator().DropColumn(table, "key_version"); err != nil {
+						return err
+					}
+				}
+				return db.Migrator().DropColumn("accounts", "previous_keys")
+			},
+		},
+		{
+			ID: "028_add_account_user_lockout",
+			Migrate: func(db *gorm.DB) error {
+				type AccountUser struct {
+					AccountUserID  string `gorm:"primary_key;size:36;unique"`
+					HashedEmail    string
+					HashedPassword string
+					Salt           string
+					AdminLevel     int
+					TOTPSecret     string
+					TOTPEnabled    bool
+					RecoveryCodes  string `gorm:"type:text"`
+					PasskeyKey     string `gorm:"type:text"`
+					FailedLogins   int
+					LockedUntil    *time.Time
+				}
+				return db.AutoMigrate(&AccountUser{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				if err := db.Migrator().DropColumn("account_users", "failed_logins"); err != nil {
+					return err
+				}
+				return db.Migrator().DropColumn("account_users", "locked_until")
+			},
+		},
+		{
+			ID: "029_add_event_types",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					RetiredAt           *time.Time
+					Disabled            bool
+					AccountStyles       string `gorm:"type:text"`
+					RetentionPeriod     string
+					RetentionRules      string `gorm:"type:text"`
+					BotPolicy           string `gorm:"size:16"`
+					AllowedOrigins      string `gorm:"type:text"`
+					EventTypes          string `gorm:"type:text"`
+					KeyVersion          int
+					PreviousKeys        string `gorm:"type:text"`
+					Created             time.Time
+				}
+				type Event struct {
+					EventID    string  `gorm:"primary_key;size:26;unique"`
+					Sequence   string  `gorm:"size:26"`
+					AccountID  string  `gorm:"size:36"`
+					SecretID   *string `gorm:"size:64"`
+					Payload    string  `gorm:"type:text"`
+					KeyVersion int
+					EventType  string `gorm:"size:64"`
+				}
+				return db.AutoMigrate(&Account{}, &Event{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				if err := db.Migrator().DropColumn("accounts", "event_types"); err != nil {
+					return err
+				}
+				return db.Migrator().DropColumn("events", "event_type")
+			},
+		},
+		{
+			ID: "030_add_aggregate_counters",
+			Migrate: func(db *gorm.DB) error {
+				type AggregateCounter struct {
+					CounterID string `gorm:"primary_key;size:26;unique"`
+					AccountID string `gorm:"size:36;index"`
+					Day       time.Time
+					Count     int64
+					Epsilon   float64
+					Created   time.Time
+				}
+				return db.AutoMigrate(&AggregateCounter{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("aggregate_counters")
+			},
+		},
+		{
+			ID: "031_add_account_cookie_policy",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					RetiredAt           *time.Time
+					Disabled            bool
+					AccountStyles       string `gorm:"type:text"`
+					RetentionPeriod     string
+					RetentionRules      string `gorm:"type:text"`
+					BotPolicy           string `gorm:"size:16"`
+					AllowedOrigins      string `gorm:"type:text"`
+					EventTypes          string `gorm:"type:text"`
+					CookiePolicy        string `gorm:"type:text"`
+					KeyVersion          int
+					PreviousKeys        string `gorm:"type:text"`
+					Created             time.Time
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "cookie_policy")
+			},
+		},
+		{
+			ID: "032_add_ping_counters",
+			Migrate: func(db *gorm.DB) error {
+				type PingCounter struct {
+					AccountID string    `gorm:"primary_key;size:36"`
+					Day       time.Time `gorm:"primary_key"`
+					Count     int64
+				}
+				return db.AutoMigrate(&PingCounter{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropTable("ping_counters")
+			},
+		},
+		{
+			ID: "033_add_account_feature_flags",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					RetiredAt           *time.Time
+					Disabled            bool
+					AccountStyles       string `gorm:"type:text"`
+					RetentionPeriod     string
+					RetentionRules      string `gorm:"type:text"`
+					BotPolicy           string `gorm:"size:16"`
+					AllowedOrigins      string `gorm:"type:text"`
+					EventTypes          string `gorm:"type:text"`
+					CookiePolicy        string `gorm:"type:text"`
+					FeatureFlags        string `gorm:"type:text"`
+					KeyVersion          int
+					PreviousKeys        string `gorm:"type:text"`
+					Created             time.Time
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "feature_flags")
+			},
+		},
+		{
+			ID: "034_add_account_locale",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					RetiredAt           *time.Time
+					Disabled            bool
+					AccountStyles       string `gorm:"type:text"`
+					RetentionPeriod     string
+					RetentionRules      string `gorm:"type:text"`
+					BotPolicy           string `gorm:"size:16"`
+					AllowedOrigins      string `gorm:"type:text"`
+					EventTypes          string `gorm:"type:text"`
+					CookiePolicy        string `gorm:"type:text"`
+					FeatureFlags        string `gorm:"type:text"`
+					Locale              string `gorm:"size:16"`
+					KeyVersion          int
+					PreviousKeys        string `gorm:"type:text"`
+					Created             time.Time
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "locale")
+			},
+		},
+		{
+			ID: "035_add_account_theme",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					RetiredAt           *time.Time
+					Disabled            bool
+					AccountStyles       string `gorm:"type:text"`
+					RetentionPeriod     string
+					RetentionRules      string `gorm:"type:text"`
+					BotPolicy           string `gorm:"size:16"`
+					AllowedOrigins      string `gorm:"type:text"`
+					EventTypes          string `gorm:"type:text"`
+					CookiePolicy        string `gorm:"type:text"`
+					FeatureFlags        string `gorm:"type:text"`
+					Locale              string `gorm:"size:16"`
+					Theme               string `gorm:"type:text"`
+					KeyVersion          int
+					PreviousKeys        string `gorm:"type:text"`
+					Created             time.Time
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "theme")
+			},
+		},
+		{
+			ID: "036_add_sequence_numbers",
+			Migrate: func(db *gorm.DB) error {
+				type Event struct {
+					EventID        string  `gorm:"primary_key;size:26;unique"`
+					Sequence       string  `gorm:"size:26"`
+					SequenceNumber int64   `gorm:"index"`
+					AccountID      string  `gorm:"size:36"`
+					SecretID       *string `gorm:"size:64"`
+					Payload        string  `gorm:"type:text"`
+					KeyVersion     int
+					EventType      string `gorm:"size:64"`
+				}
+				type Tombstone struct {
+					EventID        string  `gorm:"primary_key"`
+					AccountID      string  `gorm:"size:36"`
+					SecretID       *string `gorm:"size:64"`
+					Sequence       string  `gorm:"size:26"`
+					SequenceNumber int64   `gorm:"index"`
+				}
+				type AccountSequence struct {
+					AccountID      string `gorm:"primary_key;size:36"`
+					SequenceNumber int64
+				}
+				if err := db.AutoMigrate(&Event{}, &Tombstone{}, &AccountSequence{}); err != nil {
+					return err
+				}
+				// existing rows are not numbered, clients holding a cursor
+				// will only receive events that are created from now on.
+				// Counters are created upfront so concurrent inserts do not
+				// race for initializing them.
+				return db.Exec(
+					"INSERT INTO account_sequences (account_id, sequence_number) SELECT account_id, 0 FROM accounts",
+				).Error
+			},
+			Rollback: func(db *gorm.DB) error {
+				if err := db.Migrator().DropTable("account_sequences"); err != nil {
+					return err
+				}
+				for _, table := range []string{"events", "tombstones"} {
+					if err := db.Migrator().DropIndex(table, fmt.Sprintf("idx_%s_sequence_number", table)); err != nil {
+						return err
+					}
+					if err := db.Migrator().DropColumn(table, "sequence_number"); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "037_add_account_write_keys",
+			Migrate: func(db *gorm.DB) error {
+				type Account struct {
+					AccountID           string `gorm:"primary_key;size:36;unique"`
+					Name                string
+					PublicKey           string `gorm:"type:text"`
+					EncryptedPrivateKey string `gorm:"type:text"`
+					UserSalt            string
+					Retired             bool
+					RetiredAt           *time.Time
+					Disabled            bool
+					AccountStyles       string `gorm:"type:text"`
+					RetentionPeriod     string
+					RetentionRules      string `gorm:"type:text"`
+					BotPolicy           string `gorm:"size:16"`
+					AllowedOrigins      string `gorm:"type:text"`
+					EventTypes          string `gorm:"type:text"`
+					CookiePolicy        string `gorm:"type:text"`
+					FeatureFlags        string `gorm:"type:text"`
+					Locale              string `gorm:"size:16"`
+					Theme               string `gorm:"type:text"`
+					WriteKeys           string `gorm:"type:text"`
+					KeyVersion          int
+					PreviousKeys        string `gorm:"type:text"`
+					Created             time.Time
+				}
+				return db.AutoMigrate(&Account{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("accounts", "write_keys")
+			},
+		},
+		{
+			ID: "038_add_account_user_totp_last_step",
+			Migrate: func(db *gorm.DB) error {
+				type AccountUser struct {
+					AccountUserID  string `gorm:"primary_key;size:36;unique"`
+					HashedEmail    string
+					HashedPassword string
+					Salt           string
+					AdminLevel     int
+					TOTPSecret     string
+					TOTPEnabled    bool
+					TOTPLastStep   int64
+					RecoveryCodes  string `gorm:"type:text"`
+					PasskeyKey     string `gorm:"type:text"`
+					FailedLogins   int
+					LockedUntil    *time.Time
+				}
+				return db.AutoMigrate(&AccountUser{})
+			},
+			Rollback: func(db *gorm.DB) error {
+				return db.Migrator().DropColumn("account_users", "totp_last_step")
+			},
+		},
+	}
+}
 
-	return m.Migrate()
+// convertTablesToUTF8MB4 converts all known tables that use a character set
+// other than utf8mb4. This is mostly the case for MariaDB installations
+// that default to latin1 and fail to store non ASCII account names.
+func convertTablesToUTF8MB4(db *gorm.DB) error {
+	var tables []string
+	if err := db.Raw(
+		`SELECT t.TABLE_NAME FROM information_schema.TABLES t
+		JOIN information_schema.COLLATION_CHARACTER_SET_APPLICABILITY c ON c.COLLATION_NAME = t.TABLE_COLLATION
+		WHERE t.TABLE_SCHEMA = DATABASE() AND c.CHARACTER_SET_NAME != 'utf8mb4'`,
+	).Scan(&tables).Error; err != nil {
+		return fmt.Errorf("relational: error looking up table character sets: %w", err)
+	}
+
+	known := map[string]bool{}
+	for _, model := range knownTables {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("relational: error parsing model: %w", err)
+		}
+		known[stmt.Schema.Table] = true
+	}
+
+	// foreign key checks are only disabled for the current connection, so
+	// all statements need to be issued using the same one. DDL statements
+	// commit implicitly in MySQL, the transaction is only used for pinning
+	// the connection.
+	return db.Transaction(func(conn *gorm.DB) error {
+		if err := conn.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
+			return fmt.Errorf("relational: error disabling foreign key checks: %w", err)
+		}
+		defer conn.Exec("SET FOREIGN_KEY_CHECKS = 1")
+		for _, table := range tables {
+			if !known[table] {
+				continue
+			}
+			if err := conn.Exec(
+				fmt.Sprintf("ALTER TABLE `%s` CONVERT TO CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci", table),
+			).Error; err != nil {
+				return fmt.Errorf("relational: error converting table %s: %w", table, err)
+			}
+		}
+		return nil
+	})
 }
@@ -0,0 +1,320 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	gormigrate "github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// MigrationPhase defines when a migration is applied in relation to
+// deploying a new version of the application.
+type MigrationPhase string
+
+// Expand migrations only add to the schema, so they are applied before
+// deploying a new version while older versions are still serving requests.
+// Contract migrations are applied after all instances have been upgraded.
+const (
+	MigrationPhaseExpand   MigrationPhase = "expand"
+	MigrationPhaseContract MigrationPhase = "contract"
+)
+
+// schemaInitID is recorded when a blank database is initialized from the
+// latest schema definition. It is compatible with previous releases that
+// used gormigrate for applying migrations.
+const schemaInitID = "SCHEMA_INIT"
+
+// MigrationOptions configures which migrations are applied or rolled back.
+type MigrationOptions struct {
+	// To is the ID of the migration the database is migrated to. Applied
+	// migrations defined after it are rolled back. Leaving it empty
+	// applies all migrations.
+	To string
+	// Phase limits the migrations that are applied to the given phase.
+	// Leaving it empty applies migrations of all phases.
+	Phase MigrationPhase
+	// DryRun returns the planned steps without applying them.
+	DryRun bool
+}
+
+// MigrationStep is a single migration that is applied or rolled back.
+type MigrationStep struct {
+	ID       string
+	Phase    MigrationPhase
+	Rollback bool
+}
+
+func (m MigrationStep) String() string {
+	if m.Rollback {
+		return fmt.Sprintf("rollback %s (%s)", m.ID, m.Phase)
+	}
+	return fmt.Sprintf("apply %s (%s)", m.ID, m.Phase)
+}
+
+// MigrationStatus describes whether a migration has been applied.
+type MigrationStatus struct {
+	ID        string
+	Phase     MigrationPhase
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// migrationRecord is the table used by previous releases for recording
+// applied migrations.
+type migrationRecord struct {
+	ID string `gorm:"primary_key;size:255"`
+}
+
+func (migrationRecord) TableName() string {
+	return "migrations"
+}
+
+// MigrationChecksum records the checksum of an applied migration, so
+// migrations that have been renamed, reordered or moved to a different
+// phase after being applied are detected.
+type MigrationChecksum struct {
+	MigrationID string `gorm:"primary_key;size:255"`
+	Checksum    string `gorm:"size:64"`
+	Phase       string `gorm:"size:16"`
+	AppliedAt   time.Time
+}
+
+type definedMigration struct {
+	*gormigrate.Migration
+	phase    MigrationPhase
+	checksum string
+}
+
+func defineMigrations(list []*gormigrate.Migration, phases map[string]MigrationPhase) []definedMigration {
+	var result []definedMigration
+	for i, m := range list {
+		phase, ok := phases[m.ID]
+		if !ok {
+			phase = MigrationPhaseExpand
+		}
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%s", i, m.ID, phase)))
+		result = append(result, definedMigration{
+			Migration: m,
+			phase:     phase,
+			checksum:  hex.EncodeToString(sum[:]),
+		})
+	}
+	return result
+}
+
+// RunMigrations applies and rolls back migrations in the given database
+// according to the given options. It returns the steps that have been
+// taken, or would be taken when running in dry run mode.
+func RunMigrations(db *gorm.DB, opts MigrationOptions) ([]MigrationStep, error) {
+	return runMigrations(db, defineMigrations(migrations(), migrationPhases), opts)
+}
+
+// MigrationStatuses returns the status of all defined migrations.
+func MigrationStatuses(db *gorm.DB) ([]MigrationStatus, error) {
+	defined := defineMigrations(migrations(), migrationPhases)
+	applied, checksums, err := readAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	var result []MigrationStatus
+	for _, m := range defined {
+		status := MigrationStatus{ID: m.ID, Phase: m.phase, Applied: applied[m.ID]}
+		if c, ok := checksums[m.ID]; ok {
+			appliedAt := c.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+func readAppliedMigrations(db *gorm.DB) (map[string]bool, map[string]MigrationChecksum, error) {
+	applied := map[string]bool{}
+	checksums := map[string]MigrationChecksum{}
+	if db.Migrator().HasTable(&migrationRecord{}) {
+		var records []migrationRecord
+		if err := db.Find(&records).Error; err != nil {
+			return nil, nil, fmt.Errorf("relational: error reading applied migrations: %w", err)
+		}
+		for _, r := range records {
+			applied[r.ID] = true
+		}
+	}
+	if db.Migrator().HasTable(&MigrationChecksum{}) {
+		var records []MigrationChecksum
+		if err := db.Find(&records).Error; err != nil {
+			return nil, nil, fmt.Errorf("relational: error reading migration checksums: %w", err)
+		}
+		for _, r := range records {
+			checksums[r.MigrationID] = r
+		}
+	}
+	return applied, checksums, nil
+}
+
+func runMigrations(db *gorm.DB, defined []definedMigration, opts MigrationOptions) ([]MigrationStep, error) {
+	if db.Config.Dialector.Name() == "mysql" {
+		// MySQL and MariaDB installations might default to a character set
+		// that cannot store all of unicode, so tables are created explicitly
+		db = db.Set("gorm:table_options", "DEFAULT CHARSET=utf8mb4")
+	}
+	if opts.Phase != "" && opts.Phase != MigrationPhaseExpand && opts.Phase != MigrationPhaseContract {
+		return nil, fmt.Errorf("relational: unknown migration phase %s", opts.Phase)
+	}
+
+	target := len(defined) - 1
+	if opts.To != "" {
+		target = -1
+		for i, m := range defined {
+			if m.ID == opts.To {
+				target = i
+			}
+		}
+		if target == -1 {
+			return nil, fmt.Errorf("relational: unknown migration %s", opts.To)
+		}
+	}
+
+	applied, checksums, err := readAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatched []string
+	for _, m := range defined {
+		if c, ok := checksums[m.ID]; ok && c.Checksum != m.checksum {
+			mismatched = append(mismatched, m.ID)
+		}
+	}
+	if len(mismatched) != 0 {
+		return nil, fmt.Errorf(
+			"relational: checksums of applied migrations %s do not match their definitions, they might have been changed after being applied",
+			strings.Join(mismatched, ", "),
+		)
+	}
+
+	var steps []MigrationStep
+	if len(applied) == 0 {
+		// a blank database is initialized from the latest schema definition
+		// instead of replaying all migrations
+		for _, m := range defined {
+			steps = append(steps, MigrationStep{ID: m.ID, Phase: m.phase})
+		}
+		if opts.DryRun {
+			return steps, nil
+		}
+		if err := initSchema(db, defined); err != nil {
+			return nil, err
+		}
+		return steps, nil
+	}
+
+	if !opts.DryRun {
+		if err := db.AutoMigrate(&MigrationChecksum{}); err != nil {
+			return nil, fmt.Errorf("relational: error creating migration checksums table: %w", err)
+		}
+		// migrations applied by previous releases do not have a checksum yet
+		for _, m := range defined {
+			if _, ok := checksums[m.ID]; ok || !applied[m.ID] {
+				continue
+			}
+			if err := recordChecksum(db, m); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i := len(defined) - 1; i > target; i-- {
+		m := defined[i]
+		if !applied[m.ID] {
+			continue
+		}
+		steps = append(steps, MigrationStep{ID: m.ID, Phase: m.phase, Rollback: true})
+		if opts.DryRun {
+			continue
+		}
+		if m.Rollback == nil {
+			return steps, fmt.Errorf("relational: migration %s cannot be rolled back", m.ID)
+		}
+		if err := m.Rollback(db); err != nil {
+			return steps, fmt.Errorf("relational: error rolling back migration %s: %w", m.ID, err)
+		}
+		if err := db.Where("id = ?", m.ID).Delete(&migrationRecord{}).Error; err != nil {
+			return steps, fmt.Errorf("relational: error removing migration record for %s: %w", m.ID, err)
+		}
+		if err := db.Where("migration_id = ?", m.ID).Delete(&MigrationChecksum{}).Error; err != nil {
+			return steps, fmt.Errorf("relational: error removing checksum for %s: %w", m.ID, err)
+		}
+	}
+
+	expandPending := false
+	for i := 0; i <= target; i++ {
+		m := defined[i]
+		if applied[m.ID] {
+			continue
+		}
+		if opts.Phase != "" && opts.Phase != m.phase {
+			if m.phase == MigrationPhaseExpand {
+				expandPending = true
+			}
+			continue
+		}
+		if m.phase == MigrationPhaseContract && expandPending {
+			return steps, fmt.Errorf("relational: contract migration %s requires all preceding expand migrations to be applied first", m.ID)
+		}
+		steps = append(steps, MigrationStep{ID: m.ID, Phase: m.phase})
+		if opts.DryRun {
+			continue
+		}
+		if err := m.Migrate(db); err != nil {
+			return steps, fmt.Errorf("relational: error applying migration %s: %w", m.ID, err)
+		}
+		if err := db.Create(&migrationRecord{ID: m.ID}).Error; err != nil {
+			return steps, fmt.Errorf("relational: error recording migration %s: %w", m.ID, err)
+		}
+		if err := recordChecksum(db, m); err != nil {
+			return steps, err
+		}
+	}
+	return steps, nil
+}
+
+func initSchema(db *gorm.DB, defined []definedMigration) error {
+	if err := db.AutoMigrate(knownTables...); err != nil {
+		return fmt.Errorf("relational: error initializing schema: %w", err)
+	}
+	if err := db.AutoMigrate(&migrationRecord{}, &MigrationChecksum{}); err != nil {
+		return fmt.Errorf("relational: error creating migration tables: %w", err)
+	}
+	if err := db.Create(&migrationRecord{ID: schemaInitID}).Error; err != nil {
+		return fmt.Errorf("relational: error recording schema initialization: %w", err)
+	}
+	for _, m := range defined {
+		if err := db.Create(&migrationRecord{ID: m.ID}).Error; err != nil {
+			return fmt.Errorf("relational: error recording migration %s: %w", m.ID, err)
+		}
+		if err := recordChecksum(db, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func recordChecksum(db *gorm.DB, m definedMigration) error {
+	if err := db.Save(&MigrationChecksum{
+		MigrationID: m.ID,
+		Checksum:    m.checksum,
+		Phase:       string(m.phase),
+		AppliedAt:   time.Now(),
+	}).Error; err != nil {
+		return fmt.Errorf("relational: error recording checksum for migration %s: %w", m.ID, err)
+	}
+	return nil
+}
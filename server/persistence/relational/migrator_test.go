@@ -0,0 +1,133 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"reflect"
+	"testing"
+
+	gormigrate "github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+func stepIDs(steps []MigrationStep) []string {
+	result := []string{}
+	for _, s := range steps {
+		result = append(result, s.String())
+	}
+	return result
+}
+
+func TestRunMigrations(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+
+	var log []string
+	define := func(id string) *gormigrate.Migration {
+		return &gormigrate.Migration{
+			ID: id,
+			Migrate: func(*gorm.DB) error {
+				log = append(log, "migrate "+id)
+				return nil
+			},
+			Rollback: func(*gorm.DB) error {
+				log = append(log, "rollback "+id)
+				return nil
+			},
+		}
+	}
+	list := []*gormigrate.Migration{define("001_a")}
+	phases := map[string]MigrationPhase{"003_c": MigrationPhaseContract}
+
+	// a blank database is initialized without running migrations
+	steps, err := runMigrations(db, defineMigrations(list, phases), MigrationOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(steps) != 1 || len(log) != 0 {
+		t.Errorf("Unexpected result %v %v", steps, log)
+	}
+
+	list = append(list, define("002_b"), define("003_c"), define("004_d"))
+	defined := defineMigrations(list, phases)
+
+	steps, err = runMigrations(db, defined, MigrationOptions{Phase: MigrationPhaseExpand, DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := []string{"apply 002_b (expand)", "apply 004_d (expand)"}; !reflect.DeepEqual(stepIDs(steps), expected) {
+		t.Errorf("Unexpected dry run %v", stepIDs(steps))
+	}
+	if len(log) != 0 {
+		t.Errorf("Expected dry run not to apply migrations, got %v", log)
+	}
+
+	if _, err := runMigrations(db, defined, MigrationOptions{Phase: MigrationPhaseExpand}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, err := runMigrations(db, defined, MigrationOptions{Phase: MigrationPhaseContract}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := []string{"migrate 002_b", "migrate 004_d", "migrate 003_c"}; !reflect.DeepEqual(log, expected) {
+		t.Errorf("Unexpected migrations %v", log)
+	}
+
+	log = nil
+	steps, err = runMigrations(db, defined, MigrationOptions{To: "002_b"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := []string{"rollback 004_d", "rollback 003_c"}; !reflect.DeepEqual(log, expected) {
+		t.Errorf("Unexpected rollbacks %v", log)
+	}
+	if expected := []string{"rollback 004_d (expand)", "rollback 003_c (contract)"}; !reflect.DeepEqual(stepIDs(steps), expected) {
+		t.Errorf("Unexpected steps %v", stepIDs(steps))
+	}
+
+	if _, err := runMigrations(db, defined, MigrationOptions{To: "005_e"}); err == nil {
+		t.Error("Expected error for unknown migration")
+	}
+
+	// moving a migration to a different phase after applying it is detected
+	if _, err := runMigrations(db, defineMigrations(list, map[string]MigrationPhase{"002_b": MigrationPhaseContract}), MigrationOptions{}); err == nil {
+		t.Error("Expected error for mismatched checksums")
+	}
+}
+
+func TestRunMigrations_contractRequiresExpand(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+
+	noop := func(*gorm.DB) error { return nil }
+	list := []*gormigrate.Migration{{ID: "001_a", Migrate: noop}}
+	if _, err := runMigrations(db, defineMigrations(list, nil), MigrationOptions{}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	list = append(list, &gormigrate.Migration{ID: "002_b", Migrate: noop}, &gormigrate.Migration{ID: "003_c", Migrate: noop})
+	_, err := runMigrations(db, defineMigrations(list, map[string]MigrationPhase{"003_c": MigrationPhaseContract}), MigrationOptions{Phase: MigrationPhaseContract})
+	if err == nil {
+		t.Error("Expected error when applying contract migration before expand migration")
+	}
+}
+
+func TestMigrationStatuses(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+
+	if _, err := RunMigrations(db, MigrationOptions{}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	statuses, err := MigrationStatuses(db)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(statuses) != len(migrations()) {
+		t.Errorf("Unexpected number of statuses %d", len(statuses))
+	}
+	for _, s := range statuses {
+		if !s.Applied || s.AppliedAt == nil {
+			t.Errorf("Expected migration to be applied, got %v", s)
+		}
+	}
+}
@@ -4,6 +4,7 @@
 package relational
 
 import (
+	"strings"
 	"time"
 
 	"github.com/offen/offen/server/persistence"
@@ -12,21 +13,32 @@ import (
 // Event is any analytics event that will be stored in the database. It is
 // uniquely tied to an Account and a Secret model.
 type Event struct {
-	EventID   string `gorm:"primary_key;size:26;unique"`
-	Sequence  string `gorm:"size:26"`
-	AccountID string `gorm:"size:36"`
+	EventID        string `gorm:"primary_key;size:26;unique"`
+	Sequence       string `gorm:"size:26"`
+	SequenceNumber int64  `gorm:"index"`
+	AccountID      string `gorm:"size:36"`
 	// the secret id is nullable for anonymous events
-	SecretID *string `gorm:"size:64"`
-	Payload  string  `gorm:"type:text"`
-	Secret   Secret  `gorm:"foreignkey:SecretID;association_foreignkey:SecretID"`
+	SecretID   *string `gorm:"size:64"`
+	Payload    string  `gorm:"type:text"`
+	Secret     Secret  `gorm:"foreignkey:SecretID;association_foreignkey:SecretID"`
+	KeyVersion int
+	EventType  string `gorm:"size:64"`
 }
 
 // A Tombstone replaces an event on its deletion
 type Tombstone struct {
-	EventID   string  `gorm:"primary_key"`
-	AccountID string  `gorm:"size:36"`
-	SecretID  *string `gorm:"size:64"`
-	Sequence  string  `gorm:"size:26"`
+	EventID        string  `gorm:"primary_key"`
+	AccountID      string  `gorm:"size:36"`
+	SecretID       *string `gorm:"size:64"`
+	Sequence       string  `gorm:"size:26"`
+	SequenceNumber int64   `gorm:"index"`
+}
+
+// AccountSequence holds the last sequence number that has been assigned to
+// an event or tombstone of the account.
+type AccountSequence struct {
+	AccountID      string `gorm:"primary_key;size:36"`
+	SequenceNumber int64
 }
 
 // Secret associates a hashed user id - which ties a user and account together
@@ -35,6 +47,7 @@ type Tombstone struct {
 type Secret struct {
 	SecretID        string `gorm:"primary_key;size:64;unique"`
 	EncryptedSecret string `gorm:"type:text"`
+	KeyVersion      int
 }
 
 // Account stores information about an account.
@@ -45,7 +58,21 @@ type Account struct {
 	EncryptedPrivateKey string `gorm:"type:text"`
 	UserSalt            string
 	Retired             bool
+	RetiredAt           *time.Time
+	Disabled            bool
 	AccountStyles       string `gorm:"type:text"`
+	RetentionPeriod     string
+	RetentionRules      string `gorm:"type:text"`
+	BotPolicy           string `gorm:"size:16"`
+	AllowedOrigins      string `gorm:"type:text"`
+	EventTypes          string `gorm:"type:text"`
+	CookiePolicy        string `gorm:"type:text"`
+	FeatureFlags        string `gorm:"type:text"`
+	Locale              string `gorm:"size:16"`
+	Theme               string `gorm:"type:text"`
+	WriteKeys           string `gorm:"type:text"`
+	KeyVersion          int
+	PreviousKeys        string `gorm:"type:text"`
 	Created             time.Time
 	Events              []Event `gorm:"foreignkey:AccountID;association_foreignkey:AccountID"`
 }
@@ -58,6 +85,13 @@ type AccountUser struct {
 	HashedPassword string
 	Salt           string
 	AdminLevel     int
+	TOTPSecret     string
+	TOTPEnabled    bool
+	TOTPLastStep   int64
+	RecoveryCodes  string `gorm:"type:text"`
+	PasskeyKey     string `gorm:"type:text"`
+	FailedLogins   int
+	LockedUntil    *time.Time
 	Relationships  []AccountUserRelationship `gorm:"foreignkey:AccountUserID;association_foreignkey:AccountUserID"`
 }
 
@@ -70,45 +104,193 @@ type AccountUserRelationship struct {
 	PasswordEncryptedKeyEncryptionKey string `gorm:"type:text"`
 	EmailEncryptedKeyEncryptionKey    string `gorm:"type:text"`
 	OneTimeEncryptedKeyEncryptionKey  string `gorm:"type:text"`
+	PasskeyEncryptedKeyEncryptionKey  string `gorm:"type:text"`
+	Role                              string `gorm:"size:16"`
+	InvitationID                      string `gorm:"size:26;index"`
+}
+
+// AuditLogEntry records a sensitive operation that has been performed on an
+// account.
+type AuditLogEntry struct {
+	EntryID       string `gorm:"primary_key;size:26;unique"`
+	AccountID     string `gorm:"size:36;index"`
+	AccountUserID string `gorm:"size:36"`
+	Action        string `gorm:"size:64"`
+	Target        string `gorm:"size:64"`
+	Timestamp     time.Time
+}
+
+// ShareLink grants read-only access to an account.
+type ShareLink struct {
+	LinkID        string `gorm:"primary_key;size:26;unique"`
+	AccountID     string `gorm:"size:36;index"`
+	AccountUserID string `gorm:"size:36"`
+	Expires       time.Time
+}
+
+// TrafficAnomaly flags a day with an unusual number of events.
+type TrafficAnomaly struct {
+	AnomalyID string `gorm:"primary_key;size:26;unique"`
+	AccountID string `gorm:"size:36;index"`
+	Day       time.Time
+	Count     int64
+	Expected  float64
+	Deviation float64
+	Detected  time.Time
+}
+
+// AggregateCounter is the noised number of events received on a single day.
+type AggregateCounter struct {
+	CounterID string `gorm:"primary_key;size:26;unique"`
+	AccountID string `gorm:"size:36;index"`
+	Day       time.Time
+	Count     int64
+	Epsilon   float64
+	Created   time.Time
+}
+
+// PingCounter is the number of cookieless pings received on a single day.
+type PingCounter struct {
+	AccountID string    `gorm:"primary_key;size:36"`
+	Day       time.Time `gorm:"primary_key"`
+	Count     int64
+}
+
+// Invitation tracks pending access to accounts.
+type Invitation struct {
+	InvitationID  string `gorm:"primary_key;size:26;unique"`
+	AccountUserID string `gorm:"size:36"`
+	InvitedBy     string `gorm:"size:36"`
+	Created       time.Time
+	Expires       time.Time
+}
+
+// Session is a login of an account user.
+type Session struct {
+	SessionID     string `gorm:"primary_key;size:32;unique"`
+	AccountUserID string `gorm:"size:36;index"`
+	Created       time.Time
+	Expires       time.Time
+}
+
+// APIToken grants headless access to an account. Scopes are stored as a
+// comma separated list.
+type APIToken struct {
+	TokenID       string `gorm:"primary_key;size:26;unique"`
+	AccountID     string `gorm:"size:36;index"`
+	AccountUserID string `gorm:"size:36"`
+	Name          string
+	HashedToken   string `gorm:"size:64;uniqueIndex"`
+	Scopes        string
+	Created       time.Time
+}
+
+// WebAuthnCredential is a passkey registered by an account user.
+type WebAuthnCredential struct {
+	CredentialID  string `gorm:"primary_key;size:255;unique"`
+	AccountUserID string `gorm:"size:36;index"`
+	Credential    string `gorm:"type:text"`
+	Created       time.Time
+}
+
+// QueuedMail is an outbound transactional email. Sender and recipient are
+// not called from and to as these are reserved words in SQL.
+type QueuedMail struct {
+	MailID      string `gorm:"primary_key;size:26;unique"`
+	Sender      string
+	Recipient   string
+	Subject     string
+	Body        string `gorm:"type:text"`
+	Attempts    int
+	LastError   string    `gorm:"type:text"`
+	NextAttempt time.Time `gorm:"index"`
+	Failed      bool
+	Created     time.Time
+}
+
+// Webhook is an endpoint that is notified about account lifecycle events.
+type Webhook struct {
+	WebhookID string `gorm:"primary_key;size:26;unique"`
+	AccountID string `gorm:"size:36;index"`
+	URL       string `gorm:"type:text"`
+	Secret    string
+	Events    string
+	CreatedBy string `gorm:"size:36"`
+	Created   time.Time
+}
+
+// WebhookDelivery is a notification that is sent to a webhook.
+type WebhookDelivery struct {
+	DeliveryID  string `gorm:"primary_key;size:26;unique"`
+	WebhookID   string `gorm:"size:26;index"`
+	AccountID   string `gorm:"size:36;index"`
+	Event       string `gorm:"size:64"`
+	Payload     string `gorm:"type:text"`
+	Attempts    int
+	StatusCode  int
+	LastError   string    `gorm:"type:text"`
+	NextAttempt time.Time `gorm:"index"`
+	Delivered   bool
+	Failed      bool
+	Created     time.Time
+}
+
+// AccountDomain is a domain claimed by an account.
+type AccountDomain struct {
+	DomainID  string `gorm:"primary_key;size:26;unique"`
+	AccountID string `gorm:"size:36;index"`
+	Domain    string
+	Token     string
+	CreatedBy string `gorm:"size:36"`
+	Created   time.Time
+	Verified  *time.Time
 }
 
 func (e *Event) export() persistence.Event {
 	return persistence.Event{
-		EventID:   e.EventID,
-		AccountID: e.AccountID,
-		SecretID:  e.SecretID,
-		Payload:   e.Payload,
-		Secret:    e.Secret.export(),
-		Sequence:  e.Sequence,
+		EventID:        e.EventID,
+		AccountID:      e.AccountID,
+		SecretID:       e.SecretID,
+		Payload:        e.Payload,
+		Secret:         e.Secret.export(),
+		Sequence:       e.Sequence,
+		SequenceNumber: e.SequenceNumber,
+		KeyVersion:     e.KeyVersion,
+		EventType:      e.EventType,
 	}
 }
 
 func importEvent(e *persistence.Event) Event {
 	return Event{
-		EventID:   e.EventID,
-		AccountID: e.AccountID,
-		SecretID:  e.SecretID,
-		Payload:   e.Payload,
-		Secret:    importSecret(&e.Secret),
-		Sequence:  e.Sequence,
+		EventID:        e.EventID,
+		AccountID:      e.AccountID,
+		SecretID:       e.SecretID,
+		Payload:        e.Payload,
+		Secret:         importSecret(&e.Secret),
+		Sequence:       e.Sequence,
+		SequenceNumber: e.SequenceNumber,
+		KeyVersion:     e.KeyVersion,
+		EventType:      e.EventType,
 	}
 }
 
 func (t *Tombstone) export() persistence.Tombstone {
 	return persistence.Tombstone{
-		EventID:   t.EventID,
-		AccountID: t.AccountID,
-		SecretID:  t.SecretID,
-		Sequence:  t.Sequence,
+		EventID:        t.EventID,
+		AccountID:      t.AccountID,
+		SecretID:       t.SecretID,
+		Sequence:       t.Sequence,
+		SequenceNumber: t.SequenceNumber,
 	}
 }
 
 func importTombstone(t *persistence.Tombstone) *Tombstone {
 	return &Tombstone{
-		EventID:   t.EventID,
-		AccountID: t.AccountID,
-		Sequence:  t.Sequence,
-		SecretID:  t.SecretID,
+		EventID:        t.EventID,
+		AccountID:      t.AccountID,
+		Sequence:       t.Sequence,
+		SequenceNumber: t.SequenceNumber,
+		SecretID:       t.SecretID,
 	}
 }
 
@@ -116,6 +298,7 @@ func (s *Secret) export() persistence.Secret {
 	return persistence.Secret{
 		SecretID:        s.SecretID,
 		EncryptedSecret: s.EncryptedSecret,
+		KeyVersion:      s.KeyVersion,
 	}
 }
 
@@ -123,6 +306,7 @@ func importSecret(s *persistence.Secret) Secret {
 	return Secret{
 		SecretID:        s.SecretID,
 		EncryptedSecret: s.EncryptedSecret,
+		KeyVersion:      s.KeyVersion,
 	}
 }
 
@@ -131,12 +315,27 @@ func (a *AccountUser) export() persistence.AccountUser {
 	for _, r := range a.Relationships {
 		relationships = append(relationships, r.export())
 	}
+	var recoveryCodes []string
+	if a.RecoveryCodes != "" {
+		recoveryCodes = strings.Split(a.RecoveryCodes, ",")
+	}
+	var lockedUntil time.Time
+	if a.LockedUntil != nil {
+		lockedUntil = *a.LockedUntil
+	}
 	return persistence.AccountUser{
 		AccountUserID:  a.AccountUserID,
 		HashedEmail:    a.HashedEmail,
 		HashedPassword: a.HashedPassword,
 		Salt:           a.Salt,
 		AdminLevel:     persistence.AccountUserAdminLevel(a.AdminLevel),
+		TOTPSecret:     a.TOTPSecret,
+		TOTPEnabled:    a.TOTPEnabled,
+		TOTPLastStep:   a.TOTPLastStep,
+		RecoveryCodes:  recoveryCodes,
+		PasskeyKey:     a.PasskeyKey,
+		FailedLogins:   a.FailedLogins,
+		LockedUntil:    lockedUntil,
 		Relationships:  relationships,
 	}
 }
@@ -146,12 +345,23 @@ func importAccountUser(a *persistence.AccountUser) AccountUser {
 	for _, r := range a.Relationships {
 		relationships = append(relationships, importAccountUserRelationship(&r))
 	}
+	var lockedUntil *time.Time
+	if !a.LockedUntil.IsZero() {
+		lockedUntil = &a.LockedUntil
+	}
 	return AccountUser{
 		AccountUserID:  a.AccountUserID,
 		HashedEmail:    a.HashedEmail,
 		HashedPassword: a.HashedPassword,
 		Salt:           a.Salt,
 		AdminLevel:     int(a.AdminLevel),
+		TOTPSecret:     a.TOTPSecret,
+		TOTPEnabled:    a.TOTPEnabled,
+		TOTPLastStep:   a.TOTPLastStep,
+		RecoveryCodes:  strings.Join(a.RecoveryCodes, ","),
+		PasskeyKey:     a.PasskeyKey,
+		FailedLogins:   a.FailedLogins,
+		LockedUntil:    lockedUntil,
 		Relationships:  relationships,
 	}
 }
@@ -164,6 +374,9 @@ func (a *AccountUserRelationship) export() persistence.AccountUserRelationship {
 		PasswordEncryptedKeyEncryptionKey: a.PasswordEncryptedKeyEncryptionKey,
 		EmailEncryptedKeyEncryptionKey:    a.EmailEncryptedKeyEncryptionKey,
 		OneTimeEncryptedKeyEncryptionKey:  a.OneTimeEncryptedKeyEncryptionKey,
+		PasskeyEncryptedKeyEncryptionKey:  a.PasskeyEncryptedKeyEncryptionKey,
+		Role:                              persistence.AccountUserRole(a.Role),
+		InvitationID:                      a.InvitationID,
 	}
 }
 
@@ -175,6 +388,9 @@ func importAccountUserRelationship(a *persistence.AccountUserRelationship) Accou
 		PasswordEncryptedKeyEncryptionKey: a.PasswordEncryptedKeyEncryptionKey,
 		EmailEncryptedKeyEncryptionKey:    a.EmailEncryptedKeyEncryptionKey,
 		OneTimeEncryptedKeyEncryptionKey:  a.OneTimeEncryptedKeyEncryptionKey,
+		PasskeyEncryptedKeyEncryptionKey:  a.PasskeyEncryptedKeyEncryptionKey,
+		Role:                              string(a.Role),
+		InvitationID:                      a.InvitationID,
 	}
 }
 
@@ -183,6 +399,10 @@ func (a *Account) export() persistence.Account {
 	for _, e := range a.Events {
 		events = append(events, e.export())
 	}
+	var retiredAt time.Time
+	if a.RetiredAt != nil {
+		retiredAt = *a.RetiredAt
+	}
 	return persistence.Account{
 		AccountID:           a.AccountID,
 		Name:                a.Name,
@@ -190,9 +410,23 @@ func (a *Account) export() persistence.Account {
 		EncryptedPrivateKey: a.EncryptedPrivateKey,
 		UserSalt:            a.UserSalt,
 		Retired:             a.Retired,
+		RetiredAt:           retiredAt,
+		Disabled:            a.Disabled,
 		Created:             a.Created,
 		Events:              events,
 		AccountStyles:       a.AccountStyles,
+		RetentionPeriod:     a.RetentionPeriod,
+		RetentionRules:      a.RetentionRules,
+		BotPolicy:           a.BotPolicy,
+		AllowedOrigins:      a.AllowedOrigins,
+		EventTypes:          a.EventTypes,
+		CookiePolicy:        a.CookiePolicy,
+		FeatureFlags:        a.FeatureFlags,
+		Locale:              a.Locale,
+		Theme:               a.Theme,
+		WriteKeys:           a.WriteKeys,
+		KeyVersion:          a.KeyVersion,
+		PreviousKeys:        a.PreviousKeys,
 	}
 }
 
@@ -201,6 +435,10 @@ func importAccount(a *persistence.Account) Account {
 	for _, e := range a.Events {
 		events = append(events, importEvent(&e))
 	}
+	var retiredAt *time.Time
+	if !a.RetiredAt.IsZero() {
+		retiredAt = &a.RetiredAt
+	}
 	return Account{
 		AccountID:           a.AccountID,
 		Name:                a.Name,
@@ -208,8 +446,332 @@ func importAccount(a *persistence.Account) Account {
 		EncryptedPrivateKey: a.EncryptedPrivateKey,
 		UserSalt:            a.UserSalt,
 		Retired:             a.Retired,
+		RetiredAt:           retiredAt,
+		Disabled:            a.Disabled,
 		Created:             a.Created,
 		Events:              events,
 		AccountStyles:       a.AccountStyles,
+		RetentionPeriod:     a.RetentionPeriod,
+		RetentionRules:      a.RetentionRules,
+		BotPolicy:           a.BotPolicy,
+		AllowedOrigins:      a.AllowedOrigins,
+		EventTypes:          a.EventTypes,
+		CookiePolicy:        a.CookiePolicy,
+		FeatureFlags:        a.FeatureFlags,
+		Locale:              a.Locale,
+		Theme:               a.Theme,
+		WriteKeys:           a.WriteKeys,
+		KeyVersion:          a.KeyVersion,
+		PreviousKeys:        a.PreviousKeys,
+	}
+}
+
+func (a *AuditLogEntry) export() persistence.AuditLogEntry {
+	return persistence.AuditLogEntry{
+		EntryID:       a.EntryID,
+		AccountID:     a.AccountID,
+		AccountUserID: a.AccountUserID,
+		Action:        a.Action,
+		Target:        a.Target,
+		Timestamp:     a.Timestamp,
+	}
+}
+
+func importAuditLogEntry(a *persistence.AuditLogEntry) AuditLogEntry {
+	return AuditLogEntry{
+		EntryID:       a.EntryID,
+		AccountID:     a.AccountID,
+		AccountUserID: a.AccountUserID,
+		Action:        a.Action,
+		Target:        a.Target,
+		Timestamp:     a.Timestamp,
+	}
+}
+
+func (s *ShareLink) export() persistence.ShareLink {
+	return persistence.ShareLink{
+		LinkID:        s.LinkID,
+		AccountID:     s.AccountID,
+		AccountUserID: s.AccountUserID,
+		Expires:       s.Expires,
+	}
+}
+
+func importShareLink(s *persistence.ShareLink) ShareLink {
+	return ShareLink{
+		LinkID:        s.LinkID,
+		AccountID:     s.AccountID,
+		AccountUserID: s.AccountUserID,
+		Expires:       s.Expires,
+	}
+}
+
+func (w *Webhook) export() persistence.Webhook {
+	var events []string
+	if w.Events != "" {
+		events = strings.Split(w.Events, ",")
+	}
+	return persistence.Webhook{
+		WebhookID: w.WebhookID,
+		AccountID: w.AccountID,
+		URL:       w.URL,
+		Secret:    w.Secret,
+		Events:    events,
+		CreatedBy: w.CreatedBy,
+		Created:   w.Created,
+	}
+}
+
+func importWebhook(w *persistence.Webhook) Webhook {
+	return Webhook{
+		WebhookID: w.WebhookID,
+		AccountID: w.AccountID,
+		URL:       w.URL,
+		Secret:    w.Secret,
+		Events:    strings.Join(w.Events, ","),
+		CreatedBy: w.CreatedBy,
+		Created:   w.Created,
+	}
+}
+
+func (w *WebhookDelivery) export() persistence.WebhookDelivery {
+	return persistence.WebhookDelivery{
+		DeliveryID:  w.DeliveryID,
+		WebhookID:   w.WebhookID,
+		AccountID:   w.AccountID,
+		Event:       w.Event,
+		Payload:     w.Payload,
+		Attempts:    w.Attempts,
+		StatusCode:  w.StatusCode,
+		LastError:   w.LastError,
+		NextAttempt: w.NextAttempt,
+		Delivered:   w.Delivered,
+		Failed:      w.Failed,
+		Created:     w.Created,
+	}
+}
+
+func importWebhookDelivery(w *persistence.WebhookDelivery) WebhookDelivery {
+	return WebhookDelivery{
+		DeliveryID:  w.DeliveryID,
+		WebhookID:   w.WebhookID,
+		AccountID:   w.AccountID,
+		Event:       w.Event,
+		Payload:     w.Payload,
+		Attempts:    w.Attempts,
+		StatusCode:  w.StatusCode,
+		LastError:   w.LastError,
+		NextAttempt: w.NextAttempt,
+		Delivered:   w.Delivered,
+		Failed:      w.Failed,
+		Created:     w.Created,
+	}
+}
+
+func (t *TrafficAnomaly) export() persistence.TrafficAnomaly {
+	return persistence.TrafficAnomaly{
+		AnomalyID: t.AnomalyID,
+		AccountID: t.AccountID,
+		Day:       t.Day,
+		Count:     t.Count,
+		Expected:  t.Expected,
+		Deviation: t.Deviation,
+		Detected:  t.Detected,
+	}
+}
+
+func importTrafficAnomaly(t *persistence.TrafficAnomaly) TrafficAnomaly {
+	return TrafficAnomaly{
+		AnomalyID: t.AnomalyID,
+		AccountID: t.AccountID,
+		Day:       t.Day,
+		Count:     t.Count,
+		Expected:  t.Expected,
+		Deviation: t.Deviation,
+		Detected:  t.Detected,
+	}
+}
+
+func (a *AggregateCounter) export() persistence.AggregateCounter {
+	return persistence.AggregateCounter{
+		CounterID: a.CounterID,
+		AccountID: a.AccountID,
+		Day:       a.Day,
+		Count:     a.Count,
+		Epsilon:   a.Epsilon,
+		Created:   a.Created,
+	}
+}
+
+func importAggregateCounter(a *persistence.AggregateCounter) AggregateCounter {
+	return AggregateCounter{
+		CounterID: a.CounterID,
+		AccountID: a.AccountID,
+		Day:       a.Day,
+		Count:     a.Count,
+		Epsilon:   a.Epsilon,
+		Created:   a.Created,
+	}
+}
+
+func (p *PingCounter) export() persistence.PingCounter {
+	return persistence.PingCounter{
+		AccountID: p.AccountID,
+		Day:       p.Day,
+		Count:     p.Count,
+	}
+}
+
+func importPingCounter(p *persistence.PingCounter) PingCounter {
+	return PingCounter{
+		AccountID: p.AccountID,
+		Day:       p.Day,
+		Count:     p.Count,
+	}
+}
+
+func (i *Invitation) export() persistence.Invitation {
+	return persistence.Invitation{
+		InvitationID:  i.InvitationID,
+		AccountUserID: i.AccountUserID,
+		InvitedBy:     i.InvitedBy,
+		Created:       i.Created,
+		Expires:       i.Expires,
+	}
+}
+
+func importInvitation(i *persistence.Invitation) Invitation {
+	return Invitation{
+		InvitationID:  i.InvitationID,
+		AccountUserID: i.AccountUserID,
+		InvitedBy:     i.InvitedBy,
+		Created:       i.Created,
+		Expires:       i.Expires,
+	}
+}
+
+func (s *Session) export() persistence.Session {
+	return persistence.Session{
+		SessionID:     s.SessionID,
+		AccountUserID: s.AccountUserID,
+		Created:       s.Created,
+		Expires:       s.Expires,
+	}
+}
+
+func importSession(s *persistence.Session) Session {
+	return Session{
+		SessionID:     s.SessionID,
+		AccountUserID: s.AccountUserID,
+		Created:       s.Created,
+		Expires:       s.Expires,
+	}
+}
+
+func (a *APIToken) export() persistence.APIToken {
+	var scopes []string
+	if a.Scopes != "" {
+		scopes = strings.Split(a.Scopes, ",")
+	}
+	return persistence.APIToken{
+		TokenID:       a.TokenID,
+		AccountID:     a.AccountID,
+		AccountUserID: a.AccountUserID,
+		Name:          a.Name,
+		HashedToken:   a.HashedToken,
+		Scopes:        scopes,
+		Created:       a.Created,
+	}
+}
+
+func importAPIToken(a *persistence.APIToken) APIToken {
+	return APIToken{
+		TokenID:       a.TokenID,
+		AccountID:     a.AccountID,
+		AccountUserID: a.AccountUserID,
+		Name:          a.Name,
+		HashedToken:   a.HashedToken,
+		Scopes:        strings.Join(a.Scopes, ","),
+		Created:       a.Created,
+	}
+}
+
+func (w *WebAuthnCredential) export() persistence.WebAuthnCredential {
+	return persistence.WebAuthnCredential{
+		CredentialID:  w.CredentialID,
+		AccountUserID: w.AccountUserID,
+		Credential:    w.Credential,
+		Created:       w.Created,
+	}
+}
+
+func importWebAuthnCredential(w *persistence.WebAuthnCredential) WebAuthnCredential {
+	return WebAuthnCredential{
+		CredentialID:  w.CredentialID,
+		AccountUserID: w.AccountUserID,
+		Credential:    w.Credential,
+		Created:       w.Created,
+	}
+}
+
+func (q *QueuedMail) export() persistence.QueuedMail {
+	return persistence.QueuedMail{
+		MailID:      q.MailID,
+		From:        q.Sender,
+		To:          q.Recipient,
+		Subject:     q.Subject,
+		Body:        q.Body,
+		Attempts:    q.Attempts,
+		LastError:   q.LastError,
+		NextAttempt: q.NextAttempt,
+		Failed:      q.Failed,
+		Created:     q.Created,
+	}
+}
+
+func importQueuedMail(q *persistence.QueuedMail) QueuedMail {
+	return QueuedMail{
+		MailID:      q.MailID,
+		Sender:      q.From,
+		Recipient:   q.To,
+		Subject:     q.Subject,
+		Body:        q.Body,
+		Attempts:    q.Attempts,
+		LastError:   q.LastError,
+		NextAttempt: q.NextAttempt,
+		Failed:      q.Failed,
+		Created:     q.Created,
+	}
+}
+
+func (a *AccountDomain) export() persistence.AccountDomain {
+	var verified time.Time
+	if a.Verified != nil {
+		verified = *a.Verified
+	}
+	return persistence.AccountDomain{
+		DomainID:  a.DomainID,
+		AccountID: a.AccountID,
+		Domain:    a.Domain,
+		Token:     a.Token,
+		CreatedBy: a.CreatedBy,
+		Created:   a.Created,
+		Verified:  verified,
+	}
+}
+
+func importAccountDomain(a *persistence.AccountDomain) AccountDomain {
+	var verified *time.Time
+	if !a.Verified.IsZero() {
+		verified = &a.Verified
+	}
+	return AccountDomain{
+		DomainID:  a.DomainID,
+		AccountID: a.AccountID,
+		Domain:    a.Domain,
+		Token:     a.Token,
+		CreatedBy: a.CreatedBy,
+		Created:   a.Created,
+		Verified:  verified,
 	}
 }
@@ -0,0 +1,59 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IncrementPingCounter increments the counter of the given account and day,
+// creating it if needed. Pings are counted concurrently, so this is done
+// using a single upsert instead of reading the counter first.
+func (r *relationalDAL) IncrementPingCounter(accountID string, day time.Time) error {
+	if err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "account_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("ping_counters.count + 1")}),
+	}).Create(&PingCounter{AccountID: accountID, Day: day, Count: 1}).Error; err != nil {
+		return fmt.Errorf("relational: error incrementing ping counter: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindPingCounters(q interface{}) ([]persistence.PingCounter, error) {
+	var counters []PingCounter
+	switch query := q.(type) {
+	case persistence.FindPingCountersQueryByAccountID:
+		if err := r.db.
+			Where("account_id = ? AND day >= ?", query.AccountID, query.Since).
+			Order("day ASC").
+			Find(&counters).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up ping counters: %w", err)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	result := []persistence.PingCounter{}
+	for _, counter := range counters {
+		result = append(result, counter.export())
+	}
+	return result, nil
+}
+
+func (r *relationalDAL) DeletePingCounters(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.DeletePingCountersQueryBefore:
+		deletion := r.db.Where("day < ?", time.Time(query)).Delete(&PingCounter{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting ping counters: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
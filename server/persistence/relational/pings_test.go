@@ -0,0 +1,53 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_PingCounters(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	day := time.Date(2022, 5, 17, 0, 0, 0, 0, time.UTC)
+	for _, increment := range []struct {
+		accountID string
+		day       time.Time
+	}{
+		{"account-a", day},
+		{"account-a", day},
+		{"account-a", day},
+		{"account-a", day.AddDate(0, 0, -1)},
+		{"account-a", day.AddDate(0, 0, -40)},
+		{"account-b", day},
+	} {
+		if err := dal.IncrementPingCounter(increment.accountID, increment.day); err != nil {
+			t.Fatalf("Unexpected error incrementing counter: %v", err)
+		}
+	}
+
+	counters, err := dal.FindPingCounters(persistence.FindPingCountersQueryByAccountID{
+		AccountID: "account-a",
+		Since:     day.AddDate(0, 0, -30),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(counters) != 2 || counters[0].Count != 1 || counters[1].Count != 3 {
+		t.Errorf("Unexpected counters %v", counters)
+	}
+	if _, err := dal.FindPingCounters("account-a"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+
+	affected, err := dal.DeletePingCounters(persistence.DeletePingCountersQueryBefore(day.AddDate(0, 0, -30)))
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result deleting counters: %d, %v", affected, err)
+	}
+}
@@ -43,6 +43,20 @@ var knownTables = []interface{}{
 	&Event{},
 	&Secret{},
 	&Tombstone{},
+	&AuditLogEntry{},
+	&ShareLink{},
+	&Invitation{},
+	&Session{},
+	&APIToken{},
+	&WebAuthnCredential{},
+	&QueuedMail{},
+	&TrafficAnomaly{},
+	&AggregateCounter{},
+	&PingCounter{},
+	&Webhook{},
+	&WebhookDelivery{},
+	&AccountDomain{},
+	&AccountSequence{},
 }
 
 func (r *relationalDAL) ProbeEmpty() bool {
@@ -76,7 +90,23 @@ func (r *relationalDAL) DropAll() error {
 		&Secret{},
 		&AccountUser{},
 		&AccountUserRelationship{},
+		&Tombstone{},
+		&AuditLogEntry{},
+		&ShareLink{},
+		&Invitation{},
+		&Session{},
+		&APIToken{},
+		&WebAuthnCredential{},
+		&QueuedMail{},
+		&TrafficAnomaly{},
+		&AggregateCounter{},
+		&PingCounter{},
+		&Webhook{},
+		&WebhookDelivery{},
+		&AccountDomain{},
+		&AccountSequence{},
 		"migrations",
+		&MigrationChecksum{},
 	); err != nil {
 		return fmt.Errorf("relational: error dropping tables: %w,", err)
 	}
@@ -19,7 +19,7 @@ func createTestDatabase() (*gorm.DB, func() error) {
 	if err != nil {
 		panic(err)
 	}
-	if err := db.AutoMigrate(&Event{}, &Account{}, &Secret{}, &AccountUser{}, &AccountUserRelationship{}, &Tombstone{}); err != nil {
+	if err := db.AutoMigrate(&Event{}, &Account{}, &Secret{}, &AccountUser{}, &AccountUserRelationship{}, &Tombstone{}, &AuditLogEntry{}, &ShareLink{}, &Session{}, &APIToken{}, &WebAuthnCredential{}, &QueuedMail{}, &Invitation{}, &TrafficAnomaly{}, &AggregateCounter{}, &PingCounter{}, &Webhook{}, &WebhookDelivery{}, &AccountDomain{}, &AccountSequence{}); err != nil {
 		panic(err)
 	}
 	d, _ := db.DB()
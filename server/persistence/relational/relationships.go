@@ -24,6 +24,18 @@ func (r *relationalDAL) DeleteAccountUserRelationships(q interface{}) error {
 			return fmt.Errorf("relational: error deleting relationships for account %s: %w", query, err)
 		}
 		return nil
+	case persistence.DeleteAccountUserRelationshipsQueryPendingByInvitationID:
+		if err := r.db.
+			Where("invitation_id = ? AND (password_encrypted_key_encryption_key = ? OR password_encrypted_key_encryption_key IS NULL)", string(query), "").
+			Delete(&AccountUserRelationship{}).Error; err != nil {
+			return fmt.Errorf("relational: error deleting relationships for invitation %s: %w", query, err)
+		}
+		return nil
+	case persistence.DeleteAccountUserRelationshipsQueryByAccountUserID:
+		if err := r.db.Where("account_id = ? AND account_user_id = ?", query.AccountID, query.AccountUserID).Delete(&AccountUserRelationship{}).Error; err != nil {
+			return fmt.Errorf("relational: error deleting relationship of account user %s: %w", query.AccountUserID, err)
+		}
+		return nil
 	default:
 		return persistence.ErrBadQuery
 	}
@@ -41,6 +53,24 @@ func (r *relationalDAL) FindAccountUserRelationships(q interface{}) ([]persisten
 			result = append(result, r.export())
 		}
 		return result, nil
+	case persistence.FindAccountUserRelationshipsQueryByAccountID:
+		if err := r.db.Where("account_id = ?", string(query)).Order("relationship_id").Find(&relationships).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up relationships for account: %w", err)
+		}
+		result := []persistence.AccountUserRelationship{}
+		for _, r := range relationships {
+			result = append(result, r.export())
+		}
+		return result, nil
+	case persistence.FindAccountUserRelationshipsQueryByInvitationID:
+		if err := r.db.Where("invitation_id = ?", string(query)).Find(&relationships).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up relationships for invitation: %w", err)
+		}
+		result := []persistence.AccountUserRelationship{}
+		for _, r := range relationships {
+			result = append(result, r.export())
+		}
+		return result, nil
 	default:
 		return nil, persistence.ErrBadQuery
 	}
@@ -95,6 +95,27 @@ func TestRelationalDAL_FindAccountUserRelationships(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"by account id",
+			func(db *gorm.DB) error {
+				for _, r := range []AccountUserRelationship{
+					{RelationshipID: "relationship-b", AccountUserID: "user-b", AccountID: "account-a"},
+					{RelationshipID: "relationship-a", AccountUserID: "user-a", AccountID: "account-a"},
+					{RelationshipID: "relationship-c", AccountUserID: "user-a", AccountID: "account-b"},
+				} {
+					if err := db.Save(&r).Error; err != nil {
+						return fmt.Errorf("error saving fixtures: %w", err)
+					}
+				}
+				return nil
+			},
+			persistence.FindAccountUserRelationshipsQueryByAccountID("account-a"),
+			[]persistence.AccountUserRelationship{
+				{RelationshipID: "relationship-a", AccountUserID: "user-a", AccountID: "account-a"},
+				{RelationshipID: "relationship-b", AccountUserID: "user-b", AccountID: "account-a"},
+			},
+			false,
+		},
 	}
 
 	for _, test := range tests {
@@ -49,3 +49,27 @@ func (r *relationalDAL) FindSecret(q interface{}) (persistence.Secret, error) {
 		return secret.export(), persistence.ErrBadQuery
 	}
 }
+
+func (r *relationalDAL) FindSecrets(q interface{}) ([]persistence.Secret, error) {
+	switch query := q.(type) {
+	case persistence.FindSecretsQueryBySecretIDs:
+		result := []persistence.Secret{}
+		var limit = 500
+		for offset := 0; offset < len(query); offset += limit {
+			end := offset + limit
+			if end > len(query) {
+				end = len(query)
+			}
+			var secrets []Secret
+			if err := r.db.Where("secret_id IN (?)", []string(query[offset:end])).Find(&secrets).Error; err != nil {
+				return nil, fmt.Errorf("relational: error looking up secrets: %w", err)
+			}
+			for _, s := range secrets {
+				result = append(result, s.export())
+			}
+		}
+		return result, nil
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+}
@@ -197,3 +197,27 @@ func TestRelationalDAL_FindSecret(t *testing.T) {
 		})
 	}
 }
+
+func TestRelationalDAL_FindSecrets(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	for _, id := range []string{"hashed-user-id-1", "hashed-user-id-2", "hashed-user-id-3"} {
+		if err := db.Save(&Secret{SecretID: id, EncryptedSecret: "secret-" + id}).Error; err != nil {
+			t.Fatalf("Unexpected error setting up test: %v", err)
+		}
+	}
+
+	result, err := dal.FindSecrets(persistence.FindSecretsQueryBySecretIDs{"hashed-user-id-1", "hashed-user-id-3", "hashed-user-id-9"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(result) != 2 {
+		t.Errorf("Unexpected result %v", result)
+	}
+
+	if _, err := dal.FindSecrets("hashed-user-id-1"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+}
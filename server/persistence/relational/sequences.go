@@ -0,0 +1,92 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *relationalDAL) ReserveSequenceNumbers(accountID string, n int64) (int64, error) {
+	var first int64
+	if err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		first, err = reserveSequenceNumbers(tx, accountID, n)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return first, nil
+}
+
+// reserveSequenceNumbers increments the counter of the given account by n and
+// returns the first of the reserved numbers. The counter row stays locked
+// until the given transaction is done, so numbers become visible to readers
+// in the order they have been assigned in.
+func reserveSequenceNumbers(tx *gorm.DB, accountID string, n int64) (int64, error) {
+	update := tx.Model(&AccountSequence{}).
+		Where("account_id = ?", accountID).
+		UpdateColumn("sequence_number", gorm.Expr("sequence_number + ?", n))
+	if err := update.Error; err != nil {
+		return 0, fmt.Errorf("relational: error incrementing sequence number: %w", err)
+	}
+
+	if update.RowsAffected == 0 {
+		// accounts created before sequence numbers were introduced or restored
+		// from a snapshot might not have a counter yet, so it is initialized
+		// from the rows that already exist. Concurrent writers might try to
+		// initialize the counter at the same time, so this is done using an
+		// upsert that increments the counter created by another writer instead.
+		var latestEvent, latestTombstone sql.NullInt64
+		if err := tx.Model(&Event{}).Select("MAX(sequence_number)").Where("account_id = ?", accountID).Row().Scan(&latestEvent); err != nil {
+			return 0, fmt.Errorf("relational: error looking up latest event sequence number: %w", err)
+		}
+		if err := tx.Model(&Tombstone{}).Select("MAX(sequence_number)").Where("account_id = ?", accountID).Row().Scan(&latestTombstone); err != nil {
+			return 0, fmt.Errorf("relational: error looking up latest tombstone sequence number: %w", err)
+		}
+		current := latestEvent.Int64
+		if latestTombstone.Int64 > current {
+			current = latestTombstone.Int64
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "account_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"sequence_number": gorm.Expr("account_sequences.sequence_number + ?", n)}),
+		}).Create(&AccountSequence{AccountID: accountID, SequenceNumber: current + n}).Error; err != nil {
+			return 0, fmt.Errorf("relational: error creating sequence number: %w", err)
+		}
+	}
+
+	var counter AccountSequence
+	if err := tx.First(&counter, "account_id = ?", accountID).Error; err != nil {
+		return 0, fmt.Errorf("relational: error reading sequence number: %w", err)
+	}
+	return counter.SequenceNumber - n + 1, nil
+}
+
+// sinceSequenceNumbers scopes the given db to rows with a sequence number
+// higher than the one given for their account. Rows of accounts that are not
+// contained in the map are not restricted.
+func sinceSequenceNumbers(db *gorm.DB, since map[string]int64) *gorm.DB {
+	if len(since) == 0 {
+		return db
+	}
+	accountIDs := make([]string, 0, len(since))
+	for accountID := range since {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Strings(accountIDs)
+
+	conditions := []string{"account_id NOT IN (?)"}
+	args := []interface{}{accountIDs}
+	for _, accountID := range accountIDs {
+		conditions = append(conditions, "(account_id = ? AND sequence_number > ?)")
+		args = append(args, accountID, since[accountID])
+	}
+	return db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+}
@@ -0,0 +1,62 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func (r *relationalDAL) CreateSession(s *persistence.Session) error {
+	local := importSession(s)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating session: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindSessions(q interface{}) ([]persistence.Session, error) {
+	var sessions []Session
+	switch query := q.(type) {
+	case persistence.FindSessionsQueryByID:
+		if err := r.db.Where("session_id = ?", string(query)).Find(&sessions).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up session: %w", err)
+		}
+	case persistence.FindSessionsQueryByAccountUserID:
+		if err := r.db.
+			Where("account_user_id = ? AND expires > ?", string(query), time.Now()).
+			Order("created DESC").
+			Find(&sessions).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up sessions: %w", err)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	var result []persistence.Session
+	for _, s := range sessions {
+		result = append(result, s.export())
+	}
+	return result, nil
+}
+
+func (r *relationalDAL) DeleteSessions(q interface{}) (int64, error) {
+	var deletion *gorm.DB
+	switch query := q.(type) {
+	case persistence.DeleteSessionsQueryByID:
+		deletion = r.db.Where("session_id = ? AND account_user_id = ?", query.SessionID, query.AccountUserID).Delete(&Session{})
+	case persistence.DeleteSessionsQueryByAccountUserID:
+		deletion = r.db.Where("account_user_id = ?", string(query)).Delete(&Session{})
+	case persistence.DeleteSessionsQueryExpiredBefore:
+		deletion = r.db.Where("expires < ?", time.Time(query)).Delete(&Session{})
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+	if err := deletion.Error; err != nil {
+		return 0, fmt.Errorf("relational: error deleting sessions: %w", err)
+	}
+	return deletion.RowsAffected, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_Sessions(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	now := time.Now()
+	for _, session := range []*persistence.Session{
+		{SessionID: "session-a", AccountUserID: "user-a", Created: now.Add(-time.Minute), Expires: now.Add(time.Hour)},
+		{SessionID: "session-b", AccountUserID: "user-a", Created: now, Expires: now.Add(time.Hour)},
+		{SessionID: "session-c", AccountUserID: "user-a", Created: now.Add(-time.Hour * 2), Expires: now.Add(-time.Hour)},
+		{SessionID: "session-d", AccountUserID: "user-b", Created: now, Expires: now.Add(time.Hour)},
+	} {
+		if err := dal.CreateSession(session); err != nil {
+			t.Fatalf("Unexpected error creating session: %v", err)
+		}
+	}
+
+	sessions, err := dal.FindSessions(persistence.FindSessionsQueryByID("session-a"))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].AccountUserID != "user-a" {
+		t.Errorf("Unexpected result %v", sessions)
+	}
+
+	if sessions, err := dal.FindSessions(persistence.FindSessionsQueryByID("session-z")); err != nil || len(sessions) != 0 {
+		t.Errorf("Unexpected result for unknown session: %v, %v", sessions, err)
+	}
+
+	sessions, err = dal.FindSessions(persistence.FindSessionsQueryByAccountUserID("user-a"))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].SessionID != "session-b" || sessions[1].SessionID != "session-a" {
+		t.Errorf("Unexpected result %v", sessions)
+	}
+
+	if _, err := dal.FindSessions("session-a"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+
+	affected, err := dal.DeleteSessions(persistence.DeleteSessionsQueryExpiredBefore(now))
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result deleting expired sessions: %d, %v", affected, err)
+	}
+
+	affected, err = dal.DeleteSessions(persistence.DeleteSessionsQueryByID{AccountUserID: "user-b", SessionID: "session-a"})
+	if err != nil || affected != 0 {
+		t.Errorf("Expected session of other user to be left untouched, got %d, %v", affected, err)
+	}
+	affected, err = dal.DeleteSessions(persistence.DeleteSessionsQueryByID{AccountUserID: "user-a", SessionID: "session-a"})
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result revoking session: %d, %v", affected, err)
+	}
+
+	affected, err = dal.DeleteSessions(persistence.DeleteSessionsQueryByAccountUserID("user-a"))
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result revoking all sessions: %d, %v", affected, err)
+	}
+	if _, err := dal.DeleteSessions("user-b"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+}
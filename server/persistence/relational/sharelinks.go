@@ -0,0 +1,56 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func (r *relationalDAL) CreateShareLink(s *persistence.ShareLink) error {
+	local := importShareLink(s)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating share link: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindShareLink(q interface{}) (persistence.ShareLink, error) {
+	var link ShareLink
+	switch query := q.(type) {
+	case persistence.FindShareLinkQueryByID:
+		if err := r.db.Where("link_id = ?", string(query)).First(&link).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return link.export(), persistence.ErrUnknownShareLink("relational: no matching share link found")
+			}
+			return link.export(), fmt.Errorf("relational: error looking up share link: %w", err)
+		}
+		return link.export(), nil
+	default:
+		return link.export(), persistence.ErrBadQuery
+	}
+}
+
+func (r *relationalDAL) DeleteShareLinks(q interface{}) (int64, error) {
+	switch query := q.(type) {
+	case persistence.DeleteShareLinksQueryByID:
+		deletion := r.db.Where("link_id = ? AND account_id = ?", query.LinkID, query.AccountID).Delete(&ShareLink{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting share link: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	case persistence.DeleteShareLinksQueryExpiredBefore:
+		deletion := r.db.Where("expires < ?", time.Time(query)).Delete(&ShareLink{})
+		if err := deletion.Error; err != nil {
+			return 0, fmt.Errorf("relational: error deleting expired share links: %w", err)
+		}
+		return deletion.RowsAffected, nil
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_ShareLinks(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	now := time.Now()
+	for _, link := range []*persistence.ShareLink{
+		{LinkID: "link-a", AccountID: "account-a", Expires: now.Add(time.Hour)},
+		{LinkID: "link-b", AccountID: "account-a", Expires: now.Add(-time.Hour)},
+		{LinkID: "link-c", AccountID: "account-b", Expires: now.Add(time.Hour)},
+	} {
+		if err := dal.CreateShareLink(link); err != nil {
+			t.Fatalf("Unexpected error creating share link: %v", err)
+		}
+	}
+
+	link, err := dal.FindShareLink(persistence.FindShareLinkQueryByID("link-a"))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if link.AccountID != "account-a" {
+		t.Errorf("Unexpected result %v", link)
+	}
+
+	var unknown persistence.ErrUnknownShareLink
+	if _, err := dal.FindShareLink(persistence.FindShareLinkQueryByID("link-z")); !errors.As(err, &unknown) {
+		t.Errorf("Expected unknown share link error, got %v", err)
+	}
+	if _, err := dal.FindShareLink("link-a"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+
+	affected, err := dal.DeleteShareLinks(persistence.DeleteShareLinksQueryExpiredBefore(now))
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result deleting expired links: %d, %v", affected, err)
+	}
+
+	affected, err = dal.DeleteShareLinks(persistence.DeleteShareLinksQueryByID{AccountID: "account-b", LinkID: "link-a"})
+	if err != nil || affected != 0 {
+		t.Errorf("Expected link of other account to be left untouched, got %d, %v", affected, err)
+	}
+	affected, err = dal.DeleteShareLinks(persistence.DeleteShareLinksQueryByID{AccountID: "account-a", LinkID: "link-a"})
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result revoking link: %d, %v", affected, err)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm/clause"
+)
+
+const restoreBatchSize = 500
+
+func (r *relationalDAL) DumpAll() (*persistence.Snapshot, error) {
+	return r.dump(true)
+}
+
+// DumpAllWithoutEvents returns a snapshot that contains all records except
+// events, which can be read in batches instead.
+func (r *relationalDAL) DumpAllWithoutEvents() (*persistence.Snapshot, error) {
+	return r.dump(false)
+}
+
+func (r *relationalDAL) dump(includeEvents bool) (*persistence.Snapshot, error) {
+	snapshot := persistence.Snapshot{}
+
+	var accounts []Account
+	if err := r.db.Find(&accounts).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping accounts: %w", err)
+	}
+	for _, a := range accounts {
+		snapshot.Accounts = append(snapshot.Accounts, a.export())
+	}
+
+	var accountUsers []AccountUser
+	if err := r.db.Find(&accountUsers).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping account users: %w", err)
+	}
+	for _, a := range accountUsers {
+		snapshot.AccountUsers = append(snapshot.AccountUsers, a.export())
+	}
+
+	var relationships []AccountUserRelationship
+	if err := r.db.Find(&relationships).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping account user relationships: %w", err)
+	}
+	for _, a := range relationships {
+		snapshot.AccountUserRelationships = append(snapshot.AccountUserRelationships, a.export())
+	}
+
+	var secrets []Secret
+	if err := r.db.Find(&secrets).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping secrets: %w", err)
+	}
+	for _, s := range secrets {
+		snapshot.Secrets = append(snapshot.Secrets, s.export())
+	}
+
+	if includeEvents {
+		var events []Event
+		if err := r.db.Order("event_id").Find(&events).Error; err != nil {
+			return nil, fmt.Errorf("relational: error dumping events: %w", err)
+		}
+		for _, e := range events {
+			snapshot.Events = append(snapshot.Events, e.export())
+		}
+	}
+
+	var tombstones []Tombstone
+	if err := r.db.Find(&tombstones).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping tombstones: %w", err)
+	}
+	for _, t := range tombstones {
+		snapshot.Tombstones = append(snapshot.Tombstones, t.export())
+	}
+
+	var entries []AuditLogEntry
+	if err := r.db.Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping audit log: %w", err)
+	}
+	for _, e := range entries {
+		snapshot.AuditLogEntries = append(snapshot.AuditLogEntries, e.export())
+	}
+
+	var shareLinks []ShareLink
+	if err := r.db.Find(&shareLinks).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping share links: %w", err)
+	}
+	for _, s := range shareLinks {
+		snapshot.ShareLinks = append(snapshot.ShareLinks, s.export())
+	}
+
+	var invitations []Invitation
+	if err := r.db.Find(&invitations).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping invitations: %w", err)
+	}
+	for _, i := range invitations {
+		snapshot.Invitations = append(snapshot.Invitations, i.export())
+	}
+
+	var webhooks []Webhook
+	if err := r.db.Find(&webhooks).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping webhooks: %w", err)
+	}
+	for _, w := range webhooks {
+		snapshot.Webhooks = append(snapshot.Webhooks, w.export())
+	}
+
+	var domains []AccountDomain
+	if err := r.db.Find(&domains).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping account domains: %w", err)
+	}
+	for _, d := range domains {
+		snapshot.AccountDomains = append(snapshot.AccountDomains, d.export())
+	}
+
+	var tokens []APIToken
+	if err := r.db.Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping api tokens: %w", err)
+	}
+	for _, t := range tokens {
+		snapshot.APITokens = append(snapshot.APITokens, t.export())
+	}
+
+	var credentials []WebAuthnCredential
+	if err := r.db.Find(&credentials).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping webauthn credentials: %w", err)
+	}
+	for _, c := range credentials {
+		snapshot.WebAuthnCredentials = append(snapshot.WebAuthnCredentials, c.export())
+	}
+
+	var pingCounters []PingCounter
+	if err := r.db.Find(&pingCounters).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping ping counters: %w", err)
+	}
+	for _, p := range pingCounters {
+		snapshot.PingCounters = append(snapshot.PingCounters, p.export())
+	}
+
+	var aggregateCounters []AggregateCounter
+	if err := r.db.Find(&aggregateCounters).Error; err != nil {
+		return nil, fmt.Errorf("relational: error dumping aggregate counters: %w", err)
+	}
+	for _, a := range aggregateCounters {
+		snapshot.AggregateCounters = append(snapshot.AggregateCounters, a.export())
+	}
+
+	return &snapshot, nil
+}
+
+// RestoreAll inserts all records of the given snapshot. Associations are
+// omitted as each kind of record is restored on its own.
+func (r *relationalDAL) RestoreAll(s *persistence.Snapshot) error {
+	insert := func(name string, count int, records interface{}) error {
+		if count == 0 {
+			return nil
+		}
+		if err := r.db.Omit(clause.Associations).CreateInBatches(records, restoreBatchSize).Error; err != nil {
+			return fmt.Errorf("relational: error restoring %s: %w", name, err)
+		}
+		return nil
+	}
+
+	var accounts []Account
+	for _, a := range s.Accounts {
+		accounts = append(accounts, importAccount(&a))
+	}
+	if err := insert("accounts", len(accounts), &accounts); err != nil {
+		return err
+	}
+
+	var accountUsers []AccountUser
+	for _, a := range s.AccountUsers {
+		accountUsers = append(accountUsers, importAccountUser(&a))
+	}
+	if err := insert("account users", len(accountUsers), &accountUsers); err != nil {
+		return err
+	}
+
+	var relationships []AccountUserRelationship
+	for _, a := range s.AccountUserRelationships {
+		relationships = append(relationships, importAccountUserRelationship(&a))
+	}
+	if err := insert("account user relationships", len(relationships), &relationships); err != nil {
+		return err
+	}
+
+	var secrets []Secret
+	for _, a := range s.Secrets {
+		secrets = append(secrets, importSecret(&a))
+	}
+	if err := insert("secrets", len(secrets), &secrets); err != nil {
+		return err
+	}
+
+	var events []Event
+	for _, e := range s.Events {
+		events = append(events, importEvent(&e))
+	}
+	if err := insert("events", len(events), &events); err != nil {
+		return err
+	}
+
+	var tombstones []Tombstone
+	for _, t := range s.Tombstones {
+		tombstones = append(tombstones, *importTombstone(&t))
+	}
+	if err := insert("tombstones", len(tombstones), &tombstones); err != nil {
+		return err
+	}
+
+	var entries []AuditLogEntry
+	for _, e := range s.AuditLogEntries {
+		entries = append(entries, importAuditLogEntry(&e))
+	}
+	if err := insert("audit log", len(entries), &entries); err != nil {
+		return err
+	}
+
+	var shareLinks []ShareLink
+	for _, l := range s.ShareLinks {
+		shareLinks = append(shareLinks, importShareLink(&l))
+	}
+	if err := insert("share links", len(shareLinks), &shareLinks); err != nil {
+		return err
+	}
+
+	var invitations []Invitation
+	for _, i := range s.Invitations {
+		invitations = append(invitations, importInvitation(&i))
+	}
+	if err := insert("invitations", len(invitations), &invitations); err != nil {
+		return err
+	}
+
+	var webhooks []Webhook
+	for _, w := range s.Webhooks {
+		webhooks = append(webhooks, importWebhook(&w))
+	}
+	if err := insert("webhooks", len(webhooks), &webhooks); err != nil {
+		return err
+	}
+
+	var domains []AccountDomain
+	for _, d := range s.AccountDomains {
+		domains = append(domains, importAccountDomain(&d))
+	}
+	if err := insert("account domains", len(domains), &domains); err != nil {
+		return err
+	}
+
+	var tokens []APIToken
+	for _, t := range s.APITokens {
+		tokens = append(tokens, importAPIToken(&t))
+	}
+	if err := insert("api tokens", len(tokens), &tokens); err != nil {
+		return err
+	}
+
+	var credentials []WebAuthnCredential
+	for _, c := range s.WebAuthnCredentials {
+		credentials = append(credentials, importWebAuthnCredential(&c))
+	}
+	if err := insert("webauthn credentials", len(credentials), &credentials); err != nil {
+		return err
+	}
+
+	var pingCounters []PingCounter
+	for _, p := range s.PingCounters {
+		pingCounters = append(pingCounters, importPingCounter(&p))
+	}
+	if err := insert("ping counters", len(pingCounters), &pingCounters); err != nil {
+		return err
+	}
+
+	var aggregateCounters []AggregateCounter
+	for _, a := range s.AggregateCounters {
+		aggregateCounters = append(aggregateCounters, importAggregateCounter(&a))
+	}
+	return insert("aggregate counters", len(aggregateCounters), &aggregateCounters)
+}
@@ -0,0 +1,65 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_Snapshot(t *testing.T) {
+	source, closeSource := createTestDatabase()
+	defer closeSource()
+	target, closeTarget := createTestDatabase()
+	defer closeTarget()
+
+	if err := source.Create(&Account{AccountID: "account-a", Name: "name"}).Error; err != nil {
+		t.Fatalf("Unexpected error setting up test: %v", err)
+	}
+	if err := source.Create(&AccountUser{AccountUserID: "user-a", Relationships: []AccountUserRelationship{
+		{RelationshipID: "relationship-a", AccountID: "account-a"},
+	}}).Error; err != nil {
+		t.Fatalf("Unexpected error setting up test: %v", err)
+	}
+	if err := source.Create(&Event{EventID: "event-a", AccountID: "account-a", SecretID: strptr("secret-a"), Payload: "payload", Secret: Secret{SecretID: "secret-a", EncryptedSecret: "secret"}}).Error; err != nil {
+		t.Fatalf("Unexpected error setting up test: %v", err)
+	}
+	if err := source.Create(&APIToken{TokenID: "token-a", AccountID: "account-a", Scopes: "read-stats"}).Error; err != nil {
+		t.Fatalf("Unexpected error setting up test: %v", err)
+	}
+	if err := source.Create(&PingCounter{AccountID: "account-a", Day: time.Date(2022, 3, 14, 0, 0, 0, 0, time.UTC), Count: 12}).Error; err != nil {
+		t.Fatalf("Unexpected error setting up test: %v", err)
+	}
+	if err := source.Create(&AggregateCounter{CounterID: "counter-a", AccountID: "account-a", Day: time.Date(2022, 3, 14, 0, 0, 0, 0, time.UTC), Count: 99, Epsilon: 0.5}).Error; err != nil {
+		t.Fatalf("Unexpected error setting up test: %v", err)
+	}
+
+	snapshot, err := NewRelationalDAL(source).DumpAll()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(snapshot.Accounts) != 1 || len(snapshot.AccountUsers) != 1 || len(snapshot.AccountUserRelationships) != 1 ||
+		len(snapshot.Secrets) != 1 || len(snapshot.Events) != 1 || len(snapshot.APITokens) != 1 ||
+		len(snapshot.PingCounters) != 1 || len(snapshot.AggregateCounters) != 1 {
+		t.Fatalf("Unexpected snapshot %v", snapshot)
+	}
+
+	if err := NewRelationalDAL(target).RestoreAll(snapshot); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	restored, err := NewRelationalDAL(target).DumpAll()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(snapshot, restored) {
+		t.Errorf("Expected restored snapshot to equal original, got %v and %v", restored, snapshot)
+	}
+
+	if err := NewRelationalDAL(target).RestoreAll(&persistence.Snapshot{}); err != nil {
+		t.Errorf("Unexpected error restoring empty snapshot: %v", err)
+	}
+}
@@ -7,13 +7,25 @@ import (
 	"fmt"
 
 	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
 )
 
 func (r *relationalDAL) CreateTombstone(t *persistence.Tombstone) error {
 	local := importTombstone(t)
-	if err := r.db.Create(&local).Error; err != nil {
-		return fmt.Errorf("relational: error creating tombstone: %w", err)
+	if err := r.db.Transaction(func(tx *gorm.DB) error {
+		first, err := reserveSequenceNumbers(tx, local.AccountID, 1)
+		if err != nil {
+			return err
+		}
+		local.SequenceNumber = first
+		if err := tx.Create(local).Error; err != nil {
+			return fmt.Errorf("relational: error creating tombstone: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
 	}
+	t.SequenceNumber = local.SequenceNumber
 	return nil
 }
 
@@ -21,7 +33,7 @@ func (r *relationalDAL) FindTombstones(q interface{}) ([]persistence.Tombstone,
 	switch query := q.(type) {
 	case persistence.FindTombstonesQueryByAccounts:
 		var result []Tombstone
-		if err := r.db.Find(&result, "account_id IN (?) AND sequence > ?", query.AccountIDs, query.Since).Error; err != nil {
+		if err := sinceSequenceNumbers(r.db, query.SinceSequenceNumbers).Find(&result, "account_id IN (?) AND sequence > ?", query.AccountIDs, query.Since).Error; err != nil {
 			return nil, fmt.Errorf("relational: error looking up tombstones by account ids: %w", err)
 		}
 		var export []persistence.Tombstone
@@ -31,7 +43,7 @@ func (r *relationalDAL) FindTombstones(q interface{}) ([]persistence.Tombstone,
 		return export, nil
 	case persistence.FindTombstonesQueryBySecrets:
 		var result []Tombstone
-		if err := r.db.Find(&result, "secret_id IN (?) AND sequence > ?", query.SecretIDs, query.Since).Error; err != nil {
+		if err := sinceSequenceNumbers(r.db, query.SinceSequenceNumbers).Find(&result, "secret_id IN (?) AND sequence > ?", query.SecretIDs, query.Since).Error; err != nil {
 			return nil, fmt.Errorf("relational: error looking up tombstones by secret ids: %w", err)
 		}
 		var export []persistence.Tombstone
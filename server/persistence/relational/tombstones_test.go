@@ -36,10 +36,11 @@ func TestRelationalDAL_CreateTombstone(t *testing.T) {
 					return fmt.Errorf("expected 1 item, got %d", len(allRecords))
 				}
 				if !reflect.DeepEqual(allRecords[0], Tombstone{
-					EventID:   "event-id",
-					AccountID: "account-id",
-					SecretID:  nil,
-					Sequence:  "sequence-a",
+					EventID:        "event-id",
+					AccountID:      "account-id",
+					SecretID:       nil,
+					Sequence:       "sequence-a",
+					SequenceNumber: 1,
 				}) {
 					return fmt.Errorf("found unexpected record %v", allRecords[0])
 				}
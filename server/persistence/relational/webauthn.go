@@ -0,0 +1,52 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func (r *relationalDAL) CreateWebAuthnCredential(c *persistence.WebAuthnCredential) error {
+	local := importWebAuthnCredential(c)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating webauthn credential: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindWebAuthnCredentials(q interface{}) ([]persistence.WebAuthnCredential, error) {
+	var credentials []WebAuthnCredential
+	switch query := q.(type) {
+	case persistence.FindWebAuthnCredentialsQueryByAccountUserID:
+		if err := r.db.
+			Where("account_user_id = ?", string(query)).
+			Order("created ASC").
+			Find(&credentials).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up webauthn credentials: %w", err)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	var result []persistence.WebAuthnCredential
+	for _, c := range credentials {
+		result = append(result, c.export())
+	}
+	return result, nil
+}
+
+func (r *relationalDAL) UpdateWebAuthnCredential(c *persistence.WebAuthnCredential) error {
+	local := importWebAuthnCredential(c)
+	update := r.db.Model(&WebAuthnCredential{}).
+		Where("credential_id = ? AND account_user_id = ?", local.CredentialID, local.AccountUserID).
+		Update("credential", local.Credential)
+	if err := update.Error; err != nil {
+		return fmt.Errorf("relational: error updating webauthn credential: %w", err)
+	}
+	if update.RowsAffected == 0 {
+		return fmt.Errorf("relational: webauthn credential %s not found", local.CredentialID)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_WebAuthnCredentials(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	now := time.Now()
+	for _, credential := range []*persistence.WebAuthnCredential{
+		{CredentialID: "credential-a", AccountUserID: "user-a", Credential: "a", Created: now.Add(-time.Minute)},
+		{CredentialID: "credential-b", AccountUserID: "user-a", Credential: "b", Created: now},
+		{CredentialID: "credential-c", AccountUserID: "user-b", Credential: "c", Created: now},
+	} {
+		if err := dal.CreateWebAuthnCredential(credential); err != nil {
+			t.Fatalf("Unexpected error creating webauthn credential: %v", err)
+		}
+	}
+
+	credentials, err := dal.FindWebAuthnCredentials(persistence.FindWebAuthnCredentialsQueryByAccountUserID("user-a"))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(credentials) != 2 || credentials[0].CredentialID != "credential-a" || credentials[1].CredentialID != "credential-b" {
+		t.Fatalf("Unexpected result %v", credentials)
+	}
+
+	if _, err := dal.FindWebAuthnCredentials("user-a"); err != persistence.ErrBadQuery {
+		t.Errorf("Expected bad query error, got %v", err)
+	}
+
+	if err := dal.UpdateWebAuthnCredential(&persistence.WebAuthnCredential{CredentialID: "credential-c", AccountUserID: "user-a", Credential: "x"}); err == nil {
+		t.Error("Expected error updating credential of other account user")
+	}
+	if err := dal.UpdateWebAuthnCredential(&persistence.WebAuthnCredential{CredentialID: "credential-b", AccountUserID: "user-a", Credential: "updated"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	credentials, _ = dal.FindWebAuthnCredentials(persistence.FindWebAuthnCredentialsQueryByAccountUserID("user-a"))
+	if len(credentials) != 2 || credentials[1].Credential != "updated" {
+		t.Errorf("Unexpected result after update %v", credentials)
+	}
+}
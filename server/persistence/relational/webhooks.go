@@ -0,0 +1,128 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+	"gorm.io/gorm"
+)
+
+func (r *relationalDAL) CreateWebhook(w *persistence.Webhook) error {
+	local := importWebhook(w)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating webhook: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindWebhooks(q interface{}) ([]persistence.Webhook, error) {
+	var webhooks []Webhook
+	var lookup *gorm.DB
+	switch query := q.(type) {
+	case persistence.FindWebhooksQueryByAccountID:
+		lookup = r.db.Where("account_id = ?", string(query))
+	case persistence.FindWebhooksQueryForAccount:
+		lookup = r.db.Where("account_id IN (?)", []string{string(query), ""})
+	case persistence.FindWebhooksQueryByID:
+		lookup = r.db.Where("webhook_id = ?", string(query))
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	if err := lookup.Order("created ASC").Find(&webhooks).Error; err != nil {
+		return nil, fmt.Errorf("relational: error looking up webhooks: %w", err)
+	}
+	var result []persistence.Webhook
+	for _, w := range webhooks {
+		result = append(result, w.export())
+	}
+	return result, nil
+}
+
+func (r *relationalDAL) DeleteWebhooks(q interface{}) (int64, error) {
+	var deletion *gorm.DB
+	switch query := q.(type) {
+	case persistence.DeleteWebhooksQueryByID:
+		deletion = r.db.Where("webhook_id = ? AND account_id = ?", query.WebhookID, query.AccountID).Delete(&Webhook{})
+	case persistence.DeleteWebhooksQueryByAccountID:
+		deletion = r.db.Where("account_id = ?", string(query)).Delete(&Webhook{})
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+	if err := deletion.Error; err != nil {
+		return 0, fmt.Errorf("relational: error deleting webhooks: %w", err)
+	}
+	return deletion.RowsAffected, nil
+}
+
+func (r *relationalDAL) CreateWebhookDelivery(d *persistence.WebhookDelivery) error {
+	local := importWebhookDelivery(d)
+	if err := r.db.Create(&local).Error; err != nil {
+		return fmt.Errorf("relational: error creating webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) FindWebhookDeliveries(q interface{}) ([]persistence.WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	switch query := q.(type) {
+	case persistence.FindWebhookDeliveriesQueryDue:
+		lookup := r.db.
+			Where("delivered = ? AND failed = ? AND next_attempt <= ?", false, false, query.Before).
+			Order("next_attempt ASC")
+		if query.Limit > 0 {
+			lookup = lookup.Limit(query.Limit)
+		}
+		if err := lookup.Find(&deliveries).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up due webhook deliveries: %w", err)
+		}
+	case persistence.FindWebhookDeliveriesQueryByWebhookID:
+		lookup := r.db.
+			Where("webhook_id = ?", query.WebhookID).
+			Order("created DESC")
+		if query.Limit > 0 {
+			lookup = lookup.Limit(query.Limit)
+		}
+		if err := lookup.Find(&deliveries).Error; err != nil {
+			return nil, fmt.Errorf("relational: error looking up webhook deliveries: %w", err)
+		}
+	default:
+		return nil, persistence.ErrBadQuery
+	}
+	var result []persistence.WebhookDelivery
+	for _, d := range deliveries {
+		result = append(result, d.export())
+	}
+	return result, nil
+}
+
+func (r *relationalDAL) UpdateWebhookDelivery(d *persistence.WebhookDelivery) error {
+	local := importWebhookDelivery(d)
+	if err := r.db.Save(&local).Error; err != nil {
+		return fmt.Errorf("relational: error updating webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (r *relationalDAL) DeleteWebhookDeliveries(q interface{}) (int64, error) {
+	var deletion *gorm.DB
+	switch query := q.(type) {
+	case persistence.DeleteWebhookDeliveriesQueryByWebhookID:
+		deletion = r.db.Where("webhook_id = ?", string(query)).Delete(&WebhookDelivery{})
+	case persistence.DeleteWebhookDeliveriesQueryByAccountID:
+		deletion = r.db.Where("account_id = ?", string(query)).Delete(&WebhookDelivery{})
+	case persistence.DeleteWebhookDeliveriesQueryCompletedBefore:
+		deletion = r.db.
+			Where("(delivered = ? OR failed = ?) AND created < ?", true, true, time.Time(query)).
+			Delete(&WebhookDelivery{})
+	default:
+		return 0, persistence.ErrBadQuery
+	}
+	if err := deletion.Error; err != nil {
+		return 0, fmt.Errorf("relational: error deleting webhook deliveries: %w", err)
+	}
+	return deletion.RowsAffected, nil
+}
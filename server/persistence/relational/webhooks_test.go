@@ -0,0 +1,93 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package relational
+
+import (
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRelationalDAL_Webhooks(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	now := time.Now()
+	for _, hook := range []*persistence.Webhook{
+		{WebhookID: "webhook-a", AccountID: "account-a", URL: "https://a.offen.dev", Events: []string{persistence.WebhookEventUserJoined, persistence.WebhookEventQuotaExceeded}, Created: now.Add(-time.Hour)},
+		{WebhookID: "webhook-b", URL: "https://b.offen.dev", Events: []string{persistence.WebhookEventAccountCreated}, Created: now},
+		{WebhookID: "webhook-c", AccountID: "account-c", URL: "https://c.offen.dev", Events: []string{persistence.WebhookEventUserJoined}, Created: now},
+	} {
+		if err := dal.CreateWebhook(hook); err != nil {
+			t.Fatalf("Unexpected error creating webhook: %v", err)
+		}
+	}
+
+	webhooks, err := dal.FindWebhooks(persistence.FindWebhooksQueryForAccount("account-a"))
+	if err != nil || len(webhooks) != 2 || webhooks[0].WebhookID != "webhook-a" || webhooks[1].WebhookID != "webhook-b" {
+		t.Errorf("Unexpected result %v, %v", webhooks, err)
+	}
+	if len(webhooks) > 0 && len(webhooks[0].Events) != 2 {
+		t.Errorf("Unexpected events %v", webhooks[0].Events)
+	}
+	webhooks, err = dal.FindWebhooks(persistence.FindWebhooksQueryByAccountID(""))
+	if err != nil || len(webhooks) != 1 || webhooks[0].WebhookID != "webhook-b" {
+		t.Errorf("Unexpected instance wide webhooks %v, %v", webhooks, err)
+	}
+
+	affected, err := dal.DeleteWebhooks(persistence.DeleteWebhooksQueryByID{AccountID: "account-a", WebhookID: "webhook-c"})
+	if err != nil || affected != 0 {
+		t.Errorf("Expected webhook of other account to be kept, got %d, %v", affected, err)
+	}
+	affected, err = dal.DeleteWebhooks(persistence.DeleteWebhooksQueryByAccountID("account-c"))
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result deleting webhooks %d, %v", affected, err)
+	}
+}
+
+func TestRelationalDAL_WebhookDeliveries(t *testing.T) {
+	db, closeDB := createTestDatabase()
+	defer closeDB()
+	dal := NewRelationalDAL(db)
+
+	now := time.Now()
+	for _, delivery := range []*persistence.WebhookDelivery{
+		{DeliveryID: "delivery-a", WebhookID: "webhook-a", AccountID: "account-a", NextAttempt: now.Add(-time.Minute), Created: now.Add(-time.Minute)},
+		{DeliveryID: "delivery-b", WebhookID: "webhook-a", AccountID: "account-a", NextAttempt: now.Add(-time.Hour), Created: now.Add(-time.Hour)},
+		{DeliveryID: "delivery-c", WebhookID: "webhook-a", AccountID: "account-a", NextAttempt: now.Add(time.Hour), Created: now},
+		{DeliveryID: "delivery-d", WebhookID: "webhook-b", AccountID: "account-b", Delivered: true, Created: now.Add(-time.Hour * 24 * 40)},
+	} {
+		if err := dal.CreateWebhookDelivery(delivery); err != nil {
+			t.Fatalf("Unexpected error creating delivery: %v", err)
+		}
+	}
+
+	deliveries, err := dal.FindWebhookDeliveries(persistence.FindWebhookDeliveriesQueryDue{Before: now})
+	if err != nil || len(deliveries) != 2 || deliveries[0].DeliveryID != "delivery-b" || deliveries[1].DeliveryID != "delivery-a" {
+		t.Errorf("Unexpected due deliveries %v, %v", deliveries, err)
+	}
+
+	update := deliveries[0]
+	update.Delivered = true
+	update.StatusCode = 204
+	if err := dal.UpdateWebhookDelivery(&update); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	deliveries, err = dal.FindWebhookDeliveries(persistence.FindWebhookDeliveriesQueryByWebhookID{WebhookID: "webhook-a", Limit: 2})
+	if err != nil || len(deliveries) != 2 || deliveries[0].DeliveryID != "delivery-c" || deliveries[1].DeliveryID != "delivery-a" {
+		t.Errorf("Unexpected deliveries of webhook %v, %v", deliveries, err)
+	}
+
+	affected, err := dal.DeleteWebhookDeliveries(persistence.DeleteWebhookDeliveriesQueryCompletedBefore(now.Add(-time.Hour * 24 * 30)))
+	if err != nil || affected != 1 {
+		t.Errorf("Unexpected result pruning deliveries %d, %v", affected, err)
+	}
+	affected, err = dal.DeleteWebhookDeliveries(persistence.DeleteWebhookDeliveriesQueryByWebhookID("webhook-a"))
+	if err != nil || affected != 3 {
+		t.Errorf("Unexpected result deleting deliveries %d, %v", affected, err)
+	}
+}
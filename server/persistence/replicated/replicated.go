@@ -0,0 +1,108 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package replicated routes read-only queries of a data access layer to one
+// or more read replicas, while all writes and transactions are sent to the
+// primary database. In case a replica fails to answer a query, the query is
+// sent to the primary instead and the replica is not used again until it
+// answers pings again.
+//
+// Replicas might lag behind the primary, so queries are only routed to
+// replicas when callers explicitly opt in using ReadReplica, which they do
+// for reads whose results are never written back.
+package replicated
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+// unavailableFor is the time a failing replica is skipped before it is
+// considered again.
+const unavailableFor = time.Second * 30
+
+type replica struct {
+	persistence.DataAccessLayer
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+func (r *replica) available(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !now.Before(r.downUntil)
+}
+
+func (r *replica) markDown(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.downUntil = now.Add(unavailableFor)
+}
+
+type replicatedDAL struct {
+	persistence.DataAccessLayer
+	replicas []*replica
+	next     atomic.Uint64
+	now      func() time.Time
+}
+
+// NewReplicatedDAL wraps the given primary data access layer, routing reads
+// to the given replicas. In case no replicas are given, the primary is
+// returned as is.
+func NewReplicatedDAL(primary persistence.DataAccessLayer, replicas ...persistence.DataAccessLayer) persistence.DataAccessLayer {
+	if len(replicas) == 0 {
+		return primary
+	}
+	r := &replicatedDAL{DataAccessLayer: primary, now: time.Now}
+	for _, dal := range replicas {
+		r.replicas = append(r.replicas, &replica{DataAccessLayer: dal})
+	}
+	return r
+}
+
+// read calls fn with the next available replica in a round robin fashion.
+// In case no replica is available or the query fails, fn is called using
+// the primary. All other methods use the primary.
+func (r *replicatedDAL) read(fn func(persistence.DataAccessLayer) error) error {
+	now := r.now()
+	start := r.next.Add(1)
+	for i := 0; i < len(r.replicas); i++ {
+		replica := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if !replica.available(now) {
+			continue
+		}
+		err := fn(replica)
+		if err == nil {
+			return nil
+		}
+		// errors like unknown records might be caused by replication lag,
+		// so the replica is only skipped in case it cannot be reached
+		if pingErr := replica.Ping(); pingErr != nil {
+			replica.markDown(now)
+		}
+		break
+	}
+	return fn(r.DataAccessLayer)
+}
+
+// ReadReplica calls fn with the next available replica. All reads fn
+// performs are served by the same database, so that results of multiple
+// queries, e.g. events and tombstones, are consistent with each other.
+func (r *replicatedDAL) ReadReplica(fn func(persistence.DataAccessLayer) error) error {
+	return r.read(fn)
+}
+
+// Transaction always uses the primary, so that reads inside a transaction
+// are consistent with its writes.
+func (r *replicatedDAL) Transaction() (persistence.Transaction, error) {
+	return r.DataAccessLayer.Transaction()
+}
+
+// Ping only reports the health of the primary, as failing replicas are
+// skipped.
+func (r *replicatedDAL) Ping() error {
+	return r.DataAccessLayer.Ping()
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package replicated
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockDAL struct {
+	persistence.DataAccessLayer
+	name    string
+	findErr error
+	pingErr error
+	calls   int
+}
+
+func (m *mockDAL) FindAccount(q interface{}) (persistence.Account, error) {
+	m.calls++
+	if m.findErr != nil {
+		return persistence.Account{}, m.findErr
+	}
+	return persistence.Account{AccountID: m.name}, nil
+}
+
+func (m *mockDAL) FindEvents(q interface{}) ([]persistence.Event, error) {
+	m.calls++
+	return []persistence.Event{{EventID: m.name}}, m.findErr
+}
+
+func (m *mockDAL) Ping() error {
+	return m.pingErr
+}
+
+func (m *mockDAL) Transaction() (persistence.Transaction, error) {
+	return nil, errors.New(m.name)
+}
+
+func TestNewReplicatedDAL(t *testing.T) {
+	primary := &mockDAL{name: "primary"}
+	if NewReplicatedDAL(primary) != primary {
+		t.Error("Expected primary to be returned when no replicas are given")
+	}
+}
+
+func readAccount(dal persistence.DataAccessLayer) (persistence.Account, error) {
+	var account persistence.Account
+	err := dal.(persistence.ReplicaReader).ReadReplica(func(dal persistence.DataAccessLayer) error {
+		var err error
+		account, err = dal.FindAccount(persistence.FindAccountQueryByID("x"))
+		return err
+	})
+	return account, err
+}
+
+func readEvents(dal persistence.DataAccessLayer) ([]persistence.Event, error) {
+	var events []persistence.Event
+	err := dal.(persistence.ReplicaReader).ReadReplica(func(dal persistence.DataAccessLayer) error {
+		var err error
+		events, err = dal.FindEvents(persistence.FindEventsQueryByEventIDs{"x"})
+		return err
+	})
+	return events, err
+}
+
+func TestReplicatedDAL_read(t *testing.T) {
+	t.Run("round robin", func(t *testing.T) {
+		primary, a, b := &mockDAL{name: "primary"}, &mockDAL{name: "a"}, &mockDAL{name: "b"}
+		dal := NewReplicatedDAL(primary, a, b)
+		seen := map[string]int{}
+		for i := 0; i < 4; i++ {
+			account, err := readAccount(dal)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			seen[account.AccountID]++
+		}
+		if seen["a"] != 2 || seen["b"] != 2 || primary.calls != 0 {
+			t.Errorf("Unexpected distribution %v", seen)
+		}
+	})
+	t.Run("lagging replica", func(t *testing.T) {
+		primary := &mockDAL{name: "primary"}
+		lagging := &mockDAL{name: "a", findErr: persistence.ErrUnknownAccount("unknown")}
+		dal := NewReplicatedDAL(primary, lagging)
+		account, err := readAccount(dal)
+		if err != nil || account.AccountID != "primary" {
+			t.Errorf("Unexpected result %v, %v", account, err)
+		}
+		readAccount(dal)
+		if lagging.calls != 2 {
+			t.Errorf("Expected reachable replica to be used again, got %d calls", lagging.calls)
+		}
+	})
+	t.Run("unreachable replica", func(t *testing.T) {
+		primary := &mockDAL{name: "primary"}
+		down := &mockDAL{name: "a", findErr: errors.New("connection refused"), pingErr: errors.New("connection refused")}
+		dal := NewReplicatedDAL(primary, down).(*replicatedDAL)
+		now := time.Now()
+		dal.now = func() time.Time { return now }
+
+		events, err := readEvents(dal)
+		if err != nil || events[0].EventID != "primary" {
+			t.Errorf("Unexpected result %v, %v", events, err)
+		}
+		readEvents(dal)
+		if down.calls != 1 || primary.calls != 2 {
+			t.Errorf("Expected unreachable replica to be skipped, got %d calls", down.calls)
+		}
+
+		down.findErr, down.pingErr = nil, nil
+		now = now.Add(unavailableFor)
+		events, _ = readEvents(dal)
+		if events[0].EventID != "a" {
+			t.Errorf("Expected replica to be used again, got %v", events)
+		}
+	})
+	t.Run("primary by default", func(t *testing.T) {
+		primary, replica := &mockDAL{name: "primary"}, &mockDAL{name: "a"}
+		dal := NewReplicatedDAL(primary, replica)
+		account, err := dal.FindAccount(persistence.FindAccountQueryByID("x"))
+		if err != nil || account.AccountID != "primary" || replica.calls != 0 {
+			t.Errorf("Expected reads outside of ReadReplica to use primary, got %v, %v", account, err)
+		}
+	})
+	t.Run("single source", func(t *testing.T) {
+		primary, a, b := &mockDAL{name: "primary"}, &mockDAL{name: "a"}, &mockDAL{name: "b"}
+		dal := NewReplicatedDAL(primary, a, b)
+		var sources []string
+		dal.(persistence.ReplicaReader).ReadReplica(func(dal persistence.DataAccessLayer) error {
+			for i := 0; i < 3; i++ {
+				account, _ := dal.FindAccount(persistence.FindAccountQueryByID("x"))
+				sources = append(sources, account.AccountID)
+			}
+			return nil
+		})
+		if len(sources) != 3 || sources[0] == "primary" || sources[1] != sources[0] || sources[2] != sources[0] {
+			t.Errorf("Expected all reads to use the same replica, got %v", sources)
+		}
+	})
+	t.Run("transactions", func(t *testing.T) {
+		dal := NewReplicatedDAL(&mockDAL{name: "primary"}, &mockDAL{name: "a"})
+		if _, err := dal.Transaction(); err == nil || err.Error() != "primary" {
+			t.Errorf("Expected transaction to use primary, got %v", err)
+		}
+	})
+}
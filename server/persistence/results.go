@@ -3,7 +3,10 @@
 
 package persistence
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // SecretResult contains information about a single secret record
 type SecretResult struct {
@@ -17,16 +20,78 @@ type EventsResult struct {
 	Events          *EventsByAccountID `json:"events,omitempty"`
 	DeletedEvents   []string           `json:"deletedEvents,omitempty"`
 	Sequence        string             `json:"sequence,omitempty"`
+	NextCursor      string             `json:"nextCursor,omitempty"`
 	RetentionPeriod string             `json:"retentionPeriod,omitempty"`
 }
 
 // EventResult is an element returned from a query. It contains all data that
 // is stored about an atomic event.
 type EventResult struct {
-	AccountID string  `json:"accountId,omitempty"`
-	SecretID  *string `json:"secretId,omitempty"`
-	EventID   string  `json:"eventId"`
-	Payload   string  `json:"payload"`
+	AccountID  string  `json:"accountId,omitempty"`
+	SecretID   *string `json:"secretId,omitempty"`
+	EventID    string  `json:"eventId"`
+	Payload    string  `json:"payload"`
+	KeyVersion int     `json:"keyVersion,omitempty"`
+	EventType  string  `json:"eventType,omitempty"`
+}
+
+// ExportedEventResult is a single event contained in an account export. It
+// carries the encrypted secret of the user that has created the event, so
+// it can be decrypted without any further lookups.
+type ExportedEventResult struct {
+	EventID         string  `json:"eventId"`
+	SecretID        *string `json:"secretId,omitempty"`
+	EncryptedSecret string  `json:"encryptedSecret,omitempty"`
+	KeyVersion      int     `json:"keyVersion,omitempty"`
+	Payload         string  `json:"payload"`
+	EventType       string  `json:"eventType,omitempty"`
+	// KeyFingerprint identifies the account key the secret has been
+	// encrypted with, so instances importing the event can check they
+	// hold the same key.
+	KeyFingerprint string `json:"keyFingerprint,omitempty"`
+}
+
+// ProvisionResult lists the changes applied when provisioning accounts.
+type ProvisionResult struct {
+	DryRun  bool              `json:"dryRun"`
+	Changes []ProvisionChange `json:"changes"`
+}
+
+// ProvisionChange is a single change applied when provisioning accounts.
+// Target is the setting or the member a change applies to.
+type ProvisionChange struct {
+	Action    string `json:"action"`
+	AccountID string `json:"accountId"`
+	Target    string `json:"target,omitempty"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+}
+
+// ImportResult reports the outcome of merging exported events into an
+// account.
+type ImportResult struct {
+	Imported int `json:"imported"`
+	// Skipped is the number of events that already exist or have been
+	// deleted in the importing instance.
+	Skipped int `json:"skipped"`
+}
+
+// UserDataResult contains all data that is stored about a single user across
+// all accounts. Payloads and secrets are returned in their encrypted form, as
+// the server is not able to decrypt them.
+type UserDataResult struct {
+	Created  time.Time               `json:"created"`
+	Accounts []UserDataAccountResult `json:"accounts"`
+}
+
+// UserDataAccountResult contains the data stored about a user for a single
+// account.
+type UserDataAccountResult struct {
+	AccountID       string        `json:"accountId"`
+	AccountName     string        `json:"accountName"`
+	SecretID        string        `json:"secretId"`
+	EncryptedSecret string        `json:"encryptedSecret,omitempty"`
+	Events          []EventResult `json:"events"`
 }
 
 // EventsByAccountID groups a list of events by AccountID in a response
@@ -42,6 +107,8 @@ type AccountResult struct {
 	Name                string                `json:"name"`
 	PublicKey           interface{}           `json:"publicKey,omitempty"`
 	EncryptedPrivateKey string                `json:"encryptedPrivateKey,omitempty"`
+	KeyVersion          int                   `json:"keyVersion,omitempty"`
+	PreviousKeys        []AccountKeyResult    `json:"previousKeys,omitempty"`
 	Events              *EventsByAccountID    `json:"events,omitempty"`
 	DeletedEvents       []string              `json:"deletedEvents,omitempty"`
 	Sequence            string                `json:"sequence,omitempty"`
@@ -49,12 +116,231 @@ type AccountResult struct {
 	AccountStyles       string                `json:"accountStyles,omitempty"`
 	Created             time.Time             `json:"created,omitempty"`
 	RetentionPeriod     string                `json:"retentionPeriod,omitempty"`
+	RetentionRules      RetentionRules        `json:"retentionRules,omitempty"`
+	BotPolicy           string                `json:"botPolicy,omitempty"`
+	AllowedOrigins      []string              `json:"allowedOrigins,omitempty"`
+	EventTypes          EventTypes            `json:"eventTypes,omitempty"`
+	CookiePolicy        *CookiePolicy         `json:"cookiePolicy,omitempty"`
+	FeatureFlags        FeatureFlags          `json:"featureFlags,omitempty"`
+	Locale              string                `json:"locale,omitempty"`
+	Theme               *Theme                `json:"theme,omitempty"`
+	WriteKeys           WriteKeys             `json:"writeKeys,omitempty"`
+	Usage               *AccountUsageResult   `json:"usage,omitempty"`
+}
+
+// AccountKeyResult is a previous keypair of an account that is needed for
+// decrypting secrets created before the account's keys were rotated.
+type AccountKeyResult struct {
+	Version             int    `json:"version"`
+	EncryptedPrivateKey string `json:"encryptedPrivateKey"`
+}
+
+// AccountUsageResult contains the number of events of an account and the
+// quotas that apply to them. Limits of zero mean no quota is enforced.
+type AccountUsageResult struct {
+	EventsThisMonth     int64 `json:"eventsThisMonth"`
+	EventsPerMonthLimit int64 `json:"eventsPerMonthLimit"`
+	StoredEvents        int64 `json:"storedEvents"`
+	StoredEventsLimit   int64 `json:"storedEventsLimit"`
+}
+
+// AdminAccountResult describes an account for instance operators.
+type AdminAccountResult struct {
+	AccountID     string    `json:"accountId"`
+	Name          string    `json:"name"`
+	Created       time.Time `json:"created"`
+	Retired       bool      `json:"retired"`
+	Disabled      bool      `json:"disabled"`
+	EventCount    int64     `json:"eventCount"`
+	LatestEventID string    `json:"latestEventId,omitempty"`
+}
+
+// InstanceUsageResult contains aggregate usage of all accounts of an
+// instance.
+type InstanceUsageResult struct {
+	Accounts         int   `json:"accounts"`
+	RetiredAccounts  int   `json:"retiredAccounts"`
+	DisabledAccounts int   `json:"disabledAccounts"`
+	Events           int64 `json:"events"`
+}
+
+// AccountSummaryResult contains aggregate information about the events
+// stored for an account.
+type AccountSummaryResult struct {
+	AccountID     string `json:"accountId"`
+	EventCount    int64  `json:"eventCount"`
+	LatestEventID string `json:"latestEventId,omitempty"`
+	Sequence      string `json:"sequence,omitempty"`
+}
+
+// ShareLinkResult describes a share link.
+type ShareLinkResult struct {
+	LinkID    string    `json:"linkId"`
+	AccountID string    `json:"accountId"`
+	Expires   time.Time `json:"expires"`
+}
+
+// SessionResult describes an active login session of an account user.
+type SessionResult struct {
+	SessionID     string    `json:"sessionId"`
+	AccountUserID string    `json:"-"`
+	Created       time.Time `json:"created"`
+	Expires       time.Time `json:"expires"`
+	Current       bool      `json:"current"`
+}
+
+// QueuedMailResult describes a queued mail. The body is never exposed as
+// it might contain secrets like password reset links.
+type QueuedMailResult struct {
+	MailID      string    `json:"mailId"`
+	To          string    `json:"to"`
+	Subject     string    `json:"subject"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"lastError"`
+	Failed      bool      `json:"failed"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	Created     time.Time `json:"created"`
+}
+
+// WebhookResult describes a webhook. The secret is only populated right after
+// the webhook has been created.
+type WebhookResult struct {
+	WebhookID string    `json:"webhookId"`
+	AccountID string    `json:"accountId,omitempty"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedBy string    `json:"createdBy"`
+	Created   time.Time `json:"created"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+// WebhookDeliveryResult describes an attempted or pending delivery of a
+// webhook.
+type WebhookDeliveryResult struct {
+	DeliveryID  string          `json:"deliveryId"`
+	WebhookID   string          `json:"webhookId"`
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	StatusCode  int             `json:"statusCode,omitempty"`
+	LastError   string          `json:"lastError,omitempty"`
+	Delivered   bool            `json:"delivered"`
+	Failed      bool            `json:"failed"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+	Created     time.Time       `json:"created"`
+}
+
+// AccountDomainResult describes a domain claimed by an account and the
+// challenge that needs to be published for verifying it.
+type AccountDomainResult struct {
+	DomainID string     `json:"domainId"`
+	Domain   string     `json:"domain"`
+	Record   string     `json:"record"`
+	Value    string     `json:"value"`
+	MetaTag  string     `json:"metaTag"`
+	Created  time.Time  `json:"created"`
+	Verified *time.Time `json:"verified,omitempty"`
+}
+
+// TOTPSetupResult contains the secret that needs to be added to an
+// authenticator app, both plain and as an otpauth URI.
+type TOTPSetupResult struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TOTPVerifyResult contains the recovery codes that are created when enabling
+// two factor authentication. They are not stored and cannot be retrieved
+// again later.
+type TOTPVerifyResult struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// WebAuthnCredentialResult is a passkey registered by an account user.
+type WebAuthnCredentialResult struct {
+	CredentialID string    `json:"credentialId"`
+	Credential   string    `json:"-"`
+	Created      time.Time `json:"created"`
+}
+
+// APITokenResult describes an API token. The token itself is only populated
+// right after it has been created.
+type APITokenResult struct {
+	TokenID       string    `json:"tokenId"`
+	AccountID     string    `json:"accountId"`
+	AccountUserID string    `json:"accountUserId"`
+	Name          string    `json:"name"`
+	Scopes        []string  `json:"scopes"`
+	Created       time.Time `json:"created"`
+	Token         string    `json:"token,omitempty"`
+}
+
+// HasScope checks whether the token has been granted the given scope.
+func (a *APITokenResult) HasScope(scope string) bool {
+	for _, s := range a.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
 
 // ShareAccountResult is a successful invitation of a user
 type ShareAccountResult struct {
 	UserExistsWithPassword bool
 	AccountNames           []string
+	// RoleChanged is set when the invitee had access to a requested account
+	// before and has been granted a different role for it.
+	RoleChanged bool
+	// InvitationID is set when access to at least one account has been
+	// shared with the invitee.
+	InvitationID string
+}
+
+// AccountUserResult describes an account user that is a member of an
+// account.
+type AccountUserResult struct {
+	AccountUserID string          `json:"accountUserId"`
+	Role          AccountUserRole `json:"role"`
+	// Pending is set when the account user has been invited but has not
+	// accepted the invitation yet.
+	Pending bool `json:"pending"`
+}
+
+// AnomalyResult describes a day on which an account has received an unusual
+// number of events.
+type AnomalyResult struct {
+	AnomalyID   string    `json:"anomalyId"`
+	AccountID   string    `json:"accountId"`
+	AccountName string    `json:"accountName"`
+	Day         time.Time `json:"day"`
+	Count       int64     `json:"count"`
+	Expected    float64   `json:"expected"`
+	Deviation   float64   `json:"deviation"`
+}
+
+// AggregateResult is the noised number of events an account has received on
+// a single day.
+type AggregateResult struct {
+	Day     time.Time `json:"day"`
+	Count   int64     `json:"count"`
+	Epsilon float64   `json:"epsilon"`
+}
+
+// PingResult is the number of cookieless pings an account has received on a
+// single day.
+type PingResult struct {
+	Day   time.Time `json:"day"`
+	Count int64     `json:"count"`
+}
+
+// InvitationResult describes an invitation that has not been accepted yet.
+type InvitationResult struct {
+	InvitationID           string    `json:"invitationId"`
+	AccountIDs             []string  `json:"accountIds"`
+	AccountNames           []string  `json:"accountNames,omitempty"`
+	Expires                time.Time `json:"expires"`
+	UserExistsWithPassword bool      `json:"-"`
 }
 
 // LoginResult is a successful account user authentication response.
@@ -75,6 +361,27 @@ func (l *LoginResult) CanAccessAccount(accountID string) bool {
 	return false
 }
 
+// HasRole checks whether the login result has been granted the given role
+// or a role including it for the account of the given identifier.
+func (l *LoginResult) HasRole(accountID string, role AccountUserRole) bool {
+	for _, account := range l.Accounts {
+		if accountID == account.AccountID {
+			return account.Role.Includes(role)
+		}
+	}
+	return false
+}
+
+// AccountIDs returns the identifiers of all accounts the login result
+// is allowed to access.
+func (l *LoginResult) AccountIDs() []string {
+	var result []string
+	for _, account := range l.Accounts {
+		result = append(result, account.AccountID)
+	}
+	return result
+}
+
 // IsSuperAdmin checks whether the login result is a SuperAdmin.
 func (l *LoginResult) IsSuperAdmin() bool {
 	return l.AdminLevel == AccountUserAdminLevelSuperAdmin
@@ -83,8 +390,18 @@ func (l *LoginResult) IsSuperAdmin() bool {
 // LoginAccountResult contains information for the client to handle an account
 // in the client at runtime.
 type LoginAccountResult struct {
-	AccountName      string      `json:"accountName"`
-	AccountID        string      `json:"accountId"`
-	KeyEncryptionKey interface{} `json:"keyEncryptionKey"`
-	Created          time.Time   `json:"created"`
+	AccountName      string          `json:"accountName"`
+	AccountID        string          `json:"accountId"`
+	Role             AccountUserRole `json:"role"`
+	KeyEncryptionKey interface{}     `json:"keyEncryptionKey"`
+	Created          time.Time       `json:"created"`
+}
+
+// AuditLogResult is a single entry in an account's audit log
+type AuditLogResult struct {
+	EntryID       string    `json:"entryId"`
+	AccountUserID string    `json:"accountUserId,omitempty"`
+	Action        string    `json:"action"`
+	Target        string    `json:"target,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
 }
@@ -0,0 +1,116 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RetentionRule limits the events stored for an account in addition to its
+// retention period. Exactly one of MaxAgeDays and MaxEvents is expected to be
+// set. As event payloads are encrypted, rules cannot consider their contents,
+// but they can be limited to events of a single EventType.
+type RetentionRule struct {
+	MaxAgeDays int    `json:"maxAgeDays,omitempty"`
+	MaxEvents  int64  `json:"maxEvents,omitempty"`
+	EventType  string `json:"eventType,omitempty"`
+}
+
+// RetentionRules is the set of rules an account defines. All rules are
+// applied, so the most restrictive one wins.
+type RetentionRules []RetentionRule
+
+// Validate checks whether all rules are well formed.
+func (r RetentionRules) Validate() error {
+	for i, rule := range r {
+		if rule.MaxAgeDays < 0 || rule.MaxEvents < 0 {
+			return fmt.Errorf("persistence: rule %d contains a negative value", i)
+		}
+		if (rule.MaxAgeDays == 0) == (rule.MaxEvents == 0) {
+			return fmt.Errorf("persistence: rule %d is expected to set exactly one of maxAgeDays and maxEvents", i)
+		}
+		if rule.EventType != "" {
+			if err := ValidateEventTypeName(rule.EventType); err != nil {
+				return fmt.Errorf("persistence: rule %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func parseRetentionRules(s string) (RetentionRules, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var rules RetentionRules
+	if err := json.Unmarshal([]byte(s), &rules); err != nil {
+		return nil, fmt.Errorf("persistence: error parsing retention rules: %w", err)
+	}
+	return rules, nil
+}
+
+// expiredQueries returns the queries matching all events of the given account
+// that are to be expired by its retention rules.
+func (r RetentionRules) expiredQueries(dal DataAccessLayer, accountID string, now time.Time) ([]FindEventsQueryExpired, error) {
+	var queries []FindEventsQueryExpired
+	for _, rule := range r {
+		switch {
+		case rule.MaxAgeDays > 0:
+			deadline, err := EventIDAt(now.AddDate(0, 0, -rule.MaxAgeDays))
+			if err != nil {
+				return nil, fmt.Errorf("persistence: error determining deadline: %w", err)
+			}
+			queries = append(queries, FindEventsQueryExpired{Before: deadline, AccountID: accountID, EventType: rule.EventType})
+		case rule.MaxEvents > 0:
+			events, err := dal.FindEvents(FindEventsQueryNthNewest{AccountID: accountID, N: rule.MaxEvents, EventType: rule.EventType})
+			if err != nil {
+				return nil, fmt.Errorf("persistence: error looking up oldest retained event: %w", err)
+			}
+			if len(events) == 0 {
+				continue
+			}
+			queries = append(queries, FindEventsQueryExpired{Before: events[0].EventID, AccountID: accountID, EventType: rule.EventType})
+		}
+	}
+	return queries, nil
+}
+
+func (p *persistenceLayer) UpdateAccountRetentionRules(accountID string, rules RetentionRules, accountUserID string) error {
+	if err := rules.Validate(); err != nil {
+		return fmt.Errorf("persistence: invalid retention rules: %w", err)
+	}
+	a, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account before updating retention rules: %w", err)
+	}
+
+	var encoded string
+	if len(rules) != 0 {
+		b, err := json.Marshal(rules)
+		if err != nil {
+			return fmt.Errorf("persistence: error encoding retention rules: %w", err)
+		}
+		encoded = string(b)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	a.RetentionRules = encoded
+	if err := txn.UpdateAccount(&a); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error updating retention rules of account %s: %w", accountID, err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionUpdateRetentionRules, fmt.Sprintf("%d rules", len(rules))); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording retention rules update of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing retention rules update: %w", err)
+	}
+	return nil
+}
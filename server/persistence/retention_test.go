@@ -0,0 +1,76 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRetentionRules_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       RetentionRules
+		expectError bool
+	}{
+		{"empty", nil, false},
+		{"ok", RetentionRules{{MaxAgeDays: 30}, {MaxEvents: 100000}}, false},
+		{"no value", RetentionRules{{}}, true},
+		{"both values", RetentionRules{{MaxAgeDays: 30, MaxEvents: 100000}}, true},
+		{"negative value", RetentionRules{{MaxAgeDays: -1}}, true},
+		{"event type", RetentionRules{{MaxAgeDays: 7, EventType: "signup"}}, false},
+		{"bad event type", RetentionRules{{MaxAgeDays: 7, EventType: "sign up"}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.rules.Validate(); (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
+
+func TestPersistenceLayer_UpdateAccountRetentionRules(t *testing.T) {
+	t.Run("invalid rules", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdateAccountRetentionRules("account-a", RetentionRules{{}}, "user-a"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if len(db.updated) != 0 {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+	})
+	t.Run("unknown account", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{findErr: ErrUnknownAccount("unknown")}
+		p := &persistenceLayer{dal: db}
+		var unknown ErrUnknownAccount
+		if err := p.UpdateAccountRetentionRules("account-a", RetentionRules{{MaxAgeDays: 30}}, "user-a"); !errors.As(err, &unknown) {
+			t.Errorf("Expected unknown account error, got %v", err)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdateAccountRetentionRules("account-a", RetentionRules{{MaxAgeDays: 30}, {MaxEvents: 100000}}, "user-a"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 || db.updated[0].RetentionRules != `[{"maxAgeDays":30},{"maxEvents":100000}]` {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionUpdateRetentionRules || db.auditLog[0].Target != "2 rules" {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+	t.Run("reset", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.UpdateAccountRetentionRules("account-a", nil, "user-a"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 || db.updated[0].RetentionRules != "" {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"time"
+)
+
+// sqlStateSerializationFailure is returned by databases like CockroachDB when
+// a transaction conflicts with a concurrent one. Such transactions are
+// expected to be retried by the client.
+const sqlStateSerializationFailure = "40001"
+
+var (
+	serializationRetries    = 5
+	serializationRetryDelay = time.Millisecond * 20
+)
+
+// isSerializationFailure checks whether err has been caused by a conflicting
+// concurrent transaction. Drivers expose the SQLSTATE of an error using a
+// SQLState method, which saves depending on a specific driver here.
+func isSerializationFailure(err error) bool {
+	var sqlErr interface{ SQLState() string }
+	return errors.As(err, &sqlErr) && sqlErr.SQLState() == sqlStateSerializationFailure
+}
+
+// retryOnSerializationFailure calls fn until it succeeds, returns an error
+// that is not a serialization failure or the number of retries is exhausted.
+// fn is expected to run a complete transaction, so it can be retried safely.
+func retryOnSerializationFailure(fn func() error) error {
+	delay := serializationRetryDelay
+	var err error
+	for attempt := 0; attempt <= serializationRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = fn(); err == nil || !isSerializationFailure(err) {
+			return err
+		}
+	}
+	return err
+}
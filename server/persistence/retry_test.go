@@ -0,0 +1,66 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type mockSQLError string
+
+func (m mockSQLError) Error() string {
+	return fmt.Sprintf("sql error %s", string(m))
+}
+
+func (m mockSQLError) SQLState() string {
+	return string(m)
+}
+
+func TestRetryOnSerializationFailure(t *testing.T) {
+	defer func(retries int, delay time.Duration) {
+		serializationRetries, serializationRetryDelay = retries, delay
+	}(serializationRetries, serializationRetryDelay)
+	serializationRetries = 2
+	serializationRetryDelay = 0
+
+	t.Run("eventual success", func(t *testing.T) {
+		calls := 0
+		err := retryOnSerializationFailure(func() error {
+			calls++
+			if calls < 3 {
+				return fmt.Errorf("wrapped: %w", mockSQLError("40001"))
+			}
+			return nil
+		})
+		if err != nil || calls != 3 {
+			t.Errorf("Unexpected result %v after %d calls", err, calls)
+		}
+	})
+	t.Run("exhausted", func(t *testing.T) {
+		calls := 0
+		err := retryOnSerializationFailure(func() error {
+			calls++
+			return mockSQLError("40001")
+		})
+		if !isSerializationFailure(err) || calls != 3 {
+			t.Errorf("Unexpected result %v after %d calls", err, calls)
+		}
+	})
+	t.Run("other error", func(t *testing.T) {
+		calls := 0
+		err := retryOnSerializationFailure(func() error {
+			calls++
+			if calls == 1 {
+				return mockSQLError("23505")
+			}
+			return errors.New("did not work")
+		})
+		if err == nil || calls != 1 {
+			t.Errorf("Unexpected result %v after %d calls", err, calls)
+		}
+	})
+}
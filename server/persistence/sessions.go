@@ -0,0 +1,236 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+)
+
+// SessionStore persists the login sessions of account users. Implementations
+// are expected to return ErrUnknownSession when a session cannot be found.
+type SessionStore interface {
+	Create(*Session) error
+	Find(sessionID string) (Session, error)
+	FindByAccountUser(accountUserID string) ([]Session, error)
+	Delete(accountUserID, sessionID string) error
+	DeleteByAccountUser(accountUserID string) error
+}
+
+// WithSessionStore configures the persistence layer to store sessions using
+// the given store. By default, sessions are stored in the database.
+func WithSessionStore(s SessionStore) Config {
+	return func(p *persistenceLayer) {
+		p.sessions = s
+	}
+}
+
+// NewDatabaseSessionStore creates a SessionStore that persists sessions using
+// the given data access layer.
+func NewDatabaseSessionStore(dal DataAccessLayer) SessionStore {
+	return &databaseSessionStore{dal: dal}
+}
+
+type databaseSessionStore struct {
+	dal DataAccessLayer
+}
+
+func (d *databaseSessionStore) Create(s *Session) error {
+	// expired sessions are of no use anymore, so they are cleaned up whenever
+	// a new session is created
+	if _, err := d.dal.DeleteSessions(DeleteSessionsQueryExpiredBefore(time.Now())); err != nil {
+		return fmt.Errorf("persistence: error deleting expired sessions: %w", err)
+	}
+	if err := d.dal.CreateSession(s); err != nil {
+		return fmt.Errorf("persistence: error creating session: %w", err)
+	}
+	return nil
+}
+
+func (d *databaseSessionStore) Find(sessionID string) (Session, error) {
+	sessions, err := d.dal.FindSessions(FindSessionsQueryByID(sessionID))
+	if err != nil {
+		return Session{}, fmt.Errorf("persistence: error looking up session: %w", err)
+	}
+	if len(sessions) == 0 {
+		return Session{}, ErrUnknownSession(fmt.Sprintf("persistence: session %s not found", sessionID))
+	}
+	return sessions[0], nil
+}
+
+func (d *databaseSessionStore) FindByAccountUser(accountUserID string) ([]Session, error) {
+	sessions, err := d.dal.FindSessions(FindSessionsQueryByAccountUserID(accountUserID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (d *databaseSessionStore) Delete(accountUserID, sessionID string) error {
+	affected, err := d.dal.DeleteSessions(DeleteSessionsQueryByID{AccountUserID: accountUserID, SessionID: sessionID})
+	if err != nil {
+		return fmt.Errorf("persistence: error deleting session: %w", err)
+	}
+	if affected == 0 {
+		return ErrUnknownSession(fmt.Sprintf("persistence: session %s not found for account user %s", sessionID, accountUserID))
+	}
+	return nil
+}
+
+func (d *databaseSessionStore) DeleteByAccountUser(accountUserID string) error {
+	if _, err := d.dal.DeleteSessions(DeleteSessionsQueryByAccountUserID(accountUserID)); err != nil {
+		return fmt.Errorf("persistence: error deleting sessions: %w", err)
+	}
+	return nil
+}
+
+// NewMemorySessionStore creates a SessionStore that keeps sessions in memory.
+// Sessions will be lost on restart and are not shared between multiple
+// instances, so this is only suitable for single instance deployments.
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{sessions: map[string]Session{}}
+}
+
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func (m *memorySessionStore) Create(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for id, session := range m.sessions {
+		if session.Expires.Before(now) {
+			delete(m.sessions, id)
+		}
+	}
+	m.sessions[s.SessionID] = *s
+	return nil
+}
+
+func (m *memorySessionStore) Find(sessionID string) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return Session{}, ErrUnknownSession(fmt.Sprintf("persistence: session %s not found", sessionID))
+	}
+	return session, nil
+}
+
+func (m *memorySessionStore) FindByAccountUser(accountUserID string) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var result []Session
+	for _, session := range m.sessions {
+		if session.AccountUserID == accountUserID && session.Expires.After(now) {
+			result = append(result, session)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created.After(result[j].Created)
+	})
+	return result, nil
+}
+
+func (m *memorySessionStore) Delete(accountUserID, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if session, ok := m.sessions[sessionID]; !ok || session.AccountUserID != accountUserID {
+		return ErrUnknownSession(fmt.Sprintf("persistence: session %s not found for account user %s", sessionID, accountUserID))
+	}
+	delete(m.sessions, sessionID)
+	return nil
+}
+
+func (m *memorySessionStore) DeleteByAccountUser(accountUserID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, session := range m.sessions {
+		if session.AccountUserID == accountUserID {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (p *persistenceLayer) CreateSession(accountUserID string, lifetime time.Duration) (SessionResult, error) {
+	sessionID, err := keys.GenerateRandomValueWith(24, base64.RawURLEncoding)
+	if err != nil {
+		return SessionResult{}, fmt.Errorf("persistence: error creating session id: %w", err)
+	}
+	now := time.Now()
+	session := &Session{
+		SessionID:     sessionID,
+		AccountUserID: accountUserID,
+		Created:       now,
+		Expires:       now.Add(lifetime),
+	}
+	if err := p.sessions.Create(session); err != nil {
+		return SessionResult{}, fmt.Errorf("persistence: error storing session: %w", err)
+	}
+	return session.export(), nil
+}
+
+func (p *persistenceLayer) LookupSession(sessionID string) (SessionResult, error) {
+	session, err := p.sessions.Find(sessionID)
+	if err != nil {
+		var unknown ErrUnknownSession
+		if errors.As(err, &unknown) {
+			return SessionResult{}, err
+		}
+		return SessionResult{}, fmt.Errorf("persistence: error looking up session: %w", err)
+	}
+	if time.Now().After(session.Expires) {
+		return SessionResult{}, ErrUnknownSession(fmt.Sprintf("persistence: session %s has expired", sessionID))
+	}
+	return session.export(), nil
+}
+
+func (p *persistenceLayer) ListSessions(accountUserID string) ([]SessionResult, error) {
+	sessions, err := p.sessions.FindByAccountUser(accountUserID)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error listing sessions: %w", err)
+	}
+	result := []SessionResult{}
+	for _, session := range sessions {
+		result = append(result, session.export())
+	}
+	return result, nil
+}
+
+func (p *persistenceLayer) RevokeSession(accountUserID, sessionID string) error {
+	if err := p.sessions.Delete(accountUserID, sessionID); err != nil {
+		var unknown ErrUnknownSession
+		if errors.As(err, &unknown) {
+			return err
+		}
+		return fmt.Errorf("persistence: error revoking session: %w", err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) RevokeSessions(accountUserID string) error {
+	if err := p.sessions.DeleteByAccountUser(accountUserID); err != nil {
+		return fmt.Errorf("persistence: error revoking sessions: %w", err)
+	}
+	return nil
+}
+
+func (s *Session) export() SessionResult {
+	return SessionResult{
+		SessionID:     s.SessionID,
+		AccountUserID: s.AccountUserID,
+		Created:       s.Created,
+		Expires:       s.Expires,
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockSessionDatabase struct {
+	DataAccessLayer
+	sessions      []Session
+	findErr       error
+	created       []*Session
+	deleteResult  int64
+	deleteQueries []interface{}
+}
+
+func (m *mockSessionDatabase) CreateSession(s *Session) error {
+	m.created = append(m.created, s)
+	return nil
+}
+
+func (m *mockSessionDatabase) FindSessions(q interface{}) ([]Session, error) {
+	return m.sessions, m.findErr
+}
+
+func (m *mockSessionDatabase) DeleteSessions(q interface{}) (int64, error) {
+	m.deleteQueries = append(m.deleteQueries, q)
+	return m.deleteResult, nil
+}
+
+func TestDatabaseSessionStore(t *testing.T) {
+	t.Run("create", func(t *testing.T) {
+		db := &mockSessionDatabase{}
+		s := NewDatabaseSessionStore(db)
+		if err := s.Create(&Session{SessionID: "session-a"}); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.created) != 1 {
+			t.Errorf("Unexpected sessions created %v", db.created)
+		}
+		if len(db.deleteQueries) != 1 {
+			t.Fatalf("Expected expired sessions to be deleted, got %v", db.deleteQueries)
+		}
+		if _, ok := db.deleteQueries[0].(DeleteSessionsQueryExpiredBefore); !ok {
+			t.Errorf("Unexpected delete query %v", db.deleteQueries[0])
+		}
+	})
+	t.Run("find unknown", func(t *testing.T) {
+		s := NewDatabaseSessionStore(&mockSessionDatabase{})
+		var unknown ErrUnknownSession
+		if _, err := s.Find("session-a"); !errors.As(err, &unknown) {
+			t.Errorf("Expected unknown session error, got %v", err)
+		}
+	})
+	t.Run("find error", func(t *testing.T) {
+		s := NewDatabaseSessionStore(&mockSessionDatabase{findErr: errors.New("did not work")})
+		var unknown ErrUnknownSession
+		if _, err := s.Find("session-a"); err == nil || errors.As(err, &unknown) {
+			t.Errorf("Expected database error, got %v", err)
+		}
+	})
+	t.Run("delete unknown", func(t *testing.T) {
+		s := NewDatabaseSessionStore(&mockSessionDatabase{})
+		var unknown ErrUnknownSession
+		if err := s.Delete("user-a", "session-a"); !errors.As(err, &unknown) {
+			t.Errorf("Expected unknown session error, got %v", err)
+		}
+	})
+	t.Run("delete", func(t *testing.T) {
+		db := &mockSessionDatabase{deleteResult: 1}
+		s := NewDatabaseSessionStore(db)
+		if err := s.Delete("user-a", "session-a"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if q, ok := db.deleteQueries[0].(DeleteSessionsQueryByID); !ok || q.AccountUserID != "user-a" || q.SessionID != "session-a" {
+			t.Errorf("Unexpected delete query %v", db.deleteQueries[0])
+		}
+	})
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	s := NewMemorySessionStore()
+	now := time.Now()
+	for _, session := range []*Session{
+		{SessionID: "session-a", AccountUserID: "user-a", Created: now.Add(-time.Minute), Expires: now.Add(time.Hour)},
+		{SessionID: "session-b", AccountUserID: "user-a", Created: now, Expires: now.Add(time.Hour)},
+		{SessionID: "session-c", AccountUserID: "user-a", Created: now.Add(-time.Hour * 2), Expires: now.Add(-time.Hour)},
+		{SessionID: "session-d", AccountUserID: "user-b", Created: now, Expires: now.Add(time.Hour)},
+	} {
+		if err := s.Create(session); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+
+	if session, err := s.Find("session-a"); err != nil || session.AccountUserID != "user-a" {
+		t.Errorf("Unexpected result %v, %v", session, err)
+	}
+	var unknown ErrUnknownSession
+	if _, err := s.Find("session-z"); !errors.As(err, &unknown) {
+		t.Errorf("Expected unknown session error, got %v", err)
+	}
+
+	sessions, err := s.FindByAccountUser("user-a")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].SessionID != "session-b" || sessions[1].SessionID != "session-a" {
+		t.Errorf("Unexpected result %v", sessions)
+	}
+
+	if err := s.Delete("user-b", "session-a"); !errors.As(err, &unknown) {
+		t.Errorf("Expected session of other user to be left untouched, got %v", err)
+	}
+	if err := s.Delete("user-a", "session-a"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := s.Find("session-a"); !errors.As(err, &unknown) {
+		t.Errorf("Expected revoked session to be unknown, got %v", err)
+	}
+
+	if err := s.DeleteByAccountUser("user-a"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if sessions, _ := s.FindByAccountUser("user-a"); len(sessions) != 0 {
+		t.Errorf("Expected all sessions to be revoked, got %v", sessions)
+	}
+	if _, err := s.Find("session-d"); err != nil {
+		t.Errorf("Expected session of other user to be left untouched, got %v", err)
+	}
+}
+
+func TestPersistenceLayer_Sessions(t *testing.T) {
+	p := &persistenceLayer{sessions: NewMemorySessionStore()}
+
+	result, err := p.CreateSession("user-a", time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if result.SessionID == "" || result.AccountUserID != "user-a" {
+		t.Errorf("Unexpected result %v", result)
+	}
+
+	lookup, err := p.LookupSession(result.SessionID)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if lookup.AccountUserID != "user-a" {
+		t.Errorf("Unexpected lookup result %v", lookup)
+	}
+
+	expired, _ := p.CreateSession("user-a", -time.Hour)
+	var unknown ErrUnknownSession
+	if _, err := p.LookupSession(expired.SessionID); !errors.As(err, &unknown) {
+		t.Errorf("Expected expired session to be unknown, got %v", err)
+	}
+
+	sessions, err := p.ListSessions("user-a")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionID != result.SessionID {
+		t.Errorf("Unexpected sessions %v", sessions)
+	}
+
+	if err := p.RevokeSession("user-b", result.SessionID); !errors.As(err, &unknown) {
+		t.Errorf("Expected unknown session error, got %v", err)
+	}
+	if err := p.RevokeSession("user-a", result.SessionID); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := p.LookupSession(result.SessionID); !errors.As(err, &unknown) {
+		t.Errorf("Expected revoked session to be unknown, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (p *persistenceLayer) CreateShareLink(accountID, accountUserID string, expires time.Time) (ShareLinkResult, error) {
+	linkID, err := NewULID()
+	if err != nil {
+		return ShareLinkResult{}, fmt.Errorf("persistence: error creating share link id: %w", err)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return ShareLinkResult{}, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+
+	// expired links are of no use anymore, so they are cleaned up whenever
+	// a new link is created
+	if _, err := txn.DeleteShareLinks(DeleteShareLinksQueryExpiredBefore(time.Now())); err != nil {
+		txn.Rollback()
+		return ShareLinkResult{}, fmt.Errorf("persistence: error deleting expired share links: %w", err)
+	}
+
+	link := &ShareLink{
+		LinkID:        linkID,
+		AccountID:     accountID,
+		AccountUserID: accountUserID,
+		Expires:       expires,
+	}
+	if err := txn.CreateShareLink(link); err != nil {
+		txn.Rollback()
+		return ShareLinkResult{}, fmt.Errorf("persistence: error creating share link: %w", err)
+	}
+
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionCreateShare, linkID); err != nil {
+		txn.Rollback()
+		return ShareLinkResult{}, fmt.Errorf("persistence: error recording share link creation: %w", err)
+	}
+
+	if err := txn.Commit(); err != nil {
+		return ShareLinkResult{}, fmt.Errorf("persistence: error committing share link: %w", err)
+	}
+	return link.export(), nil
+}
+
+func (p *persistenceLayer) LookupShareLink(linkID string) (ShareLinkResult, error) {
+	link, err := p.dal.FindShareLink(FindShareLinkQueryByID(linkID))
+	if err != nil {
+		var unknown ErrUnknownShareLink
+		if errors.As(err, &unknown) {
+			return ShareLinkResult{}, err
+		}
+		return ShareLinkResult{}, fmt.Errorf("persistence: error looking up share link: %w", err)
+	}
+	if time.Now().After(link.Expires) {
+		return ShareLinkResult{}, ErrUnknownShareLink(fmt.Sprintf("persistence: share link %s has expired", linkID))
+	}
+	return link.export(), nil
+}
+
+func (p *persistenceLayer) RevokeShareLink(accountID, linkID, accountUserID string) error {
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+
+	affected, err := txn.DeleteShareLinks(DeleteShareLinksQueryByID{AccountID: accountID, LinkID: linkID})
+	if err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error revoking share link: %w", err)
+	}
+	if affected == 0 {
+		txn.Rollback()
+		return ErrUnknownShareLink(fmt.Sprintf("persistence: share link %s not found for account %s", linkID, accountID))
+	}
+
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionRevokeShare, linkID); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording share link revocation: %w", err)
+	}
+
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing share link revocation: %w", err)
+	}
+	return nil
+}
+
+func (s *ShareLink) export() ShareLinkResult {
+	return ShareLinkResult{
+		LinkID:    s.LinkID,
+		AccountID: s.AccountID,
+		Expires:   s.Expires,
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockShareLinkDatabase struct {
+	DataAccessLayer
+	findResult    ShareLink
+	findErr       error
+	created       []*ShareLink
+	createErr     error
+	deleteResult  int64
+	deleteErr     error
+	auditLog      []*AuditLogEntry
+	deleteQueries []interface{}
+}
+
+func (m *mockShareLinkDatabase) CreateShareLink(s *ShareLink) error {
+	m.created = append(m.created, s)
+	return m.createErr
+}
+
+func (m *mockShareLinkDatabase) FindShareLink(q interface{}) (ShareLink, error) {
+	return m.findResult, m.findErr
+}
+
+func (m *mockShareLinkDatabase) DeleteShareLinks(q interface{}) (int64, error) {
+	m.deleteQueries = append(m.deleteQueries, q)
+	if _, ok := q.(DeleteShareLinksQueryExpiredBefore); ok {
+		return 0, nil
+	}
+	return m.deleteResult, m.deleteErr
+}
+
+func (m *mockShareLinkDatabase) CreateAuditLogEntry(e *AuditLogEntry) error {
+	m.auditLog = append(m.auditLog, e)
+	return nil
+}
+
+func (m *mockShareLinkDatabase) Commit() error {
+	return nil
+}
+
+func (m *mockShareLinkDatabase) Rollback() error {
+	return nil
+}
+
+func (m *mockShareLinkDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func TestPersistenceLayer_CreateShareLink(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		db := &mockShareLinkDatabase{createErr: errors.New("did not work")}
+		p := &persistenceLayer{dal: db}
+		if _, err := p.CreateShareLink("account-a", "user-a", time.Now().Add(time.Hour)); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if len(db.auditLog) != 0 {
+			t.Errorf("Unexpected audit log entries %v", db.auditLog)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockShareLinkDatabase{}
+		p := &persistenceLayer{dal: db}
+		expires := time.Now().Add(time.Hour)
+		result, err := p.CreateShareLink("account-a", "user-a", expires)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if result.LinkID == "" || result.AccountID != "account-a" || !result.Expires.Equal(expires) {
+			t.Errorf("Unexpected result %v", result)
+		}
+		if len(db.deleteQueries) != 1 {
+			t.Errorf("Expected expired links to be cleaned up, got %v", db.deleteQueries)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionCreateShare {
+			t.Errorf("Unexpected audit log entries %v", db.auditLog)
+		}
+	})
+}
+
+func TestPersistenceLayer_LookupShareLink(t *testing.T) {
+	t.Run("unknown", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockShareLinkDatabase{findErr: ErrUnknownShareLink("did not work")}}
+		_, err := p.LookupShareLink("link-a")
+		var unknown ErrUnknownShareLink
+		if !errors.As(err, &unknown) {
+			t.Errorf("Expected unknown share link error, got %v", err)
+		}
+	})
+	t.Run("expired", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockShareLinkDatabase{
+			findResult: ShareLink{LinkID: "link-a", AccountID: "account-a", Expires: time.Now().Add(-time.Minute)},
+		}}
+		_, err := p.LookupShareLink("link-a")
+		var unknown ErrUnknownShareLink
+		if !errors.As(err, &unknown) {
+			t.Errorf("Expected unknown share link error, got %v", err)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockShareLinkDatabase{
+			findResult: ShareLink{LinkID: "link-a", AccountID: "account-a", Expires: time.Now().Add(time.Minute)},
+		}}
+		result, err := p.LookupShareLink("link-a")
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if result.AccountID != "account-a" {
+			t.Errorf("Unexpected result %v", result)
+		}
+	})
+}
+
+func TestPersistenceLayer_RevokeShareLink(t *testing.T) {
+	t.Run("unknown", func(t *testing.T) {
+		db := &mockShareLinkDatabase{}
+		p := &persistenceLayer{dal: db}
+		err := p.RevokeShareLink("account-a", "link-a", "user-a")
+		var unknown ErrUnknownShareLink
+		if !errors.As(err, &unknown) {
+			t.Errorf("Expected unknown share link error, got %v", err)
+		}
+		if len(db.auditLog) != 0 {
+			t.Errorf("Unexpected audit log entries %v", db.auditLog)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockShareLinkDatabase{deleteResult: 1}
+		p := &persistenceLayer{dal: db}
+		if err := p.RevokeShareLink("account-a", "link-a", "user-a"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionRevokeShare {
+			t.Errorf("Unexpected audit log entries %v", db.auditLog)
+		}
+	})
+}
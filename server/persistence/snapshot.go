@@ -0,0 +1,59 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"fmt"
+)
+
+func (p *persistenceLayer) Dump() (*Snapshot, error) {
+	snapshot, err := p.dal.DumpAll()
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error dumping database: %w", err)
+	}
+	return snapshot, nil
+}
+
+// Restore writes the given snapshot into the database. Unless force is given,
+// restoring into a database that already contains data is refused, otherwise
+// all existing data is dropped before restoring.
+func (p *persistenceLayer) Restore(snapshot *Snapshot, force bool) error {
+	if err := p.prepareRestore(force); err != nil {
+		return err
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	if err := txn.RestoreAll(snapshot); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error restoring snapshot: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing restored snapshot: %w", err)
+	}
+	return nil
+}
+
+// prepareRestore ensures the database schema is up to date and that the
+// database does not contain any data before restoring.
+func (p *persistenceLayer) prepareRestore(force bool) error {
+	if err := p.dal.ApplyMigrations(); err != nil {
+		return fmt.Errorf("persistence: error applying migrations before restore: %w", err)
+	}
+	if !p.dal.ProbeEmpty() {
+		if !force {
+			return errors.New("persistence: refusing to restore snapshot into a database that is not empty")
+		}
+		if err := p.dal.DropAll(); err != nil {
+			return fmt.Errorf("persistence: error dropping existing data before restore: %w", err)
+		}
+		if err := p.dal.ApplyMigrations(); err != nil {
+			return fmt.Errorf("persistence: error applying migrations before restore: %w", err)
+		}
+	}
+	return nil
+}
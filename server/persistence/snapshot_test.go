@@ -0,0 +1,91 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+)
+
+type mockSnapshotDatabase struct {
+	DataAccessLayer
+	empty      bool
+	dropped    bool
+	restored   *Snapshot
+	restoreErr error
+}
+
+func (m *mockSnapshotDatabase) ApplyMigrations() error {
+	return nil
+}
+
+func (m *mockSnapshotDatabase) ProbeEmpty() bool {
+	return m.empty
+}
+
+func (m *mockSnapshotDatabase) DropAll() error {
+	m.dropped = true
+	return nil
+}
+
+func (m *mockSnapshotDatabase) RestoreAll(s *Snapshot) error {
+	if m.restoreErr != nil {
+		return m.restoreErr
+	}
+	m.restored = s
+	return nil
+}
+
+func (m *mockSnapshotDatabase) Commit() error {
+	return nil
+}
+
+func (m *mockSnapshotDatabase) Rollback() error {
+	return nil
+}
+
+func (m *mockSnapshotDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func TestPersistenceLayer_Restore(t *testing.T) {
+	snapshot := &Snapshot{Accounts: []Account{{AccountID: "account-a"}}}
+	t.Run("not empty", func(t *testing.T) {
+		db := &mockSnapshotDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.Restore(snapshot, false); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if db.dropped || db.restored != nil {
+			t.Errorf("Unexpected modification of database %v", db)
+		}
+	})
+	t.Run("force", func(t *testing.T) {
+		db := &mockSnapshotDatabase{}
+		p := &persistenceLayer{dal: db}
+		if err := p.Restore(snapshot, true); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if !db.dropped || db.restored != snapshot {
+			t.Errorf("Unexpected state of database %v", db)
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		db := &mockSnapshotDatabase{empty: true}
+		p := &persistenceLayer{dal: db}
+		if err := p.Restore(snapshot, false); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if db.dropped || db.restored != snapshot {
+			t.Errorf("Unexpected state of database %v", db)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		db := &mockSnapshotDatabase{empty: true, restoreErr: errors.New("did not work")}
+		p := &persistenceLayer{dal: db}
+		if err := p.Restore(snapshot, false); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
@@ -0,0 +1,338 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// streamVersion is the version of the line delimited format written by
+// DumpStream. It is increased when the format changes in a way that older
+// versions cannot read anymore.
+const streamVersion = 1
+
+// streamBatchSize is the number of events that are read from and written to
+// the database at once when streaming.
+const streamBatchSize = 1000
+
+// Each line of a stream is a StreamRecord with one of the following types.
+const (
+	StreamRecordHeader                  = "header"
+	StreamRecordAccount                 = "account"
+	StreamRecordAccountUser             = "account_user"
+	StreamRecordAccountUserRelationship = "account_user_relationship"
+	StreamRecordSecret                  = "secret"
+	StreamRecordTombstone               = "tombstone"
+	StreamRecordAuditLogEntry           = "audit_log_entry"
+	StreamRecordShareLink               = "share_link"
+	StreamRecordInvitation              = "invitation"
+	StreamRecordAPIToken                = "api_token"
+	StreamRecordWebAuthnCredential      = "webauthn_credential"
+	StreamRecordWebhook                 = "webhook"
+	StreamRecordAccountDomain           = "account_domain"
+	StreamRecordPingCounter             = "ping_counter"
+	StreamRecordAggregateCounter        = "aggregate_counter"
+	StreamRecordEvent                   = "event"
+)
+
+// StreamRecord is a single line in a stream of line delimited JSON.
+type StreamRecord struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type streamHeader struct {
+	Version int `json:"version"`
+}
+
+type streamWriter struct {
+	enc   *json.Encoder
+	count int
+}
+
+func (s *streamWriter) write(recordType string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("persistence: error encoding %s record: %w", recordType, err)
+	}
+	if err := s.enc.Encode(StreamRecord{Type: recordType, Data: b}); err != nil {
+		return fmt.Errorf("persistence: error writing %s record: %w", recordType, err)
+	}
+	s.count++
+	return nil
+}
+
+// DumpStream writes all data as line delimited JSON to the given writer.
+// Events are read from the database in batches, so the size of the dataset
+// is not limited by the available memory. It returns the number of records
+// that have been written.
+func (p *persistenceLayer) DumpStream(w io.Writer) (int, error) {
+	snapshot, err := p.dal.DumpAllWithoutEvents()
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error dumping database: %w", err)
+	}
+
+	buf := bufio.NewWriter(w)
+	s := &streamWriter{enc: json.NewEncoder(buf)}
+	if err := s.write(StreamRecordHeader, streamHeader{Version: streamVersion}); err != nil {
+		return s.count, err
+	}
+
+	for _, r := range snapshot.Accounts {
+		if err := s.write(StreamRecordAccount, r); err != nil {
+			return s.count, err
+		}
+	}
+	for _, r := range snapshot.AccountUsers {
+		if err := s.write(StreamRecordAccountUser, r); err != nil {
+			return s.count, err
+		}
+	}
+	for _, r := range snapshot.AccountUserRelationships {
+		if err := s.write(StreamRecordAccountUserRelationship, r); err != nil {
+			return s.count, err
+		}
+	}
+	for _, r := range snapshot.Secrets {
+		if err := s.write(StreamRecordSecret, r); err != nil {
+			return s.count, err
+		}
+	}
+	for _, r := range snapshot.Tombstones {
+		if err := s.write(StreamRecordTombstone, r); err != nil {
+			return s.count, err
+		}
+	}
+	for _, r := range snapshot.AuditLogEntries {
+		if err := s.write(StreamRecordAuditLogEntry, r); err != nil {
+			return s.count, err
+		}
+	}
+	for _, r := range snapshot.ShareLinks {
+		if err := s.write(StreamRecordShareLink, r); err != nil {
+			return s.count, err
+		}
+	}
+	for _, r := range snapshot.Invitations {
+		if err := s.write(StreamRecordInvitation, r); err != nil {
+			return s.count, err
+		}
+	}
+	for _, r := range snapshot.APITokens {
+		if err := s.write(StreamRecordAPIToken, r); err != nil {
+			return s.count, err
+		}
+	}
+	for _, r := range snapshot.WebAuthnCredentials {
+		if err := s.write(StreamRecordWebAuthnCredential, r); err != nil {
+			return s.count, err
+		}
+	}
+	for _, r := range snapshot.Webhooks {
+		if err := s.write(StreamRecordWebhook, r); err != nil {
+			return s.count, err
+		}
+	}
+	for _, r := range snapshot.AccountDomains {
+		if err := s.write(StreamRecordAccountDomain, r); err != nil {
+			return s.count, err
+		}
+	}
+	for _, r := range snapshot.PingCounters {
+		if err := s.write(StreamRecordPingCounter, r); err != nil {
+			return s.count, err
+		}
+	}
+	for _, r := range snapshot.AggregateCounters {
+		if err := s.write(StreamRecordAggregateCounter, r); err != nil {
+			return s.count, err
+		}
+	}
+
+	for _, account := range snapshot.Accounts {
+		var cursor string
+		for {
+			events, err := p.dal.FindEvents(FindEventsQueryByAccountID{
+				AccountID: account.AccountID,
+				After:     cursor,
+				Limit:     streamBatchSize,
+			})
+			if err != nil {
+				return s.count, fmt.Errorf("persistence: error looking up events for account %s: %w", account.AccountID, err)
+			}
+			for _, evt := range events {
+				if err := s.write(StreamRecordEvent, evt); err != nil {
+					return s.count, err
+				}
+			}
+			if len(events) < streamBatchSize {
+				break
+			}
+			cursor = events[len(events)-1].EventID
+		}
+	}
+
+	if err := buf.Flush(); err != nil {
+		return s.count, fmt.Errorf("persistence: error flushing stream: %w", err)
+	}
+	return s.count, nil
+}
+
+// RestoreStream reads line delimited JSON as written by DumpStream and
+// writes it into the database. Unless force is given, restoring into a
+// database that already contains data is refused, otherwise all existing
+// data is dropped before restoring. It returns the number of records that
+// have been read.
+func (p *persistenceLayer) RestoreStream(r io.Reader, force bool) (int, error) {
+	if err := p.prepareRestore(force); err != nil {
+		return 0, err
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	count, err := restoreStream(txn, r)
+	if err != nil {
+		txn.Rollback()
+		return count, err
+	}
+	if err := txn.Commit(); err != nil {
+		return count, fmt.Errorf("persistence: error committing restored stream: %w", err)
+	}
+	return count, nil
+}
+
+func restoreStream(txn Transaction, r io.Reader) (int, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var (
+		count           int
+		snapshot        = &Snapshot{}
+		events          []Event
+		restoredRecords bool
+	)
+
+	// records other than events are kept in memory until the first event
+	// is read, so they are restored in the order required by foreign keys
+	flush := func() error {
+		if !restoredRecords {
+			restoredRecords = true
+			if err := txn.RestoreAll(snapshot); err != nil {
+				return fmt.Errorf("persistence: error restoring records: %w", err)
+			}
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		if err := txn.RestoreAll(&Snapshot{Events: events}); err != nil {
+			return fmt.Errorf("persistence: error restoring events: %w", err)
+		}
+		events = nil
+		return nil
+	}
+
+	for {
+		var record StreamRecord
+		if err := dec.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return count, fmt.Errorf("persistence: error reading record %d: %w", count+1, err)
+		}
+		count++
+
+		if count == 1 {
+			if record.Type != StreamRecordHeader {
+				return count, errors.New("persistence: stream does not start with a header")
+			}
+			var header streamHeader
+			if err := json.Unmarshal(record.Data, &header); err != nil {
+				return count, fmt.Errorf("persistence: error decoding header: %w", err)
+			}
+			if header.Version != streamVersion {
+				return count, fmt.Errorf("persistence: unsupported stream version %d", header.Version)
+			}
+			continue
+		}
+
+		if restoredRecords && record.Type != StreamRecordEvent {
+			return count, fmt.Errorf("persistence: unexpected %s record after events in record %d", record.Type, count)
+		}
+
+		var target interface{}
+		switch record.Type {
+		case StreamRecordAccount:
+			snapshot.Accounts = append(snapshot.Accounts, Account{})
+			target = &snapshot.Accounts[len(snapshot.Accounts)-1]
+		case StreamRecordAccountUser:
+			snapshot.AccountUsers = append(snapshot.AccountUsers, AccountUser{})
+			target = &snapshot.AccountUsers[len(snapshot.AccountUsers)-1]
+		case StreamRecordAccountUserRelationship:
+			snapshot.AccountUserRelationships = append(snapshot.AccountUserRelationships, AccountUserRelationship{})
+			target = &snapshot.AccountUserRelationships[len(snapshot.AccountUserRelationships)-1]
+		case StreamRecordSecret:
+			snapshot.Secrets = append(snapshot.Secrets, Secret{})
+			target = &snapshot.Secrets[len(snapshot.Secrets)-1]
+		case StreamRecordTombstone:
+			snapshot.Tombstones = append(snapshot.Tombstones, Tombstone{})
+			target = &snapshot.Tombstones[len(snapshot.Tombstones)-1]
+		case StreamRecordAuditLogEntry:
+			snapshot.AuditLogEntries = append(snapshot.AuditLogEntries, AuditLogEntry{})
+			target = &snapshot.AuditLogEntries[len(snapshot.AuditLogEntries)-1]
+		case StreamRecordShareLink:
+			snapshot.ShareLinks = append(snapshot.ShareLinks, ShareLink{})
+			target = &snapshot.ShareLinks[len(snapshot.ShareLinks)-1]
+		case StreamRecordInvitation:
+			snapshot.Invitations = append(snapshot.Invitations, Invitation{})
+			target = &snapshot.Invitations[len(snapshot.Invitations)-1]
+		case StreamRecordAPIToken:
+			snapshot.APITokens = append(snapshot.APITokens, APIToken{})
+			target = &snapshot.APITokens[len(snapshot.APITokens)-1]
+		case StreamRecordWebAuthnCredential:
+			snapshot.WebAuthnCredentials = append(snapshot.WebAuthnCredentials, WebAuthnCredential{})
+			target = &snapshot.WebAuthnCredentials[len(snapshot.WebAuthnCredentials)-1]
+		case StreamRecordWebhook:
+			snapshot.Webhooks = append(snapshot.Webhooks, Webhook{})
+			target = &snapshot.Webhooks[len(snapshot.Webhooks)-1]
+		case StreamRecordAccountDomain:
+			snapshot.AccountDomains = append(snapshot.AccountDomains, AccountDomain{})
+			target = &snapshot.AccountDomains[len(snapshot.AccountDomains)-1]
+		case StreamRecordPingCounter:
+			snapshot.PingCounters = append(snapshot.PingCounters, PingCounter{})
+			target = &snapshot.PingCounters[len(snapshot.PingCounters)-1]
+		case StreamRecordAggregateCounter:
+			snapshot.AggregateCounters = append(snapshot.AggregateCounters, AggregateCounter{})
+			target = &snapshot.AggregateCounters[len(snapshot.AggregateCounters)-1]
+		case StreamRecordEvent:
+			if !restoredRecords {
+				if err := flush(); err != nil {
+					return count, err
+				}
+			}
+			events = append(events, Event{})
+			target = &events[len(events)-1]
+		default:
+			return count, fmt.Errorf("persistence: unknown record type %q in record %d", record.Type, count)
+		}
+		if err := json.Unmarshal(record.Data, target); err != nil {
+			return count, fmt.Errorf("persistence: error decoding %s record %d: %w", record.Type, count, err)
+		}
+		if len(events) >= streamBatchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if count == 0 {
+		return count, errors.New("persistence: stream is empty")
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+	return count, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type mockStreamDatabase struct {
+	mockSnapshotDatabase
+	snapshot *Snapshot
+	events   []Event
+	restores []*Snapshot
+}
+
+func (m *mockStreamDatabase) DumpAllWithoutEvents() (*Snapshot, error) {
+	return m.snapshot, nil
+}
+
+func (m *mockStreamDatabase) FindEvents(q interface{}) ([]Event, error) {
+	query := q.(FindEventsQueryByAccountID)
+	var result []Event
+	for _, evt := range m.events {
+		if evt.AccountID == query.AccountID && evt.EventID > query.After && len(result) < query.Limit {
+			result = append(result, evt)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockStreamDatabase) RestoreAll(s *Snapshot) error {
+	m.restores = append(m.restores, s)
+	return nil
+}
+
+func (m *mockStreamDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func TestPersistenceLayer_Stream(t *testing.T) {
+	var events []Event
+	for i := 0; i < streamBatchSize+1; i++ {
+		events = append(events, Event{AccountID: "account-a", EventID: fmt.Sprintf("event-%05d", i), Payload: "payload"})
+	}
+	events = append(events, Event{AccountID: "account-b", EventID: "event-b"})
+	source := &mockStreamDatabase{
+		snapshot: &Snapshot{
+			Accounts:     []Account{{AccountID: "account-a"}, {AccountID: "account-b"}},
+			AccountUsers: []AccountUser{{AccountUserID: "user-a"}},
+			Secrets:      []Secret{{SecretID: "secret-a"}},
+		},
+		events: events,
+	}
+
+	var buf bytes.Buffer
+	count, err := (&persistenceLayer{dal: source}).DumpStream(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := 1 + 4 + len(events); count != expected {
+		t.Errorf("Expected %d records, got %d", expected, count)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != count {
+		t.Errorf("Expected %d lines, got %d", count, lines)
+	}
+
+	target := &mockStreamDatabase{mockSnapshotDatabase: mockSnapshotDatabase{empty: true}}
+	restored, err := (&persistenceLayer{dal: target}).RestoreStream(&buf, false)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if restored != count {
+		t.Errorf("Expected %d records to be restored, got %d", count, restored)
+	}
+	if len(target.restores) != 3 {
+		t.Fatalf("Unexpected number of restores %d", len(target.restores))
+	}
+	if !reflect.DeepEqual(target.restores[0], source.snapshot) {
+		t.Errorf("Unexpected records %v", target.restores[0])
+	}
+	var restoredEvents []Event
+	for _, s := range target.restores[1:] {
+		restoredEvents = append(restoredEvents, s.Events...)
+	}
+	if !reflect.DeepEqual(restoredEvents, events) {
+		t.Errorf("Unexpected events of length %d", len(restoredEvents))
+	}
+}
+
+func TestPersistenceLayer_RestoreStream(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		empty bool
+	}{
+		{"not empty", `{"type":"header","data":{"version":1}}` + "\n", false},
+		{"empty stream", "", true},
+		{"missing header", `{"type":"account","data":{"AccountID":"account-a"}}` + "\n", true},
+		{"bad version", `{"type":"header","data":{"version":99}}` + "\n", true},
+		{"unknown type", `{"type":"header","data":{"version":1}}` + "\n" + `{"type":"other","data":{}}` + "\n", true},
+		{"bad json", `{"type":"header","data":{"version":1}}` + "\n" + `{"type":` + "\n", true},
+		{
+			"records after events",
+			`{"type":"header","data":{"version":1}}` + "\n" +
+				`{"type":"event","data":{"EventID":"event-a"}}` + "\n" +
+				`{"type":"account","data":{"AccountID":"account-a"}}` + "\n",
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &mockStreamDatabase{mockSnapshotDatabase: mockSnapshotDatabase{empty: test.empty}}
+			if _, err := (&persistenceLayer{dal: db}).RestoreStream(strings.NewReader(test.input), false); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
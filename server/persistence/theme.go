@@ -0,0 +1,184 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+const (
+	// MaxThemeLogoSize limits the size of logo images in bytes.
+	MaxThemeLogoSize = 64 * 1024
+	// maxConsentTextLength limits the length of custom consent texts.
+	maxConsentTextLength = 2048
+)
+
+// ThemeColors lists the colors of the palette an account can customize.
+var ThemeColors = []string{"primary", "secondary", "background", "text"}
+
+// themeLogoTypes lists the content types logos can be uploaded in. SVG is
+// not supported as it can contain scripts.
+var themeLogoTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var themeColorValue = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// consentTextPolicy defines which HTML is allowed in custom consent texts.
+var consentTextPolicy = func() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "b", "strong", "i", "em")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowURLSchemes("https")
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}()
+
+// Theme customizes the appearance of the vault and the auditorium for the
+// users of an account. Empty values use the default appearance.
+type Theme struct {
+	// Logo is a base64 encoded data URI of the logo image.
+	Logo string `json:"logo,omitempty"`
+	// Colors maps the names of palette colors to hex values.
+	Colors map[string]string `json:"colors,omitempty"`
+	// ConsentText replaces the default text of the consent banner. It can
+	// contain paragraphs, emphasis and links.
+	ConsentText string `json:"consentText,omitempty"`
+}
+
+// Empty returns true if the theme does not customize anything.
+func (t Theme) Empty() bool {
+	return t.Logo == "" && len(t.Colors) == 0 && t.ConsentText == ""
+}
+
+// Sanitize returns a copy of the theme with all HTML in the consent text
+// removed that is not allowed.
+func (t Theme) Sanitize() Theme {
+	t.ConsentText = strings.TrimSpace(consentTextPolicy.Sanitize(t.ConsentText))
+	return t
+}
+
+// Validate checks whether the theme only uses known colors, the logo is an
+// image of a supported type and the consent text is not too long.
+func (t Theme) Validate() error {
+	known := map[string]bool{}
+	for _, name := range ThemeColors {
+		known[name] = true
+	}
+	for name, value := range t.Colors {
+		if !known[name] {
+			return fmt.Errorf("persistence: unknown theme color %s", name)
+		}
+		if !themeColorValue.MatchString(value) {
+			return fmt.Errorf("persistence: color %s must be given as a hex value, received %s", name, value)
+		}
+	}
+	if len(t.ConsentText) > maxConsentTextLength {
+		return fmt.Errorf("persistence: consent text must not be longer than %d characters", maxConsentTextLength)
+	}
+	if t.Logo != "" {
+		if err := validateThemeLogo(t.Logo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewThemeLogo returns the data URI for the given image. The content type
+// is detected from the image's content.
+func NewThemeLogo(image []byte) (string, error) {
+	if len(image) > MaxThemeLogoSize {
+		return "", fmt.Errorf("persistence: logo must not be larger than %d bytes", MaxThemeLogoSize)
+	}
+	contentType := http.DetectContentType(image)
+	if !themeLogoTypes[contentType] {
+		return "", fmt.Errorf("persistence: unsupported logo type %s", contentType)
+	}
+	return fmt.Sprintf("data:%s;base64,%s", contentType, base64.StdEncoding.EncodeToString(image)), nil
+}
+
+func validateThemeLogo(uri string) error {
+	contentType, data, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ";base64,")
+	if !ok || !strings.HasPrefix(uri, "data:") {
+		return fmt.Errorf("persistence: logo must be a base64 encoded data uri")
+	}
+	image, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return fmt.Errorf("persistence: error decoding logo: %w", err)
+	}
+	// the declared type has to match the content so the uri can safely be
+	// used as the source of an image
+	normalized, err := NewThemeLogo(image)
+	if err != nil {
+		return err
+	}
+	if normalized != uri {
+		return fmt.Errorf("persistence: logo declares type %s, which does not match its content", contentType)
+	}
+	return nil
+}
+
+func parseTheme(s string) (Theme, error) {
+	var theme Theme
+	if s == "" {
+		return theme, nil
+	}
+	if err := json.Unmarshal([]byte(s), &theme); err != nil {
+		return theme, fmt.Errorf("persistence: error parsing theme: %w", err)
+	}
+	return theme, nil
+}
+
+// UpdateAccountTheme replaces the theme of the given account. The consent
+// text is sanitized before the theme is validated and stored. The stored
+// theme is returned.
+func (p *persistenceLayer) UpdateAccountTheme(accountID string, theme Theme, accountUserID string) (Theme, error) {
+	theme = theme.Sanitize()
+	if err := theme.Validate(); err != nil {
+		return Theme{}, fmt.Errorf("persistence: invalid theme: %w", err)
+	}
+	a, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return Theme{}, fmt.Errorf("persistence: error looking up account before updating theme: %w", err)
+	}
+
+	var encoded string
+	if !theme.Empty() {
+		b, err := json.Marshal(theme)
+		if err != nil {
+			return Theme{}, fmt.Errorf("persistence: error encoding theme: %w", err)
+		}
+		encoded = string(b)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return Theme{}, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	a.Theme = encoded
+	if err := txn.UpdateAccount(&a); err != nil {
+		txn.Rollback()
+		return Theme{}, fmt.Errorf("persistence: error updating theme of account %s: %w", accountID, err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionUpdateTheme, ""); err != nil {
+		txn.Rollback()
+		return Theme{}, fmt.Errorf("persistence: error recording theme update of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return Theme{}, fmt.Errorf("persistence: error committing theme update: %w", err)
+	}
+	return theme, nil
+}
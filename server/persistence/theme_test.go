@@ -0,0 +1,101 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// pngHeader is the signature used for detecting PNG images.
+var pngHeader = []byte("\x89PNG\x0D\x0A\x1A\x0A")
+
+func TestTheme_Validate(t *testing.T) {
+	logo, err := NewThemeLogo(pngHeader)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	tests := []struct {
+		name        string
+		theme       Theme
+		expectError bool
+	}{
+		{"empty", Theme{}, false},
+		{"ok", Theme{Logo: logo, Colors: map[string]string{"primary": "#ff0", "text": "#123456"}, ConsentText: "<b>Hi</b>"}, false},
+		{"unknown color", Theme{Colors: map[string]string{"border": "#fff"}}, true},
+		{"bad color", Theme{Colors: map[string]string{"primary": "red;}body{display:none"}}, true},
+		{"long consent text", Theme{ConsentText: strings.Repeat("a", maxConsentTextLength+1)}, true},
+		{"bad logo", Theme{Logo: "https://www.offen.dev/logo.png"}, true},
+		{"mismatching logo type", Theme{Logo: "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString(pngHeader)}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.theme.Validate(); (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+		})
+	}
+}
+
+func TestNewThemeLogo(t *testing.T) {
+	if logo, err := NewThemeLogo(pngHeader); err != nil || !strings.HasPrefix(logo, "data:image/png;base64,") {
+		t.Errorf("Unexpected result %v, %v", logo, err)
+	}
+	if _, err := NewThemeLogo([]byte(`<svg onload="alert(1)"></svg>`)); err == nil {
+		t.Error("Expected error for svg logo")
+	}
+	if _, err := NewThemeLogo(append(pngHeader, make([]byte, MaxThemeLogoSize)...)); err == nil {
+		t.Error("Expected error for large logo")
+	}
+}
+
+func TestTheme_Sanitize(t *testing.T) {
+	theme := Theme{ConsentText: `<p onclick="x()">We <em>care</em>. <a href="javascript:alert(1)">Bad</a> <a href="https://www.offen.dev">Good</a><script>alert(1)</script></p>`}
+	result := theme.Sanitize().ConsentText
+	expected := `<p>We <em>care</em>. Bad <a href="https://www.offen.dev" rel="nofollow noopener" target="_blank">Good</a></p>`
+	if result != expected {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestPersistenceLayer_UpdateAccountTheme(t *testing.T) {
+	t.Run("invalid theme", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if _, err := p.UpdateAccountTheme("account-a", Theme{Colors: map[string]string{"primary": "red"}}, "user-a"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if len(db.updated) != 0 {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		theme, err := p.UpdateAccountTheme("account-a", Theme{ConsentText: "<i>Hi</i><img src=x>"}, "user-a")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if theme.ConsentText != "<i>Hi</i>" {
+			t.Errorf("Unexpected consent text %v", theme.ConsentText)
+		}
+		if len(db.updated) != 1 || db.updated[0].Theme != `{"consentText":"\u003ci\u003eHi\u003c/i\u003e"}` {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionUpdateTheme {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+	t.Run("reset", func(t *testing.T) {
+		db := &mockUpdateAccountRetentionDatabase{}
+		p := &persistenceLayer{dal: db}
+		if _, err := p.UpdateAccountTheme("account-a", Theme{ConsentText: "<script></script>"}, "user-a"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(db.updated) != 1 || db.updated[0].Theme != "" {
+			t.Errorf("Unexpected updates %v", db.updated)
+		}
+	})
+}
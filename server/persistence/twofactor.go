@@ -0,0 +1,231 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+)
+
+const numRecoveryCodes = 10
+
+// ErrSecondFactorRequired is returned when logging in an account user that
+// has enabled two factor authentication without passing a second factor.
+var ErrSecondFactorRequired = errors.New("persistence: second factor required")
+
+// ErrInvalidSecondFactor is returned when the given second factor is neither
+// a valid one time password nor an unused recovery code.
+var ErrInvalidSecondFactor = errors.New("persistence: invalid second factor")
+
+// WithSecret sets the secret of the instance which is used for deriving the
+// key that encrypts secrets for two factor authentication.
+func WithSecret(secret []byte) Config {
+	return func(p *persistenceLayer) {
+		key := sha256.Sum256(secret)
+		p.secretKey = key[:]
+	}
+}
+
+// WithPreviousSecrets sets secrets the instance has used before its secret
+// was rotated. Values that have been encrypted using one of them can still be
+// decrypted and are re-encrypted using the current secret when accessed.
+func WithPreviousSecrets(secrets ...[]byte) Config {
+	return func(p *persistenceLayer) {
+		p.previousSecretKeys = nil
+		for _, secret := range secrets {
+			key := sha256.Sum256(secret)
+			p.previousSecretKeys = append(p.previousSecretKeys, key[:])
+		}
+	}
+}
+
+// decryptWithSecretKey decrypts a value that has been encrypted using the key
+// derived from the secret of the instance. In case a previous secret had to
+// be used, the value re-encrypted using the current secret is returned too.
+func (p *persistenceLayer) decryptWithSecretKey(value string) ([]byte, string, error) {
+	result, err := keys.DecryptWith(p.secretKey, value)
+	if err == nil {
+		return result, "", nil
+	}
+	for _, previousKey := range p.previousSecretKeys {
+		result, previousErr := keys.DecryptWith(previousKey, value)
+		if previousErr != nil {
+			continue
+		}
+		reencrypted, encryptErr := keys.EncryptWith(p.secretKey, result)
+		if encryptErr != nil {
+			return nil, "", fmt.Errorf("persistence: error re-encrypting value: %w", encryptErr)
+		}
+		return result, reencrypted.Marshal(), nil
+	}
+	return nil, "", err
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *persistenceLayer) decryptTOTPSecret(accountUser *AccountUser) ([]byte, error) {
+	if p.secretKey == nil {
+		return nil, errors.New("persistence: no secret configured for two factor authentication")
+	}
+	secret, reencrypted, err := p.decryptWithSecretKey(accountUser.TOTPSecret)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error decrypting totp secret: %w", err)
+	}
+	if reencrypted != "" {
+		accountUser.TOTPSecret = reencrypted
+		if err := p.dal.UpdateAccountUser(accountUser); err != nil {
+			return nil, fmt.Errorf("persistence: error updating totp secret: %w", err)
+		}
+	}
+	return secret, nil
+}
+
+func (p *persistenceLayer) SetupTOTP(accountUserID string) (TOTPSetupResult, error) {
+	if p.secretKey == nil {
+		return TOTPSetupResult{}, errors.New("persistence: no secret configured for two factor authentication")
+	}
+	accountUser, err := p.dal.FindAccountUser(FindAccountUserQueryByAccountUserIDIncludeRelationships(accountUserID))
+	if err != nil {
+		return TOTPSetupResult{}, fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	if accountUser.TOTPEnabled {
+		return TOTPSetupResult{}, errors.New("persistence: two factor authentication is already enabled")
+	}
+
+	secret, err := keys.GenerateTOTPSecret()
+	if err != nil {
+		return TOTPSetupResult{}, fmt.Errorf("persistence: error creating totp secret: %w", err)
+	}
+	encryptedSecret, err := keys.EncryptWith(p.secretKey, secret)
+	if err != nil {
+		return TOTPSetupResult{}, fmt.Errorf("persistence: error encrypting totp secret: %w", err)
+	}
+	// the secret is only used for logging in after it has been verified
+	accountUser.TOTPSecret = encryptedSecret.Marshal()
+	if err := p.dal.UpdateAccountUser(&accountUser); err != nil {
+		return TOTPSetupResult{}, fmt.Errorf("persistence: error saving totp secret: %w", err)
+	}
+
+	encodedSecret := keys.TOTPEncoding.EncodeToString(secret)
+	uri := url.URL{
+		Scheme: "otpauth",
+		Host:   "totp",
+		Path:   "/Offen",
+		RawQuery: url.Values{
+			"secret": []string{encodedSecret},
+			"issuer": []string{"Offen"},
+		}.Encode(),
+	}
+	return TOTPSetupResult{
+		Secret: encodedSecret,
+		URI:    uri.String(),
+	}, nil
+}
+
+func (p *persistenceLayer) VerifyTOTP(accountUserID, code string) (TOTPVerifyResult, error) {
+	accountUser, err := p.dal.FindAccountUser(FindAccountUserQueryByAccountUserIDIncludeRelationships(accountUserID))
+	if err != nil {
+		return TOTPVerifyResult{}, fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	if accountUser.TOTPEnabled {
+		return TOTPVerifyResult{}, errors.New("persistence: two factor authentication is already enabled")
+	}
+	if accountUser.TOTPSecret == "" {
+		return TOTPVerifyResult{}, errors.New("persistence: two factor authentication has not been set up")
+	}
+	secret, err := p.decryptTOTPSecret(&accountUser)
+	if err != nil {
+		return TOTPVerifyResult{}, err
+	}
+	step, ok := keys.MatchTOTP(secret, code, time.Now())
+	if !ok {
+		return TOTPVerifyResult{}, ErrInvalidSecondFactor
+	}
+	// the code used for setting up cannot be used for logging in
+	accountUser.TOTPLastStep = step
+
+	var result TOTPVerifyResult
+	accountUser.RecoveryCodes = nil
+	for i := 0; i < numRecoveryCodes; i++ {
+		value, err := keys.GenerateRandomValueWith(10, keys.TOTPEncoding)
+		if err != nil {
+			return TOTPVerifyResult{}, fmt.Errorf("persistence: error creating recovery code: %w", err)
+		}
+		code := strings.ToLower(value)
+		result.RecoveryCodes = append(result.RecoveryCodes, code)
+		// recovery codes are random values of sufficient length, so a plain
+		// hash is enough to protect them at rest
+		accountUser.RecoveryCodes = append(accountUser.RecoveryCodes, hashRecoveryCode(code))
+	}
+	accountUser.TOTPEnabled = true
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return TOTPVerifyResult{}, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	if err := txn.UpdateAccountUser(&accountUser); err != nil {
+		txn.Rollback()
+		return TOTPVerifyResult{}, fmt.Errorf("persistence: error enabling two factor authentication: %w", err)
+	}
+	if err := writeAuditLog(txn, accountUser.accountIDs(), accountUserID, AuditActionEnableTwoFactor, ""); err != nil {
+		txn.Rollback()
+		return TOTPVerifyResult{}, fmt.Errorf("persistence: error recording enabling of two factor authentication: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return TOTPVerifyResult{}, fmt.Errorf("persistence: error committing transaction: %w", err)
+	}
+	return result, nil
+}
+
+// checkSecondFactor validates the given second factor for the account user,
+// which is either a one time password or a recovery code. One time passwords
+// are only accepted when they are newer than the last accepted one, recovery
+// codes are removed once they have been used.
+func (p *persistenceLayer) checkSecondFactor(accountUser *AccountUser, secondFactor string) error {
+	if !accountUser.TOTPEnabled {
+		return nil
+	}
+	if secondFactor == "" {
+		return ErrSecondFactorRequired
+	}
+
+	// in case the secret of the instance has changed, account users are
+	// still able to log in using their recovery codes
+	if secret, err := p.decryptTOTPSecret(accountUser); err == nil {
+		if step, ok := keys.MatchTOTP(secret, secondFactor, time.Now()); ok {
+			if step <= accountUser.TOTPLastStep {
+				return ErrInvalidSecondFactor
+			}
+			accountUser.TOTPLastStep = step
+			if err := p.dal.UpdateAccountUser(accountUser); err != nil {
+				return fmt.Errorf("persistence: error recording used one time password: %w", err)
+			}
+			return nil
+		}
+	}
+
+	hashed := hashRecoveryCode(secondFactor)
+	for idx, recoveryCode := range accountUser.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(recoveryCode), []byte(hashed)) != 1 {
+			continue
+		}
+		accountUser.RecoveryCodes = append(accountUser.RecoveryCodes[:idx:idx], accountUser.RecoveryCodes[idx+1:]...)
+		if err := p.dal.UpdateAccountUser(accountUser); err != nil {
+			return fmt.Errorf("persistence: error invalidating used recovery code: %w", err)
+		}
+		return nil
+	}
+	return ErrInvalidSecondFactor
+}
@@ -0,0 +1,170 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+)
+
+type mockTwoFactorDatabase struct {
+	DataAccessLayer
+	accountUser AccountUser
+	auditLog    []*AuditLogEntry
+}
+
+func (m *mockTwoFactorDatabase) FindAccountUser(interface{}) (AccountUser, error) {
+	return m.accountUser, nil
+}
+
+func (m *mockTwoFactorDatabase) UpdateAccountUser(u *AccountUser) error {
+	m.accountUser = *u
+	return nil
+}
+
+func (m *mockTwoFactorDatabase) CreateAuditLogEntry(e *AuditLogEntry) error {
+	m.auditLog = append(m.auditLog, e)
+	return nil
+}
+
+func (m *mockTwoFactorDatabase) Commit() error {
+	return nil
+}
+
+func (m *mockTwoFactorDatabase) Rollback() error {
+	return nil
+}
+
+func (m *mockTwoFactorDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func TestPersistenceLayer_TOTP(t *testing.T) {
+	db := &mockTwoFactorDatabase{
+		accountUser: AccountUser{
+			AccountUserID: "user-a",
+			Relationships: []AccountUserRelationship{{AccountID: "account-a"}},
+		},
+	}
+	p := &persistenceLayer{dal: db}
+	WithSecret([]byte("secret"))(p)
+
+	setup, err := p.SetupTOTP("user-a")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if db.accountUser.TOTPSecret == "" || db.accountUser.TOTPEnabled {
+		t.Errorf("Expected pending secret to be stored, got %v", db.accountUser)
+	}
+	secret, err := keys.TOTPEncoding.DecodeString(setup.Secret)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := p.VerifyTOTP("user-a", "000000"); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("Expected invalid second factor, got %v", err)
+	}
+
+	verify, err := p.VerifyTOTP("user-a", keys.TOTP(secret, time.Now()))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(verify.RecoveryCodes) != numRecoveryCodes || len(db.accountUser.RecoveryCodes) != numRecoveryCodes {
+		t.Errorf("Unexpected recovery codes %v", verify.RecoveryCodes)
+	}
+	if !db.accountUser.TOTPEnabled {
+		t.Error("Expected two factor authentication to be enabled")
+	}
+	if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionEnableTwoFactor {
+		t.Errorf("Unexpected audit log %v", db.auditLog)
+	}
+
+	if _, err := p.SetupTOTP("user-a"); err == nil {
+		t.Error("Expected error when setting up two factor authentication again")
+	}
+
+	accountUser := db.accountUser
+	if err := p.checkSecondFactor(&accountUser, ""); !errors.Is(err, ErrSecondFactorRequired) {
+		t.Errorf("Expected second factor to be required, got %v", err)
+	}
+	if err := p.checkSecondFactor(&accountUser, keys.TOTP(secret, time.Now())); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("Expected code used for setup to be rejected, got %v", err)
+	}
+	next := keys.TOTP(secret, time.Now().Add(keys.TOTPPeriod))
+	if err := p.checkSecondFactor(&accountUser, next); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := p.checkSecondFactor(&accountUser, next); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("Expected used code to be rejected, got %v", err)
+	}
+	if err := p.checkSecondFactor(&accountUser, keys.TOTP(secret, time.Now().Add(-keys.TOTPPeriod))); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("Expected code older than used code to be rejected, got %v", err)
+	}
+	if db.accountUser.TOTPLastStep != accountUser.TOTPLastStep || accountUser.TOTPLastStep == 0 {
+		t.Errorf("Expected last step to be stored, got %v", db.accountUser.TOTPLastStep)
+	}
+	if err := p.checkSecondFactor(&accountUser, verify.RecoveryCodes[3]); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(db.accountUser.RecoveryCodes) != numRecoveryCodes-1 {
+		t.Errorf("Expected recovery code to be invalidated, got %v", db.accountUser.RecoveryCodes)
+	}
+	if err := p.checkSecondFactor(&accountUser, verify.RecoveryCodes[3]); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("Expected used recovery code to be rejected, got %v", err)
+	}
+
+	WithSecret([]byte("rotated"))(p)
+	accountUser.TOTPLastStep = 0
+	if err := p.checkSecondFactor(&accountUser, keys.TOTP(secret, time.Now())); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("Expected code to be rejected after secret changed, got %v", err)
+	}
+	if err := p.checkSecondFactor(&accountUser, verify.RecoveryCodes[5]); err != nil {
+		t.Errorf("Unexpected error using recovery code after secret changed %v", err)
+	}
+}
+
+func TestPersistenceLayer_TOTP_PreviousSecrets(t *testing.T) {
+	db := &mockTwoFactorDatabase{
+		accountUser: AccountUser{AccountUserID: "user-a"},
+	}
+	p := &persistenceLayer{dal: db}
+	WithSecret([]byte("secret"))(p)
+
+	setup, err := p.SetupTOTP("user-a")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	secret, err := keys.TOTPEncoding.DecodeString(setup.Secret)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	db.accountUser.TOTPEnabled = true
+	previous := db.accountUser.TOTPSecret
+
+	WithSecret([]byte("rotated"))(p)
+	WithPreviousSecrets([]byte("other"), []byte("secret"))(p)
+	accountUser := db.accountUser
+	if err := p.checkSecondFactor(&accountUser, keys.TOTP(secret, time.Now())); err != nil {
+		t.Errorf("Unexpected error after secret was rotated %v", err)
+	}
+	if db.accountUser.TOTPSecret == previous {
+		t.Error("Expected secret to be re-encrypted using the current secret")
+	}
+
+	WithPreviousSecrets()(p)
+	accountUser = db.accountUser
+	if err := p.checkSecondFactor(&accountUser, keys.TOTP(secret, time.Now().Add(keys.TOTPPeriod))); err != nil {
+		t.Errorf("Unexpected error after previous secret was dropped %v", err)
+	}
+}
+
+func TestPersistenceLayer_SetupTOTP_NoSecret(t *testing.T) {
+	p := &persistenceLayer{dal: &mockTwoFactorDatabase{}}
+	if _, err := p.SetupTOTP("user-a"); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"fmt"
+	"time"
+)
+
+// GetUserData collects all events and secrets that are stored for the given
+// user. Accounts that do not hold any data about the user are omitted.
+func (p *persistenceLayer) GetUserData(userID string) (UserDataResult, error) {
+	accounts, err := p.dal.FindAccounts(FindAccountsQueryAllAccounts{})
+	if err != nil {
+		return UserDataResult{}, fmt.Errorf("persistence: error looking up accounts: %w", err)
+	}
+
+	secretIDs := make([]string, len(accounts))
+	for i, account := range accounts {
+		hashedUserID, err := account.HashUserID(userID)
+		if err != nil {
+			return UserDataResult{}, fmt.Errorf("persistence: error hashing user id for account %s: %w", account.AccountID, err)
+		}
+		secretIDs[i] = hashedUserID
+	}
+	result := UserDataResult{
+		Created:  time.Now().UTC(),
+		Accounts: []UserDataAccountResult{},
+	}
+	if len(secretIDs) == 0 {
+		return result, nil
+	}
+
+	events, err := p.dal.FindEvents(FindEventsQueryForSecretIDs{SecretIDs: secretIDs})
+	if err != nil {
+		return UserDataResult{}, fmt.Errorf("persistence: error looking up events: %w", err)
+	}
+	eventsByAccountID := map[string][]EventResult{}
+	for _, evt := range events {
+		eventsByAccountID[evt.AccountID] = append(eventsByAccountID[evt.AccountID], EventResult{
+			AccountID:  evt.AccountID,
+			SecretID:   evt.SecretID,
+			EventID:    evt.EventID,
+			Payload:    evt.Payload,
+			KeyVersion: evt.KeyVersion,
+			EventType:  evt.EventType,
+		})
+	}
+
+	secrets, err := p.dal.FindSecrets(FindSecretsQueryBySecretIDs(secretIDs))
+	if err != nil {
+		return UserDataResult{}, fmt.Errorf("persistence: error looking up secrets: %w", err)
+	}
+	encryptedSecrets := map[string]string{}
+	for _, secret := range secrets {
+		encryptedSecrets[secret.SecretID] = secret.EncryptedSecret
+	}
+
+	for i, account := range accounts {
+		secretID := secretIDs[i]
+		accountEvents := eventsByAccountID[account.AccountID]
+		encryptedSecret, hasSecret := encryptedSecrets[secretID]
+		if len(accountEvents) == 0 && !hasSecret {
+			continue
+		}
+		if accountEvents == nil {
+			accountEvents = []EventResult{}
+		}
+		result.Accounts = append(result.Accounts, UserDataAccountResult{
+			AccountID:       account.AccountID,
+			AccountName:     account.Name,
+			SecretID:        secretID,
+			EncryptedSecret: encryptedSecret,
+			Events:          accountEvents,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+)
+
+type mockGetUserDataDatabase struct {
+	DataAccessLayer
+	accounts []Account
+	events   []Event
+	secrets  []Secret
+	err      error
+}
+
+func (m *mockGetUserDataDatabase) FindAccounts(interface{}) ([]Account, error) {
+	return m.accounts, m.err
+}
+
+func (m *mockGetUserDataDatabase) FindEvents(q interface{}) ([]Event, error) {
+	return m.events, nil
+}
+
+func (m *mockGetUserDataDatabase) FindSecrets(q interface{}) ([]Secret, error) {
+	return m.secrets, nil
+}
+
+func TestPersistenceLayer_GetUserData(t *testing.T) {
+	t.Run("database error", func(t *testing.T) {
+		p := &persistenceLayer{dal: &mockGetUserDataDatabase{err: errors.New("did not work")}}
+		if _, err := p.GetUserData("user-id"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+	t.Run("ok", func(t *testing.T) {
+		accounts := []Account{
+			{AccountID: "account-a", Name: "a", UserSalt: "{1,} JF+rNeViJeJb0jth6ZheWg=="},
+			{AccountID: "account-b", Name: "b", UserSalt: "{1,} D6xdWYfRqbuWrkg4OWVgGQ=="},
+			{AccountID: "account-c", Name: "c", UserSalt: "{1,} CaHVhk78uhoPmf5wanA0vg=="},
+		}
+		secretA, _ := accounts[0].HashUserID("user-id")
+		secretB, _ := accounts[1].HashUserID("user-id")
+		db := &mockGetUserDataDatabase{
+			accounts: accounts,
+			events: []Event{
+				{EventID: "event-a", AccountID: "account-a", SecretID: &secretA, Payload: "payload-a"},
+				{EventID: "event-b", AccountID: "account-a", SecretID: &secretA, Payload: "payload-b"},
+			},
+			secrets: []Secret{
+				{SecretID: secretA, EncryptedSecret: "secret-a"},
+				{SecretID: secretB, EncryptedSecret: "secret-b"},
+			},
+		}
+		p := &persistenceLayer{dal: db}
+		result, err := p.GetUserData("user-id")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(result.Accounts) != 2 {
+			t.Fatalf("Unexpected accounts %v", result.Accounts)
+		}
+		if a := result.Accounts[0]; a.AccountID != "account-a" || a.EncryptedSecret != "secret-a" || len(a.Events) != 2 {
+			t.Errorf("Unexpected result for account a %v", a)
+		}
+		if b := result.Accounts[1]; b.AccountID != "account-b" || b.EncryptedSecret != "secret-b" || len(b.Events) != 0 {
+			t.Errorf("Unexpected result for account b %v", b)
+		}
+	})
+}
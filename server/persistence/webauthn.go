@@ -0,0 +1,198 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+)
+
+// passkeyKey returns the decrypted passkey key of the given account user. In
+// case create is true and the account user does not have a passkey key yet,
+// a new one is added to the account user.
+func (p *persistenceLayer) passkeyKey(accountUser *AccountUser, create bool) ([]byte, error) {
+	if p.secretKey == nil {
+		return nil, errors.New("persistence: no secret configured for passkeys")
+	}
+	if accountUser.PasskeyKey == "" {
+		if !create {
+			return nil, errors.New("persistence: account user has not registered any passkeys")
+		}
+		key, err := keys.GenerateRandomBytes(keys.DefaultEncryptionKeySize)
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error creating passkey key: %w", err)
+		}
+		encryptedKey, err := keys.EncryptWith(p.secretKey, key)
+		if err != nil {
+			return nil, fmt.Errorf("persistence: error encrypting passkey key: %w", err)
+		}
+		accountUser.PasskeyKey = encryptedKey.Marshal()
+		return key, nil
+	}
+	key, reencrypted, err := p.decryptWithSecretKey(accountUser.PasskeyKey)
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error decrypting passkey key: %w", err)
+	}
+	if reencrypted != "" {
+		accountUser.PasskeyKey = reencrypted
+		if err := p.dal.UpdateAccountUser(accountUser); err != nil {
+			return nil, fmt.Errorf("persistence: error updating passkey key: %w", err)
+		}
+	}
+	return key, nil
+}
+
+func (p *persistenceLayer) addPasskeyEncryptedKey(accountUser *AccountUser, relationship *AccountUserRelationship, decryptedKey []byte) error {
+	passkeyKey, err := p.passkeyKey(accountUser, false)
+	if err != nil {
+		return err
+	}
+	encryptedKey, err := keys.EncryptWith(passkeyKey, decryptedKey)
+	if err != nil {
+		return fmt.Errorf("persistence: error encrypting key for passkeys: %w", err)
+	}
+	relationship.PasskeyEncryptedKeyEncryptionKey = encryptedKey.Marshal()
+	if err := p.dal.UpdateAccountUserRelationship(relationship); err != nil {
+		return fmt.Errorf("persistence: error updating relationship: %w", err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) ListWebAuthnCredentials(accountUserID string) ([]WebAuthnCredentialResult, error) {
+	credentials, err := p.dal.FindWebAuthnCredentials(FindWebAuthnCredentialsQueryByAccountUserID(accountUserID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up webauthn credentials: %w", err)
+	}
+	result := []WebAuthnCredentialResult{}
+	for _, c := range credentials {
+		result = append(result, WebAuthnCredentialResult{
+			CredentialID: c.CredentialID,
+			Credential:   c.Credential,
+			Created:      c.Created,
+		})
+	}
+	return result, nil
+}
+
+// RegisterWebAuthnCredential stores the given credential for the account user.
+// As passkey logins cannot derive keys from the password, the key encryption
+// keys of all accounts are additionally encrypted using the passkey key of
+// the account user, which requires the password to be given.
+func (p *persistenceLayer) RegisterWebAuthnCredential(accountUserID, password, credentialID, credential string) error {
+	accountUser, err := p.dal.FindAccountUser(FindAccountUserQueryByAccountUserIDIncludeRelationships(accountUserID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	if err := keys.CompareString(password, accountUser.HashedPassword); err != nil {
+		return fmt.Errorf("persistence: error comparing passwords: %w", err)
+	}
+	pwDerivedKey, err := keys.DeriveKey(password, accountUser.Salt)
+	if err != nil {
+		return fmt.Errorf("persistence: error deriving key from password: %w", err)
+	}
+	passkeyKey, err := p.passkeyKey(&accountUser, true)
+	if err != nil {
+		return err
+	}
+
+	for idx, relationship := range accountUser.Relationships {
+		if relationship.PasskeyEncryptedKeyEncryptionKey != "" {
+			continue
+		}
+		decryptedKey, err := keys.DecryptWith(pwDerivedKey, relationship.PasswordEncryptedKeyEncryptionKey)
+		if err != nil {
+			return fmt.Errorf("persistence: error decrypting key encryption key for account %s: %w", relationship.AccountID, err)
+		}
+		encryptedKey, err := keys.EncryptWith(passkeyKey, decryptedKey)
+		if err != nil {
+			return fmt.Errorf("persistence: error encrypting key for passkeys: %w", err)
+		}
+		accountUser.Relationships[idx].PasskeyEncryptedKeyEncryptionKey = encryptedKey.Marshal()
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	if err := txn.UpdateAccountUser(&accountUser); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error updating account user: %w", err)
+	}
+	for _, relationship := range accountUser.Relationships {
+		if err := txn.UpdateAccountUserRelationship(&relationship); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error updating relationship: %w", err)
+		}
+	}
+	if err := txn.CreateWebAuthnCredential(&WebAuthnCredential{
+		CredentialID:  credentialID,
+		AccountUserID: accountUserID,
+		Credential:    credential,
+		Created:       time.Now(),
+	}); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error persisting webauthn credential: %w", err)
+	}
+	// credential ids are too long to be used as audit log target, so they
+	// are recorded as a fingerprint
+	if err := writeAuditLog(txn, accountUser.accountIDs(), accountUserID, AuditActionRegisterPasskey, keyFingerprint(credentialID)); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording passkey registration: %w", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// LoginWebAuthn logs in the account user after the given credential has been
+// used for authenticating. The stored credential is replaced with the given
+// one, so its sign count is kept up to date.
+func (p *persistenceLayer) LoginWebAuthn(accountUserID, credentialID, credential string) (LoginResult, error) {
+	accountUser, err := p.dal.FindAccountUser(FindAccountUserQueryByAccountUserIDIncludeRelationships(accountUserID))
+	if err != nil {
+		return LoginResult{}, fmt.Errorf("persistence: error looking up account user: %w", err)
+	}
+	if err := p.dal.UpdateWebAuthnCredential(&WebAuthnCredential{
+		CredentialID:  credentialID,
+		AccountUserID: accountUserID,
+		Credential:    credential,
+	}); err != nil {
+		return LoginResult{}, fmt.Errorf("persistence: error updating webauthn credential: %w", err)
+	}
+	passkeyKey, err := p.passkeyKey(&accountUser, false)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	results := []LoginAccountResult{}
+	for _, relationship := range accountUser.Relationships {
+		// accounts that have been joined after registering the passkey are
+		// only available after logging in using the password again
+		if relationship.PasskeyEncryptedKeyEncryptionKey == "" {
+			continue
+		}
+		decryptedKey, err := keys.DecryptWith(passkeyKey, relationship.PasskeyEncryptedKeyEncryptionKey)
+		if err != nil {
+			return LoginResult{}, fmt.Errorf(`persistence: failed decrypting key encryption key for account "%s": %w`, relationship.AccountID, err)
+		}
+		result, err := p.loginAccountResult(relationship, decryptedKey)
+		if errors.Is(err, errRetiredAccount) {
+			continue
+		}
+		if err != nil {
+			return LoginResult{}, err
+		}
+		results = append(results, result)
+	}
+
+	return LoginResult{
+		AccountUserID: accountUser.AccountUserID,
+		AdminLevel:    accountUser.AdminLevel,
+		Accounts:      results,
+	}, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/offen/offen/server/keys"
+)
+
+type mockWebAuthnDatabase struct {
+	DataAccessLayer
+	accountUser   AccountUser
+	relationships []*AccountUserRelationship
+	credentials   []*WebAuthnCredential
+	updated       []*WebAuthnCredential
+	auditLog      []*AuditLogEntry
+}
+
+func (m *mockWebAuthnDatabase) FindAccountUser(interface{}) (AccountUser, error) {
+	return m.accountUser, nil
+}
+
+func (m *mockWebAuthnDatabase) FindAccount(interface{}) (Account, error) {
+	return Account{Name: "name"}, nil
+}
+
+func (m *mockWebAuthnDatabase) UpdateAccountUser(u *AccountUser) error {
+	m.accountUser = *u
+	return nil
+}
+
+func (m *mockWebAuthnDatabase) UpdateAccountUserRelationship(r *AccountUserRelationship) error {
+	m.relationships = append(m.relationships, r)
+	return nil
+}
+
+func (m *mockWebAuthnDatabase) CreateWebAuthnCredential(c *WebAuthnCredential) error {
+	m.credentials = append(m.credentials, c)
+	return nil
+}
+
+func (m *mockWebAuthnDatabase) UpdateWebAuthnCredential(c *WebAuthnCredential) error {
+	for _, credential := range m.credentials {
+		if credential.CredentialID == c.CredentialID && credential.AccountUserID == c.AccountUserID {
+			m.updated = append(m.updated, c)
+			return nil
+		}
+	}
+	return errors.New("did not find credential")
+}
+
+func (m *mockWebAuthnDatabase) CreateAuditLogEntry(e *AuditLogEntry) error {
+	m.auditLog = append(m.auditLog, e)
+	return nil
+}
+
+func (m *mockWebAuthnDatabase) Commit() error {
+	return nil
+}
+
+func (m *mockWebAuthnDatabase) Rollback() error {
+	return nil
+}
+
+func (m *mockWebAuthnDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func TestPersistenceLayer_WebAuthn(t *testing.T) {
+	accountUser, err := newAccountUser("user@offen.dev", "pass", AccountUserAdminLevelSuperAdmin)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	key, _ := keys.GenerateRandomBytes(keys.DefaultEncryptionKeySize)
+	relationship, _ := newAccountUserRelationship(accountUser.AccountUserID, "account-a", AccountUserRoleAdmin)
+	if err := relationship.addPasswordEncryptedKey(key, accountUser.Salt, "pass"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	accountUser.Relationships = append(accountUser.Relationships, *relationship)
+
+	db := &mockWebAuthnDatabase{accountUser: *accountUser}
+	p := &persistenceLayer{dal: db}
+	WithSecret([]byte("secret"))(p)
+
+	if err := p.RegisterWebAuthnCredential(accountUser.AccountUserID, "other", "credential-a", "{}"); err == nil {
+		t.Error("Expected error when using bad password, got nil")
+	}
+
+	if err := p.RegisterWebAuthnCredential(accountUser.AccountUserID, "pass", "credential-a", "{}"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if db.accountUser.PasskeyKey == "" {
+		t.Error("Expected passkey key to be set")
+	}
+	if len(db.relationships) != 1 || db.relationships[0].PasskeyEncryptedKeyEncryptionKey == "" {
+		t.Errorf("Unexpected relationships %v", db.relationships)
+	}
+	if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionRegisterPasskey || db.auditLog[0].Target != keyFingerprint("credential-a") {
+		t.Errorf("Unexpected audit log %v", db.auditLog)
+	}
+	db.accountUser.Relationships = []AccountUserRelationship{*db.relationships[0]}
+
+	if _, err := p.LoginWebAuthn(accountUser.AccountUserID, "credential-z", "{}"); err == nil {
+		t.Error("Expected error when using unknown credential, got nil")
+	}
+
+	result, err := p.LoginWebAuthn(accountUser.AccountUserID, "credential-a", `{"signCount":1}`)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(result.Accounts) != 1 || result.Accounts[0].AccountID != "account-a" {
+		t.Errorf("Unexpected result %v", result)
+	}
+	if len(db.updated) != 1 || db.updated[0].Credential != `{"signCount":1}` {
+		t.Errorf("Unexpected credential updates %v", db.updated)
+	}
+}
+
+func TestPersistenceLayer_RegisterWebAuthnCredential_NoSecret(t *testing.T) {
+	accountUser, err := newAccountUser("user@offen.dev", "pass", AccountUserAdminLevelSuperAdmin)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	p := &persistenceLayer{dal: &mockWebAuthnDatabase{accountUser: *accountUser}}
+	if err := p.RegisterWebAuthnCredential(accountUser.AccountUserID, "pass", "credential-a", "{}"); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
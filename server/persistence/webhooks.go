@@ -0,0 +1,351 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/safehttp"
+	"github.com/offen/offen/server/webhook"
+)
+
+// The following events can be subscribed to by webhooks.
+const (
+	WebhookEventAccountCreated  = "account.created"
+	WebhookEventUserJoined      = "user.joined"
+	WebhookEventRetentionPurged = "retention.purged"
+	WebhookEventQuotaExceeded   = "quota.exceeded"
+)
+
+const (
+	webhookDeliveryBatchSize    = 50
+	defaultWebhookDeliveryLimit = 100
+	minimumWebhookSecretLength  = 16
+	// completed deliveries are kept for this long so they can be inspected
+	webhookDeliveryRetention = time.Hour * 24 * 30
+)
+
+// ValidateWebhookEvents checks that the given list of events is non-empty
+// and only contains known events.
+func ValidateWebhookEvents(events []string) error {
+	if len(events) == 0 {
+		return errors.New("persistence: webhooks require at least one event")
+	}
+	for _, event := range events {
+		switch event {
+		case WebhookEventAccountCreated, WebhookEventUserJoined, WebhookEventRetentionPurged, WebhookEventQuotaExceeded:
+		default:
+			return fmt.Errorf("persistence: unknown webhook event %s", event)
+		}
+	}
+	return nil
+}
+
+// ValidateWebhookURL checks that the given value is an absolute HTTPS URL
+// that does not obviously point to a non-public address. Hosts resolving to
+// such addresses are rejected when sending deliveries.
+func ValidateWebhookURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("persistence: error parsing webhook url: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("persistence: webhook url %s is not an absolute https url", value)
+	}
+	host := strings.ToLower(u.Hostname())
+	if ip := net.ParseIP(host); (ip != nil && !safehttp.IsPublic(ip)) || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("persistence: webhook url %s does not point to a public address", value)
+	}
+	return nil
+}
+
+// ValidateWebhookSecret checks that a secret given by the user is long
+// enough. Empty secrets are valid and cause a random secret to be generated.
+func ValidateWebhookSecret(secret string) error {
+	if secret != "" && len(secret) < minimumWebhookSecretLength {
+		return fmt.Errorf("persistence: webhook secrets need to be at least %d characters long", minimumWebhookSecretLength)
+	}
+	return nil
+}
+
+func (w *Webhook) subscribes(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookPayload is the body that is sent to webhooks.
+type webhookPayload struct {
+	DeliveryID string      `json:"deliveryId"`
+	Event      string      `json:"event"`
+	AccountID  string      `json:"accountId"`
+	Created    time.Time   `json:"created"`
+	Data       interface{} `json:"data"`
+}
+
+// notifyWebhooks queues a delivery of the given event for each webhook that
+// is subscribed to it. Passing a transaction makes sure notifications are
+// only sent when the operation that caused them is committed.
+func notifyWebhooks(dal DataAccessLayer, accountID, event string, data interface{}) error {
+	webhooks, err := dal.FindWebhooks(FindWebhooksQueryForAccount(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up webhooks: %w", err)
+	}
+	now := time.Now()
+	for _, hook := range webhooks {
+		if !hook.subscribes(event) {
+			continue
+		}
+		deliveryID, err := NewULID()
+		if err != nil {
+			return fmt.Errorf("persistence: error creating delivery id: %w", err)
+		}
+		payload, err := json.Marshal(webhookPayload{
+			DeliveryID: deliveryID,
+			Event:      event,
+			AccountID:  accountID,
+			Created:    now,
+			Data:       data,
+		})
+		if err != nil {
+			return fmt.Errorf("persistence: error encoding webhook payload: %w", err)
+		}
+		if err := dal.CreateWebhookDelivery(&WebhookDelivery{
+			DeliveryID:  deliveryID,
+			WebhookID:   hook.WebhookID,
+			AccountID:   accountID,
+			Event:       event,
+			Payload:     string(payload),
+			NextAttempt: now,
+			Created:     now,
+		}); err != nil {
+			return fmt.Errorf("persistence: error queueing webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *persistenceLayer) CreateWebhook(accountID, accountUserID, url, secret string, events []string) (WebhookResult, error) {
+	if err := ValidateWebhookURL(url); err != nil {
+		return WebhookResult{}, err
+	}
+	if err := ValidateWebhookEvents(events); err != nil {
+		return WebhookResult{}, err
+	}
+	if err := ValidateWebhookSecret(secret); err != nil {
+		return WebhookResult{}, err
+	}
+	if secret == "" {
+		value, err := keys.GenerateRandomValueWith(32, base64.RawURLEncoding)
+		if err != nil {
+			return WebhookResult{}, fmt.Errorf("persistence: error creating webhook secret: %w", err)
+		}
+		secret = value
+	}
+	webhookID, err := NewULID()
+	if err != nil {
+		return WebhookResult{}, fmt.Errorf("persistence: error creating webhook id: %w", err)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return WebhookResult{}, fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	hook := &Webhook{
+		WebhookID: webhookID,
+		AccountID: accountID,
+		URL:       url,
+		Secret:    secret,
+		Events:    events,
+		CreatedBy: accountUserID,
+		Created:   time.Now(),
+	}
+	if err := txn.CreateWebhook(hook); err != nil {
+		txn.Rollback()
+		return WebhookResult{}, fmt.Errorf("persistence: error creating webhook: %w", err)
+	}
+	if accountID != "" {
+		if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionCreateWebhook, webhookID); err != nil {
+			txn.Rollback()
+			return WebhookResult{}, fmt.Errorf("persistence: error recording webhook creation: %w", err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return WebhookResult{}, fmt.Errorf("persistence: error committing webhook: %w", err)
+	}
+
+	result := hook.export()
+	result.Secret = secret
+	return result, nil
+}
+
+func (p *persistenceLayer) ListWebhooks(accountID string) ([]WebhookResult, error) {
+	webhooks, err := p.dal.FindWebhooks(FindWebhooksQueryByAccountID(accountID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error listing webhooks: %w", err)
+	}
+	result := []WebhookResult{}
+	for _, hook := range webhooks {
+		result = append(result, hook.export())
+	}
+	return result, nil
+}
+
+func (p *persistenceLayer) DeleteWebhook(accountID, webhookID, accountUserID string) error {
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	affected, err := txn.DeleteWebhooks(DeleteWebhooksQueryByID{AccountID: accountID, WebhookID: webhookID})
+	if err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error deleting webhook: %w", err)
+	}
+	if affected == 0 {
+		txn.Rollback()
+		return ErrUnknownWebhook(fmt.Sprintf("persistence: webhook %s not found", webhookID))
+	}
+	if _, err := txn.DeleteWebhookDeliveries(DeleteWebhookDeliveriesQueryByWebhookID(webhookID)); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error deleting deliveries of webhook: %w", err)
+	}
+	if accountID != "" {
+		if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionDeleteWebhook, webhookID); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("persistence: error recording webhook deletion: %w", err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing webhook deletion: %w", err)
+	}
+	return nil
+}
+
+func (p *persistenceLayer) ListWebhookDeliveries(accountID, webhookID string, limit int) ([]WebhookDeliveryResult, error) {
+	webhooks, err := p.dal.FindWebhooks(FindWebhooksQueryByID(webhookID))
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up webhook: %w", err)
+	}
+	if len(webhooks) == 0 || webhooks[0].AccountID != accountID {
+		return nil, ErrUnknownWebhook(fmt.Sprintf("persistence: webhook %s not found", webhookID))
+	}
+	if limit <= 0 {
+		limit = defaultWebhookDeliveryLimit
+	}
+	deliveries, err := p.dal.FindWebhookDeliveries(FindWebhookDeliveriesQueryByWebhookID{
+		WebhookID: webhookID,
+		Limit:     limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("persistence: error looking up webhook deliveries: %w", err)
+	}
+	result := []WebhookDeliveryResult{}
+	for _, delivery := range deliveries {
+		result = append(result, delivery.export())
+	}
+	return result, nil
+}
+
+func (p *persistenceLayer) DeliverWebhooks(s webhook.Sender, maxAttempts int) (int, error) {
+	now := time.Now()
+	deliveries, err := p.dal.FindWebhookDeliveries(FindWebhookDeliveriesQueryDue{Before: now, Limit: webhookDeliveryBatchSize})
+	if err != nil {
+		return 0, fmt.Errorf("persistence: error looking up due webhook deliveries: %w", err)
+	}
+
+	webhooks := map[string]*Webhook{}
+	var delivered int
+	for _, delivery := range deliveries {
+		hook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			matches, err := p.dal.FindWebhooks(FindWebhooksQueryByID(delivery.WebhookID))
+			if err != nil {
+				return delivered, fmt.Errorf("persistence: error looking up webhook %s: %w", delivery.WebhookID, err)
+			}
+			if len(matches) != 0 {
+				hook = &matches[0]
+			}
+			webhooks[delivery.WebhookID] = hook
+		}
+		if hook == nil {
+			delivery.Failed = true
+			delivery.LastError = "webhook has been deleted"
+			if err := p.dal.UpdateWebhookDelivery(&delivery); err != nil {
+				return delivered, fmt.Errorf("persistence: error updating delivery %s: %w", delivery.DeliveryID, err)
+			}
+			continue
+		}
+
+		// the next attempt is scheduled before sending so that a crash while
+		// sending causes the delivery to be retried instead of being lost
+		delivery.Attempts++
+		delivery.NextAttempt = now.Add(deliveryRetryDelay(delivery.Attempts))
+		if err := p.dal.UpdateWebhookDelivery(&delivery); err != nil {
+			return delivered, fmt.Errorf("persistence: error scheduling next attempt for delivery %s: %w", delivery.DeliveryID, err)
+		}
+
+		status, sendErr := s.Send(webhook.Delivery{
+			ID:      delivery.DeliveryID,
+			Event:   delivery.Event,
+			URL:     hook.URL,
+			Secret:  hook.Secret,
+			Payload: []byte(delivery.Payload),
+		})
+		delivery.StatusCode = status
+		if sendErr != nil {
+			delivery.LastError = sendErr.Error()
+			delivery.Failed = !webhook.IsTemporary(sendErr) || delivery.Attempts >= maxAttempts
+		} else {
+			delivery.LastError = ""
+			delivery.Delivered = true
+			delivered++
+		}
+		if err := p.dal.UpdateWebhookDelivery(&delivery); err != nil {
+			return delivered, fmt.Errorf("persistence: error recording attempt for delivery %s: %w", delivery.DeliveryID, err)
+		}
+	}
+
+	if _, err := p.dal.DeleteWebhookDeliveries(DeleteWebhookDeliveriesQueryCompletedBefore(now.Add(-webhookDeliveryRetention))); err != nil {
+		return delivered, fmt.Errorf("persistence: error pruning webhook deliveries: %w", err)
+	}
+	return delivered, nil
+}
+
+func (w *Webhook) export() WebhookResult {
+	return WebhookResult{
+		WebhookID: w.WebhookID,
+		AccountID: w.AccountID,
+		URL:       w.URL,
+		Events:    append([]string{}, w.Events...),
+		CreatedBy: w.CreatedBy,
+		Created:   w.Created,
+	}
+}
+
+func (w *WebhookDelivery) export() WebhookDeliveryResult {
+	return WebhookDeliveryResult{
+		DeliveryID:  w.DeliveryID,
+		WebhookID:   w.WebhookID,
+		Event:       w.Event,
+		Payload:     json.RawMessage(w.Payload),
+		Attempts:    w.Attempts,
+		StatusCode:  w.StatusCode,
+		LastError:   w.LastError,
+		Delivered:   w.Delivered,
+		Failed:      w.Failed,
+		NextAttempt: w.NextAttempt,
+		Created:     w.Created,
+	}
+}
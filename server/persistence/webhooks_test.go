@@ -0,0 +1,278 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/webhook"
+)
+
+type mockWebhookDatabase struct {
+	DataAccessLayer
+	webhooks   map[string]Webhook
+	deliveries map[string]WebhookDelivery
+	deleted    []interface{}
+}
+
+func newMockWebhookDatabase() *mockWebhookDatabase {
+	return &mockWebhookDatabase{
+		webhooks: map[string]Webhook{
+			"webhook-a": {WebhookID: "webhook-a", AccountID: "account-a", URL: "https://a.offen.dev", Secret: "secret-a", Events: []string{WebhookEventUserJoined}},
+			"webhook-b": {WebhookID: "webhook-b", URL: "https://b.offen.dev", Secret: "secret-b", Events: []string{WebhookEventUserJoined, WebhookEventAccountCreated}},
+			"webhook-c": {WebhookID: "webhook-c", AccountID: "account-c", Events: []string{WebhookEventUserJoined}},
+		},
+		deliveries: map[string]WebhookDelivery{},
+	}
+}
+
+func (m *mockWebhookDatabase) CreateWebhook(w *Webhook) error {
+	m.webhooks[w.WebhookID] = *w
+	return nil
+}
+
+func (m *mockWebhookDatabase) FindWebhooks(q interface{}) ([]Webhook, error) {
+	var result []Webhook
+	for _, hook := range m.webhooks {
+		switch query := q.(type) {
+		case FindWebhooksQueryForAccount:
+			if hook.AccountID == "" || hook.AccountID == string(query) {
+				result = append(result, hook)
+			}
+		case FindWebhooksQueryByAccountID:
+			if hook.AccountID == string(query) {
+				result = append(result, hook)
+			}
+		case FindWebhooksQueryByID:
+			if hook.WebhookID == string(query) {
+				result = append(result, hook)
+			}
+		default:
+			return nil, ErrBadQuery
+		}
+	}
+	return result, nil
+}
+
+func (m *mockWebhookDatabase) DeleteWebhooks(q interface{}) (int64, error) {
+	m.deleted = append(m.deleted, q)
+	query := q.(DeleteWebhooksQueryByID)
+	if hook, ok := m.webhooks[query.WebhookID]; ok && hook.AccountID == query.AccountID {
+		delete(m.webhooks, query.WebhookID)
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m *mockWebhookDatabase) CreateWebhookDelivery(d *WebhookDelivery) error {
+	m.deliveries[d.DeliveryID] = *d
+	return nil
+}
+
+func (m *mockWebhookDatabase) FindWebhookDeliveries(q interface{}) ([]WebhookDelivery, error) {
+	var result []WebhookDelivery
+	for _, delivery := range m.deliveries {
+		switch query := q.(type) {
+		case FindWebhookDeliveriesQueryDue:
+			if !delivery.Delivered && !delivery.Failed && !delivery.NextAttempt.After(query.Before) {
+				result = append(result, delivery)
+			}
+		case FindWebhookDeliveriesQueryByWebhookID:
+			if delivery.WebhookID == query.WebhookID {
+				result = append(result, delivery)
+			}
+		default:
+			return nil, ErrBadQuery
+		}
+	}
+	return result, nil
+}
+
+func (m *mockWebhookDatabase) UpdateWebhookDelivery(d *WebhookDelivery) error {
+	m.deliveries[d.DeliveryID] = *d
+	return nil
+}
+
+func (m *mockWebhookDatabase) DeleteWebhookDeliveries(q interface{}) (int64, error) {
+	m.deleted = append(m.deleted, q)
+	return 0, nil
+}
+
+func (m *mockWebhookDatabase) CreateAuditLogEntry(*AuditLogEntry) error {
+	return nil
+}
+
+func (m *mockWebhookDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func (m *mockWebhookDatabase) Commit() error {
+	return nil
+}
+
+func (m *mockWebhookDatabase) Rollback() error {
+	return nil
+}
+
+type mockWebhookSender struct {
+	sent   []webhook.Delivery
+	status int
+	err    error
+}
+
+func (m *mockWebhookSender) Send(d webhook.Delivery) (int, error) {
+	m.sent = append(m.sent, d)
+	return m.status, m.err
+}
+
+func TestPersistenceLayer_CreateWebhook(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		secret      string
+		events      []string
+		expectError bool
+	}{
+		{"ok", "https://www.offen.dev/hook", "", []string{WebhookEventUserJoined}, false},
+		{"custom secret", "https://www.offen.dev/hook", "a-very-long-secret", []string{WebhookEventUserJoined}, false},
+		{"plain http", "http://www.offen.dev/hook", "", []string{WebhookEventUserJoined}, true},
+		{"relative url", "/hook", "", []string{WebhookEventUserJoined}, true},
+		{"loopback", "https://127.0.0.1/hook", "", []string{WebhookEventUserJoined}, true},
+		{"link local", "https://169.254.169.254/latest/meta-data", "", []string{WebhookEventUserJoined}, true},
+		{"localhost", "https://localhost:8080/hook", "", []string{WebhookEventUserJoined}, true},
+		{"short secret", "https://www.offen.dev/hook", "short", []string{WebhookEventUserJoined}, true},
+		{"no events", "https://www.offen.dev/hook", "", nil, true},
+		{"unknown event", "https://www.offen.dev/hook", "", []string{"account.renamed"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newMockWebhookDatabase()
+			p := &persistenceLayer{dal: db}
+			result, err := p.CreateWebhook("account-a", "user-a", test.url, test.secret, test.events)
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if test.expectError {
+				return
+			}
+			if result.Secret == "" || (test.secret != "" && result.Secret != test.secret) {
+				t.Errorf("Unexpected secret %v", result.Secret)
+			}
+			if db.webhooks[result.WebhookID].Secret != result.Secret {
+				t.Errorf("Expected secret to be persisted, got %v", db.webhooks[result.WebhookID])
+			}
+			listed, _ := p.ListWebhooks("account-a")
+			for _, hook := range listed {
+				if hook.Secret != "" {
+					t.Errorf("Unexpected secret in listed webhook %v", hook)
+				}
+			}
+		})
+	}
+}
+
+func TestPersistenceLayer_DeleteWebhook(t *testing.T) {
+	db := newMockWebhookDatabase()
+	p := &persistenceLayer{dal: db}
+	var unknownErr ErrUnknownWebhook
+	if err := p.DeleteWebhook("account-a", "webhook-c", "user-a"); !errors.As(err, &unknownErr) {
+		t.Errorf("Expected unknown webhook error, got %v", err)
+	}
+	if err := p.DeleteWebhook("account-a", "webhook-a", "user-a"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, ok := db.webhooks["webhook-a"]; ok {
+		t.Error("Expected webhook to be deleted")
+	}
+}
+
+func TestNotifyWebhooks(t *testing.T) {
+	db := newMockWebhookDatabase()
+	if err := notifyWebhooks(db, "account-a", WebhookEventUserJoined, map[string]interface{}{"accountUserId": "user-a"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := notifyWebhooks(db, "account-a", WebhookEventQuotaExceeded, nil); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(db.deliveries) != 2 {
+		t.Fatalf("Expected account and instance wide webhook to be notified, got %v", db.deliveries)
+	}
+	for _, delivery := range db.deliveries {
+		var payload webhookPayload
+		if err := json.Unmarshal([]byte(delivery.Payload), &payload); err != nil {
+			t.Fatalf("Unexpected error decoding payload %v", err)
+		}
+		if payload.DeliveryID != delivery.DeliveryID || payload.AccountID != "account-a" || payload.Event != WebhookEventUserJoined {
+			t.Errorf("Unexpected payload %v", payload)
+		}
+	}
+}
+
+func TestPersistenceLayer_DeliverWebhooks(t *testing.T) {
+	tests := []struct {
+		name              string
+		sender            *mockWebhookSender
+		expectedDelivered int
+		expectedFailed    bool
+	}{
+		{"ok", &mockWebhookSender{status: 200}, 1, false},
+		{"temporary error", &mockWebhookSender{status: 503, err: fmt.Errorf("%w: unavailable", webhook.ErrTemporary)}, 0, false},
+		{"rejected", &mockWebhookSender{status: 410, err: fmt.Errorf("%w: gone", webhook.ErrRejected)}, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newMockWebhookDatabase()
+			db.deliveries["delivery-a"] = WebhookDelivery{DeliveryID: "delivery-a", WebhookID: "webhook-a", Payload: "{}", NextAttempt: time.Now().Add(-time.Minute)}
+			db.deliveries["delivery-b"] = WebhookDelivery{DeliveryID: "delivery-b", WebhookID: "webhook-a", NextAttempt: time.Now().Add(time.Hour)}
+			p := &persistenceLayer{dal: db}
+			delivered, err := p.DeliverWebhooks(test.sender, 8)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if delivered != test.expectedDelivered {
+				t.Errorf("Expected %d deliveries, got %d", test.expectedDelivered, delivered)
+			}
+			if len(test.sender.sent) != 1 || test.sender.sent[0].Secret != "secret-a" || test.sender.sent[0].URL != "https://a.offen.dev" {
+				t.Errorf("Unexpected deliveries %v", test.sender.sent)
+			}
+			result := db.deliveries["delivery-a"]
+			if result.Attempts != 1 || result.Failed != test.expectedFailed || result.StatusCode != test.sender.status {
+				t.Errorf("Unexpected delivery state %v", result)
+			}
+		})
+	}
+	t.Run("deleted webhook", func(t *testing.T) {
+		db := newMockWebhookDatabase()
+		db.deliveries["delivery-a"] = WebhookDelivery{DeliveryID: "delivery-a", WebhookID: "webhook-z"}
+		sender := &mockWebhookSender{}
+		p := &persistenceLayer{dal: db}
+		if _, err := p.DeliverWebhooks(sender, 8); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(sender.sent) != 0 || !db.deliveries["delivery-a"].Failed {
+			t.Errorf("Expected delivery to fail without sending, got %v", db.deliveries["delivery-a"])
+		}
+	})
+}
+
+func TestPersistenceLayer_ListWebhookDeliveries(t *testing.T) {
+	db := newMockWebhookDatabase()
+	db.deliveries["delivery-a"] = WebhookDelivery{DeliveryID: "delivery-a", WebhookID: "webhook-a", Payload: `{"event":"user.joined"}`}
+	p := &persistenceLayer{dal: db}
+	result, err := p.ListWebhookDeliveries("account-a", "webhook-a", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(result) != 1 || string(result[0].Payload) != `{"event":"user.joined"}` {
+		t.Errorf("Unexpected result %v", result)
+	}
+	var unknownErr ErrUnknownWebhook
+	if _, err := p.ListWebhookDeliveries("account-a", "webhook-b", 0); !errors.As(err, &unknownErr) {
+		t.Errorf("Expected unknown webhook error, got %v", err)
+	}
+}
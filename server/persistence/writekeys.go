@@ -0,0 +1,132 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/offen/offen/server/keys"
+)
+
+// WriteKey is a key that needs to be passed when submitting events to an
+// account. Write keys are embedded in the pages sending events, so they are
+// not considered to be secret.
+type WriteKey struct {
+	Key     string    `json:"key"`
+	Created time.Time `json:"created"`
+	// Expires is set for keys that have been replaced by rotating the key
+	// of the account. They are accepted until then, so pages embedding them
+	// can be updated without losing any events.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// WriteKeys are the write keys of an account. In case an account does not
+// define any write keys, events are accepted without passing a key.
+type WriteKeys []WriteKey
+
+// Active returns the keys that are accepted at the given time.
+func (w WriteKeys) Active(now time.Time) WriteKeys {
+	var result WriteKeys
+	for _, key := range w {
+		if key.Expires == nil || key.Expires.After(now) {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+func parseWriteKeys(s string) (WriteKeys, error) {
+	var writeKeys WriteKeys
+	if s == "" {
+		return writeKeys, nil
+	}
+	if err := json.Unmarshal([]byte(s), &writeKeys); err != nil {
+		return nil, fmt.Errorf("persistence: error parsing write keys: %w", err)
+	}
+	return writeKeys, nil
+}
+
+// RotateAccountWriteKey creates a new write key for the given account and
+// returns it. The key that has been used before stays valid for the given
+// grace period. In case the account did not use write keys before, events
+// will be rejected unless they pass the new key.
+func (p *persistenceLayer) RotateAccountWriteKey(accountID string, gracePeriod time.Duration, accountUserID string) (string, error) {
+	a, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return "", fmt.Errorf("persistence: error looking up account before rotating write key: %w", err)
+	}
+	existing, err := parseWriteKeys(a.WriteKeys)
+	if err != nil {
+		return "", err
+	}
+	value, err := keys.GenerateRandomValueWith(24, base64.RawURLEncoding)
+	if err != nil {
+		return "", fmt.Errorf("persistence: error creating write key: %w", err)
+	}
+
+	now := time.Now()
+	expires := now.Add(gracePeriod)
+	var updated WriteKeys
+	if gracePeriod > 0 {
+		for _, key := range existing.Active(now) {
+			if key.Expires == nil {
+				key.Expires = &expires
+			}
+			updated = append(updated, key)
+		}
+	}
+	updated = append(updated, WriteKey{Key: value, Created: now})
+	b, err := json.Marshal(updated)
+	if err != nil {
+		return "", fmt.Errorf("persistence: error marshaling write keys: %w", err)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return "", fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	a.WriteKeys = string(b)
+	if err := txn.UpdateAccount(&a); err != nil {
+		txn.Rollback()
+		return "", fmt.Errorf("persistence: error updating write keys of account %s: %w", accountID, err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionRotateWriteKey, gracePeriod.String()); err != nil {
+		txn.Rollback()
+		return "", fmt.Errorf("persistence: error recording write key rotation of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return "", fmt.Errorf("persistence: error committing write key rotation: %w", err)
+	}
+	return value, nil
+}
+
+// RemoveAccountWriteKeys removes all write keys of the given account, so
+// events are accepted without passing a key again.
+func (p *persistenceLayer) RemoveAccountWriteKeys(accountID, accountUserID string) error {
+	a, err := p.dal.FindAccount(FindAccountQueryActiveByID(accountID))
+	if err != nil {
+		return fmt.Errorf("persistence: error looking up account before removing write keys: %w", err)
+	}
+
+	txn, err := p.dal.Transaction()
+	if err != nil {
+		return fmt.Errorf("persistence: error creating transaction: %w", err)
+	}
+	a.WriteKeys = ""
+	if err := txn.UpdateAccount(&a); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error removing write keys of account %s: %w", accountID, err)
+	}
+	if err := writeAuditLog(txn, []string{accountID}, accountUserID, AuditActionRemoveWriteKeys, ""); err != nil {
+		txn.Rollback()
+		return fmt.Errorf("persistence: error recording write key removal of account %s: %w", accountID, err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("persistence: error committing write key removal: %w", err)
+	}
+	return nil
+}
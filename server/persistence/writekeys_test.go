@@ -0,0 +1,101 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWriteKeys_Active(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	keys := WriteKeys{
+		{Key: "expired", Expires: &past},
+		{Key: "expiring", Expires: &future},
+		{Key: "current"},
+	}
+	active := keys.Active(now)
+	if len(active) != 2 || active[0].Key != "expiring" || active[1].Key != "current" {
+		t.Errorf("Unexpected result %v", active)
+	}
+}
+
+type mockWriteKeysDatabase struct {
+	mockUpdateAccountRetentionDatabase
+	account Account
+}
+
+func (m *mockWriteKeysDatabase) FindAccount(interface{}) (Account, error) {
+	return m.account, m.findErr
+}
+
+func (m *mockWriteKeysDatabase) UpdateAccount(a *Account) error {
+	m.account = *a
+	return m.mockUpdateAccountRetentionDatabase.UpdateAccount(a)
+}
+
+func (m *mockWriteKeysDatabase) Transaction() (Transaction, error) {
+	return m, nil
+}
+
+func TestPersistenceLayer_RotateAccountWriteKey(t *testing.T) {
+	t.Run("unknown account", func(t *testing.T) {
+		db := &mockWriteKeysDatabase{}
+		db.findErr = ErrUnknownAccount("unknown")
+		p := &persistenceLayer{dal: db}
+		var unknown ErrUnknownAccount
+		if _, err := p.RotateAccountWriteKey("account-a", time.Hour, "user-a"); !errors.As(err, &unknown) {
+			t.Errorf("Expected unknown account error, got %v", err)
+		}
+	})
+	t.Run("rotation", func(t *testing.T) {
+		db := &mockWriteKeysDatabase{account: Account{AccountID: "account-a"}}
+		p := &persistenceLayer{dal: db}
+
+		first, err := p.RotateAccountWriteKey("account-a", time.Hour, "user-a")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		second, err := p.RotateAccountWriteKey("account-a", time.Hour, "user-a")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if first == "" || first == second {
+			t.Errorf("Unexpected keys %v and %v", first, second)
+		}
+		writeKeys, _ := parseWriteKeys(db.account.WriteKeys)
+		if len(writeKeys) != 2 || writeKeys[0].Key != first || writeKeys[0].Expires == nil ||
+			writeKeys[1].Key != second || writeKeys[1].Expires != nil {
+			t.Errorf("Unexpected write keys %v", writeKeys)
+		}
+		if len(db.auditLog) != 2 || db.auditLog[0].Action != AuditActionRotateWriteKey {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+
+		third, err := p.RotateAccountWriteKey("account-a", 0, "user-a")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		writeKeys, _ = parseWriteKeys(db.account.WriteKeys)
+		if len(writeKeys) != 1 || writeKeys[0].Key != third {
+			t.Errorf("Expected previous keys to be dropped without grace period, got %v", writeKeys)
+		}
+	})
+}
+
+func TestPersistenceLayer_RemoveAccountWriteKeys(t *testing.T) {
+	db := &mockWriteKeysDatabase{account: Account{AccountID: "account-a", WriteKeys: `[{"key":"abc"}]`}}
+	p := &persistenceLayer{dal: db}
+	if err := p.RemoveAccountWriteKeys("account-a", "user-a"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if db.account.WriteKeys != "" {
+		t.Errorf("Unexpected write keys %v", db.account.WriteKeys)
+	}
+	if len(db.auditLog) != 1 || db.auditLog[0].Action != AuditActionRemoveWriteKeys {
+		t.Errorf("Unexpected audit log %v", db.auditLog)
+	}
+}
@@ -4,15 +4,23 @@
 package public
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
 	"embed"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
+	"regexp"
+	"strings"
+	"sync"
 )
 
 // FS provides static assets for the server to serve
@@ -24,9 +32,80 @@ const defaultLocale = "en"
 // LocalizedFS is responsible for looking up the assets in a multi-language directory
 // tree that match the configured locale. It implements http.Filesystem
 type LocalizedFS struct {
-	locale string
-	root   http.FileSystem
-	prefix string
+	locale       string
+	root         http.FileSystem
+	prefix       string
+	fallback     *LocalizedFS
+	integrity    sync.Map
+	fingerprints sync.Map
+}
+
+// ScriptAssets are the scripts that are served alongside Subresource
+// Integrity hashes.
+var ScriptAssets = []string{
+	"/script.js",
+	"/vault/vendor.js",
+	"/vault/index.js",
+	"/auditorium/vendor.js",
+	"/auditorium/index.js",
+}
+
+// FingerprintedAssets are the assets referenced by the HTML templates that
+// are served using names containing a hash of their content, so clients can
+// cache them indefinitely.
+var FingerprintedAssets = []string{
+	"/fonts.css",
+	"/intro.css",
+	"/tachyons.min.css",
+	"/offen-icon-black.svg",
+}
+
+// fingerprintRe matches locations that contain a hash of the asset's content
+// in the format `<name>-<hash>.<extension>`.
+var fingerprintRe = regexp.MustCompile(`^(.+)-([0-9a-f]{10})(\.[^./]+)$`)
+
+// AssetIntegrity contains the Subresource Integrity hash of an asset that
+// is served at Path. For revisioned assets, Path differs from Asset.
+type AssetIntegrity struct {
+	Asset     string `json:"asset"`
+	Path      string `json:"path"`
+	Integrity string `json:"integrity"`
+}
+
+// Integrity returns the Subresource Integrity hashes of the given assets,
+// skipping assets that cannot be found. As assets never change while the
+// application is running, hashes are computed once and cached afterwards.
+func (l *LocalizedFS) Integrity(locations ...string) []AssetIntegrity {
+	result := []AssetIntegrity{}
+	for _, location := range locations {
+		if value, ok := l.integrityOf(location); ok {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func (l *LocalizedFS) integrityOf(location string) (AssetIntegrity, bool) {
+	if cached, ok := l.integrity.Load(location); ok {
+		return cached.(AssetIntegrity), true
+	}
+	revisioned := l.rev(location)
+	f, err := l.Open(revisioned)
+	if err != nil {
+		return AssetIntegrity{}, false
+	}
+	defer f.Close()
+	h := sha512.New384()
+	if _, err := io.Copy(h, f); err != nil {
+		return AssetIntegrity{}, false
+	}
+	value := AssetIntegrity{
+		Asset:     location,
+		Path:      revisioned,
+		Integrity: "sha384-" + base64.StdEncoding.EncodeToString(h.Sum(nil)),
+	}
+	l.integrity.Store(location, value)
+	return value, true
 }
 
 // rev is a function that can be used to look up revisioned assets
@@ -34,20 +113,104 @@ type LocalizedFS struct {
 // revisioned asset can be found the original asset name is returned.
 func (l *LocalizedFS) rev(location string) string {
 	dir := path.Dir(location)
-	manifestFile, manifestErr := l.Open(path.Join(dir, "rev-manifest.json"))
-	if manifestErr != nil {
-		return location
+	if match, ok := l.revManifest(dir)[path.Base(location)]; ok {
+		return path.Join(dir, match)
 	}
+	return location
+}
 
+// revManifest returns the revisioned names of the assets in the given
+// directory as created when building the assets.
+func (l *LocalizedFS) revManifest(dir string) map[string]string {
 	revs := map[string]string{}
+	manifestFile, manifestErr := l.Open(path.Join(dir, "rev-manifest.json"))
+	if manifestErr != nil {
+		return revs
+	}
+	defer manifestFile.Close()
 	json.NewDecoder(manifestFile).Decode(&revs)
-	if match, ok := revs[path.Base(location)]; ok {
-		return path.Join(dir, match)
+	return revs
+}
+
+// Manifest returns the locations the given assets are served at. Assets that
+// have been revisioned when being built keep their revisioned name, all
+// other assets are fingerprinted using a hash of their content. It is
+// expected to be called on startup, so that missing assets are detected
+// early and hashes do not need to be computed when handling requests.
+func (l *LocalizedFS) Manifest(locations ...string) (map[string]string, error) {
+	result := map[string]string{}
+	for _, location := range locations {
+		value, err := l.fingerprintOf(location)
+		if err != nil {
+			return nil, fmt.Errorf("public: error fingerprinting %s: %w", location, err)
+		}
+		result[location] = value
+	}
+	return result, nil
+}
+
+// fingerprint returns the location the given asset is served at, using the
+// original location in case the asset cannot be read.
+func (l *LocalizedFS) fingerprint(location string) string {
+	if value, err := l.fingerprintOf(location); err == nil {
+		return value
 	}
 	return location
 }
 
-// Open looks up the requested file by location.
+func (l *LocalizedFS) fingerprintOf(location string) (string, error) {
+	if revisioned := l.rev(location); revisioned != location {
+		return revisioned, nil
+	}
+	if cached, ok := l.fingerprints.Load(location); ok {
+		return cached.(string), nil
+	}
+	f, err := l.Open(location)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	ext := path.Ext(location)
+	value := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(location, ext), hex.EncodeToString(h.Sum(nil))[:10], ext)
+	l.fingerprints.Store(location, value)
+	return value, nil
+}
+
+// unfingerprint returns the original location of a fingerprinted asset. The
+// hash in the given location has to match the current content of the asset.
+func (l *LocalizedFS) unfingerprint(location string) (string, bool) {
+	match := fingerprintRe.FindStringSubmatch(location)
+	if match == nil {
+		return "", false
+	}
+	original := match[1] + match[3]
+	if value, err := l.fingerprintOf(original); err != nil || value != location {
+		return "", false
+	}
+	return original, true
+}
+
+// Fingerprinted returns true if the given location refers to an asset whose
+// name is derived from its content, meaning its content will never change.
+func (l *LocalizedFS) Fingerprinted(location string) bool {
+	if _, ok := l.unfingerprint(location); ok {
+		return true
+	}
+	dir := path.Dir(location)
+	for _, match := range l.revManifest(dir) {
+		if path.Join(dir, match) == location {
+			return true
+		}
+	}
+	return false
+}
+
+// Open looks up the requested file by location. Fingerprinted locations
+// open the original asset.
 func (l *LocalizedFS) Open(file string) (http.File, error) {
 	cascade := []string{
 		fmt.Sprintf("%s/%s%s", l.prefix, l.locale, file),
@@ -62,9 +225,25 @@ func (l *LocalizedFS) Open(file string) (http.File, error) {
 			return neuteredReaddirFile{f}, nil
 		}
 	}
+	if original, ok := l.unfingerprint(file); ok {
+		return l.Open(original)
+	}
+	if l.fallback != nil {
+		return l.fallback.Open(file)
+	}
 	return nil, err
 }
 
+// openUnlocalized looks up the requested file by location without
+// considering the locale.
+func (l *LocalizedFS) openUnlocalized(file string) (http.File, error) {
+	f, err := l.root.Open(fmt.Sprintf("%s%s", l.prefix, file))
+	if err != nil && l.fallback != nil {
+		return l.fallback.openUnlocalized(file)
+	}
+	return f, err
+}
+
 // NewLocalizedFS returns a http.FileSystem that is locale aware. It will first
 // try to return the file in the given locale. In case this is not found, it tries
 // returning the asset in the default language, falling back to the root fs if
@@ -77,37 +256,63 @@ func NewLocalizedFS(locale string) *LocalizedFS {
 	}
 }
 
+// NewRemoteLocalizedFS returns a locale aware http.FileSystem like
+// NewLocalizedFS that looks up assets in the given remote file system first.
+// Remote assets are expected to use the layout of the embedded static
+// directory. Assets that cannot be found remotely are served from the
+// embedded file system.
+func NewRemoteLocalizedFS(locale string, remote http.FileSystem) *LocalizedFS {
+	return &LocalizedFS{
+		locale:   locale,
+		root:     remote,
+		fallback: NewLocalizedFS(locale),
+	}
+}
+
 // HTMLTemplate creates a template object containing all of the HTML templates in the
-// public file system
-func (l *LocalizedFS) HTMLTemplate(gettext func(string, ...interface{}) template.HTML) (*template.Template, error) {
+// public file system. Strings are translated using gettext, or ngettext in
+// case they depend on a count.
+func (l *LocalizedFS) HTMLTemplate(
+	gettext func(string, ...interface{}) template.HTML,
+	ngettext func(string, string, int, ...interface{}) template.HTML,
+) (*template.Template, error) {
 	return l.getTemplate(
 		"html_template",
 		[]string{"/index.go.html"},
 		template.FuncMap{
-			"__": gettext,
+			"__":  gettext,
+			"__n": ngettext,
 		},
 	)
 }
 
 // EmailTemplate creates a template object containing all of the email templates in the
-// public file system
-func (l *LocalizedFS) EmailTemplate(gettext func(string, ...interface{}) template.HTML) (*template.Template, error) {
+// public file system. Strings are translated the same way HTMLTemplate does.
+func (l *LocalizedFS) EmailTemplate(
+	gettext func(string, ...interface{}) template.HTML,
+	ngettext func(string, string, int, ...interface{}) template.HTML,
+) (*template.Template, error) {
 	return l.getTemplate(
 		"email_template",
 		[]string{"/emails.go.html"},
 		template.FuncMap{
-			"__": gettext,
+			"__":  gettext,
+			"__n": ngettext,
 		},
 	)
 }
 
 func (l *LocalizedFS) getTemplate(name string, templateFiles []string, funcMap template.FuncMap) (*template.Template, error) {
 	t := template.New(name)
-	funcMap["rev"] = l.rev
+	funcMap["rev"] = l.fingerprint
+	funcMap["integrity"] = func(location string) string {
+		value, _ := l.integrityOf(location)
+		return value.Integrity
+	}
 	t.Funcs(funcMap)
 
 	for _, file := range templateFiles {
-		f, err := l.root.Open(fmt.Sprintf("%s%s", l.prefix, file))
+		f, err := l.openUnlocalized(file)
 		if err != nil {
 			return nil, fmt.Errorf("public: error finding file %s: %w", file, err)
 		}
@@ -130,3 +335,12 @@ type neuteredReaddirFile struct {
 func (f neuteredReaddirFile) Readdir(count int) ([]os.FileInfo, error) {
 	return nil, errors.New("forcefully skipping directory listings")
 }
+
+// ETag passes through the ETag of files that have been fetched from a
+// remote origin. It is empty for all other files.
+func (f neuteredReaddirFile) ETag() string {
+	if e, ok := f.File.(interface{ ETag() string }); ok {
+		return e.ETag()
+	}
+	return ""
+}
@@ -10,6 +10,8 @@ import (
 	"html/template"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -118,6 +120,51 @@ func TestLocalizedFS_rev(t *testing.T) {
 	}
 }
 
+func TestLocalizedFS_Manifest(t *testing.T) {
+	l := &LocalizedFS{
+		locale: "fr",
+		root:   http.FS(testFS),
+		prefix: "/testdata",
+	}
+	manifest, err := l.Manifest("/thing.txt", "/truc.txt")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if manifest["/truc.txt"] != "/truc-abc123.txt" {
+		t.Errorf("Unexpected revisioned asset %v", manifest["/truc.txt"])
+	}
+	fingerprinted := manifest["/thing.txt"]
+	if !fingerprintRe.MatchString(fingerprinted) || !strings.HasPrefix(fingerprinted, "/thing-") {
+		t.Fatalf("Unexpected fingerprinted asset %v", fingerprinted)
+	}
+
+	f, err := l.Open(fingerprinted)
+	if err != nil {
+		t.Fatalf("Unexpected error opening fingerprinted asset %v", err)
+	}
+	if b, _ := ioutil.ReadAll(f); !strings.Contains(string(b), "XYZ") {
+		t.Errorf("Unexpected content %v", string(b))
+	}
+	if _, err := l.Open("/thing-0123456789.txt"); err == nil {
+		t.Error("Expected error opening asset with mismatching hash")
+	}
+
+	for location, expected := range map[string]bool{
+		fingerprinted:           true,
+		"/truc-abc123.txt":      true,
+		"/thing.txt":            false,
+		"/thing-0123456789.txt": false,
+	} {
+		if result := l.Fingerprinted(location); result != expected {
+			t.Errorf("Expected %v for %s, got %v", expected, location, result)
+		}
+	}
+
+	if _, err := l.Manifest("/doesnotexist.css"); err == nil {
+		t.Error("Expected error for unknown asset")
+	}
+}
+
 func TestLocalizedFS_getTemplate(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		l := &LocalizedFS{
@@ -159,3 +206,56 @@ func TestLocalizedFS_getTemplate(t *testing.T) {
 		}
 	})
 }
+
+func TestLocalizedFS_Integrity(t *testing.T) {
+	l := &LocalizedFS{
+		locale: "fr",
+		root:   http.FS(testFS),
+		prefix: "/testdata",
+	}
+	result := l.Integrity("/truc.txt", "/doesnotexist.js")
+	if len(result) != 1 {
+		t.Fatalf("Unexpected result %v", result)
+	}
+	if result[0].Asset != "/truc.txt" || result[0].Path != "/truc-abc123.txt" {
+		t.Errorf("Unexpected asset %v", result[0])
+	}
+	if !strings.HasPrefix(result[0].Integrity, "sha384-") || len(result[0].Integrity) != len("sha384-")+64 {
+		t.Errorf("Unexpected integrity %v", result[0].Integrity)
+	}
+	if again := l.Integrity("/truc.txt"); again[0] != result[0] {
+		t.Errorf("Expected cached value, got %v", again)
+	}
+}
+
+func TestLocalizedFS_fallback(t *testing.T) {
+	remote := t.TempDir()
+	if err := os.WriteFile(filepath.Join(remote, "file.txt"), []byte("Remote"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	l := &LocalizedFS{
+		locale: "fr",
+		root:   http.Dir(remote),
+		fallback: &LocalizedFS{
+			locale: "fr",
+			root:   http.FS(testFS),
+			prefix: "/testdata",
+		},
+	}
+	for location, expected := range map[string]string{
+		"/file.txt":  "Remote",
+		"/thing.txt": "XYZ",
+	} {
+		f, err := l.Open(location)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		s, _ := ioutil.ReadAll(f)
+		if !strings.Contains(string(s), expected) {
+			t.Errorf("Expected '%v', got content '%v'", expected, string(s))
+		}
+	}
+	if _, err := l.Open("/doesnotexist.txt"); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// NewMemoryBackend creates a Backend that keeps requests in memory. Keys
+// without any requests in their window are removed in the given interval.
+func NewMemoryBackend(cleanupInterval time.Duration) Backend {
+	return &memoryBackend{
+		windows:         map[string]*memoryWindow{},
+		cleanupInterval: cleanupInterval,
+		lastCleanup:     time.Now(),
+	}
+}
+
+type memoryWindow struct {
+	hits   []time.Time
+	window time.Duration
+}
+
+// prune removes all hits that are outside of the window ending at now.
+func (w *memoryWindow) prune(now time.Time) {
+	cutoff := now.Add(-w.window)
+	i := 0
+	for i < len(w.hits) && !w.hits[i].After(cutoff) {
+		i++
+	}
+	w.hits = w.hits[i:]
+}
+
+type memoryBackend struct {
+	mu              sync.Mutex
+	windows         map[string]*memoryWindow
+	cleanupInterval time.Duration
+	lastCleanup     time.Time
+}
+
+func (m *memoryBackend) Take(key string, limit int, window time.Duration) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastCleanup) > m.cleanupInterval {
+		m.cleanup(now)
+	}
+
+	w, ok := m.windows[key]
+	if !ok {
+		w = &memoryWindow{}
+		m.windows[key] = w
+	}
+	w.window = window
+	w.prune(now)
+	if len(w.hits) < limit {
+		w.hits = append(w.hits, now)
+		return 0, nil
+	}
+	return w.hits[len(w.hits)-limit].Add(window).Sub(now), nil
+}
+
+func (m *memoryBackend) cleanup(now time.Time) {
+	for key, w := range m.windows {
+		w.prune(now)
+		if len(w.hits) == 0 {
+			delete(m.windows, key)
+		}
+	}
+	m.lastCleanup = now
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryBackend(t *testing.T) {
+	b := NewMemoryBackend(time.Minute)
+	for i := 0; i < 2; i++ {
+		if wait, err := b.Take("key", 2, time.Second); err != nil || wait != 0 {
+			t.Errorf("Unexpected result %v, %v", wait, err)
+		}
+	}
+	wait, err := b.Take("key", 2, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("Unexpected wait %v", wait)
+	}
+	if wait, _ := b.Take("other", 2, time.Second); wait != 0 {
+		t.Errorf("Expected other key to be unaffected, got %v", wait)
+	}
+
+	t.Run("sliding", func(t *testing.T) {
+		b := NewMemoryBackend(time.Minute)
+		b.Take("key", 2, time.Millisecond*40)
+		time.Sleep(time.Millisecond * 25)
+		b.Take("key", 2, time.Millisecond*40)
+		time.Sleep(time.Millisecond * 25)
+		// the first request has left the window, the second one has not
+		if wait, _ := b.Take("key", 2, time.Millisecond*40); wait != 0 {
+			t.Errorf("Expected request to be accepted, got %v", wait)
+		}
+		if wait, _ := b.Take("key", 2, time.Millisecond*40); wait == 0 {
+			t.Error("Expected request to be rejected")
+		}
+	})
+
+	t.Run("cleanup", func(t *testing.T) {
+		b := NewMemoryBackend(time.Millisecond).(*memoryBackend)
+		b.Take("key", 1, time.Millisecond)
+		time.Sleep(time.Millisecond * 5)
+		b.Take("other", 1, time.Minute)
+		if _, ok := b.windows["key"]; ok {
+			t.Error("Expected stale key to be removed")
+		}
+	})
+}
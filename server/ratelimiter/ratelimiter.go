@@ -12,29 +12,51 @@ import (
 )
 
 var (
-	errInvalidCache        = errors.New("ratelimiter: invalid value in cache")
 	errWouldExceedDeadline = errors.New("ratelimiter: applicable rate limit would exceed give deadline")
+	errBackendUnavailable  = errors.New("ratelimiter: backend is unavailable")
 )
 
-// GetSetter needs to be implemented by any cache that is
-// to be used for storing limits
-type GetSetter interface {
-	Get(key string) (interface{}, bool)
-	Set(key string, value interface{}, expiry time.Duration)
+// Backend records requests in a sliding window. Implementations are expected
+// to check and record requests atomically, so that multiple instances using
+// the same backend apply consistent limits.
+type Backend interface {
+	// Take records a request for the given key in case less than limit
+	// requests have been recorded for the key within the preceding window.
+	// In case the request is rejected, the duration after which a request
+	// would be accepted again is returned. Accepted requests return zero.
+	Take(key string, limit int, window time.Duration) (time.Duration, error)
+}
+
+// Availability can be implemented by backends that might become unavailable,
+// e.g. when shared between multiple instances over the network.
+type Availability interface {
+	Available() bool
+}
+
+// Limit allows the given number of requests within a sliding window.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Every returns a Limit that allows a single request in the given interval.
+func Every(interval time.Duration) Limit {
+	return Limit{Requests: 1, Window: interval}
 }
 
 // Throttler needs to be implemented by any rate limiter
 type Throttler interface {
+	Throttle(limit Limit, identifier string) <-chan Result
 	LinearThrottle(threshold time.Duration, identifier string) <-chan Result
-	ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result
 }
 
 // Limiter can be used to rate limit operations
-// based on an identifier and a threshold value
+// based on an identifier and a limit
 type Limiter struct {
-	timeout time.Duration
-	cache   GetSetter
-	salt    []byte
+	timeout    time.Duration
+	backend    Backend
+	salt       []byte
+	failClosed bool
 }
 
 // Result describes the outcome of a `Throttle` call
@@ -45,97 +67,99 @@ type Result struct {
 
 func (l *Limiter) hash(s string) string {
 	joined := append([]byte(s), l.salt...)
-	return fmt.Sprintf("%x", sha256.Sum256(joined))
-}
-
-type cacheItem struct {
-	blockUntil time.Time
-	queueLen   int64
+	return fmt.Sprintf("ratelimit-%x", sha256.Sum256(joined))
 }
 
-// LinearThrottle returns a channel that blocks until the configured
-// rate limit has been satisfied. The channel will send a `Result` exactly
-// once before closing, containing information on the
-// applied rate limiting or possible errors that occured
-func (l *Limiter) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
-	return l.throttle(threshold, identifier, false)
-}
-
-// ExponentialThrottle throttles using exponentially increasing thresholds
-func (l *Limiter) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
-	return l.throttle(threshold, identifier, true)
-}
-
-func (l *Limiter) throttle(threshold time.Duration, identifier string, exponential bool) <-chan Result {
+// Throttle returns a channel that blocks until the given limit has been
+// satisfied. The channel will send a `Result` exactly once before closing,
+// containing information on the applied rate limiting or possible errors
+// that occured. A zero limit does not apply any rate limiting.
+func (l *Limiter) Throttle(limit Limit, identifier string) <-chan Result {
 	hashedIdentifier := l.hash(identifier)
 
 	out := make(chan Result)
 	go func() {
-		if value, found := l.cache.Get(hashedIdentifier); found {
-			if item, ok := value.(cacheItem); ok {
-				remaining := time.Until(item.blockUntil)
-				if remaining > l.timeout {
-					out <- Result{Error: errWouldExceedDeadline}
-					return
-				}
-
-				factor := time.Duration(1)
-				if exponential {
-					factor = time.Duration(item.queueLen)
-				}
-
-				l.cache.Set(
-					hashedIdentifier,
-					cacheItem{
-						blockUntil: item.blockUntil.Add(
-							threshold * factor,
-						),
-						queueLen: item.queueLen + 1,
-					},
-					remaining,
-				)
-				time.Sleep(remaining)
-				out <- Result{Delay: remaining}
-			} else {
-				out <- Result{Error: errInvalidCache}
-			}
-		} else {
-			l.cache.Set(hashedIdentifier, cacheItem{
-				blockUntil: time.Now().Add(threshold),
-				queueLen:   1,
-			}, threshold)
+		defer close(out)
+		if limit.Requests <= 0 || limit.Window <= 0 {
 			out <- Result{}
+			return
+		}
+		if l.failClosed {
+			if a, ok := l.backend.(Availability); ok && !a.Available() {
+				out <- Result{Error: errBackendUnavailable}
+				return
+			}
+		}
+
+		// other callers might take a free slot while waiting, so the request
+		// is recorded again after each wait
+		deadline := time.Now().Add(l.timeout)
+		var delay time.Duration
+		for {
+			wait, err := l.backend.Take(hashedIdentifier, limit.Requests, limit.Window)
+			if err != nil {
+				out <- Result{Error: fmt.Errorf("ratelimiter: error recording request: %w", err)}
+				return
+			}
+			if wait <= 0 {
+				out <- Result{Delay: delay}
+				return
+			}
+			if time.Now().Add(wait).After(deadline) {
+				out <- Result{Error: errWouldExceedDeadline}
+				return
+			}
+			time.Sleep(wait)
+			delay += wait
 		}
-		close(out)
 	}()
 	return out
 }
 
-// New creates a new Throttler using Limiter. `threshold` defines the
-// enforced minimum distance between two calls of the
-// instance's `Throttle` method using the same identifier
-func New(timeout time.Duration, cache GetSetter) Throttler {
+// LinearThrottle throttles calls using the same identifier so that they are
+// at least the given threshold apart.
+func (l *Limiter) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+	return l.Throttle(Every(threshold), identifier)
+}
+
+// New creates a new Throttler using Limiter. Calls that would need to wait
+// longer than `timeout` for satisfying a limit fail immediately.
+func New(timeout time.Duration, backend Backend) Throttler {
 	salt, err := randomBytes(16)
 	if err != nil {
 		panic("cannot initialize rate limiter")
 	}
 	return &Limiter{
-		cache:   cache,
+		backend: backend,
 		timeout: timeout,
 		salt:    salt,
 	}
 }
 
+// NewShared creates a new Throttler for a backend that is shared between
+// multiple instances. All instances are expected to pass the same salt so
+// they agree on the keys being used. In case failClosed is true and the
+// backend implements Availability, calls are rejected while the backend is
+// unavailable. Otherwise the backend is expected to degrade to local behavior.
+func NewShared(timeout time.Duration, backend Backend, salt []byte, failClosed bool) Throttler {
+	return &Limiter{
+		backend:    backend,
+		timeout:    timeout,
+		salt:       salt,
+		failClosed: failClosed,
+	}
+}
+
 // NoopRatelimiter implements Throttler without ever blocking
 type NoopRatelimiter struct{}
 
-// LinearThrottle immediately returns an empty result
-func (l *NoopRatelimiter) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
+// Throttle immediately returns an empty result
+func (l *NoopRatelimiter) Throttle(limit Limit, identifier string) <-chan Result {
 	return l.pass()
 }
 
-// ExponentialThrottle immediately returns an empty result
-func (l *NoopRatelimiter) ExponentialThrottle(threshold time.Duration, identifier string) <-chan Result {
+// LinearThrottle immediately returns an empty result
+func (l *NoopRatelimiter) LinearThrottle(threshold time.Duration, identifier string) <-chan Result {
 	return l.pass()
 }
 
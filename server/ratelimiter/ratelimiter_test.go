@@ -5,42 +5,21 @@ package ratelimiter
 
 import (
 	"fmt"
-	"sync"
 	"testing"
 	"time"
 )
 
-type mockGetSetter struct {
-	values map[string]value
-	lock   sync.Mutex
+type mockBackend struct {
+	Backend
+	unavailable bool
 }
 
-type value struct {
-	value  interface{}
-	expiry time.Time
+func (m *mockBackend) Available() bool {
+	return !m.unavailable
 }
 
-func (m *mockGetSetter) Get(key string) (interface{}, bool) {
-	m.lock.Lock()
-	defer m.lock.Unlock()
-	v, ok := m.values[key]
-	if !ok {
-		return nil, false
-	}
-	if time.Now().After(v.expiry) {
-		delete(m.values, key)
-		return nil, false
-	}
-	return v.value, true
-}
-
-func (m *mockGetSetter) Set(key string, v interface{}, expiry time.Duration) {
-	m.lock.Lock()
-	defer m.lock.Unlock()
-	if m.values == nil {
-		m.values = map[string]value{}
-	}
-	m.values[key] = value{v, time.Now().Add(expiry)}
+func newMockBackend(unavailable bool) *mockBackend {
+	return &mockBackend{NewMemoryBackend(time.Minute), unavailable}
 }
 
 func TestLinearThrottle(t *testing.T) {
@@ -65,7 +44,7 @@ func TestLinearThrottle(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			limiter := New(time.Hour, &mockGetSetter{})
+			limiter := New(time.Hour, newMockBackend(false))
 			<-limiter.LinearThrottle(test.threshold, test.name)
 			time.Sleep(test.sleep)
 			result := <-limiter.LinearThrottle(test.threshold, test.name)
@@ -76,8 +55,62 @@ func TestLinearThrottle(t *testing.T) {
 	}
 }
 
+func TestNewShared(t *testing.T) {
+	t.Run("shared salt", func(t *testing.T) {
+		backend := newMockBackend(false)
+		a := NewShared(time.Hour, backend, []byte("salt"), false)
+		b := NewShared(time.Hour, backend, []byte("salt"), false)
+		<-a.LinearThrottle(time.Millisecond*50, "identifier")
+		if result := <-b.LinearThrottle(time.Millisecond*50, "identifier"); result.Delay == 0 {
+			t.Error("Expected limiters sharing a backend to apply the same limits")
+		}
+	})
+	t.Run("fail open", func(t *testing.T) {
+		limiter := NewShared(time.Hour, newMockBackend(true), []byte("salt"), false)
+		if result := <-limiter.LinearThrottle(time.Second, "identifier"); result.Error != nil {
+			t.Errorf("Unexpected error %v", result.Error)
+		}
+	})
+	t.Run("fail closed", func(t *testing.T) {
+		limiter := NewShared(time.Hour, newMockBackend(true), []byte("salt"), true)
+		if result := <-limiter.LinearThrottle(time.Second, "identifier"); result.Error != errBackendUnavailable {
+			t.Errorf("Expected unavailable error, got %v", result.Error)
+		}
+	})
+}
+
+func TestThrottle(t *testing.T) {
+	t.Run("zero limit", func(t *testing.T) {
+		limiter := New(time.Hour, newMockBackend(false))
+		for i := 0; i < 3; i++ {
+			if result := <-limiter.Throttle(Limit{}, "identifier"); result.Error != nil || result.Delay != 0 {
+				t.Errorf("Unexpected result %v", result)
+			}
+		}
+	})
+	t.Run("burst", func(t *testing.T) {
+		limiter := New(time.Hour, newMockBackend(false))
+		limit := Limit{Requests: 3, Window: time.Millisecond * 50}
+		for i := 0; i < 3; i++ {
+			if result := <-limiter.Throttle(limit, "identifier"); result.Delay != 0 {
+				t.Errorf("Unexpected delay %v for request %d", result.Delay, i)
+			}
+		}
+		if result := <-limiter.Throttle(limit, "identifier"); result.Delay == 0 {
+			t.Error("Expected request exceeding limit to be delayed")
+		}
+	})
+	t.Run("exceed deadline", func(t *testing.T) {
+		limiter := New(time.Millisecond, newMockBackend(false))
+		<-limiter.Throttle(Every(time.Hour), "identifier")
+		if result := <-limiter.Throttle(Every(time.Hour), "identifier"); result.Error != errWouldExceedDeadline {
+			t.Errorf("Expected deadline error, got %v", result.Error)
+		}
+	})
+}
+
 func ExampleNew() {
-	limiter := New(time.Hour, &mockGetSetter{})
+	limiter := New(time.Hour, newMockBackend(false))
 
 	r1 := <-limiter.LinearThrottle(time.Second*2, "example")
 	fmt.Println(r1.Delay > 0)
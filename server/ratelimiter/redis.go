@@ -0,0 +1,103 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/offen/offen/server/redis"
+)
+
+// takeScript implements a sliding window log using a sorted set per key.
+// Scores are timestamps in milliseconds. It returns 0 in case the request
+// has been recorded, or the number of milliseconds until the oldest request
+// leaves the window otherwise.
+const takeScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local limit = tonumber(ARGV[3])
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return 0
+end
+local oldest = redis.call('ZRANGE', KEYS[1], count - limit, count - limit, 'WITHSCORES')
+return math.max(1, tonumber(oldest[2]) + window - now)
+`
+
+// retryAfter is the time Redis is not being used after an error occurred, so
+// an outage does not add latency to every single request.
+const retryAfter = time.Second * 5
+
+// NewRedisBackend creates a Backend that records requests in Redis using the
+// given prefix for all keys, so that all instances using the same Redis
+// server apply the same limits. In case Redis cannot be reached, requests are
+// recorded using the given fallback until Redis becomes available again.
+// Errors are passed to onError, which may be nil.
+func NewRedisBackend(client *redis.Client, prefix string, fallback Backend, onError func(error)) Backend {
+	return &redisBackend{
+		client:   client,
+		prefix:   prefix,
+		fallback: fallback,
+		onError:  onError,
+	}
+}
+
+type redisBackend struct {
+	client      *redis.Client
+	prefix      string
+	fallback    Backend
+	onError     func(error)
+	unavailable atomic.Int64
+}
+
+func (r *redisBackend) Available() bool {
+	return time.Now().UnixNano() >= r.unavailable.Load()
+}
+
+func (r *redisBackend) fail(err error) {
+	r.unavailable.Store(time.Now().Add(retryAfter).UnixNano())
+	if r.onError != nil {
+		r.onError(err)
+	}
+}
+
+func (r *redisBackend) Take(key string, limit int, window time.Duration) (time.Duration, error) {
+	if !r.Available() {
+		return r.fallback.Take(key, limit, window)
+	}
+
+	// members of the sorted set need to be unique, even if multiple requests
+	// are recorded in the same millisecond
+	nonce, err := randomBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	ms := window.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	reply, err := r.client.Do(
+		"EVAL", takeScript, "1", r.prefix+key,
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.FormatInt(ms, 10),
+		strconv.Itoa(limit),
+		fmt.Sprintf("%d-%x", now.UnixNano(), nonce),
+	)
+	if err != nil {
+		r.fail(fmt.Errorf("ratelimiter: error recording request in redis: %w", err))
+		return r.fallback.Take(key, limit, window)
+	}
+	wait, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("ratelimiter: unexpected reply type %T", reply)
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimiter
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/redis"
+)
+
+func TestRedisBackend_Unavailable(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	client, _ := redis.New("redis://" + addr)
+	var errs []error
+	b := NewRedisBackend(client, "offen-", NewMemoryBackend(time.Minute), func(err error) {
+		errs = append(errs, err)
+	})
+	if !b.(Availability).Available() {
+		t.Error("Expected backend to be available before first use")
+	}
+	if wait, err := b.Take("key", 1, time.Minute); err != nil || wait != 0 {
+		t.Errorf("Expected request to be recorded in fallback, got %v, %v", wait, err)
+	}
+	if b.(Availability).Available() {
+		t.Error("Expected backend to be unavailable after error")
+	}
+	if wait, _ := b.Take("key", 1, time.Minute); wait == 0 {
+		t.Error("Expected fallback to apply limit")
+	}
+	if len(errs) != 1 {
+		t.Errorf("Expected a single error while backing off, got %v", errs)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package redis is a minimal client for Redis speaking the RESP protocol. It
+// supports the small set of commands Offen needs for sharing state between
+// multiple instances.
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNil is returned when Redis responds with a nil value.
+var ErrNil = errors.New("redis: nil")
+
+// Error is an error returned by the Redis server.
+type Error string
+
+func (e Error) Error() string {
+	return fmt.Sprintf("redis: %s", string(e))
+}
+
+// Client sends commands to a single Redis server. Commands are sent over a
+// single connection that is reestablished after failures.
+type Client struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+// New creates a Client for the given URL of the form
+// redis://[:password@]host[:port][/db]
+func New(redisURL string) (*Client, error) {
+	u, err := url.Parse(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("redis: error parsing url: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("redis: unsupported scheme %s", u.Scheme)
+	}
+	c := &Client{
+		addr:    u.Host,
+		timeout: time.Second,
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		c.db, err = strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid database %s: %w", db, err)
+		}
+	}
+	return c, nil
+}
+
+// Do sends the given command and returns the server's reply. Replies are
+// either string, int64, []interface{} or nil.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+	result, err := c.do(args...)
+	if err != nil {
+		var redisErr Error
+		if !errors.As(err, &redisErr) {
+			// the connection is in an unknown state, so it is discarded
+			c.conn.Close()
+			c.conn = nil
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) connect() error {
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return fmt.Errorf("redis: error connecting to %s: %w", c.addr, err)
+	}
+	c.conn = conn
+	c.rw = bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	if c.password != "" {
+		if _, err := c.do("AUTH", c.password); err != nil {
+			c.conn.Close()
+			c.conn = nil
+			return fmt.Errorf("redis: error authenticating: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(c.db)); err != nil {
+			c.conn.Close()
+			c.conn = nil
+			return fmt.Errorf("redis: error selecting database: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) do(args ...string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	fmt.Fprintf(c.rw, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.rw, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.rw.Flush(); err != nil {
+		return nil, fmt.Errorf("redis: error writing command: %w", err)
+	}
+	return readReply(c.rw.Reader)
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: error reading reply: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("redis: received empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: error parsing integer reply: %w", err)
+		}
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: error parsing bulk length: %w", err)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("redis: error reading bulk reply: %w", err)
+		}
+		return string(buf[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: error parsing array length: %w", err)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		result := make([]interface{}, size)
+		for i := range result {
+			if result[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// Get returns the value stored for the given key. In case the key does not
+// exist, ErrNil is returned.
+func (c *Client) Get(key string) (string, error) {
+	reply, err := c.Do("GET", key)
+	if err != nil {
+		return "", err
+	}
+	if reply == nil {
+		return "", ErrNil
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("redis: unexpected reply type %T", reply)
+	}
+	return s, nil
+}
+
+// Set stores the given value, expiring it after the given duration. A
+// non-positive expiry stores the value without expiration.
+func (c *Client) Set(key, value string, expiry time.Duration) error {
+	args := []string{"SET", key, value}
+	if expiry > 0 {
+		ms := expiry.Milliseconds()
+		if ms < 1 {
+			ms = 1
+		}
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	_, err := c.Do(args...)
+	return err
+}
+
+// Del deletes the given key.
+func (c *Client) Del(key string) error {
+	_, err := c.Do("DEL", key)
+	return err
+}
+
+// Ping checks whether the server is reachable.
+func (c *Client) Ping() error {
+	_, err := c.Do("PING")
+	return err
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer implements a tiny subset of Redis for testing purposes.
+type fakeServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	s := &fakeServer{listener: l, values: map[string]string{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range reply.([]interface{}) {
+			args = append(args, arg.(string))
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.Join(args, " "))
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			fmt.Fprint(conn, "+PONG\r\n")
+		case "AUTH":
+			if args[1] != "secret" {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+			} else {
+				fmt.Fprint(conn, "+OK\r\n")
+			}
+		case "SELECT":
+			fmt.Fprint(conn, "+OK\r\n")
+		case "GET":
+			if v, ok := s.values[args[1]]; ok {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+			} else {
+				fmt.Fprint(conn, "$-1\r\n")
+			}
+		case "SET":
+			s.values[args[1]] = args[2]
+			fmt.Fprint(conn, "+OK\r\n")
+		case "DEL":
+			delete(s.values, args[1])
+			fmt.Fprint(conn, ":1\r\n")
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command %s\r\n", args[0])
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name             string
+		url              string
+		expectError      bool
+		expectedAddr     string
+		expectedDB       int
+		expectedPassword string
+	}{
+		{"default port", "redis://localhost", false, "localhost:6379", 0, ""},
+		{"full", "redis://:secret@redis:6380/2", false, "redis:6380", 2, "secret"},
+		{"bad scheme", "http://localhost", true, "", 0, ""},
+		{"bad db", "redis://localhost/abc", true, "", 0, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := New(test.url)
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if c.addr != test.expectedAddr || c.db != test.expectedDB || c.password != test.expectedPassword {
+				t.Errorf("Unexpected client %v", c)
+			}
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.listener.Close()
+
+	c, _ := New(fmt.Sprintf("redis://:secret@%s/1", s.listener.Addr()))
+	if err := c.Ping(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, err := c.Get("key"); err != ErrNil {
+		t.Errorf("Expected ErrNil, got %v", err)
+	}
+	if err := c.Set("key", "value\r\nwith newline", time.Minute); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if v, err := c.Get("key"); err != nil || v != "value\r\nwith newline" {
+		t.Errorf("Unexpected result %v, %v", v, err)
+	}
+	if err := c.Del("key"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	var redisErr Error
+	if _, err := c.Do("FLUSHALL"); !errors.As(err, &redisErr) {
+		t.Errorf("Expected server error, got %v", err)
+	}
+	// server errors do not require reconnecting
+	if err := c.Ping(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.commands[0] != "AUTH secret" || s.commands[1] != "SELECT 1" {
+		t.Errorf("Expected connection to be initialized, got %v", s.commands)
+	}
+	if s.commands[4] != "SET key value\r\nwith newline PX 60000" {
+		t.Errorf("Unexpected command %q", s.commands[4])
+	}
+}
+
+func TestClient_Unavailable(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	c, _ := New("redis://" + addr)
+	if err := c.Ping(); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package remotefs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/s3"
+)
+
+// GCSEndpoint is the endpoint of the S3 compatible API of Google Cloud
+// Storage. It requires HMAC keys to be used as credentials.
+const GCSEndpoint = "https://storage.googleapis.com"
+
+// NewHTTPOrigin creates an Origin that fetches assets relative to the
+// given base URL.
+func NewHTTPOrigin(baseURL string) (Origin, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("remotefs: error parsing base url: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("remotefs: base url %s is expected to be an absolute URL", baseURL)
+	}
+	return &httpOrigin{
+		baseURL: u,
+		client:  &http.Client{Timeout: time.Second * 10},
+	}, nil
+}
+
+type httpOrigin struct {
+	baseURL *url.URL
+	client  *http.Client
+}
+
+func (h *httpOrigin) Fetch(location, etag string) (*Asset, error) {
+	u := *h.baseURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + location
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("remotefs: error creating request: %w", err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("remotefs: error performing request: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, ErrNotModified
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("remotefs: unexpected status code %d fetching %s", res.StatusCode, location)
+	}
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("remotefs: error reading response body: %w", err)
+	}
+	asset := &Asset{Body: b, ETag: res.Header.Get("ETag")}
+	if modTime, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		asset.ModTime = modTime
+	}
+	return asset, nil
+}
+
+// NewS3Origin creates an Origin that fetches assets from S3 compatible
+// storage, using the given prefix for all keys.
+func NewS3Origin(client *s3.Client, prefix string) Origin {
+	return &s3Origin{client: client, prefix: prefix}
+}
+
+type s3Origin struct {
+	client *s3.Client
+	prefix string
+}
+
+func (s *s3Origin) Fetch(location, etag string) (*Asset, error) {
+	b, nextETag, err := s.client.GetIfNoneMatch(s.prefix+strings.TrimPrefix(location, "/"), etag)
+	if err != nil {
+		switch {
+		case errors.Is(err, s3.ErrNotModified):
+			return nil, ErrNotModified
+		case errors.Is(err, s3.ErrNotFound):
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("remotefs: error reading asset from object storage: %w", err)
+	}
+	return &Asset{Body: b, ETag: nextETag}, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package remotefs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPOrigin(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/assets/script.js":
+			if r.Header.Get("If-None-Match") == `"a"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"a"`)
+			w.Write([]byte("script"))
+		case "/assets/broken.js":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	if _, err := NewHTTPOrigin("assets"); err == nil {
+		t.Error("Expected error for relative base url")
+	}
+	origin, err := NewHTTPOrigin(ts.URL + "/assets/")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	asset, err := origin.Fetch("/script.js", "")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(asset.Body) != "script" || asset.ETag != `"a"` {
+		t.Errorf("Unexpected asset %v", asset)
+	}
+	if _, err := origin.Fetch("/script.js", `"a"`); err != ErrNotModified {
+		t.Errorf("Expected ErrNotModified, got %v", err)
+	}
+	if _, err := origin.Fetch("/missing.js", ""); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := origin.Fetch("/broken.js", ""); err == nil || err == ErrNotFound {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package remotefs serves static assets that are stored in a remote location
+// like object storage, caching them locally.
+package remotefs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by an Origin when the requested asset does not exist.
+var ErrNotFound = errors.New("remotefs: asset not found")
+
+// ErrNotModified is returned by an Origin when the requested asset still
+// matches the given ETag.
+var ErrNotModified = errors.New("remotefs: asset not modified")
+
+// Asset is a file that has been fetched from an Origin.
+type Asset struct {
+	Body    []byte    `json:"-"`
+	ETag    string    `json:"etag"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Origin fetches assets from a remote location.
+type Origin interface {
+	// Fetch returns the asset stored at the given location. In case etag is
+	// not empty and the asset has not changed, ErrNotModified is returned.
+	Fetch(location, etag string) (*Asset, error)
+}
+
+// FS is a http.FileSystem that serves assets from an Origin. Fetched assets
+// are cached in memory and optionally on disk, and are revalidated using
+// their ETag once the given TTL has passed.
+type FS struct {
+	origin         Origin
+	cacheDirectory string
+	ttl            time.Duration
+	now            func() time.Time
+	mu             sync.Mutex
+	entries        map[string]*entry
+}
+
+type entry struct {
+	// asset is nil for locations that do not exist in the origin
+	asset   *Asset
+	checked time.Time
+}
+
+// New creates a FS for the given origin. In case cacheDirectory is empty,
+// assets are only cached in memory.
+func New(origin Origin, cacheDirectory string, ttl time.Duration) *FS {
+	return &FS{
+		origin:         origin,
+		cacheDirectory: cacheDirectory,
+		ttl:            ttl,
+		now:            time.Now,
+		entries:        map[string]*entry{},
+	}
+}
+
+// Open returns the asset stored at the given location.
+func (f *FS) Open(name string) (http.File, error) {
+	location := path.Clean("/" + name)
+	asset, err := f.lookup(location)
+	if err != nil {
+		return nil, err
+	}
+	if asset == nil {
+		return nil, &os.PathError{Op: "open", Path: location, Err: os.ErrNotExist}
+	}
+	return &file{
+		Reader: bytes.NewReader(asset.Body),
+		info: fileInfo{
+			name:    path.Base(location),
+			size:    int64(len(asset.Body)),
+			modTime: asset.ModTime,
+		},
+		etag: asset.ETag,
+	}, nil
+}
+
+func (f *FS) lookup(location string) (*Asset, error) {
+	f.mu.Lock()
+	e, ok := f.entries[location]
+	f.mu.Unlock()
+	if ok && f.now().Sub(e.checked) < f.ttl {
+		return e.asset, nil
+	}
+	if !ok {
+		e = f.readCache(location)
+	}
+
+	var etag string
+	if e != nil && e.asset != nil {
+		etag = e.asset.ETag
+	}
+	asset, err := f.origin.Fetch(location, etag)
+	switch {
+	case err == nil:
+		f.writeCache(location, asset)
+	case errors.Is(err, ErrNotModified) && etag != "":
+		asset = e.asset
+	case errors.Is(err, ErrNotFound):
+		asset = nil
+		f.removeCache(location)
+	default:
+		// in case the origin is unavailable, previously fetched assets
+		// are served until they can be revalidated
+		if e == nil {
+			return nil, fmt.Errorf("remotefs: error fetching %s: %w", location, err)
+		}
+		asset = e.asset
+	}
+	e = &entry{asset: asset, checked: f.now()}
+
+	f.mu.Lock()
+	f.entries[location] = e
+	f.mu.Unlock()
+	return e.asset, nil
+}
+
+func (f *FS) cachePath(location string) string {
+	sum := sha256.Sum256([]byte(location))
+	return filepath.Join(f.cacheDirectory, hex.EncodeToString(sum[:]))
+}
+
+// readCache returns the asset that has been cached on disk for the given
+// location. It is revalidated before being used.
+func (f *FS) readCache(location string) *entry {
+	if f.cacheDirectory == "" {
+		return nil
+	}
+	meta, err := os.ReadFile(f.cachePath(location) + ".json")
+	if err != nil {
+		return nil
+	}
+	var asset Asset
+	if err := json.Unmarshal(meta, &asset); err != nil {
+		return nil
+	}
+	body, err := os.ReadFile(f.cachePath(location))
+	if err != nil {
+		return nil
+	}
+	asset.Body = body
+	return &entry{asset: &asset}
+}
+
+// writeCache persists the given asset on disk. Failing to do so only means
+// the asset has to be fetched again after restarting, so errors are skipped.
+func (f *FS) writeCache(location string, asset *Asset) {
+	if f.cacheDirectory == "" {
+		return
+	}
+	meta, err := json.Marshal(asset)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(f.cacheDirectory, 0700); err != nil {
+		return
+	}
+	if err := os.WriteFile(f.cachePath(location), asset.Body, 0600); err != nil {
+		return
+	}
+	os.WriteFile(f.cachePath(location)+".json", meta, 0600)
+}
+
+func (f *FS) removeCache(location string) {
+	if f.cacheDirectory == "" {
+		return
+	}
+	os.Remove(f.cachePath(location))
+	os.Remove(f.cachePath(location) + ".json")
+}
+
+type file struct {
+	*bytes.Reader
+	info fileInfo
+	etag string
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+func (f *file) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, errors.New("remotefs: directory listings are not supported")
+}
+
+func (f *file) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+// ETag returns the ETag the origin has sent for the file.
+func (f *file) ETag() string {
+	return f.etag
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) Mode() os.FileMode  { return 0444 }
+func (i fileInfo) ModTime() time.Time { return i.modTime }
+func (i fileInfo) IsDir() bool        { return false }
+func (i fileInfo) Sys() interface{}   { return nil }
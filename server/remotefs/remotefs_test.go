@@ -0,0 +1,89 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package remotefs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+type mockOrigin struct {
+	assets  map[string]*Asset
+	err     error
+	fetches []string
+}
+
+func (m *mockOrigin) Fetch(location, etag string) (*Asset, error) {
+	m.fetches = append(m.fetches, location+" "+etag)
+	if m.err != nil {
+		return nil, m.err
+	}
+	asset, ok := m.assets[location]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if etag != "" && asset.ETag == etag {
+		return nil, ErrNotModified
+	}
+	return asset, nil
+}
+
+func readAll(t *testing.T, fs *FS, location string) string {
+	f, err := fs.Open(location)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return string(b)
+}
+
+func TestFS(t *testing.T) {
+	origin := &mockOrigin{assets: map[string]*Asset{
+		"/vault/index.js": {Body: []byte("vault"), ETag: `"a"`},
+	}}
+	now := time.Now()
+	fs := New(origin, t.TempDir(), time.Minute)
+	fs.now = func() time.Time { return now }
+
+	if _, err := fs.Open("/missing.js"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected not exist error, got %v", err)
+	}
+	if value := readAll(t, fs, "vault/index.js"); value != "vault" {
+		t.Errorf("Unexpected value %s", value)
+	}
+	f, _ := fs.Open("/vault/index.js")
+	if etag := f.(*file).ETag(); etag != `"a"` {
+		t.Errorf("Unexpected ETag %s", etag)
+	}
+	if len(origin.fetches) != 2 {
+		t.Errorf("Expected cached asset to be used, got %v", origin.fetches)
+	}
+
+	now = now.Add(time.Hour)
+	origin.err = errors.New("did not work")
+	if value := readAll(t, fs, "/vault/index.js"); value != "vault" {
+		t.Errorf("Expected stale asset to be served, got %s", value)
+	}
+	if _, err := fs.Open("/vault/vendor.js"); err == nil {
+		t.Error("Expected error fetching unknown asset from unavailable origin")
+	}
+
+	// a new file system revalidates the asset that has been cached on disk
+	origin.err = nil
+	origin.fetches = nil
+	restarted := New(origin, fs.cacheDirectory, time.Minute)
+	if value := readAll(t, restarted, "/vault/index.js"); value != "vault" {
+		t.Errorf("Unexpected value %s", value)
+	}
+	if len(origin.fetches) != 1 || origin.fetches[0] != `/vault/index.js "a"` {
+		t.Errorf("Unexpected fetches %v", origin.fetches)
+	}
+}
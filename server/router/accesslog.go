@@ -0,0 +1,112 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/sirupsen/logrus"
+)
+
+// Fields that are recorded for each request. Operators can redact any of
+// them using configuration.
+const (
+	accessLogFieldRemoteAddr = "remote_addr"
+	accessLogFieldMethod     = "method"
+	accessLogFieldURI        = "uri"
+	accessLogFieldProto      = "proto"
+	accessLogFieldStatus     = "status"
+	accessLogFieldBytes      = "bytes"
+	accessLogFieldReferer    = "referer"
+	accessLogFieldUserAgent  = "user_agent"
+	accessLogFieldDuration   = "duration_ms"
+)
+
+func (rt *router) getAccessLogger() *logrus.Logger {
+	if rt.accessLogger == nil {
+		l := logrus.New()
+		l.SetOutput(os.Stdout)
+		if rt.accessLogOutput != nil {
+			l.SetOutput(rt.accessLogOutput)
+		}
+		l.SetLevel(logrus.InfoLevel)
+		switch rt.getConfig().Server.AccessLogFormat {
+		case "json":
+			l.SetFormatter(&logrus.JSONFormatter{
+				TimestampFormat: time.RFC3339,
+				FieldMap: logrus.FieldMap{
+					logrus.FieldKeyMsg: "message",
+				},
+			})
+		default:
+			l.SetFormatter(&combinedFormatter{})
+		}
+		rt.accessLogger = l
+	}
+	return rt.accessLogger
+}
+
+// accessLog wraps the given handler and logs a line for each request.
+// Non-error status codes are anonymized so the log does not leak information
+// about returning users that have opted out.
+func (rt *router) accessLog(next http.Handler) http.Handler {
+	logger := rt.getAccessLogger()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics := httpsnoop.CaptureMetrics(next, w, r)
+		fields := logrus.Fields{
+			accessLogFieldMethod:    r.Method,
+			accessLogFieldURI:       r.RequestURI,
+			accessLogFieldProto:     r.Proto,
+			accessLogFieldStatus:    anonymizeStatusCode(metrics.Code),
+			accessLogFieldBytes:     metrics.Written,
+			accessLogFieldReferer:   r.Referer(),
+			accessLogFieldUserAgent: r.UserAgent(),
+			accessLogFieldDuration:  metrics.Duration.Milliseconds(),
+		}
+		if rt.getConfig().Server.LogClientIP {
+			fields[accessLogFieldRemoteAddr] = anonymizeIP(clientIP(r, rt.trustedProxies()))
+		}
+		for _, key := range rt.getConfig().Server.AccessLogRedact {
+			delete(fields, key)
+		}
+		logger.WithFields(fields).Info("request")
+	})
+}
+
+// combinedFormatter renders entries using the Apache combined log format.
+// Fields that are missing or have been redacted are rendered as a dash.
+type combinedFormatter struct{}
+
+func (*combinedFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	field := func(key string) string {
+		v, ok := e.Data[key]
+		if !ok {
+			return "-"
+		}
+		if s := fmt.Sprintf("%v", v); s != "" {
+			return s
+		}
+		return "-"
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(
+		&b,
+		"%s - - [%s] \"%s %s %s\" %s %s \"%s\" \"%s\"\n",
+		field(accessLogFieldRemoteAddr),
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		field(accessLogFieldMethod),
+		field(accessLogFieldURI),
+		field(accessLogFieldProto),
+		field(accessLogFieldStatus),
+		field(accessLogFieldBytes),
+		field(accessLogFieldReferer),
+		field(accessLogFieldUserAgent),
+	)
+	return b.Bytes(), nil
+}
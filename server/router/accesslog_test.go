@@ -0,0 +1,84 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/offen/offen/server/config"
+)
+
+func TestRouter_accessLog(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	newRequest := func(path string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = "192.168.0.12:9999"
+		r.Header.Set("Referer", "https://www.offen.dev/")
+		r.Header.Set("User-Agent", "curl/8.0")
+		return r
+	}
+
+	t.Run("combined", func(t *testing.T) {
+		var out bytes.Buffer
+		cfg := &config.Config{}
+		cfg.Server.AccessLogRedact = []string{"referer"}
+		rt := &router{config: cfg, accessLogOutput: &out}
+
+		rt.accessLog(handler).ServeHTTP(httptest.NewRecorder(), newRequest("/vault"))
+		rt.accessLog(handler).ServeHTTP(httptest.NewRecorder(), newRequest("/missing"))
+
+		lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+		if len(lines) != 2 {
+			t.Fatalf("Unexpected log output %s", out.String())
+		}
+		expected := []*regexp.Regexp{
+			regexp.MustCompile(`^- - - \[[^\]]+\] "GET /vault HTTP/1.1" 200 0 "-" "curl/8.0"$`),
+			regexp.MustCompile(`^- - - \[[^\]]+\] "GET /missing HTTP/1.1" 404 0 "-" "curl/8.0"$`),
+		}
+		for i, line := range lines {
+			if !expected[i].Match(line) {
+				t.Errorf("Unexpected log line %s", line)
+			}
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var out bytes.Buffer
+		cfg := &config.Config{}
+		cfg.Server.AccessLogFormat = "json"
+		cfg.Server.LogClientIP = true
+		cfg.Server.AccessLogRedact = []string{"referer", "user_agent"}
+		rt := &router{config: cfg, accessLogOutput: &out}
+
+		rt.accessLog(handler).ServeHTTP(httptest.NewRecorder(), newRequest("/vault?x=y"))
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if entry["uri"] != "/vault?x=y" || entry["status"] != float64(http.StatusOK) || entry["method"] != http.MethodGet {
+			t.Errorf("Unexpected entry %v", entry)
+		}
+		if entry["remote_addr"] != "192.168.0.0" {
+			t.Errorf("Unexpected remote address %v", entry["remote_addr"])
+		}
+		if _, ok := entry["referer"]; ok {
+			t.Errorf("Expected referer to be redacted, got %v", entry)
+		}
+		if _, ok := entry["user_agent"]; ok {
+			t.Errorf("Expected user agent to be redacted, got %v", entry)
+		}
+	})
+}
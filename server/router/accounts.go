@@ -4,6 +4,7 @@
 package router
 
 import (
+	"crypto/md5"
 	"errors"
 	"fmt"
 	"html"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/persistence"
 )
 
@@ -40,7 +42,7 @@ func (rt *router) getAccount(c *gin.Context) {
 		return
 	}
 
-	result, err := rt.db.GetAccount(accountID, true, true, c.Query("since"))
+	result, err := rt.db.GetAccount(accountID, false, true, c.Query("since"))
 	if err != nil {
 		var errUnknown persistence.ErrUnknownAccount
 		if errors.As(err, &errUnknown) {
@@ -56,7 +58,284 @@ func (rt *router) getAccount(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
-	result.RetentionPeriod = rt.config.App.Retention.String()
+	if styles, err := rt.getStyleStore().Get(accountID); err != nil {
+		rt.logError(err, "error reading custom styles for account")
+	} else {
+		result.AccountStyles = styles
+	}
+	if result.RetentionPeriod == "" {
+		result.RetentionPeriod = rt.getConfig().App.Retention.String()
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// updateAccountRequest contains the account settings to update. Settings
+// that are omitted are left unchanged.
+type updateAccountRequest struct {
+	RetentionPeriod *string                     `json:"retentionPeriod"`
+	RetentionRules  *persistence.RetentionRules `json:"retentionRules"`
+	BotPolicy       *string                     `json:"botPolicy"`
+	AllowedOrigins  *[]string                   `json:"allowedOrigins"`
+	CookiePolicy    *persistence.CookiePolicy   `json:"cookiePolicy"`
+	Locale          *string                     `json:"locale"`
+	WriteKey        *writeKeyUpdate             `json:"writeKey"`
+}
+
+// writeKeyUpdate rotates or removes the write keys of an account.
+type writeKeyUpdate struct {
+	// Action is either "rotate" or "remove".
+	Action string `json:"action"`
+	// GracePeriod is the duration the previous key is still accepted for
+	// after rotating, e.g. "1h". Passing "0s" revokes it immediately.
+	GracePeriod string `json:"gracePeriod"`
+}
+
+func (rt *router) putAccount(c *gin.Context) {
+	accountID := c.Param("accountID")
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("putAccount-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if ok := accountUser.HasRole(accountID, persistence.AccountUserRoleAdmin); !ok {
+		newJSONError(
+			fmt.Errorf("router: account user does not have permissions to update account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	var req updateAccountRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	if req.RetentionPeriod == nil && req.RetentionRules == nil && req.BotPolicy == nil && req.AllowedOrigins == nil && req.CookiePolicy == nil && req.Locale == nil && req.WriteKey == nil {
+		newJSONError(
+			errors.New("router: request payload does not contain any updates"),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	// an empty value resets the account to the global default
+	if req.RetentionPeriod != nil && *req.RetentionPeriod != "" {
+		if _, err := config.RetentionDuration(*req.RetentionPeriod); err != nil {
+			newJSONError(
+				fmt.Errorf("router: invalid retention period: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+	if req.RetentionRules != nil {
+		if err := req.RetentionRules.Validate(); err != nil {
+			newJSONError(
+				fmt.Errorf("router: invalid retention rules: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+	if req.BotPolicy != nil && *req.BotPolicy != "" {
+		var policy config.BotPolicy
+		if err := policy.Decode(*req.BotPolicy); err != nil {
+			newJSONError(
+				fmt.Errorf("router: invalid bot policy: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+
+	if req.AllowedOrigins != nil {
+		for _, origin := range *req.AllowedOrigins {
+			if _, err := persistence.NormalizeOrigin(origin); err != nil {
+				newJSONError(
+					fmt.Errorf("router: invalid allowed origin: %w", err),
+					http.StatusBadRequest,
+				).Pipe(c)
+				return
+			}
+		}
+	}
+
+	if req.CookiePolicy != nil {
+		if err := req.CookiePolicy.Validate(); err != nil {
+			newJSONError(
+				fmt.Errorf("router: invalid cookie policy: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+
+	// an empty value makes the locale be negotiated per request
+	if req.Locale != nil && *req.Locale != "" {
+		var locale config.Locale
+		if err := locale.Decode(*req.Locale); err != nil {
+			newJSONError(
+				fmt.Errorf("router: invalid locale: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+
+	gracePeriod := defaultWriteKeyGracePeriod
+	if req.WriteKey != nil {
+		if req.WriteKey.Action != "rotate" && req.WriteKey.Action != "remove" {
+			newJSONError(
+				fmt.Errorf("router: unknown write key action %q", req.WriteKey.Action),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		if req.WriteKey.GracePeriod != "" {
+			d, err := time.ParseDuration(req.WriteKey.GracePeriod)
+			if err != nil || d < 0 {
+				newJSONError(
+					fmt.Errorf("router: invalid write key grace period %q", req.WriteKey.GracePeriod),
+					http.StatusBadRequest,
+				).Pipe(c)
+				return
+			}
+			gracePeriod = d
+		}
+	}
+
+	var updates []func() error
+	if req.RetentionPeriod != nil {
+		updates = append(updates, func() error {
+			return rt.db.UpdateAccountRetention(accountID, *req.RetentionPeriod, accountUser.AccountUserID)
+		})
+	}
+	if req.RetentionRules != nil {
+		updates = append(updates, func() error {
+			return rt.db.UpdateAccountRetentionRules(accountID, *req.RetentionRules, accountUser.AccountUserID)
+		})
+	}
+	if req.BotPolicy != nil {
+		updates = append(updates, func() error {
+			return rt.db.UpdateAccountBotPolicy(accountID, *req.BotPolicy, accountUser.AccountUserID)
+		})
+	}
+	if req.AllowedOrigins != nil {
+		updates = append(updates, func() error {
+			return rt.db.UpdateAccountAllowedOrigins(accountID, *req.AllowedOrigins, accountUser.AccountUserID)
+		})
+	}
+	if req.CookiePolicy != nil {
+		updates = append(updates, func() error {
+			return rt.db.UpdateAccountCookiePolicy(accountID, *req.CookiePolicy, accountUser.AccountUserID)
+		})
+	}
+	if req.Locale != nil {
+		updates = append(updates, func() error {
+			return rt.db.UpdateAccountLocale(accountID, *req.Locale, accountUser.AccountUserID)
+		})
+	}
+	if req.WriteKey != nil {
+		updates = append(updates, func() error {
+			if req.WriteKey.Action == "remove" {
+				return rt.db.RemoveAccountWriteKeys(accountID, accountUser.AccountUserID)
+			}
+			_, err := rt.db.RotateAccountWriteKey(accountID, gracePeriod, accountUser.AccountUserID)
+			return err
+		})
+	}
+	for _, update := range updates {
+		if err := update(); err != nil {
+			var errUnknown persistence.ErrUnknownAccount
+			if errors.As(err, &errUnknown) {
+				newJSONError(
+					fmt.Errorf("router: account %s not found", accountID),
+					http.StatusNotFound,
+				).Pipe(c)
+				return
+			}
+			newJSONError(
+				fmt.Errorf("router: error updating account: %w", err),
+				http.StatusInternalServerError,
+			).Pipe(c)
+			return
+		}
+	}
+	rt.getCache().Delete(fmt.Sprintf("account-retention-%s", accountID))
+	rt.getCache().Delete(fmt.Sprintf("account-bot-policy-%s", accountID))
+	rt.getCache().Delete(fmt.Sprintf("account-allowed-origins-%s", accountID))
+	rt.getCache().Delete(fmt.Sprintf("account-cookie-policy-%s", accountID))
+	rt.getCache().Delete(fmt.Sprintf("account-locale-%s", accountID))
+	rt.getCache().Delete(fmt.Sprintf("account-write-keys-%s", accountID))
+
+	c.Status(http.StatusNoContent)
+}
+
+func (rt *router) getAccountSummary(c *gin.Context) {
+	accountID := c.Param("accountID")
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("getAccountSummary-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if ok := accountUser.CanAccessAccount(accountID); !ok {
+		newJSONError(
+			fmt.Errorf("router: account user does not have permissions to access account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	result, err := rt.db.GetAccountSummary(accountID)
+	if err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error looking up account summary: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	// the sequence changes on every insertion while the count also covers
+	// deletions, so the ETag changes whenever the underlying data does
+	etag := fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf(
+		"%s-%s-%s-%d", result.AccountID, result.LatestEventID, result.Sequence, result.EventCount,
+	))))
+	if applyETag(c, etag) {
+		return
+	}
 	c.JSON(http.StatusOK, result)
 }
 
@@ -80,7 +359,7 @@ func (rt *router) deleteAccount(c *gin.Context) {
 		return
 	}
 
-	if ok := accountUser.CanAccessAccount(accountID) && accountUser.IsSuperAdmin(); !ok {
+	if ok := accountUser.HasRole(accountID, persistence.AccountUserRoleAdmin); !ok {
 		newJSONError(
 			fmt.Errorf("router: account user does not have permissions to delete account %s", accountID),
 			http.StatusForbidden,
@@ -88,7 +367,7 @@ func (rt *router) deleteAccount(c *gin.Context) {
 		return
 	}
 
-	err := rt.db.RetireAccount(accountID)
+	err := rt.db.RetireAccount(accountID, accountUser.AccountUserID)
 	if err != nil {
 		var errUnknown persistence.ErrUnknownAccount
 		if errors.As(err, &errUnknown) {
@@ -107,6 +386,47 @@ func (rt *router) deleteAccount(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// postRestoreAccount restores an account that has been retired before. As
+// retired accounts are not part of login results, checking whether the
+// account user is allowed to restore the account is left to the database.
+func (rt *router) postRestoreAccount(c *gin.Context) {
+	accountID := c.Param("accountID")
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("postRestoreAccount-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.db.RestoreAccount(accountID, accountUser.AccountUserID); err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: retired account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error restoring account: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
 type createAccountRequest struct {
 	AccountName  string `json:"accountName"`
 	EmailAddress string `json:"emailAddress"`
@@ -140,7 +460,7 @@ func (rt *router) postAccount(c *gin.Context) {
 		return
 	}
 
-	accountInRequest, err := rt.db.Login(req.EmailAddress, req.Password)
+	accountInRequest, err := rt.db.VerifyCredentials(req.EmailAddress, req.Password)
 	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: error validating given credentials: %w", err),
@@ -175,3 +495,64 @@ func (rt *router) postAccount(c *gin.Context) {
 	}
 	c.JSON(http.StatusCreated, nil)
 }
+
+type rotateKeysRequest struct {
+	Password string `json:"password"`
+}
+
+// postRotateKeys replaces the keypair of an account. The password of the
+// account user is required for encrypting the new private key.
+func (rt *router) postRotateKeys(c *gin.Context) {
+	accountID := c.Param("accountID")
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("postRotateKeys-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if ok := accountUser.HasRole(accountID, persistence.AccountUserRoleAdmin); !ok {
+		newJSONError(
+			fmt.Errorf("router: account user does not have permissions to rotate keys of account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	var req rotateKeysRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.db.RotateAccountKeys(accountID, accountUser.AccountUserID, req.Password); err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error rotating keys: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
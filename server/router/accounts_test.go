@@ -9,8 +9,10 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/securecookie"
@@ -82,12 +84,78 @@ func TestRouter_GetAccount(t *testing.T) {
 	}
 }
 
+type mockGetAccountSummaryDatabase struct {
+	persistence.Service
+	result persistence.AccountSummaryResult
+	err    error
+}
+
+func (m *mockGetAccountSummaryDatabase) GetAccountSummary(string) (persistence.AccountSummaryResult, error) {
+	return m.result, m.err
+}
+
+func TestRouter_getAccountSummary(t *testing.T) {
+	db := &mockGetAccountSummaryDatabase{
+		result: persistence.AccountSummaryResult{
+			AccountID: "account-a", EventCount: 2, LatestEventID: "event-b", Sequence: "seq-b",
+		},
+	}
+	rt := router{db: db, config: &config.Config{}}
+	m := gin.New()
+	m.GET("/:accountID", func(c *gin.Context) {
+		c.Set(contextKeyAuth, persistence.LoginResult{
+			Accounts: []persistence.LoginAccountResult{{AccountID: "account-a"}},
+		})
+	}, rt.getAccountSummary)
+
+	request := func(url, ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		m.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("/account-b", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Unexpected status code %v", w.Code)
+	}
+
+	w := request("/account-a", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %v", w.Code)
+	}
+	if w.Body.String() != `{"accountId":"account-a","eventCount":2,"latestEventId":"event-b","sequence":"seq-b"}` {
+		t.Errorf("Unexpected response body %s", w.Body.String())
+	}
+	etag := w.Header().Get("Etag")
+	if etag == "" {
+		t.Fatal("Expected ETag to be set")
+	}
+
+	if w := request("/account-a", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected empty 304 response, got %v and %s", w.Code, w.Body.String())
+	}
+
+	db.result.EventCount = 3
+	db.result.Sequence = "seq-c"
+	if w := request("/account-a", etag); w.Code != http.StatusOK || w.Header().Get("Etag") == etag {
+		t.Errorf("Expected ETag to change after new events, got %v", w.Code)
+	}
+
+	db.err = persistence.ErrUnknownAccount("unknown")
+	if w := request("/account-a", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status code %v", w.Code)
+	}
+}
+
 type mockDeleteAccountDatabase struct {
 	persistence.Service
 	result error
 }
 
-func (m *mockDeleteAccountDatabase) RetireAccount(string) error {
+func (m *mockDeleteAccountDatabase) RetireAccount(string, string) error {
 	return m.result
 }
 
@@ -117,7 +185,7 @@ func TestRouter_DeleteAccount(t *testing.T) {
 			persistence.LoginResult{
 				AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
 				Accounts: []persistence.LoginAccountResult{
-					{AccountID: "account-a"},
+					{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
 				},
 			},
 			http.StatusForbidden,
@@ -129,7 +197,7 @@ func TestRouter_DeleteAccount(t *testing.T) {
 			persistence.LoginResult{
 				AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
 				Accounts: []persistence.LoginAccountResult{
-					{AccountID: "account-a"},
+					{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
 				},
 			},
 			http.StatusNoContent,
@@ -163,6 +231,276 @@ func TestRouter_DeleteAccount(t *testing.T) {
 	}
 }
 
+type mockRestoreAccountDatabase struct {
+	persistence.Service
+	result error
+}
+
+func (m *mockRestoreAccountDatabase) RestoreAccount(string, string) error {
+	return m.result
+}
+
+func TestRouter_postRestoreAccount(t *testing.T) {
+	tests := []struct {
+		name               string
+		database           persistence.Service
+		expectedStatusCode int
+	}{
+		{
+			"unknown account",
+			&mockRestoreAccountDatabase{result: persistence.ErrUnknownAccount("did not work")},
+			http.StatusNotFound,
+		},
+		{
+			"database error",
+			&mockRestoreAccountDatabase{result: errors.New("did not work")},
+			http.StatusInternalServerError,
+		},
+		{
+			"ok",
+			&mockRestoreAccountDatabase{},
+			http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.database, config: &config.Config{}}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/account-a/restore", nil)
+			m := gin.New()
+			m.POST("/:accountID/restore", func(c *gin.Context) {
+				c.Set(contextKeyAuth, persistence.LoginResult{AccountUserID: "user-a"})
+				c.Next()
+			}, rt.postRestoreAccount)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+type mockPutAccountDatabase struct {
+	persistence.Service
+	err     error
+	updated []string
+}
+
+func (m *mockPutAccountDatabase) UpdateAccountRetention(accountID, retentionPeriod, accountUserID string) error {
+	m.updated = append(m.updated, retentionPeriod)
+	return m.err
+}
+
+func (m *mockPutAccountDatabase) UpdateAccountBotPolicy(accountID, botPolicy, accountUserID string) error {
+	m.updated = append(m.updated, "bot policy "+botPolicy)
+	return m.err
+}
+
+func (m *mockPutAccountDatabase) UpdateAccountAllowedOrigins(accountID string, origins []string, accountUserID string) error {
+	m.updated = append(m.updated, fmt.Sprintf("%d origins", len(origins)))
+	return m.err
+}
+
+func (m *mockPutAccountDatabase) UpdateAccountRetentionRules(accountID string, rules persistence.RetentionRules, accountUserID string) error {
+	m.updated = append(m.updated, fmt.Sprintf("%d rules", len(rules)))
+	return m.err
+}
+
+func (m *mockPutAccountDatabase) RotateAccountWriteKey(accountID string, gracePeriod time.Duration, accountUserID string) (string, error) {
+	m.updated = append(m.updated, "rotate write key "+gracePeriod.String())
+	return "key", m.err
+}
+
+func (m *mockPutAccountDatabase) RemoveAccountWriteKeys(accountID, accountUserID string) error {
+	m.updated = append(m.updated, "remove write keys")
+	return m.err
+}
+
+func TestRouter_putAccount(t *testing.T) {
+	superAdmin := persistence.LoginResult{
+		AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
+		Accounts: []persistence.LoginAccountResult{
+			{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
+		},
+	}
+	tests := []struct {
+		name               string
+		database           *mockPutAccountDatabase
+		user               persistence.LoginResult
+		body               string
+		expectedStatusCode int
+		expectedUpdates    []string
+	}{
+		{
+			"not authorized",
+			&mockPutAccountDatabase{},
+			persistence.LoginResult{
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a"},
+				},
+			},
+			`{"retentionPeriod":"30days"}`,
+			http.StatusForbidden,
+			nil,
+		},
+		{
+			"bad retention period",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"retentionPeriod":"forever"}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"database error",
+			&mockPutAccountDatabase{err: errors.New("did not work")},
+			superAdmin,
+			`{"retentionPeriod":"30days"}`,
+			http.StatusInternalServerError,
+			[]string{"30days"},
+		},
+		{
+			"ok",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"retentionPeriod":"30days"}`,
+			http.StatusNoContent,
+			[]string{"30days"},
+		},
+		{
+			"reset",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"retentionPeriod":""}`,
+			http.StatusNoContent,
+			[]string{""},
+		},
+		{
+			"empty payload",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"bad retention rules",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"retentionRules":[{"maxAgeDays":30,"maxEvents":100}]}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"retention rules",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"retentionRules":[{"maxAgeDays":30},{"maxEvents":100000}]}`,
+			http.StatusNoContent,
+			[]string{"2 rules"},
+		},
+		{
+			"retention period and rules",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"retentionPeriod":"30days","retentionRules":[]}`,
+			http.StatusNoContent,
+			[]string{"30days", "0 rules"},
+		},
+		{
+			"bad bot policy",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"botPolicy":"ignore"}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"bot policy",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"botPolicy":"flag"}`,
+			http.StatusNoContent,
+			[]string{"bot policy flag"},
+		},
+		{
+			"bad allowed origin",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"allowedOrigins":["https://www.offen.dev/about"]}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"allowed origins",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"allowedOrigins":["https://www.offen.dev"]}`,
+			http.StatusNoContent,
+			[]string{"1 origins"},
+		},
+		{
+			"bad write key action",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"writeKey":{"action":"create"}}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"bad write key grace period",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"writeKey":{"action":"rotate","gracePeriod":"a week"}}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"rotate write key",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"writeKey":{"action":"rotate"}}`,
+			http.StatusNoContent,
+			[]string{"rotate write key 24h0m0s"},
+		},
+		{
+			"rotate write key with grace period",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"writeKey":{"action":"rotate","gracePeriod":"1h"}}`,
+			http.StatusNoContent,
+			[]string{"rotate write key 1h0m0s"},
+		},
+		{
+			"remove write keys",
+			&mockPutAccountDatabase{},
+			superAdmin,
+			`{"writeKey":{"action":"remove"}}`,
+			http.StatusNoContent,
+			[]string{"remove write keys"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.database, config: &config.Config{}}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/account-a", strings.NewReader(test.body))
+			m := gin.New()
+			m.PUT("/:accountID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, test.user)
+				c.Next()
+			}, rt.putAccount)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if !reflect.DeepEqual(test.expectedUpdates, test.database.updated) {
+				t.Errorf("Unexpected updates %v", test.database.updated)
+			}
+		})
+	}
+}
+
 type mockPostAccountDatabase struct {
 	persistence.Service
 	loginResult      persistence.LoginResult
@@ -170,7 +508,7 @@ type mockPostAccountDatabase struct {
 	createAccountErr error
 }
 
-func (m *mockPostAccountDatabase) Login(string, string) (persistence.LoginResult, error) {
+func (m *mockPostAccountDatabase) VerifyCredentials(string, string) (persistence.LoginResult, error) {
 	return m.loginResult, m.loginErr
 }
 
@@ -309,3 +647,85 @@ func TestRouter_postAccount(t *testing.T) {
 		})
 	}
 }
+
+type mockRotateKeysDatabase struct {
+	persistence.Service
+	err error
+}
+
+func (m *mockRotateKeysDatabase) RotateAccountKeys(accountID, accountUserID, password string) error {
+	return m.err
+}
+
+func TestRouter_postRotateKeys(t *testing.T) {
+	admin := persistence.LoginResult{
+		AccountUserID: "user-a",
+		Accounts: []persistence.LoginAccountResult{
+			{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
+		},
+	}
+	tests := []struct {
+		name               string
+		database           persistence.Service
+		user               persistence.LoginResult
+		body               string
+		expectedStatusCode int
+	}{
+		{
+			"not authorized",
+			&mockRotateKeysDatabase{},
+			persistence.LoginResult{
+				AccountUserID: "user-a",
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a", Role: persistence.AccountUserRoleEditor},
+				},
+			},
+			`{"password":"pass"}`,
+			http.StatusForbidden,
+		},
+		{
+			"bad payload",
+			&mockRotateKeysDatabase{},
+			admin,
+			`{"password":`,
+			http.StatusBadRequest,
+		},
+		{
+			"unknown account",
+			&mockRotateKeysDatabase{err: persistence.ErrUnknownAccount("did not work")},
+			admin,
+			`{"password":"pass"}`,
+			http.StatusNotFound,
+		},
+		{
+			"database error",
+			&mockRotateKeysDatabase{err: errors.New("did not work")},
+			admin,
+			`{"password":"pass"}`,
+			http.StatusInternalServerError,
+		},
+		{
+			"ok",
+			&mockRotateKeysDatabase{},
+			admin,
+			`{"password":"pass"}`,
+			http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.database, config: &config.Config{}}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/account-a/rotate-keys", strings.NewReader(test.body))
+			m := gin.New()
+			m.POST("/:accountID/rotate-keys", func(c *gin.Context) {
+				c.Set(contextKeyAuth, test.user)
+				c.Next()
+			}, rt.postRotateKeys)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
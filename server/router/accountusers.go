@@ -0,0 +1,159 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+// accountUserManager returns the account user of the request in case it is
+// allowed to manage the members of the requested account. In case false is
+// returned, the request has already been aborted.
+func accountUserManager(c *gin.Context) (persistence.LoginResult, bool) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return accountUser, false
+	}
+	accountID := c.Param("accountID")
+	if !accountUser.HasRole(accountID, persistence.AccountUserRoleAdmin) {
+		newJSONError(
+			fmt.Errorf("router: account user is not allowed to manage users of account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return accountUser, false
+	}
+	return accountUser, true
+}
+
+// pipeAccountUserError responds with the status matching the given error
+// returned when changing a member of an account.
+func pipeAccountUserError(c *gin.Context, err error) {
+	var unknownErr persistence.ErrUnknownAccountUser
+	if errors.As(err, &unknownErr) {
+		newJSONError(
+			fmt.Errorf("router: account user %s not found", c.Param("accountUserID")),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	var lastAdminErr persistence.ErrLastAccountAdmin
+	if errors.As(err, &lastAdminErr) {
+		newJSONError(
+			fmt.Errorf("router: account %s requires at least one admin", c.Param("accountID")),
+			http.StatusConflict,
+		).Pipe(c)
+		return
+	}
+	newJSONError(
+		fmt.Errorf("router: error updating account user: %w", err),
+		http.StatusInternalServerError,
+	).Pipe(c)
+}
+
+func (rt *router) getAccountUsers(c *gin.Context) {
+	if _, ok := accountUserManager(c); !ok {
+		return
+	}
+	users, err := rt.db.ListAccountUsers(c.Param("accountID"))
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error listing account users: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+type updateAccountUserRequest struct {
+	Role string `json:"role"`
+}
+
+func (rt *router) putAccountUser(c *gin.Context) {
+	accountUser, ok := accountUserManager(c)
+	if !ok {
+		return
+	}
+
+	var req updateAccountUserRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	role := persistence.AccountUserRole(req.Role)
+	if !role.Valid() {
+		newJSONError(
+			fmt.Errorf("router: unknown role %s", req.Role),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.db.UpdateAccountUserRole(c.Param("accountID"), c.Param("accountUserID"), role, accountUser.AccountUserID); err != nil {
+		pipeAccountUserError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type removeAccountUserRequest struct {
+	Password string `json:"password"`
+}
+
+func (rt *router) deleteAccountUser(c *gin.Context) {
+	accountUser, ok := accountUserManager(c)
+	if !ok {
+		return
+	}
+	accountID := c.Param("accountID")
+
+	// removing a user rotates the keys of the account
+	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("postRotateKeys-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	var req removeAccountUserRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.db.RemoveAccountUser(accountID, c.Param("accountUserID"), accountUser.AccountUserID, req.Password); err != nil {
+		pipeAccountUserError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (rt *router) postUnlockAccountUser(c *gin.Context) {
+	accountUser, ok := accountUserManager(c)
+	if !ok {
+		return
+	}
+	if err := rt.db.UnlockAccountUser(c.Param("accountID"), c.Param("accountUserID"), accountUser.AccountUserID); err != nil {
+		pipeAccountUserError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
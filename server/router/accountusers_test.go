@@ -0,0 +1,166 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockAccountUsersDatabase struct {
+	persistence.Service
+	users []persistence.AccountUserResult
+	err   error
+}
+
+func (m *mockAccountUsersDatabase) ListAccountUsers(accountID string) ([]persistence.AccountUserResult, error) {
+	return m.users, m.err
+}
+
+func (m *mockAccountUsersDatabase) UpdateAccountUserRole(accountID, targetAccountUserID string, role persistence.AccountUserRole, accountUserID string) error {
+	return m.err
+}
+
+func (m *mockAccountUsersDatabase) RemoveAccountUser(accountID, targetAccountUserID, accountUserID, password string) error {
+	return m.err
+}
+
+func (m *mockAccountUsersDatabase) UnlockAccountUser(accountID, targetAccountUserID, accountUserID string) error {
+	return m.err
+}
+
+var accountUsersAccountUser = persistence.LoginResult{
+	AccountUserID: "user-a",
+	Accounts: []persistence.LoginAccountResult{
+		{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
+		{AccountID: "account-b", Role: persistence.AccountUserRoleViewer},
+	},
+}
+
+func TestRouter_accountUsers(t *testing.T) {
+	tests := []struct {
+		name               string
+		method             string
+		path               string
+		body               string
+		db                 *mockAccountUsersDatabase
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			"list ok",
+			http.MethodGet, "/accounts/account-a/users", "",
+			&mockAccountUsersDatabase{users: []persistence.AccountUserResult{{AccountUserID: "user-a", Role: persistence.AccountUserRoleAdmin}}},
+			http.StatusOK,
+			`[{"accountUserId":"user-a","role":"admin","pending":false}]`,
+		},
+		{
+			"list not an admin",
+			http.MethodGet, "/accounts/account-b/users", "",
+			&mockAccountUsersDatabase{},
+			http.StatusForbidden, "",
+		},
+		{
+			"list error",
+			http.MethodGet, "/accounts/account-a/users", "",
+			&mockAccountUsersDatabase{err: errors.New("did not work")},
+			http.StatusInternalServerError, "",
+		},
+		{
+			"update ok",
+			http.MethodPut, "/accounts/account-a/users/user-b", `{"role":"editor"}`,
+			&mockAccountUsersDatabase{},
+			http.StatusNoContent, "",
+		},
+		{
+			"update bad role",
+			http.MethodPut, "/accounts/account-a/users/user-b", `{"role":"owner"}`,
+			&mockAccountUsersDatabase{},
+			http.StatusBadRequest, "",
+		},
+		{
+			"update unknown user",
+			http.MethodPut, "/accounts/account-a/users/user-z", `{"role":"editor"}`,
+			&mockAccountUsersDatabase{err: persistence.ErrUnknownAccountUser("unknown")},
+			http.StatusNotFound, "",
+		},
+		{
+			"update last admin",
+			http.MethodPut, "/accounts/account-a/users/user-a", `{"role":"viewer"}`,
+			&mockAccountUsersDatabase{err: persistence.ErrLastAccountAdmin("last")},
+			http.StatusConflict, "",
+		},
+		{
+			"remove ok",
+			http.MethodDelete, "/accounts/account-a/users/user-b", `{"password":"pass"}`,
+			&mockAccountUsersDatabase{},
+			http.StatusNoContent, "",
+		},
+		{
+			"remove bad payload",
+			http.MethodDelete, "/accounts/account-a/users/user-b", `{"password":`,
+			&mockAccountUsersDatabase{},
+			http.StatusBadRequest, "",
+		},
+		{
+			"remove not an admin",
+			http.MethodDelete, "/accounts/account-b/users/user-b", `{"password":"pass"}`,
+			&mockAccountUsersDatabase{},
+			http.StatusForbidden, "",
+		},
+		{
+			"remove error",
+			http.MethodDelete, "/accounts/account-a/users/user-b", `{"password":"pass"}`,
+			&mockAccountUsersDatabase{err: errors.New("did not work")},
+			http.StatusInternalServerError, "",
+		},
+		{
+			"unlock ok",
+			http.MethodPost, "/accounts/account-a/users/user-b/unlock", "",
+			&mockAccountUsersDatabase{},
+			http.StatusNoContent, "",
+		},
+		{
+			"unlock not an admin",
+			http.MethodPost, "/accounts/account-b/users/user-b/unlock", "",
+			&mockAccountUsersDatabase{},
+			http.StatusForbidden, "",
+		},
+		{
+			"unlock unknown user",
+			http.MethodPost, "/accounts/account-a/users/user-z/unlock", "",
+			&mockAccountUsersDatabase{err: persistence.ErrUnknownAccountUser("unknown")},
+			http.StatusNotFound, "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			auth := func(c *gin.Context) {
+				c.Set(contextKeyAuth, accountUsersAccountUser)
+			}
+			m.GET("/accounts/:accountID/users", auth, rt.getAccountUsers)
+			m.PUT("/accounts/:accountID/users/:accountUserID", auth, rt.putAccountUser)
+			m.DELETE("/accounts/:accountID/users/:accountUserID", auth, rt.deleteAccountUser)
+			m.POST("/accounts/:accountID/users/:accountUserID/unlock", auth, rt.postUnlockAccountUser)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedBody != "" && strings.TrimSpace(w.Body.String()) != test.expectedBody {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+		})
+	}
+}
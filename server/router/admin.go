@@ -0,0 +1,220 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/scheduler"
+)
+
+// adminMiddleware authenticates instance operators. Requests carrying the
+// configured admin token as a bearer token are granted super admin
+// privileges without being tied to an account user. Cookie based logins are
+// not accepted, as super admin privileges can be handed out by any account
+// admin when sharing an account and must not grant access to all accounts
+// of the instance.
+func (rt *router) adminMiddleware(contextKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		expected := rt.getConfig().App.AdminToken.String()
+		given := strings.TrimPrefix(header, "Bearer ")
+		if expected == "" || !strings.HasPrefix(header, "Bearer ") || subtle.ConstantTimeCompare([]byte(expected), []byte(given)) != 1 {
+			newJSONError(
+				errors.New("router: missing or invalid admin token"),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+		c.Set(contextKey, persistence.LoginResult{
+			AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
+		})
+		c.Next()
+	}
+}
+
+// requireSuperAdmin aborts all requests that are not made by a super admin.
+func requireSuperAdmin(contextKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountUser, ok := c.Value(contextKey).(persistence.LoginResult)
+		if !ok {
+			newJSONError(
+				errors.New("router: could not find account user object in request context"),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		if !accountUser.IsSuperAdmin() {
+			newJSONError(
+				errors.New("router: account user is not allowed to access the admin api"),
+				http.StatusForbidden,
+			).Pipe(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+func (rt *router) getAdminAccounts(c *gin.Context) {
+	accounts, err := rt.db.ListAllAccounts()
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error listing accounts: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, accounts)
+}
+
+func (rt *router) getAdminUsage(c *gin.Context) {
+	usage, err := rt.db.GetInstanceUsage()
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up usage: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+func (rt *router) postAdminDisableAccount(c *gin.Context) {
+	rt.setAccountDisabled(c, true)
+}
+
+func (rt *router) postAdminEnableAccount(c *gin.Context) {
+	rt.setAccountDisabled(c, false)
+}
+
+func (rt *router) setAccountDisabled(c *gin.Context, disabled bool) {
+	accountUser, _ := c.Value(contextKeyAuth).(persistence.LoginResult)
+	accountID := c.Param("accountID")
+	if err := rt.db.SetAccountDisabled(accountID, disabled, accountUser.AccountUserID); err != nil {
+		var unknownAccountErr persistence.ErrUnknownAccount
+		if errors.As(err, &unknownAccountErr) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error updating account: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type adminJobResponse struct {
+	Job      string `json:"job"`
+	Affected int    `json:"affected"`
+}
+
+// getAdminJobs returns the status of all scheduled background jobs.
+func (rt *router) getAdminJobs(c *gin.Context) {
+	if rt.scheduler == nil {
+		c.JSON(http.StatusOK, []scheduler.Status{})
+		return
+	}
+	c.JSON(http.StatusOK, rt.scheduler.Status())
+}
+
+// postAdminJob runs the given maintenance job immediately instead of
+// waiting for its next scheduled run.
+func (rt *router) postAdminJob(c *gin.Context) {
+	if rt.scheduler != nil {
+		rt.triggerScheduledJob(c)
+		return
+	}
+	cfg := rt.getConfig()
+	jobs := map[string]func() (int, error){
+		"expire-events": func() (int, error) {
+			return rt.db.Expire(cfg.App.Retention.Duration(), config.RetentionDuration)
+		},
+		"expire-audit-log": func() (int, error) {
+			return rt.db.ExpireAuditLog(cfg.App.AuditRetention)
+		},
+		"expire-mails": func() (int, error) {
+			return rt.db.ExpireMails(cfg.Mailer.Retention)
+		},
+		"purge-retired-accounts": func() (int, error) {
+			return rt.db.PurgeRetiredAccounts(cfg.App.RetirementGracePeriod)
+		},
+	}
+	if cfg.App.AnomalyThreshold > 0 {
+		jobs["detect-anomalies"] = func() (int, error) {
+			return rt.db.DetectAnomalies(cfg.App.AnomalyThreshold, cfg.App.Retention.Duration())
+		}
+	}
+	if cfg.Aggregates.Enabled {
+		jobs["count-aggregates"] = func() (int, error) {
+			return rt.db.CountAggregates(cfg.Aggregates.Epsilon, cfg.Aggregates.Retention)
+		}
+	}
+	if cfg.Pings.Enabled {
+		jobs["expire-pings"] = func() (int, error) {
+			return rt.db.ExpirePings(cfg.Pings.Retention)
+		}
+	}
+	if queue, ok := rt.mailer.(interface{ Deliver() (int, error) }); ok {
+		jobs["deliver-mails"] = queue.Deliver
+	}
+
+	name := c.Param("job")
+	job, ok := jobs[name]
+	if !ok {
+		newJSONError(
+			fmt.Errorf("router: unknown job %s", name),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	affected, err := job()
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error running job %s: %w", name, err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, adminJobResponse{Job: name, Affected: affected})
+}
+
+// triggerScheduledJob runs a job using the scheduler, so it acquires the
+// same lock as scheduled runs and its result is reflected in the job status.
+func (rt *router) triggerScheduledJob(c *gin.Context) {
+	name := c.Param("job")
+	affected, err := rt.scheduler.Trigger(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, scheduler.ErrUnknownJob):
+			newJSONError(
+				fmt.Errorf("router: unknown job %s", name),
+				http.StatusNotFound,
+			).Pipe(c)
+		case errors.Is(err, scheduler.ErrSkipped):
+			newJSONError(
+				fmt.Errorf("router: job %s is already running", name),
+				http.StatusConflict,
+			).Pipe(c)
+		default:
+			newJSONError(
+				fmt.Errorf("router: error running job %s: %w", name, err),
+				http.StatusInternalServerError,
+			).Pipe(c)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, adminJobResponse{Job: name, Affected: affected})
+}
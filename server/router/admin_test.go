@@ -0,0 +1,224 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/scheduler"
+)
+
+type mockAdminDatabase struct {
+	persistence.Service
+	disableErr error
+	disabled   map[string]bool
+	purged     int
+}
+
+func (m *mockAdminDatabase) SetAccountDisabled(accountID string, disabled bool, accountUserID string) error {
+	if m.disableErr != nil {
+		return m.disableErr
+	}
+	m.disabled[accountID] = disabled
+	return nil
+}
+
+func (m *mockAdminDatabase) PurgeRetiredAccounts(gracePeriod time.Duration) (int, error) {
+	return m.purged, nil
+}
+
+func TestRouter_adminMiddleware(t *testing.T) {
+	tests := []struct {
+		name               string
+		token              string
+		header             string
+		expectedStatusCode int
+	}{
+		{
+			"valid token",
+			"secret",
+			"Bearer secret",
+			http.StatusOK,
+		},
+		{
+			"invalid token",
+			"secret",
+			"Bearer other",
+			http.StatusUnauthorized,
+		},
+		{
+			"no token configured",
+			"",
+			"Bearer ",
+			http.StatusUnauthorized,
+		},
+		{
+			"no header",
+			"secret",
+			"",
+			http.StatusUnauthorized,
+		},
+		{
+			"other scheme",
+			"secret",
+			"Basic c2VjcmV0",
+			http.StatusUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.AdminToken = config.EnvString(test.token)
+			rt := router{config: cfg}
+			m := gin.New()
+			m.GET("/", rt.adminMiddleware(contextKeyAuth), requireSuperAdmin(contextKeyAuth), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				r.Header.Set("Authorization", test.header)
+			}
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_postAdminDisableAccount(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockAdminDatabase
+		expectedStatusCode int
+	}{
+		{
+			"unknown account",
+			&mockAdminDatabase{disableErr: persistence.ErrUnknownAccount("unknown")},
+			http.StatusNotFound,
+		},
+		{
+			"database error",
+			&mockAdminDatabase{disableErr: errors.New("did not work")},
+			http.StatusInternalServerError,
+		},
+		{
+			"ok",
+			&mockAdminDatabase{disabled: map[string]bool{}},
+			http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.POST("/:accountID", rt.postAdminDisableAccount)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/account-a", nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedStatusCode == http.StatusNoContent && !test.db.disabled["account-a"] {
+				t.Errorf("Expected account to be disabled")
+			}
+		})
+	}
+}
+
+func TestRouter_postAdminJob(t *testing.T) {
+	tests := []struct {
+		name               string
+		job                string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			"unknown job",
+			"unknown",
+			http.StatusNotFound,
+			"",
+		},
+		{
+			"ok",
+			"purge-retired-accounts",
+			http.StatusOK,
+			`{"job":"purge-retired-accounts","affected":3}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: &mockAdminDatabase{purged: 3}, config: &config.Config{}}
+			m := gin.New()
+			m.POST("/:job", rt.postAdminJob)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/"+test.job, nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedBody != "" && w.Body.String() != test.expectedBody {
+				t.Errorf("Unexpected body %v", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_adminJobs_scheduler(t *testing.T) {
+	s := &scheduler.Scheduler{}
+	schedule, _ := scheduler.Parse("@hourly")
+	s.Add(scheduler.Job{Name: "expire-events", Schedule: schedule, Run: func() (int, error) {
+		return 7, nil
+	}})
+	s.Add(scheduler.Job{Name: "backup", Schedule: schedule, Run: func() (int, error) {
+		return 0, errors.New("did not work")
+	}})
+	rt := router{scheduler: s, config: &config.Config{}}
+	m := gin.New()
+	m.GET("/", rt.getAdminJobs)
+	m.POST("/:job", rt.postAdminJob)
+
+	tests := []struct {
+		method             string
+		path               string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{http.MethodPost, "/unknown", http.StatusNotFound, ""},
+		{http.MethodPost, "/backup", http.StatusInternalServerError, ""},
+		{http.MethodPost, "/expire-events", http.StatusOK, `{"job":"expire-events","affected":7}`},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("Unexpected status code %v for %s", w.Code, test.path)
+		}
+		if test.expectedBody != "" && w.Body.String() != test.expectedBody {
+			t.Errorf("Unexpected body %v", w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status code %v", w.Code)
+	}
+	var status []scheduler.Status
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(status) != 2 || status[0].LastError == "" || status[1].LastAffected != 7 {
+		t.Errorf("Unexpected status %v", status)
+	}
+}
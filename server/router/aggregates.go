@@ -0,0 +1,76 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+const (
+	defaultAggregateWindowDays = 30
+	maxAggregateWindowDays     = 366
+)
+
+// getAggregates returns the noised daily counters of an account. Other than
+// the encrypted events, counters can be read without access to the
+// account's private key.
+func (rt *router) getAggregates(c *gin.Context) {
+	accountID := c.Param("accountID")
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	if !accountUser.CanAccessAccount(accountID) {
+		newJSONError(
+			fmt.Errorf("router: account user does not have permissions to access account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	days, ok := windowDays(c)
+	if !ok {
+		return
+	}
+
+	result, err := rt.db.ListAggregates(accountID, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up aggregates: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// windowDays reads the number of days daily counters are requested for. In
+// case the value is invalid, an error response is written and false is
+// returned.
+func windowDays(c *gin.Context) (int, bool) {
+	d := c.Query("days")
+	if d == "" {
+		return defaultAggregateWindowDays, true
+	}
+	days, err := strconv.Atoi(d)
+	if err != nil || days < 1 || days > maxAggregateWindowDays {
+		newJSONError(
+			fmt.Errorf("router: invalid number of days %s, expected a value between 1 and %d", d, maxAggregateWindowDays),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return 0, false
+	}
+	return days, true
+}
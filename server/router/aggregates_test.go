@@ -0,0 +1,91 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockAggregatesDatabase struct {
+	persistence.Service
+	result []persistence.AggregateResult
+	err    error
+	calls  int
+}
+
+func (m *mockAggregatesDatabase) ListAggregates(accountID string, since time.Time) ([]persistence.AggregateResult, error) {
+	m.calls++
+	return m.result, m.err
+}
+
+func TestRouter_getAggregates(t *testing.T) {
+	accountUser := persistence.LoginResult{
+		AccountUserID: "user-a",
+		Accounts: []persistence.LoginAccountResult{
+			{AccountID: "account-a", Role: persistence.AccountUserRoleViewer},
+		},
+	}
+	tests := []struct {
+		name               string
+		db                 *mockAggregatesDatabase
+		path               string
+		expectedStatusCode int
+		expectedCalls      int
+	}{
+		{
+			"database error",
+			&mockAggregatesDatabase{err: errors.New("did not work")},
+			"/account-a",
+			http.StatusInternalServerError,
+			1,
+		},
+		{
+			"bad days",
+			&mockAggregatesDatabase{},
+			"/account-a?days=1000",
+			http.StatusBadRequest,
+			0,
+		},
+		{
+			"other account",
+			&mockAggregatesDatabase{},
+			"/account-z",
+			http.StatusForbidden,
+			0,
+		},
+		{
+			"ok",
+			&mockAggregatesDatabase{},
+			"/account-a?days=7",
+			http.StatusOK,
+			1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.GET("/:accountID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, accountUser)
+			}, rt.getAggregates)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, test.path, nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.db.calls != test.expectedCalls {
+				t.Errorf("Unexpected number of lookups %d", test.db.calls)
+			}
+		})
+	}
+}
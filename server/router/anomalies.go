@@ -0,0 +1,125 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+const defaultAnomalyWindowDays = 90
+
+// lookupAnomalies returns the anomalies recorded for the accounts the
+// requesting account user can access. In case false is returned, the request
+// has already been aborted.
+func (rt *router) lookupAnomalies(c *gin.Context) ([]persistence.AnomalyResult, bool) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return nil, false
+	}
+
+	accountIDs := accountUser.AccountIDs()
+	if accountID := c.Query("accountId"); accountID != "" {
+		if !accountUser.CanAccessAccount(accountID) {
+			newJSONError(
+				fmt.Errorf("router: account user is not allowed to access account %s", accountID),
+				http.StatusForbidden,
+			).Pipe(c)
+			return nil, false
+		}
+		accountIDs = []string{accountID}
+	}
+
+	days := defaultAnomalyWindowDays
+	if d := c.Query("days"); d != "" {
+		var err error
+		days, err = strconv.Atoi(d)
+		if err != nil || days < 1 {
+			newJSONError(
+				fmt.Errorf("router: invalid number of days %s", d),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return nil, false
+		}
+	}
+
+	result, err := rt.db.ListAnomalies(accountIDs, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up anomalies: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return nil, false
+	}
+	return result, true
+}
+
+func (rt *router) getAnomalies(c *gin.Context) {
+	result, ok := rt.lookupAnomalies(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (rt *router) getAnomaliesICS(c *gin.Context) {
+	result, ok := rt.lookupAnomalies(c)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(anomaliesCalendar(result, time.Now())))
+}
+
+var icsEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\n", `\n`,
+)
+
+// anomaliesCalendar renders the given anomalies as an iCalendar document
+// containing an all-day event for each of them.
+func anomaliesCalendar(anomalies []persistence.AnomalyResult, stamp time.Time) string {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Offen//Traffic Anomalies//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:Offen traffic anomalies",
+	}
+	for _, anomaly := range anomalies {
+		kind := "Unusually high"
+		if anomaly.Deviation < 0 {
+			kind = "Unusually low"
+		}
+		lines = append(
+			lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:%s@offen", anomaly.AnomalyID),
+			fmt.Sprintf("DTSTAMP:%s", stamp.UTC().Format("20060102T150405Z")),
+			fmt.Sprintf("DTSTART;VALUE=DATE:%s", anomaly.Day.UTC().Format("20060102")),
+			fmt.Sprintf("DTEND;VALUE=DATE:%s", anomaly.Day.UTC().AddDate(0, 0, 1).Format("20060102")),
+			fmt.Sprintf("SUMMARY:%s", icsEscaper.Replace(fmt.Sprintf(
+				"%s traffic for %s: %d events (expected %d)",
+				kind, anomaly.AccountName, anomaly.Count, int64(math.Round(anomaly.Expected)),
+			))),
+			"TRANSP:TRANSPARENT",
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
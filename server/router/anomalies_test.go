@@ -0,0 +1,127 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockAnomaliesDatabase struct {
+	persistence.Service
+	result     []persistence.AnomalyResult
+	err        error
+	accountIDs []string
+}
+
+func (m *mockAnomaliesDatabase) ListAnomalies(accountIDs []string, since time.Time) ([]persistence.AnomalyResult, error) {
+	m.accountIDs = accountIDs
+	return m.result, m.err
+}
+
+func TestRouter_getAnomalies(t *testing.T) {
+	accountUser := persistence.LoginResult{
+		AccountUserID: "user-a",
+		Accounts: []persistence.LoginAccountResult{
+			{AccountID: "account-a", Role: persistence.AccountUserRoleViewer},
+			{AccountID: "account-b", Role: persistence.AccountUserRoleViewer},
+		},
+	}
+	tests := []struct {
+		name               string
+		db                 *mockAnomaliesDatabase
+		query              string
+		expectedStatusCode int
+		expectedAccountIDs int
+	}{
+		{
+			"database error",
+			&mockAnomaliesDatabase{err: errors.New("did not work")},
+			"",
+			http.StatusInternalServerError,
+			2,
+		},
+		{
+			"bad days",
+			&mockAnomaliesDatabase{},
+			"?days=-1",
+			http.StatusBadRequest,
+			0,
+		},
+		{
+			"other account",
+			&mockAnomaliesDatabase{},
+			"?accountId=account-z",
+			http.StatusForbidden,
+			0,
+		},
+		{
+			"ok",
+			&mockAnomaliesDatabase{},
+			"",
+			http.StatusOK,
+			2,
+		},
+		{
+			"ok filtered",
+			&mockAnomaliesDatabase{},
+			"?accountId=account-b&days=7",
+			http.StatusOK,
+			1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.GET("/", func(c *gin.Context) {
+				c.Set(contextKeyAuth, accountUser)
+			}, rt.getAnomalies)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/"+test.query, nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if len(test.db.accountIDs) != test.expectedAccountIDs {
+				t.Errorf("Unexpected account ids %v", test.db.accountIDs)
+			}
+		})
+	}
+}
+
+func TestAnomaliesCalendar(t *testing.T) {
+	result := anomaliesCalendar([]persistence.AnomalyResult{
+		{
+			AnomalyID:   "anomaly-a",
+			AccountName: "Shop, Blog",
+			Day:         time.Date(2022, 5, 17, 0, 0, 0, 0, time.UTC),
+			Count:       412,
+			Expected:    99.6,
+			Deviation:   31.2,
+		},
+	}, time.Date(2022, 5, 18, 1, 0, 0, 0, time.UTC))
+
+	for _, line := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:anomaly-a@offen\r\n",
+		"DTSTAMP:20220518T010000Z\r\n",
+		"DTSTART;VALUE=DATE:20220517\r\n",
+		"DTEND;VALUE=DATE:20220518\r\n",
+		"SUMMARY:Unusually high traffic for Shop\\, Blog: 412 events (expected 100)\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(result, line) {
+			t.Errorf("Expected calendar to contain %q, got %s", line, result)
+		}
+	}
+}
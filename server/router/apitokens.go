@@ -0,0 +1,230 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+// apiTokenMiddleware authenticates requests carrying an API token in their
+// Authorization header and attaches a login result that is restricted to the
+// token's account to the request context. Requests without a bearer token
+// are passed on to the given fallback, which is expected to be the cookie
+// based account user middleware.
+func (rt *router) apiTokenMiddleware(scope, contextKey string, fallback gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			fallback(c)
+			return
+		}
+
+		token, err := rt.db.LookupAPIToken(strings.TrimPrefix(header, "Bearer "))
+		if err != nil {
+			newJSONError(
+				fmt.Errorf("router: error looking up api token: %v", err),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+		if !token.HasScope(scope) {
+			newJSONError(
+				fmt.Errorf("router: api token %s has not been granted scope %s", token.TokenID, scope),
+				http.StatusForbidden,
+			).Pipe(c)
+			return
+		}
+
+		// tokens act on behalf of their creator, so they are invalidated
+		// when the creator loses access to the account
+		creator, err := rt.db.LookupAccountUser(token.AccountUserID)
+		if err != nil || !creator.CanAccessAccount(token.AccountID) {
+			newJSONError(
+				fmt.Errorf("router: creator of api token %s cannot access account %s anymore", token.TokenID, token.AccountID),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+
+		// tokens are never granted more than read access unless they are
+		// allowed to manage the account, in which case they act using the
+		// role of their creator
+		account := persistence.LoginAccountResult{
+			AccountID: token.AccountID,
+			Role:      persistence.AccountUserRoleViewer,
+		}
+		result := persistence.LoginResult{
+			AccountUserID: creator.AccountUserID,
+		}
+		if token.HasScope(persistence.APITokenScopeManageAccount) {
+			result.AdminLevel = creator.AdminLevel
+			for _, creatorAccount := range creator.Accounts {
+				if creatorAccount.AccountID == token.AccountID {
+					account.Role = creatorAccount.Role
+				}
+			}
+		}
+		result.Accounts = []persistence.LoginAccountResult{account}
+		c.Set(contextKey, result)
+		c.Next()
+	}
+}
+
+type createAPITokenRequest struct {
+	AccountID string   `json:"accountId"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+}
+
+func (rt *router) postAPIToken(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("postAPIToken-%s", accountUser.AccountUserID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	var req createAPITokenRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	if err := persistence.ValidateAPITokenScopes(req.Scopes); err != nil {
+		newJSONError(
+			fmt.Errorf("router: invalid scopes for api token: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if !accountUser.CanAccessAccount(req.AccountID) {
+		newJSONError(
+			fmt.Errorf("router: account user is not allowed to access account %s", req.AccountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if scope == persistence.APITokenScopeManageAccount && !accountUser.HasRole(req.AccountID, persistence.AccountUserRoleAdmin) {
+			newJSONError(
+				fmt.Errorf("router: account user is not allowed to grant scope %s", scope),
+				http.StatusForbidden,
+			).Pipe(c)
+			return
+		}
+	}
+
+	result, err := rt.db.CreateAPIToken(req.AccountID, accountUser.AccountUserID, req.Name, req.Scopes)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error creating api token: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+func (rt *router) getAPITokens(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	tokens, err := rt.db.ListAPITokens(accountUser.AccountIDs())
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error listing api tokens: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (rt *router) deleteAPIToken(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	tokens, err := rt.db.ListAPITokens(accountUser.AccountIDs())
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error listing api tokens: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	tokenID := c.Param("tokenID")
+	var match *persistence.APITokenResult
+	for i := range tokens {
+		if tokens[i].TokenID == tokenID {
+			match = &tokens[i]
+			break
+		}
+	}
+	if match == nil {
+		newJSONError(
+			fmt.Errorf("router: api token %s not found", tokenID),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	// admins can revoke any token of their accounts, all other users
+	// can only revoke the tokens they have created themselves
+	if match.AccountUserID != accountUser.AccountUserID && !accountUser.HasRole(match.AccountID, persistence.AccountUserRoleAdmin) {
+		newJSONError(
+			fmt.Errorf("router: account user is not allowed to revoke api token %s", tokenID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.db.RevokeAPIToken(match.AccountID, tokenID, accountUser.AccountUserID); err != nil {
+		var errUnknown persistence.ErrUnknownAPIToken
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: api token %s not found", tokenID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error revoking api token: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,266 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockAPITokenDatabase struct {
+	persistence.Service
+	tokens  []persistence.APITokenResult
+	creator persistence.LoginResult
+	created []string
+	revoked []string
+}
+
+func (m *mockAPITokenDatabase) LookupAPIToken(token string) (persistence.APITokenResult, error) {
+	for _, t := range m.tokens {
+		if t.Token == token {
+			return t, nil
+		}
+	}
+	return persistence.APITokenResult{}, persistence.ErrUnknownAPIToken("unknown token")
+}
+
+func (m *mockAPITokenDatabase) LookupAccountUser(accountUserID string) (persistence.LoginResult, error) {
+	if accountUserID != m.creator.AccountUserID {
+		return persistence.LoginResult{}, fmt.Errorf("account user %s not found", accountUserID)
+	}
+	return m.creator, nil
+}
+
+func (m *mockAPITokenDatabase) CreateAPIToken(accountID, accountUserID, name string, scopes []string) (persistence.APITokenResult, error) {
+	m.created = append(m.created, accountID)
+	return persistence.APITokenResult{TokenID: "token-z", AccountID: accountID, Scopes: scopes, Token: "offen_xyz"}, nil
+}
+
+func (m *mockAPITokenDatabase) ListAPITokens(accountIDs []string) ([]persistence.APITokenResult, error) {
+	return m.tokens, nil
+}
+
+func (m *mockAPITokenDatabase) RevokeAPIToken(accountID, tokenID, accountUserID string) error {
+	m.revoked = append(m.revoked, tokenID)
+	return nil
+}
+
+func newAPITokenTestDatabase() *mockAPITokenDatabase {
+	return &mockAPITokenDatabase{
+		tokens: []persistence.APITokenResult{
+			{TokenID: "token-a", AccountID: "account-a", AccountUserID: "user-a", Scopes: []string{persistence.APITokenScopeReadStats}, Token: "offen_read"},
+			{TokenID: "token-b", AccountID: "account-a", AccountUserID: "user-a", Scopes: []string{persistence.APITokenScopeManageAccount}, Token: "offen_manage"},
+			{TokenID: "token-c", AccountID: "account-b", AccountUserID: "user-a", Scopes: []string{persistence.APITokenScopeReadStats}, Token: "offen_revoked"},
+		},
+		creator: persistence.LoginResult{
+			AccountUserID: "user-a",
+			AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
+			Accounts: []persistence.LoginAccountResult{
+				{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
+			},
+		},
+	}
+}
+
+func TestAPITokenMiddleware(t *testing.T) {
+	tests := []struct {
+		name               string
+		scope              string
+		header             string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			"fallback",
+			persistence.APITokenScopeReadStats,
+			"",
+			http.StatusTeapot,
+			"",
+		},
+		{
+			"unknown token",
+			persistence.APITokenScopeReadStats,
+			"Bearer offen_unknown",
+			http.StatusUnauthorized,
+			"",
+		},
+		{
+			"missing scope",
+			persistence.APITokenScopeManageAccount,
+			"Bearer offen_read",
+			http.StatusForbidden,
+			"",
+		},
+		{
+			"creator lost access",
+			persistence.APITokenScopeReadStats,
+			"Bearer offen_revoked",
+			http.StatusUnauthorized,
+			"",
+		},
+		{
+			"read stats",
+			persistence.APITokenScopeReadStats,
+			"Bearer offen_read",
+			http.StatusOK,
+			"user-a account-a false viewer",
+		},
+		{
+			"manage account",
+			persistence.APITokenScopeManageAccount,
+			"Bearer offen_manage",
+			http.StatusOK,
+			"user-a account-a true admin",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{
+				config: &config.Config{},
+				db:     newAPITokenTestDatabase(),
+			}
+			fallback := func(c *gin.Context) {
+				c.AbortWithStatus(http.StatusTeapot)
+			}
+			m := gin.New()
+			m.GET("/", rt.apiTokenMiddleware(test.scope, contextKeyAuth, fallback), func(c *gin.Context) {
+				result := c.Value(contextKeyAuth).(persistence.LoginResult)
+				c.String(http.StatusOK, "%s %s %v %s", result.AccountUserID, strings.Join(result.AccountIDs(), ","), result.IsSuperAdmin(), result.Accounts[0].Role)
+			})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				r.Header.Set("Authorization", test.header)
+			}
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedBody != "" && w.Body.String() != test.expectedBody {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_postAPIToken(t *testing.T) {
+	tests := []struct {
+		name               string
+		body               string
+		login              persistence.LoginResult
+		expectedStatusCode int
+	}{
+		{
+			"bad scope",
+			`{"accountId":"account-a","scopes":["root"]}`,
+			persistence.LoginResult{Accounts: []persistence.LoginAccountResult{{AccountID: "account-a"}}},
+			http.StatusBadRequest,
+		},
+		{
+			"no access",
+			`{"accountId":"account-b","scopes":["read-stats"]}`,
+			persistence.LoginResult{Accounts: []persistence.LoginAccountResult{{AccountID: "account-a"}}},
+			http.StatusForbidden,
+		},
+		{
+			"manage without admin",
+			`{"accountId":"account-a","scopes":["read-stats","manage-account"]}`,
+			persistence.LoginResult{Accounts: []persistence.LoginAccountResult{{AccountID: "account-a"}}},
+			http.StatusForbidden,
+		},
+		{
+			"ok",
+			`{"accountId":"account-a","name":"ci","scopes":["read-stats"]}`,
+			persistence.LoginResult{Accounts: []persistence.LoginAccountResult{{AccountID: "account-a"}}},
+			http.StatusCreated,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newAPITokenTestDatabase()
+			rt := router{
+				config: &config.Config{},
+				db:     db,
+			}
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyAuth, test.login)
+			}, rt.postAPIToken)
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body)))
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedStatusCode == http.StatusCreated {
+				if len(db.created) != 1 || !strings.Contains(w.Body.String(), `"token":"offen_xyz"`) {
+					t.Errorf("Unexpected response %s", w.Body.String())
+				}
+			} else if len(db.created) != 0 {
+				t.Errorf("Unexpected tokens created %v", db.created)
+			}
+		})
+	}
+}
+
+func TestRouter_deleteAPIToken(t *testing.T) {
+	tests := []struct {
+		name               string
+		tokenID            string
+		login              persistence.LoginResult
+		expectedStatusCode int
+	}{
+		{
+			"unknown token",
+			"token-z",
+			persistence.LoginResult{AccountUserID: "user-a"},
+			http.StatusNotFound,
+		},
+		{
+			"other user",
+			"token-a",
+			persistence.LoginResult{AccountUserID: "user-b"},
+			http.StatusForbidden,
+		},
+		{
+			"account admin",
+			"token-a",
+			persistence.LoginResult{AccountUserID: "user-b", Accounts: []persistence.LoginAccountResult{{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin}}},
+			http.StatusNoContent,
+		},
+		{
+			"creator",
+			"token-a",
+			persistence.LoginResult{AccountUserID: "user-a"},
+			http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newAPITokenTestDatabase()
+			rt := router{
+				config: &config.Config{},
+				db:     db,
+			}
+			m := gin.New()
+			m.DELETE("/:tokenID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, test.login)
+			}, rt.deleteAPIToken)
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/"+test.tokenID, nil))
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if (test.expectedStatusCode == http.StatusNoContent) != (len(db.revoked) == 1) {
+				t.Errorf("Unexpected revocations %v", db.revoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+func (rt *router) getAuditLog(c *gin.Context) {
+	accountID := c.Param("accountID")
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("getAuditLog-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if ok := accountUser.HasRole(accountID, persistence.AccountUserRoleAdmin); !ok {
+		newJSONError(
+			fmt.Errorf("router: account user does not have permissions to access audit log of account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	var limit int
+	if l := c.Query("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			newJSONError(
+				fmt.Errorf("router: invalid limit %s", l),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+
+	result, err := rt.db.GetAuditLog(accountID, limit)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up audit log: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,113 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockGetAuditLogDatabase struct {
+	persistence.Service
+	result []persistence.AuditLogResult
+	err    error
+}
+
+func (m *mockGetAuditLogDatabase) GetAuditLog(string, int) ([]persistence.AuditLogResult, error) {
+	return m.result, m.err
+}
+
+func TestRouter_getAuditLog(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 persistence.Service
+		user               persistence.LoginResult
+		url                string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			"not an admin",
+			&mockGetAuditLogDatabase{},
+			persistence.LoginResult{
+				Accounts: []persistence.LoginAccountResult{{AccountID: "account-a"}},
+			},
+			"/account-a",
+			http.StatusForbidden,
+			"",
+		},
+		{
+			"account out of scope",
+			&mockGetAuditLogDatabase{},
+			persistence.LoginResult{
+				AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
+				Accounts:   []persistence.LoginAccountResult{{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin}},
+			},
+			"/account-b",
+			http.StatusForbidden,
+			"",
+		},
+		{
+			"bad limit",
+			&mockGetAuditLogDatabase{},
+			persistence.LoginResult{
+				AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
+				Accounts:   []persistence.LoginAccountResult{{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin}},
+			},
+			"/account-a?limit=abc",
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"database error",
+			&mockGetAuditLogDatabase{err: errors.New("did not work")},
+			persistence.LoginResult{
+				AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
+				Accounts:   []persistence.LoginAccountResult{{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin}},
+			},
+			"/account-a",
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"ok",
+			&mockGetAuditLogDatabase{
+				result: []persistence.AuditLogResult{
+					{EntryID: "entry-a", AccountUserID: "user-a", Action: "login", Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+				},
+			},
+			persistence.LoginResult{
+				AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
+				Accounts:   []persistence.LoginAccountResult{{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin}},
+			},
+			"/account-a?limit=10",
+			http.StatusOK,
+			`[{"entryId":"entry-a","accountUserId":"user-a","action":"login","timestamp":"2022-01-01T00:00:00Z"}]`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db}
+			m := gin.New()
+			m.GET("/:accountID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, test.user)
+			}, rt.getAuditLog)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, test.url, nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedBody != "" && w.Body.String() != test.expectedBody {
+				t.Errorf("Unexpected response body %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// circuitBreaker stops passing requests to handlers after a number of
+// consecutive failures. Once the cooldown has passed, a single request is
+// passed on for probing whether the database is available again.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow checks whether a request can be passed on. In case it cannot, the
+// time after which the request should be retried is returned.
+func (b *circuitBreaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return true, 0
+	}
+	now := b.now()
+	if now.Before(b.openUntil) {
+		return false, b.openUntil.Sub(now)
+	}
+	if b.probing {
+		return false, time.Second
+	}
+	b.probing = true
+	return true, 0
+}
+
+// record stores the outcome of a request that has been passed on. It
+// returns true in case the breaker has been opened or closed by the call.
+func (b *circuitBreaker) record(success bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasOpen := !b.openUntil.IsZero()
+	if success {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		b.probing = false
+		return wasOpen
+	}
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+		b.probing = false
+		return !wasOpen
+	}
+	return false
+}
+
+// circuitBreakerMiddleware responds with 503 instead of calling the handler
+// while the database is considered unavailable, so requests do not pile up
+// waiting for a connection that is not going to succeed. Handlers responding
+// with a server error are considered to have failed.
+func (rt *router) circuitBreakerMiddleware(c *gin.Context) {
+	breaker := rt.breaker
+	if breaker == nil || breaker.threshold <= 0 {
+		c.Next()
+		return
+	}
+	if ok, retryAfter := breaker.allow(); !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		newJSONError(
+			errors.New("router: database is currently unavailable, try again later"),
+			http.StatusServiceUnavailable,
+		).Pipe(c)
+		return
+	}
+	c.Next()
+	failed := c.Writer.Status() >= http.StatusInternalServerError
+	if breaker.record(!failed) && rt.logger != nil {
+		if failed {
+			rt.logger.WithField("cooldown", breaker.cooldown.String()).Warn("Database seems unavailable, rejecting events")
+		} else {
+			rt.logger.Info("Database is available again, accepting events")
+		}
+	}
+}
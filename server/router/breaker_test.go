@@ -0,0 +1,89 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker(2, time.Second*10)
+	b.now = func() time.Time { return clock }
+
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("Expected closed breaker to allow requests")
+	}
+	if b.record(false) {
+		t.Error("Expected breaker to stay closed after first failure")
+	}
+	if !b.record(false) {
+		t.Error("Expected breaker to open after reaching threshold")
+	}
+	if ok, retryAfter := b.allow(); ok || retryAfter != time.Second*10 {
+		t.Errorf("Unexpected result %v, %v", ok, retryAfter)
+	}
+
+	clock = clock.Add(time.Second * 11)
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("Expected probe to be allowed after cooldown")
+	}
+	if ok, _ := b.allow(); ok {
+		t.Error("Expected only a single probe to be allowed")
+	}
+	if b.record(false) {
+		t.Error("Expected failing probe to not report a state change")
+	}
+	if ok, _ := b.allow(); ok {
+		t.Error("Expected breaker to open again after failing probe")
+	}
+
+	clock = clock.Add(time.Second * 11)
+	b.allow()
+	if !b.record(true) {
+		t.Error("Expected successful probe to close breaker")
+	}
+	if ok, _ := b.allow(); !ok {
+		t.Error("Expected closed breaker to allow requests")
+	}
+}
+
+func TestRouter_circuitBreakerMiddleware(t *testing.T) {
+	rt := &router{breaker: newCircuitBreaker(1, time.Second*5)}
+	status := http.StatusInternalServerError
+	calls := 0
+	m := gin.New()
+	m.POST("/", rt.circuitBreakerMiddleware, func(c *gin.Context) {
+		calls++
+		c.Status(status)
+	})
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusInternalServerError || calls != 1 {
+		t.Fatalf("Unexpected result %v after %d calls", w.Code, calls)
+	}
+
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusServiceUnavailable || calls != 1 {
+		t.Errorf("Unexpected result %v after %d calls", w.Code, calls)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "5" {
+		t.Errorf("Unexpected Retry-After header %v", retryAfter)
+	}
+
+	rt.breaker.now = func() time.Time { return time.Now().Add(time.Minute) }
+	status = http.StatusCreated
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("Unexpected result %v after %d calls", w.Code, calls)
+	}
+}
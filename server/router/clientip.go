@@ -0,0 +1,79 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/offen/offen/server/config"
+)
+
+// clientIP returns the IP address of the client that issued the request. In
+// case the request was forwarded by one of the given trusted proxies, the
+// X-Forwarded-For header is walked from right to left and the first address
+// that is not a trusted proxy is returned.
+func clientIP(r *http.Request, trustedProxies config.Networks) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !trustedProxies.Contains(ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !trustedProxies.Contains(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// reverseProxyNetworks are trusted to pass the client address in case the
+// application is configured to run behind a reverse proxy without listing
+// trusted proxies explicitly. Reverse proxies are expected to connect from
+// the same host or a private network.
+var reverseProxyNetworks = func() config.Networks {
+	var n config.Networks
+	n.Decode("127.0.0.0/8,::1,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7")
+	return n
+}()
+
+// trustedProxies returns the proxies that are allowed to pass the client
+// address. Explicitly configured proxies take precedence over the networks
+// trusted when running behind a reverse proxy.
+func (rt *router) trustedProxies() config.Networks {
+	cfg := rt.getConfig()
+	if len(cfg.Server.TrustedProxies) != 0 || !cfg.Server.ReverseProxy {
+		return cfg.Server.TrustedProxies
+	}
+	return reverseProxyNetworks
+}
+
+var (
+	ipv4AnonymizationMask = net.CIDRMask(24, 32)
+	ipv6AnonymizationMask = net.CIDRMask(48, 128)
+)
+
+// anonymizeIP truncates the given address by zeroing the last octet of IPv4
+// addresses and the last 80 bits of IPv6 addresses. A dash is returned in
+// case no address is given.
+func anonymizeIP(ip net.IP) string {
+	if ip == nil {
+		return "-"
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(ipv4AnonymizationMask).String()
+	}
+	return ip.Mask(ipv6AnonymizationMask).String()
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/offen/offen/server/config"
+)
+
+func TestClientIP(t *testing.T) {
+	var trusted config.Networks
+	if err := trusted.Decode("10.0.0.0/8"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		forwardedFor  string
+		expectedValue string
+	}{
+		{"direct", "203.0.113.7:1234", "", "203.0.113.7"},
+		{"untrusted proxy", "203.0.113.7:1234", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"trusted proxy chain", "10.0.0.1:1234", "192.0.2.1, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"trusted proxy without header", "10.0.0.1:1234", "", "10.0.0.1"},
+		{"ipv6", "[2001:db8::1]:1234", "", "2001:db8::1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			if test.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			if ip := clientIP(r, trusted); ip.String() != test.expectedValue {
+				t.Errorf("Expected %s, got %s", test.expectedValue, ip)
+			}
+		})
+	}
+}
+
+func TestRouter_trustedProxies(t *testing.T) {
+	var explicit config.Networks
+	if err := explicit.Decode("203.0.113.0/24"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	tests := []struct {
+		name           string
+		reverseProxy   bool
+		trustedProxies config.Networks
+		ip             string
+		expectedResult bool
+	}{
+		{"default", false, nil, "127.0.0.1", false},
+		{"reverse proxy", true, nil, "127.0.0.1", true},
+		{"reverse proxy private network", true, nil, "172.17.0.2", true},
+		{"reverse proxy public network", true, nil, "203.0.113.7", false},
+		{"explicit", false, explicit, "203.0.113.7", true},
+		{"explicit overrides reverse proxy", true, explicit, "127.0.0.1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Server.ReverseProxy = test.reverseProxy
+			cfg.Server.TrustedProxies = test.trustedProxies
+			rt := &router{config: cfg}
+			if result := rt.trustedProxies().Contains(net.ParseIP(test.ip)); result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := []struct {
+		name          string
+		ip            net.IP
+		expectedValue string
+	}{
+		{"nil", nil, "-"},
+		{"ipv4", net.ParseIP("203.0.113.77"), "203.0.113.0"},
+		{"ipv4 in ipv6", net.ParseIP("::ffff:203.0.113.77"), "203.0.113.0"},
+		{"ipv6", net.ParseIP("2001:db8:abcd:12:34:56:78:9a"), "2001:db8:abcd::"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if value := anonymizeIP(test.ip); value != test.expectedValue {
+				t.Errorf("Expected %s, got %s", test.expectedValue, value)
+			}
+		})
+	}
+}
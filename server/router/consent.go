@@ -0,0 +1,190 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/offen/offen/server/persistence"
+)
+
+// consentReceiptClaims are the contents of a consent receipt. The subject is
+// the identifier of the user the receipt has been issued to.
+type consentReceiptClaims struct {
+	ReceiptID     string   `json:"jti"`
+	Subject       string   `json:"sub"`
+	IssuedAt      int64    `json:"iat"`
+	PolicyVersion string   `json:"policyVersion"`
+	AccountIDs    []string `json:"accountIds"`
+}
+
+// maxAuditTargetLength is the size of the column audit log targets are
+// stored in.
+const maxAuditTargetLength = 64
+
+type consentResponse struct {
+	Receipt               string    `json:"receipt"`
+	PolicyVersion         string    `json:"policyVersion"`
+	PreviousPolicyVersion string    `json:"previousPolicyVersion,omitempty"`
+	AccountIDs            []string  `json:"accountIds"`
+	Issued                time.Time `json:"issued"`
+	Renewed               bool      `json:"renewed"`
+}
+
+// consentReceiptKey derives the key receipts are signed with from the given
+// secret of the instance.
+func consentReceiptKey(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("offen-consent-receipt"))
+	return mac.Sum(nil)
+}
+
+func (rt *router) signConsentReceipt(claims consentReceiptClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("router: error encoding consent receipt: %w", err)
+	}
+	signed, err := jws.Sign(payload, jwa.HS256, consentReceiptKey(rt.getConfig().Secret.Bytes()))
+	if err != nil {
+		return "", fmt.Errorf("router: error signing consent receipt: %w", err)
+	}
+	return string(signed), nil
+}
+
+// verifyConsentReceipt returns the claims of the given receipt in case it
+// has been signed by this instance. Receipts that have been signed before the
+// secret of the instance was rotated are checked against previous secrets.
+func (rt *router) verifyConsentReceipt(receipt string) (consentReceiptClaims, error) {
+	cfg := rt.getConfig()
+	secrets := [][]byte{cfg.Secret.Bytes()}
+	for _, secret := range cfg.PreviousSecrets {
+		secrets = append(secrets, secret.Bytes())
+	}
+	for _, secret := range secrets {
+		payload, err := jws.Verify([]byte(receipt), jwa.HS256, consentReceiptKey(secret))
+		if err != nil {
+			continue
+		}
+		var claims consentReceiptClaims
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			return consentReceiptClaims{}, fmt.Errorf("router: error decoding consent receipt: %w", err)
+		}
+		return claims, nil
+	}
+	return consentReceiptClaims{}, errors.New("router: consent receipt has not been signed by this instance")
+}
+
+// getConsent issues a signed receipt for the consent of the requesting user,
+// covering all accounts the user has opted in to under the current policy
+// version. Clients pass the receipt they have been issued before, which is
+// returned as is in case it is still current. Otherwise, a new receipt is
+// issued and recorded in the audit log of the affected accounts.
+func (rt *router) getConsent(c *gin.Context) {
+	userID := c.GetString(contextKeyCookie)
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("getConsent-%s", userID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	var previous *consentReceiptClaims
+	if receipt := c.Query("receipt"); receipt != "" {
+		claims, err := rt.verifyConsentReceipt(receipt)
+		if err != nil {
+			newJSONError(
+				fmt.Errorf("router: invalid consent receipt: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		if claims.Subject != userID {
+			newJSONError(
+				errors.New("router: consent receipt has been issued to another user"),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		previous = &claims
+	}
+
+	accountIDs, err := rt.db.ConsentedAccountIDs(userID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up consent scope: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	policyVersion := rt.getConfig().App.ConsentPolicyVersion
+	if previous != nil && previous.PolicyVersion == policyVersion && reflect.DeepEqual(previous.AccountIDs, accountIDs) {
+		c.JSON(http.StatusOK, consentResponse{
+			Receipt:       c.Query("receipt"),
+			PolicyVersion: policyVersion,
+			AccountIDs:    accountIDs,
+			Issued:        time.Unix(previous.IssuedAt, 0).UTC(),
+		})
+		return
+	}
+
+	receiptID, err := persistence.NewULID()
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error creating receipt id: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	now := time.Now().UTC()
+	receipt, err := rt.signConsentReceipt(consentReceiptClaims{
+		ReceiptID:     receiptID,
+		Subject:       userID,
+		IssuedAt:      now.Unix(),
+		PolicyVersion: policyVersion,
+		AccountIDs:    accountIDs,
+	})
+	if err != nil {
+		newJSONError(err, http.StatusInternalServerError).Pipe(c)
+		return
+	}
+
+	response := consentResponse{
+		Receipt:       receipt,
+		PolicyVersion: policyVersion,
+		AccountIDs:    accountIDs,
+		Issued:        now,
+		Renewed:       previous != nil,
+	}
+	target := fmt.Sprintf("%s %s", receiptID, policyVersion)
+	if previous != nil && previous.PolicyVersion != policyVersion {
+		response.PreviousPolicyVersion = previous.PolicyVersion
+		target = fmt.Sprintf("%s %s -> %s", receiptID, previous.PolicyVersion, policyVersion)
+	}
+	if len(target) > maxAuditTargetLength {
+		target = target[:maxAuditTargetLength]
+	}
+	// the user id is not recorded so that the audit log cannot be used
+	// for linking consent to users, the receipt id is sufficient for
+	// proving a receipt has been issued
+	if err := rt.db.RecordAuditLog("", accountIDs, persistence.AuditActionRecordConsent, target); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error recording consent: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockConsentDatabase struct {
+	persistence.Service
+	accountIDs []string
+	recorded   []string
+}
+
+func (m *mockConsentDatabase) ConsentedAccountIDs(userID string) ([]string, error) {
+	return m.accountIDs, nil
+}
+
+func (m *mockConsentDatabase) RecordAuditLog(accountUserID string, accountIDs []string, action, target string) error {
+	if action != persistence.AuditActionRecordConsent || accountUserID != "" {
+		return nil
+	}
+	m.recorded = append(m.recorded, target)
+	return nil
+}
+
+func newConsentTestRouter(db persistence.Service, policyVersion string) (*router, *gin.Engine) {
+	cfg := &config.Config{Secret: config.Bytes("secret")}
+	cfg.App.ConsentPolicyVersion = policyVersion
+	rt := &router{db: db, config: cfg}
+	m := gin.New()
+	m.GET("/", func(c *gin.Context) {
+		c.Set(contextKeyCookie, "user-id")
+		c.Next()
+	}, rt.getConsent)
+	return rt, m
+}
+
+func requestConsent(m *gin.Engine, receipt string) (int, consentResponse) {
+	w := httptest.NewRecorder()
+	target := "/"
+	if receipt != "" {
+		target += "?receipt=" + url.QueryEscape(receipt)
+	}
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	var response consentResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func TestRouter_getConsent(t *testing.T) {
+	t.Run("issue and reuse", func(t *testing.T) {
+		db := &mockConsentDatabase{accountIDs: []string{"account-a"}}
+		rt, m := newConsentTestRouter(db, "1")
+
+		code, issued := requestConsent(m, "")
+		if code != http.StatusOK || issued.Receipt == "" || issued.Renewed {
+			t.Fatalf("Unexpected response %d %v", code, issued)
+		}
+		claims, err := rt.verifyConsentReceipt(issued.Receipt)
+		if err != nil {
+			t.Fatalf("Unexpected error verifying receipt %v", err)
+		}
+		if claims.Subject != "user-id" || claims.PolicyVersion != "1" || !reflect.DeepEqual(claims.AccountIDs, []string{"account-a"}) {
+			t.Errorf("Unexpected claims %v", claims)
+		}
+
+		code, reused := requestConsent(m, issued.Receipt)
+		if code != http.StatusOK || reused.Receipt != issued.Receipt {
+			t.Errorf("Expected receipt to be reused, got %d %v", code, reused)
+		}
+		if len(db.recorded) != 1 {
+			t.Errorf("Expected a single audit log entry, got %v", db.recorded)
+		}
+	})
+	t.Run("policy change", func(t *testing.T) {
+		db := &mockConsentDatabase{accountIDs: []string{"account-a"}}
+		_, m := newConsentTestRouter(db, "1")
+		_, issued := requestConsent(m, "")
+
+		_, m = newConsentTestRouter(db, "2")
+		code, renewed := requestConsent(m, issued.Receipt)
+		if code != http.StatusOK || !renewed.Renewed || renewed.PreviousPolicyVersion != "1" || renewed.PolicyVersion != "2" {
+			t.Errorf("Unexpected response %d %v", code, renewed)
+		}
+		if len(db.recorded) != 2 {
+			t.Errorf("Expected two audit log entries, got %v", db.recorded)
+		}
+	})
+	t.Run("scope change", func(t *testing.T) {
+		db := &mockConsentDatabase{accountIDs: []string{"account-a"}}
+		_, m := newConsentTestRouter(db, "1")
+		_, issued := requestConsent(m, "")
+
+		db.accountIDs = []string{"account-a", "account-b"}
+		code, renewed := requestConsent(m, issued.Receipt)
+		if code != http.StatusOK || !renewed.Renewed || renewed.PreviousPolicyVersion != "" || renewed.Receipt == issued.Receipt {
+			t.Errorf("Unexpected response %d %v", code, renewed)
+		}
+	})
+	t.Run("bad receipt", func(t *testing.T) {
+		db := &mockConsentDatabase{}
+		rt, m := newConsentTestRouter(db, "1")
+		if code, _ := requestConsent(m, "not-a-receipt"); code != http.StatusBadRequest {
+			t.Errorf("Unexpected status code %d", code)
+		}
+		foreign, _ := rt.signConsentReceipt(consentReceiptClaims{Subject: "other-user", PolicyVersion: "1"})
+		if code, _ := requestConsent(m, foreign); code != http.StatusBadRequest {
+			t.Errorf("Unexpected status code %d", code)
+		}
+		if len(db.recorded) != 0 {
+			t.Errorf("Unexpected audit log entries %v", db.recorded)
+		}
+	})
+}
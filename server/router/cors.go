@@ -0,0 +1,163 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/location"
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+// isSameHost checks whether the given origin has the host the request has
+// been sent to.
+func isSameHost(origin string, r *http.Request) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// isSameOrigin checks whether the given origin is the origin the request
+// has been sent to, comparing both scheme and host.
+func isSameOrigin(origin string, c *gin.Context) bool {
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Host, c.Request.Host) {
+		return false
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if l := location.Get(c); l != nil {
+		scheme = l.Scheme
+	}
+	return strings.EqualFold(u.Scheme, scheme)
+}
+
+// requestAccountIDs returns the accounts a request refers to, which are
+// given in the `accountId` query parameter and in the JSON encoded request
+// body. The body is restored so handlers can read it again.
+func requestAccountIDs(c *gin.Context) ([]string, error) {
+	var result []string
+	if accountID := c.Query("accountId"); accountID != "" {
+		result = append(result, accountID)
+	}
+	if c.Request.Body == nil || c.Request.Method != http.MethodPost {
+		return result, nil
+	}
+	b, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("router: error reading request body: %w", err)
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(b))
+
+	type payload struct {
+		AccountID string `json:"accountId"`
+	}
+	var items []payload
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		if err := json.Unmarshal(b, &items); err != nil {
+			return nil, fmt.Errorf("router: error decoding request body: %w", err)
+		}
+	} else {
+		var item payload
+		if err := json.Unmarshal(b, &item); err != nil {
+			return nil, fmt.Errorf("router: error decoding request body: %w", err)
+		}
+		items = append(items, item)
+	}
+	for _, item := range items {
+		if item.AccountID != "" {
+			result = append(result, item.AccountID)
+		}
+	}
+	return result, nil
+}
+
+// accountAllowedOrigins returns the origins the given account accepts cross
+// origin requests from. Values are cached the same way retention periods are.
+func (rt *router) accountAllowedOrigins(accountID string) []string {
+	cache, cacheKey := rt.getCache(), fmt.Sprintf("account-allowed-origins-%s", accountID)
+	origins, ok := cache.Get(cacheKey)
+	if !ok {
+		account, err := rt.db.GetAccount(accountID, false, false, "")
+		if err != nil {
+			return nil
+		}
+		origins = strings.Join(account.AllowedOrigins, ",")
+		cache.Set(cacheKey, origins, time.Minute*5)
+	}
+	if origins == "" {
+		return nil
+	}
+	return strings.Split(origins, ",")
+}
+
+// corsMiddleware allows cross origin requests from the origins that have
+// been allowed by all accounts the request refers to. Same origin requests,
+// like the ones sent by the vault, are passed on as is. Cross origin requests
+// from any other origin are rejected. Preflight requests do not carry a body
+// and therefore cannot be attributed to an account, so they are answered
+// without any checks, which are applied to the actual request instead.
+func (rt *router) corsMiddleware(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	if origin == "" || isSameOrigin(origin, c) {
+		c.Next()
+		return
+	}
+	c.Header("Vary", "Origin")
+
+	if c.Request.Method == http.MethodOptions {
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Allow-Credentials", "true")
+		c.Header("Access-Control-Allow-Methods", "GET, POST")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, "+headerEmbeddingOrigin+", "+headerWriteKey)
+		c.Header("Access-Control-Max-Age", "600")
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+
+	accountIDs, err := requestAccountIDs(c)
+	if err != nil {
+		newJSONError(err, http.StatusBadRequest).Pipe(c)
+		return
+	}
+	if len(accountIDs) == 0 {
+		newJSONError(
+			errors.New("router: cross origin requests need to pass an account id"),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	normalized, err := persistence.NormalizeOrigin(origin)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: origin %s is not allowed", origin),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+	for _, accountID := range accountIDs {
+		if !contains(rt.accountAllowedOrigins(accountID), normalized) {
+			newJSONError(
+				fmt.Errorf("router: account %s does not allow requests from origin %s", accountID, origin),
+				http.StatusForbidden,
+			).Pipe(c)
+			return
+		}
+	}
+
+	c.Header("Access-Control-Allow-Origin", origin)
+	c.Header("Access-Control-Allow-Credentials", "true")
+	c.Next()
+}
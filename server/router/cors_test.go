@@ -0,0 +1,95 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockCORSDatabase struct {
+	persistence.Service
+	origins map[string][]string
+}
+
+func (m *mockCORSDatabase) GetAccount(accountID string, styles, events bool, since string) (persistence.AccountResult, error) {
+	origins, ok := m.origins[accountID]
+	if !ok {
+		return persistence.AccountResult{}, persistence.ErrUnknownAccount("unknown")
+	}
+	return persistence.AccountResult{AccountID: accountID, AllowedOrigins: origins}, nil
+}
+
+func TestRouter_corsMiddleware(t *testing.T) {
+	db := &mockCORSDatabase{
+		origins: map[string][]string{
+			"account-a": {"https://www.offen.dev", "http://localhost:8080"},
+			"account-b": {"https://www.offen.dev"},
+			"account-c": nil,
+		},
+	}
+	tests := []struct {
+		name               string
+		method             string
+		target             string
+		origin             string
+		body               string
+		expectedStatusCode int
+		expectedCORS       bool
+	}{
+		{"same origin", http.MethodPost, "/", "https://analytics.example", `{"accountId":"account-c"}`, http.StatusOK, false},
+		{"no origin", http.MethodPost, "/", "", `{"accountId":"account-c"}`, http.StatusOK, false},
+		{"allowed", http.MethodPost, "/", "https://www.offen.dev", `{"accountId":"account-a"}`, http.StatusOK, true},
+		{"allowed in query", http.MethodGet, "/?accountId=account-a", "http://localhost:8080", "", http.StatusOK, true},
+		{"not allowed", http.MethodPost, "/", "https://www.offen.dev", `{"accountId":"account-c"}`, http.StatusForbidden, false},
+		{"unknown account", http.MethodPost, "/", "https://www.offen.dev", `{"accountId":"account-z"}`, http.StatusForbidden, false},
+		{"no account", http.MethodPost, "/", "https://www.offen.dev", `{}`, http.StatusForbidden, false},
+		{"bad body", http.MethodPost, "/", "https://www.offen.dev", `{"accountId":`, http.StatusBadRequest, false},
+		{"batch allowed", http.MethodPost, "/", "https://www.offen.dev", `[{"accountId":"account-a"},{"accountId":"account-b"}]`, http.StatusOK, true},
+		{"batch partially allowed", http.MethodPost, "/", "http://localhost:8080", `[{"accountId":"account-a"},{"accountId":"account-b"}]`, http.StatusForbidden, false},
+		{"query and body", http.MethodPost, "/?accountId=account-a", "http://localhost:8080", `{"accountId":"account-b"}`, http.StatusForbidden, false},
+		{"same host different scheme", http.MethodPost, "/", "http://analytics.example", `{"accountId":"account-c"}`, http.StatusForbidden, false},
+		{"preflight", http.MethodOptions, "/?accountId=account-b", "https://www.offen.dev", "", http.StatusNoContent, true},
+		{"preflight without body", http.MethodOptions, "/", "https://www.offen.dev", "", http.StatusNoContent, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: db, config: &config.Config{}}
+			m := gin.New()
+			handler := func(c *gin.Context) {
+				// the body needs to be available to handlers after it
+				// has been inspected
+				b, _ := io.ReadAll(c.Request.Body)
+				if string(b) != test.body {
+					c.AbortWithError(http.StatusInternalServerError, errors.New("body has not been restored"))
+					return
+				}
+				c.Status(http.StatusOK)
+			}
+			m.Handle(http.MethodGet, "/", rt.corsMiddleware, handler)
+			m.Handle(http.MethodPost, "/", rt.corsMiddleware, handler)
+			m.Handle(http.MethodOptions, "/", rt.corsMiddleware)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(test.method, "https://analytics.example"+test.target, strings.NewReader(test.body))
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if allowed := w.Header().Get("Access-Control-Allow-Origin"); (allowed != "" && allowed == test.origin) != test.expectedCORS {
+				t.Errorf("Unexpected CORS header %v", allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+)
+
+const defaultCSP = "default-src 'self'; style-src 'self' 'unsafe-inline'; script-src 'self' 'unsafe-inline'; img-src 'self' data:"
+
+// cspPolicy is a Content-Security-Policy whose directives keep the order
+// they have been defined in.
+type cspPolicy []config.CSPDirective
+
+func parseCSP(s string) cspPolicy {
+	var directives config.CSPDirectives
+	if err := directives.Decode(s); err != nil {
+		panic(fmt.Sprintf("router: error parsing content security policy: %v", err))
+	}
+	return cspPolicy(directives)
+}
+
+// apply returns a copy of the policy with the given modifications applied.
+func (p cspPolicy) apply(mods config.CSPDirectives) cspPolicy {
+	result := make(cspPolicy, len(p))
+	for i, directive := range p {
+		result[i] = config.CSPDirective{
+			Name:    directive.Name,
+			Sources: append([]string{}, directive.Sources...),
+		}
+	}
+	for _, mod := range mods {
+		index := result.index(mod.Name)
+		if index == -1 {
+			result = append(result, config.CSPDirective{
+				Name:    mod.Name,
+				Sources: append([]string{}, mod.Sources...),
+			})
+			continue
+		}
+		if !mod.Extend {
+			result[index].Sources = nil
+		}
+		for _, source := range mod.Sources {
+			if !contains(result[index].Sources, source) {
+				result[index].Sources = append(result[index].Sources, source)
+			}
+		}
+	}
+	return result
+}
+
+// withNonce allows scripts and styles using the given nonce. Browsers that
+// support nonces ignore 'unsafe-inline' in this case.
+func (p cspPolicy) withNonce(nonce string) cspPolicy {
+	var defaultSources []string
+	if i := p.index("default-src"); i != -1 {
+		defaultSources = p[i].Sources
+	}
+	mods := config.CSPDirectives{}
+	for _, name := range []string{"script-src", "style-src"} {
+		sources := []string{fmt.Sprintf("'nonce-%s'", nonce)}
+		if p.index(name) == -1 {
+			// adding a directive that did not exist before must not
+			// revoke what has been allowed by default-src
+			sources = append(append([]string{}, defaultSources...), sources...)
+		}
+		mods = append(mods, config.CSPDirective{Name: name, Sources: sources, Extend: true})
+	}
+	return p.apply(mods)
+}
+
+func (p cspPolicy) index(name string) int {
+	for i, directive := range p {
+		if directive.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p cspPolicy) String() string {
+	directives := make([]string, len(p))
+	for i, directive := range p {
+		directives[i] = strings.Join(append([]string{directive.Name}, directive.Sources...), " ")
+	}
+	return strings.Join(directives, "; ")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("router: error generating nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// cspMiddleware sets the Content-Security-Policy header using the given
+// policy. In case nonces are enabled, a nonce is generated for each request
+// and stored in the request context using the given key, so templates can
+// add it to inline scripts and styles.
+func cspMiddleware(policy cspPolicy, useNonce bool, contextKey string) gin.HandlerFunc {
+	header := policy.String()
+	return func(c *gin.Context) {
+		if !useNonce {
+			c.Header("Content-Security-Policy", header)
+			c.Next()
+			return
+		}
+		nonce, err := newNonce()
+		if err != nil {
+			newJSONError(err, http.StatusInternalServerError).Pipe(c)
+			return
+		}
+		c.Set(contextKey, nonce)
+		c.Header("Content-Security-Policy", policy.withNonce(nonce).String())
+		c.Next()
+	}
+}
+
+// templateData adds the nonce of the current request to the given data
+// so it can be used by templates.
+func templateData(c *gin.Context, data map[string]interface{}) map[string]interface{} {
+	data["nonce"] = c.GetString(contextKeyNonce)
+	return data
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+)
+
+func TestCSPPolicy_apply(t *testing.T) {
+	tests := []struct {
+		name     string
+		mods     string
+		expected string
+	}{
+		{
+			"none",
+			"",
+			defaultCSP,
+		},
+		{
+			"override",
+			"img-src 'self' https://cdn.offen.dev",
+			"default-src 'self'; style-src 'self' 'unsafe-inline'; script-src 'self' 'unsafe-inline'; img-src 'self' https://cdn.offen.dev",
+		},
+		{
+			"extend",
+			"+img-src https://cdn.offen.dev 'self'; frame-ancestors 'none'",
+			"default-src 'self'; style-src 'self' 'unsafe-inline'; script-src 'self' 'unsafe-inline'; img-src 'self' data: https://cdn.offen.dev; frame-ancestors 'none'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mods config.CSPDirectives
+			if err := mods.Decode(test.mods); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			base := parseCSP(defaultCSP)
+			if result := base.apply(mods).String(); result != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, result)
+			}
+			if base.String() != defaultCSP {
+				t.Errorf("Unexpected modification of base policy %s", base)
+			}
+		})
+	}
+}
+
+func TestCSPPolicy_withNonce(t *testing.T) {
+	result := parseCSP("default-src 'self'; script-src 'self'").withNonce("abc").String()
+	expected := "default-src 'self'; script-src 'self' 'nonce-abc'; style-src 'self' 'nonce-abc'"
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestCSPMiddleware(t *testing.T) {
+	t.Run("static", func(t *testing.T) {
+		m := gin.New()
+		m.GET("/", cspMiddleware(parseCSP(defaultCSP), false, contextKeyNonce), func(c *gin.Context) {
+			c.String(http.StatusOK, c.GetString(contextKeyNonce))
+		})
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Header().Get("Content-Security-Policy") != defaultCSP {
+			t.Errorf("Unexpected header %v", w.Header().Get("Content-Security-Policy"))
+		}
+		if w.Body.String() != "" {
+			t.Errorf("Unexpected nonce %v", w.Body.String())
+		}
+	})
+	t.Run("nonce", func(t *testing.T) {
+		m := gin.New()
+		m.GET("/", cspMiddleware(parseCSP(defaultCSP), true, contextKeyNonce), func(c *gin.Context) {
+			c.String(http.StatusOK, c.GetString(contextKeyNonce))
+		})
+		var nonces []string
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			nonce := w.Body.String()
+			if nonce == "" {
+				t.Fatal("Expected nonce to be set")
+			}
+			if !strings.Contains(w.Header().Get("Content-Security-Policy"), "script-src 'self' 'unsafe-inline' 'nonce-"+nonce+"'") {
+				t.Errorf("Unexpected header %v", w.Header().Get("Content-Security-Policy"))
+			}
+			nonces = append(nonces, nonce)
+		}
+		if nonces[0] == nonces[1] {
+			t.Error("Expected nonces to differ between requests")
+		}
+	})
+}
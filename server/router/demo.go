@@ -0,0 +1,63 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+type resetDemoResponse struct {
+	Reset   bool   `json:"reset"`
+	Message string `json:"message,omitempty"`
+}
+
+func (rt *router) postResetDemo(c *gin.Context) {
+	if l := <-rt.getLimiter().LinearThrottle(time.Minute, "postResetDemo"); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	// the route is only available to super admins, who do not need to be
+	// a member of the demo account
+	accountUser, _ := c.Value(contextKeyAuth).(persistence.LoginResult)
+
+	// the demo account is the only account this handler will ever touch, so
+	// it is never read from the request
+	demoAccountID := rt.getConfig().App.DemoAccount
+	if demoAccountID == "" || rt.demoSeeder == nil {
+		c.JSON(http.StatusOK, resetDemoResponse{
+			Reset:   false,
+			Message: "No demo account is configured, nothing was reset.",
+		})
+		return
+	}
+
+	err := rt.db.ResetAccountEvents(demoAccountID, accountUser.AccountUserID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error removing demo data: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	err = rt.demoSeeder()
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error generating demo data: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, resetDemoResponse{Reset: true})
+}
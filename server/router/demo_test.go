@@ -0,0 +1,113 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockResetDemoDatabase struct {
+	persistence.Service
+	err      error
+	resetIDs []string
+}
+
+func (m *mockResetDemoDatabase) ResetAccountEvents(accountID, accountUserID string) error {
+	m.resetIDs = append(m.resetIDs, accountID)
+	return m.err
+}
+
+func TestRouter_postResetDemo(t *testing.T) {
+	// super admins authenticated using the admin token are not a member
+	// of any account
+	superAdmin := persistence.LoginResult{
+		AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
+	}
+	tests := []struct {
+		name               string
+		db                 *mockResetDemoDatabase
+		demoAccount        string
+		seeder             func() error
+		user               persistence.LoginResult
+		expectedStatusCode int
+		expectedBody       string
+		expectedResetIDs   []string
+	}{
+		{
+			"no demo account",
+			&mockResetDemoDatabase{},
+			"",
+			nil,
+			superAdmin,
+			http.StatusOK,
+			`{"reset":false,"message":"No demo account is configured, nothing was reset."}`,
+			nil,
+		},
+		{
+			"database error",
+			&mockResetDemoDatabase{err: errors.New("did not work")},
+			"demo-account",
+			func() error { return nil },
+			superAdmin,
+			http.StatusInternalServerError,
+			"",
+			[]string{"demo-account"},
+		},
+		{
+			"seeder error",
+			&mockResetDemoDatabase{},
+			"demo-account",
+			func() error { return errors.New("did not work") },
+			superAdmin,
+			http.StatusInternalServerError,
+			"",
+			[]string{"demo-account"},
+		},
+		{
+			"ok",
+			&mockResetDemoDatabase{},
+			"demo-account",
+			func() error { return nil },
+			superAdmin,
+			http.StatusOK,
+			`{"reset":true}`,
+			[]string{"demo-account"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.DemoAccount = test.demoAccount
+			rt := router{db: test.db, config: cfg, demoSeeder: test.seeder}
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyAuth, test.user)
+			}, rt.postResetDemo)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/?accountId=other-account", nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedBody != "" && w.Body.String() != test.expectedBody {
+				t.Errorf("Unexpected response body %s", w.Body.String())
+			}
+			if len(test.db.resetIDs) != len(test.expectedResetIDs) {
+				t.Fatalf("Expected resets of %v, got %v", test.expectedResetIDs, test.db.resetIDs)
+			}
+			for i, id := range test.expectedResetIDs {
+				if test.db.resetIDs[i] != id {
+					t.Errorf("Expected reset of %s, got %s", id, test.db.resetIDs[i])
+				}
+			}
+		})
+	}
+}
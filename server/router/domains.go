@@ -0,0 +1,244 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/domainverify"
+	"github.com/offen/offen/server/persistence"
+)
+
+// headerEmbeddingOrigin is sent by the vault, which is served from the same
+// origin as the API, so the Origin header of its requests does not tell
+// which site has embedded it.
+const headerEmbeddingOrigin = "X-Offen-Embedding-Origin"
+
+// domainOwner returns the account user of the request in case it is allowed
+// to manage the domains of the account in the request path. In case false is
+// returned, the request has already been aborted.
+func domainOwner(c *gin.Context) (persistence.LoginResult, string, bool) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return accountUser, "", false
+	}
+	accountID := c.Param("accountID")
+	if !accountUser.HasRole(accountID, persistence.AccountUserRoleAdmin) {
+		newJSONError(
+			fmt.Errorf("router: account user is not allowed to manage domains of account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return accountUser, "", false
+	}
+	return accountUser, accountID, true
+}
+
+func (rt *router) getDomains(c *gin.Context) {
+	_, accountID, ok := domainOwner(c)
+	if !ok {
+		return
+	}
+	domains, err := rt.db.ListAccountDomains(accountID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error listing domains: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, domains)
+}
+
+type createDomainRequest struct {
+	Domain string `json:"domain"`
+}
+
+func (rt *router) postDomain(c *gin.Context) {
+	accountUser, accountID, ok := domainOwner(c)
+	if !ok {
+		return
+	}
+
+	var req createDomainRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	if _, err := persistence.NormalizeDomain(req.Domain); err != nil {
+		newJSONError(
+			fmt.Errorf("router: invalid domain: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	result, err := rt.db.CreateAccountDomain(accountID, req.Domain, accountUser.AccountUserID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error creating domain: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+type verifyDomainRequest struct {
+	Method string `json:"method"`
+}
+
+func (rt *router) postDomainVerification(c *gin.Context) {
+	accountUser, accountID, ok := domainOwner(c)
+	if !ok {
+		return
+	}
+
+	var req verifyDomainRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	if req.Method != domainverify.MethodDNS && req.Method != domainverify.MethodMeta {
+		newJSONError(
+			fmt.Errorf("router: unknown verification method %s", req.Method),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	domainID := c.Param("domainID")
+	result, err := rt.db.VerifyAccountDomain(accountID, domainID, req.Method, accountUser.AccountUserID, rt.getDomainVerifier())
+	if err != nil {
+		var errUnknown persistence.ErrUnknownAccountDomain
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: domain %s not found", domainID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		if errors.Is(err, domainverify.ErrChallengeFailed) {
+			newJSONError(
+				fmt.Errorf("router: error verifying domain: %w", err),
+				http.StatusUnprocessableEntity,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error verifying domain: %w", err),
+			http.StatusBadGateway,
+		).Pipe(c)
+		return
+	}
+	rt.getCache().Delete(fmt.Sprintf("account-domains-%s", accountID))
+	c.JSON(http.StatusOK, result)
+}
+
+func (rt *router) deleteDomain(c *gin.Context) {
+	accountUser, accountID, ok := domainOwner(c)
+	if !ok {
+		return
+	}
+
+	domainID := c.Param("domainID")
+	if err := rt.db.DeleteAccountDomain(accountID, domainID, accountUser.AccountUserID); err != nil {
+		var errUnknown persistence.ErrUnknownAccountDomain
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: domain %s not found", domainID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error deleting domain: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	rt.getCache().Delete(fmt.Sprintf("account-domains-%s", accountID))
+	c.Status(http.StatusNoContent)
+}
+
+// accountDomains returns the verified domains of the given account. As this
+// is looked up for each ingested event, values are cached for a short time.
+func (rt *router) accountDomains(accountID string) ([]string, error) {
+	cache, cacheKey := rt.getCache(), fmt.Sprintf("account-domains-%s", accountID)
+	if value, ok := cache.Get(cacheKey); ok {
+		if value == "" {
+			return nil, nil
+		}
+		return strings.Split(value, ","), nil
+	}
+	domains, err := rt.db.ListAccountDomains(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("router: error looking up domains of account %s: %w", accountID, err)
+	}
+	var verified []string
+	for _, d := range domains {
+		if d.Verified != nil {
+			verified = append(verified, d.Domain)
+		}
+	}
+	cache.Set(cacheKey, strings.Join(verified, ","), time.Minute*5)
+	return verified, nil
+}
+
+// originAllowed checks whether the given request is allowed to send events
+// for the given account. In case enforcement is enabled, accounts that have
+// verified at least one domain only accept events from these domains or
+// their subdomains. Accounts without verified domains accept all events.
+func (rt *router) originAllowed(r *http.Request, accountID string) (bool, error) {
+	if c := rt.getConfig(); c == nil || !c.App.EnforceDomains {
+		return true, nil
+	}
+	domains, err := rt.accountDomains(accountID)
+	if err != nil {
+		return false, err
+	}
+	if len(domains) == 0 {
+		return true, nil
+	}
+	host := eventOriginHost(r)
+	if host == "" {
+		return false, nil
+	}
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// eventOriginHost returns the host of the site that has sent the given
+// request. Same origin requests are sent by the vault, which passes the
+// origin of the site embedding it in a header.
+func eventOriginHost(r *http.Request) string {
+	origin := r.Header.Get("Origin")
+	if origin == "" || isSameHost(origin, r) {
+		origin = r.Header.Get(headerEmbeddingOrigin)
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
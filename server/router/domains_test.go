@@ -0,0 +1,181 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/domainverify"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockDomainDatabase struct {
+	persistence.Service
+	domains   []persistence.AccountDomainResult
+	listErr   error
+	verifyErr error
+	deleteErr error
+}
+
+func (m *mockDomainDatabase) ListAccountDomains(accountID string) ([]persistence.AccountDomainResult, error) {
+	return m.domains, m.listErr
+}
+
+func (m *mockDomainDatabase) CreateAccountDomain(accountID, domain, accountUserID string) (persistence.AccountDomainResult, error) {
+	return persistence.AccountDomainResult{DomainID: "domain-a", Domain: domain}, nil
+}
+
+func (m *mockDomainDatabase) VerifyAccountDomain(accountID, domainID, method, accountUserID string, v domainverify.Verifier) (persistence.AccountDomainResult, error) {
+	return persistence.AccountDomainResult{DomainID: domainID}, m.verifyErr
+}
+
+func (m *mockDomainDatabase) DeleteAccountDomain(accountID, domainID, accountUserID string) error {
+	return m.deleteErr
+}
+
+var domainAccountUser = persistence.LoginResult{
+	AccountUserID: "user-a",
+	Accounts: []persistence.LoginAccountResult{
+		{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
+		{AccountID: "account-b", Role: persistence.AccountUserRoleViewer},
+	},
+}
+
+func TestRouter_postDomain(t *testing.T) {
+	tests := []struct {
+		name               string
+		path               string
+		body               string
+		expectedStatusCode int
+	}{
+		{"bad payload", "/accounts/account-a/domains", `{"domain":`, http.StatusBadRequest},
+		{"invalid domain", "/accounts/account-a/domains", `{"domain":"https://www.offen.dev"}`, http.StatusBadRequest},
+		{"not an admin", "/accounts/account-b/domains", `{"domain":"www.offen.dev"}`, http.StatusForbidden},
+		{"ok", "/accounts/account-a/domains", `{"domain":"www.offen.dev"}`, http.StatusCreated},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: &mockDomainDatabase{}, config: &config.Config{}}
+			m := gin.New()
+			m.POST("/accounts/:accountID/domains", func(c *gin.Context) {
+				c.Set(contextKeyAuth, domainAccountUser)
+			}, rt.postDomain)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body))
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_postDomainVerification(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockDomainDatabase
+		body               string
+		expectedStatusCode int
+	}{
+		{"unknown method", &mockDomainDatabase{}, `{"method":"carrier-pigeon"}`, http.StatusBadRequest},
+		{"unknown domain", &mockDomainDatabase{verifyErr: persistence.ErrUnknownAccountDomain("unknown")}, `{"method":"dns"}`, http.StatusNotFound},
+		{"challenge failed", &mockDomainDatabase{verifyErr: fmt.Errorf("no: %w", domainverify.ErrChallengeFailed)}, `{"method":"dns"}`, http.StatusUnprocessableEntity},
+		{"lookup error", &mockDomainDatabase{verifyErr: errors.New("did not work")}, `{"method":"meta"}`, http.StatusBadGateway},
+		{"ok", &mockDomainDatabase{}, `{"method":"meta"}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.POST("/accounts/:accountID/domains/:domainID/verify", func(c *gin.Context) {
+				c.Set(contextKeyAuth, domainAccountUser)
+			}, rt.postDomainVerification)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/accounts/account-a/domains/domain-a/verify", strings.NewReader(test.body))
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_deleteDomain(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockDomainDatabase
+		expectedStatusCode int
+	}{
+		{"unknown domain", &mockDomainDatabase{deleteErr: persistence.ErrUnknownAccountDomain("unknown")}, http.StatusNotFound},
+		{"database error", &mockDomainDatabase{deleteErr: errors.New("did not work")}, http.StatusInternalServerError},
+		{"ok", &mockDomainDatabase{}, http.StatusNoContent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.DELETE("/accounts/:accountID/domains/:domainID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, domainAccountUser)
+			}, rt.deleteDomain)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodDelete, "/accounts/account-a/domains/domain-a", nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_originAllowed(t *testing.T) {
+	verified := time.Now()
+	domains := []persistence.AccountDomainResult{
+		{Domain: "offen.dev", Verified: &verified},
+		{Domain: "squatted.example"},
+	}
+	tests := []struct {
+		name           string
+		enforce        bool
+		db             *mockDomainDatabase
+		headers        map[string]string
+		expectedResult bool
+		expectError    bool
+	}{
+		{"not enforced", false, &mockDomainDatabase{domains: domains}, map[string]string{"Origin": "https://evil.example"}, true, false},
+		{"no verified domains", true, &mockDomainDatabase{domains: domains[1:]}, map[string]string{"Origin": "https://evil.example"}, true, false},
+		{"database error", true, &mockDomainDatabase{listErr: errors.New("did not work")}, nil, false, true},
+		{"cross origin match", true, &mockDomainDatabase{domains: domains}, map[string]string{"Origin": "https://www.offen.dev"}, true, false},
+		{"cross origin mismatch", true, &mockDomainDatabase{domains: domains}, map[string]string{"Origin": "https://notoffen.dev"}, false, false},
+		{"unverified domain", true, &mockDomainDatabase{domains: domains}, map[string]string{"Origin": "https://squatted.example"}, false, false},
+		{"vault", true, &mockDomainDatabase{domains: domains}, map[string]string{"Origin": "https://analytics.example", headerEmbeddingOrigin: "https://offen.dev"}, true, false},
+		{"vault mismatch", true, &mockDomainDatabase{domains: domains}, map[string]string{"Origin": "https://analytics.example", headerEmbeddingOrigin: "https://evil.example"}, false, false},
+		{"no origin", true, &mockDomainDatabase{domains: domains}, nil, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.EnforceDomains = test.enforce
+			rt := router{db: test.db, config: cfg}
+			r := httptest.NewRequest(http.MethodPost, "https://analytics.example/api/events", nil)
+			for key, value := range test.headers {
+				r.Header.Set(key, value)
+			}
+			result, err := rt.originAllowed(r, "account-a")
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if result != test.expectedResult {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+		})
+	}
+}
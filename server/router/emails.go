@@ -0,0 +1,69 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/mailer"
+)
+
+type emailPreviewResponse struct {
+	Email   string `json:"email"`
+	Locale  string `json:"locale"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// getAdminEmailPreview renders the given email using sample data, so admins
+// can check the result of overriding templates without sending emails. The
+// locale defaults to the one negotiated for the request.
+func (rt *router) getAdminEmailPreview(c *gin.Context) {
+	if rt.emailTemplates == nil {
+		newJSONError(
+			errors.New("router: email templates are not available"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	email := c.Param("email")
+	data, ok := mailer.TemplateSamples[email]
+	if !ok {
+		newJSONError(
+			fmt.Errorf("router: unknown email %s", email),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	locale := rt.negotiateLocale(c.Request)
+	if requested := c.Query("locale"); requested != "" {
+		if _, ok := rt.localized[requested]; !ok && requested != rt.getConfig().App.Locale.String() {
+			newJSONError(
+				fmt.Errorf("router: unsupported locale %s", requested),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		locale = requested
+	}
+
+	subject, body, err := rt.emailTemplates.Render(locale, email, data)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error rendering email: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, emailPreviewResponse{
+		Email:   email,
+		Locale:  locale,
+		Subject: subject,
+		Body:    body,
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/mailer"
+)
+
+func TestRouter_getAdminEmailPreview(t *testing.T) {
+	base := map[string]*template.Template{}
+	for _, locale := range []string{"en", "de"} {
+		base[locale] = template.Must(template.New("emails").Parse(`
+{{ define "subject_reset_password" }}subject ` + locale + `{{ end }}
+{{ define "body_reset_password" }}{{ .url }}{{ end }}
+		`))
+	}
+	emails, err := mailer.NewTemplates(base, "en", "")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	tests := []struct {
+		name               string
+		path               string
+		acceptLanguage     string
+		expectedStatusCode int
+		expectedResult     *emailPreviewResponse
+	}{
+		{
+			"default locale",
+			"/reset_password",
+			"",
+			http.StatusOK,
+			&emailPreviewResponse{Email: "reset_password", Locale: "en", Subject: "subject en", Body: "https://offen.example.com/reset-password/?token=example"},
+		},
+		{
+			"negotiated locale",
+			"/reset_password",
+			"de-DE",
+			http.StatusOK,
+			&emailPreviewResponse{Email: "reset_password", Locale: "de", Subject: "subject de", Body: "https://offen.example.com/reset-password/?token=example"},
+		},
+		{
+			"requested locale",
+			"/reset_password?locale=en",
+			"de-DE",
+			http.StatusOK,
+			&emailPreviewResponse{Email: "reset_password", Locale: "en", Subject: "subject en", Body: "https://offen.example.com/reset-password/?token=example"},
+		},
+		{
+			"unsupported locale",
+			"/reset_password?locale=xx",
+			"",
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"unknown email",
+			"/welcome",
+			"",
+			http.StatusNotFound,
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.Locale = config.Locale("en")
+			rt := &router{config: cfg}
+			WithEmailTemplates(emails)(rt)
+			WithLocalizedTemplates("en", template.New("en"))(rt)
+			WithLocalizedTemplates("de", template.New("de"))(rt)
+
+			m := gin.New()
+			m.GET("/:email", rt.getAdminEmailPreview)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", test.acceptLanguage)
+			}
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedResult == nil {
+				return
+			}
+			var result emailPreviewResponse
+			json.Unmarshal(w.Body.Bytes(), &result)
+			if !reflect.DeepEqual(*test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", *test.expectedResult, result)
+			}
+		})
+	}
+}
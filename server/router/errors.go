@@ -8,6 +8,8 @@ import "github.com/gin-gonic/gin"
 type errorResponse struct {
 	Error  string `json:"error"`
 	Status int    `json:"status"`
+	// Violations lists the requirements a submitted value did not meet.
+	Violations []string `json:"violations,omitempty"`
 }
 
 func (e *errorResponse) Pipe(c *gin.Context) {
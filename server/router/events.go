@@ -7,15 +7,33 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
 )
 
+// maxPurgeAccounts limits the number of accounts a single purge request can
+// target.
+const maxPurgeAccounts = 100
+
+type purgePayload struct {
+	AccountIDs []string `json:"accountIds"`
+}
+
 type inboundEventPayload struct {
 	AccountID string `json:"accountId"`
 	Payload   string `json:"payload"`
+	// EventType is the name of a custom event type registered for the
+	// account. Untyped events leave it empty.
+	EventType string `json:"eventType,omitempty"`
+	// ClientEventID is an optional identifier picked by the client that is
+	// used for skipping retried events.
+	ClientEventID string `json:"clientEventId,omitempty"`
 }
 
 type ackResponse struct {
@@ -26,7 +44,7 @@ var errBadRequestContext = errors.New("could not use user id in request context"
 
 func (rt *router) postEvents(c *gin.Context) {
 	userID := c.GetString(contextKeyCookie)
-	if l := <-rt.getLimiter().LinearThrottle(time.Second/2, fmt.Sprintf("postEvents-%s", userID)); l.Error != nil {
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit(rt.getConfig().RateLimit.Events), fmt.Sprintf("postEvents-%s", userID)); l.Error != nil {
 		newJSONError(
 			fmt.Errorf("router: error rate limiting request: %w", l.Error),
 			http.StatusTooManyRequests,
@@ -35,15 +53,74 @@ func (rt *router) postEvents(c *gin.Context) {
 	}
 
 	evt := inboundEventPayload{}
-	if err := c.BindJSON(&evt); err != nil {
+	if !bindPayload(c, &evt) {
+		return
+	}
+
+	botPolicy := config.BotPolicyAllow
+	if c.GetBool(contextKeyBot) {
+		botPolicy = rt.accountBotPolicy(evt.AccountID)
+	}
+	// events of crawlers are dropped the same way events without consent are
+	if botPolicy == config.BotPolicyReject {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	if allowed, err := rt.originAllowed(c.Request, evt.AccountID); err != nil {
 		newJSONError(
-			fmt.Errorf("router: error decoding request payload: %v", err),
-			http.StatusBadRequest,
+			fmt.Errorf("router: error checking origin of event: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	} else if !allowed {
+		newJSONError(
+			fmt.Errorf("router: account %s does not accept events from this origin", evt.AccountID),
+			http.StatusForbidden,
 		).Pipe(c)
 		return
 	}
 
-	if err := rt.db.Insert(userID, evt.AccountID, evt.Payload, nil); err != nil {
+	// retried requests are acknowledged without being inserted again so
+	// that clients on flaky connections do not count visits twice
+	idempotencyKey := c.GetHeader(headerIdempotencyKey)
+	if idempotencyKey == "" {
+		idempotencyKey = evt.ClientEventID
+	}
+	if violations := validateIdempotencyKey(headerIdempotencyKey, idempotencyKey); len(violations) != 0 {
+		pipeViolations(c, violations)
+		return
+	}
+	var idempotencyCacheKey string
+	if idempotencyKey != "" && rt.getConfig().App.IdempotencyWindow > 0 {
+		idempotencyCacheKey = idempotencyCacheKeyFor(userID, evt.AccountID, idempotencyKey)
+		switch rt.claimIdempotencyKey(idempotencyCacheKey) {
+		case idempotencyDone:
+			c.Header(headerIdempotentReplayed, "true")
+			c.JSON(http.StatusCreated, ackResponse{true})
+			return
+		case idempotencyPending:
+			newJSONError(
+				errors.New("router: a request using the same idempotency key is currently being handled"),
+				http.StatusConflict,
+			).Pipe(c)
+			return
+		}
+	}
+
+	// users sending a privacy signal might be counted without linking
+	// their events to them, depending on the configured policy
+	anonymous := c.GetBool(contextKeyAnonymous)
+	insertUserID := userID
+	if anonymous {
+		insertUserID = ""
+	}
+
+	err := rt.db.Insert(insertUserID, evt.AccountID, evt.EventType, evt.Payload, nil)
+	if idempotencyCacheKey != "" {
+		rt.releaseIdempotencyKey(idempotencyCacheKey, err == nil)
+	}
+	if err != nil {
 		var unknownAccountErr persistence.ErrUnknownAccount
 		if errors.As(err, &unknownAccountErr) {
 			newJSONError(
@@ -62,6 +139,33 @@ func (rt *router) postEvents(c *gin.Context) {
 			return
 		}
 
+		var unknownEventTypeErr persistence.ErrUnknownEventType
+		if errors.As(err, &unknownEventTypeErr) {
+			newJSONError(
+				fmt.Errorf("router: error inserting event: %w", unknownEventTypeErr),
+				http.StatusUnprocessableEntity,
+			).Pipe(c)
+			return
+		}
+
+		var disabledErr persistence.ErrAccountDisabled
+		if errors.As(err, &disabledErr) {
+			newJSONError(
+				fmt.Errorf("router: error inserting event: %w", disabledErr),
+				http.StatusForbidden,
+			).Pipe(c)
+			return
+		}
+
+		var quotaErr persistence.ErrQuotaExceeded
+		if errors.As(err, &quotaErr) {
+			newJSONError(
+				fmt.Errorf("router: error inserting event: %w", quotaErr),
+				quotaStatusCode(quotaErr),
+			).Pipe(c)
+			return
+		}
+
 		newJSONError(
 			fmt.Errorf("router: error persisting event: %v", err),
 			http.StatusInternalServerError,
@@ -69,13 +173,235 @@ func (rt *router) postEvents(c *gin.Context) {
 		return
 	}
 
-	http.SetCookie(
-		c.Writer,
-		rt.userCookie(userID, c.GetBool(contextKeySecureContext)),
-	)
+	rt.metrics.Counter(metricEventsIngested, "Number of events that have been ingested.").Inc()
+	if botPolicy == config.BotPolicyFlag {
+		rt.metrics.Counter(metricEventsFlagged, "Number of ingested events that have been sent by crawlers.").Inc()
+	}
+	if !anonymous {
+		http.SetCookie(
+			c.Writer,
+			rt.userCookie(userID, rt.userCookieLifetime(evt.AccountID), c.GetBool(contextKeySecureContext)),
+		)
+	}
+	// events that have only been enqueued are not yet visible when querying
+	if rt.getConfig().AsyncEventAcknowledgement() {
+		c.JSON(http.StatusAccepted, ackResponse{true})
+		return
+	}
 	c.JSON(http.StatusCreated, ackResponse{true})
 }
 
+const maxEventBatchSize = 50
+
+type batchItemResponse struct {
+	Ack    bool   `json:"ack"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchItemResponse `json:"results"`
+}
+
+// postEventsBatch accepts multiple events at once so clients can buffer
+// events and flush them in a single request, e.g. when a page is unloaded.
+// Each event is validated on its own and the response contains a result for
+// each item in the order they were received.
+func (rt *router) postEventsBatch(c *gin.Context) {
+	userID := c.GetString(contextKeyCookie)
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit(rt.getConfig().RateLimit.Events), fmt.Sprintf("postEventsBatch-%s", userID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	var payload []inboundEventPayload
+	if !bindPayload(c, &payload) {
+		return
+	}
+	if len(payload) == 0 || len(payload) > maxEventBatchSize {
+		newJSONError(
+			fmt.Errorf("router: expected between 1 and %d events, received %d", maxEventBatchSize, len(payload)),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	candidates := make([]batchCandidate, len(payload))
+	for i, evt := range payload {
+		candidates[i] = batchCandidate{inboundEventPayload: evt}
+		if !rt.featureEnabled(featureBatchIngestion, evt.AccountID) {
+			candidates[i].rejection = &batchItemResponse{
+				Status: http.StatusNotFound,
+				Error:  fmt.Sprintf("router: batch ingestion is not enabled for account %s", evt.AccountID),
+			}
+		}
+	}
+	rt.insertBatch(c, userID, candidates)
+}
+
+// batchCandidate is an event that is inserted as part of a batch.
+type batchCandidate struct {
+	inboundEventPayload
+	recordedAt time.Time
+	// rejection is set in case the event has already been rejected when
+	// decoding the request.
+	rejection *batchItemResponse
+}
+
+// insertBatch validates and inserts the given events, responding with a
+// result for each of them.
+func (rt *router) insertBatch(c *gin.Context, userID string, payload []batchCandidate) {
+	response := batchResponse{Results: make([]batchItemResponse, len(payload))}
+	isBot := c.GetBool(contextKeyBot)
+	var batch []persistence.BatchEvent
+	// indices maps the position of each inserted event to its position
+	// in the payload, as events of crawlers might have been skipped
+	var indices []int
+	// cacheKeys holds the idempotency cache key of each inserted event, if any
+	var cacheKeys []string
+	idempotencyWindow := rt.getConfig().App.IdempotencyWindow
+	for i, evt := range payload {
+		if evt.rejection != nil {
+			response.Results[i] = *evt.rejection
+			continue
+		}
+		if violations := evt.validate(); len(violations) != 0 {
+			response.Results[i] = batchItemResponse{
+				Status: http.StatusUnprocessableEntity,
+				Error:  fmt.Sprintf("router: event is invalid: %s", strings.Join(violations, ", ")),
+			}
+			continue
+		}
+		if isBot && rt.accountBotPolicy(evt.AccountID) == config.BotPolicyReject {
+			response.Results[i] = batchItemResponse{Status: http.StatusNoContent}
+			continue
+		}
+		if allowed, err := rt.originAllowed(c.Request, evt.AccountID); err != nil {
+			response.Results[i] = batchItemResponse{Status: http.StatusInternalServerError, Error: err.Error()}
+			continue
+		} else if !allowed {
+			response.Results[i] = batchItemResponse{
+				Status: http.StatusForbidden,
+				Error:  fmt.Sprintf("router: account %s does not accept events from this origin", evt.AccountID),
+			}
+			continue
+		}
+		var cacheKey string
+		if evt.ClientEventID != "" && idempotencyWindow > 0 {
+			cacheKey = idempotencyCacheKeyFor(userID, evt.AccountID, evt.ClientEventID)
+			switch rt.claimIdempotencyKey(cacheKey) {
+			case idempotencyDone:
+				response.Results[i] = batchItemResponse{Ack: true, Status: http.StatusCreated}
+				continue
+			case idempotencyPending:
+				response.Results[i] = batchItemResponse{
+					Status: http.StatusConflict,
+					Error:  "router: an event using the same client event id is currently being handled",
+				}
+				continue
+			}
+		}
+		batch = append(batch, persistence.BatchEvent{
+			AccountID:  evt.AccountID,
+			EventType:  evt.EventType,
+			Payload:    evt.Payload,
+			RecordedAt: evt.recordedAt,
+		})
+		indices = append(indices, i)
+		cacheKeys = append(cacheKeys, cacheKey)
+	}
+	if len(batch) == 0 {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	anonymous := c.GetBool(contextKeyAnonymous)
+	insertUserID := userID
+	if anonymous {
+		insertUserID = ""
+	}
+	results, err := rt.db.InsertBatch(insertUserID, batch)
+	for j, cacheKey := range cacheKeys {
+		if cacheKey != "" {
+			rt.releaseIdempotencyKey(cacheKey, err == nil && results[j] == nil)
+		}
+	}
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error persisting events: %v", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	var accepted, flagged int
+	// the cookie is shared by all accounts, so it needs to be kept for the
+	// longest lifetime of any of the accounts involved
+	var lifetime time.Duration
+	for j, err := range results {
+		i := indices[j]
+		if err == nil {
+			accepted++
+			if isBot && rt.accountBotPolicy(payload[i].AccountID) == config.BotPolicyFlag {
+				flagged++
+			}
+			if l := rt.userCookieLifetime(payload[i].AccountID); l > lifetime {
+				lifetime = l
+			}
+			response.Results[i] = batchItemResponse{Ack: true, Status: http.StatusCreated}
+			continue
+		}
+		status := http.StatusInternalServerError
+		var unknownAccountErr persistence.ErrUnknownAccount
+		var unknownSecretErr persistence.ErrUnknownSecret
+		var unknownEventTypeErr persistence.ErrUnknownEventType
+		var disabledErr persistence.ErrAccountDisabled
+		var quotaErr persistence.ErrQuotaExceeded
+		if errors.As(err, &unknownAccountErr) {
+			status = http.StatusNotFound
+		} else if errors.As(err, &unknownSecretErr) {
+			status = http.StatusBadRequest
+		} else if errors.As(err, &unknownEventTypeErr) {
+			status = http.StatusUnprocessableEntity
+		} else if errors.As(err, &disabledErr) {
+			status = http.StatusForbidden
+		} else if errors.As(err, &quotaErr) {
+			status = quotaStatusCode(quotaErr)
+		}
+		response.Results[i] = batchItemResponse{Status: status, Error: err.Error()}
+	}
+
+	rt.metrics.Counter(metricEventsIngested, "Number of events that have been ingested.").Add(float64(accepted))
+	if flagged > 0 {
+		rt.metrics.Counter(metricEventsFlagged, "Number of ingested events that have been sent by crawlers.").Add(float64(flagged))
+	}
+	if accepted > 0 && !anonymous {
+		http.SetCookie(
+			c.Writer,
+			rt.userCookie(userID, lifetime, c.GetBool(contextKeySecureContext)),
+		)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// quotaStatusCode returns the status code used for responding to requests
+// that exceed the given quota. Exceeding the monthly quota resolves itself
+// over time, while exceeding the storage quota does not.
+func quotaStatusCode(err persistence.ErrQuotaExceeded) int {
+	if err.Quota == persistence.QuotaStoredEvents {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusTooManyRequests
+}
+
+const maxEventsPageSize = 10000
+
+// getEvents returns the events of the requesting user. Clients can request
+// results in pages using limit and cursor, and restrict results to certain
+// accounts by passing one or more accountId values.
 func (rt *router) getEvents(c *gin.Context) {
 	userID := c.GetString(contextKeyCookie)
 	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("getEvents-%s", userID)); l.Error != nil {
@@ -85,9 +411,34 @@ func (rt *router) getEvents(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
+
+	var limit int
+	if l := c.Query("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 0 || limit > maxEventsPageSize {
+			newJSONError(
+				fmt.Errorf("router: invalid limit %s, expected a value between 0 and %d", l, maxEventsPageSize),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+
+	// polling clients are answered without querying the database in case
+	// the requested events have not changed
+	accountIDs := c.QueryArray("accountId")
+	if rt.applyEventsRevision(c, userID, accountIDs) {
+		return
+	}
+
 	result, err := rt.db.Query(persistence.Query{
-		UserID: userID,
-		Since:  c.Query("since"),
+		UserID:       userID,
+		Since:        c.Query("since"),
+		AccountIDs:   accountIDs,
+		Limit:        limit,
+		Cursor:       c.Query("cursor"),
+		DeletedSince: c.Query("deletedSince"),
 	})
 	if err != nil {
 		newJSONError(
@@ -96,7 +447,7 @@ func (rt *router) getEvents(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
-	result.RetentionPeriod = rt.config.App.Retention.String()
+	result.RetentionPeriod = rt.getConfig().App.Retention.String()
 	c.JSON(http.StatusOK, result)
 }
 
@@ -109,6 +460,26 @@ func (rt *router) purgeEvents(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
+
+	// requests without a body purge the user's events across all accounts
+	if c.Request.Body != nil && c.Request.ContentLength != 0 {
+		var req purgePayload
+		if !bindPayload(c, &req) {
+			return
+		}
+		if err := rt.db.PurgeAccounts(userID, req.AccountIDs); err != nil {
+			newJSONError(
+				fmt.Errorf("router: error purging user events: %v", err),
+				http.StatusInternalServerError,
+			).Pipe(c)
+			return
+		}
+		// the user id is still needed for the accounts that have not
+		// been purged, so the cookie is kept
+		c.Status(http.StatusNoContent)
+		return
+	}
+
 	if err := rt.db.Purge(userID); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error purging user events: %v", err),
@@ -119,7 +490,7 @@ func (rt *router) purgeEvents(c *gin.Context) {
 	if c.Query("user") != "" {
 		http.SetCookie(
 			c.Writer,
-			rt.userCookie("", c.GetBool(contextKeySecureContext)),
+			rt.userCookie("", 0, c.GetBool(contextKeySecureContext)),
 		)
 	}
 	c.Status(http.StatusNoContent)
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -21,10 +22,18 @@ func strptr(s string) *string {
 
 type mockPurgeEventsService struct {
 	persistence.Service
-	err error
+	err        error
+	accountIDs []string
+	purgedAll  bool
 }
 
 func (m *mockPurgeEventsService) Purge(string) error {
+	m.purgedAll = true
+	return m.err
+}
+
+func (m *mockPurgeEventsService) PurgeAccounts(userID string, accountIDs []string) error {
+	m.accountIDs = accountIDs
 	return m.err
 }
 
@@ -71,13 +80,85 @@ func TestRouter_purgeEvents(t *testing.T) {
 	}
 }
 
+func TestRouter_purgeEvents_Accounts(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockPurgeEventsService
+		body               string
+		expectedStatus     int
+		expectedAccountIDs []string
+	}{
+		{
+			"not ok",
+			&mockPurgeEventsService{err: errors.New("did not work")},
+			`{"accountIds":["account-a"]}`,
+			http.StatusInternalServerError,
+			[]string{"account-a"},
+		},
+		{
+			"bad payload",
+			&mockPurgeEventsService{},
+			`{"accountIds":"account-a"}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"no accounts",
+			&mockPurgeEventsService{},
+			`{"accountIds":[]}`,
+			http.StatusUnprocessableEntity,
+			nil,
+		},
+		{
+			"ok",
+			&mockPurgeEventsService{},
+			`{"accountIds":["account-a","account-b"]}`,
+			http.StatusNoContent,
+			[]string{"account-a", "account-b"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			rt := router{db: test.db}
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyCookie, "user-id")
+				c.Next()
+			}, rt.purgeEvents)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/?user=1", strings.NewReader(test.body))
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if !reflect.DeepEqual(test.db.accountIDs, test.expectedAccountIDs) {
+				t.Errorf("Unexpected account ids %v", test.db.accountIDs)
+			}
+			if test.db.purgedAll {
+				t.Error("Unexpected purge across all accounts")
+			}
+			if w.Header().Get("Set-Cookie") != "" {
+				t.Errorf("Unexpected cookie %s", w.Header().Get("Set-Cookie"))
+			}
+		})
+	}
+}
+
 type mockGetEventsService struct {
 	persistence.Service
 	result persistence.EventsResult
 	err    error
+	query  persistence.Query
 }
 
-func (m *mockGetEventsService) Query(persistence.Query) (persistence.EventsResult, error) {
+func (m *mockGetEventsService) EventsRevision(userID string, accountIDs []string) (string, error) {
+	return "", nil
+}
+
+func (m *mockGetEventsService) Query(q persistence.Query) (persistence.EventsResult, error) {
+	m.query = q
 	return m.result, m.err
 }
 
@@ -85,6 +166,7 @@ func TestRouter_getEvents(t *testing.T) {
 	tests := []struct {
 		name           string
 		db             persistence.Service
+		query          string
 		expectedStatus int
 		expectedBody   string
 	}{
@@ -93,6 +175,7 @@ func TestRouter_getEvents(t *testing.T) {
 			&mockGetEventsService{
 				err: errors.New("did not work"),
 			},
+			"",
 			http.StatusInternalServerError,
 			"",
 		},
@@ -107,9 +190,26 @@ func TestRouter_getEvents(t *testing.T) {
 					},
 				},
 			},
+			"",
 			http.StatusOK,
 			`{"events":{"account-a":[{"accountId":"account-a","secretId":"hashed-user-a","eventId":"event-a","payload":"payload"}]}}`,
 		},
+		{
+			"bad limit",
+			&mockGetEventsService{},
+			"?limit=-1",
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"paginated",
+			&mockGetEventsService{
+				result: persistence.EventsResult{NextCursor: "seq-b"},
+			},
+			"?limit=2&cursor=seq-a&accountId=account-a&accountId=account-b",
+			http.StatusOK,
+			`"nextCursor":"seq-b"`,
+		},
 	}
 
 	for _, test := range tests {
@@ -125,7 +225,7 @@ func TestRouter_getEvents(t *testing.T) {
 			}, rt.getEvents)
 
 			w := httptest.NewRecorder()
-			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r := httptest.NewRequest(http.MethodGet, "/"+test.query, nil)
 
 			m.ServeHTTP(w, r)
 
@@ -147,10 +247,14 @@ type mockPostEventsService struct {
 	err error
 }
 
-func (m *mockPostEventsService) Insert(string, string, string, *string) error {
+func (m *mockPostEventsService) Insert(string, string, string, string, *string) error {
 	return m.err
 }
 
+func (m *mockPostEventsService) GetAccount(string, bool, bool, string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{RetentionPeriod: "30days"}, nil
+}
+
 func TestRouter_postEvents(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -193,6 +297,24 @@ func TestRouter_postEvents(t *testing.T) {
 			http.StatusBadRequest,
 			"",
 		},
+		{
+			"monthly quota exceeded",
+			&mockPostEventsService{
+				err: persistence.ErrQuotaExceeded{Quota: persistence.QuotaEventsPerMonth, Limit: 10},
+			},
+			`{"accountId":"account-a","payload":"some-payload"}`,
+			http.StatusTooManyRequests,
+			"",
+		},
+		{
+			"storage quota exceeded",
+			&mockPostEventsService{
+				err: persistence.ErrQuotaExceeded{Quota: persistence.QuotaStoredEvents, Limit: 10},
+			},
+			`{"accountId":"account-a","payload":"some-payload"}`,
+			http.StatusRequestEntityTooLarge,
+			"",
+		},
 		{
 			"ok",
 			&mockPostEventsService{},
@@ -232,3 +354,233 @@ func TestRouter_postEvents(t *testing.T) {
 		})
 	}
 }
+
+func TestRouter_postEvents_asyncAcknowledgement(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database.EventAcknowledgement = config.EventAcknowledgementAsync
+	rt := router{db: &mockPostEventsService{}, config: cfg}
+	m := gin.New()
+	m.POST("/", func(c *gin.Context) {
+		c.Set(contextKeyCookie, "user-id")
+		c.Next()
+	}, rt.postEvents)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"accountId":"account-a","payload":"some-payload"}`))
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `{"ack":true}`) {
+		t.Errorf("Unexpected response %d, %s", w.Code, w.Body.String())
+	}
+}
+
+type mockBotEventsService struct {
+	persistence.Service
+	botPolicy string
+	inserted  int
+}
+
+func (m *mockBotEventsService) Insert(string, string, string, string, *string) error {
+	m.inserted++
+	return nil
+}
+
+func (m *mockBotEventsService) GetAccount(string, bool, bool, string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{BotPolicy: m.botPolicy}, nil
+}
+
+func TestRouter_postEvents_bots(t *testing.T) {
+	tests := []struct {
+		name             string
+		isBot            bool
+		accountPolicy    string
+		defaultPolicy    config.BotPolicy
+		expectedStatus   int
+		expectedInserted int
+	}{
+		{"no bot", false, "reject", config.BotPolicyReject, http.StatusCreated, 1},
+		{"rejected by default", true, "", config.BotPolicyReject, http.StatusNoContent, 0},
+		{"rejected by account", true, "reject", config.BotPolicyAllow, http.StatusNoContent, 0},
+		{"flagged", true, "flag", config.BotPolicyReject, http.StatusCreated, 1},
+		{"allowed", true, "allow", config.BotPolicyReject, http.StatusCreated, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &mockBotEventsService{botPolicy: test.accountPolicy}
+			cfg := &config.Config{}
+			cfg.App.BotPolicy = test.defaultPolicy
+			rt := router{db: db, config: cfg}
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyCookie, "user-id")
+				c.Set(contextKeyBot, test.isBot)
+				c.Next()
+			}, rt.postEvents)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"accountId":"account-a","payload":"some-payload"}`))
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if db.inserted != test.expectedInserted {
+				t.Errorf("Expected %d inserted events, got %d", test.expectedInserted, db.inserted)
+			}
+			if test.expectedStatus == http.StatusNoContent && len(w.Result().Cookies()) != 0 {
+				t.Errorf("Unexpected cookies %v", w.Result().Cookies())
+			}
+		})
+	}
+}
+
+type mockPostEventsBatchService struct {
+	persistence.Service
+	results []error
+	err     error
+}
+
+func (m *mockPostEventsBatchService) InsertBatch(userID string, events []persistence.BatchEvent) ([]error, error) {
+	return m.results, m.err
+}
+
+func (m *mockPostEventsBatchService) GetAccount(string, bool, bool, string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{}, nil
+}
+
+func TestRouter_postEventsBatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		db             persistence.Service
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			"bad payload",
+			&mockPostEventsBatchService{},
+			`{"accountId":"account-a","payload":"some-payload"}`,
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"empty batch",
+			&mockPostEventsBatchService{},
+			`[]`,
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"database error",
+			&mockPostEventsBatchService{
+				err: errors.New("did not work"),
+			},
+			`[{"accountId":"account-a","payload":"some-payload"}]`,
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"ok",
+			&mockPostEventsBatchService{
+				results: []error{nil, persistence.ErrUnknownAccount("unknown account"), persistence.ErrUnknownSecret("unknown secret")},
+			},
+			`[{"accountId":"account-a","payload":"a"},{"accountId":"account-z","payload":"b"},{"accountId":"account-a","payload":"c"}]`,
+			http.StatusOK,
+			`{"results":[{"ack":true,"status":201},{"ack":false,"status":404,"error":"unknown account"},{"ack":false,"status":400,"error":"unknown secret"}]}`,
+		},
+		{
+			"invalid event",
+			&mockPostEventsBatchService{
+				results: []error{nil},
+			},
+			`[{"accountId":"account-a"},{"accountId":"account-a","payload":"a"}]`,
+			http.StatusOK,
+			`{"results":[{"ack":false,"status":422,"error":"router: event is invalid: payload: required"},{"ack":true,"status":201}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			rt := router{
+				db:     test.db,
+				config: &config.Config{},
+			}
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyCookie, "user-id")
+				c.Set(contextKeySecureContext, false)
+				c.Next()
+			}, rt.postEventsBatch)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+
+			if test.expectedBody != "" {
+				if !strings.Contains(w.Body.String(), test.expectedBody) {
+					t.Errorf("Expected response body %s to contain %s", w.Body.String(), test.expectedBody)
+				}
+			}
+		})
+	}
+}
+
+type mockAnonymousEventsService struct {
+	persistence.Service
+	userIDs []string
+}
+
+func (m *mockAnonymousEventsService) Insert(userID, accountID, eventType, payload string, eventID *string) error {
+	m.userIDs = append(m.userIDs, userID)
+	return nil
+}
+
+func (m *mockAnonymousEventsService) GetAccount(string, bool, bool, string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{}, nil
+}
+
+func TestRouter_postEvents_PrivacySignals(t *testing.T) {
+	tests := []struct {
+		name            string
+		policy          config.PrivacySignalPolicy
+		expectedStatus  int
+		expectedUserIDs []string
+		expectCookie    bool
+	}{
+		{"ignore", config.PrivacySignalIgnore, http.StatusCreated, []string{"user-id"}, true},
+		{"anonymous", config.PrivacySignalAnonymous, http.StatusCreated, []string{""}, false},
+		{"drop", config.PrivacySignalDrop, http.StatusNoContent, nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &mockAnonymousEventsService{}
+			cfg := &config.Config{}
+			cfg.App.PrivacySignals = test.policy
+			rt := router{db: db, config: cfg}
+			m := gin.New()
+			m.POST("/", rt.privacySignalMiddleware(contextKeyAnonymous), func(c *gin.Context) {
+				c.Set(contextKeyCookie, "user-id")
+				c.Next()
+			}, rt.postEvents)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"accountId":"account-a","payload":"some-payload"}`))
+			r.Header.Set("Sec-GPC", "1")
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", test.expectedStatus, w.Code)
+			}
+			if !reflect.DeepEqual(db.userIDs, test.expectedUserIDs) {
+				t.Errorf("Unexpected user ids %v", db.userIDs)
+			}
+			if hasCookie := w.Header().Get("Set-Cookie") != ""; hasCookie != test.expectCookie {
+				t.Errorf("Unexpected cookie header %v", w.Header().Get("Set-Cookie"))
+			}
+		})
+	}
+}
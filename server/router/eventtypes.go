@@ -0,0 +1,76 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+// putAccountEventTypes replaces the custom event types registered for an
+// account. Events can only use types that have been registered before.
+func (rt *router) putAccountEventTypes(c *gin.Context) {
+	accountID := c.Param("accountID")
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("putAccountEventTypes-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	if !accountUser.HasRole(accountID, persistence.AccountUserRoleAdmin) {
+		newJSONError(
+			fmt.Errorf("router: account user does not have permissions to update event types of account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	var types persistence.EventTypes
+	if err := c.BindJSON(&types); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	if err := types.Validate(); err != nil {
+		newJSONError(
+			fmt.Errorf("router: invalid event types: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.db.UpdateAccountEventTypes(accountID, types, accountUser.AccountUserID); err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error updating event types: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockPutAccountEventTypesDatabase struct {
+	persistence.Service
+	err     error
+	updated []persistence.EventTypes
+}
+
+func (m *mockPutAccountEventTypesDatabase) UpdateAccountEventTypes(accountID string, types persistence.EventTypes, accountUserID string) error {
+	m.updated = append(m.updated, types)
+	return m.err
+}
+
+func TestRouter_putAccountEventTypes(t *testing.T) {
+	admin := persistence.LoginResult{
+		Accounts: []persistence.LoginAccountResult{
+			{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
+		},
+	}
+	tests := []struct {
+		name               string
+		database           *mockPutAccountEventTypesDatabase
+		user               persistence.LoginResult
+		body               string
+		expectedStatusCode int
+		expectedUpdates    []persistence.EventTypes
+	}{
+		{
+			"not authorized",
+			&mockPutAccountEventTypesDatabase{},
+			persistence.LoginResult{
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a", Role: persistence.AccountUserRoleViewer},
+				},
+			},
+			`[{"name":"signup"}]`,
+			http.StatusForbidden,
+			nil,
+		},
+		{
+			"bad payload",
+			&mockPutAccountEventTypesDatabase{},
+			admin,
+			`{"name":"signup"}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"invalid types",
+			&mockPutAccountEventTypesDatabase{},
+			admin,
+			`[{"name":"signup"},{"name":"signup"}]`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"unknown account",
+			&mockPutAccountEventTypesDatabase{err: persistence.ErrUnknownAccount("unknown")},
+			admin,
+			`[]`,
+			http.StatusNotFound,
+			[]persistence.EventTypes{{}},
+		},
+		{
+			"database error",
+			&mockPutAccountEventTypesDatabase{err: errors.New("did not work")},
+			admin,
+			`[{"name":"signup"}]`,
+			http.StatusInternalServerError,
+			[]persistence.EventTypes{{{Name: "signup"}}},
+		},
+		{
+			"ok",
+			&mockPutAccountEventTypesDatabase{},
+			admin,
+			`[{"name":"signup","fields":["plan"]}]`,
+			http.StatusNoContent,
+			[]persistence.EventTypes{{{Name: "signup", Fields: []string{"plan"}}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.database, config: &config.Config{}}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/account-a", strings.NewReader(test.body))
+			m := gin.New()
+			m.PUT("/:accountID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, test.user)
+				c.Next()
+			}, rt.putAccountEventTypes)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if !reflect.DeepEqual(test.expectedUpdates, test.database.updated) {
+				t.Errorf("Unexpected updates %v", test.database.updated)
+			}
+		})
+	}
+}
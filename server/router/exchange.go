@@ -4,16 +4,120 @@
 package router
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gofrs/uuid"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/keys"
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
 )
 
+// exchangeNonceLifetime is the duration a nonce that has been handed out
+// alongside the public key of an account can be used for sending a secret.
+const exchangeNonceLifetime = time.Minute * 5
+
+// exchangeAbuseInterval is the interval in which suspected abuse of the
+// exchange is recorded at most once for each account and reason.
+const exchangeAbuseInterval = time.Minute * 10
+
+// publicKeyResponse is the account's public key alongside a nonce that
+// needs to be passed when sending the encrypted user secret.
+type publicKeyResponse struct {
+	persistence.AccountResult
+	Nonce     string `json:"nonce"`
+	Timestamp string `json:"timestamp"`
+}
+
+// requestUserID returns the user id sent in the user cookie, or an empty
+// string for users that have not been given an id yet.
+func requestUserID(c *gin.Context) string {
+	if ck, err := c.Request.Cookie(cookieKey); err == nil {
+		return ck.Value
+	}
+	return ""
+}
+
+// exchangeNonceSignature signs the given nonce so it can only be used by the
+// given user for sending a secret to the given account.
+func (rt *router) exchangeNonceSignature(userID, accountID, nonce, timestamp string) []byte {
+	mac := hmac.New(sha256.New, rt.getConfig().Secret.Bytes())
+	mac.Write([]byte("offen-exchange|" + userID + "|" + accountID + "|" + nonce + "|" + timestamp))
+	return mac.Sum(nil)
+}
+
+// newExchangeNonce creates a signed nonce and the timestamp it has been
+// issued at. Nonces are not stored, the signature is sufficient for checking
+// whether a nonce has been issued for the sending user.
+func (rt *router) newExchangeNonce(userID, accountID string, now time.Time) (string, string, error) {
+	nonce, err := keys.GenerateRandomValueWith(16, base64.RawURLEncoding)
+	if err != nil {
+		return "", "", fmt.Errorf("router: error creating nonce: %w", err)
+	}
+	timestamp := now.UTC().Format(time.RFC3339)
+	signature := rt.exchangeNonceSignature(userID, accountID, nonce, timestamp)
+	return nonce + "." + hex.EncodeToString(signature), timestamp, nil
+}
+
+// checkExchangeNonce returns the reason for rejecting the given payload in
+// case it does not pass a nonce that has been issued for the given user
+// recently. Each nonce can only be used once.
+func (rt *router) checkExchangeNonce(userID string, p userSecretPayload, now time.Time) string {
+	issuedAt, err := time.Parse(time.RFC3339, p.Timestamp)
+	if err != nil {
+		return "invalid timestamp"
+	}
+	parts := strings.SplitN(p.Nonce, ".", 2)
+	if len(parts) != 2 {
+		return "invalid nonce"
+	}
+	signature, err := hex.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, rt.exchangeNonceSignature(userID, p.AccountID, parts[0], p.Timestamp)) {
+		return "invalid nonce"
+	}
+	if issuedAt.After(now.Add(replayClockSkew)) || issuedAt.Before(now.Add(-exchangeNonceLifetime)) {
+		return "expired nonce"
+	}
+	cache, cacheKey := rt.getCache(), fmt.Sprintf("exchange-nonce-%s", parts[0])
+	if _, used := cache.Get(cacheKey); used {
+		return "reused nonce"
+	}
+	cache.Set(cacheKey, p.Timestamp, exchangeNonceLifetime+replayClockSkew)
+	return ""
+}
+
+// recordExchangeAbuse adds an entry to the audit log of the given account.
+// Entries are only recorded for existing accounts and at most once per
+// interval and reason, so the audit log cannot be flooded by attackers.
+// Like for consent, the user id is not recorded.
+func (rt *router) recordExchangeAbuse(accountID, reason string) {
+	cache, cacheKey := rt.getCache(), fmt.Sprintf("exchange-abuse-%s-%s", accountID, reason)
+	if _, ok := cache.Get(cacheKey); ok {
+		return
+	}
+	cache.Set(cacheKey, reason, exchangeAbuseInterval)
+
+	if _, err := rt.db.GetAccount(accountID, false, false, ""); err != nil {
+		var unknownAccountErr persistence.ErrUnknownAccount
+		if !errors.As(err, &unknownAccountErr) {
+			rt.logError(err, "error looking up account for recording suspected abuse of user secret exchange")
+		}
+		return
+	}
+	if err := rt.db.RecordAuditLog("", []string{accountID}, persistence.AuditActionExchangeAbuse, reason); err != nil {
+		rt.logError(err, "error recording suspected abuse of user secret exchange")
+	}
+}
+
 func (rt *router) getPublicKey(c *gin.Context) {
 	account, err := rt.db.GetAccount(c.Query("accountId"), false, false, "")
 	if err != nil {
@@ -31,21 +135,33 @@ func (rt *router) getPublicKey(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
-	c.JSON(http.StatusOK, account)
+	// the key exchange is public, so settings that are only of interest
+	// to account users are left out
+	account.WriteKeys = nil
+
+	nonce, timestamp, err := rt.newExchangeNonce(requestUserID(c), c.Query("accountId"), time.Now())
+	if err != nil {
+		newJSONError(err, http.StatusInternalServerError).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, publicKeyResponse{
+		AccountResult: account,
+		Nonce:         nonce,
+		Timestamp:     timestamp,
+	})
 }
 
 type userSecretPayload struct {
 	EncryptedUserSecret string `json:"encryptedSecret"`
 	AccountID           string `json:"accountId"`
+	Nonce               string `json:"nonce"`
+	Timestamp           string `json:"timestamp"`
 }
 
 func (rt *router) postUserSecret(c *gin.Context) {
-	var userID string
-
-	ck, err := c.Request.Cookie(cookieKey)
-	if err == nil {
-		userID = ck.Value
-	} else {
+	existingUserID := requestUserID(c)
+	userID := existingUserID
+	if userID == "" {
 		newID, newIDErr := uuid.NewV4()
 		if newIDErr != nil {
 			newJSONError(
@@ -58,10 +174,17 @@ func (rt *router) postUserSecret(c *gin.Context) {
 	}
 
 	payload := userSecretPayload{}
-	if err := c.BindJSON(&payload); err != nil {
+	if !bindPayload(c, &payload) {
+		return
+	}
+
+	// secrets are only accepted from clients that have requested the public
+	// key themselves, so requests cannot be forged or replayed by 3rd parties
+	if reason := rt.checkExchangeNonce(existingUserID, payload, time.Now()); reason != "" {
+		rt.recordExchangeAbuse(payload.AccountID, reason)
 		newJSONError(
-			fmt.Errorf("router: error decoding response body: %v", err),
-			http.StatusBadRequest,
+			fmt.Errorf("router: rejecting user secret: %s", reason),
+			http.StatusForbidden,
 		).Pipe(c)
 		return
 	}
@@ -74,6 +197,33 @@ func (rt *router) postUserSecret(c *gin.Context) {
 		return
 	}
 
+	// replacing the secret of an existing user makes all of their previous
+	// events inaccessible, so this is limited further
+	if existingUserID != "" {
+		limit := ratelimiter.Limit(rt.getConfig().RateLimit.Exchange)
+		if l := <-rt.getLimiter().Throttle(limit, fmt.Sprintf("rotateUserSecret-%s-%s", existingUserID, payload.AccountID)); l.Error != nil {
+			rt.recordExchangeAbuse(payload.AccountID, "rotation limit exceeded")
+			newJSONError(
+				fmt.Errorf("router: error rate limiting request: %w", l.Error),
+				http.StatusTooManyRequests,
+			).Pipe(c)
+			return
+		}
+	}
+
+	// crawlers are not given a user cookie in case their events are rejected
+	if c.GetBool(contextKeyBot) && rt.accountBotPolicy(payload.AccountID) == config.BotPolicyReject {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	// users sending a privacy signal are not given a user cookie in case
+	// their events are stored anonymously
+	if c.GetBool(contextKeyAnonymous) {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
 	if err := rt.db.AssociateUserSecret(payload.AccountID, userID, payload.EncryptedUserSecret); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error associating user secret: %v", err),
@@ -84,7 +234,7 @@ func (rt *router) postUserSecret(c *gin.Context) {
 
 	http.SetCookie(
 		c.Writer,
-		rt.userCookie(userID, c.GetBool(contextKeySecureContext)),
+		rt.userCookie(userID, rt.userCookieLifetime(payload.AccountID), c.GetBool(contextKeySecureContext)),
 	)
 	c.Status(http.StatusNoContent)
 }
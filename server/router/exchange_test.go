@@ -4,6 +4,8 @@
 package router
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +13,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/offen/offen/server/config"
@@ -73,24 +76,57 @@ func TestRouter_GetPublicKey(t *testing.T) {
 			if w.Code != test.expectedStatusCode {
 				t.Errorf("Expected status code %d, got %d", test.expectedStatusCode, w.Code)
 			}
+			if w.Code == http.StatusOK {
+				var response publicKeyResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				if response.AccountID != "12345" || response.Nonce == "" || response.Timestamp == "" {
+					t.Errorf("Unexpected response %v", response)
+				}
+			}
 		})
 	}
 }
 
 type mockUserSecretDatabase struct {
 	persistence.Service
-	err error
+	err          error
+	knownAccount bool
+	auditLog     []string
 }
 
 func (m *mockUserSecretDatabase) AssociateUserSecret(string, string, string) error {
 	return m.err
 }
 
+func (m *mockUserSecretDatabase) GetAccount(string, bool, bool, string) (persistence.AccountResult, error) {
+	if m.knownAccount {
+		return persistence.AccountResult{}, nil
+	}
+	return persistence.AccountResult{}, persistence.ErrUnknownAccount("unknown account")
+}
+
+func (m *mockUserSecretDatabase) RecordAuditLog(accountUserID string, accountIDs []string, action, target string) error {
+	m.auditLog = append(m.auditLog, fmt.Sprintf("%s %s", action, target))
+	return nil
+}
+
+// userSecretBody replaces the nonce and timestamp placeholders in the given
+// body with a nonce issued for the given user.
+func userSecretBody(rt *router, userID, body string) io.Reader {
+	nonce, timestamp, _ := rt.newExchangeNonce(userID, "another value", time.Now())
+	return strings.NewReader(
+		strings.NewReplacer("{nonce}", nonce, "{timestamp}", timestamp).Replace(body),
+	)
+}
+
 func TestRouter_PostUserSecret(t *testing.T) {
 	tests := []struct {
 		name           string
 		db             persistence.Service
-		body           io.Reader
+		body           string
+		nonceUserID    string
 		cookie         *http.Cookie
 		expectedStatus int
 		expectedUserID func(string) bool
@@ -98,7 +134,8 @@ func TestRouter_PostUserSecret(t *testing.T) {
 		{
 			"bad payload",
 			&mockUserSecretDatabase{},
-			strings.NewReader("this is not json"),
+			"this is not json",
+			"",
 			&http.Cookie{},
 			http.StatusBadRequest,
 			func(string) bool { return true },
@@ -108,25 +145,84 @@ func TestRouter_PostUserSecret(t *testing.T) {
 			&mockUserSecretDatabase{
 				err: errors.New("did not work"),
 			},
-			strings.NewReader(`
+			`
 			{
-				"encrypted_user_secret": "a value",
-				"accountId": "another value"
+				"encryptedSecret": "a value",
+				"accountId": "another value",
+				"nonce": "{nonce}",
+				"timestamp": "{timestamp}"
 			}
-			`),
+			`,
+			"",
 			&http.Cookie{},
 			http.StatusBadRequest,
 			func(input string) bool { return input != "" },
 		},
+		{
+			"invalid payload",
+			&mockUserSecretDatabase{},
+			`{"accountId": "another value", "nonce": "{nonce}", "timestamp": "{timestamp}"}`,
+			"",
+			&http.Cookie{},
+			http.StatusUnprocessableEntity,
+			func(string) bool { return true },
+		},
+		{
+			"missing nonce",
+			&mockUserSecretDatabase{},
+			`{"encryptedSecret": "a value", "accountId": "another value"}`,
+			"",
+			&http.Cookie{},
+			http.StatusUnprocessableEntity,
+			func(string) bool { return true },
+		},
+		{
+			"nonce issued for other user",
+			&mockUserSecretDatabase{},
+			`
+			{
+				"encryptedSecret": "a value",
+				"accountId": "another value",
+				"nonce": "{nonce}",
+				"timestamp": "{timestamp}"
+			}
+			`,
+			"other-user-id",
+			&http.Cookie{
+				Name:  cookieKey,
+				Value: "existing-user-id",
+			},
+			http.StatusForbidden,
+			func(string) bool { return false },
+		},
+		{
+			"tampered timestamp",
+			&mockUserSecretDatabase{},
+			`
+			{
+				"encryptedSecret": "a value",
+				"accountId": "another value",
+				"nonce": "{nonce}",
+				"timestamp": "2022-01-01T00:00:00Z"
+			}
+			`,
+			"",
+			&http.Cookie{},
+			http.StatusForbidden,
+			func(string) bool { return false },
+		},
 		{
 			"new user id",
 			&mockUserSecretDatabase{},
-			strings.NewReader(`
+			`
 			{
-				"encrypted_user_secret": "a value",
-				"accountId": "another value"
+				"encryptedSecret": "a value",
+				"accountId": "another value",
+				"nonce": "{nonce}",
+				"timestamp": "{timestamp}"
 			}
-			`),
+			`,
+			"",
 			&http.Cookie{},
 			http.StatusNoContent,
 			func(input string) bool { return input != "" },
@@ -134,12 +230,15 @@ func TestRouter_PostUserSecret(t *testing.T) {
 		{
 			"existing user id",
 			&mockUserSecretDatabase{},
-			strings.NewReader(`
+			`
 			{
-				"encrypted_user_secret": "a value",
-				"accountId": "another value"
+				"encryptedSecret": "a value",
+				"accountId": "another value",
+				"nonce": "{nonce}",
+				"timestamp": "{timestamp}"
 			}
-			`),
+			`,
+			"existing-user-id",
 			&http.Cookie{
 				Name:  cookieKey,
 				Value: "existing-user-id",
@@ -154,7 +253,7 @@ func TestRouter_PostUserSecret(t *testing.T) {
 			m := gin.New()
 			m.POST("/", rt.postUserSecret)
 			w := httptest.NewRecorder()
-			r := httptest.NewRequest(http.MethodPost, "/", test.body)
+			r := httptest.NewRequest(http.MethodPost, "/", userSecretBody(&rt, test.nonceUserID, test.body))
 			r.AddCookie(test.cookie)
 			m.ServeHTTP(w, r)
 			if w.Code != test.expectedStatus {
@@ -171,3 +270,58 @@ func TestRouter_PostUserSecret(t *testing.T) {
 		})
 	}
 }
+
+func TestRouter_PostUserSecret_Abuse(t *testing.T) {
+	body := `{"encryptedSecret": "a value", "accountId": "another value", "nonce": "{nonce}", "timestamp": "{timestamp}"}`
+	post := func(rt *router, body io.Reader) int {
+		m := gin.New()
+		m.POST("/", rt.postUserSecret)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", body)
+		r.AddCookie(&http.Cookie{Name: cookieKey, Value: "existing-user-id"})
+		m.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	t.Run("reused nonce", func(t *testing.T) {
+		db := &mockUserSecretDatabase{knownAccount: true}
+		rt := &router{db: db, config: &config.Config{}}
+		b, _ := io.ReadAll(userSecretBody(rt, "existing-user-id", body))
+		if code := post(rt, bytes.NewReader(b)); code != http.StatusNoContent {
+			t.Errorf("Expected status code %d, got %d", http.StatusNoContent, code)
+		}
+		for i := 0; i < 2; i++ {
+			if code := post(rt, bytes.NewReader(b)); code != http.StatusForbidden {
+				t.Errorf("Expected status code %d, got %d", http.StatusForbidden, code)
+			}
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0] != "suspected-exchange-abuse reused nonce" {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+	t.Run("rotation limit", func(t *testing.T) {
+		db := &mockUserSecretDatabase{knownAccount: true}
+		cfg := &config.Config{}
+		cfg.RateLimit.Exchange = config.RateLimit{Requests: 1, Window: time.Hour}
+		rt := &router{db: db, config: cfg}
+		if code := post(rt, userSecretBody(rt, "existing-user-id", body)); code != http.StatusNoContent {
+			t.Errorf("Expected status code %d, got %d", http.StatusNoContent, code)
+		}
+		if code := post(rt, userSecretBody(rt, "existing-user-id", body)); code != http.StatusTooManyRequests {
+			t.Errorf("Expected status code %d, got %d", http.StatusTooManyRequests, code)
+		}
+		if len(db.auditLog) != 1 || db.auditLog[0] != "suspected-exchange-abuse rotation limit exceeded" {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+	t.Run("unknown account", func(t *testing.T) {
+		db := &mockUserSecretDatabase{}
+		rt := &router{db: db, config: &config.Config{}}
+		if code := post(rt, strings.NewReader(strings.NewReplacer("{nonce}", "abc.def", "{timestamp}", time.Now().Format(time.RFC3339)).Replace(body))); code != http.StatusForbidden {
+			t.Errorf("Expected status code %d, got %d", http.StatusForbidden, code)
+		}
+		if len(db.auditLog) != 0 {
+			t.Errorf("Unexpected audit log %v", db.auditLog)
+		}
+	})
+}
@@ -0,0 +1,245 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+const exportPageSize = 1000
+
+type exportWriter interface {
+	Write(persistence.ExportedEventResult) error
+	Flush() error
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvExportWriter) Write(evt persistence.ExportedEventResult) error {
+	var secretID string
+	if evt.SecretID != nil {
+		secretID = *evt.SecretID
+	}
+	return c.w.Write([]string{evt.EventID, secretID, evt.EncryptedSecret, evt.Payload})
+}
+
+func (c *csvExportWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonExportWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonExportWriter) Write(evt persistence.ExportedEventResult) error {
+	return n.enc.Encode(evt)
+}
+
+func (n *ndjsonExportWriter) Flush() error {
+	return nil
+}
+
+// getAccountExport streams all events of an account together with the
+// encrypted secrets needed for decrypting them. Events are written in
+// ascending order of their id, so an interrupted download can be resumed by
+// passing the id of the last event received as the cursor parameter.
+func (rt *router) getAccountExport(c *gin.Context) {
+	accountID := c.Param("accountID")
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if ok := accountUser.CanAccessAccount(accountID); !ok {
+		newJSONError(
+			fmt.Errorf("router: account user does not have permissions to access account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("getAccountExport-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	default:
+		newJSONError(
+			fmt.Errorf("router: unsupported export format %s", format),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	// the first page is requested before writing any response so errors can
+	// still be reported using a proper status code
+	cursor := c.Query("cursor")
+	events, err := rt.db.ExportEvents(accountID, cursor, exportPageSize)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error exporting events: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="offen-%s.%s"`, accountID, format))
+	c.Status(http.StatusOK)
+
+	var w exportWriter
+	if format == "csv" {
+		csvWriter := csv.NewWriter(c.Writer)
+		csvWriter.Write([]string{"eventId", "secretId", "encryptedSecret", "payload"})
+		w = &csvExportWriter{csvWriter}
+	} else {
+		w = &ndjsonExportWriter{json.NewEncoder(c.Writer)}
+	}
+
+	for {
+		for _, evt := range events {
+			if err := w.Write(evt); err != nil {
+				rt.logError(err, "error writing account export")
+				return
+			}
+		}
+		if err := w.Flush(); err != nil {
+			rt.logError(err, "error writing account export")
+			return
+		}
+		c.Writer.Flush()
+
+		if len(events) < exportPageSize {
+			return
+		}
+		cursor = events[len(events)-1].EventID
+		events, err = rt.db.ExportEvents(accountID, cursor, exportPageSize)
+		if err != nil {
+			// the status has already been sent, so the client is left with a
+			// truncated export it can resume using the last event id
+			rt.logError(err, "error exporting events")
+			return
+		}
+	}
+}
+
+// postAccountImport merges events that have been exported from another
+// instance running the same account. The request body uses the ndjson export
+// format. Each exported event carries the fingerprint of the account key it
+// has been encrypted for, so that only events of the same account can be
+// merged. Events keep their ids, which means importing the same export twice
+// is a no-op and an interrupted import can simply be retried.
+func (rt *router) postAccountImport(c *gin.Context) {
+	accountID := c.Param("accountID")
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if ok := accountUser.HasRole(accountID, persistence.AccountUserRoleAdmin); !ok {
+		newJSONError(
+			fmt.Errorf("router: account user is not allowed to import events into account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("postAccountImport-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	var result persistence.ImportResult
+	importPage := func(events []persistence.ExportedEventResult) error {
+		pageResult, err := rt.db.ImportEvents(accountID, accountUser.AccountUserID, events)
+		result.Imported += pageResult.Imported
+		result.Skipped += pageResult.Skipped
+		return err
+	}
+
+	dec := json.NewDecoder(c.Request.Body)
+	page := []persistence.ExportedEventResult{}
+	for {
+		var evt persistence.ExportedEventResult
+		if err := dec.Decode(&evt); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			newJSONError(
+				fmt.Errorf("router: error decoding imported events: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		page = append(page, evt)
+		if len(page) < exportPageSize {
+			continue
+		}
+		if err := importPage(page); err != nil {
+			rt.pipeImportError(c, err)
+			return
+		}
+		page = []persistence.ExportedEventResult{}
+	}
+	if len(page) != 0 {
+		if err := importPage(page); err != nil {
+			rt.pipeImportError(c, err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (rt *router) pipeImportError(c *gin.Context, err error) {
+	var unknownAccountErr persistence.ErrUnknownAccount
+	var keyMismatchErr persistence.ErrAccountKeyMismatch
+	var invalidErr persistence.ErrInvalidImport
+	var unknownTypeErr persistence.ErrUnknownEventType
+	status := http.StatusInternalServerError
+	switch {
+	case errors.As(err, &unknownAccountErr):
+		status = http.StatusNotFound
+	case errors.As(err, &keyMismatchErr):
+		status = http.StatusConflict
+	case errors.As(err, &invalidErr), errors.As(err, &unknownTypeErr):
+		status = http.StatusBadRequest
+	}
+	newJSONError(
+		fmt.Errorf("router: error importing events: %w", err),
+		status,
+	).Pipe(c)
+}
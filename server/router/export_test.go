@@ -0,0 +1,244 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockExportEventsDatabase struct {
+	persistence.Service
+	events  []persistence.ExportedEventResult
+	err     error
+	cursors []string
+}
+
+func (m *mockExportEventsDatabase) ExportEvents(accountID, cursor string, limit int) ([]persistence.ExportedEventResult, error) {
+	m.cursors = append(m.cursors, cursor)
+	if m.err != nil {
+		return nil, m.err
+	}
+	var result []persistence.ExportedEventResult
+	for _, evt := range m.events {
+		if evt.EventID > cursor && len(result) < limit {
+			result = append(result, evt)
+		}
+	}
+	return result, nil
+}
+
+func TestRouter_getAccountExport(t *testing.T) {
+	secretID := "secret-a"
+	var events []persistence.ExportedEventResult
+	for i := 0; i < exportPageSize+1; i++ {
+		events = append(events, persistence.ExportedEventResult{
+			EventID:         fmt.Sprintf("event-%05d", i),
+			SecretID:        &secretID,
+			EncryptedSecret: "encrypted",
+			Payload:         "payload",
+		})
+	}
+
+	tests := []struct {
+		name               string
+		query              string
+		db                 *mockExportEventsDatabase
+		expectedStatusCode int
+		expectedLines      int
+		expectedPrefix     string
+		expectedCursors    []string
+	}{
+		{
+			"no access",
+			"/account-b",
+			&mockExportEventsDatabase{},
+			http.StatusForbidden,
+			0,
+			"",
+			nil,
+		},
+		{
+			"bad format",
+			"/account-a?format=xml",
+			&mockExportEventsDatabase{},
+			http.StatusBadRequest,
+			0,
+			"",
+			nil,
+		},
+		{
+			"database error",
+			"/account-a",
+			&mockExportEventsDatabase{err: errors.New("did not work")},
+			http.StatusInternalServerError,
+			0,
+			"",
+			[]string{""},
+		},
+		{
+			"csv",
+			"/account-a",
+			&mockExportEventsDatabase{events: events},
+			http.StatusOK,
+			exportPageSize + 3,
+			"eventId,secretId,encryptedSecret,payload\nevent-00000,secret-a,encrypted,payload\n",
+			[]string{"", fmt.Sprintf("event-%05d", exportPageSize-1)},
+		},
+		{
+			"ndjson with cursor",
+			"/account-a?format=ndjson&cursor=event-00999",
+			&mockExportEventsDatabase{events: events},
+			http.StatusOK,
+			2,
+			`{"eventId":"event-01000","secretId":"secret-a","encryptedSecret":"encrypted","payload":"payload"}`,
+			[]string{"event-00999"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{
+				config: &config.Config{},
+				db:     test.db,
+			}
+			m := gin.New()
+			m.GET("/:accountID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, persistence.LoginResult{
+					Accounts: []persistence.LoginAccountResult{{AccountID: "account-a"}},
+				})
+			}, rt.getAccountExport)
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.query, nil))
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if lines := len(strings.Split(w.Body.String(), "\n")); lines != test.expectedLines {
+				t.Errorf("Unexpected number of lines %d", lines)
+			}
+			if !strings.HasPrefix(w.Body.String(), test.expectedPrefix) {
+				t.Errorf("Unexpected body %s", w.Body.String()[:200])
+			}
+			if fmt.Sprintf("%v", test.db.cursors) != fmt.Sprintf("%v", test.expectedCursors) {
+				t.Errorf("Unexpected cursors %v", test.db.cursors)
+			}
+		})
+	}
+}
+
+type mockImportEventsDatabase struct {
+	persistence.Service
+	err   error
+	pages []int
+}
+
+func (m *mockImportEventsDatabase) ImportEvents(accountID, accountUserID string, events []persistence.ExportedEventResult) (persistence.ImportResult, error) {
+	m.pages = append(m.pages, len(events))
+	if m.err != nil {
+		return persistence.ImportResult{}, m.err
+	}
+	return persistence.ImportResult{Imported: len(events)}, nil
+}
+
+func TestRouter_postAccountImport(t *testing.T) {
+	admin := persistence.LoginResult{
+		Accounts: []persistence.LoginAccountResult{
+			{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
+		},
+	}
+	var lines []string
+	for i := 0; i < exportPageSize+1; i++ {
+		lines = append(lines, fmt.Sprintf(`{"eventId":"event-%05d","payload":"payload"}`, i))
+	}
+	tests := []struct {
+		name               string
+		db                 *mockImportEventsDatabase
+		user               persistence.LoginResult
+		body               string
+		expectedStatusCode int
+		expectedPages      []int
+	}{
+		{
+			"not authorized",
+			&mockImportEventsDatabase{},
+			persistence.LoginResult{
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a", Role: persistence.AccountUserRoleViewer},
+				},
+			},
+			lines[0],
+			http.StatusForbidden,
+			nil,
+		},
+		{
+			"bad payload",
+			&mockImportEventsDatabase{},
+			admin,
+			"eventId,payload",
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"key mismatch",
+			&mockImportEventsDatabase{err: persistence.ErrAccountKeyMismatch("mismatch")},
+			admin,
+			lines[0],
+			http.StatusConflict,
+			[]int{1},
+		},
+		{
+			"database error",
+			&mockImportEventsDatabase{err: errors.New("did not work")},
+			admin,
+			lines[0],
+			http.StatusInternalServerError,
+			[]int{1},
+		},
+		{
+			"empty",
+			&mockImportEventsDatabase{},
+			admin,
+			"",
+			http.StatusOK,
+			nil,
+		},
+		{
+			"paged",
+			&mockImportEventsDatabase{},
+			admin,
+			strings.Join(lines, "\n"),
+			http.StatusOK,
+			[]int{exportPageSize, 1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/account-a", strings.NewReader(test.body))
+			m := gin.New()
+			m.POST("/:accountID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, test.user)
+				c.Next()
+			}, rt.postAccountImport)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if fmt.Sprint(test.db.pages) != fmt.Sprint(test.expectedPages) {
+				t.Errorf("Unexpected pages %v", test.db.pages)
+			}
+		})
+	}
+}
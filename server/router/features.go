@@ -0,0 +1,171 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+// Features that can be rolled out gradually.
+const (
+	// featureBatchIngestion guards accepting multiple events in a single
+	// request.
+	featureBatchIngestion = "batch-ingestion"
+	// featureGraphQL guards querying an account using the GraphQL API.
+	featureGraphQL = "graphql"
+)
+
+// knownFeatures lists all features that can be toggled, mapped to whether
+// they are enabled in case neither the configuration nor the account
+// define a value.
+var knownFeatures = map[string]bool{
+	featureBatchIngestion: true,
+	featureGraphQL:        true,
+}
+
+// Sources of the value of a feature flag.
+const (
+	featureSourceDefault = "default"
+	featureSourceConfig  = "config"
+	featureSourceAccount = "account"
+)
+
+type featureFlagResponse struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Source  string `json:"source"`
+}
+
+// accountFeatureFlags returns the feature flags defined for the given
+// account. Values are cached the same way retention periods are.
+func (rt *router) accountFeatureFlags(accountID string) persistence.FeatureFlags {
+	cache, cacheKey := rt.getCache(), fmt.Sprintf("account-feature-flags-%s", accountID)
+	encoded, ok := cache.Get(cacheKey)
+	if !ok {
+		account, err := rt.db.GetAccount(accountID, false, false, "")
+		if err != nil {
+			return nil
+		}
+		encoded = "{}"
+		if b, err := json.Marshal(account.FeatureFlags); err == nil && account.FeatureFlags != nil {
+			encoded = string(b)
+		}
+		cache.Set(cacheKey, encoded, time.Minute*5)
+	}
+	var flags persistence.FeatureFlags
+	if err := json.Unmarshal([]byte(encoded), &flags); err != nil {
+		return nil
+	}
+	return flags
+}
+
+// resolveFeature returns whether the given feature is enabled given the
+// flags of an account and where this value has been defined. Values set
+// for the account take precedence over the configuration, which takes
+// precedence over the built-in default.
+func (rt *router) resolveFeature(feature string, accountFlags persistence.FeatureFlags) (bool, string) {
+	if enabled, ok := accountFlags[feature]; ok {
+		return enabled, featureSourceAccount
+	}
+	if enabled, ok := rt.getConfig().App.Features[feature]; ok {
+		return enabled, featureSourceConfig
+	}
+	return knownFeatures[feature], featureSourceDefault
+}
+
+// featureEnabled returns whether the given feature is enabled for the given
+// account. Passing an empty account id skips looking up account specific
+// values.
+func (rt *router) featureEnabled(feature, accountID string) bool {
+	var flags persistence.FeatureFlags
+	if accountID != "" {
+		flags = rt.accountFeatureFlags(accountID)
+	}
+	enabled, _ := rt.resolveFeature(feature, flags)
+	return enabled
+}
+
+func (rt *router) featureFlagsResponse(flags persistence.FeatureFlags) []featureFlagResponse {
+	result := []featureFlagResponse{}
+	for name := range knownFeatures {
+		enabled, source := rt.resolveFeature(name, flags)
+		result = append(result, featureFlagResponse{Name: name, Enabled: enabled, Source: source})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// getAdminAccountFeatures returns the state of all known features for the
+// given account.
+func (rt *router) getAdminAccountFeatures(c *gin.Context) {
+	accountID := c.Param("accountID")
+	account, err := rt.db.GetAccount(accountID, false, false, "")
+	if err != nil {
+		var unknownAccountErr persistence.ErrUnknownAccount
+		if errors.As(err, &unknownAccountErr) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error looking up account: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, rt.featureFlagsResponse(account.FeatureFlags))
+}
+
+// patchAdminAccountFeatures sets or removes account specific values for
+// the given features. Setting a feature to null makes the account use the
+// instance wide value again.
+func (rt *router) patchAdminAccountFeatures(c *gin.Context) {
+	accountUser, _ := c.Value(contextKeyAuth).(persistence.LoginResult)
+	accountID := c.Param("accountID")
+
+	var req map[string]*bool
+	if !bindPayload(c, &req) {
+		return
+	}
+	for name := range req {
+		if _, ok := knownFeatures[name]; !ok {
+			newJSONError(
+				fmt.Errorf("router: unknown feature %s", name),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+
+	flags, err := rt.db.UpdateAccountFeatureFlags(accountID, req, accountUser.AccountUserID)
+	if err != nil {
+		var unknownAccountErr persistence.ErrUnknownAccount
+		if errors.As(err, &unknownAccountErr) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error updating feature flags: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	rt.getCache().Delete(fmt.Sprintf("account-feature-flags-%s", accountID))
+	c.JSON(http.StatusOK, rt.featureFlagsResponse(flags))
+}
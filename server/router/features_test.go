@@ -0,0 +1,148 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockFeaturesDatabase struct {
+	persistence.Service
+	flags   persistence.FeatureFlags
+	lookups int
+}
+
+func (m *mockFeaturesDatabase) GetAccount(accountID string, includeStyles bool, includeEvents bool, eventsSince string) (persistence.AccountResult, error) {
+	m.lookups++
+	if accountID != "account-a" {
+		return persistence.AccountResult{}, persistence.ErrUnknownAccount("unknown")
+	}
+	return persistence.AccountResult{AccountID: accountID, FeatureFlags: m.flags}, nil
+}
+
+func (m *mockFeaturesDatabase) UpdateAccountFeatureFlags(accountID string, update map[string]*bool, accountUserID string) (persistence.FeatureFlags, error) {
+	if accountID != "account-a" {
+		return nil, persistence.ErrUnknownAccount("unknown")
+	}
+	flags := persistence.FeatureFlags{}
+	for name, enabled := range update {
+		if enabled != nil {
+			flags[name] = *enabled
+		}
+	}
+	m.flags = flags
+	return flags, nil
+}
+
+func TestRouter_featureEnabled(t *testing.T) {
+	tests := []struct {
+		name            string
+		configured      map[string]bool
+		flags           persistence.FeatureFlags
+		accountID       string
+		expectedEnabled bool
+	}{
+		{"default", nil, nil, "account-a", true},
+		{"config", map[string]bool{featureBatchIngestion: false}, nil, "account-a", false},
+		{"account", map[string]bool{featureBatchIngestion: false}, persistence.FeatureFlags{featureBatchIngestion: true}, "account-a", true},
+		{"account disabled", nil, persistence.FeatureFlags{featureBatchIngestion: false}, "account-a", false},
+		{"unknown account", map[string]bool{featureBatchIngestion: false}, nil, "account-z", false},
+		{"no account", nil, persistence.FeatureFlags{featureBatchIngestion: false}, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.Features = test.configured
+			db := &mockFeaturesDatabase{flags: test.flags}
+			rt := &router{db: db, config: cfg}
+			if enabled := rt.featureEnabled(featureBatchIngestion, test.accountID); enabled != test.expectedEnabled {
+				t.Errorf("Expected %v, got %v", test.expectedEnabled, enabled)
+			}
+			// the second lookup is expected to be served from the cache
+			rt.featureEnabled(featureBatchIngestion, test.accountID)
+			if test.accountID == "account-a" && db.lookups != 1 {
+				t.Errorf("Expected a single lookup, got %d", db.lookups)
+			}
+		})
+	}
+}
+
+func TestRouter_patchAdminAccountFeatures(t *testing.T) {
+	tests := []struct {
+		name               string
+		accountID          string
+		body               string
+		expectedStatusCode int
+		expectedResult     []featureFlagResponse
+	}{
+		{
+			"ok",
+			"account-a",
+			`{"batch-ingestion":false,"graphql":null}`,
+			http.StatusOK,
+			[]featureFlagResponse{
+				{Name: featureBatchIngestion, Enabled: false, Source: featureSourceAccount},
+				{Name: featureGraphQL, Enabled: true, Source: featureSourceDefault},
+			},
+		},
+		{
+			"unknown feature",
+			"account-a",
+			`{"teleportation":true}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"unknown account",
+			"account-z",
+			`{"graphql":false}`,
+			http.StatusNotFound,
+			nil,
+		},
+		{
+			"bad payload",
+			"account-a",
+			`{"graphql":"yes"}`,
+			http.StatusBadRequest,
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &mockFeaturesDatabase{}
+			rt := &router{db: db, config: &config.Config{}}
+			// a stale value is expected to be purged on update
+			rt.getCache().Set("account-feature-flags-account-a", `{"batch-ingestion":true}`, time.Minute)
+			m := gin.New()
+			m.PATCH("/:accountID", rt.patchAdminAccountFeatures)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPatch, "/"+test.accountID, strings.NewReader(test.body))
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedResult == nil {
+				return
+			}
+			var result []featureFlagResponse
+			json.Unmarshal(w.Body.Bytes(), &result)
+			if !reflect.DeepEqual(test.expectedResult, result) {
+				t.Errorf("Expected %v, got %v", test.expectedResult, result)
+			}
+			if rt.featureEnabled(featureBatchIngestion, "account-a") {
+				t.Error("Expected updated flags to be used")
+			}
+		})
+	}
+}
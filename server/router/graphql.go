@@ -0,0 +1,313 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/offen/offen/server/persistence"
+)
+
+const (
+	graphqlDefaultPageSize = 100
+	graphqlMaxPageSize     = exportPageSize
+)
+
+type graphqlContextKey struct{}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphqlAccountUser returns the account user the current GraphQL request
+// is made on behalf of.
+func graphqlAccountUser(p graphql.ResolveParams) (persistence.LoginResult, error) {
+	accountUser, ok := p.Context.Value(graphqlContextKey{}).(persistence.LoginResult)
+	if !ok {
+		return persistence.LoginResult{}, errors.New("router: could not find account user object in request context")
+	}
+	return accountUser, nil
+}
+
+func graphqlAccount(a persistence.LoginAccountResult) map[string]interface{} {
+	return map[string]interface{}{
+		"accountId": a.AccountID,
+		"name":      a.AccountName,
+		"role":      string(a.Role),
+		"created":   a.Created,
+	}
+}
+
+func graphqlSourceAccountID(p graphql.ResolveParams) string {
+	return p.Source.(map[string]interface{})["accountId"].(string)
+}
+
+func (rt *router) getGraphQLSchema() (*graphql.Schema, error) {
+	if rt.graphql != nil {
+		return rt.graphql, nil
+	}
+
+	eventType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Event",
+		Description: "An encrypted event. Events are decrypted using the user secret they reference.",
+		Fields: graphql.Fields{
+			"eventId":         &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"secretId":        &graphql.Field{Type: graphql.ID},
+			"encryptedSecret": &graphql.Field{Type: graphql.String},
+			"payload":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	eventConnectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "EventConnection",
+		Fields: graphql.Fields{
+			"edges": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(
+				graphql.NewObject(graphql.ObjectConfig{
+					Name: "EventEdge",
+					Fields: graphql.Fields{
+						"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+						"node":   &graphql.Field{Type: graphql.NewNonNull(eventType)},
+					},
+				}),
+			)))},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(
+				graphql.NewObject(graphql.ObjectConfig{
+					Name: "PageInfo",
+					Fields: graphql.Fields{
+						"endCursor":   &graphql.Field{Type: graphql.String},
+						"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+					},
+				}),
+			)},
+		},
+	})
+
+	summaryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AccountSummary",
+		Fields: graphql.Fields{
+			"eventCount":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"latestEventId": &graphql.Field{Type: graphql.ID},
+			"sequence":      &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	accountType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Account",
+		Fields: graphql.Fields{
+			"accountId": &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"role":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"created":   &graphql.Field{Type: graphql.DateTime},
+			"publicKey": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The account's public key, serialized as a JSON Web Key.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					account, err := rt.db.GetAccount(graphqlSourceAccountID(p), false, false, "")
+					if err != nil {
+						return nil, fmt.Errorf("router: error looking up account: %w", err)
+					}
+					key, err := json.Marshal(account.PublicKey)
+					if err != nil {
+						return nil, fmt.Errorf("router: error serializing public key: %w", err)
+					}
+					return string(key), nil
+				},
+			},
+			"retentionPeriod": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					account, err := rt.db.GetAccount(graphqlSourceAccountID(p), false, false, "")
+					if err != nil {
+						return nil, fmt.Errorf("router: error looking up account: %w", err)
+					}
+					if account.RetentionPeriod == "" {
+						return rt.getConfig().App.Retention.String(), nil
+					}
+					return account.RetentionPeriod, nil
+				},
+			},
+			"summary": &graphql.Field{
+				Type: graphql.NewNonNull(summaryType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					summary, err := rt.db.GetAccountSummary(graphqlSourceAccountID(p))
+					if err != nil {
+						return nil, fmt.Errorf("router: error looking up account summary: %w", err)
+					}
+					return map[string]interface{}{
+						"eventCount":    summary.EventCount,
+						"latestEventId": summary.LatestEventID,
+						"sequence":      summary.Sequence,
+					}, nil
+				},
+			},
+			"events": &graphql.Field{
+				Type:        graphql.NewNonNull(eventConnectionType),
+				Description: "Events in ascending order of their id, including the encrypted user secret needed for decrypting each event.",
+				Args: graphql.FieldConfigArgument{
+					"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: graphqlDefaultPageSize},
+					"after": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					first, _ := p.Args["first"].(int)
+					if first < 1 || first > graphqlMaxPageSize {
+						return nil, fmt.Errorf("router: first must be between 1 and %d", graphqlMaxPageSize)
+					}
+					after, _ := p.Args["after"].(string)
+					// one additional event is requested for finding out
+					// whether there is another page
+					events, err := rt.db.ExportEvents(graphqlSourceAccountID(p), after, first+1)
+					if err != nil {
+						return nil, fmt.Errorf("router: error looking up events: %w", err)
+					}
+					hasNextPage := len(events) > first
+					if hasNextPage {
+						events = events[:first]
+					}
+					edges := []interface{}{}
+					var endCursor interface{}
+					for _, evt := range events {
+						var secretID interface{}
+						if evt.SecretID != nil {
+							secretID = *evt.SecretID
+						}
+						edges = append(edges, map[string]interface{}{
+							"cursor": evt.EventID,
+							"node": map[string]interface{}{
+								"eventId":         evt.EventID,
+								"secretId":        secretID,
+								"encryptedSecret": evt.EncryptedSecret,
+								"payload":         evt.Payload,
+							},
+						})
+						endCursor = evt.EventID
+					}
+					return map[string]interface{}{
+						"edges": edges,
+						"pageInfo": map[string]interface{}{
+							"endCursor":   endCursor,
+							"hasNextPage": hasNextPage,
+						},
+					}, nil
+				},
+			},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"accounts": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(accountType))),
+				Description: "All accounts the current account user can access.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					accountUser, err := graphqlAccountUser(p)
+					if err != nil {
+						return nil, err
+					}
+					result := []interface{}{}
+					for _, account := range accountUser.Accounts {
+						if !rt.featureEnabled(featureGraphQL, account.AccountID) {
+							continue
+						}
+						result = append(result, graphqlAccount(account))
+					}
+					return result, nil
+				},
+			},
+			"account": &graphql.Field{
+				Type: accountType,
+				Args: graphql.FieldConfigArgument{
+					"accountId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					accountUser, err := graphqlAccountUser(p)
+					if err != nil {
+						return nil, err
+					}
+					accountID, _ := p.Args["accountId"].(string)
+					if !rt.featureEnabled(featureGraphQL, accountID) {
+						return nil, fmt.Errorf("router: graphql is not enabled for account %s", accountID)
+					}
+					for _, account := range accountUser.Accounts {
+						if account.AccountID == accountID {
+							return graphqlAccount(account), nil
+						}
+					}
+					return nil, fmt.Errorf("router: account user does not have permissions to access account %s", accountID)
+				},
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+	if err != nil {
+		return nil, fmt.Errorf("router: error creating graphql schema: %w", err)
+	}
+	rt.graphql = &schema
+	return rt.graphql, nil
+}
+
+// postGraphQL executes a GraphQL query on behalf of the current account user.
+// Following GraphQL conventions, errors that occur when resolving single
+// fields are returned alongside all data that could be resolved.
+func (rt *router) postGraphQL(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("postGraphQL-%s", accountUser.AccountUserID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	var req graphqlRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	schema, err := rt.getGraphQLSchema()
+	if err != nil {
+		newJSONError(
+			err,
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         *schema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        context.WithValue(c.Request.Context(), graphqlContextKey{}, accountUser),
+	})
+	// a result without any data means the query itself could not be
+	// validated or executed
+	if result.Data == nil && result.HasErrors() {
+		c.JSON(http.StatusBadRequest, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,276 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockGraphQLDatabase struct {
+	persistence.Service
+	events    []persistence.ExportedEventResult
+	exportErr error
+	cursors   []string
+	limits    []int
+	flags     map[string]persistence.FeatureFlags
+}
+
+func (m *mockGraphQLDatabase) GetAccount(accountID string, styles, events bool, eventsSince string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{AccountID: accountID, FeatureFlags: m.flags[accountID]}, nil
+}
+
+func (m *mockGraphQLDatabase) ExportEvents(accountID, cursor string, limit int) ([]persistence.ExportedEventResult, error) {
+	m.cursors = append(m.cursors, cursor)
+	m.limits = append(m.limits, limit)
+	if limit < len(m.events) {
+		return m.events[:limit], m.exportErr
+	}
+	return m.events, m.exportErr
+}
+
+func (m *mockGraphQLDatabase) GetAccountSummary(accountID string) (persistence.AccountSummaryResult, error) {
+	return persistence.AccountSummaryResult{AccountID: accountID, EventCount: int64(len(m.events))}, nil
+}
+
+type graphqlTestResponse struct {
+	Data struct {
+		Accounts []struct {
+			AccountID string `json:"accountId"`
+			Name      string `json:"name"`
+			Role      string `json:"role"`
+		} `json:"accounts"`
+		Account *struct {
+			Summary struct {
+				EventCount int `json:"eventCount"`
+			} `json:"summary"`
+			Events struct {
+				Edges []struct {
+					Cursor string `json:"cursor"`
+					Node   struct {
+						EventID         string  `json:"eventId"`
+						SecretID        *string `json:"secretId"`
+						EncryptedSecret string  `json:"encryptedSecret"`
+						Payload         string  `json:"payload"`
+					} `json:"node"`
+				} `json:"edges"`
+				PageInfo struct {
+					EndCursor   *string `json:"endCursor"`
+					HasNextPage bool    `json:"hasNextPage"`
+				} `json:"pageInfo"`
+			} `json:"events"`
+		} `json:"account"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func TestRouter_postGraphQL(t *testing.T) {
+	secretID := "secret-a"
+	accountUser := persistence.LoginResult{
+		AccountUserID: "user-a",
+		Accounts: []persistence.LoginAccountResult{
+			{AccountID: "account-a", AccountName: "Account A", Role: persistence.AccountUserRoleAdmin},
+			{AccountID: "account-b", AccountName: "Account B", Role: persistence.AccountUserRoleViewer},
+		},
+	}
+	db := &mockGraphQLDatabase{events: []persistence.ExportedEventResult{
+		{EventID: "event-a", SecretID: &secretID, EncryptedSecret: "encrypted-a", Payload: "payload-a"},
+		{EventID: "event-b", Payload: "payload-b"},
+		{EventID: "event-c", Payload: "payload-c"},
+	}}
+
+	tests := []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+		assert             func(*testing.T, graphqlTestResponse)
+	}{
+		{
+			"bad payload",
+			`{"query":`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"invalid query",
+			`{"query":"{ zomfg }"}`,
+			http.StatusBadRequest,
+			func(t *testing.T, res graphqlTestResponse) {
+				if len(res.Errors) == 0 {
+					t.Error("Expected errors to be returned")
+				}
+			},
+		},
+		{
+			"accounts",
+			`{"query":"{ accounts { accountId name role } }"}`,
+			http.StatusOK,
+			func(t *testing.T, res graphqlTestResponse) {
+				if len(res.Data.Accounts) != 2 {
+					t.Fatalf("Unexpected accounts %v", res.Data.Accounts)
+				}
+				if res.Data.Accounts[1].AccountID != "account-b" || res.Data.Accounts[1].Name != "Account B" || res.Data.Accounts[1].Role != "viewer" {
+					t.Errorf("Unexpected account %v", res.Data.Accounts[1])
+				}
+			},
+		},
+		{
+			"account not accessible",
+			`{"query":"{ account(accountId: \"account-z\") { accountId } }"}`,
+			http.StatusOK,
+			func(t *testing.T, res graphqlTestResponse) {
+				if res.Data.Account != nil || len(res.Errors) != 1 {
+					t.Errorf("Unexpected response %v", res)
+				}
+			},
+		},
+		{
+			"events",
+			`{"query":"query Events($first: Int) { account(accountId: \"account-a\") { summary { eventCount } events(first: $first) { edges { cursor node { eventId secretId encryptedSecret payload } } pageInfo { endCursor hasNextPage } } } }","variables":{"first":2}}`,
+			http.StatusOK,
+			func(t *testing.T, res graphqlTestResponse) {
+				if len(res.Errors) != 0 {
+					t.Fatalf("Unexpected errors %v", res.Errors)
+				}
+				account := res.Data.Account
+				if account.Summary.EventCount != 3 {
+					t.Errorf("Unexpected summary %v", account.Summary)
+				}
+				if len(account.Events.Edges) != 2 {
+					t.Fatalf("Unexpected edges %v", account.Events.Edges)
+				}
+				first := account.Events.Edges[0]
+				if first.Cursor != "event-a" || first.Node.SecretID == nil || *first.Node.SecretID != "secret-a" || first.Node.EncryptedSecret != "encrypted-a" {
+					t.Errorf("Unexpected edge %v", first)
+				}
+				if account.Events.Edges[1].Node.SecretID != nil {
+					t.Errorf("Expected nil secret id, got %v", account.Events.Edges[1].Node.SecretID)
+				}
+				if !account.Events.PageInfo.HasNextPage || *account.Events.PageInfo.EndCursor != "event-b" {
+					t.Errorf("Unexpected page info %v", account.Events.PageInfo)
+				}
+			},
+		},
+		{
+			"page size out of range",
+			`{"query":"{ account(accountId: \"account-a\") { events(first: 5000) { pageInfo { hasNextPage } } } }"}`,
+			http.StatusOK,
+			func(t *testing.T, res graphqlTestResponse) {
+				if len(res.Errors) != 1 {
+					t.Errorf("Unexpected errors %v", res.Errors)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: db, config: &config.Config{}}
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyAuth, accountUser)
+			}, rt.postGraphQL)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.assert == nil {
+				return
+			}
+			var res graphqlTestResponse
+			if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+				t.Fatalf("Unexpected error decoding response %v", err)
+			}
+			test.assert(t, res)
+		})
+	}
+
+	t.Run("feature disabled for account", func(t *testing.T) {
+		db := &mockGraphQLDatabase{flags: map[string]persistence.FeatureFlags{
+			"account-a": {featureGraphQL: false},
+		}}
+		rt := router{db: db, config: &config.Config{}}
+		m := gin.New()
+		m.POST("/", func(c *gin.Context) {
+			c.Set(contextKeyAuth, accountUser)
+		}, rt.postGraphQL)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"query":"{ accounts { accountId } }"}`))
+		m.ServeHTTP(w, r)
+		var res graphqlTestResponse
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatalf("Unexpected error decoding response %v", err)
+		}
+		if len(res.Data.Accounts) != 1 || res.Data.Accounts[0].AccountID != "account-b" {
+			t.Errorf("Unexpected accounts %v", res.Data.Accounts)
+		}
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"query":"{ account(accountId: \"account-a\") { accountId } }"}`))
+		m.ServeHTTP(w, r)
+		res = graphqlTestResponse{}
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatalf("Unexpected error decoding response %v", err)
+		}
+		if res.Data.Account != nil || len(res.Errors) != 1 {
+			t.Errorf("Unexpected response %v", res)
+		}
+		if len(db.cursors) != 0 {
+			t.Errorf("Expected no events to be exported, got cursors %v", db.cursors)
+		}
+	})
+
+	t.Run("feature enabled for account", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.App.Features = map[string]bool{featureGraphQL: false}
+		db := &mockGraphQLDatabase{flags: map[string]persistence.FeatureFlags{
+			"account-b": {featureGraphQL: true},
+		}}
+		rt := router{db: db, config: cfg}
+		m := gin.New()
+		m.POST("/", func(c *gin.Context) {
+			c.Set(contextKeyAuth, accountUser)
+		}, rt.postGraphQL)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"query":"{ accounts { accountId } }"}`))
+		m.ServeHTTP(w, r)
+		var res graphqlTestResponse
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatalf("Unexpected error decoding response %v", err)
+		}
+		if len(res.Data.Accounts) != 1 || res.Data.Accounts[0].AccountID != "account-b" {
+			t.Errorf("Unexpected accounts %v", res.Data.Accounts)
+		}
+	})
+
+	t.Run("export error", func(t *testing.T) {
+		rt := router{db: &mockGraphQLDatabase{exportErr: errors.New("did not work")}, config: &config.Config{}}
+		m := gin.New()
+		m.POST("/", func(c *gin.Context) {
+			c.Set(contextKeyAuth, accountUser)
+		}, rt.postGraphQL)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"query":"{ account(accountId: \"account-a\") { accountId events { pageInfo { hasNextPage } } } }"}`))
+		m.ServeHTTP(w, r)
+		var res graphqlTestResponse
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatalf("Unexpected error decoding response %v", err)
+		}
+		if len(res.Errors) != 1 {
+			t.Errorf("Unexpected errors %v", res.Errors)
+		}
+	})
+}
@@ -4,13 +4,33 @@
 package router
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/mailer"
 )
 
+const healthCheckTimeout = time.Second * 5
+
+type healthComponent struct {
+	OK bool `json:"ok"`
+}
+
+type deepHealthResponse struct {
+	OK         bool                       `json:"ok"`
+	Components map[string]healthComponent `json:"components"`
+}
+
 func (rt *router) getHealth(c *gin.Context) {
+	if c.Query("deep") == "1" && rt.getConfig() != nil && rt.getConfig().Server.DeepHealthCheck {
+		rt.getDeepHealth(c)
+		return
+	}
 	if err := rt.db.CheckHealth(); err != nil {
 		newJSONError(
 			fmt.Errorf("router: failed checking health of connected persistence layer: %v", err),
@@ -20,3 +40,106 @@ func (rt *router) getHealth(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, map[string]bool{"ok": true})
 }
+
+// getDeepHealth checks all dependencies of the router concurrently and
+// reports the status of each of them. Dependencies that are not configured
+// are not part of the response. As the endpoint is not authenticated and
+// contacts external services, requests are throttled and error details are
+// only written to the log.
+func (rt *router) getDeepHealth(c *gin.Context) {
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, "getDeepHealth"); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+	defer cancel()
+
+	checks := map[string]func(context.Context) error{
+		"database": func(context.Context) error {
+			return rt.db.CheckHealth()
+		},
+	}
+	if checker, ok := rt.mailer.(mailer.HealthChecker); ok {
+		checks["mailer"] = func(context.Context) error {
+			return checker.CheckHealth()
+		}
+	}
+	if rt.fs != nil {
+		checks["filesystem"] = func(context.Context) error {
+			f, err := rt.fs.Open("/")
+			if err != nil {
+				return err
+			}
+			return f.Close()
+		}
+	}
+	for name, issuer := range rt.oidcIssuers {
+		issuer := issuer
+		checks["oidc:"+name] = func(ctx context.Context) error {
+			return checkOIDCDiscovery(ctx, issuer)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	result := deepHealthResponse{OK: true, Components: map[string]healthComponent{}}
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) error) {
+			defer wg.Done()
+			err := runHealthCheck(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.OK = false
+				rt.logError(err, fmt.Sprintf("health check for %s failed", name))
+			}
+			result.Components[name] = healthComponent{OK: err == nil}
+		}(name, check)
+	}
+	wg.Wait()
+
+	if !result.OK {
+		c.JSON(http.StatusBadGateway, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// runHealthCheck calls check, returning an error in case it does not
+// return before ctx is done.
+func runHealthCheck(ctx context.Context, check func(context.Context) error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+func checkOIDCDiscovery(ctx context.Context, issuer string) error {
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", nil,
+	)
+	if err != nil {
+		return fmt.Errorf("router: error creating discovery request: %w", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("router: error requesting discovery document: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("router: discovery document returned unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
@@ -4,13 +4,18 @@
 package router
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
 )
 
 type mockHealthChecker struct {
@@ -52,3 +57,135 @@ func TestRouter_getHealth(t *testing.T) {
 		}
 	})
 }
+
+type mockHealthMailer struct {
+	err error
+}
+
+func (m *mockHealthMailer) Send(from, to, subject, body string) error {
+	return nil
+}
+
+func (m *mockHealthMailer) CheckHealth() error {
+	return m.err
+}
+
+func TestRouter_getHealth_deep(t *testing.T) {
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer issuer.Close()
+
+	enabled := &config.Config{}
+	enabled.Server.DeepHealthCheck = true
+
+	tests := []struct {
+		name               string
+		rt                 *router
+		query              string
+		expectedStatusCode int
+		expectedComponents map[string]bool
+	}{
+		{
+			"disabled",
+			&router{db: &mockHealthChecker{}, config: &config.Config{}, mailer: &mockHealthMailer{err: errors.New("did not work")}},
+			"?deep=1",
+			http.StatusOK,
+			nil,
+		},
+		{
+			"not requested",
+			&router{db: &mockHealthChecker{}, config: enabled, mailer: &mockHealthMailer{err: errors.New("did not work")}},
+			"",
+			http.StatusOK,
+			nil,
+		},
+		{
+			"ok",
+			&router{
+				db:          &mockHealthChecker{},
+				config:      enabled,
+				mailer:      &mockHealthMailer{},
+				fs:          http.Dir("."),
+				oidcIssuers: map[string]string{"main": issuer.URL},
+			},
+			"?deep=1",
+			http.StatusOK,
+			map[string]bool{"database": true, "mailer": true, "filesystem": true, "oidc:main": true},
+		},
+		{
+			"failing components",
+			&router{
+				db:          &mockHealthChecker{err: errors.New("did not work")},
+				config:      enabled,
+				mailer:      &mockHealthMailer{err: errors.New("did not work")},
+				oidcIssuers: map[string]string{"main": issuer.URL + "/unknown"},
+			},
+			"?deep=1",
+			http.StatusBadGateway,
+			map[string]bool{"database": false, "mailer": false, "oidc:main": false},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			m.GET("/", test.rt.getHealth)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/"+test.query, nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedComponents == nil {
+				return
+			}
+			var res deepHealthResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if len(res.Components) != len(test.expectedComponents) {
+				t.Errorf("Unexpected components %v", res.Components)
+			}
+			for name, ok := range test.expectedComponents {
+				if res.Components[name].OK != ok {
+					t.Errorf("Unexpected status for component %s: %v", name, res.Components[name])
+				}
+			}
+			if strings.Contains(w.Body.String(), "did not work") {
+				t.Errorf("Unexpected error details in response %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_getHealth_deepThrottled(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.DeepHealthCheck = true
+	rt := &router{
+		db:      &mockHealthChecker{},
+		config:  cfg,
+		limiter: ratelimiter.New(0, ratelimiter.NewMemoryBackend(time.Minute)),
+	}
+	m := gin.New()
+	m.GET("/", rt.getHealth)
+
+	for _, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/?deep=1", nil)
+		m.ServeHTTP(w, r)
+		if w.Code != expected {
+			t.Errorf("Expected status code %v, got %v", expected, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected shallow health check to pass, got %v", w.Code)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultHoneypotPaths are commonly requested by vulnerability scanners
+// probing for software or files that are never served by Offen.
+var defaultHoneypotPaths = []string{
+	"/.env",
+	"/.git",
+	"/.aws",
+	"/.ds_store",
+	"/.htaccess",
+	"/wp-admin",
+	"/wp-content",
+	"/wp-includes",
+	"/wp-login",
+	"/xmlrpc",
+	"/phpmyadmin",
+	"/pma",
+	"/cgi-bin",
+	"/boaform",
+	"/actuator",
+	"/hnap1",
+	"/server-status",
+	"/vendor/phpunit",
+	"/owa",
+	"/solr",
+}
+
+// honeypotExtensions are file extensions of server side scripts, none of
+// which are served by Offen.
+var honeypotExtensions = []string{".php", ".asp", ".aspx", ".jsp", ".cgi"}
+
+const (
+	// honeypotInterval is the minimum interval between two honeypot requests
+	// of the same offender. Subsequent requests are held by the rate limiter.
+	honeypotInterval = time.Minute
+	// honeypotConcurrency limits the number of requests that are tarpitted
+	// at the same time, so offenders cannot exhaust resources by opening
+	// lots of connections.
+	honeypotConcurrency = 64
+	// honeypotChunks is the number of chunks a tarpitted response is
+	// trickled out in.
+	honeypotChunks = 10
+)
+
+// matchHoneypot checks whether the given path is requested by vulnerability
+// scanners only.
+func matchHoneypot(path string, prefixes []string) bool {
+	path = strings.ToLower(path)
+	for _, prefix := range prefixes {
+		prefix = strings.ToLower(strings.TrimSuffix(prefix, "/"))
+		if prefix == "" {
+			continue
+		}
+		if path == prefix || strings.HasPrefix(path, prefix+"/") || strings.HasPrefix(path, prefix+".") {
+			return true
+		}
+	}
+	for _, ext := range honeypotExtensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// honeypot wraps the given handler, answering requests for paths that are
+// only requested by vulnerability scanners with deliberately slow responses.
+// Such requests never reach the application, so they neither hit the
+// database nor show up in the access log. Offenders are identified by their
+// IP address and user agent and are rate limited on subsequent requests.
+func (rt *router) honeypot(next http.Handler) http.Handler {
+	cfg := rt.getConfig().Honeypot
+	if !cfg.Enabled {
+		return next
+	}
+	paths := append(append([]string{}, defaultHoneypotPaths...), cfg.Paths...)
+	slots := make(chan struct{}, honeypotConcurrency)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !matchHoneypot(r.URL.Path, paths) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		fingerprint := rt.offenderFingerprint(r)
+		if l := <-rt.getLimiter().LinearThrottle(honeypotInterval, fmt.Sprintf("honeypot-%s", fingerprint)); l.Error != nil {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if rt.logger != nil {
+			rt.logger.WithField("offender", fingerprint[:12]).Debugf("Tarpitting request for %s", r.URL.Path)
+		}
+		tarpit(w, r, rt.getConfig().Honeypot.Delay)
+	})
+}
+
+// offenderFingerprint identifies the client of the given request without
+// storing its IP address in clear text.
+func (rt *router) offenderFingerprint(r *http.Request) string {
+	ip := clientIP(r, rt.trustedProxies())
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(ip.String()+"|"+r.UserAgent())))
+}
+
+// tarpit responds with a 404 that is trickled out over the given duration
+// or until the client gives up.
+func tarpit(w http.ResponseWriter, r *http.Request, d time.Duration) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	body := []byte("404 page not found\n")
+	if d <= 0 {
+		w.Write(body)
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+
+	ticker := time.NewTicker(d / honeypotChunks)
+	defer ticker.Stop()
+	chunkSize := (len(body) + honeypotChunks - 1) / honeypotChunks
+	for len(body) > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		n := chunkSize
+		if n > len(body) {
+			n = len(body)
+		}
+		if _, err := w.Write(body[:n]); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		body = body[n:]
+	}
+}
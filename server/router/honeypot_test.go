@@ -0,0 +1,76 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+func TestMatchHoneypot(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/wp-login.php", true},
+		{"/WP-ADMIN/setup-config.php", true},
+		{"/.env", true},
+		{"/.env.production", true},
+		{"/.git/config", true},
+		{"/some/nested/shell.php", true},
+		{"/custom/probe", true},
+		{"/", false},
+		{"/api/events", false},
+		{"/environment/", false},
+		{"/auditorium/", false},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if result := matchHoneypot(test.path, append(defaultHoneypotPaths, "/custom/")); result != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestRouter_honeypot(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		rt := router{config: &config.Config{}}
+		w := httptest.NewRecorder()
+		rt.honeypot(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/wp-login.php", nil))
+		if w.Code != http.StatusTeapot {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.Honeypot.Enabled = true
+		rt := router{config: cfg, limiter: ratelimiter.NewNoopRateLimiter()}
+		handler := rt.honeypot(next)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if w.Code != http.StatusTeapot {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.env", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		if w.Body.String() != "404 page not found\n" {
+			t.Errorf("Unexpected body %q", w.Body.String())
+		}
+	})
+}
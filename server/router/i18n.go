@@ -0,0 +1,78 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/offen/offen/server/locales"
+)
+
+// accountLocale returns the locale set for the given account, or an empty
+// string in case the locale is negotiated. Values are cached the same way
+// retention periods are.
+func (rt *router) accountLocale(accountID string) string {
+	cache, cacheKey := rt.getCache(), fmt.Sprintf("account-locale-%s", accountID)
+	locale, ok := cache.Get(cacheKey)
+	if !ok {
+		account, err := rt.db.GetAccount(accountID, false, false, "")
+		if err != nil {
+			return ""
+		}
+		locale = account.Locale
+		cache.Set(cacheKey, locale, time.Minute*5)
+	}
+	return locale
+}
+
+// negotiateLocale returns the locale output for the given request is
+// rendered in. The first locale set for any of the given accounts is used,
+// followed by the languages accepted by the client. In case no match is
+// found, or no localized templates are available, the configured locale
+// is returned.
+func (rt *router) negotiateLocale(r *http.Request, accountIDs ...string) string {
+	fallback := rt.getConfig().App.Locale.String()
+	if len(rt.localized) == 0 {
+		return fallback
+	}
+	var candidates []string
+	for _, accountID := range accountIDs {
+		if accountID != "" {
+			candidates = append(candidates, rt.accountLocale(accountID))
+		}
+	}
+	if r != nil {
+		candidates = append(candidates, r.Header.Get("Accept-Language"))
+	}
+	available := make([]string, 0, len(rt.localized))
+	for locale := range rt.localized {
+		available = append(available, locale)
+	}
+	return locales.Negotiate(available, fallback, candidates...)
+}
+
+// emailsFor returns the email templates for the given locale.
+func (rt *router) emailsFor(locale string) *template.Template {
+	if rt.emailTemplates != nil {
+		return rt.emailTemplates.Lookup(locale)
+	}
+	return rt.emails
+}
+
+// renderHTML renders the HTML template of the given name in the locale
+// negotiated for the request.
+func (rt *router) renderHTML(c *gin.Context, status int, name string, data map[string]interface{}) {
+	locale := rt.negotiateLocale(c.Request)
+	data["lang"] = locale
+	if t, ok := rt.localized[locale]; ok && t != nil {
+		c.Render(status, render.HTML{Template: t, Name: name, Data: templateData(c, data)})
+		return
+	}
+	c.HTML(status, name, templateData(c, data))
+}
@@ -0,0 +1,62 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockLocaleDatabase struct {
+	persistence.Service
+	locale string
+}
+
+func (m *mockLocaleDatabase) GetAccount(accountID string, includeStyles bool, includeEvents bool, eventsSince string) (persistence.AccountResult, error) {
+	if accountID != "account-a" {
+		return persistence.AccountResult{}, persistence.ErrUnknownAccount("unknown")
+	}
+	return persistence.AccountResult{AccountID: accountID, Locale: m.locale}, nil
+}
+
+func TestRouter_negotiateLocale(t *testing.T) {
+	tests := []struct {
+		name           string
+		localized      []string
+		accountLocale  string
+		acceptLanguage string
+		accountIDs     []string
+		expected       string
+	}{
+		{"no localized templates", nil, "fr", "de", []string{"account-a"}, "en"},
+		{"fallback", []string{"en", "de", "fr"}, "", "", nil, "en"},
+		{"accept language", []string{"en", "de", "fr"}, "", "es, de;q=0.8", nil, "de"},
+		{"account locale", []string{"en", "de", "fr"}, "fr", "de", []string{"account-a"}, "fr"},
+		{"account without locale", []string{"en", "de", "fr"}, "", "de", []string{"account-a"}, "de"},
+		{"unknown account", []string{"en", "de", "fr"}, "fr", "de", []string{"account-z"}, "de"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.Locale = config.Locale("en")
+			rt := &router{db: &mockLocaleDatabase{locale: test.accountLocale}, config: cfg}
+			for _, locale := range test.localized {
+				WithLocalizedTemplates(locale, template.New(locale))(rt)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", test.acceptLanguage)
+			}
+			result := rt.negotiateLocale(r, test.accountIDs...)
+			if result != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+)
+
+const (
+	// headerIdempotencyKey is sent by clients that might retry requests,
+	// e.g. on flaky mobile connections.
+	headerIdempotencyKey = "Idempotency-Key"
+	// headerIdempotentReplayed is set on responses to requests that
+	// have already been handled before.
+	headerIdempotentReplayed = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength is long enough for UUIDs and ULIDs while
+	// keeping clients from storing arbitrary data in the cache.
+	maxIdempotencyKeyLength = 128
+	// idempotencyPendingExpiry is the time a key is reserved for while
+	// the request using it is being handled.
+	idempotencyPendingExpiry = time.Second * 30
+)
+
+type idempotencyState string
+
+const (
+	idempotencyUnseen  idempotencyState = ""
+	idempotencyPending idempotencyState = "pending"
+	idempotencyDone    idempotencyState = "done"
+)
+
+// idempotencyCacheKeyFor scopes the given key to the user and account, so keys
+// picked by different clients never collide.
+func idempotencyCacheKeyFor(userID, accountID, key string) string {
+	return fmt.Sprintf("idempotency-%x", sha256.Sum256([]byte(userID+"|"+accountID+"|"+key)))
+}
+
+func validateIdempotencyKey(field, key string) []string {
+	if len(key) > maxIdempotencyKeyLength {
+		return []string{fmt.Sprintf("%s: must not be longer than %d characters", field, maxIdempotencyKeyLength)}
+	}
+	return nil
+}
+
+// claimIdempotencyKey returns the state of the given cache key, reserving it
+// in case it has not been seen before. Callers are expected to call
+// releaseIdempotencyKey once they are done handling the request.
+func (rt *router) claimIdempotencyKey(cacheKey string) idempotencyState {
+	cache := rt.getCache()
+	if state, ok := cache.Get(cacheKey); ok {
+		return idempotencyState(state)
+	}
+	cache.Set(cacheKey, string(idempotencyPending), idempotencyPendingExpiry)
+	return idempotencyUnseen
+}
+
+// releaseIdempotencyKey marks the given cache key as done in case the request
+// has succeeded, so that retries within the configured window are skipped.
+// Failed requests release the key so they can be retried.
+func (rt *router) releaseIdempotencyKey(cacheKey string, succeeded bool) {
+	window := rt.getConfig().App.IdempotencyWindow
+	if !succeeded || window <= 0 {
+		rt.getCache().Delete(cacheKey)
+		return
+	}
+	rt.getCache().Set(cacheKey, string(idempotencyDone), window)
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockIdempotentEventsService struct {
+	persistence.Service
+	inserted int
+	err      error
+}
+
+func (m *mockIdempotentEventsService) Insert(string, string, string, string, *string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.inserted++
+	return nil
+}
+
+func (m *mockIdempotentEventsService) InsertBatch(userID string, events []persistence.BatchEvent) ([]error, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.inserted += len(events)
+	return make([]error, len(events)), nil
+}
+
+func (m *mockIdempotentEventsService) GetAccount(string, bool, bool, string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{}, nil
+}
+
+func newIdempotencyTestRouter(db persistence.Service, window time.Duration) (*router, *gin.Engine) {
+	cfg := &config.Config{}
+	cfg.App.IdempotencyWindow = window
+	rt := &router{db: db, config: cfg}
+	m := gin.New()
+	withUser := func(c *gin.Context) {
+		c.Set(contextKeyCookie, "user-id")
+		c.Next()
+	}
+	m.POST("/", withUser, rt.postEvents)
+	m.POST("/batch", withUser, rt.postEventsBatch)
+	return rt, m
+}
+
+func TestRouter_postEvents_Idempotency(t *testing.T) {
+	t.Run("header", func(t *testing.T) {
+		db := &mockIdempotentEventsService{}
+		_, m := newIdempotencyTestRouter(db, time.Hour)
+		for i := 0; i < 3; i++ {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"accountId":"account-a","payload":"some-payload"}`))
+			r.Header.Set("Idempotency-Key", "key-a")
+			m.ServeHTTP(w, r)
+			if w.Code != http.StatusCreated {
+				t.Errorf("Unexpected status code %d", w.Code)
+			}
+			if replayed := w.Header().Get("Idempotent-Replayed"); (replayed == "true") != (i > 0) {
+				t.Errorf("Unexpected replay header %q in request %d", replayed, i)
+			}
+		}
+		if db.inserted != 1 {
+			t.Errorf("Expected a single insert, got %d", db.inserted)
+		}
+	})
+	t.Run("client event id", func(t *testing.T) {
+		db := &mockIdempotentEventsService{}
+		_, m := newIdempotencyTestRouter(db, time.Hour)
+		for _, body := range []string{
+			`{"accountId":"account-a","payload":"a","clientEventId":"event-a"}`,
+			`{"accountId":"account-a","payload":"a","clientEventId":"event-a"}`,
+			`{"accountId":"account-a","payload":"b","clientEventId":"event-b"}`,
+			`{"accountId":"account-b","payload":"a","clientEventId":"event-a"}`,
+		} {
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+			if w.Code != http.StatusCreated {
+				t.Errorf("Unexpected status code %d", w.Code)
+			}
+		}
+		if db.inserted != 3 {
+			t.Errorf("Expected 3 inserts, got %d", db.inserted)
+		}
+	})
+	t.Run("failed insert", func(t *testing.T) {
+		db := &mockIdempotentEventsService{err: errors.New("did not work")}
+		_, m := newIdempotencyTestRouter(db, time.Hour)
+		body := `{"accountId":"account-a","payload":"a","clientEventId":"event-a"}`
+
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("Unexpected status code %d", w.Code)
+		}
+
+		db.err = nil
+		w = httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if w.Code != http.StatusCreated || db.inserted != 1 {
+			t.Errorf("Expected retry to be inserted, got status %d and %d inserts", w.Code, db.inserted)
+		}
+	})
+	t.Run("pending", func(t *testing.T) {
+		db := &mockIdempotentEventsService{}
+		rt, m := newIdempotencyTestRouter(db, time.Hour)
+		rt.claimIdempotencyKey(idempotencyCacheKeyFor("user-id", "account-a", "event-a"))
+
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"accountId":"account-a","payload":"a","clientEventId":"event-a"}`)))
+		if w.Code != http.StatusConflict || db.inserted != 0 {
+			t.Errorf("Expected conflict, got status %d and %d inserts", w.Code, db.inserted)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		db := &mockIdempotentEventsService{}
+		_, m := newIdempotencyTestRouter(db, 0)
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"accountId":"account-a","payload":"a","clientEventId":"event-a"}`)))
+		}
+		if db.inserted != 2 {
+			t.Errorf("Expected 2 inserts, got %d", db.inserted)
+		}
+	})
+	t.Run("key too long", func(t *testing.T) {
+		db := &mockIdempotentEventsService{}
+		_, m := newIdempotencyTestRouter(db, time.Hour)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"accountId":"account-a","payload":"a"}`))
+		r.Header.Set("Idempotency-Key", strings.Repeat("k", maxIdempotencyKeyLength+1))
+		m.ServeHTTP(w, r)
+		if w.Code != http.StatusUnprocessableEntity || db.inserted != 0 {
+			t.Errorf("Expected validation error, got status %d and %d inserts", w.Code, db.inserted)
+		}
+	})
+}
+
+func TestRouter_postEventsBatch_Idempotency(t *testing.T) {
+	db := &mockIdempotentEventsService{}
+	_, m := newIdempotencyTestRouter(db, time.Hour)
+	body := `[{"accountId":"account-a","payload":"a","clientEventId":"event-a"},{"accountId":"account-a","payload":"b"}]`
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Errorf("Unexpected status code %d", w.Code)
+		}
+		if expected := `{"results":[{"ack":true,"status":201},{"ack":true,"status":201}]}`; w.Body.String() != expected {
+			t.Errorf("Unexpected body %s", w.Body.String())
+		}
+	}
+	// the event without a client event id is inserted twice
+	if db.inserted != 3 {
+		t.Errorf("Expected 3 inserts, got %d", db.inserted)
+	}
+}
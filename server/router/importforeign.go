@@ -0,0 +1,69 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/foreignimport"
+	"github.com/offen/offen/server/persistence"
+)
+
+// postAdminImportForeign converts the data exported from another analytics
+// tool that is passed as the request body into events of the given account.
+func (rt *router) postAdminImportForeign(c *gin.Context) {
+	accountID, source := c.Query("accountId"), c.Query("source")
+	if accountID == "" {
+		newJSONError(
+			errors.New("router: accountId is required"),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	rows, err := foreignimport.Parse(source, c.Request.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			newJSONError(
+				fmt.Errorf("router: request body exceeds the limit of %d bytes", maxBytesErr.Limit),
+				http.StatusRequestEntityTooLarge,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error reading export: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	result, err := foreignimport.Import(rt.db, accountID, c.Query("root"), source, rows)
+	if err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		var invalidErr foreignimport.ErrInvalidExport
+		switch {
+		case errors.As(err, &errUnknown):
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+		case errors.As(err, &invalidErr):
+			newJSONError(
+				fmt.Errorf("router: error importing export: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+		default:
+			newJSONError(
+				fmt.Errorf("router: error importing events, %d events have been imported before failing: %w", result.Events, err),
+				http.StatusInternalServerError,
+			).Pipe(c)
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
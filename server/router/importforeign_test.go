@@ -0,0 +1,112 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockImportForeignDatabase struct {
+	persistence.Service
+	publicKey jwk.Key
+	inserted  int
+}
+
+func (m *mockImportForeignDatabase) GetAccount(accountID string, styles, events bool, eventsSince string) (persistence.AccountResult, error) {
+	if accountID != "account-a" {
+		return persistence.AccountResult{}, persistence.ErrUnknownAccount("not found")
+	}
+	return persistence.AccountResult{AccountID: accountID, PublicKey: m.publicKey}, nil
+}
+
+func (m *mockImportForeignDatabase) AssociateUserSecret(accountID, userID, encryptedUserSecret string) error {
+	return nil
+}
+
+func (m *mockImportForeignDatabase) InsertBatch(userID string, events []persistence.BatchEvent) ([]error, error) {
+	m.inserted += len(events)
+	return make([]error, len(events)), nil
+}
+
+func TestRouter_postAdminImportForeign(t *testing.T) {
+	publicKey, _, err := keys.GenerateRSAKeypair(2048)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	set, _ := jwk.ParseString(string(publicKey))
+	key, _ := set.Get(0)
+
+	export := "date,page,visitors,pageviews\n2022-04-01,/,2,3\n"
+	tests := []struct {
+		name               string
+		query              string
+		body               string
+		expectedStatusCode int
+		expectedInserted   int
+	}{
+		{
+			"missing account",
+			"?source=plausible",
+			export,
+			http.StatusBadRequest,
+			0,
+		},
+		{
+			"unsupported source",
+			"?accountId=account-a&source=other",
+			export,
+			http.StatusBadRequest,
+			0,
+		},
+		{
+			"unknown account",
+			"?accountId=account-z&source=plausible&root=https://www.example.net",
+			export,
+			http.StatusNotFound,
+			0,
+		},
+		{
+			"missing root",
+			"?accountId=account-a&source=plausible",
+			export,
+			http.StatusBadRequest,
+			0,
+		},
+		{
+			"ok",
+			"?accountId=account-a&source=plausible&root=https://www.example.net",
+			export,
+			http.StatusCreated,
+			3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &mockImportForeignDatabase{publicKey: key}
+			rt := router{db: db, config: &config.Config{}}
+			m := gin.New()
+			m.POST("/", rt.postAdminImportForeign)
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/"+test.query, strings.NewReader(test.body)))
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if db.inserted != test.expectedInserted {
+				t.Errorf("Expected %d events to be inserted, got %d", test.expectedInserted, db.inserted)
+			}
+			if test.expectedStatusCode == http.StatusCreated && !strings.Contains(w.Body.String(), `"events":3`) {
+				t.Errorf("Unexpected response body %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@
 package router
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -11,54 +12,41 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/offen/offen/server/css"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/stylestore"
 )
 
-func (rt *router) getVault(c *gin.Context) {
-	accountID := c.Request.URL.Query().Get("accountId")
-	if accountID == "" {
-		c.HTML(http.StatusOK, "vault", map[string]interface{}{
-			"accountStyles": nil,
-		})
-		return
+// accountStyles returns the custom styles of the given account and the
+// duration they can be cached for. Styles that cannot be read or do not pass
+// validation are replaced with default styling.
+func (rt *router) accountStyles(accountID string) (string, time.Duration, error) {
+	ttl := 5 * time.Minute
+	if rt.getConfig().App.Development || rt.getConfig().App.DemoAccount != "" {
+		ttl = time.Second
 	}
 
 	cache, cacheKey := rt.getCache(), fmt.Sprintf("account-styles-%s", accountID)
-	if cachedItem, ok := cache.Get(cacheKey); ok {
-		cachedStyles, castOk := cachedItem.(string)
-		if !castOk {
-			c.HTML(http.StatusInternalServerError, "error", map[string]string{
-				"message": fmt.Sprintf("Unexpected cache item for account %s", accountID),
-			})
-			return
-		}
-
-		c.HTML(http.StatusOK, "vault", map[string]interface{}{
-			"accountStyles": template.CSS(cachedStyles),
-		})
-		return
+	if cachedStyles, ok := cache.Get(cacheKey); ok {
+		return cachedStyles, ttl, nil
 	}
 
-	account, err := rt.db.GetAccount(accountID, true, false, "")
+	styles, err := rt.getStyleStore().Get(accountID)
 	if err != nil {
-		c.HTML(http.StatusBadRequest, "error", map[string]string{
-			"message": fmt.Sprintf("Error %v looking up account %s", err, accountID),
-		})
-		return
-	}
-
-	ttl := 5 * time.Minute
-	if rt.config.App.Development || rt.config.App.DemoAccount != "" {
-		ttl = time.Second
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			return "", 0, err
+		}
+		// In case the style store is unavailable, the vault is still served
+		// using default styling, retrying shortly after.
+		styles = ""
+		ttl = 30 * time.Second
+		rt.logError(err, "error reading custom styles for account, default styling will apply")
 	}
 
-	styles := account.AccountStyles
 	if styles != "" {
 		if err := css.ValidateCSS(styles); err != nil {
 			styles = ""
-			rt.logger.WithError(err).Warnf(
-				"Custom styles for account %s in database did not pass validation, default styling will apply.",
-				account.Name,
-			)
+			rt.logError(err, fmt.Sprintf("custom styles for account %s did not pass validation, default styling will apply", accountID))
 		}
 	}
 
@@ -67,23 +55,83 @@ func (rt *router) getVault(c *gin.Context) {
 	// which might be confusing but mitigates the possibility of attacking the
 	// application by inserting malformed CSS into the database.
 	cache.Set(cacheKey, styles, ttl)
+	return styles, ttl, nil
+}
 
-	c.HTML(http.StatusOK, "vault", map[string]interface{}{
-		"accountStyles": template.CSS(styles),
-	})
+func (rt *router) getVault(c *gin.Context) {
+	accountID := c.Request.URL.Query().Get("accountId")
+	if accountID == "" {
+		c.HTML(http.StatusOK, "vault", templateData(c, rt.vaultData(accountID, nil)))
+		return
+	}
+
+	styles, _, err := rt.accountStyles(accountID)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "error", map[string]string{
+			"message": fmt.Sprintf("Error %v looking up account %s", err, accountID),
+		})
+		return
+	}
+	c.HTML(http.StatusOK, "vault", templateData(c, rt.vaultData(accountID, template.CSS(styles))))
+}
+
+// getAccountStyles serves the custom styles of an account as a stylesheet.
+// In case the style store allows clients to download styles directly, the
+// request is redirected there. Otherwise, styles are read through the store.
+func (rt *router) getAccountStyles(c *gin.Context) {
+	accountID := c.Param("accountID")
+	if redirector, ok := rt.getStyleStore().(stylestore.Redirector); ok {
+		if url := redirector.URL(accountID); url != "" {
+			c.Redirect(http.StatusFound, url)
+			return
+		}
+	}
+
+	styles, ttl, err := rt.accountStyles(accountID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up account %s: %w", accountID, err),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ttl.Seconds())))
+	c.Data(http.StatusOK, "text/css; charset=utf-8", []byte(styles))
+}
+
+// vaultData returns the data used for rendering the vault. Consent settings
+// are passed so the vault can apply the cookie policy of the account.
+// Whether cookieless pings are accepted is passed so the vault knows if it
+// should count visitors that declined consent. The theme of the account is
+// applied as well.
+func (rt *router) vaultData(accountID string, styles interface{}) map[string]interface{} {
+	data := map[string]interface{}{
+		"accountStyles":  styles,
+		"consentMaxAge":  int64(rt.consentLifetime(accountID).Seconds()),
+		"consentVersion": "",
+		"pingsEnabled":   rt.getConfig().Pings.Enabled,
+	}
+	if accountID != "" {
+		data["consentVersion"] = rt.accountCookiePolicy(accountID).PolicyVersion
+		rt.applyTheme(data, rt.accountTheme(accountID))
+	}
+	return data
 }
 
 func (rt *router) getIntro(c *gin.Context) {
-	c.HTML(http.StatusOK, "intro", map[string]interface{}{
-		"demoAccount": rt.config.App.DemoAccount,
-		"lang":        rt.config.App.Locale,
+	rt.renderHTML(c, http.StatusOK, "intro", map[string]interface{}{
+		"demoAccount": rt.getConfig().App.DemoAccount,
 	})
-	return
 }
 
+// getIndex renders the auditorium. In case a root account is configured,
+// its theme is applied.
 func (rt *router) getIndex(c *gin.Context) {
-	c.HTML(http.StatusOK, "index", map[string]interface{}{
-		"rootAccount": rt.config.App.RootAccount,
-		"lang":        rt.config.App.Locale,
-	})
+	data := map[string]interface{}{
+		"rootAccount": rt.getConfig().App.RootAccount,
+	}
+	if rootAccount := rt.getConfig().App.RootAccount; rootAccount != "" {
+		rt.applyTheme(data, rt.accountTheme(rootAccount))
+	}
+	rt.renderHTML(c, http.StatusOK, "index", data)
 }
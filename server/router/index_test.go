@@ -4,13 +4,17 @@
 package router
 
 import (
+	"errors"
 	"html/template"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/stylestore"
 )
 
 func TestRouter_getRoot(t *testing.T) {
@@ -31,3 +35,188 @@ func TestRouter_getRoot(t *testing.T) {
 		t.Errorf("Unexpected status code %v", w.Code)
 	}
 }
+
+type mockStyleStore struct {
+	styles string
+	err    error
+}
+
+func (m *mockStyleStore) Get(string) (string, error) {
+	return m.styles, m.err
+}
+
+func (m *mockStyleStore) Put(string, string) error {
+	return m.err
+}
+
+type mockVaultDatabase struct {
+	persistence.Service
+	policy *persistence.CookiePolicy
+}
+
+func (m *mockVaultDatabase) GetAccount(accountID string, includeEvents, includeInvitations bool, eventsSince string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{AccountID: accountID, CookiePolicy: m.policy}, nil
+}
+
+func TestRouter_getVault(t *testing.T) {
+	tests := []struct {
+		name               string
+		store              *mockStyleStore
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			"ok",
+			&mockStyleStore{styles: ".banner__root { color: red; }"},
+			http.StatusOK,
+			".banner__root { color: red; }",
+		},
+		{
+			"invalid styles",
+			&mockStyleStore{styles: "body { color: red; }"},
+			http.StatusOK,
+			"",
+		},
+		{
+			"unknown account",
+			&mockStyleStore{err: persistence.ErrUnknownAccount("unknown")},
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"store unavailable",
+			&mockStyleStore{err: errors.New("did not work")},
+			http.StatusOK,
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{
+				config: &config.Config{},
+				styles: test.store,
+				db:     &mockVaultDatabase{},
+			}
+			m := gin.New()
+			m.GET("/", rt.getVault)
+			tpl := template.Must(template.New("vault").Parse("{{ .accountStyles }}"))
+			template.Must(tpl.New("error").Parse("{{ .message }}"))
+			m.SetHTMLTemplate(tpl)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/?accountId=account-a", nil)
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedStatusCode == http.StatusOK && w.Body.String() != test.expectedBody {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+		})
+	}
+}
+
+type mockRedirectingStyleStore struct {
+	mockStyleStore
+	url string
+}
+
+func (m *mockRedirectingStyleStore) URL(string) string {
+	return m.url
+}
+
+func TestRouter_getAccountStyles(t *testing.T) {
+	tests := []struct {
+		name               string
+		store              stylestore.Store
+		expectedStatusCode int
+		expectedBody       string
+		expectedLocation   string
+	}{
+		{
+			"ok",
+			&mockStyleStore{styles: ".banner__root { color: red; }"},
+			http.StatusOK,
+			".banner__root { color: red; }",
+			"",
+		},
+		{
+			"unknown account",
+			&mockStyleStore{err: persistence.ErrUnknownAccount("unknown")},
+			http.StatusNotFound,
+			"",
+			"",
+		},
+		{
+			"store unavailable",
+			&mockStyleStore{err: errors.New("did not work")},
+			http.StatusOK,
+			"",
+			"",
+		},
+		{
+			"redirect",
+			&mockRedirectingStyleStore{url: "https://cdn.example.com/account-styles/account-a.css"},
+			http.StatusFound,
+			"",
+			"https://cdn.example.com/account-styles/account-a.css",
+		},
+		{
+			"no public url",
+			&mockRedirectingStyleStore{mockStyleStore: mockStyleStore{styles: ".banner__root { color: red; }"}},
+			http.StatusOK,
+			".banner__root { color: red; }",
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{config: &config.Config{}, styles: test.store}
+			m := gin.New()
+			m.GET("/:accountID", rt.getAccountStyles)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/account-a", nil)
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedStatusCode == http.StatusOK && w.Body.String() != test.expectedBody {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+			if location := w.Header().Get("Location"); location != test.expectedLocation {
+				t.Errorf("Unexpected location %s", location)
+			}
+		})
+	}
+}
+
+func TestRouter_vaultData(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.ConsentLifetime = time.Hour
+	t.Run("defaults", func(t *testing.T) {
+		rt := router{config: cfg, db: &mockVaultDatabase{}}
+		data := rt.vaultData("account-a", nil)
+		if data["consentMaxAge"] != int64(3600) || data["consentVersion"] != "" {
+			t.Errorf("Unexpected data %v", data)
+		}
+	})
+	t.Run("account policy", func(t *testing.T) {
+		rt := router{config: cfg, db: &mockVaultDatabase{
+			policy: &persistence.CookiePolicy{ConsentLifetime: "24h", PolicyVersion: "2022-06"},
+		}}
+		data := rt.vaultData("account-a", nil)
+		if data["consentMaxAge"] != int64(86400) || data["consentVersion"] != "2022-06" {
+			t.Errorf("Unexpected data %v", data)
+		}
+	})
+	t.Run("no account", func(t *testing.T) {
+		rt := router{config: cfg}
+		data := rt.vaultData("", nil)
+		if data["consentMaxAge"] != int64(3600) || data["consentVersion"] != "" {
+			t.Errorf("Unexpected data %v", data)
+		}
+	})
+}
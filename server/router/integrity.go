@@ -0,0 +1,22 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/public"
+)
+
+// getIntegrity returns the Subresource Integrity hashes of the scripts
+// served by the application. Hashes change with each release, so embedding
+// sites that pin them need to update their integrity attributes on upgrade.
+func (rt *router) getIntegrity(c *gin.Context) {
+	assets := rt.integrity
+	if assets == nil {
+		assets = []public.AssetIntegrity{}
+	}
+	c.JSON(http.StatusOK, assets)
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/public"
+)
+
+func TestRouter_getIntegrity(t *testing.T) {
+	tests := []struct {
+		name         string
+		integrity    []public.AssetIntegrity
+		expectedBody string
+	}{
+		{
+			"empty",
+			nil,
+			`[]`,
+		},
+		{
+			"ok",
+			[]public.AssetIntegrity{{Asset: "/script.js", Path: "/script.js", Integrity: "sha384-abc"}},
+			`[{"asset":"/script.js","path":"/script.js","integrity":"sha384-abc"}]`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{integrity: test.integrity}
+			m := gin.New()
+			m.GET("/", rt.getIntegrity)
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if w.Body.String() != test.expectedBody {
+				t.Errorf("Unexpected body %v", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+// managedInvitation looks up the invitation referenced in the request and
+// checks whether the given account user is allowed to manage it, which
+// requires the admin role for all of the invitation's accounts. In case false
+// is returned, the request has already been aborted.
+func (rt *router) managedInvitation(c *gin.Context, accountUser persistence.LoginResult) (persistence.InvitationResult, bool) {
+	invitationID := c.Param("invitationID")
+	invitation, err := rt.db.LookupInvitation(invitationID)
+	if err != nil {
+		var unknownErr persistence.ErrUnknownInvitation
+		if errors.As(err, &unknownErr) {
+			newJSONError(
+				fmt.Errorf("router: invitation %s not found", invitationID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return invitation, false
+		}
+		newJSONError(
+			fmt.Errorf("router: error looking up invitation: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return invitation, false
+	}
+
+	for _, accountID := range invitation.AccountIDs {
+		// invitations for accounts the user cannot access are not disclosed
+		if !accountUser.CanAccessAccount(accountID) {
+			newJSONError(
+				fmt.Errorf("router: invitation %s not found", invitationID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return invitation, false
+		}
+		if !accountUser.HasRole(accountID, persistence.AccountUserRoleAdmin) {
+			newJSONError(
+				fmt.Errorf("router: account user is not allowed to manage invitation %s", invitationID),
+				http.StatusForbidden,
+			).Pipe(c)
+			return invitation, false
+		}
+	}
+	return invitation, true
+}
+
+type resendInvitationRequest struct {
+	InviteeEmailAddress string `json:"invitee"`
+	URLTemplate         string `json:"urlTemplate"`
+}
+
+func (rt *router) postResendInvitation(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	var req resendInvitationRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit{Requests: 5, Window: time.Minute}, fmt.Sprintf("postShareAccount-%s", accountUser.AccountUserID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	invitation, ok := rt.managedInvitation(c, accountUser)
+	if !ok {
+		return
+	}
+
+	result, err := rt.db.ResendInvitation(invitation.InvitationID, req.InviteeEmailAddress, accountUser.AccountUserID)
+	if err != nil {
+		var unknownErr persistence.ErrUnknownInvitation
+		if errors.As(err, &unknownErr) {
+			newJSONError(
+				fmt.Errorf("router: invitation %s was not sent to the given invitee", invitation.InvitationID),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error updating invitation: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.sendInvitation(req.InviteeEmailAddress, req.URLTemplate, result.AccountNames, result.UserExistsWithPassword, rt.negotiateLocale(c.Request, invitation.AccountIDs...)); err != nil {
+		status := http.StatusInternalServerError
+		if mailer.IsTemporary(err) {
+			status = http.StatusServiceUnavailable
+		}
+		newJSONError(
+			fmt.Errorf("router: error sending invitation: %w", err),
+			status,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (rt *router) deleteInvitation(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	invitation, ok := rt.managedInvitation(c, accountUser)
+	if !ok {
+		return
+	}
+
+	if err := rt.db.RevokeInvitation(invitation.InvitationID, accountUser.AccountUserID); err != nil {
+		var unknownErr persistence.ErrUnknownInvitation
+		if errors.As(err, &unknownErr) {
+			newJSONError(
+				fmt.Errorf("router: invitation %s not found", invitation.InvitationID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error revoking invitation: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,158 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockInvitationDatabase struct {
+	persistence.Service
+	lookupResult persistence.InvitationResult
+	lookupErr    error
+	resendErr    error
+	revokeErr    error
+}
+
+func (m *mockInvitationDatabase) LookupInvitation(string) (persistence.InvitationResult, error) {
+	return m.lookupResult, m.lookupErr
+}
+
+func (m *mockInvitationDatabase) ResendInvitation(invitationID, invitee, accountUserID string) (persistence.InvitationResult, error) {
+	return m.lookupResult, m.resendErr
+}
+
+func (m *mockInvitationDatabase) RevokeInvitation(invitationID, accountUserID string) error {
+	return m.revokeErr
+}
+
+func TestRouter_deleteInvitation(t *testing.T) {
+	admin := persistence.LoginResult{
+		AccountUserID: "user-a",
+		Accounts: []persistence.LoginAccountResult{
+			{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
+			{AccountID: "account-b", Role: persistence.AccountUserRoleViewer},
+		},
+	}
+	tests := []struct {
+		name               string
+		db                 *mockInvitationDatabase
+		expectedStatusCode int
+	}{
+		{
+			"unknown invitation",
+			&mockInvitationDatabase{lookupErr: persistence.ErrUnknownInvitation("unknown")},
+			http.StatusNotFound,
+		},
+		{
+			"other account",
+			&mockInvitationDatabase{lookupResult: persistence.InvitationResult{InvitationID: "invitation-a", AccountIDs: []string{"account-z"}}},
+			http.StatusNotFound,
+		},
+		{
+			"not an admin",
+			&mockInvitationDatabase{lookupResult: persistence.InvitationResult{InvitationID: "invitation-a", AccountIDs: []string{"account-a", "account-b"}}},
+			http.StatusForbidden,
+		},
+		{
+			"database error",
+			&mockInvitationDatabase{
+				lookupResult: persistence.InvitationResult{InvitationID: "invitation-a", AccountIDs: []string{"account-a"}},
+				revokeErr:    errors.New("did not work"),
+			},
+			http.StatusInternalServerError,
+		},
+		{
+			"ok",
+			&mockInvitationDatabase{lookupResult: persistence.InvitationResult{InvitationID: "invitation-a", AccountIDs: []string{"account-a"}}},
+			http.StatusNoContent,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.DELETE("/:invitationID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, admin)
+			}, rt.deleteInvitation)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodDelete, "/invitation-a", nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_postResendInvitation(t *testing.T) {
+	admin := persistence.LoginResult{
+		AccountUserID: "user-a",
+		Accounts: []persistence.LoginAccountResult{
+			{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
+		},
+	}
+	tests := []struct {
+		name               string
+		db                 *mockInvitationDatabase
+		mailer             mockMailer
+		expectedStatusCode int
+	}{
+		{
+			"other invitee",
+			&mockInvitationDatabase{
+				lookupResult: persistence.InvitationResult{InvitationID: "invitation-a", AccountIDs: []string{"account-a"}},
+				resendErr:    persistence.ErrUnknownInvitation("other invitee"),
+			},
+			mockMailer{err: errors.New("must not be called")},
+			http.StatusBadRequest,
+		},
+		{
+			"mailer error",
+			&mockInvitationDatabase{lookupResult: persistence.InvitationResult{InvitationID: "invitation-a", AccountIDs: []string{"account-a"}}},
+			mockMailer{err: errors.New("did not work")},
+			http.StatusInternalServerError,
+		},
+		{
+			"ok",
+			&mockInvitationDatabase{lookupResult: persistence.InvitationResult{InvitationID: "invitation-a", AccountIDs: []string{"account-a"}}},
+			mockMailer{},
+			http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{
+				db:           test.db,
+				config:       &config.Config{},
+				cookieSigner: securecookie.New([]byte("ABC"), nil),
+				mailer:       &test.mailer,
+				emails: template.Must(template.New("emails").Parse(`
+{{ define "subject_new_user_invite" }}subject{{ end }}
+{{ define "body_new_user_invite" }}body{{ end }}
+				`)),
+			}
+			m := gin.New()
+			m.POST("/:invitationID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, admin)
+			}, rt.postResendInvitation)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/invitation-a", strings.NewReader(`{"invitee":"mail@offen.dev","urlTemplate":"/join/{token}"}`))
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
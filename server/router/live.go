@@ -0,0 +1,76 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+const liveEventsHeartbeat = time.Second * 30
+
+// getLiveEvents streams all events that are ingested for the requested
+// account as server-sent events. Payloads are passed on as is, i.e. they
+// are still encrypted.
+func (rt *router) getLiveEvents(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	accountID := c.Query("accountId")
+	if !accountUser.CanAccessAccount(accountID) {
+		newJSONError(
+			fmt.Errorf("router: account user is not allowed to access account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("getLiveEvents-%s", accountUser.AccountUserID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	events, unsubscribe := rt.liveFeed.Subscribe(accountID)
+	defer unsubscribe()
+
+	heartbeat := time.NewTicker(liveEventsHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case evt, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent("event", evt)
+			return true
+		case <-heartbeat.C:
+			// comments are ignored by clients but keep proxies from closing
+			// idle connections
+			fmt.Fprint(w, ": heartbeat\n\n")
+			return true
+		}
+	})
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/livefeed"
+	"github.com/offen/offen/server/persistence"
+)
+
+func TestRouter_getLiveEvents(t *testing.T) {
+	broker := livefeed.New()
+	rt := router{
+		config:   &config.Config{},
+		liveFeed: broker,
+	}
+	m := gin.New()
+	m.GET("/", func(c *gin.Context) {
+		c.Set(contextKeyAuth, persistence.LoginResult{
+			AccountUserID: "user-a",
+			Accounts: []persistence.LoginAccountResult{
+				{AccountID: "account-a"},
+			},
+		})
+	}, rt.getLiveEvents)
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	t.Run("forbidden", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/?accountId=account-b")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusForbidden {
+			t.Errorf("Unexpected status code %v", res.StatusCode)
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/?accountId=account-a")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Unexpected status code %v", res.StatusCode)
+		}
+		if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+			t.Errorf("Unexpected content type %v", ct)
+		}
+
+		// headers are only sent after subscribing, so the event is
+		// guaranteed to be received
+		broker.Publish(persistence.EventResult{AccountID: "account-b", EventID: "event-b"})
+		broker.Publish(persistence.EventResult{AccountID: "account-a", EventID: "event-a", Payload: "payload"})
+
+		scanner := bufio.NewScanner(res.Body)
+		var lines []string
+		for scanner.Scan() {
+			if scanner.Text() == "" {
+				break
+			}
+			lines = append(lines, scanner.Text())
+		}
+		if len(lines) != 2 || lines[0] != "event:event" || !strings.Contains(lines[1], `"eventId":"event-a"`) {
+			t.Errorf("Unexpected event %v", lines)
+		}
+		broker.Close()
+	})
+}
@@ -0,0 +1,35 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// sendLockoutNotification tells the account user with the given email
+// address that logging in has been blocked after too many failed attempts.
+// The notification is rendered in the given locale. Errors are only logged,
+// as the login request has failed anyways.
+func (rt *router) sendLockoutNotification(emailAddress string, until time.Time, locale string) {
+	emails := rt.emailsFor(locale)
+	if rt.mailer == nil || emails == nil {
+		return
+	}
+	subject, body := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	if err := emails.ExecuteTemplate(subject, "subject_login_locked", nil); err != nil {
+		rt.logError(fmt.Errorf("router: error rendering email subject: %w", err), "error notifying account user of lockout")
+		return
+	}
+	if err := emails.ExecuteTemplate(body, "body_login_locked", map[string]string{
+		"until": until.UTC().Format(time.RFC1123),
+	}); err != nil {
+		rt.logError(fmt.Errorf("router: error rendering email body: %w", err), "error notifying account user of lockout")
+		return
+	}
+	if err := rt.mailer.Send(rt.getConfig().SMTP.Sender, emailAddress, subject.String(), body.String()); err != nil {
+		rt.logError(err, "error notifying account user of lockout")
+	}
+}
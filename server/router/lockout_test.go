@@ -0,0 +1,43 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/offen/offen/server/config"
+)
+
+type recordingMailer struct {
+	to   []string
+	body []string
+}
+
+func (m *recordingMailer) Send(from, to, subject, body string) error {
+	m.to = append(m.to, to)
+	m.body = append(m.body, body)
+	return nil
+}
+
+func TestRouter_sendLockoutNotification(t *testing.T) {
+	m := &recordingMailer{}
+	rt := router{
+		config: &config.Config{},
+		mailer: m,
+		emails: template.Must(template.New("emails").Parse(`
+{{ define "subject_login_locked" }}subject{{ end }}
+{{ define "body_login_locked" }}locked until {{ .until }}{{ end }}
+		`)),
+	}
+	rt.sendLockoutNotification("mail@offen.dev", time.Date(2022, 3, 4, 12, 0, 0, 0, time.UTC), "en")
+	if len(m.to) != 1 || m.to[0] != "mail@offen.dev" {
+		t.Fatalf("Unexpected recipients %v", m.to)
+	}
+	if !strings.Contains(m.body[0], "04 Mar 2022 12:00:00 UTC") {
+		t.Errorf("Unexpected body %s", m.body[0])
+	}
+}
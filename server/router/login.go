@@ -7,20 +7,26 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/mailer"
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
 )
 
 type loginCredentials struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	SecondFactor string `json:"secondFactor"`
 }
 
 func (rt *router) postLogout(c *gin.Context) {
+	rt.revokeCurrentSession(c)
 	authCookie, authCookieErr := rt.authCookie("", c.GetBool(contextKeySecureContext))
 	if authCookieErr != nil {
 		newJSONError(
@@ -44,7 +50,7 @@ func (rt *router) postLogin(c *gin.Context) {
 		return
 	}
 
-	if l := <-rt.getLimiter().ExponentialThrottle(time.Second, fmt.Sprintf("postLogin-%s", credentials.Username)); l.Error != nil {
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit(rt.getConfig().RateLimit.Login), fmt.Sprintf("postLogin-%s", credentials.Username)); l.Error != nil {
 		newJSONError(
 			fmt.Errorf("router: error applying rate limit: %w", l.Error),
 			http.StatusTooManyRequests,
@@ -61,7 +67,29 @@ func (rt *router) postLogin(c *gin.Context) {
 		return
 	}
 
-	result, err := rt.db.Login(credentials.Username, credentials.Password)
+	result, err := rt.db.Login(credentials.Username, credentials.Password, credentials.SecondFactor)
+	var lockErr persistence.ErrAccountUserLocked
+	if errors.As(err, &lockErr) {
+		if lockErr.Started {
+			rt.sendLockoutNotification(credentials.Username, lockErr.Until, rt.negotiateLocale(c.Request))
+		}
+		retryAfter := int(math.Ceil(time.Until(lockErr.Until).Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		newJSONError(
+			fmt.Errorf("router: error logging in: %w", err),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+	if errors.Is(err, persistence.ErrSecondFactorRequired) {
+		// clients are expected to ask for the second factor and send the
+		// credentials again
+		c.AbortWithStatusJSON(http.StatusUnauthorized, secondFactorRequiredResponse{
+			errorResponse:        *newJSONError(fmt.Errorf("router: error logging in: %w", err), http.StatusUnauthorized),
+			SecondFactorRequired: true,
+		})
+		return
+	}
 	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: error logging in: %w", err),
@@ -70,15 +98,19 @@ func (rt *router) postLogin(c *gin.Context) {
 		return
 	}
 
-	authCookie, authCookieErr := rt.authCookie(result.AccountUserID, c.GetBool(contextKeySecureContext))
+	authCookie, authCookieErr := rt.createSession(result.AccountUserID, c.GetBool(contextKeySecureContext))
 	if authCookieErr != nil {
 		newJSONError(
-			fmt.Errorf("router: error creating auth cookie: %w", authCookieErr),
+			fmt.Errorf("router: error creating session: %w", authCookieErr),
 			http.StatusInternalServerError,
 		).Pipe(c)
 		return
 	}
 
+	if err := rt.db.RecordAuditLog(result.AccountUserID, result.AccountIDs(), persistence.AuditActionLogin, ""); err != nil {
+		rt.logError(err, "error recording login in audit log")
+	}
+
 	http.SetCookie(c.Writer, authCookie)
 	c.JSON(http.StatusOK, result)
 }
@@ -128,6 +160,9 @@ func (rt *router) postChangePassword(c *gin.Context) {
 		).Pipe(c)
 		return
 	}
+	if !rt.validatePassword(c, req.ChangedPassword) {
+		return
+	}
 	if err := rt.db.ChangePassword(user.AccountUserID, req.CurrentPassword, req.ChangedPassword); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error changing password: %w", err),
@@ -207,7 +242,7 @@ func (rt *router) postForgotPassword(c *gin.Context) {
 		return
 	}
 
-	if l := <-rt.getLimiter().ExponentialThrottle(time.Second*5, fmt.Sprintf("postForgotPassword-%s", req.EmailAddress)); l.Error != nil {
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit(rt.getConfig().RateLimit.ForgotPassword), fmt.Sprintf("postForgotPassword-%s", req.EmailAddress)); l.Error != nil {
 		newJSONError(
 			fmt.Errorf("router: error applying rate limit: %w", l.Error),
 			http.StatusTooManyRequests,
@@ -242,15 +277,16 @@ func (rt *router) postForgotPassword(c *gin.Context) {
 
 	resetURL := strings.Replace(req.URLTemplate, "{token}", signedCredentials, -1)
 
+	emails := rt.emailsFor(rt.negotiateLocale(c.Request))
 	subject, body := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
-	if err := rt.emails.ExecuteTemplate(subject, "subject_reset_password", nil); err != nil {
+	if err := emails.ExecuteTemplate(subject, "subject_reset_password", nil); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error rendering email subject: %v", err),
 			http.StatusInternalServerError,
 		).Pipe(c)
 		return
 	}
-	if err := rt.emails.ExecuteTemplate(body, "body_reset_password", map[string]string{"url": resetURL}); err != nil {
+	if err := emails.ExecuteTemplate(body, "body_reset_password", map[string]string{"url": resetURL}); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error rendering email body: %v", err),
 			http.StatusInternalServerError,
@@ -258,10 +294,14 @@ func (rt *router) postForgotPassword(c *gin.Context) {
 		return
 	}
 
-	if err := rt.mailer.Send(rt.config.SMTP.Sender, req.EmailAddress, subject.String(), body.String()); err != nil {
+	if err := rt.mailer.Send(rt.getConfig().SMTP.Sender, req.EmailAddress, subject.String(), body.String()); err != nil {
+		status := http.StatusInternalServerError
+		if mailer.IsTemporary(err) {
+			status = http.StatusServiceUnavailable
+		}
 		newJSONError(
-			fmt.Errorf("error sending email message: %v", err),
-			http.StatusInternalServerError,
+			fmt.Errorf("error sending email message: %w", err),
+			status,
 		).Pipe(c)
 		return
 	}
@@ -284,7 +324,7 @@ func (rt *router) postResetPassword(c *gin.Context) {
 		return
 	}
 	var credentials forgotPasswordCredentials
-	if err := rt.cookieSigner.Decode("credentials", req.Token, &credentials); err != nil {
+	if err := rt.decodeSigned(rt.cookieSigner, 24*time.Hour, "credentials", req.Token, &credentials); err != nil {
 		newJSONError(
 			fmt.Errorf("error decoding signed token: %w", err),
 			http.StatusBadRequest,
@@ -292,7 +332,7 @@ func (rt *router) postResetPassword(c *gin.Context) {
 		return
 	}
 
-	if l := <-rt.getLimiter().ExponentialThrottle(time.Second*5, fmt.Sprintf("postResetPassword-%s", credentials.EmailAddress)); l.Error != nil {
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit(rt.getConfig().RateLimit.ForgotPassword), fmt.Sprintf("postResetPassword-%s", credentials.EmailAddress)); l.Error != nil {
 		newJSONError(
 			fmt.Errorf("router: error applying rate limit: %w", l.Error),
 			http.StatusTooManyRequests,
@@ -308,6 +348,10 @@ func (rt *router) postResetPassword(c *gin.Context) {
 		return
 	}
 
+	if !rt.validatePassword(c, req.Password) {
+		return
+	}
+
 	if err := rt.db.ResetPassword(req.EmailAddress, req.Password, credentials.Token); err != nil {
 		// on error a successful status is sent in order not to leak information
 		// to attackers
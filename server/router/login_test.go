@@ -17,13 +17,15 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/securecookie"
 	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/mailer"
 	"github.com/offen/offen/server/persistence"
 )
 
 func TestRouter_postLogout(t *testing.T) {
 	m := gin.New()
 	rt := router{
-		config: &config.Config{},
+		config:       &config.Config{},
+		cookieSigner: securecookie.New([]byte("abc"), nil),
 	}
 	m.POST("/", rt.postLogout)
 	r := httptest.NewRequest(http.MethodPost, "/", nil)
@@ -57,9 +59,18 @@ type mockPostLoginDatabase struct {
 	err    error
 }
 
-func (m *mockPostLoginDatabase) Login(string, string) (persistence.LoginResult, error) {
+func (m *mockPostLoginDatabase) Login(string, string, string) (persistence.LoginResult, error) {
 	return m.result, m.err
 }
+
+func (m *mockPostLoginDatabase) CreateSession(accountUserID string, lifetime time.Duration) (persistence.SessionResult, error) {
+	return persistence.SessionResult{SessionID: "session-a", AccountUserID: accountUserID}, nil
+}
+
+func (m *mockPostLoginDatabase) RecordAuditLog(string, []string, string, string) error {
+	return nil
+}
+
 func TestRouter_postLogin(t *testing.T) {
 	tests := []struct {
 		name               string
@@ -84,6 +95,24 @@ func TestRouter_postLogin(t *testing.T) {
 			http.StatusUnauthorized,
 			false,
 		},
+		{
+			"second factor required",
+			mockPostLoginDatabase{
+				err: fmt.Errorf("did not work: %w", persistence.ErrSecondFactorRequired),
+			},
+			strings.NewReader(`{"username":"mail@offen.dev","password":"secret!"}`),
+			http.StatusUnauthorized,
+			false,
+		},
+		{
+			"locked",
+			mockPostLoginDatabase{
+				err: fmt.Errorf("did not work: %w", persistence.ErrAccountUserLocked{Until: time.Now().Add(time.Minute), Started: true}),
+			},
+			strings.NewReader(`{"username":"mail@offen.dev","password":"secret!"}`),
+			http.StatusTooManyRequests,
+			false,
+		},
 		{
 			"ok",
 			mockPostLoginDatabase{
@@ -91,7 +120,7 @@ func TestRouter_postLogin(t *testing.T) {
 					AccountUserID: "user-a",
 				},
 			},
-			strings.NewReader(`{"username":"mail@offen.dev","password":"secret!"}`),
+			strings.NewReader(`{"username":"mail@offen.dev","password":"secret!","secondFactor":"123456"}`),
 			http.StatusOK,
 			true,
 		},
@@ -186,7 +215,7 @@ func TestRouter_postChangePassword(t *testing.T) {
 		{
 			"no user context",
 			mockPostChangePasswordDatabase{},
-			strings.NewReader(`{"currentPassword":"secret","changedPassword":"update"}`),
+			strings.NewReader(`{"currentPassword":"secret","changedPassword":"update-password"}`),
 			nil,
 			http.StatusInternalServerError,
 			false,
@@ -206,7 +235,7 @@ func TestRouter_postChangePassword(t *testing.T) {
 			mockPostChangePasswordDatabase{
 				err: errors.New("did not work"),
 			},
-			strings.NewReader(`{"currentPassword":"secret","changedPassword":"update"}`),
+			strings.NewReader(`{"currentPassword":"secret","changedPassword":"update-password"}`),
 			persistence.LoginResult{
 				AccountUserID: "account-user",
 			},
@@ -216,7 +245,7 @@ func TestRouter_postChangePassword(t *testing.T) {
 		{
 			"ok",
 			mockPostChangePasswordDatabase{},
-			strings.NewReader(`{"currentPassword":"secret","changedPassword":"update"}`),
+			strings.NewReader(`{"currentPassword":"secret","changedPassword":"update-password"}`),
 			persistence.LoginResult{
 				AccountUserID: "account-user",
 			},
@@ -384,7 +413,7 @@ func TestRouter_postResetPassword(t *testing.T) {
 		},
 		{
 			"bad token",
-			strings.NewReader(`{"emailAddress":"hioffen@posteo.de","password":"new","token":"made up token"}`),
+			strings.NewReader(`{"emailAddress":"hioffen@posteo.de","password":"new-password","token":"made up token"}`),
 			mockPostResetPasswordDatabase{},
 			http.StatusBadRequest,
 		},
@@ -396,7 +425,7 @@ func TestRouter_postResetPassword(t *testing.T) {
 				})
 				return strings.NewReader(
 					fmt.Sprintf(
-						`{"emailAddress":"hioffen@posteo.de","password":"new","token":"%s"}`, s,
+						`{"emailAddress":"hioffen@posteo.de","password":"new-password","token":"%s"}`, s,
 					),
 				)
 			}(),
@@ -411,7 +440,7 @@ func TestRouter_postResetPassword(t *testing.T) {
 				})
 				return strings.NewReader(
 					fmt.Sprintf(
-						`{"emailAddress":"hioffen@posteo.de","password":"new","token":"%s"}`, s,
+						`{"emailAddress":"hioffen@posteo.de","password":"new-password","token":"%s"}`, s,
 					),
 				)
 			}(),
@@ -428,7 +457,7 @@ func TestRouter_postResetPassword(t *testing.T) {
 				})
 				return strings.NewReader(
 					fmt.Sprintf(
-						`{"emailAddress":"hioffen@posteo.de","password":"new","token":"%s"}`, s,
+						`{"emailAddress":"hioffen@posteo.de","password":"new-password","token":"%s"}`, s,
 					),
 				)
 			}(),
@@ -510,6 +539,17 @@ func TestRouter_postForgotPassword(t *testing.T) {
 			strings.NewReader(`{"emailAddress":"mail@offen.dev","urlTemplate":"/reset/{token}/"}`),
 			http.StatusInternalServerError,
 		},
+		{
+			"temporary error sending email",
+			mockPostForgotPasswordDatabase{
+				result: []byte("i'm a token"),
+			},
+			mockMailer{
+				err: mailer.NewError(mailer.ErrTemporary, errors.New("did not work")),
+			},
+			strings.NewReader(`{"emailAddress":"mail@offen.dev","urlTemplate":"/reset/{token}/"}`),
+			http.StatusServiceUnavailable,
+		},
 		{
 			"ok",
 			mockPostForgotPasswordDatabase{
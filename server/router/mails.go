@@ -0,0 +1,48 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+// getFailedMails lists all mails that could not be delivered. Mails of all
+// accounts are listed, so this is only available using the admin API.
+func (rt *router) getFailedMails(c *gin.Context) {
+	mails, err := rt.db.ListFailedMails()
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error listing failed mails: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, mails)
+}
+
+// postRequeueMail schedules delivery of a failed mail again.
+func (rt *router) postRequeueMail(c *gin.Context) {
+	mailID := c.Param("mailID")
+	if err := rt.db.RequeueMail(mailID); err != nil {
+		var errUnknown persistence.ErrUnknownMail
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: failed mail %s not found", mailID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error requeueing mail: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
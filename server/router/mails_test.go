@@ -0,0 +1,119 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockMailQueueDatabase struct {
+	persistence.Service
+	mails      []persistence.QueuedMailResult
+	listErr    error
+	requeueErr error
+	requeued   []string
+}
+
+func (m *mockMailQueueDatabase) ListFailedMails() ([]persistence.QueuedMailResult, error) {
+	return m.mails, m.listErr
+}
+
+func (m *mockMailQueueDatabase) RequeueMail(mailID string) error {
+	m.requeued = append(m.requeued, mailID)
+	return m.requeueErr
+}
+
+func TestRouter_getFailedMails(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockMailQueueDatabase
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			"database error",
+			&mockMailQueueDatabase{listErr: errors.New("did not work")},
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"ok",
+			&mockMailQueueDatabase{mails: []persistence.QueuedMailResult{
+				{MailID: "mail-a", To: "develop@offen.dev", Subject: "subject", Attempts: 3, LastError: "did not work", Failed: true},
+			}},
+			http.StatusOK,
+			`[{"mailId":"mail-a","to":"develop@offen.dev","subject":"subject","attempts":3,"lastError":"did not work","failed":true,"nextAttempt":"0001-01-01T00:00:00Z","created":"0001-01-01T00:00:00Z"}]`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.GET("/", rt.getFailedMails)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedBody != "" && w.Body.String() != test.expectedBody {
+				t.Errorf("Unexpected response body %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_postRequeueMail(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockMailQueueDatabase
+		expectedStatusCode int
+		expectedRequeued   int
+	}{
+		{
+			"unknown mail",
+			&mockMailQueueDatabase{requeueErr: persistence.ErrUnknownMail("did not work")},
+			http.StatusNotFound,
+			1,
+		},
+		{
+			"database error",
+			&mockMailQueueDatabase{requeueErr: errors.New("did not work")},
+			http.StatusInternalServerError,
+			1,
+		},
+		{
+			"ok",
+			&mockMailQueueDatabase{},
+			http.StatusNoContent,
+			1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.POST("/:mailID", rt.postRequeueMail)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/mail-a", nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if len(test.db.requeued) != test.expectedRequeued {
+				t.Errorf("Unexpected requeue calls %v", test.db.requeued)
+			}
+			if test.expectedRequeued != 0 && test.db.requeued[0] != "mail-a" {
+				t.Errorf("Unexpected mail id %v", test.db.requeued[0])
+			}
+		})
+	}
+}
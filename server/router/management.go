@@ -13,7 +13,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/offen/offen/server/css"
+	"github.com/offen/offen/server/mailer"
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
 )
 
 type accountStylesRequest struct {
@@ -48,9 +50,16 @@ func (rt *router) putAccountStyles(c *gin.Context) {
 			).Pipe(c)
 			return
 		}
+		if !accountUser.HasRole(accountID, persistence.AccountUserRoleEditor) {
+			newJSONError(
+				fmt.Errorf("router: user is not allowed to edit styles of account %s", accountID),
+				http.StatusForbidden,
+			).Pipe(c)
+			return
+		}
 	}
 
-	if l := <-rt.getLimiter().ExponentialThrottle(time.Second, fmt.Sprintf("putAccountStyles-%s", accountUser.AccountUserID)); l.Error != nil {
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit{Requests: 5, Window: time.Minute}, fmt.Sprintf("putAccountStyles-%s", accountUser.AccountUserID)); l.Error != nil {
 		newJSONError(
 			fmt.Errorf("router: error rate limiting request: %w", l.Error),
 			http.StatusTooManyRequests,
@@ -71,13 +80,14 @@ func (rt *router) putAccountStyles(c *gin.Context) {
 		return
 	}
 
-	if err := rt.db.UpdateAccountStyles(accountID, req.AccountStyles); err != nil {
+	if err := rt.getStyleStore().Put(accountID, req.AccountStyles); err != nil {
 		newJSONError(
 			fmt.Errorf("router: error updating styles for account %s: %w", accountID, err),
 			http.StatusInternalServerError,
 		).Pipe(c)
 		return
 	}
+	rt.getCache().Delete(fmt.Sprintf("account-styles-%s", accountID))
 
 	c.Status(http.StatusNoContent)
 }
@@ -88,6 +98,19 @@ type shareAccountRequest struct {
 	ProviderPassword     string `json:"password"`
 	URLTemplate          string `json:"urlTemplate"`
 	GrantAdminPrivileges bool   `json:"grantAdminPrivileges"`
+	Role                 string `json:"role"`
+}
+
+// role returns the role requested for the invitee. Clients that do not
+// send a role are still supported by mapping the admin privileges flag.
+func (s *shareAccountRequest) role() persistence.AccountUserRole {
+	if s.Role != "" {
+		return persistence.AccountUserRole(s.Role)
+	}
+	if s.GrantAdminPrivileges {
+		return persistence.AccountUserRoleAdmin
+	}
+	return persistence.AccountUserRoleEditor
 }
 
 func (rt *router) postShareAccount(c *gin.Context) {
@@ -120,7 +143,7 @@ func (rt *router) postShareAccount(c *gin.Context) {
 		}
 	}
 
-	if l := <-rt.getLimiter().ExponentialThrottle(time.Second, fmt.Sprintf("postShareAccount-%s", accountUser.AccountUserID)); l.Error != nil {
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit{Requests: 5, Window: time.Minute}, fmt.Sprintf("postShareAccount-%s", accountUser.AccountUserID)); l.Error != nil {
 		newJSONError(
 			fmt.Errorf("router: error rate limiting request: %w", l.Error),
 			http.StatusTooManyRequests,
@@ -129,7 +152,7 @@ func (rt *router) postShareAccount(c *gin.Context) {
 	}
 
 	// the given credentials might not be valid
-	accountInRequest, err := rt.db.Login(req.ProviderEmailAddress, req.ProviderPassword)
+	accountInRequest, err := rt.db.VerifyCredentials(req.ProviderEmailAddress, req.ProviderPassword)
 	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: error validating given credentials: %w", err),
@@ -148,7 +171,10 @@ func (rt *router) postShareAccount(c *gin.Context) {
 		return
 	}
 
-	if !accountInRequest.IsSuperAdmin() {
+	// sharing a single account requires the admin role for it, while sharing
+	// all accounts is reserved to super admins
+	if (accountID != "" && !accountInRequest.HasRole(accountID, persistence.AccountUserRoleAdmin)) ||
+		(accountID == "" && !accountInRequest.IsSuperAdmin()) {
 		newJSONError(
 			errors.New("router: given credentials are not allowed to share accounts"),
 			http.StatusBadRequest,
@@ -156,7 +182,16 @@ func (rt *router) postShareAccount(c *gin.Context) {
 		return
 	}
 
-	result, err := rt.db.ShareAccount(req.InviteeEmailAddress, req.ProviderEmailAddress, req.ProviderPassword, c.Param("accountID"), req.GrantAdminPrivileges)
+	role := req.role()
+	if !role.Valid() {
+		newJSONError(
+			fmt.Errorf("router: unknown role %s", role),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	result, err := rt.db.ShareAccount(req.InviteeEmailAddress, req.ProviderEmailAddress, req.ProviderPassword, accountID, role)
 	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: error inviting user: %w", err),
@@ -168,6 +203,10 @@ func (rt *router) postShareAccount(c *gin.Context) {
 	// the user might have access to all accounts already in which case we
 	// do not want to send a confusing email
 	if len(result.AccountNames) == 0 {
+		if result.RoleChanged {
+			c.Status(http.StatusNoContent)
+			return
+		}
 		newJSONError(
 			fmt.Errorf("router: user already has access to all requested accounts"),
 			http.StatusBadRequest,
@@ -175,41 +214,64 @@ func (rt *router) postShareAccount(c *gin.Context) {
 		return
 	}
 
+	if err := rt.sendInvitation(req.InviteeEmailAddress, req.URLTemplate, result.AccountNames, result.UserExistsWithPassword, rt.negotiateLocale(c.Request, accountID)); err != nil {
+		status := http.StatusInternalServerError
+		if mailer.IsTemporary(err) {
+			status = http.StatusServiceUnavailable
+		}
+		newJSONError(
+			fmt.Errorf("router: error sending invitation: %w", err),
+			status,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, shareAccountResponse{InvitationID: result.InvitationID})
+}
+
+type shareAccountResponse struct {
+	InvitationID string `json:"invitationId"`
+}
+
+// invitationExpiry returns the duration invitations and the tokens used for
+// accepting them are valid for.
+func (rt *router) invitationExpiry() time.Duration {
+	if rt.getConfig() == nil || rt.getConfig().App.InvitationExpiry <= 0 {
+		return persistence.DefaultInvitationExpiry
+	}
+	return rt.getConfig().App.InvitationExpiry
+}
+
+// sendInvitation notifies the invitee about having been granted access to
+// the given accounts. Users that have not set a password yet receive a link
+// for joining that is created from the given URL template. The email is
+// rendered in the given locale.
+func (rt *router) sendInvitation(invitee, urlTemplate string, accountNames []string, userExistsWithPassword bool, locale string) error {
+	emails := rt.emailsFor(locale)
 	var bodyErr error
 	var subjectErr error
 	body, subject := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
-	if result.UserExistsWithPassword {
-		bodyErr = rt.emails.ExecuteTemplate(body, "body_existing_user_invite", map[string]interface{}{"accountNames": result.AccountNames})
-		subjectErr = rt.emails.ExecuteTemplate(subject, "subject_existing_user_invite", nil)
+	if userExistsWithPassword {
+		bodyErr = emails.ExecuteTemplate(body, "body_existing_user_invite", map[string]interface{}{"accountNames": accountNames})
+		subjectErr = emails.ExecuteTemplate(subject, "subject_existing_user_invite", nil)
 	} else {
-		signedCredentials, signErr := rt.cookieSigner.MaxAge(7*24*60*60).Encode("credentials", req.InviteeEmailAddress)
+		signedCredentials, signErr := rt.cookieSigner.MaxAge(int(rt.invitationExpiry().Seconds())).Encode("credentials", invitee)
 		if signErr != nil {
-			rt.logError(signErr, "error signing token")
-			c.Status(http.StatusNoContent)
-			return
+			return fmt.Errorf("router: error signing token: %w", signErr)
 		}
-		joinURL := strings.Replace(req.URLTemplate, "{token}", signedCredentials, -1)
-		bodyErr = rt.emails.ExecuteTemplate(body, "body_new_user_invite", map[string]interface{}{"url": joinURL})
-		subjectErr = rt.emails.ExecuteTemplate(subject, "subject_new_user_invite", nil)
+		joinURL := strings.Replace(urlTemplate, "{token}", signedCredentials, -1)
+		bodyErr = emails.ExecuteTemplate(body, "body_new_user_invite", map[string]interface{}{"url": joinURL})
+		subjectErr = emails.ExecuteTemplate(subject, "subject_new_user_invite", nil)
 	}
 
 	for _, err := range []error{bodyErr, subjectErr} {
 		if err != nil {
-			newJSONError(
-				fmt.Errorf("router: error rendering email message: %v", err),
-				http.StatusInternalServerError,
-			).Pipe(c)
-			return
+			return fmt.Errorf("router: error rendering email message: %w", err)
 		}
 	}
-	if err := rt.mailer.Send(rt.config.SMTP.Sender, req.InviteeEmailAddress, subject.String(), body.String()); err != nil {
-		newJSONError(
-			fmt.Errorf("router: error sending email message: %v", err),
-			http.StatusInternalServerError,
-		).Pipe(c)
-		return
+	if err := rt.mailer.Send(rt.getConfig().SMTP.Sender, invitee, subject.String(), body.String()); err != nil {
+		return fmt.Errorf("router: error sending email message: %w", err)
 	}
-	c.Status(http.StatusNoContent)
+	return nil
 }
 
 type joinRequest struct {
@@ -228,7 +290,7 @@ func (rt *router) postJoin(c *gin.Context) {
 		return
 	}
 	var email string
-	if err := rt.cookieSigner.Decode("credentials", req.Token, &email); err != nil {
+	if err := rt.decodeSigned(rt.cookieSigner, rt.invitationExpiry(), "credentials", req.Token, &email); err != nil {
 		newJSONError(
 			fmt.Errorf("error decoding signed token: %w", err),
 			http.StatusBadRequest,
@@ -243,7 +305,7 @@ func (rt *router) postJoin(c *gin.Context) {
 		return
 	}
 
-	if l := <-rt.getLimiter().ExponentialThrottle(time.Second, fmt.Sprintf("postJoin-%s", req.EmailAddress)); l.Error != nil {
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit{Requests: 5, Window: time.Minute}, fmt.Sprintf("postJoin-%s", req.EmailAddress)); l.Error != nil {
 		newJSONError(
 			fmt.Errorf("router: error rate limiting request: %w", l.Error),
 			http.StatusTooManyRequests,
@@ -260,7 +322,19 @@ func (rt *router) postJoin(c *gin.Context) {
 		return
 	}
 
+	if !rt.validatePassword(c, req.Password) {
+		return
+	}
+
 	if err := rt.db.Join(req.EmailAddress, req.Password); err != nil {
+		var expiredErr persistence.ErrInvitationExpired
+		if errors.As(err, &expiredErr) {
+			newJSONError(
+				fmt.Errorf("router: error joining: %w", expiredErr),
+				http.StatusGone,
+			).Pipe(c)
+			return
+		}
 		rt.logError(err, "error joining")
 	}
 	c.Status(http.StatusNoContent)
@@ -27,11 +27,11 @@ type mockPostShareAccountDatabase struct {
 	loginErr           error
 }
 
-func (m *mockPostShareAccountDatabase) ShareAccount(string, string, string, string, bool) (persistence.ShareAccountResult, error) {
+func (m *mockPostShareAccountDatabase) ShareAccount(string, string, string, string, persistence.AccountUserRole) (persistence.ShareAccountResult, error) {
 	return m.shareAccountResult, m.shareAccountErr
 }
 
-func (m *mockPostShareAccountDatabase) Login(string, string) (persistence.LoginResult, error) {
+func (m *mockPostShareAccountDatabase) VerifyCredentials(string, string) (persistence.LoginResult, error) {
 	return m.loginResult, m.loginErr
 }
 
@@ -54,7 +54,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 					AccountUserID: "account-user-id",
 					AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 					Accounts: []persistence.LoginAccountResult{
-						{AccountID: "account-a-id"},
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 					},
 				},
 			},
@@ -62,7 +62,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 				AccountUserID: "account-user-id",
 				AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 				Accounts: []persistence.LoginAccountResult{
-					{AccountID: "account-a-id"},
+					{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 				},
 			},
 			strings.NewReader("xx8190"),
@@ -77,7 +77,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 					AccountUserID: "account-user-id",
 					AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 					Accounts: []persistence.LoginAccountResult{
-						{AccountID: "account-a-id"},
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 					},
 				},
 			},
@@ -94,7 +94,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 					AccountUserID: "account-user-id",
 					AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 					Accounts: []persistence.LoginAccountResult{
-						{AccountID: "account-a-id"},
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 					},
 				},
 			},
@@ -102,7 +102,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 				AccountUserID: "account-user-id",
 				AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 				Accounts: []persistence.LoginAccountResult{
-					{AccountID: "account-a-id"},
+					{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 				},
 			},
 			strings.NewReader(`{"invitee":"mail@offen.dev","emailAddress":"hioffen@posteo.de","password":"ok","urlTemplate":"/join/{token}","grantAdminPrivileges":false}`),
@@ -119,7 +119,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 				AccountUserID: "account-user-id",
 				AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 				Accounts: []persistence.LoginAccountResult{
-					{AccountID: "account-a-id"},
+					{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 				},
 			},
 			strings.NewReader(`{"invitee":"mail@offen.dev","emailAddress":"hioffen@posteo.de","password":"ok","urlTemplate":"/join/{token}","grantAdminPrivileges":false}`),
@@ -134,7 +134,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 					AccountUserID: "other-account-user-id",
 					AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 					Accounts: []persistence.LoginAccountResult{
-						{AccountID: "account-a-id"},
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 					},
 				},
 			},
@@ -142,7 +142,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 				AccountUserID: "account-user-id",
 				AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 				Accounts: []persistence.LoginAccountResult{
-					{AccountID: "account-a-id"},
+					{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 				},
 			},
 			strings.NewReader(`{"invitee":"mail@offen.dev","emailAddress":"hioffen@posteo.de","password":"ok","urlTemplate":"/join/{token}","grantAdminPrivileges":false}`),
@@ -150,13 +150,13 @@ func TestRouter_postShareAccount(t *testing.T) {
 			http.StatusBadRequest,
 		},
 		{
-			"requester is not super admin",
+			"requester is not admin",
 			"account-a-id",
 			mockPostShareAccountDatabase{
 				loginResult: persistence.LoginResult{
 					AccountUserID: "account-user-id",
 					Accounts: []persistence.LoginAccountResult{
-						{AccountID: "account-a-id"},
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleEditor},
 					},
 				},
 			},
@@ -178,7 +178,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 					AccountUserID: "account-user-id",
 					AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 					Accounts: []persistence.LoginAccountResult{
-						{AccountID: "account-a-id"},
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 					},
 				},
 				shareAccountErr: errors.New("did not work"),
@@ -187,7 +187,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 				AccountUserID: "account-user-id",
 				AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 				Accounts: []persistence.LoginAccountResult{
-					{AccountID: "account-a-id"},
+					{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 				},
 			},
 			strings.NewReader(`{"invitee":"mail@offen.dev","emailAddress":"hioffen@posteo.de","password":"ok","urlTemplate":"/join/{token}","grantAdminPrivileges":false}`),
@@ -202,7 +202,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 					AccountUserID: "account-user-id",
 					AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 					Accounts: []persistence.LoginAccountResult{
-						{AccountID: "account-a-id"},
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 					},
 				},
 				shareAccountResult: persistence.ShareAccountResult{
@@ -214,13 +214,66 @@ func TestRouter_postShareAccount(t *testing.T) {
 				AccountUserID: "account-user-id",
 				AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 				Accounts: []persistence.LoginAccountResult{
-					{AccountID: "account-a-id"},
+					{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 				},
 			},
 			strings.NewReader(`{"invitee":"mail@offen.dev","emailAddress":"hioffen@posteo.de","password":"ok","urlTemplate":"/join/{token}","grantAdminPrivileges":false}`),
 			mockMailer{},
 			http.StatusBadRequest,
 		},
+		{
+			"bad role",
+			"account-a-id",
+			mockPostShareAccountDatabase{
+				loginResult: persistence.LoginResult{
+					AccountUserID: "account-user-id",
+					AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
+					Accounts: []persistence.LoginAccountResult{
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
+					},
+				},
+			},
+			persistence.LoginResult{
+				AccountUserID: "account-user-id",
+				AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
+				},
+			},
+			strings.NewReader(`{"invitee":"mail@offen.dev","emailAddress":"hioffen@posteo.de","password":"ok","urlTemplate":"/join/{token}","role":"owner"}`),
+			mockMailer{},
+			http.StatusBadRequest,
+		},
+		{
+			"ok role changed",
+			"account-a-id",
+			mockPostShareAccountDatabase{
+				loginResult: persistence.LoginResult{
+					AccountUserID: "account-user-id",
+					AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
+					Accounts: []persistence.LoginAccountResult{
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
+					},
+				},
+				shareAccountResult: persistence.ShareAccountResult{
+					UserExistsWithPassword: true,
+					AccountNames:           []string{},
+					RoleChanged:            true,
+				},
+			},
+			persistence.LoginResult{
+				AccountUserID: "account-user-id",
+				AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
+				Accounts: []persistence.LoginAccountResult{
+					{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
+				},
+			},
+			strings.NewReader(`{"invitee":"mail@offen.dev","emailAddress":"hioffen@posteo.de","password":"ok","urlTemplate":"/join/{token}","role":"viewer"}`),
+			mockMailer{
+				err: errors.New("must not be called"),
+			},
+			http.StatusNoContent,
+		},
 		{
 			"ok user exists",
 			"account-a-id",
@@ -229,24 +282,25 @@ func TestRouter_postShareAccount(t *testing.T) {
 					AccountUserID: "account-user-id",
 					AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 					Accounts: []persistence.LoginAccountResult{
-						{AccountID: "account-a-id"},
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 					},
 				},
 				shareAccountResult: persistence.ShareAccountResult{
 					UserExistsWithPassword: true,
 					AccountNames:           []string{"Account A"},
+					InvitationID:           "invitation-id",
 				},
 			},
 			persistence.LoginResult{
 				AccountUserID: "account-user-id",
 				AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 				Accounts: []persistence.LoginAccountResult{
-					{AccountID: "account-a-id"},
+					{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 				},
 			},
 			strings.NewReader(`{"invitee":"mail@offen.dev","emailAddress":"hioffen@posteo.de","password":"ok","urlTemplate":"/join/{token}","grantAdminPrivileges":false}`),
 			mockMailer{},
-			http.StatusNoContent,
+			http.StatusOK,
 		},
 		{
 			"ok user does not exist",
@@ -256,24 +310,25 @@ func TestRouter_postShareAccount(t *testing.T) {
 					AccountUserID: "account-user-id",
 					AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 					Accounts: []persistence.LoginAccountResult{
-						{AccountID: "account-a-id"},
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 					},
 				},
 				shareAccountResult: persistence.ShareAccountResult{
 					UserExistsWithPassword: false,
 					AccountNames:           []string{"Account A"},
+					InvitationID:           "invitation-id",
 				},
 			},
 			persistence.LoginResult{
 				AccountUserID: "account-user-id",
 				AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 				Accounts: []persistence.LoginAccountResult{
-					{AccountID: "account-a-id"},
+					{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 				},
 			},
 			strings.NewReader(`{"invitee":"mail@offen.dev","emailAddress":"hioffen@posteo.de","password":"ok","urlTemplate":"/join/{token}","grantAdminPrivileges":false}`),
 			mockMailer{},
-			http.StatusNoContent,
+			http.StatusOK,
 		},
 		{
 			"mailer error",
@@ -283,7 +338,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 					AccountUserID: "account-user-id",
 					AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 					Accounts: []persistence.LoginAccountResult{
-						{AccountID: "account-a-id"},
+						{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 					},
 				},
 				shareAccountResult: persistence.ShareAccountResult{
@@ -295,7 +350,7 @@ func TestRouter_postShareAccount(t *testing.T) {
 				AccountUserID: "account-user-id",
 				AdminLevel:    persistence.AccountUserAdminLevelSuperAdmin,
 				Accounts: []persistence.LoginAccountResult{
-					{AccountID: "account-a-id"},
+					{AccountID: "account-a-id", Role: persistence.AccountUserRoleAdmin},
 				},
 			},
 			strings.NewReader(`{"invitee":"mail@offen.dev","emailAddress":"hioffen@posteo.de","password":"ok","urlTemplate":"/join/{token}","grantAdminPrivileges":false}`),
@@ -367,7 +422,7 @@ func TestRouter_postJoin(t *testing.T) {
 		{
 			"bad token",
 			mockPostJoinDatabase{},
-			strings.NewReader(`{"emailAddress":"hioffen@posteo.de","password":"pass","token":"something something"}`),
+			strings.NewReader(`{"emailAddress":"hioffen@posteo.de","password":"join-password","token":"something something"}`),
 			http.StatusBadRequest,
 		},
 		{
@@ -375,6 +430,20 @@ func TestRouter_postJoin(t *testing.T) {
 			mockPostJoinDatabase{},
 			func() io.Reader {
 				token, _ := signer.Encode("credentials", "mail@offen.dev")
+				return strings.NewReader(
+					fmt.Sprintf(
+						`{"emailAddress":"hioffen@posteo.de","password":"join-password","token":"%s"}`,
+						token,
+					),
+				)
+			}(),
+			http.StatusBadRequest,
+		},
+		{
+			"password policy",
+			mockPostJoinDatabase{},
+			func() io.Reader {
+				token, _ := signer.Encode("credentials", "hioffen@posteo.de")
 				return strings.NewReader(
 					fmt.Sprintf(
 						`{"emailAddress":"hioffen@posteo.de","password":"pass","token":"%s"}`,
@@ -393,13 +462,29 @@ func TestRouter_postJoin(t *testing.T) {
 				token, _ := signer.Encode("credentials", "hioffen@posteo.de")
 				return strings.NewReader(
 					fmt.Sprintf(
-						`{"emailAddress":"hioffen@posteo.de","password":"pass","token":"%s"}`,
+						`{"emailAddress":"hioffen@posteo.de","password":"join-password","token":"%s"}`,
 						token,
 					),
 				)
 			}(),
 			http.StatusNoContent,
 		},
+		{
+			"invitation expired",
+			mockPostJoinDatabase{
+				err: persistence.ErrInvitationExpired("expired"),
+			},
+			func() io.Reader {
+				token, _ := signer.Encode("credentials", "hioffen@posteo.de")
+				return strings.NewReader(
+					fmt.Sprintf(
+						`{"emailAddress":"hioffen@posteo.de","password":"join-password","token":"%s"}`,
+						token,
+					),
+				)
+			}(),
+			http.StatusGone,
+		},
 		{
 			"ok",
 			mockPostJoinDatabase{},
@@ -407,7 +492,7 @@ func TestRouter_postJoin(t *testing.T) {
 				token, _ := signer.Encode("credentials", "hioffen@posteo.de")
 				return strings.NewReader(
 					fmt.Sprintf(
-						`{"emailAddress":"hioffen@posteo.de","password":"pass","token":"%s"}`,
+						`{"emailAddress":"hioffen@posteo.de","password":"join-password","token":"%s"}`,
 						token,
 					),
 				)
@@ -436,3 +521,33 @@ func TestRouter_postJoin(t *testing.T) {
 		})
 	}
 }
+
+func TestRouter_putAccountStyles(t *testing.T) {
+	tests := []struct {
+		name               string
+		role               persistence.AccountUserRole
+		expectedStatusCode int
+	}{
+		{"viewer", persistence.AccountUserRoleViewer, http.StatusForbidden},
+		{"editor", persistence.AccountUserRoleEditor, http.StatusNoContent},
+		{"admin", persistence.AccountUserRoleAdmin, http.StatusNoContent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{config: &config.Config{}}
+			m := gin.New()
+			m.PUT("/:accountID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, persistence.LoginResult{
+					Accounts: []persistence.LoginAccountResult{
+						{AccountID: "account-a", Role: test.role},
+					},
+				})
+			}, rt.putAccountStyles)
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/account-a?dryRun=1", strings.NewReader(`{"accountStyles":""}`)))
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/metrics"
+)
+
+const (
+	metricRequests        = "offen_http_requests_total"
+	metricRequestDuration = "offen_http_request_duration_seconds"
+	metricEventsIngested  = "offen_events_ingested_total"
+	metricEventsFlagged   = "offen_events_flagged_bot_total"
+)
+
+// routeGroup returns a label for the route that handled the request. Only
+// the first two segments of the matched route are used so that the number
+// of distinct labels stays small. Requests that did not match any route
+// are static assets.
+func routeGroup(c *gin.Context) string {
+	route := c.FullPath()
+	if route == "" {
+		return "static"
+	}
+	segments := strings.SplitN(strings.TrimPrefix(route, "/"), "/", 3)
+	if len(segments) > 2 {
+		segments = segments[:2]
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func metricsMiddleware(registry *metrics.Registry) gin.HandlerFunc {
+	requests := registry.Counter(metricRequests, "Number of HTTP requests handled.", "group", "method", "code")
+	durations := registry.Histogram(metricRequestDuration, "Duration of HTTP requests in seconds.", metrics.DefaultBuckets, "group")
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		group := routeGroup(c)
+		requests.Inc(group, c.Request.Method, strconv.Itoa(c.Writer.Status()))
+		durations.Observe(time.Since(start).Seconds(), group)
+	}
+}
+
+func (rt *router) getMetrics(c *gin.Context) {
+	if token := rt.getConfig().Metrics.Token; token != "" {
+		given := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			newJSONError(
+				errors.New("router: invalid or missing token for accessing metrics"),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+	}
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	if _, err := rt.metrics.WriteTo(c.Writer); err != nil {
+		rt.logError(err, "error writing metrics")
+	}
+}
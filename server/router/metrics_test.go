@@ -0,0 +1,63 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/metrics"
+)
+
+func TestRouter_getMetrics(t *testing.T) {
+	tests := []struct {
+		name               string
+		token              string
+		authorization      string
+		expectedStatusCode int
+	}{
+		{"no token configured", "", "", http.StatusOK},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"bad token", "secret", "Bearer other", http.StatusUnauthorized},
+		{"ok", "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Metrics.Token = test.token
+			rt := router{config: cfg, metrics: metrics.New()}
+
+			m := gin.New()
+			m.Use(metricsMiddleware(rt.metrics))
+			m.GET("/api/accounts/:accountID", func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			})
+			m.GET("/metricsz", rt.getMetrics)
+
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/accounts/account-a", nil))
+
+			w = httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/metricsz", nil)
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			expected := `offen_http_requests_total{group="/api/accounts",method="GET",code="204"} 1`
+			if !strings.Contains(w.Body.String(), expected) {
+				t.Errorf("Expected request to be recorded, got %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -4,8 +4,6 @@
 package router
 
 import (
-	"bytes"
-	"crypto/md5"
 	"errors"
 	"fmt"
 	"net/http"
@@ -13,6 +11,7 @@ import (
 
 	"github.com/gin-contrib/location"
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
 )
 
 func secureContextMiddleware(contextKey string, isDevelopment bool) gin.HandlerFunc {
@@ -65,8 +64,8 @@ func (rt *router) accountUserMiddleware(cookieKey, contextKey string) gin.Handle
 			return
 		}
 
-		var userID string
-		if err := rt.cookieSigner.Decode(authKey, authCookie.Value, &userID); err != nil {
+		var sessionID string
+		if err := rt.decodeSigned(rt.cookieSigner, sessionLifetime, authKey, authCookie.Value, &sessionID); err != nil {
 			authCookie, _ = rt.authCookie("", c.GetBool(contextKeySecureContext))
 			http.SetCookie(c.Writer, authCookie)
 			newJSONError(
@@ -76,17 +75,29 @@ func (rt *router) accountUserMiddleware(cookieKey, contextKey string) gin.Handle
 			return
 		}
 
-		user, userErr := rt.db.LookupAccountUser(userID)
+		session, sessionErr := rt.db.LookupSession(sessionID)
+		if sessionErr != nil {
+			authCookie, _ = rt.authCookie("", c.GetBool(contextKeySecureContext))
+			http.SetCookie(c.Writer, authCookie)
+			newJSONError(
+				fmt.Errorf("error looking up session: %v", sessionErr),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+
+		user, userErr := rt.db.LookupAccountUser(session.AccountUserID)
 		if userErr != nil {
 			authCookie, _ = rt.authCookie("", c.GetBool(contextKeySecureContext))
 			http.SetCookie(c.Writer, authCookie)
 			newJSONError(
-				fmt.Errorf("user with id %s does not exist: %v", userID, userErr),
+				fmt.Errorf("user with id %s does not exist: %v", session.AccountUserID, userErr),
 				http.StatusUnauthorized,
 			).Pipe(c)
 			return
 		}
 		c.Set(contextKey, user)
+		c.Set(contextKeySession, session.SessionID)
 		c.Next()
 	}
 }
@@ -100,32 +111,69 @@ func headerMiddleware(valueProvider map[string]func() string) gin.HandlerFunc {
 	}
 }
 
-type bufferingGinWriter struct {
-	gin.ResponseWriter
-	buf bytes.Buffer
+// queryTokenMiddleware uses the bearer token passed in the given query
+// parameter for authorizing the request in case no Authorization header
+// is present.
+func queryTokenMiddleware(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := c.Query(param); token != "" && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+		c.Next()
+	}
 }
 
-func (g *bufferingGinWriter) Write(data []byte) (int, error) {
-	return g.buf.Write(data)
+// botMiddleware flags requests that are considered to be issued by crawlers
+// using the given context key. Handlers decide how to treat flagged requests
+// as this depends on the account events are sent to.
+func (rt *router) botMiddleware(contextKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := clientIP(c.Request, rt.trustedProxies())
+		c.Set(contextKey, rt.getBotFilter().Match(c.Request.UserAgent(), ip))
+		c.Next()
+	}
+}
+
+// hasPrivacySignal checks whether the request carries a Do-Not-Track or
+// Global Privacy Control signal.
+func hasPrivacySignal(r *http.Request) bool {
+	return r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1"
 }
 
-func etagMiddleware() gin.HandlerFunc {
+// privacySignalMiddleware applies the configured policy to requests that
+// carry a privacy signal. Dropped requests are answered the same way requests
+// without consent are. In case events are to be stored anonymously, this is
+// signaled to the wrapped handler using the given context key.
+func (rt *router) privacySignalMiddleware(contextKey string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		bw := &bufferingGinWriter{c.Writer, bytes.Buffer{}}
-		defer bw.ResponseWriter.Flush()
-		c.Writer = bw
+		if !hasPrivacySignal(c.Request) {
+			c.Next()
+			return
+		}
+		switch rt.getConfig().App.PrivacySignals {
+		case config.PrivacySignalDrop:
+			c.Status(http.StatusNoContent)
+			c.Abort()
+			return
+		case config.PrivacySignalAnonymous:
+			c.Set(contextKey, true)
+		}
 		c.Next()
+	}
+}
 
-		data := bw.buf.Bytes()
-		etag := fmt.Sprintf("%x", md5.Sum(data))
-		c.Header("Etag", etag)
-		c.Header("Cache-Control", "no-cache")
-		if match := c.GetHeader("If-None-Match"); match != "" {
-			if strings.Contains(match, etag) {
-				c.Status(http.StatusNotModified)
-				return
-			}
+// applyETag sets the given ETag on the response and checks it against
+// the If-None-Match header of the request. In case the client's version
+// is still current, a 304 status is written and true is returned, meaning
+// the caller must not write a response body.
+func applyETag(c *gin.Context, etag string) bool {
+	c.Header("Etag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if strings.Contains(match, etag) {
+			c.Status(http.StatusNotModified)
+			return true
 		}
-		bw.ResponseWriter.Write(data)
 	}
+	return false
 }
@@ -13,6 +13,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/securecookie"
+	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/persistence"
 )
 
@@ -125,6 +126,16 @@ type mockUserLookupDatabase struct {
 	persistence.Service
 }
 
+func (*mockUserLookupDatabase) LookupSession(sessionID string) (persistence.SessionResult, error) {
+	switch sessionID {
+	case "session-id-1":
+		return persistence.SessionResult{SessionID: sessionID, AccountUserID: "account-user-id-1"}, nil
+	case "session-id-2":
+		return persistence.SessionResult{SessionID: sessionID, AccountUserID: "account-user-id-2"}, nil
+	}
+	return persistence.SessionResult{}, persistence.ErrUnknownSession("unknown session")
+}
+
 func (*mockUserLookupDatabase) LookupAccountUser(accountUserID string) (persistence.LoginResult, error) {
 	if accountUserID == "account-user-id-1" {
 		return persistence.LoginResult{
@@ -168,10 +179,24 @@ func TestAccountUserMiddleware(t *testing.T) {
 		}
 	})
 
+	t.Run("unknown session", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		cookieValue, _ := cookieSigner.Encode("auth", "session-id-3")
+		r.AddCookie(&http.Cookie{
+			Name:  "auth",
+			Value: cookieValue,
+		})
+		m.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+	})
+
 	t.Run("bad db lookup", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		r := httptest.NewRequest(http.MethodGet, "/", nil)
-		cookieValue, _ := cookieSigner.Encode("auth", "account-user-id-2")
+		cookieValue, _ := cookieSigner.Encode("auth", "session-id-2")
 		r.AddCookie(&http.Cookie{
 			Name:  "auth",
 			Value: cookieValue,
@@ -185,7 +210,7 @@ func TestAccountUserMiddleware(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		r := httptest.NewRequest(http.MethodGet, "/", nil)
-		cookieValue, _ := cookieSigner.Encode("auth", "account-user-id-1")
+		cookieValue, _ := cookieSigner.Encode("auth", "session-id-1")
 		r.AddCookie(&http.Cookie{
 			Name:  "auth",
 			Value: cookieValue,
@@ -239,37 +264,81 @@ func TestHeaderMiddleware(t *testing.T) {
 	}
 }
 
-func TestEtagMiddleware(t *testing.T) {
+func TestQueryTokenMiddleware(t *testing.T) {
 	m := gin.New()
-	m.GET("/", etagMiddleware(), func(c *gin.Context) {
-		c.String(http.StatusOK, "OK this is the content!")
+	m.GET("/", queryTokenMiddleware("token"), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetHeader("Authorization"))
 	})
 
-	w1 := httptest.NewRecorder()
-	r1 := httptest.NewRequest(http.MethodGet, "/", nil)
-
-	m.ServeHTTP(w1, r1)
-
-	if w1.Code != http.StatusOK {
-		t.Errorf("Unexpected status code %v", w1.Code)
+	for query, expected := range map[string]string{
+		"/?token=abc": "Bearer abc",
+		"/":           "",
+	} {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, query, nil))
+		if w.Body.String() != expected {
+			t.Errorf("Expected %q for %s, got %q", expected, query, w.Body.String())
+		}
 	}
+}
 
-	if cacheControl := w1.Header().Get("Cache-Control"); cacheControl != "no-cache" {
-		t.Errorf("Unexpected cache control header %v", cacheControl)
-	}
+func TestBotMiddleware(t *testing.T) {
+	rt := router{config: &config.Config{}}
+	m := gin.New()
+	m.GET("/", rt.botMiddleware(contextKeyBot), func(c *gin.Context) {
+		c.String(http.StatusOK, "%v", c.GetBool(contextKeyBot))
+	})
 
-	etag := w1.Header().Get("Etag")
-	if etag == "" {
-		t.Fatal("No Etag header sent in response")
+	for userAgent, expected := range map[string]string{
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)":           "true",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0":            "false",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 Safari/605.1": "false",
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("User-Agent", userAgent)
+		m.ServeHTTP(w, r)
+		if w.Body.String() != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, userAgent, w.Body.String())
+		}
 	}
+}
 
-	w2 := httptest.NewRecorder()
-	r2 := httptest.NewRequest(http.MethodGet, "/", nil)
-	r2.Header["If-None-Match"] = []string{etag}
-
-	m.ServeHTTP(w2, r2)
-
-	if w2.Code != http.StatusNotModified {
-		t.Errorf("Unexpected status code %v", w2.Code)
+func TestPrivacySignalMiddleware(t *testing.T) {
+	tests := []struct {
+		name               string
+		policy             config.PrivacySignalPolicy
+		header             string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{"no signal", config.PrivacySignalDrop, "", http.StatusOK, "false"},
+		{"ignore", config.PrivacySignalIgnore, "DNT", http.StatusOK, "false"},
+		{"drop dnt", config.PrivacySignalDrop, "DNT", http.StatusNoContent, ""},
+		{"drop gpc", config.PrivacySignalDrop, "Sec-GPC", http.StatusNoContent, ""},
+		{"anonymous", config.PrivacySignalAnonymous, "Sec-GPC", http.StatusOK, "true"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.PrivacySignals = test.policy
+			rt := router{config: cfg}
+			m := gin.New()
+			m.GET("/", rt.privacySignalMiddleware(contextKeyAnonymous), func(c *gin.Context) {
+				c.String(http.StatusOK, "%v", c.GetBool(contextKeyAnonymous))
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				r.Header.Set(test.header, "1")
+			}
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if w.Body.String() != test.expectedBody {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+		})
 	}
 }
@@ -4,18 +4,98 @@
 package router
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+	"mpldr.codes/oidc"
 )
 
+// oauthStateTTL defines how long a user has for completing the login flow
+// at the identity provider before the state is discarded.
+const oauthStateTTL = time.Minute * 10
+
+func oauthStateCacheKey(state string) string {
+	return fmt.Sprintf("oauth-state-%s", state)
+}
+
+// lookupProvider returns the name of the provider requested. In case only a
+// single provider is configured, the name can be omitted.
+func (rt *router) lookupProvider(name string) (string, bool) {
+	if name == "" && len(rt.oidc) == 1 {
+		for key := range rt.oidc {
+			return key, true
+		}
+	}
+	_, ok := rt.oidc[name]
+	return name, ok
+}
+
+func (rt *router) oauthProviders(c *gin.Context) {
+	providers := []string{}
+	for name := range rt.oidc {
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+	c.JSON(http.StatusOK, providers)
+}
+
 func (rt *router) oauthLogin(c *gin.Context) {
-	c.Redirect(http.StatusTemporaryRedirect, rt.oidc.GetAuthorizationURL())
+	name, ok := rt.lookupProvider(c.Request.FormValue("provider"))
+	if !ok {
+		newJSONError(
+			fmt.Errorf("router: unknown identity provider %s", c.Request.FormValue("provider")),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	authorizationURL := rt.oidc[name].GetAuthorizationURL()
+	u, err := url.Parse(authorizationURL)
+	if err != nil || u.Query().Get("state") == "" {
+		newJSONError(
+			errors.New("router: error reading state from authorization url"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	// the state is bound to the issuing provider so the callback cannot be
+	// handled by any other provider
+	rt.getCache().Set(oauthStateCacheKey(u.Query().Get("state")), name, oauthStateTTL)
+
+	c.Redirect(http.StatusTemporaryRedirect, authorizationURL)
 }
 
 func (rt *router) oauthCallback(c *gin.Context) {
-	token, err := rt.oidc.Callback(c.Request.FormValue("code"), c.Request.FormValue("state"))
+	state := c.Request.FormValue("state")
+	cache, cacheKey := rt.getCache(), oauthStateCacheKey(state)
+	cachedName, ok := cache.Get(cacheKey)
+	if !ok {
+		newJSONError(
+			errors.New("router: authentication failed: unknown or expired state"),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return
+	}
+	// each state can only be used once
+	cache.Delete(cacheKey)
+
+	provider, ok := rt.oidc[cachedName]
+	if !ok {
+		newJSONError(
+			fmt.Errorf("router: authentication failed: unknown identity provider %s", cachedName),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return
+	}
+
+	token, err := provider.Callback(c.Request.FormValue("code"), state)
 	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: authentication failed: %w", err),
@@ -24,27 +104,88 @@ func (rt *router) oauthCallback(c *gin.Context) {
 		return
 	}
 
-	result, err := rt.db.LoginSSO(token.Email(), string(rt.config.Secret))
+	result, ok := rt.loginSSO(c, token.Email(), tokenGroups(token, rt.getConfig().OIDC.GroupsClaim))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// loginSSO logs in the account user with the given email after it has been
+// authenticated by an identity provider, provisioning it using the given
+// groups if needed. In case login fails, an error response is sent and false
+// is returned.
+func (rt *router) loginSSO(c *gin.Context, email string, groups []string) (persistence.LoginResult, bool) {
+	var previousSecrets []string
+	for _, secret := range rt.getConfig().PreviousSecrets {
+		previousSecrets = append(previousSecrets, string(secret))
+	}
+	result, err := rt.db.LoginSSO(email, string(rt.getConfig().Secret), rt.ssoProvisioning(groups), previousSecrets...)
 	if err != nil {
 		newJSONError(
 			fmt.Errorf("router: error logging in: %w", err),
 			http.StatusUnauthorized,
 		).Pipe(c)
-		return
+		return result, false
 	}
 
-	authCookie, authCookieErr := rt.authCookie(result.AccountUserID, c.GetBool(contextKeySecureContext))
+	authCookie, authCookieErr := rt.createSession(result.AccountUserID, c.GetBool(contextKeySecureContext))
 	if authCookieErr != nil {
 		newJSONError(
-			fmt.Errorf("router: error creating auth cookie: %w", authCookieErr),
+			fmt.Errorf("router: error creating session: %w", authCookieErr),
 			http.StatusInternalServerError,
 		).Pipe(c)
-		return
+		return result, false
+	}
+
+	if err := rt.db.RecordAuditLog(result.AccountUserID, result.AccountIDs(), persistence.AuditActionLogin, ""); err != nil {
+		rt.logError(err, "error recording login in audit log")
 	}
 
 	http.SetCookie(c.Writer, authCookie)
-	c.JSON(http.StatusOK, result)
+	return result, true
+}
+
+// ssoProvisioning returns the accounts a user logging in for the first time
+// is given access to, based on the groups reported by the identity provider.
+func (rt *router) ssoProvisioning(groups []string) persistence.SSOProvisioning {
+	result := persistence.SSOProvisioning{Sponsor: rt.getConfig().OIDC.Sponsor}
+	for _, grant := range rt.getConfig().OIDC.GroupMapping.Grants(groups) {
+		result.Grants = append(result.Grants, persistence.SSOGrant{
+			AccountID: grant.AccountID,
+			Admin:     grant.Admin,
+		})
+	}
+	return result
+}
+
+// tokenGroups returns the groups contained in the given claim of the ID
+// token returned by the identity provider.
+func tokenGroups(token *oidc.Token, name string) []string {
+	return groupsClaim(token.Claims(), name)
+}
+
+// groupsClaim reads the given claim as a list of groups. Identity providers
+// either use a list of strings or a single space separated string.
+func groupsClaim(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case []string:
+		return value
+	case []interface{}:
+		var groups []string
+		for _, item := range value {
+			if group, ok := item.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+		return groups
+	case string:
+		return strings.Fields(value)
+	default:
+		return nil
+	}
 }
 
 func (rt *router) oauthLogout(c *gin.Context) {
+	rt.postLogout(c)
 }
@@ -0,0 +1,164 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+	"mpldr.codes/oidc"
+)
+
+func TestRouter_oauthProviders(t *testing.T) {
+	rt := router{oidc: map[string]*oidc.Configuration{"partner": nil, "internal": nil}}
+	m := gin.New()
+	m.GET("/", rt.oauthProviders)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	m.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status code %v", w.Code)
+	}
+	if w.Body.String() != `["internal","partner"]` {
+		t.Errorf("Unexpected response body %s", w.Body.String())
+	}
+}
+
+func TestRouter_oauthLogin(t *testing.T) {
+	tests := []struct {
+		name               string
+		providers          map[string]*oidc.Configuration
+		body               string
+		expectedStatusCode int
+	}{
+		{
+			"unknown provider",
+			map[string]*oidc.Configuration{"internal": nil},
+			"provider=partner",
+			http.StatusBadRequest,
+		},
+		{
+			"ambiguous provider",
+			map[string]*oidc.Configuration{"internal": nil, "partner": nil},
+			"",
+			http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{oidc: test.providers}
+			m := gin.New()
+			m.POST("/", rt.oauthLogin)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_oauthCallback(t *testing.T) {
+	t.Run("unknown state", func(t *testing.T) {
+		rt := router{oidc: map[string]*oidc.Configuration{"internal": nil}}
+		m := gin.New()
+		m.POST("/", rt.oauthCallback)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("state=abc&code=xyz"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		m.ServeHTTP(w, r)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+	})
+	t.Run("state issued for removed provider", func(t *testing.T) {
+		rt := router{oidc: map[string]*oidc.Configuration{"internal": nil}}
+		rt.getCache().Set(oauthStateCacheKey("abc"), "partner", oauthStateTTL)
+		m := gin.New()
+		m.POST("/", rt.oauthCallback)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("state=abc&code=xyz"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		m.ServeHTTP(w, r)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		if _, ok := rt.getCache().Get(oauthStateCacheKey("abc")); ok {
+			t.Error("Expected state to be discarded after use")
+		}
+	})
+}
+
+func TestRouter_ssoProvisioning(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.OIDC.Sponsor = "sponsor@offen.dev"
+	cfg.OIDC.GroupMapping = config.GroupMapping{
+		{Group: "analytics-admins", AccountID: "account-a", Admin: true},
+		{Group: "analytics", AccountID: "account-b"},
+	}
+	rt := router{config: cfg}
+
+	result := rt.ssoProvisioning([]string{"analytics", "staff"})
+	expected := persistence.SSOProvisioning{
+		Sponsor: "sponsor@offen.dev",
+		Grants:  []persistence.SSOGrant{{AccountID: "account-b"}},
+	}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestTokenGroups(t *testing.T) {
+	if groups := tokenGroups(&oidc.Token{}, "groups"); len(groups) != 0 {
+		t.Errorf("Expected no groups for token without claims, got %v", groups)
+	}
+}
+
+func TestGroupsClaim(t *testing.T) {
+	tests := []struct {
+		name           string
+		claims         map[string]interface{}
+		expectedGroups []string
+	}{
+		{
+			"list of groups",
+			map[string]interface{}{"groups": []interface{}{"analytics-admins", "staff", 12}},
+			[]string{"analytics-admins", "staff"},
+		},
+		{
+			"space separated groups",
+			map[string]interface{}{"groups": "analytics analytics-admins"},
+			[]string{"analytics", "analytics-admins"},
+		},
+		{
+			"missing claim",
+			map[string]interface{}{"roles": []interface{}{"analytics"}},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			groups := groupsClaim(test.claims, "groups")
+			if !reflect.DeepEqual(test.expectedGroups, groups) {
+				t.Errorf("Expected %v, got %v", test.expectedGroups, groups)
+			}
+		})
+	}
+}
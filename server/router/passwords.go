@@ -0,0 +1,47 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/keys"
+)
+
+func (rt *router) passwordPolicy() *keys.PasswordPolicy {
+	policy := &keys.PasswordPolicy{Breaches: rt.breaches}
+	if cfg := rt.getConfig(); cfg != nil {
+		policy.MinLength = cfg.Passwords.MinLength
+		policy.MinScore = cfg.Passwords.MinScore
+	}
+	return policy
+}
+
+// validatePassword checks the given password against the configured password
+// policy. In case false is returned, the request has already been aborted
+// listing all violations of the policy.
+func (rt *router) validatePassword(c *gin.Context, password string) bool {
+	err := rt.passwordPolicy().Validate(password)
+	if err == nil {
+		return true
+	}
+	var policyErr *keys.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		newJSONError(
+			fmt.Errorf("router: error validating password: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return false
+	}
+	response := newJSONError(
+		fmt.Errorf("router: given password does not meet the password policy: %w", err),
+		http.StatusBadRequest,
+	)
+	response.Violations = policyErr.Violations
+	response.Pipe(c)
+	return false
+}
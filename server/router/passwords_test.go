@@ -0,0 +1,63 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/keys"
+)
+
+func TestRouter_validatePassword(t *testing.T) {
+	breaches, _ := keys.NewBloomFilter(10, 0.001)
+	sum := sha1.Sum([]byte("breached-password"))
+	breaches.Add(sum[:])
+
+	cfg := &config.Config{}
+	cfg.Passwords.MinLength = 12
+
+	tests := []struct {
+		name               string
+		password           string
+		expectedStatusCode int
+		expectedViolations []string
+	}{
+		{"ok", "unbreached-password", http.StatusNoContent, nil},
+		{"too short", "password", http.StatusBadRequest, []string{keys.PasswordViolationTooShort}},
+		{"breached", "breached-password", http.StatusBadRequest, []string{keys.PasswordViolationBreached}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{config: cfg, breaches: breaches}
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				if rt.validatePassword(c, test.password) {
+					c.Status(http.StatusNoContent)
+				}
+			})
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedViolations == nil {
+				return
+			}
+			var response errorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(response.Violations, test.expectedViolations) {
+				t.Errorf("Unexpected violations %v", response.Violations)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"strings"
+)
+
+// stripPathPrefixes serves requests for paths below one of the given
+// prefixes as if they had been issued without the prefix. This allows
+// operators to proxy requests for e.g. /analytics/* from the domain of the
+// embedding site to the instance without having to rewrite paths. Assets
+// referenced by the script and the vault use relative URLs, so they are
+// requested using the same prefix.
+func stripPathPrefixes(prefixes []string, next http.Handler) http.Handler {
+	var normalized []string
+	for _, prefix := range prefixes {
+		if p := strings.Trim(prefix, "/"); p != "" {
+			normalized = append(normalized, "/"+p)
+		}
+	}
+	if len(normalized) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range normalized {
+			remainder := strings.TrimPrefix(r.URL.Path, prefix)
+			if remainder == r.URL.Path || (remainder != "" && !strings.HasPrefix(remainder, "/")) {
+				continue
+			}
+			if remainder == "" {
+				remainder = "/"
+			}
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = remainder
+			r2.URL.RawPath = ""
+			next.ServeHTTP(w, r2)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
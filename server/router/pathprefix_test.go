@@ -0,0 +1,32 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStripPathPrefixes(t *testing.T) {
+	handler := stripPathPrefixes([]string{"/analytics/", "", "stats"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	for path, expected := range map[string]string{
+		"/script.js":              "/script.js",
+		"/analytics/script.js":    "/script.js",
+		"/analytics/vault":        "/vault",
+		"/analytics":              "/",
+		"/analyticsz/script.js":   "/analyticsz/script.js",
+		"/stats/api/events":       "/api/events",
+		"/other/analytics/vault":  "/other/analytics/vault",
+		"/analytics/vault/app.js": "/vault/app.js",
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Body.String() != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, path, w.Body.String())
+		}
+	}
+}
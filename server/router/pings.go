@@ -0,0 +1,121 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+type pingPayload struct {
+	AccountID string `json:"accountId"`
+}
+
+// postPing counts a pageview of a visitor that has declined consent. Pings
+// do not require a user cookie and are not stored on their own, so they
+// cannot be linked to the visitor sending them.
+func (rt *router) postPing(c *gin.Context) {
+	// the address is only used for rate limiting and is never stored
+	ip := clientIP(c.Request, rt.trustedProxies())
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit(rt.getConfig().RateLimit.Events), fmt.Sprintf("postPing-%s", ip)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	var payload pingPayload
+	if !bindPayload(c, &payload) {
+		return
+	}
+
+	// pings cannot be told apart later on, so crawlers are only counted
+	// in case the account accepts their events without flagging them
+	if c.GetBool(contextKeyBot) && rt.accountBotPolicy(payload.AccountID) != config.BotPolicyAllow {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	if allowed, err := rt.originAllowed(c.Request, payload.AccountID); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error checking origin of ping: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	} else if !allowed {
+		newJSONError(
+			fmt.Errorf("router: account %s does not accept pings from this origin", payload.AccountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.db.RecordPing(payload.AccountID); err != nil {
+		var unknownAccountErr persistence.ErrUnknownAccount
+		if errors.As(err, &unknownAccountErr) {
+			newJSONError(
+				fmt.Errorf("router: error recording ping: %w", unknownAccountErr),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		var disabledErr persistence.ErrAccountDisabled
+		if errors.As(err, &disabledErr) {
+			newJSONError(
+				fmt.Errorf("router: error recording ping: %w", disabledErr),
+				http.StatusForbidden,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error recording ping: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// getPings returns the daily number of pings an account has received.
+func (rt *router) getPings(c *gin.Context) {
+	accountID := c.Param("accountID")
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	if !accountUser.CanAccessAccount(accountID) {
+		newJSONError(
+			fmt.Errorf("router: account user does not have permissions to access account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	days, ok := windowDays(c)
+	if !ok {
+		return
+	}
+
+	result, err := rt.db.ListPings(accountID, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up pings: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
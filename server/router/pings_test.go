@@ -0,0 +1,112 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockPingsDatabase struct {
+	persistence.Service
+	err      error
+	recorded []string
+}
+
+func (m *mockPingsDatabase) RecordPing(accountID string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.recorded = append(m.recorded, accountID)
+	return nil
+}
+
+func (m *mockPingsDatabase) GetAccount(string, bool, bool, string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{}, nil
+}
+
+func TestRouter_postPing(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockPingsDatabase
+		body               string
+		isBot              bool
+		expectedStatusCode int
+		expectedRecorded   int
+	}{
+		{
+			"bad payload",
+			&mockPingsDatabase{},
+			`{"accountId":""}`,
+			false,
+			http.StatusUnprocessableEntity,
+			0,
+		},
+		{
+			"unknown account",
+			&mockPingsDatabase{err: persistence.ErrUnknownAccount("unknown")},
+			`{"accountId":"account-a"}`,
+			false,
+			http.StatusNotFound,
+			0,
+		},
+		{
+			"database error",
+			&mockPingsDatabase{err: errors.New("did not work")},
+			`{"accountId":"account-a"}`,
+			false,
+			http.StatusInternalServerError,
+			0,
+		},
+		{
+			"bot",
+			&mockPingsDatabase{},
+			`{"accountId":"account-a"}`,
+			true,
+			http.StatusNoContent,
+			0,
+		},
+		{
+			"ok",
+			&mockPingsDatabase{},
+			`{"accountId":"account-a"}`,
+			false,
+			http.StatusNoContent,
+			1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.BotPolicy = config.BotPolicyFlag
+			rt := router{db: test.db, config: cfg}
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyBot, test.isBot)
+				c.Next()
+			}, rt.postPing)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if len(test.db.recorded) != test.expectedRecorded {
+				t.Errorf("Unexpected pings %v", test.db.recorded)
+			}
+			if w.Header().Get("Set-Cookie") != "" {
+				t.Errorf("Unexpected cookie %v", w.Header().Get("Set-Cookie"))
+			}
+		})
+	}
+}
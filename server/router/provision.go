@@ -0,0 +1,104 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+// provisionRequest is a declarative document describing accounts. Passing
+// the credentials of an account admin is only required when members of
+// existing accounts are added or removed.
+type provisionRequest struct {
+	persistence.ProvisionConfig
+	EmailAddress string `json:"emailAddress"`
+	Password     string `json:"password"`
+}
+
+// validateProvisionSettings checks the account settings that are resolved
+// using the application config.
+func validateProvisionSettings(c persistence.ProvisionConfig) error {
+	for _, account := range c.Accounts {
+		// an empty value resets the account to the global default
+		if account.RetentionPeriod != nil && *account.RetentionPeriod != "" {
+			if _, err := config.RetentionDuration(*account.RetentionPeriod); err != nil {
+				return fmt.Errorf("invalid retention period for account %s: %w", account.AccountID, err)
+			}
+		}
+		if account.BotPolicy != nil && *account.BotPolicy != "" {
+			var policy config.BotPolicy
+			if err := policy.Decode(*account.BotPolicy); err != nil {
+				return fmt.Errorf("invalid bot policy for account %s: %w", account.AccountID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// postAdminProvision makes the accounts of the instance match the given
+// document and responds with the changes applied. Passing dryRun=true
+// reports the changes without applying them.
+func (rt *router) postAdminProvision(c *gin.Context) {
+	var req provisionRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	if err := validateProvisionSettings(req.ProvisionConfig); err != nil {
+		newJSONError(
+			fmt.Errorf("router: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	if req.EmailAddress != "" {
+		if _, err := rt.db.VerifyCredentials(req.EmailAddress, req.Password); err != nil {
+			newJSONError(
+				fmt.Errorf("router: error verifying credentials: %w", err),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+	}
+
+	dryRun := c.Query("dryRun") == "true"
+	result, err := rt.db.Provision(req.ProvisionConfig, persistence.ProvisionCredentials{
+		EmailAddress: req.EmailAddress,
+		Password:     req.Password,
+	}, dryRun)
+	if err != nil {
+		var invalidErr persistence.ErrInvalidProvisioning
+		var conflictErr persistence.ErrProvisioningConflict
+		status := http.StatusInternalServerError
+		switch {
+		case errors.As(err, &invalidErr):
+			status = http.StatusBadRequest
+		case errors.As(err, &conflictErr):
+			status = http.StatusConflict
+		}
+		newJSONError(
+			fmt.Errorf("router: error provisioning accounts: %w", err),
+			status,
+		).Pipe(c)
+		return
+	}
+
+	if !dryRun {
+		for _, change := range result.Changes {
+			rt.getCache().Delete(fmt.Sprintf("account-retention-%s", change.AccountID))
+			rt.getCache().Delete(fmt.Sprintf("account-bot-policy-%s", change.AccountID))
+			rt.getCache().Delete(fmt.Sprintf("account-allowed-origins-%s", change.AccountID))
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockProvisionDatabase struct {
+	persistence.Service
+	err      error
+	loginErr error
+	dryRuns  []bool
+}
+
+func (m *mockProvisionDatabase) VerifyCredentials(email, password string) (persistence.LoginResult, error) {
+	return persistence.LoginResult{}, m.loginErr
+}
+
+func (m *mockProvisionDatabase) Provision(c persistence.ProvisionConfig, credentials persistence.ProvisionCredentials, dryRun bool) (persistence.ProvisionResult, error) {
+	m.dryRuns = append(m.dryRuns, dryRun)
+	return persistence.ProvisionResult{DryRun: dryRun}, m.err
+}
+
+func TestRouter_postAdminProvision(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockProvisionDatabase
+		query              string
+		body               string
+		expectedStatusCode int
+		expectedDryRuns    []bool
+	}{
+		{
+			"bad payload",
+			&mockProvisionDatabase{},
+			"",
+			`[]`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"bad retention",
+			&mockProvisionDatabase{},
+			"",
+			`{"accounts":[{"id":"account-a","name":"a","retentionPeriod":"forever"}]}`,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"bad credentials",
+			&mockProvisionDatabase{loginErr: errors.New("did not work")},
+			"",
+			`{"accounts":[],"emailAddress":"develop@offen.dev","password":"secret"}`,
+			http.StatusUnauthorized,
+			nil,
+		},
+		{
+			"conflict",
+			&mockProvisionDatabase{err: persistence.ErrProvisioningConflict("conflict")},
+			"",
+			`{"accounts":[]}`,
+			http.StatusConflict,
+			[]bool{false},
+		},
+		{
+			"invalid",
+			&mockProvisionDatabase{err: persistence.ErrInvalidProvisioning("invalid")},
+			"",
+			`{"accounts":[]}`,
+			http.StatusBadRequest,
+			[]bool{false},
+		},
+		{
+			"database error",
+			&mockProvisionDatabase{err: errors.New("did not work")},
+			"",
+			`{"accounts":[]}`,
+			http.StatusInternalServerError,
+			[]bool{false},
+		},
+		{
+			"dry run",
+			&mockProvisionDatabase{},
+			"?dryRun=true",
+			`{"accounts":[{"id":"account-a","name":"a","retentionPeriod":"30days"}]}`,
+			http.StatusOK,
+			[]bool{true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.POST("/", rt.postAdminProvision)
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/"+test.query, strings.NewReader(test.body)))
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if len(test.db.dryRuns) != len(test.expectedDryRuns) {
+				t.Fatalf("Unexpected calls %v", test.db.dryRuns)
+			}
+			for idx, dryRun := range test.expectedDryRuns {
+				if test.db.dryRuns[idx] != dryRun {
+					t.Errorf("Unexpected dry run %v", test.db.dryRuns)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+// replayClockSkew is the tolerance applied to timestamps that are
+// slightly ahead of the server's clock.
+const replayClockSkew = time.Minute
+
+// replayEventPayload is an event that has been recorded while the client
+// was offline. The signature is created using the replay key of the user.
+type replayEventPayload struct {
+	inboundEventPayload
+	RecordedAt string `json:"recordedAt"`
+	Signature  string `json:"signature"`
+}
+
+type replayKeyResponse struct {
+	Key          string `json:"key"`
+	WindowInDays int    `json:"windowInDays"`
+}
+
+// replayKey derives the key a user signs events recorded while offline
+// with. It is handed out when the client is online and never stored.
+func (rt *router) replayKey(userID string) []byte {
+	mac := hmac.New(sha256.New, rt.getConfig().Secret.Bytes())
+	mac.Write([]byte("offen-replay|" + userID))
+	return mac.Sum(nil)
+}
+
+// replaySignature signs the given event using the given key. Fields are
+// separated using newlines, which cannot be part of any field.
+func replaySignature(key []byte, accountID, recordedAt, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(accountID + "\n" + recordedAt + "\n" + payload))
+	return mac.Sum(nil)
+}
+
+func (rt *router) getReplayKey(c *gin.Context) {
+	userID := c.GetString(contextKeyCookie)
+	c.JSON(http.StatusOK, replayKeyResponse{
+		Key:          base64.StdEncoding.EncodeToString(rt.replayKey(userID)),
+		WindowInDays: int(rt.getConfig().App.ReplayWindow.Hours() / 24),
+	})
+}
+
+// checkReplayedEvent returns the time the given event has been recorded at
+// in case it is signed correctly and can still be accepted.
+func (rt *router) checkReplayedEvent(key []byte, evt replayEventPayload, now time.Time) (time.Time, []string) {
+	if violations := evt.validate(); len(violations) != 0 {
+		return time.Time{}, violations
+	}
+	recordedAt, err := time.Parse(time.RFC3339, evt.RecordedAt)
+	if err != nil {
+		return time.Time{}, []string{"recordedAt: must be a RFC3339 timestamp"}
+	}
+	signature, err := hex.DecodeString(evt.Signature)
+	if err != nil || !hmac.Equal(signature, replaySignature(key, evt.AccountID, evt.RecordedAt, evt.Payload)) {
+		return time.Time{}, []string{"signature: does not match"}
+	}
+
+	if recordedAt.After(now.Add(replayClockSkew)) {
+		return time.Time{}, []string{"recordedAt: must not be in the future"}
+	}
+	// timestamps within the tolerated skew are not backdated at all
+	if recordedAt.After(now) {
+		recordedAt = now
+	}
+	// events that would be expired right away are rejected too
+	window := rt.getConfig().App.ReplayWindow
+	if retention := rt.accountRetention(evt.AccountID); retention < window {
+		window = retention
+	}
+	if recordedAt.Before(now.Add(-window)) {
+		return time.Time{}, []string{fmt.Sprintf("recordedAt: must not be older than %v", window)}
+	}
+	return recordedAt, nil
+}
+
+// postReplayEvents accepts events that have been buffered by clients while
+// being offline, e.g. by a service worker. Each event carries the time it has
+// been recorded at, which is used for backdating the event in case the event
+// is signed using the user's replay key and falls within the accepted window.
+func (rt *router) postReplayEvents(c *gin.Context) {
+	userID := c.GetString(contextKeyCookie)
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit(rt.getConfig().RateLimit.Events), fmt.Sprintf("postReplayEvents-%s", userID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	var payload []replayEventPayload
+	if !bindPayload(c, &payload) {
+		return
+	}
+	if len(payload) == 0 || len(payload) > maxEventBatchSize {
+		newJSONError(
+			fmt.Errorf("router: expected between 1 and %d events, received %d", maxEventBatchSize, len(payload)),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	key, now := rt.replayKey(userID), time.Now()
+	candidates := make([]batchCandidate, len(payload))
+	for i, evt := range payload {
+		candidates[i] = batchCandidate{inboundEventPayload: evt.inboundEventPayload}
+		recordedAt, violations := rt.checkReplayedEvent(key, evt, now)
+		if len(violations) != 0 {
+			candidates[i].rejection = &batchItemResponse{
+				Status: http.StatusUnprocessableEntity,
+				Error:  fmt.Sprintf("router: event is invalid: %s", strings.Join(violations, ", ")),
+			}
+			continue
+		}
+		candidates[i].recordedAt = recordedAt
+	}
+	rt.insertBatch(c, userID, candidates)
+}
@@ -0,0 +1,103 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockReplayEventsService struct {
+	persistence.Service
+	inserted []persistence.BatchEvent
+}
+
+func (m *mockReplayEventsService) InsertBatch(userID string, events []persistence.BatchEvent) ([]error, error) {
+	m.inserted = append(m.inserted, events...)
+	return make([]error, len(events)), nil
+}
+
+func (m *mockReplayEventsService) GetAccount(string, bool, bool, string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{}, nil
+}
+
+func TestRouter_postReplayEvents(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Secret = config.Bytes("secret")
+	cfg.App.ReplayWindow = time.Hour * 72
+	db := &mockReplayEventsService{}
+	rt := &router{db: db, config: cfg}
+
+	m := gin.New()
+	m.POST("/", func(c *gin.Context) {
+		c.Set(contextKeyCookie, "user-id")
+		c.Next()
+	}, rt.postReplayEvents)
+
+	now := time.Now()
+	sign := func(key []byte, accountID string, recordedAt time.Time, payload string) map[string]string {
+		ts := recordedAt.Format(time.RFC3339)
+		return map[string]string{
+			"accountId":  accountID,
+			"payload":    payload,
+			"recordedAt": ts,
+			"signature":  hex.EncodeToString(replaySignature(key, accountID, ts, payload)),
+		}
+	}
+	key := rt.replayKey("user-id")
+	tampered := sign(key, "account-a", now.Add(-time.Hour), "payload")
+	tampered["recordedAt"] = now.Add(-time.Hour * 2).Format(time.RFC3339)
+
+	body, _ := json.Marshal([]map[string]string{
+		sign(key, "account-a", now.Add(-time.Hour), "payload"),
+		sign(rt.replayKey("other-user"), "account-a", now.Add(-time.Hour), "payload"),
+		tampered,
+		sign(key, "account-a", now.Add(-time.Hour*96), "payload"),
+		sign(key, "account-a", now.Add(time.Hour), "payload"),
+		sign(key, "account-a", now.Add(time.Second*10), "payload"),
+	})
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body))))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %d", w.Code)
+	}
+
+	var response batchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := []int{
+		http.StatusCreated,
+		http.StatusUnprocessableEntity,
+		http.StatusUnprocessableEntity,
+		http.StatusUnprocessableEntity,
+		http.StatusUnprocessableEntity,
+		http.StatusCreated,
+	}
+	for i, status := range expected {
+		if response.Results[i].Status != status {
+			t.Errorf("Expected status %d for item %d, got %v", status, i, response.Results[i])
+		}
+	}
+
+	if len(db.inserted) != 2 {
+		t.Fatalf("Unexpected inserts %v", db.inserted)
+	}
+	if db.inserted[0].RecordedAt.Unix() != now.Add(-time.Hour).Unix() {
+		t.Errorf("Expected event to be backdated, got %v", db.inserted[0].RecordedAt)
+	}
+	if db.inserted[1].RecordedAt.After(time.Now()) {
+		t.Errorf("Expected timestamp to be clamped, got %v", db.inserted[1].RecordedAt)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"crypto/md5"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// applyEventsRevision sets an ETag header for a query of the user's events,
+// derived from the events that are persisted for the user in the requested
+// accounts. In case the client's version is still current, a 304 status is
+// written and true is returned, meaning the caller must not query for events.
+func (rt *router) applyEventsRevision(c *gin.Context, userID string, accountIDs []string) bool {
+	revision, err := rt.db.EventsRevision(userID, accountIDs)
+	if err != nil {
+		// the events query is performed in any case, so clients can still
+		// sync, only without being able to skip unchanged results
+		rt.logError(err, "error looking up events revision")
+		return false
+	}
+	// the retention period is part of the response and can be changed
+	// when reloading the configuration
+	etag := fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf(
+		"%s-%s-%s-%s", userID, c.Request.URL.RawQuery, rt.getConfig().App.Retention.String(), revision,
+	))))
+	return applyETag(c, etag)
+}
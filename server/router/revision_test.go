@@ -0,0 +1,86 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+type mockRevisionDatabase struct {
+	persistence.Service
+	revisions map[string]string
+	err       error
+	queries   int
+}
+
+func (m *mockRevisionDatabase) EventsRevision(userID string, accountIDs []string) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	var revision string
+	for _, accountID := range accountIDs {
+		revision += m.revisions[accountID]
+	}
+	return revision, nil
+}
+
+func (m *mockRevisionDatabase) Query(q persistence.Query) (persistence.EventsResult, error) {
+	m.queries++
+	return persistence.EventsResult{}, nil
+}
+
+func TestRouter_getEvents_conditional(t *testing.T) {
+	db := &mockRevisionDatabase{
+		revisions: map[string]string{"account-a": "account-a:12:4", "account-b": "account-b:3:1"},
+	}
+	rt := &router{db: db, config: &config.Config{}, limiter: ratelimiter.NewNoopRateLimiter()}
+	m := gin.New()
+	m.GET("/", func(c *gin.Context) {
+		c.Set(contextKeyCookie, "user-a")
+	}, rt.getEvents)
+
+	request := func(query string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/"+query, nil)
+		for key, values := range header {
+			r.Header[key] = values
+		}
+		m.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("?accountId=account-a", nil)
+	if w.Code != http.StatusOK || db.queries != 1 {
+		t.Fatalf("Unexpected result %v after %d queries", w.Code, db.queries)
+	}
+	etag := w.Header().Get("Etag")
+	if etag == "" {
+		t.Fatal("No Etag header sent in response")
+	}
+
+	if w := request("?accountId=account-a", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusNotModified || db.queries != 1 {
+		t.Errorf("Unexpected result %v after %d queries", w.Code, db.queries)
+	}
+	if w := request("?accountId=account-b", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusOK || db.queries != 2 {
+		t.Errorf("Unexpected result %v after %d queries", w.Code, db.queries)
+	}
+
+	db.revisions["account-a"] = "account-a:13:5"
+	if w := request("?accountId=account-a", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusOK || w.Header().Get("Etag") == etag {
+		t.Errorf("Unexpected result %v after changing events", w.Code)
+	}
+
+	db.err = errors.New("did not work")
+	if w := request("?accountId=account-a", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusOK || w.Header().Get("Etag") != "" {
+		t.Errorf("Unexpected result %v when revision is unavailable", w.Code)
+	}
+}
@@ -4,57 +4,132 @@
 package router
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/NYTimes/gziphandler"
-	"github.com/felixge/httpsnoop"
+	"github.com/crewjam/saml"
 	"github.com/gin-contrib/location"
 	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gorilla/securecookie"
+	"github.com/graphql-go/graphql"
 	"github.com/microcosm-cc/bluemonday"
+	"github.com/offen/offen/server/botfilter"
+	"github.com/offen/offen/server/cache"
 	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/domainverify"
+	"github.com/offen/offen/server/keys"
+	"github.com/offen/offen/server/livefeed"
 	"github.com/offen/offen/server/mailer"
+	"github.com/offen/offen/server/metrics"
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/public"
 	ratelimiter "github.com/offen/offen/server/ratelimiter"
-	"github.com/patrickmn/go-cache"
+	"github.com/offen/offen/server/scheduler"
+	"github.com/offen/offen/server/stylestore"
 	"github.com/sirupsen/logrus"
 	"mpldr.codes/oidc"
 )
 
 type router struct {
-	db           persistence.Service
-	mailer       mailer.Mailer
-	fs           http.FileSystem
-	logger       *logrus.Logger
-	cookieSigner *securecookie.SecureCookie
-	template     *template.Template
-	emails       *template.Template
-	config       *config.Config
-	sanitizer    *bluemonday.Policy
-	limiter      ratelimiter.Throttler
-	cache        *cache.Cache
-	oidc         *oidc.Configuration
+	db              persistence.Service
+	mailer          mailer.Mailer
+	fs              http.FileSystem
+	logger          *logrus.Logger
+	accessLogger    *logrus.Logger
+	accessLogOutput io.Writer
+	cookieSigner    *securecookie.SecureCookie
+	template        *template.Template
+	emails          *template.Template
+	localized       map[string]*template.Template
+	emailTemplates  *mailer.Templates
+	config          *config.Config
+	liveConfig      *config.Live
+	sanitizer       *bluemonday.Policy
+	limiter         ratelimiter.Throttler
+	cache           cache.Cache
+	limitBackend    ratelimiter.Backend
+	metrics         *metrics.Registry
+	liveFeed        *livefeed.Broker
+	oidc            map[string]*oidc.Configuration
+	demoSeeder      func() error
+	styles          stylestore.Store
+	oidcIssuers     map[string]string
+	saml            *saml.ServiceProvider
+	webauthn        *webauthn.WebAuthn
+	graphql         *graphql.Schema
+	bots            *botfilter.Filter
+	integrity       []public.AssetIntegrity
+	domains         domainverify.Verifier
+	scheduler       *scheduler.Scheduler
+	breaches        *keys.BloomFilter
+	breaker         *circuitBreaker
+	ready           atomic.Bool
+}
+
+// getConfig returns the current configuration. In case a live configuration
+// has been given, values might change between calls, so handlers should
+// call it once per request where consistency matters.
+func (rt *router) getConfig() *config.Config {
+	if rt.liveConfig != nil {
+		return rt.liveConfig.Load()
+	}
+	return rt.config
 }
 
 func (rt *router) getLimiter() ratelimiter.Throttler {
 	if rt.limiter == nil {
-		if rt.config != nil && rt.config.Server.ReverseProxy {
+		if rt.getConfig() != nil && rt.getConfig().Server.ReverseProxy {
 			rt.limiter = ratelimiter.NewNoopRateLimiter()
+		} else if rt.limitBackend != nil {
+			// all instances need to agree on the keys used for storing limits,
+			// so the salt is derived from the shared secret
+			rt.limiter = ratelimiter.NewShared(
+				time.Second*30,
+				rt.limitBackend,
+				rt.getConfig().Secret.Bytes(),
+				!rt.getConfig().Cache.RateLimitFailOpen,
+			)
 		} else {
-			rt.limiter = ratelimiter.New(time.Second*30, cache.New(time.Minute, time.Minute*2))
+			rt.limiter = ratelimiter.New(time.Second*30, ratelimiter.NewMemoryBackend(time.Minute*2))
 		}
 	}
 	return rt.limiter
 }
 
-func (rt *router) getCache() *cache.Cache {
+func (rt *router) getStyleStore() stylestore.Store {
+	if rt.styles == nil {
+		rt.styles = stylestore.NewDatabaseStore(rt.db)
+	}
+	return rt.styles
+}
+
+func (rt *router) getBotFilter() *botfilter.Filter {
+	if rt.bots == nil {
+		rt.bots = botfilter.Default()
+	}
+	return rt.bots
+}
+
+func (rt *router) getDomainVerifier() domainverify.Verifier {
+	if rt.domains == nil {
+		rt.domains = domainverify.New(time.Second * 10)
+	}
+	return rt.domains
+}
+
+func (rt *router) getCache() cache.Cache {
 	if rt.cache == nil {
-		rt.cache = cache.New(cache.NoExpiration, time.Minute)
+		rt.cache = cache.NewLocal(time.Minute)
 	}
 	return rt.cache
 }
@@ -74,9 +149,132 @@ const (
 	contextKeyCookie        = "contextKeyCookie"
 	contextKeyAuth          = "contextKeyAuth"
 	contextKeySecureContext = "contextKeySecure"
+	contextKeyShareLink     = "contextKeyShareLink"
+	contextKeySession       = "contextKeySession"
+	contextKeyBot           = "contextKeyBot"
+	contextKeyAnonymous     = "contextKeyAnonymous"
+	contextKeyNonce         = "contextKeyNonce"
 )
 
-func (rt *router) userCookie(userID string, secure bool) *http.Cookie {
+// accountRetention returns the retention period that applies to events of the
+// given account, falling back to the global default. As this is looked up for
+// each ingested event, values are cached for a short time.
+func (rt *router) accountRetention(accountID string) time.Duration {
+	cache, cacheKey := rt.getCache(), fmt.Sprintf("account-retention-%s", accountID)
+	period, ok := cache.Get(cacheKey)
+	if !ok {
+		account, err := rt.db.GetAccount(accountID, false, false, "")
+		if err != nil {
+			return rt.defaultRetention()
+		}
+		period = account.RetentionPeriod
+		cache.Set(cacheKey, period, time.Minute*5)
+	}
+	if period == "" {
+		return rt.defaultRetention()
+	}
+	retention, err := config.RetentionDuration(period)
+	if err != nil {
+		return rt.defaultRetention()
+	}
+	return retention
+}
+
+// accountBotPolicy returns the policy that applies to events of the given
+// account that are sent by crawlers, falling back to the global default.
+// Values are cached the same way retention periods are.
+func (rt *router) accountBotPolicy(accountID string) config.BotPolicy {
+	cache, cacheKey := rt.getCache(), fmt.Sprintf("account-bot-policy-%s", accountID)
+	policy, ok := cache.Get(cacheKey)
+	if !ok {
+		account, err := rt.db.GetAccount(accountID, false, false, "")
+		if err != nil {
+			return rt.defaultBotPolicy()
+		}
+		policy = account.BotPolicy
+		cache.Set(cacheKey, policy, time.Minute*5)
+	}
+	var result config.BotPolicy
+	if err := result.Decode(policy); err != nil {
+		return rt.defaultBotPolicy()
+	}
+	return result
+}
+
+// accountCookiePolicy returns the cookie policy of the given account. Values
+// are cached the same way retention periods are.
+func (rt *router) accountCookiePolicy(accountID string) persistence.CookiePolicy {
+	cache, cacheKey := rt.getCache(), fmt.Sprintf("account-cookie-policy-%s", accountID)
+	encoded, ok := cache.Get(cacheKey)
+	if !ok {
+		account, err := rt.db.GetAccount(accountID, false, false, "")
+		if err != nil {
+			return persistence.CookiePolicy{}
+		}
+		encoded = "{}"
+		if account.CookiePolicy != nil {
+			if b, err := json.Marshal(account.CookiePolicy); err == nil {
+				encoded = string(b)
+			}
+		}
+		cache.Set(cacheKey, encoded, time.Minute*5)
+	}
+	var policy persistence.CookiePolicy
+	if err := json.Unmarshal([]byte(encoded), &policy); err != nil {
+		return persistence.CookiePolicy{}
+	}
+	return policy
+}
+
+// userCookieLifetime returns the duration the user cookie is kept for after
+// an event has been sent to the given account. It never exceeds the
+// retention period of the account, as the cookie would be of no use after
+// all events have expired.
+func (rt *router) userCookieLifetime(accountID string) time.Duration {
+	retention := rt.accountRetention(accountID)
+	lifetime, err := rt.accountCookiePolicy(accountID).UserCookieLifetimeDuration()
+	if err != nil || lifetime == 0 {
+		lifetime = rt.getConfig().App.UserCookieLifetime
+	}
+	if lifetime > 0 && lifetime < retention {
+		return lifetime
+	}
+	return retention
+}
+
+// consentLifetime returns the duration a consent decision for the given
+// account is kept for.
+func (rt *router) consentLifetime(accountID string) time.Duration {
+	if accountID != "" {
+		if lifetime, err := rt.accountCookiePolicy(accountID).ConsentLifetimeDuration(); err == nil && lifetime > 0 {
+			return lifetime
+		}
+	}
+	return rt.getConfig().App.ConsentLifetime
+}
+
+// defaultBotPolicy returns the configured bot policy. Configurations that
+// do not define a policy allow all events.
+func (rt *router) defaultBotPolicy() config.BotPolicy {
+	if c := rt.getConfig(); c != nil && c.App.BotPolicy != "" {
+		return c.App.BotPolicy
+	}
+	return config.BotPolicyAllow
+}
+
+// defaultRetention returns the configured retention period, which might
+// have been reloaded at runtime.
+func (rt *router) defaultRetention() time.Duration {
+	if c := rt.getConfig(); c != nil && c.App.Retention.Duration() != 0 {
+		return c.App.Retention.Duration()
+	}
+	return config.EventRetention
+}
+
+// userCookie returns a cookie for the given user id that expires after the
+// given lifetime. Passing an empty user id returns a cookie that
+// removes any existing user cookie.
+func (rt *router) userCookie(userID string, lifetime time.Duration, secure bool) *http.Cookie {
 	sameSite := http.SameSiteNoneMode
 	if !secure {
 		sameSite = http.SameSiteLaxMode
@@ -92,12 +290,14 @@ func (rt *router) userCookie(userID string, secure bool) *http.Cookie {
 		Path:     "/api",
 	}
 	if userID != "" {
-		c.Expires = time.Now().Add(config.EventRetention)
+		c.Expires = time.Now().Add(lifetime)
 	}
 	return c
 }
 
-func (rt *router) authCookie(userID string, secure bool) (*http.Cookie, error) {
+// authCookie returns a cookie referencing the given session. Passing an empty
+// session id returns a cookie that removes any existing auth cookie.
+func (rt *router) authCookie(sessionID string, secure bool) (*http.Cookie, error) {
 	c := http.Cookie{
 		Name:     authKey,
 		HttpOnly: true,
@@ -105,10 +305,10 @@ func (rt *router) authCookie(userID string, secure bool) (*http.Cookie, error) {
 		Secure:   secure,
 		Path:     "/api",
 	}
-	if userID == "" {
+	if sessionID == "" {
 		c.Expires = time.Unix(0, 0)
 	} else {
-		value, err := rt.cookieSigner.MaxAge(24*60*60).Encode(authKey, userID)
+		value, err := rt.cookieSigner.MaxAge(int(sessionLifetime.Seconds())).Encode(authKey, sessionID)
 		if err != nil {
 			return nil, err
 		}
@@ -117,6 +317,24 @@ func (rt *router) authCookie(userID string, secure bool) (*http.Cookie, error) {
 	return &c, nil
 }
 
+// decodeSigned decodes a value that has been signed using signer. Values that
+// have been signed before the secret of the instance was rotated are checked
+// against the previous secrets, so rotating does not invalidate all of them
+// at once.
+func (rt *router) decodeSigned(signer *securecookie.SecureCookie, maxAge time.Duration, name, value string, dst interface{}) error {
+	err := signer.Decode(name, value, dst)
+	if err == nil || rt.getConfig() == nil {
+		return err
+	}
+	for _, secret := range rt.getConfig().PreviousSecrets {
+		previous := securecookie.New(secret.Bytes(), nil).MaxAge(int(maxAge.Seconds()))
+		if previous.Decode(name, value, dst) == nil {
+			return nil
+		}
+	}
+	return err
+}
+
 // Config adds a configuration value to the router
 type Config func(*router)
 
@@ -134,6 +352,14 @@ func WithLogger(l *logrus.Logger) Config {
 	}
 }
 
+// WithAccessLogOutput sets the destination access logs are written to.
+// It defaults to stdout.
+func WithAccessLogOutput(w io.Writer) Config {
+	return func(r *router) {
+		r.accessLogOutput = w
+	}
+}
+
 // WithTemplate ensures the router is using the given template object
 // for rendering dynamic HTML output.
 func WithTemplate(t *template.Template) Config {
@@ -150,6 +376,27 @@ func WithEmails(t *template.Template) Config {
 	}
 }
 
+// WithLocalizedTemplates ensures the router is using the given template
+// object for rendering HTML output in the given locale. It can be passed
+// multiple times for supporting multiple locales.
+func WithLocalizedTemplates(locale string, html *template.Template) Config {
+	return func(r *router) {
+		if r.localized == nil {
+			r.localized = map[string]*template.Template{}
+		}
+		r.localized[locale] = html
+	}
+}
+
+// WithEmailTemplates ensures the router is using the given templates for
+// rendering email output in all available locales. It takes precedence
+// over WithEmails.
+func WithEmailTemplates(t *mailer.Templates) Config {
+	return func(r *router) {
+		r.emailTemplates = t
+	}
+}
+
 // WithConfig attaches the given runtime config to the router.
 func WithConfig(c *config.Config) Config {
 	return func(r *router) {
@@ -157,6 +404,15 @@ func WithConfig(c *config.Config) Config {
 	}
 }
 
+// WithLiveConfig makes the router read its configuration from the given
+// value, so that reloaded values are picked up without restarting. It takes
+// precedence over WithConfig.
+func WithLiveConfig(l *config.Live) Config {
+	return func(r *router) {
+		r.liveConfig = l
+	}
+}
+
 // WithFS attaches a filesystem for serving static assets
 func WithFS(fs http.FileSystem) Config {
 	return func(r *router) {
@@ -164,6 +420,14 @@ func WithFS(fs http.FileSystem) Config {
 	}
 }
 
+// WithIntegrity sets the Subresource Integrity hashes of the scripts served
+// by the application, so they can be looked up by embedding sites.
+func WithIntegrity(assets []public.AssetIntegrity) Config {
+	return func(r *router) {
+		r.integrity = assets
+	}
+}
+
 // WithMailer attaches a mailer for sending transactional email
 func WithMailer(m mailer.Mailer) Config {
 	return func(r *router) {
@@ -171,42 +435,172 @@ func WithMailer(m mailer.Mailer) Config {
 	}
 }
 
-func WithOIDC(oidc *oidc.Configuration) Config {
+// WithStyleStore sets the store used for reading and writing custom styles
+// of accounts. It defaults to storing styles in the database.
+func WithStyleStore(s stylestore.Store) Config {
+	return func(r *router) {
+		r.styles = s
+	}
+}
+
+// WithCache sets a cache that is shared between all instances of the
+// application. By default, each instance uses its own in-memory cache.
+func WithCache(c cache.Cache) Config {
+	return func(r *router) {
+		r.cache = c
+	}
+}
+
+// WithRateLimitBackend sets a backend for recording rate limits that is
+// shared between all instances of the application. By default, each instance
+// keeps rate limits in memory.
+func WithRateLimitBackend(b ratelimiter.Backend) Config {
+	return func(r *router) {
+		r.limitBackend = b
+	}
+}
+
+// WithMetrics sets the registry used for collecting metrics. In case it is
+// given, metrics are exposed at /metricsz.
+func WithMetrics(m *metrics.Registry) Config {
+	return func(r *router) {
+		r.metrics = m
+	}
+}
+
+// WithLiveFeed sets the broker used for streaming newly ingested events to
+// dashboards. In case it is given, events are streamed at /api/events/live.
+func WithLiveFeed(b *livefeed.Broker) Config {
 	return func(r *router) {
-		r.oidc = oidc
+		r.liveFeed = b
+	}
+}
+
+// WithDemoSeeder sets the routine used for generating usage data for the
+// configured demo account.
+func WithDemoSeeder(seed func() error) Config {
+	return func(r *router) {
+		r.demoSeeder = seed
+	}
+}
+
+// WithScheduler exposes the jobs of the given scheduler in the admin API.
+func WithScheduler(s *scheduler.Scheduler) Config {
+	return func(r *router) {
+		r.scheduler = s
+	}
+}
+
+// WithBreachedPasswords rejects passwords contained in the given filter
+// when account users choose a new password.
+func WithBreachedPasswords(b *keys.BloomFilter) Config {
+	return func(r *router) {
+		r.breaches = b
+	}
+}
+
+// WithOIDC registers an OpenID Connect provider under the given name. It can
+// be passed multiple times for offering users a choice of identity providers.
+func WithOIDC(name string, c *oidc.Configuration) Config {
+	return func(r *router) {
+		if r.oidc == nil {
+			r.oidc = map[string]*oidc.Configuration{}
+		}
+		r.oidc[name] = c
 	}
 }
 
+// WithSAML enables login using the given SAML service provider. It can be
+// used alongside OpenID Connect providers.
+func WithSAML(sp *saml.ServiceProvider) Config {
+	return func(r *router) {
+		r.saml = sp
+	}
+}
+
+// WithWebAuthn enables registering passkeys and logging in using them.
+func WithWebAuthn(w *webauthn.WebAuthn) Config {
+	return func(r *router) {
+		r.webauthn = w
+	}
+}
+
+// WithOIDCIssuer registers an OpenID Connect provider under the given name
+// that is discovered using the given issuer when the router is warmed up.
+func WithOIDCIssuer(name, issuer string) Config {
+	return func(r *router) {
+		if r.oidcIssuers == nil {
+			r.oidcIssuers = map[string]string{}
+		}
+		r.oidcIssuers[name] = issuer
+	}
+}
+
+// Router is the application's http.Handler. Warmup is expected to be called
+// before the router starts accepting traffic.
+type Router interface {
+	http.Handler
+	Warmup(ctx context.Context) error
+}
+
+type warmableHandler struct {
+	http.Handler
+	rt *router
+}
+
+func (w *warmableHandler) Warmup(ctx context.Context) error {
+	return w.rt.Warmup(ctx)
+}
+
 // New creates a new application router that reads and writes data
 // to the given database implementation. In the context of the application
 // this expects to be the only top level router in charge of handling all
 // incoming HTTP requests.
-func New(opts ...Config) http.Handler {
-	rt := router{}
+func New(opts ...Config) Router {
+	rt := &router{}
 	for _, opt := range opts {
-		opt(&rt)
+		opt(rt)
 	}
 
 	rt.sanitizer = bluemonday.StrictPolicy()
-	rt.cookieSigner = securecookie.New(rt.config.Secret.Bytes(), nil)
+	rt.cookieSigner = securecookie.New(rt.getConfig().Secret.Bytes(), nil)
+	rt.breaker = newCircuitBreaker(
+		rt.getConfig().Database.CircuitBreakerThreshold,
+		rt.getConfig().Database.CircuitBreakerCooldown,
+	)
 
 	optin := optinMiddleware(optinKey, optinValue)
 	userCookie := userCookieMiddleware(cookieKey, contextKeyCookie)
 	accountAuth := rt.accountUserMiddleware(authKey, contextKeyAuth)
+	statsAuth := rt.apiTokenMiddleware(persistence.APITokenScopeReadStats, contextKeyAuth, accountAuth)
+	manageAuth := rt.apiTokenMiddleware(persistence.APITokenScopeManageAccount, contextKeyAuth, accountAuth)
+	adminAuth := rt.adminMiddleware(contextKeyAuth)
+	shareLink := rt.shareLinkMiddleware(contextKeyShareLink)
 	noStore := headerMiddleware(map[string]func() string{
 		"Cache-Control": func() string {
 			return "no-store"
 		},
 	})
 
-	csp := headerMiddleware(map[string]func() string{
-		"Content-Security-Policy": func() string {
-			return defaultCSP
-		},
+	cspConfig := rt.getConfig().CSP
+	basePolicy := parseCSP(defaultCSP).apply(cspConfig.Default)
+	indexPolicy := basePolicy.apply(cspConfig.Index)
+	vaultCSP := cspMiddleware(basePolicy.apply(cspConfig.Vault), cspConfig.Nonce, contextKeyNonce)
+	indexCSP := cspMiddleware(indexPolicy, cspConfig.Nonce, contextKeyNonce)
+	auditoriumCSP := cspMiddleware(basePolicy.apply(cspConfig.Auditorium), cspConfig.Nonce, contextKeyNonce)
+	bots := rt.botMiddleware(contextKeyBot)
+	privacySignals := rt.privacySignalMiddleware(contextKeyAnonymous)
+	bodyLimit := bodyLimitMiddleware(func() config.ByteSize {
+		return rt.getConfig().Server.MaxBodySize
+	})
+	batchBodyLimit := bodyLimitMiddleware(func() config.ByteSize {
+		return rt.getConfig().Server.MaxBatchBodySize
+	})
+	importBodyLimit := bodyLimitMiddleware(func() config.ByteSize {
+		return rt.getConfig().Server.MaxImportSize
 	})
-	etag := etagMiddleware()
 
-	if !rt.config.App.Development {
+	if !rt.getConfig().App.Development {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
@@ -215,32 +609,118 @@ func New(opts ...Config) http.Handler {
 	app.Use(
 		gin.Recovery(),
 		location.Default(),
-		secureContextMiddleware(contextKeySecureContext, rt.config.App.Development),
+		secureContextMiddleware(contextKeySecureContext, rt.getConfig().App.Development),
 	)
+	if rt.metrics != nil {
+		app.Use(metricsMiddleware(rt.metrics))
+		app.GET("/metricsz", noStore, rt.getMetrics)
+	}
 
 	app.Any("/healthz", noStore, rt.getHealth)
+	app.GET("/readyz", noStore, rt.getReady)
 	app.GET("/versionz", noStore, rt.getVersion)
 
-	app.GET("/vault", etag, csp, rt.getVault)
-	if rt.config.App.DemoAccount != "" {
-		app.GET("/intro", etag, csp, rt.getIntro)
+	app.GET("/vault", noStore, vaultCSP, rt.getVault)
+	app.GET("/vault/styles/:accountID", rt.getAccountStyles)
+	if rt.getConfig().App.DemoAccount != "" {
+		app.GET("/intro", noStore, indexCSP, rt.getIntro)
 	}
 
 	{
 		api := app.Group("/api")
 		api.Use(noStore)
-		api.GET("/exchange", rt.getPublicKey)
-		api.POST("/exchange", rt.postUserSecret)
-
-		api.GET("/accounts/:accountID", accountAuth, rt.getAccount)
-		api.DELETE("/accounts/:accountID", accountAuth, rt.deleteAccount)
-		api.PUT("/accounts/:accountID/account-styles", accountAuth, rt.putAccountStyles)
+		api.OPTIONS("/exchange", rt.corsMiddleware)
+		api.GET("/exchange", rt.corsMiddleware, rt.getPublicKey)
+		api.GET("/integrity", rt.getIntegrity)
+		api.POST("/exchange", rt.corsMiddleware, bodyLimit, privacySignals, bots, rt.postUserSecret)
+
+		api.GET("/accounts/:accountID", statsAuth, rt.getAccount)
+		api.PUT("/accounts/:accountID", manageAuth, rt.putAccount)
+		api.DELETE("/accounts/:accountID", manageAuth, rt.deleteAccount)
+		api.POST("/accounts/:accountID/restore", accountAuth, rt.postRestoreAccount)
+		api.POST("/accounts/:accountID/rotate-keys", accountAuth, rt.postRotateKeys)
+		api.PUT("/accounts/:accountID/account-styles", manageAuth, rt.putAccountStyles)
+		api.GET("/accounts/:accountID/theme", manageAuth, rt.getAccountTheme)
+		api.PUT("/accounts/:accountID/theme", manageAuth, rt.putAccountTheme)
+		api.PUT("/accounts/:accountID/theme/logo", manageAuth, rt.putAccountThemeLogo)
+		api.DELETE("/accounts/:accountID/theme/logo", manageAuth, rt.deleteAccountThemeLogo)
+		api.POST("/accounts/:accountID/theme/preview", manageAuth, rt.postAccountThemePreview)
+		api.PUT("/accounts/:accountID/event-types", manageAuth, rt.putAccountEventTypes)
+		api.GET("/accounts/:accountID/summary", statsAuth, rt.getAccountSummary)
+		if rt.getConfig().Aggregates.Enabled {
+			api.GET("/accounts/:accountID/aggregates", statsAuth, rt.getAggregates)
+		}
+		if rt.getConfig().Pings.Enabled {
+			api.GET("/accounts/:accountID/pings", statsAuth, rt.getPings)
+		}
+		api.GET("/accounts/:accountID/export", accountAuth, rt.getAccountExport)
+		api.POST("/accounts/:accountID/import", manageAuth, importBodyLimit, rt.postAccountImport)
+		api.GET("/accounts/:accountID/audit", manageAuth, rt.getAuditLog)
+		api.POST("/accounts/:accountID/share-links", manageAuth, rt.postShareLink)
+		api.DELETE("/accounts/:accountID/share-links/:linkID", manageAuth, rt.deleteShareLink)
+		api.GET("/accounts/:accountID/webhooks", manageAuth, rt.getWebhooks)
+		api.POST("/accounts/:accountID/webhooks", manageAuth, rt.postWebhook)
+		api.DELETE("/accounts/:accountID/webhooks/:webhookID", manageAuth, rt.deleteWebhook)
+		api.GET("/accounts/:accountID/webhooks/:webhookID/deliveries", manageAuth, rt.getWebhookDeliveries)
+		api.GET("/accounts/:accountID/domains", manageAuth, rt.getDomains)
+		api.POST("/accounts/:accountID/domains", manageAuth, rt.postDomain)
+		api.POST("/accounts/:accountID/domains/:domainID/verify", manageAuth, rt.postDomainVerification)
+		api.DELETE("/accounts/:accountID/domains/:domainID", manageAuth, rt.deleteDomain)
+		api.GET("/accounts/:accountID/users", manageAuth, rt.getAccountUsers)
+		api.PUT("/accounts/:accountID/users/:accountUserID", manageAuth, rt.putAccountUser)
+		api.POST("/accounts/:accountID/users/:accountUserID/unlock", manageAuth, rt.postUnlockAccountUser)
+		// removing a user requires the password for rotating the account's keys
+		api.DELETE("/accounts/:accountID/users/:accountUserID", accountAuth, rt.deleteAccountUser)
 		api.POST("/accounts", accountAuth, rt.postAccount)
 
-		api.POST("/purge", userCookie, rt.purgeEvents)
+		api.POST("/graphql", accountAuth, rt.postGraphQL)
+
+		api.GET("/anomalies", statsAuth, rt.getAnomalies)
+		// calendar applications cannot send headers when subscribing to feeds
+		api.GET("/anomalies.ics", queryTokenMiddleware("token"), statsAuth, rt.getAnomaliesICS)
+
+		// api tokens can only be managed using an interactive login
+		api.GET("/tokens", accountAuth, rt.getAPITokens)
+		api.POST("/tokens", accountAuth, rt.postAPIToken)
+		api.DELETE("/tokens/:tokenID", accountAuth, rt.deleteAPIToken)
+
+		api.POST("/purge", bodyLimit, userCookie, rt.purgeEvents)
+		api.GET("/my-data", userCookie, rt.getUserData)
+		api.GET("/consent", optin, userCookie, rt.getConsent)
+
+		// share links grant read only access to a single account, so
+		// no other routes must be added to this group
+		api.GET("/shared/summary", shareLink, rt.getSharedSummary)
+		api.GET("/shared/account", shareLink, rt.getSharedAccount)
+
+		{
+			// instance operators can use these routes without being a
+			// member of the accounts they manage
+			admin := api.Group("/admin", adminAuth, requireSuperAdmin(contextKeyAuth))
+			admin.GET("/accounts", rt.getAdminAccounts)
+			admin.POST("/accounts/:accountID/disable", rt.postAdminDisableAccount)
+			admin.POST("/accounts/:accountID/enable", rt.postAdminEnableAccount)
+			admin.GET("/accounts/:accountID/features", rt.getAdminAccountFeatures)
+			admin.PATCH("/accounts/:accountID/features", rt.patchAdminAccountFeatures)
+			admin.GET("/usage", rt.getAdminUsage)
+			admin.POST("/provision", rt.postAdminProvision)
+			admin.POST("/import", importBodyLimit, rt.postAdminImportForeign)
+			admin.GET("/jobs", rt.getAdminJobs)
+			admin.POST("/jobs/:job", rt.postAdminJob)
+			admin.GET("/emails/:email/preview", rt.getAdminEmailPreview)
+			admin.GET("/mails", rt.getFailedMails)
+			admin.POST("/mails/:mailID/requeue", rt.postRequeueMail)
+			admin.GET("/webhooks", rt.getWebhooks)
+			admin.POST("/webhooks", rt.postWebhook)
+			admin.DELETE("/webhooks/:webhookID", rt.deleteWebhook)
+			admin.GET("/webhooks/:webhookID/deliveries", rt.getWebhookDeliveries)
+			admin.POST("/reset-demo", rt.postResetDemo)
+		}
 
 		api.GET("/login", accountAuth, rt.getLogin)
-		if rt.oidc == nil {
+		api.GET("/sessions", accountAuth, rt.getSessions)
+		api.DELETE("/sessions/:sessionID", accountAuth, rt.deleteSession)
+		if len(rt.oidc) == 0 && len(rt.oidcIssuers) == 0 && rt.saml == nil {
 			api.POST("/login", rt.postLogin)
 			api.POST("/logout", rt.postLogout)
 
@@ -251,46 +731,78 @@ func New(opts ...Config) http.Handler {
 			api.POST("/share-account/:accountID", accountAuth, rt.postShareAccount)
 			api.POST("/share-account", accountAuth, rt.postShareAccount)
 			api.POST("/join", rt.postJoin)
+			api.POST("/invitations/:invitationID/resend", accountAuth, rt.postResendInvitation)
+			api.DELETE("/invitations/:invitationID", accountAuth, rt.deleteInvitation)
+			api.POST("/2fa/setup", accountAuth, rt.postTwoFactorSetup)
+			api.POST("/2fa/verify", accountAuth, rt.postTwoFactorVerify)
+			if rt.webauthn != nil {
+				api.GET("/webauthn/credentials", accountAuth, rt.getWebAuthnCredentials)
+				api.POST("/webauthn/register/begin", accountAuth, rt.postWebAuthnRegisterBegin)
+				api.POST("/webauthn/register/finish", accountAuth, rt.postWebAuthnRegisterFinish)
+				api.POST("/webauthn/login/begin", rt.postWebAuthnLoginBegin)
+				api.POST("/webauthn/login/finish", rt.postWebAuthnLoginFinish)
+			}
 		} else {
-			api.POST("/login", rt.oauthLogin)
-			api.POST("/login/callback", rt.oauthCallback)
+			if len(rt.oidc) != 0 || len(rt.oidcIssuers) != 0 {
+				api.GET("/login/providers", rt.oauthProviders)
+				api.POST("/login", rt.oauthLogin)
+				api.POST("/login/callback", rt.oauthCallback)
+			}
+			if rt.saml != nil {
+				api.GET("/login/saml/metadata", rt.samlMetadata)
+				api.POST("/login/saml", rt.samlLogin)
+				api.POST("/login/saml/acs", rt.samlACS)
+			}
 			api.POST("/logout", rt.oauthLogout)
 		}
 		api.GET("/setup", rt.getSetup)
 		api.POST("/setup", rt.postSetup)
 
 		api.GET("/events", userCookie, rt.getEvents)
-		api.POST("/events", optin, userCookie, rt.postEvents)
+		api.OPTIONS("/events", rt.corsMiddleware)
+		api.POST("/events", rt.corsMiddleware, bodyLimit, rt.writeKeyMiddleware, optin, privacySignals, bots, userCookie, rt.circuitBreakerMiddleware, rt.postEvents)
+		if rt.getConfig().Pings.Enabled {
+			// pings are accepted without consent and without a user cookie
+			api.OPTIONS("/pings", rt.corsMiddleware)
+			api.POST("/pings", rt.corsMiddleware, bodyLimit, privacySignals, bots, rt.circuitBreakerMiddleware, rt.postPing)
+		}
+		api.OPTIONS("/events/batch", rt.corsMiddleware)
+		api.POST("/events/batch", rt.corsMiddleware, batchBodyLimit, rt.writeKeyMiddleware, optin, privacySignals, bots, userCookie, rt.circuitBreakerMiddleware, rt.postEventsBatch)
+		if rt.getConfig().App.ReplayWindow > 0 {
+			api.OPTIONS("/events/replay", rt.corsMiddleware)
+			api.GET("/events/replay", rt.corsMiddleware, optin, userCookie, rt.getReplayKey)
+			api.POST("/events/replay", rt.corsMiddleware, batchBodyLimit, rt.writeKeyMiddleware, optin, privacySignals, bots, userCookie, rt.circuitBreakerMiddleware, rt.postReplayEvents)
+		}
+		if rt.liveFeed != nil {
+			api.GET("/events/live", accountAuth, rt.getLiveEvents)
+		}
 	}
 
 	root := gin.New()
 	root.SetHTMLTemplate(rt.template)
-	root.GET("/*any", etag, csp, rt.getIndex)
+	// all other pages are rendered by the auditorium
+	root.GET("/*any", noStore, auditoriumCSP, rt.getIndex)
 
-	app.Use(staticMiddleware(http.FileServer(rt.fs), root))
+	app.Use(staticMiddleware(etagFileServer(rt.fs), root, indexPolicy.String(), assetFingerprints(rt.fs)))
 
-	if rt.config.Server.ReverseProxy {
-		return app
+	handler := stripPathPrefixes(rt.getConfig().Server.PathPrefixes, app)
+	if rt.getConfig().Server.ReverseProxy {
+		return &warmableHandler{rt.honeypot(handler), rt}
 	}
 
-	withGzip := gziphandler.GzipHandler(app)
-	// HTTP logging is only added when the reverse proxy setting is not
-	// enabled
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		metrics := httpsnoop.CaptureMetrics(withGzip, w, r)
-		fmt.Printf(
-			"%s %s %s [%s] \"%s %s %s\" %d %s\n",
-			"-",
-			"-",
-			"-",
-			time.Now().Format("02/Jan/2006:15:04:05 -0700"),
-			r.Method,
-			r.RequestURI,
-			r.Proto,
-			anonymizeStatusCode(metrics.Code),
-			"-",
-		)
+	compressed := gziphandler.GzipHandler(handler)
+	withGzip := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// event streams need to be flushed after each event which is not
+		// possible in case the response is buffered for compression
+		if r.Header.Get("Accept") == "text/event-stream" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		compressed.ServeHTTP(w, r)
 	})
+	// HTTP logging is only added when the reverse proxy setting is not
+	// enabled. Requests caught by the honeypot are never logged.
+	return &warmableHandler{rt.honeypot(rt.accessLog(withGzip)), rt}
 }
 
 // anonymizeStatusCode turns all non-error status codes into http.StatusOK
@@ -7,10 +7,13 @@ import (
 	"html/template"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
 	"github.com/offen/offen/server/config"
 	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
 )
 
 type mockDatabase struct {
@@ -29,3 +32,125 @@ func TestNew(t *testing.T) {
 		WithTemplate(template.New("a test")),
 	)
 }
+
+func TestRouter_getLimiter(t *testing.T) {
+	t.Run("local", func(t *testing.T) {
+		rt := &router{config: &config.Config{}}
+		if _, ok := rt.getLimiter().(*ratelimiter.Limiter); !ok {
+			t.Errorf("Unexpected limiter %T", rt.limiter)
+		}
+		if rt.cache != nil {
+			t.Error("Expected limiter not to use the default cache")
+		}
+	})
+	t.Run("shared", func(t *testing.T) {
+		shared := ratelimiter.NewMemoryBackend(time.Minute)
+		rt := &router{config: &config.Config{}}
+		WithRateLimitBackend(shared)(rt)
+		<-rt.getLimiter().LinearThrottle(time.Millisecond*50, "identifier")
+
+		other := &router{config: &config.Config{}}
+		WithRateLimitBackend(shared)(other)
+		if result := <-other.getLimiter().LinearThrottle(time.Millisecond*50, "identifier"); result.Delay == 0 {
+			t.Error("Expected limits to be shared between routers using the same backend")
+		}
+	})
+	t.Run("reverse proxy", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.Server.ReverseProxy = true
+		rt := &router{config: cfg}
+		if _, ok := rt.getLimiter().(*ratelimiter.NoopRatelimiter); !ok {
+			t.Errorf("Unexpected limiter %T", rt.limiter)
+		}
+	})
+}
+
+func TestRouter_decodeSigned(t *testing.T) {
+	cfg := &config.Config{Secret: config.Bytes("current")}
+	cfg.PreviousSecrets = []config.Bytes{config.Bytes("other"), config.Bytes("previous")}
+	rt := &router{config: cfg}
+	signer := securecookie.New(cfg.Secret.Bytes(), nil)
+
+	tests := []struct {
+		name        string
+		secret      string
+		expectError bool
+	}{
+		{"current secret", "current", false},
+		{"previous secret", "previous", false},
+		{"unknown secret", "unknown", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := securecookie.New([]byte(test.secret), nil).Encode("key", "value")
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			var result string
+			err = rt.decodeSigned(signer, time.Hour, "key", value, &result)
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if !test.expectError && result != "value" {
+				t.Errorf("Unexpected result %v", result)
+			}
+		})
+	}
+}
+
+type mockCookiePolicyDatabase struct {
+	persistence.Service
+	retention string
+	policy    *persistence.CookiePolicy
+}
+
+func (m *mockCookiePolicyDatabase) GetAccount(string, bool, bool, string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{RetentionPeriod: m.retention, CookiePolicy: m.policy}, nil
+}
+
+func TestRouter_userCookieLifetime(t *testing.T) {
+	tests := []struct {
+		name             string
+		db               *mockCookiePolicyDatabase
+		configured       time.Duration
+		expectedLifetime time.Duration
+	}{
+		{
+			"default",
+			&mockCookiePolicyDatabase{},
+			0,
+			config.EventRetention,
+		},
+		{
+			"configured",
+			&mockCookiePolicyDatabase{},
+			time.Hour * 24,
+			time.Hour * 24,
+		},
+		{
+			"account policy",
+			&mockCookiePolicyDatabase{policy: &persistence.CookiePolicy{UserCookieLifetime: "48h"}},
+			time.Hour * 24,
+			time.Hour * 48,
+		},
+		{
+			"capped by retention",
+			&mockCookiePolicyDatabase{
+				retention: "7days",
+				policy:    &persistence.CookiePolicy{UserCookieLifetime: "720h"},
+			},
+			0,
+			time.Hour * 24 * 7,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.UserCookieLifetime = test.configured
+			rt := &router{config: cfg, db: test.db}
+			if lifetime := rt.userCookieLifetime("account-a"); lifetime != test.expectedLifetime {
+				t.Errorf("Expected %v, got %v", test.expectedLifetime, lifetime)
+			}
+		})
+	}
+}
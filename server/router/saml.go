@@ -0,0 +1,117 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+)
+
+func samlRequestCacheKey(requestID string) string {
+	return fmt.Sprintf("saml-request-%s", requestID)
+}
+
+func (rt *router) samlMetadata(c *gin.Context) {
+	metadata, err := xml.MarshalIndent(rt.saml.Metadata(), "", "  ")
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error generating service provider metadata: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+func (rt *router) samlLogin(c *gin.Context) {
+	request, err := rt.saml.MakeAuthenticationRequest(
+		rt.saml.GetSSOBindingLocation(saml.HTTPRedirectBinding),
+		saml.HTTPRedirectBinding,
+		saml.HTTPPostBinding,
+	)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error creating authentication request: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	// the request id is passed as relay state so the response can be matched
+	// to the request it answers when the identity provider posts it
+	authenticationURL, err := request.Redirect(request.ID, rt.saml)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error creating authentication url: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	rt.getCache().Set(samlRequestCacheKey(request.ID), "true", oauthStateTTL)
+
+	c.Redirect(http.StatusTemporaryRedirect, authenticationURL.String())
+}
+
+func (rt *router) samlACS(c *gin.Context) {
+	requestID := c.Request.FormValue("RelayState")
+	cache, cacheKey := rt.getCache(), samlRequestCacheKey(requestID)
+	if _, ok := cache.Get(cacheKey); !ok || requestID == "" {
+		newJSONError(
+			errors.New("router: authentication failed: unknown or expired request"),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return
+	}
+	// each request can only be answered once
+	cache.Delete(cacheKey)
+
+	assertion, err := rt.saml.ParseResponse(c.Request, []string{requestID})
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: authentication failed: %w", err),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return
+	}
+
+	email := samlAttribute(assertion, rt.getConfig().SAML.EmailAttribute)
+	if len(email) == 0 && assertion.Subject != nil && assertion.Subject.NameID != nil {
+		email = []string{assertion.Subject.NameID.Value}
+	}
+	if len(email) == 0 || email[0] == "" {
+		newJSONError(
+			errors.New("router: authentication failed: assertion did not contain an email address"),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return
+	}
+
+	if _, ok := rt.loginSSO(c, email[0], samlAttribute(assertion, rt.getConfig().SAML.GroupsAttribute)); !ok {
+		return
+	}
+	// the response is posted by the browser on behalf of the identity provider,
+	// so the user is sent to the auditorium instead of receiving JSON
+	c.Redirect(http.StatusSeeOther, "/auditorium/")
+}
+
+// samlAttribute returns all values of the attribute with the given name or
+// friendly name.
+func samlAttribute(assertion *saml.Assertion, name string) []string {
+	var values []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if attribute.Name != name && attribute.FriendlyName != name {
+				continue
+			}
+			for _, value := range attribute.Values {
+				values = append(values, value.Value)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+)
+
+func TestRouter_samlACS(t *testing.T) {
+	t.Run("unknown request", func(t *testing.T) {
+		rt := router{saml: &saml.ServiceProvider{}, config: &config.Config{}}
+		m := gin.New()
+		m.POST("/", rt.samlACS)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("RelayState=abc&SAMLResponse=xyz"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		m.ServeHTTP(w, r)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+	})
+	t.Run("bad response", func(t *testing.T) {
+		rt := router{saml: &saml.ServiceProvider{}, config: &config.Config{}}
+		rt.getCache().Set(samlRequestCacheKey("abc"), "true", oauthStateTTL)
+		m := gin.New()
+		m.POST("/", rt.samlACS)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("RelayState=abc&SAMLResponse=xyz"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		m.ServeHTTP(w, r)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+		if _, ok := rt.getCache().Get(samlRequestCacheKey("abc")); ok {
+			t.Error("Expected request to be discarded after use")
+		}
+	})
+}
+
+func TestSAMLAttribute(t *testing.T) {
+	assertion := &saml.Assertion{
+		AttributeStatements: []saml.AttributeStatement{
+			{
+				Attributes: []saml.Attribute{
+					{
+						Name:   "urn:oid:0.9.2342.19200300.100.1.3",
+						Values: []saml.AttributeValue{{Value: "develop@offen.dev"}},
+					},
+					{
+						FriendlyName: "groups",
+						Values:       []saml.AttributeValue{{Value: "analytics"}, {Value: "staff"}},
+					},
+				},
+			},
+		},
+	}
+	if groups := samlAttribute(assertion, "groups"); !reflect.DeepEqual(groups, []string{"analytics", "staff"}) {
+		t.Errorf("Unexpected groups %v", groups)
+	}
+	if email := samlAttribute(assertion, "urn:oid:0.9.2342.19200300.100.1.3"); !reflect.DeepEqual(email, []string{"develop@offen.dev"}) {
+		t.Errorf("Unexpected email %v", email)
+	}
+	if missing := samlAttribute(assertion, "roles"); missing != nil {
+		t.Errorf("Unexpected values %v", missing)
+	}
+}
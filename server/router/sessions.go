@@ -0,0 +1,114 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+const sessionLifetime = time.Hour * 24
+
+// createSession creates a new server side session for the given account user
+// and returns an auth cookie referencing it.
+func (rt *router) createSession(accountUserID string, secure bool) (*http.Cookie, error) {
+	session, err := rt.db.CreateSession(accountUserID, sessionLifetime)
+	if err != nil {
+		return nil, err
+	}
+	return rt.authCookie(session.SessionID, secure)
+}
+
+// revokeCurrentSession revokes the session referenced by the auth cookie of
+// the given request, if any. As the cookie is removed from the client
+// anyways, errors are only logged.
+func (rt *router) revokeCurrentSession(c *gin.Context) {
+	authCookie, err := c.Request.Cookie(authKey)
+	if err != nil {
+		return
+	}
+	var sessionID string
+	if err := rt.decodeSigned(rt.cookieSigner, sessionLifetime, authKey, authCookie.Value, &sessionID); err != nil {
+		return
+	}
+	session, err := rt.db.LookupSession(sessionID)
+	if err != nil {
+		return
+	}
+	if err := rt.db.RevokeSession(session.AccountUserID, session.SessionID); err != nil {
+		rt.logError(err, "error revoking session on logout")
+	}
+}
+
+func (rt *router) getSessions(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	sessions, err := rt.db.ListSessions(accountUser.AccountUserID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error listing sessions: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	current := c.GetString(contextKeySession)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionID == current
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (rt *router) deleteSession(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("deleteSession-%s", accountUser.AccountUserID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	sessionID := c.Param("sessionID")
+	if err := rt.db.RevokeSession(accountUser.AccountUserID, sessionID); err != nil {
+		var errUnknown persistence.ErrUnknownSession
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: session %s not found", sessionID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error revoking session: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	if sessionID == c.GetString(contextKeySession) {
+		authCookie, _ := rt.authCookie("", c.GetBool(contextKeySecureContext))
+		http.SetCookie(c.Writer, authCookie)
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,159 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockSessionDatabase struct {
+	persistence.Service
+	sessions  []persistence.SessionResult
+	revokeErr error
+	revoked   []string
+}
+
+func (m *mockSessionDatabase) ListSessions(string) ([]persistence.SessionResult, error) {
+	return m.sessions, nil
+}
+
+func (m *mockSessionDatabase) LookupSession(sessionID string) (persistence.SessionResult, error) {
+	for _, session := range m.sessions {
+		if session.SessionID == sessionID {
+			return session, nil
+		}
+	}
+	return persistence.SessionResult{}, persistence.ErrUnknownSession("unknown session")
+}
+
+func (m *mockSessionDatabase) RevokeSession(accountUserID, sessionID string) error {
+	m.revoked = append(m.revoked, sessionID)
+	return m.revokeErr
+}
+
+func TestRouter_getSessions(t *testing.T) {
+	rt := router{
+		config: &config.Config{},
+		db: &mockSessionDatabase{
+			sessions: []persistence.SessionResult{
+				{SessionID: "session-a"},
+				{SessionID: "session-b"},
+			},
+		},
+	}
+	m := gin.New()
+	m.GET("/", func(c *gin.Context) {
+		c.Set(contextKeyAuth, persistence.LoginResult{AccountUserID: "user-a"})
+		c.Set(contextKeySession, "session-b")
+	}, rt.getSessions)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status code %v", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"sessionId":"session-a","created":"0001-01-01T00:00:00Z","expires":"0001-01-01T00:00:00Z","current":false`) {
+		t.Errorf("Unexpected body %s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"sessionId":"session-b","created":"0001-01-01T00:00:00Z","expires":"0001-01-01T00:00:00Z","current":true`) {
+		t.Errorf("Unexpected body %s", w.Body.String())
+	}
+}
+
+func TestRouter_deleteSession(t *testing.T) {
+	tests := []struct {
+		name               string
+		sessionID          string
+		revokeErr          error
+		expectedStatusCode int
+		expectCookie       bool
+	}{
+		{
+			"unknown session",
+			"session-z",
+			persistence.ErrUnknownSession("unknown session"),
+			http.StatusNotFound,
+			false,
+		},
+		{
+			"database error",
+			"session-a",
+			errors.New("did not work"),
+			http.StatusInternalServerError,
+			false,
+		},
+		{
+			"other session",
+			"session-a",
+			nil,
+			http.StatusNoContent,
+			false,
+		},
+		{
+			"current session",
+			"session-b",
+			nil,
+			http.StatusNoContent,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{
+				config: &config.Config{},
+				db:     &mockSessionDatabase{revokeErr: test.revokeErr},
+			}
+			m := gin.New()
+			m.DELETE("/:sessionID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, persistence.LoginResult{AccountUserID: "user-a"})
+				c.Set(contextKeySession, "session-b")
+			}, rt.deleteSession)
+
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/"+test.sessionID, nil))
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if cookies := w.Result().Cookies(); test.expectCookie != (len(cookies) == 1) {
+				t.Errorf("Unexpected cookies %v", cookies)
+			}
+		})
+	}
+}
+
+func TestRouter_revokeCurrentSession(t *testing.T) {
+	cookieSigner := securecookie.New([]byte("abc"), nil)
+	db := &mockSessionDatabase{
+		sessions: []persistence.SessionResult{
+			{SessionID: "session-a", AccountUserID: "user-a", Expires: time.Now().Add(time.Hour)},
+		},
+	}
+	rt := router{
+		config:       &config.Config{},
+		db:           db,
+		cookieSigner: cookieSigner,
+	}
+	m := gin.New()
+	m.POST("/", rt.postLogout)
+
+	value, _ := cookieSigner.Encode(authKey, "session-a")
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.AddCookie(&http.Cookie{Name: authKey, Value: value})
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, r)
+
+	if len(db.revoked) != 1 || db.revoked[0] != "session-a" {
+		t.Errorf("Expected session to be revoked, got %v", db.revoked)
+	}
+}
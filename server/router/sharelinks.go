@@ -0,0 +1,306 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
+	"github.com/offen/offen/server/persistence"
+)
+
+const (
+	shareLinkKey             = "share-link"
+	shareLinkHeader          = "X-Offen-Share-Link"
+	defaultShareLinkLifetime = time.Hour
+)
+
+// shareLinkToken is the payload that is signed and handed out to holders
+// of a share link. It is validated without hitting the database first, but
+// revocation requires the link to also be present in the database.
+type shareLinkToken struct {
+	LinkID    string
+	AccountID string
+	Expires   int64
+}
+
+// getShareLinkSigner returns the signer used for share link tokens. It is
+// separate from the cookie signer as its max age differs from the one used
+// for login cookies. It is derived from the current configuration on each
+// call, so changes to the max lifetime apply when reloading.
+func (rt *router) getShareLinkSigner() *securecookie.SecureCookie {
+	return securecookie.New(rt.getConfig().Secret.Bytes(), nil).
+		MaxAge(int(rt.maxShareLinkLifetime().Seconds()))
+}
+
+func (rt *router) maxShareLinkLifetime() time.Duration {
+	if rt.getConfig().App.ShareLinkMaxLifetime > 0 {
+		return rt.getConfig().App.ShareLinkMaxLifetime
+	}
+	return defaultShareLinkLifetime
+}
+
+type createShareLinkRequest struct {
+	ExpiresIn string `json:"expiresIn"`
+}
+
+type createShareLinkResponse struct {
+	persistence.ShareLinkResult
+	Token string `json:"token"`
+}
+
+func (rt *router) postShareLink(c *gin.Context) {
+	accountID := c.Param("accountID")
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("postShareLink-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if !accountUser.HasRole(accountID, persistence.AccountUserRoleAdmin) {
+		newJSONError(
+			fmt.Errorf("router: account user is not allowed to share account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	var req createShareLinkRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&req); err != nil {
+			newJSONError(
+				fmt.Errorf("router: error decoding request payload: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+
+	lifetime := defaultShareLinkLifetime
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			newJSONError(
+				fmt.Errorf("router: invalid lifetime %s for share link", req.ExpiresIn),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+		lifetime = d
+	}
+	if limit := rt.maxShareLinkLifetime(); lifetime > limit {
+		newJSONError(
+			fmt.Errorf("router: share links cannot be valid for longer than %v", limit),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	link, err := rt.db.CreateShareLink(accountID, accountUser.AccountUserID, time.Now().Add(lifetime))
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error creating share link: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	token, err := rt.getShareLinkSigner().Encode(shareLinkKey, shareLinkToken{
+		LinkID:    link.LinkID,
+		AccountID: link.AccountID,
+		Expires:   link.Expires.Unix(),
+	})
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error signing share link: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusCreated, createShareLinkResponse{link, token})
+}
+
+func (rt *router) deleteShareLink(c *gin.Context) {
+	accountID := c.Param("accountID")
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("deleteShareLink-%s", accountID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+
+	if !accountUser.HasRole(accountID, persistence.AccountUserRoleAdmin) {
+		newJSONError(
+			fmt.Errorf("router: account user is not allowed to revoke share links for account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.db.RevokeShareLink(accountID, c.Param("linkID"), accountUser.AccountUserID); err != nil {
+		var errUnknown persistence.ErrUnknownShareLink
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: share link %s not found", c.Param("linkID")),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error revoking share link: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// shareLinkMiddleware validates the share link token passed in the request
+// and attaches the share link to the request context. Handlers
+// behind this middleware must only ever read data of that account.
+func (rt *router) shareLinkMiddleware(contextKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value := c.Query("token")
+		if value == "" {
+			value = strings.TrimSpace(c.GetHeader(shareLinkHeader))
+		}
+		if value == "" {
+			newJSONError(
+				errors.New("router: missing share link token"),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+
+		var token shareLinkToken
+		if err := rt.decodeSigned(rt.getShareLinkSigner(), rt.maxShareLinkLifetime(), shareLinkKey, value, &token); err != nil {
+			newJSONError(
+				fmt.Errorf("router: error decoding share link token: %v", err),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+		if time.Now().Unix() > token.Expires {
+			newJSONError(
+				errors.New("router: share link has expired"),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+
+		// the lookup ensures revoked links cannot be used anymore, even
+		// though their signature is still valid
+		link, err := rt.db.LookupShareLink(token.LinkID)
+		if err != nil {
+			var errUnknown persistence.ErrUnknownShareLink
+			if errors.As(err, &errUnknown) {
+				newJSONError(
+					errors.New("router: share link is not valid anymore"),
+					http.StatusUnauthorized,
+				).Pipe(c)
+				return
+			}
+			newJSONError(
+				fmt.Errorf("router: error looking up share link: %w", err),
+				http.StatusInternalServerError,
+			).Pipe(c)
+			return
+		}
+		if link.AccountID != token.AccountID {
+			newJSONError(
+				errors.New("router: share link does not match account"),
+				http.StatusUnauthorized,
+			).Pipe(c)
+			return
+		}
+		c.Set(contextKey, link)
+		c.Next()
+	}
+}
+
+func (rt *router) getSharedSummary(c *gin.Context) {
+	link, ok := c.Value(contextKeyShareLink).(persistence.ShareLinkResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find share link in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("getSharedSummary-%s", link.LinkID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	result, err := rt.db.GetAccountSummary(link.AccountID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up account summary: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (rt *router) getSharedAccount(c *gin.Context) {
+	link, ok := c.Value(contextKeyShareLink).(persistence.ShareLinkResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find share link in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return
+	}
+	if l := <-rt.getLimiter().LinearThrottle(time.Second, fmt.Sprintf("getSharedAccount-%s", link.LinkID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	result, err := rt.db.GetAccount(link.AccountID, false, true, c.Query("since"))
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up account: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	// holders of a share link must never be able to obtain key material,
+	// even if it is encrypted
+	result.EncryptedPrivateKey = ""
+	result.PreviousKeys = nil
+	result.Secrets = nil
+	result.WriteKeys = nil
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,241 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockShareLinkDatabase struct {
+	persistence.Service
+	lookupResult  persistence.ShareLinkResult
+	lookupErr     error
+	revokeErr     error
+	accountResult persistence.AccountResult
+	createdWith   time.Time
+}
+
+func (m *mockShareLinkDatabase) CreateShareLink(accountID, accountUserID string, expires time.Time) (persistence.ShareLinkResult, error) {
+	m.createdWith = expires
+	return persistence.ShareLinkResult{LinkID: "link-a", AccountID: accountID, Expires: expires}, nil
+}
+
+func (m *mockShareLinkDatabase) LookupShareLink(string) (persistence.ShareLinkResult, error) {
+	return m.lookupResult, m.lookupErr
+}
+
+func (m *mockShareLinkDatabase) RevokeShareLink(string, string, string) error {
+	return m.revokeErr
+}
+
+func (m *mockShareLinkDatabase) GetAccount(string, bool, bool, string) (persistence.AccountResult, error) {
+	return m.accountResult, nil
+}
+
+func newShareLinkTestConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Secret = config.Bytes("abc123")
+	cfg.App.ShareLinkMaxLifetime = time.Hour * 24
+	return cfg
+}
+
+func TestRouter_postShareLink(t *testing.T) {
+	tests := []struct {
+		name               string
+		body               string
+		login              persistence.LoginResult
+		expectedStatusCode int
+	}{
+		{
+			"no access",
+			"",
+			persistence.LoginResult{AdminLevel: persistence.AccountUserAdminLevelSuperAdmin},
+			http.StatusForbidden,
+		},
+		{
+			"no admin",
+			"",
+			persistence.LoginResult{Accounts: []persistence.LoginAccountResult{{AccountID: "account-a"}}},
+			http.StatusForbidden,
+		},
+		{
+			"lifetime exceeds maximum",
+			`{"expiresIn":"48h"}`,
+			persistence.LoginResult{
+				AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
+				Accounts:   []persistence.LoginAccountResult{{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin}},
+			},
+			http.StatusBadRequest,
+		},
+		{
+			"bad lifetime",
+			`{"expiresIn":"soon"}`,
+			persistence.LoginResult{
+				AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
+				Accounts:   []persistence.LoginAccountResult{{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin}},
+			},
+			http.StatusBadRequest,
+		},
+		{
+			"ok",
+			`{"expiresIn":"2h"}`,
+			persistence.LoginResult{
+				AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
+				Accounts:   []persistence.LoginAccountResult{{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin}},
+			},
+			http.StatusCreated,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: &mockShareLinkDatabase{}, config: newShareLinkTestConfig()}
+			m := gin.New()
+			m.POST("/:accountID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, test.login)
+				c.Next()
+			}, rt.postShareLink)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/account-a", strings.NewReader(test.body))
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_shareLinkMiddleware(t *testing.T) {
+	cfg := newShareLinkTestConfig()
+	signer := (&router{config: cfg}).getShareLinkSigner()
+	validToken, _ := signer.Encode(shareLinkKey, shareLinkToken{
+		LinkID: "link-a", AccountID: "account-a", Expires: time.Now().Add(time.Hour).Unix(),
+	})
+	expiredToken, _ := signer.Encode(shareLinkKey, shareLinkToken{
+		LinkID: "link-a", AccountID: "account-a", Expires: time.Now().Add(-time.Hour).Unix(),
+	})
+
+	tests := []struct {
+		name               string
+		token              string
+		db                 *mockShareLinkDatabase
+		expectedStatusCode int
+	}{
+		{
+			"missing token",
+			"",
+			&mockShareLinkDatabase{},
+			http.StatusUnauthorized,
+		},
+		{
+			"bad signature",
+			"abc",
+			&mockShareLinkDatabase{},
+			http.StatusUnauthorized,
+		},
+		{
+			"expired token",
+			expiredToken,
+			&mockShareLinkDatabase{
+				lookupResult: persistence.ShareLinkResult{LinkID: "link-a", AccountID: "account-a"},
+			},
+			http.StatusUnauthorized,
+		},
+		{
+			"revoked",
+			validToken,
+			&mockShareLinkDatabase{lookupErr: persistence.ErrUnknownShareLink("did not work")},
+			http.StatusUnauthorized,
+		},
+		{
+			"lookup error",
+			validToken,
+			&mockShareLinkDatabase{lookupErr: errors.New("did not work")},
+			http.StatusInternalServerError,
+		},
+		{
+			"account mismatch",
+			validToken,
+			&mockShareLinkDatabase{
+				lookupResult: persistence.ShareLinkResult{LinkID: "link-a", AccountID: "account-b"},
+			},
+			http.StatusUnauthorized,
+		},
+		{
+			"ok",
+			validToken,
+			&mockShareLinkDatabase{
+				lookupResult: persistence.ShareLinkResult{LinkID: "link-a", AccountID: "account-a"},
+				accountResult: persistence.AccountResult{
+					AccountID:           "account-a",
+					EncryptedPrivateKey: "private",
+					Secrets:             &persistence.EncryptedSecretsByID{"user-a": "secret"},
+				},
+			},
+			http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: cfg}
+			m := gin.New()
+			m.GET("/", rt.shareLinkMiddleware(contextKeyShareLink), rt.getSharedAccount)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.token != "" {
+				r.Header.Set(shareLinkHeader, test.token)
+			}
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if strings.Contains(w.Body.String(), "private") || strings.Contains(w.Body.String(), "secret") {
+				t.Errorf("Response leaked key material: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_deleteShareLink(t *testing.T) {
+	login := persistence.LoginResult{
+		AdminLevel: persistence.AccountUserAdminLevelSuperAdmin,
+		Accounts:   []persistence.LoginAccountResult{{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin}},
+	}
+	tests := []struct {
+		name               string
+		db                 *mockShareLinkDatabase
+		expectedStatusCode int
+	}{
+		{"unknown", &mockShareLinkDatabase{revokeErr: persistence.ErrUnknownShareLink("did not work")}, http.StatusNotFound},
+		{"error", &mockShareLinkDatabase{revokeErr: errors.New("did not work")}, http.StatusInternalServerError},
+		{"ok", &mockShareLinkDatabase{}, http.StatusNoContent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: newShareLinkTestConfig()}
+			m := gin.New()
+			m.DELETE("/:accountID/:linkID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, login)
+				c.Next()
+			}, rt.deleteShareLink)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodDelete, "/account-a/link-a", nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"path"
 	"regexp"
 	"strings"
 	"time"
@@ -17,8 +18,8 @@ import (
 )
 
 var (
-	defaultCSP             = "default-src 'self'; style-src 'self' 'unsafe-inline'; script-src 'self' 'unsafe-inline'; img-src 'self' data:"
 	defaultSTS             = "max-age=15768000"
+	immutableCacheControl  = "public, max-age=31536000, immutable"
 	revisionedJSRe         = regexp.MustCompile("-[0-9a-z]{10}\\.js$")
 	webfontRe              = regexp.MustCompile("\\.(woff|woff2|ttf)$")
 	scriptRe               = regexp.MustCompile("script\\.js$")
@@ -39,7 +40,40 @@ func muteRequest(r *http.Request) *http.Request {
 	}))
 }
 
-func staticMiddleware(fileServer, fallback http.Handler) gin.HandlerFunc {
+// assetFingerprints returns a function reporting whether the given location
+// is a fingerprinted asset. File systems that do not know about fingerprints
+// only report assets that have been revisioned on build.
+func assetFingerprints(fs http.FileSystem) func(string) bool {
+	if f, ok := fs.(interface{ Fingerprinted(string) bool }); ok {
+		return f.Fingerprinted
+	}
+	return revisionedJSRe.MatchString
+}
+
+// etagFileServer serves files from the given file system like
+// http.FileServer. Files that carry the ETag of a remote origin are served
+// using it, so conditional requests are answered without sending the file.
+func etagFileServer(fs http.FileSystem) http.Handler {
+	fileServer := http.FileServer(fs)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upath := r.URL.Path
+		if !strings.HasPrefix(upath, "/") {
+			upath = "/" + upath
+		}
+		if f, err := fs.Open(path.Clean(upath)); err == nil {
+			if e, ok := f.(interface{ ETag() string }); ok && e.ETag() != "" {
+				w.Header().Set("ETag", e.ETag())
+			}
+			f.Close()
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// staticMiddleware serves files from the given file server. HTML documents
+// are served using the given Content-Security-Policy. Assets that are
+// reported as fingerprinted are cached indefinitely by clients.
+func staticMiddleware(fileServer, fallback http.Handler, csp string, fingerprinted func(string) bool) gin.HandlerFunc {
 	tryStatic := func(method, url string) (int, string) {
 		r := httptest.NewRequest(method, url, nil)
 		w := httptest.NewRecorder()
@@ -59,21 +93,27 @@ func staticMiddleware(fileServer, fallback http.Handler) gin.HandlerFunc {
 		}
 
 		if strings.HasPrefix(contentType, "text/html") {
-			c.Header("Cache-Control", "no-cache")
-			c.Header("Content-Security-Policy", defaultCSP)
+			c.Header("Cache-Control", "no-store")
+			c.Header("Content-Security-Policy", csp)
 			if secureContext {
 				c.Header("Strict-Transport-Security", defaultSTS)
 			}
 		}
 
 		switch uri := c.Request.URL.Path; {
-		case revisionedJSRe.MatchString(uri), webfontRe.MatchString(uri):
+		case fingerprinted(uri):
+			c.Header("Cache-Control", immutableCacheControl)
+			c.Header("Expires", time.Now().Add(time.Hour*24*365).Format(time.RFC1123))
+		case webfontRe.MatchString(uri):
 			expires := time.Now().Add(time.Hour * 24 * 365).Format(time.RFC1123)
 			c.Header("Expires", expires)
 		case stylesheetRe.MatchString(uri), assetRe.MatchString(uri):
 			c.Header("Cache-Control", "no-cache")
 		case scriptRe.MatchString(uri):
 			c.Header("Cache-Control", "no-cache")
+			// embedding sites need to request the script using CORS for
+			// checking its integrity
+			c.Header("Access-Control-Allow-Origin", "*")
 			if secureContext {
 				c.Header("Strict-Transport-Security", defaultSTS)
 			}
@@ -20,7 +20,7 @@ func TestStaticMiddleware(t *testing.T) {
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
-	}))
+	}), defaultCSP, revisionedJSRe.MatchString)
 
 	m.Use(middleware)
 
@@ -38,8 +38,12 @@ func TestStaticMiddleware(t *testing.T) {
 			t.Errorf("Unexpected Content-Type %v", w.Header().Get("Content-Type"))
 		}
 
-		if w.Header().Get("Content-Security-Policy") == "" {
-			t.Error("Unexpected empty CSP header")
+		if w.Header().Get("Content-Security-Policy") != defaultCSP {
+			t.Errorf("Unexpected CSP header %v", w.Header().Get("Content-Security-Policy"))
+		}
+
+		if w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("Unexpected Cache-Control header %v", w.Header().Get("Cache-Control"))
 		}
 	}
 
@@ -82,6 +86,10 @@ func TestStaticMiddleware(t *testing.T) {
 		if w.Header().Get("Expires") == "" {
 			t.Error("Unexpected empty Expires header on revisioned asset")
 		}
+
+		if w.Header().Get("Cache-Control") != immutableCacheControl {
+			t.Errorf("Unexpected Cache-Control header on revisioned asset %v", w.Header().Get("Cache-Control"))
+		}
 	}
 
 	{
@@ -114,3 +122,44 @@ func TestStaticMiddleware(t *testing.T) {
 		}
 	}
 }
+
+type mockETagFile struct {
+	http.File
+}
+
+func (m mockETagFile) ETag() string {
+	return `"etag-a"`
+}
+
+type mockETagFS struct {
+	http.FileSystem
+}
+
+func (m mockETagFS) Open(name string) (http.File, error) {
+	f, err := m.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return mockETagFile{f}, nil
+}
+
+func TestETagFileServer(t *testing.T) {
+	handler := etagFileServer(mockETagFS{http.Dir("./testdata")})
+	{
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/script.js", nil)
+		handler.ServeHTTP(w, r)
+		if w.Header().Get("ETag") != `"etag-a"` {
+			t.Errorf("Unexpected ETag %v", w.Header().Get("ETag"))
+		}
+	}
+	{
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/script.js", nil)
+		r.Header.Set("If-None-Match", `"etag-a"`)
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusNotModified {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+	}
+}
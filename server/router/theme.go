@@ -0,0 +1,296 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/css"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+// accountTheme returns the theme of the given account. Values are cached
+// the same way custom styles are.
+func (rt *router) accountTheme(accountID string) persistence.Theme {
+	cache, cacheKey := rt.getCache(), fmt.Sprintf("account-theme-%s", accountID)
+	encoded, ok := cache.Get(cacheKey)
+	if !ok {
+		account, err := rt.db.GetAccount(accountID, true, false, "")
+		if err != nil {
+			return persistence.Theme{}
+		}
+		encoded = "{}"
+		if account.Theme != nil {
+			if b, err := json.Marshal(account.Theme); err == nil {
+				encoded = string(b)
+			}
+		}
+		cache.Set(cacheKey, encoded, time.Minute*5)
+	}
+	var theme persistence.Theme
+	if err := json.Unmarshal([]byte(encoded), &theme); err != nil {
+		return persistence.Theme{}
+	}
+	return theme
+}
+
+// applyTheme adds the values of the given theme to the data used for
+// rendering a template. The theme is sanitized and validated again before
+// rendering, so values that have been written to the database by other means
+// cannot be used for injecting content. In case validation fails, the
+// default appearance is used. Values of a previously applied theme are
+// replaced.
+func (rt *router) applyTheme(data map[string]interface{}, theme persistence.Theme) map[string]interface{} {
+	theme = theme.Sanitize()
+	if err := theme.Validate(); err != nil {
+		rt.logError(err, "theme did not pass validation, default appearance will apply")
+		theme = persistence.Theme{}
+	}
+	var colors string
+	if len(theme.Colors) != 0 {
+		var names []string
+		for name := range theme.Colors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var properties []string
+		for _, name := range names {
+			properties = append(properties, fmt.Sprintf("--offen-color-%s: %s;", name, theme.Colors[name]))
+		}
+		colors = fmt.Sprintf(":root { %s }", strings.Join(properties, " "))
+	}
+	data["themeColors"] = template.CSS(colors)
+	data["themeLogo"] = template.URL(theme.Logo)
+	data["themeConsentText"] = template.HTML(theme.ConsentText)
+	return data
+}
+
+// themeEditor checks whether the account user in the request context is
+// allowed to edit the theme of the account in the request.
+func (rt *router) themeEditor(c *gin.Context) (persistence.LoginResult, string, bool) {
+	accountID := c.Param("accountID")
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return accountUser, accountID, false
+	}
+	if !accountUser.CanAccessAccount(accountID) {
+		newJSONError(
+			fmt.Errorf("router: user is not allowed to access account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return accountUser, accountID, false
+	}
+	if !accountUser.HasRole(accountID, persistence.AccountUserRoleEditor) {
+		newJSONError(
+			fmt.Errorf("router: user is not allowed to edit the theme of account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return accountUser, accountID, false
+	}
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit{Requests: 10, Window: time.Minute}, fmt.Sprintf("theme-%s", accountUser.AccountUserID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return accountUser, accountID, false
+	}
+	return accountUser, accountID, true
+}
+
+// currentTheme looks up the stored theme of the given account, bypassing the
+// cache.
+func (rt *router) currentTheme(c *gin.Context, accountID string) (persistence.Theme, bool) {
+	account, err := rt.db.GetAccount(accountID, true, false, "")
+	if err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return persistence.Theme{}, false
+		}
+		newJSONError(
+			fmt.Errorf("router: error looking up account: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return persistence.Theme{}, false
+	}
+	if account.Theme == nil {
+		return persistence.Theme{}, true
+	}
+	return *account.Theme, true
+}
+
+// saveTheme stores the given theme and responds with the result.
+func (rt *router) saveTheme(c *gin.Context, accountID string, theme persistence.Theme, accountUserID string) {
+	result, err := rt.db.UpdateAccountTheme(accountID, theme, accountUserID)
+	if err != nil {
+		var errUnknown persistence.ErrUnknownAccount
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: account %s not found", accountID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error updating theme: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	rt.getCache().Delete(fmt.Sprintf("account-theme-%s", accountID))
+	c.JSON(http.StatusOK, result)
+}
+
+func (rt *router) getAccountTheme(c *gin.Context) {
+	accountID := c.Param("accountID")
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok || !accountUser.CanAccessAccount(accountID) {
+		newJSONError(
+			fmt.Errorf("router: user is not allowed to access account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return
+	}
+	theme, ok := rt.currentTheme(c, accountID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, theme)
+}
+
+type themeRequest struct {
+	Colors      map[string]string `json:"colors"`
+	ConsentText string            `json:"consentText"`
+}
+
+// theme returns the theme defined by the request, using the logo of the
+// given theme.
+func (r themeRequest) theme(current persistence.Theme) persistence.Theme {
+	return persistence.Theme{
+		Logo:        current.Logo,
+		Colors:      r.Colors,
+		ConsentText: r.ConsentText,
+	}.Sanitize()
+}
+
+// bindTheme decodes the theme in the request and validates it. The logo of
+// the account is kept, as it is uploaded separately.
+func (rt *router) bindTheme(c *gin.Context, accountID string) (persistence.Theme, bool) {
+	var req themeRequest
+	if !bindPayload(c, &req) {
+		return persistence.Theme{}, false
+	}
+	current, ok := rt.currentTheme(c, accountID)
+	if !ok {
+		return persistence.Theme{}, false
+	}
+	theme := req.theme(current)
+	if err := theme.Validate(); err != nil {
+		newJSONError(
+			fmt.Errorf("router: invalid theme: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return persistence.Theme{}, false
+	}
+	return theme, true
+}
+
+// putAccountTheme replaces the colors and the consent text of the account's
+// theme.
+func (rt *router) putAccountTheme(c *gin.Context) {
+	accountUser, accountID, ok := rt.themeEditor(c)
+	if !ok {
+		return
+	}
+	theme, ok := rt.bindTheme(c, accountID)
+	if !ok {
+		return
+	}
+	rt.saveTheme(c, accountID, theme, accountUser.AccountUserID)
+}
+
+// putAccountThemeLogo sets the logo of the account's theme to the image
+// sent as the request body.
+func (rt *router) putAccountThemeLogo(c *gin.Context) {
+	accountUser, accountID, ok := rt.themeEditor(c)
+	if !ok {
+		return
+	}
+	image, err := io.ReadAll(io.LimitReader(c.Request.Body, persistence.MaxThemeLogoSize+1))
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error reading logo: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	logo, err := persistence.NewThemeLogo(image)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: invalid logo: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	theme, ok := rt.currentTheme(c, accountID)
+	if !ok {
+		return
+	}
+	theme.Logo = logo
+	rt.saveTheme(c, accountID, theme, accountUser.AccountUserID)
+}
+
+// deleteAccountThemeLogo removes the logo from the account's theme.
+func (rt *router) deleteAccountThemeLogo(c *gin.Context) {
+	accountUser, accountID, ok := rt.themeEditor(c)
+	if !ok {
+		return
+	}
+	theme, ok := rt.currentTheme(c, accountID)
+	if !ok {
+		return
+	}
+	theme.Logo = ""
+	rt.saveTheme(c, accountID, theme, accountUser.AccountUserID)
+}
+
+// postAccountThemePreview renders the vault using the theme in the request
+// without storing it, so editors can check the result before saving.
+func (rt *router) postAccountThemePreview(c *gin.Context) {
+	_, accountID, ok := rt.themeEditor(c)
+	if !ok {
+		return
+	}
+	theme, ok := rt.bindTheme(c, accountID)
+	if !ok {
+		return
+	}
+	styles, err := rt.getStyleStore().Get(accountID)
+	if err != nil {
+		rt.logError(err, "error reading custom styles for theme preview, default styling will apply")
+		styles = ""
+	}
+	if err := css.ValidateCSS(styles); styles != "" && err != nil {
+		styles = ""
+	}
+	data := rt.applyTheme(rt.vaultData(accountID, template.CSS(styles)), theme)
+	c.HTML(http.StatusOK, "vault", templateData(c, data))
+}
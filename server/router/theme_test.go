@@ -0,0 +1,115 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockThemeDatabase struct {
+	persistence.Service
+	theme   *persistence.Theme
+	updated *persistence.Theme
+}
+
+func (m *mockThemeDatabase) GetAccount(accountID string, includeStyles bool, includeEvents bool, eventsSince string) (persistence.AccountResult, error) {
+	if accountID != "account-a" {
+		return persistence.AccountResult{}, persistence.ErrUnknownAccount("unknown")
+	}
+	return persistence.AccountResult{AccountID: accountID, Theme: m.theme}, nil
+}
+
+func (m *mockThemeDatabase) UpdateAccountTheme(accountID string, theme persistence.Theme, accountUserID string) (persistence.Theme, error) {
+	m.updated = &theme
+	return theme, nil
+}
+
+func TestRouter_applyTheme(t *testing.T) {
+	rt := &router{}
+	t.Run("ok", func(t *testing.T) {
+		data := rt.applyTheme(map[string]interface{}{}, persistence.Theme{
+			Colors:      map[string]string{"text": "#000", "primary": "#ff0000"},
+			ConsentText: "<b>Hi</b><script>alert(1)</script>",
+		})
+		if data["themeColors"] != template.CSS(":root { --offen-color-primary: #ff0000; --offen-color-text: #000; }") {
+			t.Errorf("Unexpected colors %v", data["themeColors"])
+		}
+		if data["themeConsentText"] != template.HTML("<b>Hi</b>") {
+			t.Errorf("Unexpected consent text %v", data["themeConsentText"])
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		data := rt.applyTheme(map[string]interface{}{"themeColors": template.CSS(":root {}")}, persistence.Theme{
+			Colors: map[string]string{"primary": "red; } body { display: none"},
+		})
+		if data["themeColors"] != template.CSS("") {
+			t.Errorf("Unexpected colors %v", data["themeColors"])
+		}
+	})
+}
+
+func TestRouter_putAccountTheme(t *testing.T) {
+	editor := persistence.LoginResult{
+		AccountUserID: "user-a",
+		Accounts: []persistence.LoginAccountResult{
+			{AccountID: "account-a", Role: persistence.AccountUserRoleEditor},
+			{AccountID: "account-b", Role: persistence.AccountUserRoleViewer},
+		},
+	}
+	tests := []struct {
+		name               string
+		accountID          string
+		body               string
+		expectedStatusCode int
+	}{
+		{"ok", "account-a", `{"colors":{"primary":"#abc"},"consentText":"<em>Hello</em>"}`, http.StatusOK},
+		{"invalid color", "account-a", `{"colors":{"primary":"blue"}}`, http.StatusBadRequest},
+		{"unknown color", "account-a", `{"colors":{"border":"#fff"}}`, http.StatusBadRequest},
+		{"viewer", "account-b", `{"colors":{"primary":"#abc"}}`, http.StatusForbidden},
+		{"no access", "account-z", `{"colors":{"primary":"#abc"}}`, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logo, _ := persistence.NewThemeLogo([]byte("\x89PNG\x0D\x0A\x1A\x0A"))
+			db := &mockThemeDatabase{theme: &persistence.Theme{Logo: logo}}
+			rt := &router{db: db, config: &config.Config{}}
+			rt.getCache().Set("account-theme-account-a", "{}", time.Minute)
+
+			m := gin.New()
+			m.PUT("/:accountID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, editor)
+			}, rt.putAccountTheme)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/"+test.accountID, strings.NewReader(test.body))
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedStatusCode != http.StatusOK {
+				if db.updated != nil {
+					t.Errorf("Unexpected update %v", db.updated)
+				}
+				return
+			}
+			var result persistence.Theme
+			json.Unmarshal(w.Body.Bytes(), &result)
+			if result.Logo != logo || result.Colors["primary"] != "#abc" || result.ConsentText != "<em>Hello</em>" {
+				t.Errorf("Unexpected result %v", result)
+			}
+			if _, ok := rt.getCache().Get("account-theme-account-a"); ok {
+				t.Error("Expected cached theme to be purged")
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+// secondFactorRequiredResponse is sent when logging in requires a second
+// factor that has not been given.
+type secondFactorRequiredResponse struct {
+	errorResponse
+	SecondFactorRequired bool `json:"secondFactorRequired"`
+}
+
+func (rt *router) postTwoFactorSetup(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("postTwoFactorSetup-%s", accountUser.AccountUserID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error applying rate limit: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	result, err := rt.db.SetupTOTP(accountUser.AccountUserID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error setting up two factor authentication: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+type verifyTwoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+func (rt *router) postTwoFactorVerify(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	var req verifyTwoFactorRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	// codes only consist of a few digits, so guessing needs to be prevented
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit(rt.getConfig().RateLimit.Login), fmt.Sprintf("postTwoFactorVerify-%s", accountUser.AccountUserID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error applying rate limit: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	result, err := rt.db.VerifyTOTP(accountUser.AccountUserID, req.Code)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, persistence.ErrInvalidSecondFactor) {
+			status = http.StatusUnauthorized
+		}
+		newJSONError(
+			fmt.Errorf("router: error verifying two factor authentication: %w", err),
+			status,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockTwoFactorDatabase struct {
+	persistence.Service
+	err error
+}
+
+func (m *mockTwoFactorDatabase) SetupTOTP(string) (persistence.TOTPSetupResult, error) {
+	return persistence.TOTPSetupResult{Secret: "secret", URI: "otpauth://totp/Offen?secret=secret"}, m.err
+}
+
+func (m *mockTwoFactorDatabase) VerifyTOTP(accountUserID, code string) (persistence.TOTPVerifyResult, error) {
+	return persistence.TOTPVerifyResult{RecoveryCodes: []string{"code-a", "code-b"}}, m.err
+}
+
+func TestRouter_postTwoFactorSetup(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockTwoFactorDatabase
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			"database error",
+			&mockTwoFactorDatabase{err: errors.New("did not work")},
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"ok",
+			&mockTwoFactorDatabase{},
+			http.StatusOK,
+			`{"secret":"secret","uri":"otpauth://totp/Offen?secret=secret"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyAuth, persistence.LoginResult{AccountUserID: "user-a"})
+				c.Next()
+			}, rt.postTwoFactorSetup)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedBody != "" && w.Body.String() != test.expectedBody {
+				t.Errorf("Unexpected response body %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_postTwoFactorVerify(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockTwoFactorDatabase
+		body               string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			"bad payload",
+			&mockTwoFactorDatabase{},
+			"{{",
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"invalid code",
+			&mockTwoFactorDatabase{err: fmt.Errorf("did not work: %w", persistence.ErrInvalidSecondFactor)},
+			`{"code":"123456"}`,
+			http.StatusUnauthorized,
+			"",
+		},
+		{
+			"not set up",
+			&mockTwoFactorDatabase{err: errors.New("did not work")},
+			`{"code":"123456"}`,
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"ok",
+			&mockTwoFactorDatabase{},
+			`{"code":"123456"}`,
+			http.StatusOK,
+			`{"recoveryCodes":["code-a","code-b"]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.POST("/", func(c *gin.Context) {
+				c.Set(contextKeyAuth, persistence.LoginResult{AccountUserID: "user-a"})
+				c.Next()
+			}, rt.postTwoFactorVerify)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			m.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedBody != "" && w.Body.String() != test.expectedBody {
+				t.Errorf("Unexpected response body %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getUserData returns all data stored about the requesting user as a JSON
+// download, so users can exercise their right of access without having to
+// contact the operators of each account.
+func (rt *router) getUserData(c *gin.Context) {
+	userID := c.GetString(contextKeyCookie)
+	if l := <-rt.getLimiter().LinearThrottle(time.Second*5, fmt.Sprintf("getUserData-%s", userID)); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error rate limiting request: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	result, err := rt.db.GetUserData(userID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up user data: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", `attachment; filename="offen-my-data.json"`)
+	c.JSON(http.StatusOK, result)
+}
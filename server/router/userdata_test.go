@@ -0,0 +1,80 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockGetUserDataDatabase struct {
+	persistence.Service
+	result persistence.UserDataResult
+	err    error
+	userID string
+}
+
+func (m *mockGetUserDataDatabase) GetUserData(userID string) (persistence.UserDataResult, error) {
+	m.userID = userID
+	return m.result, m.err
+}
+
+func TestRouter_getUserData(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockGetUserDataDatabase
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			"database error",
+			&mockGetUserDataDatabase{err: errors.New("did not work")},
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"ok",
+			&mockGetUserDataDatabase{
+				result: persistence.UserDataResult{
+					Accounts: []persistence.UserDataAccountResult{
+						{AccountID: "account-a", SecretID: "secret-a", EncryptedSecret: "encrypted", Events: []persistence.EventResult{}},
+					},
+				},
+			},
+			http.StatusOK,
+			`"encryptedSecret":"encrypted"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.GET("/", func(c *gin.Context) {
+				c.Set(contextKeyCookie, "user-id")
+				c.Next()
+			}, rt.getUserData)
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.db.userID != "user-id" {
+				t.Errorf("Unexpected user id %s", test.db.userID)
+			}
+			if !strings.Contains(w.Body.String(), test.expectedBody) {
+				t.Errorf("Unexpected body %s", w.Body.String())
+			}
+			if test.expectedStatusCode == http.StatusOK && !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+				t.Errorf("Expected attachment, got %q", w.Header().Get("Content-Disposition"))
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+// maxAccountIDLength is the length of the UUIDs used as account ids.
+const maxAccountIDLength = 36
+
+// bodyLimitMiddleware rejects requests with a body larger than the size
+// returned by the given func. Requests that do not announce their size are
+// cut off once the limit has been read.
+func bodyLimitMiddleware(limit func() config.ByteSize) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		max := limit().Int64()
+		if max <= 0 {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > max {
+			newJSONError(
+				fmt.Errorf("router: request body exceeds the limit of %d bytes", max),
+				http.StatusRequestEntityTooLarge,
+			).Pipe(c)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+		c.Next()
+	}
+}
+
+// payloadValidator is implemented by request payloads that check their
+// contents before being passed on to persistence. Each violation names the
+// offending field.
+type payloadValidator interface {
+	validate() []string
+}
+
+// bindPayload decodes the JSON body of the request into the given value and
+// validates it. In case false is returned, the request has already been
+// aborted using a structured error.
+func bindPayload(c *gin.Context, v interface{}) bool {
+	if err := c.ShouldBindJSON(v); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			newJSONError(
+				fmt.Errorf("router: request body exceeds the limit of %d bytes", maxBytesErr.Limit),
+				http.StatusRequestEntityTooLarge,
+			).Pipe(c)
+			return false
+		}
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %v", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return false
+	}
+	if validator, ok := v.(payloadValidator); ok {
+		if violations := validator.validate(); len(violations) != 0 {
+			pipeViolations(c, violations)
+			return false
+		}
+	}
+	return true
+}
+
+func pipeViolations(c *gin.Context, violations []string) {
+	resp := newJSONError(
+		errors.New("router: request payload is invalid"),
+		http.StatusUnprocessableEntity,
+	)
+	resp.Violations = violations
+	resp.Pipe(c)
+}
+
+func validateAccountID(accountID string) []string {
+	switch {
+	case accountID == "":
+		return []string{"accountId: required"}
+	case len(accountID) > maxAccountIDLength:
+		return []string{fmt.Sprintf("accountId: must not be longer than %d characters", maxAccountIDLength)}
+	}
+	return nil
+}
+
+func (p *inboundEventPayload) validate() []string {
+	violations := validateAccountID(p.AccountID)
+	if p.Payload == "" {
+		violations = append(violations, "payload: required")
+	}
+	violations = append(violations, validateIdempotencyKey("clientEventId", p.ClientEventID)...)
+	if p.EventType != "" {
+		if err := persistence.ValidateEventTypeName(p.EventType); err != nil {
+			violations = append(violations, "eventType: must consist of up to 64 letters, digits, dots, dashes or underscores")
+		}
+	}
+	return violations
+}
+
+func (p *purgePayload) validate() []string {
+	switch {
+	case len(p.AccountIDs) == 0:
+		return []string{"accountIds: required"}
+	case len(p.AccountIDs) > maxPurgeAccounts:
+		return []string{fmt.Sprintf("accountIds: must not contain more than %d items", maxPurgeAccounts)}
+	}
+	var violations []string
+	for i, accountID := range p.AccountIDs {
+		if accountID == "" || len(accountID) > maxAccountIDLength {
+			violations = append(violations, fmt.Sprintf("accountIds[%d]: must be a valid account id", i))
+		}
+	}
+	return violations
+}
+
+func (p *userSecretPayload) validate() []string {
+	violations := validateAccountID(p.AccountID)
+	if p.EncryptedUserSecret == "" {
+		violations = append(violations, "encryptedSecret: required")
+	}
+	if p.Nonce == "" {
+		violations = append(violations, "nonce: required")
+	}
+	if p.Timestamp == "" {
+		violations = append(violations, "timestamp: required")
+	}
+	return violations
+}
+
+func (p *pingPayload) validate() []string {
+	return validateAccountID(p.AccountID)
+}
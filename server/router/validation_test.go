@@ -0,0 +1,99 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+)
+
+func TestBindPayload(t *testing.T) {
+	tests := []struct {
+		name               string
+		limit              config.ByteSize
+		body               string
+		chunked            bool
+		expectedStatusCode int
+		expectedViolations []string
+	}{
+		{
+			"ok",
+			64,
+			`{"accountId":"account-a","payload":"some-payload"}`,
+			false,
+			http.StatusOK,
+			nil,
+		},
+		{
+			"malformed",
+			64,
+			`{"accountId":`,
+			false,
+			http.StatusBadRequest,
+			nil,
+		},
+		{
+			"too large",
+			16,
+			`{"accountId":"account-a","payload":"some-payload"}`,
+			false,
+			http.StatusRequestEntityTooLarge,
+			nil,
+		},
+		{
+			"too large without content length",
+			16,
+			`{"accountId":"account-a","payload":"some-payload"}`,
+			true,
+			http.StatusRequestEntityTooLarge,
+			nil,
+		},
+		{
+			"invalid",
+			1024,
+			`{"accountId":"` + strings.Repeat("a", 37) + `"}`,
+			false,
+			http.StatusUnprocessableEntity,
+			[]string{"accountId: must not be longer than 36 characters", "payload: required"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := gin.New()
+			limit := test.limit
+			m.POST("/", bodyLimitMiddleware(func() config.ByteSize { return limit }), func(c *gin.Context) {
+				var evt inboundEventPayload
+				if !bindPayload(c, &evt) {
+					return
+				}
+				c.Status(http.StatusOK)
+			})
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			if test.chunked {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.expectedViolations != nil {
+				var resp errorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				if !reflect.DeepEqual(resp.Violations, test.expectedViolations) {
+					t.Errorf("Unexpected violations %v", resp.Violations)
+				}
+			}
+		})
+	}
+}
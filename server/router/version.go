@@ -12,12 +12,20 @@ import (
 
 type versionInfo struct {
 	Revision string `json:"revision"`
+	// PrivacySignals is the policy applied to requests that carry a
+	// Do-Not-Track or Global Privacy Control signal.
+	PrivacySignals string `json:"privacySignals"`
 }
 
 func (rt *router) getVersion(c *gin.Context) {
 	// this endpoint is most likely to be consumed by humans, so
 	// we pretty print the output
-	c.IndentedJSON(http.StatusOK, versionInfo{
-		Revision: config.Revision,
-	})
+	info := versionInfo{
+		Revision:       config.Revision,
+		PrivacySignals: string(config.PrivacySignalIgnore),
+	}
+	if cfg := rt.getConfig(); cfg != nil && cfg.App.PrivacySignals != "" {
+		info.PrivacySignals = string(cfg.App.PrivacySignals)
+	}
+	c.IndentedJSON(http.StatusOK, info)
 }
@@ -4,6 +4,7 @@
 package router
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -24,4 +25,11 @@ func TestRouter_getVersion(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Errorf("Unexpected status code %v", w.Code)
 	}
+	var info versionInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if info.PrivacySignals != "ignore" {
+		t.Errorf("Unexpected privacy signal policy %v", info.PrivacySignals)
+	}
 }
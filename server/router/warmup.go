@@ -0,0 +1,87 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"mpldr.codes/oidc"
+)
+
+// configureOIDC performs discovery for the given issuer. It is a variable
+// so it can be swapped in tests.
+var configureOIDC = func(issuer string) (*oidc.Configuration, error) {
+	return oidc.Configure(issuer, "")
+}
+
+// Warmup eagerly initializes all dependencies of the router that would
+// otherwise be initialized on first use. Once it returns, the router reports
+// being ready. Failures are returned in case the StrictWarmup setting is
+// enabled, otherwise they are logged and the router still becomes ready.
+func (rt *router) Warmup(ctx context.Context) error {
+	rt.getLimiter()
+	rt.getCache()
+	rt.getStyleStore()
+
+	var errs []error
+	for name, issuer := range rt.oidcIssuers {
+		if _, ok := rt.oidc[name]; ok {
+			continue
+		}
+		c, err := discoverOIDC(ctx, issuer)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("router: error discovering oidc provider %s: %w", name, err))
+			continue
+		}
+		if rt.oidc == nil {
+			rt.oidc = map[string]*oidc.Configuration{}
+		}
+		rt.oidc[name] = c
+	}
+
+	if rt.db != nil {
+		if err := rt.db.CheckHealth(); err != nil {
+			errs = append(errs, fmt.Errorf("router: error pinging database: %w", err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		if rt.getConfig() != nil && rt.getConfig().Server.StrictWarmup {
+			return err
+		}
+		rt.logError(err, "error warming up router, continuing")
+	}
+	rt.ready.Store(true)
+	return nil
+}
+
+func discoverOIDC(ctx context.Context, issuer string) (*oidc.Configuration, error) {
+	type result struct {
+		c   *oidc.Configuration
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		c, err := configureOIDC(issuer)
+		done <- result{c, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-done:
+		return r.c, r.err
+	}
+}
+
+func (rt *router) getReady(c *gin.Context) {
+	if !rt.ready.Load() {
+		c.JSON(http.StatusServiceUnavailable, map[string]bool{"ok": false})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]bool{"ok": true})
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+	"mpldr.codes/oidc"
+)
+
+type mockWarmupDatabase struct {
+	persistence.Service
+	err error
+}
+
+func (m *mockWarmupDatabase) CheckHealth() error {
+	return m.err
+}
+
+func TestRouter_Warmup(t *testing.T) {
+	defer func(original func(string) (*oidc.Configuration, error)) {
+		configureOIDC = original
+	}(configureOIDC)
+
+	tests := []struct {
+		name          string
+		db            persistence.Service
+		strict        bool
+		discoveryErr  error
+		expectError   bool
+		expectReady   bool
+		expectedOIDCs int
+	}{
+		{"ok", &mockWarmupDatabase{}, true, nil, false, true, 1},
+		{"database error strict", &mockWarmupDatabase{err: errors.New("did not work")}, true, nil, true, false, 1},
+		{"database error lenient", &mockWarmupDatabase{err: errors.New("did not work")}, false, nil, false, true, 1},
+		{"discovery error strict", &mockWarmupDatabase{}, true, errors.New("did not work"), true, false, 0},
+		{"discovery error lenient", &mockWarmupDatabase{}, false, errors.New("did not work"), false, true, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configureOIDC = func(string) (*oidc.Configuration, error) {
+				if test.discoveryErr != nil {
+					return nil, test.discoveryErr
+				}
+				return &oidc.Configuration{}, nil
+			}
+			cfg := &config.Config{}
+			cfg.Server.StrictWarmup = test.strict
+			rt := &router{
+				db:          test.db,
+				config:      cfg,
+				oidcIssuers: map[string]string{"default": "https://sso.example.com"},
+			}
+
+			err := rt.Warmup(context.Background())
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error value %v", err)
+			}
+			if rt.limiter == nil || rt.cache == nil {
+				t.Error("Expected limiter and cache to be initialized")
+			}
+			if len(rt.oidc) != test.expectedOIDCs {
+				t.Errorf("Expected %d oidc providers, got %d", test.expectedOIDCs, len(rt.oidc))
+			}
+
+			m := gin.New()
+			m.GET("/", rt.getReady)
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			expectedCode := http.StatusServiceUnavailable
+			if test.expectReady {
+				expectedCode = http.StatusOK
+			}
+			if w.Code != expectedCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/ratelimiter"
+)
+
+// webauthnSessionTTL defines how long a user has for completing a ceremony
+const webauthnSessionTTL = time.Minute * 5
+
+func webauthnRegistrationCacheKey(accountUserID string) string {
+	return fmt.Sprintf("webauthn-registration-%s", accountUserID)
+}
+
+func webauthnLoginCacheKey(challenge string) string {
+	return fmt.Sprintf("webauthn-login-%s", challenge)
+}
+
+// webauthnUser wraps an account user so it can be used in WebAuthn
+// ceremonies. The account user id is used as the user handle, which allows
+// looking up account users when they log in using a discoverable credential.
+type webauthnUser struct {
+	accountUserID string
+	credentials   []webauthn.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte {
+	return []byte(u.accountUserID)
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.accountUserID
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	return "Offen"
+}
+
+func (u *webauthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func (rt *router) webauthnUser(accountUserID string) (*webauthnUser, error) {
+	credentials, err := rt.db.ListWebAuthnCredentials(accountUserID)
+	if err != nil {
+		return nil, err
+	}
+	user := &webauthnUser{accountUserID: accountUserID}
+	for _, c := range credentials {
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(c.Credential), &credential); err != nil {
+			return nil, fmt.Errorf("router: error decoding stored credential: %w", err)
+		}
+		user.credentials = append(user.credentials, credential)
+	}
+	return user, nil
+}
+
+// setWebAuthnSession stores the given session data in the cache so it can be
+// retrieved when the ceremony is finished by the client.
+func (rt *router) setWebAuthnSession(key string, session *webauthn.SessionData) error {
+	b, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("router: error encoding session data: %w", err)
+	}
+	rt.getCache().Set(key, string(b), webauthnSessionTTL)
+	return nil
+}
+
+// popWebAuthnSession retrieves the session data stored under the given key.
+// Sessions can only be used once, so it is removed from the cache.
+func (rt *router) popWebAuthnSession(key string) (*webauthn.SessionData, error) {
+	cache := rt.getCache()
+	value, ok := cache.Get(key)
+	if !ok {
+		return nil, errors.New("router: unknown or expired ceremony")
+	}
+	cache.Delete(key)
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(value), &session); err != nil {
+		return nil, fmt.Errorf("router: error decoding session data: %w", err)
+	}
+	return &session, nil
+}
+
+func (rt *router) postWebAuthnRegisterBegin(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	user, err := rt.webauthnUser(accountUser.AccountUserID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up credentials: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	var exclusions []protocol.CredentialDescriptor
+	for _, credential := range user.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+	options, session, err := rt.webauthn.BeginRegistration(
+		user,
+		webauthn.WithExclusions(exclusions),
+		// credentials need to be discoverable so users do not need to
+		// enter their email address when logging in
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error beginning registration: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.setWebAuthnSession(webauthnRegistrationCacheKey(accountUser.AccountUserID), session); err != nil {
+		newJSONError(err, http.StatusInternalServerError).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+type webauthnRegisterRequest struct {
+	Password   string          `json:"password"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+func (rt *router) postWebAuthnRegisterFinish(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	var req webauthnRegisterRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	session, err := rt.popWebAuthnSession(webauthnRegistrationCacheKey(accountUser.AccountUserID))
+	if err != nil {
+		newJSONError(err, http.StatusBadRequest).Pipe(c)
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error parsing credential: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	user, err := rt.webauthnUser(accountUser.AccountUserID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up credentials: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	credential, err := rt.webauthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error validating credential: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	b, err := json.Marshal(credential)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error encoding credential: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.db.RegisterWebAuthnCredential(
+		accountUser.AccountUserID, req.Password,
+		base64.RawURLEncoding.EncodeToString(credential.ID), string(b),
+	); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error registering credential: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (rt *router) postWebAuthnLoginBegin(c *gin.Context) {
+	options, session, err := rt.webauthn.BeginDiscoverableLogin()
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error beginning login: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	if err := rt.setWebAuthnSession(webauthnLoginCacheKey(session.Challenge), session); err != nil {
+		newJSONError(err, http.StatusInternalServerError).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+func (rt *router) postWebAuthnLoginFinish(c *gin.Context) {
+	if l := <-rt.getLimiter().Throttle(ratelimiter.Limit(rt.getConfig().RateLimit.Login), fmt.Sprintf("postWebAuthnLoginFinish-%s", clientIP(c.Request, rt.trustedProxies()))); l.Error != nil {
+		newJSONError(
+			fmt.Errorf("router: error applying rate limit: %w", l.Error),
+			http.StatusTooManyRequests,
+		).Pipe(c)
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(c.Request.Body)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error parsing credential: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+
+	session, err := rt.popWebAuthnSession(webauthnLoginCacheKey(parsed.Response.CollectedClientData.Challenge))
+	if err != nil {
+		newJSONError(err, http.StatusUnauthorized).Pipe(c)
+		return
+	}
+
+	var accountUserID string
+	credential, err := rt.webauthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		accountUserID = string(userHandle)
+		return rt.webauthnUser(accountUserID)
+	}, *session, parsed)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: authentication failed: %w", err),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return
+	}
+
+	b, err := json.Marshal(credential)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error encoding credential: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	result, err := rt.db.LoginWebAuthn(accountUserID, base64.RawURLEncoding.EncodeToString(credential.ID), string(b))
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error logging in: %w", err),
+			http.StatusUnauthorized,
+		).Pipe(c)
+		return
+	}
+
+	authCookie, authCookieErr := rt.createSession(result.AccountUserID, c.GetBool(contextKeySecureContext))
+	if authCookieErr != nil {
+		newJSONError(
+			fmt.Errorf("router: error creating session: %w", authCookieErr),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+
+	if err := rt.db.RecordAuditLog(result.AccountUserID, result.AccountIDs(), persistence.AuditActionLogin, ""); err != nil {
+		rt.logError(err, "error recording login in audit log")
+	}
+
+	http.SetCookie(c.Writer, authCookie)
+	c.JSON(http.StatusOK, result)
+}
+
+func (rt *router) getWebAuthnCredentials(c *gin.Context) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: account user object not found on request context"),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	result, err := rt.db.ListWebAuthnCredentials(accountUser.AccountUserID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error looking up credentials: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+func mockWebAuthn(t *testing.T) *webauthn.WebAuthn {
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          "localhost",
+		RPDisplayName: "Offen",
+		RPOrigins:     []string{"http://localhost"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return w
+}
+
+func TestRouter_postWebAuthnLoginBegin(t *testing.T) {
+	rt := router{config: &config.Config{}, webauthn: mockWebAuthn(t)}
+	m := gin.New()
+	m.POST("/", rt.postWebAuthnLoginBegin)
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status code %v", w.Code)
+	}
+	var options struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&options); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, ok := rt.getCache().Get(webauthnLoginCacheKey(options.PublicKey.Challenge)); !ok {
+		t.Error("Expected session to be stored in cache")
+	}
+}
+
+func TestRouter_postWebAuthnRegisterFinish(t *testing.T) {
+	t.Run("unknown ceremony", func(t *testing.T) {
+		rt := router{config: &config.Config{}, webauthn: mockWebAuthn(t)}
+		m := gin.New()
+		m.POST("/", func(c *gin.Context) {
+			c.Set(contextKeyAuth, persistence.LoginResult{AccountUserID: "user-a"})
+			c.Next()
+		}, rt.postWebAuthnRegisterFinish)
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"password":"pass","credential":{}}`))
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Unexpected status code %v", w.Code)
+		}
+	})
+}
+
+func TestRouter_popWebAuthnSession(t *testing.T) {
+	rt := router{}
+	if err := rt.setWebAuthnSession("key", &webauthn.SessionData{Challenge: "challenge"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	session, err := rt.popWebAuthnSession("key")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if session.Challenge != "challenge" {
+		t.Errorf("Unexpected session %v", session)
+	}
+	if _, err := rt.popWebAuthnSession("key"); err == nil {
+		t.Error("Expected session to be usable only once")
+	}
+}
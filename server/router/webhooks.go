@@ -0,0 +1,174 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+// webhookOwner returns the account user of the request and the account whose
+// webhooks are managed. Account webhooks require the admin role, instance
+// wide webhooks are managed using the admin api where no account id is
+// given. In case false is returned, the request has already been aborted.
+func webhookOwner(c *gin.Context) (persistence.LoginResult, string, bool) {
+	accountUser, ok := c.Value(contextKeyAuth).(persistence.LoginResult)
+	if !ok {
+		newJSONError(
+			errors.New("router: could not find account user object in request context"),
+			http.StatusNotFound,
+		).Pipe(c)
+		return accountUser, "", false
+	}
+
+	accountID := c.Param("accountID")
+	if accountID == "" {
+		if !accountUser.IsSuperAdmin() {
+			newJSONError(
+				errors.New("router: account user is not allowed to manage instance wide webhooks"),
+				http.StatusForbidden,
+			).Pipe(c)
+			return accountUser, "", false
+		}
+		return accountUser, "", true
+	}
+	if !accountUser.HasRole(accountID, persistence.AccountUserRoleAdmin) {
+		newJSONError(
+			fmt.Errorf("router: account user is not allowed to manage webhooks of account %s", accountID),
+			http.StatusForbidden,
+		).Pipe(c)
+		return accountUser, "", false
+	}
+	return accountUser, accountID, true
+}
+
+func (rt *router) getWebhooks(c *gin.Context) {
+	_, accountID, ok := webhookOwner(c)
+	if !ok {
+		return
+	}
+	webhooks, err := rt.db.ListWebhooks(accountID)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error listing webhooks: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, webhooks)
+}
+
+type createWebhookRequest struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+func (rt *router) postWebhook(c *gin.Context) {
+	accountUser, accountID, ok := webhookOwner(c)
+	if !ok {
+		return
+	}
+
+	var req createWebhookRequest
+	if err := c.BindJSON(&req); err != nil {
+		newJSONError(
+			fmt.Errorf("router: error decoding request payload: %w", err),
+			http.StatusBadRequest,
+		).Pipe(c)
+		return
+	}
+	for _, validate := range []func() error{
+		func() error { return persistence.ValidateWebhookURL(req.URL) },
+		func() error { return persistence.ValidateWebhookEvents(req.Events) },
+		func() error { return persistence.ValidateWebhookSecret(req.Secret) },
+	} {
+		if err := validate(); err != nil {
+			newJSONError(
+				fmt.Errorf("router: invalid webhook: %w", err),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+
+	result, err := rt.db.CreateWebhook(accountID, accountUser.AccountUserID, req.URL, req.Secret, req.Events)
+	if err != nil {
+		newJSONError(
+			fmt.Errorf("router: error creating webhook: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+func (rt *router) deleteWebhook(c *gin.Context) {
+	accountUser, accountID, ok := webhookOwner(c)
+	if !ok {
+		return
+	}
+
+	webhookID := c.Param("webhookID")
+	if err := rt.db.DeleteWebhook(accountID, webhookID, accountUser.AccountUserID); err != nil {
+		var errUnknown persistence.ErrUnknownWebhook
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: webhook %s not found", webhookID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error deleting webhook: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (rt *router) getWebhookDeliveries(c *gin.Context) {
+	_, accountID, ok := webhookOwner(c)
+	if !ok {
+		return
+	}
+
+	var limit int
+	if l := c.Query("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			newJSONError(
+				fmt.Errorf("router: invalid limit %s", l),
+				http.StatusBadRequest,
+			).Pipe(c)
+			return
+		}
+	}
+
+	webhookID := c.Param("webhookID")
+	deliveries, err := rt.db.ListWebhookDeliveries(accountID, webhookID, limit)
+	if err != nil {
+		var errUnknown persistence.ErrUnknownWebhook
+		if errors.As(err, &errUnknown) {
+			newJSONError(
+				fmt.Errorf("router: webhook %s not found", webhookID),
+				http.StatusNotFound,
+			).Pipe(c)
+			return
+		}
+		newJSONError(
+			fmt.Errorf("router: error listing webhook deliveries: %w", err),
+			http.StatusInternalServerError,
+		).Pipe(c)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
@@ -0,0 +1,204 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockWebhookDatabase struct {
+	persistence.Service
+	createErr     error
+	deleteErr     error
+	deliveriesErr error
+	accountID     string
+}
+
+func (m *mockWebhookDatabase) ListWebhooks(accountID string) ([]persistence.WebhookResult, error) {
+	m.accountID = accountID
+	return []persistence.WebhookResult{}, nil
+}
+
+func (m *mockWebhookDatabase) CreateWebhook(accountID, accountUserID, url, secret string, events []string) (persistence.WebhookResult, error) {
+	m.accountID = accountID
+	return persistence.WebhookResult{WebhookID: "webhook-a", Secret: "secret"}, m.createErr
+}
+
+func (m *mockWebhookDatabase) DeleteWebhook(accountID, webhookID, accountUserID string) error {
+	m.accountID = accountID
+	return m.deleteErr
+}
+
+func (m *mockWebhookDatabase) ListWebhookDeliveries(accountID, webhookID string, limit int) ([]persistence.WebhookDeliveryResult, error) {
+	m.accountID = accountID
+	return []persistence.WebhookDeliveryResult{}, m.deliveriesErr
+}
+
+var webhookAccountUser = persistence.LoginResult{
+	AccountUserID: "user-a",
+	Accounts: []persistence.LoginAccountResult{
+		{AccountID: "account-a", Role: persistence.AccountUserRoleAdmin},
+		{AccountID: "account-b", Role: persistence.AccountUserRoleViewer},
+	},
+}
+
+func TestRouter_postWebhook(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockWebhookDatabase
+		accountUser        persistence.LoginResult
+		path               string
+		body               string
+		expectedStatusCode int
+	}{
+		{
+			"bad payload",
+			&mockWebhookDatabase{},
+			webhookAccountUser,
+			"/accounts/account-a/webhooks",
+			`{"url":`,
+			http.StatusBadRequest,
+		},
+		{
+			"plain http",
+			&mockWebhookDatabase{},
+			webhookAccountUser,
+			"/accounts/account-a/webhooks",
+			`{"url":"http://www.offen.dev/hook","events":["user.joined"]}`,
+			http.StatusBadRequest,
+		},
+		{
+			"unknown event",
+			&mockWebhookDatabase{},
+			webhookAccountUser,
+			"/accounts/account-a/webhooks",
+			`{"url":"https://www.offen.dev/hook","events":["account.renamed"]}`,
+			http.StatusBadRequest,
+		},
+		{
+			"not an admin",
+			&mockWebhookDatabase{},
+			webhookAccountUser,
+			"/accounts/account-b/webhooks",
+			`{"url":"https://www.offen.dev/hook","events":["user.joined"]}`,
+			http.StatusForbidden,
+		},
+		{
+			"instance wide webhook without super admin",
+			&mockWebhookDatabase{},
+			webhookAccountUser,
+			"/webhooks",
+			`{"url":"https://www.offen.dev/hook","events":["account.created"]}`,
+			http.StatusForbidden,
+		},
+		{
+			"database error",
+			&mockWebhookDatabase{createErr: errors.New("did not work")},
+			webhookAccountUser,
+			"/accounts/account-a/webhooks",
+			`{"url":"https://www.offen.dev/hook","events":["user.joined"]}`,
+			http.StatusInternalServerError,
+		},
+		{
+			"ok",
+			&mockWebhookDatabase{},
+			webhookAccountUser,
+			"/accounts/account-a/webhooks",
+			`{"url":"https://www.offen.dev/hook","events":["user.joined"]}`,
+			http.StatusCreated,
+		},
+		{
+			"ok instance wide",
+			&mockWebhookDatabase{accountID: "unset"},
+			persistence.LoginResult{AdminLevel: persistence.AccountUserAdminLevelSuperAdmin},
+			"/webhooks",
+			`{"url":"https://www.offen.dev/hook","events":["account.created"]}`,
+			http.StatusCreated,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			setUser := func(c *gin.Context) {
+				c.Set(contextKeyAuth, test.accountUser)
+			}
+			m.POST("/accounts/:accountID/webhooks", setUser, rt.postWebhook)
+			m.POST("/webhooks", setUser, rt.postWebhook)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body))
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+			if test.name == "ok instance wide" && test.db.accountID != "" {
+				t.Errorf("Expected instance wide webhook, got account %s", test.db.accountID)
+			}
+		})
+	}
+}
+
+func TestRouter_deleteWebhook(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockWebhookDatabase
+		expectedStatusCode int
+	}{
+		{"unknown webhook", &mockWebhookDatabase{deleteErr: persistence.ErrUnknownWebhook("unknown")}, http.StatusNotFound},
+		{"database error", &mockWebhookDatabase{deleteErr: errors.New("did not work")}, http.StatusInternalServerError},
+		{"ok", &mockWebhookDatabase{}, http.StatusNoContent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.DELETE("/accounts/:accountID/webhooks/:webhookID", func(c *gin.Context) {
+				c.Set(contextKeyAuth, webhookAccountUser)
+			}, rt.deleteWebhook)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodDelete, "/accounts/account-a/webhooks/webhook-a", nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
+
+func TestRouter_getWebhookDeliveries(t *testing.T) {
+	tests := []struct {
+		name               string
+		db                 *mockWebhookDatabase
+		query              string
+		expectedStatusCode int
+	}{
+		{"bad limit", &mockWebhookDatabase{}, "?limit=abc", http.StatusBadRequest},
+		{"unknown webhook", &mockWebhookDatabase{deliveriesErr: persistence.ErrUnknownWebhook("unknown")}, "", http.StatusNotFound},
+		{"database error", &mockWebhookDatabase{deliveriesErr: errors.New("did not work")}, "", http.StatusInternalServerError},
+		{"ok", &mockWebhookDatabase{}, "?limit=10", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.GET("/accounts/:accountID/webhooks/:webhookID/deliveries", func(c *gin.Context) {
+				c.Set(contextKeyAuth, webhookAccountUser)
+			}, rt.getWebhookDeliveries)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/accounts/account-a/webhooks/webhook-a/deliveries"+test.query, nil)
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/persistence"
+)
+
+// headerWriteKey is sent by the vault in case the page embedding the script
+// has passed a write key.
+const headerWriteKey = "X-Offen-Write-Key"
+
+// defaultWriteKeyGracePeriod is the duration a write key is still accepted
+// for after it has been rotated, unless another period is requested.
+const defaultWriteKeyGracePeriod = time.Hour * 24
+
+// accountWriteKeys returns the write keys of the given account. Values are
+// cached the same way retention periods are.
+func (rt *router) accountWriteKeys(accountID string) (persistence.WriteKeys, error) {
+	cache, cacheKey := rt.getCache(), fmt.Sprintf("account-write-keys-%s", accountID)
+	encoded, ok := cache.Get(cacheKey)
+	if !ok {
+		account, err := rt.db.GetAccount(accountID, false, false, "")
+		if err != nil {
+			return nil, err
+		}
+		encoded = "[]"
+		if len(account.WriteKeys) != 0 {
+			b, err := json.Marshal(account.WriteKeys)
+			if err != nil {
+				return nil, fmt.Errorf("router: error marshaling write keys: %w", err)
+			}
+			encoded = string(b)
+		}
+		cache.Set(cacheKey, encoded, time.Minute*5)
+	}
+	var writeKeys persistence.WriteKeys
+	if err := json.Unmarshal([]byte(encoded), &writeKeys); err != nil {
+		return nil, fmt.Errorf("router: error parsing write keys: %w", err)
+	}
+	return writeKeys, nil
+}
+
+// matchWriteKey checks whether the given value is one of the given keys.
+// All keys are compared in constant time, so the response time does not
+// reveal anything about the keys.
+func matchWriteKey(writeKeys persistence.WriteKeys, value string) bool {
+	match := 0
+	for _, key := range writeKeys {
+		match |= subtle.ConstantTimeCompare([]byte(key.Key), []byte(value))
+	}
+	return match == 1
+}
+
+// writeKeyMiddleware rejects events sent to accounts that use write keys
+// unless the request passes one of the keys that are currently active.
+// Accounts without any write keys accept all events.
+func (rt *router) writeKeyMiddleware(c *gin.Context) {
+	accountIDs, err := requestAccountIDs(c)
+	if err != nil {
+		newJSONError(err, http.StatusBadRequest).Pipe(c)
+		return
+	}
+	value := c.GetHeader(headerWriteKey)
+	now := time.Now()
+	for _, accountID := range accountIDs {
+		writeKeys, err := rt.accountWriteKeys(accountID)
+		if err != nil {
+			// unknown accounts are handled when inserting the event
+			var unknownAccountErr persistence.ErrUnknownAccount
+			if errors.As(err, &unknownAccountErr) {
+				continue
+			}
+			newJSONError(
+				fmt.Errorf("router: error looking up write keys: %w", err),
+				http.StatusInternalServerError,
+			).Pipe(c)
+			return
+		}
+		writeKeys = writeKeys.Active(now)
+		if len(writeKeys) == 0 {
+			continue
+		}
+		if !matchWriteKey(writeKeys, value) {
+			newJSONError(
+				fmt.Errorf("router: request does not pass a valid write key for account %s", accountID),
+				http.StatusForbidden,
+			).Pipe(c)
+			return
+		}
+	}
+	c.Next()
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/offen/offen/server/config"
+	"github.com/offen/offen/server/persistence"
+)
+
+type mockWriteKeyDatabase struct {
+	persistence.Service
+	writeKeys map[string]persistence.WriteKeys
+	err       error
+}
+
+func (m *mockWriteKeyDatabase) GetAccount(accountID string, styles, events bool, since string) (persistence.AccountResult, error) {
+	if m.err != nil {
+		return persistence.AccountResult{}, m.err
+	}
+	writeKeys, ok := m.writeKeys[accountID]
+	if !ok {
+		return persistence.AccountResult{}, persistence.ErrUnknownAccount("unknown")
+	}
+	return persistence.AccountResult{AccountID: accountID, WriteKeys: writeKeys}, nil
+}
+
+func TestRouter_writeKeyMiddleware(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	expiring := time.Now().Add(time.Hour)
+	db := &mockWriteKeyDatabase{
+		writeKeys: map[string]persistence.WriteKeys{
+			"account-a": {{Key: "previous", Expires: &expiring}, {Key: "current"}},
+			"account-b": {{Key: "other"}},
+			"account-c": nil,
+			"account-d": {{Key: "expired", Expires: &expired}},
+		},
+	}
+	tests := []struct {
+		name               string
+		db                 *mockWriteKeyDatabase
+		body               string
+		writeKey           string
+		expectedStatusCode int
+	}{
+		{"no write keys", db, `{"accountId":"account-c"}`, "", http.StatusOK},
+		{"current key", db, `{"accountId":"account-a"}`, "current", http.StatusOK},
+		{"previous key", db, `{"accountId":"account-a"}`, "previous", http.StatusOK},
+		{"missing key", db, `{"accountId":"account-a"}`, "", http.StatusForbidden},
+		{"bad key", db, `{"accountId":"account-a"}`, "curren", http.StatusForbidden},
+		{"key of other account", db, `{"accountId":"account-a"}`, "other", http.StatusForbidden},
+		{"expired keys only", db, `{"accountId":"account-d"}`, "", http.StatusOK},
+		{"unknown account", db, `{"accountId":"account-z"}`, "", http.StatusOK},
+		{"batch", db, `[{"accountId":"account-a"},{"accountId":"account-c"}]`, "current", http.StatusOK},
+		{"batch mismatch", db, `[{"accountId":"account-a"},{"accountId":"account-b"}]`, "current", http.StatusForbidden},
+		{"bad body", db, `{"accountId":`, "", http.StatusBadRequest},
+		{"database error", &mockWriteKeyDatabase{err: errors.New("did not work")}, `{"accountId":"account-a"}`, "current", http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := router{db: test.db, config: &config.Config{}}
+			m := gin.New()
+			m.POST("/", rt.writeKeyMiddleware, func(c *gin.Context) {
+				b, _ := io.ReadAll(c.Request.Body)
+				if string(b) != test.body {
+					c.AbortWithError(http.StatusInternalServerError, errors.New("body has not been restored"))
+					return
+				}
+				c.Status(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			if test.writeKey != "" {
+				r.Header.Set(headerWriteKey, test.writeKey)
+			}
+			m.ServeHTTP(w, r)
+			if w.Code != test.expectedStatusCode {
+				t.Errorf("Unexpected status code %v", w.Code)
+			}
+		})
+	}
+}
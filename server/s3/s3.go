@@ -0,0 +1,222 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package s3 is a minimal client for S3 compatible object storage.
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/offen/offen/server/sigv4"
+)
+
+// ErrNotFound is returned when the requested object does not exist.
+var ErrNotFound = errors.New("s3: object not found")
+
+// ErrNotModified is returned when a conditional request finds the requested
+// object has not changed.
+var ErrNotModified = errors.New("s3: object not modified")
+
+// Client reads and writes objects in a single bucket.
+type Client struct {
+	endpoint *url.URL
+	bucket   string
+	signer   *sigv4.Signer
+	client   *http.Client
+}
+
+// New creates a Client for the given bucket. Objects are addressed using
+// path style URLs, which is supported by all common S3 compatible services.
+func New(endpoint, bucket, region, accessKeyID, secretAccessKey string) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3: error parsing endpoint: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("s3: endpoint %s is expected to be an absolute URL", endpoint)
+	}
+	if bucket == "" {
+		return nil, errors.New("s3: bucket cannot be empty")
+	}
+	return &Client{
+		endpoint: u,
+		bucket:   bucket,
+		signer: sigv4.New(sigv4.Credentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+		}, region, "s3"),
+		client: &http.Client{Timeout: time.Second * 10},
+	}, nil
+}
+
+func (c *Client) objectURL(key string) string {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.bucket + "/" + strings.TrimPrefix(key, "/")
+	return u.String()
+}
+
+func (c *Client) bucketURL(query url.Values) string {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.bucket
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (c *Client) do(method, key, contentType string, body []byte) (*http.Response, error) {
+	return c.doURL(method, c.objectURL(key), contentType, body)
+}
+
+func (c *Client) doURL(method, target, contentType string, body []byte) (*http.Response, error) {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return c.doURLWithHeader(method, target, header, body)
+}
+
+func (c *Client) doURLWithHeader(method, target string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("s3: error creating request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	c.signer.Sign(req, body)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: error performing request: %w", err)
+	}
+	return res, nil
+}
+
+// Get returns the content of the object stored under the given key.
+func (c *Client) Get(key string) ([]byte, error) {
+	res, err := c.do(http.MethodGet, key, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("s3: unexpected status code %d reading object %s", res.StatusCode, key)
+	}
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("s3: error reading response body: %w", err)
+	}
+	return b, nil
+}
+
+// GetIfNoneMatch returns the content and the ETag of the object stored under
+// the given key. In case a non-empty ETag is given and the object still
+// matches it, ErrNotModified is returned.
+func (c *Client) GetIfNoneMatch(key, etag string) ([]byte, string, error) {
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	res, err := c.doURLWithHeader(http.MethodGet, c.objectURL(key), header, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, etag, ErrNotModified
+	case http.StatusNotFound:
+		return nil, "", ErrNotFound
+	default:
+		return nil, "", fmt.Errorf("s3: unexpected status code %d reading object %s", res.StatusCode, key)
+	}
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("s3: error reading response body: %w", err)
+	}
+	return b, res.Header.Get("ETag"), nil
+}
+
+// Put stores the given content under the given key, replacing any
+// existing object.
+func (c *Client) Put(key, contentType string, body []byte) error {
+	res, err := c.do(http.MethodPut, key, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3: unexpected status code %d writing object %s", res.StatusCode, key)
+	}
+	return nil
+}
+
+// Delete removes the object stored under the given key. Deleting an object
+// that does not exist is not considered an error.
+func (c *Client) Delete(key string) error {
+	res, err := c.do(http.MethodDelete, key, "", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("s3: unexpected status code %d deleting object %s", res.StatusCode, key)
+	}
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the keys of all objects that start with the given prefix,
+// following continuation tokens until the full listing has been read.
+func (c *Client) List(prefix string) ([]string, error) {
+	keys := []string{}
+	var token string
+	for {
+		query := url.Values{"list-type": []string{"2"}, "prefix": []string{prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		res, err := c.doURL(http.MethodGet, c.bucketURL(query), "", nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		decodeErr := func() error {
+			defer res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				return fmt.Errorf("s3: unexpected status code %d listing objects with prefix %s", res.StatusCode, prefix)
+			}
+			if err := xml.NewDecoder(res.Body).Decode(&result); err != nil {
+				return fmt.Errorf("s3: error decoding object listing: %w", err)
+			}
+			return nil
+		}()
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
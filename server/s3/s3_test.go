@@ -0,0 +1,153 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package s3
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	objects := map[string]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(b)
+		case http.MethodGet:
+			value, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(value))
+		}
+	}))
+	defer ts.Close()
+
+	c, err := New(ts.URL, "bucket", "us-east-1", "key", "secret")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := c.Get("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := c.Put("dir/object", "text/plain", []byte("value")); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if objects["/bucket/dir/object"] != "value" {
+		t.Errorf("Unexpected objects %v", objects)
+	}
+	b, err := c.Get("dir/object")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if string(b) != "value" {
+		t.Errorf("Unexpected value %s", string(b))
+	}
+}
+
+func TestClient_ListDelete(t *testing.T) {
+	objects := map[string]string{"a/1": "", "a/2": "", "a/3": "", "b/1": ""}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			delete(objects, strings.TrimPrefix(r.URL.Path, "/bucket/"))
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			if r.URL.Path != "/bucket" || r.URL.Query().Get("list-type") != "2" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			// serve a single key per page so pagination is exercised
+			var keys []string
+			for key := range objects {
+				if strings.HasPrefix(key, r.URL.Query().Get("prefix")) && key > r.URL.Query().Get("continuation-token") {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			if len(keys) == 0 {
+				w.Write([]byte(`<ListBucketResult></ListBucketResult>`))
+				return
+			}
+			fmt.Fprintf(w, `<ListBucketResult><Contents><Key>%s</Key></Contents><IsTruncated>%v</IsTruncated><NextContinuationToken>%s</NextContinuationToken></ListBucketResult>`, keys[0], len(keys) > 1, keys[0])
+		}
+	}))
+	defer ts.Close()
+
+	c, err := New(ts.URL, "bucket", "us-east-1", "key", "secret")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	keys, err := c.List("a/")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a/1", "a/2", "a/3"}) {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+	if err := c.Delete("a/2"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	keys, _ = c.List("a/")
+	if !reflect.DeepEqual(keys, []string{"a/1", "a/3"}) {
+		t.Errorf("Unexpected keys after deletion %v", keys)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("not a url", "bucket", "", "", ""); err == nil {
+		t.Error("Expected error for relative endpoint")
+	}
+	if _, err := New("https://s3.example.com", "", "", "", ""); err == nil {
+		t.Error("Expected error for empty bucket")
+	}
+}
+
+func TestClient_GetIfNoneMatch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/object" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"etag-a"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"etag-a"`)
+		w.Write([]byte("value"))
+	}))
+	defer ts.Close()
+
+	c, err := New(ts.URL, "bucket", "us-east-1", "key", "secret")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, _, err := c.GetIfNoneMatch("missing", ""); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	b, etag, err := c.GetIfNoneMatch("object", "")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(b) != "value" || etag != `"etag-a"` {
+		t.Errorf("Unexpected result %s %s", string(b), etag)
+	}
+	if _, _, err := c.GetIfNoneMatch("object", etag); err != ErrNotModified {
+		t.Errorf("Expected ErrNotModified, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package safehttp
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"1.1.1.1", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.12", false},
+		{"172.16.4.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.ip, func(t *testing.T) {
+			if result := IsPublic(net.ParseIP(test.ip)); result != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	t.Run("loopback", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("Unexpected request")
+		}))
+		defer server.Close()
+		_, err := NewClient(time.Second).Get(server.URL)
+		if !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("Expected forbidden address error, got %v", err)
+		}
+	})
+	t.Run("localhost", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("Unexpected request")
+		}))
+		defer server.Close()
+		_, err := NewClient(time.Second).Get(strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+		if !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("Expected forbidden address error, got %v", err)
+		}
+	})
+	t.Run("redirect", func(t *testing.T) {
+		client := NewClient(time.Second)
+		// the check for public addresses is skipped for this test
+		client.Transport = http.DefaultTransport
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				t.Error("Unexpected redirect being followed")
+			}
+			http.Redirect(w, r, "/internal", http.StatusFound)
+		}))
+		defer server.Close()
+		res, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusFound {
+			t.Errorf("Unexpected status code %d", res.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	from := time.Date(2022, time.March, 15, 10, 30, 20, 0, time.UTC)
+	tests := []struct {
+		name          string
+		expr          string
+		expectError   bool
+		expectedNext  time.Time
+		expectedAfter time.Time
+	}{
+		{
+			"hourly",
+			"@hourly",
+			false,
+			time.Date(2022, time.March, 15, 11, 0, 0, 0, time.UTC),
+			time.Date(2022, time.March, 15, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			"daily at 3am",
+			"0 3 * * *",
+			false,
+			time.Date(2022, time.March, 16, 3, 0, 0, 0, time.UTC),
+			time.Date(2022, time.March, 17, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			"steps and lists",
+			"*/20 9,11 * * *",
+			false,
+			time.Date(2022, time.March, 15, 10, 30, 20, 0, time.UTC).Add(time.Minute * 30).Truncate(time.Hour),
+			time.Date(2022, time.March, 15, 11, 20, 0, 0, time.UTC),
+		},
+		{
+			"weekdays",
+			"15 8 * * 1-5",
+			false,
+			time.Date(2022, time.March, 16, 8, 15, 0, 0, time.UTC),
+			time.Date(2022, time.March, 17, 8, 15, 0, 0, time.UTC),
+		},
+		{
+			"sunday as 7",
+			"0 0 * * 7",
+			false,
+			time.Date(2022, time.March, 20, 0, 0, 0, 0, time.UTC),
+			time.Date(2022, time.March, 27, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"day of month or day of week",
+			"0 0 1 * 5",
+			false,
+			time.Date(2022, time.March, 18, 0, 0, 0, 0, time.UTC),
+			time.Date(2022, time.March, 25, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"every",
+			"@every 90s",
+			false,
+			from.Add(time.Second * 90),
+			from.Add(time.Second * 180),
+		},
+		{
+			"impossible date",
+			"0 0 31 2 *",
+			false,
+			time.Time{},
+			time.Time{},
+		},
+		{"bad field count", "* * *", true, time.Time{}, time.Time{}},
+		{"out of range", "61 * * * *", true, time.Time{}, time.Time{}},
+		{"bad step", "*/0 * * * *", true, time.Time{}, time.Time{}},
+		{"bad range", "5-1 * * * *", true, time.Time{}, time.Time{}},
+		{"bad interval", "@every soon", true, time.Time{}, time.Time{}},
+		{"too short interval", "@every 1ms", true, time.Time{}, time.Time{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := Parse(test.expr)
+			if (err != nil) != test.expectError {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if schedule.String() != test.expr {
+				t.Errorf("Unexpected string representation %s", schedule.String())
+			}
+			next := schedule.Next(from)
+			if !next.Equal(test.expectedNext) {
+				t.Errorf("Expected next run at %v, got %v", test.expectedNext, next)
+			}
+			if next.IsZero() {
+				return
+			}
+			if after := schedule.Next(next); !after.Equal(test.expectedAfter) {
+				t.Errorf("Expected subsequent run at %v, got %v", test.expectedAfter, after)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package scheduler runs background jobs based on cron expressions. Jobs
+// can be guarded by a Locker so that only one instance of a horizontally
+// scaled deployment runs a job at a time.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUnknownJob is returned when triggering a job that does not exist.
+var ErrUnknownJob = errors.New("scheduler: unknown job")
+
+// ErrSkipped is returned when a job could not be run because it is already
+// running, either in this process or in another instance holding the lock.
+var ErrSkipped = errors.New("scheduler: job is already running")
+
+// Locker acquires named locks that are shared between all instances of
+// a deployment. TryLock does not block. In case the lock is held elsewhere,
+// acquired is false.
+type Locker interface {
+	TryLock(name string) (release func(), acquired bool, err error)
+}
+
+// Job is a unit of work that is run on the given schedule. Run returns
+// the number of affected items.
+type Job struct {
+	Name      string
+	Schedule  Schedule
+	RunOnInit bool
+	Run       func() (int, error)
+}
+
+// Status describes the state of a job.
+type Status struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	Running      bool       `json:"running"`
+	NextRun      *time.Time `json:"nextRun,omitempty"`
+	LastRun      *time.Time `json:"lastRun,omitempty"`
+	LastDuration string     `json:"lastDuration,omitempty"`
+	LastAffected int        `json:"lastAffected"`
+	LastError    string     `json:"lastError,omitempty"`
+	Skipped      int        `json:"skipped"`
+}
+
+type entry struct {
+	job    Job
+	mu     sync.Mutex
+	status Status
+}
+
+// Scheduler runs jobs on their schedules.
+type Scheduler struct {
+	// Locker is used for making sure a job is not run by multiple
+	// instances at once. In case it is nil, jobs are only guarded against
+	// overlapping runs in the current process.
+	Locker Locker
+	// Jitter is the maximum random delay added to each scheduled run so
+	// instances sharing a schedule do not all wake up at the same time.
+	Jitter time.Duration
+	// OnResult is called after each run of a job.
+	OnResult func(name string, affected int, err error)
+
+	mu      sync.RWMutex
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+// Add registers the given job. Jobs need to be added before calling Run.
+func (s *Scheduler) Add(job Job) error {
+	if job.Name == "" || job.Schedule == nil || job.Run == nil {
+		return errors.New("scheduler: jobs require a name, a schedule and a func")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries == nil {
+		s.entries = map[string]*entry{}
+	}
+	if _, ok := s.entries[job.Name]; ok {
+		return fmt.Errorf("scheduler: job %s has already been added", job.Name)
+	}
+	s.entries[job.Name] = &entry{
+		job:    job,
+		status: Status{Name: job.Name, Schedule: job.Schedule.String()},
+	}
+	return nil
+}
+
+// Run runs all jobs on their schedules until the given context is canceled.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.RLock()
+	var wg sync.WaitGroup
+	for _, e := range s.entries {
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+			s.loop(ctx, e)
+		}(e)
+	}
+	s.mu.RUnlock()
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	if e.job.RunOnInit {
+		s.run(e)
+	}
+	for {
+		next := e.job.Schedule.Next(s.currentTime())
+		if next.IsZero() {
+			return
+		}
+		e.mu.Lock()
+		e.status.NextRun = &next
+		e.mu.Unlock()
+
+		delay := next.Sub(s.currentTime())
+		if s.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(s.Jitter)))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.run(e)
+		}
+	}
+}
+
+// Trigger runs the job with the given name immediately.
+func (s *Scheduler) Trigger(name string) (int, error) {
+	s.mu.RLock()
+	e, ok := s.entries[name]
+	s.mu.RUnlock()
+	if !ok {
+		return 0, ErrUnknownJob
+	}
+	return s.run(e)
+}
+
+func (s *Scheduler) run(e *entry) (int, error) {
+	e.mu.Lock()
+	if e.status.Running {
+		e.status.Skipped++
+		e.mu.Unlock()
+		return 0, ErrSkipped
+	}
+	e.status.Running = true
+	e.mu.Unlock()
+
+	affected, err := s.runLocked(e)
+
+	e.mu.Lock()
+	e.status.Running = false
+	if errors.Is(err, ErrSkipped) {
+		e.status.Skipped++
+	}
+	e.mu.Unlock()
+	return affected, err
+}
+
+func (s *Scheduler) runLocked(e *entry) (int, error) {
+	if s.Locker != nil {
+		release, acquired, err := s.Locker.TryLock("job:" + e.job.Name)
+		if err != nil {
+			err = fmt.Errorf("scheduler: error acquiring lock for job %s: %w", e.job.Name, err)
+			s.record(e, s.currentTime(), 0, 0, err)
+			return 0, err
+		}
+		if !acquired {
+			return 0, ErrSkipped
+		}
+		defer release()
+	}
+
+	start := s.currentTime()
+	affected, err := e.job.Run()
+	s.record(e, start, s.currentTime().Sub(start), affected, err)
+	return affected, err
+}
+
+func (s *Scheduler) record(e *entry, start time.Time, duration time.Duration, affected int, err error) {
+	e.mu.Lock()
+	e.status.LastRun = &start
+	e.status.LastDuration = duration.String()
+	e.status.LastAffected = affected
+	e.status.LastError = ""
+	if err != nil {
+		e.status.LastError = err.Error()
+	}
+	e.mu.Unlock()
+	if s.OnResult != nil {
+		s.OnResult(e.job.Name, affected, err)
+	}
+}
+
+// Status returns the status of all jobs, sorted by name.
+func (s *Scheduler) Status() []Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := []Status{}
+	for _, e := range s.entries {
+		e.mu.Lock()
+		result = append(result, e.status)
+		e.mu.Unlock()
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func (s *Scheduler) currentTime() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
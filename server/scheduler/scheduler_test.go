@@ -0,0 +1,117 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockLocker struct {
+	held     bool
+	err      error
+	released int
+}
+
+func (m *mockLocker) TryLock(name string) (func(), bool, error) {
+	if m.err != nil {
+		return nil, false, m.err
+	}
+	if m.held {
+		return nil, false, nil
+	}
+	return func() { m.released++ }, true, nil
+}
+
+func TestScheduler_Trigger(t *testing.T) {
+	locker := &mockLocker{}
+	var results []string
+	s := &Scheduler{
+		Locker: locker,
+		OnResult: func(name string, affected int, err error) {
+			results = append(results, name)
+		},
+	}
+	schedule, _ := Parse("@hourly")
+	if err := s.Add(Job{Name: "expire", Schedule: schedule, Run: func() (int, error) {
+		return 12, nil
+	}}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := s.Add(Job{Name: "expire", Schedule: schedule, Run: func() (int, error) {
+		return 0, nil
+	}}); err == nil {
+		t.Error("Expected error when adding duplicate job")
+	}
+	if err := s.Add(Job{Name: "fail", Schedule: schedule, Run: func() (int, error) {
+		return 0, errors.New("did not work")
+	}}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if _, err := s.Trigger("unknown"); err != ErrUnknownJob {
+		t.Errorf("Expected ErrUnknownJob, got %v", err)
+	}
+	if affected, err := s.Trigger("expire"); affected != 12 || err != nil {
+		t.Errorf("Unexpected result %v %v", affected, err)
+	}
+	if _, err := s.Trigger("fail"); err == nil {
+		t.Error("Expected error")
+	}
+	if locker.released != 2 {
+		t.Errorf("Expected locks to be released, got %d", locker.released)
+	}
+
+	locker.held = true
+	if _, err := s.Trigger("expire"); err != ErrSkipped {
+		t.Errorf("Expected ErrSkipped, got %v", err)
+	}
+
+	status := s.Status()
+	if len(status) != 2 {
+		t.Fatalf("Unexpected status %v", status)
+	}
+	if status[0].Name != "expire" || status[0].LastAffected != 12 || status[0].Skipped != 1 || status[0].LastRun == nil {
+		t.Errorf("Unexpected status %v", status[0])
+	}
+	if status[1].Name != "fail" || status[1].LastError == "" {
+		t.Errorf("Unexpected status %v", status[1])
+	}
+	if len(results) != 2 {
+		t.Errorf("Unexpected results %v", results)
+	}
+}
+
+func TestScheduler_Run(t *testing.T) {
+	runs := make(chan bool, 10)
+	s := &Scheduler{}
+	schedule, _ := Parse("@every 1h")
+	s.Add(Job{Name: "init", Schedule: schedule, RunOnInit: true, Run: func() (int, error) {
+		runs <- true
+		return 0, nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Fatal("Expected job to run on init")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected scheduler to stop")
+	}
+	if status := s.Status(); status[0].NextRun == nil {
+		t.Errorf("Expected next run to be set, got %v", status[0])
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package secretsource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/offen/offen/server/sigv4"
+)
+
+type getSecretValueRequest struct {
+	SecretID string `json:"SecretId"`
+}
+
+type getSecretValueResponse struct {
+	SecretString *string `json:"SecretString"`
+}
+
+// resolveAWSSM reads a secret from AWS Secrets Manager. secretID can be the
+// name or the ARN of the secret. In case a key is given, the secret is
+// expected to be a JSON object the key is selected from.
+func (r *resolver) resolveAWSSM(ctx context.Context, secretID, key string) (string, error) {
+	region := r.lookup("AWS_REGION")
+	if region == "" {
+		region = r.lookup("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return "", errors.New("secretsource: AWS_REGION is required for resolving awssm references")
+	}
+	credentials := sigv4.Credentials{
+		AccessKeyID:     r.lookup("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: r.lookup("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    r.lookup("AWS_SESSION_TOKEN"),
+	}
+	if credentials.AccessKeyID == "" || credentials.SecretAccessKey == "" {
+		return "", errors.New("secretsource: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for resolving awssm references")
+	}
+	endpoint := r.lookup("AWS_ENDPOINT_URL_SECRETS_MANAGER")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", region)
+	}
+
+	body, err := json.Marshal(getSecretValueRequest{SecretID: secretID})
+	if err != nil {
+		return "", fmt.Errorf("secretsource: error encoding request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("secretsource: error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	sigv4.New(credentials, region, "secretsmanager").Sign(req, body)
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secretsource: error calling secrets manager: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("secretsource: secrets manager responded with status %d for %s", res.StatusCode, secretID)
+	}
+	var payload getSecretValueResponse
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		return "", fmt.Errorf("secretsource: error decoding secrets manager response: %w", err)
+	}
+	if payload.SecretString == nil {
+		return "", fmt.Errorf("secretsource: secret %s does not contain a string value", secretID)
+	}
+	if key == "" {
+		return *payload.SecretString, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(*payload.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("secretsource: error decoding secret %s as JSON: %w", secretID, err)
+	}
+	return selectKey(fields, key)
+}
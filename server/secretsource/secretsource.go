@@ -0,0 +1,110 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package secretsource resolves references to secrets that are stored in
+// HashiCorp Vault or AWS Secrets Manager, so that configuration values do not
+// need to contain any secrets in plaintext. Credentials for accessing the
+// stores are read from the environment variables the official clients use.
+package secretsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	schemeVault = "vault://"
+	schemeAWSSM = "awssm://"
+)
+
+// Resolver returns the secret the given reference points to.
+type Resolver interface {
+	Resolve(ctx context.Context, reference string) (string, error)
+}
+
+// IsReference checks whether the given value references a secret instead of
+// being a plain value.
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, schemeVault) || strings.HasPrefix(value, schemeAWSSM)
+}
+
+// New returns a Resolver that supports all known kinds of references, using
+// lookup for reading credentials and addresses. Passing nil uses the
+// environment of the process.
+func New(lookup func(string) string) Resolver {
+	if lookup == nil {
+		lookup = os.Getenv
+	}
+	return &resolver{
+		lookup: lookup,
+		client: &http.Client{Timeout: time.Second * 15},
+	}
+}
+
+type resolver struct {
+	lookup func(string) string
+	client *http.Client
+}
+
+func (r *resolver) Resolve(ctx context.Context, reference string) (string, error) {
+	switch {
+	case strings.HasPrefix(reference, schemeVault):
+		path, key := splitReference(strings.TrimPrefix(reference, schemeVault))
+		return r.resolveVault(ctx, path, key)
+	case strings.HasPrefix(reference, schemeAWSSM):
+		secretID, key := splitReference(strings.TrimPrefix(reference, schemeAWSSM))
+		return r.resolveAWSSM(ctx, secretID, key)
+	default:
+		return "", fmt.Errorf("secretsource: unsupported reference %s", redact(reference))
+	}
+}
+
+// splitReference splits a reference into the location of the secret and
+// the key that is selected from it using a key query parameter, if any. A
+// fragment is not used for this, as it would be treated as a comment in env
+// files.
+func splitReference(s string) (string, string) {
+	if idx := strings.LastIndex(s, "?key="); idx != -1 {
+		return s[:idx], s[idx+len("?key="):]
+	}
+	return s, ""
+}
+
+// selectKey picks the given key from the fields of a secret. In case no key
+// is given, the secret is expected to contain a single field.
+func selectKey(fields map[string]interface{}, key string) (string, error) {
+	if key == "" {
+		if len(fields) != 1 {
+			return "", fmt.Errorf("secretsource: secret contains %d fields, a key needs to be selected", len(fields))
+		}
+		for k := range fields {
+			key = k
+		}
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secretsource: secret does not contain key %s", key)
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("secretsource: error encoding value of key %s: %w", key, err)
+		}
+		return string(b), nil
+	}
+}
+
+// redact returns a reference without its selected key, so it can be used
+// in error messages.
+func redact(reference string) string {
+	location, _ := splitReference(reference)
+	return location
+}
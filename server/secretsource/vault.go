@@ -0,0 +1,63 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package secretsource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type vaultResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+// resolveVault reads a secret from the KV version 2 secrets engine. The path
+// is expected to start with the mount of the engine, e.g. secret/offen.
+func (r *resolver) resolveVault(ctx context.Context, path, key string) (string, error) {
+	addr := strings.TrimSuffix(r.lookup("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", errors.New("secretsource: VAULT_ADDR is required for resolving vault references")
+	}
+	token := r.lookup("VAULT_TOKEN")
+	if token == "" {
+		return "", errors.New("secretsource: VAULT_TOKEN is required for resolving vault references")
+	}
+	segments := strings.SplitN(strings.Trim(path, "/"), "/", 2)
+	if len(segments) != 2 || segments[1] == "" {
+		return "", fmt.Errorf("secretsource: vault reference %s does not contain a mount and a path", path)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet,
+		fmt.Sprintf("%s/v1/%s/data/%s", addr, segments[0], segments[1]),
+		nil,
+	)
+	if err != nil {
+		return "", fmt.Errorf("secretsource: error creating request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := r.lookup("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secretsource: error calling vault: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("secretsource: vault responded with status %d for %s", res.StatusCode, path)
+	}
+	var payload vaultResponse
+	if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		return "", fmt.Errorf("secretsource: error decoding vault response: %w", err)
+	}
+	return selectKey(payload.Data.Data, key)
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package sigv4
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigner_Sign(t *testing.T) {
+	t.Run("aws example", func(t *testing.T) {
+		// see https://docs.aws.amazon.com/general/latest/gr/sigv4-create-canonical-request.html
+		s := New(Credentials{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		}, "us-east-1", "iam")
+		s.now = func() time.Time {
+			return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+		}
+		r, _ := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		s.Sign(r, nil)
+
+		expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+		if auth := r.Header.Get("Authorization"); auth != expected {
+			t.Errorf("Unexpected authorization header %s", auth)
+		}
+	})
+	t.Run("s3", func(t *testing.T) {
+		s := New(Credentials{
+			AccessKeyID:     "key",
+			SecretAccessKey: "secret",
+			SessionToken:    "token",
+		}, "eu-central-1", "s3")
+		r, _ := http.NewRequest(http.MethodPut, "https://s3.example.com/bucket/key.css", nil)
+		s.Sign(r, []byte("body"))
+
+		if r.Header.Get("X-Amz-Content-Sha256") != "230d8358dc8e8890b4c58deeb62912ee2f20357ae92a5cc861b98e68fe31acb5" {
+			t.Errorf("Unexpected payload hash %s", r.Header.Get("X-Amz-Content-Sha256"))
+		}
+		if r.Header.Get("X-Amz-Security-Token") != "token" {
+			t.Errorf("Expected session token to be set")
+		}
+		if auth := r.Header.Get("Authorization"); !strings.Contains(auth, "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token,") {
+			t.Errorf("Unexpected authorization header %s", auth)
+		}
+	})
+}
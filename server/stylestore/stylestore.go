@@ -0,0 +1,112 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package stylestore defines where custom styles for accounts are stored.
+package stylestore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/s3"
+)
+
+// Store reads and writes custom styles for accounts. Reading or writing
+// styles of an unknown account returns persistence.ErrUnknownAccount.
+type Store interface {
+	Get(accountID string) (string, error)
+	Put(accountID, styles string) error
+}
+
+// Redirector can be implemented by stores that allow clients to download
+// styles directly, e.g. from a CDN in front of object storage. An empty URL
+// means styles need to be served by the application.
+type Redirector interface {
+	URL(accountID string) string
+}
+
+// NewDatabaseStore creates a Store that keeps styles alongside the account
+// record in the given database.
+func NewDatabaseStore(db persistence.Service) Store {
+	return &databaseStore{db: db}
+}
+
+type databaseStore struct {
+	db persistence.Service
+}
+
+func (d *databaseStore) Get(accountID string) (string, error) {
+	account, err := d.db.GetAccount(accountID, true, false, "")
+	if err != nil {
+		return "", fmt.Errorf("stylestore: error looking up account: %w", err)
+	}
+	return account.AccountStyles, nil
+}
+
+func (d *databaseStore) Put(accountID, styles string) error {
+	if err := d.db.UpdateAccountStyles(accountID, styles); err != nil {
+		return fmt.Errorf("stylestore: error updating account: %w", err)
+	}
+	return nil
+}
+
+// NewS3Store creates a Store that keeps styles as objects in S3 compatible
+// storage, using the given prefix for all keys. The given database is used
+// for checking whether an account exists. In case a public URL is given,
+// clients are redirected to objects below this URL.
+func NewS3Store(client *s3.Client, db persistence.Service, prefix, publicURL string) Store {
+	return &s3Store{client: client, db: db, prefix: prefix, publicURL: publicURL}
+}
+
+type s3Store struct {
+	client    *s3.Client
+	db        persistence.Service
+	prefix    string
+	publicURL string
+}
+
+func (s *s3Store) key(accountID string) string {
+	return fmt.Sprintf("%saccount-styles/%s.css", s.prefix, accountID)
+}
+
+// checkAccount makes sure objects are only read and written for accounts
+// that exist, the same way the database store does.
+func (s *s3Store) checkAccount(accountID string) error {
+	if _, err := s.db.GetAccount(accountID, false, false, ""); err != nil {
+		return fmt.Errorf("stylestore: error looking up account: %w", err)
+	}
+	return nil
+}
+
+func (s *s3Store) Get(accountID string) (string, error) {
+	if err := s.checkAccount(accountID); err != nil {
+		return "", err
+	}
+	b, err := s.client.Get(s.key(accountID))
+	if err != nil {
+		if errors.Is(err, s3.ErrNotFound) {
+			return "", nil
+		}
+		return "", fmt.Errorf("stylestore: error reading styles from object storage: %w", err)
+	}
+	return string(b), nil
+}
+
+func (s *s3Store) URL(accountID string) string {
+	if s.publicURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(s.publicURL, "/") + "/" + s.key(accountID)
+}
+
+func (s *s3Store) Put(accountID, styles string) error {
+	if err := s.checkAccount(accountID); err != nil {
+		return err
+	}
+	if err := s.client.Put(s.key(accountID), "text/css", []byte(styles)); err != nil {
+		return fmt.Errorf("stylestore: error writing styles to object storage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package stylestore
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/offen/offen/server/persistence"
+	"github.com/offen/offen/server/s3"
+)
+
+type mockStylesDatabase struct {
+	persistence.Service
+	styles string
+	err    error
+}
+
+func (m *mockStylesDatabase) GetAccount(string, bool, bool, string) (persistence.AccountResult, error) {
+	return persistence.AccountResult{AccountStyles: m.styles}, m.err
+}
+
+func (m *mockStylesDatabase) UpdateAccountStyles(accountID, styles string) error {
+	m.styles = styles
+	return m.err
+}
+
+func TestDatabaseStore(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		s := NewDatabaseStore(&mockStylesDatabase{})
+		if err := s.Put("account-a", "body { color: red; }"); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		styles, err := s.Get("account-a")
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if styles != "body { color: red; }" {
+			t.Errorf("Unexpected styles %s", styles)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		s := NewDatabaseStore(&mockStylesDatabase{err: errors.New("did not work")})
+		if _, err := s.Get("account-a"); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if err := s.Put("account-a", ""); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
+
+func TestS3Store(t *testing.T) {
+	objects := map[string]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(b)
+		case http.MethodGet:
+			value, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(value))
+		}
+	}))
+	defer ts.Close()
+
+	client, _ := s3.New(ts.URL, "bucket", "us-east-1", "key", "secret")
+	s := NewS3Store(client, &mockStylesDatabase{}, "offen/", "")
+
+	styles, err := s.Get("account-a")
+	if err != nil || styles != "" {
+		t.Errorf("Expected missing styles to be empty, got %s and %v", styles, err)
+	}
+	if err := s.Put("account-a", "body { color: red; }"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, ok := objects["/bucket/offen/account-styles/account-a.css"]; !ok {
+		t.Errorf("Unexpected objects %v", objects)
+	}
+	styles, err = s.Get("account-a")
+	if err != nil || styles != "body { color: red; }" {
+		t.Errorf("Unexpected result %s and %v", styles, err)
+	}
+
+	ts.Close()
+	if _, err := s.Get("account-a"); err == nil {
+		t.Error("Expected error when object storage is unreachable")
+	}
+}
+
+func TestS3Store_UnknownAccount(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+
+	client, _ := s3.New(ts.URL, "bucket", "us-east-1", "key", "secret")
+	s := NewS3Store(client, &mockStylesDatabase{err: persistence.ErrUnknownAccount("unknown")}, "offen/", "")
+
+	var unknown persistence.ErrUnknownAccount
+	if _, err := s.Get("account-z"); !errors.As(err, &unknown) {
+		t.Errorf("Expected unknown account error, got %v", err)
+	}
+	if err := s.Put("account-z", "body { color: red; }"); !errors.As(err, &unknown) {
+		t.Errorf("Expected unknown account error, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected object storage not to be requested, got %d requests", requests)
+	}
+}
+
+func TestS3Store_URL(t *testing.T) {
+	client, _ := s3.New("https://s3.example.com", "bucket", "us-east-1", "key", "secret")
+	if url := NewS3Store(client, &mockStylesDatabase{}, "offen/", "").(Redirector).URL("account-a"); url != "" {
+		t.Errorf("Expected empty URL without public URL, got %s", url)
+	}
+	url := NewS3Store(client, &mockStylesDatabase{}, "offen/", "https://cdn.example.com/").(Redirector).URL("account-a")
+	if url != "https://cdn.example.com/offen/account-styles/account-a.css" {
+		t.Errorf("Unexpected URL %s", url)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestListeners_NotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	listeners, err := Listeners()
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(listeners) != 0 {
+		t.Errorf("Unexpected listeners %v", listeners)
+	}
+	if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Error("Expected LISTEN_FDS to be unset")
+	}
+}
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := Notify(StateReady); sent || err != nil {
+		t.Errorf("Unexpected result %v %v", sent, err)
+	}
+
+	location := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: location, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", location)
+	sent, err := Notify(StateReady)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !sent {
+		t.Error("Expected notification to be sent")
+	}
+	b := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(b[:n]) != StateReady {
+		t.Errorf("Unexpected notification %s", string(b[:n]))
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	if interval, err := WatchdogInterval(); interval != 0 || err != nil {
+		t.Errorf("Unexpected result %v %v", interval, err)
+	}
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if interval, err := WatchdogInterval(); interval != time.Second*30 || err != nil {
+		t.Errorf("Unexpected result %v %v", interval, err)
+	}
+
+	t.Setenv("WATCHDOG_PID", "1")
+	if interval, err := WatchdogInterval(); interval != 0 || err != nil {
+		t.Errorf("Unexpected result %v %v", interval, err)
+	}
+
+	t.Setenv("WATCHDOG_PID", "")
+	t.Setenv("WATCHDOG_USEC", "soon")
+	if _, err := WatchdogInterval(); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+// Package webhook sends signed notifications about account lifecycle events
+// to endpoints registered by account admins.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/offen/offen/server/safehttp"
+)
+
+// The following headers are added to each request sent to an endpoint.
+const (
+	HeaderSignature = "X-Offen-Signature"
+	HeaderEvent     = "X-Offen-Event"
+	HeaderDelivery  = "X-Offen-Delivery"
+)
+
+// Delivery is a single notification that is sent to an endpoint.
+type Delivery struct {
+	ID      string
+	Event   string
+	URL     string
+	Secret  string
+	Payload []byte
+}
+
+// Sender sends a delivery and returns the status code the endpoint has
+// responded with.
+type Sender interface {
+	Send(d Delivery) (int, error)
+}
+
+// Errors returned by a Sender wrap one of the following values so that callers
+// can tell apart failures that might go away when retrying from those that
+// will not.
+var (
+	// ErrTemporary signals the endpoint could not be reached or responded
+	// with a status that indicates it might accept the delivery later.
+	ErrTemporary = errors.New("webhook: temporary failure")
+	// ErrRejected signals the endpoint refused to accept the delivery.
+	ErrRejected = errors.New("webhook: delivery rejected")
+)
+
+// IsTemporary returns true if err is a failure that might be resolved by
+// trying again later.
+func IsTemporary(err error) bool {
+	return errors.Is(err, ErrTemporary)
+}
+
+// Sign returns the signature of the given payload that is sent in the
+// X-Offen-Signature header. Receivers compute the HMAC-SHA256 of the raw
+// request body using their secret and compare it against the header value.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// HTTPSender sends deliveries as JSON encoded POST requests.
+type HTTPSender struct {
+	Client *http.Client
+}
+
+// NewHTTPSender creates a sender that gives up on requests after the given
+// timeout. As URLs are given by users, it only connects to public addresses
+// and does not follow redirects.
+func NewHTTPSender(timeout time.Duration) *HTTPSender {
+	return &HTTPSender{Client: safehttp.NewClient(timeout)}
+}
+
+// Send posts the payload of the given delivery to its URL.
+func (h *HTTPSender) Send(d Delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("%w: error creating request: %w", ErrRejected, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Offen-Webhook")
+	req.Header.Set(HeaderSignature, Sign(d.Secret, d.Payload))
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, d.ID)
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, safehttp.ErrForbiddenAddress) {
+			return 0, fmt.Errorf("%w: error sending request: %w", ErrRejected, err)
+		}
+		return 0, fmt.Errorf("%w: error sending request: %w", ErrTemporary, err)
+	}
+	defer res.Body.Close()
+	// the body is drained so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return res.StatusCode, nil
+	case res.StatusCode >= 500, res.StatusCode == http.StatusTooManyRequests, res.StatusCode == http.StatusRequestTimeout:
+		return res.StatusCode, fmt.Errorf("%w: endpoint responded with status %d", ErrTemporary, res.StatusCode)
+	default:
+		return res.StatusCode, fmt.Errorf("%w: endpoint responded with status %d", ErrRejected, res.StatusCode)
+	}
+}
+
+// Deliverer delivers all deliveries that are currently due using the given
+// sender and returns the number of successful deliveries.
+type Deliverer interface {
+	DeliverWebhooks(s Sender, maxAttempts int) (int, error)
+}
+
+// Dispatcher delivers pending notifications in the background.
+type Dispatcher struct {
+	DB     Deliverer
+	Sender Sender
+	// MaxAttempts is the number of times a delivery is attempted before it
+	// is marked as failed. Deliveries rejected by the endpoint are marked as
+	// failed right away.
+	MaxAttempts int
+	mu          sync.Mutex
+}
+
+// Deliver sends all notifications that are currently due and returns the
+// number of notifications that have been delivered. Concurrent calls are
+// serialized so that no notification is sent twice.
+func (d *Dispatcher) Deliver() (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivered, err := d.DB.DeliverWebhooks(d.Sender, d.MaxAttempts)
+	if err != nil {
+		return delivered, fmt.Errorf("webhook: error delivering notifications: %w", err)
+	}
+	return delivered, nil
+}
+
+// Run calls Deliver in the given interval until the context is cancelled.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration, onDelivered func(int), onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			delivered, err := d.Deliver()
+			if err != nil {
+				if onError != nil {
+					onError(err)
+				}
+				continue
+			}
+			if delivered != 0 && onDelivered != nil {
+				onDelivered(delivered)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2022 - Offen Authors <hioffen@posteo.de>
+// SPDX-License-Identifier: Apache-2.0
+
+package webhook
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	result := Sign("secret", []byte(`{"event":"account.created"}`))
+	if result != Sign("secret", []byte(`{"event":"account.created"}`)) {
+		t.Error("Expected signature to be stable")
+	}
+	if result == Sign("other-secret", []byte(`{"event":"account.created"}`)) {
+		t.Error("Expected signature to depend on secret")
+	}
+	if len(result) != len("sha256=")+64 {
+		t.Errorf("Unexpected signature %s", result)
+	}
+}
+
+func TestHTTPSender_Send(t *testing.T) {
+	tests := []struct {
+		name              string
+		status            int
+		expectError       bool
+		expectedTemporary bool
+	}{
+		{"ok", http.StatusNoContent, false, false},
+		{"server error", http.StatusBadGateway, true, true},
+		{"throttled", http.StatusTooManyRequests, true, true},
+		{"rejected", http.StatusGone, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if r.Header.Get(HeaderSignature) != Sign("secret", body) {
+					t.Errorf("Unexpected signature %s", r.Header.Get(HeaderSignature))
+				}
+				if r.Header.Get(HeaderEvent) != "user.joined" || r.Header.Get(HeaderDelivery) != "delivery-a" {
+					t.Errorf("Unexpected headers %v", r.Header)
+				}
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			sender := &HTTPSender{Client: server.Client()}
+			status, err := sender.Send(Delivery{
+				ID:      "delivery-a",
+				Event:   "user.joined",
+				URL:     server.URL,
+				Secret:  "secret",
+				Payload: []byte(`{}`),
+			})
+			if status != test.status {
+				t.Errorf("Unexpected status %d", status)
+			}
+			if (err != nil) != test.expectError {
+				t.Errorf("Unexpected error %v", err)
+			}
+			if IsTemporary(err) != test.expectedTemporary {
+				t.Errorf("Unexpected temporary value for %v", err)
+			}
+		})
+	}
+	t.Run("unreachable", func(t *testing.T) {
+		sender := &HTTPSender{Client: &http.Client{Timeout: time.Second}}
+		_, err := sender.Send(Delivery{URL: "http://127.0.0.1:0"})
+		if !IsTemporary(err) {
+			t.Errorf("Expected temporary error, got %v", err)
+		}
+	})
+	t.Run("private address", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("Unexpected request to private address")
+		}))
+		defer server.Close()
+		_, err := NewHTTPSender(time.Second).Send(Delivery{URL: server.URL})
+		if err == nil || IsTemporary(err) {
+			t.Errorf("Expected permanent error, got %v", err)
+		}
+	})
+}
+
+type mockDeliverer struct {
+	sender      Sender
+	maxAttempts int
+	err         error
+}
+
+func (m *mockDeliverer) DeliverWebhooks(s Sender, maxAttempts int) (int, error) {
+	m.sender = s
+	m.maxAttempts = maxAttempts
+	return 2, m.err
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		db := &mockDeliverer{}
+		sender := &HTTPSender{}
+		d := &Dispatcher{DB: db, Sender: sender, MaxAttempts: 4}
+		delivered, err := d.Deliver()
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if delivered != 2 || db.sender != sender || db.maxAttempts != 4 {
+			t.Errorf("Unexpected delivery parameters %d, %v, %d", delivered, db.sender, db.maxAttempts)
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		d := &Dispatcher{DB: &mockDeliverer{err: errors.New("did not work")}}
+		if _, err := d.Deliver(); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
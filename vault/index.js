@@ -6,6 +6,7 @@ var router = require('./src/router')
 var handler = require('./src/handler')
 var middleware = require('./src/middleware')
 var allowsCookies = require('./src/allows-cookies')
+var baseUrl = require('./src/base-url')
 
 if (!window.fetch) {
   require('unfetch/polyfill')
@@ -25,7 +26,7 @@ register('EVENT',
     handler.handleAnalyticsEvent(event.data)
       .then(function () {
         console.log(__('This page is using Offen Fair Web Analytics to collect usage statistics.'))
-        console.log(__('You can access and manage all of your personal data or opt-out at "%s/auditorium/".', window.location.origin))
+        console.log(__('You can access and manage all of your personal data or opt-out at "%s/auditorium/".', baseUrl))
         console.log(__('Find out more about Offen Fair Web Analytics at "https://www.offen.dev".'))
         respond(null)
       })
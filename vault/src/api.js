@@ -5,8 +5,9 @@
 
 var path = require('path')
 var handleFetchResponse = require('offen/fetch-response')
+var baseUrl = require('./base-url')
 
-exports.getAccount = getAccountWith(window.location.origin + '/api/accounts')
+exports.getAccount = getAccountWith(baseUrl + '/api/accounts')
 exports.getAccountWith = getAccountWith
 
 function getAccountWith (accountsUrl) {
@@ -23,7 +24,7 @@ function getAccountWith (accountsUrl) {
   }
 }
 
-exports.getEvents = getEventsWith(window.location.origin + '/api/events')
+exports.getEvents = getEventsWith(baseUrl + '/api/events')
 exports.getEventsWith = getEventsWith
 
 function getEventsWith (accountsUrl) {
@@ -49,26 +50,78 @@ function getEventsWith (accountsUrl) {
   }
 }
 
-exports.postEvent = postEventWith(window.location.origin + '/api/events')
+exports.postEvent = postEventWith(baseUrl + '/api/events')
 exports.postEventWith = postEventWith
 
 function postEventWith (eventsUrl) {
-  return function (accountId, payload) {
+  return function (accountId, payload, eventType) {
     var url = new window.URL(eventsUrl)
+    // The vault is served from the same origin as the API, so the server
+    // cannot tell which site has embedded it by looking at the request's
+    // Origin header. Accounts with verified domains reject events of
+    // other sites.
+    var headers = {}
+    var embeddingOrigin = getEmbeddingOrigin()
+    if (embeddingOrigin) {
+      headers['X-Offen-Embedding-Origin'] = embeddingOrigin
+    }
+    // The write key is passed by the script when embedding the vault.
+    var writeKey = new window.URL(window.location.href).searchParams.get('writeKey')
+    if (writeKey) {
+      headers['X-Offen-Write-Key'] = writeKey
+    }
     return window
       .fetch(url, {
         method: 'POST',
         credentials: 'include',
+        headers: headers,
         body: JSON.stringify({
           accountId: accountId,
-          payload: payload
+          payload: payload,
+          // custom event types registered for the account are passed
+          // in plaintext so the server can apply retention rules
+          eventType: eventType || undefined
         })
       })
       .then(handleFetchResponse)
   }
 }
 
-exports.getPublicKey = getPublicKeyWith(window.location.origin + '/api/exchange')
+exports.postPing = postPingWith(baseUrl + '/api/pings')
+exports.postPingWith = postPingWith
+
+function postPingWith (pingsUrl) {
+  return function (accountId) {
+    var url = new window.URL(pingsUrl)
+    var headers = {}
+    var embeddingOrigin = getEmbeddingOrigin()
+    if (embeddingOrigin) {
+      headers['X-Offen-Embedding-Origin'] = embeddingOrigin
+    }
+    return window
+      .fetch(url, {
+        method: 'POST',
+        // pings must not be linkable to the visitor sending them
+        credentials: 'omit',
+        headers: headers,
+        body: JSON.stringify({ accountId: accountId })
+      })
+      .then(handleFetchResponse)
+  }
+}
+
+function getEmbeddingOrigin () {
+  if (!document.referrer) {
+    return null
+  }
+  try {
+    return new window.URL(document.referrer).origin
+  } catch (err) {
+    return null
+  }
+}
+
+exports.getPublicKey = getPublicKeyWith(baseUrl + '/api/exchange')
 exports.getPublicKeyWith = getPublicKeyWith
 
 function getPublicKeyWith (exchangeUrl) {
@@ -82,12 +135,17 @@ function getPublicKeyWith (exchangeUrl) {
       })
       .then(handleFetchResponse)
       .then(function (response) {
-        return response.publicKey
+        // the nonce needs to be passed when posting the user secret
+        return {
+          publicKey: response.publicKey,
+          nonce: response.nonce,
+          timestamp: response.timestamp
+        }
       })
   }
 }
 
-exports.postUserSecret = postUserSecretWith(window.location.origin + '/api/exchange')
+exports.postUserSecret = postUserSecretWith(baseUrl + '/api/exchange')
 exports.postUserSecretWith = postUserSecretWith
 
 function postUserSecretWith (exchangeUrl) {
@@ -102,7 +160,7 @@ function postUserSecretWith (exchangeUrl) {
   }
 }
 
-exports.login = loginWith(window.location.origin + '/api/login')
+exports.login = loginWith(baseUrl + '/api/login')
 exports.loginWith = loginWith
 
 function loginWith (loginUrl) {
@@ -127,7 +185,7 @@ function loginWith (loginUrl) {
   }
 }
 
-exports.logout = logoutWith(window.location.origin + '/api/logout')
+exports.logout = logoutWith(baseUrl + '/api/logout')
 exports.logoutWith = logoutWith
 
 function logoutWith (logoutUrl) {
@@ -141,7 +199,7 @@ function logoutWith (logoutUrl) {
   }
 }
 
-exports.changePassword = changePasswordWith(window.location.origin + '/api/change-password')
+exports.changePassword = changePasswordWith(baseUrl + '/api/change-password')
 exports.changePasswordWith = changePasswordWith
 
 function changePasswordWith (loginUrl) {
@@ -159,7 +217,7 @@ function changePasswordWith (loginUrl) {
   }
 }
 
-exports.forgotPassword = forgotPasswordWith(window.location.origin + '/api/forgot-password')
+exports.forgotPassword = forgotPasswordWith(baseUrl + '/api/forgot-password')
 exports.forgotPasswordWith = forgotPasswordWith
 
 function forgotPasswordWith (forgotUrl) {
@@ -176,7 +234,7 @@ function forgotPasswordWith (forgotUrl) {
   }
 }
 
-exports.resetPassword = resetPasswordWith(window.location.origin + '/api/reset-password')
+exports.resetPassword = resetPasswordWith(baseUrl + '/api/reset-password')
 exports.resetPasswordWith = resetPasswordWith
 
 function resetPasswordWith (resetUrl) {
@@ -194,7 +252,7 @@ function resetPasswordWith (resetUrl) {
   }
 }
 
-exports.changeEmail = changeEmailWith(window.location.origin + '/api/change-email')
+exports.changeEmail = changeEmailWith(baseUrl + '/api/change-email')
 exports.changeEmailWith = changeEmailWith
 
 function changeEmailWith (loginUrl) {
@@ -213,7 +271,7 @@ function changeEmailWith (loginUrl) {
   }
 }
 
-exports.purge = purgeWith(window.location.origin + '/api/purge')
+exports.purge = purgeWith(baseUrl + '/api/purge')
 exports.purgeWith = purgeWith
 
 function purgeWith (purgeUrl) {
@@ -231,7 +289,7 @@ function purgeWith (purgeUrl) {
   }
 }
 
-exports.shareAccount = shareAccountWith(window.location.origin + '/api/share-account')
+exports.shareAccount = shareAccountWith(baseUrl + '/api/share-account')
 exports.shareAccountWith = shareAccountWith
 
 function shareAccountWith (inviteUrl) {
@@ -256,7 +314,7 @@ function shareAccountWith (inviteUrl) {
   }
 }
 
-exports.join = joinWith(window.location.origin + '/api/join')
+exports.join = joinWith(baseUrl + '/api/join')
 exports.joinWith = joinWith
 
 function joinWith (joinUrl) {
@@ -275,7 +333,7 @@ function joinWith (joinUrl) {
   }
 }
 
-exports.createAccount = createAccountWith(window.location.origin + '/api/accounts')
+exports.createAccount = createAccountWith(baseUrl + '/api/accounts')
 exports.createAccountWith = createAccountWith
 
 function createAccountWith (createUrl) {
@@ -294,7 +352,7 @@ function createAccountWith (createUrl) {
   }
 }
 
-exports.retireAccount = retireAccountWith(window.location.origin + '/api/accounts')
+exports.retireAccount = retireAccountWith(baseUrl + '/api/accounts')
 exports.retireAccountWith = retireAccountWith
 
 function retireAccountWith (deleteUrl) {
@@ -308,7 +366,7 @@ function retireAccountWith (deleteUrl) {
   }
 }
 
-exports.updateAccountStyles = updateAccountStylesWith(window.location.origin + '/api/accounts/:accountId/account-styles')
+exports.updateAccountStyles = updateAccountStylesWith(baseUrl + '/api/accounts/:accountId/account-styles')
 exports.updateAccountStylesWith = updateAccountStylesWith
 
 function updateAccountStylesWith (updateUrl) {
@@ -329,7 +387,7 @@ function updateAccountStylesWith (updateUrl) {
   }
 }
 
-exports.setup = setupWith(window.location.origin + '/api/setup')
+exports.setup = setupWith(baseUrl + '/api/setup')
 exports.setupWith = setupWith
 
 function setupWith (setupUrl) {
@@ -348,7 +406,7 @@ function setupWith (setupUrl) {
   }
 }
 
-exports.setupStatus = setupStatusWith(window.location.origin + '/api/setup')
+exports.setupStatus = setupStatusWith(baseUrl + '/api/setup')
 exports.setupStatusWith = setupStatusWith
 
 function setupStatusWith (setupUrl) {
@@ -0,0 +1,9 @@
+/**
+ * Copyright 2022 - Offen Authors <hioffen@posteo.de>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// The vault might be served below a path prefix in case the instance is
+// proxied from the domain of the embedding site, so all other resources are
+// resolved relative to the location of the vault.
+module.exports = window.location.origin + window.location.pathname.replace(/\/vault\/?$/, '')
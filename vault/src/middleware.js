@@ -4,6 +4,7 @@
  */
 
 var consentStatus = require('./user-consent')
+var api = require('./api')
 var getSessionId = require('./session-id')
 var zones = require('./zones')
 
@@ -38,6 +39,12 @@ function optIn (event, respond, next) {
       if (status === consentStatus.ALLOW) {
         return next()
       }
+      if (result.persist && isPageview(event) && pingsEnabled()) {
+        // visitors that declined consent are counted without being
+        // identifiable in case the instance accepts cookieless pings
+        api.postPing(event.data.payload.accountId)
+          .catch(function () {})
+      }
       console.log(__('This page is using Offen Fair Web Analytics to collect usage statistics.'))
       console.log(__('You have opted out of data collection, no data is being collected.'))
       console.log(__('Find out more about Offen Fair Web Analytics at "%s"', window.location.origin))
@@ -45,6 +52,16 @@ function optIn (event, respond, next) {
     })
 }
 
+function isPageview (event) {
+  var payload = event.data.payload
+  return Boolean(payload && payload.event && payload.event.type === 'PAGEVIEW')
+}
+
+function pingsEnabled () {
+  var host = document.querySelector('#host')
+  return Boolean(host && host.dataset.pings === 'true')
+}
+
 exports.eventDuplexer = eventDuplexer
 
 function eventDuplexer (event, respond, next) {
@@ -25,8 +25,11 @@ function relayEventWith (api, ensureUserSecret) {
         return encryptEventPayload(payload)
       })
       .then(function (encryptedEventPayload) {
+        var eventType = typeof payload.eventType === 'string'
+          ? payload.eventType
+          : null
         return api
-          .postEvent(accountId, encryptedEventPayload)
+          .postEvent(accountId, encryptedEventPayload, eventType)
           .catch(function (err) {
             // a 400 response is sent in case no cookie is present in the request.
             // This means the secret exchange can happen one more time
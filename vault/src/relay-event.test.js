@@ -51,6 +51,24 @@ describe('src/relay-event.js', function () {
         })
     })
 
+    it('passes custom event types in plaintext', function () {
+      var eventTypes = []
+      var mockApi = {
+        postEvent: function (accountId, payload, eventType) {
+          eventTypes.push(eventType)
+          return Promise.resolve()
+        }
+      }
+      var relayEvent = relayEventWith(mockApi, mockEnsureUserSecret)
+      return relayEvent('account-id-token', { payload: 'data', eventType: 'signup' })
+        .then(function () {
+          return relayEvent('account-id-token', { payload: 'data' })
+        })
+        .then(function () {
+          assert.deepStrictEqual(eventTypes, ['signup', null])
+        })
+    })
+
     it('retries on a 400 error', function () {
       var numCalled = 0
       var mockApi = {
@@ -10,6 +10,8 @@ var consentBanner = require('offen/consent-banner')
 var ALLOW = 'allow'
 var DENY = 'deny'
 var COOKIE_NAME = 'consent'
+var POLICY_COOKIE_PREFIX = 'consentPolicy-'
+var DEFAULT_MAX_AGE = 100 * 365 * 24 * 60 * 60
 
 exports.ALLOW = ALLOW
 exports.DENY = DENY
@@ -86,15 +88,47 @@ exports.get = getConsentStatus
 
 function getConsentStatus () {
   var matches = cookies.parse(document.cookie)
-  return matches[COOKIE_NAME] || null
+  var status = matches[COOKIE_NAME] || null
+  var policy = consentPolicy()
+  // in case the operator of the account has changed their privacy terms
+  // since the decision has been made, the user needs to be asked again
+  if (status && policy.version && matches[policyCookieName(policy.accountId)] !== policy.version) {
+    return null
+  }
+  return status
 }
 
 exports.set = setConsentStatus
 
 function setConsentStatus (status) {
-  var expires = new Date(Date.now() + 100 * 365 * 24 * 60 * 60 * 1000)
+  var policy = consentPolicy()
+  var expires = new Date(Date.now() + policy.maxAge * 1000)
   var cookie = cookies.defaultCookie(COOKIE_NAME, status, { expires: expires })
   document.cookie = cookies.serialize(cookie)
+  if (policy.version) {
+    var versionCookie = cookies.defaultCookie(
+      policyCookieName(policy.accountId), policy.version, { expires: expires }
+    )
+    document.cookie = cookies.serialize(versionCookie)
+  }
+}
+
+// consentPolicy reads the policy the server passes when rendering the vault
+// for an account.
+function consentPolicy () {
+  var host = document.querySelector('#host')
+  var data = (host && host.dataset) || {}
+  var maxAge = parseInt(data.consentMaxAge, 10)
+  var accountId = new window.URLSearchParams(window.location.search).get('accountId')
+  return {
+    maxAge: maxAge > 0 ? maxAge : DEFAULT_MAX_AGE,
+    version: accountId ? data.consentVersion || null : null,
+    accountId: accountId
+  }
+}
+
+function policyCookieName (accountId) {
+  return POLICY_COOKIE_PREFIX + accountId
 }
 
 exports.withConsentGiven = withConsentGiven
@@ -15,5 +15,28 @@ describe('src/user-consent.js', function () {
         assert.strictEqual(result, null)
       })
     })
+    context('with a changed policy version', function () {
+      var host
+      beforeEach(function () {
+        host = document.createElement('div')
+        host.id = 'host'
+        host.dataset.consentVersion = '2'
+        document.body.appendChild(host)
+        window.history.replaceState(null, '', '?accountId=account-a')
+        document.cookie = 'consent=allow'
+        document.cookie = 'consentPolicy-account-a=1'
+      })
+      afterEach(function () {
+        document.body.removeChild(host)
+        window.history.replaceState(null, '', window.location.pathname)
+        document.cookie = 'consent=; expires=Thu, 01 Jan 1970 00:00:00 GMT'
+        document.cookie = 'consentPolicy-account-a=; expires=Thu, 01 Jan 1970 00:00:00 GMT'
+      })
+      it('returns null', function () {
+        assert.strictEqual(consentStatus.get(), null)
+        document.cookie = 'consentPolicy-account-a=2'
+        assert.strictEqual(consentStatus.get(), 'allow')
+      })
+    })
   })
 })
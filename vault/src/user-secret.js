@@ -58,12 +58,18 @@ var generateNewUserSecret = bindCrypto(function (publicJwk) {
 })
 
 function exchangeUserSecret (api, accountId) {
+  var exchange
   return api.getPublicKey(accountId)
-    .then(generateNewUserSecret)
+    .then(function (_exchange) {
+      exchange = _exchange
+      return generateNewUserSecret(exchange.publicKey)
+    })
     .then(function (result) {
       var body = {
         accountId: accountId,
-        encryptedSecret: result.encryptedUserSecret
+        encryptedSecret: result.encryptedUserSecret,
+        nonce: exchange.nonce,
+        timestamp: exchange.timestamp
       }
       return api.postUserSecret(body)
         .then(function () {
@@ -7,20 +7,28 @@ var assert = require('assert')
 
 var ensureUserSecret = require('./user-secret')
 
-var response = {
+var publicKey = {
   kty: 'RSA',
   n: 'sWDRHwcAfKv1dykP9-Qu-JeRjbmqiVpgzTHgDGMxqkj0ftGhAURBqxAV0CbYXyNGb8g23Jta5JkskwAZ6iugU4bo19T-hqjrGNTm-hynKhtniuvkoxxyzmxnKMlq27k_gdMR_z2Zdoj3mUveRDaAXyaoPmS0ode-s9jSb030KzPhnjcQpa338Qx9Q5BF7MWuQ6013atmU3dM7ibuJ4kwrh_a2b4dj95onh1tPklGYgS1i1fgGWXP16oW1YlAmUtUUFtdnVnNPfSAyMNy1myV2H7q8ZPcZKOz_IyHgAHuB0D6WuIJ-03OzlinxX9RTAS-4dX_vXh7hP24v9-hxIlVIdd9iCQM65shwmXa2NfHYDEaPFo7M-lz_-jHCqCoZIYP3q88hGW9QeVGxAFL3AIJcUb5JRFhw2XqYUUZhLNBBWHUJEmseYP3k4NZr3gG90WTCfxhOmCTzPnCrr9QBINY-ijcyJgPvGEUK8ucq3NdASBQpkHyVcjmr6tmKBDal6jma5xXVX7IexuRINYImGZIuWKF8KTqvaIECR-yP9GdWjAPChHa29j0lZbkUuZbwgeJO5O2GVlImYazz3pR-xRJMOU8N2wipTcCnXJT4oOEYxe3NAv2ulqQESEvS42tb-l0QPDzah4jns86zMAwLNx7hIXas8C77vu9SaQjEzv1tdE',
   e: 'AQAB'
 }
 
+var response = {
+  publicKey: publicKey,
+  nonce: 'bm9uY2U.abc123',
+  timestamp: '2022-06-01T12:00:00Z'
+}
+
 describe('src/user-secret.js', function () {
   describe('ensureUserSecret(accountId)', function () {
     it('handles the key exchange', function () {
+      var posted = []
       var mockApi = {
         getPublicKey: function () {
           return Promise.resolve(response)
         },
-        postUserSecret: function () {
+        postUserSecret: function (body) {
+          posted.push(body)
           return Promise.resolve()
         }
       }
@@ -42,6 +50,9 @@ describe('src/user-secret.js', function () {
         })
         .then(function (nextKey) {
           assert.notDeepStrictEqual(initialKey, nextKey)
+          assert.strictEqual(posted.length, 2)
+          assert.strictEqual(posted[0].nonce, response.nonce)
+          assert.strictEqual(posted[0].timestamp, response.timestamp)
         })
     })
 